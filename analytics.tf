@@ -0,0 +1,250 @@
+# GA4 purchase and refund forwarding. EventBridge delivers completed orders
+# and refunded payments to a queue ga4-forwarder drains in batches; the
+# events are stitched to the client and session recorded on the order's
+# checkout and sent with the Measurement Protocol. Messages that keep
+# failing move to the dead-letter queue after five attempts.
+resource "aws_sqs_queue" "ga4_events_dlq" {
+  name                      = "${var.project_name}-ga4-events-dlq"
+  message_retention_seconds = 1209600
+  sqs_managed_sse_enabled   = true
+
+  tags = {
+    Name        = "${var.project_name}-ga4-events-dlq"
+    Environment = var.environment
+  }
+}
+
+resource "aws_sqs_queue" "ga4_events" {
+  name                       = "${var.project_name}-ga4-events"
+  visibility_timeout_seconds = 360
+  sqs_managed_sse_enabled    = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.ga4_events_dlq.arn
+    maxReceiveCount     = 5
+  })
+
+  tags = {
+    Name        = "${var.project_name}-ga4-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "ga4_events" {
+  name           = "${var.project_name}-ga4-events"
+  description    = "Completed orders and refunded payments forwarded to GA4"
+  event_bus_name = aws_cloudwatch_event_bus.ecommerce.name
+
+  event_pattern = jsonencode({
+    "$or" = [
+      {
+        source        = ["ecommerce.order-service"]
+        "detail-type" = ["Order Completed"]
+      },
+      {
+        source        = ["ecommerce.payment-service"]
+        "detail-type" = ["Payment Refunded"]
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-ga4-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_target" "ga4_events" {
+  rule           = aws_cloudwatch_event_rule.ga4_events.name
+  event_bus_name = aws_cloudwatch_event_bus.ecommerce.name
+  target_id      = "GA4Events"
+  arn            = aws_sqs_queue.ga4_events.arn
+}
+
+resource "aws_sqs_queue_policy" "ga4_events" {
+  queue_url = aws_sqs_queue.ga4_events.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = "events.amazonaws.com" }
+        Action    = "sqs:SendMessage"
+        Resource  = aws_sqs_queue.ga4_events.arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = aws_cloudwatch_event_rule.ga4_events.arn
+          }
+        }
+      }
+    ]
+  })
+}
+
+# Bus events already sent, so a redelivered one is not counted twice in
+# GA4. Records expire after 30 days via TTL.
+resource "aws_dynamodb_table" "ga4_forwarded_events" {
+  name         = "${var.project_name}-ga4-forwarded-events"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "event_id"
+
+  attribute {
+    name = "event_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-ga4-forwarded-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_secretsmanager_secret" "ga4_measurement_protocol" {
+  name                    = "${var.project_name}/ga4/measurement-protocol"
+  description             = "GA4 Measurement Protocol measurement ID and API secret"
+  recovery_window_in_days = 0
+
+  tags = {
+    Name        = "${var.project_name}-ga4-measurement-protocol"
+    Environment = var.environment
+  }
+}
+
+resource "aws_secretsmanager_secret_version" "ga4_measurement_protocol" {
+  secret_id = aws_secretsmanager_secret.ga4_measurement_protocol.id
+  secret_string = jsonencode({
+    measurement_id = var.ga4_measurement_id
+    api_secret     = var.ga4_api_secret
+  })
+}
+
+resource "aws_iam_role" "ga4_forwarder" {
+  name = "${var.project_name}-ga4-forwarder-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-ga4-forwarder-role"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "ga4_forwarder" {
+  name = "${var.project_name}-ga4-forwarder-policy"
+  role = aws_iam_role.ga4_forwarder.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "logs:CreateLogGroup",
+          "logs:CreateLogStream",
+          "logs:PutLogEvents"
+        ]
+        Resource = "arn:aws:logs:*:*:*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:GetQueueAttributes"
+        ]
+        Resource = [aws_sqs_queue.ga4_events.arn]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem"]
+        Resource = [aws_dynamodb_table.checkouts.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:PutItem",
+          "dynamodb:DeleteItem"
+        ]
+        Resource = [aws_dynamodb_table.ga4_forwarded_events.arn]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["secretsmanager:GetSecretValue"]
+        Resource = [aws_secretsmanager_secret.ga4_measurement_protocol.arn]
+      }
+    ]
+  })
+}
+
+data "archive_file" "ga4_forwarder_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/lambda/ga4-forwarder"
+  output_path = "${path.module}/lambda/ga4-forwarder.zip"
+}
+
+resource "aws_lambda_function" "ga4_forwarder" {
+  filename         = data.archive_file.ga4_forwarder_lambda.output_path
+  source_code_hash = data.archive_file.ga4_forwarder_lambda.output_base64sha256
+  function_name    = "${var.project_name}-ga4-forwarder"
+  role             = aws_iam_role.ga4_forwarder.arn
+  handler          = "main"
+  runtime          = "go1.x"
+  timeout          = 60
+  memory_size      = 256
+
+  environment {
+    variables = {
+      GA4_SECRET_ARN              = aws_secretsmanager_secret.ga4_measurement_protocol.arn
+      CHECKOUTS_TABLE_NAME        = aws_dynamodb_table.checkouts.name
+      FORWARDED_EVENTS_TABLE_NAME = aws_dynamodb_table.ga4_forwarded_events.name
+      GA4_DEBUG_VALIDATION        = tostring(var.ga4_debug_validation)
+      ENVIRONMENT                 = var.environment
+    }
+  }
+
+  tags = {
+    Name        = "${var.project_name}-ga4-forwarder"
+    Environment = var.environment
+  }
+}
+
+# Up to 25 events, one Measurement Protocol request's worth, are batched
+# per invocation; failed messages are retried on their own.
+resource "aws_lambda_event_source_mapping" "ga4_forwarder" {
+  event_source_arn                   = aws_sqs_queue.ga4_events.arn
+  function_name                      = aws_lambda_function.ga4_forwarder.arn
+  batch_size                         = 25
+  maximum_batching_window_in_seconds = 30
+  function_response_types            = ["ReportBatchItemFailures"]
+}
+
+resource "aws_cloudwatch_log_group" "ga4_forwarder_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.ga4_forwarder.function_name}"
+  retention_in_days = 14
+
+  tags = {
+    Name        = "${var.project_name}-ga4-forwarder-logs"
+    Environment = var.environment
+  }
+}
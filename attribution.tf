@@ -0,0 +1,159 @@
+# Multi-touch attribution. A daily lambda spreads every attributed order
+# over the touchpoints attribution-service recorded for it under the linear,
+# time-decay and position-based models, alongside last-click, and stores the
+# credit per model, day and campaign in the attribution-models table, which
+# reports-service compares models from. Each day is also exported as CSV to
+# a private bucket for Athena and QuickSight.
+
+resource "aws_s3_bucket" "attribution_models" {
+  bucket = "${var.project_name}-attribution-models-${random_string.suffix.result}"
+
+  tags = {
+    Name        = "${var.project_name}-attribution-models"
+    Environment = var.environment
+  }
+}
+
+resource "aws_s3_bucket_public_access_block" "attribution_models" {
+  bucket = aws_s3_bucket.attribution_models.id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "attribution_models" {
+  bucket = aws_s3_bucket.attribution_models.id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+resource "aws_iam_role" "attribution_modeler" {
+  name = "${var.project_name}-attribution-modeler-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-attribution-modeler-role"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "attribution_modeler" {
+  name = "${var.project_name}-attribution-modeler-policy"
+  role = aws_iam_role.attribution_modeler.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "logs:CreateLogGroup",
+          "logs:CreateLogStream",
+          "logs:PutLogEvents"
+        ]
+        Resource = "arn:aws:logs:*:*:*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Query"]
+        Resource = "${aws_dynamodb_table.attributions.arn}/index/status-ordered_at-index"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchWriteItem"]
+        Resource = aws_dynamodb_table.attribution_models.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:PutObject"]
+        Resource = "${aws_s3_bucket.attribution_models.arn}/attribution_models/*"
+      }
+    ]
+  })
+}
+
+data "archive_file" "attribution_modeler_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/lambda/attribution-modeler"
+  output_path = "${path.module}/lambda/attribution-modeler.zip"
+}
+
+resource "aws_lambda_function" "attribution_modeler" {
+  filename         = data.archive_file.attribution_modeler_lambda.output_path
+  source_code_hash = data.archive_file.attribution_modeler_lambda.output_base64sha256
+  function_name    = "${var.project_name}-attribution-modeler"
+  role             = aws_iam_role.attribution_modeler.arn
+  handler          = "main"
+  runtime          = "go1.x"
+  timeout          = 900
+  memory_size      = 512
+
+  environment {
+    variables = {
+      ATTRIBUTIONS_TABLE_NAME       = aws_dynamodb_table.attributions.name
+      ATTRIBUTION_MODELS_TABLE_NAME = aws_dynamodb_table.attribution_models.name
+      ATTRIBUTION_MODELS_BUCKET     = aws_s3_bucket.attribution_models.id
+      REFRESH_DAYS                  = "3"
+      ENVIRONMENT                   = var.environment
+    }
+  }
+
+  tags = {
+    Name        = "${var.project_name}-attribution-modeler"
+    Environment = var.environment
+  }
+}
+
+# Daily at 02:30 UTC, once yesterday's orders have been attributed
+resource "aws_cloudwatch_event_rule" "attribution_modeler_schedule" {
+  name                = "${var.project_name}-attribution-modeler-schedule"
+  description         = "Daily multi-touch attribution modeling"
+  schedule_expression = "cron(30 2 * * ? *)"
+
+  tags = {
+    Name        = "${var.project_name}-attribution-modeler-schedule"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_target" "attribution_modeler" {
+  rule      = aws_cloudwatch_event_rule.attribution_modeler_schedule.name
+  target_id = "AttributionModelerTarget"
+  arn       = aws_lambda_function.attribution_modeler.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_attribution_modeler" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.attribution_modeler.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.attribution_modeler_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "attribution_modeler_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.attribution_modeler.function_name}"
+  retention_in_days = 14
+
+  tags = {
+    Name        = "${var.project_name}-attribution-modeler-logs"
+    Environment = var.environment
+  }
+}
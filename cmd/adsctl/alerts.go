@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"pkg/envelope"
+	"pkg/notify"
+)
+
+// tailAlerts prints the alerts published to the alerts topic until
+// interrupted. SNS keeps nothing, so it subscribes a queue of its own for
+// the duration and removes both when it stops.
+func tailAlerts(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("alerts", flag.ExitOnError)
+	topic := fs.String("topic", os.Getenv("SNS_TOPIC_ARN"), "alerts topic ARN (required)")
+	customer := fs.String("customer", "", "only this account's alerts")
+	types := fs.String("types", strings.Join([]string{notify.KindCampaignAlert, notify.KindAlertGroup, notify.KindBudgetOrderAlert}, ","),
+		"comma-separated message types to show")
+	duration := fs.Duration("for", 0, "stop after this long (default until interrupted)")
+	fs.Parse(args)
+	if *topic == "" {
+		return fmt.Errorf("-topic is required")
+	}
+	show := make(map[string]bool)
+	for _, t := range strings.Split(*types, ",") {
+		show[strings.TrimSpace(t)] = true
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	t, err := subscribe(ctx, c, *topic)
+	if err != nil {
+		return err
+	}
+	defer t.close()
+	log.Printf("Tailing %s; Ctrl-C to stop", *topic)
+
+	codec := envelope.New("adsctl", nil, "", c.clk)
+	for ctx.Err() == nil {
+		out, err := t.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(t.queueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     20,
+		})
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive alerts: %w", err)
+		}
+		for _, m := range out.Messages {
+			printAlert(ctx, c, codec, aws.ToString(m.Body), customerID(*customer), show)
+			t.sqs.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(t.queueURL), ReceiptHandle: m.ReceiptHandle})
+		}
+	}
+	return nil
+}
+
+// printAlert prints one published message if it is of a type shown, for
+// the account shown.
+func printAlert(ctx context.Context, c *ctl, codec *envelope.Codec, raw, customer string, show map[string]bool) {
+	env, err := codec.Open(ctx, raw)
+	if errors.Is(err, envelope.ErrNotEnvelope) {
+		return
+	}
+	if err != nil {
+		log.Printf("Skipping message: %v", err)
+		return
+	}
+	if !show[env.Type] || (customer != "" && env.Tenant != customer) {
+		return
+	}
+	if c.json {
+		c.print(env)
+		return
+	}
+
+	var body struct {
+		AlertType    string            `json:"alert_type"`
+		Cause        string            `json:"cause"`
+		CampaignName string            `json:"campaign_name"`
+		Message      string            `json:"message"`
+		Alerts       []json.RawMessage `json:"alerts"`
+	}
+	if err := env.Decode(&body); err != nil {
+		log.Printf("Skipping %s %s: %v", env.Type, env.ID, err)
+		return
+	}
+	kind := body.AlertType
+	if env.Type == notify.KindAlertGroup {
+		kind = fmt.Sprintf("%s (%d alerts)", body.Cause, len(body.Alerts))
+	}
+	if kind == "" {
+		kind = env.Type
+	}
+	fmt.Printf("%s  %s  %s  %s: %s\n", env.PublishedAt.Local().Format(time.RFC3339), env.Tenant, kind, body.CampaignName, body.Message)
+}
+
+// tail is the queue subscribed to the topic for one tailAlerts.
+type tail struct {
+	sns             *sns.Client
+	sqs             *sqs.Client
+	queueURL        string
+	subscriptionARN string
+}
+
+// subscribe creates a queue only the topic may send to and subscribes it
+// with raw delivery, so messages arrive as the envelopes published.
+func subscribe(ctx context.Context, c *ctl, topicARN string) (*tail, error) {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	t := &tail{sns: sns.NewFromConfig(c.cfg), sqs: sqs.NewFromConfig(c.cfg)}
+
+	queue, err := t.sqs.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName: aws.String(fmt.Sprintf("%s-adsctl-alerts-%s", c.project, hex.EncodeToString(suffix))),
+		Attributes: map[string]string{
+			// The queue outlives a killed adsctl by at most a day of
+			// messages.
+			string(sqstypes.QueueAttributeNameMessageRetentionPeriod): "86400",
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create queue: %w", err)
+	}
+	t.queueURL = aws.ToString(queue.QueueUrl)
+
+	attrs, err := t.sqs.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("failed to get queue ARN: %w", err)
+	}
+	queueARN := attrs.Attributes[string(sqstypes.QueueAttributeNameQueueArn)]
+	policy, _ := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "sns.amazonaws.com"},
+			"Action":    "sqs:SendMessage",
+			"Resource":  queueARN,
+			"Condition": map[string]interface{}{"ArnEquals": map[string]string{"aws:SourceArn": topicARN}},
+		}},
+	})
+	_, err = t.sqs.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   queue.QueueUrl,
+		Attributes: map[string]string{string(sqstypes.QueueAttributeNamePolicy): string(policy)},
+	})
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("failed to set queue policy: %w", err)
+	}
+
+	sub, err := t.sns.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn:              aws.String(topicARN),
+		Protocol:              aws.String("sqs"),
+		Endpoint:              aws.String(queueARN),
+		Attributes:            map[string]string{"RawMessageDelivery": "true"},
+		ReturnSubscriptionArn: true,
+	})
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", topicARN, err)
+	}
+	t.subscriptionARN = aws.ToString(sub.SubscriptionArn)
+	return t, nil
+}
+
+// close unsubscribes and deletes the queue. It runs after the tail's
+// context is done, so it uses a context of its own.
+func (t *tail) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if t.subscriptionARN != "" {
+		if _, err := t.sns.Unsubscribe(ctx, &sns.UnsubscribeInput{SubscriptionArn: aws.String(t.subscriptionARN)}); err != nil {
+			log.Printf("Failed to unsubscribe %s: %v", t.subscriptionARN, err)
+		}
+	}
+	if _, err := t.sqs.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: aws.String(t.queueURL)}); err != nil {
+		log.Printf("Failed to delete queue %s: %v", t.queueURL, err)
+	}
+}
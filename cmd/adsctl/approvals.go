@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/approval"
+	"pkg/bidaudit"
+	"pkg/dynamo"
+)
+
+func (c *ctl) approvals() *approval.Store {
+	table := c.name("APPROVALS_TABLE_NAME", "%s-google-ads-approvals-%s")
+	return approval.NewStore(dynamo.NewTable(dynamodb.NewFromConfig(c.cfg), table, dynamo.WithConsistentReads(true)), c.clk)
+}
+
+func (c *ctl) bidAudit() *bidaudit.Store {
+	table := c.name("BID_AUDIT_TABLE_NAME", "%s-google-ads-bid-audit-%s")
+	return bidaudit.NewStore(dynamo.NewTable(dynamodb.NewFromConfig(c.cfg), table), c.clk)
+}
+
+// listApprovals lists the bid changes in one status, PENDING by default,
+// oldest first.
+func listApprovals(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("approvals", flag.ExitOnError)
+	customer := fs.String("customer", "", "only this account's changes")
+	status := fs.String("status", approval.StatusPending, "status to list")
+	limit := fs.Int("limit", 50, "most changes to show, 0 for all")
+	fs.Parse(args)
+
+	items, err := c.approvals().All(ctx, strings.ToUpper(*status), customerID(*customer))
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(items) > *limit {
+		log.Printf("Showing the oldest %d of %d", *limit, len(items))
+		items = items[:*limit]
+	}
+	if c.json {
+		return c.print(items)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APPROVAL\tCUSTOMER\tCAMPAIGN\tKEYWORD\tCURRENT\tRECOMMENDED\tIMPACT/DAY\tDECIDE BY")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", item.ApprovalID, item.CustomerID, item.CampaignName, item.KeywordText,
+			item.CurrentBid, item.RecommendedBid, item.Impact, item.DecideBy.Local().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// decide returns the approve or reject command. Each ID is decided on its
+// own; the command fails if any of them could not be.
+func decide(approve bool) func(ctx context.Context, c *ctl, args []string) error {
+	verb := map[bool]string{true: "approve", false: "reject"}[approve]
+	return func(ctx context.Context, c *ctl, args []string) error {
+		fs := flag.NewFlagSet(verb, flag.ExitOnError)
+		actor := fs.String("as", getEnv("ADSCTL_ACTOR", os.Getenv("USER")), "who is deciding, recorded on the change")
+		note := fs.String("note", "", "note recorded with the decision")
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: adsctl %s [-as actor] [-note text] <approval ID>...\n", verb)
+			fs.PrintDefaults()
+		}
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *actor == "" {
+			return fmt.Errorf("-as is required when USER is unset")
+		}
+
+		store := c.approvals()
+		var failed int
+		for _, id := range fs.Args() {
+			item, err := store.Decide(ctx, id, approve, *actor, *note)
+			switch {
+			case errors.Is(err, dynamo.ErrNotFound):
+				log.Printf("%s: no such approval", id)
+			case errors.Is(err, approval.ErrNotPending), errors.Is(err, approval.ErrWindowClosed):
+				log.Printf("%s: %v", id, err)
+			case err != nil:
+				return fmt.Errorf("failed to %s %s: %w", verb, id, err)
+			default:
+				log.Printf("%s: %s by %s (%s %s -> %s)", id, item.Status, *actor, item.KeywordText, item.CurrentBid, item.RecommendedBid)
+				continue
+			}
+			failed++
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d approvals not decided", failed, fs.NArg())
+		}
+		return nil
+	}
+}
+
+// audit shows the newest applied changes. With -customer it reads the
+// account's part of the log; without it scans the log over -days.
+func audit(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	customer := fs.String("customer", "", "only this account's changes")
+	campaign := fs.String("campaign", "", "only this campaign's changes; needs -customer")
+	runID := fs.String("run", "", "only the changes of this optimizer run")
+	changeType := fs.String("type", "", "only changes of this type: KEYWORD_BID, AD_SCHEDULE or BUDGET")
+	days := fs.Int("days", 7, "how many days back to look")
+	limit := fs.Int("limit", 20, "most changes to show")
+	fs.Parse(args)
+	if *campaign != "" && *customer == "" {
+		return fmt.Errorf("-campaign needs -customer")
+	}
+
+	now := c.clk.Now().UTC()
+	filter := bidaudit.Filter{
+		CustomerID: customerID(*customer),
+		CampaignID: *campaign,
+		RunID:      *runID,
+		Type:       strings.ToUpper(*changeType),
+		From:       now.AddDate(0, 0, -*days),
+		To:         now,
+	}
+	store := c.bidAudit()
+	var records []bidaudit.Record
+	if filter.CustomerID != "" {
+		page, err := store.List(ctx, filter, int32(*limit), "")
+		if err != nil {
+			return err
+		}
+		records = page.Items
+	} else {
+		all, err := store.All(ctx, filter)
+		if err != nil {
+			return err
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].AppliedAt.After(all[j].AppliedAt) })
+		if len(all) > *limit {
+			all = all[:*limit]
+		}
+		records = all
+	}
+
+	if c.json {
+		return c.print(records)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APPLIED\tCUSTOMER\tTYPE\tCAMPAIGN\tKEYWORD\tOLD\tNEW\tACTOR\tRUN")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.AppliedAt.Local().Format(time.RFC3339), r.CustomerID, r.Type,
+			campaignLabel(r), r.KeywordText, r.OldValue, r.NewValue, r.Actor, r.RunID)
+	}
+	return w.Flush()
+}
+
+func campaignLabel(r bidaudit.Record) string {
+	if r.CampaignName != "" {
+		return r.CampaignName
+	}
+	return r.CampaignID
+}
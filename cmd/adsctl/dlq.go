@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// dlqPolls bounds how many receives dlq makes looking for messages; each
+// returns up to ten.
+const dlqPolls = 10
+
+// dlq lists a dead-letter queue's messages or moves one back to the queue
+// it came from. Messages are only hidden while they are looked at, so
+// listing leaves the queue as it was.
+func dlq(ctx context.Context, c *ctl, args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "replay") {
+		fmt.Fprintf(os.Stderr, "Usage: adsctl dlq list|replay [flags]\n")
+		os.Exit(2)
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("dlq "+action, flag.ExitOnError)
+	queue := fs.String("queue", c.name("DLQ_NAME", "%s-google-ads-bid-optimizer-accounts-dlq-%s"), "dead-letter queue name or URL")
+	id := fs.String("id", "", "replay: message ID to replay (default the first received)")
+	to := fs.String("to", "", "replay: queue URL to replay to (default the queue the DLQ serves)")
+	limit := fs.Int("limit", 20, "list: most messages to show")
+	fs.Parse(args[1:])
+
+	client := sqs.NewFromConfig(c.cfg)
+	dlqURL, err := queueURL(ctx, client, *queue)
+	if err != nil {
+		return err
+	}
+	if action == "list" {
+		return listDLQ(ctx, c, client, dlqURL, *limit)
+	}
+
+	target := *to
+	if target == "" {
+		if target, err = sourceQueue(ctx, client, dlqURL); err != nil {
+			return err
+		}
+	}
+	msg, err := findMessage(ctx, client, dlqURL, *id)
+	if err != nil {
+		return err
+	}
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(target),
+		MessageBody:       msg.Body,
+		MessageAttributes: msg.MessageAttributes,
+	})
+	if err != nil {
+		release(ctx, client, dlqURL, []sqstypes.Message{*msg})
+		return fmt.Errorf("failed to send message %s to %s: %w", aws.ToString(msg.MessageId), target, err)
+	}
+	// A failed delete leaves the message on both queues; saying so beats
+	// silently replaying it twice.
+	if _, err := client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(dlqURL), ReceiptHandle: msg.ReceiptHandle}); err != nil {
+		return fmt.Errorf("replayed message %s but failed to delete it from the DLQ: %w", aws.ToString(msg.MessageId), err)
+	}
+	log.Printf("Replayed message %s to %s", aws.ToString(msg.MessageId), target)
+	return nil
+}
+
+// queueURL returns name's URL; URLs are returned as they are.
+func queueURL(ctx context.Context, client *sqs.Client, name string) (string, error) {
+	if strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://") {
+		return name, nil
+	}
+	out, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return "", fmt.Errorf("failed to find queue %s: %w", name, err)
+	}
+	return aws.ToString(out.QueueUrl), nil
+}
+
+// sourceQueue returns the queue whose redrive policy points at dlqURL,
+// failing unless there is exactly one.
+func sourceQueue(ctx context.Context, client *sqs.Client, dlqURL string) (string, error) {
+	out, err := client.ListDeadLetterSourceQueues(ctx, &sqs.ListDeadLetterSourceQueuesInput{QueueUrl: aws.String(dlqURL)})
+	if err != nil {
+		return "", fmt.Errorf("failed to list the queues the DLQ serves: %w", err)
+	}
+	if len(out.QueueUrls) != 1 {
+		return "", fmt.Errorf("the DLQ serves %d queues; pick one with -to", len(out.QueueUrls))
+	}
+	return out.QueueUrls[0], nil
+}
+
+// receive hides up to ten messages for a minute.
+func receive(ctx context.Context, client *sqs.Client, dlqURL string) ([]sqstypes.Message, error) {
+	out, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(dlqURL),
+		MaxNumberOfMessages:   10,
+		VisibilityTimeout:     60,
+		WaitTimeSeconds:       1,
+		AttributeNames:        []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll},
+		MessageAttributeNames: []string{"All"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive from %s: %w", dlqURL, err)
+	}
+	return out.Messages, nil
+}
+
+// release makes messages visible again straight away.
+func release(ctx context.Context, client *sqs.Client, dlqURL string, msgs []sqstypes.Message) {
+	for _, m := range msgs {
+		_, err := client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(dlqURL),
+			ReceiptHandle:     m.ReceiptHandle,
+			VisibilityTimeout: 0,
+		})
+		if err != nil {
+			log.Printf("Failed to release message %s, it is hidden for another minute: %v", aws.ToString(m.MessageId), err)
+		}
+	}
+}
+
+// findMessage receives until it has the message with ID id, or any
+// message when id is empty, and releases the others.
+func findMessage(ctx context.Context, client *sqs.Client, dlqURL, id string) (*sqstypes.Message, error) {
+	var held []sqstypes.Message
+	defer func() { release(ctx, client, dlqURL, held) }()
+	for i := 0; i < dlqPolls; i++ {
+		msgs, err := receive(ctx, client, dlqURL)
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		for j, m := range msgs {
+			if id == "" || aws.ToString(m.MessageId) == id {
+				held = append(held, msgs[:j]...)
+				held = append(held, msgs[j+1:]...)
+				return &m, nil
+			}
+		}
+		held = append(held, msgs...)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("the DLQ is empty")
+	}
+	return nil, fmt.Errorf("message %s not found in the first %d messages", id, len(held))
+}
+
+// listDLQ shows up to limit messages with their receive counts, then
+// releases them.
+func listDLQ(ctx context.Context, c *ctl, client *sqs.Client, dlqURL string, limit int) error {
+	var held []sqstypes.Message
+	defer func() { release(ctx, client, dlqURL, held) }()
+	for i := 0; i < dlqPolls && len(held) < limit; i++ {
+		msgs, err := receive(ctx, client, dlqURL)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		held = append(held, msgs...)
+	}
+	shown := held
+	if len(shown) > limit {
+		shown = shown[:limit]
+	}
+
+	if c.json {
+		type message struct {
+			ID         string            `json:"id"`
+			Attributes map[string]string `json:"attributes"`
+			Body       string            `json:"body"`
+		}
+		out := make([]message, 0, len(shown))
+		for _, m := range shown {
+			out = append(out, message{ID: aws.ToString(m.MessageId), Attributes: m.Attributes, Body: aws.ToString(m.Body)})
+		}
+		return c.print(out)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MESSAGE\tSENT\tRECEIVES\tBODY")
+	for _, m := range shown {
+		sent := m.Attributes[string(sqstypes.MessageSystemAttributeNameSentTimestamp)]
+		if ms, err := strconv.ParseInt(sent, 10, 64); err == nil {
+			sent = time.UnixMilli(ms).Local().Format(time.RFC3339)
+		}
+		body := aws.ToString(m.Body)
+		if len(body) > 80 {
+			body = body[:77] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", aws.ToString(m.MessageId), sent,
+			m.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)], body)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,140 @@
+// Command adsctl is the operator's tool for the Google Ads functions. It
+// works on the same tables, queues, topic and functions they do, with the
+// caller's AWS credentials:
+//
+//	dry-run    ask bid-optimizer what it would recommend for one account
+//	approvals  list bid changes waiting for a decision
+//	approve    approve pending bid changes
+//	reject     reject pending bid changes
+//	audit      show recently applied bid, schedule and budget changes
+//	dlq        list or replay the messages on a dead-letter queue
+//	alerts     tail the alerts published from now on
+//
+// Resource names follow the Terraform naming from -project and -env; each
+// can be overridden with the environment variable the functions read,
+// such as APPROVALS_TABLE_NAME.
+//
+// Usage:
+//
+//	adsctl [-project ecommerce-platform] [-env dev] [-json] <command> [flags]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"pkg/clock"
+	_ "pkg/localdev"
+)
+
+// command is one adsctl subcommand; run gets the arguments after its
+// name.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, c *ctl, args []string) error
+}
+
+var commands = []command{
+	{"dry-run", "ask bid-optimizer what it would recommend for one account", dryRun},
+	{"approvals", "list bid changes waiting for a decision", listApprovals},
+	{"approve", "approve pending bid changes", decide(true)},
+	{"reject", "reject pending bid changes", decide(false)},
+	{"audit", "show recently applied changes", audit},
+	{"dlq", "list or replay the messages on a dead-letter queue", dlq},
+	{"alerts", "tail the alerts published from now on", tailAlerts},
+}
+
+// ctl is what every command shares.
+type ctl struct {
+	cfg         aws.Config
+	clk         clock.Clock
+	project     string
+	environment string
+	json        bool
+}
+
+func main() {
+	var (
+		project     = flag.String("project", getEnv("PROJECT_NAME", "ecommerce-platform"), "Terraform project_name")
+		environment = flag.String("env", getEnv("ENVIRONMENT", "dev"), "Terraform environment")
+		asJSON      = flag.Bool("json", false, "print JSON instead of tables")
+	)
+	flag.Usage = usage
+	flag.Parse()
+	log.SetFlags(0)
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+	c := &ctl{cfg: cfg, clk: clock.Real{}, project: *project, environment: *environment, json: *asJSON}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(ctx, c, args); err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+			return
+		}
+	}
+	log.Printf("Unknown command %q", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: adsctl [flags] <command> [command flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// name returns the resource name in the environment variable key, or the
+// one Terraform gives it: format filled with the project and environment.
+func (c *ctl) name(key, format string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	if strings.Count(format, "%s") == 2 {
+		return fmt.Sprintf(format, c.project, c.environment)
+	}
+	return fmt.Sprintf(format, c.project)
+}
+
+// print writes v as indented JSON.
+func (c *ctl) print(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// customerID strips the dashes Google Ads shows customer IDs with.
+func customerID(id string) string {
+	return strings.ReplaceAll(strings.TrimSpace(id), "-", "")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
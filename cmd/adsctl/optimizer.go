@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+
+	"pkg/money"
+)
+
+// dryRunReport is the part of bid-optimizer's DryRunReport shown as a
+// table; -json prints the whole report.
+type dryRunReport struct {
+	CustomerID      string `json:"customer_id"`
+	Mode            string `json:"mode"`
+	ConfigHash      string `json:"config_hash"`
+	Recommendations []struct {
+		CampaignName     string      `json:"campaign_name"`
+		KeywordText      string      `json:"keyword_text"`
+		CurrentBid       money.Money `json:"current_bid"`
+		RecommendedBid   money.Money `json:"recommended_bid"`
+		OptimizationType string      `json:"optimization_type"`
+		Cohort           string      `json:"cohort"`
+	} `json:"recommendations"`
+	AdSchedules            []json.RawMessage `json:"ad_schedule_recommendations"`
+	BudgetReallocations    []json.RawMessage `json:"budget_reallocations"`
+	ProductRecommendations []json.RawMessage `json:"product_recommendations"`
+}
+
+// dryRun invokes bid-optimizer with dry_run set, which plans the one
+// account and returns the plan without filing, applying or publishing
+// anything.
+func dryRun(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("dry-run", flag.ExitOnError)
+	customer := fs.String("customer", "", "customer ID, or platform:ID for Microsoft and Meta accounts (required)")
+	mode := fs.String("mode", "", `run mode: "" for bids, schedules and products, or "budgets"`)
+	function := fs.String("function", c.name("BID_OPTIMIZER_FUNCTION_NAME", "%s-bid-optimizer"), "bid-optimizer function")
+	fs.Parse(args)
+	if *customer == "" {
+		return fmt.Errorf("-customer is required")
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"dry_run":     true,
+		"customer_id": customerID(*customer),
+		"mode":        *mode,
+	})
+	if err != nil {
+		return err
+	}
+	out, err := lambda.NewFromConfig(c.cfg).Invoke(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(*function),
+		Payload:      payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to invoke %s: %w", *function, err)
+	}
+	if out.FunctionError != nil {
+		return fmt.Errorf("%s failed: %s", *function, out.Payload)
+	}
+
+	if c.json {
+		var report json.RawMessage = out.Payload
+		return c.print(report)
+	}
+	var report dryRunReport
+	if err := json.Unmarshal(out.Payload, &report); err != nil {
+		return fmt.Errorf("failed to decode report: %w", err)
+	}
+	fmt.Printf("Dry run for %s (mode %q, config %s): %d bid, %d ad schedule, %d budget and %d product recommendations\n\n",
+		report.CustomerID, report.Mode, report.ConfigHash, len(report.Recommendations),
+		len(report.AdSchedules), len(report.BudgetReallocations), len(report.ProductRecommendations))
+	if len(report.Recommendations) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CAMPAIGN\tKEYWORD\tCURRENT\tRECOMMENDED\tTYPE\tCOHORT")
+	for _, r := range report.Recommendations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.CampaignName, r.KeywordText, r.CurrentBid, r.RecommendedBid, r.OptimizationType, r.Cohort)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,207 @@
+// Command e2e runs the Google Ads pipeline end to end against LocalStack
+// and a mock Google Ads API, so a change can be verified without deploying
+// to dev.
+//
+// It provisions ephemeral tables, a topic with a queue subscribed, a bucket
+// and a secret in LocalStack; seeds the fixture account; builds the
+// functions and runs each one as Lambda would, through an emulated Runtime
+// API; and checks what every step published and stored:
+//
+//	monitor   campaign-monitor raises the fixture alert and records its run
+//	optimize  bid-optimizer reports bid and ad schedule recommendations
+//	apply     bid-optimizer applies the ad schedule through a mutate
+//	report    report-exporter writes the search term partition
+//
+// Usage, from this directory with LocalStack running:
+//
+//	go run . [-endpoint http://localhost.localstack.cloud:4566] [-steps monitor,apply] [-keep]
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+
+	"pkg/adsstub"
+)
+
+func main() {
+	var (
+		endpoint   = flag.String("endpoint", getEnv("AWS_ENDPOINT_URL", "http://localhost.localstack.cloud:4566"), "LocalStack endpoint")
+		root       = flag.String("root", "../..", "repository root")
+		fixtures   = flag.String("fixtures", "fixtures", "fixture directory")
+		only       = flag.String("steps", "", "comma-separated steps to run (default all)")
+		keep       = flag.Bool("keep", false, "keep the provisioned resources for inspection")
+		clockStart = flag.String("clock", "2024-01-15T08:00:00Z", "TEST_CLOCK_START for the functions")
+		timeout    = flag.Duration("timeout", 2*time.Minute, "per-function timeout")
+		wait       = flag.Duration("wait", 20*time.Second, "how long to wait for published messages")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+
+	ctx := context.Background()
+	if err := run(ctx, *endpoint, *root, *fixtures, *only, *keep, *clockStart, *timeout, *wait); err != nil {
+		log.Printf("FAIL: %v", err)
+		os.Exit(1)
+	}
+	log.Printf("PASS")
+}
+
+func run(ctx context.Context, endpoint, root, fixtures, only string, keep bool, clockStart string, timeout, wait time.Duration) error {
+	selected, err := selectSteps(only)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	ads, err := adsstub.Load(filepath.Join(fixtures, "googleads.json"))
+	if err != nil {
+		return err
+	}
+	adsServer, err := ads.Start("127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer adsServer.Close()
+	adsEndpoint := adsServer.URL
+
+	s := newStack(cfg, endpoint, "e2e-"+randomSuffix())
+	log.Printf("Provisioning %s resources in %s", s.prefix, endpoint)
+	if !keep {
+		defer s.teardown(context.Background())
+	}
+	if err := s.provision(ctx); err != nil {
+		return err
+	}
+	accounts, err := loadSeedAccounts(filepath.Join(fixtures, "accounts.json"))
+	if err != nil {
+		return err
+	}
+	if err := s.seed(ctx, accounts); err != nil {
+		return err
+	}
+
+	bin, err := os.MkdirTemp("", "e2e-bin-")
+	if err != nil {
+		return fmt.Errorf("failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(bin)
+
+	binaries := make(map[string]string)
+	for _, st := range selected {
+		if _, ok := binaries[st.Function]; ok {
+			continue
+		}
+		log.Printf("Building %s", st.Function)
+		binary, err := buildFunction(ctx, root, bin, st.Function)
+		if err != nil {
+			return err
+		}
+		binaries[st.Function] = binary
+	}
+
+	p := newPipeline(s, ads, wait)
+	env := s.functionEnv(endpoint, adsEndpoint, clockStart)
+	var failed []string
+	for _, st := range selected {
+		started := time.Now()
+		ads.Reset()
+		err := runStep(ctx, p, st, binaries[st.Function], env, timeout)
+		for _, call := range ads.Unmatched() {
+			log.Printf("  no fixture for query: %s", call.Query)
+		}
+		if err != nil {
+			log.Printf("FAIL %s (%s): %v", st.Name, time.Since(started).Round(time.Millisecond), err)
+			failed = append(failed, st.Name)
+			continue
+		}
+		log.Printf("PASS %s (%s)", st.Name, time.Since(started).Round(time.Millisecond))
+	}
+
+	if keep {
+		log.Printf("Kept resources with prefix %s", s.prefix)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d steps failed: %s", len(failed), len(selected), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runStep(ctx context.Context, p *pipeline, st step, binary string, env []string, timeout time.Duration) error {
+	result, err := invoke(ctx, st.Function, binary, []byte(st.Event), append(env, st.Env...), timeout)
+	if err != nil {
+		return err
+	}
+	if result.Error {
+		return fmt.Errorf("%s returned an error: %s", st.Function, result.Body)
+	}
+	return st.Check(ctx, p)
+}
+
+func selectSteps(only string) ([]step, error) {
+	if only == "" {
+		return steps, nil
+	}
+	var selected []step
+	for _, name := range strings.Split(only, ",") {
+		found := false
+		for _, st := range steps {
+			if st.Name == strings.TrimSpace(name) {
+				selected = append(selected, st)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown step %q", name)
+		}
+	}
+	return selected, nil
+}
+
+func loadSeedAccounts(path string) ([]seedAccount, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accounts fixture: %w", err)
+	}
+	var accounts []seedAccount
+	if err := decodeJSON(string(raw), &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse accounts fixture: %w", err)
+	}
+	return accounts, nil
+}
+
+// Utility functions
+func decodeJSON(raw string, v interface{}) error {
+	return json.Unmarshal([]byte(raw), v)
+}
+
+func randomSuffix() string {
+	var b [4]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
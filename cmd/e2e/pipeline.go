@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"pkg/adsstub"
+	"pkg/clock"
+	"pkg/envelope"
+	"pkg/runlog"
+)
+
+// Fixture IDs the assertions expect; see fixtures/googleads.json.
+const (
+	fixtureCustomerID       = "1234567890"
+	fixtureUnprofitable     = "2001"
+	fixtureScheduleCampaign = "2002"
+	fixtureKeywordID        = "4001"
+	fixtureExistingSchedule = "customers/1234567890/campaignCriteria/2002~9001"
+	fixtureSearchTerm       = "running shoes sale"
+	fixtureReportDate       = "2024-01-14"
+)
+
+// step runs one function and checks what it left behind.
+type step struct {
+	Name     string
+	Function string
+	Event    string
+	Env      []string
+	Check    func(ctx context.Context, p *pipeline) error
+}
+
+// steps is the pipeline in order: monitor → optimizer → apply → report.
+var steps = []step{
+	{
+		Name:     "monitor",
+		Function: "campaign-monitor",
+		Event:    `{}`,
+		Check:    checkMonitor,
+	},
+	{
+		Name:     "optimize",
+		Function: "bid-optimizer",
+		Event:    `{}`,
+		Env:      []string{"AD_SCHEDULE_APPLY=false"},
+		Check:    checkOptimize,
+	},
+	{
+		Name:     "apply",
+		Function: "bid-optimizer",
+		Event:    `{}`,
+		Env:      []string{"AD_SCHEDULE_APPLY=true"},
+		Check:    checkApply,
+	},
+	{
+		Name:     "report",
+		Function: "report-exporter",
+		Event:    `{"reports": ["search_terms"], "start_date": "` + fixtureReportDate + `", "end_date": "` + fixtureReportDate + `"}`,
+		Check:    checkReport,
+	},
+}
+
+type pipeline struct {
+	stack *stack
+	ads   *adsstub.Server
+	codec *envelope.Codec
+	wait  time.Duration
+}
+
+func newPipeline(s *stack, ads *adsstub.Server, wait time.Duration) *pipeline {
+	return &pipeline{stack: s, ads: ads, codec: envelope.New("e2e", nil, "", clock.Real{}), wait: wait}
+}
+
+func checkMonitor(ctx context.Context, p *pipeline) error {
+	var alerts []struct {
+		CampaignID string `json:"campaign_id"`
+		AlertType  string `json:"alert_type"`
+		RunID      string `json:"run_id"`
+		ConfigHash string `json:"config_hash"`
+	}
+	if err := p.receive(ctx, "campaign_alert", &alerts); err != nil {
+		return err
+	}
+
+	run, err := p.latestRun(ctx, "campaign-monitor")
+	if err != nil {
+		return err
+	}
+	if run.Status != runlog.StatusSucceeded {
+		return fmt.Errorf("campaign-monitor run %s is %s, want %s", run.RunID, run.Status, runlog.StatusSucceeded)
+	}
+
+	for _, alert := range alerts {
+		if alert.CampaignID != fixtureUnprofitable || alert.AlertType != "HIGH_COST_NO_CONVERSIONS" {
+			continue
+		}
+		if alert.RunID != run.RunID || alert.ConfigHash != run.ConfigHash {
+			return fmt.Errorf("alert carries run %s/%s, want %s/%s", alert.RunID, alert.ConfigHash, run.RunID, run.ConfigHash)
+		}
+		return nil
+	}
+	return fmt.Errorf("no HIGH_COST_NO_CONVERSIONS alert for campaign %s among %d alerts", fixtureUnprofitable, len(alerts))
+}
+
+type bidReport struct {
+	RunID           string `json:"run_id"`
+	Recommendations []struct {
+		KeywordID        string          `json:"keyword_id"`
+		OptimizationType string          `json:"optimization_type"`
+		Projection       json.RawMessage `json:"projection"`
+	} `json:"recommendations"`
+	AdSchedules []struct {
+		CampaignID string `json:"campaign_id"`
+		Status     string `json:"status"`
+	} `json:"ad_schedule_recommendations"`
+}
+
+func checkOptimize(ctx context.Context, p *pipeline) error {
+	var reports []bidReport
+	if err := p.receive(ctx, "bid_report", &reports); err != nil {
+		return err
+	}
+	report := reports[len(reports)-1]
+
+	var increased, projected bool
+	for _, rec := range report.Recommendations {
+		if rec.KeywordID == fixtureKeywordID && rec.OptimizationType == "INCREASE_BID" {
+			increased = true
+			projected = len(rec.Projection) > 0
+		}
+	}
+	if !increased {
+		return fmt.Errorf("bid report has no INCREASE_BID for keyword %s", fixtureKeywordID)
+	}
+	if !projected {
+		return fmt.Errorf("INCREASE_BID for keyword %s has no bid simulator projection", fixtureKeywordID)
+	}
+
+	if err := p.expectSchedule(ctx, "RECOMMENDED"); err != nil {
+		return err
+	}
+	if calls := p.ads.Mutates("campaignCriteria"); len(calls) > 0 {
+		return fmt.Errorf("ad schedules were mutated %d times with AD_SCHEDULE_APPLY=false", len(calls))
+	}
+	return nil
+}
+
+func checkApply(ctx context.Context, p *pipeline) error {
+	var reports []bidReport
+	if err := p.receive(ctx, "bid_report", &reports); err != nil {
+		return err
+	}
+
+	calls := p.ads.Mutates("campaignCriteria")
+	if len(calls) != 1 {
+		return fmt.Errorf("got %d ad schedule mutates, want 1", len(calls))
+	}
+	var removed, created int
+	for _, op := range calls[0].Operations {
+		switch {
+		case strings.Contains(string(op), fixtureExistingSchedule):
+			removed++
+		case strings.Contains(string(op), "adSchedule"):
+			created++
+		}
+	}
+	if removed != 1 || created == 0 {
+		return fmt.Errorf("mutate removed %d and created %d schedules, want the existing one replaced", removed, created)
+	}
+
+	if err := p.expectSchedule(ctx, "APPLIED"); err != nil {
+		return err
+	}
+	run, err := p.latestRun(ctx, "bid-optimizer")
+	if err != nil {
+		return err
+	}
+	if !run.Config.FeatureFlags["ad_schedule_apply"] {
+		return fmt.Errorf("bid-optimizer run %s did not record ad_schedule_apply", run.RunID)
+	}
+	return nil
+}
+
+func checkReport(ctx context.Context, p *pipeline) error {
+	key := fmt.Sprintf("search_terms/date=%s/%s.csv", fixtureReportDate, fixtureCustomerID)
+	obj, err := p.stack.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(p.stack.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer obj.Body.Close()
+
+	body, err := io.ReadAll(obj.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	if !strings.Contains(string(body), fixtureSearchTerm) {
+		return fmt.Errorf("%s does not contain search term %q", key, fixtureSearchTerm)
+	}
+	return nil
+}
+
+// receive collects the bodies of msgType envelopes published to the topic,
+// waiting up to p.wait for the first. Every received message is deleted,
+// so the next step starts with an empty queue. out must point to a slice.
+func (p *pipeline) receive(ctx context.Context, msgType string, out interface{}) error {
+	var bodies []string
+	deadline := time.Now().Add(p.wait)
+	for {
+		resp, err := p.stack.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(p.stack.QueueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     1,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to receive messages: %w", err)
+		}
+		for _, msg := range resp.Messages {
+			p.stack.sqs.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(p.stack.QueueURL),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+			env, err := p.codec.Open(ctx, aws.ToString(msg.Body))
+			if err != nil {
+				return fmt.Errorf("failed to open published message: %w", err)
+			}
+			if env.Type == msgType {
+				bodies = append(bodies, string(env.Body))
+			}
+		}
+
+		// Stop once messages have arrived and the queue has drained.
+		if len(bodies) > 0 && len(resp.Messages) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			if len(bodies) == 0 {
+				return fmt.Errorf("no %s message published within %s", msgType, p.wait)
+			}
+			break
+		}
+	}
+
+	return decodeJSON("["+strings.Join(bodies, ",")+"]", out)
+}
+
+func (p *pipeline) latestRun(ctx context.Context, function string) (runlog.Run, error) {
+	result, err := p.stack.db.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(p.stack.RunsTable),
+		KeyConditionExpression: aws.String("#function = :function"),
+		ExpressionAttributeNames: map[string]string{
+			"#function": "function",
+		},
+		ExpressionAttributeValues: map[string]dbtypes.AttributeValue{
+			":function": &dbtypes.AttributeValueMemberS{Value: function},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(1),
+	})
+	if err != nil {
+		return runlog.Run{}, fmt.Errorf("failed to query runs: %w", err)
+	}
+	if len(result.Items) == 0 {
+		return runlog.Run{}, fmt.Errorf("no %s run recorded", function)
+	}
+
+	var run runlog.Run
+	if err := attributevalue.UnmarshalMap(result.Items[0], &run); err != nil {
+		return runlog.Run{}, fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+	return run, nil
+}
+
+func (p *pipeline) expectSchedule(ctx context.Context, status string) error {
+	result, err := p.stack.db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(p.stack.AdSchedulesTable),
+		Key: map[string]dbtypes.AttributeValue{
+			"customer_id": &dbtypes.AttributeValueMemberS{Value: fixtureCustomerID},
+			"campaign_id": &dbtypes.AttributeValueMemberS{Value: fixtureScheduleCampaign},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get ad schedule recommendation: %w", err)
+	}
+	if result.Item == nil {
+		return errors.New("no ad schedule recommendation stored for campaign " + fixtureScheduleCampaign)
+	}
+
+	var rec struct {
+		Status string `dynamodbav:"status"`
+		Error  string `dynamodbav:"error"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &rec); err != nil {
+		return fmt.Errorf("failed to unmarshal ad schedule recommendation: %w", err)
+	}
+	if rec.Status != status {
+		return fmt.Errorf("ad schedule recommendation is %s (%s), want %s", rec.Status, rec.Error, status)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// stack is one run's ephemeral LocalStack resources. Every name carries the
+// run's prefix, so concurrent runs against one LocalStack do not collide.
+type stack struct {
+	prefix string
+
+	AccountsTable    string
+	RunsTable        string
+	AdSchedulesTable string
+	TopicARN         string
+	QueueURL         string
+	Bucket           string
+	SecretARN        string
+
+	db      *dynamodb.Client
+	sns     *sns.Client
+	sqs     *sqs.Client
+	s3      *s3.Client
+	secrets *secretsmanager.Client
+}
+
+type tableSpec struct {
+	name     *string
+	hashKey  string
+	rangeKey string
+}
+
+func newStack(cfg aws.Config, endpoint, prefix string) *stack {
+	return &stack{
+		prefix: prefix,
+		db: dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+		}),
+		sns: sns.NewFromConfig(cfg, func(o *sns.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+		}),
+		sqs: sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+		}),
+		s3: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}),
+		secrets: secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+		}),
+	}
+}
+
+// provision creates the tables, topic, queue, bucket and secret the
+// functions use. The queue is subscribed to the topic with raw delivery,
+// so it receives the published envelopes as they are.
+func (s *stack) provision(ctx context.Context) error {
+	s.AccountsTable = s.prefix + "-accounts"
+	s.RunsTable = s.prefix + "-runs"
+	s.AdSchedulesTable = s.prefix + "-ad-schedules"
+	s.Bucket = s.prefix + "-reports"
+
+	tables := []tableSpec{
+		{name: &s.AccountsTable, hashKey: "customer_id"},
+		{name: &s.RunsTable, hashKey: "function", rangeKey: "run_id"},
+		{name: &s.AdSchedulesTable, hashKey: "customer_id", rangeKey: "campaign_id"},
+	}
+	for _, t := range tables {
+		if err := s.createTable(ctx, t); err != nil {
+			return err
+		}
+	}
+
+	topic, err := s.sns.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String(s.prefix + "-alerts")})
+	if err != nil {
+		return fmt.Errorf("failed to create topic: %w", err)
+	}
+	s.TopicARN = aws.ToString(topic.TopicArn)
+
+	queue, err := s.sqs.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String(s.prefix + "-notifications")})
+	if err != nil {
+		return fmt.Errorf("failed to create queue: %w", err)
+	}
+	s.QueueURL = aws.ToString(queue.QueueUrl)
+	attrs, err := s.sqs.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get queue ARN: %w", err)
+	}
+	_, err = s.sns.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn:   topic.TopicArn,
+		Protocol:   aws.String("sqs"),
+		Endpoint:   aws.String(attrs.Attributes[string(sqstypes.QueueAttributeNameQueueArn)]),
+		Attributes: map[string]string{"RawMessageDelivery": "true"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe queue to topic: %w", err)
+	}
+
+	if _, err := s.s3.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(s.Bucket)}); err != nil {
+		return fmt.Errorf("failed to create bucket: %w", err)
+	}
+
+	return nil
+}
+
+func (s *stack) createTable(ctx context.Context, t tableSpec) error {
+	input := &dynamodb.CreateTableInput{
+		TableName:   t.name,
+		BillingMode: dbtypes.BillingModePayPerRequest,
+		AttributeDefinitions: []dbtypes.AttributeDefinition{
+			{AttributeName: aws.String(t.hashKey), AttributeType: dbtypes.ScalarAttributeTypeS},
+		},
+		KeySchema: []dbtypes.KeySchemaElement{
+			{AttributeName: aws.String(t.hashKey), KeyType: dbtypes.KeyTypeHash},
+		},
+	}
+	if t.rangeKey != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions,
+			dbtypes.AttributeDefinition{AttributeName: aws.String(t.rangeKey), AttributeType: dbtypes.ScalarAttributeTypeS})
+		input.KeySchema = append(input.KeySchema,
+			dbtypes.KeySchemaElement{AttributeName: aws.String(t.rangeKey), KeyType: dbtypes.KeyTypeRange})
+	}
+	if _, err := s.db.CreateTable(ctx, input); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", *t.name, err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(s.db)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: t.name}, time.Minute); err != nil {
+		return fmt.Errorf("table %s did not become active: %w", *t.name, err)
+	}
+	return nil
+}
+
+// seedAccount is an onboarded account as the ads-api stores it.
+type seedAccount struct {
+	CustomerID       string `json:"customer_id" dynamodbav:"customer_id"`
+	DescriptiveName  string `json:"descriptive_name" dynamodbav:"descriptive_name"`
+	CurrencyCode     string `json:"currency_code" dynamodbav:"currency_code"`
+	TimeZone         string `json:"time_zone" dynamodbav:"time_zone"`
+	Status           string `json:"status" dynamodbav:"status"`
+	MonitorEnabled   bool   `json:"monitor_enabled" dynamodbav:"monitor_enabled"`
+	OptimizerEnabled bool   `json:"optimizer_enabled" dynamodbav:"optimizer_enabled"`
+}
+
+// seed stores the fixture accounts and placeholder Google Ads credentials;
+// the mock server does not check them.
+func (s *stack) seed(ctx context.Context, accounts []seedAccount) error {
+	for _, account := range accounts {
+		item, err := attributevalue.MarshalMap(account)
+		if err != nil {
+			return fmt.Errorf("failed to marshal account: %w", err)
+		}
+		_, err = s.db.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(s.AccountsTable), Item: item})
+		if err != nil {
+			return fmt.Errorf("failed to seed account %s: %w", account.CustomerID, err)
+		}
+	}
+
+	credentials, _ := json.Marshal(map[string]string{
+		"client_id":       "e2e",
+		"client_secret":   "e2e",
+		"refresh_token":   "e2e",
+		"developer_token": "e2e",
+	})
+	secret, err := s.secrets.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+		Name:         aws.String(s.prefix + "/google-ads/credentials"),
+		SecretString: aws.String(string(credentials)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create secret: %w", err)
+	}
+	s.SecretARN = aws.ToString(secret.ARN)
+	return nil
+}
+
+// teardown deletes whatever provision and seed created. Failures are
+// logged: LocalStack state is disposable.
+func (s *stack) teardown(ctx context.Context) {
+	for _, table := range []string{s.AccountsTable, s.RunsTable, s.AdSchedulesTable} {
+		if table == "" {
+			continue
+		}
+		if _, err := s.db.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(table)}); err != nil {
+			log.Printf("Failed to delete table %s: %v", table, err)
+		}
+	}
+	if s.QueueURL != "" {
+		if _, err := s.sqs.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: aws.String(s.QueueURL)}); err != nil {
+			log.Printf("Failed to delete queue: %v", err)
+		}
+	}
+	if s.TopicARN != "" {
+		if _, err := s.sns.DeleteTopic(ctx, &sns.DeleteTopicInput{TopicArn: aws.String(s.TopicARN)}); err != nil {
+			log.Printf("Failed to delete topic: %v", err)
+		}
+	}
+	if s.SecretARN != "" {
+		_, err := s.secrets.DeleteSecret(ctx, &secretsmanager.DeleteSecretInput{
+			SecretId:                   aws.String(s.SecretARN),
+			ForceDeleteWithoutRecovery: aws.Bool(true),
+		})
+		if err != nil {
+			log.Printf("Failed to delete secret: %v", err)
+		}
+	}
+	if s.Bucket != "" {
+		s.emptyBucket(ctx)
+		if _, err := s.s3.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(s.Bucket)}); err != nil {
+			log.Printf("Failed to delete bucket: %v", err)
+		}
+	}
+}
+
+func (s *stack) emptyBucket(ctx context.Context) {
+	paginator := s3.NewListObjectsV2Paginator(s.s3, &s3.ListObjectsV2Input{Bucket: aws.String(s.Bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Failed to list bucket: %v", err)
+			return
+		}
+		for _, obj := range page.Contents {
+			if _, err := s.s3.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.Bucket), Key: obj.Key}); err != nil {
+				log.Printf("Failed to delete %s: %v", aws.ToString(obj.Key), err)
+			}
+		}
+	}
+}
+
+// functionEnv is the environment every function runs with: the stack's
+// resources, LocalStack for AWS and the mock server for Google Ads.
+func (s *stack) functionEnv(endpoint, adsEndpoint, clockStart string) []string {
+	return []string{
+		"AWS_ENDPOINT_URL=" + endpoint,
+		"AWS_REGION=us-east-1",
+		"AWS_ACCESS_KEY_ID=test",
+		"AWS_SECRET_ACCESS_KEY=test",
+		"ENVIRONMENT=e2e",
+		"TEST_MODE=true",
+		"TEST_CLOCK_START=" + clockStart,
+		"GOOGLE_ADS_ENDPOINT=" + adsEndpoint,
+		"GOOGLE_ADS_SECRET_ARN=" + s.SecretARN,
+		"GOOGLE_ADS_RETRY_MAX_ATTEMPTS=1",
+		"SNS_TOPIC_ARN=" + s.TopicARN,
+		"ACCOUNTS_TABLE_NAME=" + s.AccountsTable,
+		"RUNS_TABLE_NAME=" + s.RunsTable,
+		"AD_SCHEDULE_TABLE_NAME=" + s.AdSchedulesTable,
+		"REPORTS_BUCKET=" + s.Bucket,
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// invocationResult is what a function posted back for its invocation.
+type invocationResult struct {
+	Body  []byte
+	Error bool
+}
+
+// runtimeAPI emulates the Lambda Runtime API for a single invocation, so
+// the functions run exactly as built for Lambda: lambda.Start polls it for
+// the event and posts the handler's result back.
+type runtimeAPI struct {
+	function  string
+	requestID string
+	event     []byte
+	deadline  time.Time
+	result    chan invocationResult
+
+	mu     sync.Mutex
+	served bool
+}
+
+func (r *runtimeAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	const prefix = "/2018-06-01/runtime/"
+	path := strings.TrimPrefix(req.URL.Path, prefix)
+
+	switch {
+	case req.Method == http.MethodGet && path == "invocation/next":
+		r.mu.Lock()
+		served := r.served
+		r.served = true
+		r.mu.Unlock()
+		if served {
+			// The function asks for its next event once it has answered;
+			// hold it until it is stopped.
+			<-req.Context().Done()
+			return
+		}
+		w.Header().Set("Lambda-Runtime-Aws-Request-Id", r.requestID)
+		w.Header().Set("Lambda-Runtime-Deadline-Ms", strconv.FormatInt(r.deadline.UnixMilli(), 10))
+		w.Header().Set("Lambda-Runtime-Invoked-Function-Arn", "arn:aws:lambda:us-east-1:000000000000:function:"+r.function)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(r.event)
+
+	case req.Method == http.MethodPost && path == "invocation/"+r.requestID+"/response":
+		r.finish(w, req, false)
+
+	case req.Method == http.MethodPost && (path == "invocation/"+r.requestID+"/error" || path == "init/error"):
+		r.finish(w, req, true)
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *runtimeAPI) finish(w http.ResponseWriter, req *http.Request, failed bool) {
+	body, _ := io.ReadAll(req.Body)
+	w.WriteHeader(http.StatusAccepted)
+	select {
+	case r.result <- invocationResult{Body: body, Error: failed}:
+	default:
+	}
+}
+
+// buildFunction compiles lambda/<name> into dir and returns the binary.
+func buildFunction(ctx context.Context, root, dir, name string) (string, error) {
+	binary := filepath.Join(dir, name)
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", binary, ".")
+	cmd.Dir = filepath.Join(root, "lambda", name)
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to build %s: %w\n%s", name, err, out)
+	}
+	return binary, nil
+}
+
+// invoke runs binary for one invocation with event and returns its result.
+// The process is stopped once it has answered.
+func invoke(ctx context.Context, name, binary string, event []byte, env []string, timeout time.Duration) (invocationResult, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return invocationResult{}, fmt.Errorf("failed to listen for runtime API: %w", err)
+	}
+	api := &runtimeAPI{
+		function:  name,
+		requestID: fmt.Sprintf("e2e-%d", time.Now().UnixNano()),
+		event:     event,
+		deadline:  time.Now().Add(timeout),
+		result:    make(chan invocationResult, 1),
+	}
+	srv := &http.Server{Handler: api}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	cmd := exec.Command(binary)
+	cmd.Env = append(append(os.Environ(), env...),
+		"AWS_LAMBDA_RUNTIME_API="+listener.Addr().String(),
+		"AWS_LAMBDA_FUNCTION_NAME="+name,
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE=256",
+	)
+	logs := &prefixWriter{prefix: "  [" + name + "] ", out: os.Stderr}
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+	if err := cmd.Start(); err != nil {
+		return invocationResult{}, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	stop := func() {
+		cmd.Process.Kill()
+		<-exited
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result := <-api.result:
+		stop()
+		return result, nil
+	case err := <-exited:
+		return invocationResult{}, fmt.Errorf("%s exited before responding: %v", name, err)
+	case <-timer.C:
+		stop()
+		return invocationResult{}, fmt.Errorf("%s did not respond within %s", name, timeout)
+	case <-ctx.Done():
+		stop()
+		return invocationResult{}, ctx.Err()
+	}
+}
+
+// prefixWriter prefixes each line of a function's output, so its logs can
+// be told apart from the bootstrapper's.
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf.Write(b)
+	for {
+		line, err := p.buf.ReadBytes('\n')
+		if err != nil {
+			// Keep the partial line for the next write.
+			p.buf.Write(line)
+			return len(b), nil
+		}
+		if _, err := fmt.Fprint(p.out, p.prefix, string(line)); err != nil {
+			log.Printf("Failed to write function output: %v", err)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+module googleads-stub
+
+go 1.21
+
+require pkg v0.0.0
+
+replace pkg => ../../pkg
@@ -0,0 +1,47 @@
+// Command googleads-stub serves a stand-in Google Ads API for local
+// development: search, searchStream and mutate answered from the same
+// canned fixtures cmd/e2e uses, so the functions and services run offline.
+// Point them at it with GOOGLE_ADS_ENDPOINT, which LOCAL_DEV=true does (see
+// pkg/localdev and docs/LOCAL_DEVELOPMENT.md).
+//
+// Usage, from this directory:
+//
+//	go run . [-addr :8089] [-fixtures ../e2e/fixtures/googleads.json] [-quiet]
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"pkg/adsstub"
+)
+
+func main() {
+	var (
+		addr     = flag.String("addr", ":8089", "address to listen on")
+		fixtures = flag.String("fixtures", "../e2e/fixtures/googleads.json", "Google Ads fixtures")
+		quiet    = flag.Bool("quiet", false, "don't log each call")
+	)
+	flag.Parse()
+
+	ads, err := adsstub.Load(*fixtures)
+	if err != nil {
+		log.Fatalf("Failed to load fixtures: %v", err)
+	}
+	ads.Verbose = !*quiet
+
+	srv, err := ads.Start(*addr)
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
+	}
+	defer srv.Close()
+	log.Printf("Google Ads stub serving %s on %s", *fixtures, srv.URL)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	log.Printf("Stopping; %d searches matched no fixture", len(ads.Unmatched()))
+}
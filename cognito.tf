@@ -0,0 +1,112 @@
+# Customer identities. user-service signs users up and logs them in against
+# this pool with admin APIs and the app client below; the pool holds
+# credentials, the users table the profile. custom:user_id ties a Cognito
+# user to its user record and custom:tenant_id to the storefront brand they
+# signed up to; both are only writable by user-service.
+resource "aws_cognito_user_pool" "customers" {
+  name = "${var.project_name}-customers"
+
+  username_attributes      = ["email"]
+  auto_verified_attributes = ["email"]
+
+  password_policy {
+    minimum_length                   = 8
+    require_lowercase                = true
+    require_uppercase                = true
+    require_numbers                  = true
+    require_symbols                  = false
+    temporary_password_validity_days = 1
+  }
+
+  schema {
+    name                     = "user_id"
+    attribute_data_type      = "String"
+    mutable                  = false
+    developer_only_attribute = false
+
+    string_attribute_constraints {
+      min_length = 1
+      max_length = 64
+    }
+  }
+
+  schema {
+    name                     = "tenant_id"
+    attribute_data_type      = "String"
+    mutable                  = false
+    developer_only_attribute = false
+
+    string_attribute_constraints {
+      min_length = 1
+      max_length = 63
+    }
+  }
+
+  account_recovery_setting {
+    recovery_mechanism {
+      name     = "verified_email"
+      priority = 1
+    }
+  }
+
+  tags = {
+    Name        = "${var.project_name}-customers"
+    Environment = var.environment
+  }
+}
+
+# A public client: user-service calls InitiateAuth on behalf of browsers
+# and apps, so there is no secret to keep.
+resource "aws_cognito_user_pool_client" "user_service" {
+  name         = "${var.project_name}-user-service"
+  user_pool_id = aws_cognito_user_pool.customers.id
+
+  generate_secret = false
+  explicit_auth_flows = [
+    "ALLOW_USER_PASSWORD_AUTH",
+    "ALLOW_REFRESH_TOKEN_AUTH"
+  ]
+  prevent_user_existence_errors = "ENABLED"
+
+  access_token_validity  = 1
+  id_token_validity      = 1
+  refresh_token_validity = 30
+  token_validity_units {
+    access_token  = "hours"
+    id_token      = "hours"
+    refresh_token = "days"
+  }
+
+  read_attributes  = ["email", "email_verified", "given_name", "family_name", "custom:user_id", "custom:tenant_id"]
+  write_attributes = ["email", "given_name", "family_name"]
+}
+
+resource "aws_iam_role_policy" "ecs_task_cognito" {
+  name = "${var.project_name}-ecs-task-cognito-policy"
+  role = "${var.project_name}-ecs-task-role"
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "cognito-idp:AdminCreateUser",
+          "cognito-idp:AdminSetUserPassword",
+          "cognito-idp:AdminDeleteUser"
+        ]
+        Resource = aws_cognito_user_pool.customers.arn
+      }
+    ]
+  })
+}
+
+output "cognito_user_pool_id" {
+  description = "Cognito user pool holding customer identities"
+  value       = aws_cognito_user_pool.customers.id
+}
+
+output "cognito_client_id" {
+  description = "App client user-service authenticates customers through"
+  value       = aws_cognito_user_pool_client.user_service.id
+}
@@ -0,0 +1,941 @@
+# Shared DynamoDB tables used by the ECS services
+
+# Idempotency-Key records for POST endpoints (see pkg/idempotency). Items
+# expire after 24 hours via TTL.
+resource "aws_dynamodb_table" "idempotency_keys" {
+  name         = "${var.project_name}-idempotency-keys"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "idempotency_key"
+
+  attribute {
+    name = "idempotency_key"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-idempotency-keys"
+    Environment = var.environment
+  }
+}
+
+# Shopping carts (cart-service). Idle carts are found through the status /
+# last activity index and marked abandoned; TTL removes them after
+# CART_TTL_DAYS without activity.
+resource "aws_dynamodb_table" "carts" {
+  name         = "${var.project_name}-carts"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "last_activity_at"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "status-last_activity_index"
+    hash_key        = "status"
+    range_key       = "last_activity_at"
+    projection_type = "ALL"
+  }
+
+  # Per-user cart history for the user-service journey timeline
+  global_secondary_index {
+    name            = "user_id-last_activity_index"
+    hash_key        = "user_id"
+    range_key       = "last_activity_at"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-carts"
+    Environment = var.environment
+  }
+}
+
+# Anonymous-to-identified merges (user-service), one record per anonymous
+# ID so a visitor is merged into at most one account.
+resource "aws_dynamodb_table" "user_merges" {
+  name         = "${var.project_name}-user-merges"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "anonymous_id"
+
+  attribute {
+    name = "anonymous_id"
+    type = "S"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-user-merges"
+    Environment = var.environment
+  }
+}
+
+# Stock levels (inventory-service), one item per SKU. available is kept
+# equal to on_hand - reserved so reservations can be conditioned on it.
+resource "aws_dynamodb_table" "inventory" {
+  name         = "${var.project_name}-inventory"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "sku"
+
+  attribute {
+    name = "sku"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-inventory"
+    Environment = var.environment
+  }
+}
+
+# Stock reservations (inventory-service). checkout-service finds the
+# reservation of a checkout whose reserve response it lost by order ID.
+resource "aws_dynamodb_table" "inventory_reservations" {
+  name         = "${var.project_name}-inventory-reservations"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "order_id"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "order_id-index"
+    hash_key        = "order_id"
+    projection_type = "KEYS_ONLY"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-inventory-reservations"
+    Environment = var.environment
+  }
+}
+
+# Append-only audit trail of stock changes, per SKU in time order
+resource "aws_dynamodb_table" "stock_movements" {
+  name         = "${var.project_name}-stock-movements"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "sku"
+  range_key    = "id"
+
+  attribute {
+    name = "sku"
+    type = "S"
+  }
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-stock-movements"
+    Environment = var.environment
+  }
+}
+
+# Payments (payment-service), one item per payment attempt. Refund webhooks
+# carry only the Stripe intent ID, hence the intent index; checkout-service
+# finds the payment of a checkout whose charge response it lost through
+# the order index.
+resource "aws_dynamodb_table" "payments" {
+  name         = "${var.project_name}-payments"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "stripe_payment_intent_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "order_id"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "stripe_payment_intent_id-index"
+    hash_key        = "stripe_payment_intent_id"
+    projection_type = "KEYS_ONLY"
+  }
+
+  global_secondary_index {
+    name            = "order_id-index"
+    hash_key        = "order_id"
+    projection_type = "KEYS_ONLY"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-payments"
+    Environment = var.environment
+  }
+}
+
+# Checkouts (checkout-service), one item per saga run with its step
+# history. Checkouts left pending or half undone are found by the
+# recovery sweep through the status / saved_at index.
+resource "aws_dynamodb_table" "checkouts" {
+  name         = "${var.project_name}-checkouts"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  attribute {
+    name = "saved_at"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "status-saved_at-index"
+    hash_key        = "status"
+    range_key       = "saved_at"
+    projection_type = "ALL"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-checkouts"
+    Environment = var.environment
+  }
+}
+
+# Ad clicks (attribution-service), one item per Google Ads click a visitor
+# landed from, under the user or anonymous visitor ID. Like every per-user
+# event table it has the user_id / timestamp index, through which
+# user-service moves a visitor's clicks to the user and builds timelines,
+# and privacy-worker erases them. Clicks expire after the 90-day click
+# window.
+resource "aws_dynamodb_table" "ad_clicks" {
+  name         = "${var.project_name}-ad-clicks"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "timestamp"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "user_id-timestamp-index"
+    hash_key        = "user_id"
+    range_key       = "timestamp"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-ad-clicks"
+    Environment = var.environment
+  }
+}
+
+# Order attributions (attribution-service), one item per order with the
+# click it is credited to and its touchpoints. conversion-uploader looks
+# orders up by ID; reports-service reads a date range through the status /
+# ordered_at index.
+resource "aws_dynamodb_table" "attributions" {
+  name         = "${var.project_name}-attributions"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "order_id"
+
+  attribute {
+    name = "order_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  attribute {
+    name = "ordered_at"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "status-ordered_at-index"
+    hash_key        = "status"
+    range_key       = "ordered_at"
+    projection_type = "ALL"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-attributions"
+    Environment = var.environment
+  }
+}
+
+# Multi-touch attribution results (attribution-modeler), single-table per
+# tenant and model: each day's credited conversions and revenue per campaign
+# and currency, which reports-service compares models from.
+resource "aws_dynamodb_table" "attribution_models" {
+  name         = "${var.project_name}-attribution-models"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "pk"
+  range_key    = "sk"
+
+  attribute {
+    name = "pk"
+    type = "S"
+  }
+
+  attribute {
+    name = "sk"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-attribution-models"
+    Environment = var.environment
+  }
+}
+
+# Coupons (checkout-service), single-table per coupon code: the coupon,
+# one item per redemption keyed by order, and per-user redemption counters.
+resource "aws_dynamodb_table" "coupons" {
+  name         = "${var.project_name}-coupons"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "pk"
+  range_key    = "sk"
+
+  attribute {
+    name = "pk"
+    type = "S"
+  }
+
+  attribute {
+    name = "sk"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-coupons"
+    Environment = var.environment
+  }
+}
+
+# Stripe webhook event IDs already processed, so redeliveries are
+# acknowledged without effect. Kept 30 days, beyond Stripe's retry window.
+resource "aws_dynamodb_table" "stripe_webhook_events" {
+  name         = "${var.project_name}-stripe-webhook-events"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-stripe-webhook-events"
+    Environment = var.environment
+  }
+}
+
+# Product catalogue (product-service). The stream feeds product-indexer,
+# which mirrors every change into the OpenSearch product index.
+resource "aws_dynamodb_table" "products" {
+  name         = "${var.project_name}-products"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  stream_enabled   = true
+  stream_view_type = "NEW_AND_OLD_IMAGES"
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-products"
+    Environment = var.environment
+  }
+}
+
+# Price history and promotions (product-service), single-table under
+# PRODUCT#<id>. Promotions waiting to start or end carry due / due_at,
+# which puts them in the sparse index the promotion sweep reads.
+resource "aws_dynamodb_table" "product_prices" {
+  name         = "${var.project_name}-product-prices"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "pk"
+  range_key    = "sk"
+
+  attribute {
+    name = "pk"
+    type = "S"
+  }
+
+  attribute {
+    name = "sk"
+    type = "S"
+  }
+
+  attribute {
+    name = "due"
+    type = "S"
+  }
+
+  attribute {
+    name = "due_at"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "due-index"
+    hash_key        = "due"
+    range_key       = "due_at"
+    projection_type = "ALL"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-product-prices"
+    Environment = var.environment
+  }
+}
+
+# Co-purchase matrix (recommendation-service): how many orders contained
+# both product_id and related_id. The diagonal counts orders per product.
+resource "aws_dynamodb_table" "co_purchases" {
+  name         = "${var.project_name}-co-purchases"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "product_id"
+  range_key    = "related_id"
+
+  attribute {
+    name = "product_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "related_id"
+    type = "S"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-co-purchases"
+    Environment = var.environment
+  }
+}
+
+# Products each user has bought, seeding their recommendations
+resource "aws_dynamodb_table" "user_purchases" {
+  name         = "${var.project_name}-user-purchases"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "user_id"
+  range_key    = "product_id"
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "product_id"
+    type = "S"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-user-purchases"
+    Environment = var.environment
+  }
+}
+
+# Order IDs already counted, so redelivered order events are skipped
+resource "aws_dynamodb_table" "recommendation_orders" {
+  name         = "${var.project_name}-recommendation-orders"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "order_id"
+
+  attribute {
+    name = "order_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-recommendation-orders"
+    Environment = var.environment
+  }
+}
+
+# GDPR export and erasure requests (user-service), one item per request.
+# Kept after completion as the record that a request was honoured.
+resource "aws_dynamodb_table" "privacy_requests" {
+  name         = "${var.project_name}-privacy-requests"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "created_at"
+    type = "S"
+  }
+
+  # A user's requests newest first, to find one still running
+  global_secondary_index {
+    name            = "user_id-created_at-index"
+    hash_key        = "user_id"
+    range_key       = "created_at"
+    projection_type = "ALL"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-privacy-requests"
+    Environment = var.environment
+  }
+}
+
+# Consent log (user-service): every consent a user granted or withdrew,
+# newest last by UUIDv7 id. Records are proof of consent and are never
+# changed or deleted, which the policy below enforces for the services.
+resource "aws_dynamodb_table" "user_consent_log" {
+  name         = "${var.project_name}-user-consent-log"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "user_id"
+  range_key    = "id"
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-user-consent-log"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "ecs_task_consent_log_immutable" {
+  name = "${var.project_name}-ecs-task-consent-log-immutable-policy"
+  role = "${var.project_name}-ecs-task-role"
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Deny"
+        Action = [
+          "dynamodb:UpdateItem",
+          "dynamodb:DeleteItem",
+          "dynamodb:BatchWriteItem"
+        ]
+        Resource = aws_dynamodb_table.user_consent_log.arn
+      }
+    ]
+  })
+}
+
+# Background user imports from S3 and their progress
+resource "aws_dynamodb_table" "user_imports" {
+  name         = "${var.project_name}-user-imports"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-user-imports"
+    Environment = var.environment
+  }
+}
+
+# Webhook endpoints registered by API clients, one item per webhook
+resource "aws_dynamodb_table" "webhooks" {
+  name         = "${var.project_name}-webhooks"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "owner_id"
+    type = "S"
+  }
+
+  # A client's webhooks
+  global_secondary_index {
+    name            = "owner_id-index"
+    hash_key        = "owner_id"
+    projection_type = "ALL"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-webhooks"
+    Environment = var.environment
+  }
+}
+
+# Webhook delivery log; ids are time-ordered so a webhook's deliveries
+# read newest first, and expire after 30 days
+resource "aws_dynamodb_table" "webhook_deliveries" {
+  name         = "${var.project_name}-webhook-deliveries"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "webhook_id"
+  range_key    = "id"
+
+  attribute {
+    name = "webhook_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-webhook-deliveries"
+    Environment = var.environment
+  }
+}
+
+# Emails sent by notification-service and their SES status, expiring after
+# 180 days. IDs derive from the triggering event, so an event is emailed
+# once; a user's emails read newest first from the index.
+resource "aws_dynamodb_table" "notifications" {
+  name         = "${var.project_name}-notifications"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "created_at"
+    type = "S"
+  }
+
+  attribute {
+    name = "message_id"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "user_id-index"
+    hash_key        = "user_id"
+    range_key       = "created_at"
+    projection_type = "ALL"
+  }
+
+  # WhatsApp receipts name only the message
+  global_secondary_index {
+    name            = "message_id-index"
+    hash_key        = "message_id"
+    projection_type = "KEYS_ONLY"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-notifications"
+    Environment = var.environment
+  }
+}
+
+# Channels, phone number and schedule each user is notified with
+resource "aws_dynamodb_table" "notification_preferences" {
+  name         = "${var.project_name}-notification-preferences"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "user_id"
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-notification-preferences"
+    Environment = var.environment
+  }
+}
+
+# Addresses notification-service never emails: permanent bounces,
+# complaints and manual additions
+resource "aws_dynamodb_table" "email_suppressions" {
+  name         = "${var.project_name}-email-suppressions"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "email"
+
+  attribute {
+    name = "email"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-email-suppressions"
+    Environment = var.environment
+  }
+}
@@ -0,0 +1,45 @@
+# Platform event bus for domain events published by the ECS services
+resource "aws_cloudwatch_event_bus" "ecommerce" {
+  name = "${var.project_name}-events"
+
+  tags = {
+    Name        = "${var.project_name}-events"
+    Environment = var.environment
+  }
+}
+
+# Schema registry for the domain events defined in pkg/events. The schemas
+# are generated from the Go structs (go generate ./events in pkg), so the
+# registry, the publishers and the consumers share one definition.
+locals {
+  event_schemas = {
+    for file in fileset("${path.module}/pkg/events/schemas", "*.json") :
+    trimsuffix(file, ".json") => jsondecode(file("${path.module}/pkg/events/schemas/${file}"))
+  }
+}
+
+resource "aws_schemas_registry" "events" {
+  name        = "${var.project_name}-events"
+  description = "Domain events on the ${var.project_name}-events bus"
+
+  tags = {
+    Name        = "${var.project_name}-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_schemas_schema" "events" {
+  for_each = local.event_schemas
+
+  # Named as pkg/events' Type.SchemaName: source@DetailTypeWithoutSpaces
+  name          = "${each.value.properties.source.enum[0]}@${each.value.title}"
+  registry_name = aws_schemas_registry.events.name
+  type          = "JSONSchemaDraft4"
+  description   = each.value.description
+  content       = jsonencode(each.value)
+
+  tags = {
+    Name        = "${var.project_name}-${each.key}"
+    Environment = var.environment
+  }
+}
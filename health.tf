@@ -0,0 +1,23 @@
+# /health/ready describes the tables each service uses and the secrets it
+# was started with, so the task role may describe, though not read, any of
+# the project's tables and secrets.
+resource "aws_iam_role_policy" "ecs_task_health" {
+  name = "${var.project_name}-ecs-task-health-policy"
+  role = "${var.project_name}-ecs-task-role"
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:DescribeTable"]
+        Resource = "arn:aws:dynamodb:${var.aws_region}:*:table/${var.project_name}-*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["secretsmanager:DescribeSecret"]
+        Resource = "arn:aws:secretsmanager:${var.aws_region}:*:secret:${var.project_name}/*"
+      }
+    ]
+  })
+}
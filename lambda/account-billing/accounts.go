@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var accountsTable = os.Getenv("ACCOUNTS_TABLE_NAME")
+
+type billingAccount struct {
+	CustomerID      string `dynamodbav:"customer_id"`
+	DescriptiveName string `dynamodbav:"descriptive_name"`
+	CurrencyCode    string `dynamodbav:"currency_code"`
+	TimeZone        string `dynamodbav:"time_zone"`
+}
+
+// location is the account time zone, in which Google Ads reports budget
+// order start and end times.
+func (a billingAccount) location() *time.Location {
+	if loc, err := time.LoadLocation(a.TimeZone); err == nil && a.TimeZone != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// loadAccounts returns every ACTIVE account. Billing is ingested regardless
+// of the monitor/optimizer toggles since finance needs every account.
+func loadAccounts(ctx context.Context, svc *dynamodb.Client) ([]billingAccount, error) {
+	if accountsTable == "" {
+		customerID := os.Getenv("GOOGLE_ADS_CUSTOMER_ID")
+		if customerID == "" {
+			return nil, fmt.Errorf("neither ACCOUNTS_TABLE_NAME nor GOOGLE_ADS_CUSTOMER_ID environment variable is set")
+		}
+		return []billingAccount{{CustomerID: customerID}}, nil
+	}
+
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName:        aws.String(accountsTable),
+		FilterExpression: aws.String("#status = :active"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active": &types.AttributeValueMemberS{Value: "ACTIVE"},
+		},
+		ProjectionExpression: aws.String("customer_id, descriptive_name, currency_code, time_zone"),
+	})
+
+	var accounts []billingAccount
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan accounts: %w", err)
+		}
+
+		var batch []billingAccount
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal accounts: %w", err)
+		}
+		accounts = append(accounts, batch...)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].CustomerID < accounts[j].CustomerID })
+	return accounts, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+
+	"pkg/envelope"
+	"pkg/gaql"
+	"pkg/notify"
+)
+
+const (
+	AlertTypeBudgetOrderNearlyExhausted = "BUDGET_ORDER_NEARLY_EXHAUSTED"
+	AlertTypeBudgetOrderExhausted       = "BUDGET_ORDER_EXHAUSTED"
+	AlertTypeBudgetOrderEnding          = "BUDGET_ORDER_ENDING"
+)
+
+// Google Ads reports budget order times as "yyyy-MM-dd HH:mm:ss" in the
+// account time zone.
+const budgetTimeLayout = "2006-01-02 15:04:05"
+
+// Only approved budget orders carry a spending limit Google bills
+// against; pending proposals and cancelled orders are left out.
+var budgetOrdersQuery = gaql.Select(
+	"account_budget.id",
+	"account_budget.name",
+	"account_budget.status",
+	"account_budget.billing_setup",
+	"account_budget.purchase_order_number",
+	"account_budget.approved_spending_limit_micros",
+	"account_budget.approved_spending_limit_type",
+	"account_budget.adjusted_spending_limit_micros",
+	"account_budget.adjusted_spending_limit_type",
+	"account_budget.amount_served_micros",
+	"account_budget.approved_start_date_time",
+	"account_budget.approved_end_date_time",
+	"account_budget.approved_end_time_type",
+).From("account_budget").
+	Where("account_budget.status", gaql.Equals, "APPROVED").
+	MustBuild()
+
+// BudgetOrder is an approved account budget with its consumption.
+// SpendingLimit is nil for orders without a limit, EndDate for orders
+// running until cancelled.
+type BudgetOrder struct {
+	ID                  string
+	Name                string
+	BillingSetup        string
+	PurchaseOrderNumber string
+	SpendingLimit       *float64
+	AmountServed        float64
+	StartDate           time.Time
+	EndDate             *time.Time
+	ProjectedExhaustion *time.Time
+}
+
+// Remaining is the unserved part of the spending limit, or 0 without one.
+func (b BudgetOrder) Remaining() float64 {
+	if b.SpendingLimit == nil {
+		return 0
+	}
+	return math.Max(*b.SpendingLimit-b.AmountServed, 0)
+}
+
+// Consumed is the share of the spending limit served, or 0 without one.
+func (b BudgetOrder) Consumed() float64 {
+	if b.SpendingLimit == nil || *b.SpendingLimit <= 0 {
+		return 0
+	}
+	return b.AmountServed / *b.SpendingLimit
+}
+
+// Active reports whether the order is the one currently being served.
+func (b BudgetOrder) Active(now time.Time) bool {
+	return !now.Before(b.StartDate) && (b.EndDate == nil || now.Before(*b.EndDate))
+}
+
+func fetchBudgetOrders(ctx context.Context, client *googleads.Service, account billingAccount, now time.Time) ([]BudgetOrder, error) {
+	resp, err := client.Search(ctx, &googleads.SearchGoogleAdsRequest{
+		CustomerId: account.CustomerID,
+		Query:      budgetOrdersQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search account budgets: %w", err)
+	}
+
+	loc := account.location()
+	var budgets []BudgetOrder
+	for _, row := range resp.Results {
+		ab := row.AccountBudget
+		start, err := time.ParseInLocation(budgetTimeLayout, ab.ApprovedStartDateTime, loc)
+		if err != nil {
+			return nil, fmt.Errorf("budget %d has invalid start time %q: %w", ab.Id, ab.ApprovedStartDateTime, err)
+		}
+
+		budget := BudgetOrder{
+			ID:                  strconv.FormatInt(ab.Id, 10),
+			Name:                ab.Name,
+			BillingSetup:        ab.BillingSetup,
+			PurchaseOrderNumber: ab.PurchaseOrderNumber,
+			AmountServed:        float64(ab.AmountServedMicros) / 1000000.0,
+			StartDate:           start,
+		}
+
+		// An adjusted limit (after credits or overdelivery) supersedes
+		// the approved one.
+		switch {
+		case ab.AdjustedSpendingLimitMicros > 0:
+			limit := float64(ab.AdjustedSpendingLimitMicros) / 1000000.0
+			budget.SpendingLimit = &limit
+		case ab.ApprovedSpendingLimitMicros > 0 && ab.ApprovedSpendingLimitType.String() != "INFINITE":
+			limit := float64(ab.ApprovedSpendingLimitMicros) / 1000000.0
+			budget.SpendingLimit = &limit
+		}
+
+		if ab.ApprovedEndTimeType.String() != "FOREVER" && ab.ApprovedEndDateTime != "" {
+			end, err := time.ParseInLocation(budgetTimeLayout, ab.ApprovedEndDateTime, loc)
+			if err != nil {
+				return nil, fmt.Errorf("budget %d has invalid end time %q: %w", ab.Id, ab.ApprovedEndDateTime, err)
+			}
+			budget.EndDate = &end
+		}
+
+		if budget.SpendingLimit != nil && budget.Active(now) {
+			budget.ProjectedExhaustion = projectExhaustion(budget.AmountServed, *budget.SpendingLimit, start, now)
+		}
+
+		budgets = append(budgets, budget)
+	}
+
+	sort.Slice(budgets, func(i, j int) bool { return budgets[i].StartDate.Before(budgets[j].StartDate) })
+	return budgets, nil
+}
+
+// projectExhaustion extrapolates the average daily served amount since the
+// order started to estimate when its limit is reached.
+func projectExhaustion(served, limit float64, start, now time.Time) *time.Time {
+	elapsed := now.Sub(start)
+	if served <= 0 || elapsed <= 0 || served >= limit {
+		return nil
+	}
+	perSecond := served / elapsed.Seconds()
+	exhaustion := now.Add(time.Duration((limit-served)/perSecond) * time.Second)
+	return &exhaustion
+}
+
+// billingSetups returns the distinct billing setups the budget orders are
+// billed through; invoices are listed per billing setup.
+func billingSetups(budgets []BudgetOrder) []string {
+	seen := make(map[string]bool)
+	var setups []string
+	for _, budget := range budgets {
+		if budget.BillingSetup != "" && !seen[budget.BillingSetup] {
+			seen[budget.BillingSetup] = true
+			setups = append(setups, budget.BillingSetup)
+		}
+	}
+	return setups
+}
+
+// budgetOrderAlerts returns at most one alert per active budget order, the
+// most urgent that applies: exhausted, nearly exhausted (by share served
+// or projected run-out within alertDays and before the end date), or
+// ending within alertDays.
+func budgetOrderAlerts(account billingAccount, budgets []BudgetOrder, now time.Time) []notify.BudgetOrderAlert {
+	horizon := now.AddDate(0, 0, alertDays)
+
+	var alerts []notify.BudgetOrderAlert
+	for _, budget := range budgets {
+		if !budget.Active(now) || budget.SpendingLimit == nil {
+			continue
+		}
+
+		alert := notify.BudgetOrderAlert{
+			CustomerID:          account.CustomerID,
+			AccountName:         account.DescriptiveName,
+			BudgetID:            budget.ID,
+			BudgetName:          budget.Name,
+			PurchaseOrderNumber: budget.PurchaseOrderNumber,
+			Currency:            account.CurrencyCode,
+			SpendingLimit:       *budget.SpendingLimit,
+			AmountServed:        budget.AmountServed,
+			Remaining:           budget.Remaining(),
+			PercentConsumed:     budget.Consumed() * 100,
+			EndDate:             budget.EndDate,
+			ProjectedExhaustion: budget.ProjectedExhaustion,
+		}
+
+		runsOut := budget.ProjectedExhaustion != nil && budget.ProjectedExhaustion.Before(horizon) &&
+			(budget.EndDate == nil || budget.ProjectedExhaustion.Before(*budget.EndDate))
+
+		switch {
+		case budget.Consumed() >= 1.0:
+			alert.AlertType = AlertTypeBudgetOrderExhausted
+			alert.Message = fmt.Sprintf("Budget order '%s' has reached its spending limit (%.2f of %.2f %s served); ads stop serving until it is raised",
+				budget.Name, budget.AmountServed, *budget.SpendingLimit, account.CurrencyCode)
+		case budget.Consumed() >= alertThreshold || runsOut:
+			alert.AlertType = AlertTypeBudgetOrderNearlyExhausted
+			alert.Message = fmt.Sprintf("Budget order '%s' has %.2f %s remaining (%.0f%% served)",
+				budget.Name, budget.Remaining(), account.CurrencyCode, budget.Consumed()*100)
+			if budget.ProjectedExhaustion != nil {
+				alert.Message += fmt.Sprintf(", projected to run out on %s", budget.ProjectedExhaustion.Format("2006-01-02"))
+			}
+		case budget.EndDate != nil && budget.EndDate.Before(horizon):
+			alert.AlertType = AlertTypeBudgetOrderEnding
+			alert.Message = fmt.Sprintf("Budget order '%s' ends on %s with %.2f %s remaining",
+				budget.Name, budget.EndDate.Format("2006-01-02"), budget.Remaining(), account.CurrencyCode)
+		default:
+			continue
+		}
+
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+func publishAlert(ctx context.Context, client *sns.Client, alert notify.BudgetOrderAlert) error {
+	message, err := envelope.New("account-billing", nil, "", clk).Seal(ctx, envelope.Meta{
+		Type:          notify.KindBudgetOrderAlert,
+		SchemaVersion: notify.BudgetOrderSchemaVersion,
+		Tenant:        alert.CustomerID,
+	}, alert)
+	if err != nil {
+		return fmt.Errorf("failed to seal alert: %w", err)
+	}
+
+	_, err = client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(snsTopicARN),
+		Message:  aws.String(message),
+		Subject:  aws.String(fmt.Sprintf("Google Ads Budget Order: %s - %s", alert.AlertType, alert.BudgetName)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to SNS: %w", err)
+	}
+	return nil
+}
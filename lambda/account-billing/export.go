@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Report types, the first path segment of each export. quicksight-refresh
+// maps them to the finance datasets.
+const (
+	reportAccountBudgets = "account_budgets"
+	reportInvoices       = "invoices"
+)
+
+// Exporter writes one CSV per account and partition, so a rerun or a
+// failed account never leaves another account's rows stale.
+type Exporter struct {
+	client *s3.Client
+	bucket string
+}
+
+// WriteBudgetOrders writes the day's snapshot of an account's budget
+// orders to account_budgets/date=YYYY-MM-DD/<customer_id>.csv.
+func (e *Exporter) WriteBudgetOrders(ctx context.Context, account billingAccount, budgets []BudgetOrder, now time.Time) error {
+	date := now.UTC().Format("2006-01-02")
+	rows := [][]string{{
+		"snapshot_date", "customer_id", "account_name", "budget_id", "budget_name", "purchase_order_number",
+		"currency", "start_date", "end_date", "spending_limit", "amount_served", "remaining",
+		"percent_consumed", "projected_exhaustion",
+	}}
+	for _, budget := range budgets {
+		limit, remaining, consumed := "", "", ""
+		if budget.SpendingLimit != nil {
+			limit = money(*budget.SpendingLimit)
+			remaining = money(budget.Remaining())
+			consumed = strconv.FormatFloat(budget.Consumed()*100, 'f', 1, 64)
+		}
+		rows = append(rows, []string{
+			date,
+			account.CustomerID,
+			account.DescriptiveName,
+			budget.ID,
+			budget.Name,
+			budget.PurchaseOrderNumber,
+			account.CurrencyCode,
+			budget.StartDate.Format("2006-01-02"),
+			optionalDate(budget.EndDate),
+			limit,
+			money(budget.AmountServed),
+			remaining,
+			consumed,
+			optionalDate(budget.ProjectedExhaustion),
+		})
+	}
+
+	key := fmt.Sprintf("%s/date=%s/%s.csv", reportAccountBudgets, date, account.CustomerID)
+	return e.put(ctx, key, rows)
+}
+
+// WriteInvoices writes an account's invoice lines for the month they were
+// issued in to invoices/issue_month=YYYY-MM/<customer_id>.csv.
+func (e *Exporter) WriteInvoices(ctx context.Context, account billingAccount, lines []InvoiceLine, month time.Time) error {
+	rows := [][]string{{
+		"invoice_id", "customer_id", "account_name", "type", "issue_date", "due_date", "currency",
+		"account_budget", "budget_name", "purchase_order_number", "subtotal", "tax", "total", "invoice_total",
+	}}
+	for _, line := range lines {
+		rows = append(rows, []string{
+			line.InvoiceID,
+			account.CustomerID,
+			account.DescriptiveName,
+			line.Type,
+			line.IssueDate,
+			line.DueDate,
+			line.Currency,
+			line.AccountBudget,
+			line.BudgetName,
+			line.PurchaseOrderNumber,
+			money(line.Subtotal),
+			money(line.Tax),
+			money(line.Total),
+			money(line.InvoiceTotal),
+		})
+	}
+
+	key := fmt.Sprintf("%s/issue_month=%s/%s.csv", reportInvoices, month.Format("2006-01"), account.CustomerID)
+	return e.put(ctx, key, rows)
+}
+
+func (e *Exporter) put(ctx context.Context, key string, rows [][]string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+
+	_, err := e.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(e.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("text/csv"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+func money(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func optionalDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
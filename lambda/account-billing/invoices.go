@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleads"
+)
+
+// InvoiceLine is one budget order's share of an invoice. Invoices without
+// budget summaries produce a single line carrying the invoice totals.
+type InvoiceLine struct {
+	InvoiceID           string
+	Type                string
+	IssueDate           string
+	DueDate             string
+	Currency            string
+	AccountBudget       string
+	BudgetName          string
+	PurchaseOrderNumber string
+	Subtotal            float64
+	Tax                 float64
+	Total               float64
+	InvoiceTotal        float64
+}
+
+// fetchInvoices lists the invoices issued in month for each billing setup.
+// Only accounts on monthly invoicing have invoices; for the rest the API
+// returns none.
+func fetchInvoices(ctx context.Context, client *googleads.Service, account billingAccount, setups []string, month time.Time) ([]InvoiceLine, error) {
+	var lines []InvoiceLine
+	for _, setup := range setups {
+		resp, err := client.ListInvoices(ctx, &googleads.ListInvoicesRequest{
+			CustomerId:   account.CustomerID,
+			BillingSetup: setup,
+			IssueYear:    month.Format("2006"),
+			IssueMonth:   googleads.Enum(strings.ToUpper(month.Month().String())),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list invoices for %s: %w", setup, err)
+		}
+		if resp == nil {
+			continue
+		}
+
+		for _, invoice := range resp.Invoices {
+			lines = append(lines, invoiceLines(invoice)...)
+		}
+	}
+
+	if len(lines) > 0 {
+		log.Printf("Account %s: %d invoice lines for %s", account.CustomerID, len(lines), month.Format("2006-01"))
+	}
+	return lines, nil
+}
+
+func invoiceLines(invoice *googleads.Invoice) []InvoiceLine {
+	base := InvoiceLine{
+		InvoiceID:    invoice.Id,
+		Type:         invoice.Type.String(),
+		IssueDate:    invoice.IssueDate,
+		DueDate:      invoice.DueDate,
+		Currency:     invoice.CurrencyCode,
+		InvoiceTotal: micros(invoice.TotalAmountMicros),
+	}
+
+	if len(invoice.AccountBudgetSummaries) == 0 {
+		base.Subtotal = micros(invoice.SubtotalAmountMicros)
+		base.Tax = micros(invoice.TaxAmountMicros)
+		base.Total = micros(invoice.TotalAmountMicros)
+		return []InvoiceLine{base}
+	}
+
+	lines := make([]InvoiceLine, 0, len(invoice.AccountBudgetSummaries))
+	for _, summary := range invoice.AccountBudgetSummaries {
+		line := base
+		line.AccountBudget = summary.AccountBudget
+		line.BudgetName = summary.AccountBudgetName
+		line.PurchaseOrderNumber = summary.PurchaseOrderNumber
+		line.Subtotal = micros(summary.SubtotalAmountMicros)
+		line.Tax = micros(summary.TaxAmountMicros)
+		line.Total = micros(summary.TotalAmountMicros)
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func micros(v int64) float64 {
+	return float64(v) / 1000000.0
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+var (
+	secretName    = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	snsTopicARN   = os.Getenv("SNS_TOPIC_ARN")
+	reportsBucket = os.Getenv("REPORTS_BUCKET")
+	environment   = os.Getenv("ENVIRONMENT")
+
+	// A budget order alerts once this share of its spending limit is
+	// served, or when it is projected to run out or ends within
+	// alertDays.
+	alertThreshold = parseFloatEnv("BUDGET_ORDER_ALERT_THRESHOLD", 0.9)
+	alertDays      = getIntEnv("BUDGET_ORDER_ALERT_DAYS", 7)
+
+	clk = clock.FromEnv()
+)
+
+func main() {
+	lambda.Start(HandleAccountBilling)
+}
+
+// HandleAccountBilling runs daily: for every active account it snapshots
+// account budget orders and the current and previous month's invoices to
+// the reports bucket for the finance dashboards, and alerts on budget
+// orders that are running out.
+func HandleAccountBilling(ctx context.Context, event interface{}) error {
+	log.Printf("Starting account billing ingestion for environment: %s", environment)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := createGoogleAdsClient(adsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	accounts, err := loadAccounts(ctx, dynamodb.NewFromConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+
+	exporter := &Exporter{client: s3.NewFromConfig(cfg), bucket: reportsBucket}
+	publisher := sns.NewFromConfig(cfg)
+	now := clk.Now()
+
+	var failed, alerted int
+	for _, account := range accounts {
+		budgets, err := ingestAccount(ctx, client, exporter, account, now)
+		if err != nil {
+			log.Printf("Failed to ingest billing for account %s: %v", account.CustomerID, err)
+			failed++
+			continue
+		}
+
+		for _, alert := range budgetOrderAlerts(account, budgets, now) {
+			if err := publishAlert(ctx, publisher, alert); err != nil {
+				log.Printf("Failed to publish budget order alert for %s: %v", alert.BudgetID, err)
+				continue
+			}
+			alerted++
+		}
+	}
+	if failed > 0 && failed == len(accounts) {
+		return fmt.Errorf("failed to ingest billing for all %d accounts", failed)
+	}
+
+	log.Printf("Account billing ingestion completed for %d accounts, %d alerts", len(accounts)-failed, alerted)
+	return nil
+}
+
+// ingestAccount exports one account's budget orders and invoices and
+// returns the budget orders for alerting.
+func ingestAccount(ctx context.Context, client *googleads.Service, exporter *Exporter, account billingAccount, now time.Time) ([]BudgetOrder, error) {
+	budgets, err := fetchBudgetOrders(ctx, client, account, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := exporter.WriteBudgetOrders(ctx, account, budgets, now); err != nil {
+		return nil, err
+	}
+
+	// Invoices are issued early in the month for the previous month's
+	// activity, so both months are refreshed until the later one closes.
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for _, month := range []time.Time{thisMonth.AddDate(0, -1, 0), thisMonth} {
+		invoices, err := fetchInvoices(ctx, client, account, billingSetups(budgets), month)
+		if err != nil {
+			return nil, err
+		}
+		if err := exporter.WriteInvoices(ctx, account, invoices, month); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Account %s: %d budget orders ingested", account.CustomerID, len(budgets))
+	return budgets, nil
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	srv, err := googleads.NewService(context.Background(),
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/notify"
+	"pkg/tracking"
+)
+
+// maxExamples caps the sample of offending entities kept per check.
+const maxExamples = 5
+
+// audit is one structural check. Each issue costs weight points, capped at
+// maxPenalty so a single bad area cannot zero the whole score.
+type audit struct {
+	name       string
+	weight     float64
+	maxPenalty float64
+	run        func(ctx context.Context, client *googleads.Service, customerID string) (issues int, examples []string, err error)
+}
+
+var audits = []audit{
+	{name: "Duplicate keywords", weight: 2, maxPenalty: 20, run: auditDuplicateKeywords},
+	{name: "Missing extensions", weight: 5, maxPenalty: 20, run: auditMissingExtensions},
+	{name: "Disapproved ads", weight: 4, maxPenalty: 25, run: auditDisapprovedAds},
+	{name: "Empty ad groups", weight: 3, maxPenalty: 15, run: auditEmptyAdGroups},
+	{name: "Tracking template errors", weight: 5, maxPenalty: 20, run: auditTrackingTemplates},
+	{name: "UTM scheme mismatches", weight: 3, maxPenalty: 15, run: auditURLParameters},
+}
+
+// trackingScheme is the canonical UTM suffix attribution joins rely on.
+var trackingScheme = tracking.MustParseScheme(getEnv("CANONICAL_URL_SUFFIX", tracking.DefaultScheme))
+
+// requiredExtensions are the asset types every enabled campaign should have.
+var requiredExtensions = []string{"SITELINK", "CALLOUT"}
+
+var (
+	keywordsQuery = gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"ad_group.id",
+		"ad_group_criterion.keyword.text",
+		"ad_group_criterion.keyword.match_type",
+	).From("keyword_view").
+		Where("campaign.status", gaql.Equals, "ENABLED").
+		Where("ad_group.status", gaql.Equals, "ENABLED").
+		Where("ad_group_criterion.status", gaql.Equals, "ENABLED").
+		Where("ad_group_criterion.negative", gaql.Equals, false).
+		MustBuild()
+
+	enabledCampaignsQuery = gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"campaign.tracking_url_template",
+		"campaign.final_url_suffix",
+	).From("campaign").
+		Where("campaign.status", gaql.Equals, "ENABLED").
+		MustBuild()
+
+	campaignAssetsQuery = gaql.Select(
+		"campaign.id",
+		"campaign_asset.field_type",
+	).From("campaign_asset").
+		Where("campaign.status", gaql.Equals, "ENABLED").
+		Where("campaign_asset.status", gaql.Equals, "ENABLED").
+		MustBuild()
+
+	accountTrackingQuery = gaql.Select(
+		"customer.tracking_url_template",
+		"customer.final_url_suffix",
+	).From("customer").
+		MustBuild()
+
+	finalURLsQuery = gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"ad_group_ad.ad.id",
+		"ad_group_ad.ad.final_urls",
+	).From("ad_group_ad").
+		Where("campaign.status", gaql.Equals, "ENABLED").
+		Where("ad_group.status", gaql.Equals, "ENABLED").
+		Where("ad_group_ad.status", gaql.Equals, "ENABLED").
+		MustBuild()
+
+	disapprovedAdsQuery = gaql.Select(
+		"campaign.name",
+		"ad_group.name",
+		"ad_group_ad.ad.id",
+	).From("ad_group_ad").
+		Where("campaign.status", gaql.Equals, "ENABLED").
+		Where("ad_group_ad.status", gaql.Equals, "ENABLED").
+		Where("ad_group_ad.policy_summary.approval_status", gaql.Equals, "DISAPPROVED").
+		MustBuild()
+
+	enabledAdGroupsQuery = gaql.Select(
+		"campaign.name",
+		"ad_group.id",
+		"ad_group.name",
+	).From("ad_group").
+		Where("campaign.status", gaql.Equals, "ENABLED").
+		Where("ad_group.status", gaql.Equals, "ENABLED").
+		MustBuild()
+
+	enabledAdsQuery = gaql.Select(
+		"ad_group.id",
+	).From("ad_group_ad").
+		Where("ad_group.status", gaql.Equals, "ENABLED").
+		Where("ad_group_ad.status", gaql.Equals, "ENABLED").
+		MustBuild()
+)
+
+// runAudits computes an account's checks and its 0-100 hygiene score.
+func runAudits(ctx context.Context, client *googleads.Service, customerID string) (float64, []notify.HygieneCheck, error) {
+	score := 100.0
+	checks := make([]notify.HygieneCheck, 0, len(audits))
+	for _, a := range audits {
+		issues, examples, err := a.run(ctx, client, customerID)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%s: %w", strings.ToLower(a.name), err)
+		}
+
+		penalty := math.Min(float64(issues)*a.weight, a.maxPenalty)
+		score -= penalty
+		checks = append(checks, notify.HygieneCheck{
+			Name:     a.name,
+			Issues:   issues,
+			Penalty:  penalty,
+			Examples: examples,
+		})
+	}
+	return math.Max(score, 0), checks, nil
+}
+
+// auditDuplicateKeywords counts keywords repeated with the same match type
+// in more than one ad group of a campaign, which makes them compete in the
+// same auctions.
+func auditDuplicateKeywords(ctx context.Context, client *googleads.Service, customerID string) (int, []string, error) {
+	type key struct {
+		campaignID int64
+		text       string
+		matchType  string
+	}
+	adGroups := make(map[key]map[int64]bool)
+	campaignNames := make(map[int64]string)
+
+	err := searchAll(ctx, client, customerID, keywordsQuery, func(row *googleads.GoogleAdsRow) {
+		k := key{
+			campaignID: row.Campaign.Id,
+			text:       strings.ToLower(strings.TrimSpace(row.AdGroupCriterion.Keyword.Text)),
+			matchType:  row.AdGroupCriterion.Keyword.MatchType.String(),
+		}
+		if adGroups[k] == nil {
+			adGroups[k] = make(map[int64]bool)
+		}
+		adGroups[k][row.AdGroup.Id] = true
+		campaignNames[row.Campaign.Id] = row.Campaign.Name
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var issues int
+	var examples []string
+	for k, groups := range adGroups {
+		if len(groups) < 2 {
+			continue
+		}
+		issues += len(groups) - 1
+		examples = appendExample(examples, fmt.Sprintf("%q [%s] in %s", k.text, k.matchType, campaignNames[k.campaignID]))
+	}
+	return issues, examples, nil
+}
+
+// auditMissingExtensions counts enabled campaigns lacking any of the
+// required extension types.
+func auditMissingExtensions(ctx context.Context, client *googleads.Service, customerID string) (int, []string, error) {
+	campaigns := make(map[int64]string)
+	err := searchAll(ctx, client, customerID, enabledCampaignsQuery, func(row *googleads.GoogleAdsRow) {
+		campaigns[row.Campaign.Id] = row.Campaign.Name
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	assets := make(map[int64]map[string]bool)
+	err = searchAll(ctx, client, customerID, campaignAssetsQuery, func(row *googleads.GoogleAdsRow) {
+		if assets[row.Campaign.Id] == nil {
+			assets[row.Campaign.Id] = make(map[string]bool)
+		}
+		assets[row.Campaign.Id][row.CampaignAsset.FieldType.String()] = true
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var issues int
+	var examples []string
+	for id, name := range campaigns {
+		var missing []string
+		for _, ext := range requiredExtensions {
+			if !assets[id][ext] {
+				missing = append(missing, strings.ToLower(ext))
+			}
+		}
+		if len(missing) > 0 {
+			issues++
+			examples = appendExample(examples, fmt.Sprintf("%s (no %s)", name, strings.Join(missing, ", ")))
+		}
+	}
+	return issues, examples, nil
+}
+
+// auditDisapprovedAds counts enabled ads that policy review disapproved.
+func auditDisapprovedAds(ctx context.Context, client *googleads.Service, customerID string) (int, []string, error) {
+	var issues int
+	var examples []string
+	err := searchAll(ctx, client, customerID, disapprovedAdsQuery, func(row *googleads.GoogleAdsRow) {
+		issues++
+		examples = appendExample(examples, fmt.Sprintf("ad %d in %s / %s", row.AdGroupAd.Ad.Id, row.Campaign.Name, row.AdGroup.Name))
+	})
+	return issues, examples, err
+}
+
+// auditEmptyAdGroups counts enabled ad groups without a single enabled ad;
+// they can never serve.
+func auditEmptyAdGroups(ctx context.Context, client *googleads.Service, customerID string) (int, []string, error) {
+	withAds := make(map[int64]bool)
+	err := searchAll(ctx, client, customerID, enabledAdsQuery, func(row *googleads.GoogleAdsRow) {
+		withAds[row.AdGroup.Id] = true
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var issues int
+	var examples []string
+	err = searchAll(ctx, client, customerID, enabledAdGroupsQuery, func(row *googleads.GoogleAdsRow) {
+		if !withAds[row.AdGroup.Id] {
+			issues++
+			examples = appendExample(examples, fmt.Sprintf("%s / %s", row.Campaign.Name, row.AdGroup.Name))
+		}
+	})
+	return issues, examples, err
+}
+
+// auditTrackingTemplates counts enabled campaigns whose effective tracking
+// template would break or drop the landing page URL.
+func auditTrackingTemplates(ctx context.Context, client *googleads.Service, customerID string) (int, []string, error) {
+	account, err := loadAccountTracking(ctx, client, customerID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var issues int
+	var examples []string
+	err = searchAll(ctx, client, customerID, enabledCampaignsQuery, func(row *googleads.GoogleAdsRow) {
+		template := row.Campaign.TrackingUrlTemplate
+		if template == "" {
+			template = account.TrackingUrlTemplate
+		}
+		if problems := tracking.CheckTemplate(template); len(problems) > 0 {
+			issues++
+			examples = appendExample(examples, fmt.Sprintf("%s: %s", row.Campaign.Name, problems[0]))
+		}
+	})
+	return issues, examples, err
+}
+
+// auditURLParameters counts enabled campaigns whose effective final URL
+// suffix deviates from the canonical UTM scheme, or whose ads hardcode
+// scheme parameters in their final URLs. Either way clicks land with UTM
+// values that no longer join to campaign data downstream.
+func auditURLParameters(ctx context.Context, client *googleads.Service, customerID string) (int, []string, error) {
+	account, err := loadAccountTracking(ctx, client, customerID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	problems := make(map[int64][]tracking.Issue)
+	names := make(map[int64]string)
+	err = searchAll(ctx, client, customerID, enabledCampaignsQuery, func(row *googleads.GoogleAdsRow) {
+		names[row.Campaign.Id] = row.Campaign.Name
+		suffix := tracking.EffectiveSuffix(row.Campaign.FinalUrlSuffix, account.FinalUrlSuffix)
+		problems[row.Campaign.Id] = append(problems[row.Campaign.Id], trackingScheme.CheckSuffix(suffix)...)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = searchAll(ctx, client, customerID, finalURLsQuery, func(row *googleads.GoogleAdsRow) {
+		for _, finalURL := range row.AdGroupAd.Ad.FinalUrls {
+			problems[row.Campaign.Id] = append(problems[row.Campaign.Id], trackingScheme.CheckFinalURL(finalURL)...)
+		}
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var issues int
+	var examples []string
+	for id, found := range problems {
+		if len(found) == 0 {
+			continue
+		}
+		issues++
+		examples = appendExample(examples, fmt.Sprintf("%s: %s", names[id], found[0]))
+	}
+	return issues, examples, nil
+}
+
+// loadAccountTracking returns the account-level template and suffix that
+// campaigns inherit when they set none of their own.
+func loadAccountTracking(ctx context.Context, client *googleads.Service, customerID string) (*googleads.Customer, error) {
+	account := &googleads.Customer{}
+	err := searchAll(ctx, client, customerID, accountTrackingQuery, func(row *googleads.GoogleAdsRow) {
+		if row.Customer != nil {
+			account = row.Customer
+		}
+	})
+	return account, err
+}
+
+// searchAll pages through a query and calls fn for every row.
+func searchAll(ctx context.Context, client *googleads.Service, customerID, query string, fn func(*googleads.GoogleAdsRow)) error {
+	pageToken := ""
+	for {
+		resp, err := client.Search(ctx, &googleads.SearchGoogleAdsRequest{
+			CustomerId: customerID,
+			Query:      query,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to search: %w", err)
+		}
+		for _, row := range resp.Results {
+			fn(row)
+		}
+		if resp.NextPageToken == "" {
+			return nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+func appendExample(examples []string, example string) []string {
+	if len(examples) < maxExamples {
+		examples = append(examples, example)
+	}
+	return examples
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/notify"
+)
+
+// trendWeeks is how many prior weeks are shown alongside the current score.
+const trendWeeks = 8
+
+// HygieneRecord is one account's weekly score as stored in DynamoDB.
+type HygieneRecord struct {
+	CustomerID string                `dynamodbav:"customer_id"`
+	WeekStart  string                `dynamodbav:"week_start"`
+	Score      float64               `dynamodbav:"score"`
+	Checks     []notify.HygieneCheck `dynamodbav:"checks"`
+	ComputedAt time.Time             `dynamodbav:"computed_at"`
+}
+
+// weekStart returns the Monday (UTC) of the week containing t.
+func weekStart(t time.Time) string {
+	t = t.UTC()
+	offset := (int(t.Weekday()) + 6) % 7
+	return t.AddDate(0, 0, -offset).Format("2006-01-02")
+}
+
+// loadTrend returns up to trendWeeks scores recorded before week, oldest
+// first.
+func loadTrend(ctx context.Context, svc *dynamodb.Client, customerID, week string) ([]float64, error) {
+	result, err := svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(hygieneTable),
+		KeyConditionExpression: aws.String("customer_id = :customer AND week_start < :week"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":customer": &types.AttributeValueMemberS{Value: customerID},
+			":week":     &types.AttributeValueMemberS{Value: week},
+		},
+		ProjectionExpression: aws.String("score"),
+		ScanIndexForward:     aws.Bool(false),
+		Limit:                aws.Int32(trendWeeks),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hygiene history: %w", err)
+	}
+
+	var records []HygieneRecord
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &records); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal hygiene history: %w", err)
+	}
+
+	trend := make([]float64, len(records))
+	for i, record := range records {
+		trend[len(records)-1-i] = record.Score
+	}
+	return trend, nil
+}
+
+// saveScore records the week's score; re-running in the same week
+// overwrites it.
+func saveScore(ctx context.Context, svc *dynamodb.Client, record HygieneRecord) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hygiene record: %w", err)
+	}
+
+	_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(hygieneTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save hygiene record: %w", err)
+	}
+	return nil
+}
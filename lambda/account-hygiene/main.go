@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	"pkg/envelope"
+	"pkg/notify"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+var (
+	secretName   = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	snsTopicARN  = os.Getenv("SNS_TOPIC_ARN")
+	hygieneTable = os.Getenv("HYGIENE_TABLE_NAME")
+	environment  = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+)
+
+func main() {
+	lambda.Start(HandleAccountHygiene)
+}
+
+// HandleAccountHygiene runs weekly: it audits every active account's
+// structure, records the score and publishes the weekly digest.
+func HandleAccountHygiene(ctx context.Context, event interface{}) error {
+	log.Printf("Starting account hygiene audit for environment: %s", environment)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dynamoClient := dynamodb.NewFromConfig(cfg)
+
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := createGoogleAdsClient(adsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	accounts, err := loadAccounts(ctx, dynamoClient)
+	if err != nil {
+		return fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+
+	now := clk.Now()
+	week := weekStart(now)
+	digest := notify.WeeklyDigest{
+		Kind:        notify.KindWeeklyDigest,
+		WeekStart:   week,
+		Environment: environment,
+		GeneratedAt: now,
+	}
+
+	var failed int
+	for _, account := range accounts {
+		hygiene, err := auditAccount(ctx, client, dynamoClient, account, week)
+		if err != nil {
+			log.Printf("Failed to audit account %s: %v", account.CustomerID, err)
+			failed++
+			continue
+		}
+		digest.Hygiene = append(digest.Hygiene, hygiene)
+	}
+	if failed > 0 && failed == len(accounts) {
+		return fmt.Errorf("failed to audit all %d accounts", failed)
+	}
+
+	if err := publishDigest(ctx, cfg, digest); err != nil {
+		return fmt.Errorf("failed to publish weekly digest: %w", err)
+	}
+
+	log.Printf("Account hygiene audit completed for %d accounts", len(digest.Hygiene))
+	return nil
+}
+
+func auditAccount(ctx context.Context, client *googleads.Service, dynamoClient *dynamodb.Client, account rotationAccount, week string) (notify.AccountHygiene, error) {
+	score, checks, err := runAudits(ctx, client, account.CustomerID)
+	if err != nil {
+		return notify.AccountHygiene{}, err
+	}
+
+	trend, err := loadTrend(ctx, dynamoClient, account.CustomerID, week)
+	if err != nil {
+		return notify.AccountHygiene{}, err
+	}
+
+	err = saveScore(ctx, dynamoClient, HygieneRecord{
+		CustomerID: account.CustomerID,
+		WeekStart:  week,
+		Score:      score,
+		Checks:     checks,
+		ComputedAt: clk.Now(),
+	})
+	if err != nil {
+		return notify.AccountHygiene{}, err
+	}
+
+	hygiene := notify.AccountHygiene{
+		CustomerID:  account.CustomerID,
+		AccountName: account.DescriptiveName,
+		Score:       score,
+		Trend:       trend,
+		Checks:      checks,
+	}
+	if len(trend) > 0 {
+		previous := trend[len(trend)-1]
+		hygiene.PreviousScore = &previous
+	}
+
+	log.Printf("Account %s hygiene score %.0f", account.CustomerID, score)
+	return hygiene, nil
+}
+
+func publishDigest(ctx context.Context, cfg aws.Config, digest notify.WeeklyDigest) error {
+	body, err := envelope.New("account-hygiene", nil, "", clk).Seal(ctx, envelope.Meta{
+		Type:          notify.KindWeeklyDigest,
+		SchemaVersion: notify.WeeklyDigestSchemaVersion,
+	}, digest)
+	if err != nil {
+		return fmt.Errorf("failed to seal digest: %w", err)
+	}
+
+	_, err = sns.NewFromConfig(cfg).Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(snsTopicARN),
+		Message:  aws.String(body),
+		Subject:  aws.String(fmt.Sprintf("Google Ads Weekly Digest - Week of %s", digest.WeekStart)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to SNS: %w", err)
+	}
+	return nil
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	srv, err := googleads.NewService(context.Background(),
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
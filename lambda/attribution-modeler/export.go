@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// reportAttributionModels is the key prefix of the exports.
+const reportAttributionModels = "attribution_models"
+
+// Exporter writes one CSV per modeled day.
+type Exporter struct {
+	client *s3.Client
+	bucket string
+}
+
+// WriteDay writes every tenant's CampaignDays of day to
+// attribution_models/date=YYYY-MM-DD/campaigns.csv. Days without
+// attributed orders are written with the header alone, so a rerun clears
+// the rows of a day modeled before.
+func (e *Exporter) WriteDay(ctx context.Context, day time.Time, tenants []string, byTenant map[string]*dayModel) error {
+	rows := [][]string{{
+		"tenant_id", "date", "model", "campaign_id", "currency", "conversions", "revenue",
+	}}
+	for _, id := range tenants {
+		for _, d := range byTenant[id].days {
+			rows = append(rows, []string{
+				id,
+				d.Date,
+				d.Model,
+				d.CampaignID,
+				d.Currency,
+				strconv.FormatFloat(d.Conversions, 'f', 4, 64),
+				strconv.FormatFloat(d.Revenue, 'f', 2, 64),
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to encode attribution models: %w", err)
+	}
+
+	key := fmt.Sprintf("%s/date=%s/campaigns.csv", reportAttributionModels, day.Format("2006-01-02"))
+	_, err := e.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(e.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("text/csv"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"pkg/attribution"
+	"pkg/clock"
+	"pkg/dynamo"
+	_ "pkg/localdev"
+	"pkg/metrics"
+	"pkg/tenant"
+)
+
+// metricNamespace groups the attribution metrics.
+const metricNamespace = "Ecommerce/Attribution"
+
+// ModelingEvent optionally narrows a run. The daily schedule sends an
+// empty event; a backfill passes an inclusive date range, e.g.
+// {"start_date": "2024-01-01", "end_date": "2024-03-31"}.
+type ModelingEvent struct {
+	StartDate string `json:"start_date,omitempty"`
+	EndDate   string `json:"end_date,omitempty"`
+}
+
+// maxBackfillDays bounds a single invocation's date range so a backfill
+// fits in the Lambda timeout; split longer ranges into several events.
+const maxBackfillDays = 92
+
+var (
+	attributionsTable = os.Getenv("ATTRIBUTIONS_TABLE_NAME")
+	resultsTable      = os.Getenv("ATTRIBUTION_MODELS_TABLE_NAME")
+	resultsBucket     = os.Getenv("ATTRIBUTION_MODELS_BUCKET")
+	environment       = os.Getenv("ENVIRONMENT")
+
+	// refreshDays is how many days, ending yesterday, the daily run
+	// models again: orders interrupted at checkout are attributed when
+	// the recovery sweep completes them, up to a day or two late.
+	refreshDays = getIntEnv("REFRESH_DAYS", 3)
+
+	clk = clock.FromEnv()
+)
+
+func main() {
+	lambda.Start(HandleModeling)
+}
+
+// HandleModeling runs daily. For each day of the range it spreads every
+// attributed order over its touchpoints under each model in
+// attribution.Models, stores each tenant's credit per model, day, campaign
+// and currency in the results table that reports-service compares models
+// from, and exports the day to the results bucket as CSV.
+func HandleModeling(ctx context.Context, event ModelingEvent) error {
+	log.Printf("Starting attribution modeling for environment: %s", environment)
+
+	emf := metrics.NewLogger(metricNamespace, map[string]string{
+		"Function":    "attribution-modeler",
+		"Environment": environment,
+	}, clk)
+	defer emf.Flush()
+
+	now := clk.Now().UTC()
+	start, end, err := modelingRange(event, now)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dynamoClient := dynamodb.NewFromConfig(cfg)
+	store := attribution.NewStore(nil, dynamo.NewTable(dynamoClient, attributionsTable), clk, 0)
+	results := attribution.NewResults(dynamo.NewTable(dynamoClient, resultsTable, dynamo.WithTenancy(dynamo.PartitionKey)))
+	exporter := &Exporter{client: s3.NewFromConfig(cfg), bucket: resultsBucket}
+
+	var modeled, failed, orders int
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		n, err := modelDay(ctx, store, results, exporter, day, now)
+		if err != nil {
+			log.Printf("Failed to model attribution of %s: %v", day.Format("2006-01-02"), err)
+			failed++
+			continue
+		}
+		modeled++
+		orders += n
+	}
+
+	emf.Count("AttributionDaysModeled", modeled)
+	emf.Count("AttributionDaysFailed", failed)
+	emf.Count("AttributionOrdersModeled", orders)
+	if failed > 0 && modeled == 0 {
+		return fmt.Errorf("failed to model all %d days", failed)
+	}
+
+	log.Printf("Attribution modeling completed: %d days (%d orders) modeled, %d failed", modeled, orders, failed)
+	return nil
+}
+
+// modelingRange is the inclusive range of days to model: the last
+// refreshDays days ending yesterday, or the event's range.
+func modelingRange(event ModelingEvent, now time.Time) (time.Time, time.Time, error) {
+	if event.StartDate == "" && event.EndDate == "" {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		end := today.AddDate(0, 0, -1)
+		return end.AddDate(0, 0, -(refreshDays - 1)), end, nil
+	}
+
+	start, err := time.Parse("2006-01-02", event.StartDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_date must be YYYY-MM-DD: %w", err)
+	}
+	end, err := time.Parse("2006-01-02", event.EndDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("end_date must be YYYY-MM-DD: %w", err)
+	}
+	if end.Before(start) || end.Sub(start) >= maxBackfillDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range must be 1 to %d days", maxBackfillDays)
+	}
+	return start, end, nil
+}
+
+// modelDay models the attributed orders placed on day, in UTC, storing
+// each tenant's CampaignDays and exporting the day. It returns the orders
+// modeled.
+func modelDay(ctx context.Context, store *attribution.Store, results *attribution.Results, exporter *Exporter, day, now time.Time) (int, error) {
+	byTenant := make(map[string]*dayModel)
+	var tenants []string
+	var orders int
+	err := store.AllRecords(ctx, attribution.StatusAttributed, day, day.AddDate(0, 0, 1), func(records []attribution.Record) error {
+		for _, r := range records {
+			id := r.TenantID
+			if id == "" {
+				id = tenant.Default
+			}
+			m, ok := byTenant[id]
+			if !ok {
+				m = newDayModel(day, now)
+				byTenant[id] = m
+				tenants = append(tenants, id)
+			}
+			if err := m.add(r); err != nil {
+				return fmt.Errorf("order %s: %w", r.OrderID, err)
+			}
+			orders++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range tenants {
+		if err := results.Write(tenant.WithID(ctx, id), byTenant[id].days); err != nil {
+			return 0, fmt.Errorf("tenant %s: %w", id, err)
+		}
+	}
+	if err := exporter.WriteDay(ctx, day, tenants, byTenant); err != nil {
+		return 0, err
+	}
+	return orders, nil
+}
+
+// Utility functions
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
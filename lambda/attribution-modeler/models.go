@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"pkg/attribution"
+)
+
+// dayModel totals one tenant's orders of one day under every model, per
+// campaign and currency.
+type dayModel struct {
+	date       string
+	computedAt time.Time
+	index      map[dayKey]int
+	days       []attribution.CampaignDay
+}
+
+type dayKey struct{ model, campaign, currency string }
+
+func newDayModel(day, now time.Time) *dayModel {
+	return &dayModel{
+		date:       day.Format("2006-01-02"),
+		computedAt: now,
+		index:      make(map[dayKey]int),
+	}
+}
+
+// add credits r's order to its campaigns under each model.
+func (m *dayModel) add(r attribution.Record) error {
+	for _, model := range attribution.Models {
+		credits, err := attribution.Credits(model, r)
+		if err != nil {
+			return err
+		}
+		for _, c := range credits {
+			key := dayKey{model: model, campaign: c.CampaignID, currency: r.Currency}
+			i, ok := m.index[key]
+			if !ok {
+				i = len(m.days)
+				m.index[key] = i
+				m.days = append(m.days, attribution.CampaignDay{
+					Model:      model,
+					Date:       m.date,
+					CampaignID: c.CampaignID,
+					Currency:   r.Currency,
+					ComputedAt: m.computedAt,
+				})
+			}
+			m.days[i].Conversions += c.Share
+			m.days[i].Revenue += c.Share * r.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/notify"
+)
+
+// InsightsReport is one account's auction insights for a week, stored as
+// auction_insights/<window start>/<customer_id>.json.
+type InsightsReport struct {
+	CustomerID  string                    `json:"customer_id"`
+	AccountName string                    `json:"account_name,omitempty"`
+	WindowStart string                    `json:"window_start"`
+	WindowEnd   string                    `json:"window_end"`
+	GeneratedAt time.Time                 `json:"generated_at"`
+	Competitors []Competitor              `json:"competitors"`
+	Changes     []notify.CompetitorChange `json:"changes,omitempty"`
+}
+
+// Competitor is one domain's auction insights across the account's search
+// campaigns. Google Ads reports them per campaign; the account figures
+// weigh each campaign by its impressions, so a domain met in one small
+// campaign does not look like a rival everywhere. PositionAboveRate and
+// TopImpressionPercentage are weighed by the overlapping impressions
+// instead, since they only describe auctions both took part in.
+type Competitor struct {
+	Domain                  string  `json:"domain"`
+	Campaigns               int     `json:"campaigns"`
+	ImpressionShare         float64 `json:"impression_share"`
+	OverlapRate             float64 `json:"overlap_rate"`
+	PositionAboveRate       float64 `json:"position_above_rate"`
+	OutrankingShare         float64 `json:"outranking_share"`
+	TopImpressionPercentage float64 `json:"top_impression_percentage"`
+}
+
+// accountCompetitors reads the auction insights of the account's search
+// campaigns for the week starting start and combines them per domain,
+// largest overlap first.
+func accountCompetitors(ctx context.Context, client *googleads.Service, customerID string, start time.Time) ([]Competitor, error) {
+	from, to := start.Format("2006-01-02"), start.AddDate(0, 0, 6).Format("2006-01-02")
+
+	impressionsQuery := gaql.Select(
+		"campaign.id",
+		"metrics.impressions",
+	).From("campaign").
+		Where("campaign.advertising_channel_type", gaql.Equals, "SEARCH").
+		Where("metrics.impressions", gaql.GreaterThan, 0).
+		Between("segments.date", from, to).
+		MustBuild()
+	rows, err := searchAll(ctx, client, customerID, impressionsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search campaign impressions: %w", err)
+	}
+	impressions := make(map[int64]float64)
+	var total float64
+	for _, row := range rows {
+		impressions[row.Campaign.Id] += float64(row.Metrics.Impressions)
+		total += float64(row.Metrics.Impressions)
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	insightsQuery := gaql.Select(
+		"campaign.id",
+		"segments.auction_insight_domain",
+		"metrics.auction_insight_search_impression_share",
+		"metrics.auction_insight_search_overlap_rate",
+		"metrics.auction_insight_search_position_above_rate",
+		"metrics.auction_insight_search_outranking_share",
+		"metrics.auction_insight_search_top_impression_percentage",
+	).From("campaign").
+		Where("campaign.advertising_channel_type", gaql.Equals, "SEARCH").
+		Between("segments.date", from, to).
+		MustBuild()
+	rows, err = searchAll(ctx, client, customerID, insightsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search auction insights: %w", err)
+	}
+
+	type sums struct {
+		campaigns                              map[int64]bool
+		share, overlap, above, outranking, top float64
+	}
+	byDomain := make(map[string]*sums)
+	for _, row := range rows {
+		domain := row.Segments.AuctionInsightDomain
+		weight := impressions[row.Campaign.Id]
+		if domain == "" || weight == 0 {
+			continue
+		}
+		s, ok := byDomain[domain]
+		if !ok {
+			s = &sums{campaigns: make(map[int64]bool)}
+			byDomain[domain] = s
+		}
+		m := row.Metrics
+		overlapping := m.AuctionInsightSearchOverlapRate * weight
+		s.campaigns[row.Campaign.Id] = true
+		s.share += m.AuctionInsightSearchImpressionShare * weight
+		s.overlap += overlapping
+		s.outranking += m.AuctionInsightSearchOutrankingShare * weight
+		s.above += m.AuctionInsightSearchPositionAboveRate * overlapping
+		s.top += m.AuctionInsightSearchTopImpressionPercentage * overlapping
+	}
+
+	competitors := make([]Competitor, 0, len(byDomain))
+	for domain, s := range byDomain {
+		c := Competitor{
+			Domain:          domain,
+			Campaigns:       len(s.campaigns),
+			ImpressionShare: s.share / total,
+			OverlapRate:     s.overlap / total,
+			OutrankingShare: s.outranking / total,
+		}
+		if s.overlap > 0 {
+			c.PositionAboveRate = s.above / s.overlap
+			c.TopImpressionPercentage = s.top / s.overlap
+		}
+		competitors = append(competitors, c)
+	}
+	sort.Slice(competitors, func(i, j int) bool {
+		if competitors[i].OverlapRate != competitors[j].OverlapRate {
+			return competitors[i].OverlapRate > competitors[j].OverlapRate
+		}
+		return competitors[i].Domain < competitors[j].Domain
+	})
+	return competitors, nil
+}
+
+// searchAll reads every page of query.
+func searchAll(ctx context.Context, client *googleads.Service, customerID, query string) ([]*googleads.GoogleAdsRow, error) {
+	var rows []*googleads.GoogleAdsRow
+	var pageToken string
+	for {
+		resp, err := client.Search(ctx, &googleads.SearchGoogleAdsRequest{
+			CustomerId: customerID,
+			Query:      query,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, resp.Results...)
+		if resp.NextPageToken == "" {
+			return rows, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// compareCompetitors lists the domains that reached competitorMinOverlap
+// since the previous week, then those whose overlap or position above rate
+// moved by competitorShift or more, then those that fell below it, each
+// largest overlap first.
+func compareCompetitors(current, previous []Competitor) []notify.CompetitorChange {
+	before := make(map[string]Competitor, len(previous))
+	for _, c := range previous {
+		before[c.Domain] = c
+	}
+	after := make(map[string]Competitor, len(current))
+	for _, c := range current {
+		after[c.Domain] = c
+	}
+
+	var entered, shifted, left []notify.CompetitorChange
+	for _, c := range current {
+		if c.OverlapRate < competitorMinOverlap {
+			continue
+		}
+		change := notify.CompetitorChange{
+			Domain:            c.Domain,
+			ImpressionShare:   c.ImpressionShare,
+			OverlapRate:       c.OverlapRate,
+			PositionAboveRate: c.PositionAboveRate,
+		}
+		prev, ok := before[c.Domain]
+		if !ok || prev.OverlapRate < competitorMinOverlap {
+			change.Change = notify.CompetitorNew
+			entered = append(entered, change)
+			continue
+		}
+		if math.Abs(c.OverlapRate-prev.OverlapRate) < competitorShift && math.Abs(c.PositionAboveRate-prev.PositionAboveRate) < competitorShift {
+			continue
+		}
+		change.Change = notify.CompetitorShift
+		change.PreviousOverlapRate = &prev.OverlapRate
+		change.PreviousPositionAboveRate = &prev.PositionAboveRate
+		shifted = append(shifted, change)
+	}
+
+	for _, prev := range previous {
+		if prev.OverlapRate < competitorMinOverlap {
+			continue
+		}
+		if c, ok := after[prev.Domain]; ok && c.OverlapRate >= competitorMinOverlap {
+			continue
+		}
+		prev := prev
+		left = append(left, notify.CompetitorChange{
+			Domain:                    prev.Domain,
+			Change:                    notify.CompetitorGone,
+			PreviousOverlapRate:       &prev.OverlapRate,
+			PreviousPositionAboveRate: &prev.PositionAboveRate,
+		})
+	}
+
+	return append(append(entered, shifted...), left...)
+}
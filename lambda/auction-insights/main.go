@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	"pkg/envelope"
+	"pkg/notify"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+var (
+	secretName    = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	snsTopicARN   = os.Getenv("SNS_TOPIC_ARN")
+	reportsBucket = os.Getenv("REPORTS_BUCKET")
+	environment   = os.Getenv("ENVIRONMENT")
+
+	// A domain is counted as a competitor once it showed alongside the
+	// account's ads in at least competitorMinOverlap of its impressions.
+	// Moving its overlap or position above rate by competitorShift or
+	// more between weeks is a significant shift.
+	competitorMinOverlap = parseFloatEnv("COMPETITOR_MIN_OVERLAP", 0.05)
+	competitorShift      = parseFloatEnv("COMPETITOR_SHIFT", 0.10)
+
+	clk = clock.FromEnv()
+)
+
+func main() {
+	lambda.Start(HandleAuctionInsights)
+}
+
+// HandleAuctionInsights runs weekly: for every active account it reads
+// the last full week's auction insights, stores them, compares them with
+// the week before and publishes the changes as a weekly digest section.
+func HandleAuctionInsights(ctx context.Context, event interface{}) error {
+	log.Printf("Starting auction insights digest for environment: %s", environment)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := createGoogleAdsClient(adsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	accounts, err := loadAccounts(ctx, dynamodb.NewFromConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+
+	now := clk.Now()
+	week := weekStart(now)
+	digest := notify.WeeklyDigest{
+		Kind:        notify.KindWeeklyDigest,
+		WeekStart:   week,
+		Environment: environment,
+		GeneratedAt: now,
+	}
+	store := &ReportStore{client: s3.NewFromConfig(cfg), bucket: reportsBucket}
+
+	var failed int
+	for _, account := range accounts {
+		competitors, err := digestAccount(ctx, client, store, account, now)
+		if err != nil {
+			log.Printf("Failed to read auction insights for account %s: %v", account.CustomerID, err)
+			failed++
+			continue
+		}
+		digest.Competitors = append(digest.Competitors, competitors)
+	}
+	if failed > 0 && failed == len(accounts) {
+		return fmt.Errorf("failed to read auction insights for all %d accounts", failed)
+	}
+
+	if err := publishDigest(ctx, cfg, digest); err != nil {
+		return fmt.Errorf("failed to publish weekly digest: %w", err)
+	}
+
+	log.Printf("Auction insights digest completed for %d accounts", len(digest.Competitors))
+	return nil
+}
+
+// digestAccount reads and stores one account's auction insights for the
+// last full week and compares them with the stored week before. A missing
+// previous report means every competitor is new, so changes are only
+// reported once there is one.
+func digestAccount(ctx context.Context, client *googleads.Service, store *ReportStore, account rotationAccount, now time.Time) (notify.AccountCompetitors, error) {
+	start, _ := time.Parse("2006-01-02", weekStart(now))
+	start = start.AddDate(0, 0, -7)
+	report := InsightsReport{
+		CustomerID:  account.CustomerID,
+		AccountName: account.DescriptiveName,
+		WindowStart: start.Format("2006-01-02"),
+		WindowEnd:   start.AddDate(0, 0, 6).Format("2006-01-02"),
+		GeneratedAt: now,
+	}
+
+	competitors, err := accountCompetitors(ctx, client, account.CustomerID, start)
+	if err != nil {
+		return notify.AccountCompetitors{}, err
+	}
+	report.Competitors = competitors
+
+	previous, err := store.Read(ctx, account.CustomerID, start.AddDate(0, 0, -7).Format("2006-01-02"))
+	if err != nil {
+		return notify.AccountCompetitors{}, err
+	}
+	if previous != nil {
+		report.Changes = compareCompetitors(report.Competitors, previous.Competitors)
+	}
+
+	uri, err := store.Write(ctx, report)
+	if err != nil {
+		return notify.AccountCompetitors{}, err
+	}
+
+	summary := notify.AccountCompetitors{
+		CustomerID:  report.CustomerID,
+		AccountName: report.AccountName,
+		WindowStart: report.WindowStart,
+		WindowEnd:   report.WindowEnd,
+		Changes:     report.Changes,
+		ReportURI:   uri,
+	}
+	for _, c := range report.Competitors {
+		if c.OverlapRate >= competitorMinOverlap {
+			summary.Competitors++
+		}
+	}
+	log.Printf("Account %s: %d competitors, %d changes", account.CustomerID, summary.Competitors, len(summary.Changes))
+	return summary, nil
+}
+
+func publishDigest(ctx context.Context, cfg aws.Config, digest notify.WeeklyDigest) error {
+	body, err := envelope.New("auction-insights", nil, "", clk).Seal(ctx, envelope.Meta{
+		Type:          notify.KindWeeklyDigest,
+		SchemaVersion: notify.WeeklyDigestSchemaVersion,
+	}, digest)
+	if err != nil {
+		return fmt.Errorf("failed to seal digest: %w", err)
+	}
+
+	_, err = sns.NewFromConfig(cfg).Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(snsTopicARN),
+		Message:  aws.String(body),
+		Subject:  aws.String(fmt.Sprintf("Google Ads Weekly Digest - Week of %s", digest.WeekStart)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to SNS: %w", err)
+	}
+	return nil
+}
+
+// weekStart returns the Monday (UTC) of the week containing t.
+func weekStart(t time.Time) string {
+	t = t.UTC()
+	offset := (int(t.Weekday()) + 6) % 7
+	return t.AddDate(0, 0, -offset).Format("2006-01-02")
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	srv, err := googleads.NewService(context.Background(),
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
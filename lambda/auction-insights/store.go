@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// reportAuctionInsights is the key prefix of the stored reports.
+const reportAuctionInsights = "auction_insights"
+
+// ReportStore keeps one report per account and week in REPORTS_BUCKET,
+// which is also where the previous week is read back from.
+type ReportStore struct {
+	client *s3.Client
+	bucket string
+}
+
+func reportKey(customerID, windowStart string) string {
+	return fmt.Sprintf("%s/%s/%s.json", reportAuctionInsights, windowStart, customerID)
+}
+
+// Read returns the account's report for the week starting windowStart,
+// or nil when there is none.
+func (s *ReportStore) Read(ctx context.Context, customerID, windowStart string) (*InsightsReport, error) {
+	key := reportKey(customerID, windowStart)
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var missing *types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	var report InsightsReport
+	if err := json.NewDecoder(out.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return &report, nil
+}
+
+// Write stores report, replacing any earlier run for the same week, and
+// returns its URI.
+func (s *ReportStore) Write(ctx context.Context, report InsightsReport) (string, error) {
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode report: %w", err)
+	}
+	key := reportKey(report.CustomerID, report.WindowStart)
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// trigger is a domain event that can move a user into or out of a list.
+type trigger string
+
+const (
+	triggerCartAbandoned  trigger = "cart_abandoned"
+	triggerOrderCompleted trigger = "order_completed"
+	triggerUserRegistered trigger = "user_registered"
+	// triggerConsentChanged adds to no list; Apply removes users who
+	// withdrew ads personalization consent from every list.
+	triggerConsentChanged trigger = "consent_changed"
+	// triggerHighLTV and triggerLTVDropped are ltv-scorer placing a
+	// customer in, or moving them out of, its high tier.
+	triggerHighLTV    trigger = "high_ltv"
+	triggerLTVDropped trigger = "ltv_dropped"
+)
+
+// ltvTierHigh is ltv-scorer's top tier.
+const ltvTierHigh = "high"
+
+// Audience is a Customer Match user list and the events that add users to
+// it or remove them. Membership lasts Duration after the last add, after
+// which the daily run removes the user.
+type Audience struct {
+	Key      string
+	ListID   string
+	Duration time.Duration
+	AddOn    []trigger
+	RemoveOn []trigger
+}
+
+// audiences are the configured lists; a list without an ID is disabled.
+var audiences = loadAudiences()
+
+func loadAudiences() []Audience {
+	var out []Audience
+	if id := os.Getenv("CART_ABANDONERS_LIST_ID"); id != "" {
+		out = append(out, Audience{
+			Key:      "cart_abandoners",
+			ListID:   id,
+			Duration: days(getIntEnv("CART_ABANDONERS_MEMBERSHIP_DAYS", 30)),
+			AddOn:    []trigger{triggerCartAbandoned},
+			// Buyers are no longer abandoners; keep them out of recovery
+			// campaigns.
+			RemoveOn: []trigger{triggerOrderCompleted},
+		})
+	}
+	if id := os.Getenv("PURCHASERS_LIST_ID"); id != "" {
+		out = append(out, Audience{
+			Key:      "purchasers",
+			ListID:   id,
+			Duration: days(getIntEnv("PURCHASERS_MEMBERSHIP_DAYS", 540)),
+			AddOn:    []trigger{triggerOrderCompleted},
+		})
+	}
+	if id := os.Getenv("REGISTERED_USERS_LIST_ID"); id != "" {
+		out = append(out, Audience{
+			Key:      "registered_users",
+			ListID:   id,
+			Duration: days(getIntEnv("REGISTERED_USERS_MEMBERSHIP_DAYS", 540)),
+			// Every consenting account, for excluding existing customers
+			// from acquisition campaigns; purchases renew the membership.
+			AddOn: []trigger{triggerUserRegistered, triggerOrderCompleted},
+		})
+	}
+	if id := os.Getenv("HIGH_LTV_LIST_ID"); id != "" {
+		out = append(out, Audience{
+			Key:    "high_ltv",
+			ListID: id,
+			// Outlasts a few of ltv-scorer's re-announcements, so members
+			// leave only when their tier drops or scoring stops.
+			Duration: days(getIntEnv("HIGH_LTV_MEMBERSHIP_DAYS", 90)),
+			AddOn:    []trigger{triggerHighLTV},
+			RemoveOn: []trigger{triggerLTVDropped},
+		})
+	}
+	return out
+}
+
+func (a Audience) resourceName() string {
+	return "customers/" + customerID + "/userLists/" + a.ListID
+}
+
+func has(triggers []trigger, t trigger) bool {
+	for _, candidate := range triggers {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	domain "pkg/events"
+	"pkg/warmup"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+// Event detail types consumed from the platform event bus that pkg/events
+// does not define.
+const (
+	detailTypeConsentChanged = "User Consent Changed"
+	detailTypeLTVTierChanged = "Customer LTV Tier Changed"
+	detailTypeScheduled      = "Scheduled Event"
+)
+
+// ConsentChanged is the part of user-service's "User Consent Changed"
+// detail this lambda needs; the consents themselves are read from the
+// user, as for every event.
+type ConsentChanged struct {
+	UserID string `json:"user_id"`
+}
+
+// LTVTierChanged is the part of ltv-scorer's "Customer LTV Tier Changed"
+// detail this lambda needs. A high-tier customer is re-announced
+// periodically though unchanged, renewing their membership.
+type LTVTierChanged struct {
+	UserID string `json:"user_id"`
+	Tier   string `json:"tier"`
+}
+
+var (
+	secretName       = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	customerID       = os.Getenv("GOOGLE_ADS_CUSTOMER_ID")
+	usersTable       = os.Getenv("USERS_TABLE_NAME")
+	membershipsTable = os.Getenv("MEMBERSHIPS_TABLE_NAME")
+	environment      = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+
+	// Set up during init rather than per event; the secret and the client
+	// are reloaded every warmup.RefreshFromEnv.
+	awsCfg          = warmup.New("aws_config", 0, loadAWSConfig)
+	googleAdsSecret = warmup.New("google_ads_secret", warmup.RefreshFromEnv(), loadGoogleAdsConfig)
+	adsClient       = warmup.New("google_ads_client", warmup.RefreshFromEnv(), createGoogleAdsClient)
+)
+
+func init() {
+	warmup.Prime(awsCfg, googleAdsSecret, adsClient)
+}
+
+func main() {
+	lambda.Start(warmup.ErrorHandler(HandleEvent))
+}
+
+// HandleEvent applies list membership changes for cart, order, sign-up
+// and LTV tier events and, on the daily schedule, removes memberships that have run
+// their course. Errors are returned so EventBridge retries the invocation;
+// membership records make the retry safe.
+func HandleEvent(ctx context.Context, event events.CloudWatchEvent) error {
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	syncer := &Syncer{
+		db:        dynamodb.NewFromConfig(cfg),
+		loadAds:   func() (*googleads.Service, error) { return adsClient.Get(ctx) },
+		pending:   make(map[string]*listBatch),
+		audiences: audiences,
+	}
+
+	switch event.DetailType {
+	case domain.DetailTypeCartAbandoned:
+		var cart domain.CartAbandoned
+		if _, err := domain.Unmarshal(event.Detail, &cart); err != nil {
+			log.Printf("Skipping malformed event %s: %v", event.ID, err)
+			return nil
+		}
+		if err := syncer.Apply(ctx, cart.UserID, triggerCartAbandoned); err != nil {
+			return err
+		}
+	case domain.DetailTypeOrderCompleted:
+		var order domain.OrderCompleted
+		if _, err := domain.Unmarshal(event.Detail, &order); err != nil {
+			log.Printf("Skipping malformed event %s: %v", event.ID, err)
+			return nil
+		}
+		if err := syncer.Apply(ctx, order.UserID, triggerOrderCompleted); err != nil {
+			return err
+		}
+	case domain.DetailTypeUserRegistered:
+		var user domain.UserRegistered
+		if _, err := domain.Unmarshal(event.Detail, &user); err != nil {
+			log.Printf("Skipping malformed event %s: %v", event.ID, err)
+			return nil
+		}
+		if err := syncer.Apply(ctx, user.UserID, triggerUserRegistered); err != nil {
+			return err
+		}
+	case detailTypeConsentChanged:
+		var change ConsentChanged
+		if err := json.Unmarshal(event.Detail, &change); err != nil {
+			log.Printf("Skipping malformed event %s: %v", event.ID, err)
+			return nil
+		}
+		if err := syncer.Apply(ctx, change.UserID, triggerConsentChanged); err != nil {
+			return err
+		}
+	case detailTypeLTVTierChanged:
+		var change LTVTierChanged
+		if err := json.Unmarshal(event.Detail, &change); err != nil {
+			log.Printf("Skipping malformed event %s: %v", event.ID, err)
+			return nil
+		}
+		t := triggerLTVDropped
+		if change.Tier == ltvTierHigh {
+			t = triggerHighLTV
+		}
+		if err := syncer.Apply(ctx, change.UserID, t); err != nil {
+			return err
+		}
+	case detailTypeScheduled:
+		if err := syncer.ExpireMemberships(ctx); err != nil {
+			return err
+		}
+	default:
+		log.Printf("Ignoring event %s with detail type %q", event.ID, event.DetailType)
+		return nil
+	}
+
+	return syncer.Flush(ctx)
+}
+
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx)
+}
+
+func loadGoogleAdsConfig(ctx context.Context) (*GoogleAdsConfig, error) {
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(ctx context.Context) (*googleads.Service, error) {
+	adsConfig, err := googleAdsSecret.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	srv, err := googleads.NewService(context.Background(),
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"google.golang.org/api/googleads"
+
+	"pkg/customermatch"
+)
+
+// Membership statuses.
+const (
+	membershipActive  = "MEMBER"
+	membershipRemoved = "REMOVED"
+)
+
+// Removal reasons recorded on memberships.
+const (
+	reasonEvent            = "event"
+	reasonExpired          = "expired"
+	reasonConsentWithdrawn = "consent_withdrawn"
+	reasonUserDeleted      = "user_deleted"
+)
+
+// maxOperationsPerUpload is the Customer Match limit per UploadUserData call.
+const maxOperationsPerUpload = 100
+
+// membershipIndex is the GSI on (status, membership_ends_at).
+const membershipIndex = "status-membership_ends_index"
+
+// removedRetention is how long removed memberships are kept for audit
+// before DynamoDB TTL deletes them.
+const removedRetention = 180 * 24 * time.Hour
+
+// Membership is one user's state in one list. Only the hashed email is
+// stored, which is all a later removal needs.
+type Membership struct {
+	UserID           string     `dynamodbav:"user_id"`
+	ListKey          string     `dynamodbav:"list_key"`
+	ListID           string     `dynamodbav:"list_id"`
+	HashedEmail      string     `dynamodbav:"hashed_email"`
+	Status           string     `dynamodbav:"status"`
+	AddedAt          time.Time  `dynamodbav:"added_at"`
+	MembershipEndsAt int64      `dynamodbav:"membership_ends_at"`
+	RemovedAt        *time.Time `dynamodbav:"removed_at,omitempty"`
+	RemoveReason     string     `dynamodbav:"remove_reason,omitempty"`
+	ExpiresAt        int64      `dynamodbav:"expires_at,omitempty"`
+}
+
+// userProfile is the part of a user-service record audience sync needs.
+type userProfile struct {
+	Email            string `dynamodbav:"email"`
+	MarketingConsent bool   `dynamodbav:"marketing_consent"`
+	// Preferences are the user's consents, set through user-service's
+	// /users/{id}/preferences; nil for users who never set them.
+	Preferences *struct {
+		AdsPersonalization bool `dynamodbav:"ads_personalization"`
+	} `dynamodbav:"preferences"`
+}
+
+// consented reports whether the user agreed to be in ad audiences: their
+// ads personalization consent, or marketing_consent if they never set
+// preferences.
+func (u userProfile) consented() bool {
+	if u.Preferences != nil {
+		return u.Preferences.AdsPersonalization
+	}
+	return u.MarketingConsent
+}
+
+// listBatch collects one list's pending operations for a single upload.
+type listBatch struct {
+	audience Audience
+	adds     []Membership
+	removes  []Membership
+}
+
+// Syncer queues membership changes and uploads them per list on Flush. A
+// membership record is only written once Google Ads accepted the change,
+// so a failed upload is retried from scratch.
+type Syncer struct {
+	db        *dynamodb.Client
+	loadAds   func() (*googleads.Service, error)
+	audiences []Audience
+	pending   map[string]*listBatch
+}
+
+// Apply moves userID in or out of every list according to the trigger.
+// Users without ads personalization consent, or who no longer exist, are
+// only ever removed.
+func (s *Syncer) Apply(ctx context.Context, userID string, t trigger) error {
+	if userID == "" {
+		log.Printf("Skipping %s event without a user", t)
+		return nil
+	}
+
+	user, err := s.lookupUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	now := clk.Now()
+	for _, audience := range s.audiences {
+		current, err := s.getMembership(ctx, userID, audience.Key)
+		if err != nil {
+			return err
+		}
+		isMember := current != nil && current.Status == membershipActive
+
+		switch {
+		case user == nil:
+			if isMember {
+				s.queueRemove(audience, *current, reasonUserDeleted, now)
+			}
+		case !user.consented():
+			if isMember {
+				s.queueRemove(audience, *current, reasonConsentWithdrawn, now)
+			}
+		case has(audience.AddOn, t):
+			hashedEmail := customermatch.HashEmail(user.Email)
+			if hashedEmail == "" {
+				continue
+			}
+			if isMember {
+				// Already uploaded; just extend the membership.
+				if err := s.extendMembership(ctx, *current, now.Add(audience.Duration)); err != nil {
+					return err
+				}
+				continue
+			}
+			s.queueAdd(audience, Membership{
+				UserID:           userID,
+				ListKey:          audience.Key,
+				ListID:           audience.ListID,
+				HashedEmail:      hashedEmail,
+				Status:           membershipActive,
+				AddedAt:          now,
+				MembershipEndsAt: now.Add(audience.Duration).Unix(),
+			})
+		case has(audience.RemoveOn, t):
+			if isMember {
+				s.queueRemove(audience, *current, reasonEvent, now)
+			}
+		}
+	}
+	return nil
+}
+
+// ExpireMemberships removes members whose membership has ended, whose
+// consent was withdrawn or whose account was deleted since they were added.
+func (s *Syncer) ExpireMemberships(ctx context.Context) error {
+	now := clk.Now()
+	byKey := make(map[string]Audience, len(s.audiences))
+	for _, audience := range s.audiences {
+		byKey[audience.Key] = audience
+	}
+	users := make(map[string]*userProfile)
+
+	var lastKey map[string]types.AttributeValue
+	for {
+		result, err := s.db.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(membershipsTable),
+			IndexName:              aws.String(membershipIndex),
+			KeyConditionExpression: aws.String("#status = :member"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":member": &types.AttributeValueMemberS{Value: membershipActive},
+			},
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to query memberships: %w", err)
+		}
+
+		var memberships []Membership
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &memberships); err != nil {
+			return fmt.Errorf("failed to unmarshal memberships: %w", err)
+		}
+
+		for _, m := range memberships {
+			audience, ok := byKey[m.ListKey]
+			if !ok {
+				continue
+			}
+			if m.MembershipEndsAt < now.Unix() {
+				s.queueRemove(audience, m, reasonExpired, now)
+				continue
+			}
+
+			user, seen := users[m.UserID]
+			if !seen {
+				if user, err = s.lookupUser(ctx, m.UserID); err != nil {
+					return err
+				}
+				users[m.UserID] = user
+			}
+			switch {
+			case user == nil:
+				s.queueRemove(audience, m, reasonUserDeleted, now)
+			case !user.consented():
+				s.queueRemove(audience, m, reasonConsentWithdrawn, now)
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+}
+
+func (s *Syncer) queueAdd(audience Audience, m Membership) {
+	s.batch(audience).adds = append(s.batch(audience).adds, m)
+}
+
+func (s *Syncer) queueRemove(audience Audience, m Membership, reason string, now time.Time) {
+	m.Status = membershipRemoved
+	m.RemovedAt = &now
+	m.RemoveReason = reason
+	m.ExpiresAt = now.Add(removedRetention).Unix()
+	s.batch(audience).removes = append(s.batch(audience).removes, m)
+}
+
+func (s *Syncer) batch(audience Audience) *listBatch {
+	b, ok := s.pending[audience.Key]
+	if !ok {
+		b = &listBatch{audience: audience}
+		s.pending[audience.Key] = b
+	}
+	return b
+}
+
+// Flush uploads every queued change and records the resulting memberships.
+func (s *Syncer) Flush(ctx context.Context) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	client, err := s.loadAds()
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	var failed int
+	for _, b := range s.pending {
+		if err := s.flushList(ctx, client, b.audience, b.adds, true); err != nil {
+			log.Printf("Failed to add members to %s: %v", b.audience.Key, err)
+			failed++
+		}
+		if err := s.flushList(ctx, client, b.audience, b.removes, false); err != nil {
+			log.Printf("Failed to remove members from %s: %v", b.audience.Key, err)
+			failed++
+		}
+		log.Printf("Audience %s: %d added, %d removed (%s)", b.audience.Key, len(b.adds), len(b.removes), environment)
+	}
+	s.pending = make(map[string]*listBatch)
+
+	if failed > 0 {
+		return fmt.Errorf("failed to sync %d list operations", failed)
+	}
+	return nil
+}
+
+func (s *Syncer) flushList(ctx context.Context, client *googleads.Service, audience Audience, memberships []Membership, add bool) error {
+	for start := 0; start < len(memberships); start += maxOperationsPerUpload {
+		end := start + maxOperationsPerUpload
+		if end > len(memberships) {
+			end = len(memberships)
+		}
+		chunk := memberships[start:end]
+
+		ops := make([]*googleads.UserDataOperation, len(chunk))
+		for i, m := range chunk {
+			data := &googleads.UserData{
+				UserIdentifiers: []*googleads.UserIdentifier{{HashedEmail: m.HashedEmail}},
+			}
+			if add {
+				ops[i] = &googleads.UserDataOperation{Create: data}
+			} else {
+				ops[i] = &googleads.UserDataOperation{Remove: data}
+			}
+		}
+
+		_, err := client.UploadUserData(ctx, &googleads.UploadUserDataRequest{
+			CustomerId: customerID,
+			Operations: ops,
+			CustomerMatchUserListMetadata: &googleads.CustomerMatchUserListMetadata{
+				UserList: audience.resourceName(),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload user data: %w", err)
+		}
+
+		for _, m := range chunk {
+			if err := s.putMembership(ctx, m); err != nil {
+				// Google Ads already has the change; the next event or daily
+				// run reconciles the record.
+				log.Printf("Failed to record membership %s/%s: %v", m.UserID, m.ListKey, err)
+			}
+		}
+	}
+	return nil
+}
+
+// DynamoDB operations
+
+func (s *Syncer) lookupUser(ctx context.Context, userID string) (*userProfile, error) {
+	result, err := s.db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(usersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: userID},
+		},
+		ProjectionExpression: aws.String("email, marketing_consent, preferences"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %w", userID, err)
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	var user userProfile
+	if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *Syncer) getMembership(ctx context.Context, userID, listKey string) (*Membership, error) {
+	result, err := s.db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(membershipsTable),
+		Key: map[string]types.AttributeValue{
+			"user_id":  &types.AttributeValueMemberS{Value: userID},
+			"list_key": &types.AttributeValueMemberS{Value: listKey},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get membership: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	var m Membership
+	if err := attributevalue.UnmarshalMap(result.Item, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal membership: %w", err)
+	}
+	return &m, nil
+}
+
+func (s *Syncer) putMembership(ctx context.Context, m Membership) error {
+	item, err := attributevalue.MarshalMap(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal membership: %w", err)
+	}
+	_, err = s.db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(membershipsTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put membership: %w", err)
+	}
+	return nil
+}
+
+func (s *Syncer) extendMembership(ctx context.Context, m Membership, endsAt time.Time) error {
+	_, err := s.db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(membershipsTable),
+		Key: map[string]types.AttributeValue{
+			"user_id":  &types.AttributeValueMemberS{Value: m.UserID},
+			"list_key": &types.AttributeValueMemberS{Value: m.ListKey},
+		},
+		UpdateExpression: aws.String("SET membership_ends_at = :ends"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ends": &types.AttributeValueMemberN{Value: strconv.FormatInt(endsAt.Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to extend membership: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"pkg/ads"
+	"pkg/approval"
+	"pkg/bidaudit"
+	"pkg/events"
+)
+
+// maxPutEventsEntries is PutEvents' limit of entries per call.
+const maxPutEventsEntries = 10
+
+// expireApprovals closes the pending changes whose decision window has
+// passed, returning how many it closed. Decisions made in the meantime
+// win: Store.Expire only touches items still pending.
+func expireApprovals(ctx context.Context, store *approval.Store) (int, error) {
+	pending, err := store.All(ctx, approval.StatusPending, "")
+	if err != nil {
+		return 0, err
+	}
+	now := clk.Now()
+	var expired int
+	for _, item := range pending {
+		if item.DecideBy.After(now) {
+			continue
+		}
+		if err := store.Expire(ctx, item.ApprovalID); err != nil {
+			log.Printf("Failed to expire approval %s: %v", item.ApprovalID, err)
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// applyCustomerBids sets the approved keyword bids of one account through
+// its platform, records each change's outcome, appends the applied ones
+// to the bid audit log and announces them on bus when there is one. When
+// the whole request fails the changes stay approved and are retried on the
+// next run.
+func applyCustomerBids(ctx context.Context, platform ads.Platform, store *approval.Store, audit *bidaudit.Store, bus *eventbridge.Client, account ads.Account, items []approval.Item) (applied, failed int, err error) {
+	changes := make([]ads.BidChange, 0, len(items))
+	for _, item := range items {
+		changes = append(changes, ads.BidChange{
+			CampaignID: item.CampaignID,
+			AdGroupID:  item.AdGroupID,
+			KeywordID:  item.KeywordID,
+			Bid:        item.RecommendedBid,
+		})
+	}
+
+	rejected, err := platform.UpdateBids(ctx, account.ID, changes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to update keyword bids: %w", err)
+	}
+	failures := make(map[int]error, len(rejected))
+	for _, f := range rejected {
+		failures[f.Index] = f.Err
+	}
+
+	var done []approval.Item
+	for i, item := range items {
+		applyErr := failures[i]
+		if applyErr != nil {
+			log.Printf("Customer %s: failed to set bid for keyword %s: %v", account, item.KeywordID, applyErr)
+			failed++
+		} else {
+			applied++
+			done = append(done, item)
+			recordBidChange(ctx, audit, item)
+		}
+		if err := store.Finish(ctx, item.ApprovalID, applyErr); err != nil {
+			log.Printf("Failed to record outcome of approval %s: %v", item.ApprovalID, err)
+		}
+	}
+	if bus != nil {
+		publishBidsApplied(ctx, bus, done)
+	}
+	log.Printf("Customer %s: applied %d of %d approved bid changes", account, applied, len(items))
+	return applied, failed, nil
+}
+
+// recordBidChange appends an applied bid change to the audit log. The bid
+// is already set, so a failure is only logged.
+func recordBidChange(ctx context.Context, audit *bidaudit.Store, item approval.Item) {
+	err := audit.Append(ctx, &bidaudit.Record{
+		CustomerID:   item.CustomerID,
+		Type:         bidaudit.TypeKeywordBid,
+		CampaignID:   item.CampaignID,
+		CampaignName: item.CampaignName,
+		AdGroupID:    item.AdGroupID,
+		KeywordID:    item.KeywordID,
+		KeywordText:  item.KeywordText,
+		OldValue:     bidaudit.Value(item.CurrentBid),
+		NewValue:     bidaudit.Value(item.RecommendedBid),
+		Reason:       item.Reason,
+		Source:       "bid-applier",
+		RunID:        item.RunID,
+		ConfigHash:   item.ConfigHash,
+		Actor:        item.DecidedBy,
+		ApprovalID:   item.ApprovalID,
+	})
+	if err != nil {
+		log.Printf("Failed to audit bid change of approval %s: %v", item.ApprovalID, err)
+	}
+}
+
+// publishBidsApplied announces applied bid changes on the platform bus.
+// Like the audit log, the bids are already set, so failures are only
+// logged.
+func publishBidsApplied(ctx context.Context, bus *eventbridge.Client, items []approval.Item) {
+	enc := events.NewEncoder(clk)
+	now := clk.Now().UTC()
+	entries := make([]ebtypes.PutEventsRequestEntry, 0, len(items))
+	for _, item := range items {
+		entry, err := enc.Marshal(ctx, events.BidApplied{
+			CustomerID:   item.CustomerID,
+			CampaignID:   item.CampaignID,
+			CampaignName: item.CampaignName,
+			AdGroupID:    item.AdGroupID,
+			KeywordID:    item.KeywordID,
+			KeywordText:  item.KeywordText,
+			OldBid:       item.CurrentBid,
+			NewBid:       item.RecommendedBid,
+			ApprovalID:   item.ApprovalID,
+			RunID:        item.RunID,
+			Actor:        item.DecidedBy,
+			AppliedAt:    now,
+		})
+		if err != nil {
+			log.Printf("Failed to marshal bid change of approval %s: %v", item.ApprovalID, err)
+			continue
+		}
+		entries = append(entries, ebtypes.PutEventsRequestEntry{
+			EventBusName: aws.String(eventBusName),
+			Source:       aws.String(entry.Source),
+			DetailType:   aws.String(entry.DetailType),
+			Detail:       aws.String(entry.Detail),
+			Time:         aws.Time(entry.Time),
+		})
+	}
+
+	for start := 0; start < len(entries); start += maxPutEventsEntries {
+		batch := entries[start:min(start+maxPutEventsEntries, len(entries))]
+		result, err := bus.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: batch})
+		if err != nil {
+			log.Printf("Failed to publish %d applied bid changes: %v", len(batch), err)
+			continue
+		}
+		if result.FailedEntryCount > 0 {
+			log.Printf("EventBridge rejected %d of %d applied bid changes", result.FailedEntryCount, len(batch))
+		}
+	}
+}
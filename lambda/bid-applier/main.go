@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/ads"
+	"pkg/approval"
+	"pkg/bidaudit"
+	"pkg/clock"
+	"pkg/dynamo"
+	gads "pkg/googleads"
+	_ "pkg/localdev"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+var (
+	secretName     = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	environment    = os.Getenv("ENVIRONMENT")
+	approvalsTable = os.Getenv("APPROVALS_TABLE_NAME")
+	bidAuditTable  = os.Getenv("BID_AUDIT_TABLE_NAME")
+	eventBusName   = os.Getenv("EVENT_BUS_NAME")
+
+	// applyBids sends approved bid changes to their ad platform; when unset
+	// the run only logs what it would apply and leaves the changes
+	// approved.
+	applyBids = os.Getenv("BID_APPLY") == "true"
+
+	clk = clock.FromEnv()
+
+	// emf collects the invocation's metrics for CloudWatch.
+	emf = gads.Metrics("bid-applier", environment, clk)
+
+	// adsCalls makes the Google Ads calls, retrying those that fail with
+	// quota or server errors; see retry.GoogleAdsFromEnv for the overrides.
+	adsCalls = gads.New(emf, nil)
+)
+
+// Invocation modes.
+const (
+	// modeApprovals applies approved changes; it is what the schedule runs.
+	modeApprovals = "approvals"
+	// modeRollback reverts applied keyword bids; see HandleRollback.
+	modeRollback = "rollback"
+)
+
+// Request is the invocation payload. The schedule sends an EventBridge
+// event, which has no mode; rollbacks are invoked by hand with the
+// changes to revert.
+type Request struct {
+	Mode string `json:"mode"`
+	RollbackRequest
+}
+
+func main() {
+	lambda.Start(Handle)
+}
+
+// Handle runs the request's mode, the approval run by default.
+func Handle(ctx context.Context, req Request) (interface{}, error) {
+	defer flushMetrics()
+	switch req.Mode {
+	case "", modeApprovals:
+		return nil, HandleApprovals(ctx)
+	case modeRollback:
+		return HandleRollback(ctx, req.RollbackRequest)
+	default:
+		return nil, fmt.Errorf("unknown mode %q", req.Mode)
+	}
+}
+
+// HandleApprovals runs every few minutes: it applies the keyword bid
+// changes that were approved since the last run and expires the pending
+// ones whose decision window has closed.
+func HandleApprovals(ctx context.Context) error {
+	log.Printf("Starting bid approval run for environment: %s (apply %t)", environment, applyBids)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	db := dynamodb.NewFromConfig(cfg)
+	store := approval.NewStore(dynamo.NewTable(db, approvalsTable), clk)
+	audit := bidaudit.NewStore(dynamo.NewTable(db, bidAuditTable), clk)
+
+	expired, err := expireApprovals(ctx, store)
+	if err != nil {
+		return fmt.Errorf("failed to expire approvals: %w", err)
+	}
+	emf.Count("ApprovalsExpired", expired)
+
+	approved, err := store.All(ctx, approval.StatusApproved, "")
+	if err != nil {
+		return fmt.Errorf("failed to load approved changes: %w", err)
+	}
+	if len(approved) == 0 {
+		log.Printf("No approved bid changes to apply")
+		return nil
+	}
+	if !applyBids {
+		for _, item := range approved {
+			log.Printf("Would apply bid %s -> %s for keyword %s (%s) in customer %s, approved by %s",
+				item.CurrentBid, item.RecommendedBid, item.KeywordID, item.KeywordText, item.CustomerID, item.DecidedBy)
+		}
+		return nil
+	}
+
+	registry, err := newRegistry(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	byCustomer := make(map[string][]approval.Item)
+	var customers []string
+	for _, item := range approved {
+		if _, ok := byCustomer[item.CustomerID]; !ok {
+			customers = append(customers, item.CustomerID)
+		}
+		byCustomer[item.CustomerID] = append(byCustomer[item.CustomerID], item)
+	}
+
+	var bus *eventbridge.Client
+	if eventBusName != "" {
+		bus = eventbridge.NewFromConfig(cfg)
+	}
+
+	var applied, failed, accountsFailed int
+	for _, customerID := range customers {
+		account := ads.ParseAccount(customerID)
+		platform, err := registry.Platform(account.Platform)
+		if err == nil {
+			var a, f int
+			a, f, err = applyCustomerBids(ctx, platform, store, audit, bus, account, byCustomer[customerID])
+			applied += a
+			failed += f
+		}
+		if err != nil {
+			log.Printf("Failed to apply bids for customer %s: %v", customerID, err)
+			accountsFailed++
+		}
+	}
+	emf.Count("BidChangesApplied", applied)
+	emf.Count("BidChangesFailed", failed)
+	emf.Count("AccountsFailed", accountsFailed)
+	if accountsFailed > 0 && accountsFailed == len(customers) {
+		return fmt.Errorf("failed to apply bids for all %d accounts", accountsFailed)
+	}
+
+	log.Printf("Bid approval run completed: %d applied, %d failed, %d expired", applied, failed, expired)
+	return nil
+}
+
+// newRegistry returns the ad platforms, Google Ads among them.
+func newRegistry(ctx context.Context, cfg aws.Config) (*ads.Registry, error) {
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := createGoogleAdsClient(adsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+	registry, err := loadPlatforms(ctx, cfg, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ad platforms: %w", err)
+	}
+	return registry, nil
+}
+
+// search runs a Google Ads query through adsCalls.
+func search(ctx context.Context, client *googleads.Service, req *googleads.SearchGoogleAdsRequest) (*googleads.SearchGoogleAdsResponse, error) {
+	return gads.Search(ctx, adsCalls, func(ctx context.Context) (*googleads.SearchGoogleAdsResponse, error) {
+		return client.Search(ctx, req)
+	}, func(resp *googleads.SearchGoogleAdsResponse) int { return len(resp.Results) })
+}
+
+func flushMetrics() {
+	if err := emf.Flush(); err != nil {
+		log.Printf("Failed to flush metrics: %v", err)
+	}
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	opts := []option.ClientOption{
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	}
+	// GOOGLE_ADS_ENDPOINT points the client at a stand-in API such as the
+	// mock server run by cmd/e2e.
+	if endpoint := os.Getenv("GOOGLE_ADS_ENDPOINT"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+
+	srv, err := googleads.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
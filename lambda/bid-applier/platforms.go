@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+
+	"pkg/ads"
+	"pkg/gaql"
+	"pkg/money"
+)
+
+// platformsSecretName is the secret configuring the ad platforms besides
+// Google Ads; see ads.Config. When unset only Google Ads changes can be
+// applied.
+var platformsSecretName = os.Getenv("ADS_PLATFORMS_SECRET_ARN")
+
+// loadPlatforms returns the ad platforms approved changes are applied
+// through: the ones in the platforms secret and Google Ads through client.
+func loadPlatforms(ctx context.Context, cfg aws.Config, client *googleads.Service) (*ads.Registry, error) {
+	var platformsConfig ads.Config
+	if platformsSecretName != "" {
+		out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(platformsSecretName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve platforms secret: %w", err)
+		}
+		if platformsConfig, err = ads.ParseConfig([]byte(aws.ToString(out.SecretString))); err != nil {
+			return nil, err
+		}
+	}
+
+	policy := ads.DefaultRetry()
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		log.Printf("Ad platform call failed (attempt %d/%d), retrying in %s: %v", attempt, policy.MaxAttempts, delay, err)
+		emf.Count("PlatformRetries", 1)
+	}
+	registry := ads.NewRegistry(platformsConfig, policy)
+	registry.Add(&googleAdsPlatform{client: client})
+	return registry, nil
+}
+
+// googleAdsPlatform is Google Ads behind ads.Platform, for applying bids.
+// Reports are read with GAQL by the optimizer and monitor, which need more
+// than the shared metrics, and conversions are uploaded by
+// conversion-uploader; both are left unsupported here.
+type googleAdsPlatform struct {
+	client *googleads.Service
+}
+
+func (p *googleAdsPlatform) Name() string { return ads.Google }
+
+func (p *googleAdsPlatform) FetchMetrics(ctx context.Context, customerID string, level ads.Level, period ads.Period) ([]ads.Metrics, error) {
+	return nil, ads.ErrUnsupported
+}
+
+func (p *googleAdsPlatform) UploadConversions(ctx context.Context, customerID string, conversions []ads.Conversion) ([]ads.Failure, error) {
+	return nil, ads.ErrUnsupported
+}
+
+// UpdateBids sets keyword CPC bids in a single partial-failure mutate.
+func (p *googleAdsPlatform) UpdateBids(ctx context.Context, customerID string, changes []ads.BidChange) ([]ads.Failure, error) {
+	ops := make([]*googleads.AdGroupCriterionOperation, 0, len(changes))
+	for _, change := range changes {
+		ops = append(ops, &googleads.AdGroupCriterionOperation{
+			Update: &googleads.AdGroupCriterion{
+				ResourceName: fmt.Sprintf("customers/%s/adGroupCriteria/%s~%s", customerID, change.AdGroupID, change.KeywordID),
+				CpcBidMicros: change.Bid.AmountMicros,
+			},
+			UpdateMask: "cpc_bid_micros",
+		})
+	}
+
+	resp, err := p.client.MutateAdGroupCriteria(ctx, &googleads.MutateAdGroupCriteriaRequest{
+		CustomerId:     customerID,
+		Operations:     ops,
+		PartialFailure: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []ads.Failure
+	if resp.PartialFailureError != nil {
+		for _, detail := range resp.PartialFailureError.Details {
+			failures = append(failures, ads.Failure{Index: detail.Index, Err: errors.New(detail.ErrorCode + ": " + detail.Message)})
+		}
+	}
+	return failures, nil
+}
+
+// KeywordBids returns the CPC bids of the ad groups' keywords by ad group
+// and keyword ID, in the account currency. Keywords bidding at the ad
+// group default report none.
+func (p *googleAdsPlatform) KeywordBids(ctx context.Context, customerID string, adGroupIDs []string) (map[string]money.Money, error) {
+	ids := make([]int64, 0, len(adGroupIDs))
+	for _, id := range adGroupIDs {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ad group ID %q", id)
+		}
+		ids = append(ids, n)
+	}
+	query, err := gaql.Select(
+		"ad_group.id",
+		"ad_group_criterion.criterion_id",
+		"ad_group_criterion.cpc_bid_micros",
+	).From("ad_group_criterion").
+		Where("ad_group_criterion.type", gaql.Equals, "KEYWORD").
+		Where("ad_group_criterion.status", gaql.NotEquals, "REMOVED").
+		Where("ad_group.id", gaql.In, ids).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := search(ctx, p.client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      query,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bids := make(map[string]money.Money, len(resp.Results))
+	for _, row := range resp.Results {
+		key := fmt.Sprintf("%d~%d", row.AdGroup.Id, row.AdGroupCriterion.CriterionId)
+		bids[key] = money.Money{AmountMicros: row.AdGroupCriterion.CpcBidMicros}
+	}
+	return bids, nil
+}
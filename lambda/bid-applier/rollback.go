@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/ads"
+	"pkg/bidaudit"
+	"pkg/dynamo"
+	"pkg/money"
+)
+
+// rollbackActor is the Actor of reverted bids when the request names no
+// one.
+const rollbackActor = "rollback"
+
+// bidTolerance is how far a platform's bid may be from the one applied and
+// still count as unchanged: Microsoft Advertising and Meta round bids to
+// the currency's minor unit.
+const bidTolerance = 5000
+
+// rollbackBidDays is the reporting window platforms without a bidReader
+// are read over for current bids; keywords without traffic in it are
+// skipped.
+const rollbackBidDays = 30
+
+// RollbackRequest selects the applied keyword bid changes to revert: those
+// of one optimizer run, or those applied from From to To (YYYY-MM-DD,
+// inclusive). CustomerID and CampaignID narrow either.
+type RollbackRequest struct {
+	RunID      string `json:"run_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	CustomerID string `json:"customer_id"`
+	CampaignID string `json:"campaign_id"`
+	// DryRun reports what would be reverted without changing anything,
+	// as does any rollback while BID_APPLY is unset.
+	DryRun bool `json:"dry_run"`
+	// RequestedBy is recorded as the actor of the reverted bids.
+	RequestedBy string `json:"requested_by"`
+}
+
+// RollbackReport is a rollback's outcome, per keyword.
+type RollbackReport struct {
+	DryRun bool `json:"dry_run"`
+	// Changes is how many applied changes the request selected.
+	Changes int `json:"changes"`
+	// Reverted are the keywords set back to their bid before the first
+	// selected change, or that would be in a dry run.
+	Reverted []RollbackItem `json:"reverted"`
+	// Skipped are the keywords left alone, mostly because their bid was
+	// changed again since; Failed the ones the platform rejected.
+	Skipped []RollbackItem `json:"skipped"`
+	Failed  []RollbackItem `json:"failed"`
+}
+
+// RollbackItem is one keyword in a rollback. AppliedBid is the bid the
+// last selected change set and RevertTo the one before the first.
+type RollbackItem struct {
+	CustomerID  string      `json:"customer_id"`
+	CampaignID  string      `json:"campaign_id"`
+	AdGroupID   string      `json:"ad_group_id"`
+	KeywordID   string      `json:"keyword_id"`
+	KeywordText string      `json:"keyword_text,omitempty"`
+	AppliedBid  money.Money `json:"applied_bid"`
+	CurrentBid  money.Money `json:"current_bid"`
+	RevertTo    money.Money `json:"revert_to"`
+	Reason      string      `json:"reason,omitempty"`
+
+	campaignName string
+}
+
+// bidReader is implemented by platforms that read keyword bids directly,
+// including keywords without traffic. Others are read from their bid
+// target metrics.
+type bidReader interface {
+	KeywordBids(ctx context.Context, accountID string, adGroupIDs []string) (map[string]money.Money, error)
+}
+
+// HandleRollback reverts the keyword bids of the changes req selects, as
+// recorded in the bid audit log, to what they were before. A keyword whose
+// platform bid is no longer the one applied was changed since, by hand or
+// by a later run, and is skipped rather than overwritten. Reverted bids
+// are recorded in the audit log like any other change.
+func HandleRollback(ctx context.Context, req RollbackRequest) (*RollbackReport, error) {
+	filter := bidaudit.Filter{
+		CustomerID: req.CustomerID,
+		CampaignID: req.CampaignID,
+		Type:       bidaudit.TypeKeywordBid,
+		RunID:      req.RunID,
+	}
+	var err error
+	if filter.From, filter.To, err = req.span(); err != nil {
+		return nil, err
+	}
+	dryRun := req.DryRun || !applyBids
+	log.Printf("Starting bid rollback for environment: %s (run %q, %s to %s, dry run %t)",
+		environment, req.RunID, req.From, req.To, dryRun)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	audit := bidaudit.NewStore(dynamo.NewTable(dynamodb.NewFromConfig(cfg), bidAuditTable), clk)
+	records, err := audit.All(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load applied bid changes: %w", err)
+	}
+
+	report := &RollbackReport{DryRun: dryRun, Changes: len(records)}
+	if len(records) == 0 {
+		log.Printf("No applied bid changes match the rollback")
+		return report, nil
+	}
+	registry, err := newRegistry(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	byCustomer, customers := rollbackItems(records, report)
+	for _, customerID := range customers {
+		account := ads.ParseAccount(customerID)
+		platform, err := registry.Platform(account.Platform)
+		if err == nil {
+			err = rollbackCustomerBids(ctx, platform, audit, account, byCustomer[customerID], req, report)
+		}
+		if err != nil {
+			log.Printf("Failed to roll back bids for customer %s: %v", customerID, err)
+			for _, item := range byCustomer[customerID] {
+				item.Reason = err.Error()
+				report.Failed = append(report.Failed, item)
+			}
+		}
+	}
+
+	emf.Count("BidRollbacksReverted", len(report.Reverted))
+	emf.Count("BidRollbacksSkipped", len(report.Skipped))
+	emf.Count("BidRollbacksFailed", len(report.Failed))
+	log.Printf("Bid rollback completed: %d changes, %d keywords reverted, %d skipped, %d failed",
+		report.Changes, len(report.Reverted), len(report.Skipped), len(report.Failed))
+	return report, nil
+}
+
+// span parses the request's days, requiring either them or a run.
+func (req RollbackRequest) span() (from, to time.Time, err error) {
+	if req.RunID == "" && (req.From == "" || req.To == "") {
+		return time.Time{}, time.Time{}, fmt.Errorf("a rollback needs run_id, or from and to")
+	}
+	if req.From != "" {
+		if from, err = time.Parse("2006-01-02", req.From); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+		}
+	}
+	if req.To != "" {
+		if to, err = time.Parse("2006-01-02", req.To); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	return from, to, nil
+}
+
+// rollbackItems folds each keyword's selected changes, oldest first, into
+// one item: back to the bid before the first, expecting the bid the last
+// set. Changes without a readable bid are skipped into report.
+func rollbackItems(records []bidaudit.Record, report *RollbackReport) (map[string][]RollbackItem, []string) {
+	byKeyword := make(map[string]*RollbackItem)
+	var keywords []string
+	for _, r := range records {
+		key := r.CustomerID + "/" + r.AdGroupID + "~" + r.KeywordID
+		var oldBid, newBid money.Money
+		if json.Unmarshal(r.OldValue, &oldBid) != nil || json.Unmarshal(r.NewValue, &newBid) != nil {
+			report.Skipped = append(report.Skipped, RollbackItem{
+				CustomerID:  r.CustomerID,
+				CampaignID:  r.CampaignID,
+				AdGroupID:   r.AdGroupID,
+				KeywordID:   r.KeywordID,
+				KeywordText: r.KeywordText,
+				Reason:      fmt.Sprintf("change %s has no readable bid", r.ChangeID),
+			})
+			continue
+		}
+		item, ok := byKeyword[key]
+		if !ok {
+			item = &RollbackItem{
+				CustomerID:   r.CustomerID,
+				CampaignID:   r.CampaignID,
+				AdGroupID:    r.AdGroupID,
+				KeywordID:    r.KeywordID,
+				KeywordText:  r.KeywordText,
+				RevertTo:     oldBid,
+				campaignName: r.CampaignName,
+			}
+			byKeyword[key] = item
+			keywords = append(keywords, key)
+		}
+		item.AppliedBid = newBid
+	}
+
+	byCustomer := make(map[string][]RollbackItem)
+	var customers []string
+	for _, key := range keywords {
+		item := *byKeyword[key]
+		if _, ok := byCustomer[item.CustomerID]; !ok {
+			customers = append(customers, item.CustomerID)
+		}
+		byCustomer[item.CustomerID] = append(byCustomer[item.CustomerID], item)
+	}
+	return byCustomer, customers
+}
+
+// rollbackCustomerBids reverts one account's keywords whose bid is still
+// the one applied, adding each keyword to report. An error means the bids
+// could not be read and no keyword was added.
+func rollbackCustomerBids(ctx context.Context, platform ads.Platform, audit *bidaudit.Store, account ads.Account, items []RollbackItem, req RollbackRequest, report *RollbackReport) error {
+	current, err := currentBids(ctx, platform, account, items)
+	if err != nil {
+		return fmt.Errorf("failed to read current bids: %w", err)
+	}
+
+	var revert []RollbackItem
+	for _, item := range items {
+		bid, ok := current[item.AdGroupID+"~"+item.KeywordID]
+		switch {
+		case !ok:
+			item.Reason = "current bid unknown"
+		case !sameBid(bid, item.AppliedBid):
+			item.CurrentBid = bid
+			item.Reason = fmt.Sprintf("bid is %s, not the applied %s; changed since", bid, item.AppliedBid)
+		case sameBid(item.AppliedBid, item.RevertTo):
+			item.CurrentBid = bid
+			item.Reason = "already at its earlier bid"
+		default:
+			item.CurrentBid = bid
+			revert = append(revert, item)
+			continue
+		}
+		log.Printf("Customer %s: not reverting keyword %s: %s", account, item.KeywordID, item.Reason)
+		report.Skipped = append(report.Skipped, item)
+	}
+	if len(revert) == 0 {
+		return nil
+	}
+	if report.DryRun {
+		for _, item := range revert {
+			log.Printf("Would revert bid %s -> %s for keyword %s (%s) in customer %s",
+				item.AppliedBid, item.RevertTo, item.KeywordID, item.KeywordText, account)
+		}
+		report.Reverted = append(report.Reverted, revert...)
+		return nil
+	}
+
+	changes := make([]ads.BidChange, 0, len(revert))
+	for _, item := range revert {
+		changes = append(changes, ads.BidChange{
+			CampaignID: item.CampaignID,
+			AdGroupID:  item.AdGroupID,
+			KeywordID:  item.KeywordID,
+			Bid:        item.RevertTo,
+		})
+	}
+	rejected, err := platform.UpdateBids(ctx, account.ID, changes)
+	if err != nil {
+		log.Printf("Customer %s: failed to revert keyword bids: %v", account, err)
+		for _, item := range revert {
+			item.Reason = err.Error()
+			report.Failed = append(report.Failed, item)
+		}
+		return nil
+	}
+	failures := make(map[int]error, len(rejected))
+	for _, f := range rejected {
+		failures[f.Index] = f.Err
+	}
+
+	actor := req.RequestedBy
+	if actor == "" {
+		actor = rollbackActor
+	}
+	for i, item := range revert {
+		if err := failures[i]; err != nil {
+			log.Printf("Customer %s: failed to revert bid for keyword %s: %v", account, item.KeywordID, err)
+			item.Reason = err.Error()
+			report.Failed = append(report.Failed, item)
+			continue
+		}
+		report.Reverted = append(report.Reverted, item)
+		err := audit.Append(ctx, &bidaudit.Record{
+			CustomerID:   item.CustomerID,
+			Type:         bidaudit.TypeKeywordBid,
+			CampaignID:   item.CampaignID,
+			CampaignName: item.campaignName,
+			AdGroupID:    item.AdGroupID,
+			KeywordID:    item.KeywordID,
+			KeywordText:  item.KeywordText,
+			OldValue:     bidaudit.Value(item.AppliedBid),
+			NewValue:     bidaudit.Value(item.RevertTo),
+			Reason:       req.describe(),
+			Source:       "bid-applier",
+			Actor:        actor,
+		})
+		if err != nil {
+			log.Printf("Failed to audit reverted bid of keyword %s: %v", item.KeywordID, err)
+		}
+	}
+	log.Printf("Customer %s: reverted %d of %d keyword bids", account, len(revert)-len(failures), len(revert))
+	return nil
+}
+
+// describe is the reason recorded on reverted bids.
+func (req RollbackRequest) describe() string {
+	if req.RunID != "" {
+		return "rollback of run " + req.RunID
+	}
+	return fmt.Sprintf("rollback of changes applied %s to %s", req.From, req.To)
+}
+
+// currentBids returns the account's keyword bids by ad group and keyword
+// ID, for the keywords of items.
+func currentBids(ctx context.Context, platform ads.Platform, account ads.Account, items []RollbackItem) (map[string]money.Money, error) {
+	if reader, ok := platform.(bidReader); ok {
+		seen := make(map[string]bool)
+		var adGroups []string
+		for _, item := range items {
+			if !seen[item.AdGroupID] {
+				seen[item.AdGroupID] = true
+				adGroups = append(adGroups, item.AdGroupID)
+			}
+		}
+		return reader.KeywordBids(ctx, account.ID, adGroups)
+	}
+
+	rows, err := platform.FetchMetrics(ctx, account.ID, ads.LevelBidTarget, ads.LastDays(clk.Now(), rollbackBidDays))
+	if err != nil {
+		return nil, err
+	}
+	bids := make(map[string]money.Money, len(rows))
+	for _, row := range rows {
+		bids[row.AdGroupID+"~"+row.KeywordID] = row.CurrentBid
+	}
+	return bids, nil
+}
+
+// sameBid reports whether two bids match within bidTolerance. A bid read
+// without its currency matches on amount alone.
+func sameBid(a, b money.Money) bool {
+	if a.Currency != "" && b.Currency != "" && a.Currency != b.Currency {
+		return false
+	}
+	diff := a.AmountMicros - b.AmountMicros
+	return diff > -bidTolerance && diff < bidTolerance
+}
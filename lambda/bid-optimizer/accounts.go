@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var accountsTable = os.Getenv("ACCOUNTS_TABLE_NAME")
+
+type rotationAccount struct {
+	CustomerID string `dynamodbav:"customer_id"`
+}
+
+// loadCustomerIDs returns the accounts in the rotation: the Google Ads
+// accounts, then those of the other platforms in the platforms secret, by
+// their platform-prefixed IDs. The Google Ads rotation runs even when the
+// other platforms cannot be loaded.
+func loadCustomerIDs(ctx context.Context) ([]string, error) {
+	customerIDs, err := googleAdsCustomerIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := platforms(ctx)
+	if err != nil {
+		log.Printf("Failed to load ad platforms, optimizing Google Ads accounts only: %v", err)
+		return customerIDs, nil
+	}
+	for _, account := range registry.Accounts() {
+		customerIDs = append(customerIDs, account.String())
+	}
+	return customerIDs, nil
+}
+
+// googleAdsCustomerIDs returns the Google Ads accounts in the rotation.
+// Accounts onboarded through the ads-api are read from the accounts table;
+// GOOGLE_ADS_CUSTOMER_ID is still honoured for single-account deployments.
+func googleAdsCustomerIDs(ctx context.Context) ([]string, error) {
+	if accountsTable == "" {
+		customerID := os.Getenv("GOOGLE_ADS_CUSTOMER_ID")
+		if customerID == "" {
+			return nil, fmt.Errorf("neither ACCOUNTS_TABLE_NAME nor GOOGLE_ADS_CUSTOMER_ID environment variable is set")
+		}
+		return []string{customerID}, nil
+	}
+
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	svc := dynamodb.NewFromConfig(cfg)
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName:        aws.String(accountsTable),
+		FilterExpression: aws.String("#status = :active AND optimizer_enabled = :enabled"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active":  &types.AttributeValueMemberS{Value: "ACTIVE"},
+			":enabled": &types.AttributeValueMemberBOOL{Value: true},
+		},
+		ProjectionExpression: aws.String("customer_id"),
+	})
+
+	var customerIDs []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan accounts: %w", err)
+		}
+
+		var accounts []rotationAccount
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &accounts); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal accounts: %w", err)
+		}
+		for _, account := range accounts {
+			customerIDs = append(customerIDs, account.CustomerID)
+		}
+	}
+
+	sort.Strings(customerIDs)
+	return customerIDs, nil
+}
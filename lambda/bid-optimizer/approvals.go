@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"pkg/approval"
+	"pkg/dynamo"
+	"pkg/ids"
+	"pkg/runlog"
+)
+
+var (
+	// approvalsTable holds keyword bid changes for bid-applier. When unset
+	// recommendations are only reported, as before approvals existed.
+	approvalsTable = os.Getenv("APPROVALS_TABLE_NAME")
+	// approvalMinImpact is the estimated daily spend change, in
+	// ruleCurrency, from which a bid change waits for a person to approve
+	// it. Smaller changes are approved automatically.
+	approvalMinImpact = parseFloatEnv("APPROVAL_MIN_IMPACT", 25.0)
+	// approvalWindow is how long a change waits for a decision before it
+	// expires unapplied.
+	approvalWindow = time.Duration(parseIntEnv("APPROVAL_WINDOW_HOURS", 48)) * time.Hour
+
+	// Approve and reject links in reports are signed with the secret and
+	// point at the public API; they are left out when either is unset.
+	approvalSecretARN   = os.Getenv("APPROVAL_SIGNING_SECRET_ARN")
+	approvalLinkBaseURL = os.Getenv("APPROVAL_LINK_BASE_URL")
+)
+
+// keywordImpactDays is the length of keywordPerformanceQuery's window, over
+// which clicks are averaged to estimate a bid change's daily impact.
+const keywordImpactDays = 14
+
+var (
+	signerOnce sync.Once
+	signer     *approval.Signer
+)
+
+// linkSigner returns the signer for one-click links, or nil when links are
+// not configured or the key could not be read.
+func linkSigner(ctx context.Context) *approval.Signer {
+	signerOnce.Do(func() {
+		if approvalSecretARN == "" || approvalLinkBaseURL == "" {
+			return
+		}
+		cfg, err := awsCfg.Get(ctx)
+		if err != nil {
+			log.Printf("Failed to load AWS config for approval links: %v", err)
+			return
+		}
+		out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(approvalSecretARN),
+		})
+		if err != nil {
+			log.Printf("Failed to read approval signing key, sending reports without links: %v", err)
+			return
+		}
+		signer = approval.NewSigner([]byte(aws.ToString(out.SecretString)), approvalLinkBaseURL)
+	})
+	return signer
+}
+
+// bidImpact estimates how much a bid change moves the keyword's daily
+// spend: the bid difference times its average daily clicks.
+func bidImpact(currentBid, recommendedBid float64, clicks int64) float64 {
+	return math.Abs(recommendedBid-currentBid) * float64(clicks) / keywordImpactDays
+}
+
+// fileApprovals records the account's bid recommendations for bid-applier
+// and stamps each with its approval. A keyword that already has a change
+// pending keeps it, so repeated runs do not stack up decisions; the result
+// then carries the pending approval. Recommendations for experiment control
+// campaigns are not filed.
+func fileApprovals(ctx context.Context, run *runlog.Run, rules *accountRules, customerID string, results []BidOptimizationResult) error {
+	if approvalsTable == "" || len(results) == 0 {
+		return nil
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	store := approval.NewStore(dynamo.NewTable(dynamodb.NewFromConfig(cfg), approvalsTable), clk)
+
+	pending, err := store.All(ctx, approval.StatusPending, customerID)
+	if err != nil {
+		return fmt.Errorf("failed to load pending approvals: %w", err)
+	}
+	byKeyword := make(map[string]approval.Item, len(pending))
+	for _, item := range pending {
+		byKeyword[item.AdGroupID+"~"+item.KeywordID] = item
+	}
+
+	links := linkSigner(ctx)
+	idGen := ids.FromEnv(clk)
+	var held, auto int
+	for i := range results {
+		r := &results[i]
+		if r.Cohort == CohortControl {
+			continue
+		}
+		item, ok := byKeyword[r.AdGroupID+"~"+r.KeywordID]
+		if !ok {
+			item = approval.Item{
+				ApprovalID:     idGen.NewID(),
+				Kind:           approval.KindKeywordBid,
+				Status:         approval.StatusPending,
+				CustomerID:     customerID,
+				RunID:          run.RunID,
+				ConfigHash:     run.ConfigHash,
+				CampaignID:     r.CampaignID,
+				CampaignName:   r.CampaignName,
+				AdGroupID:      r.AdGroupID,
+				KeywordID:      r.KeywordID,
+				KeywordText:    r.KeywordText,
+				CurrentBid:     r.CurrentBid,
+				RecommendedBid: r.RecommendedBid,
+				Impact:         r.Impact,
+				Reason:         r.Reason,
+				DecideBy:       clk.Now().Add(approvalWindow).UTC(),
+			}
+			if r.Impact.Units() < rules.approvalMinImpact {
+				now := clk.Now().UTC()
+				item.Status = approval.StatusApproved
+				item.DecidedBy = approval.AutoApprover
+				item.DecidedAt = &now
+			}
+			if err := store.Create(ctx, &item); err != nil {
+				log.Printf("Failed to file approval for keyword %s: %v", r.KeywordID, err)
+				continue
+			}
+			if item.Status == approval.StatusPending {
+				held++
+			} else {
+				auto++
+			}
+		}
+
+		r.ApprovalID = item.ApprovalID
+		r.ApprovalStatus = item.Status
+		if item.Status == approval.StatusPending && links != nil {
+			r.ApproveURL = links.Link(item.ApprovalID, approval.ActionApprove, item.DecideBy)
+			r.RejectURL = links.Link(item.ApprovalID, approval.ActionReject, item.DecideBy)
+		}
+	}
+	emf.Count("ApprovalsPending", held)
+	emf.Count("ApprovalsAutoApproved", auto)
+	log.Printf("Filed %d bid changes for approval and approved %d for customer %s", held, auto, customerID)
+	return nil
+}
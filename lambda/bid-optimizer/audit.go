@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/bidaudit"
+	"pkg/dynamo"
+)
+
+// bidAuditTable is the append-only log of applied changes; when unset
+// applied changes are only logged.
+var bidAuditTable = os.Getenv("BID_AUDIT_TABLE_NAME")
+
+// auditSource is the Source and Actor of the changes bid-optimizer applies
+// itself, without an approval.
+const auditSource = "bid-optimizer"
+
+// recordChanges appends applied changes to the bid audit log. The changes
+// are already live, so failures are only logged.
+func recordChanges(ctx context.Context, records []bidaudit.Record) {
+	if bidAuditTable == "" || len(records) == 0 {
+		return
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		log.Printf("Failed to load AWS config for the bid audit log: %v", err)
+		return
+	}
+	audit := bidaudit.NewStore(dynamo.NewTable(dynamodb.NewFromConfig(cfg), bidAuditTable), clk)
+	for i := range records {
+		r := &records[i]
+		r.Source = auditSource
+		r.Actor = auditSource
+		if err := audit.Append(ctx, r); err != nil {
+			log.Printf("Failed to audit %s change to campaign %s: %v", r.Type, r.CampaignID, err)
+		}
+	}
+}
+
+// budgetAuditRecords describes an applied plan's budget changes.
+func budgetAuditRecords(plan BudgetReallocationPlan) []bidaudit.Record {
+	records := make([]bidaudit.Record, 0, len(plan.Changes))
+	for _, c := range plan.Changes {
+		reason := fmt.Sprintf("budget reallocation moving %s/day; marginal ROAS %.2f -> %.2f",
+			plan.Moved, c.MarginalROAS, c.ProjectedMarginalROAS)
+		switch {
+		case plan.Season != "" && plan.restore:
+			reason = fmt.Sprintf("seasonality: restoring the budget after %s", plan.Season)
+		case plan.Season != "":
+			reason = fmt.Sprintf("seasonality: raising the budget for %s", plan.Season)
+		}
+		records = append(records, bidaudit.Record{
+			CustomerID:   plan.CustomerID,
+			Type:         bidaudit.TypeBudget,
+			CampaignID:   c.CampaignID,
+			CampaignName: c.CampaignName,
+			OldValue:     bidaudit.Value(c.CurrentBudget),
+			NewValue:     bidaudit.Value(c.RecommendedBudget),
+			Reason:       reason,
+			RunID:        plan.RunID,
+			ConfigHash:   plan.ConfigHash,
+		})
+	}
+	return records
+}
+
+// adScheduleAuditRecord describes an applied ad schedule.
+func adScheduleAuditRecord(rec AdScheduleRecommendation) bidaudit.Record {
+	r := bidaudit.Record{
+		CustomerID:   rec.CustomerID,
+		Type:         bidaudit.TypeAdSchedule,
+		CampaignID:   rec.CampaignID,
+		CampaignName: rec.CampaignName,
+		NewValue:     bidaudit.Value(rec.Windows),
+		Reason:       "dayparting: " + strings.Join(rec.Changes(), ", "),
+		RunID:        rec.RunID,
+		ConfigHash:   rec.ConfigHash,
+	}
+	if len(rec.CurrentSchedule) > 0 {
+		r.OldValue = bidaudit.Value(rec.CurrentSchedule)
+	}
+	return r
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+)
+
+// The Google Ads messages the AdsClient trades, named here so the rest of
+// the package, and its tests, need not import the API package.
+type (
+	SearchRequest  = googleads.SearchGoogleAdsRequest
+	SearchResponse = googleads.SearchGoogleAdsResponse
+	StreamRequest  = googleads.SearchGoogleAdsStreamRequest
+	StreamResponse = googleads.SearchGoogleAdsStreamResponse
+	Row            = googleads.GoogleAdsRow
+
+	CriteriaRequest     = googleads.MutateCampaignCriteriaRequest
+	CriteriaResponse    = googleads.MutateCampaignCriteriaResponse
+	BudgetsRequest      = googleads.MutateCampaignBudgetsRequest
+	BudgetsResponse     = googleads.MutateCampaignBudgetsResponse
+	SeasonalityRequest  = googleads.MutateBiddingSeasonalityAdjustmentsRequest
+	SeasonalityResponse = googleads.MutateBiddingSeasonalityAdjustmentsResponse
+)
+
+// AdsClient is the part of the Google Ads API the optimizer calls. The
+// function hands it a *googleads.Service, through googleAdsService; a
+// test hands it a fake.
+type AdsClient interface {
+	Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error)
+	SearchStream(ctx context.Context, req *StreamRequest) (SearchStream, error)
+	MutateCampaignCriteria(ctx context.Context, req *CriteriaRequest) (*CriteriaResponse, error)
+	MutateCampaignBudgets(ctx context.Context, req *BudgetsRequest) (*BudgetsResponse, error)
+	MutateBiddingSeasonalityAdjustments(ctx context.Context, req *SeasonalityRequest) (*SeasonalityResponse, error)
+}
+
+// SearchStream yields a streamed search's batches of rows, then io.EOF.
+type SearchStream interface {
+	Recv() (*StreamResponse, error)
+}
+
+// SecretsProvider is the part of *secretsmanager.Client the Google Ads
+// credentials are read with.
+type SecretsProvider interface {
+	GetSecretValue(ctx context.Context, in *secretsmanager.GetSecretValueInput, opts ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// Publisher is the part of *sns.Client the reports are published with.
+type Publisher interface {
+	Publish(ctx context.Context, in *sns.PublishInput, opts ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// googleAdsService is the AdsClient over the Google Ads API.
+type googleAdsService struct {
+	*googleads.Service
+}
+
+func (s googleAdsService) SearchStream(ctx context.Context, req *StreamRequest) (SearchStream, error) {
+	stream, err := s.Service.SearchStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Optimizer runs the bid optimization against the clients it was built
+// with.
+type Optimizer struct {
+	ads       func(ctx context.Context) (AdsClient, error)
+	publisher Publisher
+}
+
+// NewOptimizer returns an Optimizer that gets its Google Ads client from
+// ads on each invocation, which may keep one across them, and publishes
+// reports with publisher.
+func NewOptimizer(ads func(ctx context.Context) (AdsClient, error), publisher Publisher) *Optimizer {
+	return &Optimizer{ads: ads, publisher: publisher}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	_ "time/tzdata"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/bidrules"
+	"pkg/gaql"
+	"pkg/money"
+)
+
+// ruleCurrency is the currency the money thresholds in runs.go,
+// approvals.go and the bid rules document are written in. They are
+// converted to each account's currency before its rules run.
+const ruleCurrency = money.USD
+
+// fxRates converts thresholds and order revenue into account currencies;
+// see money.StaticFromEnv for FX_RATES. Accounts in a currency it has no
+// rate for fail rather than run dollar rules on other money.
+var fxRates money.Provider = staticRates()
+
+func staticRates() money.Provider {
+	rates, err := money.StaticFromEnv()
+	if err != nil {
+		log.Printf("Ignoring FX_RATES, only %s accounts can be optimized: %v", ruleCurrency, err)
+		return money.Static{}
+	}
+	return rates
+}
+
+var accountQuery = gaql.Select("customer.currency_code", "customer.time_zone").From("customer").MustBuild()
+
+// accountRules are the money thresholds of the bidding rules in one
+// account's currency.
+type accountRules struct {
+	currency string
+
+	targetCPA         float64
+	noRevenueMinCost  float64
+	approvalMinImpact float64
+
+	productExclusionMinCost float64
+
+	// bid are the performance rules, shared with the other ad platforms,
+	// and rate converts their money to currency.
+	bid  *bidrules.Ruleset
+	rate float64
+
+	// guardrails are the defaults, before the account's settings.
+	guardrails bidGuardrails
+
+	// location is the account's time zone, which its days start in.
+	location *time.Location
+}
+
+// loadAccountRules reads the account's currency and time zone and converts
+// the rule thresholds to the currency.
+func loadAccountRules(ctx context.Context, client AdsClient, customerID string) (*accountRules, error) {
+	customer, err := accountCustomer(ctx, client, customerID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := rulesIn(ctx, customer.CurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+	// An unknown zone is a Google Ads change to follow, not a reason to
+	// leave the account unoptimized; its days start in UTC meanwhile.
+	if loc, err := time.LoadLocation(customer.TimeZone); err != nil || customer.TimeZone == "" {
+		log.Printf("Customer %s has unknown time zone %q, using UTC", customerID, customer.TimeZone)
+	} else {
+		rules.location = loc
+	}
+	return rules, nil
+}
+
+// rulesIn converts the rule thresholds to currency.
+func rulesIn(ctx context.Context, currency string) (*accountRules, error) {
+	rate, err := fxRates.Rate(ctx, ruleCurrency, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert bidding rules to %s: %w", currency, err)
+	}
+	return &accountRules{
+		currency:          currency,
+		targetCPA:         targetCPA * rate,
+		noRevenueMinCost:  roasNoRevenueMinCost * rate,
+		approvalMinImpact: approvalMinImpact * rate,
+
+		productExclusionMinCost: productExclusionMinCost * rate,
+
+		bid:  bidRules,
+		rate: rate,
+
+		guardrails: defaultGuardrails(rate),
+
+		location: time.UTC,
+	}, nil
+}
+
+func accountCurrency(ctx context.Context, client AdsClient, customerID string) (string, error) {
+	customer, err := accountCustomer(ctx, client, customerID)
+	if err != nil {
+		return "", err
+	}
+	return customer.CurrencyCode, nil
+}
+
+// accountCustomer reads the account's currency and time zone.
+func accountCustomer(ctx context.Context, client AdsClient, customerID string) (*googleads.Customer, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      accountQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account currency: %w", err)
+	}
+	if len(resp.Results) == 0 || resp.Results[0].Customer == nil || resp.Results[0].Customer.CurrencyCode == "" {
+		return nil, fmt.Errorf("customer %s has no currency", customerID)
+	}
+	return resp.Results[0].Customer, nil
+}
+
+// amount returns units of the account's currency.
+func (r *accountRules) amount(units float64) money.Money {
+	return money.FromUnits(units, r.currency)
+}
+
+// micros returns a Google Ads micros amount in the account's currency.
+func (r *accountRules) micros(micros int64) money.Money {
+	return money.FromMicros(micros, r.currency)
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"google.golang.org/api/googleads"
+
+	"pkg/bidaudit"
+	"pkg/gaql"
+	"pkg/money"
+	"pkg/pool"
+	"pkg/runlog"
+)
+
+// Ad schedule recommendation statuses.
+const (
+	ScheduleRecommended = "RECOMMENDED"
+	ScheduleApplied     = "APPLIED"
+	ScheduleApplyFailed = "APPLY_FAILED"
+)
+
+// Campaign performance by week, day of week and hour. Hours are in the
+// account's time zone, which is also how ad schedules are interpreted.
+var adSchedulePerformanceQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"segments.week",
+	"segments.day_of_week",
+	"segments.hour",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	During(gaql.Last30Days).
+	MustBuild()
+
+// The campaigns' current ad schedules, replaced when a recommendation is
+// applied.
+var currentAdScheduleQuery = gaql.Select(
+	"campaign.id",
+	"campaign_criterion.resource_name",
+	"campaign_criterion.bid_modifier",
+	"campaign_criterion.ad_schedule.day_of_week",
+	"campaign_criterion.ad_schedule.start_hour",
+	"campaign_criterion.ad_schedule.end_hour",
+).From("campaign_criterion").
+	Where("campaign_criterion.type", gaql.Equals, "AD_SCHEDULE").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+var (
+	// adScheduleTable stores the latest recommendation per campaign; when
+	// unset recommendations are only reported.
+	adScheduleTable = os.Getenv("AD_SCHEDULE_TABLE_NAME")
+	// applyAdSchedules replaces campaigns' ad schedules with the
+	// recommendation instead of only reporting it.
+	applyAdSchedules = os.Getenv("AD_SCHEDULE_APPLY") == "true"
+)
+
+// maxAdSchedulesPerDay is Google Ads' limit on a campaign's ad schedules
+// per day.
+const maxAdSchedulesPerDay = 6
+
+// daysOfWeek in schedule order.
+var daysOfWeek = []string{"MONDAY", "TUESDAY", "WEDNESDAY", "THURSDAY", "FRIDAY", "SATURDAY", "SUNDAY"}
+
+// AdScheduleWindow is a span of whole hours on one day. EndHour is
+// exclusive and may be 24. Paused windows are left out of the schedule,
+// so ads do not serve then.
+type AdScheduleWindow struct {
+	DayOfWeek   string  `json:"day_of_week" dynamodbav:"day_of_week"`
+	StartHour   int     `json:"start_hour" dynamodbav:"start_hour"`
+	EndHour     int     `json:"end_hour" dynamodbav:"end_hour"`
+	BidModifier float64 `json:"bid_modifier" dynamodbav:"bid_modifier"`
+	Paused      bool    `json:"paused,omitempty" dynamodbav:"paused,omitempty"`
+}
+
+func (w AdScheduleWindow) String() string {
+	label := fmt.Sprintf("%s %02d:00-%02d:00", w.DayOfWeek[:3], w.StartHour, w.EndHour)
+	if w.Paused {
+		return label + " paused"
+	}
+	return fmt.Sprintf("%s %+.0f%%", label, (w.BidModifier-1)*100)
+}
+
+// AdScheduleRecommendation is the recommended ad schedule for one
+// campaign: every hour of the week, as windows of equal bid modifier.
+type AdScheduleRecommendation struct {
+	CustomerID      string             `json:"customer_id" dynamodbav:"customer_id"`
+	CampaignID      string             `json:"campaign_id" dynamodbav:"campaign_id"`
+	CampaignName    string             `json:"campaign_name" dynamodbav:"campaign_name"`
+	RunID           string             `json:"run_id" dynamodbav:"run_id"`
+	ConfigHash      string             `json:"config_hash" dynamodbav:"config_hash"`
+	GeneratedAt     string             `json:"generated_at" dynamodbav:"generated_at"`
+	Status          string             `json:"status" dynamodbav:"status"`
+	Error           string             `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	CampaignCPA     money.Money        `json:"campaign_cpa" dynamodbav:"campaign_cpa"`
+	PausedHours     int                `json:"paused_hours" dynamodbav:"paused_hours"`
+	PausedCost      money.Money        `json:"paused_cost" dynamodbav:"paused_cost"`
+	Windows         []AdScheduleWindow `json:"windows" dynamodbav:"windows"`
+	CurrentSchedule []AdScheduleWindow `json:"current_schedule,omitempty" dynamodbav:"current_schedule,omitempty"`
+	// Cohort is the campaign's experiment cohort; control schedules are
+	// never applied.
+	Cohort string `json:"cohort,omitempty" dynamodbav:"cohort,omitempty"`
+
+	// criteria are the resource names of the current schedule, removed
+	// when the recommendation is applied.
+	criteria []string
+}
+
+// Changes lists the non-neutral windows, for reports.
+func (r AdScheduleRecommendation) Changes() []string {
+	var changes []string
+	for _, w := range r.Windows {
+		if w.Paused || w.BidModifier != 1 {
+			changes = append(changes, w.String())
+		}
+	}
+	return changes
+}
+
+// slotStats are one hour-of-week's totals, overall and per week.
+type slotStats struct {
+	Clicks      int64
+	Cost        float64
+	Conversions int64
+	Weeks       map[string]*slotWeek
+}
+
+type slotWeek struct {
+	Cost        float64
+	Conversions int64
+}
+
+type campaignSlots struct {
+	ID          string
+	Name        string
+	Cost        float64
+	Conversions int64
+	Slots       [7][24]slotStats
+}
+
+// CPA is the campaign's cost per conversion over the window.
+func (c *campaignSlots) CPA() float64 {
+	if c.Conversions == 0 {
+		return 0
+	}
+	return c.Cost / float64(c.Conversions)
+}
+
+// optimizeAdSchedules recommends ad schedules for the account's campaigns
+// with enough conversions to judge their hours against.
+func optimizeAdSchedules(ctx context.Context, client AdsClient, rules *accountRules, customerID string) ([]AdScheduleRecommendation, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      adSchedulePerformanceQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search ad schedule performance: %w", err)
+	}
+
+	campaigns := make(map[string]*campaignSlots)
+	for _, row := range resp.Results {
+		day := dayIndex(row.Segments.DayOfWeek.String())
+		hour := int(row.Segments.Hour)
+		if day < 0 || hour < 0 || hour > 23 {
+			continue
+		}
+		id := fmt.Sprintf("%d", row.Campaign.Id)
+		c, ok := campaigns[id]
+		if !ok {
+			c = &campaignSlots{ID: id, Name: row.Campaign.Name}
+			campaigns[id] = c
+		}
+		cost := float64(row.Metrics.CostMicros) / 1000000.0
+		c.Cost += cost
+		c.Conversions += row.Metrics.Conversions
+
+		slot := &c.Slots[day][hour]
+		slot.Clicks += row.Metrics.Clicks
+		slot.Cost += cost
+		slot.Conversions += row.Metrics.Conversions
+		if slot.Weeks == nil {
+			slot.Weeks = make(map[string]*slotWeek)
+		}
+		week, ok := slot.Weeks[row.Segments.Week]
+		if !ok {
+			week = &slotWeek{}
+			slot.Weeks[row.Segments.Week] = week
+		}
+		week.Cost += cost
+		week.Conversions += row.Metrics.Conversions
+	}
+
+	current, err := loadAdSchedules(ctx, client, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var recs []AdScheduleRecommendation
+	for _, c := range campaigns {
+		if c.Conversions < adScheduleMinConversions {
+			continue
+		}
+		rec := recommendAdSchedule(rules, c)
+		if len(rec.Changes()) == 0 {
+			continue
+		}
+		existing := current[c.ID]
+		rec.CustomerID = customerID
+		rec.CurrentSchedule = existing.Windows
+		rec.criteria = existing.Criteria
+		if sameSchedule(rec.Windows, existing.Windows) {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].PausedCost.AmountMicros > recs[j].PausedCost.AmountMicros })
+	return recs, nil
+}
+
+// recommendAdSchedule judges each hour of the week against the campaign's
+// CPA. An hour is paused when it spent in enough weeks without ever
+// converting at an acceptable CPA; otherwise its bid modifier is the
+// ratio of campaign to hour CPA, clamped and rounded. Hours without enough
+// clicks to judge stay neutral.
+func recommendAdSchedule(rules *accountRules, c *campaignSlots) AdScheduleRecommendation {
+	cpa := c.CPA()
+	rec := AdScheduleRecommendation{
+		CampaignID:   c.ID,
+		CampaignName: c.Name,
+		CampaignCPA:  rules.amount(cpa),
+	}
+
+	var hours [7][24]AdScheduleWindow
+	var pausedCost float64
+	for d := range daysOfWeek {
+		for h := 0; h < 24; h++ {
+			slot := c.Slots[d][h]
+			hour := AdScheduleWindow{DayOfWeek: daysOfWeek[d], StartHour: h, EndHour: h + 1, BidModifier: 1}
+			switch {
+			case consistentlyUnprofitable(slot, cpa):
+				hour.Paused = true
+				rec.PausedHours++
+				pausedCost += slot.Cost
+			case slot.Clicks >= adScheduleMinClicks:
+				hour.BidModifier = hourBidModifier(slot, cpa)
+			}
+			hours[d][h] = hour
+		}
+	}
+	rec.PausedCost = rules.amount(pausedCost)
+
+	for d := range daysOfWeek {
+		rec.Windows = append(rec.Windows, fitDay(hours[d][:])...)
+	}
+	return rec
+}
+
+// consistentlyUnprofitable reports whether an hour spent at least the
+// campaign CPA at an unprofitable CPA, and was unprofitable in every week
+// it spent and in enough weeks that it is not noise.
+func consistentlyUnprofitable(slot slotStats, campaignCPA float64) bool {
+	limit := campaignCPA * adScheduleUnprofitableCPA
+	if slot.Cost < campaignCPA*adSchedulePauseCostMultiple || !unprofitable(slot.Cost, slot.Conversions, limit) {
+		return false
+	}
+	var bad int
+	for _, week := range slot.Weeks {
+		if week.Cost == 0 {
+			continue
+		}
+		if !unprofitable(week.Cost, week.Conversions, limit) {
+			return false
+		}
+		bad++
+	}
+	return bad >= adSchedulePauseMinWeeks
+}
+
+func unprofitable(cost float64, conversions int64, maxCPA float64) bool {
+	return conversions == 0 || cost/float64(conversions) > maxCPA
+}
+
+func hourBidModifier(slot slotStats, campaignCPA float64) float64 {
+	if slot.Conversions == 0 {
+		return adScheduleMinModifier
+	}
+	modifier := campaignCPA / (slot.Cost / float64(slot.Conversions))
+	modifier = math.Max(adScheduleMinModifier, math.Min(adScheduleMaxModifier, modifier))
+	modifier = math.Round(modifier/adScheduleModifierStep) * adScheduleModifierStep
+	if math.Abs(modifier-1) < adScheduleMinModifierChange {
+		return 1
+	}
+	return math.Round(modifier*100) / 100
+}
+
+// fitDay merges a day's hours into windows of equal modifier. Google Ads
+// allows a limited number of schedules per day, so while the day's
+// serving windows exceed it the adjustment closest to neutral is dropped.
+func fitDay(hours []AdScheduleWindow) []AdScheduleWindow {
+	for {
+		windows := mergeHours(hours)
+		var serving int
+		for _, w := range windows {
+			if !w.Paused {
+				serving++
+			}
+		}
+		if serving <= maxAdSchedulesPerDay {
+			return windows
+		}
+
+		weakest := -1
+		for i, h := range hours {
+			if h.Paused || h.BidModifier == 1 {
+				continue
+			}
+			if weakest < 0 || math.Abs(h.BidModifier-1) < math.Abs(hours[weakest].BidModifier-1) {
+				weakest = i
+			}
+		}
+		if weakest < 0 {
+			// Only pauses split the day; keep them and let applying fail
+			// loudly rather than silently serving paused hours.
+			return windows
+		}
+		neutral := hours[weakest].BidModifier
+		for i := range hours {
+			if hours[i].BidModifier == neutral && !hours[i].Paused {
+				hours[i].BidModifier = 1
+			}
+		}
+	}
+}
+
+func mergeHours(hours []AdScheduleWindow) []AdScheduleWindow {
+	var windows []AdScheduleWindow
+	for _, h := range hours {
+		if n := len(windows); n > 0 {
+			last := &windows[n-1]
+			if last.Paused == h.Paused && last.BidModifier == h.BidModifier && last.EndHour == h.StartHour {
+				last.EndHour = h.EndHour
+				continue
+			}
+		}
+		windows = append(windows, h)
+	}
+	return windows
+}
+
+type currentSchedule struct {
+	Windows  []AdScheduleWindow
+	Criteria []string
+}
+
+// loadAdSchedules returns the account's current ad schedules by campaign.
+// Hours a campaign with schedules does not list are not served, so they
+// are reported as paused.
+func loadAdSchedules(ctx context.Context, client AdsClient, customerID string) (map[string]currentSchedule, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      currentAdScheduleQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search ad schedules: %w", err)
+	}
+
+	hours := make(map[string]*[7][24]AdScheduleWindow)
+	schedules := make(map[string]currentSchedule)
+	for _, row := range resp.Results {
+		criterion := row.CampaignCriterion
+		if criterion == nil || criterion.AdSchedule == nil {
+			continue
+		}
+		day := dayIndex(criterion.AdSchedule.DayOfWeek.String())
+		if day < 0 {
+			continue
+		}
+		id := fmt.Sprintf("%d", row.Campaign.Id)
+		grid, ok := hours[id]
+		if !ok {
+			grid = new([7][24]AdScheduleWindow)
+			for d := range grid {
+				for h := range grid[d] {
+					grid[d][h] = AdScheduleWindow{DayOfWeek: daysOfWeek[d], StartHour: h, EndHour: h + 1, BidModifier: 1, Paused: true}
+				}
+			}
+			hours[id] = grid
+		}
+		modifier := criterion.BidModifier
+		if modifier == 0 {
+			modifier = 1
+		}
+		for h := int(criterion.AdSchedule.StartHour); h < int(criterion.AdSchedule.EndHour) && h < 24; h++ {
+			grid[day][h].Paused = false
+			grid[day][h].BidModifier = modifier
+		}
+		s := schedules[id]
+		s.Criteria = append(s.Criteria, criterion.ResourceName)
+		schedules[id] = s
+	}
+
+	for id, grid := range hours {
+		s := schedules[id]
+		for d := range grid {
+			s.Windows = append(s.Windows, mergeHours(grid[d][:])...)
+		}
+		schedules[id] = s
+	}
+	return schedules, nil
+}
+
+func sameSchedule(a, b []AdScheduleWindow) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyAdSchedule replaces the campaign's ad schedules with the
+// recommended serving windows in one request, so a failure leaves the
+// current schedule in place.
+func applyAdSchedule(ctx context.Context, client AdsClient, rec AdScheduleRecommendation) error {
+	campaign := fmt.Sprintf("customers/%s/campaigns/%s", rec.CustomerID, rec.CampaignID)
+
+	var ops []*googleads.CampaignCriterionOperation
+	for _, name := range rec.criteria {
+		ops = append(ops, &googleads.CampaignCriterionOperation{Remove: name})
+	}
+	for _, w := range rec.Windows {
+		if w.Paused {
+			continue
+		}
+		ops = append(ops, &googleads.CampaignCriterionOperation{
+			Create: &googleads.CampaignCriterion{
+				Campaign:    campaign,
+				BidModifier: w.BidModifier,
+				AdSchedule: &googleads.AdScheduleInfo{
+					DayOfWeek:   googleads.Enum(w.DayOfWeek),
+					StartHour:   int64(w.StartHour),
+					EndHour:     int64(w.EndHour),
+					StartMinute: "ZERO",
+					EndMinute:   "ZERO",
+				},
+			},
+		})
+	}
+
+	err := adsCalls.Call(ctx, func(ctx context.Context) error {
+		_, err := client.MutateCampaignCriteria(ctx, &googleads.MutateCampaignCriteriaRequest{
+			CustomerId: rec.CustomerID,
+			Operations: ops,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mutate ad schedules for campaign %s: %w", rec.CampaignID, err)
+	}
+	return nil
+}
+
+// saveAdScheduleRecommendations stores each campaign's latest
+// recommendation, replacing the previous one.
+func saveAdScheduleRecommendations(ctx context.Context, db *dynamodb.Client, recs []AdScheduleRecommendation) error {
+	var failed int
+	for _, rec := range recs {
+		item, err := attributevalue.MarshalMap(rec)
+		if err != nil {
+			return fmt.Errorf("failed to marshal ad schedule recommendation: %w", err)
+		}
+		_, err = db.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(adScheduleTable),
+			Item:      item,
+		})
+		if err != nil {
+			log.Printf("Failed to save ad schedule recommendation for campaign %s: %v", rec.CampaignID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to save %d of %d ad schedule recommendations", failed, len(recs))
+	}
+	return nil
+}
+
+func dayIndex(day string) int {
+	for i, d := range daysOfWeek {
+		if strings.EqualFold(d, day) {
+			return i
+		}
+	}
+	return -1
+}
+
+// processAdSchedules stamps the run's recommendations, applies them when
+// AD_SCHEDULE_APPLY is set, except in experiment control campaigns, and
+// stores them; applied schedules are recorded in the bid audit log.
+// Failures are logged: the bid report still goes out.
+func processAdSchedules(ctx context.Context, client AdsClient, run *runlog.Run, recs []AdScheduleRecommendation) {
+	var apply []*AdScheduleRecommendation
+	for i := range recs {
+		rec := &recs[i]
+		rec.RunID = run.RunID
+		rec.ConfigHash = run.ConfigHash
+		rec.GeneratedAt = clk.Now().UTC().Format(time.RFC3339)
+		rec.Status = ScheduleRecommended
+		if applyAdSchedules && rec.Cohort != CohortControl {
+			apply = append(apply, rec)
+		}
+	}
+
+	// Each campaign's schedule is its own mutate, so campaigns are applied
+	// up to queryConcurrency at a time.
+	var applied atomic.Int64
+	pool.Each(ctx, queryConcurrency, apply, func(ctx context.Context, rec *AdScheduleRecommendation) error {
+		if err := applyAdSchedule(ctx, client, *rec); err != nil {
+			log.Printf("Failed to apply ad schedule: %v", err)
+			rec.Status = ScheduleApplyFailed
+			rec.Error = err.Error()
+			return nil
+		}
+		rec.Status = ScheduleApplied
+		applied.Add(1)
+		log.Printf("Applied ad schedule to campaign %s: %s", rec.CampaignID, strings.Join(rec.Changes(), ", "))
+		return nil
+	})
+	emf.Count("AdSchedulesApplied", int(applied.Load()))
+	var audited []bidaudit.Record
+	for _, rec := range apply {
+		if rec.Status == ScheduleApplied {
+			audited = append(audited, adScheduleAuditRecord(*rec))
+		}
+	}
+	recordChanges(ctx, audited)
+
+	if adScheduleTable == "" {
+		return
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		log.Printf("Failed to load AWS config for ad schedules: %v", err)
+		return
+	}
+	if err := saveAdScheduleRecommendations(ctx, dynamodb.NewFromConfig(cfg), recs); err != nil {
+		log.Printf("Failed to save ad schedule recommendations: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"pkg/ads"
+)
+
+// DryRunReport is what a run would recommend for one account. A dry run
+// files nothing for approval, applies nothing and publishes nothing; the
+// report is only returned to the caller, such as adsctl.
+type DryRunReport struct {
+	DryRun     bool   `json:"dry_run"`
+	CustomerID string `json:"customer_id"`
+	Mode       string `json:"mode,omitempty"`
+	ConfigHash string `json:"config_hash"`
+
+	Recommendations        []BidOptimizationResult    `json:"recommendations"`
+	AdSchedules            []AdScheduleRecommendation `json:"ad_schedule_recommendations,omitempty"`
+	CampaignROAS           []CampaignROAS             `json:"campaign_roas,omitempty"`
+	StrategyProjections    []StrategyProjection       `json:"strategy_projections,omitempty"`
+	BudgetReallocations    []BudgetReallocationPlan   `json:"budget_reallocations,omitempty"`
+	ProductPartitions      []ProductPartition         `json:"product_partitions,omitempty"`
+	ListingGroupExclusions []ListingExclusion         `json:"listing_group_exclusions,omitempty"`
+	ProductRecommendations []ProductRecommendation    `json:"product_recommendations,omitempty"`
+}
+
+// dryRun plans the event's customer the way the run would, in the event's
+// mode, and returns the plan instead of acting on it. No run is recorded.
+func (o *Optimizer) dryRun(ctx context.Context, event BidOptimizationEvent) (*DryRunReport, error) {
+	defer flushMetrics()
+
+	if event.CustomerID == "" {
+		return nil, fmt.Errorf("customer_id is required for a dry run")
+	}
+	if event.Mode != "" && event.Mode != ModeBudgets {
+		return nil, fmt.Errorf("mode %q has no dry run", event.Mode)
+	}
+	log.Printf("Starting dry run for customer %s in environment: %s (mode %q)", event.CustomerID, environment, event.Mode)
+
+	report := &DryRunReport{
+		DryRun:     true,
+		CustomerID: event.CustomerID,
+		Mode:       event.Mode,
+		ConfigHash: configSnapshot().Hash(),
+	}
+	if account := ads.ParseAccount(event.CustomerID); account.Platform != ads.Google {
+		if event.Mode == ModeBudgets {
+			return report, nil
+		}
+		results, _, err := planPlatformAccount(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		report.Recommendations = results
+		return report, nil
+	}
+
+	client, err := o.ads(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+	plan, err := planAccount(ctx, client, event.CustomerID, event.Mode)
+	if err != nil {
+		return nil, err
+	}
+	report.Recommendations = plan.results
+	report.AdSchedules = plan.schedules
+	report.CampaignROAS = plan.roas
+	report.StrategyProjections = plan.strategies
+	report.BudgetReallocations = plan.reallocations
+	report.ProductPartitions = plan.products.Partitions
+	report.ListingGroupExclusions = plan.products.Exclusions
+	report.ProductRecommendations = plan.products.Recommendations
+	log.Printf("Dry run for customer %s: %d bid, %d ad schedule, %d budget and %d product recommendations",
+		event.CustomerID, len(report.Recommendations), len(report.AdSchedules), len(report.BudgetReallocations), len(report.ProductRecommendations))
+	return report, nil
+}
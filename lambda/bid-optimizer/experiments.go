@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+
+	"pkg/dynamo"
+	"pkg/envelope"
+	"pkg/gaql"
+	"pkg/money"
+	"pkg/notify"
+	"pkg/pool"
+)
+
+// ModeExperimentReport publishes the weekly comparison of the running
+// experiment's cohorts instead of optimizing.
+const ModeExperimentReport = "experiment_report"
+
+// Experiment cohorts. Only treatment campaigns have the optimizer's
+// changes applied; control campaigns are still analysed and reported, so
+// the report shows what was held back.
+const (
+	CohortTreatment = "treatment"
+	CohortControl   = "control"
+)
+
+var (
+	// experimentID names the running experiment; the optimizer applies to
+	// every campaign when it is unset. A new ID starts a new experiment
+	// with fresh assignments.
+	experimentID     = os.Getenv("EXPERIMENT_ID")
+	experimentsTable = os.Getenv("EXPERIMENTS_TABLE_NAME")
+	// experimentTreatmentShare is the fraction of campaigns assigned to
+	// treatment.
+	experimentTreatmentShare = parseFloatEnv("EXPERIMENT_TREATMENT_SHARE", 0.5)
+	// experimentReportsBucket stores the full weekly reports.
+	experimentReportsBucket = os.Getenv("EXPERIMENT_REPORTS_BUCKET")
+)
+
+// Envelope type and schema version of the published experiment report.
+const (
+	experimentMessageType   = notify.KindExperimentReport
+	experimentSchemaVersion = notify.ExperimentReportSchemaVersion
+)
+
+// experimentMaxDays caps the report window, keeping the query bounded for
+// long-running experiments.
+const experimentMaxDays = 90
+
+// z95 is the standard normal quantile of a two-sided 95% interval.
+const z95 = 1.959964
+
+// cohortAssignment is a campaign's cohort in an experiment. Assignments
+// are stored on first sight and never change, so campaigns created during
+// the experiment join it and the split survives config changes.
+type cohortAssignment struct {
+	ExperimentID string    `json:"experiment_id" dynamodbav:"experiment_id"`
+	CampaignKey  string    `json:"-" dynamodbav:"campaign_key"`
+	CustomerID   string    `json:"customer_id" dynamodbav:"customer_id"`
+	CampaignID   string    `json:"campaign_id" dynamodbav:"campaign_id"`
+	Cohort       string    `json:"cohort" dynamodbav:"cohort"`
+	AssignedAt   time.Time `json:"assigned_at" dynamodbav:"assigned_at"`
+}
+
+func campaignKey(customerID, campaignID string) string {
+	return dynamo.Compose(customerID, campaignID)
+}
+
+// accountCohorts holds one account's assignments in the running
+// experiment. A nil *accountCohorts means no experiment is running, and
+// every campaign is treated.
+type accountCohorts struct {
+	table      *dynamo.Table
+	customerID string
+	assigned   map[string]string
+}
+
+func experimentTable(ctx context.Context) (*dynamo.Table, error) {
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return dynamo.NewTable(dynamodb.NewFromConfig(cfg), experimentsTable), nil
+}
+
+// loadCohorts reads the account's assignments in the running experiment,
+// or returns nil when there is none.
+func loadCohorts(ctx context.Context, customerID string) (*accountCohorts, error) {
+	if experimentID == "" || experimentsTable == "" {
+		return nil, nil
+	}
+	table, err := experimentTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := dynamo.QueryAll[cohortAssignment](ctx, table, dynamo.Query{
+		KeyCondition: "experiment_id = :experiment AND begins_with(campaign_key, :prefix)",
+		Values: map[string]types.AttributeValue{
+			":experiment": dynamo.S(experimentID),
+			":prefix":     dynamo.S(dynamo.Prefix(customerID)),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cohort assignments: %w", err)
+	}
+	c := &accountCohorts{table: table, customerID: customerID, assigned: make(map[string]string, len(items))}
+	for _, item := range items {
+		c.assigned[item.CampaignID] = item.Cohort
+	}
+	return c, nil
+}
+
+// cohort returns the campaign's cohort, assigning it on first sight. A
+// campaign whose assignment cannot be stored is treated as control for
+// this run, so no change reaches it unrecorded.
+func (c *accountCohorts) cohort(ctx context.Context, campaignID string) string {
+	if c == nil {
+		return CohortTreatment
+	}
+	if cohort, ok := c.assigned[campaignID]; ok {
+		return cohort
+	}
+
+	item := cohortAssignment{
+		ExperimentID: experimentID,
+		CampaignKey:  campaignKey(c.customerID, campaignID),
+		CustomerID:   c.customerID,
+		CampaignID:   campaignID,
+		Cohort:       assignCohort(c.customerID, campaignID),
+		AssignedAt:   clk.Now().UTC(),
+	}
+	err := c.table.Put(ctx, item, dynamo.IfNotExists("campaign_key"))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		// Another worker assigned it first; theirs stands.
+		stored, getErr := dynamo.Get[cohortAssignment](ctx, c.table, dynamo.Key{
+			"experiment_id": dynamo.S(experimentID),
+			"campaign_key":  dynamo.S(item.CampaignKey),
+		})
+		if getErr == nil {
+			item, err = stored, nil
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to assign campaign %s to a cohort, holding it out: %v", campaignID, err)
+		return CohortControl
+	}
+	c.assigned[campaignID] = item.Cohort
+	return item.Cohort
+}
+
+func (c *accountCohorts) treated(ctx context.Context, campaignID string) bool {
+	return c.cohort(ctx, campaignID) == CohortTreatment
+}
+
+// assignCohort splits campaigns by a hash of the experiment and campaign,
+// so the split is random across campaigns but reproducible.
+func assignCohort(customerID, campaignID string) string {
+	sum := sha256.Sum256([]byte(experimentID + "/" + customerID + "/" + campaignID))
+	u := float64(binary.BigEndian.Uint64(sum[:8])) / math.MaxUint64
+	if u < experimentTreatmentShare {
+		return CohortTreatment
+	}
+	return CohortControl
+}
+
+// holdOutControl stamps each recommendation with its campaign's cohort.
+// Control recommendations are reported but never filed for approval or
+// applied.
+func holdOutControl(ctx context.Context, cohorts *accountCohorts, results []BidOptimizationResult, schedules []AdScheduleRecommendation, products []ProductRecommendation) {
+	if cohorts == nil {
+		return
+	}
+	var held int
+	for i := range results {
+		results[i].Cohort = cohorts.cohort(ctx, results[i].CampaignID)
+		if results[i].Cohort == CohortControl {
+			held++
+		}
+	}
+	for i := range schedules {
+		schedules[i].Cohort = cohorts.cohort(ctx, schedules[i].CampaignID)
+		if schedules[i].Cohort == CohortControl {
+			held++
+		}
+	}
+	for i := range products {
+		products[i].Cohort = cohorts.cohort(ctx, products[i].CampaignID)
+		if products[i].Cohort == CohortControl {
+			held++
+		}
+	}
+	emf.Count("RecommendationsHeldOut", held)
+}
+
+// experimentCampaignQuery totals every campaign from start to end.
+func experimentCampaignQuery(start, end time.Time) (string, error) {
+	return gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"metrics.clicks",
+		"metrics.conversions",
+		"metrics.cost_micros",
+	).From("campaign").
+		Between("segments.date", start.Format("2006-01-02"), end.Format("2006-01-02")).
+		Build()
+}
+
+// experimentCampaign is one assigned campaign's totals in the report.
+// Cost is in the account's currency and reportCost in ruleCurrency, which
+// the cohorts are totalled in.
+type experimentCampaign struct {
+	CustomerID   string      `json:"customer_id"`
+	CampaignID   string      `json:"campaign_id"`
+	CampaignName string      `json:"campaign_name"`
+	Cohort       string      `json:"cohort"`
+	Clicks       int64       `json:"clicks"`
+	Conversions  float64     `json:"conversions"`
+	Cost         money.Money `json:"cost"`
+
+	reportCost money.Money
+}
+
+// fullExperimentReport is the report stored in S3: the published summary
+// plus every campaign's row.
+type fullExperimentReport struct {
+	notify.ExperimentReport
+	Campaigns []experimentCampaign `json:"campaigns"`
+}
+
+// reportExperiment compares the cohorts of the running experiment from its
+// first assignment through yesterday, stores the report in S3 and
+// publishes its summary.
+func (o *Optimizer) reportExperiment(ctx context.Context) error {
+	if experimentID == "" || experimentsTable == "" {
+		log.Printf("No experiment is running, skipping the experiment report")
+		return nil
+	}
+	table, err := experimentTable(ctx)
+	if err != nil {
+		return err
+	}
+	assignments, err := dynamo.QueryAll[cohortAssignment](ctx, table, dynamo.Query{
+		KeyCondition: "experiment_id = :experiment",
+		Values:       map[string]types.AttributeValue{":experiment": dynamo.S(experimentID)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load cohort assignments: %w", err)
+	}
+	if len(assignments) == 0 {
+		log.Printf("Experiment %s has no assigned campaigns yet", experimentID)
+		return nil
+	}
+
+	// Full days only: from the day after the first assignment, when the
+	// first treated changes had a whole day to act, through yesterday.
+	today := clk.Now().UTC().Truncate(24 * time.Hour)
+	first := assignments[0].AssignedAt
+	byCustomer := make(map[string]map[string]string)
+	for _, a := range assignments {
+		if a.AssignedAt.Before(first) {
+			first = a.AssignedAt
+		}
+		if byCustomer[a.CustomerID] == nil {
+			byCustomer[a.CustomerID] = make(map[string]string)
+		}
+		byCustomer[a.CustomerID][a.CampaignID] = a.Cohort
+	}
+	start := first.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	if oldest := today.AddDate(0, 0, -experimentMaxDays); start.Before(oldest) {
+		start = oldest
+	}
+	end := today.AddDate(0, 0, -1)
+	if end.Before(start) {
+		log.Printf("Experiment %s has no full day of data yet", experimentID)
+		return nil
+	}
+
+	client, err := o.ads(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+	query, err := experimentCampaignQuery(start, end)
+	if err != nil {
+		return fmt.Errorf("failed to build experiment query: %w", err)
+	}
+
+	report := fullExperimentReport{ExperimentReport: notify.ExperimentReport{
+		ExperimentID: experimentID,
+		Environment:  environment,
+		GeneratedAt:  clk.Now().UTC(),
+		WindowStart:  start.Format("2006-01-02"),
+		WindowEnd:    end.Format("2006-01-02"),
+	}}
+	customerIDs := make([]string, 0, len(byCustomer))
+	for customerID := range byCustomer {
+		customerIDs = append(customerIDs, customerID)
+	}
+	sort.Strings(customerIDs)
+	// Accounts are loaded up to accountConcurrency at a time, and the
+	// campaigns then added in customer ID order so reports compare.
+	var mu sync.Mutex
+	campaigns := make(map[string][]experimentCampaign, len(customerIDs))
+	err = pool.Each(ctx, accountConcurrency, customerIDs, func(ctx context.Context, customerID string) error {
+		// A missing account would bias the comparison; better no report
+		// than a wrong one.
+		currency, err := accountCurrency(ctx, client, customerID)
+		if err != nil {
+			return err
+		}
+		resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{CustomerId: customerID, Query: query})
+		if err != nil {
+			return fmt.Errorf("failed to load campaigns for customer %s: %w", customerID, err)
+		}
+		var accountCampaigns []experimentCampaign
+		for _, row := range resp.Results {
+			campaignID := fmt.Sprintf("%d", row.Campaign.Id)
+			cohort, ok := byCustomer[customerID][campaignID]
+			if !ok {
+				continue
+			}
+			cost := money.FromMicros(row.Metrics.CostMicros, currency)
+			reportCost, err := money.Convert(ctx, fxRates, cost, ruleCurrency)
+			if err != nil {
+				return fmt.Errorf("failed to convert cost for customer %s: %w", customerID, err)
+			}
+			accountCampaigns = append(accountCampaigns, experimentCampaign{
+				CustomerID:   customerID,
+				CampaignID:   campaignID,
+				CampaignName: row.Campaign.Name,
+				Cohort:       cohort,
+				Clicks:       row.Metrics.Clicks,
+				Conversions:  float64(row.Metrics.Conversions),
+				Cost:         cost,
+				reportCost:   reportCost,
+			})
+		}
+		mu.Lock()
+		campaigns[customerID] = accountCampaigns
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, customerID := range customerIDs {
+		report.Campaigns = append(report.Campaigns, campaigns[customerID]...)
+	}
+	if report.Treatment, err = cohortTotals(report.Campaigns, CohortTreatment); err != nil {
+		return fmt.Errorf("failed to total the treatment cohort: %w", err)
+	}
+	if report.Control, err = cohortTotals(report.Campaigns, CohortControl); err != nil {
+		return fmt.Errorf("failed to total the control cohort: %w", err)
+	}
+	report.ConversionRateLift, report.CPADelta = compareCohorts(report.Treatment, report.Control)
+
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if experimentReportsBucket != "" {
+		key := fmt.Sprintf("experiments/%s/%s.json", experimentID, report.WindowEnd)
+		body, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode experiment report: %w", err)
+		}
+		_, err = s3.NewFromConfig(cfg).PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(experimentReportsBucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store experiment report: %w", err)
+		}
+		report.ReportURI = fmt.Sprintf("s3://%s/%s", experimentReportsBucket, key)
+	}
+
+	message, err := envelope.New("bid-optimizer", nil, "", clk).Seal(ctx, envelope.Meta{
+		Type:          experimentMessageType,
+		SchemaVersion: experimentSchemaVersion,
+	}, report.ExperimentReport)
+	if err != nil {
+		return fmt.Errorf("failed to seal experiment report: %w", err)
+	}
+	_, err = o.publisher.Publish(ctx, &sns.PublishInput{
+		Message:  aws.String(message),
+		Subject:  aws.String(fmt.Sprintf("Google Ads Experiment Report - %s", experimentID)),
+		TopicArn: aws.String(snsTopicARN),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish experiment report: %w", err)
+	}
+
+	log.Printf("Published experiment %s report for %s to %s: %d treatment and %d control campaigns",
+		experimentID, report.WindowStart, report.WindowEnd, report.Treatment.Campaigns, report.Control.Campaigns)
+	return nil
+}
+
+func cohortTotals(campaigns []experimentCampaign, cohort string) (notify.CohortMetrics, error) {
+	m := notify.CohortMetrics{Cost: money.FromMicros(0, ruleCurrency)}
+	for _, c := range campaigns {
+		if c.Cohort != cohort {
+			continue
+		}
+		cost, err := m.Cost.Add(c.reportCost)
+		if err != nil {
+			return m, fmt.Errorf("campaign %s: %w", c.CampaignID, err)
+		}
+		m.Campaigns++
+		m.Clicks += c.Clicks
+		m.Conversions += c.Conversions
+		m.Cost = cost
+	}
+	if m.Clicks > 0 {
+		m.ConversionRate = m.Conversions / float64(m.Clicks)
+	}
+	m.CPA = m.Cost.Div(m.Conversions)
+	return m, nil
+}
+
+// compareCohorts estimates the treatment's conversion rate lift and CPA
+// change over control, with 95% intervals from the log of each ratio:
+// conversions are treated as Poisson counts, so the log conversion rate
+// has variance (1-p)/conversions and the log CPA 1/conversions. Both are
+// nil until each cohort has converted.
+func compareCohorts(treatment, control notify.CohortMetrics) (lift, cpa *notify.Estimate) {
+	if treatment.Conversions <= 0 || control.Conversions <= 0 || treatment.Clicks == 0 || control.Clicks == 0 {
+		return nil, nil
+	}
+	// Several conversions per click push the rate past 1; its variance
+	// term then bottoms out at zero.
+	rateVariance := math.Max(0, 1-treatment.ConversionRate)/treatment.Conversions +
+		math.Max(0, 1-control.ConversionRate)/control.Conversions
+	lift = relativeDifference(treatment.ConversionRate/control.ConversionRate, math.Sqrt(rateVariance))
+
+	cpaVariance := 1/treatment.Conversions + 1/control.Conversions
+	cpa = relativeDifference(treatment.CPA.Units()/control.CPA.Units(), math.Sqrt(cpaVariance))
+	return lift, cpa
+}
+
+// relativeDifference turns a ratio and the standard error of its log into
+// a relative change with its 95% interval.
+func relativeDifference(ratio, logSE float64) *notify.Estimate {
+	e := &notify.Estimate{
+		Value: ratio - 1,
+		Lower: math.Exp(math.Log(ratio)-z95*logSE) - 1,
+		Upper: math.Exp(math.Log(ratio)+z95*logSE) - 1,
+	}
+	e.Significant = e.Lower > 0 || e.Upper < 0
+	return e
+}
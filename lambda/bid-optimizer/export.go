@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"pkg/runlog"
+	"pkg/xlsx"
+)
+
+// Spreadsheet formats bid recommendations are exported in.
+const (
+	ExportCSV  = "csv"
+	ExportXLSX = "xlsx"
+)
+
+// maxExportLinkTTL is the longest S3 allows a presigned URL to last.
+const maxExportLinkTTL = 7 * 24 * time.Hour
+
+var (
+	// bidExportsBucket stores each report's recommendations as
+	// spreadsheets under bid_exports/; nothing is exported when unset.
+	bidExportsBucket = os.Getenv("BID_EXPORTS_BUCKET")
+	// bidExportFormats lists the formats to write, comma separated.
+	bidExportFormats = parseExportFormats(os.Getenv("BID_EXPORT_FORMATS"))
+	// bidExportLinkTTL is how long the download links in the report work.
+	// Links are signed with the function's role credentials and stop
+	// working early if those expire first.
+	bidExportLinkTTL = exportLinkTTL(parseIntEnv("BID_EXPORT_LINK_TTL_HOURS", 72))
+)
+
+// BidExport is one spreadsheet of a report's recommendations. DownloadURL
+// is presigned and works without AWS credentials until ExpiresAt.
+type BidExport struct {
+	Format      string    `json:"format"`
+	URI         string    `json:"uri"`
+	DownloadURL string    `json:"download_url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Rows        int       `json:"rows"`
+}
+
+// exportColumns heads both the CSV and the XLSX export. Amounts are in the
+// account's currency.
+var exportColumns = []string{
+	"customer_id", "campaign_id", "campaign_name", "ad_group_id", "ad_group_name",
+	"keyword_id", "keyword_text", "optimization_type", "currency",
+	"current_bid", "recommended_bid", "bid_change_pct", "daily_spend_impact",
+	"reason", "rule", "guardrails", "expected_impact", "revenue", "orders", "roas", "quality_score",
+	"projected_clicks_per_day", "projected_cost_per_day", "projected_conversions_per_day",
+	"cohort", "approval_id", "approval_status",
+}
+
+// exportResults writes the recommendations in every configured format and
+// presigns a download link for each. A format that fails is logged and
+// left out, so the report still goes out with the others.
+func exportResults(ctx context.Context, client *s3.Client, run *runlog.Run, customerID string, results []BidOptimizationResult) []BidExport {
+	rows := make([][]xlsx.Cell, len(results))
+	for i, r := range results {
+		rows[i] = exportRow(r)
+	}
+
+	presigner := s3.NewPresignClient(client)
+	day := clk.Now().UTC().Format("2006-01-02")
+	var exports []BidExport
+	for _, format := range bidExportFormats {
+		body, contentType, err := encodeExport(format, rows)
+		if err != nil {
+			log.Printf("Failed to encode %s export for customer %s: %v", format, customerID, err)
+			continue
+		}
+
+		key := fmt.Sprintf("bid_exports/%s/%s/%s.%s", customerID, day, run.RunID, format)
+		filename := fmt.Sprintf("bid-recommendations-%s-%s.%s", customerID, day, format)
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:             aws.String(bidExportsBucket),
+			Key:                aws.String(key),
+			Body:               bytes.NewReader(body),
+			ContentType:        aws.String(contentType),
+			ContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", filename)),
+		})
+		if err != nil {
+			log.Printf("Failed to store %s export for customer %s: %v", format, customerID, err)
+			continue
+		}
+
+		presigned, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bidExportsBucket),
+			Key:    aws.String(key),
+		}, s3.WithPresignExpires(bidExportLinkTTL))
+		if err != nil {
+			log.Printf("Failed to presign %s export for customer %s: %v", format, customerID, err)
+			continue
+		}
+
+		exports = append(exports, BidExport{
+			Format:      format,
+			URI:         fmt.Sprintf("s3://%s/%s", bidExportsBucket, key),
+			DownloadURL: presigned.URL,
+			ExpiresAt:   clk.Now().UTC().Add(bidExportLinkTTL),
+			Rows:        len(rows),
+		})
+	}
+	emf.Count("BidExportsWritten", len(exports))
+	return exports
+}
+
+func encodeExport(format string, rows [][]xlsx.Cell) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case ExportCSV:
+		w := csv.NewWriter(&buf)
+		if err := w.Write(exportColumns); err != nil {
+			return nil, "", err
+		}
+		for _, row := range rows {
+			record := make([]string, len(row))
+			for i, cell := range row {
+				record[i] = cell.String()
+			}
+			if err := w.Write(record); err != nil {
+				return nil, "", err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "text/csv; charset=utf-8", nil
+	case ExportXLSX:
+		err := xlsx.Write(&buf, xlsx.Sheet{
+			Name:   "Bid recommendations",
+			Header: exportColumns,
+			Rows:   rows,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), xlsx.ContentType, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// exportRow is one recommendation in exportColumns order. IDs stay text so
+// spreadsheets don't round them; optional figures are blank when unset.
+func exportRow(r BidOptimizationResult) []xlsx.Cell {
+	blank := xlsx.Text("")
+	row := []xlsx.Cell{
+		xlsx.Text(r.CustomerID),
+		xlsx.Text(r.CampaignID),
+		xlsx.Text(r.CampaignName),
+		xlsx.Text(r.AdGroupID),
+		xlsx.Text(r.AdGroupName),
+		xlsx.Text(r.KeywordID),
+		xlsx.Text(r.KeywordText),
+		xlsx.Text(r.OptimizationType),
+		xlsx.Text(r.CurrentBid.Currency),
+		xlsx.Number(r.CurrentBid.Units()),
+		xlsx.Number(r.RecommendedBid.Units()),
+		blank,
+		xlsx.Number(r.Impact.Units()),
+		xlsx.Text(r.Reason),
+		xlsx.Text(r.Rule),
+		xlsx.Text(strings.Join(r.Guardrails, ",")),
+		xlsx.Text(r.ExpectedImpact),
+	}
+	if r.CurrentBid.AmountMicros > 0 {
+		row[11] = xlsx.Number(100 * float64(r.RecommendedBid.AmountMicros-r.CurrentBid.AmountMicros) / float64(r.CurrentBid.AmountMicros))
+	}
+
+	if r.Revenue != nil {
+		row = append(row, xlsx.Number(r.Revenue.Units()), xlsx.Int(int64(r.Orders)), xlsx.Number(r.ROAS))
+	} else {
+		row = append(row, blank, blank, blank)
+	}
+	if r.Quality != nil {
+		row = append(row, xlsx.Int(r.Quality.Score))
+	} else {
+		row = append(row, blank)
+	}
+	if r.Projection != nil {
+		row = append(row,
+			xlsx.Number(r.Projection.Projected.Clicks),
+			xlsx.Number(r.Projection.Projected.Cost.Units()),
+			xlsx.Number(r.Projection.Projected.Conversions))
+	} else {
+		row = append(row, blank, blank, blank)
+	}
+	return append(row, xlsx.Text(r.Cohort), xlsx.Text(r.ApprovalID), xlsx.Text(r.ApprovalStatus))
+}
+
+// parseExportFormats reads BID_EXPORT_FORMATS, defaulting to both formats
+// and dropping any it does not know.
+func parseExportFormats(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return []string{ExportCSV, ExportXLSX}
+	}
+	var formats []string
+	seen := make(map[string]bool)
+	for _, f := range strings.Split(value, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" || seen[f] {
+			continue
+		}
+		if f != ExportCSV && f != ExportXLSX {
+			log.Printf("Ignoring unknown bid export format %q", f)
+			continue
+		}
+		seen[f] = true
+		formats = append(formats, f)
+	}
+	return formats
+}
+
+func exportLinkTTL(hours int) time.Duration {
+	ttl := time.Duration(hours) * time.Hour
+	if ttl <= 0 || ttl > maxExportLinkTTL {
+		return maxExportLinkTTL
+	}
+	return ttl
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"pkg/envelope"
+	"pkg/runlog"
+)
+
+// failuresQueueURL receives a runlog.Failure for every run that finished
+// with failed accounts. It is also the function's on-failure destination,
+// so invocations that fail on every attempt land there too.
+var failuresQueueURL = os.Getenv("FAILURES_QUEUE_URL")
+
+// reportFailure queues the run's failure envelope, listing the processed,
+// failed and pending accounts and the event that resumes it.
+func reportFailure(ctx context.Context, run *runlog.Run) {
+	if failuresQueueURL == "" {
+		return
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		log.Printf("Failed to load AWS config to report run %s: %v", run.RunID, err)
+		return
+	}
+	body, err := envelope.New("bid-optimizer", nil, "", clk).Seal(ctx, envelope.Meta{
+		Type:          runlog.FailureMessageType,
+		SchemaVersion: runlog.FailureSchemaVersion,
+	}, runlog.NewFailure(run))
+	if err != nil {
+		log.Printf("Failed to seal failure of run %s: %v", run.RunID, err)
+		return
+	}
+	_, err = sqs.NewFromConfig(cfg).SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(failuresQueueURL),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		log.Printf("Failed to report failure of run %s: %v", run.RunID, err)
+		return
+	}
+	emf.Count("RunFailuresReported", 1)
+	log.Printf("Reported run %s with %d failed accounts to the failures queue", run.RunID, len(run.Failed))
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"pkg/envelope"
+	"pkg/runlog"
+)
+
+// Envelope type and schema version of the per-account work messages the
+// dispatcher queues for the worker function.
+const (
+	accountMessageType   = "bid_optimizer_account"
+	accountSchemaVersion = 1
+)
+
+// sendBatchSize is the most entries SQS takes in one SendMessageBatch.
+const sendBatchSize = 10
+
+var (
+	// accountQueueURL is the queue the scheduled run fans accounts out to.
+	// When unset, accounts are optimized in the scheduled invocation.
+	accountQueueURL = os.Getenv("ACCOUNT_QUEUE_URL")
+	// accountMaxReceives matches the queue's redrive maxReceiveCount: an
+	// account that fails its last receive goes to the dead-letter queue
+	// and is recorded as failed on the run.
+	accountMaxReceives = parseIntEnv("ACCOUNT_MAX_RECEIVE_COUNT", 3)
+)
+
+// accountMessage asks the worker to optimize one account for a run.
+type accountMessage struct {
+	RunID      string `json:"run_id"`
+	ConfigHash string `json:"config_hash"`
+	CustomerID string `json:"customer_id"`
+	Mode       string `json:"mode,omitempty"`
+}
+
+// dispatchRun queues one message per account in the rotation; a resumed
+// run queues only the accounts it has not processed. The run is then
+// finished by the workers, as each reports its account; accounts that
+// could not be queued are recorded as failed straight away.
+func dispatchRun(ctx context.Context, run *runlog.Run, recorder *runlog.Recorder) error {
+	customerIDs, err := runAccounts(ctx, recorder, run)
+	if err != nil {
+		finishRun(ctx, recorder, run, err)
+		return err
+	}
+
+	pending := run.Pending()
+	if skipped := len(customerIDs) - len(pending); skipped > 0 {
+		log.Printf("Skipped %d accounts already processed by run %s", skipped, run.RunID)
+		emf.Count("AccountsSkipped", skipped)
+	}
+	run.Accounts = len(customerIDs)
+	recordDispatch(ctx, recorder, run)
+	if len(pending) == 0 {
+		if run.AccountsDone > 0 {
+			// Every account was processed before; Dispatch only finishes
+			// runs without accounts.
+			finishRun(ctx, recorder, run, nil)
+		}
+		return nil
+	}
+
+	failed := enqueueAccounts(ctx, run, pending)
+	for customerID, err := range failed {
+		log.Printf("Failed to queue customer %s: %v", customerID, err)
+		finishAccount(ctx, recorder, run.RunID, customerID, 0, err)
+	}
+	emf.Count("AccountsDispatched", len(pending)-len(failed))
+	emf.Count("AccountsFailed", len(failed))
+	if len(failed) > 0 && len(failed) == len(pending) {
+		return fmt.Errorf("failed to queue all %d accounts", len(failed))
+	}
+
+	log.Printf("Queued %d of %d accounts for run %s", len(pending)-len(failed), len(pending), run.RunID)
+	return nil
+}
+
+// enqueueAccounts sends the account messages in batches and returns the
+// accounts that were not queued, with the reason.
+func enqueueAccounts(ctx context.Context, run *runlog.Run, customerIDs []string) map[string]error {
+	failed := make(map[string]error)
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		for _, customerID := range customerIDs {
+			failed[customerID] = fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		return failed
+	}
+	svc := sqs.NewFromConfig(cfg)
+	codec := envelope.New("bid-optimizer", nil, "", clk)
+
+	for start := 0; start < len(customerIDs); start += sendBatchSize {
+		end := start + sendBatchSize
+		if end > len(customerIDs) {
+			end = len(customerIDs)
+		}
+
+		// Entry IDs are the batch index, so failures map back to accounts.
+		batch := customerIDs[start:end]
+		entries := make([]sqstypes.SendMessageBatchRequestEntry, 0, len(batch))
+		for i, customerID := range batch {
+			body, err := codec.Seal(ctx, envelope.Meta{
+				Type:          accountMessageType,
+				SchemaVersion: accountSchemaVersion,
+				Tenant:        customerID,
+			}, accountMessage{
+				RunID:      run.RunID,
+				ConfigHash: run.ConfigHash,
+				CustomerID: customerID,
+				Mode:       run.Mode,
+			})
+			if err != nil {
+				failed[customerID] = fmt.Errorf("failed to seal message: %w", err)
+				continue
+			}
+			entries = append(entries, sqstypes.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(i)),
+				MessageBody: aws.String(body),
+			})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		out, err := svc.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(accountQueueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			for _, entry := range entries {
+				i, _ := strconv.Atoi(aws.ToString(entry.Id))
+				failed[batch[i]] = fmt.Errorf("failed to send message: %w", err)
+			}
+			continue
+		}
+		for _, entry := range out.Failed {
+			i, _ := strconv.Atoi(aws.ToString(entry.Id))
+			failed[batch[i]] = fmt.Errorf("failed to send message: %s: %s", aws.ToString(entry.Code), aws.ToString(entry.Message))
+		}
+	}
+	return failed
+}
+
+// HandleAccountMessages optimizes the accounts the dispatcher queued, one
+// per message. A failed account is reported back to SQS on its own so the
+// rest of the batch is not redelivered; once it has used up its receives
+// it moves to the dead-letter queue.
+func (o *Optimizer) HandleAccountMessages(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	defer flushMetrics()
+	var response events.SQSEventResponse
+
+	// Without a client nothing in the batch can succeed; failing the
+	// invocation has SQS redeliver all of it.
+	client, err := o.ads(ctx)
+	if err != nil {
+		return response, fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	codec := envelope.New("bid-optimizer", nil, "", clk)
+	recorder := newRecorder(ctx)
+	configHash := configSnapshot().Hash()
+	for _, record := range event.Records {
+		msg, err := decodeAccountMessage(ctx, codec, record.Body)
+		if err != nil {
+			// Redelivery would not make it readable.
+			log.Printf("Skipping malformed message %s: %v", record.MessageId, err)
+			continue
+		}
+		if msg.ConfigHash != configHash {
+			log.Printf("Run %s was dispatched with config %s, worker has %s", msg.RunID, msg.ConfigHash, configHash)
+		}
+
+		if accountProcessed(ctx, recorder, msg) {
+			// A duplicate delivery, or an account a resumed run already
+			// processed; it has been counted.
+			log.Printf("Skipping customer %s, already processed by run %s", msg.CustomerID, msg.RunID)
+			emf.Count("AccountsSkipped", 1)
+			continue
+		}
+
+		run := &runlog.Run{
+			Function:    "bid-optimizer",
+			RunID:       msg.RunID,
+			Environment: environment,
+			ConfigHash:  msg.ConfigHash,
+		}
+		results, err := o.optimizeAccount(ctx, client, run, msg.CustomerID, msg.Mode)
+		if err != nil {
+			log.Printf("Failed to optimize customer %s for run %s: %v", msg.CustomerID, msg.RunID, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: record.MessageId,
+			})
+			if !lastReceive(record) {
+				continue
+			}
+			emf.Count("AccountsFailed", 1)
+		}
+		finishAccount(ctx, recorder, msg.RunID, msg.CustomerID, results, err)
+	}
+	return response, nil
+}
+
+// accountProcessed reports whether the run has already recorded the
+// account as processed. When the run cannot be read the account is
+// optimized again.
+func accountProcessed(ctx context.Context, recorder *runlog.Recorder, msg accountMessage) bool {
+	if recorder == nil {
+		return false
+	}
+	run, err := recorder.Lookup(ctx, "bid-optimizer", msg.RunID)
+	if err != nil {
+		if !errors.Is(err, runlog.ErrNotFound) {
+			log.Printf("Failed to look up run %s: %v", msg.RunID, err)
+		}
+		return false
+	}
+	return run.Done(msg.CustomerID)
+}
+
+func decodeAccountMessage(ctx context.Context, codec *envelope.Codec, body string) (accountMessage, error) {
+	env, err := codec.Open(ctx, body)
+	if err != nil {
+		return accountMessage{}, err
+	}
+	if err := env.Expect(accountMessageType, accountSchemaVersion); err != nil {
+		return accountMessage{}, err
+	}
+	var msg accountMessage
+	if err := env.Decode(&msg); err != nil {
+		return accountMessage{}, err
+	}
+	if msg.RunID == "" || msg.CustomerID == "" {
+		return accountMessage{}, fmt.Errorf("run_id and customer_id are required")
+	}
+	return msg, nil
+}
+
+// lastReceive reports whether a failed record will not be delivered again.
+func lastReceive(record events.SQSMessage) bool {
+	received, err := strconv.Atoi(record.Attributes["ApproximateReceiveCount"])
+	return err == nil && received >= accountMaxReceives
+}
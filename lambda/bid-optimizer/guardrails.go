@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/bidaudit"
+	"pkg/dynamo"
+	"pkg/money"
+	"pkg/seasonality"
+)
+
+// Guardrail defaults, overridden per account by the ads-api bid_guardrails
+// settings section. Bids and spend are in ruleCurrency.
+var (
+	// guardrailMinBid and guardrailMaxBid bound every recommended bid.
+	guardrailMinBid = parseFloatEnv("BID_GUARDRAIL_MIN_BID", 0.10)
+	guardrailMaxBid = parseFloatEnv("BID_GUARDRAIL_MAX_BID", 50.0)
+	// guardrailMaxDailyChange is the furthest a keyword's bid may move in
+	// a day, as a fraction of its bid at the start of the day.
+	guardrailMaxDailyChange = parseFloatEnv("BID_GUARDRAIL_MAX_DAILY_CHANGE", 0.5)
+	// guardrailMaxChangesPerRun is how many bid changes one account's run
+	// recommends at most; the rest wait for the next run.
+	guardrailMaxChangesPerRun = parseIntEnv("BID_GUARDRAIL_MAX_CHANGES_PER_RUN", 200)
+	// guardrailMaxSpendImpact is how much estimated daily spend one
+	// account's bid increases may add in a run.
+	guardrailMaxSpendImpact = parseFloatEnv("BID_GUARDRAIL_MAX_DAILY_SPEND_IMPACT", 500.0)
+)
+
+// Guardrails, as listed on the recommendations they clamped.
+const (
+	GuardrailMinBid         = "MIN_BID"
+	GuardrailMaxBid         = "MAX_BID"
+	GuardrailMaxDailyChange = "MAX_DAILY_CHANGE"
+	GuardrailSpendImpact    = "MAX_DAILY_SPEND_IMPACT"
+)
+
+// bidGuardrails bound one account's bid changes, in its currency; see the
+// ads-api bid_guardrails settings section. Zero fields keep the defaults.
+type bidGuardrails struct {
+	MinBid              float64 `dynamodbav:"min_bid"`
+	MaxBid              float64 `dynamodbav:"max_bid"`
+	MaxDailyChange      float64 `dynamodbav:"max_daily_change"`
+	MaxChangesPerRun    int     `dynamodbav:"max_changes_per_run"`
+	MaxDailySpendImpact float64 `dynamodbav:"max_daily_spend_impact"`
+}
+
+// defaultGuardrails converts the guardrail defaults to an account's
+// currency.
+func defaultGuardrails(rate float64) bidGuardrails {
+	return bidGuardrails{
+		MinBid:              guardrailMinBid * rate,
+		MaxBid:              guardrailMaxBid * rate,
+		MaxDailyChange:      guardrailMaxDailyChange,
+		MaxChangesPerRun:    guardrailMaxChangesPerRun,
+		MaxDailySpendImpact: guardrailMaxSpendImpact * rate,
+	}
+}
+
+// merge overrides g with the account's settings.
+func (g bidGuardrails) merge(settings *bidGuardrails) bidGuardrails {
+	if settings == nil {
+		return g
+	}
+	if settings.MinBid > 0 {
+		g.MinBid = settings.MinBid
+	}
+	if settings.MaxBid > 0 {
+		g.MaxBid = settings.MaxBid
+	}
+	if settings.MaxDailyChange > 0 {
+		g.MaxDailyChange = settings.MaxDailyChange
+	}
+	if settings.MaxChangesPerRun > 0 {
+		g.MaxChangesPerRun = settings.MaxChangesPerRun
+	}
+	if settings.MaxDailySpendImpact > 0 {
+		g.MaxDailySpendImpact = settings.MaxDailySpendImpact
+	}
+	return g
+}
+
+// applyGuardrails clamps the account's keyword bid recommendations to its
+// guardrails and returns those still worth making. Each keyword's bid stays
+// between the minimum and maximum bid and within the daily change of its
+// bid at the start of the day, read from the bid audit log. Then, largest
+// spend impact first, at most the per-run number of changes are kept and
+// increases stop adding spend once they reach the account's cap. A clamped
+// recommendation lists the guardrails it hit and keeps the bid the rules
+// recommended; one clamped to no change, or clamped the other way, is
+// dropped.
+//
+// While a seasonality event runs, the max bid of the campaigns it covers
+// and the account's spend impact cap rise by its multipliers, and bid
+// decreases in those campaigns wait until it ends: the surge is planned,
+// not a sign the bids are too high.
+func applyGuardrails(ctx context.Context, rules *accountRules, customerID string, results []BidOptimizationResult, season *accountSeason) []BidOptimizationResult {
+	if len(results) == 0 {
+		return results
+	}
+	g := rules.guardrails
+	settings, err := loadBidGuardrails(ctx, customerID)
+	if err != nil {
+		log.Printf("Failed to load bid guardrails for customer %s, using the defaults: %v", customerID, err)
+	}
+	g = g.merge(settings)
+
+	// Without the log every keyword's day starts at its current bid.
+	dayStart, err := dayStartBids(ctx, customerID, rules.location)
+	if err != nil {
+		log.Printf("Failed to read today's bid changes for customer %s, limiting daily change from current bids: %v", customerID, err)
+	}
+
+	active := season.active()
+	kept := make([]BidOptimizationResult, 0, len(results))
+	var clamped, held int
+	for _, r := range results {
+		current, recommended := r.CurrentBid.Units(), r.RecommendedBid.Units()
+		seasonal := seasonality.Combine(active, r.CampaignID)
+		if len(seasonal.Events) > 0 {
+			if recommended < current {
+				held++
+				continue
+			}
+			r.Season = seasonal.Events
+		}
+		bid := recommended
+		var hit []string
+		if g.MaxDailyChange > 0 {
+			start, ok := dayStart[keywordKey(r.AdGroupID, r.KeywordID)]
+			if !ok {
+				start = current
+			}
+			low, high := start*(1-g.MaxDailyChange), start*(1+g.MaxDailyChange)
+			if bid < low || bid > high {
+				bid = math.Max(low, math.Min(high, bid))
+				hit = append(hit, GuardrailMaxDailyChange)
+			}
+		}
+		if maxBid := g.MaxBid * seasonal.Bid; maxBid > 0 && bid > maxBid {
+			bid = maxBid
+			hit = append(hit, GuardrailMaxBid)
+		}
+		if g.MinBid > 0 && bid < g.MinBid {
+			bid = g.MinBid
+			hit = append(hit, GuardrailMinBid)
+		}
+		if !clampTo(rules, &r, bid, hit) {
+			log.Printf("Customer %s: dropped %s for keyword %s, clamped by %v", customerID, r.OptimizationType, r.KeywordID, hit)
+			clamped++
+			continue
+		}
+		if len(hit) > 0 {
+			clamped++
+		}
+		kept = append(kept, r)
+	}
+	if held > 0 {
+		log.Printf("Customer %s: holding %d bid decreases until seasonality events end", customerID, held)
+	}
+	emf.Count("BidDecreasesHeldForSeason", held)
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Impact.AmountMicros > kept[j].Impact.AmountMicros
+	})
+	if g.MaxChangesPerRun > 0 && len(kept) > g.MaxChangesPerRun {
+		log.Printf("Customer %s: deferring %d bid changes past the limit of %d per run", customerID, len(kept)-g.MaxChangesPerRun, g.MaxChangesPerRun)
+		emf.Count("BidChangesDeferred", len(kept)-g.MaxChangesPerRun)
+		kept = kept[:g.MaxChangesPerRun]
+	}
+
+	if g.MaxDailySpendImpact > 0 {
+		spendCap := g.MaxDailySpendImpact * seasonality.Combine(active, "").Budget
+		remaining := spendCap
+		capped := kept[:0]
+		for _, r := range kept {
+			current, recommended := r.CurrentBid.Units(), r.RecommendedBid.Units()
+			impact := r.Impact.Units()
+			if recommended <= current || impact <= remaining {
+				if recommended > current {
+					remaining -= impact
+				}
+				capped = append(capped, r)
+				continue
+			}
+			// Impact is linear in the bid change, so scaling the change
+			// scales the added spend to what is left.
+			bid := current + (recommended-current)*remaining/impact
+			remaining = 0
+			if !clampTo(rules, &r, bid, append(r.Guardrails, GuardrailSpendImpact)) {
+				log.Printf("Customer %s: dropped %s for keyword %s, account spend impact cap of %s reached", customerID, r.OptimizationType, r.KeywordID, rules.amount(spendCap))
+				clamped++
+				continue
+			}
+			clamped++
+			capped = append(capped, r)
+		}
+		kept = capped
+	}
+
+	emf.Count("BidChangesClamped", clamped)
+	return kept
+}
+
+// clampTo moves r's recommendation to bid, recording the guardrails that
+// moved it, and reports whether it still changes the bid in the direction
+// the rules chose.
+func clampTo(rules *accountRules, r *BidOptimizationResult, bid float64, hit []string) bool {
+	if len(hit) == 0 {
+		return true
+	}
+	current, recommended := r.CurrentBid.Units(), r.RecommendedBid.Units()
+	clamped := rules.amount(bid)
+	if clamped.AmountMicros == r.CurrentBid.AmountMicros || (bid > current) != (recommended > current) {
+		return false
+	}
+	if r.UnclampedBid == nil {
+		unclamped := r.RecommendedBid
+		r.UnclampedBid = &unclamped
+	}
+	// The impact scales with the bid change; see bidImpact.
+	if change := math.Abs(recommended - current); change > 0 {
+		r.Impact = rules.amount(r.Impact.Units() * math.Abs(bid-current) / change)
+	}
+	r.RecommendedBid = clamped
+	r.Guardrails = hit
+	return true
+}
+
+// loadBidGuardrails reads the account's bid_guardrails settings, nil when
+// it has none.
+func loadBidGuardrails(ctx context.Context, customerID string) (*bidGuardrails, error) {
+	if accountConfigTable == "" {
+		return nil, nil
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	result, err := dynamodb.NewFromConfig(cfg).GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(accountConfigTable),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberS{Value: customerID},
+		},
+		ProjectionExpression: aws.String("bid_guardrails"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bid guardrails: %w", err)
+	}
+
+	var settings struct {
+		BidGuardrails *bidGuardrails `dynamodbav:"bid_guardrails"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bid guardrails: %w", err)
+	}
+	return settings.BidGuardrails, nil
+}
+
+// dayStartBids returns the bid each keyword changed today, in the account's
+// time zone loc, had before its first change, keyed by keywordKey.
+func dayStartBids(ctx context.Context, customerID string, loc *time.Location) (map[string]float64, error) {
+	if bidAuditTable == "" {
+		return nil, nil
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	audit := bidaudit.NewStore(dynamo.NewTable(dynamodb.NewFromConfig(cfg), bidAuditTable), clk)
+	now := clk.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	// The log's days are UTC ones, so the account's day can start on the
+	// UTC day before; changes from before its start are skipped below.
+	changes, err := audit.All(ctx, bidaudit.Filter{
+		CustomerID: customerID,
+		Type:       bidaudit.TypeKeywordBid,
+		From:       today,
+		To:         now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Changes come oldest first, so the first of each keyword holds the
+	// bid it started the day with.
+	bids := make(map[string]float64)
+	for _, c := range changes {
+		if c.AppliedAt.Before(today) {
+			continue
+		}
+		key := keywordKey(c.AdGroupID, c.KeywordID)
+		if _, ok := bids[key]; ok {
+			continue
+		}
+		var old money.Money
+		if err := json.Unmarshal(c.OldValue, &old); err != nil || old.AmountMicros <= 0 {
+			continue
+		}
+		bids[key] = old.Units()
+	}
+	return bids, nil
+}
+
+func keywordKey(adGroupID, keywordID string) string {
+	return adGroupID + "~" + keywordID
+}
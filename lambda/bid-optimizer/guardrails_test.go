@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/money"
+	"pkg/seasonality"
+)
+
+// bidChange is a keyword bid recommendation in campaign 2002, in dollars.
+func bidChange(keywordID string, current, recommended, impact float64) BidOptimizationResult {
+	return BidOptimizationResult{
+		CampaignID:       "2002",
+		AdGroupID:        "3001",
+		KeywordID:        keywordID,
+		CurrentBid:       money.FromUnits(current, money.USD),
+		RecommendedBid:   money.FromUnits(recommended, money.USD),
+		OptimizationType: "INCREASE_BID",
+		Impact:           money.FromUnits(impact, money.USD),
+	}
+}
+
+// blackFriday runs on 2026-11-28 in campaign 2002.
+func blackFriday(bid, budget float64) *accountSeason {
+	return &accountSeason{
+		events: []seasonality.Event{{
+			Name:             "Black Friday",
+			StartDate:        "2026-11-27",
+			EndDate:          "2026-11-30",
+			CampaignIDs:      []string{"2002"},
+			BidMultiplier:    bid,
+			BudgetMultiplier: budget,
+		}},
+		today: time.Date(2026, 11, 28, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestApplyGuardrails(t *testing.T) {
+	type kept struct {
+		keywordID  string
+		bid        float64
+		impact     float64
+		guardrails string
+		season     string
+	}
+	tests := []struct {
+		name       string
+		guardrails bidGuardrails
+		season     *accountSeason
+		results    []BidOptimizationResult
+		want       []kept
+	}{
+		{
+			name:       "keeps a change within the guardrails",
+			guardrails: bidGuardrails{MinBid: 0.1, MaxBid: 50, MaxDailyChange: 0.5},
+			results:    []BidOptimizationResult{bidChange("4001", 1, 1.2, 10)},
+			want:       []kept{{keywordID: "4001", bid: 1.2, impact: 10}},
+		},
+		{
+			name:       "clamps to the max bid",
+			guardrails: bidGuardrails{MaxBid: 2},
+			results:    []BidOptimizationResult{bidChange("4001", 1.5, 2.5, 10)},
+			want:       []kept{{keywordID: "4001", bid: 2, impact: 5, guardrails: GuardrailMaxBid}},
+		},
+		{
+			name:       "clamps to the min bid",
+			guardrails: bidGuardrails{MinBid: 0.5},
+			results:    []BidOptimizationResult{bidChange("4001", 1, 0.25, 15)},
+			want:       []kept{{keywordID: "4001", bid: 0.5, impact: 10, guardrails: GuardrailMinBid}},
+		},
+		{
+			name:       "limits the change from the bid the day started with",
+			guardrails: bidGuardrails{MaxDailyChange: 0.5},
+			results:    []BidOptimizationResult{bidChange("4001", 1, 2, 10)},
+			want:       []kept{{keywordID: "4001", bid: 1.5, impact: 5, guardrails: GuardrailMaxDailyChange}},
+		},
+		{
+			name:       "lists every guardrail that clamped",
+			guardrails: bidGuardrails{MaxBid: 1.2, MaxDailyChange: 0.5},
+			results:    []BidOptimizationResult{bidChange("4001", 1, 2, 10)},
+			want:       []kept{{keywordID: "4001", bid: 1.2, impact: 2, guardrails: GuardrailMaxDailyChange + "," + GuardrailMaxBid}},
+		},
+		{
+			name:       "drops a change clamped to no change",
+			guardrails: bidGuardrails{MaxBid: 1},
+			results:    []BidOptimizationResult{bidChange("4001", 1, 1.5, 10)},
+		},
+		{
+			name:       "drops a change clamped the other way",
+			guardrails: bidGuardrails{MaxBid: 1},
+			results:    []BidOptimizationResult{bidChange("4001", 1.2, 1.5, 10)},
+		},
+		{
+			name:       "keeps the largest impacts up to the per-run cap",
+			guardrails: bidGuardrails{MaxChangesPerRun: 2},
+			results: []BidOptimizationResult{
+				bidChange("4001", 1, 1.1, 5),
+				bidChange("4002", 1, 1.4, 20),
+				bidChange("4003", 1, 1.2, 10),
+			},
+			want: []kept{
+				{keywordID: "4002", bid: 1.4, impact: 20},
+				{keywordID: "4003", bid: 1.2, impact: 10},
+			},
+		},
+		{
+			name:       "scales the increase that reaches the spend impact cap",
+			guardrails: bidGuardrails{MaxDailySpendImpact: 30},
+			results: []BidOptimizationResult{
+				bidChange("4001", 1, 2, 20),
+				bidChange("4002", 1, 1.8, 16),
+				bidChange("4003", 2, 1, 40),
+			},
+			want: []kept{
+				{keywordID: "4003", bid: 1, impact: 40},
+				{keywordID: "4001", bid: 2, impact: 20},
+				{keywordID: "4002", bid: 1.5, impact: 10, guardrails: GuardrailSpendImpact},
+			},
+		},
+		{
+			name:       "drops increases past the spend impact cap",
+			guardrails: bidGuardrails{MaxDailySpendImpact: 20},
+			results: []BidOptimizationResult{
+				bidChange("4001", 1, 2, 20),
+				bidChange("4002", 1, 1.8, 16),
+			},
+			want: []kept{{keywordID: "4001", bid: 2, impact: 20}},
+		},
+		{
+			name:       "holds decreases during a seasonality event",
+			guardrails: bidGuardrails{MaxBid: 50},
+			season:     blackFriday(0, 0),
+			results: []BidOptimizationResult{
+				bidChange("4001", 1, 0.8, 4),
+				bidChange("4002", 1, 1.2, 4),
+			},
+			want: []kept{{keywordID: "4002", bid: 1.2, impact: 4, season: "Black Friday"}},
+		},
+		{
+			name:       "raises the max bid during a seasonality event",
+			guardrails: bidGuardrails{MaxBid: 2},
+			season:     blackFriday(1.5, 0),
+			results:    []BidOptimizationResult{bidChange("4001", 2, 3.5, 15)},
+			want:       []kept{{keywordID: "4001", bid: 3, impact: 10, guardrails: GuardrailMaxBid, season: "Black Friday"}},
+		},
+		{
+			name:       "raises the spend impact cap during a seasonality event",
+			guardrails: bidGuardrails{MaxDailySpendImpact: 20},
+			season:     blackFriday(0, 2),
+			results: []BidOptimizationResult{
+				bidChange("4001", 1, 2, 20),
+				bidChange("4002", 1, 1.8, 16),
+			},
+			want: []kept{
+				{keywordID: "4001", bid: 2, impact: 20, season: "Black Friday"},
+				{keywordID: "4002", bid: 1.8, impact: 16, season: "Black Friday"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := testRules(t)
+			rules.guardrails = tt.guardrails
+
+			got := applyGuardrails(context.Background(), rules, "1234567890", tt.results, tt.season)
+			if len(got) != len(tt.want) {
+				t.Fatalf("kept %d recommendations, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				r := got[i]
+				if r.KeywordID != want.keywordID {
+					t.Errorf("recommendation %d is for keyword %s, want %s", i, r.KeywordID, want.keywordID)
+					continue
+				}
+				if b := r.RecommendedBid.Units(); math.Abs(b-want.bid) > 1e-6 {
+					t.Errorf("keyword %s bid = %v, want %v", r.KeywordID, b, want.bid)
+				}
+				if impact := r.Impact.Units(); math.Abs(impact-want.impact) > 1e-6 {
+					t.Errorf("keyword %s impact = %v, want %v", r.KeywordID, impact, want.impact)
+				}
+				if g := strings.Join(r.Guardrails, ","); g != want.guardrails {
+					t.Errorf("keyword %s clamped by %q, want %q", r.KeywordID, g, want.guardrails)
+				}
+				if (r.UnclampedBid != nil) != (want.guardrails != "") {
+					t.Errorf("keyword %s unclamped bid = %v, want one only when clamped", r.KeywordID, r.UnclampedBid)
+				}
+				if s := strings.Join(r.Season, ","); s != want.season {
+					t.Errorf("keyword %s season = %q, want %q", r.KeywordID, s, want.season)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAccountRulesTimeZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeZone string
+		want     string
+	}{
+		{name: "reads the account's zone", timeZone: "America/New_York", want: "America/New_York"},
+		{name: "falls back to UTC for an unknown zone", timeZone: "Mars/Olympus_Mons", want: "UTC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRules(t)
+			client := newMockAdsClient(t, mockResponse{
+				Match: []string{"customer.currency_code", "customer.time_zone"},
+				Rows:  `[{"customer": {"currencyCode": "USD", "timeZone": "` + tt.timeZone + `"}}]`,
+			})
+			rules, err := loadAccountRules(context.Background(), client, "1234567890")
+			if err != nil {
+				t.Fatalf("loadAccountRules: %v", err)
+			}
+			if got := rules.location.String(); got != tt.want {
+				t.Errorf("location = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
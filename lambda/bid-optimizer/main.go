@@ -7,34 +7,107 @@ import (
 	"log"
 	"math"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"google.golang.org/api/googleads"
 	"google.golang.org/api/option"
+
+	"pkg/ads"
+	"pkg/clock"
+	"pkg/envelope"
+	"pkg/gaql"
+	gads "pkg/googleads"
+	_ "pkg/localdev"
+	"pkg/money"
+	"pkg/pool"
+	"pkg/runlog"
+	"pkg/warmup"
 )
 
 type BidOptimizationEvent struct {
 	Timestamp   time.Time `json:"timestamp"`
 	Environment string    `json:"environment"`
+
+	// Mode "budgets" only plans budget reallocations, "experiment_report"
+	// only reports on the running experiment and "self_check" only checks
+	// the function can reach its dependencies; anything else runs the bid,
+	// strategy and ad schedule optimizations.
+	Mode string `json:"mode,omitempty"`
+
+	// ResumeRun continues an earlier run, given its run ID or the request
+	// ID of the invocation that started it, optimizing only the accounts
+	// it had not processed. The run's own mode is used.
+	ResumeRun string `json:"resume_run,omitempty"`
+
+	// DryRun plans CustomerID alone, in Mode, and returns a DryRunReport
+	// without filing, applying or publishing anything.
+	DryRun     bool   `json:"dry_run,omitempty"`
+	CustomerID string `json:"customer_id,omitempty"`
 }
 
 type BidOptimizationResult struct {
-	CampaignID       string  `json:"campaign_id"`
-	CampaignName     string  `json:"campaign_name"`
-	AdGroupID        string  `json:"ad_group_id"`
-	AdGroupName      string  `json:"ad_group_name"`
-	KeywordID        string  `json:"keyword_id"`
-	KeywordText      string  `json:"keyword_text"`
-	CurrentBid       float64 `json:"current_bid"`
-	RecommendedBid   float64 `json:"recommended_bid"`
-	OptimizationType string  `json:"optimization_type"`
-	Reason           string  `json:"reason"`
-	ExpectedImpact   string  `json:"expected_impact"`
+	CustomerID       string      `json:"customer_id"`
+	CampaignID       string      `json:"campaign_id"`
+	CampaignName     string      `json:"campaign_name"`
+	AdGroupID        string      `json:"ad_group_id"`
+	AdGroupName      string      `json:"ad_group_name"`
+	KeywordID        string      `json:"keyword_id"`
+	KeywordText      string      `json:"keyword_text"`
+	CurrentBid       money.Money `json:"current_bid"`
+	RecommendedBid   money.Money `json:"recommended_bid"`
+	OptimizationType string      `json:"optimization_type"`
+	Reason           string      `json:"reason"`
+	ExpectedImpact   string      `json:"expected_impact"`
+
+	// Rule names the bid rule that decided a performance recommendation;
+	// see bid_rules.yaml.
+	Rule string `json:"rule,omitempty"`
+
+	// Guardrails lists the guardrails that clamped the recommendation,
+	// and UnclampedBid is the bid recommended before them; see
+	// applyGuardrails.
+	Guardrails   []string     `json:"guardrails,omitempty"`
+	UnclampedBid *money.Money `json:"unclamped_bid,omitempty"`
+	// Season names the running seasonality events that widened the
+	// guardrails for the keyword's campaign.
+	Season []string `json:"season,omitempty"`
+
+	// Set when the recommendation came from order revenue rather than CPA.
+	// Revenue is converted to the account's currency.
+	Revenue *money.Money `json:"revenue,omitempty"`
+	Orders  int          `json:"orders,omitempty"`
+	ROAS    float64      `json:"roas,omitempty"`
+
+	// Projection is the keyword's bid simulator read at the current and
+	// recommended bid, when Google Ads has simulated it.
+	Projection *BidProjection `json:"projection,omitempty"`
+
+	// Impact is the estimated change in daily spend; see bidImpact.
+	Impact money.Money `json:"impact"`
+
+	// Quality is the keyword's Quality Score and its components, when
+	// Google Ads has rated the keyword.
+	Quality *KeywordQuality `json:"quality,omitempty"`
+
+	// Cohort is the campaign's cohort while an experiment runs; control
+	// recommendations are reported but not applied.
+	Cohort string `json:"cohort,omitempty"`
+
+	// Set once the change is filed for approval. The links are only set
+	// while it is pending.
+	ApprovalID     string `json:"approval_id,omitempty"`
+	ApprovalStatus string `json:"approval_status,omitempty"`
+	ApproveURL     string `json:"approve_url,omitempty"`
+	RejectURL      string `json:"reject_url,omitempty"`
 }
 
 type GoogleAdsConfig struct {
@@ -44,63 +117,400 @@ type GoogleAdsConfig struct {
 	DeveloperToken string `json:"developer_token"`
 }
 
+// Keywords with performance data from the last 14 days
+var keywordPerformanceQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"ad_group.id",
+	"ad_group.name",
+	"ad_group_criterion.criterion_id",
+	"ad_group_criterion.keyword.text",
+	"ad_group_criterion.keyword.match_type",
+	"ad_group_criterion.effective_cpc_bid_micros",
+	"ad_group_criterion.quality_info.quality_score",
+	"ad_group_criterion.quality_info.search_predicted_ctr",
+	"ad_group_criterion.quality_info.creative_quality_score",
+	"ad_group_criterion.quality_info.post_click_quality_score",
+	"metrics.impressions",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+	"metrics.ctr",
+	"metrics.average_cpc",
+	"metrics.conversion_rate",
+	"metrics.cost_per_conversion",
+).From("keyword_view").
+	Where("ad_group_criterion.status", gaql.Equals, "ENABLED").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	During(gaql.Last14Days).
+	Where("metrics.impressions", gaql.GreaterThan, keywordMinImpressions).
+	MustBuild()
+
+// keywordMinImpressions is the impressions a keyword needs over the window
+// before its bid is optimized.
+const keywordMinImpressions = 50
+
+// Envelope type and schema version of the published summary; see
+// notify.KindBidReport.
+const (
+	reportMessageType   = "bid_report"
+	reportSchemaVersion = 2
+)
+
 var (
 	secretName  = os.Getenv("GOOGLE_ADS_SECRET_ARN")
 	snsTopicARN = os.Getenv("SNS_TOPIC_ARN")
 	environment = os.Getenv("ENVIRONMENT")
+
+	// clk is the time source for timestamps and pacing; deterministic when
+	// TEST_MODE=true.
+	clk = clock.FromEnv()
+
+	// emf collects the invocation's metrics for CloudWatch.
+	emf = gads.Metrics("bid-optimizer", environment, clk)
+
+	// adsCalls makes the Google Ads calls of all workers, paced together;
+	// see pool.GoogleAdsThrottleFromEnv and, for the retries,
+	// retry.GoogleAdsFromEnv.
+	adsCalls = gads.New(emf, pool.GoogleAdsThrottleFromEnv(clk))
+
+	// accountConcurrency is how many accounts are optimized at once, and
+	// queryConcurrency how many of an account's analyses query at once.
+	accountConcurrency = pool.LimitFromEnv("ACCOUNT_CONCURRENCY", 4)
+	queryConcurrency   = pool.LimitFromEnv("ACCOUNT_QUERY_CONCURRENCY", 4)
+
+	// The AWS config, Google Ads secret and client are set up during init
+	// and kept while the execution environment lives; the secret and the
+	// client are reloaded every warmup.RefreshFromEnv.
+	awsCfg          = warmup.New("aws_config", 0, loadAWSConfig)
+	googleAdsSecret = warmup.New("google_ads_secret", warmup.RefreshFromEnv(), loadGoogleAdsSecret)
+	adsClient       = warmup.New("google_ads_client", warmup.RefreshFromEnv(), createGoogleAdsClient)
 )
 
+func init() {
+	warmup.Prime(awsCfg, googleAdsSecret, adsClient)
+}
+
 func main() {
-	lambda.Start(HandleBidOptimization)
+	cfg, err := awsCfg.Get(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+	optimizer := NewOptimizer(adsClient.Get, sns.NewFromConfig(cfg))
+	lambda.Start(warmup.Handler(optimizer.HandleEvent))
 }
 
-func HandleBidOptimization(ctx context.Context, event interface{}) error {
-	log.Printf("Starting bid optimization for environment: %s", environment)
+// HandleEvent runs the scheduled optimization or, on the worker function,
+// the account messages it queued; see fanout.go. A dry run returns its
+// DryRunReport.
+func (o *Optimizer) HandleEvent(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	if err := loadBidRules(ctx); err != nil {
+		return nil, err
+	}
 
-	// Load Google Ads configuration
-	config, err := loadGoogleAdsConfig(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	var probe struct {
+		Records []json.RawMessage `json:"Records"`
+	}
+	if err := json.Unmarshal(raw, &probe); err == nil && len(probe.Records) > 0 {
+		var event events.SQSEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return events.SQSEventResponse{}, fmt.Errorf("failed to unmarshal SQS event: %w", err)
+		}
+		return o.HandleAccountMessages(ctx, event)
 	}
 
-	// Initialize Google Ads client
-	client, err := createGoogleAdsClient(config)
+	var event BidOptimizationEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	if event.DryRun {
+		return o.dryRun(ctx, event)
+	}
+	return nil, o.HandleBidOptimization(ctx, event)
+}
+
+// HandleBidOptimization starts a run over every account in the rotation.
+// With ACCOUNT_QUEUE_URL set the accounts are queued for the worker
+// function; otherwise they are optimized here one after another.
+func (o *Optimizer) HandleBidOptimization(ctx context.Context, event BidOptimizationEvent) (err error) {
+	if event.Mode == ModeSelfCheck {
+		return o.selfCheck(ctx)
+	}
+	defer flushMetrics()
+
+	if event.Mode == ModeExperimentReport {
+		return o.reportExperiment(ctx)
+	}
+
+	run, recorder := startRun(ctx, event.Mode, event.ResumeRun)
+	if run.Mode == ModeBudgets {
+		log.Printf("Starting budget reallocation for environment: %s (run %s, config %s)", environment, run.RunID, run.ConfigHash)
+	} else {
+		log.Printf("Starting bid optimization for environment: %s (run %s, config %s)", environment, run.RunID, run.ConfigHash)
+	}
+
+	if accountQueueURL != "" {
+		return dispatchRun(ctx, run, recorder)
+	}
+	defer func() { finishRun(ctx, recorder, run, err) }()
+
+	client, err := o.ads(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create Google Ads client: %w", err)
 	}
 
-	// Perform bid optimization
-	results, err := optimizeBids(ctx, client)
+	customerIDs, err := runAccounts(ctx, recorder, run)
 	if err != nil {
-		return fmt.Errorf("failed to optimize bids: %w", err)
+		return err
 	}
 
-	// Send optimization results if any
-	if len(results) > 0 {
-		if err := sendOptimizationResults(ctx, results); err != nil {
-			return fmt.Errorf("failed to send optimization results: %w", err)
+	// Accounts are optimized up to accountConcurrency at a time. Each
+	// account's report is published before the account is checkpointed,
+	// so a retried or resumed run skips it.
+	pending := run.Pending()
+	skipped := len(customerIDs) - len(pending)
+	var mu sync.Mutex
+	var failed int
+	pool.Each(ctx, accountConcurrency, pending, func(ctx context.Context, customerID string) error {
+		results, err := o.optimizeAccount(ctx, client, run, customerID, run.Mode)
+
+		mu.Lock()
+		defer mu.Unlock()
+		checkpoint(ctx, recorder, run, customerID, err)
+		if err != nil {
+			log.Printf("Failed to optimize customer %s: %v", customerID, err)
+			failed++
+			return nil
 		}
-		log.Printf("Sent %d bid optimization recommendations", len(results))
-	} else {
-		log.Println("No bid optimizations recommended")
+		run.Results += results
+		return nil
+	})
+	run.Accounts = len(customerIDs)
+	run.AccountsFailed = failed
+	emf.Count("AccountsFailed", failed)
+	emf.Count("AccountsSkipped", skipped)
+	if skipped > 0 {
+		log.Printf("Skipped %d accounts already processed by run %s", skipped, run.RunID)
+	}
+	if failed > 0 && failed == len(pending) {
+		return fmt.Errorf("failed to optimize bids for all %d accounts", failed)
 	}
 
 	log.Printf("Bid optimization completed successfully")
 	return nil
 }
 
-func loadGoogleAdsConfig(ctx context.Context) (*GoogleAdsConfig, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+// optimizeAccount runs one account's part of the run and publishes its
+// report, returning the number of recommendations made. In budgets mode
+// only budget reallocation is planned. While an experiment runs, changes
+// only reach treatment campaigns. Accounts on other ad platforms are
+// handed to optimizePlatformAccount.
+func (o *Optimizer) optimizeAccount(ctx context.Context, client AdsClient, run *runlog.Run, customerID, mode string) (int, error) {
+	if account := ads.ParseAccount(customerID); account.Platform != ads.Google {
+		return o.optimizePlatformAccount(ctx, run, account, mode)
+	}
+
+	plan, err := planAccount(ctx, client, customerID, mode)
+	if err != nil {
+		return 0, err
+	}
+
+	if mode == ModeBudgets {
+		syncSeasonalityAdjustments(ctx, client, plan.season)
+		if len(plan.reallocations) == 0 {
+			log.Printf("No budget reallocation recommended for customer %s", customerID)
+			return 0, nil
+		}
+		emf.Count("BudgetReallocations", len(plan.reallocations))
+		processBudgetReallocations(ctx, client, run, plan.reallocations)
+		if err := sendOptimizationResults(ctx, o.publisher, run, customerID, optimizationReport{reallocations: plan.reallocations}); err != nil {
+			return 0, fmt.Errorf("failed to send optimization results: %w", err)
+		}
+		return len(plan.reallocations), nil
+	}
+
+	results, schedules, products := plan.results, plan.schedules, plan.products
+	emf.Count("RecommendationsGenerated", len(results))
+	emf.Count("AdScheduleRecommendations", len(schedules))
+	emf.Count("ProductRecommendations", len(products.Recommendations))
+
+	if err := fileApprovals(ctx, run, plan.rules, customerID, results); err != nil {
+		return 0, fmt.Errorf("failed to file bid approvals: %w", err)
+	}
+
+	if len(schedules) > 0 {
+		processAdSchedules(ctx, client, run, schedules)
+	}
+
+	if len(results) == 0 && len(schedules) == 0 && len(products.Recommendations) == 0 {
+		log.Printf("No bid optimizations recommended for customer %s", customerID)
+		return 0, nil
+	}
+	if err := sendOptimizationResults(ctx, o.publisher, run, customerID, optimizationReport{
+		results:    results,
+		schedules:  schedules,
+		roas:       plan.roas,
+		strategies: plan.strategies,
+		products:   products,
+	}); err != nil {
+		return 0, fmt.Errorf("failed to send optimization results: %w", err)
+	}
+	log.Printf("Sent %d bid optimization and %d product recommendations for customer %s", len(results), len(products.Recommendations), customerID)
+	return len(results) + len(schedules) + len(products.Recommendations), nil
+}
+
+// accountPlan is what the analyses recommend for a Google Ads account,
+// before anything is filed, applied or published.
+type accountPlan struct {
+	rules  *accountRules
+	season *accountSeason
+
+	results       []BidOptimizationResult
+	schedules     []AdScheduleRecommendation
+	roas          []CampaignROAS
+	strategies    []StrategyProjection
+	reallocations []BudgetReallocationPlan
+	products      ProductAnalysis
+}
+
+// planAccount runs the account's analyses, only reading from Google Ads
+// and the tables. In budgets mode only budget reallocation is planned.
+// Control campaigns are already held out of the plan.
+func planAccount(ctx context.Context, client AdsClient, customerID, mode string) (*accountPlan, error) {
+	cohorts, err := loadCohorts(ctx, customerID)
+	if err != nil {
+		// Without assignments control campaigns could be changed.
+		return nil, err
+	}
+	rules, err := loadAccountRules(ctx, client, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	season, err := loadSeason(ctx, customerID)
+	if err != nil {
+		log.Printf("Failed to load seasonality events for customer %s, optimizing without them: %v", customerID, err)
+	}
+	plan := &accountPlan{rules: rules, season: season}
+
+	if mode == ModeBudgets {
+		reallocations, raising, err := seasonalBudgetPlans(ctx, client, rules, season, cohorts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan seasonal budgets: %w", err)
+		}
+		if raising {
+			log.Printf("Budget reallocation for customer %s waits for its seasonality event to end", customerID)
+		} else {
+			reallocation, err := recommendBudgetReallocation(ctx, client, rules, customerID, cohorts, season)
+			if err != nil {
+				return nil, fmt.Errorf("failed to plan budget reallocation: %w", err)
+			}
+			if reallocation != nil {
+				reallocations = append(reallocations, *reallocation)
+			}
+		}
+		plan.reallocations = reallocations
+		return plan, nil
+	}
+
+	revenue, err := loadOrderRevenue(ctx, customerID, rules.currency)
+	if err != nil {
+		log.Printf("Failed to load order revenue for customer %s, bidding on CPA only: %v", customerID, err)
+	}
+
+	// The analyses query independently, so they run side by side. Only
+	// the bid optimization is required for the report.
+	err = pool.Run(ctx, queryConcurrency,
+		func(ctx context.Context) error {
+			var err error
+			plan.results, err = optimizeBids(ctx, client, rules, customerID, revenue)
+			if err != nil {
+				return fmt.Errorf("failed to optimize bids: %w", err)
+			}
+			return nil
+		},
+		func(ctx context.Context) error {
+			if revenue == nil {
+				return nil
+			}
+			var err error
+			if plan.roas, err = campaignROAS(ctx, client, rules, customerID, revenue); err != nil {
+				log.Printf("Failed to compute campaign ROAS for customer %s: %v", customerID, err)
+			}
+			return nil
+		},
+		func(ctx context.Context) error {
+			var err error
+			if plan.strategies, err = projectStrategies(ctx, client, rules, customerID); err != nil {
+				log.Printf("Failed to project bidding strategies for customer %s: %v", customerID, err)
+			}
+			return nil
+		},
+		func(ctx context.Context) error {
+			var err error
+			if plan.schedules, err = optimizeAdSchedules(ctx, client, rules, customerID); err != nil {
+				log.Printf("Failed to optimize ad schedules for customer %s: %v", customerID, err)
+			}
+			return nil
+		},
+		func(ctx context.Context) error {
+			var err error
+			if plan.products, err = analyzeProducts(ctx, client, rules, customerID); err != nil {
+				log.Printf("Failed to analyze products for customer %s: %v", customerID, err)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	plan.results = applyGuardrails(ctx, rules, customerID, plan.results, season)
+	holdOutControl(ctx, cohorts, plan.results, plan.schedules, plan.products.Recommendations)
+	return plan, nil
+}
+
+// search runs a Google Ads query through adsCalls.
+func search(ctx context.Context, client AdsClient, req *googleads.SearchGoogleAdsRequest) (*googleads.SearchGoogleAdsResponse, error) {
+	return gads.Search(ctx, adsCalls, func(ctx context.Context) (*googleads.SearchGoogleAdsResponse, error) {
+		return client.Search(ctx, req)
+	}, func(resp *googleads.SearchGoogleAdsResponse) int { return len(resp.Results) })
+}
+
+// searchStream runs a query that can return too many rows to hold at once
+// through adsCalls; see gads.SearchStream.
+func searchStream(ctx context.Context, client AdsClient, req *googleads.SearchGoogleAdsStreamRequest, fn func(row *googleads.GoogleAdsRow) error) error {
+	return gads.SearchStream(ctx, adsCalls, func(ctx context.Context) (gads.Stream[*googleads.SearchGoogleAdsStreamResponse], error) {
+		return client.SearchStream(ctx, req)
+	}, func(resp *googleads.SearchGoogleAdsStreamResponse) []*googleads.GoogleAdsRow { return resp.Results }, fn)
+}
+
+func flushMetrics() {
+	if err := emf.Flush(); err != nil {
+		log.Printf("Failed to flush metrics: %v", err)
+	}
+}
+
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx)
+}
+
+// loadGoogleAdsSecret reads the Google Ads credentials from Secrets
+// Manager.
+func loadGoogleAdsSecret(ctx context.Context) (*GoogleAdsConfig, error) {
+	cfg, err := awsCfg.Get(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
+	return loadGoogleAdsConfig(ctx, secretsmanager.NewFromConfig(cfg))
+}
 
-	svc := secretsmanager.NewFromConfig(cfg)
+func loadGoogleAdsConfig(ctx context.Context, secrets SecretsProvider) (*GoogleAdsConfig, error) {
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId: aws.String(secretName),
 	}
 
-	result, err := svc.GetSecretValue(ctx, input)
+	result, err := secrets.GetSecretValue(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
 	}
@@ -114,160 +524,162 @@ func loadGoogleAdsConfig(ctx context.Context) (*GoogleAdsConfig, error) {
 }
 
 func createGoogleAdsConfig(config *GoogleAdsConfig) []option.ClientOption {
-	return []option.ClientOption{
+	opts := []option.ClientOption{
 		option.WithCredentialsFile(config),
 		option.WithScopes(googleads.GoogleAdsScope),
 	}
+	// GOOGLE_ADS_ENDPOINT points the client at a stand-in API such as the
+	// mock server run by cmd/e2e.
+	if endpoint := os.Getenv("GOOGLE_ADS_ENDPOINT"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	return opts
 }
 
-func createGoogleAdsClient(config *GoogleAdsConfig) (*googleads.Service, error) {
-	ctx := context.Background()
+func createGoogleAdsClient(ctx context.Context) (AdsClient, error) {
+	config, err := googleAdsSecret.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
 	opts := createGoogleAdsConfig(config)
 
-	srv, err := googleads.NewService(ctx, opts...)
+	// The client outlives this call, so it must not keep ctx.
+	srv, err := googleads.NewService(context.Background(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
 	}
 
-	return srv, nil
+	return googleAdsService{srv}, nil
 }
 
-func optimizeBids(ctx context.Context, client *googleads.Service) ([]BidOptimizationResult, error) {
+// optimizeBids recommends keyword bid changes. Keywords with enough order
+// revenue attributed to them are bid on ROAS; the rest, and every keyword
+// when revenue is nil, on CTR, conversion rate and CPA. Amounts are in the
+// account's currency.
+func optimizeBids(ctx context.Context, client AdsClient, rules *accountRules, customerID string, revenue *orderRevenue) ([]BidOptimizationResult, error) {
 	var results []BidOptimizationResult
 
-	// Get customer ID
-	customerID := os.Getenv("GOOGLE_ADS_CUSTOMER_ID")
-	if customerID == "" {
-		return nil, fmt.Errorf("GOOGLE_ADS_CUSTOMER_ID environment variable not set")
-	}
-
-	// Query keywords with performance data from last 14 days
-	query := fmt.Sprintf(`
-		SELECT 
-			campaign.id,
-			campaign.name,
-			ad_group.id,
-			ad_group.name,
-			ad_group_criterion.criterion_id,
-			ad_group_criterion.keyword.text,
-			ad_group_criterion.keyword.match_type,
-			metrics.impressions,
-			metrics.clicks,
-			metrics.cost_micros,
-			metrics.conversions,
-			metrics.ctr,
-			metrics.average_cpc,
-			metrics.conversion_rate,
-			metrics.cost_per_conversion
-		FROM keyword_view
-		WHERE 
-			ad_group_criterion.status = 'ENABLED'
-			AND campaign.status = 'ENABLED'
-			AND ad_group.status = 'ENABLED'
-			AND segments.date DURING LAST_14_DAYS
-			AND metrics.impressions > 50
-	`)
-
-	req := &googleads.SearchGoogleAdsRequest{
-		CustomerId: customerID,
-		Query:      query,
+	// Without simulators recommendations still go out, just unprojected.
+	simulations, err := loadCriterionSimulations(ctx, client, rules, customerID)
+	if err != nil {
+		log.Printf("Failed to load bid simulations for customer %s: %v", customerID, err)
 	}
 
-	resp, err := client.Search(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search keywords: %w", err)
+	req := &googleads.SearchGoogleAdsStreamRequest{
+		CustomerId: customerID,
+		Query:      keywordPerformanceQuery,
 	}
 
-	for _, row := range resp.Results {
+	// Keywords are streamed: only the recommendations are kept.
+	err = searchStream(ctx, client, req, func(row *googleads.GoogleAdsRow) error {
 		campaign := row.Campaign
 		adGroup := row.AdGroup
 		keyword := row.AdGroupCriterion.Keyword
 		metrics := row.Metrics
 
-		// Convert micros to dollars
-		cost := float64(metrics.CostMicros) / 1000000.0
-		cpc := float64(metrics.AverageCpc) / 1000000.0
-		costPerConversion := float64(metrics.CostPerConversion) / 1000000.0
+		// Keywords bid on automatically have no bid to move.
+		if row.AdGroupCriterion.EffectiveCpcBidMicros <= 0 {
+			return nil
+		}
 
-		// Get current bid (this would require additional API call to get criterion data)
-		currentBid := cpc // Simplified for example
+		// Convert micros to units of the account currency. The current bid
+		// is the keyword's max CPC, or its ad group's default.
+		cost := float64(metrics.CostMicros) / 1000000.0
+		currentBid := float64(row.AdGroupCriterion.EffectiveCpcBidMicros) / 1000000.0
 
-		// Calculate recommended bid based on performance
-		recommendedBid, optimizationType, reason := calculateRecommendedBid(
-			metrics, currentBid, cost, costPerConversion,
-		)
+		// Calculate recommended bid based on revenue, or performance when
+		// there is too little of it
+		var rev revenueTotal
+		if revenue != nil {
+			rev = revenue.keyword(fmt.Sprintf("%d", adGroup.Id), keyword.Text)
+		}
+		useROAS := revenue != nil && cost > 0 && hasROASEvidence(rules, cost, rev)
+
+		var recommendedBid float64
+		var optimizationType, reason, rule string
+		if useROAS {
+			recommendedBid, optimizationType, reason = calculateROASBid(rules, currentBid, cost, rev)
+		} else {
+			decision := calculateRecommendedBid(rules, keywordMetrics(rules, row), currentBid)
+			recommendedBid, optimizationType, reason, rule = decision.Bid, decision.Type, decision.Reason, decision.Rule
+		}
 
 		// Only recommend if the change is significant (>20% difference)
-		if math.Abs(recommendedBid-currentBid)/currentBid > 0.2 {
+		if math.Abs(recommendedBid-currentBid)/currentBid > minBidChange {
+			var projection *BidProjection
+			if curve, ok := simulations[criterionSimulationKey(adGroup.Id, row.AdGroupCriterion.CriterionId)]; ok {
+				projection = projectBid(rules, curve, currentBid, recommendedBid)
+				if !projection.worthwhile() {
+					log.Printf("Skipping %s for keyword %d: simulator shows no additional clicks", optimizationType, row.AdGroupCriterion.CriterionId)
+					return nil
+				}
+			}
+
 			result := BidOptimizationResult{
+				CustomerID:       customerID,
 				CampaignID:       fmt.Sprintf("%d", campaign.Id),
 				CampaignName:     campaign.Name,
 				AdGroupID:        fmt.Sprintf("%d", adGroup.Id),
 				AdGroupName:      adGroup.Name,
 				KeywordID:        fmt.Sprintf("%d", row.AdGroupCriterion.CriterionId),
 				KeywordText:      keyword.Text,
-				CurrentBid:       currentBid,
-				RecommendedBid:   recommendedBid,
+				CurrentBid:       rules.amount(currentBid),
+				RecommendedBid:   rules.amount(recommendedBid),
 				OptimizationType: optimizationType,
 				Reason:           reason,
-				ExpectedImpact:   calculateExpectedImpact(currentBid, recommendedBid, metrics),
+				Rule:             rule,
+				ExpectedImpact:   "No bid simulation available for this keyword",
+				Projection:       projection,
+				Impact:           rules.amount(bidImpact(currentBid, recommendedBid, metrics.Clicks)),
+			}
+			if projection != nil {
+				result.ExpectedImpact = projection.describe()
 			}
+			result.Quality = keywordQuality(row.AdGroupCriterion.QualityInfo)
+			if useROAS {
+				value := rules.amount(rev.Value)
+				result.Revenue = &value
+				result.Orders = rev.Orders
+				result.ROAS = rev.Value / cost
+			}
+			logRule(result)
 			results = append(results, result)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search keywords: %w", err)
 	}
 
 	return results, nil
 }
 
-func calculateRecommendedBid(metrics *googleads.Metrics, currentBid, cost, costPerConversion float64) (float64, string, string) {
-	ctr := metrics.Ctr
-	conversionRate := metrics.ConversionRate
-
-	// High performing keywords - increase bid
-	if ctr > 0.02 && conversionRate > 0.05 && costPerConversion < 50.0 {
-		newBid := currentBid * 1.25 // Increase by 25%
-		return newBid, "INCREASE_BID", fmt.Sprintf("High CTR (%.2f%%) and conversion rate (%.2f%%) with low cost per conversion ($%.2f)", ctr*100, conversionRate*100, costPerConversion)
-	}
-
-	// Low performing keywords - decrease bid
-	if ctr < 0.005 && metrics.Impressions > 1000 {
-		newBid := currentBid * 0.75 // Decrease by 25%
-		return newBid, "DECREASE_BID", fmt.Sprintf("Low CTR (%.2f%%) despite high impressions (%d)", ctr*100, metrics.Impressions)
-	}
-
-	// High cost per conversion - decrease bid
-	if costPerConversion > 100.0 && metrics.Conversions > 0 {
-		newBid := currentBid * 0.8 // Decrease by 20%
-		return newBid, "DECREASE_BID", fmt.Sprintf("High cost per conversion ($%.2f)", costPerConversion)
-	}
-
-	// Good performance with room for improvement - moderate increase
-	if ctr > 0.01 && conversionRate > 0.02 && costPerConversion < 75.0 {
-		newBid := currentBid * 1.15 // Increase by 15%
-		return newBid, "MODERATE_INCREASE", fmt.Sprintf("Good performance metrics with room for growth")
-	}
-
-	// No change recommended
-	return currentBid, "NO_CHANGE", "Performance metrics are within acceptable ranges"
-}
-
-func calculateExpectedImpact(currentBid, recommendedBid float64, metrics *googleads.Metrics) string {
-	changePercent := ((recommendedBid - currentBid) / currentBid) * 100
-
-	if changePercent > 0 {
-		return fmt.Sprintf("Estimated %.0f%% increase in clicks and conversions", changePercent*0.8)
-	} else {
-		return fmt.Sprintf("Estimated %.0f%% cost reduction with minimal impact on conversions", math.Abs(changePercent))
-	}
+// optimizationReport is what one account's report publishes; parts the
+// run did not plan are left empty.
+type optimizationReport struct {
+	results       []BidOptimizationResult
+	schedules     []AdScheduleRecommendation
+	roas          []CampaignROAS
+	strategies    []StrategyProjection
+	reallocations []BudgetReallocationPlan
+	products      ProductAnalysis
 }
 
-func sendOptimizationResults(ctx context.Context, results []BidOptimizationResult) error {
-	cfg, err := config.LoadDefaultConfig(ctx)
+// sendOptimizationResults publishes the account's report, with links to
+// spreadsheet exports of its bid recommendations.
+func sendOptimizationResults(ctx context.Context, publisher Publisher, run *runlog.Run, customerID string, report optimizationReport) error {
+	results, products := report.results, report.products
+	cfg, err := awsCfg.Get(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	svc := sns.NewFromConfig(cfg)
+	// Spreadsheet exports for reviewing the recommendations; the report
+	// goes out without them if they fail.
+	var exports []BidExport
+	if bidExportsBucket != "" && len(results) > 0 {
+		exports = exportResults(ctx, s3.NewFromConfig(cfg), run, customerID, results)
+	}
 
 	// Group results by optimization type for better organization
 	groupedResults := make(map[string][]BidOptimizationResult)
@@ -277,35 +689,64 @@ func sendOptimizationResults(ctx context.Context, results []BidOptimizationResul
 
 	// Send summary message
 	summary := map[string]interface{}{
-		"timestamp":             time.Now(),
+		"timestamp":             clk.Now(),
 		"environment":           environment,
+		"run_id":                run.RunID,
+		"customer_id":           customerID,
+		"config_hash":           run.ConfigHash,
 		"total_recommendations": len(results),
 		"optimization_summary": map[string]int{
 			"INCREASE_BID":      len(groupedResults["INCREASE_BID"]),
 			"DECREASE_BID":      len(groupedResults["DECREASE_BID"]),
 			"MODERATE_INCREASE": len(groupedResults["MODERATE_INCREASE"]),
 		},
-		"recommendations": results,
+		"recommendations":             results,
+		"ad_schedule_recommendations": report.schedules,
+		"campaign_roas":               report.roas,
+		"strategy_projections":        report.strategies,
+		"budget_reallocations":        report.reallocations,
+		"product_partitions":          products.Partitions,
+		"listing_group_exclusions":    products.Exclusions,
+		"product_recommendations":     products.Recommendations,
+		"exports":                     exports,
 	}
 
-	message, err := json.MarshalIndent(summary, "", "  ")
+	message, err := envelope.New("bid-optimizer", nil, "", clk).Seal(ctx, envelope.Meta{
+		Type:          reportMessageType,
+		SchemaVersion: reportSchemaVersion,
+		Tenant:        customerID,
+	}, summary)
 	if err != nil {
-		return fmt.Errorf("failed to marshal summary: %w", err)
+		return fmt.Errorf("failed to seal summary: %w", err)
 	}
 
-	subject := fmt.Sprintf("Google Ads Bid Optimization Report - %d Recommendations", len(results))
+	subject := fmt.Sprintf("%s Bid Optimization Report - %d Recommendations", ads.Title(ads.ParseAccount(customerID).Platform), len(results))
 
 	input := &sns.PublishInput{
-		Message:  aws.String(string(message)),
+		Message:  aws.String(message),
 		Subject:  aws.String(subject),
 		TopicArn: aws.String(snsTopicARN),
 	}
 
-	_, err = svc.Publish(ctx, input)
+	_, err = publisher.Publish(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to publish optimization results: %w", err)
 	}
 
-	log.Printf("Sent bid optimization summary with %d recommendations", len(results))
 	return nil
 }
+
+// Utility functions
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func parseIntEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+
+	"pkg/ads"
+	"pkg/retry"
+	"pkg/runlog"
+)
+
+// Accounts on Microsoft Advertising and Meta are optimized with the same
+// performance rules as Google Ads keywords, on the metrics their platform
+// reports. They have no bid simulators, order revenue or experiments, so
+// only the CPA rules apply, and budget reallocation is Google Ads only.
+// Their bid changes are filed for approval like any other and applied by
+// bid-applier.
+
+// platformsSecretName is the secret configuring the other platforms; see
+// ads.Config. When unset only Google Ads accounts are optimized.
+var platformsSecretName = os.Getenv("ADS_PLATFORMS_SECRET_ARN")
+
+var (
+	platformsMu      sync.Mutex
+	platformRegistry *ads.Registry
+)
+
+// platforms returns the configured ad platforms other than Google Ads,
+// loading them on first use. A failed load is tried again next time.
+func platforms(ctx context.Context) (*ads.Registry, error) {
+	platformsMu.Lock()
+	defer platformsMu.Unlock()
+	if platformRegistry != nil {
+		return platformRegistry, nil
+	}
+
+	var platformsConfig ads.Config
+	if platformsSecretName != "" {
+		cfg, err := awsCfg.Get(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(platformsSecretName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve platforms secret: %w", err)
+		}
+		if platformsConfig, err = ads.ParseConfig([]byte(aws.ToString(out.SecretString))); err != nil {
+			return nil, err
+		}
+	}
+	platformRegistry = ads.NewRegistry(platformsConfig, platformRetryPolicy())
+	return platformRegistry, nil
+}
+
+func platformRetryPolicy() retry.Policy {
+	p := ads.DefaultRetry()
+	p.OnRetry = func(attempt int, err error, delay time.Duration) {
+		log.Printf("Ad platform call failed (attempt %d/%d), retrying in %s: %v", attempt, p.MaxAttempts, delay, err)
+		emf.Count("PlatformRetries", 1)
+	}
+	return p
+}
+
+// optimizePlatformAccount is optimizeAccount for an account on another
+// platform: it recommends bid changes for the account's manually bid
+// targets, files them for approval and publishes the report.
+func (o *Optimizer) optimizePlatformAccount(ctx context.Context, run *runlog.Run, account ads.Account, mode string) (int, error) {
+	if mode == ModeBudgets {
+		log.Printf("Skipping %s: budget reallocation is only planned for Google Ads", account)
+		return 0, nil
+	}
+	results, rules, err := planPlatformAccount(ctx, account)
+	if err != nil || rules == nil {
+		return 0, err
+	}
+	emf.Count("RecommendationsGenerated", len(results))
+	if err := fileApprovals(ctx, run, rules, account.String(), results); err != nil {
+		return 0, fmt.Errorf("failed to file bid approvals: %w", err)
+	}
+	if len(results) == 0 {
+		log.Printf("No bid optimizations recommended for %s", account)
+		return 0, nil
+	}
+	if err := sendOptimizationResults(ctx, o.publisher, run, account.String(), optimizationReport{results: results}); err != nil {
+		return 0, fmt.Errorf("failed to send optimization results: %w", err)
+	}
+	log.Printf("Sent %d bid optimization recommendations for %s", len(results), account)
+	return len(results), nil
+}
+
+// planPlatformAccount recommends bids for an account on another ad
+// platform, only reading its metrics. The rules are nil when the account
+// had no activity to optimize.
+func planPlatformAccount(ctx context.Context, account ads.Account) ([]BidOptimizationResult, *accountRules, error) {
+	registry, err := platforms(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	platform, err := registry.Platform(account.Platform)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := platform.FetchMetrics(ctx, account.ID, ads.LevelBidTarget, ads.LastDays(clk.Now(), keywordImpactDays))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch %s metrics: %w", ads.Title(account.Platform), err)
+	}
+	if len(rows) == 0 {
+		log.Printf("No activity to optimize for %s", account)
+		return nil, nil, nil
+	}
+	rules, err := rulesIn(ctx, rows[0].Cost.Currency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	season, err := loadSeason(ctx, account.String())
+	if err != nil {
+		log.Printf("Failed to load seasonality events for %s, optimizing without them: %v", account, err)
+	}
+	return applyGuardrails(ctx, rules, account.String(), platformBids(rules, account, rows), season), rules, nil
+}
+
+// platformBids applies the performance rules to the bid targets with a
+// manual bid and enough impressions, as optimizeBids does for keywords
+// without order revenue.
+func platformBids(rules *accountRules, account ads.Account, rows []ads.Metrics) []BidOptimizationResult {
+	var results []BidOptimizationResult
+	for _, m := range rows {
+		// Targets the platform bids on automatically have no bid to move.
+		if m.CurrentBid.AmountMicros <= 0 || m.Impressions <= keywordMinImpressions {
+			continue
+		}
+		currentBid := m.CurrentBid.Units()
+		decision := calculateRecommendedBid(rules, m, currentBid)
+		recommendedBid := decision.Bid
+		if math.Abs(recommendedBid-currentBid)/currentBid <= minBidChange {
+			continue
+		}
+		result := BidOptimizationResult{
+			CustomerID:       account.String(),
+			CampaignID:       m.CampaignID,
+			CampaignName:     m.CampaignName,
+			AdGroupID:        m.AdGroupID,
+			AdGroupName:      m.AdGroupName,
+			KeywordID:        m.KeywordID,
+			KeywordText:      m.KeywordText,
+			CurrentBid:       rules.amount(currentBid),
+			RecommendedBid:   rules.amount(recommendedBid),
+			OptimizationType: decision.Type,
+			Reason:           decision.Reason,
+			Rule:             decision.Rule,
+			ExpectedImpact:   fmt.Sprintf("%s has no bid simulations", ads.Title(account.Platform)),
+			Impact:           rules.amount(bidImpact(currentBid, recommendedBid, m.Clicks)),
+		}
+		logRule(result)
+		results = append(results, result)
+	}
+	return results
+}
+
+// keywordMetrics is a keywordPerformanceQuery row as the shared rules read
+// it.
+func keywordMetrics(rules *accountRules, row *googleads.GoogleAdsRow) ads.Metrics {
+	return ads.Metrics{
+		CampaignID:   fmt.Sprintf("%d", row.Campaign.Id),
+		CampaignName: row.Campaign.Name,
+		AdGroupID:    fmt.Sprintf("%d", row.AdGroup.Id),
+		AdGroupName:  row.AdGroup.Name,
+		KeywordID:    fmt.Sprintf("%d", row.AdGroupCriterion.CriterionId),
+		KeywordText:  row.AdGroupCriterion.Keyword.Text,
+		Impressions:  row.Metrics.Impressions,
+		Clicks:       row.Metrics.Clicks,
+		Conversions:  float64(row.Metrics.Conversions),
+		Cost:         rules.micros(row.Metrics.CostMicros),
+		CurrentBid:   rules.micros(row.AdGroupCriterion.EffectiveCpcBidMicros),
+	}
+}
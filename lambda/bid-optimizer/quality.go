@@ -0,0 +1,29 @@
+package main
+
+import "google.golang.org/api/googleads"
+
+// KeywordQuality is a keyword's Quality Score, 1 to 10, and the three
+// components it is built from, each BELOW_AVERAGE, AVERAGE or
+// ABOVE_AVERAGE. Approvers weigh a bid increase differently when the
+// keyword's ads or landing page are what hold it back.
+type KeywordQuality struct {
+	Score                 int64  `json:"score"`
+	ExpectedCTR           string `json:"expected_ctr,omitempty"`
+	AdRelevance           string `json:"ad_relevance,omitempty"`
+	LandingPageExperience string `json:"landing_page_experience,omitempty"`
+}
+
+// keywordQuality returns nil for keywords without a Quality Score, which
+// Google Ads leaves unset until a keyword has had enough exact-match
+// searches.
+func keywordQuality(info *googleads.QualityInfo) *KeywordQuality {
+	if info == nil || info.QualityScore == 0 {
+		return nil
+	}
+	return &KeywordQuality{
+		Score:                 info.QualityScore,
+		ExpectedCTR:           info.SearchPredictedCtr.String(),
+		AdRelevance:           info.CreativeQualityScore.String(),
+		LandingPageExperience: info.PostClickQualityScore.String(),
+	}
+}
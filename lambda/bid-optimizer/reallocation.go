@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"google.golang.org/api/googleads"
+
+	"pkg/bidaudit"
+	"pkg/gaql"
+	"pkg/money"
+	"pkg/runlog"
+	"pkg/seasonality"
+)
+
+// Budget reallocation plan statuses.
+const (
+	ReallocationRecommended = "RECOMMENDED"
+	ReallocationApplied     = "APPLIED"
+	ReallocationApplyFailed = "APPLY_FAILED"
+)
+
+// ModeBudgets is the event mode of the daily budget reallocation run; see
+// BidOptimizationEvent. Budgets move at most once a day so each move has
+// a day of spend behind it before the next.
+const ModeBudgets = "budgets"
+
+var (
+	// accountConfigTable holds the budget_constraints settings section;
+	// when unset no campaign has constraints beyond the rules below.
+	accountConfigTable = os.Getenv("ACCOUNT_CONFIG_TABLE_NAME")
+	// applyReallocations mutates campaign budgets to the plan instead of
+	// only reporting it.
+	applyReallocations = os.Getenv("BUDGET_REALLOCATION_APPLY") == "true"
+)
+
+// Daily spend and conversion value of enabled campaigns with their own
+// daily budget. Shared budgets are left alone: moving one moves every
+// campaign on it.
+var budgetPerformanceQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign_budget.resource_name",
+	"campaign_budget.amount_micros",
+	"segments.date",
+	"metrics.cost_micros",
+	"metrics.conversions_value",
+	"metrics.search_budget_lost_impression_share",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("campaign_budget.period", gaql.Equals, "DAILY").
+	Where("campaign_budget.explicitly_shared", gaql.Equals, false).
+	During(gaql.Last30Days).
+	MustBuild()
+
+// BudgetChange is one campaign's part in a reallocation plan. Budgets and
+// costs are daily, in the account currency; ROAS is conversion value per
+// unit of spend as Google Ads reports it.
+type BudgetChange struct {
+	CampaignID        string      `json:"campaign_id"`
+	CampaignName      string      `json:"campaign_name"`
+	CurrentBudget     money.Money `json:"current_budget"`
+	RecommendedBudget money.Money `json:"recommended_budget"`
+	AvgDailyCost      money.Money `json:"avg_daily_cost"`
+	ROAS              float64     `json:"roas"`
+	// MarginalROAS is the value an extra unit of budget is expected to
+	// return at the current budget, and ProjectedMarginalROAS at the
+	// recommended one.
+	MarginalROAS          float64 `json:"marginal_roas"`
+	ProjectedMarginalROAS float64 `json:"projected_marginal_roas"`
+	Elasticity            float64 `json:"elasticity"`
+
+	budget string
+}
+
+// BudgetReallocationPlan moves budget between one account's campaigns
+// without changing the account's total daily budget, or, for a
+// seasonality event, raises the budgets for the event or restores them
+// after it.
+type BudgetReallocationPlan struct {
+	CustomerID  string `json:"customer_id"`
+	RunID       string `json:"run_id"`
+	ConfigHash  string `json:"config_hash"`
+	GeneratedAt string `json:"generated_at"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	// Moved is the daily budget taken from donors and given to recipients,
+	// and ExpectedValueChange the daily conversion value the move is
+	// projected to add.
+	Moved               money.Money    `json:"moved"`
+	ExpectedValueChange money.Money    `json:"expected_value_change"`
+	Changes             []BudgetChange `json:"changes"`
+	// Season names the seasonality event of a raise or restore; Moved is
+	// then the daily budget added or taken back.
+	Season string `json:"season,omitempty"`
+
+	season  *accountSeason
+	event   seasonality.Event
+	restore bool
+}
+
+// budgetConstraint bounds a campaign's daily budget, in the account
+// currency; see the ads-api budget_constraints settings section.
+type budgetConstraint struct {
+	MinDailyBudget float64 `dynamodbav:"min_daily_budget"`
+	MaxDailyBudget float64 `dynamodbav:"max_daily_budget"`
+	Locked         bool    `dynamodbav:"locked"`
+}
+
+// budgetCurve models a campaign's daily conversion value as a function of
+// its daily spend, value = scale * spend^elasticity, fitted to the
+// lookback's days. An elasticity below 1 is diminishing returns.
+type budgetCurve struct {
+	scale      float64
+	elasticity float64
+}
+
+func (c budgetCurve) value(spend float64) float64 {
+	if spend <= 0 {
+		return 0
+	}
+	return c.scale * math.Pow(spend, c.elasticity)
+}
+
+// marginal is the derivative of value at spend.
+func (c budgetCurve) marginal(spend float64) float64 {
+	if spend <= 0 {
+		return 0
+	}
+	return c.elasticity * c.scale * math.Pow(spend, c.elasticity-1)
+}
+
+// fitBudgetCurve fits the curve by least squares on log spend and log
+// value over the days with both. Campaigns whose spend barely varies,
+// typically those capped by their budget every day, give no slope to
+// fit and get reallocationDefaultElasticity.
+func fitBudgetCurve(days []campaignDay, avgCost, avgValue float64) budgetCurve {
+	var xs, ys []float64
+	for _, d := range days {
+		if d.cost > 0 && d.value > 0 {
+			xs = append(xs, math.Log(d.cost))
+			ys = append(ys, math.Log(d.value))
+		}
+	}
+
+	elasticity := reallocationDefaultElasticity
+	if len(xs) >= reallocationMinDays {
+		var meanX, meanY float64
+		for i := range xs {
+			meanX += xs[i]
+			meanY += ys[i]
+		}
+		meanX /= float64(len(xs))
+		meanY /= float64(len(ys))
+		var cov, variance float64
+		for i := range xs {
+			cov += (xs[i] - meanX) * (ys[i] - meanY)
+			variance += (xs[i] - meanX) * (xs[i] - meanX)
+		}
+		if variance/float64(len(xs)) >= reallocationMinLogVariance {
+			elasticity = math.Max(reallocationMinElasticity, math.Min(reallocationMaxElasticity, cov/variance))
+		}
+	}
+
+	// Anchor the curve at the campaign's average day.
+	if avgCost <= 0 || avgValue <= 0 {
+		return budgetCurve{elasticity: elasticity}
+	}
+	return budgetCurve{scale: avgValue / math.Pow(avgCost, elasticity), elasticity: elasticity}
+}
+
+// campaignDay is one campaign's spend and value on one day.
+type campaignDay struct {
+	cost  float64
+	value float64
+}
+
+// budgetCandidate is a campaign the plan may move budget to or from,
+// with the bounds its budget must stay within.
+type budgetCandidate struct {
+	change BudgetChange
+	curve  budgetCurve
+	// spendRatio is average daily spend over budget; spend is assumed to
+	// scale with the budget.
+	spendRatio float64
+	// current is the campaign's budget today and budget the one planned.
+	current  float64
+	budget   float64
+	min, max float64
+}
+
+func (c *budgetCandidate) marginal() float64 {
+	return c.curve.marginal(c.budget*c.spendRatio) * c.spendRatio
+}
+
+// recommendBudgetReallocation plans the account's budget moves, or
+// returns nil when no move is worth making. Experiment control campaigns
+// keep their budgets. Days within the account's seasonality events are
+// left out of the history, so a sale's spend and value don't skew the
+// curves.
+func recommendBudgetReallocation(ctx context.Context, client AdsClient, rules *accountRules, customerID string, cohorts *accountCohorts, season *accountSeason) (*BudgetReallocationPlan, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      budgetPerformanceQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search campaign budgets: %w", err)
+	}
+
+	constraints, err := loadBudgetConstraints(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	type campaignHistory struct {
+		row          *googleads.GoogleAdsRow
+		days         []campaignDay
+		lostToBudget float64
+	}
+	histories := make(map[int64]*campaignHistory)
+	var order []int64
+	for _, row := range resp.Results {
+		if season.during(row.Segments.Date) {
+			continue
+		}
+		h, ok := histories[row.Campaign.Id]
+		if !ok {
+			h = &campaignHistory{row: row}
+			histories[row.Campaign.Id] = h
+			order = append(order, row.Campaign.Id)
+		}
+		h.days = append(h.days, campaignDay{
+			cost:  float64(row.Metrics.CostMicros) / 1000000.0,
+			value: row.Metrics.ConversionsValue,
+		})
+		h.lostToBudget += row.Metrics.SearchBudgetLostImpressionShare
+	}
+
+	var candidates []*budgetCandidate
+	for _, id := range order {
+		h := histories[id]
+		budget := float64(h.row.CampaignBudget.AmountMicros) / 1000000.0
+		var spent int
+		var cost, value float64
+		for _, d := range h.days {
+			if d.cost > 0 {
+				spent++
+			}
+			cost += d.cost
+			value += d.value
+		}
+		if budget <= 0 || spent < reallocationMinDays {
+			continue
+		}
+		avgCost := cost / float64(len(h.days))
+		avgValue := value / float64(len(h.days))
+
+		c := &budgetCandidate{
+			curve:      fitBudgetCurve(h.days, avgCost, avgValue),
+			spendRatio: math.Min(avgCost/budget, 1),
+			current:    budget,
+			budget:     budget,
+		}
+		c.change = BudgetChange{
+			CampaignID:    fmt.Sprintf("%d", id),
+			CampaignName:  h.row.Campaign.Name,
+			CurrentBudget: rules.micros(h.row.CampaignBudget.AmountMicros),
+			AvgDailyCost:  rules.amount(avgCost),
+			Elasticity:    c.curve.elasticity,
+			budget:        h.row.CampaignBudget.ResourceName,
+		}
+		if cost > 0 {
+			c.change.ROAS = value / cost
+		}
+		c.change.MarginalROAS = c.marginal()
+
+		// A campaign only takes more budget if it spends what it has
+		// now; otherwise the extra would go unspent.
+		limited := c.spendRatio >= reallocationBudgetLimited ||
+			h.lostToBudget/float64(len(h.days)) >= reallocationMinLostToBudget
+		c.min = budget * (1 - reallocationMaxShift)
+		c.max = budget
+		if limited {
+			c.max = budget * (1 + reallocationMaxShift)
+		}
+		if !cohorts.treated(ctx, c.change.CampaignID) {
+			continue
+		}
+		if bound, ok := constraints[c.change.CampaignID]; ok {
+			if bound.Locked {
+				continue
+			}
+			if bound.MinDailyBudget > 0 {
+				c.min = math.Max(c.min, math.Min(bound.MinDailyBudget, budget))
+			}
+			if bound.MaxDailyBudget > 0 {
+				c.max = math.Min(c.max, math.Max(bound.MaxDailyBudget, budget))
+			}
+		}
+		candidates = append(candidates, c)
+	}
+	if len(candidates) < 2 {
+		return nil, nil
+	}
+
+	plan := planBudgetMoves(rules, candidates)
+	if plan == nil {
+		return nil, nil
+	}
+	plan.CustomerID = customerID
+	return plan, nil
+}
+
+// planBudgetMoves moves budget a step at a time from the campaign whose
+// next unit of budget returns least to the one whose next unit returns
+// most, re-reading both curves after every step, until no move gains
+// reallocationMinGain or every campaign is at a bound.
+func planBudgetMoves(rules *accountRules, candidates []*budgetCandidate) *BudgetReallocationPlan {
+	const epsilon = 0.005
+	for i := 0; i < reallocationMaxSteps; i++ {
+		var donor, recipient *budgetCandidate
+		for _, c := range candidates {
+			if c.budget > c.min+epsilon && (donor == nil || c.marginal() < donor.marginal()) {
+				donor = c
+			}
+			if c.budget < c.max-epsilon && (recipient == nil || c.marginal() > recipient.marginal()) {
+				recipient = c
+			}
+		}
+		if donor == nil || recipient == nil || donor == recipient {
+			break
+		}
+		if recipient.marginal() < donor.marginal()*reallocationMinGain || recipient.marginal() <= 0 {
+			break
+		}
+		step := math.Min(donor.current*reallocationStep, math.Min(donor.budget-donor.min, recipient.max-recipient.budget))
+		donor.budget -= step
+		recipient.budget += step
+	}
+
+	plan := &BudgetReallocationPlan{}
+	var moved, valueChange float64
+	for _, c := range candidates {
+		recommended := math.Round(c.budget*100) / 100
+		if math.Abs(recommended-c.current) < 0.01 {
+			continue
+		}
+		change := c.change
+		change.RecommendedBudget = rules.amount(recommended)
+		change.ProjectedMarginalROAS = c.marginal()
+		if recommended > c.current {
+			moved += recommended - c.current
+		}
+		valueChange += c.curve.value(c.budget*c.spendRatio) - c.curve.value(c.current*c.spendRatio)
+		plan.Changes = append(plan.Changes, change)
+	}
+	if len(plan.Changes) == 0 || valueChange <= 0 {
+		return nil
+	}
+	plan.Moved = rules.amount(moved)
+	plan.ExpectedValueChange = rules.amount(valueChange)
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		di := plan.Changes[i].RecommendedBudget.AmountMicros - plan.Changes[i].CurrentBudget.AmountMicros
+		dj := plan.Changes[j].RecommendedBudget.AmountMicros - plan.Changes[j].CurrentBudget.AmountMicros
+		return di > dj
+	})
+	return plan
+}
+
+// loadBudgetConstraints reads the account's budget_constraints settings,
+// keyed by campaign ID.
+func loadBudgetConstraints(ctx context.Context, customerID string) (map[string]budgetConstraint, error) {
+	if accountConfigTable == "" {
+		return nil, nil
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	result, err := dynamodb.NewFromConfig(cfg).GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(accountConfigTable),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberS{Value: customerID},
+		},
+		ProjectionExpression: aws.String("budget_constraints"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget constraints: %w", err)
+	}
+
+	var settings struct {
+		BudgetConstraints map[string]budgetConstraint `dynamodbav:"budget_constraints"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal budget constraints: %w", err)
+	}
+	return settings.BudgetConstraints, nil
+}
+
+// applyBudgetReallocation sets every budget in the plan in one request, so
+// the account's total never changes half way.
+func applyBudgetReallocation(ctx context.Context, client AdsClient, plan BudgetReallocationPlan) error {
+	ops := make([]*googleads.CampaignBudgetOperation, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		ops = append(ops, &googleads.CampaignBudgetOperation{
+			Update: &googleads.CampaignBudget{
+				ResourceName: change.budget,
+				AmountMicros: change.RecommendedBudget.AmountMicros,
+			},
+			UpdateMask: "amount_micros",
+		})
+	}
+	err := adsCalls.Call(ctx, func(ctx context.Context) error {
+		_, err := client.MutateCampaignBudgets(ctx, &googleads.MutateCampaignBudgetsRequest{
+			CustomerId: plan.CustomerID,
+			Operations: ops,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mutate campaign budgets for customer %s: %w", plan.CustomerID, err)
+	}
+	return nil
+}
+
+// processBudgetReallocations stamps the run's plans and applies them when
+// BUDGET_REALLOCATION_APPLY is set, recording applied changes in the bid
+// audit log. Failures are recorded on the plan: the bid report still goes
+// out.
+func processBudgetReallocations(ctx context.Context, client AdsClient, run *runlog.Run, plans []BudgetReallocationPlan) {
+	var applied int
+	var audited []bidaudit.Record
+	for i := range plans {
+		plan := &plans[i]
+		plan.RunID = run.RunID
+		plan.ConfigHash = run.ConfigHash
+		plan.GeneratedAt = clk.Now().UTC().Format(time.RFC3339)
+		plan.Status = ReallocationRecommended
+		if !applyReallocations {
+			continue
+		}
+		if plan.Season != "" && !plan.restore {
+			// A raise is recorded before it is applied: one applied but
+			// not recorded would be raised again by the next run. One
+			// recorded but not applied is restored to what it is.
+			if err := recordSeasonalBudgets(ctx, *plan); err != nil {
+				log.Printf("Failed to record seasonal budgets for %q: %v", plan.Season, err)
+				plan.Status = ReallocationApplyFailed
+				plan.Error = err.Error()
+				continue
+			}
+		}
+		if err := applyBudgetReallocation(ctx, client, *plan); err != nil {
+			log.Printf("Failed to apply budget reallocation: %v", err)
+			plan.Status = ReallocationApplyFailed
+			plan.Error = err.Error()
+			continue
+		}
+		plan.Status = ReallocationApplied
+		applied++
+		audited = append(audited, budgetAuditRecords(*plan)...)
+		if plan.Season == "" {
+			log.Printf("Reallocated %s/day of budget for customer %s: %s", plan.Moved, plan.CustomerID, plan.describe())
+			continue
+		}
+		log.Printf("Changed budgets by %s/day for %q in customer %s: %s", plan.Moved, plan.Season, plan.CustomerID, plan.describe())
+		if !plan.restore {
+			continue
+		}
+		if err := recordSeasonalBudgets(ctx, *plan); err != nil {
+			// The next run finds the budgets restored and records it.
+			log.Printf("Failed to record restored budgets for %q: %v", plan.Season, err)
+		}
+	}
+	emf.Count("BudgetReallocationsApplied", applied)
+	recordChanges(ctx, audited)
+}
+
+// describe lists the plan's budget changes, for logs.
+func (p BudgetReallocationPlan) describe() string {
+	parts := make([]string, 0, len(p.Changes))
+	for _, c := range p.Changes {
+		parts = append(parts, fmt.Sprintf("%s %.2f->%.2f", c.CampaignID, c.CurrentBudget.Units(), c.RecommendedBudget.Units()))
+	}
+	return strings.Join(parts, ", ")
+}
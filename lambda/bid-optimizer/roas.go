@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/money"
+	"pkg/tracking"
+)
+
+// orderRevenueTable is written by conversion-uploader from order events.
+// Without it the optimizer bids on CPA alone.
+var orderRevenueTable = os.Getenv("ORDER_REVENUE_TABLE_NAME")
+
+// revenueLookbackDays matches the LAST_14_DAYS window of the performance
+// queries, so cost and revenue cover the same days.
+const revenueLookbackDays = 14
+
+// Enabled campaigns' spend and platform-reported conversion value over the
+// revenue lookback.
+var campaignCostQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"metrics.cost_micros",
+	"metrics.conversions_value",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	During(gaql.Last14Days).
+	Where("metrics.cost_micros", gaql.GreaterThan, 0).
+	MustBuild()
+
+// CampaignROAS is one campaign's return on ad spend from order revenue,
+// next to what Google Ads reports from its own conversion tracking.
+// Revenue is converted to the account's currency.
+type CampaignROAS struct {
+	CustomerID   string      `json:"customer_id"`
+	CampaignID   string      `json:"campaign_id"`
+	CampaignName string      `json:"campaign_name"`
+	Cost         money.Money `json:"cost"`
+	Revenue      money.Money `json:"revenue"`
+	Orders       int         `json:"orders"`
+	ROAS         float64     `json:"roas"`
+	ReportedROAS float64     `json:"reported_roas"`
+	TargetROAS   float64     `json:"target_roas"`
+}
+
+// revenueTotal is the attributed revenue of a campaign or keyword, in the
+// account's currency.
+type revenueTotal struct {
+	Orders int
+	Value  float64
+}
+
+// orderRevenue is an account's order revenue over the lookback, attributed
+// by the UTM parameters the order carried.
+type orderRevenue struct {
+	campaigns map[string]revenueTotal
+	keywords  map[string]revenueTotal
+}
+
+type revenueRecord struct {
+	CampaignID string  `dynamodbav:"campaign_id"`
+	AdGroupID  string  `dynamodbav:"ad_group_id"`
+	Keyword    string  `dynamodbav:"keyword"`
+	Value      float64 `dynamodbav:"value"`
+	Currency   string  `dynamodbav:"currency"`
+}
+
+// keywordRevenueKey identifies a keyword the way orders attribute it: by
+// ad group and normalized text, since utm_term carries the text, not the
+// criterion ID.
+func keywordRevenueKey(adGroupID, keyword string) string {
+	return adGroupID + "|" + tracking.NormalizeKeyword(keyword)
+}
+
+// keyword returns the revenue attributed to a keyword.
+func (r *orderRevenue) keyword(adGroupID, keyword string) revenueTotal {
+	return r.keywords[keywordRevenueKey(adGroupID, keyword)]
+}
+
+// loadOrderRevenue sums customerID's order revenue over the lookback,
+// converted to currency. It returns nil when no revenue table is
+// configured. Orders are dated in UTC while Google Ads dates cost in the
+// account's time zone, so the window edges can differ by a few hours.
+func loadOrderRevenue(ctx context.Context, customerID, currency string) (*orderRevenue, error) {
+	if orderRevenueTable == "" {
+		return nil, nil
+	}
+
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	// LAST_14_DAYS ends yesterday. Order keys are "<date>#<order id>", and
+	// "~" sorts after "#", so the range takes in the whole last day.
+	today := clk.Now().UTC()
+	from := today.AddDate(0, 0, -revenueLookbackDays).Format("2006-01-02")
+	to := today.AddDate(0, 0, -1).Format("2006-01-02") + "~"
+
+	paginator := dynamodb.NewQueryPaginator(dynamodb.NewFromConfig(cfg), &dynamodb.QueryInput{
+		TableName:              aws.String(orderRevenueTable),
+		KeyConditionExpression: aws.String("customer_id = :customer AND order_key BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":customer": &types.AttributeValueMemberS{Value: customerID},
+			":from":     &types.AttributeValueMemberS{Value: from},
+			":to":       &types.AttributeValueMemberS{Value: to},
+		},
+		ProjectionExpression: aws.String("campaign_id, ad_group_id, keyword, #value, currency"),
+		ExpressionAttributeNames: map[string]string{
+			"#value": "value",
+		},
+	})
+
+	revenue := &orderRevenue{
+		campaigns: make(map[string]revenueTotal),
+		keywords:  make(map[string]revenueTotal),
+	}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query order revenue: %w", err)
+		}
+
+		var records []revenueRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &records); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal order revenue: %w", err)
+		}
+		for _, r := range records {
+			// Orders recorded without a currency were in the account's.
+			if r.Currency == "" {
+				r.Currency = currency
+			}
+			value, err := money.Convert(ctx, fxRates, money.FromUnits(r.Value, r.Currency), currency)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert order revenue: %w", err)
+			}
+			if r.CampaignID != "" {
+				revenue.campaigns[r.CampaignID] = revenue.campaigns[r.CampaignID].add(value.Units())
+			}
+			if r.AdGroupID != "" && r.Keyword != "" {
+				key := keywordRevenueKey(r.AdGroupID, r.Keyword)
+				revenue.keywords[key] = revenue.keywords[key].add(value.Units())
+			}
+		}
+	}
+	return revenue, nil
+}
+
+func (t revenueTotal) add(value float64) revenueTotal {
+	return revenueTotal{Orders: t.Orders + 1, Value: t.Value + value}
+}
+
+// hasROASEvidence reports whether a keyword has enough orders, or enough
+// spend without any, for its ROAS to be trusted over the CPA rules.
+func hasROASEvidence(rules *accountRules, cost float64, rev revenueTotal) bool {
+	if rev.Orders == 0 {
+		return cost >= rules.noRevenueMinCost
+	}
+	return rev.Orders >= roasMinOrders
+}
+
+// calculateROASBid recommends a bid from a keyword's true ROAS relative to
+// the target.
+func calculateROASBid(rules *accountRules, currentBid, cost float64, rev revenueTotal) (float64, string, string) {
+	roas := rev.Value / cost
+
+	if rev.Orders == 0 {
+		return currentBid * weakCTRBidDecrease, "DECREASE_BID", fmt.Sprintf("No order revenue from %s spend", rules.amount(cost))
+	}
+	if roas >= targetROAS*roasStrongMultiple {
+		return currentBid * strongBidIncrease, "INCREASE_BID", fmt.Sprintf("ROAS %.2f from %d orders is well above target %.2f", roas, rev.Orders, targetROAS)
+	}
+	if roas < targetROAS*roasPoorMultiple {
+		return currentBid * weakCTRBidDecrease, "DECREASE_BID", fmt.Sprintf("ROAS %.2f from %d orders is less than half of target %.2f", roas, rev.Orders, targetROAS)
+	}
+	if roas < targetROAS {
+		return currentBid * highCPABidDecrease, "DECREASE_BID", fmt.Sprintf("ROAS %.2f from %d orders is below target %.2f", roas, rev.Orders, targetROAS)
+	}
+	return currentBid, "NO_CHANGE", fmt.Sprintf("ROAS %.2f is on target %.2f", roas, targetROAS)
+}
+
+// campaignROAS joins each enabled campaign's spend with its order revenue.
+func campaignROAS(ctx context.Context, client AdsClient, rules *accountRules, customerID string, revenue *orderRevenue) ([]CampaignROAS, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      campaignCostQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search campaign cost: %w", err)
+	}
+
+	var results []CampaignROAS
+	for _, row := range resp.Results {
+		campaignID := fmt.Sprintf("%d", row.Campaign.Id)
+		cost := float64(row.Metrics.CostMicros) / 1000000.0
+		rev := revenue.campaigns[campaignID]
+		results = append(results, CampaignROAS{
+			CustomerID:   customerID,
+			CampaignID:   campaignID,
+			CampaignName: row.Campaign.Name,
+			Cost:         rules.micros(row.Metrics.CostMicros),
+			Revenue:      rules.amount(rev.Value),
+			Orders:       rev.Orders,
+			ROAS:         rev.Value / cost,
+			ReportedROAS: row.Metrics.ConversionsValue / cost,
+			TargetROAS:   targetROAS,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Cost.AmountMicros > results[j].Cost.AmountMicros })
+	return results, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"pkg/ads"
+	"pkg/bidrules"
+)
+
+// defaultBidRules is the performance rules document applied unless
+// BID_RULES_S3_URI names another.
+//
+//go:embed bid_rules.yaml
+var defaultBidRules []byte
+
+// bidRulesURI is an s3:// URI of a YAML or JSON rules document replacing
+// the built-in one. It is read on every invocation, so an uploaded change
+// applies from the next run.
+var bidRulesURI = os.Getenv("BID_RULES_S3_URI")
+
+// bidRules are the performance rules calculateRecommendedBid applies, set
+// by loadBidRules.
+var bidRules *bidrules.Ruleset
+
+// loadBidRules reads and validates the rules document. An invalid document
+// fails the invocation rather than optimizing with rules nobody wrote.
+func loadBidRules(ctx context.Context) error {
+	data, source := defaultBidRules, "bid_rules.yaml"
+	if bidRulesURI != "" {
+		var err error
+		if data, err = readS3URI(ctx, bidRulesURI); err != nil {
+			return fmt.Errorf("failed to read bid rules: %w", err)
+		}
+		source = bidRulesURI
+	}
+	rules, err := bidrules.Parse(data)
+	if err != nil {
+		return fmt.Errorf("bid rules in %s: %w", source, err)
+	}
+	bidRules = rules
+	log.Printf("Loaded %d bid rules from %s", rules.Rules(), source)
+	return nil
+}
+
+func readS3URI(ctx context.Context, uri string) ([]byte, error) {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+	if !strings.HasPrefix(uri, "s3://") || !ok || bucket == "" || key == "" {
+		return nil, fmt.Errorf("%q is not an s3://bucket/key URI", uri)
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	out, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// calculateRecommendedBid applies the performance rules, which every ad
+// platform shares.
+func calculateRecommendedBid(rules *accountRules, metrics ads.Metrics, currentBid float64) bidrules.Decision {
+	return rules.bid.Evaluate(metrics, currentBid, rules.currency, rules.rate)
+}
+
+// logRule records which rule decided a recommendation.
+func logRule(result BidOptimizationResult) {
+	if result.Rule == "" {
+		return
+	}
+	log.Printf("Customer %s: rule %s recommends %s for keyword %s (%s to %s)", result.CustomerID, result.Rule, result.OptimizationType, result.KeywordID, result.CurrentBid, result.RecommendedBid)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"pkg/ads"
+	"pkg/bidrules"
+	"pkg/money"
+	"pkg/runlog"
+)
+
+// testRules are the built-in bid rules in US dollars.
+func testRules(t *testing.T) *accountRules {
+	t.Helper()
+	parsed, err := bidrules.Parse(defaultBidRules)
+	if err != nil {
+		t.Fatalf("built-in bid rules: %v", err)
+	}
+	saved := bidRules
+	bidRules = parsed
+	t.Cleanup(func() { bidRules = saved })
+
+	rules, err := rulesIn(context.Background(), money.USD)
+	if err != nil {
+		t.Fatalf("rulesIn: %v", err)
+	}
+	return rules
+}
+
+func TestCalculateRecommendedBid(t *testing.T) {
+	rules := testRules(t)
+
+	tests := []struct {
+		name     string
+		metrics  ads.Metrics
+		wantType string
+		wantRule string
+		wantBid  float64
+	}{
+		{
+			name:     "strong performance",
+			metrics:  ads.Metrics{Impressions: 2000, Clicks: 100, Conversions: 8, Cost: money.FromUnits(150, money.USD)},
+			wantType: "INCREASE_BID",
+			wantRule: "strong-performance",
+			wantBid:  1.875,
+		},
+		{
+			name:     "low CTR",
+			metrics:  ads.Metrics{Impressions: 5000, Clicks: 10, Cost: money.FromUnits(15, money.USD)},
+			wantType: "DECREASE_BID",
+			wantRule: "low-ctr",
+			wantBid:  1.125,
+		},
+		{
+			name:     "high CPA",
+			metrics:  ads.Metrics{Impressions: 2000, Clicks: 100, Conversions: 1, Cost: money.FromUnits(150, money.USD)},
+			wantType: "DECREASE_BID",
+			wantRule: "high-cpa",
+			wantBid:  1.2,
+		},
+		{
+			name:     "good performance",
+			metrics:  ads.Metrics{Impressions: 2000, Clicks: 30, Conversions: 1, Cost: money.FromUnits(60, money.USD)},
+			wantType: "MODERATE_INCREASE",
+			wantRule: "good-performance",
+			wantBid:  1.725,
+		},
+		{
+			name:     "within range",
+			metrics:  ads.Metrics{Impressions: 500, Clicks: 5, Cost: money.FromUnits(7.5, money.USD)},
+			wantType: ads.NoChange,
+			wantBid:  1.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := calculateRecommendedBid(rules, tt.metrics, 1.5)
+			if d.Type != tt.wantType || d.Rule != tt.wantRule {
+				t.Errorf("decision = %s by %q, want %s by %q", d.Type, d.Rule, tt.wantType, tt.wantRule)
+			}
+			if math.Abs(d.Bid-tt.wantBid) > 1e-9 {
+				t.Errorf("bid = %v, want %v", d.Bid, tt.wantBid)
+			}
+		})
+	}
+}
+
+// keywordRows is the keyword_performance fixture of cmd/e2e: CTR 5%,
+// conversion rate 8% and CPA $18.75 at an average CPC of $1.50, on a max
+// CPC bid of $1.80.
+const keywordRows = `[{
+	"campaign": {"id": "2002", "name": "E2E Search - Brand"},
+	"adGroup": {"id": "3001", "name": "Running Shoes"},
+	"adGroupCriterion": {
+		"criterionId": "4001",
+		"keyword": {"text": "running shoes", "matchType": "PHRASE"},
+		"effectiveCpcBidMicros": "1800000"
+	},
+	"metrics": {
+		"impressions": "2000",
+		"clicks": "100",
+		"costMicros": "150000000",
+		"conversions": 8,
+		"ctr": 0.05,
+		"averageCpc": "1500000",
+		"conversionRate": 0.08,
+		"costPerConversion": "18750000"
+	}
+}]`
+
+func TestOptimizeBids(t *testing.T) {
+	rules := testRules(t)
+	client := newMockAdsClient(t, mockResponse{Match: []string{"FROM keyword_view"}, Rows: keywordRows})
+
+	results, err := optimizeBids(context.Background(), client, rules, "1234567890", nil)
+	if err != nil {
+		t.Fatalf("optimizeBids: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d recommendations, want 1", len(results))
+	}
+	r := results[0]
+	if r.OptimizationType != "INCREASE_BID" || r.Rule != "strong-performance" {
+		t.Errorf("recommendation = %s by %q, want INCREASE_BID by strong-performance", r.OptimizationType, r.Rule)
+	}
+	if r.CampaignID != "2002" || r.AdGroupID != "3001" || r.KeywordID != "4001" || r.KeywordText != "running shoes" {
+		t.Errorf("recommendation is for %s/%s/%s %q, want 2002/3001/4001 \"running shoes\"", r.CampaignID, r.AdGroupID, r.KeywordID, r.KeywordText)
+	}
+	if got := r.CurrentBid.Units(); got != 1.8 {
+		t.Errorf("current bid = %v, want the keyword's max CPC of 1.8", got)
+	}
+	if got := r.RecommendedBid.Units(); math.Abs(got-2.25) > 0.005 {
+		t.Errorf("recommended bid = %v, want 2.25", got)
+	}
+	if len(client.mutates) != 0 {
+		t.Errorf("optimizeBids changed %d things in Google Ads; it only recommends", len(client.mutates))
+	}
+}
+
+func TestOptimizeBidsSkipsSmallChanges(t *testing.T) {
+	rules := testRules(t)
+	// 1.5% CTR, 3.3% conversion rate, $60 CPA: good-performance's 15%
+	// raise is under minBidChange.
+	rows := strings.NewReplacer(
+		`"clicks": "100"`, `"clicks": "30"`,
+		`"costMicros": "150000000"`, `"costMicros": "60000000"`,
+		`"conversions": 8`, `"conversions": 1`,
+	).Replace(keywordRows)
+	client := newMockAdsClient(t, mockResponse{Match: []string{"FROM keyword_view"}, Rows: rows})
+
+	results, err := optimizeBids(context.Background(), client, rules, "1234567890", nil)
+	if err != nil {
+		t.Fatalf("optimizeBids: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got %d recommendations, want none for a change under %.0f%%", len(results), minBidChange*100)
+	}
+}
+
+func TestOptimizeBidsSkipsAutomatedBids(t *testing.T) {
+	rules := testRules(t)
+	rows := strings.Replace(keywordRows, `"effectiveCpcBidMicros": "1800000"`, `"effectiveCpcBidMicros": "0"`, 1)
+	client := newMockAdsClient(t, mockResponse{Match: []string{"FROM keyword_view"}, Rows: rows})
+
+	results, err := optimizeBids(context.Background(), client, rules, "1234567890", nil)
+	if err != nil {
+		t.Fatalf("optimizeBids: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got %d recommendations, want none for a keyword without a max CPC", len(results))
+	}
+}
+
+func TestOptimizeBidsStreamError(t *testing.T) {
+	rules := testRules(t)
+	broken := errors.New("stream reset")
+	client := &brokenStreamClient{
+		mockAdsClient: newMockAdsClient(t, mockResponse{Match: []string{"FROM keyword_view"}, Rows: keywordRows}),
+		err:           broken,
+	}
+
+	_, err := optimizeBids(context.Background(), client, rules, "1234567890", nil)
+	if !errors.Is(err, broken) {
+		t.Fatalf("optimizeBids = %v, want the stream's error", err)
+	}
+}
+
+// brokenStreamClient's keyword stream breaks after its rows, which is
+// never retried.
+type brokenStreamClient struct {
+	*mockAdsClient
+	err error
+}
+
+func (c *brokenStreamClient) SearchStream(ctx context.Context, req *StreamRequest) (SearchStream, error) {
+	stream, err := c.mockAdsClient.SearchStream(ctx, req)
+	if err == nil && strings.Contains(req.Query, "FROM keyword_view") {
+		stream.(*mockStream).err = c.err
+	}
+	return stream, err
+}
+
+func TestAccountCurrency(t *testing.T) {
+	client := newMockAdsClient(t, mockResponse{
+		Match: []string{"customer.currency_code"},
+		Rows:  `[{"customer": {"currencyCode": "EUR"}}]`,
+	})
+	currency, err := accountCurrency(context.Background(), client, "1234567890")
+	if err != nil {
+		t.Fatalf("accountCurrency: %v", err)
+	}
+	if currency != "EUR" {
+		t.Errorf("currency = %q, want EUR", currency)
+	}
+
+	if _, err := accountCurrency(context.Background(), newMockAdsClient(t), "1234567890"); err == nil {
+		t.Error("accountCurrency of an account without a currency succeeded")
+	}
+}
+
+func TestLoadGoogleAdsConfig(t *testing.T) {
+	secrets := &mockSecrets{value: `{"client_id": "id", "client_secret": "secret", "refresh_token": "refresh", "developer_token": "dev"}`}
+
+	config, err := loadGoogleAdsConfig(context.Background(), secrets)
+	if err != nil {
+		t.Fatalf("loadGoogleAdsConfig: %v", err)
+	}
+	if config.ClientID != "id" || config.RefreshToken != "refresh" || config.DeveloperToken != "dev" {
+		t.Errorf("config = %+v", config)
+	}
+	if len(secrets.requested) != 1 || secrets.requested[0] != secretName {
+		t.Errorf("read secrets %v, want [%s]", secrets.requested, secretName)
+	}
+
+	failing := &mockSecrets{err: errors.New("access denied")}
+	if _, err := loadGoogleAdsConfig(context.Background(), failing); err == nil {
+		t.Error("loadGoogleAdsConfig succeeded without the secret")
+	}
+}
+
+func TestSendOptimizationResults(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	rules := testRules(t)
+	run := &runlog.Run{RunID: "run-1"}
+	results := []BidOptimizationResult{{
+		CustomerID:       "1234567890",
+		KeywordID:        "4001",
+		CurrentBid:       rules.amount(1.5),
+		RecommendedBid:   rules.amount(1.875),
+		OptimizationType: "INCREASE_BID",
+	}}
+
+	publisher := &mockPublisher{}
+	err := sendOptimizationResults(context.Background(), publisher, run, "1234567890", optimizationReport{results: results})
+	if err != nil {
+		t.Fatalf("sendOptimizationResults: %v", err)
+	}
+	if len(publisher.published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(publisher.published))
+	}
+	msg := publisher.published[0]
+	if subject := *msg.Subject; !strings.HasSuffix(subject, "Bid Optimization Report - 1 Recommendations") {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(*msg.Message, `"run_id":"run-1"`) {
+		t.Errorf("message does not name the run: %s", *msg.Message)
+	}
+
+	failing := &mockPublisher{err: errors.New("topic not found")}
+	err = sendOptimizationResults(context.Background(), failing, run, "1234567890", optimizationReport{results: results})
+	if err == nil {
+		t.Error("sendOptimizationResults succeeded though publishing failed")
+	}
+}
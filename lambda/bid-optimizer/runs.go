@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/ids"
+	"pkg/money"
+	"pkg/runlog"
+)
+
+// ruleSetVersion names the bidding rules in calculateROASBid,
+// BidProjection.worthwhile, recommendAdSchedule,
+// recommendBudgetReallocation and recommendProduct, and how
+// calculateRecommendedBid applies the bid rules document. Bump it whenever
+// their logic changes; the document itself is recorded with each run.
+const ruleSetVersion = "bid-optimizer/11"
+
+// Bid steps applied by calculateROASBid and recommendProduct, the same as
+// the built-in bid rules document's. Costs are in ruleCurrency; see
+// loadAccountRules.
+const (
+	strongBidIncrease  = 1.25
+	weakCTRBidDecrease = 0.75
+	highCPABidDecrease = 0.8
+
+	// targetCPA is the cost per conversion TARGET_CPA strategy
+	// projections aim for.
+	targetCPA = 50.0
+
+	// minBidChange is the relative change below which a recommendation
+	// is not worth reporting.
+	minBidChange = 0.2
+)
+
+// Revenue rules applied by calculateROASBid. ROAS multiples are relative
+// to targetROAS; keywords with fewer orders fall back to the CPA rules.
+const (
+	roasStrongMultiple   = 1.25
+	roasPoorMultiple     = 0.5
+	roasMinOrders        = 3
+	roasNoRevenueMinCost = 50.0
+)
+
+// Product rules applied by recommendProduct. Items converting fewer times
+// keep their bid; bid changes reuse the ROAS multiples and bid steps above.
+const (
+	productMinClicks        = 30
+	productExclusionMinCost = 50.0
+	productMinConversions   = 3
+)
+
+// simulationMinClickGain is the relative click gain a bid increase must
+// show on the keyword's simulator to be recommended.
+const simulationMinClickGain = 0.02
+
+// targetROAS is order revenue per unit of spend the account aims for.
+var targetROAS = parseFloatEnv("TARGET_ROAS", 4.0)
+
+// Ad schedule rules applied by recommendAdSchedule. CPA multiples are
+// relative to the campaign's CPA over the window.
+const (
+	adScheduleMinConversions    = 30
+	adScheduleMinClicks         = 20
+	adSchedulePauseCostMultiple = 1.0
+	adScheduleUnprofitableCPA   = 2.0
+	adSchedulePauseMinWeeks     = 3
+	adScheduleMinModifier       = 0.7
+	adScheduleMaxModifier       = 1.3
+	adScheduleModifierStep      = 0.05
+	adScheduleMinModifierChange = 0.1
+)
+
+// Budget reallocation rules applied by recommendBudgetReallocation.
+// Shifts and steps are fractions of a campaign's current daily budget.
+const (
+	reallocationMinDays           = 14
+	reallocationMinLogVariance    = 0.01
+	reallocationDefaultElasticity = 0.6
+	reallocationMinElasticity     = 0.1
+	reallocationMaxElasticity     = 1.0
+	reallocationBudgetLimited     = 0.9
+	reallocationMinLostToBudget   = 0.1
+	reallocationMaxShift          = 0.2
+	reallocationStep              = 0.02
+	reallocationMaxSteps          = 1000
+	reallocationMinGain           = 1.25
+)
+
+var runsTable = os.Getenv("RUNS_TABLE_NAME")
+
+// configSnapshot is the configuration this run applies, recorded with the
+// run so its recommendations can be reproduced. It needs the bid rules
+// loaded. Static exchange rates are
+// recorded with the thresholds, since they move every non-dollar account's
+// rules.
+func configSnapshot() runlog.Snapshot {
+	snap := runlog.Snapshot{
+		RuleSetVersion: ruleSetVersion,
+		Thresholds: map[string]float64{
+			"strong_bid_increase":   strongBidIncrease,
+			"weak_ctr_bid_decrease": weakCTRBidDecrease,
+			"high_cpa_bid_decrease": highCPABidDecrease,
+			"min_bid_change":        minBidChange,
+
+			"roas_strong_multiple":      roasStrongMultiple,
+			"roas_poor_multiple":        roasPoorMultiple,
+			"roas_min_orders":           roasMinOrders,
+			"roas_no_revenue_min_cost":  roasNoRevenueMinCost,
+			"simulation_min_click_gain": simulationMinClickGain,
+
+			"ad_schedule_min_conversions":     adScheduleMinConversions,
+			"ad_schedule_min_clicks":          adScheduleMinClicks,
+			"ad_schedule_pause_cost_multiple": adSchedulePauseCostMultiple,
+			"ad_schedule_unprofitable_cpa":    adScheduleUnprofitableCPA,
+			"ad_schedule_pause_min_weeks":     adSchedulePauseMinWeeks,
+			"ad_schedule_min_modifier":        adScheduleMinModifier,
+			"ad_schedule_max_modifier":        adScheduleMaxModifier,
+			"ad_schedule_modifier_step":       adScheduleModifierStep,
+			"ad_schedule_min_modifier_change": adScheduleMinModifierChange,
+
+			"reallocation_min_days":           reallocationMinDays,
+			"reallocation_min_log_variance":   reallocationMinLogVariance,
+			"reallocation_default_elasticity": reallocationDefaultElasticity,
+			"reallocation_min_elasticity":     reallocationMinElasticity,
+			"reallocation_max_elasticity":     reallocationMaxElasticity,
+			"reallocation_budget_limited":     reallocationBudgetLimited,
+			"reallocation_min_lost_to_budget": reallocationMinLostToBudget,
+			"reallocation_max_shift":          reallocationMaxShift,
+			"reallocation_step":               reallocationStep,
+			"reallocation_min_gain":           reallocationMinGain,
+
+			"product_min_clicks":         productMinClicks,
+			"product_exclusion_min_cost": productExclusionMinCost,
+			"product_min_conversions":    productMinConversions,
+
+			"approval_min_impact":   approvalMinImpact,
+			"approval_window_hours": approvalWindow.Hours(),
+
+			"guardrail_min_bid":                guardrailMinBid,
+			"guardrail_max_bid":                guardrailMaxBid,
+			"guardrail_max_daily_change":       guardrailMaxDailyChange,
+			"guardrail_max_changes_per_run":    float64(guardrailMaxChangesPerRun),
+			"guardrail_max_daily_spend_impact": guardrailMaxSpendImpact,
+
+			"seasonality_lead_days": float64(seasonalityLeadDays),
+
+			"experiment_treatment_share": experimentTreatmentShare,
+		},
+		Goals: map[string]float64{
+			"target_cpa":  targetCPA,
+			"target_roas": targetROAS,
+		},
+		RuleDocuments: map[string]string{
+			"bid_rules": bidRules.JSON(),
+		},
+		FeatureFlags: map[string]bool{
+			"ad_schedule_apply":         applyAdSchedules,
+			"budget_reallocation_apply": applyReallocations,
+			"roas_bidding":              orderRevenueTable != "",
+			"product_catalog":           productsTable != "",
+			"approvals":                 approvalsTable != "",
+			"experiment":                experimentID != "" && experimentsTable != "",
+			"seasonality":               seasonalityTable != "",
+		},
+	}
+	if rates, ok := fxRates.(money.Static); ok {
+		for currency, rate := range rates {
+			snap.Thresholds["fx_"+strings.ToLower(currency)+"_per_usd"] = rate
+		}
+	}
+	return snap
+}
+
+// startRun records the start of this run, or resumes the run named by
+// resumeID. Without one, a run started by this invocation's Lambda request
+// ID is resumed: Lambda retries a failed asynchronous invocation under the
+// same ID. Recording is best effort: a run is always returned so the report
+// can carry its ID, but it is only stored when RUNS_TABLE_NAME is set and
+// the write succeeds.
+func startRun(ctx context.Context, mode, resumeID string) (*runlog.Run, *runlog.Recorder) {
+	snap := configSnapshot()
+	fallback := &runlog.Run{
+		Function:    "bid-optimizer",
+		RunID:       ids.FromEnv(clk).NewID(),
+		Environment: environment,
+		Config:      snap,
+		ConfigHash:  snap.Hash(),
+		Mode:        mode,
+	}
+	recorder := newRecorder(ctx)
+	if recorder == nil {
+		return fallback, nil
+	}
+
+	invocationID := ""
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		invocationID = lc.AwsRequestID
+	}
+	if run := resumeRun(ctx, recorder, resumeID, invocationID, snap); run != nil {
+		return run, recorder
+	}
+	if resumeID != "" {
+		// Without the run there is nothing to skip, so start over.
+		log.Printf("No run %s to resume, starting a new run", resumeID)
+	}
+
+	run, err := recorder.Start(ctx, "bid-optimizer", environment, snap, mode, invocationID)
+	if err != nil {
+		log.Printf("Failed to record run start: %v", err)
+		return fallback, nil
+	}
+	return run, recorder
+}
+
+// resumeRun looks up the run to continue and records the new attempt. It
+// returns nil when there is none.
+func resumeRun(ctx context.Context, recorder *runlog.Recorder, resumeID, invocationID string, snap runlog.Snapshot) *runlog.Run {
+	id := resumeID
+	if id == "" {
+		id = invocationID
+	}
+	if id == "" {
+		return nil
+	}
+	run, err := recorder.Lookup(ctx, "bid-optimizer", id)
+	if errors.Is(err, runlog.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to look up run %s to resume: %v", id, err)
+		return nil
+	}
+	if run.ConfigHash != snap.Hash() {
+		log.Printf("Run %s started with config %s, resuming with %s", run.RunID, run.ConfigHash, snap.Hash())
+	}
+	if err := recorder.Resume(ctx, run); err != nil {
+		log.Printf("Failed to record resumption of run %s: %v", run.RunID, err)
+		return nil
+	}
+	log.Printf("Resuming run %s (attempt %d): %d of %d accounts already processed", run.RunID, run.Attempts, len(run.Processed), len(run.CustomerIDs))
+	return run
+}
+
+// runAccounts returns the run's rotation. A resumed run keeps the rotation
+// it started with; a new one loads it and records it on the run.
+func runAccounts(ctx context.Context, recorder *runlog.Recorder, run *runlog.Run) ([]string, error) {
+	if len(run.CustomerIDs) > 0 {
+		return run.CustomerIDs, nil
+	}
+	customerIDs, err := loadCustomerIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+	if recorder == nil {
+		run.CustomerIDs = customerIDs
+		return customerIDs, nil
+	}
+	if err := recorder.Plan(ctx, run, customerIDs); err != nil {
+		log.Printf("Failed to record accounts of run %s: %v", run.RunID, err)
+	}
+	return customerIDs, nil
+}
+
+// checkpoint records an account's outcome on the run.
+func checkpoint(ctx context.Context, recorder *runlog.Recorder, run *runlog.Run, customerID string, accountErr error) {
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Checkpoint(ctx, run, customerID, accountErr); err != nil {
+		log.Printf("Failed to checkpoint run %s: %v", run.RunID, err)
+	}
+}
+
+// newRecorder returns the run recorder, or nil when runs are not recorded.
+func newRecorder(ctx context.Context) *runlog.Recorder {
+	if runsTable == "" {
+		return nil
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		log.Printf("Failed to load AWS config for run log: %v", err)
+		return nil
+	}
+	return runlog.NewRecorder(dynamodb.NewFromConfig(cfg), runsTable, clk, ids.FromEnv(clk))
+}
+
+// finishRun records the run's outcome. A run that finished with failed
+// accounts is reported to the failures queue; one that failed outright is
+// retried by Lambda, whose failure record reaches the same queue once the
+// retries are used up.
+func finishRun(ctx context.Context, recorder *runlog.Recorder, run *runlog.Run, runErr error) {
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Finish(ctx, run, runErr); err != nil {
+		log.Printf("Failed to record run %s: %v", run.RunID, err)
+	}
+	if run.Status == runlog.StatusPartial {
+		reportFailure(ctx, run)
+	}
+}
+
+// recordDispatch stores the number of accounts queued for the run; it must
+// be written before the first worker reports back.
+func recordDispatch(ctx context.Context, recorder *runlog.Recorder, run *runlog.Run) {
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Dispatch(ctx, run); err != nil {
+		log.Printf("Failed to record dispatch of run %s: %v", run.RunID, err)
+	}
+}
+
+// finishAccount records a dispatched account's final outcome. The worker
+// that finishes the run reports it to the failures queue when accounts
+// failed.
+func finishAccount(ctx context.Context, recorder *runlog.Recorder, runID, customerID string, results int, accountErr error) {
+	if recorder == nil {
+		return
+	}
+	run, err := recorder.FinishAccount(ctx, "bid-optimizer", runID, customerID, results, accountErr)
+	if err != nil {
+		log.Printf("Failed to record account of run %s: %v", runID, err)
+		return
+	}
+	if run != nil && run.Status == runlog.StatusPartial {
+		reportFailure(ctx, run)
+	}
+}
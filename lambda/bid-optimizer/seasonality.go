@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"google.golang.org/api/googleads"
+
+	"pkg/dynamo"
+	"pkg/gaql"
+	"pkg/seasonality"
+)
+
+var (
+	// seasonalityTable holds the seasonality calendar; when unset no
+	// account has events.
+	seasonalityTable = os.Getenv("SEASONALITY_TABLE_NAME")
+	// seasonalityLeadDays is how many days before an event its Google Ads
+	// seasonality adjustment is created. Adjustments are only created
+	// ahead of events, never for one already running.
+	seasonalityLeadDays = parseIntEnv("SEASONALITY_LEAD_DAYS", 7)
+)
+
+// Enabled campaigns with their own daily budget, as they are now.
+var campaignBudgetQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign_budget.resource_name",
+	"campaign_budget.amount_micros",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("campaign_budget.period", gaql.Equals, "DAILY").
+	Where("campaign_budget.explicitly_shared", gaql.Equals, false).
+	MustBuild()
+
+// accountSeason is the seasonality calendar of one account, read once per
+// run. A nil season has no events.
+type accountSeason struct {
+	customerID string
+	store      *seasonality.Store
+	events     []seasonality.Event
+	today      time.Time
+}
+
+// loadSeason reads the account's events and the global ones.
+func loadSeason(ctx context.Context, customerID string) (*accountSeason, error) {
+	if seasonalityTable == "" {
+		return nil, nil
+	}
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	store := seasonality.NewStore(dynamo.NewTable(dynamodb.NewFromConfig(cfg), seasonalityTable), clk)
+	events, err := store.ForAccount(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seasonality events: %w", err)
+	}
+	now := clk.Now().UTC()
+	return &accountSeason{
+		customerID: customerID,
+		store:      store,
+		events:     events,
+		today:      time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+// active returns the events running today.
+func (s *accountSeason) active() []seasonality.Event {
+	if s == nil {
+		return nil
+	}
+	return seasonality.Active(s.events, s.today)
+}
+
+// during reports whether date, YYYY-MM-DD, falls within one of the
+// account's events.
+func (s *accountSeason) during(date string) bool {
+	if s == nil {
+		return false
+	}
+	for _, e := range s.events {
+		if e.StartDate <= date && date <= e.EndDate {
+			return true
+		}
+	}
+	return false
+}
+
+// syncSeasonalityAdjustments creates a Google Ads seasonality adjustment
+// for each event with a conversion rate modifier that starts within
+// seasonalityLeadDays and has none in the account yet. Failures are
+// logged; the next daily run tries again while the event is ahead.
+func syncSeasonalityAdjustments(ctx context.Context, client AdsClient, s *accountSeason) {
+	if s == nil {
+		return
+	}
+	horizon := s.today.AddDate(0, 0, seasonalityLeadDays)
+	var created int
+	for _, e := range s.events {
+		start := e.Start()
+		if e.ConversionRateModifier == 0 || !start.After(s.today) || start.After(horizon) {
+			continue
+		}
+		state := e.Accounts[s.customerID]
+		if state.Adjustment != "" {
+			continue
+		}
+		name, err := createSeasonalityAdjustment(ctx, client, s.customerID, e)
+		if err != nil {
+			log.Printf("Failed to create seasonality adjustment for %q in customer %s: %v", e.Name, s.customerID, err)
+			continue
+		}
+		created++
+		state.Adjustment = name
+		if err := s.store.SetAccount(ctx, e.Scope, e.EventID, s.customerID, state); err != nil {
+			log.Printf("Failed to record seasonality adjustment %s for %q: %v", name, e.Name, err)
+		}
+		log.Printf("Customer %s: created seasonality adjustment %s for %q, %s to %s, conversion rate x%.2f",
+			s.customerID, name, e.Name, e.StartDate, e.EndDate, e.ConversionRateModifier)
+	}
+	emf.Count("SeasonalityAdjustmentsCreated", created)
+}
+
+// createSeasonalityAdjustment creates the event's adjustment over the
+// account, or over its campaigns when the event names some. Google Ads
+// reads the start and end in the account's time zone.
+func createSeasonalityAdjustment(ctx context.Context, client AdsClient, customerID string, e seasonality.Event) (string, error) {
+	adjustment := &googleads.BiddingSeasonalityAdjustment{
+		Name:                   e.Name,
+		Scope:                  "CUSTOMER",
+		StartDateTime:          e.StartDate + " 00:00:00",
+		EndDateTime:            e.EndDate + " 23:59:59",
+		ConversionRateModifier: e.ConversionRateModifier,
+	}
+	if len(e.CampaignIDs) > 0 {
+		adjustment.Scope = "CAMPAIGN"
+		for _, id := range e.CampaignIDs {
+			adjustment.Campaigns = append(adjustment.Campaigns, fmt.Sprintf("customers/%s/campaigns/%s", customerID, id))
+		}
+	}
+	var resp *googleads.MutateBiddingSeasonalityAdjustmentsResponse
+	err := adsCalls.Call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = client.MutateBiddingSeasonalityAdjustments(ctx, &googleads.MutateBiddingSeasonalityAdjustmentsRequest{
+			CustomerId: customerID,
+			Operations: []*googleads.BiddingSeasonalityAdjustmentOperation{{Create: adjustment}},
+		})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Results) == 0 {
+		return "", fmt.Errorf("creating seasonality adjustment returned no result")
+	}
+	return resp.Results[0].ResourceName, nil
+}
+
+// seasonalBudgetPlans raises budgets for a running event and restores
+// them once it is over. The running event with the largest budget
+// multiplier raises the budgets of the campaigns it covers, bounded by
+// their budget_constraints, unless an event raised them already; each
+// campaign goes back to its pre-event budget after the event that raised
+// it ends. Experiment control campaigns and locked ones are left alone.
+//
+// raising reports whether an event's raise is in force or planned, in
+// which case the account's budget reallocation waits until it is over.
+func seasonalBudgetPlans(ctx context.Context, client AdsClient, rules *accountRules, s *accountSeason, cohorts *accountCohorts) (plans []BudgetReallocationPlan, raising bool, err error) {
+	if s == nil {
+		return nil, false, nil
+	}
+	var raise *seasonality.Event
+	var restore []seasonality.Event
+	for i := range s.events {
+		e := &s.events[i]
+		state := e.Accounts[s.customerID]
+		switch {
+		case len(state.Budgets) > 0 && !state.Restored && e.End().Before(s.today):
+			restore = append(restore, *e)
+		case len(state.Budgets) > 0 && !state.Restored:
+			raising = true
+		case e.On(s.today) && seasonality.Multiplier(e.BudgetMultiplier) > 1:
+			if raise == nil || e.BudgetMultiplier > raise.BudgetMultiplier {
+				raise = e
+			}
+		}
+	}
+	if raising {
+		raise = nil
+	}
+	if raise == nil && len(restore) == 0 {
+		return nil, raising, nil
+	}
+
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: s.customerID,
+		Query:      campaignBudgetQuery,
+	})
+	if err != nil {
+		return nil, raising, fmt.Errorf("failed to search campaign budgets: %w", err)
+	}
+
+	// restored holds the budgets the restores set, which a raise the same
+	// day starts from.
+	restored := make(map[string]int64)
+	for _, e := range restore {
+		state := e.Accounts[s.customerID]
+		plan := BudgetReallocationPlan{CustomerID: s.customerID, Season: e.Name, season: s, event: e, restore: true}
+		var removed float64
+		for _, row := range resp.Results {
+			id := fmt.Sprintf("%d", row.Campaign.Id)
+			before, ok := state.Budgets[id]
+			if !ok || before == row.CampaignBudget.AmountMicros {
+				continue
+			}
+			plan.Changes = append(plan.Changes, seasonalChange(rules, row, row.CampaignBudget.AmountMicros, before))
+			removed += float64(row.CampaignBudget.AmountMicros-before) / 1000000.0
+			restored[id] = before
+		}
+		if len(plan.Changes) == 0 {
+			// Every budget is back already.
+			if err := recordSeasonalBudgets(ctx, plan); err != nil {
+				log.Printf("Failed to record restored budgets for %q: %v", e.Name, err)
+			}
+			continue
+		}
+		plan.Moved = rules.amount(math.Abs(removed))
+		plans = append(plans, plan)
+	}
+
+	if raise != nil {
+		constraints, err := loadBudgetConstraints(ctx, s.customerID)
+		if err != nil {
+			return nil, raising, err
+		}
+		plan := BudgetReallocationPlan{CustomerID: s.customerID, Season: raise.Name, season: s, event: *raise}
+		var added float64
+		for _, row := range resp.Results {
+			id := fmt.Sprintf("%d", row.Campaign.Id)
+			base := row.CampaignBudget.AmountMicros
+			if before, ok := restored[id]; ok {
+				base = before
+			}
+			current := float64(base) / 1000000.0
+			if current <= 0 || !raise.Covers(id) || !cohorts.treated(ctx, id) {
+				continue
+			}
+			budget := current * raise.BudgetMultiplier
+			if bound, ok := constraints[id]; ok {
+				if bound.Locked {
+					continue
+				}
+				if bound.MaxDailyBudget > 0 {
+					budget = math.Min(budget, math.Max(bound.MaxDailyBudget, current))
+				}
+			}
+			change := seasonalChange(rules, row, base, rules.amount(math.Round(budget*100)/100).AmountMicros)
+			if change.RecommendedBudget.AmountMicros <= base {
+				continue
+			}
+			added += change.RecommendedBudget.Units() - current
+			plan.Changes = append(plan.Changes, change)
+		}
+		if len(plan.Changes) > 0 {
+			plan.Moved = rules.amount(added)
+			plans = append(plans, plan)
+			raising = true
+		}
+	}
+
+	for i := range plans {
+		sort.Slice(plans[i].Changes, func(a, b int) bool {
+			return plans[i].Changes[a].CampaignID < plans[i].Changes[b].CampaignID
+		})
+	}
+	return plans, raising, nil
+}
+
+// seasonalChange moves a campaign's budget from one amount to another, in
+// micros.
+func seasonalChange(rules *accountRules, row *googleads.GoogleAdsRow, from, to int64) BudgetChange {
+	return BudgetChange{
+		CampaignID:        fmt.Sprintf("%d", row.Campaign.Id),
+		CampaignName:      row.Campaign.Name,
+		CurrentBudget:     rules.micros(from),
+		RecommendedBudget: rules.micros(to),
+		budget:            row.CampaignBudget.ResourceName,
+	}
+}
+
+// recordSeasonalBudgets records an applied seasonal plan on its event: the
+// budgets a raise replaced, so they can be restored, or that a restore is
+// done.
+func recordSeasonalBudgets(ctx context.Context, plan BudgetReallocationPlan) error {
+	state := plan.event.Accounts[plan.CustomerID]
+	if plan.restore {
+		state.Restored = true
+	} else {
+		state.Budgets = make(map[string]int64, len(plan.Changes))
+		for _, c := range plan.Changes {
+			state.Budgets[c.CampaignID] = c.CurrentBudget.AmountMicros
+		}
+	}
+	return plan.season.store.SetAccount(ctx, plan.event.Scope, plan.event.EventID, plan.CustomerID, state)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/health"
+)
+
+// ModeSelfCheck is the event mode that checks the function can reach its
+// dependencies instead of optimizing; see BidOptimizationEvent.
+const ModeSelfCheck = "self_check"
+
+// selfCheck reads the Google Ads credentials, bypassing the warm copy,
+// and describes the accounts and runs tables, logs the report and fails
+// the invocation if any of them could not be reached.
+func (o *Optimizer) selfCheck(ctx context.Context) error {
+	checks := []health.Check{{
+		Name:     "secretsmanager:google-ads-credentials",
+		Critical: true,
+		Run: func(ctx context.Context) error {
+			_, err := loadGoogleAdsSecret(ctx)
+			return err
+		},
+	}}
+	if accountsTable != "" || runsTable != "" {
+		cfg, err := awsCfg.Get(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		db := dynamodb.NewFromConfig(cfg)
+		if accountsTable != "" {
+			checks = append(checks, health.Table(db, accountsTable, true))
+		}
+		if runsTable != "" {
+			checks = append(checks, health.Table(db, runsTable, false))
+		}
+	}
+
+	report := health.NewChecker("bid-optimizer", clk, checks...).Run(ctx)
+	out, _ := json.Marshal(report)
+	log.Printf("Self-check: %s", out)
+	return report.Err()
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"google.golang.org/api/googleads"
+
+	"pkg/dynamo"
+	"pkg/gaql"
+	"pkg/money"
+)
+
+// Product recommendation actions. Bid changes are only recommended for
+// Shopping items with their own listing group, since Performance Max sets
+// its own bids.
+const (
+	ProductExclude     = "EXCLUDE_PRODUCT"
+	ProductIncreaseBid = "INCREASE_BID"
+	ProductDecreaseBid = "DECREASE_BID"
+)
+
+// productsTable is product-service's catalogue. Merchant Center item IDs
+// are the catalogue's product IDs, so advertised items missing from it can
+// no longer be bought. When unset products are analyzed without catalogue
+// details.
+var productsTable = os.Getenv("PRODUCTS_TABLE_NAME")
+
+// Item-level performance of enabled Shopping and Performance Max
+// campaigns. Shopping rows carry their ad group; Performance Max rows have
+// none.
+var productPerformanceQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.advertising_channel_type",
+	"ad_group.id",
+	"segments.product_item_id",
+	"segments.product_title",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+	"metrics.conversions_value",
+).From("shopping_performance_view").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("campaign.advertising_channel_type", gaql.In, []string{"SHOPPING", "PERFORMANCE_MAX"}).
+	During(gaql.Last30Days).
+	Where("metrics.clicks", gaql.GreaterThan, 0).
+	MustBuild()
+
+// Performance of Shopping ad groups' listing group partitions.
+var shoppingPartitionQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"ad_group.id",
+	"ad_group_criterion.criterion_id",
+	"ad_group_criterion.listing_group.type",
+	"ad_group_criterion.listing_group.case_value.product_item_id.value",
+	"ad_group_criterion.cpc_bid_micros",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+	"metrics.conversions_value",
+).From("product_group_view").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	During(gaql.Last30Days).
+	MustBuild()
+
+// Performance of Performance Max asset groups' listing group filters.
+var assetGroupPartitionQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"asset_group.id",
+	"asset_group.name",
+	"asset_group_listing_group_filter.id",
+	"asset_group_listing_group_filter.type",
+	"asset_group_listing_group_filter.case_value.product_item_id.value",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+	"metrics.conversions_value",
+).From("asset_group_product_group_view").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("asset_group.status", gaql.Equals, "ENABLED").
+	During(gaql.Last30Days).
+	MustBuild()
+
+// Items already excluded from Shopping ad groups. Excluded partitions get
+// no traffic, so they are read from the criteria rather than the views.
+var shoppingExclusionQuery = gaql.Select(
+	"campaign.id",
+	"ad_group.id",
+	"ad_group_criterion.listing_group.case_value.product_item_id.value",
+).From("ad_group_criterion").
+	Where("ad_group_criterion.type", gaql.Equals, "LISTING_GROUP").
+	Where("ad_group_criterion.listing_group.type", gaql.Equals, "UNIT").
+	Where("ad_group_criterion.negative", gaql.Equals, true).
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// Items already excluded from Performance Max asset groups.
+var assetGroupExclusionQuery = gaql.Select(
+	"campaign.id",
+	"asset_group.id",
+	"asset_group_listing_group_filter.case_value.product_item_id.value",
+).From("asset_group_listing_group_filter").
+	Where("asset_group_listing_group_filter.type", gaql.Equals, "UNIT_EXCLUDED").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// ProductPartition is one listing group's performance over the last 30
+// days: a partition of a Shopping ad group, with its bid, or a listing
+// group filter of a Performance Max asset group. ItemID is empty for
+// partitions that are not a single item, such as "everything else".
+type ProductPartition struct {
+	CampaignID       string       `json:"campaign_id"`
+	CampaignName     string       `json:"campaign_name"`
+	AdGroupID        string       `json:"ad_group_id,omitempty"`
+	AssetGroupID     string       `json:"asset_group_id,omitempty"`
+	AssetGroupName   string       `json:"asset_group_name,omitempty"`
+	PartitionID      string       `json:"partition_id"`
+	PartitionType    string       `json:"partition_type"`
+	ItemID           string       `json:"item_id,omitempty"`
+	CpcBid           *money.Money `json:"cpc_bid,omitempty"`
+	Clicks           int64        `json:"clicks"`
+	Cost             money.Money  `json:"cost"`
+	Conversions      float64      `json:"conversions"`
+	ConversionsValue money.Money  `json:"conversions_value"`
+	ROAS             float64      `json:"roas"`
+}
+
+// ListingExclusion is an item already excluded from a Shopping ad group or
+// a Performance Max asset group.
+type ListingExclusion struct {
+	CampaignID   string `json:"campaign_id"`
+	AdGroupID    string `json:"ad_group_id,omitempty"`
+	AssetGroupID string `json:"asset_group_id,omitempty"`
+	ItemID       string `json:"item_id"`
+}
+
+// ProductRecommendation is a change for one advertised item, keyed by its
+// Merchant Center item ID. Performance Max exclusions apply to every asset
+// group of the campaign.
+type ProductRecommendation struct {
+	CustomerID       string      `json:"customer_id"`
+	CampaignID       string      `json:"campaign_id"`
+	CampaignName     string      `json:"campaign_name"`
+	ChannelType      string      `json:"channel_type"`
+	AdGroupID        string      `json:"ad_group_id,omitempty"`
+	ItemID           string      `json:"item_id"`
+	ProductTitle     string      `json:"product_title"`
+	Clicks           int64       `json:"clicks"`
+	Cost             money.Money `json:"cost"`
+	Conversions      float64     `json:"conversions"`
+	ConversionsValue money.Money `json:"conversions_value"`
+	ROAS             float64     `json:"roas"`
+	Action           string      `json:"action"`
+	Reason           string      `json:"reason"`
+
+	// Set for bid changes.
+	CurrentBid     *money.Money `json:"current_bid,omitempty"`
+	RecommendedBid *money.Money `json:"recommended_bid,omitempty"`
+
+	// Catalogue details, when the item is in the catalogue. Price is in
+	// the catalogue's currency.
+	InCatalog bool         `json:"in_catalog"`
+	Category  string       `json:"category,omitempty"`
+	Brand     string       `json:"brand,omitempty"`
+	Price     *money.Money `json:"price,omitempty"`
+
+	// Cohort is the campaign's cohort while an experiment runs.
+	Cohort string `json:"cohort,omitempty"`
+}
+
+// ProductAnalysis is an account's Shopping and Performance Max section of
+// the report.
+type ProductAnalysis struct {
+	Partitions      []ProductPartition
+	Exclusions      []ListingExclusion
+	Recommendations []ProductRecommendation
+}
+
+// catalogProduct is the part of a product-service record the analysis
+// uses.
+type catalogProduct struct {
+	ID       string  `dynamodbav:"id"`
+	Name     string  `dynamodbav:"name"`
+	Category string  `dynamodbav:"category"`
+	Brand    string  `dynamodbav:"brand"`
+	Price    float64 `dynamodbav:"price"`
+	Currency string  `dynamodbav:"currency"`
+}
+
+// productPerformance sums an item's rows within one campaign and, for
+// Shopping, ad group.
+type productPerformance struct {
+	campaign         *googleads.Campaign
+	adGroupID        string
+	itemID           string
+	title            string
+	clicks           int64
+	costMicros       int64
+	conversions      float64
+	conversionsValue float64
+}
+
+func (p productPerformance) roas() float64 {
+	if p.costMicros == 0 {
+		return 0
+	}
+	return p.conversionsValue / (float64(p.costMicros) / 1000000.0)
+}
+
+// listingKey identifies an item within a Shopping ad group, or within a
+// Performance Max campaign when adGroupID is empty.
+func listingKey(campaignID, adGroupID, itemID string) string {
+	return campaignID + "|" + adGroupID + "|" + itemID
+}
+
+// analyzeProducts reports the listing group partitions of the account's
+// Shopping and Performance Max campaigns and recommends exclusions and bid
+// changes for their items. Failed partition or exclusion queries only
+// leave their part out.
+func analyzeProducts(ctx context.Context, client AdsClient, rules *accountRules, customerID string) (ProductAnalysis, error) {
+	var analysis ProductAnalysis
+
+	products := make(map[string]*productPerformance)
+	var order []string
+	err := searchStream(ctx, client, &googleads.SearchGoogleAdsStreamRequest{CustomerId: customerID, Query: productPerformanceQuery}, func(row *googleads.GoogleAdsRow) error {
+		campaignID := fmt.Sprintf("%d", row.Campaign.Id)
+		var adGroupID string
+		if row.Campaign.AdvertisingChannelType.String() == "SHOPPING" && row.AdGroup != nil {
+			adGroupID = fmt.Sprintf("%d", row.AdGroup.Id)
+		}
+		itemID := strings.ToLower(row.Segments.ProductItemId)
+		key := listingKey(campaignID, adGroupID, itemID)
+		p, ok := products[key]
+		if !ok {
+			p = &productPerformance{campaign: row.Campaign, adGroupID: adGroupID, itemID: itemID, title: row.Segments.ProductTitle}
+			products[key] = p
+			order = append(order, key)
+		}
+		p.clicks += row.Metrics.Clicks
+		p.costMicros += row.Metrics.CostMicros
+		p.conversions += float64(row.Metrics.Conversions)
+		p.conversionsValue += row.Metrics.ConversionsValue
+		return nil
+	})
+	if err != nil {
+		return analysis, fmt.Errorf("failed to search product performance: %w", err)
+	}
+
+	units := make(map[string]ProductPartition)
+	if partitions, err := shoppingPartitions(ctx, client, rules, customerID); err != nil {
+		log.Printf("Failed to load Shopping partitions for customer %s: %v", customerID, err)
+	} else {
+		analysis.Partitions = append(analysis.Partitions, partitions...)
+		for _, p := range partitions {
+			if p.ItemID != "" && p.PartitionType == "UNIT" {
+				units[listingKey(p.CampaignID, p.AdGroupID, p.ItemID)] = p
+			}
+		}
+	}
+	if partitions, err := assetGroupPartitions(ctx, client, rules, customerID); err != nil {
+		log.Printf("Failed to load Performance Max partitions for customer %s: %v", customerID, err)
+	} else {
+		analysis.Partitions = append(analysis.Partitions, partitions...)
+	}
+	sort.SliceStable(analysis.Partitions, func(i, j int) bool {
+		return analysis.Partitions[i].Cost.AmountMicros > analysis.Partitions[j].Cost.AmountMicros
+	})
+
+	excluded := make(map[string]bool)
+	analysis.Exclusions, err = listingExclusions(ctx, client, customerID)
+	if err != nil {
+		log.Printf("Failed to load listing group exclusions for customer %s: %v", customerID, err)
+	}
+	for _, e := range analysis.Exclusions {
+		// A Performance Max item counts as excluded once any asset group
+		// excludes it; the report says which.
+		excluded[listingKey(e.CampaignID, e.AdGroupID, e.ItemID)] = true
+	}
+
+	catalog, err := loadCatalog(ctx, products)
+	if err != nil {
+		// Without the catalogue no item can be told apart as discontinued.
+		log.Printf("Failed to read the product catalogue, analyzing products without it: %v", err)
+	}
+
+	for _, key := range order {
+		p := products[key]
+		if excluded[key] {
+			continue
+		}
+		var unit *ProductPartition
+		if u, ok := units[key]; ok {
+			unit = &u
+		}
+		rec := recommendProduct(rules, *p, catalog, unit)
+		if rec == nil {
+			continue
+		}
+		rec.CustomerID = customerID
+		analysis.Recommendations = append(analysis.Recommendations, *rec)
+	}
+	sort.SliceStable(analysis.Recommendations, func(i, j int) bool {
+		return analysis.Recommendations[i].Cost.AmountMicros > analysis.Recommendations[j].Cost.AmountMicros
+	})
+	return analysis, nil
+}
+
+// recommendProduct excludes items that spend without converting or are no
+// longer in the catalogue, and moves the bid of Shopping items with their
+// own partition toward targetROAS. catalog is nil when it could not be
+// read; unit is the item's own Shopping partition, if it has one.
+func recommendProduct(rules *accountRules, p productPerformance, catalog map[string]catalogProduct, unit *ProductPartition) *ProductRecommendation {
+	cost := rules.micros(p.costMicros)
+	rec := &ProductRecommendation{
+		CampaignID:       fmt.Sprintf("%d", p.campaign.Id),
+		CampaignName:     p.campaign.Name,
+		ChannelType:      p.campaign.AdvertisingChannelType.String(),
+		AdGroupID:        p.adGroupID,
+		ItemID:           p.itemID,
+		ProductTitle:     p.title,
+		Clicks:           p.clicks,
+		Cost:             cost,
+		Conversions:      p.conversions,
+		ConversionsValue: rules.amount(p.conversionsValue),
+		ROAS:             p.roas(),
+	}
+	product, inCatalog := catalog[p.itemID]
+	if inCatalog {
+		price := money.FromUnits(product.Price, product.Currency)
+		rec.InCatalog = true
+		rec.Category = product.Category
+		rec.Brand = product.Brand
+		rec.Price = &price
+	}
+
+	switch {
+	case catalog != nil && !inCatalog:
+		rec.Action = ProductExclude
+		rec.Reason = fmt.Sprintf("Item is not in the product catalogue but spent %s over the last 30 days", cost)
+		return rec
+	case p.conversions == 0 && p.clicks >= productMinClicks && cost.Units() >= rules.productExclusionMinCost:
+		rec.Action = ProductExclude
+		rec.Reason = fmt.Sprintf("%d clicks and %s spent over the last 30 days without a conversion", p.clicks, cost)
+		return rec
+	}
+
+	if unit == nil || unit.CpcBid == nil || unit.CpcBid.AmountMicros == 0 || p.conversions < productMinConversions {
+		return nil
+	}
+	current := unit.CpcBid.Units()
+	roas := p.roas()
+	var bid float64
+	switch {
+	case roas >= targetROAS*roasStrongMultiple:
+		bid, rec.Action = current*strongBidIncrease, ProductIncreaseBid
+		rec.Reason = fmt.Sprintf("ROAS %.2f from %.0f conversions is well above target %.2f", roas, p.conversions, targetROAS)
+	case roas < targetROAS*roasPoorMultiple:
+		bid, rec.Action = current*weakCTRBidDecrease, ProductDecreaseBid
+		rec.Reason = fmt.Sprintf("ROAS %.2f from %.0f conversions is less than half of target %.2f", roas, p.conversions, targetROAS)
+	case roas < targetROAS:
+		bid, rec.Action = current*highCPABidDecrease, ProductDecreaseBid
+		rec.Reason = fmt.Sprintf("ROAS %.2f from %.0f conversions is below target %.2f", roas, p.conversions, targetROAS)
+	default:
+		return nil
+	}
+	recommended := rules.amount(bid)
+	rec.CurrentBid = unit.CpcBid
+	rec.RecommendedBid = &recommended
+	return rec
+}
+
+func shoppingPartitions(ctx context.Context, client AdsClient, rules *accountRules, customerID string) ([]ProductPartition, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{CustomerId: customerID, Query: shoppingPartitionQuery})
+	if err != nil {
+		return nil, err
+	}
+	partitions := make([]ProductPartition, 0, len(resp.Results))
+	for _, row := range resp.Results {
+		criterion := row.AdGroupCriterion
+		p := partitionMetrics(rules, row.Metrics)
+		p.CampaignID = fmt.Sprintf("%d", row.Campaign.Id)
+		p.CampaignName = row.Campaign.Name
+		p.AdGroupID = fmt.Sprintf("%d", row.AdGroup.Id)
+		p.PartitionID = fmt.Sprintf("%d", criterion.CriterionId)
+		if group := criterion.ListingGroup; group != nil {
+			p.PartitionType = group.Type.String()
+			p.ItemID = caseValueItemID(group.CaseValue)
+		}
+		if criterion.CpcBidMicros > 0 {
+			bid := rules.micros(criterion.CpcBidMicros)
+			p.CpcBid = &bid
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, nil
+}
+
+func assetGroupPartitions(ctx context.Context, client AdsClient, rules *accountRules, customerID string) ([]ProductPartition, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{CustomerId: customerID, Query: assetGroupPartitionQuery})
+	if err != nil {
+		return nil, err
+	}
+	partitions := make([]ProductPartition, 0, len(resp.Results))
+	for _, row := range resp.Results {
+		filter := row.AssetGroupListingGroupFilter
+		p := partitionMetrics(rules, row.Metrics)
+		p.CampaignID = fmt.Sprintf("%d", row.Campaign.Id)
+		p.CampaignName = row.Campaign.Name
+		p.AssetGroupID = fmt.Sprintf("%d", row.AssetGroup.Id)
+		p.AssetGroupName = row.AssetGroup.Name
+		p.PartitionID = fmt.Sprintf("%d", filter.Id)
+		p.PartitionType = filter.Type.String()
+		p.ItemID = caseValueItemID(filter.CaseValue)
+		partitions = append(partitions, p)
+	}
+	return partitions, nil
+}
+
+func partitionMetrics(rules *accountRules, metrics *googleads.Metrics) ProductPartition {
+	p := ProductPartition{
+		Clicks:           metrics.Clicks,
+		Cost:             rules.micros(metrics.CostMicros),
+		Conversions:      float64(metrics.Conversions),
+		ConversionsValue: rules.amount(metrics.ConversionsValue),
+	}
+	if metrics.CostMicros > 0 {
+		p.ROAS = metrics.ConversionsValue / p.Cost.Units()
+	}
+	return p
+}
+
+// caseValueItemID returns the item ID a listing group partitions on, or ""
+// when it partitions on something else.
+func caseValueItemID(value *googleads.ListingDimensionInfo) string {
+	if value == nil || value.ProductItemId == nil {
+		return ""
+	}
+	return strings.ToLower(value.ProductItemId.Value)
+}
+
+// listingExclusions reads the items excluded from the account's Shopping
+// ad groups and Performance Max asset groups.
+func listingExclusions(ctx context.Context, client AdsClient, customerID string) ([]ListingExclusion, error) {
+	var exclusions []ListingExclusion
+
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{CustomerId: customerID, Query: shoppingExclusionQuery})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search Shopping exclusions: %w", err)
+	}
+	for _, row := range resp.Results {
+		itemID := caseValueItemID(row.AdGroupCriterion.ListingGroup.CaseValue)
+		if itemID == "" {
+			continue
+		}
+		exclusions = append(exclusions, ListingExclusion{
+			CampaignID: fmt.Sprintf("%d", row.Campaign.Id),
+			AdGroupID:  fmt.Sprintf("%d", row.AdGroup.Id),
+			ItemID:     itemID,
+		})
+	}
+
+	resp, err = search(ctx, client, &googleads.SearchGoogleAdsRequest{CustomerId: customerID, Query: assetGroupExclusionQuery})
+	if err != nil {
+		return exclusions, fmt.Errorf("failed to search Performance Max exclusions: %w", err)
+	}
+	for _, row := range resp.Results {
+		itemID := caseValueItemID(row.AssetGroupListingGroupFilter.CaseValue)
+		if itemID == "" {
+			continue
+		}
+		exclusions = append(exclusions, ListingExclusion{
+			CampaignID:   fmt.Sprintf("%d", row.Campaign.Id),
+			AssetGroupID: fmt.Sprintf("%d", row.AssetGroup.Id),
+			ItemID:       itemID,
+		})
+	}
+	return exclusions, nil
+}
+
+// loadCatalog reads the advertised items from the product catalogue, keyed
+// by item ID. It returns nil when no catalogue is configured or it could
+// not be read.
+func loadCatalog(ctx context.Context, products map[string]*productPerformance) (map[string]catalogProduct, error) {
+	if productsTable == "" || len(products) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	var keys []dynamo.Key
+	for _, p := range products {
+		if !seen[p.itemID] {
+			seen[p.itemID] = true
+			keys = append(keys, dynamo.StringKey("id", p.itemID))
+		}
+	}
+
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	items, err := dynamo.BatchGet[catalogProduct](ctx, dynamo.NewTable(dynamodb.NewFromConfig(cfg), productsTable), keys)
+	if err != nil {
+		return nil, err
+	}
+	catalog := make(map[string]catalogProduct, len(items))
+	for _, item := range items {
+		catalog[strings.ToLower(item.ID)] = item
+	}
+	return catalog, nil
+}
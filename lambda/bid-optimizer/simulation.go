@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/money"
+)
+
+// Keyword CPC bid simulators: Google Ads' estimate of how a keyword would
+// have performed over the last week at a range of bids.
+var criterionSimulationQuery = gaql.Select(
+	"ad_group_criterion_simulation.ad_group_id",
+	"ad_group_criterion_simulation.criterion_id",
+	"ad_group_criterion_simulation.start_date",
+	"ad_group_criterion_simulation.end_date",
+	"ad_group_criterion_simulation.cpc_bid_point_list.points",
+).From("ad_group_criterion_simulation").
+	Where("ad_group_criterion_simulation.type", gaql.Equals, "CPC_BID").
+	Where("ad_group_criterion_simulation.modification_method", gaql.Equals, "UNIFORM").
+	MustBuild()
+
+// Campaign target CPA and target ROAS simulators of enabled campaigns, with
+// the targets the campaigns bid to today.
+var campaignSimulationQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.bidding_strategy_type",
+	"campaign.target_cpa.target_cpa_micros",
+	"campaign.target_roas.target_roas",
+	"campaign_simulation.type",
+	"campaign_simulation.start_date",
+	"campaign_simulation.end_date",
+	"campaign_simulation.target_cpa_point_list.points",
+	"campaign_simulation.target_roas_point_list.points",
+).From("campaign_simulation").
+	Where("campaign_simulation.type", gaql.In, []string{"TARGET_CPA", "TARGET_ROAS"}).
+	Where("campaign_simulation.modification_method", gaql.Equals, "UNIFORM").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// SimulatedOutcome is a simulator's estimate of average daily performance
+// at one bid or target.
+type SimulatedOutcome struct {
+	Impressions      float64     `json:"impressions"`
+	Clicks           float64     `json:"clicks"`
+	Cost             money.Money `json:"cost"`
+	Conversions      float64     `json:"conversions"`
+	ConversionsValue money.Money `json:"conversions_value"`
+}
+
+// BidProjection compares a keyword's simulated performance at its current
+// and recommended bid. OutOfRange is set when either bid lies outside the
+// simulated bids, so the nearest simulated point was used.
+type BidProjection struct {
+	SimulationStart string           `json:"simulation_start"`
+	SimulationEnd   string           `json:"simulation_end"`
+	CurrentBid      money.Money      `json:"current_bid"`
+	ProjectedBid    money.Money      `json:"projected_bid"`
+	Current         SimulatedOutcome `json:"current"`
+	Projected       SimulatedOutcome `json:"projected"`
+	OutOfRange      bool             `json:"out_of_range,omitempty"`
+}
+
+// StrategyProjection is a campaign's simulated performance at the
+// optimizer's target CPA or target ROAS goal, next to its performance at
+// its current target when it bids to one. Target CPAs are in Currency,
+// the account's.
+type StrategyProjection struct {
+	CustomerID      string            `json:"customer_id"`
+	CampaignID      string            `json:"campaign_id"`
+	CampaignName    string            `json:"campaign_name"`
+	BiddingStrategy string            `json:"bidding_strategy"`
+	Simulation      string            `json:"simulation"`
+	SimulationStart string            `json:"simulation_start"`
+	SimulationEnd   string            `json:"simulation_end"`
+	CurrentTarget   float64           `json:"current_target,omitempty"`
+	GoalTarget      float64           `json:"goal_target"`
+	Currency        string            `json:"currency"`
+	Current         *SimulatedOutcome `json:"current,omitempty"`
+	Projected       SimulatedOutcome  `json:"projected"`
+	OutOfRange      bool              `json:"out_of_range,omitempty"`
+}
+
+// simulationCurve is a simulator's points ordered by the simulated bid or
+// target, with outcomes already averaged per day.
+type simulationCurve struct {
+	start, end string
+	points     []simulationPoint
+}
+
+type simulationPoint struct {
+	x       float64
+	outcome SimulatedOutcome
+}
+
+func newSimulationCurve(start, end string, points []simulationPoint) *simulationCurve {
+	days := simulationDays(start, end)
+	for i := range points {
+		o := &points[i].outcome
+		o.Impressions /= days
+		o.Clicks /= days
+		o.Cost = o.Cost.Div(days)
+		o.Conversions /= days
+		o.ConversionsValue = o.ConversionsValue.Div(days)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].x < points[j].x })
+	return &simulationCurve{start: start, end: end, points: points}
+}
+
+// simulationDays is the length of the simulated period, inclusive. The
+// API's periods are usually a week; a malformed one counts as a day.
+func simulationDays(start, end string) float64 {
+	s, err1 := time.Parse("2006-01-02", start)
+	e, err2 := time.Parse("2006-01-02", end)
+	if err1 != nil || err2 != nil || e.Before(s) {
+		return 1
+	}
+	return e.Sub(s).Hours()/24 + 1
+}
+
+// at interpolates the curve linearly at x. Beyond either end the nearest
+// point is returned and ok is false: simulators do not extrapolate, and
+// neither do we.
+func (c *simulationCurve) at(x float64) (SimulatedOutcome, bool) {
+	n := len(c.points)
+	if x <= c.points[0].x {
+		return c.points[0].outcome, x == c.points[0].x
+	}
+	if x >= c.points[n-1].x {
+		return c.points[n-1].outcome, x == c.points[n-1].x
+	}
+
+	i := sort.Search(n, func(i int) bool { return c.points[i].x >= x })
+	lo, hi := c.points[i-1], c.points[i]
+	t := (x - lo.x) / (hi.x - lo.x)
+	lerp := func(a, b float64) float64 { return a + t*(b-a) }
+	lerpMoney := func(a, b money.Money) money.Money {
+		return money.FromUnits(lerp(a.Units(), b.Units()), a.Currency)
+	}
+	return SimulatedOutcome{
+		Impressions:      lerp(lo.outcome.Impressions, hi.outcome.Impressions),
+		Clicks:           lerp(lo.outcome.Clicks, hi.outcome.Clicks),
+		Cost:             lerpMoney(lo.outcome.Cost, hi.outcome.Cost),
+		Conversions:      lerp(lo.outcome.Conversions, hi.outcome.Conversions),
+		ConversionsValue: lerpMoney(lo.outcome.ConversionsValue, hi.outcome.ConversionsValue),
+	}, true
+}
+
+func criterionSimulationKey(adGroupID, criterionID int64) string {
+	return fmt.Sprintf("%d~%d", adGroupID, criterionID)
+}
+
+// loadCriterionSimulations returns the account's keyword CPC bid curves,
+// keyed by ad group and criterion ID.
+func loadCriterionSimulations(ctx context.Context, client AdsClient, rules *accountRules, customerID string) (map[string]*simulationCurve, error) {
+	curves := make(map[string]*simulationCurve)
+	err := searchStream(ctx, client, &googleads.SearchGoogleAdsStreamRequest{
+		CustomerId: customerID,
+		Query:      criterionSimulationQuery,
+	}, func(row *googleads.GoogleAdsRow) error {
+		sim := row.AdGroupCriterionSimulation
+		if sim.CpcBidPointList == nil || len(sim.CpcBidPointList.Points) < 2 {
+			return nil
+		}
+		var points []simulationPoint
+		for _, p := range sim.CpcBidPointList.Points {
+			points = append(points, simulationPoint{
+				x:       float64(p.CpcBidMicros) / 1000000.0,
+				outcome: simulatedOutcome(rules, p.Impressions, p.Clicks, p.CostMicros, p.BiddableConversions, p.BiddableConversionsValue),
+			})
+		}
+		curves[criterionSimulationKey(sim.AdGroupId, sim.CriterionId)] = newSimulationCurve(sim.StartDate, sim.EndDate, points)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search criterion simulations: %w", err)
+	}
+	return curves, nil
+}
+
+// projectBid reads the keyword's performance at its current and proposed
+// bid, in the account's currency, off its simulated curve.
+func projectBid(rules *accountRules, curve *simulationCurve, currentBid, proposedBid float64) *BidProjection {
+	current, inRange := curve.at(currentBid)
+	projected, projectedInRange := curve.at(proposedBid)
+	return &BidProjection{
+		SimulationStart: curve.start,
+		SimulationEnd:   curve.end,
+		CurrentBid:      rules.amount(currentBid),
+		ProjectedBid:    rules.amount(proposedBid),
+		Current:         current,
+		Projected:       projected,
+		OutOfRange:      !inRange || !projectedInRange,
+	}
+}
+
+// worthwhile reports whether a bid increase buys enough extra clicks to be
+// recommended. Past the top of the auction a higher bid only raises cost.
+func (p *BidProjection) worthwhile() bool {
+	if p.ProjectedBid.AmountMicros <= p.CurrentBid.AmountMicros {
+		return true
+	}
+	return p.Projected.Clicks > p.Current.Clicks*(1+simulationMinClickGain)
+}
+
+// describe summarizes the projection for the report.
+func (p *BidProjection) describe() string {
+	clicks := p.Projected.Clicks - p.Current.Clicks
+	cost := p.Projected.Cost.Units() - p.Current.Cost.Units()
+	conversions := p.Projected.Conversions - p.Current.Conversions
+
+	s := fmt.Sprintf("Simulator projects %+.1f clicks/day (%s), %+.2f %s cost/day and %+.2f conversions/day",
+		clicks, percentChange(p.Current.Clicks, p.Projected.Clicks), cost, p.Current.Cost.Currency, conversions)
+	if p.OutOfRange {
+		s += " (bid outside the simulated range; nearest point used)"
+	}
+	return s
+}
+
+func percentChange(from, to float64) string {
+	if from == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.0f%%", (to-from)/from*100)
+}
+
+// projectStrategies reads each simulated campaign's performance at the
+// optimizer's target CPA or target ROAS goal.
+func projectStrategies(ctx context.Context, client AdsClient, rules *accountRules, customerID string) ([]StrategyProjection, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      campaignSimulationQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search campaign simulations: %w", err)
+	}
+
+	var projections []StrategyProjection
+	for _, row := range resp.Results {
+		sim := row.CampaignSimulation
+		campaign := row.Campaign
+
+		var points []simulationPoint
+		var goal, current float64
+		switch sim.Type.String() {
+		case "TARGET_CPA":
+			if sim.TargetCpaPointList == nil {
+				continue
+			}
+			for _, p := range sim.TargetCpaPointList.Points {
+				points = append(points, simulationPoint{
+					x:       float64(p.TargetCpaMicros) / 1000000.0,
+					outcome: simulatedOutcome(rules, p.Impressions, p.Clicks, p.CostMicros, p.BiddableConversions, p.BiddableConversionsValue),
+				})
+			}
+			goal = rules.targetCPA
+			if campaign.TargetCpa != nil {
+				current = float64(campaign.TargetCpa.TargetCpaMicros) / 1000000.0
+			}
+		case "TARGET_ROAS":
+			if sim.TargetRoasPointList == nil {
+				continue
+			}
+			for _, p := range sim.TargetRoasPointList.Points {
+				points = append(points, simulationPoint{
+					x:       p.TargetRoas,
+					outcome: simulatedOutcome(rules, p.Impressions, p.Clicks, p.CostMicros, p.BiddableConversions, p.BiddableConversionsValue),
+				})
+			}
+			goal = targetROAS
+			if campaign.TargetRoas != nil {
+				current = campaign.TargetRoas.TargetRoas
+			}
+		}
+		if len(points) < 2 {
+			continue
+		}
+
+		curve := newSimulationCurve(sim.StartDate, sim.EndDate, points)
+		projected, inRange := curve.at(goal)
+		projection := StrategyProjection{
+			CustomerID:      customerID,
+			CampaignID:      fmt.Sprintf("%d", campaign.Id),
+			CampaignName:    campaign.Name,
+			BiddingStrategy: campaign.BiddingStrategyType.String(),
+			Simulation:      sim.Type.String(),
+			SimulationStart: sim.StartDate,
+			SimulationEnd:   sim.EndDate,
+			CurrentTarget:   current,
+			GoalTarget:      goal,
+			Currency:        rules.currency,
+			Projected:       projected,
+			OutOfRange:      !inRange,
+		}
+		if current > 0 {
+			outcome, currentInRange := curve.at(current)
+			projection.Current = &outcome
+			projection.OutOfRange = projection.OutOfRange || !currentInRange
+		}
+		projections = append(projections, projection)
+	}
+	return projections, nil
+}
+
+func simulatedOutcome(rules *accountRules, impressions, clicks, costMicros int64, conversions, value float64) SimulatedOutcome {
+	return SimulatedOutcome{
+		Impressions:      float64(impressions),
+		Clicks:           float64(clicks),
+		Cost:             rules.micros(costMicros),
+		Conversions:      conversions,
+		ConversionsValue: rules.amount(value),
+	}
+}
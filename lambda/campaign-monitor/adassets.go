@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+)
+
+const (
+	AlertTypeRSAWeakAdStrength = "RSA_WEAK_AD_STRENGTH"
+	AlertTypeRSAMissingAssets  = "RSA_MISSING_ASSETS"
+	AlertTypeAssetDisapproved  = "RSA_ASSET_DISAPPROVED"
+)
+
+// weakAdStrengths are the ad strength ratings that raise
+// RSA_WEAK_AD_STRENGTH. PENDING and NO_ADS say nothing about the assets.
+var weakAdStrengths = map[string]bool{
+	"POOR":    true,
+	"AVERAGE": true,
+}
+
+// Enabled responsive search ads in enabled ad groups and campaigns, with
+// the assets they serve from.
+var rsaAdsQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"ad_group.id",
+	"ad_group.name",
+	"ad_group_ad.ad.id",
+	"ad_group_ad.ad_strength",
+	"ad_group_ad.ad.responsive_search_ad.headlines",
+	"ad_group_ad.ad.responsive_search_ad.descriptions",
+).From("ad_group_ad").
+	Where("ad_group_ad.ad.type", gaql.Equals, "RESPONSIVE_SEARCH_AD").
+	Where("ad_group_ad.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// Assets that policy review disapproved on ads that still serve them.
+var disapprovedAssetsQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"ad_group.id",
+	"ad_group.name",
+	"ad_group_ad.ad.id",
+	"asset.id",
+	"asset.text_asset.text",
+	"ad_group_ad_asset_view.field_type",
+	"ad_group_ad_asset_view.policy_summary.policy_topic_entries",
+).From("ad_group_ad_asset_view").
+	Where("ad_group_ad_asset_view.enabled", gaql.Equals, true).
+	Where("ad_group_ad_asset_view.policy_summary.approval_status", gaql.Equals, "DISAPPROVED").
+	Where("ad_group_ad.status", gaql.Equals, "ENABLED").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// monitorAdAssets checks every enabled responsive search ad for weak ad
+// strength and too few headlines or descriptions, and every asset they
+// serve for policy disapprovals.
+func monitorAdAssets(ctx context.Context, client AdsClient, customerID string) ([]CampaignAlert, error) {
+	var alerts []CampaignAlert
+
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      rsaAdsQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search responsive search ads: %w", err)
+	}
+
+	for _, row := range resp.Results {
+		alert := generateAdStrengthAlert(row)
+		if alert != nil {
+			alert.CustomerID = customerID
+			alerts = append(alerts, *alert)
+		}
+	}
+
+	resp, err = search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      disapprovedAssetsQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search disapproved assets: %w", err)
+	}
+
+	for _, row := range resp.Results {
+		alert := generateAssetDisapprovedAlert(row)
+		alert.CustomerID = customerID
+		alerts = append(alerts, *alert)
+	}
+
+	return alerts, nil
+}
+
+// generateAdStrengthAlert raises RSA_MISSING_ASSETS when an ad has fewer
+// headlines or descriptions than recommended, and otherwise
+// RSA_WEAK_AD_STRENGTH when Google rates it POOR or AVERAGE. Missing assets
+// are the usual cause of weak strength, so they are reported instead of it.
+func generateAdStrengthAlert(row *googleads.GoogleAdsRow) *CampaignAlert {
+	if row.AdGroupAd == nil || row.AdGroupAd.Ad == nil {
+		return nil
+	}
+
+	var headlines, descriptions int
+	if rsa := row.AdGroupAd.Ad.ResponsiveSearchAd; rsa != nil {
+		headlines = len(rsa.Headlines)
+		descriptions = len(rsa.Descriptions)
+	}
+	strength := row.AdGroupAd.AdStrength.String()
+
+	alert := newAdAlert(row)
+	alert.AdStrength = strength
+	alert.Headlines = headlines
+	alert.Descriptions = descriptions
+
+	var missing []string
+	if headlines < rsaMinHeadlines {
+		missing = append(missing, fmt.Sprintf("%d of %d headlines", headlines, rsaMinHeadlines))
+	}
+	if descriptions < rsaMinDescriptions {
+		missing = append(missing, fmt.Sprintf("%d of %d descriptions", descriptions, rsaMinDescriptions))
+	}
+
+	switch {
+	case len(missing) > 0:
+		alert.AlertType = AlertTypeRSAMissingAssets
+		alert.Message = fmt.Sprintf("Responsive search ad %s in ad group '%s' has only %s (ad strength %s)",
+			alert.AdID, alert.AdGroupName, strings.Join(missing, " and "), strength)
+	case weakAdStrengths[strength]:
+		alert.AlertType = AlertTypeRSAWeakAdStrength
+		alert.Message = fmt.Sprintf("Responsive search ad %s in ad group '%s' has %s ad strength",
+			alert.AdID, alert.AdGroupName, strength)
+	default:
+		return nil
+	}
+	return alert
+}
+
+// generateAssetDisapprovedAlert reports a disapproved asset with the policy
+// topics behind the disapproval.
+func generateAssetDisapprovedAlert(row *googleads.GoogleAdsRow) *CampaignAlert {
+	alert := newAdAlert(row)
+	alert.AlertType = AlertTypeAssetDisapproved
+	alert.AssetFieldType = row.AdGroupAdAssetView.FieldType.String()
+	if row.Asset != nil {
+		alert.AssetID = fmt.Sprintf("%d", row.Asset.Id)
+		if row.Asset.TextAsset != nil {
+			alert.AssetText = row.Asset.TextAsset.Text
+		}
+	}
+	if summary := row.AdGroupAdAssetView.PolicySummary; summary != nil {
+		alert.PolicyTopics = policyTopics(summary.PolicyTopicEntries)
+	}
+
+	alert.Message = fmt.Sprintf("%s asset %q on responsive search ad %s in ad group '%s' is disapproved: %s",
+		alert.AssetFieldType, alert.AssetText, alert.AdID, alert.AdGroupName, policyReason(alert.PolicyTopics))
+	return alert
+}
+
+// newAdAlert fills the campaign, ad group and, when the row has one, the ad
+// an ad group level alert is about.
+func newAdAlert(row *googleads.GoogleAdsRow) *CampaignAlert {
+	alert := &CampaignAlert{
+		CampaignID:   fmt.Sprintf("%d", row.Campaign.Id),
+		CampaignName: row.Campaign.Name,
+		Status:       row.Campaign.Status.String(),
+		AdGroupID:    fmt.Sprintf("%d", row.AdGroup.Id),
+		AdGroupName:  row.AdGroup.Name,
+	}
+	if row.AdGroupAd != nil && row.AdGroupAd.Ad != nil {
+		alert.AdID = fmt.Sprintf("%d", row.AdGroupAd.Ad.Id)
+	}
+	return alert
+}
+
+func policyTopics(entries []*googleads.PolicyTopicEntry) []PolicyTopic {
+	topics := make([]PolicyTopic, 0, len(entries))
+	for _, e := range entries {
+		topics = append(topics, PolicyTopic{Topic: e.Topic, Type: e.Type.String()})
+	}
+	return topics
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"pkg/events"
+)
+
+// maxPutEventsEntries is PutEvents' limit of entries per call.
+const maxPutEventsEntries = 10
+
+// publishAlertEvents announces each alert on the platform bus, those sent
+// in a group with the group's cause, for consumers that act on alerts
+// rather than notify about them. The alerts already went to the topic, so
+// failures are only logged.
+func (m *Monitor) publishAlertEvents(ctx context.Context, alerts []CampaignAlert, groups []AlertGroup) {
+	if m.bus == nil {
+		return
+	}
+	enc := events.NewEncoder(clk)
+	now := clk.Now().UTC()
+	var entries []ebtypes.PutEventsRequestEntry
+	add := func(alert CampaignAlert, cause string) {
+		entry, err := enc.Marshal(ctx, events.CampaignAlertRaised{
+			CustomerID:   alert.CustomerID,
+			CampaignID:   alert.CampaignID,
+			CampaignName: alert.CampaignName,
+			AlertType:    alert.AlertType,
+			Message:      alert.Message,
+			Cause:        cause,
+			RunID:        alert.RunID,
+			RaisedAt:     now,
+		})
+		if err != nil {
+			log.Printf("Failed to marshal %s alert event for campaign %s: %v", alert.AlertType, alert.CampaignName, err)
+			return
+		}
+		entries = append(entries, ebtypes.PutEventsRequestEntry{
+			EventBusName: aws.String(eventBusName),
+			Source:       aws.String(entry.Source),
+			DetailType:   aws.String(entry.DetailType),
+			Detail:       aws.String(entry.Detail),
+			Time:         aws.Time(entry.Time),
+		})
+	}
+	for _, group := range groups {
+		for _, alert := range group.Alerts {
+			add(alert, group.Cause)
+		}
+	}
+	for _, alert := range alerts {
+		add(alert, "")
+	}
+
+	for start := 0; start < len(entries); start += maxPutEventsEntries {
+		batch := entries[start:min(start+maxPutEventsEntries, len(entries))]
+		result, err := m.bus.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: batch})
+		if err != nil {
+			log.Printf("Failed to publish %d alert events: %v", len(batch), err)
+			continue
+		}
+		if result.FailedEntryCount > 0 {
+			log.Printf("EventBridge rejected %d of %d alert events", result.FailedEntryCount, len(batch))
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+)
+
+const (
+	AlertTypeBudgetNearlyExhausted = "BUDGET_NEARLY_EXHAUSTED"
+	AlertTypeBudgetExhausted       = "BUDGET_EXHAUSTED"
+)
+
+// budgetAlertThreshold is the share of budget consumed at which
+// BUDGET_NEARLY_EXHAUSTED fires.
+var budgetAlertThreshold = parseFloatEnv("BUDGET_ALERT_THRESHOLD", 0.8)
+
+var dailyBudgetQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"campaign_budget.amount_micros",
+	"campaign_budget.period",
+	"metrics.cost_micros",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("campaign_budget.amount_micros", gaql.GreaterThan, 0).
+	During(gaql.Today).
+	MustBuild()
+
+// Lifetime metrics: no date segment means the query aggregates over the
+// whole campaign.
+var totalBudgetQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"campaign.start_date",
+	"campaign_budget.total_amount_micros",
+	"metrics.cost_micros",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("campaign_budget.total_amount_micros", gaql.GreaterThan, 0).
+	MustBuild()
+
+// monitorBudgets compares spend-to-date against each enabled campaign's
+// budget. Daily budgets are checked against today's spend, total (campaign
+// lifetime) budgets against spend since the campaign started.
+func monitorBudgets(ctx context.Context, client AdsClient, rules *accountRules, customerID string) ([]CampaignAlert, error) {
+	var alerts []CampaignAlert
+
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      dailyBudgetQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search daily budgets: %w", err)
+	}
+
+	// TODAY and the campaign start date are in the account's time zone,
+	// so the period starts are too.
+	now := clk.Now().In(rules.location)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, rules.location)
+	for _, row := range resp.Results {
+		spent := float64(row.Metrics.CostMicros) / 1000000.0
+		budget := float64(row.CampaignBudget.AmountMicros) / 1000000.0
+
+		alert := generateBudgetAlert(rules, row.Campaign, "DAILY", spent, budget, dayStart, now)
+		if alert != nil {
+			alert.CustomerID = customerID
+			alerts = append(alerts, *alert)
+		}
+	}
+
+	resp, err = search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      totalBudgetQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search total budgets: %w", err)
+	}
+
+	for _, row := range resp.Results {
+		spent := float64(row.Metrics.CostMicros) / 1000000.0
+		budget := float64(row.CampaignBudget.TotalAmountMicros) / 1000000.0
+
+		start, err := time.ParseInLocation("2006-01-02", row.Campaign.StartDate, now.Location())
+		if err != nil {
+			start = dayStart
+		}
+
+		alert := generateBudgetAlert(rules, row.Campaign, "TOTAL", spent, budget, start, now)
+		if alert != nil {
+			alert.CustomerID = customerID
+			alerts = append(alerts, *alert)
+		}
+	}
+
+	return alerts, nil
+}
+
+func generateBudgetAlert(rules *accountRules, campaign *googleads.Campaign, period string, spent, budget float64, periodStart, now time.Time) *CampaignAlert {
+	if budget <= 0 {
+		return nil
+	}
+
+	consumed := spent / budget
+	if consumed < budgetAlertThreshold {
+		return nil
+	}
+
+	budgetAmount := rules.amount(budget)
+	alert := &CampaignAlert{
+		CampaignID:      fmt.Sprintf("%d", campaign.Id),
+		CampaignName:    campaign.Name,
+		Status:          campaign.Status.String(),
+		Cost:            rules.amount(spent),
+		BudgetPeriod:    period,
+		BudgetAmount:    &budgetAmount,
+		PercentConsumed: consumed * 100,
+	}
+
+	if consumed >= 1.0 {
+		alert.AlertType = AlertTypeBudgetExhausted
+		alert.Message = fmt.Sprintf("Campaign '%s' has exhausted its %s budget (%s of %s spent)",
+			campaign.Name, period, alert.Cost, budgetAmount)
+		return alert
+	}
+
+	alert.AlertType = AlertTypeBudgetNearlyExhausted
+	alert.Message = fmt.Sprintf("Campaign '%s' has consumed %.0f%% of its %s budget (%s of %s)",
+		campaign.Name, consumed*100, period, alert.Cost, budgetAmount)
+
+	if exhaustion, ok := projectExhaustion(spent, budget, periodStart, now); ok {
+		alert.ProjectedExhaustion = &exhaustion
+		alert.Message += fmt.Sprintf(", projected to run out at %s", exhaustion.Format(time.RFC3339))
+	}
+
+	return alert
+}
+
+// projectExhaustion extrapolates the average burn rate since periodStart to
+// estimate when the remaining budget will be spent.
+func projectExhaustion(spent, budget float64, periodStart, now time.Time) (time.Time, bool) {
+	elapsed := now.Sub(periodStart)
+	if spent <= 0 || elapsed <= 0 {
+		return time.Time{}, false
+	}
+
+	ratePerSecond := spent / elapsed.Seconds()
+	remaining := budget - spent
+	return now.Add(time.Duration(remaining/ratePerSecond) * time.Second), true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"pkg/clock"
+)
+
+func TestGenerateBudgetAlert(t *testing.T) {
+	rules := testRules(t)
+	campaign := decodeRows(t, `[{"campaign": {"id": "2001", "name": "Search - Generic"}}]`)[0].Campaign
+	dayStart := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	now := dayStart.Add(18 * time.Hour)
+
+	if alert := generateBudgetAlert(rules, campaign, "DAILY", 70, 100, dayStart, now); alert != nil {
+		t.Errorf("got %s alert at 70%% of budget", alert.AlertType)
+	}
+	if alert := generateBudgetAlert(rules, campaign, "DAILY", 10, 0, dayStart, now); alert != nil {
+		t.Errorf("got %s alert for a campaign without a budget", alert.AlertType)
+	}
+
+	alert := generateBudgetAlert(rules, campaign, "DAILY", 120, 100, dayStart, now)
+	if alert == nil || alert.AlertType != AlertTypeBudgetExhausted {
+		t.Fatalf("alert over budget = %+v, want %s", alert, AlertTypeBudgetExhausted)
+	}
+	if alert.ProjectedExhaustion != nil {
+		t.Errorf("exhausted budget projected to run out at %s", alert.ProjectedExhaustion)
+	}
+
+	// $90 in 18 hours is $5 an hour: the last $10 lasts 2 hours.
+	alert = generateBudgetAlert(rules, campaign, "DAILY", 90, 100, dayStart, now)
+	if alert == nil || alert.AlertType != AlertTypeBudgetNearlyExhausted {
+		t.Fatalf("alert at 90%% = %+v, want %s", alert, AlertTypeBudgetNearlyExhausted)
+	}
+	if math.Round(alert.PercentConsumed) != 90 || alert.BudgetPeriod != "DAILY" || alert.CampaignID != "2001" {
+		t.Errorf("alert = %+v", alert)
+	}
+	if want := now.Add(2 * time.Hour); !around(alert.ProjectedExhaustion, want) {
+		t.Errorf("projected exhaustion = %v, want %s", alert.ProjectedExhaustion, want)
+	}
+}
+
+func TestProjectExhaustion(t *testing.T) {
+	start := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	if _, ok := projectExhaustion(0, 100, start, start.Add(time.Hour)); ok {
+		t.Error("projected exhaustion without spend")
+	}
+	if _, ok := projectExhaustion(50, 100, start, start); ok {
+		t.Error("projected exhaustion at the start of the period")
+	}
+	got, ok := projectExhaustion(50, 100, start, start.Add(6*time.Hour))
+	if want := start.Add(12 * time.Hour); !ok || !around(&got, want) {
+		t.Errorf("projectExhaustion = %s, %v, want %s", got, ok, want)
+	}
+}
+
+func TestMonitorBudgetsInAccountTimeZone(t *testing.T) {
+	rules := testRules(t)
+	rules.location = time.FixedZone("EDT", -4*60*60)
+
+	// 18:00 UTC is 14:00 in the account, whose day began at 04:00 UTC.
+	saved := clk
+	clk = clock.NewManual(time.Date(2026, 3, 10, 18, 0, 0, 0, time.UTC), 0)
+	t.Cleanup(func() { clk = saved })
+
+	client := newMockAdsClient(t, mockResponse{
+		Match: []string{"campaign_budget.amount_micros"},
+		Rows: `[{
+			"campaign": {"id": "2001", "name": "Search - Generic", "status": "ENABLED"},
+			"campaignBudget": {"amountMicros": "100000000"},
+			"metrics": {"costMicros": "84000000"}
+		}]`,
+	})
+
+	alerts, err := monitorBudgets(context.Background(), client, rules, "1234567890")
+	if err != nil {
+		t.Fatalf("monitorBudgets: %v", err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	alert := alerts[0]
+	if alert.AlertType != AlertTypeBudgetNearlyExhausted || alert.CustomerID != "1234567890" {
+		t.Fatalf("alert = %s for %s, want %s for 1234567890", alert.AlertType, alert.CustomerID, AlertTypeBudgetNearlyExhausted)
+	}
+	// $84 in 14 hours is $6 an hour: the last $16 lasts 2h40m.
+	want := time.Date(2026, 3, 10, 20, 40, 0, 0, time.UTC)
+	if !around(alert.ProjectedExhaustion, want) {
+		t.Errorf("projected exhaustion = %v, want %s", alert.ProjectedExhaustion, want)
+	}
+}
+
+// around reports whether a projection is want to the second it is
+// rounded to.
+func around(got *time.Time, want time.Time) bool {
+	if got == nil {
+		return false
+	}
+	d := got.Sub(want)
+	return d > -time.Second && d < time.Second
+}
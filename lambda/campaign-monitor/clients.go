@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+)
+
+// The Google Ads messages the AdsClient trades, named here so the rest of
+// the package, and its tests, need not import the API package.
+type (
+	SearchRequest  = googleads.SearchGoogleAdsRequest
+	SearchResponse = googleads.SearchGoogleAdsResponse
+	StreamRequest  = googleads.SearchGoogleAdsStreamRequest
+	StreamResponse = googleads.SearchGoogleAdsStreamResponse
+	Row            = googleads.GoogleAdsRow
+)
+
+// AdsClient is the part of the Google Ads API the checks call. The
+// function hands them a *googleads.Service, through googleAdsService; a
+// test hands them a fake.
+type AdsClient interface {
+	Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error)
+	SearchStream(ctx context.Context, req *StreamRequest) (SearchStream, error)
+}
+
+// SearchStream yields a streamed search's batches of rows, then io.EOF.
+type SearchStream interface {
+	Recv() (*StreamResponse, error)
+}
+
+// SecretsProvider is the part of *secretsmanager.Client the Google Ads
+// credentials are read with.
+type SecretsProvider interface {
+	GetSecretValue(ctx context.Context, in *secretsmanager.GetSecretValueInput, opts ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// Publisher is the part of *sns.Client the alerts are published with.
+type Publisher interface {
+	Publish(ctx context.Context, in *sns.PublishInput, opts ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// EventPublisher is the part of *eventbridge.Client alerts are announced
+// on the platform bus with.
+type EventPublisher interface {
+	PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, opts ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// googleAdsService is the AdsClient over the Google Ads API.
+type googleAdsService struct {
+	*googleads.Service
+}
+
+func (s googleAdsService) SearchStream(ctx context.Context, req *StreamRequest) (SearchStream, error) {
+	stream, err := s.Service.SearchStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Monitor runs the campaign checks against the clients it was built with.
+type Monitor struct {
+	secrets   SecretsProvider
+	newAds    func(config *GoogleAdsConfig) (AdsClient, error)
+	publisher Publisher
+	bus       EventPublisher
+}
+
+// NewMonitor returns a Monitor that reads the Google Ads credentials with
+// secrets on each invocation, connects with newAds, publishes alerts with
+// publisher and announces them on bus; bus may be nil.
+func NewMonitor(secrets SecretsProvider, newAds func(config *GoogleAdsConfig) (AdsClient, error), publisher Publisher, bus EventPublisher) *Monitor {
+	return &Monitor{secrets: secrets, newAds: newAds, publisher: publisher, bus: bus}
+}
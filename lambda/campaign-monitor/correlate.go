@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"pkg/money"
+)
+
+// Envelope type and schema version of grouped alerts; see
+// notify.KindAlertGroup.
+const (
+	alertGroupMessageType   = "alert_group"
+	alertGroupSchemaVersion = 2
+)
+
+// Root causes inferred by the correlation pass.
+const (
+	CauseTrackingOutage  = "TRACKING_OUTAGE"
+	CauseAuctionPressure = "AUCTION_PRESSURE"
+	CauseBudgetChange    = "BUDGET_CHANGE"
+)
+
+// minAccountWideCampaigns is how many campaigns must raise the same
+// symptom in one run before it is blamed on the account rather than on
+// each campaign.
+const minAccountWideCampaigns = 3
+
+// AlertGroup is a set of alerts from one run that share a likely root
+// cause, sent as a single notification instead of one per alert.
+type AlertGroup struct {
+	CustomerID   string          `json:"customer_id"`
+	Cause        string          `json:"cause"`
+	Message      string          `json:"message"`
+	CampaignID   string          `json:"campaign_id,omitempty"`
+	CampaignName string          `json:"campaign_name,omitempty"`
+	Alerts       []CampaignAlert `json:"alerts"`
+}
+
+// accountActivity is what the correlation pass needs to know about the
+// campaigns that did not alert.
+type accountActivity struct {
+	Campaigns  int
+	Converting int
+}
+
+// correlateAlerts groups one account's alerts by likely root cause and
+// returns the groups and the alerts left to send on their own. Rules are
+// tried from the broadest cause down, and an alert joins at most one
+// group:
+//
+//   - TRACKING_OUTAGE: several campaigns spent without a single conversion
+//     and no campaign in the account converted, which points at the
+//     conversion tag or import rather than the campaigns.
+//   - AUCTION_PRESSURE: several campaigns hit high CPC at once, which
+//     points at the auction (competitors, seasonality) rather than bids.
+//   - BUDGET_CHANGE: one campaign raised performance and budget alerts
+//     together, which usually follows a budget or bid change on it.
+//
+// Lost impression share alerts point at growth rather than a fault, so
+// they are always sent on their own.
+func correlateAlerts(customerID string, alerts []CampaignAlert, activity accountActivity) ([]AlertGroup, []CampaignAlert) {
+	grouped := make([]bool, len(alerts))
+	var groups []AlertGroup
+
+	accountWide := func(cause string, match func(CampaignAlert) bool, message func([]CampaignAlert) string) {
+		var members []int
+		campaigns := make(map[string]bool)
+		for i, alert := range alerts {
+			if !grouped[i] && !isImpressionShareAlert(alert) && match(alert) {
+				members = append(members, i)
+				campaigns[alert.CampaignID] = true
+			}
+		}
+		if len(campaigns) < minAccountWideCampaigns {
+			return
+		}
+
+		group := AlertGroup{CustomerID: customerID, Cause: cause}
+		for _, i := range members {
+			grouped[i] = true
+			group.Alerts = append(group.Alerts, alerts[i])
+		}
+		group.Message = message(group.Alerts)
+		groups = append(groups, group)
+	}
+
+	if activity.Converting == 0 {
+		accountWide(CauseTrackingOutage,
+			func(a CampaignAlert) bool { return !isBudgetAlert(a) && a.Cost.AmountMicros > 0 && a.Conversions == 0 },
+			func(members []CampaignAlert) string {
+				return fmt.Sprintf("%d of %d campaigns spent %s without a conversion and none converted: "+
+					"check the conversion tag, Google tag and conversion imports before changing campaigns",
+					countCampaigns(members), activity.Campaigns, totalCost(customerID, members))
+			})
+	}
+
+	accountWide(CauseAuctionPressure,
+		func(a CampaignAlert) bool { return a.AlertType == "HIGH_CPC" },
+		func(members []CampaignAlert) string {
+			return fmt.Sprintf("CPC rose above the threshold on %d campaigns at once (%s): "+
+				"likely auction competition or seasonal demand rather than individual bids",
+				countCampaigns(members), campaignNames(members))
+		})
+
+	// Per campaign: a performance alert and a budget alert together.
+	byCampaign := make(map[string][]int)
+	var order []string
+	for i, alert := range alerts {
+		if grouped[i] || isImpressionShareAlert(alert) {
+			continue
+		}
+		if _, ok := byCampaign[alert.CampaignID]; !ok {
+			order = append(order, alert.CampaignID)
+		}
+		byCampaign[alert.CampaignID] = append(byCampaign[alert.CampaignID], i)
+	}
+	for _, campaignID := range order {
+		members := byCampaign[campaignID]
+		var budget, performance bool
+		for _, i := range members {
+			if isBudgetAlert(alerts[i]) {
+				budget = true
+			} else {
+				performance = true
+			}
+		}
+		if !budget || !performance {
+			continue
+		}
+
+		group := AlertGroup{
+			CustomerID:   customerID,
+			Cause:        CauseBudgetChange,
+			CampaignID:   campaignID,
+			CampaignName: alerts[members[0]].CampaignName,
+		}
+		var types []string
+		for _, i := range members {
+			grouped[i] = true
+			group.Alerts = append(group.Alerts, alerts[i])
+			types = append(types, alerts[i].AlertType)
+		}
+		group.Message = fmt.Sprintf("Campaign '%s' raised %s together: "+
+			"a recent budget or bid strategy change on it is the likely cause",
+			group.CampaignName, strings.Join(types, ", "))
+		groups = append(groups, group)
+	}
+
+	var rest []CampaignAlert
+	for i, alert := range alerts {
+		if !grouped[i] {
+			rest = append(rest, alert)
+		}
+	}
+	return groups, rest
+}
+
+func isBudgetAlert(alert CampaignAlert) bool {
+	return alert.AlertType == AlertTypeBudgetExhausted || alert.AlertType == AlertTypeBudgetNearlyExhausted
+}
+
+func countCampaigns(alerts []CampaignAlert) int {
+	campaigns := make(map[string]bool)
+	for _, alert := range alerts {
+		campaigns[alert.CampaignID] = true
+	}
+	return len(campaigns)
+}
+
+// totalCost renders the sum of the alerts' cost. They are from one
+// account, so in one currency; should they not be, it says "money" rather
+// than a sum of mixed currencies.
+func totalCost(customerID string, alerts []CampaignAlert) string {
+	var total money.Money
+	for _, alert := range alerts {
+		var err error
+		if total, err = total.Add(alert.Cost); err != nil {
+			log.Printf("Cannot total alert costs for customer %s: %v", customerID, err)
+			return "money"
+		}
+	}
+	return total.String()
+}
+
+// campaignNames lists up to five campaign names for a message.
+func campaignNames(alerts []CampaignAlert) string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, alert := range alerts {
+		if !seen[alert.CampaignName] {
+			seen[alert.CampaignName] = true
+			names = append(names, alert.CampaignName)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > 5 {
+		return strings.Join(names[:5], ", ") + fmt.Sprintf(" and %d more", len(names)-5)
+	}
+	return strings.Join(names, ", ")
+}
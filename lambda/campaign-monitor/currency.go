@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/ads"
+	"pkg/gaql"
+	"pkg/money"
+)
+
+// ruleCurrency is the currency the money thresholds in runs.go and spike.go
+// are written in. They are converted to each account's currency before its
+// checks run.
+const ruleCurrency = money.USD
+
+// fxRates converts thresholds into account currencies; see
+// money.StaticFromEnv for FX_RATES. Accounts in a currency it has no rate
+// for fail rather than be checked against dollar thresholds.
+var fxRates money.Provider = staticRates()
+
+func staticRates() money.Provider {
+	rates, err := money.StaticFromEnv()
+	if err != nil {
+		log.Printf("Ignoring FX_RATES, only %s accounts can be monitored: %v", ruleCurrency, err)
+		return money.Static{}
+	}
+	return rates
+}
+
+var accountCurrencyQuery = gaql.Select("customer.currency_code", "customer.time_zone").From("customer").MustBuild()
+
+// accountRules are the money thresholds of the alerting rules in one
+// account's currency, and the account's time zone.
+type accountRules struct {
+	currency string
+	// location is the account's time zone, in which Google Ads bounds
+	// TODAY and segments.date; UTC for the other platforms.
+	location *time.Location
+
+	highCostNoConversions float64
+	highCPC               float64
+	spendSpikeMinCost     float64
+	spendSpikeMinBaseline float64
+
+	// alert are the campaign performance rules, shared with the other ad
+	// platforms.
+	alert ads.AlertRules
+}
+
+// loadAccountRules reads the account's currency and time zone and converts
+// the alert thresholds to the currency.
+func loadAccountRules(ctx context.Context, client AdsClient, customerID string) (*accountRules, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      accountCurrencyQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account currency: %w", err)
+	}
+	if len(resp.Results) == 0 || resp.Results[0].Customer == nil || resp.Results[0].Customer.CurrencyCode == "" {
+		return nil, fmt.Errorf("customer %s has no currency", customerID)
+	}
+	rules, err := rulesIn(ctx, resp.Results[0].Customer.CurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+	if loc, err := time.LoadLocation(resp.Results[0].Customer.TimeZone); err == nil && resp.Results[0].Customer.TimeZone != "" {
+		rules.location = loc
+	}
+	return rules, nil
+}
+
+// rulesIn converts the alert thresholds to currency.
+func rulesIn(ctx context.Context, currency string) (*accountRules, error) {
+	rate, err := fxRates.Rate(ctx, ruleCurrency, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert alert thresholds to %s: %w", currency, err)
+	}
+	return &accountRules{
+		currency:              currency,
+		location:              time.UTC,
+		highCostNoConversions: highCostNoConversions * rate,
+		highCPC:               highCPCThreshold * rate,
+		spendSpikeMinCost:     spendSpikeMinCost * rate,
+		spendSpikeMinBaseline: spendSpikeMinBaseline * rate,
+
+		alert: ads.AlertRules{
+			Currency:              currency,
+			LowCTR:                lowCTRThreshold,
+			LowCTRMinImpressions:  lowCTRMinImpressions,
+			HighCostNoConversions: highCostNoConversions * rate,
+			HighCPC:               highCPCThreshold * rate,
+		},
+	}, nil
+}
+
+// amount returns units of the account's currency.
+func (r *accountRules) amount(units float64) money.Money {
+	return money.FromUnits(units, r.currency)
+}
+
+// micros returns a Google Ads micros amount in the account's currency.
+func (r *accountRules) micros(micros int64) money.Money {
+	return money.FromMicros(micros, r.currency)
+}
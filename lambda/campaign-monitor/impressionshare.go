@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/api/googleads"
+)
+
+// Lost impression share alert types. Both are only raised for profitable
+// campaigns, where the lost share is revenue left on the table rather than
+// spend saved.
+const (
+	AlertTypeLostISBudget = "LOST_IS_BUDGET"
+	AlertTypeLostISRank   = "LOST_IS_RANK"
+)
+
+var (
+	// lostISBudgetThreshold is the share of eligible search impressions a
+	// campaign must lose to its budget over the last 7 days to raise
+	// LOST_IS_BUDGET, and lostISRankThreshold the share lost to ad rank
+	// for LOST_IS_RANK.
+	lostISBudgetThreshold = parseFloatEnv("LOST_IS_BUDGET_THRESHOLD", 0.2)
+	lostISRankThreshold   = parseFloatEnv("LOST_IS_RANK_THRESHOLD", 0.3)
+	// lostISMinROAS is the conversion value to cost ratio over the same
+	// 7 days that makes a campaign profitable enough to grow. Campaigns
+	// without conversion values are never considered profitable.
+	lostISMinROAS = parseFloatEnv("LOST_IS_MIN_ROAS", 2.0)
+)
+
+// generateImpressionShareAlert flags a profitable search campaign losing
+// impressions it could have won: to its budget, with the daily budget that
+// would capture the lost share, or else to ad rank. Impression share is
+// only reported for search, so other campaigns never alert.
+func generateImpressionShareAlert(rules *accountRules, campaign *googleads.Campaign, budget *googleads.CampaignBudget, metrics *googleads.Metrics) *CampaignAlert {
+	share := metrics.SearchImpressionShare
+	if share <= 0 || metrics.CostMicros == 0 || metrics.ConversionsValue == 0 {
+		return nil
+	}
+	cost := rules.micros(metrics.CostMicros)
+	roas := metrics.ConversionsValue / cost.Units()
+	if roas < lostISMinROAS {
+		return nil
+	}
+
+	alert := &CampaignAlert{
+		CampaignID:                fmt.Sprintf("%d", campaign.Id),
+		CampaignName:              campaign.Name,
+		Status:                    campaign.Status.String(),
+		Impressions:               metrics.Impressions,
+		Clicks:                    metrics.Clicks,
+		Cost:                      cost,
+		Conversions:               metrics.Conversions,
+		CTR:                       metrics.Ctr,
+		CPC:                       rules.micros(metrics.AverageCpc),
+		ConversionRate:            metrics.ConversionRate,
+		ROAS:                      roas,
+		SearchImpressionShare:     share,
+		BudgetLostImpressionShare: metrics.SearchBudgetLostImpressionShare,
+		RankLostImpressionShare:   metrics.SearchRankLostImpressionShare,
+	}
+
+	lostToBudget := metrics.SearchBudgetLostImpressionShare
+	if lostToBudget >= lostISBudgetThreshold && budget != nil && budget.AmountMicros > 0 {
+		// Spend is taken to grow with impressions, so winning the share
+		// lost to budget takes the budget times (won + lost) / won.
+		current := rules.micros(budget.AmountMicros)
+		recommended := rules.amount(current.Units() * (share + lostToBudget) / share)
+		increase := rules.amount(recommended.Units() - current.Units())
+		alert.AlertType = AlertTypeLostISBudget
+		alert.BudgetPeriod = budget.Period.String()
+		alert.BudgetAmount = &current
+		alert.RecommendedBudget = &recommended
+		alert.BudgetIncrease = &increase
+		alert.Message = fmt.Sprintf("Campaign '%s' lost %.0f%% of search impressions to budget over the last 7 days at a %.1fx ROAS; "+
+			"raising its %s budget by about %s to %s could capture them",
+			campaign.Name, lostToBudget*100, roas, alert.BudgetPeriod, increase, recommended)
+		return alert
+	}
+
+	if lostToRank := metrics.SearchRankLostImpressionShare; lostToRank >= lostISRankThreshold {
+		alert.AlertType = AlertTypeLostISRank
+		alert.Message = fmt.Sprintf("Campaign '%s' lost %.0f%% of search impressions to ad rank over the last 7 days at a %.1fx ROAS; "+
+			"higher bids or better Quality Scores would win more of them",
+			campaign.Name, lostToRank*100, roas)
+		return alert
+	}
+
+	return nil
+}
+
+// isImpressionShareAlert reports whether alert is a growth opportunity
+// rather than a symptom, which correlation leaves alone.
+func isImpressionShareAlert(alert CampaignAlert) bool {
+	return alert.AlertType == AlertTypeLostISBudget || alert.AlertType == AlertTypeLostISRank
+}
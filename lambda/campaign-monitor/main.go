@@ -5,102 +5,451 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
-	"google.golang.org/api/option"
 	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/ads"
+	"pkg/clock"
+	"pkg/envelope"
+	"pkg/gaql"
+	gads "pkg/googleads"
+	_ "pkg/localdev"
+	"pkg/money"
+	"pkg/pool"
+	"pkg/runlog"
 )
 
 type GoogleAdsConfig struct {
-	ClientID      string `json:"client_id"`
-	ClientSecret  string `json:"client_secret"`
-	RefreshToken  string `json:"refresh_token"`
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
 	DeveloperToken string `json:"developer_token"`
 }
 
 type CampaignMonitorEvent struct {
-	Timestamp time.Time `json:"timestamp"`
-	Environment string  `json:"environment"`
+	Timestamp   time.Time `json:"timestamp"`
+	Environment string    `json:"environment"`
+
+	// Mode "hourly" only checks for spend spikes, "traffic" only runs
+	// the invalid traffic heuristics, "quality" only snapshots keyword
+	// Quality Scores and "self_check" only checks the function can reach
+	// its dependencies; anything else runs the full set of checks.
+	Mode string `json:"mode,omitempty"`
+
+	// ResumeRun continues an earlier run, given its run ID or the request
+	// ID of the invocation that started it, checking only the accounts it
+	// had not processed. The run's own mode is used.
+	ResumeRun string `json:"resume_run,omitempty"`
 }
 
+// Envelope type and schema version of published alerts; see
+// notify.KindCampaignAlert.
+const (
+	alertMessageType   = "campaign_alert"
+	alertSchemaVersion = 2
+)
+
+// CampaignAlert is one finding about a campaign. Amounts are in the
+// account's currency.
 type CampaignAlert struct {
-	CampaignID     string  `json:"campaign_id"`
-	CampaignName   string  `json:"campaign_name"`
-	Status         string  `json:"status"`
-	Impressions    int64   `json:"impressions"`
-	Clicks         int64   `json:"clicks"`
-	Cost           float64 `json:"cost"`
-	Conversions    int64   `json:"conversions"`
-	CTR            float64 `json:"ctr"`
-	CPC            float64 `json:"cpc"`
-	ConversionRate float64 `json:"conversion_rate"`
-	AlertType      string  `json:"alert_type"`
-	Message        string  `json:"message"`
+	CustomerID     string      `json:"customer_id"`
+	CampaignID     string      `json:"campaign_id"`
+	CampaignName   string      `json:"campaign_name"`
+	Status         string      `json:"status"`
+	Impressions    int64       `json:"impressions"`
+	Clicks         int64       `json:"clicks"`
+	Cost           money.Money `json:"cost"`
+	Conversions    int64       `json:"conversions"`
+	CTR            float64     `json:"ctr"`
+	CPC            money.Money `json:"cpc"`
+	ConversionRate float64     `json:"conversion_rate"`
+	AlertType      string      `json:"alert_type"`
+	Message        string      `json:"message"`
+
+	// RunID and ConfigHash identify the monitor run and the configuration
+	// that raised the alert; see GET /runs/campaign-monitor/{runId}.
+	RunID      string `json:"run_id,omitempty"`
+	ConfigHash string `json:"config_hash,omitempty"`
+
+	// Budget alerts only
+	BudgetPeriod        string       `json:"budget_period,omitempty"`
+	BudgetAmount        *money.Money `json:"budget_amount,omitempty"`
+	PercentConsumed     float64      `json:"percent_consumed,omitempty"`
+	ProjectedExhaustion *time.Time   `json:"projected_exhaustion,omitempty"`
+
+	// Ad, asset and keyword alerts only
+	AdGroupID      string        `json:"ad_group_id,omitempty"`
+	AdGroupName    string        `json:"ad_group_name,omitempty"`
+	AdID           string        `json:"ad_id,omitempty"`
+	AdStrength     string        `json:"ad_strength,omitempty"`
+	Headlines      int           `json:"headlines,omitempty"`
+	Descriptions   int           `json:"descriptions,omitempty"`
+	AssetID        string        `json:"asset_id,omitempty"`
+	AssetFieldType string        `json:"asset_field_type,omitempty"`
+	AssetText      string        `json:"asset_text,omitempty"`
+	KeywordID      string        `json:"keyword_id,omitempty"`
+	KeywordText    string        `json:"keyword_text,omitempty"`
+	MatchType      string        `json:"match_type,omitempty"`
+	PolicyTopics   []PolicyTopic `json:"policy_topics,omitempty"`
+
+	// Spend spike alerts only: the account-local hour that spiked, what
+	// it cost a week earlier and how many times that it cost now
+	SpikeDate     string       `json:"spike_date,omitempty"`
+	SpikeHour     *int         `json:"spike_hour,omitempty"`
+	BaselineCost  *money.Money `json:"baseline_cost,omitempty"`
+	SpendMultiple float64      `json:"spend_multiple,omitempty"`
+	// Season names the running seasonality events whose expected surge
+	// the spike went beyond.
+	Season []string `json:"season,omitempty"`
+
+	// Invalid traffic alerts only: the CTR a spike is compared with, the
+	// country or display placement drawing the clicks and its share of
+	// them, and what to do about it. SUSPICIOUS_CTR_SPIKE also sets
+	// SpikeDate.
+	BaselineCTR        float64 `json:"baseline_ctr,omitempty"`
+	CountryCriterionID int64   `json:"country_criterion_id,omitempty"`
+	ClickShare         float64 `json:"click_share,omitempty"`
+	Placement          string  `json:"placement,omitempty"`
+	PlacementType      string  `json:"placement_type,omitempty"`
+	RecommendedAction  string  `json:"recommended_action,omitempty"`
+
+	// Lost impression share alerts only: the share of eligible search
+	// impressions won and lost over the last 7 days, the campaign's ROAS
+	// and, for LOST_IS_BUDGET, the budget that would win the lost share.
+	// BudgetAmount and BudgetPeriod hold the current budget.
+	SearchImpressionShare     float64      `json:"search_impression_share,omitempty"`
+	BudgetLostImpressionShare float64      `json:"budget_lost_impression_share,omitempty"`
+	RankLostImpressionShare   float64      `json:"rank_lost_impression_share,omitempty"`
+	ROAS                      float64      `json:"roas,omitempty"`
+	RecommendedBudget         *money.Money `json:"recommended_budget,omitempty"`
+	BudgetIncrease            *money.Money `json:"budget_increase,omitempty"`
+
+	// Quality score alerts only: the keyword's Quality Score now and at
+	// the previous snapshot, and the components it is rated on now
+	QualityScore          int64  `json:"quality_score,omitempty"`
+	PreviousQualityScore  int64  `json:"previous_quality_score,omitempty"`
+	PreviousQualityDate   string `json:"previous_quality_date,omitempty"`
+	ExpectedCTR           string `json:"expected_ctr,omitempty"`
+	AdRelevance           string `json:"ad_relevance,omitempty"`
+	LandingPageExperience string `json:"landing_page_experience,omitempty"`
+}
+
+// PolicyTopic is one policy finding behind a disapproval, e.g.
+// {"topic": "TRADEMARKS_IN_AD_TEXT", "type": "PROHIBITED"}.
+type PolicyTopic struct {
+	Topic string `json:"topic"`
+	Type  string `json:"type,omitempty"`
 }
 
+// Campaign performance over the last 7 days, with the search impression
+// share won and lost for LOST_IS_BUDGET and LOST_IS_RANK.
+var campaignPerformanceQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"campaign_budget.amount_micros",
+	"campaign_budget.period",
+	"metrics.impressions",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+	"metrics.ctr",
+	"metrics.average_cpc",
+	"metrics.conversion_rate",
+	"metrics.conversions_value",
+	"metrics.search_impression_share",
+	"metrics.search_budget_lost_impression_share",
+	"metrics.search_rank_lost_impression_share",
+).From("campaign").
+	Where("campaign.status", gaql.NotEquals, "REMOVED").
+	During(gaql.Last7Days).
+	MustBuild()
+
 var (
-	secretName   = os.Getenv("GOOGLE_ADS_SECRET_ARN")
-	snsTopicARN  = os.Getenv("SNS_TOPIC_ARN")
+	secretName  = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	snsTopicARN = os.Getenv("SNS_TOPIC_ARN")
+	// eventBusName is the platform bus alerts are announced on; unset, they
+	// only go to the topic.
+	eventBusName = os.Getenv("EVENT_BUS_NAME")
 	environment  = os.Getenv("ENVIRONMENT")
+
+	// clk is the time source for timestamps and pacing; deterministic when
+	// TEST_MODE=true.
+	clk = clock.FromEnv()
+
+	// emf collects the invocation's metrics for CloudWatch.
+	emf = gads.Metrics("campaign-monitor", environment, clk)
+
+	// adsCalls makes the Google Ads calls of all workers, paced together;
+	// see pool.GoogleAdsThrottleFromEnv and, for the retries,
+	// retry.GoogleAdsFromEnv.
+	adsCalls = gads.New(emf, pool.GoogleAdsThrottleFromEnv(clk))
+
+	// accountConcurrency is how many accounts are checked at once, and
+	// queryConcurrency how many of an account's checks query at once.
+	accountConcurrency = pool.LimitFromEnv("ACCOUNT_CONCURRENCY", 4)
+	queryConcurrency   = pool.LimitFromEnv("ACCOUNT_QUERY_CONCURRENCY", 4)
 )
 
 func main() {
-	lambda.Start(HandleCampaignMonitor)
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+	var bus EventPublisher
+	if eventBusName != "" {
+		bus = eventbridge.NewFromConfig(cfg)
+	}
+	monitor := NewMonitor(secretsmanager.NewFromConfig(cfg), createGoogleAdsClient, sns.NewFromConfig(cfg), bus)
+	lambda.Start(monitor.HandleCampaignMonitor)
 }
 
-func HandleCampaignMonitor(ctx context.Context, event interface{}) error {
-	log.Printf("Starting campaign monitoring for environment: %s", environment)
+// HandleCampaignMonitor runs the event's checks over every account in the
+// rotation. Each account's alerts are published as soon as it is checked
+// and the account is then checkpointed on the run, so a retried or resumed
+// run only checks the accounts that are still pending.
+func (m *Monitor) HandleCampaignMonitor(ctx context.Context, event CampaignMonitorEvent) (err error) {
+	if event.Mode == ModeSelfCheck {
+		return m.selfCheck(ctx)
+	}
+	defer flushMetrics()
+
+	run, recorder := startRun(ctx, event.Mode, event.ResumeRun)
+	defer func() { finishRun(ctx, recorder, run, err) }()
+
+	switch run.Mode {
+	case ModeHourly:
+		log.Printf("Starting hourly spend spike check for environment: %s (run %s, config %s)", environment, run.RunID, run.ConfigHash)
+	case ModeTraffic:
+		log.Printf("Starting invalid traffic check for environment: %s (run %s, config %s)", environment, run.RunID, run.ConfigHash)
+	case ModeQuality:
+		log.Printf("Starting quality score snapshot for environment: %s (run %s, config %s)", environment, run.RunID, run.ConfigHash)
+	default:
+		log.Printf("Starting campaign monitoring for environment: %s (run %s, config %s)", environment, run.RunID, run.ConfigHash)
+	}
 
 	// Load Google Ads configuration
-	config, err := loadGoogleAdsConfig(ctx)
+	config, err := loadGoogleAdsConfig(ctx, m.secrets)
 	if err != nil {
 		return fmt.Errorf("failed to load Google Ads config: %w", err)
 	}
 
 	// Initialize Google Ads client
-	client, err := createGoogleAdsClient(config)
+	client, err := m.newAds(config)
 	if err != nil {
 		return fmt.Errorf("failed to create Google Ads client: %w", err)
 	}
 
-	// Monitor campaigns
-	alerts, err := monitorCampaigns(ctx, client)
-	if err != nil {
-		return fmt.Errorf("failed to monitor campaigns: %w", err)
+	// A resumed run keeps the rotation it started with.
+	customerIDs := run.CustomerIDs
+	if len(customerIDs) == 0 {
+		customerIDs, err = loadCustomerIDs(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load customer accounts: %w", err)
+		}
+		planRun(ctx, recorder, run, customerIDs)
 	}
 
-	// Send alerts if any
-	if len(alerts) > 0 {
-		if err := sendAlerts(ctx, alerts); err != nil {
-			return fmt.Errorf("failed to send alerts: %w", err)
+	var findings *findingStore
+	if run.Mode == ModeTraffic {
+		if findings, err = newFindingStore(ctx); err != nil {
+			return fmt.Errorf("failed to open findings table: %w", err)
+		}
+	}
+	var qualityScores *qualityStore
+	if run.Mode == ModeQuality {
+		if qualityScores, err = newQualityStore(ctx); err != nil {
+			return fmt.Errorf("failed to open quality score store: %w", err)
 		}
-		log.Printf("Sent %d campaign alerts", len(alerts))
-	} else {
-		log.Println("No campaign alerts generated")
 	}
 
-	log.Printf("Campaign monitoring completed successfully")
+	// Monitor campaigns for every account in the rotation, up to
+	// accountConcurrency at a time. One account failing must not stop the
+	// others from being checked.
+	pending := run.Pending()
+	skipped := len(customerIDs) - len(pending)
+	var mu sync.Mutex
+	var failed, generated int
+	pool.Each(ctx, accountConcurrency, pending, func(ctx context.Context, customerID string) error {
+		alerts, err := m.monitorAccount(ctx, client, run, customerID, findings, qualityScores)
+
+		mu.Lock()
+		defer mu.Unlock()
+		checkpoint(ctx, recorder, run, customerID, err)
+		if err != nil {
+			log.Printf("Failed to monitor customer %s: %v", customerID, err)
+			failed++
+			return nil
+		}
+		generated += alerts
+		return nil
+	})
+	run.Accounts = len(customerIDs)
+	run.AccountsFailed = failed
+	run.Results += generated
+	emf.Count("AccountsFailed", failed)
+	emf.Count("AccountsSkipped", skipped)
+	emf.Count("AlertsGenerated", generated)
+	if skipped > 0 {
+		log.Printf("Skipped %d accounts already processed by run %s", skipped, run.RunID)
+	}
+	if failed > 0 && failed == len(pending) {
+		return fmt.Errorf("failed to monitor campaigns for all %d accounts", failed)
+	}
+
+	log.Printf("Campaign monitoring completed successfully: %d alerts from %d accounts", generated, len(pending)-failed)
 	return nil
 }
 
-func loadGoogleAdsConfig(ctx context.Context) (*GoogleAdsConfig, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+// monitorAccount runs the mode's checks for one account and publishes its
+// alerts, returning how many were generated. Accounts on other ad
+// platforms are handed to monitorPlatformAccount.
+func (m *Monitor) monitorAccount(ctx context.Context, client AdsClient, run *runlog.Run, customerID string, findings *findingStore, qualityScores *qualityStore) (int, error) {
+	if account := ads.ParseAccount(customerID); account.Platform != ads.Google {
+		return m.monitorPlatformAccount(ctx, run, account)
+	}
+
+	rules, err := loadAccountRules(ctx, client, customerID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		return 0, fmt.Errorf("failed to load alert thresholds: %w", err)
+	}
+
+	var alerts []CampaignAlert
+	var groups []AlertGroup
+	generated := 0
+	switch run.Mode {
+	case ModeHourly:
+		alerts, err = monitorSpendSpikes(ctx, client, rules, customerID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check spend spikes: %w", err)
+		}
+		stampRun(run, alerts)
+		generated = len(alerts)
+	case ModeTraffic:
+		trafficAlerts, err := monitorTraffic(ctx, client, rules, customerID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check invalid traffic: %w", err)
+		}
+		stampRun(run, trafficAlerts)
+		generated = len(trafficAlerts)
+		alerts = recordFindings(ctx, findings, trafficAlerts)
+	case ModeQuality:
+		alerts, err = monitorQualityScores(ctx, client, qualityScores, customerID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check quality scores: %w", err)
+		}
+		stampRun(run, alerts)
+		generated = len(alerts)
+	default:
+		// The checks query independently, so they run side by side; the
+		// alerts keep the order the checks are listed in.
+		var campaignAlerts, budgetAlerts, assetAlerts, policyAlerts []CampaignAlert
+		var activity accountActivity
+		err := pool.Run(ctx, queryConcurrency,
+			func(ctx context.Context) error {
+				var err error
+				campaignAlerts, activity, err = monitorCampaigns(ctx, client, rules, customerID)
+				if err != nil {
+					return fmt.Errorf("failed to monitor campaigns: %w", err)
+				}
+				return nil
+			},
+			func(ctx context.Context) error {
+				var err error
+				if budgetAlerts, err = monitorBudgets(ctx, client, rules, customerID); err != nil {
+					log.Printf("Failed to monitor budgets for customer %s: %v", customerID, err)
+				}
+				return nil
+			},
+			func(ctx context.Context) error {
+				var err error
+				if assetAlerts, err = monitorAdAssets(ctx, client, customerID); err != nil {
+					log.Printf("Failed to monitor ad assets for customer %s: %v", customerID, err)
+				}
+				return nil
+			},
+			func(ctx context.Context) error {
+				var err error
+				if policyAlerts, err = monitorPolicy(ctx, client, customerID); err != nil {
+					log.Printf("Failed to monitor policy for customer %s: %v", customerID, err)
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			return 0, err
+		}
+		var accountAlerts []CampaignAlert
+		accountAlerts = append(accountAlerts, campaignAlerts...)
+		accountAlerts = append(accountAlerts, budgetAlerts...)
+		accountAlerts = append(accountAlerts, assetAlerts...)
+		accountAlerts = append(accountAlerts, policyAlerts...)
+		stampRun(run, accountAlerts)
+		generated = len(accountAlerts)
+
+		// Alerts sharing a likely root cause go out as one notification.
+		groups, alerts = correlateAlerts(customerID, accountAlerts, activity)
+		emf.Count("AlertGroups", len(groups))
+	}
+
+	if len(alerts) == 0 && len(groups) == 0 {
+		return generated, nil
+	}
+	if err := sendAlerts(ctx, m.publisher, alerts, groups); err != nil {
+		return 0, fmt.Errorf("failed to send alerts: %w", err)
+	}
+	m.publishAlertEvents(ctx, alerts, groups)
+	log.Printf("Sent %d campaign alerts and %d alert groups for customer %s", len(alerts), len(groups), customerID)
+	return generated, nil
+}
+
+// stampRun tags alerts with the run that raised them.
+func stampRun(run *runlog.Run, alerts []CampaignAlert) {
+	for i := range alerts {
+		alerts[i].RunID = run.RunID
+		alerts[i].ConfigHash = run.ConfigHash
+	}
+}
+
+// search runs a Google Ads query through adsCalls.
+func search(ctx context.Context, client AdsClient, req *googleads.SearchGoogleAdsRequest) (*googleads.SearchGoogleAdsResponse, error) {
+	return gads.Search(ctx, adsCalls, func(ctx context.Context) (*googleads.SearchGoogleAdsResponse, error) {
+		return client.Search(ctx, req)
+	}, func(resp *googleads.SearchGoogleAdsResponse) int { return len(resp.Results) })
+}
+
+// searchStream runs a query that can return too many rows to hold at once
+// through adsCalls; see gads.SearchStream.
+func searchStream(ctx context.Context, client AdsClient, req *googleads.SearchGoogleAdsStreamRequest, fn func(row *googleads.GoogleAdsRow) error) error {
+	return gads.SearchStream(ctx, adsCalls, func(ctx context.Context) (gads.Stream[*googleads.SearchGoogleAdsStreamResponse], error) {
+		return client.SearchStream(ctx, req)
+	}, func(resp *googleads.SearchGoogleAdsStreamResponse) []*googleads.GoogleAdsRow { return resp.Results }, fn)
+}
+
+func flushMetrics() {
+	if err := emf.Flush(); err != nil {
+		log.Printf("Failed to flush metrics: %v", err)
 	}
+}
 
-	svc := secretsmanager.NewFromConfig(cfg)
+func loadGoogleAdsConfig(ctx context.Context, secrets SecretsProvider) (*GoogleAdsConfig, error) {
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId: aws.String(secretName),
 	}
 
-	result, err := svc.GetSecretValue(ctx, input)
+	result, err := secrets.GetSecretValue(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
 	}
@@ -114,169 +463,147 @@ func loadGoogleAdsConfig(ctx context.Context) (*GoogleAdsConfig, error) {
 }
 
 func createGoogleAdsConfig(config *GoogleAdsConfig) []option.ClientOption {
-	return []option.ClientOption{
+	opts := []option.ClientOption{
 		option.WithCredentialsFile(config),
 		option.WithScopes(googleads.GoogleAdsScope),
 	}
+	// GOOGLE_ADS_ENDPOINT points the client at a stand-in API such as the
+	// mock server run by cmd/e2e.
+	if endpoint := os.Getenv("GOOGLE_ADS_ENDPOINT"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	return opts
 }
 
-func createGoogleAdsClient(config *GoogleAdsConfig) (*googleads.Service, error) {
+func createGoogleAdsClient(config *GoogleAdsConfig) (AdsClient, error) {
 	ctx := context.Background()
 	opts := createGoogleAdsConfig(config)
-	
+
 	srv, err := googleads.NewService(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
 	}
 
-	return srv, nil
+	return googleAdsService{srv}, nil
 }
 
-func monitorCampaigns(ctx context.Context, client *googleads.Service) ([]CampaignAlert, error) {
+func monitorCampaigns(ctx context.Context, client AdsClient, rules *accountRules, customerID string) ([]CampaignAlert, accountActivity, error) {
 	var alerts []CampaignAlert
-
-	// Get customer ID (you might want to store this in config or environment)
-	customerID := os.Getenv("GOOGLE_ADS_CUSTOMER_ID")
-	if customerID == "" {
-		return nil, fmt.Errorf("GOOGLE_ADS_CUSTOMER_ID environment variable not set")
-	}
-
-	// Query campaigns from the last 24 hours
-	query := fmt.Sprintf(`
-		SELECT 
-			campaign.id,
-			campaign.name,
-			campaign.status,
-			metrics.impressions,
-			metrics.clicks,
-			metrics.cost_micros,
-			metrics.conversions,
-			metrics.ctr,
-			metrics.average_cpc,
-			metrics.conversion_rate
-		FROM campaign
-		WHERE 
-			campaign.status != 'REMOVED'
-			AND segments.date DURING LAST_7_DAYS
-	`)
+	var activity accountActivity
 
 	req := &googleads.SearchGoogleAdsRequest{
 		CustomerId: customerID,
-		Query:      query,
+		Query:      campaignPerformanceQuery,
 	}
 
-	resp, err := client.Search(ctx, req)
+	resp, err := search(ctx, client, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search campaigns: %w", err)
+		return nil, activity, fmt.Errorf("failed to search campaigns: %w", err)
 	}
 
 	for _, row := range resp.Results {
 		campaign := row.Campaign
 		metrics := row.Metrics
 
-		// Convert micros to dollars
-		cost := float64(metrics.CostMicros) / 1000000.0
-		cpc := float64(metrics.AverageCpc) / 1000000.0
+		activity.Campaigns++
+		if metrics.Conversions > 0 {
+			activity.Converting++
+		}
 
 		// Generate alerts based on performance metrics
-		alert := generateAlert(campaign, metrics, cost, cpc)
+		alert := generateAlert(rules, campaignMetrics(rules, row))
 		if alert != nil {
+			alert.CustomerID = customerID
+			alerts = append(alerts, *alert)
+		}
+
+		if alert := generateImpressionShareAlert(rules, campaign, row.CampaignBudget, metrics); alert != nil {
+			alert.CustomerID = customerID
 			alerts = append(alerts, *alert)
 		}
 	}
 
-	return alerts, nil
+	return alerts, activity, nil
 }
 
-func generateAlert(campaign *googleads.Campaign, metrics *googleads.Metrics, cost, cpc float64) *CampaignAlert {
-	// Low performance alert
-	if metrics.Impressions > 1000 && metrics.Ctr < 0.5 {
-		return &CampaignAlert{
-			CampaignID:     fmt.Sprintf("%d", campaign.Id),
-			CampaignName:   campaign.Name,
-			Status:         campaign.Status.String(),
-			Impressions:    metrics.Impressions,
-			Clicks:         metrics.Clicks,
-			Cost:           cost,
-			Conversions:    metrics.Conversions,
-			CTR:            metrics.Ctr,
-			CPC:            cpc,
-			ConversionRate: metrics.ConversionRate,
-			AlertType:      "LOW_PERFORMANCE",
-			Message:        fmt.Sprintf("Campaign '%s' has low CTR: %.2f%%", campaign.Name, metrics.Ctr*100),
-		}
+// generateAlert applies the campaign performance rules, which every ad
+// platform shares; see ads.AlertRules.
+func generateAlert(rules *accountRules, m ads.Metrics) *CampaignAlert {
+	alertType, message := rules.alert.Check(m)
+	if alertType == "" {
+		return nil
+	}
+	return &CampaignAlert{
+		CampaignID:     m.CampaignID,
+		CampaignName:   m.CampaignName,
+		Status:         m.CampaignStatus,
+		Impressions:    m.Impressions,
+		Clicks:         m.Clicks,
+		Cost:           m.Cost,
+		Conversions:    int64(math.Round(m.Conversions)),
+		CTR:            m.CTR(),
+		CPC:            m.AverageCPC(),
+		ConversionRate: m.ConversionRate(),
+		AlertType:      alertType,
+		Message:        message,
 	}
+}
+
+func sendAlerts(ctx context.Context, publisher Publisher, alerts []CampaignAlert, groups []AlertGroup) error {
+	codec := envelope.New("campaign-monitor", nil, "", clk)
 
-	// High cost alert
-	if cost > 100.0 && metrics.Conversions == 0 {
-		return &CampaignAlert{
-			CampaignID:     fmt.Sprintf("%d", campaign.Id),
-			CampaignName:   campaign.Name,
-			Status:         campaign.Status.String(),
-			Impressions:    metrics.Impressions,
-			Clicks:         metrics.Clicks,
-			Cost:           cost,
-			Conversions:    metrics.Conversions,
-			CTR:            metrics.Ctr,
-			CPC:            cpc,
-			ConversionRate: metrics.ConversionRate,
-			AlertType:      "HIGH_COST_NO_CONVERSIONS",
-			Message:        fmt.Sprintf("Campaign '%s' has high cost ($%.2f) with no conversions", campaign.Name, cost),
+	for _, group := range groups {
+		subject := fmt.Sprintf("%s Alert: %s - %d alerts", platformTitle(group.CustomerID), group.Cause, len(group.Alerts))
+		meta := envelope.Meta{Type: alertGroupMessageType, SchemaVersion: alertGroupSchemaVersion, Tenant: group.CustomerID}
+		if err := publishAlert(ctx, publisher, codec, meta, subject, group); err != nil {
+			log.Printf("Failed to publish alert group: %v", err)
+			continue
 		}
+
+		log.Printf("Sent %s alert group of %d alerts for customer: %s", group.Cause, len(group.Alerts), group.CustomerID)
 	}
 
-	// High CPC alert
-	if cpc > 5.0 {
-		return &CampaignAlert{
-			CampaignID:     fmt.Sprintf("%d", campaign.Id),
-			CampaignName:   campaign.Name,
-			Status:         campaign.Status.String(),
-			Impressions:    metrics.Impressions,
-			Clicks:         metrics.Clicks,
-			Cost:           cost,
-			Conversions:    metrics.Conversions,
-			CTR:            metrics.Ctr,
-			CPC:            cpc,
-			ConversionRate: metrics.ConversionRate,
-			AlertType:      "HIGH_CPC",
-			Message:        fmt.Sprintf("Campaign '%s' has high CPC: $%.2f", campaign.Name, cpc),
+	for _, alert := range alerts {
+		subject := fmt.Sprintf("%s Alert: %s - %s", platformTitle(alert.CustomerID), alert.AlertType, alert.CampaignName)
+		meta := envelope.Meta{Type: alertMessageType, SchemaVersion: alertSchemaVersion, Tenant: alert.CustomerID}
+		if err := publishAlert(ctx, publisher, codec, meta, subject, alert); err != nil {
+			log.Printf("Failed to publish alert: %v", err)
+			continue
 		}
+
+		log.Printf("Sent alert for campaign: %s", alert.CampaignName)
 	}
 
 	return nil
 }
 
-func sendAlerts(ctx context.Context, alerts []CampaignAlert) error {
-	cfg, err := config.LoadDefaultConfig(ctx)
+func publishAlert(ctx context.Context, publisher Publisher, codec *envelope.Codec, meta envelope.Meta, subject string, payload interface{}) error {
+	message, err := codec.Seal(ctx, meta, payload)
 	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %w", err)
+		return fmt.Errorf("failed to seal message: %w", err)
 	}
 
-	svc := sns.NewFromConfig(cfg)
-
-	for _, alert := range alerts {
-		message, err := json.Marshal(alert)
-		if err != nil {
-			log.Printf("Failed to marshal alert: %v", err)
-			continue
-		}
-
-		subject := fmt.Sprintf("Google Ads Alert: %s - %s", alert.AlertType, alert.CampaignName)
-
-		input := &sns.PublishInput{
-			Message:  aws.String(string(message)),
-			Subject:  aws.String(subject),
-			TopicArn: aws.String(snsTopicARN),
-		}
+	input := &sns.PublishInput{
+		Message:  aws.String(message),
+		Subject:  aws.String(subject),
+		TopicArn: aws.String(snsTopicARN),
+	}
 
-		_, err = svc.Publish(ctx, input)
-		if err != nil {
-			log.Printf("Failed to publish alert: %v", err)
-			continue
-		}
+	_, err = publisher.Publish(ctx, input)
+	return err
+}
 
-		log.Printf("Sent alert for campaign: %s", alert.CampaignName)
+// Utility functions
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(getEnv(key, ""), 64); err == nil {
+		return value
 	}
+	return defaultValue
+}
 
-	return nil
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"pkg/ads"
+	"pkg/money"
+)
+
+// testRules are the alert thresholds in US dollars, in UTC.
+func testRules(t *testing.T) *accountRules {
+	t.Helper()
+	rules, err := rulesIn(context.Background(), money.USD)
+	if err != nil {
+		t.Fatalf("rulesIn: %v", err)
+	}
+	return rules
+}
+
+func TestGenerateAlert(t *testing.T) {
+	rules := testRules(t)
+
+	tests := []struct {
+		name    string
+		metrics ads.Metrics
+		want    string
+	}{
+		{
+			name:    "low CTR",
+			metrics: ads.Metrics{Impressions: 5000, Clicks: 50, Conversions: 5, Cost: money.FromUnits(50, money.USD)},
+			want:    ads.AlertLowPerformance,
+		},
+		{
+			name:    "too few impressions to judge CTR",
+			metrics: ads.Metrics{Impressions: 800, Clicks: 8, Conversions: 1, Cost: money.FromUnits(8, money.USD)},
+		},
+		{
+			name:    "high cost without conversions",
+			metrics: ads.Metrics{Impressions: 500, Clicks: 60, Cost: money.FromUnits(150, money.USD)},
+			want:    ads.AlertHighCostNoConversions,
+		},
+		{
+			name:    "high CPC",
+			metrics: ads.Metrics{Impressions: 500, Clicks: 10, Conversions: 2, Cost: money.FromUnits(80, money.USD)},
+			want:    ads.AlertHighCPC,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.metrics.CampaignID = "2001"
+			tt.metrics.CampaignName = "Search - Generic"
+
+			alert := generateAlert(rules, tt.metrics)
+			if tt.want == "" {
+				if alert != nil {
+					t.Fatalf("got %s alert, want none", alert.AlertType)
+				}
+				return
+			}
+			if alert == nil {
+				t.Fatalf("got no alert, want %s", tt.want)
+			}
+			if alert.AlertType != tt.want {
+				t.Errorf("alert = %s, want %s", alert.AlertType, tt.want)
+			}
+			if alert.CampaignID != "2001" || !strings.Contains(alert.Message, "Search - Generic") {
+				t.Errorf("alert is not about the campaign: %+v", alert)
+			}
+		})
+	}
+}
+
+func TestGenerateAlertConvertsThresholds(t *testing.T) {
+	saved := fxRates
+	fxRates = money.Static{"JPY": 150}
+	t.Cleanup(func() { fxRates = saved })
+	rules, err := rulesIn(context.Background(), "JPY")
+	if err != nil {
+		t.Fatalf("rulesIn: %v", err)
+	}
+
+	// ¥600 a click is $4: under the $5 threshold once converted.
+	m := ads.Metrics{CampaignName: "Search - JP", Impressions: 500, Clicks: 10, Conversions: 2, Cost: money.FromUnits(6000, "JPY")}
+	if alert := generateAlert(rules, m); alert != nil {
+		t.Errorf("got %s alert for a CPC under the converted threshold", alert.AlertType)
+	}
+}
+
+const campaignRows = `[
+	{
+		"campaign": {"id": "2001", "name": "Search - Generic", "status": "ENABLED"},
+		"metrics": {"impressions": "500", "clicks": "60", "costMicros": "150000000", "conversions": 0}
+	},
+	{
+		"campaign": {"id": "2002", "name": "Search - Brand", "status": "ENABLED"},
+		"metrics": {"impressions": "800", "clicks": "40", "costMicros": "40000000", "conversions": 4}
+	}
+]`
+
+func TestMonitorCampaigns(t *testing.T) {
+	rules := testRules(t)
+	client := newMockAdsClient(t, mockResponse{Match: []string{"FROM campaign", "metrics.impressions"}, Rows: campaignRows})
+
+	alerts, activity, err := monitorCampaigns(context.Background(), client, rules, "1234567890")
+	if err != nil {
+		t.Fatalf("monitorCampaigns: %v", err)
+	}
+	if activity.Campaigns != 2 || activity.Converting != 1 {
+		t.Errorf("activity = %+v, want 2 campaigns, 1 converting", activity)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if a := alerts[0]; a.AlertType != ads.AlertHighCostNoConversions || a.CampaignID != "2001" || a.CustomerID != "1234567890" {
+		t.Errorf("alert = %s for %s/%s, want HIGH_COST_NO_CONVERSIONS for 1234567890/2001", a.AlertType, a.CustomerID, a.CampaignID)
+	}
+}
+
+func TestSendAlerts(t *testing.T) {
+	alerts := []CampaignAlert{
+		{CustomerID: "1234567890", CampaignName: "Search - Generic", AlertType: ads.AlertHighCPC},
+		{CustomerID: "1234567890", CampaignName: "Search - Brand", AlertType: ads.AlertLowPerformance},
+	}
+	groups := []AlertGroup{{CustomerID: "1234567890", Cause: CauseAuctionPressure, Alerts: alerts}}
+
+	publisher := &mockPublisher{}
+	if err := sendAlerts(context.Background(), publisher, alerts, groups); err != nil {
+		t.Fatalf("sendAlerts: %v", err)
+	}
+	if len(publisher.published) != 3 {
+		t.Fatalf("published %d messages, want the group and both alerts", len(publisher.published))
+	}
+	if subject := *publisher.published[0].Subject; !strings.HasSuffix(subject, "Alert: AUCTION_PRESSURE - 2 alerts") {
+		t.Errorf("group subject = %q", subject)
+	}
+	if subject := *publisher.published[1].Subject; !strings.HasSuffix(subject, fmt.Sprintf("Alert: %s - Search - Generic", ads.AlertHighCPC)) {
+		t.Errorf("alert subject = %q", subject)
+	}
+
+	// A failed publish is logged and the rest still go out.
+	failing := &mockPublisher{err: errors.New("topic not found")}
+	if err := sendAlerts(context.Background(), failing, alerts, nil); err != nil {
+		t.Errorf("sendAlerts = %v, want failures only logged", err)
+	}
+}
+
+func TestPublishAlertEvents(t *testing.T) {
+	var alerts []CampaignAlert
+	for i := 0; i < maxPutEventsEntries+2; i++ {
+		alerts = append(alerts, CampaignAlert{CustomerID: "1234567890", CampaignID: fmt.Sprint(2000 + i), AlertType: ads.AlertHighCPC})
+	}
+	bus := &mockEvents{}
+	NewMonitor(&mockSecrets{}, nil, &mockPublisher{}, bus).publishAlertEvents(context.Background(), alerts, nil)
+
+	if len(bus.batches) != 2 {
+		t.Fatalf("sent %d batches, want 2", len(bus.batches))
+	}
+	if n := len(bus.batches[0].Entries) + len(bus.batches[1].Entries); n != len(alerts) {
+		t.Errorf("sent %d events, want %d", n, len(alerts))
+	}
+
+	// Without a bus nothing is announced.
+	NewMonitor(&mockSecrets{}, nil, &mockPublisher{}, nil).publishAlertEvents(context.Background(), alerts, nil)
+}
+
+func TestLoadGoogleAdsConfig(t *testing.T) {
+	secrets := &mockSecrets{value: `{"client_id": "id", "client_secret": "secret", "refresh_token": "refresh", "developer_token": "dev"}`}
+
+	config, err := loadGoogleAdsConfig(context.Background(), secrets)
+	if err != nil {
+		t.Fatalf("loadGoogleAdsConfig: %v", err)
+	}
+	if config.ClientID != "id" || config.RefreshToken != "refresh" || config.DeveloperToken != "dev" {
+		t.Errorf("config = %+v", config)
+	}
+	if len(secrets.requested) != 1 || secrets.requested[0] != secretName {
+		t.Errorf("read secrets %v, want [%s]", secrets.requested, secretName)
+	}
+
+	failing := &mockSecrets{err: errors.New("access denied")}
+	if _, err := loadGoogleAdsConfig(context.Background(), failing); err == nil {
+		t.Error("loadGoogleAdsConfig succeeded without the secret")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// mockResponse is one canned search result: the rows, in the REST API's
+// JSON as in cmd/e2e/fixtures/googleads.json, answering a query that
+// contains every Match string.
+type mockResponse struct {
+	Match []string
+	Rows  string
+}
+
+// mockAdsClient is an AdsClient answering searches, streamed or not, with
+// the first response whose Match strings all occur in the query, and no
+// rows when none does. It records the queries.
+type mockAdsClient struct {
+	t         *testing.T
+	responses []mockResponse
+
+	mu       sync.Mutex
+	searches []string
+}
+
+func newMockAdsClient(t *testing.T, responses ...mockResponse) *mockAdsClient {
+	return &mockAdsClient{t: t, responses: responses}
+}
+
+func (m *mockAdsClient) rows(query string) []*Row {
+	m.mu.Lock()
+	m.searches = append(m.searches, query)
+	m.mu.Unlock()
+
+	for _, resp := range m.responses {
+		matched := true
+		for _, s := range resp.Match {
+			matched = matched && strings.Contains(query, s)
+		}
+		if !matched {
+			continue
+		}
+		return decodeRows(m.t, resp.Rows)
+	}
+	return nil
+}
+
+// decodeRows reads rows written in the REST API's JSON.
+func decodeRows(t *testing.T, data string) []*Row {
+	t.Helper()
+	var rows []*Row
+	if err := json.Unmarshal([]byte(data), &rows); err != nil {
+		t.Fatalf("bad canned rows %s: %v", data, err)
+	}
+	return rows
+}
+
+func (m *mockAdsClient) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	return &SearchResponse{Results: m.rows(req.Query)}, nil
+}
+
+func (m *mockAdsClient) SearchStream(ctx context.Context, req *StreamRequest) (SearchStream, error) {
+	stream := &mockStream{}
+	if rows := m.rows(req.Query); len(rows) > 0 {
+		stream.batches = append(stream.batches, &StreamResponse{Results: rows})
+	}
+	return stream, nil
+}
+
+// mockStream hands out its batches, then err, or io.EOF when err is nil.
+type mockStream struct {
+	batches []*StreamResponse
+	err     error
+}
+
+func (s *mockStream) Recv() (*StreamResponse, error) {
+	if len(s.batches) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	batch := s.batches[0]
+	s.batches = s.batches[1:]
+	return batch, nil
+}
+
+// mockSecrets is a SecretsProvider holding one secret value, or failing
+// with err. It records the secret IDs asked for.
+type mockSecrets struct {
+	value string
+	err   error
+
+	requested []string
+}
+
+func (s *mockSecrets) GetSecretValue(ctx context.Context, in *secretsmanager.GetSecretValueInput, opts ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	s.requested = append(s.requested, aws.ToString(in.SecretId))
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(s.value)}, nil
+}
+
+// mockPublisher is a Publisher recording what it publishes, or failing
+// with err.
+type mockPublisher struct {
+	err error
+
+	mu        sync.Mutex
+	published []*sns.PublishInput
+}
+
+func (p *mockPublisher) Publish(ctx context.Context, in *sns.PublishInput, opts ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, in)
+	return &sns.PublishOutput{MessageId: aws.String("message-1")}, nil
+}
+
+// mockEvents is an EventPublisher recording the batches it is sent.
+type mockEvents struct {
+	mu      sync.Mutex
+	batches []*eventbridge.PutEventsInput
+}
+
+func (e *mockEvents) PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, opts ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.batches = append(e.batches, in)
+	return &eventbridge.PutEventsOutput{}, nil
+}
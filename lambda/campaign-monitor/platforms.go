@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+
+	"pkg/ads"
+	"pkg/retry"
+	"pkg/runlog"
+)
+
+// Accounts on Microsoft Advertising and Meta get the campaign performance
+// checks, with the same rules as Google Ads campaigns, on the metrics
+// their platform reports. The budget, asset, policy, spend spike, traffic
+// and Quality Score checks read Google Ads resources and are not run for
+// them.
+
+// platformsSecretName is the secret configuring the other platforms; see
+// ads.Config. When unset only Google Ads accounts are monitored.
+var platformsSecretName = os.Getenv("ADS_PLATFORMS_SECRET_ARN")
+
+// campaignWindowDays matches campaignPerformanceQuery's LAST_7_DAYS.
+const campaignWindowDays = 7
+
+var (
+	platformsMu      sync.Mutex
+	platformRegistry *ads.Registry
+)
+
+// platforms returns the configured ad platforms other than Google Ads,
+// loading them on first use. A failed load is tried again next time.
+func platforms(ctx context.Context) (*ads.Registry, error) {
+	platformsMu.Lock()
+	defer platformsMu.Unlock()
+	if platformRegistry != nil {
+		return platformRegistry, nil
+	}
+
+	var platformsConfig ads.Config
+	if platformsSecretName != "" {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(platformsSecretName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve platforms secret: %w", err)
+		}
+		if platformsConfig, err = ads.ParseConfig([]byte(aws.ToString(out.SecretString))); err != nil {
+			return nil, err
+		}
+	}
+	platformRegistry = ads.NewRegistry(platformsConfig, platformRetryPolicy())
+	return platformRegistry, nil
+}
+
+func platformRetryPolicy() retry.Policy {
+	p := ads.DefaultRetry()
+	p.OnRetry = func(attempt int, err error, delay time.Duration) {
+		log.Printf("Ad platform call failed (attempt %d/%d), retrying in %s: %v", attempt, p.MaxAttempts, delay, err)
+		emf.Count("PlatformRetries", 1)
+	}
+	return p
+}
+
+// monitorPlatformAccount is monitorAccount for an account on another
+// platform. Only the full check runs; the other modes skip the account.
+func (m *Monitor) monitorPlatformAccount(ctx context.Context, run *runlog.Run, account ads.Account) (int, error) {
+	if run.Mode == ModeHourly || run.Mode == ModeTraffic || run.Mode == ModeQuality {
+		return 0, nil
+	}
+	registry, err := platforms(ctx)
+	if err != nil {
+		return 0, err
+	}
+	platform, err := registry.Platform(account.Platform)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := platform.FetchMetrics(ctx, account.ID, ads.LevelCampaign, ads.LastDays(clk.Now(), campaignWindowDays))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch %s metrics: %w", ads.Title(account.Platform), err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	rules, err := rulesIn(ctx, rows[0].Cost.Currency)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load alert thresholds: %w", err)
+	}
+
+	var accountAlerts []CampaignAlert
+	var activity accountActivity
+	for _, m := range rows {
+		activity.Campaigns++
+		if m.Conversions > 0 {
+			activity.Converting++
+		}
+		if alert := generateAlert(rules, m); alert != nil {
+			alert.CustomerID = account.String()
+			accountAlerts = append(accountAlerts, *alert)
+		}
+	}
+	stampRun(run, accountAlerts)
+
+	groups, alerts := correlateAlerts(account.String(), accountAlerts, activity)
+	emf.Count("AlertGroups", len(groups))
+	if len(alerts) == 0 && len(groups) == 0 {
+		return 0, nil
+	}
+	if err := sendAlerts(ctx, m.publisher, alerts, groups); err != nil {
+		return 0, fmt.Errorf("failed to send alerts: %w", err)
+	}
+	m.publishAlertEvents(ctx, alerts, groups)
+	log.Printf("Sent %d campaign alerts and %d alert groups for %s", len(alerts), len(groups), account)
+	return len(accountAlerts), nil
+}
+
+// campaignMetrics is a campaignPerformanceQuery row as the shared rules
+// read it.
+func campaignMetrics(rules *accountRules, row *googleads.GoogleAdsRow) ads.Metrics {
+	return ads.Metrics{
+		CampaignID:      fmt.Sprintf("%d", row.Campaign.Id),
+		CampaignName:    row.Campaign.Name,
+		CampaignStatus:  row.Campaign.Status.String(),
+		Impressions:     row.Metrics.Impressions,
+		Clicks:          row.Metrics.Clicks,
+		Conversions:     float64(row.Metrics.Conversions),
+		Cost:            rules.micros(row.Metrics.CostMicros),
+		ConversionValue: rules.amount(row.Metrics.ConversionsValue),
+	}
+}
+
+// platformTitle names the platform of an account for alert subjects.
+func platformTitle(customerID string) string {
+	return ads.Title(ads.ParseAccount(customerID).Platform)
+}
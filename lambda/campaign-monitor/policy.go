@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+)
+
+const (
+	AlertTypeAdDisapproved      = "AD_DISAPPROVED"
+	AlertTypeKeywordDisapproved = "KEYWORD_DISAPPROVED"
+)
+
+// Enabled ads in enabled ad groups and campaigns that policy review
+// disapproved. They stop serving, so spend shifts to the rest of the ad
+// group or drops.
+var disapprovedAdsQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"ad_group.id",
+	"ad_group.name",
+	"ad_group_ad.ad.id",
+	"ad_group_ad.ad.type",
+	"ad_group_ad.policy_summary.review_status",
+	"ad_group_ad.policy_summary.policy_topic_entries",
+).From("ad_group_ad").
+	Where("ad_group_ad.policy_summary.approval_status", gaql.Equals, "DISAPPROVED").
+	Where("ad_group_ad.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// Enabled positive keywords that policy review disapproved.
+var disapprovedKeywordsQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"ad_group.id",
+	"ad_group.name",
+	"ad_group_criterion.criterion_id",
+	"ad_group_criterion.keyword.text",
+	"ad_group_criterion.keyword.match_type",
+	"ad_group_criterion.disapproval_reasons",
+).From("ad_group_criterion").
+	Where("ad_group_criterion.type", gaql.Equals, "KEYWORD").
+	Where("ad_group_criterion.negative", gaql.Equals, false).
+	Where("ad_group_criterion.approval_status", gaql.Equals, "DISAPPROVED").
+	Where("ad_group_criterion.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// monitorPolicy raises an alert for every serving ad and keyword that
+// policy review disapproved, with the policy topics behind it, so the
+// violation can be fixed before the campaign's spend drops.
+func monitorPolicy(ctx context.Context, client AdsClient, customerID string) ([]CampaignAlert, error) {
+	var alerts []CampaignAlert
+
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      disapprovedAdsQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search disapproved ads: %w", err)
+	}
+
+	for _, row := range resp.Results {
+		alert := newAdAlert(row)
+		alert.CustomerID = customerID
+		alert.AlertType = AlertTypeAdDisapproved
+		if summary := row.AdGroupAd.PolicySummary; summary != nil {
+			alert.PolicyTopics = policyTopics(summary.PolicyTopicEntries)
+		}
+		alert.Message = fmt.Sprintf("%s ad %s in ad group '%s' is disapproved: %s",
+			row.AdGroupAd.Ad.Type, alert.AdID, alert.AdGroupName, policyReason(alert.PolicyTopics))
+		alerts = append(alerts, *alert)
+	}
+
+	resp, err = search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      disapprovedKeywordsQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search disapproved keywords: %w", err)
+	}
+
+	for _, row := range resp.Results {
+		criterion := row.AdGroupCriterion
+		alert := newAdAlert(row)
+		alert.CustomerID = customerID
+		alert.AlertType = AlertTypeKeywordDisapproved
+		alert.KeywordID = fmt.Sprintf("%d", criterion.CriterionId)
+		if criterion.Keyword != nil {
+			alert.KeywordText = criterion.Keyword.Text
+			alert.MatchType = criterion.Keyword.MatchType.String()
+		}
+		// Keywords report only the topic names, without a topic type.
+		for _, reason := range criterion.DisapprovalReasons {
+			alert.PolicyTopics = append(alert.PolicyTopics, PolicyTopic{Topic: reason})
+		}
+		alert.Message = fmt.Sprintf("Keyword %q (%s) in ad group '%s' is disapproved: %s",
+			alert.KeywordText, alert.MatchType, alert.AdGroupName, policyReason(alert.PolicyTopics))
+		alerts = append(alerts, *alert)
+	}
+
+	return alerts, nil
+}
+
+// policyReason lists the topics of a disapproval for an alert message.
+func policyReason(topics []PolicyTopic) string {
+	if len(topics) == 0 {
+		return "no policy topic given"
+	}
+	names := make([]string, len(topics))
+	for i, t := range topics {
+		names[i] = t.Topic
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"google.golang.org/api/googleads"
+
+	"pkg/dynamo"
+	"pkg/gaql"
+)
+
+// AlertTypeQualityScoreDrop is raised when a keyword's Quality Score fell
+// since the last snapshot.
+const AlertTypeQualityScoreDrop = "QUALITY_SCORE_DROP"
+
+// ModeQuality is the event mode of the daily Quality Score snapshot; see
+// CampaignMonitorEvent.
+const ModeQuality = "quality"
+
+// qualityScoreDrop is how many points a keyword's Quality Score must lose
+// between snapshots to raise QUALITY_SCORE_DROP.
+var qualityScoreDrop = parseFloatEnv("QUALITY_SCORE_DROP", 2)
+
+var (
+	qualityScoresTable = os.Getenv("QUALITY_SCORES_TABLE_NAME")
+	reportsBucket      = os.Getenv("REPORTS_BUCKET")
+)
+
+// qualitySnapshotTTL is how long a day's snapshot is kept.
+const qualitySnapshotTTL = 180 * 24 * time.Hour
+
+// componentRank orders the ratings of Quality Score components, worst
+// first.
+var componentRank = map[string]int{
+	"BELOW_AVERAGE": 1,
+	"AVERAGE":       2,
+	"ABOVE_AVERAGE": 3,
+}
+
+// Enabled keywords that served over the last 30 days, with their current
+// Quality Score and its components. Quality Score is not segmented by
+// date: the query returns today's rating whatever the range.
+var keywordQualityQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"ad_group.id",
+	"ad_group.name",
+	"ad_group_criterion.criterion_id",
+	"ad_group_criterion.keyword.text",
+	"ad_group_criterion.keyword.match_type",
+	"ad_group_criterion.quality_info.quality_score",
+	"ad_group_criterion.quality_info.search_predicted_ctr",
+	"ad_group_criterion.quality_info.creative_quality_score",
+	"ad_group_criterion.quality_info.post_click_quality_score",
+	"metrics.impressions",
+).From("keyword_view").
+	Where("ad_group_criterion.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("metrics.impressions", gaql.GreaterThan, 0).
+	During(gaql.Last30Days).
+	MustBuild()
+
+// QualitySnapshot is one keyword's Quality Score on one day, keyed by
+// account and "<date>#<ad group>#<criterion>" so a day's snapshot of an
+// account reads back with one begins_with query.
+type QualitySnapshot struct {
+	CustomerID            string `dynamodbav:"customer_id" json:"-"`
+	SnapshotKey           string `dynamodbav:"snapshot_key" json:"-"`
+	Date                  string `dynamodbav:"date" json:"-"`
+	CampaignID            string `dynamodbav:"campaign_id" json:"campaign_id"`
+	CampaignName          string `dynamodbav:"campaign_name" json:"-"`
+	AdGroupID             string `dynamodbav:"ad_group_id" json:"-"`
+	AdGroupName           string `dynamodbav:"ad_group_name" json:"-"`
+	KeywordID             string `dynamodbav:"keyword_id" json:"keyword_id"`
+	KeywordText           string `dynamodbav:"keyword_text" json:"keyword_text"`
+	MatchType             string `dynamodbav:"match_type" json:"match_type"`
+	QualityScore          int64  `dynamodbav:"quality_score" json:"quality_score"`
+	ExpectedCTR           string `dynamodbav:"expected_ctr" json:"expected_ctr"`
+	AdRelevance           string `dynamodbav:"ad_relevance" json:"ad_relevance"`
+	LandingPageExperience string `dynamodbav:"landing_page_experience" json:"landing_page_experience"`
+	Impressions           int64  `dynamodbav:"impressions" json:"impressions"`
+	ExpiresAt             int64  `dynamodbav:"expires_at" json:"-"`
+}
+
+// QualityReport is the daily Quality Score distribution of one account,
+// stored as quality_scores/<date>/<customer>.json in REPORTS_BUCKET.
+type QualityReport struct {
+	CustomerID  string           `json:"customer_id"`
+	Date        string           `json:"date"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	AdGroups    []AdGroupQuality `json:"ad_groups"`
+}
+
+// AdGroupQuality summarizes the Quality Scores of an ad group's keywords.
+// Distribution[i] counts the keywords scored i+1; keywords Google Ads has
+// not rated are only counted in Unrated. WeightedScore weighs each rated
+// keyword by its impressions over the last 30 days, which is closer to
+// what the ad group pays for than the plain average.
+type AdGroupQuality struct {
+	CampaignID    string  `json:"campaign_id"`
+	CampaignName  string  `json:"campaign_name"`
+	AdGroupID     string  `json:"ad_group_id"`
+	AdGroupName   string  `json:"ad_group_name"`
+	Keywords      int     `json:"keywords"`
+	Unrated       int     `json:"unrated"`
+	Distribution  [10]int `json:"distribution"`
+	AverageScore  float64 `json:"average_score"`
+	WeightedScore float64 `json:"weighted_score"`
+
+	// Rated keywords with each component below average.
+	ExpectedCTRBelowAverage int `json:"expected_ctr_below_average"`
+	AdRelevanceBelowAverage int `json:"ad_relevance_below_average"`
+	LandingPageBelowAverage int `json:"landing_page_below_average"`
+
+	// LowestScoringKeywords are the ad group's worst rated keywords.
+	LowestScoringKeywords []QualitySnapshot `json:"lowest_scoring_keywords,omitempty"`
+
+	scoreSum, weightedSum, impressions int64
+}
+
+// lowestScoringKeywords is how many of an ad group's worst keywords the
+// report lists.
+const lowestScoringKeywords = 5
+
+// monitorQualityScores snapshots the Quality Score of every serving
+// keyword in one account, raises QUALITY_SCORE_DROP for keywords that lost
+// qualityScoreDrop points since the previous snapshot, and stores the
+// account's per-ad-group distribution report. Snapshots are only kept,
+// and drops only checked, when QUALITY_SCORES_TABLE_NAME is set; the
+// report is only stored when REPORTS_BUCKET is.
+func monitorQualityScores(ctx context.Context, client AdsClient, store *qualityStore, customerID string) ([]CampaignAlert, error) {
+	now := clk.Now().UTC()
+	date := now.Format("2006-01-02")
+	var snapshots []QualitySnapshot
+	groups := make(map[string]*AdGroupQuality)
+	var order []string
+	// Keywords are streamed; only their snapshots are kept.
+	err := searchStream(ctx, client, &googleads.SearchGoogleAdsStreamRequest{
+		CustomerId: customerID,
+		Query:      keywordQualityQuery,
+	}, func(row *googleads.GoogleAdsRow) error {
+		adGroupID := fmt.Sprintf("%d", row.AdGroup.Id)
+		group, ok := groups[adGroupID]
+		if !ok {
+			group = &AdGroupQuality{
+				CampaignID:   fmt.Sprintf("%d", row.Campaign.Id),
+				CampaignName: row.Campaign.Name,
+				AdGroupID:    adGroupID,
+				AdGroupName:  row.AdGroup.Name,
+			}
+			groups[adGroupID] = group
+			order = append(order, adGroupID)
+		}
+		group.Keywords++
+
+		snap, ok := qualitySnapshot(customerID, date, row)
+		if !ok {
+			group.Unrated++
+			return nil
+		}
+		snap.ExpiresAt = now.Add(qualitySnapshotTTL).Unix()
+		snapshots = append(snapshots, snap)
+		group.add(snap)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search keyword quality: %w", err)
+	}
+
+	var alerts []CampaignAlert
+	if store != nil {
+		previous, prevDate, err := store.previous(ctx, customerID, date)
+		if err != nil {
+			log.Printf("Failed to read previous quality scores for customer %s, not checking for drops: %v", customerID, err)
+		} else if prevDate != "" {
+			alerts = qualityDropAlerts(snapshots, previous, prevDate)
+		}
+		if err := store.save(ctx, snapshots); err != nil {
+			log.Printf("Failed to save quality score snapshot for customer %s: %v", customerID, err)
+		}
+	}
+	emf.Count("QualitySnapshots", len(snapshots))
+	emf.Count("QualityScoreDrops", len(alerts))
+
+	report := QualityReport{CustomerID: customerID, Date: date, GeneratedAt: now}
+	for _, id := range order {
+		group := groups[id]
+		group.finish()
+		report.AdGroups = append(report.AdGroups, *group)
+	}
+	// Worst ad groups first; those with no rated keyword last.
+	sort.SliceStable(report.AdGroups, func(i, j int) bool {
+		a, b := report.AdGroups[i], report.AdGroups[j]
+		if (a.impressions == 0) != (b.impressions == 0) {
+			return b.impressions == 0
+		}
+		return a.WeightedScore < b.WeightedScore
+	})
+	if err := store.saveReport(ctx, report); err != nil {
+		log.Printf("Failed to store quality score report for customer %s: %v", customerID, err)
+	}
+
+	for i := range alerts {
+		alerts[i].CustomerID = customerID
+	}
+	return alerts, nil
+}
+
+// qualitySnapshot reads one keyword's rating from row, reporting false
+// when Google Ads has not given the keyword a Quality Score.
+func qualitySnapshot(customerID, date string, row *googleads.GoogleAdsRow) (QualitySnapshot, bool) {
+	criterion := row.AdGroupCriterion
+	if criterion == nil || criterion.QualityInfo == nil || criterion.QualityInfo.QualityScore == 0 {
+		return QualitySnapshot{}, false
+	}
+	info := criterion.QualityInfo
+	snap := QualitySnapshot{
+		CustomerID:            customerID,
+		Date:                  date,
+		CampaignID:            fmt.Sprintf("%d", row.Campaign.Id),
+		CampaignName:          row.Campaign.Name,
+		AdGroupID:             fmt.Sprintf("%d", row.AdGroup.Id),
+		AdGroupName:           row.AdGroup.Name,
+		KeywordID:             fmt.Sprintf("%d", criterion.CriterionId),
+		QualityScore:          info.QualityScore,
+		ExpectedCTR:           info.SearchPredictedCtr.String(),
+		AdRelevance:           info.CreativeQualityScore.String(),
+		LandingPageExperience: info.PostClickQualityScore.String(),
+		Impressions:           row.Metrics.Impressions,
+	}
+	if criterion.Keyword != nil {
+		snap.KeywordText = criterion.Keyword.Text
+		snap.MatchType = criterion.Keyword.MatchType.String()
+	}
+	snap.SnapshotKey = dynamo.Compose(date, snap.AdGroupID, snap.KeywordID)
+	return snap, true
+}
+
+func (g *AdGroupQuality) add(snap QualitySnapshot) {
+	if snap.QualityScore >= 1 && snap.QualityScore <= 10 {
+		g.Distribution[snap.QualityScore-1]++
+	}
+	g.scoreSum += snap.QualityScore
+	g.weightedSum += snap.QualityScore * snap.Impressions
+	g.impressions += snap.Impressions
+	if snap.ExpectedCTR == "BELOW_AVERAGE" {
+		g.ExpectedCTRBelowAverage++
+	}
+	if snap.AdRelevance == "BELOW_AVERAGE" {
+		g.AdRelevanceBelowAverage++
+	}
+	if snap.LandingPageExperience == "BELOW_AVERAGE" {
+		g.LandingPageBelowAverage++
+	}
+	g.LowestScoringKeywords = append(g.LowestScoringKeywords, snap)
+}
+
+// finish computes the averages and trims the keyword list to the lowest
+// scoring, busiest first among equal scores.
+func (g *AdGroupQuality) finish() {
+	if rated := g.Keywords - g.Unrated; rated > 0 {
+		g.AverageScore = float64(g.scoreSum) / float64(rated)
+	}
+	if g.impressions > 0 {
+		g.WeightedScore = float64(g.weightedSum) / float64(g.impressions)
+	}
+	sort.SliceStable(g.LowestScoringKeywords, func(i, j int) bool {
+		a, b := g.LowestScoringKeywords[i], g.LowestScoringKeywords[j]
+		if a.QualityScore != b.QualityScore {
+			return a.QualityScore < b.QualityScore
+		}
+		return a.Impressions > b.Impressions
+	})
+	if len(g.LowestScoringKeywords) > lowestScoringKeywords {
+		g.LowestScoringKeywords = g.LowestScoringKeywords[:lowestScoringKeywords]
+	}
+}
+
+// qualityDropAlerts compares today's snapshots with the previous day's.
+// Keywords new since then have nothing to compare with.
+func qualityDropAlerts(current, previous []QualitySnapshot, prevDate string) []CampaignAlert {
+	before := make(map[string]QualitySnapshot, len(previous))
+	for _, snap := range previous {
+		before[snap.AdGroupID+"#"+snap.KeywordID] = snap
+	}
+
+	var alerts []CampaignAlert
+	for _, snap := range current {
+		prev, ok := before[snap.AdGroupID+"#"+snap.KeywordID]
+		if !ok || float64(prev.QualityScore-snap.QualityScore) < qualityScoreDrop {
+			continue
+		}
+		alert := CampaignAlert{
+			CampaignID:            snap.CampaignID,
+			CampaignName:          snap.CampaignName,
+			Status:                "ENABLED",
+			Impressions:           snap.Impressions,
+			AlertType:             AlertTypeQualityScoreDrop,
+			AdGroupID:             snap.AdGroupID,
+			AdGroupName:           snap.AdGroupName,
+			KeywordID:             snap.KeywordID,
+			KeywordText:           snap.KeywordText,
+			MatchType:             snap.MatchType,
+			QualityScore:          snap.QualityScore,
+			PreviousQualityScore:  prev.QualityScore,
+			PreviousQualityDate:   prevDate,
+			ExpectedCTR:           snap.ExpectedCTR,
+			AdRelevance:           snap.AdRelevance,
+			LandingPageExperience: snap.LandingPageExperience,
+		}
+		alert.Message = fmt.Sprintf("Keyword %q (%s) in ad group '%s' dropped from Quality Score %d on %s to %d%s",
+			snap.KeywordText, snap.MatchType, snap.AdGroupName, prev.QualityScore, prevDate, snap.QualityScore, componentDrops(prev, snap))
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// componentDrops names the components rated lower than before, which are
+// what to fix, e.g. "; landing page experience fell from AVERAGE to
+// BELOW_AVERAGE".
+func componentDrops(prev, cur QualitySnapshot) string {
+	var drops []string
+	for _, c := range []struct{ name, before, after string }{
+		{"expected CTR", prev.ExpectedCTR, cur.ExpectedCTR},
+		{"ad relevance", prev.AdRelevance, cur.AdRelevance},
+		{"landing page experience", prev.LandingPageExperience, cur.LandingPageExperience},
+	} {
+		if componentRank[c.after] != 0 && componentRank[c.after] < componentRank[c.before] {
+			drops = append(drops, fmt.Sprintf("%s fell from %s to %s", c.name, c.before, c.after))
+		}
+	}
+	if len(drops) == 0 {
+		return ""
+	}
+	return "; " + strings.Join(drops, ", ")
+}
+
+// qualityStore keeps Quality Score snapshots in QUALITY_SCORES_TABLE_NAME
+// and the distribution reports in REPORTS_BUCKET.
+type qualityStore struct {
+	table  *dynamo.Table
+	s3     *s3.Client
+	bucket string
+}
+
+// newQualityStore returns nil when neither QUALITY_SCORES_TABLE_NAME nor
+// REPORTS_BUCKET is set, in which case the quality run only logs.
+func newQualityStore(ctx context.Context) (*qualityStore, error) {
+	if qualityScoresTable == "" && reportsBucket == "" {
+		log.Printf("QUALITY_SCORES_TABLE_NAME and REPORTS_BUCKET not set, quality scores will not be recorded")
+		return nil, nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	store := &qualityStore{bucket: reportsBucket}
+	if qualityScoresTable != "" {
+		store.table = dynamo.NewTable(dynamodb.NewFromConfig(cfg), qualityScoresTable)
+	}
+	if reportsBucket != "" {
+		store.s3 = s3.NewFromConfig(cfg)
+	}
+	return store, nil
+}
+
+// previous returns the account's latest snapshot taken before date, and
+// its date, or no date when there is none.
+func (s *qualityStore) previous(ctx context.Context, customerID, date string) ([]QualitySnapshot, string, error) {
+	if s.table == nil {
+		return nil, "", nil
+	}
+	latest, err := dynamo.QueryPage[QualitySnapshot](ctx, s.table, dynamo.Query{
+		KeyCondition: "customer_id = :customer AND snapshot_key < :date",
+		Values: map[string]types.AttributeValue{
+			":customer": dynamo.S(customerID),
+			":date":     dynamo.S(date),
+		},
+		Limit:      1,
+		Descending: true,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(latest.Items) == 0 {
+		return nil, "", nil
+	}
+	prevDate := latest.Items[0].Date
+
+	snapshots, err := dynamo.QueryAll[QualitySnapshot](ctx, s.table, dynamo.Query{
+		KeyCondition: "customer_id = :customer AND begins_with(snapshot_key, :date)",
+		Values: map[string]types.AttributeValue{
+			":customer": dynamo.S(customerID),
+			":date":     dynamo.S(dynamo.Prefix(prevDate)),
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return snapshots, prevDate, nil
+}
+
+// save writes a day's snapshots. Running again the same day replaces them.
+func (s *qualityStore) save(ctx context.Context, snapshots []QualitySnapshot) error {
+	if s.table == nil || len(snapshots) == 0 {
+		return nil
+	}
+	return dynamo.BatchPut(ctx, s.table, snapshots)
+}
+
+func (s *qualityStore) saveReport(ctx context.Context, report QualityReport) error {
+	if s == nil || s.s3 == nil {
+		return nil
+	}
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	_, err = s.s3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(fmt.Sprintf("quality_scores/%s/%s.json", report.Date, report.CustomerID)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/ids"
+	"pkg/money"
+	"pkg/runlog"
+)
+
+// ruleSetVersion names the alerting rules in generateAlert,
+// generateImpressionShareAlert, monitorBudgets, monitorAdAssets,
+// monitorPolicy, monitorSpendSpikes, monitorTraffic, monitorQualityScores
+// and correlateAlerts. Bump it whenever their logic changes.
+const ruleSetVersion = "campaign-monitor/9"
+
+// Alert thresholds applied by generateAlert. Costs are in ruleCurrency.
+const (
+	lowCTRThreshold       = 0.5
+	lowCTRMinImpressions  = 1000
+	highCostNoConversions = 100.0
+	highCPCThreshold      = 5.0
+)
+
+// Responsive search ads with fewer assets than these raise
+// RSA_MISSING_ASSETS. Google serves with 3 headlines and 2 descriptions
+// but rarely rates such ads above POOR.
+const (
+	rsaMinHeadlines    = 8
+	rsaMinDescriptions = 3
+)
+
+var runsTable = os.Getenv("RUNS_TABLE_NAME")
+
+// configSnapshot is the configuration this run applies, recorded with the
+// run so its alerts can be reproduced. Static exchange rates are recorded
+// with the thresholds, since they move every non-dollar account's rules.
+func configSnapshot() runlog.Snapshot {
+	snap := runlog.Snapshot{
+		RuleSetVersion: ruleSetVersion,
+		Thresholds: map[string]float64{
+			"low_ctr":                      lowCTRThreshold,
+			"low_ctr_min_impressions":      lowCTRMinImpressions,
+			"high_cost_no_conversions":     highCostNoConversions,
+			"high_cpc":                     highCPCThreshold,
+			"budget_alert_threshold":       budgetAlertThreshold,
+			"min_account_wide_campaigns":   minAccountWideCampaigns,
+			"rsa_min_headlines":            rsaMinHeadlines,
+			"rsa_min_descriptions":         rsaMinDescriptions,
+			"spend_spike_multiple":         spendSpikeMultiple,
+			"spend_spike_min_cost":         spendSpikeMinCost,
+			"spend_spike_min_baseline":     spendSpikeMinBaseline,
+			"ctr_spike_multiple":           ctrSpikeMultiple,
+			"ctr_spike_min_clicks":         ctrSpikeMinClicks,
+			"geo_concentration_share":      geoConcentrationShare,
+			"geo_concentration_min_clicks": geoConcentrationMinClicks,
+			"placement_min_clicks":         placementMinClicks,
+			"placement_suspect_ctr":        placementSuspectCTR,
+			"quality_score_drop":           qualityScoreDrop,
+			"lost_is_budget_threshold":     lostISBudgetThreshold,
+			"lost_is_rank_threshold":       lostISRankThreshold,
+			"lost_is_min_roas":             lostISMinROAS,
+		},
+	}
+	if rates, ok := fxRates.(money.Static); ok {
+		for currency, rate := range rates {
+			snap.Thresholds["fx_"+strings.ToLower(currency)+"_per_usd"] = rate
+		}
+	}
+	return snap
+}
+
+// startRun records the start of this run, or resumes the run named by
+// resumeID. Without one, a run started by this invocation's Lambda request
+// ID is resumed: Lambda retries a failed asynchronous invocation under the
+// same ID. Recording is best effort: a run is always returned so alerts
+// can carry its ID, but it is only stored when RUNS_TABLE_NAME is set and
+// the write succeeds.
+func startRun(ctx context.Context, mode, resumeID string) (*runlog.Run, *runlog.Recorder) {
+	snap := configSnapshot()
+	fallback := &runlog.Run{
+		Function:    "campaign-monitor",
+		RunID:       ids.FromEnv(clk).NewID(),
+		Environment: environment,
+		Config:      snap,
+		ConfigHash:  snap.Hash(),
+		Mode:        mode,
+	}
+	if runsTable == "" {
+		return fallback, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Printf("Failed to load AWS config for run log: %v", err)
+		return fallback, nil
+	}
+	recorder := runlog.NewRecorder(dynamodb.NewFromConfig(cfg), runsTable, clk, ids.FromEnv(clk))
+
+	invocationID := ""
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		invocationID = lc.AwsRequestID
+	}
+	if run := resumeRun(ctx, recorder, resumeID, invocationID, snap); run != nil {
+		return run, recorder
+	}
+	if resumeID != "" {
+		// Without the run there is nothing to skip, so start over.
+		log.Printf("No run %s to resume, starting a new run", resumeID)
+	}
+
+	run, err := recorder.Start(ctx, "campaign-monitor", environment, snap, mode, invocationID)
+	if err != nil {
+		log.Printf("Failed to record run start: %v", err)
+		return fallback, nil
+	}
+	return run, recorder
+}
+
+// resumeRun looks up the run to continue and records the new attempt. It
+// returns nil when there is none.
+func resumeRun(ctx context.Context, recorder *runlog.Recorder, resumeID, invocationID string, snap runlog.Snapshot) *runlog.Run {
+	id := resumeID
+	if id == "" {
+		id = invocationID
+	}
+	if id == "" {
+		return nil
+	}
+	run, err := recorder.Lookup(ctx, "campaign-monitor", id)
+	if errors.Is(err, runlog.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to look up run %s to resume: %v", id, err)
+		return nil
+	}
+	if run.ConfigHash != snap.Hash() {
+		log.Printf("Run %s started with config %s, resuming with %s", run.RunID, run.ConfigHash, snap.Hash())
+	}
+	if err := recorder.Resume(ctx, run); err != nil {
+		log.Printf("Failed to record resumption of run %s: %v", run.RunID, err)
+		return nil
+	}
+	log.Printf("Resuming run %s (attempt %d): %d of %d accounts already processed", run.RunID, run.Attempts, len(run.Processed), len(run.CustomerIDs))
+	return run
+}
+
+// planRun records the run's rotation.
+func planRun(ctx context.Context, recorder *runlog.Recorder, run *runlog.Run, customerIDs []string) {
+	if recorder == nil {
+		run.CustomerIDs = customerIDs
+		return
+	}
+	if err := recorder.Plan(ctx, run, customerIDs); err != nil {
+		log.Printf("Failed to record accounts of run %s: %v", run.RunID, err)
+	}
+}
+
+// checkpoint records an account's outcome on the run.
+func checkpoint(ctx context.Context, recorder *runlog.Recorder, run *runlog.Run, customerID string, accountErr error) {
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Checkpoint(ctx, run, customerID, accountErr); err != nil {
+		log.Printf("Failed to checkpoint run %s: %v", run.RunID, err)
+	}
+}
+
+// finishRun records the run's outcome. A run that finished with failed
+// accounts is reported to the failures queue; one that failed outright is
+// retried by Lambda, whose failure record reaches the same queue once the
+// retries are used up.
+func finishRun(ctx context.Context, recorder *runlog.Recorder, run *runlog.Run, runErr error) {
+	if recorder == nil {
+		return
+	}
+	if err := recorder.Finish(ctx, run, runErr); err != nil {
+		log.Printf("Failed to record run %s: %v", run.RunID, err)
+	}
+	if run.Status == runlog.StatusPartial {
+		reportFailure(ctx, run)
+	}
+}
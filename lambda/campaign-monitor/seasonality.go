@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/dynamo"
+	"pkg/seasonality"
+)
+
+// seasonalityTable holds the seasonality calendar; when unset spikes are
+// never expected.
+var seasonalityTable = os.Getenv("SEASONALITY_TABLE_NAME")
+
+// activeEvents returns the account's seasonality events, its own and the
+// global ones, running on day.
+func activeEvents(ctx context.Context, customerID string, day time.Time) ([]seasonality.Event, error) {
+	if seasonalityTable == "" {
+		return nil, nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	store := seasonality.NewStore(dynamo.NewTable(dynamodb.NewFromConfig(cfg), seasonalityTable), clk)
+	events, err := store.ForAccount(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seasonality events: %w", err)
+	}
+	return seasonality.Active(events, day), nil
+}
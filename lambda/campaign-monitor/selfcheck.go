@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/health"
+)
+
+// ModeSelfCheck is the event mode that checks the function can reach its
+// dependencies instead of monitoring; see CampaignMonitorEvent.
+const ModeSelfCheck = "self_check"
+
+// selfCheck reads the Google Ads credentials and describes the accounts
+// and runs tables, logs the report and fails the invocation if any of
+// them could not be reached.
+func (m *Monitor) selfCheck(ctx context.Context) error {
+	checks := []health.Check{{
+		Name:     "secretsmanager:google-ads-credentials",
+		Critical: true,
+		Run: func(ctx context.Context) error {
+			_, err := loadGoogleAdsConfig(ctx, m.secrets)
+			return err
+		},
+	}}
+	if accountsTable != "" || runsTable != "" {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		db := dynamodb.NewFromConfig(cfg)
+		if accountsTable != "" {
+			checks = append(checks, health.Table(db, accountsTable, true))
+		}
+		if runsTable != "" {
+			checks = append(checks, health.Table(db, runsTable, false))
+		}
+	}
+
+	report := health.NewChecker("campaign-monitor", clk, checks...).Run(ctx)
+	out, _ := json.Marshal(report)
+	log.Printf("Self-check: %s", out)
+	return report.Err()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/money"
+	"pkg/seasonality"
+)
+
+const AlertTypeSpendSpike = "SPEND_SPIKE"
+
+// ModeHourly is the event mode of the hourly schedule, which only checks
+// for spend spikes; see CampaignMonitorEvent.
+const ModeHourly = "hourly"
+
+var (
+	// spendSpikeMultiple is how many times the same hour's spend a week
+	// earlier an hour must cost to raise SPEND_SPIKE.
+	spendSpikeMultiple = parseFloatEnv("SPEND_SPIKE_MULTIPLE", 3.0)
+	// spendSpikeMinCost keeps small campaigns' noise from alerting: an
+	// hour costing less, in ruleCurrency, never spikes.
+	spendSpikeMinCost = parseFloatEnv("SPEND_SPIKE_MIN_COST", 25.0)
+	// spendSpikeMinBaseline stands in for a week-ago hour that cost less,
+	// so a campaign with no spend last week is compared against something.
+	spendSpikeMinBaseline = parseFloatEnv("SPEND_SPIKE_MIN_BASELINE", 5.0)
+)
+
+// Today's spend by hour. segments.date and segments.hour are in the
+// account's time zone, so the week-ago query takes its date from these
+// rows rather than the Lambda's clock.
+var hourlySpendTodayQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"segments.date",
+	"segments.hour",
+	"metrics.cost_micros",
+	"metrics.clicks",
+	"metrics.impressions",
+	"metrics.conversions",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	During(gaql.Today).
+	MustBuild()
+
+func hourlySpendQuery(date string, hour int64) string {
+	return gaql.Select(
+		"campaign.id",
+		"segments.hour",
+		"metrics.cost_micros",
+	).From("campaign").
+		Where("campaign.status", gaql.Equals, "ENABLED").
+		Where("segments.date", gaql.Equals, date).
+		Where("segments.hour", gaql.Equals, hour).
+		MustBuild()
+}
+
+// campaignHour is one campaign's metrics for one hour.
+type campaignHour struct {
+	campaign    *googleads.Campaign
+	cost        money.Money
+	clicks      int64
+	impressions int64
+	conversions int64
+}
+
+// monitorSpendSpikes compares each enabled campaign's spend in the last
+// complete hour with the same hour a week earlier, and raises SPEND_SPIKE
+// where it is spendSpikeMultiple times higher. The latest hour with data
+// is taken as still running, so an hourly schedule checks each hour once,
+// within the hour after it ends. During a seasonality event the surge is
+// planned, so the multiple rises by the event's budget multiplier for the
+// campaigns it covers.
+func monitorSpendSpikes(ctx context.Context, client AdsClient, rules *accountRules, customerID string) ([]CampaignAlert, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      hourlySpendTodayQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search today's hourly spend: %w", err)
+	}
+
+	var today string
+	latest := int64(-1)
+	for _, row := range resp.Results {
+		today = row.Segments.Date
+		if row.Segments.Hour > latest {
+			latest = row.Segments.Hour
+		}
+	}
+	hour := latest - 1
+	if hour < 0 {
+		// Nothing spent yet today, or only in its first hour.
+		return nil, nil
+	}
+
+	current := make(map[int64]campaignHour)
+	for _, row := range resp.Results {
+		if row.Segments.Hour != hour {
+			continue
+		}
+		current[row.Campaign.Id] = campaignHour{
+			campaign:    row.Campaign,
+			cost:        rules.micros(row.Metrics.CostMicros),
+			clicks:      row.Metrics.Clicks,
+			impressions: row.Metrics.Impressions,
+			conversions: row.Metrics.Conversions,
+		}
+	}
+	if len(current) == 0 {
+		return nil, nil
+	}
+
+	day, err := time.Parse("2006-01-02", today)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected segments.date %q: %w", today, err)
+	}
+	events, err := activeEvents(ctx, customerID, day)
+	if err != nil {
+		log.Printf("Failed to load seasonality events for customer %s, checking spikes without them: %v", customerID, err)
+	}
+	weekAgo := day.AddDate(0, 0, -7).Format("2006-01-02")
+	resp, err = search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      hourlySpendQuery(weekAgo, hour),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search hourly spend for %s: %w", weekAgo, err)
+	}
+	baseline := make(map[int64]int64)
+	for _, row := range resp.Results {
+		baseline[row.Campaign.Id] += row.Metrics.CostMicros
+	}
+
+	var alerts []CampaignAlert
+	for id, spend := range current {
+		seasonal := seasonality.Combine(events, fmt.Sprintf("%d", id))
+		alert := generateSpendSpikeAlert(rules, spend, rules.micros(baseline[id]), today, hour, seasonal)
+		if alert != nil {
+			alert.CustomerID = customerID
+			alerts = append(alerts, *alert)
+		}
+	}
+	return alerts, nil
+}
+
+func generateSpendSpikeAlert(rules *accountRules, spend campaignHour, baseline money.Money, date string, hour int64, seasonal seasonality.Multipliers) *CampaignAlert {
+	cost := spend.cost.Units()
+	compared := baseline.Units()
+	if compared < rules.spendSpikeMinBaseline {
+		compared = rules.spendSpikeMinBaseline
+	}
+	if cost < rules.spendSpikeMinCost || cost < spendSpikeMultiple*seasonal.Budget*compared {
+		return nil
+	}
+
+	spikeHour := int(hour)
+	alert := &CampaignAlert{
+		CampaignID:    fmt.Sprintf("%d", spend.campaign.Id),
+		CampaignName:  spend.campaign.Name,
+		Status:        spend.campaign.Status.String(),
+		Impressions:   spend.impressions,
+		Clicks:        spend.clicks,
+		Cost:          spend.cost,
+		Conversions:   spend.conversions,
+		AlertType:     AlertTypeSpendSpike,
+		SpikeDate:     date,
+		SpikeHour:     &spikeHour,
+		BaselineCost:  &baseline,
+		SpendMultiple: cost / compared,
+	}
+	if spend.clicks > 0 {
+		alert.CPC = spend.cost.Div(float64(spend.clicks))
+	}
+	if spend.impressions > 0 {
+		alert.CTR = float64(spend.clicks) / float64(spend.impressions)
+	}
+	alert.Message = fmt.Sprintf("Campaign '%s' spent %s between %02d:00 and %02d:00, %.1fx the %s spent in that hour a week ago",
+		spend.campaign.Name, spend.cost, hour, hour+1, alert.SpendMultiple, baseline)
+	if len(seasonal.Events) > 0 {
+		alert.Season = seasonal.Events
+		alert.Message += fmt.Sprintf(", beyond the %.1fx expected for %s", seasonal.Budget, strings.Join(seasonal.Events, ", "))
+	}
+	return alert
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/money"
+)
+
+// Invalid traffic alert types. Google filters most invalid clicks itself
+// and refunds them as metrics.invalid_clicks; these heuristics look for
+// the patterns that get through.
+const (
+	AlertTypeSuspiciousCTRSpike  = "SUSPICIOUS_CTR_SPIKE"
+	AlertTypeGeoConcentration    = "GEO_CLICK_CONCENTRATION"
+	AlertTypeSuspiciousPlacement = "SUSPICIOUS_PLACEMENT"
+)
+
+// ActionExcludePlacement is the action recommended for a suspicious
+// placement: add it to the campaign's placement exclusions.
+const ActionExcludePlacement = "EXCLUDE_PLACEMENT"
+
+// ModeTraffic is the event mode of the daily invalid traffic check; see
+// CampaignMonitorEvent.
+const ModeTraffic = "traffic"
+
+var (
+	// ctrSpikeMultiple is how many times its CTR over the rest of the last
+	// two weeks a campaign's CTR yesterday must be to raise
+	// SUSPICIOUS_CTR_SPIKE, and ctrSpikeMinClicks how many clicks it must
+	// have had. A spike only counts when none of the clicks converted.
+	ctrSpikeMultiple  = parseFloatEnv("CTR_SPIKE_MULTIPLE", 3.0)
+	ctrSpikeMinClicks = parseFloatEnv("CTR_SPIKE_MIN_CLICKS", 50)
+	// geoConcentrationShare is the share of a campaign's clicks over the
+	// last week one country must take, with at least
+	// geoConcentrationMinClicks clicks and no conversions, to raise
+	// GEO_CLICK_CONCENTRATION.
+	geoConcentrationShare     = parseFloatEnv("GEO_CONCENTRATION_SHARE", 0.5)
+	geoConcentrationMinClicks = parseFloatEnv("GEO_CONCENTRATION_MIN_CLICKS", 100)
+	// A display placement with at least placementMinClicks clicks over the
+	// last week, none converting, at a CTR of placementSuspectCTR or more
+	// raises SUSPICIOUS_PLACEMENT. Display CTRs are usually well under 1%.
+	placementMinClicks  = parseFloatEnv("PLACEMENT_MIN_CLICKS", 30)
+	placementSuspectCTR = parseFloatEnv("PLACEMENT_SUSPECT_CTR", 0.05)
+)
+
+var findingsTable = os.Getenv("FINDINGS_TABLE_NAME")
+
+// findingCooldown is how long a finding stays quiet after alerting; the
+// weekly windows would otherwise raise it again every day.
+const findingCooldown = 7 * 24 * time.Hour
+
+// findingTTL is how long a finding is kept after it last alerted.
+const findingTTL = 90 * 24 * time.Hour
+
+// Daily campaign metrics over the last two weeks, for CTR spikes.
+var dailyTrafficQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"segments.date",
+	"metrics.impressions",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+	"metrics.invalid_clicks",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	During(gaql.Last14Days).
+	MustBuild()
+
+// Clicks by campaign and country over the last week, by where the
+// clicking users were.
+var geoTrafficQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"geographic_view.country_criterion_id",
+	"metrics.impressions",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+).From("geographic_view").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("geographic_view.location_type", gaql.Equals, "LOCATION_OF_PRESENCE").
+	During(gaql.Last7Days).
+	MustBuild()
+
+// Display placements that drew clicks over the last week.
+var placementTrafficQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"campaign.status",
+	"group_placement_view.placement",
+	"group_placement_view.placement_type",
+	"group_placement_view.display_name",
+	"group_placement_view.target_url",
+	"metrics.impressions",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+).From("group_placement_view").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("campaign.advertising_channel_type", gaql.Equals, "DISPLAY").
+	Where("metrics.clicks", gaql.GreaterThan, 0).
+	During(gaql.Last7Days).
+	MustBuild()
+
+// TrafficFinding is an invalid traffic alert as recorded in the findings
+// table, keyed by account and by FindingID, which names the heuristic,
+// campaign and subject so a finding seen again updates the same item.
+type TrafficFinding struct {
+	CustomerID        string      `dynamodbav:"customer_id"`
+	FindingID         string      `dynamodbav:"finding_id"`
+	AlertType         string      `dynamodbav:"alert_type"`
+	CampaignID        string      `dynamodbav:"campaign_id"`
+	CampaignName      string      `dynamodbav:"campaign_name"`
+	Subject           string      `dynamodbav:"subject,omitempty"`
+	Impressions       int64       `dynamodbav:"impressions"`
+	Clicks            int64       `dynamodbav:"clicks"`
+	Cost              money.Money `dynamodbav:"cost"`
+	Conversions       int64       `dynamodbav:"conversions"`
+	CTR               float64     `dynamodbav:"ctr"`
+	BaselineCTR       float64     `dynamodbav:"baseline_ctr,omitempty"`
+	ClickShare        float64     `dynamodbav:"click_share,omitempty"`
+	PlacementType     string      `dynamodbav:"placement_type,omitempty"`
+	RecommendedAction string      `dynamodbav:"recommended_action,omitempty"`
+	Message           string      `dynamodbav:"message"`
+	RunID             string      `dynamodbav:"run_id"`
+	AlertedAt         time.Time   `dynamodbav:"alerted_at"`
+	QuietUntil        int64       `dynamodbav:"quiet_until"`
+	ExpiresAt         int64       `dynamodbav:"expires_at"`
+}
+
+// monitorTraffic runs the invalid traffic heuristics for one account. A
+// failed query skips its heuristic but not the others.
+func monitorTraffic(ctx context.Context, client AdsClient, rules *accountRules, customerID string) ([]CampaignAlert, error) {
+	var alerts []CampaignAlert
+	var errs []error
+
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{CustomerId: customerID, Query: dailyTrafficQuery})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to search daily traffic: %w", err))
+	} else {
+		alerts = append(alerts, ctrSpikeAlerts(rules, resp.Results)...)
+	}
+
+	resp, err = search(ctx, client, &googleads.SearchGoogleAdsRequest{CustomerId: customerID, Query: geoTrafficQuery})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to search traffic by country: %w", err))
+	} else {
+		alerts = append(alerts, geoConcentrationAlerts(rules, resp.Results)...)
+	}
+
+	resp, err = search(ctx, client, &googleads.SearchGoogleAdsRequest{CustomerId: customerID, Query: placementTrafficQuery})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to search display placements: %w", err))
+	} else {
+		alerts = append(alerts, placementAlerts(rules, resp.Results)...)
+	}
+
+	for i := range alerts {
+		alerts[i].CustomerID = customerID
+	}
+	if len(errs) == 3 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		log.Printf("Invalid traffic check for customer %s incomplete: %v", customerID, err)
+	}
+	return alerts, nil
+}
+
+// trafficTotals sums a campaign's metrics over some rows.
+type trafficTotals struct {
+	campaign    *googleads.Campaign
+	impressions int64
+	clicks      int64
+	costMicros  int64
+	conversions int64
+}
+
+func (t *trafficTotals) add(row *googleads.GoogleAdsRow) {
+	t.campaign = row.Campaign
+	t.impressions += row.Metrics.Impressions
+	t.clicks += row.Metrics.Clicks
+	t.costMicros += row.Metrics.CostMicros
+	t.conversions += row.Metrics.Conversions
+}
+
+func (t trafficTotals) ctr() float64 {
+	if t.impressions == 0 {
+		return 0
+	}
+	return float64(t.clicks) / float64(t.impressions)
+}
+
+// ctrSpikeAlerts compares each campaign's CTR on the latest day in rows,
+// yesterday for LAST_14_DAYS, with its CTR over the days before. Clicks
+// Google already filtered as invalid are left out of the spike.
+func ctrSpikeAlerts(rules *accountRules, rows []*googleads.GoogleAdsRow) []CampaignAlert {
+	var latest string
+	for _, row := range rows {
+		if row.Segments.Date > latest {
+			latest = row.Segments.Date
+		}
+	}
+
+	day := make(map[int64]*trafficTotals)
+	baseline := make(map[int64]*trafficTotals)
+	for _, row := range rows {
+		totals := baseline
+		if row.Segments.Date == latest {
+			totals = day
+		}
+		t, ok := totals[row.Campaign.Id]
+		if !ok {
+			t = &trafficTotals{}
+			totals[row.Campaign.Id] = t
+		}
+		t.add(row)
+		if row.Segments.Date == latest {
+			t.clicks -= row.Metrics.InvalidClicks
+		}
+	}
+
+	var alerts []CampaignAlert
+	for id, spike := range day {
+		before, ok := baseline[id]
+		if !ok || before.ctr() == 0 || spike.conversions > 0 || float64(spike.clicks) < ctrSpikeMinClicks {
+			continue
+		}
+		if spike.ctr() < ctrSpikeMultiple*before.ctr() {
+			continue
+		}
+		alert := trafficAlert(rules, *spike, AlertTypeSuspiciousCTRSpike)
+		alert.SpikeDate = latest
+		alert.BaselineCTR = before.ctr()
+		alert.Message = fmt.Sprintf("Campaign '%s' had a %.2f%% CTR on %s, %.1fx its %.2f%% CTR over the previous two weeks, with %d clicks and no conversions",
+			spike.campaign.Name, alert.CTR*100, latest, alert.CTR/alert.BaselineCTR, alert.BaselineCTR*100, spike.clicks)
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// geoConcentrationAlerts finds countries taking most of a campaign's
+// clicks without converting while the rest of the campaign converts.
+// Campaigns converting nowhere are left to HIGH_COST_NO_CONVERSIONS.
+func geoConcentrationAlerts(rules *accountRules, rows []*googleads.GoogleAdsRow) []CampaignAlert {
+	type countryKey struct{ campaign, country int64 }
+	campaigns := make(map[int64]*trafficTotals)
+	countries := make(map[countryKey]*trafficTotals)
+	for _, row := range rows {
+		c, ok := campaigns[row.Campaign.Id]
+		if !ok {
+			c = &trafficTotals{}
+			campaigns[row.Campaign.Id] = c
+		}
+		c.add(row)
+		key := countryKey{row.Campaign.Id, row.GeographicView.CountryCriterionId}
+		t, ok := countries[key]
+		if !ok {
+			t = &trafficTotals{}
+			countries[key] = t
+		}
+		t.add(row)
+	}
+
+	var alerts []CampaignAlert
+	for key, country := range countries {
+		campaign := campaigns[key.campaign]
+		if country.conversions > 0 || campaign.conversions == 0 || float64(country.clicks) < geoConcentrationMinClicks {
+			continue
+		}
+		share := float64(country.clicks) / float64(campaign.clicks)
+		if share < geoConcentrationShare {
+			continue
+		}
+		alert := trafficAlert(rules, *country, AlertTypeGeoConcentration)
+		alert.CountryCriterionID = key.country
+		alert.ClickShare = share
+		alert.Message = fmt.Sprintf("Country %d took %.0f%% of campaign '%s' clicks over the last 7 days (%d clicks, %s) without a conversion, while the rest of the campaign converted %d times",
+			key.country, share*100, country.campaign.Name, country.clicks, alert.Cost, campaign.conversions)
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// placementAlerts finds display placements whose clicks look generated:
+// a CTR several times what display ads get, and no conversions.
+func placementAlerts(rules *accountRules, rows []*googleads.GoogleAdsRow) []CampaignAlert {
+	var alerts []CampaignAlert
+	for _, row := range rows {
+		var t trafficTotals
+		t.add(row)
+		if t.conversions > 0 || float64(t.clicks) < placementMinClicks || t.ctr() < placementSuspectCTR {
+			continue
+		}
+		view := row.GroupPlacementView
+		alert := trafficAlert(rules, t, AlertTypeSuspiciousPlacement)
+		alert.Placement = view.Placement
+		alert.PlacementType = view.PlacementType.String()
+		alert.RecommendedAction = ActionExcludePlacement
+		name := view.DisplayName
+		if name == "" {
+			name = view.Placement
+		}
+		alert.Message = fmt.Sprintf("Placement '%s' drew %d clicks for campaign '%s' over the last 7 days at a %.1f%% CTR without a conversion; consider excluding it",
+			name, t.clicks, t.campaign.Name, alert.CTR*100)
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+func trafficAlert(rules *accountRules, t trafficTotals, alertType string) CampaignAlert {
+	alert := CampaignAlert{
+		CampaignID:   fmt.Sprintf("%d", t.campaign.Id),
+		CampaignName: t.campaign.Name,
+		Status:       t.campaign.Status.String(),
+		Impressions:  t.impressions,
+		Clicks:       t.clicks,
+		Cost:         rules.micros(t.costMicros),
+		Conversions:  t.conversions,
+		CTR:          t.ctr(),
+		AlertType:    alertType,
+	}
+	if t.clicks > 0 {
+		alert.CPC = alert.Cost.Div(float64(t.clicks))
+	}
+	return alert
+}
+
+// findingSubject is what an invalid traffic alert is about within its
+// campaign: the country or placement, or nothing for CTR spikes.
+func findingSubject(alert CampaignAlert) string {
+	switch {
+	case alert.Placement != "":
+		return alert.Placement
+	case alert.CountryCriterionID != 0:
+		return strconv.FormatInt(alert.CountryCriterionID, 10)
+	}
+	return ""
+}
+
+// findingStore records invalid traffic findings in FINDINGS_TABLE_NAME.
+type findingStore struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// newFindingStore returns nil when FINDINGS_TABLE_NAME is unset, in which
+// case every finding alerts.
+func newFindingStore(ctx context.Context) (*findingStore, error) {
+	if findingsTable == "" {
+		log.Printf("FINDINGS_TABLE_NAME not set, invalid traffic findings will not be recorded")
+		return nil, nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return &findingStore{client: dynamodb.NewFromConfig(cfg), table: findingsTable}, nil
+}
+
+// record saves alert as a finding unless the same finding alerted within
+// findingCooldown, and reports whether it should be sent. A finding seen
+// again during its cooldown keeps the metrics it alerted with.
+func (s *findingStore) record(ctx context.Context, alert CampaignAlert) (bool, error) {
+	if s == nil {
+		return true, nil
+	}
+	now := clk.Now().UTC()
+	finding := TrafficFinding{
+		CustomerID:        alert.CustomerID,
+		FindingID:         alert.AlertType + "#" + alert.CampaignID + "#" + findingSubject(alert),
+		AlertType:         alert.AlertType,
+		CampaignID:        alert.CampaignID,
+		CampaignName:      alert.CampaignName,
+		Subject:           findingSubject(alert),
+		Impressions:       alert.Impressions,
+		Clicks:            alert.Clicks,
+		Cost:              alert.Cost,
+		Conversions:       alert.Conversions,
+		CTR:               alert.CTR,
+		BaselineCTR:       alert.BaselineCTR,
+		ClickShare:        alert.ClickShare,
+		PlacementType:     alert.PlacementType,
+		RecommendedAction: alert.RecommendedAction,
+		Message:           alert.Message,
+		RunID:             alert.RunID,
+		AlertedAt:         now,
+		QuietUntil:        now.Add(findingCooldown).Unix(),
+		ExpiresAt:         now.Add(findingTTL).Unix(),
+	}
+	item, err := attributevalue.MarshalMap(finding)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal finding: %w", err)
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(finding_id) OR quiet_until <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to save finding %s: %w", finding.FindingID, err)
+	}
+	return true, nil
+}
+
+// recordFindings records each alert and returns those to send. A finding
+// that cannot be recorded is still sent.
+func recordFindings(ctx context.Context, store *findingStore, alerts []CampaignAlert) []CampaignAlert {
+	var send []CampaignAlert
+	for _, alert := range alerts {
+		ok, err := store.record(ctx, alert)
+		if err != nil {
+			log.Printf("Failed to record invalid traffic finding for customer %s: %v", alert.CustomerID, err)
+			ok = true
+		}
+		if ok {
+			send = append(send, alert)
+		}
+	}
+	emf.Count("TrafficFindingsSuppressed", len(alerts)-len(send))
+	return send
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	gads "pkg/googleads"
+	"pkg/warmup"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+// Refund events from payment-service. A partial refund leaves some of the
+// payment; "Payment Refunded" means none is left.
+const (
+	detailTypePaymentRefunded   = "Payment Refunded"
+	detailTypePartiallyRefunded = "Payment Partially Refunded"
+)
+
+// Google Ads conversion adjustment types.
+const (
+	AdjustmentRetraction  = "RETRACTION"
+	AdjustmentRestatement = "RESTATEMENT"
+)
+
+// conversion-uploader's status of a conversion Google Ads has.
+const statusUploaded = "UPLOADED"
+
+// settledErrorCodes mean Google Ads already has the adjustment: retracting
+// twice, or restating a retracted conversion, changes nothing.
+var settledErrorCodes = map[string]bool{
+	"CONVERSION_ALREADY_RETRACTED": true,
+}
+
+var (
+	secretName         = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	conversionActionID = os.Getenv("CONVERSION_ACTION_ID")
+	uploadsTable       = os.Getenv("UPLOADS_TABLE_NAME")
+	revenueTable       = os.Getenv("ORDER_REVENUE_TABLE_NAME")
+	environment        = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+
+	// The AWS config, Google Ads secret and client outlive the invocation;
+	// see warmup.
+	awsCfg          = warmup.New("aws_config", 0, loadAWSConfig)
+	googleAdsSecret = warmup.New("google_ads_secret", warmup.RefreshFromEnv(), loadGoogleAdsConfig)
+	adsClient       = warmup.New("google_ads_client", warmup.RefreshFromEnv(), createGoogleAdsClient)
+)
+
+// BusEvent is an EventBridge event as delivered to the queue.
+type BusEvent struct {
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// PaymentRefund is the part of payment-service's refund event details
+// this lambda needs. Amounts are in the currency's smallest unit;
+// AmountRefunded is the running total.
+type PaymentRefund struct {
+	OrderID        string    `json:"order_id"`
+	Amount         int64     `json:"amount"`
+	AmountRefunded int64     `json:"amount_refunded"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// uploadRecord is conversion-uploader's record of an order's conversion,
+// with the refund last adjusted for.
+type uploadRecord struct {
+	OrderID        string    `dynamodbav:"order_id"`
+	CustomerID     string    `dynamodbav:"customer_id"`
+	Status         string    `dynamodbav:"status"`
+	Value          float64   `dynamodbav:"value"`
+	Currency       string    `dynamodbav:"currency"`
+	ConversionTime time.Time `dynamodbav:"conversion_time"`
+	// RefundedShare is the share of the payment, between 0 and 1, the
+	// conversion was last adjusted for.
+	RefundedShare float64 `dynamodbav:"refunded_share"`
+}
+
+// adjustment is one conversion adjustment to upload, with the queue
+// message it came from.
+type adjustment struct {
+	MessageID     string
+	Record        uploadRecord
+	Type          string
+	AdjustedValue float64
+	RefundedShare float64
+	At            time.Time
+}
+
+func init() {
+	warmup.Prime(awsCfg, googleAdsSecret, adsClient)
+}
+
+func main() {
+	lambda.Start(warmup.Handler(HandleEvent))
+}
+
+// HandleEvent adjusts the Google Ads conversions of refunded orders, so
+// the conversion value Google Ads reports, and the revenue the bid
+// optimizer's ROAS is computed from, are what the order kept: a full
+// refund retracts the conversion, a partial one restates its value in
+// proportion to what was refunded. Orders that were never uploaded as
+// conversions are skipped. Messages that could not be adjusted are
+// reported back to SQS on their own, so the rest of the batch is not
+// redelivered.
+func HandleEvent(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	emf := gads.Metrics("conversion-adjuster", environment, clk)
+	defer emf.Flush()
+
+	var response events.SQSEventResponse
+	fail := func(messageID string) {
+		response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: messageID})
+	}
+
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return response, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	db := dynamodb.NewFromConfig(cfg)
+	uploads := dynamo.NewTable(db, uploadsTable, dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second))
+
+	byCustomer := make(map[string][]adjustment)
+	var skipped int
+	for _, record := range event.Records {
+		adj, err := planAdjustment(ctx, uploads, record)
+		switch {
+		case errors.Is(err, errNoAdjustment):
+			skipped++
+			continue
+		case err != nil:
+			log.Printf("Failed to plan adjustment for message %s: %v", record.MessageId, err)
+			fail(record.MessageId)
+			continue
+		}
+		byCustomer[adj.Record.CustomerID] = append(byCustomer[adj.Record.CustomerID], adj)
+	}
+	emf.Count("RefundsSkipped", skipped)
+
+	if len(byCustomer) == 0 {
+		return response, nil
+	}
+
+	client, err := adsClient.Get(ctx)
+	if err != nil {
+		return events.SQSEventResponse{}, fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	var uploaded, failed int
+	for customerID, adjustments := range byCustomer {
+		done, err := uploadAdjustments(ctx, client, customerID, adjustments)
+		if err != nil {
+			log.Printf("Failed to upload adjustments for customer %s: %v", customerID, err)
+		}
+		for i, adj := range adjustments {
+			if !done[i] {
+				failed++
+				fail(adj.MessageID)
+				continue
+			}
+			uploaded++
+			if err := recordAdjustment(ctx, db, uploads, adj); err != nil {
+				// Google Ads has the adjustment; a redelivery would only
+				// upload the same one again.
+				log.Printf("Failed to record adjustment of order %s: %v", adj.Record.OrderID, err)
+			}
+		}
+	}
+
+	emf.Count("AdjustmentsUploaded", uploaded)
+	emf.Count("AdjustmentsFailed", failed)
+	log.Printf("Uploaded %d conversion adjustments, %d failed, %d refunds skipped", uploaded, failed, skipped)
+	return response, nil
+}
+
+// errNoAdjustment marks a message that needs no adjustment, now or later.
+var errNoAdjustment = errors.New("no adjustment needed")
+
+// planAdjustment reads one queued refund event into the adjustment it
+// calls for. Other errors than errNoAdjustment are worth retrying.
+func planAdjustment(ctx context.Context, uploads *dynamo.Table, record events.SQSMessage) (adjustment, error) {
+	var bus BusEvent
+	if err := json.Unmarshal([]byte(record.Body), &bus); err != nil {
+		log.Printf("Dropping malformed message %s: %v", record.MessageId, err)
+		return adjustment{}, errNoAdjustment
+	}
+	if bus.DetailType != detailTypePaymentRefunded && bus.DetailType != detailTypePartiallyRefunded {
+		log.Printf("Ignoring event %s with detail type %q", bus.ID, bus.DetailType)
+		return adjustment{}, errNoAdjustment
+	}
+	var refund PaymentRefund
+	if err := json.Unmarshal(bus.Detail, &refund); err != nil || refund.OrderID == "" || refund.Amount <= 0 {
+		log.Printf("Dropping malformed event %s", bus.ID)
+		return adjustment{}, errNoAdjustment
+	}
+
+	rec, err := dynamo.Get[uploadRecord](ctx, uploads, dynamo.StringKey("order_id", refund.OrderID))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		// Not attributed to a Google Ads click.
+		return adjustment{}, errNoAdjustment
+	}
+	if err != nil {
+		return adjustment{}, fmt.Errorf("failed to get upload record of order %s: %w", refund.OrderID, err)
+	}
+	if rec.Status != statusUploaded {
+		// The conversion is being uploaded; adjust it once it is.
+		return adjustment{}, fmt.Errorf("conversion of order %s is %s", refund.OrderID, rec.Status)
+	}
+
+	share := 1.0
+	if bus.DetailType == detailTypePartiallyRefunded {
+		share = math.Min(float64(refund.AmountRefunded)/float64(refund.Amount), 1)
+	}
+	if share <= rec.RefundedShare {
+		log.Printf("Skipping refund event %s: order %s is already adjusted for %.0f%% refunded", bus.ID, rec.OrderID, rec.RefundedShare*100)
+		return adjustment{}, errNoAdjustment
+	}
+
+	adj := adjustment{MessageID: record.MessageId, Record: rec, RefundedShare: share, At: refund.OccurredAt}
+	switch {
+	case share >= 1:
+		adj.Type = AdjustmentRetraction
+	case rec.Value <= 0:
+		// Uploaded before conversion values were recorded.
+		log.Printf("Cannot restate conversion of order %s: its uploaded value is unknown", rec.OrderID)
+		return adjustment{}, errNoAdjustment
+	default:
+		adj.Type = AdjustmentRestatement
+		adj.AdjustedValue = math.Round(rec.Value*(1-share)*100) / 100
+	}
+	// Google Ads rejects adjustments dated before the conversion.
+	if earliest := rec.ConversionTime.Add(time.Minute); adj.At.Before(earliest) {
+		adj.At = earliest
+	}
+	return adj, nil
+}
+
+// uploadAdjustments uploads one customer's adjustments and reports which
+// of them Google Ads has.
+func uploadAdjustments(ctx context.Context, client *googleads.Service, customerID string, adjustments []adjustment) ([]bool, error) {
+	done := make([]bool, len(adjustments))
+	requests := make([]*googleads.ConversionAdjustment, len(adjustments))
+	for i, adj := range adjustments {
+		requests[i] = &googleads.ConversionAdjustment{
+			ConversionAction:   fmt.Sprintf("customers/%s/conversionActions/%s", customerID, conversionActionID),
+			AdjustmentType:     adj.Type,
+			AdjustmentDateTime: adj.At.Format("2006-01-02 15:04:05-07:00"),
+			OrderId:            adj.Record.OrderID,
+		}
+		if adj.Type == AdjustmentRestatement {
+			requests[i].RestatementValue = &googleads.RestatementValue{
+				AdjustedValue: adj.AdjustedValue,
+				CurrencyCode:  adj.Record.Currency,
+			}
+		}
+	}
+
+	resp, err := client.UploadConversionAdjustments(ctx, &googleads.UploadConversionAdjustmentsRequest{
+		CustomerId:            customerID,
+		ConversionAdjustments: requests,
+		PartialFailure:        true,
+	})
+	if err != nil {
+		return done, fmt.Errorf("failed to upload conversion adjustments: %w", err)
+	}
+
+	failures := make(map[int]*googleads.PartialFailureDetail)
+	if resp.PartialFailureError != nil {
+		for _, detail := range resp.PartialFailureError.Details {
+			failures[detail.Index] = detail
+		}
+	}
+	for i, adj := range adjustments {
+		detail, failed := failures[i]
+		switch {
+		case !failed, settledErrorCodes[detail.ErrorCode]:
+			done[i] = true
+		default:
+			// Usually CONVERSION_NOT_FOUND for a conversion Google Ads is
+			// still processing; the redelivery tries again.
+			log.Printf("%s of order %s rejected: %s %s", adj.Type, adj.Record.OrderID, detail.ErrorCode, detail.Message)
+		}
+	}
+	log.Printf("Uploaded %d of %d conversion adjustments for customer %s", len(adjustments)-len(failures), len(adjustments), customerID)
+	return done, nil
+}
+
+// recordAdjustment notes the refund adjusted for on the upload record,
+// and brings the order's revenue, which the bid optimizer computes ROAS
+// from, in line with the conversion value.
+func recordAdjustment(ctx context.Context, db *dynamodb.Client, uploads *dynamo.Table, adj adjustment) error {
+	now := clk.Now().UTC().Format(time.RFC3339)
+	err := uploads.Update(ctx, dynamo.StringKey("order_id", adj.Record.OrderID), dynamo.Update{
+		Expression: "SET refunded_share = :share, adjustment_type = :type, adjusted_at = :now",
+		Condition:  "attribute_not_exists(refunded_share) OR refunded_share < :share",
+		Values: map[string]types.AttributeValue{
+			":share": dynamo.N(strconv.FormatFloat(adj.RefundedShare, 'f', -1, 64)),
+			":type":  dynamo.S(adj.Type),
+			":now":   dynamo.S(now),
+		},
+	}, nil)
+	if err != nil && !errors.Is(err, dynamo.ErrConditionFailed) {
+		return fmt.Errorf("failed to update upload record: %w", err)
+	}
+
+	if revenueTable == "" {
+		return nil
+	}
+	revenue := dynamo.NewTable(db, revenueTable, dynamo.WithTimeout(5*time.Second))
+	orderKey := adj.Record.ConversionTime.UTC().Format("2006-01-02") + "#" + adj.Record.OrderID
+	err = revenue.Update(ctx, dynamo.CompositeKey("customer_id", adj.Record.CustomerID, "order_key", orderKey), dynamo.Update{
+		Expression: "SET #value = :value, refunded_share = :share",
+		Condition:  "attribute_exists(order_id) AND (attribute_not_exists(refunded_share) OR refunded_share < :share)",
+		Names:      map[string]string{"#value": "value"},
+		Values: map[string]types.AttributeValue{
+			":value": dynamo.N(strconv.FormatFloat(adj.AdjustedValue, 'f', -1, 64)),
+			":share": dynamo.N(strconv.FormatFloat(adj.RefundedShare, 'f', -1, 64)),
+		},
+	}, nil)
+	if err != nil && !errors.Is(err, dynamo.ErrConditionFailed) {
+		return fmt.Errorf("failed to update order revenue: %w", err)
+	}
+	return nil
+}
+
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx)
+}
+
+func loadGoogleAdsConfig(ctx context.Context) (*GoogleAdsConfig, error) {
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(ctx context.Context) (*googleads.Service, error) {
+	adsConfig, err := googleAdsSecret.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	srv, err := googleads.NewService(context.Background(),
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
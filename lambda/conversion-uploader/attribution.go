@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/attribution"
+	"pkg/dynamo"
+)
+
+// attributionsTable is attribution-service's table of order attributions.
+// A conversion queued without a click ID, as order-service queues orders
+// it cannot tie to a click itself, is completed from its order's record
+// there. Lookups are off when ATTRIBUTIONS_TABLE_NAME is unset.
+var attributionsTable = os.Getenv("ATTRIBUTIONS_TABLE_NAME")
+
+// applyAttribution fills in order's click ID, and the campaign, ad group
+// and keyword it does not carry, from the click its order is credited to.
+// Google Ads takes one click ID per conversion: the gclid if the click had
+// one, otherwise its wbraid or gbraid. Orders with a click ID, and orders
+// not attributed to a click, are left as they are.
+func applyAttribution(ctx context.Context, db *dynamodb.Client, order *OrderConversion) error {
+	if attributionsTable == "" || order.hasClickID() {
+		return nil
+	}
+
+	store := attribution.NewStore(nil, dynamo.NewTable(db, attributionsTable), clk, 0)
+	record, err := store.Lookup(ctx, order.OrderID)
+	if errors.Is(err, attribution.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if record.Click == nil {
+		return nil
+	}
+
+	click := record.Click
+	switch {
+	case click.Gclid != "":
+		order.Gclid = click.Gclid
+	case click.Wbraid != "":
+		order.Wbraid = click.Wbraid
+	default:
+		order.Gbraid = click.Gbraid
+	}
+	if order.CampaignID == "" {
+		order.CampaignID, order.AdGroupID, order.Keyword = click.CampaignID, click.AdGroupID, click.Keyword
+	}
+	return nil
+}
+
+// hasClickID reports whether the order carries a click ID to upload with.
+func (o OrderConversion) hasClickID() bool {
+	return o.Gclid != "" || o.Wbraid != "" || o.Gbraid != ""
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/bloom"
+)
+
+// Upload record statuses.
+const (
+	StatusPending  = "PENDING"
+	StatusUploaded = "UPLOADED"
+)
+
+// Where a duplicate was caught.
+const (
+	SourceBloom     = "bloom_precheck"
+	SourceClaim     = "conditional_write"
+	SourceGoogleAds = "google_ads"
+)
+
+const (
+	// staleClaimAfter lets another invocation take over a PENDING claim
+	// left behind by a crashed or timed-out run.
+	staleClaimAfter = 15 * time.Minute
+	// uploadRecordTTL outlives the 90-day GCLID click window.
+	uploadRecordTTL = 180 * 24 * time.Hour
+	duplicateTTL    = 90 * 24 * time.Hour
+)
+
+// DuplicateRecord is one blocked or downstream-detected duplicate.
+type DuplicateRecord struct {
+	Date       string    `json:"date" dynamodbav:"date"`
+	DetectedID string    `json:"-" dynamodbav:"detected_id"`
+	OrderID    string    `json:"order_id" dynamodbav:"order_id"`
+	CustomerID string    `json:"customer_id" dynamodbav:"customer_id"`
+	Gclid      string    `json:"gclid" dynamodbav:"gclid"`
+	Source     string    `json:"source" dynamodbav:"source"`
+	DetectedAt time.Time `json:"detected_at" dynamodbav:"detected_at"`
+	ExpiresAt  int64     `json:"-" dynamodbav:"expires_at"`
+}
+
+// Deduper guarantees an order ID is uploaded at most once. DynamoDB is the
+// source of truth; the bloom filter only short-circuits lookups: a miss
+// proves this container has never seen the ID, a hit is confirmed against
+// the table before anything is dropped.
+type Deduper struct {
+	db     *dynamodb.Client
+	filter *bloom.Filter
+}
+
+// Claim reserves order for upload. It returns false if the order has already
+// been uploaded or is being uploaded by another invocation.
+func (d *Deduper) Claim(ctx context.Context, order OrderConversion) (bool, error) {
+	if d.filter.MayContain(order.OrderID) {
+		exists, err := d.uploaded(ctx, order.OrderID)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			d.RecordDuplicate(ctx, order, SourceBloom)
+			return false, nil
+		}
+	}
+
+	now := clk.Now()
+	_, err := d.db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(uploadsTable),
+		Item: map[string]types.AttributeValue{
+			"order_id":    &types.AttributeValueMemberS{Value: order.OrderID},
+			"customer_id": &types.AttributeValueMemberS{Value: order.CustomerID},
+			"gclid":       &types.AttributeValueMemberS{Value: order.Gclid},
+			"status":      &types.AttributeValueMemberS{Value: StatusPending},
+			// What was uploaded, for conversion-adjuster to restate.
+			"value":           &types.AttributeValueMemberN{Value: strconv.FormatFloat(order.Value, 'f', -1, 64)},
+			"currency":        &types.AttributeValueMemberS{Value: order.Currency},
+			"conversion_time": &types.AttributeValueMemberS{Value: order.ConversionTime.UTC().Format(time.RFC3339)},
+			"claimed_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			"expires_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(uploadRecordTTL).Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(order_id) OR (#status = :pending AND claimed_at < :stale)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: StatusPending},
+			":stale":   &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(-staleClaimAfter).Unix(), 10)},
+		},
+	})
+
+	d.filter.Add(order.OrderID)
+
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		d.RecordDuplicate(ctx, order, SourceClaim)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim order: %w", err)
+	}
+	return true, nil
+}
+
+// MarkUploaded settles a claim once Google Ads has the conversion.
+func (d *Deduper) MarkUploaded(ctx context.Context, orderID string) error {
+	_, err := d.db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(uploadsTable),
+		Key: map[string]types.AttributeValue{
+			"order_id": &types.AttributeValueMemberS{Value: orderID},
+		},
+		UpdateExpression: aws.String("SET #status = :uploaded, uploaded_at = :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uploaded": &types.AttributeValueMemberS{Value: StatusUploaded},
+			":now":      &types.AttributeValueMemberN{Value: strconv.FormatInt(clk.Now().Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update upload record: %w", err)
+	}
+	return nil
+}
+
+// Release drops a PENDING claim so a redelivery can retry the upload. The
+// bloom filter keeps the ID, which only costs the retry one extra read.
+func (d *Deduper) Release(ctx context.Context, orderID string) {
+	_, err := d.db.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(uploadsTable),
+		Key: map[string]types.AttributeValue{
+			"order_id": &types.AttributeValueMemberS{Value: orderID},
+		},
+		ConditionExpression: aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: StatusPending},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to release claim for order %s: %v", orderID, err)
+	}
+}
+
+// RecordDuplicate stores a duplicate for the reconciliation report. Failures
+// are logged only; they must not block the upload path.
+func (d *Deduper) RecordDuplicate(ctx context.Context, order OrderConversion, source string) {
+	now := clk.Now().UTC()
+	record := DuplicateRecord{
+		Date:       now.Format("2006-01-02"),
+		DetectedID: fmt.Sprintf("%s#%s", now.Format(time.RFC3339Nano), order.OrderID),
+		OrderID:    order.OrderID,
+		CustomerID: order.CustomerID,
+		Gclid:      order.Gclid,
+		Source:     source,
+		DetectedAt: now,
+		ExpiresAt:  now.Add(duplicateTTL).Unix(),
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		log.Printf("Failed to marshal duplicate record: %v", err)
+		return
+	}
+	_, err = d.db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(duplicatesTable),
+		Item:      item,
+	})
+	if err != nil {
+		log.Printf("Failed to record duplicate for order %s: %v", order.OrderID, err)
+	}
+}
+
+// Duplicates returns the duplicates detected on date (YYYY-MM-DD).
+func (d *Deduper) Duplicates(ctx context.Context, date string) ([]DuplicateRecord, error) {
+	paginator := dynamodb.NewQueryPaginator(d.db, &dynamodb.QueryInput{
+		TableName:              aws.String(duplicatesTable),
+		KeyConditionExpression: aws.String("#date = :date"),
+		ExpressionAttributeNames: map[string]string{
+			"#date": "date",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":date": &types.AttributeValueMemberS{Value: date},
+		},
+	})
+
+	var records []DuplicateRecord
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query duplicates: %w", err)
+		}
+		var batch []DuplicateRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal duplicates: %w", err)
+		}
+		records = append(records, batch...)
+	}
+	return records, nil
+}
+
+// uploaded reports whether an order already has an upload record.
+func (d *Deduper) uploaded(ctx context.Context, orderID string) (bool, error) {
+	result, err := d.db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(uploadsTable),
+		Key: map[string]types.AttributeValue{
+			"order_id": &types.AttributeValueMemberS{Value: orderID},
+		},
+		ProjectionExpression: aws.String("order_id, #status"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get upload record: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return false, nil
+	}
+	status, _ := result.Item["status"].(*types.AttributeValueMemberS)
+	return status != nil && status.Value == StatusUploaded, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Value-based conversions: with LTV_CONVERSION_VALUES set, an order by a
+// scored customer is uploaded at its value times the customer's LTV value
+// multiplier, which ltv-scorer stores on the user, so Smart Bidding pays
+// more for the customers worth more over time. Revenue for ROAS keeps the
+// order's own value.
+var (
+	ltvConversionValues = os.Getenv("LTV_CONVERSION_VALUES") == "true"
+	usersTable          = os.Getenv("USERS_TABLE_NAME")
+)
+
+// applyLTVValue scales order's value by its customer's LTV multiplier.
+// Orders without a user, or whose user is not scored, keep their value.
+func applyLTVValue(ctx context.Context, db *dynamodb.Client, order *OrderConversion) error {
+	if !ltvConversionValues || usersTable == "" || order.UserID == "" {
+		return nil
+	}
+
+	result, err := db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(usersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: order.UserID},
+		},
+		ProjectionExpression:     aws.String("#ltv.#multiplier"),
+		ExpressionAttributeNames: map[string]string{"#ltv": "ltv", "#multiplier": "value_multiplier"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read LTV of user %s: %w", order.UserID, err)
+	}
+
+	var user struct {
+		LTV struct {
+			ValueMultiplier float64 `dynamodbav:"value_multiplier"`
+		} `dynamodbav:"ltv"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
+		return fmt.Errorf("failed to unmarshal LTV of user %s: %w", order.UserID, err)
+	}
+	if m := user.LTV.ValueMultiplier; m > 0 {
+		order.Value = math.Round(order.Value*m*100) / 100
+	}
+	return nil
+}
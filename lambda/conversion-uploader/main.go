@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/bloom"
+	"pkg/clock"
+	"pkg/envelope"
+	"pkg/warmup"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+// Envelope type and highest schema version of queued conversions.
+// Producers that predate envelopes send the bare OrderConversion.
+const (
+	conversionMessageType   = "order_conversion"
+	conversionSchemaVersion = 1
+)
+
+// OrderConversion is a completed order attributed to a Google Ads click,
+// delivered on the conversions queue. The click is its gclid or, for
+// clicks subject to App Tracking Transparency, its wbraid or gbraid; a
+// conversion without any is completed from the order's attribution (see
+// attribution.go).
+type OrderConversion struct {
+	OrderID        string    `json:"order_id"`
+	CustomerID     string    `json:"customer_id,omitempty"`
+	Gclid          string    `json:"gclid,omitempty"`
+	Wbraid         string    `json:"wbraid,omitempty"`
+	Gbraid         string    `json:"gbraid,omitempty"`
+	ConversionTime time.Time `json:"conversion_time"`
+	Value          float64   `json:"value"`
+	Currency       string    `json:"currency"`
+
+	// The click's campaign, ad group and keyword, as the landing page
+	// received them in utm_campaign, utm_content and utm_term (see
+	// tracking.DefaultScheme). Optional; they attribute revenue for ROAS.
+	CampaignID string `json:"campaign_id,omitempty"`
+	AdGroupID  string `json:"ad_group_id,omitempty"`
+	Keyword    string `json:"keyword,omitempty"`
+
+	// ProductIDs are the ecomm_prodid the purchase page's remarketing tag
+	// carried, as the storefront reports them. Optional; remarketing-audit
+	// checks them against the catalogue.
+	ProductIDs []string `json:"product_ids,omitempty"`
+
+	// UserID is the customer's account, empty for guest checkouts.
+	// Optional; it scales the uploaded value by their LTV (see ltv.go).
+	UserID string `json:"user_id,omitempty"`
+}
+
+// Google Ads error codes meaning the conversion was already recorded.
+var duplicateErrorCodes = map[string]bool{
+	"CLICK_CONVERSION_ALREADY_EXISTS": true,
+	"DUPLICATE_ORDER_ID":              true,
+}
+
+var (
+	secretName         = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	defaultCustomerID  = os.Getenv("GOOGLE_ADS_CUSTOMER_ID")
+	conversionActionID = os.Getenv("CONVERSION_ACTION_ID")
+	uploadsTable       = os.Getenv("UPLOADS_TABLE_NAME")
+	duplicatesTable    = os.Getenv("DUPLICATES_TABLE_NAME")
+	snsTopicARN        = os.Getenv("SNS_TOPIC_ARN")
+	messageKeyID       = os.Getenv("MESSAGE_KMS_KEY_ID")
+	environment        = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+
+	// Set up during init and kept across invocations; the secret and the
+	// client built from it are reloaded every warmup.RefreshFromEnv.
+	awsCfg          = warmup.New("aws_config", 0, loadAWSConfig)
+	googleAdsSecret = warmup.New("google_ads_secret", warmup.RefreshFromEnv(), loadGoogleAdsConfig)
+	adsClient       = warmup.New("google_ads_client", warmup.RefreshFromEnv(), createGoogleAdsClient)
+
+	// seen survives across warm invocations so repeated order IDs are
+	// caught without a DynamoDB round trip.
+	seen = bloom.New(getIntEnv("BLOOM_EXPECTED_ORDERS", 100000), 0.001)
+)
+
+func init() {
+	warmup.Prime(awsCfg, googleAdsSecret, adsClient)
+}
+
+func main() {
+	lambda.Start(warmup.ErrorHandler(HandleEvent))
+}
+
+// HandleEvent uploads conversions from the SQS queue and, when invoked by
+// the daily EventBridge schedule, runs the duplicate reconciliation report.
+func HandleEvent(ctx context.Context, raw json.RawMessage) error {
+	var probe struct {
+		Records    []json.RawMessage `json:"Records"`
+		DetailType string            `json:"detail-type"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dedup := &Deduper{db: dynamodb.NewFromConfig(cfg), filter: seen}
+
+	if probe.DetailType == "Scheduled Event" {
+		return reconcile(ctx, cfg, dedup, clk.Now().AddDate(0, 0, -1))
+	}
+
+	var event events.SQSEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return fmt.Errorf("failed to unmarshal SQS event: %w", err)
+	}
+	return uploadConversions(ctx, cfg, dedup, event)
+}
+
+func uploadConversions(ctx context.Context, cfg aws.Config, dedup *Deduper, event events.SQSEvent) error {
+	// Decode the whole batch first: if KMS is unavailable nothing has been
+	// claimed yet and SQS simply redelivers.
+	codec := envelope.New("conversion-uploader", kms.NewFromConfig(cfg), messageKeyID, clk)
+	var orders []OrderConversion
+	for _, record := range event.Records {
+		order, err := decodeConversion(ctx, codec, record.Body)
+		if errors.Is(err, envelope.ErrKeyUnavailable) {
+			return fmt.Errorf("failed to decrypt message %s: %w", record.MessageId, err)
+		}
+		if err != nil {
+			log.Printf("Skipping malformed message %s: %v", record.MessageId, err)
+			continue
+		}
+		if order.OrderID == "" {
+			log.Printf("Skipping message %s: order_id is required", record.MessageId)
+			continue
+		}
+		if err := applyAttribution(ctx, dedup.db, &order); err != nil {
+			return fmt.Errorf("failed to look up attribution of order %s: %w", order.OrderID, err)
+		}
+		if !order.hasClickID() {
+			log.Printf("Skipping order %s: no gclid, wbraid or gbraid and no attributed click", order.OrderID)
+			continue
+		}
+		if order.CustomerID == "" {
+			order.CustomerID = defaultCustomerID
+		}
+		orders = append(orders, order)
+	}
+
+	// Revenue is recorded for every order, duplicates included: the write
+	// is idempotent, and failing here leaves nothing claimed.
+	for _, order := range orders {
+		if err := recordRevenue(ctx, dedup.db, order); err != nil {
+			return err
+		}
+	}
+	for i := range orders {
+		if err := applyLTVValue(ctx, dedup.db, &orders[i]); err != nil {
+			return err
+		}
+	}
+
+	// Claim every order before uploading anything, so a conversion that
+	// arrives twice in one batch or concurrently elsewhere is uploaded once.
+	byCustomer := make(map[string][]OrderConversion)
+	for _, order := range orders {
+		claimed, err := dedup.Claim(ctx, order)
+		if err != nil {
+			return fmt.Errorf("failed to claim order %s: %w", order.OrderID, err)
+		}
+		if !claimed {
+			log.Printf("Skipping duplicate conversion for order %s", order.OrderID)
+			continue
+		}
+		byCustomer[order.CustomerID] = append(byCustomer[order.CustomerID], order)
+	}
+
+	if len(byCustomer) == 0 {
+		return nil
+	}
+
+	client, err := adsClient.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	var failed int
+	for customerID, orders := range byCustomer {
+		n, err := uploadBatch(ctx, client, dedup, customerID, orders)
+		if err != nil {
+			log.Printf("Failed to upload conversions for customer %s: %v", customerID, err)
+		}
+		failed += n
+	}
+
+	if failed > 0 {
+		// Released claims are retried when SQS redelivers the batch;
+		// already-uploaded orders are then skipped as duplicates.
+		return fmt.Errorf("failed to upload %d conversions", failed)
+	}
+	return nil
+}
+
+// decodeConversion reads an enveloped or bare conversion message.
+func decodeConversion(ctx context.Context, codec *envelope.Codec, body string) (OrderConversion, error) {
+	var order OrderConversion
+	env, err := codec.Open(ctx, body)
+	if errors.Is(err, envelope.ErrNotEnvelope) {
+		if err := json.Unmarshal([]byte(body), &order); err != nil {
+			return OrderConversion{}, err
+		}
+		return order, nil
+	}
+	if err != nil {
+		return OrderConversion{}, err
+	}
+	if err := env.Expect(conversionMessageType, conversionSchemaVersion); err != nil {
+		return OrderConversion{}, err
+	}
+	if err := env.Decode(&order); err != nil {
+		return OrderConversion{}, err
+	}
+	return order, nil
+}
+
+// uploadBatch uploads one customer's claimed orders and settles each claim.
+// It returns how many orders must be retried.
+func uploadBatch(ctx context.Context, client *googleads.Service, dedup *Deduper, customerID string, orders []OrderConversion) (int, error) {
+	conversions := make([]*googleads.ClickConversion, len(orders))
+	for i, order := range orders {
+		conversions[i] = &googleads.ClickConversion{
+			Gclid:              order.Gclid,
+			Wbraid:             order.Wbraid,
+			Gbraid:             order.Gbraid,
+			ConversionAction:   fmt.Sprintf("customers/%s/conversionActions/%s", customerID, conversionActionID),
+			ConversionDateTime: order.ConversionTime.Format("2006-01-02 15:04:05-07:00"),
+			ConversionValue:    order.Value,
+			CurrencyCode:       order.Currency,
+			OrderId:            order.OrderID,
+		}
+	}
+
+	resp, err := client.UploadClickConversions(ctx, &googleads.UploadClickConversionsRequest{
+		CustomerId:     customerID,
+		Conversions:    conversions,
+		PartialFailure: true,
+	})
+	if err != nil {
+		for _, order := range orders {
+			dedup.Release(ctx, order.OrderID)
+		}
+		return len(orders), fmt.Errorf("failed to upload click conversions: %w", err)
+	}
+
+	failures := make(map[int]*googleads.PartialFailureDetail)
+	if resp.PartialFailureError != nil {
+		for _, detail := range resp.PartialFailureError.Details {
+			failures[detail.Index] = detail
+		}
+	}
+
+	var retry int
+	for i, order := range orders {
+		detail, failed := failures[i]
+		switch {
+		case !failed:
+			if err := dedup.MarkUploaded(ctx, order.OrderID); err != nil {
+				log.Printf("Failed to mark order %s uploaded: %v", order.OrderID, err)
+			}
+		case duplicateErrorCodes[detail.ErrorCode]:
+			// Google Ads already has this conversion: our dedup layer let a
+			// duplicate through, which the reconciliation report surfaces.
+			if err := dedup.MarkUploaded(ctx, order.OrderID); err != nil {
+				log.Printf("Failed to mark order %s uploaded: %v", order.OrderID, err)
+			}
+			dedup.RecordDuplicate(ctx, order, SourceGoogleAds)
+		default:
+			log.Printf("Conversion for order %s rejected: %s %s", order.OrderID, detail.ErrorCode, detail.Message)
+			dedup.Release(ctx, order.OrderID)
+			retry++
+		}
+	}
+
+	log.Printf("Uploaded %d of %d conversions for customer %s", len(orders)-len(failures), len(orders), customerID)
+	return retry, nil
+}
+
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx)
+}
+
+func loadGoogleAdsConfig(ctx context.Context) (*GoogleAdsConfig, error) {
+	cfg, err := awsCfg.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(ctx context.Context) (*googleads.Service, error) {
+	adsConfig, err := googleAdsSecret.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	srv, err := googleads.NewService(context.Background(),
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
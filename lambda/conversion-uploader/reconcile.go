@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+
+	"pkg/envelope"
+)
+
+// Envelope type and schema version of the reconciliation report. Leaked
+// items carry GCLIDs and order IDs, so the body is encrypted.
+const (
+	reconciliationMessageType   = "conversion_reconciliation"
+	reconciliationSchemaVersion = 1
+)
+
+// ReconciliationReport summarises one day of duplicate conversions. Blocked
+// duplicates (bloom pre-check, conditional write) are expected noise from
+// retries; Leaked counts duplicates that only Google Ads caught, which means
+// the dedup layer missed them and warrants investigation.
+type ReconciliationReport struct {
+	Date        string            `json:"date"`
+	Environment string            `json:"environment"`
+	Total       int               `json:"total"`
+	BySource    map[string]int    `json:"by_source"`
+	Leaked      int               `json:"leaked"`
+	LeakedItems []DuplicateRecord `json:"leaked_items,omitempty"`
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+func reconcile(ctx context.Context, cfg aws.Config, dedup *Deduper, day time.Time) error {
+	date := day.UTC().Format("2006-01-02")
+	records, err := dedup.Duplicates(ctx, date)
+	if err != nil {
+		return fmt.Errorf("failed to load duplicates for %s: %w", date, err)
+	}
+
+	report := ReconciliationReport{
+		Date:        date,
+		Environment: environment,
+		Total:       len(records),
+		BySource:    make(map[string]int),
+		GeneratedAt: clk.Now(),
+	}
+	for _, record := range records {
+		report.BySource[record.Source]++
+		if record.Source == SourceGoogleAds {
+			report.Leaked++
+			report.LeakedItems = append(report.LeakedItems, record)
+		}
+	}
+
+	log.Printf("Conversion dedup reconciliation for %s: %d duplicates, %d leaked to Google Ads", date, report.Total, report.Leaked)
+	if report.Total == 0 {
+		return nil
+	}
+
+	codec := envelope.New("conversion-uploader", kms.NewFromConfig(cfg), messageKeyID, clk)
+	body, err := codec.Seal(ctx, envelope.Meta{
+		Type:          reconciliationMessageType,
+		SchemaVersion: reconciliationSchemaVersion,
+		Sensitive:     true,
+	}, report)
+	if err != nil {
+		return fmt.Errorf("failed to seal reconciliation report: %w", err)
+	}
+
+	_, err = sns.NewFromConfig(cfg).Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(snsTopicARN),
+		Message:  aws.String(body),
+		Subject:  aws.String(fmt.Sprintf("Conversion Dedup Reconciliation - %s", date)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish reconciliation report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/tracking"
+)
+
+// revenueTable holds every attributed order's revenue, which the bid
+// optimizer joins with Google Ads cost to compute ROAS, and the product IDs
+// its remarketing tag carried, which remarketing-audit checks. Recording
+// is off when ORDER_REVENUE_TABLE_NAME is unset.
+var revenueTable = os.Getenv("ORDER_REVENUE_TABLE_NAME")
+
+// orderRevenueTTL keeps revenue well past the bid optimizer's lookback.
+const orderRevenueTTL = 120 * 24 * time.Hour
+
+// OrderRevenue is one order's revenue as stored for ROAS. OrderKey sorts
+// a customer's orders by conversion date, so a lookback window is a single
+// key range query.
+type OrderRevenue struct {
+	CustomerID     string    `dynamodbav:"customer_id"`
+	OrderKey       string    `dynamodbav:"order_key"`
+	OrderID        string    `dynamodbav:"order_id"`
+	Gclid          string    `dynamodbav:"gclid"`
+	CampaignID     string    `dynamodbav:"campaign_id,omitempty"`
+	AdGroupID      string    `dynamodbav:"ad_group_id,omitempty"`
+	Keyword        string    `dynamodbav:"keyword,omitempty"`
+	ProductIDs     []string  `dynamodbav:"product_ids,omitempty"`
+	Value          float64   `dynamodbav:"value"`
+	Currency       string    `dynamodbav:"currency"`
+	ConversionTime time.Time `dynamodbav:"conversion_time"`
+	ExpiresAt      int64     `dynamodbav:"expires_at"`
+}
+
+// recordRevenue stores order's revenue. The write is keyed by order ID, so
+// a redelivered or duplicate order overwrites its own record rather than
+// counting twice.
+func recordRevenue(ctx context.Context, db *dynamodb.Client, order OrderConversion) error {
+	if revenueTable == "" {
+		return nil
+	}
+
+	item, err := attributevalue.MarshalMap(OrderRevenue{
+		CustomerID:     order.CustomerID,
+		OrderKey:       order.ConversionTime.UTC().Format("2006-01-02") + "#" + order.OrderID,
+		OrderID:        order.OrderID,
+		Gclid:          order.Gclid,
+		CampaignID:     order.CampaignID,
+		AdGroupID:      order.AdGroupID,
+		Keyword:        tracking.NormalizeKeyword(order.Keyword),
+		ProductIDs:     order.ProductIDs,
+		Value:          order.Value,
+		Currency:       order.Currency,
+		ConversionTime: order.ConversionTime,
+		ExpiresAt:      clk.Now().Add(orderRevenueTTL).Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal order revenue: %w", err)
+	}
+
+	_, err = db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(revenueTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record revenue for order %s: %w", order.OrderID, err)
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	domain "pkg/events"
+	"pkg/metrics"
+)
+
+// metricNamespace groups the analytics forwarding metrics.
+const metricNamespace = "Ecommerce/Analytics"
+
+// Bus events forwarded, and the GA4 events they become.
+const (
+	detailTypePaymentRefunded = "Payment Refunded"
+
+	eventPurchase = "purchase"
+	eventRefund   = "refund"
+)
+
+const (
+	// maxEventAge is how far back the Measurement Protocol accepts an
+	// event's timestamp; older events are sent without one and land at
+	// the time they are received.
+	maxEventAge = 72 * time.Hour
+	// forwardedTTL keeps forwarded event records well beyond the queue's
+	// retention, after which a redelivery is impossible.
+	forwardedTTL = 30 * 24 * time.Hour
+)
+
+// GA4Config is the Measurement Protocol credentials secret.
+type GA4Config struct {
+	MeasurementID string `json:"measurement_id"`
+	APISecret     string `json:"api_secret"`
+}
+
+// BusEvent is an EventBridge event as delivered to the queue.
+type BusEvent struct {
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Time       time.Time       `json:"time"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// PaymentRefunded is the part of payment-service's "Payment Refunded"
+// detail this lambda needs. It means nothing of the payment is left, so
+// the refund is the order's total; partial refunds are not forwarded.
+type PaymentRefunded struct {
+	OrderID    string    `json:"order_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// orderMetadata is the part of a checkout-service checkout this lambda
+// reads. The checkout ID is the order ID.
+type orderMetadata struct {
+	ID          string         `dynamodbav:"id"`
+	UserID      string         `dynamodbav:"user_id"`
+	Status      string         `dynamodbav:"status"`
+	Items       []checkoutItem `dynamodbav:"items"`
+	Currency    string         `dynamodbav:"currency"`
+	Total       float64        `dynamodbav:"total"`
+	CouponCode  string         `dynamodbav:"coupon_code"`
+	GAClientID  string         `dynamodbav:"ga_client_id"`
+	GASessionID string         `dynamodbav:"ga_session_id"`
+}
+
+type checkoutItem struct {
+	SKU       string  `dynamodbav:"sku"`
+	Name      string  `dynamodbav:"name"`
+	Quantity  int     `dynamodbav:"quantity"`
+	UnitPrice float64 `dynamodbav:"unit_price"`
+}
+
+// forwardedEvent records a bus event sent to GA4, so a redelivered one
+// is not counted twice.
+type forwardedEvent struct {
+	EventID   string `dynamodbav:"event_id"`
+	OrderID   string `dynamodbav:"order_id"`
+	Name      string `dynamodbav:"name"`
+	ExpiresAt int64  `dynamodbav:"expires_at"`
+}
+
+// checkoutCompleted is checkout-service's status of a paid order.
+const checkoutCompleted = "COMPLETED"
+
+var (
+	secretName     = os.Getenv("GA4_SECRET_ARN")
+	checkoutsTable = os.Getenv("CHECKOUTS_TABLE_NAME")
+	forwardedTable = os.Getenv("FORWARDED_EVENTS_TABLE_NAME")
+	environment    = os.Getenv("ENVIRONMENT")
+
+	// debugValidation sends events to the Measurement Protocol validation
+	// endpoint instead, which records nothing and reports what GA4 would
+	// reject; for checking a property's setup before going live.
+	debugValidation = os.Getenv("GA4_DEBUG_VALIDATION") == "true"
+
+	clk = clock.FromEnv()
+
+	// The credentials and clients outlive an invocation so warm starts
+	// skip loading them.
+	ga4Config    *GA4Config
+	dynamoClient *dynamodb.Client
+	emf          *metrics.Logger
+)
+
+func main() {
+	lambda.Start(HandleEvent)
+}
+
+// HandleEvent forwards a batch of order events from the queue to GA4 as
+// purchase and refund events, stitched to the client and session the
+// storefront's gtag recorded on the order's checkout. Orders placed
+// without one (API clients, or visitors who declined analytics cookies)
+// are not forwarded. Messages whose events could not be sent are reported
+// back to SQS on their own, so the rest of the batch is not redelivered.
+func HandleEvent(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	emf = metrics.NewLogger(metricNamespace, map[string]string{
+		"Function":    "ga4-forwarder",
+		"Environment": environment,
+	}, clk)
+	defer emf.Flush()
+
+	var response events.SQSEventResponse
+	if err := setup(ctx); err != nil {
+		// Nothing in the batch can be sent; SQS redelivers all of it.
+		return response, err
+	}
+	checkouts := dynamo.NewTable(dynamoClient, checkoutsTable, dynamo.WithTimeout(5*time.Second))
+	forwarded := dynamo.NewTable(dynamoClient, forwardedTable, dynamo.WithTimeout(5*time.Second))
+
+	fail := func(messageID string) {
+		response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: messageID})
+	}
+
+	var pending []*pendingEvent
+	for _, record := range event.Records {
+		p, err := buildEvent(ctx, checkouts, record)
+		switch {
+		case errors.Is(err, errNotForwarded):
+			emf.Count("EventsSkipped", 1)
+			continue
+		case err != nil:
+			log.Printf("Failed to build GA4 event for message %s: %v", record.MessageId, err)
+			fail(record.MessageId)
+			continue
+		}
+
+		if !debugValidation {
+			claimed, err := claim(ctx, forwarded, p)
+			if err != nil {
+				log.Printf("Failed to claim event %s: %v", p.EventID, err)
+				fail(record.MessageId)
+				continue
+			}
+			if !claimed {
+				log.Printf("Skipping event %s, already forwarded", p.EventID)
+				emf.Count("EventsDuplicate", 1)
+				continue
+			}
+		}
+		pending = append(pending, p)
+	}
+
+	sent, failed := forward(ctx, *ga4Config, pending)
+	for _, p := range failed {
+		if !debugValidation {
+			if err := forwarded.Delete(ctx, dynamo.StringKey("event_id", p.EventID)); err != nil {
+				// The redelivery is then skipped as a duplicate and the
+				// event lost; rare enough to log rather than fail on.
+				log.Printf("Failed to release event %s: %v", p.EventID, err)
+			}
+		}
+		fail(p.MessageID)
+	}
+
+	emf.Count("EventsForwarded", sent)
+	emf.Count("EventsFailed", len(failed))
+	log.Printf("Forwarded %d of %d GA4 events (%d failed, debug validation %t)", sent, len(event.Records), len(failed), debugValidation)
+	return response, nil
+}
+
+func setup(ctx context.Context) error {
+	if ga4Config != nil {
+		return nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	ga, err := loadGA4Config(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load GA4 config: %w", err)
+	}
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	ga4Config = ga
+	return nil
+}
+
+// errNotForwarded marks a message that is dropped rather than retried.
+var errNotForwarded = errors.New("event not forwarded")
+
+// buildEvent reads one queued bus event into the GA4 event it becomes.
+// Messages that will never become one return errNotForwarded; other
+// errors are worth retrying.
+func buildEvent(ctx context.Context, checkouts *dynamo.Table, record events.SQSMessage) (*pendingEvent, error) {
+	var bus BusEvent
+	if err := json.Unmarshal([]byte(record.Body), &bus); err != nil {
+		log.Printf("Dropping malformed message %s: %v", record.MessageId, err)
+		return nil, errNotForwarded
+	}
+
+	var orderID, name string
+	occurredAt := bus.Time
+	switch bus.DetailType {
+	case domain.DetailTypeOrderCompleted:
+		var order domain.OrderCompleted
+		if _, err := domain.Unmarshal(bus.Detail, &order); err != nil {
+			log.Printf("Dropping malformed event %s: %v", bus.ID, err)
+			return nil, errNotForwarded
+		}
+		orderID, name = order.OrderID, eventPurchase
+	case detailTypePaymentRefunded:
+		var refund PaymentRefunded
+		if err := json.Unmarshal(bus.Detail, &refund); err != nil {
+			log.Printf("Dropping malformed event %s: %v", bus.ID, err)
+			return nil, errNotForwarded
+		}
+		orderID, name = refund.OrderID, eventRefund
+		if !refund.OccurredAt.IsZero() {
+			occurredAt = refund.OccurredAt
+		}
+	default:
+		log.Printf("Ignoring event %s with detail type %q", bus.ID, bus.DetailType)
+		return nil, errNotForwarded
+	}
+	if bus.ID == "" || orderID == "" {
+		log.Printf("Dropping event %s without an order", bus.ID)
+		return nil, errNotForwarded
+	}
+
+	order, err := dynamo.Get[orderMetadata](ctx, checkouts, dynamo.StringKey("id", orderID))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		log.Printf("Not forwarding %s of order %s: no checkout records it", name, orderID)
+		return nil, errNotForwarded
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkout %s: %w", orderID, err)
+	}
+	if order.Status != checkoutCompleted {
+		log.Printf("Not forwarding %s of order %s: its checkout is %s", name, orderID, order.Status)
+		return nil, errNotForwarded
+	}
+	if order.GAClientID == "" {
+		log.Printf("Not forwarding %s of order %s: its checkout has no GA client", name, orderID)
+		emf.Count("EventsUnstitched", 1)
+		return nil, errNotForwarded
+	}
+
+	return &pendingEvent{
+		MessageID: record.MessageId,
+		EventID:   bus.ID,
+		OrderID:   orderID,
+		ClientID:  order.GAClientID,
+		UserID:    order.UserID,
+		Event:     measurementEvent(name, order, occurredAt),
+	}, nil
+}
+
+// claim records p as forwarded, reporting false if it already was.
+func claim(ctx context.Context, forwarded *dynamo.Table, p *pendingEvent) (bool, error) {
+	err := forwarded.Put(ctx, forwardedEvent{
+		EventID:   p.EventID,
+		OrderID:   p.OrderID,
+		Name:      p.Event.Name,
+		ExpiresAt: clk.Now().Add(forwardedTTL).Unix(),
+	}, dynamo.IfNotExists("event_id"))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func loadGA4Config(ctx context.Context, cfg aws.Config) (*GA4Config, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var ga GA4Config
+	if err := json.Unmarshal([]byte(*result.SecretString), &ga); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+	if ga.MeasurementID == "" || ga.APISecret == "" {
+		return nil, errors.New("secret needs measurement_id and api_secret")
+	}
+	return &ga, nil
+}
+
+func parseIntEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"pkg/retry"
+)
+
+// Measurement Protocol endpoints. The validation endpoint takes the same
+// requests and answers with what GA4 would reject instead of recording
+// them.
+const (
+	collectPath  = "/mp/collect"
+	validatePath = "/debug/mp/collect"
+
+	// maxEventsPerRequest is the Measurement Protocol's limit; every
+	// event in a request belongs to its one client.
+	maxEventsPerRequest = 25
+	// engagementTimeMsec marks a stitched event as session activity, which
+	// GA4 needs before the session shows in its reports.
+	engagementTimeMsec = 1
+)
+
+var (
+	measurementEndpoint = getEnv("GA4_ENDPOINT", "https://www.google-analytics.com")
+	measurementClient   = &http.Client{Timeout: 10 * time.Second}
+
+	// measurementRetry retries rate limiting, server errors and timeouts;
+	// GA4 answers anything else it accepts, even an event it drops, with a
+	// success.
+	measurementRetry = retry.Policy{
+		MaxAttempts: parseIntEnv("GA4_RETRY_MAX_ATTEMPTS", 4),
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Jitter:      1,
+		Retryable:   measurementRetryable,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			log.Printf("Measurement Protocol attempt %d failed, retrying in %s: %v", attempt, delay, err)
+			emf.Count("RequestRetries", 1)
+		},
+	}
+)
+
+// pendingEvent is a GA4 event waiting to be sent, with the queue message
+// it came from.
+type pendingEvent struct {
+	MessageID string
+	EventID   string
+	OrderID   string
+	ClientID  string
+	UserID    string
+	Event     mpEvent
+}
+
+// mpRequest is a Measurement Protocol request body.
+type mpRequest struct {
+	ClientID string    `json:"client_id"`
+	UserID   string    `json:"user_id,omitempty"`
+	Events   []mpEvent `json:"events"`
+}
+
+type mpEvent struct {
+	Name            string                 `json:"name"`
+	TimestampMicros int64                  `json:"timestamp_micros,omitempty"`
+	Params          map[string]interface{} `json:"params"`
+}
+
+type mpItem struct {
+	ItemID   string  `json:"item_id"`
+	ItemName string  `json:"item_name,omitempty"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+}
+
+// validationResponse is what the validation endpoint answers.
+type validationResponse struct {
+	ValidationMessages []struct {
+		FieldPath      string `json:"fieldPath"`
+		Description    string `json:"description"`
+		ValidationCode string `json:"validationCode"`
+	} `json:"validationMessages"`
+}
+
+// measurementEvent is the GA4 purchase or refund of order. A refund
+// carries no items, which GA4 takes as the whole order refunded.
+func measurementEvent(name string, order orderMetadata, occurredAt time.Time) mpEvent {
+	params := map[string]interface{}{
+		"transaction_id": order.ID,
+		"currency":       order.Currency,
+		"value":          order.Total,
+	}
+	if order.GASessionID != "" {
+		params["session_id"] = order.GASessionID
+		params["engagement_time_msec"] = engagementTimeMsec
+	}
+	if name == eventPurchase {
+		items := make([]mpItem, 0, len(order.Items))
+		for _, item := range order.Items {
+			items = append(items, mpItem{
+				ItemID:   item.SKU,
+				ItemName: item.Name,
+				Price:    item.UnitPrice,
+				Quantity: item.Quantity,
+			})
+		}
+		params["items"] = items
+		if order.CouponCode != "" {
+			params["coupon"] = order.CouponCode
+		}
+	}
+
+	event := mpEvent{Name: name, Params: params}
+	if age := clk.Now().Sub(occurredAt); !occurredAt.IsZero() && age < maxEventAge {
+		event.TimestampMicros = occurredAt.UnixMicro()
+	}
+	return event
+}
+
+// forward sends the events, batched per client, and returns how many were
+// sent and the ones that could not be. In debug validation mode nothing is
+// recorded: each batch is validated and what GA4 reports is logged.
+func forward(ctx context.Context, ga GA4Config, pending []*pendingEvent) (int, []*pendingEvent) {
+	var sent int
+	var failed []*pendingEvent
+	for _, batch := range batches(pending) {
+		err := sendBatch(ctx, ga, batch)
+		if err != nil {
+			log.Printf("Failed to send %d GA4 events for client %s: %v", len(batch), batch[0].ClientID, err)
+			failed = append(failed, batch...)
+			continue
+		}
+		sent += len(batch)
+	}
+	return sent, failed
+}
+
+// batches groups pending events by client and user, at most
+// maxEventsPerRequest to a batch, in the order they arrived.
+func batches(pending []*pendingEvent) [][]*pendingEvent {
+	type client struct{ clientID, userID string }
+	var order []client
+	byClient := make(map[client][]*pendingEvent)
+	for _, p := range pending {
+		c := client{p.ClientID, p.UserID}
+		if _, ok := byClient[c]; !ok {
+			order = append(order, c)
+		}
+		byClient[c] = append(byClient[c], p)
+	}
+
+	var out [][]*pendingEvent
+	for _, c := range order {
+		events := byClient[c]
+		for len(events) > maxEventsPerRequest {
+			out = append(out, events[:maxEventsPerRequest])
+			events = events[maxEventsPerRequest:]
+		}
+		out = append(out, events)
+	}
+	return out
+}
+
+func sendBatch(ctx context.Context, ga GA4Config, batch []*pendingEvent) error {
+	req := mpRequest{ClientID: batch[0].ClientID, UserID: batch[0].UserID}
+	for _, p := range batch {
+		req.Events = append(req.Events, p.Event)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	path := collectPath
+	if debugValidation {
+		path = validatePath
+	}
+	target := measurementEndpoint + path + "?" + url.Values{
+		"measurement_id": {ga.MeasurementID},
+		"api_secret":     {ga.APISecret},
+	}.Encode()
+
+	var respBody []byte
+	_, err = retry.Do(ctx, measurementRetry, func(ctx context.Context) error {
+		respBody, err = post(ctx, target, body)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if debugValidation {
+		logValidation(batch, respBody)
+	}
+	return nil
+}
+
+// statusError is a Measurement Protocol response other than a success.
+type statusError struct{ status int }
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Measurement Protocol returned %d", e.status)
+}
+
+func post(ctx context.Context, target string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, retry.Permanent(fmt.Errorf("failed to build request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := measurementClient.Do(req)
+	if err != nil {
+		// The URL carries the API secret; keep it out of the logs.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &statusError{resp.StatusCode}
+	}
+	return respBody, nil
+}
+
+// measurementRetryable reports whether a failed request is worth another
+// attempt.
+func measurementRetryable(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.status == http.StatusTooManyRequests || status.status >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// logValidation logs what the validation endpoint found wrong with batch.
+// Invalid events are not failed: sending them again would not fix them.
+func logValidation(batch []*pendingEvent, body []byte) {
+	var result validationResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		log.Printf("Failed to decode validation response: %v", err)
+		return
+	}
+	emf.Count("ValidationMessages", len(result.ValidationMessages))
+	if len(result.ValidationMessages) == 0 {
+		log.Printf("GA4 validated %d events for client %s", len(batch), batch[0].ClientID)
+		return
+	}
+	for _, m := range result.ValidationMessages {
+		log.Printf("GA4 validation of %d events for client %s: %s at %s: %s",
+			len(batch), batch[0].ClientID, m.ValidationCode, m.FieldPath, m.Description)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
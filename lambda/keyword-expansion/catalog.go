@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"pkg/dynamo"
+)
+
+// productsTable is product-service's catalogue. When unset, suggestions are
+// made without it, all as phrase match.
+var productsTable = os.Getenv("PRODUCTS_TABLE_NAME")
+
+// stopWords carry no product meaning, so they are ignored when a search
+// term is matched against the catalogue.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "for": true, "of": true,
+	"with": true, "in": true, "on": true, "to": true, "by": true, "my": true,
+	"buy": true, "cheap": true, "best": true, "online": true, "sale": true,
+	"shop": true, "store": true, "near": true, "me": true,
+}
+
+// catalogProduct is the part of a product-service record the matching
+// uses.
+type catalogProduct struct {
+	ID       string `dynamodbav:"id"`
+	Name     string `dynamodbav:"name"`
+	Category string `dynamodbav:"category"`
+	Brand    string `dynamodbav:"brand"`
+}
+
+// Catalog indexes product name, brand and category words for matching
+// search terms.
+type Catalog struct {
+	products []catalogProduct
+	// names maps a word of a product's name or brand to the products
+	// using it, categories a category word to the first category seen
+	// with it, and brands holds every brand word.
+	names      map[string][]int
+	categories map[string]string
+	brands     map[string]bool
+}
+
+// CatalogMatch is the catalogue entry a search term refers to: a product
+// when it names one, otherwise only a category.
+type CatalogMatch struct {
+	ProductID   string
+	ProductName string
+	Category    string
+}
+
+// loadCatalog reads the whole catalogue. It returns nil without a
+// PRODUCTS_TABLE_NAME.
+func loadCatalog(ctx context.Context, svc *dynamodb.Client) (*Catalog, error) {
+	if productsTable == "" {
+		return nil, nil
+	}
+	catalog := &Catalog{
+		names:      make(map[string][]int),
+		categories: make(map[string]string),
+		brands:     make(map[string]bool),
+	}
+	err := dynamo.ScanEach(ctx, dynamo.NewTable(svc, productsTable), dynamo.Scan{
+		Projection: "id, #name, category, brand",
+		Names:      map[string]string{"#name": "name"},
+	}, func(page []catalogProduct) error {
+		for _, p := range page {
+			catalog.add(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan the product catalogue: %w", err)
+	}
+	return catalog, nil
+}
+
+func (c *Catalog) add(p catalogProduct) {
+	i := len(c.products)
+	c.products = append(c.products, p)
+	seen := make(map[string]bool)
+	for _, w := range append(words(p.Name), words(p.Brand)...) {
+		if !seen[w] {
+			seen[w] = true
+			c.names[w] = append(c.names[w], i)
+		}
+	}
+	for _, w := range words(p.Category) {
+		if _, ok := c.categories[w]; !ok {
+			c.categories[w] = p.Category
+		}
+	}
+	for _, w := range words(p.Brand) {
+		c.brands[w] = true
+	}
+}
+
+// Match finds what a search term refers to. A term names a product when
+// all its words are in the product's name, brand or category and one of
+// them is a name word that is neither; among several, the product with the
+// fewest name words beyond the term is taken. Otherwise a term refers to a
+// category when it has a category word and every other word is a category
+// or brand word known to the catalogue; the category is the first one seen
+// with that word. Anything else is not matched.
+func (c *Catalog) Match(term string) (CatalogMatch, bool) {
+	terms := words(term)
+	if len(terms) == 0 {
+		return CatalogMatch{}, false
+	}
+
+	best, bestExtra := -1, 0
+	for _, w := range terms {
+		for _, i := range c.names[w] {
+			p := c.products[i]
+			if !names(terms, p) {
+				continue
+			}
+			extra := len(words(p.Name)) - len(terms)
+			if best < 0 || extra < bestExtra {
+				best, bestExtra = i, extra
+			}
+		}
+	}
+	if best >= 0 {
+		p := c.products[best]
+		return CatalogMatch{ProductID: p.ID, ProductName: p.Name, Category: p.Category}, true
+	}
+
+	var category string
+	for _, w := range terms {
+		if name, ok := c.categories[w]; ok {
+			if category == "" {
+				category = name
+			}
+			continue
+		}
+		if !c.brands[w] {
+			return CatalogMatch{}, false
+		}
+	}
+	if category == "" {
+		return CatalogMatch{}, false
+	}
+	return CatalogMatch{Category: category}, true
+}
+
+// names reports whether terms name p: every word is one of p's name,
+// brand or category words, and one is only a name word.
+func names(terms []string, p catalogProduct) bool {
+	name := make(map[string]bool)
+	for _, w := range words(p.Name) {
+		name[w] = true
+	}
+	other := make(map[string]bool)
+	for _, w := range words(p.Brand + " " + p.Category) {
+		other[w] = true
+	}
+	var distinctive bool
+	for _, w := range terms {
+		switch {
+		case other[w]:
+		case name[w]:
+			distinctive = true
+		default:
+			return false
+		}
+	}
+	return distinctive
+}
+
+// words lower-cases s and splits it into letter and digit runs, dropping
+// stop words and a plural "s" so "running shoes" matches "Running Shoe".
+func words(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		if stopWords[f] {
+			continue
+		}
+		if len(f) > 3 && strings.HasSuffix(f, "s") && !strings.HasSuffix(f, "ss") {
+			f = strings.TrimSuffix(f, "s")
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"google.golang.org/api/googleads"
+)
+
+// createKeywords adds the suggestions as paused keywords at their starting
+// bids in a single partial-failure mutate, so nothing serves until someone
+// reviews and enables them. Each suggestion records whether its keyword
+// was created.
+func createKeywords(ctx context.Context, client *googleads.Service, customerID string, suggestions []Suggestion) (created int, err error) {
+	if len(suggestions) == 0 {
+		return 0, nil
+	}
+	ops := make([]*googleads.AdGroupCriterionOperation, 0, len(suggestions))
+	for _, s := range suggestions {
+		ops = append(ops, &googleads.AdGroupCriterionOperation{
+			Create: &googleads.AdGroupCriterion{
+				AdGroup:      fmt.Sprintf("customers/%s/adGroups/%s", customerID, s.AdGroupID),
+				Status:       "PAUSED",
+				Keyword:      &googleads.Keyword{Text: s.KeywordText, MatchType: googleads.Enum(s.MatchType)},
+				CpcBidMicros: s.RecommendedBid.AmountMicros,
+			},
+		})
+	}
+
+	resp, err := client.MutateAdGroupCriteria(ctx, &googleads.MutateAdGroupCriteriaRequest{
+		CustomerId:     customerID,
+		Operations:     ops,
+		PartialFailure: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create keywords: %w", err)
+	}
+
+	failures := make(map[int]*googleads.PartialFailureDetail)
+	if resp.PartialFailureError != nil {
+		for _, detail := range resp.PartialFailureError.Details {
+			failures[detail.Index] = detail
+		}
+	}
+
+	for i := range suggestions {
+		if detail, ok := failures[i]; ok {
+			suggestions[i].CreateError = detail.ErrorCode + ": " + detail.Message
+			log.Printf("Customer %s: failed to create keyword %q: %s", customerID, suggestions[i].KeywordText, suggestions[i].CreateError)
+			continue
+		}
+		suggestions[i].Created = true
+		if i < len(resp.Results) && resp.Results[i] != nil {
+			// customers/{customer_id}/adGroupCriteria/{ad_group_id}~{criterion_id}
+			name := resp.Results[i].ResourceName
+			if j := strings.LastIndex(name, "~"); j >= 0 {
+				suggestions[i].KeywordID = name[j+1:]
+			}
+		}
+		created++
+	}
+	log.Printf("Customer %s: created %d of %d suggested keywords, paused", customerID, created, len(suggestions))
+	return created, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/money"
+)
+
+// Suggestion types, in the bid report's optimization_type.
+const (
+	ActionAddExact  = "ADD_KEYWORD_EXACT"
+	ActionAddPhrase = "ADD_KEYWORD_PHRASE"
+)
+
+// Match types of the created keywords.
+const (
+	matchExact  = "EXACT"
+	matchPhrase = "PHRASE"
+)
+
+var (
+	// A search term is suggested once it converted at least
+	// minConversions times over the last 30 days.
+	minConversions = int64(getIntEnv("MIN_CONVERSIONS", 2))
+	// targetROAS caps the suggested starting bid at the cost per click
+	// that would still return it; zero leaves bids at the term's
+	// average CPC.
+	targetROAS = parseFloatEnv("TARGET_ROAS", 0)
+	// maxTermWords skips long-tail terms, which rarely recur exactly.
+	maxTermWords = getIntEnv("MAX_TERM_WORDS", 6)
+)
+
+// searchTermQuery reads the converting search terms of enabled search
+// campaigns that no keyword of their ad group targets yet.
+var searchTermQuery = gaql.Select(
+	"customer.currency_code",
+	"search_term_view.search_term",
+	"campaign.id",
+	"campaign.name",
+	"ad_group.id",
+	"ad_group.name",
+	"metrics.clicks",
+	"metrics.impressions",
+	"metrics.cost_micros",
+	"metrics.conversions",
+	"metrics.conversions_value",
+).From("search_term_view").
+	Where("search_term_view.status", gaql.Equals, "NONE").
+	Where("campaign.advertising_channel_type", gaql.Equals, "SEARCH").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	Where("metrics.conversions", gaql.GreaterThan, 0).
+	During(gaql.Last30Days).
+	MustBuild()
+
+// keywordQuery reads the account's keywords, so terms another ad group
+// already targets are not suggested again.
+var keywordQuery = gaql.Select(
+	"ad_group_criterion.keyword.text",
+).From("keyword_view").
+	Where("ad_group_criterion.status", gaql.NotEquals, "REMOVED").
+	Where("ad_group_criterion.negative", gaql.Equals, false).
+	MustBuild()
+
+// termPerformance sums a search term's rows within one ad group.
+type termPerformance struct {
+	term             string
+	campaignID       string
+	campaignName     string
+	adGroupID        string
+	adGroupName      string
+	clicks           int64
+	impressions      int64
+	costMicros       int64
+	conversions      int64
+	conversionsValue float64
+}
+
+// Suggestion mirrors notify.BidRecommendation, with the search term in
+// keyword_text and the starting bid in recommended_bid, plus the match
+// type, the catalogue entry it refers to and, when keywords are created,
+// the paused keyword.
+type Suggestion struct {
+	CustomerID       string      `json:"customer_id"`
+	CampaignID       string      `json:"campaign_id"`
+	CampaignName     string      `json:"campaign_name"`
+	AdGroupID        string      `json:"ad_group_id"`
+	AdGroupName      string      `json:"ad_group_name"`
+	KeywordID        string      `json:"keyword_id"`
+	KeywordText      string      `json:"keyword_text"`
+	CurrentBid       money.Money `json:"current_bid"`
+	RecommendedBid   money.Money `json:"recommended_bid"`
+	OptimizationType string      `json:"optimization_type"`
+	Reason           string      `json:"reason"`
+	ExpectedImpact   string      `json:"expected_impact"`
+
+	MatchType       string      `json:"match_type"`
+	Clicks          int64       `json:"clicks"`
+	Conversions     int64       `json:"conversions"`
+	Cost            money.Money `json:"cost"`
+	ConversionValue float64     `json:"conversion_value,omitempty"`
+	ProductID       string      `json:"product_id,omitempty"`
+	ProductName     string      `json:"product_name,omitempty"`
+	Category        string      `json:"category,omitempty"`
+	Created         bool        `json:"created,omitempty"`
+	CreateError     string      `json:"create_error,omitempty"`
+}
+
+// suggestKeywords mines the account's converting search terms for new
+// keywords, most conversions first. Each term is suggested once, in the ad
+// group where it converted most. Without a catalogue every term is a
+// phrase keyword; with one, terms naming a product become exact keywords,
+// terms for a category phrase keywords, and the rest are left out as the
+// shop has nothing to sell for them.
+func suggestKeywords(ctx context.Context, client *googleads.Service, customerID string, catalog *Catalog) ([]Suggestion, error) {
+	existing, err := accountKeywords(ctx, client, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := searchAll(ctx, client, customerID, searchTermQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search search terms: %w", err)
+	}
+	var currency string
+	byAdGroup := make(map[string]*termPerformance)
+	for _, row := range rows {
+		if currency == "" && row.Customer != nil {
+			currency = row.Customer.CurrencyCode
+		}
+		term := normalizeTerm(row.SearchTermView.SearchTerm)
+		if term == "" || existing[term] || len(strings.Fields(term)) > maxTermWords {
+			continue
+		}
+		adGroupID := strconv.FormatInt(row.AdGroup.Id, 10)
+		key := adGroupID + "|" + term
+		t, ok := byAdGroup[key]
+		if !ok {
+			t = &termPerformance{
+				term:         term,
+				campaignID:   strconv.FormatInt(row.Campaign.Id, 10),
+				campaignName: row.Campaign.Name,
+				adGroupID:    adGroupID,
+				adGroupName:  row.AdGroup.Name,
+			}
+			byAdGroup[key] = t
+		}
+		t.clicks += row.Metrics.Clicks
+		t.impressions += row.Metrics.Impressions
+		t.costMicros += row.Metrics.CostMicros
+		t.conversions += row.Metrics.Conversions
+		t.conversionsValue += row.Metrics.ConversionsValue
+	}
+
+	best := make(map[string]*termPerformance)
+	for _, t := range byAdGroup {
+		if b, ok := best[t.term]; !ok || t.conversions > b.conversions ||
+			(t.conversions == b.conversions && t.adGroupID < b.adGroupID) {
+			best[t.term] = t
+		}
+	}
+
+	var suggestions []Suggestion
+	for _, t := range best {
+		if t.conversions < minConversions || t.clicks == 0 {
+			continue
+		}
+		s, ok := suggest(customerID, currency, *t, catalog)
+		if ok {
+			suggestions = append(suggestions, s)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Conversions != suggestions[j].Conversions {
+			return suggestions[i].Conversions > suggestions[j].Conversions
+		}
+		return suggestions[i].KeywordText < suggestions[j].KeywordText
+	})
+	return suggestions, nil
+}
+
+// suggest turns a converting term into a keyword suggestion. The starting
+// bid is the term's average CPC, lowered to the CPC at which its
+// conversion value per click still returns TARGET_ROAS.
+func suggest(customerID, currency string, t termPerformance, catalog *Catalog) (Suggestion, bool) {
+	s := Suggestion{
+		CustomerID:      customerID,
+		CampaignID:      t.campaignID,
+		CampaignName:    t.campaignName,
+		AdGroupID:       t.adGroupID,
+		AdGroupName:     t.adGroupName,
+		KeywordText:     t.term,
+		CurrentBid:      money.Money{Currency: currency},
+		Clicks:          t.clicks,
+		Conversions:     t.conversions,
+		Cost:            money.FromMicros(t.costMicros, currency),
+		ConversionValue: t.conversionsValue,
+	}
+
+	s.MatchType, s.OptimizationType = matchPhrase, ActionAddPhrase
+	var refers string
+	if catalog != nil {
+		match, ok := catalog.Match(t.term)
+		if !ok {
+			return Suggestion{}, false
+		}
+		s.ProductID, s.ProductName, s.Category = match.ProductID, match.ProductName, match.Category
+		if match.ProductID != "" {
+			s.MatchType, s.OptimizationType = matchExact, ActionAddExact
+			refers = fmt.Sprintf("; names product %s (%s)", match.ProductName, match.ProductID)
+		} else {
+			refers = fmt.Sprintf("; matches category %s", match.Category)
+		}
+	}
+
+	cpc := s.Cost.Div(float64(t.clicks))
+	bid := cpc
+	capped := false
+	if targetROAS > 0 && t.conversionsValue > 0 {
+		if limit := money.FromUnits(t.conversionsValue/float64(t.clicks)/targetROAS, currency); limit.AmountMicros < bid.AmountMicros {
+			bid, capped = limit, true
+		}
+	}
+	// Bids are set in whole cents.
+	bid = money.FromUnits(math.Max(math.Floor(bid.Units()*100)/100, 0.01), currency)
+	s.RecommendedBid = bid
+
+	s.Reason = fmt.Sprintf("Search term converted %d times from %d clicks over the last 30 days but no keyword targets it%s",
+		t.conversions, t.clicks, refers)
+	s.ExpectedImpact = fmt.Sprintf("Add as %s match at %s (average CPC %s)", strings.ToLower(s.MatchType), bid, cpc)
+	if capped {
+		s.ExpectedImpact += fmt.Sprintf(", capped to return %.1fx ROAS", targetROAS)
+	}
+	return s, true
+}
+
+// accountKeywords returns the normalized text of the account's keywords.
+func accountKeywords(ctx context.Context, client *googleads.Service, customerID string) (map[string]bool, error) {
+	rows, err := searchAll(ctx, client, customerID, keywordQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search keywords: %w", err)
+	}
+	keywords := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if row.AdGroupCriterion != nil && row.AdGroupCriterion.Keyword != nil {
+			keywords[normalizeTerm(row.AdGroupCriterion.Keyword.Text)] = true
+		}
+	}
+	return keywords, nil
+}
+
+// searchAll reads every page of query.
+func searchAll(ctx context.Context, client *googleads.Service, customerID, query string) ([]*googleads.GoogleAdsRow, error) {
+	var rows []*googleads.GoogleAdsRow
+	var pageToken string
+	for {
+		resp, err := client.Search(ctx, &googleads.SearchGoogleAdsRequest{
+			CustomerId: customerID,
+			Query:      query,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, resp.Results...)
+		if resp.NextPageToken == "" {
+			return rows, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// normalizeTerm lower-cases and collapses whitespace so search terms and
+// keyword texts compare equal.
+func normalizeTerm(q string) string {
+	return strings.Join(strings.Fields(strings.ToLower(q)), " ")
+}
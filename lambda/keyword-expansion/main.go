@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	"pkg/envelope"
+	"pkg/notify"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+var (
+	secretName  = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	snsTopicARN = os.Getenv("SNS_TOPIC_ARN")
+	environment = os.Getenv("ENVIRONMENT")
+
+	// createPaused adds the suggestions as paused keywords in accounts
+	// with the optimizer enabled; otherwise they are only reported.
+	createPaused = os.Getenv("CREATE_PAUSED_KEYWORDS") == "true"
+	// maxSuggestions bounds the suggestions per account and run, keeping
+	// the most converting terms.
+	maxSuggestions = getIntEnv("MAX_SUGGESTIONS_PER_ACCOUNT", 50)
+
+	clk = clock.FromEnv()
+)
+
+func main() {
+	lambda.Start(HandleKeywordExpansion)
+}
+
+// HandleKeywordExpansion runs weekly: for every active account it mines
+// the converting search terms no keyword targets, checks them against the
+// product catalogue and suggests new exact or phrase keywords with
+// starting bids, optionally creating them paused.
+func HandleKeywordExpansion(ctx context.Context, event interface{}) error {
+	log.Printf("Starting keyword expansion for environment: %s", environment)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := googleads.NewService(ctx,
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	db := dynamodb.NewFromConfig(cfg)
+	accounts, err := loadAccounts(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+	catalog, err := loadCatalog(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to load product catalogue: %w", err)
+	}
+	if catalog == nil {
+		log.Println("PRODUCTS_TABLE_NAME is not set, suggesting every converting term as phrase match")
+	}
+
+	var suggestions []Suggestion
+	var failed, created int
+	for _, account := range accounts {
+		found, err := suggestKeywords(ctx, client, account.CustomerID, catalog)
+		if err != nil {
+			log.Printf("Failed to mine search terms for account %s: %v", account.CustomerID, err)
+			failed++
+			continue
+		}
+		if len(found) > maxSuggestions {
+			found = found[:maxSuggestions]
+		}
+		if createPaused && account.OptimizerEnabled {
+			n, err := createKeywords(ctx, client, account.CustomerID, found)
+			if err != nil {
+				log.Printf("Failed to create keywords for account %s: %v", account.CustomerID, err)
+			}
+			created += n
+		}
+		suggestions = append(suggestions, found...)
+	}
+	if failed > 0 && failed == len(accounts) {
+		return fmt.Errorf("failed to mine search terms for all %d accounts", failed)
+	}
+
+	if len(suggestions) > 0 {
+		if err := publishSuggestions(ctx, sns.NewFromConfig(cfg), suggestions, created); err != nil {
+			return fmt.Errorf("failed to publish suggestions: %w", err)
+		}
+	}
+
+	log.Printf("Keyword expansion completed for %d accounts, %d suggestions, %d keywords created", len(accounts)-failed, len(suggestions), created)
+	return nil
+}
+
+// publishSuggestions sends the suggestions as a bid report, so they reach
+// the same channels as the optimizer's recommendations.
+func publishSuggestions(ctx context.Context, client *sns.Client, suggestions []Suggestion, created int) error {
+	report := map[string]interface{}{
+		"timestamp":             clk.Now(),
+		"environment":           environment,
+		"total_recommendations": len(suggestions),
+		"keywords_created":      created,
+		"recommendations":       suggestions,
+	}
+	message, err := envelope.New("keyword-expansion", nil, "", clk).Seal(ctx, envelope.Meta{
+		Type:          notify.KindBidReport,
+		SchemaVersion: notify.BidReportSchemaVersion,
+	}, report)
+	if err != nil {
+		return fmt.Errorf("failed to seal report: %w", err)
+	}
+
+	_, err = client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(snsTopicARN),
+		Message:  aws.String(message),
+		Subject:  aws.String(fmt.Sprintf("Google Ads Keyword Expansion - %d Suggestions", len(suggestions))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to SNS: %w", err)
+	}
+
+	log.Printf("Sent %d keyword suggestions", len(suggestions))
+	return nil
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+// Utility functions
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/googleads"
+)
+
+const (
+	AlertTypeBrokenLandingPage           = "BROKEN_LANDING_PAGE"
+	AlertTypeSlowLandingPage             = "SLOW_LANDING_PAGE"
+	AlertTypeMobileUnfriendlyLandingPage = "MOBILE_UNFRIENDLY_LANDING_PAGE"
+)
+
+// LandingPageAlert is a problem with one final URL, raised once per
+// campaign sending clicks to it. It is published as a campaign alert;
+// see notify.CampaignAlert.
+type LandingPageAlert struct {
+	CustomerID   string `json:"customer_id"`
+	CampaignID   string `json:"campaign_id"`
+	CampaignName string `json:"campaign_name"`
+	Status       string `json:"status"`
+	AlertType    string `json:"alert_type"`
+	Message      string `json:"message"`
+
+	// Set when a single ad or keyword of the campaign uses the URL.
+	AdGroupID   string `json:"ad_group_id,omitempty"`
+	AdGroupName string `json:"ad_group_name,omitempty"`
+	AdID        string `json:"ad_id,omitempty"`
+	KeywordID   string `json:"keyword_id,omitempty"`
+	KeywordText string `json:"keyword_text,omitempty"`
+	MatchType   string `json:"match_type,omitempty"`
+
+	LandingPageURL         string   `json:"landing_page_url"`
+	HTTPStatus             int      `json:"http_status,omitempty"`
+	RedirectChain          []string `json:"redirect_chain,omitempty"`
+	ResponseTimeMs         int64    `json:"response_time_ms,omitempty"`
+	CheckError             string   `json:"check_error,omitempty"`
+	MobilePerformanceScore float64  `json:"mobile_performance_score,omitempty"`
+	MobileIssues           []string `json:"mobile_issues,omitempty"`
+	AffectedAds            int      `json:"affected_ads,omitempty"`
+	AffectedKeywords       int      `json:"affected_keywords,omitempty"`
+	PausedAds              int      `json:"paused_ads,omitempty"`
+}
+
+// accountResult summarises the check of one account.
+type accountResult struct {
+	Destinations int
+	Broken       int
+	Paused       int
+	Alerts       []LandingPageAlert
+}
+
+// checkAccount checks the final URLs of an account's active ads and
+// keywords and raises alerts for those that are broken, slow or not
+// mobile-friendly. With pauseBrokenAds, ads pointing at pages that are
+// gone are paused in accounts with the optimizer enabled.
+func checkAccount(ctx context.Context, client *googleads.Service, c *checker, account checkedAccount) (*accountResult, error) {
+	destinations, err := loadDestinations(ctx, client, account.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, len(destinations))
+	for i, d := range destinations {
+		urls[i] = d.URL
+	}
+	checks := c.checkAll(ctx, urls)
+	if lighthouseEnabled {
+		// Destinations come most referenced first, so the Lighthouse
+		// budget goes to the pages most clicks land on.
+		ordered := make([]*pageCheck, len(destinations))
+		for i, d := range destinations {
+			ordered[i] = checks[d.URL]
+		}
+		c.checkMobileAll(ctx, ordered)
+	}
+
+	result := &accountResult{Destinations: len(destinations)}
+	paused := make(map[string]bool)
+	if pauseBrokenAds && account.OptimizerEnabled {
+		var dead []adRef
+		for _, d := range destinations {
+			if checks[d.URL].dead() {
+				for _, use := range d.Campaigns {
+					dead = append(dead, use.Ads...)
+				}
+			}
+		}
+		paused, err = pauseAds(ctx, client, account.CustomerID, dead)
+		if err != nil {
+			return nil, err
+		}
+		result.Paused = len(paused)
+	}
+
+	for _, d := range destinations {
+		check := checks[d.URL]
+		if check.broken() {
+			result.Broken++
+		}
+		for _, use := range d.Campaigns {
+			result.Alerts = append(result.Alerts, pageAlerts(account.CustomerID, check, use, paused)...)
+		}
+	}
+	return result, nil
+}
+
+// pageAlerts returns the alerts one campaign gets for a checked page. A
+// broken page only raises BROKEN_LANDING_PAGE, as its speed and layout do
+// not matter until it loads.
+func pageAlerts(customerID string, check *pageCheck, use *campaignUse, paused map[string]bool) []LandingPageAlert {
+	newAlert := func(alertType, message string) LandingPageAlert {
+		alert := LandingPageAlert{
+			CustomerID:       customerID,
+			CampaignID:       use.CampaignID,
+			CampaignName:     use.CampaignName,
+			Status:           "ENABLED",
+			AlertType:        alertType,
+			Message:          message,
+			LandingPageURL:   check.URL,
+			HTTPStatus:       check.StatusCode,
+			RedirectChain:    check.RedirectChain,
+			ResponseTimeMs:   check.Latency.Milliseconds(),
+			CheckError:       check.Error,
+			AffectedAds:      len(use.Ads),
+			AffectedKeywords: len(use.Keywords),
+		}
+		switch {
+		case len(use.Ads) == 1 && len(use.Keywords) == 0:
+			ad := use.Ads[0]
+			alert.AdGroupID, alert.AdGroupName, alert.AdID = ad.AdGroupID, ad.AdGroupName, ad.AdID
+		case len(use.Ads) == 0 && len(use.Keywords) == 1:
+			k := use.Keywords[0]
+			alert.AdGroupID, alert.AdGroupName = k.AdGroupID, k.AdGroupName
+			alert.KeywordID, alert.KeywordText, alert.MatchType = k.KeywordID, k.Text, k.MatchType
+		}
+		if check.Mobile != nil && check.Mobile.PerformanceScore >= 0 {
+			alert.MobilePerformanceScore = check.Mobile.PerformanceScore
+			alert.MobileIssues = check.Mobile.Issues
+		}
+		return alert
+	}
+
+	target := usageSummary(use)
+	if check.broken() {
+		reason := check.Error
+		if reason == "" {
+			reason = fmt.Sprintf("HTTP %d", check.StatusCode)
+		}
+		alert := newAlert(AlertTypeBrokenLandingPage,
+			fmt.Sprintf("Landing page %s of %s is broken: %s", check.URL, target, reason))
+		for _, ad := range use.Ads {
+			if paused[ad.AdID] {
+				alert.PausedAds++
+			}
+		}
+		if alert.PausedAds > 0 {
+			alert.Message += fmt.Sprintf("; %d ads pointing at it were paused", alert.PausedAds)
+		}
+		return []LandingPageAlert{alert}
+	}
+
+	var alerts []LandingPageAlert
+	var slow []string
+	if check.Latency > slowPageThreshold {
+		slow = append(slow, fmt.Sprintf("took %.1fs to respond", check.Latency.Seconds()))
+	}
+	if len(check.RedirectChain) > maxRedirectHops {
+		slow = append(slow, fmt.Sprintf("redirects %d times", len(check.RedirectChain)))
+	}
+	if check.Mobile != nil && check.Mobile.PerformanceScore >= 0 && check.Mobile.PerformanceScore < minMobilePerformance {
+		slow = append(slow, fmt.Sprintf("scores %.0f for mobile performance", check.Mobile.PerformanceScore*100))
+	}
+	if len(slow) > 0 {
+		alerts = append(alerts, newAlert(AlertTypeSlowLandingPage,
+			fmt.Sprintf("Landing page %s of %s is slow: it %s", check.URL, target, strings.Join(slow, ", "))))
+	}
+	if check.Mobile != nil && len(check.Mobile.Issues) > 0 {
+		alerts = append(alerts, newAlert(AlertTypeMobileUnfriendlyLandingPage,
+			fmt.Sprintf("Landing page %s of %s is not mobile-friendly: %s", check.URL, target, strings.Join(check.Mobile.Issues, "; "))))
+	}
+	return alerts
+}
+
+// usageSummary names what in the campaign points at a page, for messages.
+func usageSummary(use *campaignUse) string {
+	var parts []string
+	if n := len(use.Ads); n == 1 {
+		parts = append(parts, "1 ad")
+	} else if n > 1 {
+		parts = append(parts, fmt.Sprintf("%d ads", n))
+	}
+	if n := len(use.Keywords); n == 1 {
+		parts = append(parts, "1 keyword")
+	} else if n > 1 {
+		parts = append(parts, fmt.Sprintf("%d keywords", n))
+	}
+	return fmt.Sprintf("%s in campaign '%s'", strings.Join(parts, " and "), use.CampaignName)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// userAgent identifies the checker in the site's access logs. It claims a
+// mobile browser, as most ad clicks come from phones and some sites
+// redirect those elsewhere.
+const userAgent = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Mobile Safari/537.36 landing-page-checker"
+
+// maxBodyBytes bounds how much of a page is downloaded; only the status
+// and timing matter.
+const maxBodyBytes = 1 << 20
+
+// pageCheck is the outcome of requesting one final URL.
+type pageCheck struct {
+	URL           string
+	StatusCode    int
+	RedirectChain []string
+	Latency       time.Duration
+	Error         string
+	Mobile        *mobileResult
+}
+
+// broken reports whether the page did not load: the request failed or the
+// last response was an error.
+func (c *pageCheck) broken() bool {
+	return c.Error != "" || c.StatusCode >= 400
+}
+
+// dead reports whether the page is gone rather than failing for a while:
+// ads pointing at it can only waste clicks.
+func (c *pageCheck) dead() bool {
+	return c.StatusCode == http.StatusNotFound || c.StatusCode == http.StatusGone
+}
+
+// checker requests landing pages, following redirects by hand so every hop
+// is recorded. Results are cached for the invocation, as accounts often
+// share destinations.
+type checker struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*pageCheck
+
+	// mobileChecks counts the Lighthouse runs made so far.
+	mobileChecks int
+}
+
+func newChecker() *checker {
+	return &checker{
+		client: &http.Client{
+			Timeout: checkTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cache: make(map[string]*pageCheck),
+	}
+}
+
+// checkAll checks the URLs not checked yet, checkConcurrency at a time,
+// and returns the results of all of them.
+func (c *checker) checkAll(ctx context.Context, urls []string) map[string]*pageCheck {
+	sem := make(chan struct{}, checkConcurrency)
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		c.mu.Lock()
+		_, done := c.cache[u]
+		if !done {
+			// Reserve the entry so a URL listed twice is requested once.
+			c.cache[u] = nil
+		}
+		c.mu.Unlock()
+		if done {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(u string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result := c.check(ctx, u)
+			c.mu.Lock()
+			c.cache[u] = result
+			c.mu.Unlock()
+		}(u)
+	}
+	wg.Wait()
+
+	results := make(map[string]*pageCheck, len(urls))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, u := range urls {
+		results[u] = c.cache[u]
+	}
+	return results
+}
+
+// check requests a URL and follows up to maxRedirects redirects. Latency
+// covers the whole chain up to the last response's headers.
+func (c *checker) check(ctx context.Context, rawURL string) *pageCheck {
+	result := &pageCheck{URL: rawURL}
+	current, err := url.Parse(rawURL)
+	if err != nil || (current.Scheme != "http" && current.Scheme != "https") || current.Host == "" {
+		result.Error = "invalid URL"
+		return result
+	}
+
+	start := time.Now()
+	seen := map[string]bool{current.String(): true}
+	for hop := 0; ; hop++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, current.String(), nil)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		req.Header.Set("User-Agent", userAgent)
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			result.Latency = time.Since(start)
+			result.Error = fmt.Sprintf("request failed: %v", err)
+			return result
+		}
+		result.StatusCode = resp.StatusCode
+		result.Latency = time.Since(start)
+		location := resp.Header.Get("Location")
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodyBytes))
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+			return result
+		}
+		next, err := current.Parse(location)
+		if err != nil {
+			result.Error = fmt.Sprintf("invalid redirect to %q", location)
+			return result
+		}
+		result.RedirectChain = append(result.RedirectChain, next.String())
+		if seen[next.String()] {
+			result.Error = "redirect loop"
+			return result
+		}
+		if hop+1 > maxRedirects {
+			result.Error = fmt.Sprintf("more than %d redirects", maxRedirects)
+			return result
+		}
+		seen[next.String()] = true
+		current = next
+	}
+}
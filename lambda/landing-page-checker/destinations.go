@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+)
+
+// Final URLs of the ads that can serve.
+var activeAdsQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"ad_group.id",
+	"ad_group.name",
+	"ad_group_ad.ad.id",
+	"ad_group_ad.ad.final_urls",
+).From("ad_group_ad").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	Where("ad_group_ad.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// Final URLs of enabled keywords. Only keywords overriding their ads'
+// final URLs have any.
+var activeKeywordsQuery = gaql.Select(
+	"campaign.id",
+	"campaign.name",
+	"ad_group.id",
+	"ad_group.name",
+	"ad_group_criterion.criterion_id",
+	"ad_group_criterion.keyword.text",
+	"ad_group_criterion.keyword.match_type",
+	"ad_group_criterion.final_urls",
+).From("ad_group_criterion").
+	Where("ad_group_criterion.type", gaql.Equals, "KEYWORD").
+	Where("ad_group_criterion.negative", gaql.Equals, false).
+	Where("ad_group_criterion.status", gaql.Equals, "ENABLED").
+	Where("ad_group.status", gaql.Equals, "ENABLED").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	MustBuild()
+
+// destination is one final URL and the campaigns sending clicks to it.
+type destination struct {
+	URL       string
+	Campaigns []*campaignUse
+}
+
+// campaignUse is the ads and keywords of one campaign pointing at a URL.
+type campaignUse struct {
+	CampaignID   string
+	CampaignName string
+	Ads          []adRef
+	Keywords     []keywordRef
+}
+
+type adRef struct {
+	AdGroupID   string
+	AdGroupName string
+	AdID        string
+}
+
+type keywordRef struct {
+	AdGroupID   string
+	AdGroupName string
+	KeywordID   string
+	Text        string
+	MatchType   string
+}
+
+// references returns how many ads and keywords point at the destination.
+func (d *destination) references() int {
+	var n int
+	for _, c := range d.Campaigns {
+		n += len(c.Ads) + len(c.Keywords)
+	}
+	return n
+}
+
+// loadDestinations collects the final URLs of an account's active ads and
+// keywords, most referenced first.
+func loadDestinations(ctx context.Context, client *googleads.Service, customerID string) ([]*destination, error) {
+	byURL := make(map[string]*destination)
+	use := func(rawURL string, campaign *googleads.Campaign) *campaignUse {
+		u := strings.TrimSpace(rawURL)
+		d, ok := byURL[u]
+		if !ok {
+			d = &destination{URL: u}
+			byURL[u] = d
+		}
+		id := fmt.Sprintf("%d", campaign.Id)
+		for _, c := range d.Campaigns {
+			if c.CampaignID == id {
+				return c
+			}
+		}
+		c := &campaignUse{CampaignID: id, CampaignName: campaign.Name}
+		d.Campaigns = append(d.Campaigns, c)
+		return c
+	}
+
+	rows, err := searchAll(ctx, client, customerID, activeAdsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search ads: %w", err)
+	}
+	for _, row := range rows {
+		for _, finalURL := range row.AdGroupAd.Ad.FinalUrls {
+			c := use(finalURL, row.Campaign)
+			c.Ads = append(c.Ads, adRef{
+				AdGroupID:   fmt.Sprintf("%d", row.AdGroup.Id),
+				AdGroupName: row.AdGroup.Name,
+				AdID:        fmt.Sprintf("%d", row.AdGroupAd.Ad.Id),
+			})
+		}
+	}
+
+	rows, err = searchAll(ctx, client, customerID, activeKeywordsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search keywords: %w", err)
+	}
+	for _, row := range rows {
+		criterion := row.AdGroupCriterion
+		for _, finalURL := range criterion.FinalUrls {
+			c := use(finalURL, row.Campaign)
+			k := keywordRef{
+				AdGroupID:   fmt.Sprintf("%d", row.AdGroup.Id),
+				AdGroupName: row.AdGroup.Name,
+				KeywordID:   fmt.Sprintf("%d", criterion.CriterionId),
+			}
+			if criterion.Keyword != nil {
+				k.Text = criterion.Keyword.Text
+				k.MatchType = criterion.Keyword.MatchType.String()
+			}
+			c.Keywords = append(c.Keywords, k)
+		}
+	}
+
+	destinations := make([]*destination, 0, len(byURL))
+	for _, d := range byURL {
+		if d.URL != "" {
+			destinations = append(destinations, d)
+		}
+	}
+	sort.Slice(destinations, func(i, j int) bool {
+		if ri, rj := destinations[i].references(), destinations[j].references(); ri != rj {
+			return ri > rj
+		}
+		return destinations[i].URL < destinations[j].URL
+	})
+	return destinations, nil
+}
+
+// searchAll pages through a query, retrying transient failures.
+func searchAll(ctx context.Context, client *googleads.Service, customerID, query string) ([]*googleads.GoogleAdsRow, error) {
+	var rows []*googleads.GoogleAdsRow
+	pageToken := ""
+	for {
+		resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+			CustomerId: customerID,
+			Query:      query,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, resp.Results...)
+		if resp.NextPageToken == "" {
+			return rows, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	"pkg/envelope"
+	gads "pkg/googleads"
+	_ "pkg/localdev"
+	"pkg/notify"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+var (
+	secretName  = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	snsTopicARN = os.Getenv("SNS_TOPIC_ARN")
+	environment = os.Getenv("ENVIRONMENT")
+
+	// pauseBrokenAds pauses ads whose final URL returns 404 or 410 in
+	// accounts with the optimizer enabled; otherwise they are only
+	// alerted on.
+	pauseBrokenAds = os.Getenv("PAUSE_BROKEN_ADS") == "true"
+	// maxPausedAds is the most ads paused per account and run; see
+	// pauseAds.
+	maxPausedAds = parseIntEnv("MAX_PAUSED_ADS_PER_ACCOUNT", 50)
+
+	checkTimeout     = time.Duration(parseIntEnv("CHECK_TIMEOUT_SECONDS", 10)) * time.Second
+	checkConcurrency = parseIntEnv("CHECK_CONCURRENCY", 8)
+	maxRedirects     = parseIntEnv("MAX_REDIRECTS", 10)
+
+	// A page that loaded is slow when its redirect chain and first
+	// response take longer than slowPageThreshold, when it redirects
+	// more than maxRedirectHops times or when Lighthouse scores its
+	// mobile performance below minMobilePerformance.
+	slowPageThreshold    = time.Duration(parseIntEnv("SLOW_LANDING_PAGE_MS", 3000)) * time.Millisecond
+	maxRedirectHops      = parseIntEnv("MAX_REDIRECT_HOPS", 2)
+	minMobilePerformance = parseFloatEnv("MIN_MOBILE_PERFORMANCE_SCORE", 0.5)
+
+	// lighthouseEnabled runs the PageSpeed Insights mobile audit on up to
+	// maxMobileChecks pages per run.
+	lighthouseEnabled = os.Getenv("LIGHTHOUSE_ENABLED") == "true"
+	maxMobileChecks   = parseIntEnv("MAX_LIGHTHOUSE_CHECKS", 25)
+
+	clk = clock.FromEnv()
+
+	// emf collects the invocation's metrics for CloudWatch.
+	emf = gads.Metrics("landing-page-checker", environment, clk)
+
+	// adsCalls makes the Google Ads calls, retrying those that fail with
+	// quota or server errors; see retry.GoogleAdsFromEnv for the overrides.
+	adsCalls = gads.New(emf, nil)
+)
+
+func main() {
+	lambda.Start(HandleLandingPageCheck)
+}
+
+// HandleLandingPageCheck runs daily: it requests every final URL of the
+// active ads and keywords of each active account and alerts on the pages
+// that are broken, slow or not mobile-friendly, pausing the ads that point
+// at dead pages when PAUSE_BROKEN_ADS is set.
+func HandleLandingPageCheck(ctx context.Context, event interface{}) error {
+	defer flushMetrics()
+	log.Printf("Starting landing page check for environment: %s (pause %t, lighthouse %t)", environment, pauseBrokenAds, lighthouseEnabled)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := createGoogleAdsClient(adsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	accounts, err := loadAccounts(ctx, dynamodb.NewFromConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+
+	c := newChecker()
+	var alerts []LandingPageAlert
+	var failed, checked, broken, paused int
+	for _, account := range accounts {
+		result, err := checkAccount(ctx, client, c, account)
+		if err != nil {
+			log.Printf("Failed to check landing pages for customer %s: %v", account.CustomerID, err)
+			failed++
+			continue
+		}
+		log.Printf("Customer %s: %d landing pages checked, %d broken, %d ads paused, %d alerts",
+			account.CustomerID, result.Destinations, result.Broken, result.Paused, len(result.Alerts))
+		checked += result.Destinations
+		broken += result.Broken
+		paused += result.Paused
+		alerts = append(alerts, result.Alerts...)
+	}
+	emf.Count("AccountsFailed", failed)
+	emf.Count("LandingPagesChecked", checked)
+	emf.Count("LandingPagesBroken", broken)
+	emf.Count("AdsPaused", paused)
+	emf.Count("AlertsGenerated", len(alerts))
+	if failed > 0 && failed == len(accounts) {
+		return fmt.Errorf("failed to check landing pages for all %d accounts", failed)
+	}
+
+	if len(alerts) > 0 {
+		if err := sendAlerts(ctx, sns.NewFromConfig(cfg), alerts); err != nil {
+			return fmt.Errorf("failed to send alerts: %w", err)
+		}
+	}
+
+	log.Printf("Landing page check completed: %d pages checked, %d broken, %d ads paused, %d alerts", checked, broken, paused, len(alerts))
+	return nil
+}
+
+// sendAlerts publishes each alert as a campaign alert, so they reach the
+// same channels and routes as campaign-monitor's.
+func sendAlerts(ctx context.Context, svc *sns.Client, alerts []LandingPageAlert) error {
+	codec := envelope.New("landing-page-checker", nil, "", clk)
+	var sent int
+	for _, alert := range alerts {
+		message, err := codec.Seal(ctx, envelope.Meta{
+			Type:          notify.KindCampaignAlert,
+			SchemaVersion: notify.CampaignAlertSchemaVersion,
+			Tenant:        alert.CustomerID,
+		}, alert)
+		if err != nil {
+			return fmt.Errorf("failed to seal alert: %w", err)
+		}
+
+		_, err = svc.Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(snsTopicARN),
+			Message:  aws.String(message),
+			Subject:  aws.String(fmt.Sprintf("Google Ads Alert: %s - %s", alert.AlertType, alert.CampaignName)),
+		})
+		if err != nil {
+			log.Printf("Failed to publish alert: %v", err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("Sent %d of %d landing page alerts", sent, len(alerts))
+	return nil
+}
+
+// search runs a Google Ads query through adsCalls.
+func search(ctx context.Context, client *googleads.Service, req *googleads.SearchGoogleAdsRequest) (*googleads.SearchGoogleAdsResponse, error) {
+	return gads.Search(ctx, adsCalls, func(ctx context.Context) (*googleads.SearchGoogleAdsResponse, error) {
+		return client.Search(ctx, req)
+	}, func(resp *googleads.SearchGoogleAdsResponse) int { return len(resp.Results) })
+}
+
+func flushMetrics() {
+	if err := emf.Flush(); err != nil {
+		log.Printf("Failed to flush metrics: %v", err)
+	}
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	opts := []option.ClientOption{
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	}
+	// GOOGLE_ADS_ENDPOINT points the client at a stand-in API such as the
+	// mock server run by cmd/e2e.
+	if endpoint := os.Getenv("GOOGLE_ADS_ENDPOINT"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+
+	srv, err := googleads.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func parseIntEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
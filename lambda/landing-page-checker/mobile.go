@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// pageSpeedEndpoint runs Lighthouse against a URL on Google's side.
+const pageSpeedEndpoint = "https://www.googleapis.com/pagespeedonline/v5/runPagespeed"
+
+var pageSpeedAPIKey = os.Getenv("PAGESPEED_API_KEY")
+
+// mobileAudits are the Lighthouse audits a page must pass to count as
+// mobile-friendly. Audits missing from the report are ignored, as
+// Lighthouse versions retire some of them.
+var mobileAudits = []string{"viewport", "font-size", "tap-targets"}
+
+// mobileResult is a page's Lighthouse mobile report: its 0-1 performance
+// score and the titles of the mobile-friendliness audits it failed.
+type mobileResult struct {
+	PerformanceScore float64
+	Issues           []string
+}
+
+type lighthouseScore struct {
+	Score *float64 `json:"score"`
+	Title string   `json:"title"`
+}
+
+type pageSpeedResponse struct {
+	LighthouseResult struct {
+		Categories map[string]lighthouseScore `json:"categories"`
+		Audits     map[string]lighthouseScore `json:"audits"`
+	} `json:"lighthouseResult"`
+}
+
+// pageSpeedClient is separate from the checker's, as a Lighthouse run
+// takes far longer than a page load.
+var pageSpeedClient = &http.Client{Timeout: 90 * time.Second}
+
+// checkMobile runs a Lighthouse mobile audit of a URL through the
+// PageSpeed Insights API.
+func checkMobile(ctx context.Context, pageURL string) (*mobileResult, error) {
+	params := url.Values{}
+	params.Set("url", pageURL)
+	params.Set("strategy", "mobile")
+	params.Add("category", "performance")
+	params.Add("category", "seo")
+	if pageSpeedAPIKey != "" {
+		params.Set("key", pageSpeedAPIKey)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageSpeedEndpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pageSpeedClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call PageSpeed Insights: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("PageSpeed Insights returned %s", resp.Status)
+	}
+
+	var report pageSpeedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode PageSpeed Insights report: %w", err)
+	}
+
+	result := &mobileResult{PerformanceScore: -1}
+	if perf, ok := report.LighthouseResult.Categories["performance"]; ok && perf.Score != nil {
+		result.PerformanceScore = *perf.Score
+	}
+	for _, id := range mobileAudits {
+		audit, ok := report.LighthouseResult.Audits[id]
+		if !ok || audit.Score == nil || *audit.Score >= 1 {
+			continue
+		}
+		result.Issues = append(result.Issues, audit.Title)
+	}
+	return result, nil
+}
+
+// checkMobileAll audits the pages that loaded, in the order given, until
+// the invocation's maxMobileChecks Lighthouse runs are used up; they are
+// slow and the API is rate limited.
+func (c *checker) checkMobileAll(ctx context.Context, checks []*pageCheck) {
+	for _, check := range checks {
+		if c.mobileChecks >= maxMobileChecks {
+			return
+		}
+		if check.broken() || check.Mobile != nil {
+			continue
+		}
+		c.mobileChecks++
+		result, err := checkMobile(ctx, check.URL)
+		if err != nil {
+			log.Printf("Failed to run Lighthouse for %s: %v", check.URL, err)
+			emf.Count("LighthouseErrors", 1)
+			continue
+		}
+		check.Mobile = result
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"google.golang.org/api/googleads"
+)
+
+// pauseAds pauses ads in a single partial-failure mutate and returns the
+// IDs of those paused. Nothing is paused when there are more than
+// maxPausedAds: that many dead pages at once is more likely a site-wide
+// fault or a checker problem than ads to retire.
+func pauseAds(ctx context.Context, client *googleads.Service, customerID string, ads []adRef) (map[string]bool, error) {
+	paused := make(map[string]bool)
+	if len(ads) == 0 {
+		return paused, nil
+	}
+	if len(ads) > maxPausedAds {
+		log.Printf("Customer %s: %d ads point at dead pages, more than the %d allowed to pause; pausing none", customerID, len(ads), maxPausedAds)
+		return paused, nil
+	}
+
+	ops := make([]*googleads.AdGroupAdOperation, 0, len(ads))
+	for _, ad := range ads {
+		ops = append(ops, &googleads.AdGroupAdOperation{
+			Update: &googleads.AdGroupAd{
+				ResourceName: fmt.Sprintf("customers/%s/adGroupAds/%s~%s", customerID, ad.AdGroupID, ad.AdID),
+				Status:       "PAUSED",
+			},
+			UpdateMask: "status",
+		})
+	}
+
+	resp, err := client.MutateAdGroupAds(ctx, &googleads.MutateAdGroupAdsRequest{
+		CustomerId:     customerID,
+		Operations:     ops,
+		PartialFailure: true,
+	})
+	if err != nil {
+		return paused, fmt.Errorf("failed to pause ads: %w", err)
+	}
+
+	failures := make(map[int]*googleads.PartialFailureDetail)
+	if resp.PartialFailureError != nil {
+		for _, detail := range resp.PartialFailureError.Details {
+			failures[detail.Index] = detail
+		}
+	}
+
+	for i, ad := range ads {
+		if detail, ok := failures[i]; ok {
+			log.Printf("Customer %s: failed to pause ad %s: %s: %s", customerID, ad.AdID, detail.ErrorCode, detail.Message)
+			continue
+		}
+		paused[ad.AdID] = true
+	}
+	log.Printf("Customer %s: paused %d of %d ads pointing at dead pages", customerID, len(paused), len(ads))
+	return paused, nil
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/metrics"
+	"pkg/money"
+)
+
+// metricNamespace groups the user lifecycle metrics.
+const metricNamespace = "Ecommerce/Users"
+
+const (
+	eventSource             = "ecommerce.ltv-scorer"
+	detailTypeTierChanged   = "Customer LTV Tier Changed"
+	maxPutEventsEntries     = 10
+	checkoutCompleted       = "COMPLETED"
+	completedCheckoutsIndex = "status-saved_at-index"
+)
+
+var (
+	usersTable     = os.Getenv("USERS_TABLE_NAME")
+	checkoutsTable = os.Getenv("CHECKOUTS_TABLE_NAME")
+	eventBusName   = os.Getenv("EVENT_BUS_NAME")
+	environment    = os.Getenv("ENVIRONMENT")
+
+	// lookbackDays is how much order history scores are built from.
+	lookbackDays = getIntEnv("LTV_LOOKBACK_DAYS", 730)
+	// reannounceDays is how often a high-tier customer's tier is
+	// published again though unchanged, renewing their Customer Match
+	// membership.
+	reannounceDays = getIntEnv("LTV_REANNOUNCE_DAYS", 30)
+
+	ltvModel = model{
+		currency:      getEnv("LTV_CURRENCY", money.USD),
+		horizon:       days(getIntEnv("LTV_HORIZON_DAYS", 365)),
+		halfLife:      days(getIntEnv("LTV_RECENCY_HALF_LIFE_DAYS", 180)),
+		minTenure:     days(getIntEnv("LTV_MIN_TENURE_DAYS", 90)),
+		highShare:     getFloatEnv("HIGH_LTV_SHARE", 0.2),
+		mediumShare:   getFloatEnv("MEDIUM_LTV_SHARE", 0.3),
+		minMultiplier: getFloatEnv("LTV_MIN_VALUE_MULTIPLIER", 0.5),
+		maxMultiplier: getFloatEnv("LTV_MAX_VALUE_MULTIPLIER", 3),
+	}
+
+	clk = clock.FromEnv()
+)
+
+// scoredUser is the part of a user item the scorer needs.
+type scoredUser struct {
+	ID  string `dynamodbav:"id"`
+	LTV *Score `dynamodbav:"ltv"`
+}
+
+// completedOrder is the part of a completed checkout the scorer reads.
+type completedOrder struct {
+	UserID   string  `dynamodbav:"user_id"`
+	Currency string  `dynamodbav:"currency"`
+	Total    float64 `dynamodbav:"total"`
+	SavedAt  int64   `dynamodbav:"saved_at"`
+}
+
+// TierChanged is the "Customer LTV Tier Changed" event detail. Tier is
+// empty when a customer's orders have all left the lookback and their
+// score was removed.
+type TierChanged struct {
+	UserID       string  `json:"user_id"`
+	Tier         string  `json:"tier"`
+	PreviousTier string  `json:"previous_tier,omitempty"`
+	Value        float64 `json:"value"`
+	Currency     string  `json:"currency"`
+}
+
+func main() {
+	lambda.Start(HandleLTVScoring)
+}
+
+// HandleLTVScoring runs daily. It scores every customer with completed
+// orders in the lookback on recency, frequency and monetary value, stores
+// the scores on their user records and publishes the customers whose tier
+// changed, which audience-sync turns into high-LTV Customer Match
+// membership.
+func HandleLTVScoring(ctx context.Context, event interface{}) error {
+	log.Printf("Starting LTV scoring for environment: %s", environment)
+
+	emf := metrics.NewLogger(metricNamespace, map[string]string{
+		"Function":    "ltv-scorer",
+		"Environment": environment,
+	}, clk)
+	defer emf.Flush()
+
+	fx, err := money.StaticFromEnv()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dynamoClient := dynamodb.NewFromConfig(cfg)
+	users := dynamo.NewTable(dynamoClient, usersTable)
+	checkouts := dynamo.NewTable(dynamoClient, checkoutsTable)
+	eventBridgeClient := eventbridge.NewFromConfig(cfg)
+
+	previous, err := loadScoredUsers(ctx, users)
+	if err != nil {
+		return err
+	}
+
+	now := clk.Now()
+	histories, unconverted, err := loadHistories(ctx, checkouts, fx, now.AddDate(0, 0, -lookbackDays))
+	if err != nil {
+		return err
+	}
+	emf.Count("LTVOrdersUnconverted", unconverted)
+
+	scores := ltvModel.score(histories, now)
+	reannounceAfter := days(reannounceDays)
+	var changes []TierChanged
+	var scored, high, cleared, deleted, failed int
+	for userID, score := range scores {
+		prev, known := previous[userID]
+		if !known {
+			// Registered users only; the history of a deleted account is
+			// not scored.
+			continue
+		}
+		change := prev == nil || prev.Tier != score.Tier ||
+			score.Tier == tierHigh && now.Sub(prev.AnnouncedAt) >= reannounceAfter
+		if prev != nil {
+			score.AnnouncedAt = prev.AnnouncedAt
+		}
+		if change {
+			score.AnnouncedAt = now
+		}
+
+		err := storeScore(ctx, users, userID, score)
+		switch {
+		case err == nil:
+			scored++
+		case errors.Is(err, dynamo.ErrConditionFailed):
+			deleted++
+			continue
+		default:
+			log.Printf("Failed to store LTV of user %s: %v", userID, err)
+			failed++
+			continue
+		}
+		if score.Tier == tierHigh {
+			high++
+		}
+		if change {
+			var previousTier string
+			if prev != nil {
+				previousTier = prev.Tier
+			}
+			changes = append(changes, TierChanged{
+				UserID:       userID,
+				Tier:         score.Tier,
+				PreviousTier: previousTier,
+				Value:        score.Value,
+				Currency:     score.Currency,
+			})
+		}
+	}
+	for userID, prev := range previous {
+		if prev == nil {
+			continue
+		}
+		if _, ok := scores[userID]; ok {
+			continue
+		}
+		err := clearScore(ctx, users, userID)
+		switch {
+		case err == nil:
+			cleared++
+			changes = append(changes, TierChanged{UserID: userID, PreviousTier: prev.Tier, Currency: prev.Currency})
+		case errors.Is(err, dynamo.ErrConditionFailed):
+			deleted++
+		default:
+			log.Printf("Failed to clear LTV of user %s: %v", userID, err)
+			failed++
+		}
+	}
+
+	published := publishTierChanges(ctx, eventBridgeClient, changes, now)
+
+	emf.Count("LTVUsersScored", scored)
+	emf.Count("LTVUsersHighTier", high)
+	emf.Count("LTVScoresCleared", cleared)
+	emf.Count("LTVScoresFailed", failed)
+	emf.Count("LTVTierChangesPublished", published)
+	if failed > 0 && scored == 0 {
+		return fmt.Errorf("failed to store all %d LTV scores", failed)
+	}
+
+	log.Printf("LTV scoring completed: scored %d (%d high), cleared %d, skipped %d deleted, failed %d, published %d of %d tier changes",
+		scored, high, cleared, deleted, failed, published, len(changes))
+	return nil
+}
+
+// loadScoredUsers returns every live user's ID mapped to their current
+// score, nil for users not yet scored. Soft-deleted users are left out.
+func loadScoredUsers(ctx context.Context, users *dynamo.Table) (map[string]*Score, error) {
+	out := make(map[string]*Score)
+	err := dynamo.ScanEach(ctx, users, dynamo.Scan{
+		Filter:     "attribute_not_exists(#deleted)",
+		Projection: "id, #ltv",
+		Names:      map[string]string{"#deleted": "deleted_at", "#ltv": "ltv"},
+	}, func(page []scoredUser) error {
+		for _, user := range page {
+			out[user.ID] = user.LTV
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan users: %w", err)
+	}
+	return out, nil
+}
+
+// loadHistories totals each registered customer's orders completed since
+// since, converted to the model's currency. Orders in currencies without
+// a rate are left out and counted.
+func loadHistories(ctx context.Context, checkouts *dynamo.Table, fx money.Static, since time.Time) ([]history, int, error) {
+	byUser := make(map[string]*history)
+	var order []string
+	var unconverted int
+	err := dynamo.QueryEach(ctx, checkouts, dynamo.Query{
+		Index:        completedCheckoutsIndex,
+		KeyCondition: "#status = :status AND #saved >= :since",
+		Projection:   "#user, #currency, #total, #saved",
+		Names: map[string]string{
+			"#status":   "status",
+			"#user":     "user_id",
+			"#currency": "currency",
+			"#total":    "total",
+			"#saved":    "saved_at",
+		},
+		Values: map[string]types.AttributeValue{
+			":status": dynamo.S(checkoutCompleted),
+			":since":  dynamo.N(strconv.FormatInt(since.Unix(), 10)),
+		},
+	}, func(page []completedOrder) error {
+		for _, o := range page {
+			if o.UserID == "" {
+				// Guest checkouts have no record to score.
+				continue
+			}
+			rate, err := fx.Rate(ctx, o.Currency, ltvModel.currency)
+			if err != nil {
+				unconverted++
+				continue
+			}
+			at := time.Unix(o.SavedAt, 0).UTC()
+			h, ok := byUser[o.UserID]
+			if !ok {
+				h = &history{UserID: o.UserID, FirstOrder: at}
+				byUser[o.UserID] = h
+				order = append(order, o.UserID)
+			}
+			// Orders come oldest first.
+			h.LastOrder = at
+			h.Orders++
+			h.Revenue += o.Total * rate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query completed orders: %w", err)
+	}
+
+	out := make([]history, 0, len(order))
+	for _, userID := range order {
+		out = append(out, *byUser[userID])
+	}
+	return out, unconverted, nil
+}
+
+// storeScore replaces the user's ltv attribute. It fails with
+// dynamo.ErrConditionFailed if the user is gone or soft-deleted.
+func storeScore(ctx context.Context, users *dynamo.Table, userID string, score Score) error {
+	item, err := attributevalue.Marshal(score)
+	if err != nil {
+		return fmt.Errorf("failed to marshal LTV: %w", err)
+	}
+	return users.Update(ctx, dynamo.StringKey("id", userID), dynamo.Update{
+		Expression: "SET #ltv = :ltv",
+		Condition:  "attribute_exists(id) AND attribute_not_exists(#deleted)",
+		Names:      map[string]string{"#ltv": "ltv", "#deleted": "deleted_at"},
+		Values:     map[string]types.AttributeValue{":ltv": item},
+	}, nil)
+}
+
+// clearScore removes the ltv attribute of a user with no orders left in
+// the lookback.
+func clearScore(ctx context.Context, users *dynamo.Table, userID string) error {
+	return users.Update(ctx, dynamo.StringKey("id", userID), dynamo.Update{
+		Expression: "REMOVE #ltv",
+		Condition:  "attribute_exists(id)",
+		Names:      map[string]string{"#ltv": "ltv"},
+	}, nil)
+}
+
+// publishTierChanges sends the changes to the event bus and returns how
+// many were accepted. Failures are logged, not returned: scores are
+// already stored, so a missed change is published again only when the
+// tier next changes or, for a high-tier customer, when they are next
+// re-announced.
+func publishTierChanges(ctx context.Context, client *eventbridge.Client, changes []TierChanged, at time.Time) int {
+	var published int
+	for start := 0; start < len(changes); start += maxPutEventsEntries {
+		batch := changes[start:min(start+maxPutEventsEntries, len(changes))]
+		entries := make([]ebtypes.PutEventsRequestEntry, 0, len(batch))
+		for _, change := range batch {
+			detail, err := json.Marshal(change)
+			if err != nil {
+				log.Printf("Failed to marshal LTV tier change of user %s: %v", change.UserID, err)
+				continue
+			}
+			entries = append(entries, ebtypes.PutEventsRequestEntry{
+				EventBusName: aws.String(eventBusName),
+				Source:       aws.String(eventSource),
+				DetailType:   aws.String(detailTypeTierChanged),
+				Detail:       aws.String(string(detail)),
+				Time:         aws.Time(at),
+			})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		result, err := client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+		if err != nil {
+			log.Printf("Failed to publish %d LTV tier changes: %v", len(entries), err)
+			continue
+		}
+		published += len(entries) - int(result.FailedEntryCount)
+		if result.FailedEntryCount > 0 {
+			log.Printf("EventBridge rejected %d of %d LTV tier changes", result.FailedEntryCount, len(entries))
+		}
+	}
+	return published
+}
+
+// Utility functions
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// LTV tiers, by predicted value rank.
+const (
+	tierHigh   = "high"
+	tierMedium = "medium"
+	tierLow    = "low"
+)
+
+// history is one user's completed orders over the lookback, amounts in
+// the scoring currency.
+type history struct {
+	UserID     string
+	FirstOrder time.Time
+	LastOrder  time.Time
+	Orders     int
+	Revenue    float64
+}
+
+// Score is a user's LTV as stored on the user record under ltv. Recency,
+// Frequency and Monetary are quintile scores from 1 to 5, 5 being the
+// most recent, most frequent and biggest spending fifth of customers.
+type Score struct {
+	Recency     int     `dynamodbav:"recency"`
+	Frequency   int     `dynamodbav:"frequency"`
+	Monetary    int     `dynamodbav:"monetary"`
+	RecencyDays int     `dynamodbav:"recency_days"`
+	Orders      int     `dynamodbav:"orders"`
+	Revenue     float64 `dynamodbav:"revenue"`
+	// Value is the predicted lifetime value: revenue so far plus the
+	// expected revenue over the horizon.
+	Value    float64 `dynamodbav:"value"`
+	Currency string  `dynamodbav:"currency"`
+	Tier     string  `dynamodbav:"tier"`
+	// ValueMultiplier is Value relative to the average customer's,
+	// clamped; conversion-uploader scales conversion values by it.
+	ValueMultiplier float64   `dynamodbav:"value_multiplier"`
+	ScoredAt        time.Time `dynamodbav:"scored_at"`
+	// AnnouncedAt is when the tier was last published to the event bus.
+	AnnouncedAt time.Time `dynamodbav:"announced_at"`
+}
+
+// model holds the LTV model's parameters.
+type model struct {
+	currency string
+	// horizon is how far ahead expected revenue is counted.
+	horizon time.Duration
+	// halfLife is the recency at which a customer is taken to be as
+	// likely as not to order again.
+	halfLife time.Duration
+	// minTenure floors the time a customer's order rate is measured
+	// over, so a recent first order does not project a high rate.
+	minTenure time.Duration
+	// highShare and mediumShare are the fractions of customers, by
+	// predicted value, in the high and medium tiers.
+	highShare   float64
+	mediumShare float64
+	// minMultiplier and maxMultiplier clamp ValueMultiplier.
+	minMultiplier float64
+	maxMultiplier float64
+}
+
+// score scores every user with orders. Expected revenue is the user's
+// average order value times their order rate over the horizon, discounted
+// by the chance they are still a customer, which halves every halfLife
+// since their last order.
+func (m model) score(histories []history, now time.Time) map[string]Score {
+	if len(histories) == 0 {
+		return nil
+	}
+
+	recency := make([]float64, len(histories))
+	frequency := make([]float64, len(histories))
+	monetary := make([]float64, len(histories))
+	values := make([]float64, len(histories))
+	var total float64
+	for i, h := range histories {
+		sinceLast := now.Sub(h.LastOrder)
+		tenure := now.Sub(h.FirstOrder)
+		if tenure < m.minTenure {
+			tenure = m.minTenure
+		}
+		aov := h.Revenue / float64(h.Orders)
+		rate := float64(h.Orders) / tenure.Hours()
+		active := math.Pow(0.5, sinceLast.Hours()/m.halfLife.Hours())
+
+		// Negated so that more recent scores higher.
+		recency[i] = -sinceLast.Hours()
+		frequency[i] = float64(h.Orders)
+		monetary[i] = h.Revenue
+		values[i] = h.Revenue + aov*rate*m.horizon.Hours()*active
+		total += values[i]
+	}
+	mean := total / float64(len(histories))
+
+	rRank, fRank, mRank, vRank := ranks(recency), ranks(frequency), ranks(monetary), ranks(values)
+	scores := make(map[string]Score, len(histories))
+	for i, h := range histories {
+		multiplier := 1.0
+		if mean > 0 {
+			multiplier = math.Min(math.Max(values[i]/mean, m.minMultiplier), m.maxMultiplier)
+		}
+		scores[h.UserID] = Score{
+			Recency:         quintile(rRank(recency[i])),
+			Frequency:       quintile(fRank(frequency[i])),
+			Monetary:        quintile(mRank(monetary[i])),
+			RecencyDays:     int(now.Sub(h.LastOrder).Hours() / 24),
+			Orders:          h.Orders,
+			Revenue:         round2(h.Revenue),
+			Value:           round2(values[i]),
+			Currency:        m.currency,
+			Tier:            m.tier(vRank(values[i])),
+			ValueMultiplier: math.Round(multiplier*100) / 100,
+			ScoredAt:        now,
+		}
+	}
+	return scores
+}
+
+// tier places a customer whose value is above share of the others.
+func (m model) tier(share float64) string {
+	switch {
+	case share >= 1-m.highShare:
+		return tierHigh
+	case share >= 1-m.highShare-m.mediumShare:
+		return tierMedium
+	default:
+		return tierLow
+	}
+}
+
+// ranks returns a function giving the share, from 0 to 1, of values below
+// a value. Equal values share a rank.
+func ranks(values []float64) func(float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := float64(len(sorted))
+	return func(v float64) float64 {
+		return float64(sort.SearchFloat64s(sorted, v)) / n
+	}
+}
+
+// quintile turns a rank share into a score from 1 to 5.
+func quintile(share float64) int {
+	return min(int(share*5)+1, 5)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
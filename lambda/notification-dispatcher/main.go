@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"pkg/clock"
+	"pkg/envelope"
+	"pkg/ids"
+	"pkg/notify"
+)
+
+// bidReport is the summary document bid-optimizer publishes.
+type bidReport struct {
+	Timestamp       time.Time                  `json:"timestamp"`
+	Environment     string                     `json:"environment"`
+	Recommendations []notify.BidRecommendation `json:"recommendations"`
+	Exports         []notify.BidExport         `json:"exports"`
+}
+
+var (
+	routesParameter = os.Getenv("NOTIFY_ROUTES_PARAMETER")
+	deferredTable   = os.Getenv("DEFERRED_NOTIFICATIONS_TABLE_NAME")
+	environment     = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+)
+
+func main() {
+	lambda.Start(HandleEvent)
+}
+
+// HandleEvent receives both the SNS deliveries and the scheduled event
+// that releases deferred notifications.
+func HandleEvent(ctx context.Context, raw json.RawMessage) error {
+	var probe struct {
+		Records []json.RawMessage `json:"Records"`
+	}
+	if err := json.Unmarshal(raw, &probe); err == nil && len(probe.Records) > 0 {
+		var event events.SNSEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal SNS event: %w", err)
+		}
+		return HandleNotifications(ctx, event)
+	}
+	return HandleDeferred(ctx)
+}
+
+// newDispatcher loads the routing config and builds a dispatcher that
+// defers non-critical messages outside each channel's schedule. Routing is
+// read on every invocation so changes in SSM take effect without a
+// redeploy.
+func newDispatcher(ctx context.Context, cfg aws.Config) (*notify.Dispatcher, *notify.DeferredStore, error) {
+	routing, err := notify.LoadRoutingConfig(ctx, ssm.NewFromConfig(cfg), routesParameter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load notification routing: %w", err)
+	}
+
+	dispatcher := notify.NewDispatcher(routing, sesv2.NewFromConfig(cfg))
+	if deferredTable == "" {
+		return dispatcher, nil, nil
+	}
+	store := notify.NewDeferredStore(dynamodb.NewFromConfig(cfg), deferredTable, ids.FromEnv(clk))
+	return dispatcher.WithDeferral(store, clk), store, nil
+}
+
+// HandleNotifications is subscribed to the Google Ads SNS topic and fans
+// each published alert or report out to Slack and email.
+func HandleNotifications(ctx context.Context, event events.SNSEvent) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	dispatcher, _, err := newDispatcher(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	codec := envelope.New("notification-dispatcher", kms.NewFromConfig(cfg), "", clk)
+
+	var errs []error
+	for _, record := range event.Records {
+		msg, err := parseMessage(ctx, codec, record.SNS)
+		if errors.Is(err, envelope.ErrKeyUnavailable) {
+			errs = append(errs, fmt.Errorf("message %s: %w", record.SNS.MessageID, err))
+			continue
+		}
+		if err != nil {
+			log.Printf("Skipping unrecognised message %s: %v", record.SNS.MessageID, err)
+			continue
+		}
+
+		if err := dispatcher.Dispatch(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("message %s: %w", record.SNS.MessageID, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to dispatch notifications: %w", err)
+	}
+	return nil
+}
+
+// HandleDeferred runs on a schedule and delivers deferred notifications
+// whose channel's quiet hours have ended.
+func HandleDeferred(ctx context.Context) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	dispatcher, store, err := newDispatcher(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return nil
+	}
+
+	delivered, err := dispatcher.DeliverDue(ctx, store)
+	if delivered > 0 {
+		log.Printf("Delivered %d deferred notifications", delivered)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to deliver deferred notifications: %w", err)
+	}
+	return nil
+}
+
+// parseMessage opens an enveloped message and routes it by type. Messages
+// published before producers adopted envelopes are recognised by their
+// fields.
+func parseMessage(ctx context.Context, codec *envelope.Codec, sns events.SNSEntity) (notify.Message, error) {
+	env, err := codec.Open(ctx, sns.Message)
+	if errors.Is(err, envelope.ErrNotEnvelope) {
+		return parseLegacyMessage(sns)
+	}
+	if err != nil {
+		return notify.Message{}, err
+	}
+
+	switch env.Type {
+	case notify.KindBidReport:
+		var report bidReport
+		if err := decodeEnvelope(env, notify.BidReportSchemaVersion, &report); err != nil {
+			return notify.Message{}, err
+		}
+		return notify.Message{
+			Kind:            notify.KindBidReport,
+			Environment:     report.Environment,
+			Timestamp:       report.Timestamp,
+			Recommendations: report.Recommendations,
+			Exports:         report.Exports,
+		}, nil
+
+	case notify.KindWeeklyDigest:
+		var digest notify.WeeklyDigest
+		if err := decodeEnvelope(env, notify.WeeklyDigestSchemaVersion, &digest); err != nil {
+			return notify.Message{}, err
+		}
+		return notify.Message{
+			Kind:        notify.KindWeeklyDigest,
+			Environment: digest.Environment,
+			Timestamp:   digest.GeneratedAt,
+			Digest:      &digest,
+		}, nil
+
+	case notify.KindBudgetOrderAlert:
+		var order notify.BudgetOrderAlert
+		if err := decodeEnvelope(env, notify.BudgetOrderSchemaVersion, &order); err != nil {
+			return notify.Message{}, err
+		}
+		return notify.Message{
+			Kind:        notify.KindBudgetOrderAlert,
+			Environment: environment,
+			Timestamp:   env.PublishedAt,
+			BudgetOrder: &order,
+		}, nil
+
+	case notify.KindAlertGroup:
+		var group notify.AlertGroup
+		if err := decodeEnvelope(env, notify.AlertGroupSchemaVersion, &group); err != nil {
+			return notify.Message{}, err
+		}
+		return notify.Message{
+			Kind:        notify.KindAlertGroup,
+			Environment: environment,
+			Timestamp:   env.PublishedAt,
+			Group:       &group,
+		}, nil
+
+	case notify.KindExperimentReport:
+		var report notify.ExperimentReport
+		if err := decodeEnvelope(env, notify.ExperimentReportSchemaVersion, &report); err != nil {
+			return notify.Message{}, err
+		}
+		return notify.Message{
+			Kind:        notify.KindExperimentReport,
+			Environment: report.Environment,
+			Timestamp:   report.GeneratedAt,
+			Experiment:  &report,
+		}, nil
+
+	case notify.KindCampaignAlert:
+		var alert notify.CampaignAlert
+		if err := decodeEnvelope(env, notify.CampaignAlertSchemaVersion, &alert); err != nil {
+			return notify.Message{}, err
+		}
+		return notify.Message{
+			Kind:        notify.KindCampaignAlert,
+			Environment: environment,
+			Timestamp:   env.PublishedAt,
+			Alert:       &alert,
+		}, nil
+	}
+
+	return notify.Message{}, fmt.Errorf("no formatter for %s messages from %s", env.Type, env.Producer)
+}
+
+func decodeEnvelope(env envelope.Envelope, maxSchemaVersion int, v interface{}) error {
+	if err := env.Expect(env.Type, maxSchemaVersion); err != nil {
+		return err
+	}
+	return env.Decode(v)
+}
+
+func parseLegacyMessage(sns events.SNSEntity) (notify.Message, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(sns.Message), &probe); err != nil {
+		return notify.Message{}, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	if _, ok := probe["recommendations"]; ok {
+		var report bidReport
+		if err := json.Unmarshal([]byte(sns.Message), &report); err != nil {
+			return notify.Message{}, fmt.Errorf("failed to unmarshal bid report: %w", err)
+		}
+		return notify.Message{
+			Kind:            notify.KindBidReport,
+			Environment:     report.Environment,
+			Timestamp:       report.Timestamp,
+			Recommendations: report.Recommendations,
+			Exports:         report.Exports,
+		}, nil
+	}
+
+	if kind, ok := probe["kind"]; ok && string(kind) == `"`+notify.KindWeeklyDigest+`"` {
+		var digest notify.WeeklyDigest
+		if err := json.Unmarshal([]byte(sns.Message), &digest); err != nil {
+			return notify.Message{}, fmt.Errorf("failed to unmarshal weekly digest: %w", err)
+		}
+		return notify.Message{
+			Kind:        notify.KindWeeklyDigest,
+			Environment: digest.Environment,
+			Timestamp:   digest.GeneratedAt,
+			Digest:      &digest,
+		}, nil
+	}
+
+	if _, ok := probe["alert_type"]; ok {
+		var alert notify.CampaignAlert
+		if err := json.Unmarshal([]byte(sns.Message), &alert); err != nil {
+			return notify.Message{}, fmt.Errorf("failed to unmarshal campaign alert: %w", err)
+		}
+		return notify.Message{
+			Kind:        notify.KindCampaignAlert,
+			Environment: environment,
+			Timestamp:   sns.Timestamp,
+			Alert:       &alert,
+		}, nil
+	}
+
+	return notify.Message{}, fmt.Errorf("message is not a campaign alert, bid report or weekly digest")
+}
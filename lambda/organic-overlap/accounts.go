@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	accountsTable      = os.Getenv("ACCOUNTS_TABLE_NAME")
+	accountConfigTable = os.Getenv("ACCOUNT_CONFIG_TABLE_NAME")
+)
+
+// linkedAccount is an account with the organic_search settings the
+// ads-api stores in its account config.
+type linkedAccount struct {
+	CustomerID      string `dynamodbav:"customer_id"`
+	DescriptiveName string `dynamodbav:"descriptive_name"`
+	SiteURL         string
+	BrandTerms      []string
+}
+
+type organicSearchConfig struct {
+	OrganicSearch *struct {
+		SiteURL    string   `dynamodbav:"site_url"`
+		BrandTerms []string `dynamodbav:"brand_terms"`
+	} `dynamodbav:"organic_search"`
+}
+
+// branded reports whether query contains one of the account's brand terms.
+func (a linkedAccount) branded(query string) bool {
+	for _, term := range a.BrandTerms {
+		if strings.Contains(query, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAccounts returns the ACTIVE accounts whose settings link a Search
+// Console property; accounts without one are skipped.
+func loadAccounts(ctx context.Context, svc *dynamodb.Client) ([]linkedAccount, error) {
+	if accountsTable == "" || accountConfigTable == "" {
+		return nil, fmt.Errorf("ACCOUNTS_TABLE_NAME and ACCOUNT_CONFIG_TABLE_NAME environment variables are required")
+	}
+
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName:        aws.String(accountsTable),
+		FilterExpression: aws.String("#status = :active"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active": &types.AttributeValueMemberS{Value: "ACTIVE"},
+		},
+		ProjectionExpression: aws.String("customer_id, descriptive_name"),
+	})
+
+	var accounts []linkedAccount
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan accounts: %w", err)
+		}
+
+		var batch []linkedAccount
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal accounts: %w", err)
+		}
+		for _, account := range batch {
+			result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+				TableName: aws.String(accountConfigTable),
+				Key: map[string]types.AttributeValue{
+					"customer_id": &types.AttributeValueMemberS{Value: account.CustomerID},
+				},
+				ProjectionExpression: aws.String("organic_search"),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get settings for %s: %w", account.CustomerID, err)
+			}
+
+			var settings organicSearchConfig
+			if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal settings for %s: %w", account.CustomerID, err)
+			}
+			if settings.OrganicSearch == nil || settings.OrganicSearch.SiteURL == "" {
+				continue
+			}
+			account.SiteURL = settings.OrganicSearch.SiteURL
+			account.BrandTerms = settings.OrganicSearch.BrandTerms
+			accounts = append(accounts, account)
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].CustomerID < accounts[j].CustomerID })
+	return accounts, nil
+}
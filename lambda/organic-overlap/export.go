@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// reportOrganicOverlap is the key prefix of the exports.
+const reportOrganicOverlap = "organic_overlap"
+
+// Exporter writes one CSV per account and run.
+type Exporter struct {
+	client *s3.Client
+	bucket string
+}
+
+// WriteOverlaps writes an account's overlapping search terms to
+// organic_overlap/date=YYYY-MM-DD/<customer_id>.csv.
+func (e *Exporter) WriteOverlaps(ctx context.Context, account linkedAccount, overlaps []OverlapRow, start, end, now time.Time) error {
+	rows := [][]string{{
+		"window_start", "window_end", "customer_id", "account_name", "search_term", "branded",
+		"campaign_id", "campaign_name", "ad_group_id", "ad_group_name",
+		"paid_clicks", "paid_impressions", "paid_cost", "paid_conversions",
+		"organic_clicks", "organic_impressions", "organic_ctr", "organic_position",
+		"recapture_rate", "recommendation", "estimated_monthly_savings",
+	}}
+	for _, o := range overlaps {
+		action, savings := "", ""
+		if rec, ok := o.Recommend(lookbackDays); ok {
+			action = rec.OptimizationType
+			savings = money(rec.EstimatedMonthlySavings)
+		}
+		rows = append(rows, []string{
+			start.Format("2006-01-02"),
+			end.Format("2006-01-02"),
+			account.CustomerID,
+			account.DescriptiveName,
+			o.SearchTerm,
+			strconv.FormatBool(o.Branded),
+			o.CampaignID,
+			o.CampaignName,
+			o.AdGroupID,
+			o.AdGroupName,
+			strconv.FormatInt(o.PaidClicks, 10),
+			strconv.FormatInt(o.PaidImpressions, 10),
+			money(o.PaidCost),
+			strconv.FormatInt(o.PaidConversions, 10),
+			strconv.FormatFloat(o.OrganicClicks, 'f', 0, 64),
+			strconv.FormatFloat(o.OrganicImpressions, 'f', 0, 64),
+			strconv.FormatFloat(o.OrganicCTR, 'f', 4, 64),
+			strconv.FormatFloat(o.OrganicPosition, 'f', 1, 64),
+			strconv.FormatFloat(o.RecaptureRate(), 'f', 2, 64),
+			action,
+			savings,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to encode overlap report: %w", err)
+	}
+
+	key := fmt.Sprintf("%s/date=%s/%s.csv", reportOrganicOverlap, now.UTC().Format("2006-01-02"), account.CustomerID)
+	_, err := e.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(e.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("text/csv"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+func money(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
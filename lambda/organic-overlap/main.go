@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+	"google.golang.org/api/searchconsole"
+
+	"pkg/clock"
+	"pkg/envelope"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+// Envelope type and schema version of the published report; see
+// notify.KindBidReport. Recommendations reuse the bid report so they reach
+// the same channels as the optimizer's.
+const (
+	reportMessageType   = "bid_report"
+	reportSchemaVersion = 1
+)
+
+var (
+	secretName    = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	snsTopicARN   = os.Getenv("SNS_TOPIC_ARN")
+	reportsBucket = os.Getenv("REPORTS_BUCKET")
+	environment   = os.Getenv("ENVIRONMENT")
+
+	// Search Console data settles about three days after the fact; both
+	// sources are compared over the same lookbackDays window ending then.
+	lookbackDays = getIntEnv("LOOKBACK_DAYS", 28)
+	dataLagDays  = getIntEnv("SEARCH_CONSOLE_LAG_DAYS", 3)
+
+	clk = clock.FromEnv()
+)
+
+func main() {
+	lambda.Start(HandleOrganicOverlap)
+}
+
+// HandleOrganicOverlap runs weekly: for every account linked to a Search
+// Console property it compares paid search terms with organic rankings,
+// exports the overlap for the dashboards and recommends bid reductions or
+// negatives where paid clicks likely cannibalize free traffic.
+func HandleOrganicOverlap(ctx context.Context, event interface{}) error {
+	log.Printf("Starting organic overlap analysis for environment: %s", environment)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := googleads.NewService(ctx,
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+	// The OAuth grant in the Google Ads secret must include the Search
+	// Console read-only scope.
+	console, err := searchconsole.NewService(ctx,
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(searchconsole.WebmastersReadonlyScope),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create Search Console client: %w", err)
+	}
+
+	accounts, err := loadAccounts(ctx, dynamodb.NewFromConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+	if len(accounts) == 0 {
+		log.Println("No accounts are linked to a Search Console property")
+		return nil
+	}
+
+	now := clk.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -dataLagDays)
+	start := end.AddDate(0, 0, -(lookbackDays - 1))
+	exporter := &Exporter{client: s3.NewFromConfig(cfg), bucket: reportsBucket}
+
+	var recommendations []Recommendation
+	var failed int
+	for _, account := range accounts {
+		overlaps, err := analyzeAccount(ctx, client, console, account, start, end)
+		if err != nil {
+			log.Printf("Failed to analyze organic overlap for account %s: %v", account.CustomerID, err)
+			failed++
+			continue
+		}
+		if err := exporter.WriteOverlaps(ctx, account, overlaps, start, end, now); err != nil {
+			log.Printf("Failed to export organic overlap for account %s: %v", account.CustomerID, err)
+			failed++
+			continue
+		}
+		for _, overlap := range overlaps {
+			if rec, ok := overlap.Recommend(lookbackDays); ok {
+				recommendations = append(recommendations, rec)
+			}
+		}
+	}
+	if failed > 0 && failed == len(accounts) {
+		return fmt.Errorf("failed to analyze organic overlap for all %d accounts", failed)
+	}
+
+	if len(recommendations) > 0 {
+		if err := publishRecommendations(ctx, sns.NewFromConfig(cfg), recommendations); err != nil {
+			return fmt.Errorf("failed to publish recommendations: %w", err)
+		}
+	}
+
+	log.Printf("Organic overlap analysis completed for %d accounts, %d recommendations", len(accounts)-failed, len(recommendations))
+	return nil
+}
+
+func publishRecommendations(ctx context.Context, client *sns.Client, recommendations []Recommendation) error {
+	var savings float64
+	for _, rec := range recommendations {
+		savings += rec.EstimatedMonthlySavings
+	}
+
+	report := map[string]interface{}{
+		"timestamp":             clk.Now(),
+		"environment":           environment,
+		"total_recommendations": len(recommendations),
+		"estimated_savings":     savings,
+		"recommendations":       recommendations,
+	}
+	message, err := envelope.New("organic-overlap", nil, "", clk).Seal(ctx, envelope.Meta{
+		Type:          reportMessageType,
+		SchemaVersion: reportSchemaVersion,
+	}, report)
+	if err != nil {
+		return fmt.Errorf("failed to seal report: %w", err)
+	}
+
+	_, err = client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(snsTopicARN),
+		Message:  aws.String(message),
+		Subject:  aws.String(fmt.Sprintf("Google Ads Organic Overlap - %d Recommendations", len(recommendations))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to SNS: %w", err)
+	}
+
+	log.Printf("Sent %d organic overlap recommendations, est. $%.2f/month savings", len(recommendations), savings)
+	return nil
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+// Utility functions
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
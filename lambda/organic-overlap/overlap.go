@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/searchconsole"
+
+	"pkg/gaql"
+)
+
+// Recommendation types, in the bid report's optimization_type.
+const (
+	ActionAddNegative = "ADD_NEGATIVE_ORGANIC_OVERLAP"
+	ActionReduceBid   = "REDUCE_BID_ORGANIC_OVERLAP"
+)
+
+// searchConsoleRowLimit is the most rows Search Console returns per
+// request.
+const searchConsoleRowLimit = 25000
+
+var (
+	// A search term overlaps when the site ranks at or above this organic
+	// position for it and paid drew at least minPaidClicks in the window.
+	organicPositionThreshold = parseFloatEnv("ORGANIC_POSITION_THRESHOLD", 3.0)
+	minPaidClicks            = int64(getIntEnv("MIN_PAID_CLICKS", 10))
+)
+
+// OverlapRow is a paid search term, per ad group, the site also ranks for
+// organically.
+type OverlapRow struct {
+	CustomerID         string
+	SearchTerm         string
+	CampaignID         string
+	CampaignName       string
+	AdGroupID          string
+	AdGroupName        string
+	Branded            bool
+	PaidClicks         int64
+	PaidImpressions    int64
+	PaidCost           float64
+	PaidConversions    int64
+	OrganicClicks      float64
+	OrganicImpressions float64
+	OrganicCTR         float64
+	OrganicPosition    float64
+}
+
+// AverageCPC is the paid cost per click over the window.
+func (o OverlapRow) AverageCPC() float64 {
+	if o.PaidClicks == 0 {
+		return 0
+	}
+	return o.PaidCost / float64(o.PaidClicks)
+}
+
+// RecaptureRate estimates the share of paid clicks that would have landed
+// on the organic listing had the ad not shown. Google's incremental clicks
+// research puts it around half when the site ranks first organically, less
+// further down; navigational brand queries recapture more.
+func (o OverlapRow) RecaptureRate() float64 {
+	var rate float64
+	switch {
+	case o.OrganicPosition <= 1.5:
+		rate = 0.5
+	case o.OrganicPosition <= 3:
+		rate = 0.3
+	default:
+		rate = 0.15
+	}
+	if o.Branded {
+		rate += 0.3
+	}
+	if rate > 0.9 {
+		rate = 0.9
+	}
+	return rate
+}
+
+// Recommend turns an overlap into a negative or a bid reduction with the
+// estimated savings scaled to 30 days. A top-ranked term whose paid clicks
+// never converted is negated outright; otherwise the bid is cut in
+// proportion to the clicks organic would recapture, at most by half.
+func (o OverlapRow) Recommend(windowDays int) (Recommendation, bool) {
+	if o.PaidClicks < minPaidClicks || o.PaidCost <= 0 {
+		return Recommendation{}, false
+	}
+
+	recapture := o.RecaptureRate()
+	monthly := 30.0 / float64(windowDays)
+	rec := Recommendation{
+		CustomerID:   o.CustomerID,
+		CampaignID:   o.CampaignID,
+		CampaignName: o.CampaignName,
+		AdGroupID:    o.AdGroupID,
+		AdGroupName:  o.AdGroupName,
+		KeywordText:  o.SearchTerm,
+		CurrentBid:   o.AverageCPC(),
+	}
+
+	if o.OrganicPosition <= 1.5 && recapture >= 0.5 && o.PaidConversions == 0 {
+		rec.OptimizationType = ActionAddNegative
+		rec.RecommendedBid = 0
+		rec.EstimatedMonthlySavings = o.PaidCost * monthly
+		rec.Reason = fmt.Sprintf("Ranks #%.1f organically (%.0f organic clicks) and %d paid clicks did not convert; add as an exact-match negative",
+			o.OrganicPosition, o.OrganicClicks, o.PaidClicks)
+		rec.ExpectedImpact = fmt.Sprintf("Saves ~$%.2f/month; ~%.0f%% of the %d paid clicks expected to return organically",
+			rec.EstimatedMonthlySavings, recapture*100, o.PaidClicks)
+		return rec, true
+	}
+
+	reduction := recapture
+	if reduction > 0.5 {
+		reduction = 0.5
+	}
+	rec.OptimizationType = ActionReduceBid
+	rec.RecommendedBid = rec.CurrentBid * (1 - reduction)
+	rec.EstimatedMonthlySavings = o.PaidCost * reduction * monthly
+	rec.Reason = fmt.Sprintf("Ranks #%.1f organically with %.1f%% organic CTR; paid clicks likely cannibalize free traffic",
+		o.OrganicPosition, o.OrganicCTR*100)
+	rec.ExpectedImpact = fmt.Sprintf("Saves ~$%.2f/month by lowering the bid %.0f%%", rec.EstimatedMonthlySavings, reduction*100)
+	return rec, true
+}
+
+// Recommendation mirrors notify.BidRecommendation, with the search term in
+// keyword_text, plus the estimated savings.
+type Recommendation struct {
+	CustomerID              string  `json:"customer_id"`
+	CampaignID              string  `json:"campaign_id"`
+	CampaignName            string  `json:"campaign_name"`
+	AdGroupID               string  `json:"ad_group_id"`
+	AdGroupName             string  `json:"ad_group_name"`
+	KeywordID               string  `json:"keyword_id"`
+	KeywordText             string  `json:"keyword_text"`
+	CurrentBid              float64 `json:"current_bid"`
+	RecommendedBid          float64 `json:"recommended_bid"`
+	OptimizationType        string  `json:"optimization_type"`
+	Reason                  string  `json:"reason"`
+	ExpectedImpact          string  `json:"expected_impact"`
+	EstimatedMonthlySavings float64 `json:"estimated_monthly_savings"`
+}
+
+type organicQuery struct {
+	Clicks      float64
+	Impressions float64
+	CTR         float64
+	Position    float64
+}
+
+// analyzeAccount joins the account's paid search terms with its organic
+// queries over [start, end] and returns the overlapping terms, costliest
+// first.
+func analyzeAccount(ctx context.Context, client *googleads.Service, console *searchconsole.Service, account linkedAccount, start, end time.Time) ([]OverlapRow, error) {
+	organic, err := fetchOrganicQueries(ctx, console, account.SiteURL, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	query := gaql.Select(
+		"search_term_view.search_term",
+		"campaign.id",
+		"campaign.name",
+		"ad_group.id",
+		"ad_group.name",
+		"metrics.clicks",
+		"metrics.impressions",
+		"metrics.cost_micros",
+		"metrics.conversions",
+	).From("search_term_view").
+		Between("segments.date", start.Format("2006-01-02"), end.Format("2006-01-02")).
+		Where("metrics.clicks", gaql.GreaterThan, 0).
+		MustBuild()
+
+	var overlaps []OverlapRow
+	var pageToken string
+	for {
+		resp, err := client.Search(ctx, &googleads.SearchGoogleAdsRequest{
+			CustomerId: account.CustomerID,
+			Query:      query,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search search terms: %w", err)
+		}
+
+		for _, row := range resp.Results {
+			term := normalizeQuery(row.SearchTermView.SearchTerm)
+			match, ok := organic[term]
+			if !ok || match.Position > organicPositionThreshold {
+				continue
+			}
+			overlaps = append(overlaps, OverlapRow{
+				CustomerID:         account.CustomerID,
+				SearchTerm:         term,
+				CampaignID:         strconv.FormatInt(row.Campaign.Id, 10),
+				CampaignName:       row.Campaign.Name,
+				AdGroupID:          strconv.FormatInt(row.AdGroup.Id, 10),
+				AdGroupName:        row.AdGroup.Name,
+				Branded:            account.branded(term),
+				PaidClicks:         row.Metrics.Clicks,
+				PaidImpressions:    row.Metrics.Impressions,
+				PaidCost:           float64(row.Metrics.CostMicros) / 1000000.0,
+				PaidConversions:    row.Metrics.Conversions,
+				OrganicClicks:      match.Clicks,
+				OrganicImpressions: match.Impressions,
+				OrganicCTR:         match.CTR,
+				OrganicPosition:    match.Position,
+			})
+		}
+
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+
+	sort.Slice(overlaps, func(i, j int) bool { return overlaps[i].PaidCost > overlaps[j].PaidCost })
+	return overlaps, nil
+}
+
+// fetchOrganicQueries returns the site's web search queries over the
+// window keyed by normalized query text.
+func fetchOrganicQueries(ctx context.Context, console *searchconsole.Service, siteURL string, start, end time.Time) (map[string]organicQuery, error) {
+	queries := make(map[string]organicQuery)
+	for startRow := int64(0); ; startRow += searchConsoleRowLimit {
+		resp, err := console.Searchanalytics.Query(siteURL, &searchconsole.SearchAnalyticsQueryRequest{
+			StartDate:  start.Format("2006-01-02"),
+			EndDate:    end.Format("2006-01-02"),
+			Dimensions: []string{"query"},
+			SearchType: "web",
+			RowLimit:   searchConsoleRowLimit,
+			StartRow:   startRow,
+		}).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to query Search Console for %s: %w", siteURL, err)
+		}
+
+		for _, row := range resp.Rows {
+			if len(row.Keys) == 0 {
+				continue
+			}
+			queries[normalizeQuery(row.Keys[0])] = organicQuery{
+				Clicks:      row.Clicks,
+				Impressions: row.Impressions,
+				CTR:         row.Ctr,
+				Position:    row.Position,
+			}
+		}
+
+		if len(resp.Rows) < searchConsoleRowLimit {
+			break
+		}
+	}
+	return queries, nil
+}
+
+// normalizeQuery lower-cases and collapses whitespace so search terms and
+// Search Console queries compare equal.
+func normalizeQuery(q string) string {
+	return strings.Join(strings.Fields(strings.ToLower(q)), " ")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// globalScope is the account config item whose settings apply to every
+// account; see the ads-api settings endpoints.
+const globalScope = "global"
+
+var (
+	accountsTable      = os.Getenv("ACCOUNTS_TABLE_NAME")
+	accountConfigTable = os.Getenv("ACCOUNT_CONFIG_TABLE_NAME")
+)
+
+// reviewAccount is an account with the placement_exclusions settings the
+// ads-api stores in its account config.
+type reviewAccount struct {
+	CustomerID string `dynamodbav:"customer_id"`
+	MinCost    float64
+	Allowlist  []string
+}
+
+type placementExclusionsConfig struct {
+	PlacementExclusions *struct {
+		MinCost   float64  `dynamodbav:"min_cost"`
+		Allowlist []string `dynamodbav:"allowlist"`
+	} `dynamodbav:"placement_exclusions"`
+}
+
+// loadAccounts returns every ACTIVE account with its exclusion settings:
+// the global allowlist plus its own, and its own minimum cost or else the
+// global one or else PLACEMENT_EXCLUSION_MIN_COST.
+func loadAccounts(ctx context.Context, svc *dynamodb.Client) ([]reviewAccount, error) {
+	if accountsTable == "" {
+		customerID := os.Getenv("GOOGLE_ADS_CUSTOMER_ID")
+		if customerID == "" {
+			return nil, fmt.Errorf("neither ACCOUNTS_TABLE_NAME nor GOOGLE_ADS_CUSTOMER_ID environment variable is set")
+		}
+		return []reviewAccount{{CustomerID: customerID, MinCost: minExclusionCost}}, nil
+	}
+	if accountConfigTable == "" {
+		log.Printf("ACCOUNT_CONFIG_TABLE_NAME not set, no placements are allowlisted")
+	}
+
+	global, err := loadExclusionSettings(ctx, svc, globalScope)
+	if err != nil {
+		return nil, err
+	}
+
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName:        aws.String(accountsTable),
+		FilterExpression: aws.String("#status = :active"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active": &types.AttributeValueMemberS{Value: "ACTIVE"},
+		},
+		ProjectionExpression: aws.String("customer_id"),
+	})
+
+	var accounts []reviewAccount
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan accounts: %w", err)
+		}
+
+		var batch []reviewAccount
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal accounts: %w", err)
+		}
+		for _, account := range batch {
+			own, err := loadExclusionSettings(ctx, svc, account.CustomerID)
+			if err != nil {
+				return nil, err
+			}
+			account.MinCost = minExclusionCost
+			if global.MinCost > 0 {
+				account.MinCost = global.MinCost
+			}
+			if own.MinCost > 0 {
+				account.MinCost = own.MinCost
+			}
+			account.Allowlist = append(append([]string(nil), global.Allowlist...), own.Allowlist...)
+			accounts = append(accounts, account)
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].CustomerID < accounts[j].CustomerID })
+	return accounts, nil
+}
+
+// loadExclusionSettings reads one scope's placement_exclusions section;
+// a scope without one has no settings.
+func loadExclusionSettings(ctx context.Context, svc *dynamodb.Client, scope string) (reviewAccount, error) {
+	if accountConfigTable == "" {
+		return reviewAccount{}, nil
+	}
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(accountConfigTable),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberS{Value: scope},
+		},
+		ProjectionExpression: aws.String("placement_exclusions"),
+	})
+	if err != nil {
+		return reviewAccount{}, fmt.Errorf("failed to get settings for %s: %w", scope, err)
+	}
+
+	var settings placementExclusionsConfig
+	if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+		return reviewAccount{}, fmt.Errorf("failed to unmarshal settings for %s: %w", scope, err)
+	}
+	if settings.PlacementExclusions == nil {
+		return reviewAccount{}, nil
+	}
+	return reviewAccount{
+		MinCost:   settings.PlacementExclusions.MinCost,
+		Allowlist: settings.PlacementExclusions.Allowlist,
+	}, nil
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+)
+
+// Placement types the shared list can exclude. YouTube placements need
+// their own criteria and are left to the account's managers.
+const (
+	placementWebsite           = "WEBSITE"
+	placementMobileApplication = "MOBILE_APPLICATION"
+)
+
+// mobileAppPrefix starts the group_placement_view.placement of an app,
+// e.g. "mobileapp::2-com.example.game"; the rest is the app ID.
+const mobileAppPrefix = "mobileapp::"
+
+var (
+	// minExclusionCost is the spend over the lookback above which a
+	// placement without conversions is excluded, unless the account's
+	// settings override it.
+	minExclusionCost = parseFloatEnv("PLACEMENT_EXCLUSION_MIN_COST", 20.0)
+	// maxExclusionsPerRun caps how many placements one run adds to an
+	// account's list, most expensive first, so a tracking outage that
+	// zeroes conversions cannot exclude an account's whole reach.
+	maxExclusionsPerRun = parseIntEnv("PLACEMENT_EXCLUSION_MAX_PER_RUN", 100)
+	// exclusionListName is the shared negative placement list the lambda
+	// maintains in each account; it is created on first use.
+	exclusionListName = getEnv("PLACEMENT_EXCLUSION_LIST_NAME", "Automated placement exclusions")
+)
+
+// excludedChannels are the campaign types whose placements are reviewed
+// and to which the list is attached.
+var excludedChannels = []string{"DISPLAY", "PERFORMANCE_MAX"}
+
+// Placement spend over the last 30 days for Display and Performance Max
+// campaigns.
+var placementPerformanceQuery = gaql.Select(
+	"campaign.id",
+	"group_placement_view.placement",
+	"group_placement_view.placement_type",
+	"group_placement_view.display_name",
+	"metrics.impressions",
+	"metrics.clicks",
+	"metrics.cost_micros",
+	"metrics.conversions",
+).From("group_placement_view").
+	Where("campaign.status", gaql.NotEquals, "REMOVED").
+	Where("campaign.advertising_channel_type", gaql.In, excludedChannels).
+	Where("group_placement_view.placement_type", gaql.In, []string{placementWebsite, placementMobileApplication}).
+	Where("metrics.cost_micros", gaql.GreaterThan, 0).
+	During(gaql.Last30Days).
+	MustBuild()
+
+var exclusionListQuery = gaql.Select(
+	"shared_set.resource_name",
+	"shared_set.id",
+	"shared_set.name",
+).From("shared_set").
+	Where("shared_set.type", gaql.Equals, "NEGATIVE_PLACEMENTS").
+	Where("shared_set.status", gaql.Equals, "ENABLED").
+	Where("shared_set.name", gaql.Equals, exclusionListName).
+	MustBuild()
+
+func excludedPlacementsQuery(sharedSet string) string {
+	return gaql.Select(
+		"shared_criterion.type",
+		"shared_criterion.placement.url",
+		"shared_criterion.mobile_application.app_id",
+	).From("shared_criterion").
+		Where("shared_criterion.shared_set", gaql.Equals, sharedSet).
+		MustBuild()
+}
+
+var excludableCampaignsQuery = gaql.Select(
+	"campaign.id",
+	"campaign.advertising_channel_type",
+).From("campaign").
+	Where("campaign.status", gaql.Equals, "ENABLED").
+	Where("campaign.advertising_channel_type", gaql.In, excludedChannels).
+	MustBuild()
+
+func linkedCampaignsQuery(sharedSet string) string {
+	return gaql.Select(
+		"campaign.id",
+		"campaign_shared_set.status",
+	).From("campaign_shared_set").
+		Where("campaign_shared_set.shared_set", gaql.Equals, sharedSet).
+		Where("campaign_shared_set.status", gaql.Equals, "ENABLED").
+		MustBuild()
+}
+
+// placementSpend is one placement's performance across the account's
+// campaigns.
+type placementSpend struct {
+	Placement   string
+	Type        string
+	DisplayName string
+	Impressions int64
+	Clicks      int64
+	Cost        float64
+	Conversions int64
+}
+
+// reviewResult counts what one account's review did with the placements
+// that spent without converting.
+type reviewResult struct {
+	Reviewed        int
+	Excluded        int
+	Allowlisted     int
+	AlreadyExcluded int
+	Failed          int
+}
+
+// reviewPlacements excludes the account's placements that cost at least
+// its minimum over the lookback without a conversion, skipping allowlisted
+// ones, and makes sure the list applies to every enabled Display and
+// Performance Max campaign.
+func reviewPlacements(ctx context.Context, client *googleads.Service, account reviewAccount) (reviewResult, error) {
+	var result reviewResult
+	customerID := account.CustomerID
+
+	spend, err := loadPlacementSpend(ctx, client, customerID)
+	if err != nil {
+		return result, err
+	}
+	var wasted []placementSpend
+	for _, p := range spend {
+		if p.Conversions == 0 && p.Cost >= account.MinCost {
+			wasted = append(wasted, p)
+		}
+	}
+	result.Reviewed = len(spend)
+	if len(wasted) == 0 {
+		return result, nil
+	}
+
+	sharedSet, err := findExclusionList(ctx, client, customerID)
+	if err != nil {
+		return result, err
+	}
+	excluded := make(map[string]bool)
+	if sharedSet != "" {
+		if excluded, err = loadExcludedPlacements(ctx, client, customerID, sharedSet); err != nil {
+			return result, err
+		}
+	}
+
+	var exclude []placementSpend
+	for _, p := range wasted {
+		switch {
+		case excluded[p.Placement]:
+			result.AlreadyExcluded++
+		case allowlisted(account.Allowlist, p.Placement):
+			result.Allowlisted++
+		default:
+			exclude = append(exclude, p)
+		}
+	}
+	sort.Slice(exclude, func(i, j int) bool { return exclude[i].Cost > exclude[j].Cost })
+	if len(exclude) > maxExclusionsPerRun {
+		log.Printf("Customer %s: %d placements to exclude, excluding the %d most expensive this run",
+			customerID, len(exclude), maxExclusionsPerRun)
+		exclude = exclude[:maxExclusionsPerRun]
+	}
+
+	for _, p := range exclude {
+		log.Printf("Customer %s: excluding %s placement %s (%s): $%.2f, %d clicks, no conversions",
+			customerID, p.Type, p.Placement, p.DisplayName, p.Cost, p.Clicks)
+	}
+	if !applyExclusions || len(exclude) == 0 {
+		return result, nil
+	}
+
+	if sharedSet == "" {
+		if sharedSet, err = createExclusionList(ctx, client, customerID); err != nil {
+			return result, err
+		}
+	}
+	failed, err := addExclusions(ctx, client, customerID, sharedSet, exclude)
+	if err != nil {
+		return result, err
+	}
+	result.Failed = failed
+	result.Excluded = len(exclude) - failed
+
+	if err := linkExclusionList(ctx, client, customerID, sharedSet); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// loadPlacementSpend sums each placement's metrics across campaigns.
+func loadPlacementSpend(ctx context.Context, client *googleads.Service, customerID string) ([]placementSpend, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      placementPerformanceQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search placement performance: %w", err)
+	}
+
+	byPlacement := make(map[string]*placementSpend)
+	var placements []string
+	for _, row := range resp.Results {
+		view := row.GroupPlacementView
+		p, ok := byPlacement[view.Placement]
+		if !ok {
+			p = &placementSpend{
+				Placement:   view.Placement,
+				Type:        view.PlacementType.String(),
+				DisplayName: view.DisplayName,
+			}
+			byPlacement[view.Placement] = p
+			placements = append(placements, view.Placement)
+		}
+		p.Impressions += row.Metrics.Impressions
+		p.Clicks += row.Metrics.Clicks
+		p.Cost += float64(row.Metrics.CostMicros) / 1000000.0
+		p.Conversions += row.Metrics.Conversions
+	}
+
+	spend := make([]placementSpend, 0, len(placements))
+	for _, placement := range placements {
+		spend = append(spend, *byPlacement[placement])
+	}
+	return spend, nil
+}
+
+// findExclusionList returns the resource name of the account's list, or
+// "" when it has none yet.
+func findExclusionList(ctx context.Context, client *googleads.Service, customerID string) (string, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      exclusionListQuery,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to search shared sets: %w", err)
+	}
+	if len(resp.Results) == 0 {
+		return "", nil
+	}
+	return resp.Results[0].SharedSet.ResourceName, nil
+}
+
+func createExclusionList(ctx context.Context, client *googleads.Service, customerID string) (string, error) {
+	resp, err := client.MutateSharedSets(ctx, &googleads.MutateSharedSetsRequest{
+		CustomerId: customerID,
+		Operations: []*googleads.SharedSetOperation{{
+			Create: &googleads.SharedSet{
+				Name: exclusionListName,
+				Type: "NEGATIVE_PLACEMENTS",
+			},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create placement exclusion list: %w", err)
+	}
+	if len(resp.Results) == 0 {
+		return "", fmt.Errorf("creating placement exclusion list returned no shared set")
+	}
+	log.Printf("Customer %s: created placement exclusion list %q", customerID, exclusionListName)
+	return resp.Results[0].ResourceName, nil
+}
+
+// loadExcludedPlacements returns the placements already on the list, in
+// group_placement_view's form.
+func loadExcludedPlacements(ctx context.Context, client *googleads.Service, customerID, sharedSet string) (map[string]bool, error) {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      excludedPlacementsQuery(sharedSet),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search excluded placements: %w", err)
+	}
+	excluded := make(map[string]bool)
+	for _, row := range resp.Results {
+		criterion := row.SharedCriterion
+		switch {
+		case criterion.Placement != nil:
+			excluded[criterion.Placement.Url] = true
+		case criterion.MobileApplication != nil:
+			excluded[mobileAppPrefix+criterion.MobileApplication.AppId] = true
+		}
+	}
+	return excluded, nil
+}
+
+// addExclusions adds placements to the list with partial failure, so one
+// rejected placement does not hold back the rest, and returns how many
+// were rejected.
+func addExclusions(ctx context.Context, client *googleads.Service, customerID, sharedSet string, placements []placementSpend) (int, error) {
+	ops := make([]*googleads.SharedCriterionOperation, 0, len(placements))
+	for _, p := range placements {
+		criterion := &googleads.SharedCriterion{SharedSet: sharedSet}
+		if p.Type == placementMobileApplication {
+			criterion.MobileApplication = &googleads.MobileApplicationInfo{
+				AppId: strings.TrimPrefix(p.Placement, mobileAppPrefix),
+			}
+		} else {
+			criterion.Placement = &googleads.PlacementInfo{Url: p.Placement}
+		}
+		ops = append(ops, &googleads.SharedCriterionOperation{Create: criterion})
+	}
+
+	resp, err := client.MutateSharedCriteria(ctx, &googleads.MutateSharedCriteriaRequest{
+		CustomerId:     customerID,
+		Operations:     ops,
+		PartialFailure: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to add placement exclusions: %w", err)
+	}
+	if resp.PartialFailureError == nil {
+		return 0, nil
+	}
+	for _, detail := range resp.PartialFailureError.Details {
+		if detail.Index >= 0 && detail.Index < len(placements) {
+			log.Printf("Customer %s: failed to exclude placement %s: %s %s",
+				customerID, placements[detail.Index].Placement, detail.ErrorCode, detail.Message)
+		}
+	}
+	return len(resp.PartialFailureError.Details), nil
+}
+
+// linkExclusionList attaches the list to the enabled Display and
+// Performance Max campaigns that do not use it yet, including ones
+// created since the last run.
+func linkExclusionList(ctx context.Context, client *googleads.Service, customerID, sharedSet string) error {
+	resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      linkedCampaignsQuery(sharedSet),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to search campaigns using the exclusion list: %w", err)
+	}
+	linked := make(map[int64]bool)
+	for _, row := range resp.Results {
+		linked[row.Campaign.Id] = true
+	}
+
+	resp, err = search(ctx, client, &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      excludableCampaignsQuery,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to search campaigns: %w", err)
+	}
+	var ops []*googleads.CampaignSharedSetOperation
+	for _, row := range resp.Results {
+		if linked[row.Campaign.Id] {
+			continue
+		}
+		ops = append(ops, &googleads.CampaignSharedSetOperation{
+			Create: &googleads.CampaignSharedSet{
+				Campaign:  fmt.Sprintf("customers/%s/campaigns/%d", customerID, row.Campaign.Id),
+				SharedSet: sharedSet,
+			},
+		})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	linkResp, err := client.MutateCampaignSharedSets(ctx, &googleads.MutateCampaignSharedSetsRequest{
+		CustomerId:     customerID,
+		Operations:     ops,
+		PartialFailure: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach the exclusion list to campaigns: %w", err)
+	}
+	failed := 0
+	if linkResp.PartialFailureError != nil {
+		failed = len(linkResp.PartialFailureError.Details)
+		for _, detail := range linkResp.PartialFailureError.Details {
+			log.Printf("Customer %s: failed to attach the exclusion list: %s %s", customerID, detail.ErrorCode, detail.Message)
+		}
+	}
+	log.Printf("Customer %s: attached the exclusion list to %d campaigns", customerID, len(ops)-failed)
+	return nil
+}
+
+// allowlisted reports whether placement is on the allowlist. A website
+// entry also covers its subdomains, so "example.com" protects
+// "news.example.com".
+func allowlisted(allowlist []string, placement string) bool {
+	placement = strings.ToLower(placement)
+	for _, allowed := range allowlist {
+		if placement == allowed || strings.HasSuffix(placement, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	gads "pkg/googleads"
+	_ "pkg/localdev"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+var (
+	secretName  = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	environment = os.Getenv("ENVIRONMENT")
+
+	// applyExclusions adds the placements found to the shared list; when
+	// unset the run only logs what it would exclude.
+	applyExclusions = os.Getenv("PLACEMENT_EXCLUSION_APPLY") == "true"
+
+	clk = clock.FromEnv()
+
+	// emf collects the invocation's metrics for CloudWatch.
+	emf = gads.Metrics("placement-exclusions", environment, clk)
+
+	// adsCalls makes the Google Ads calls, retrying those that fail with
+	// quota or server errors; see retry.GoogleAdsFromEnv for the overrides.
+	adsCalls = gads.New(emf, nil)
+)
+
+func main() {
+	lambda.Start(HandlePlacementExclusions)
+}
+
+// HandlePlacementExclusions runs weekly: for every active account it adds
+// the Display and Performance Max placements that spent without converting
+// to the account's shared negative placement list.
+func HandlePlacementExclusions(ctx context.Context, event interface{}) error {
+	defer flushMetrics()
+	log.Printf("Starting placement exclusion review for environment: %s (apply %t)", environment, applyExclusions)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dynamoClient := dynamodb.NewFromConfig(cfg)
+
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := createGoogleAdsClient(adsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	accounts, err := loadAccounts(ctx, dynamoClient)
+	if err != nil {
+		return fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+
+	var failed, excluded int
+	for _, account := range accounts {
+		result, err := reviewPlacements(ctx, client, account)
+		if err != nil {
+			log.Printf("Failed to review placements for customer %s: %v", account.CustomerID, err)
+			failed++
+			continue
+		}
+		log.Printf("Customer %s: %d placements reviewed, %d excluded, %d allowlisted, %d already excluded, %d failed",
+			account.CustomerID, result.Reviewed, result.Excluded, result.Allowlisted, result.AlreadyExcluded, result.Failed)
+		excluded += result.Excluded
+	}
+	emf.Count("AccountsFailed", failed)
+	emf.Count("PlacementsExcluded", excluded)
+	if failed > 0 && failed == len(accounts) {
+		return fmt.Errorf("failed to review placements for all %d accounts", failed)
+	}
+
+	log.Printf("Placement exclusion review completed: %d placements excluded across %d accounts", excluded, len(accounts))
+	return nil
+}
+
+// search runs a Google Ads query through adsCalls.
+func search(ctx context.Context, client *googleads.Service, req *googleads.SearchGoogleAdsRequest) (*googleads.SearchGoogleAdsResponse, error) {
+	return gads.Search(ctx, adsCalls, func(ctx context.Context) (*googleads.SearchGoogleAdsResponse, error) {
+		return client.Search(ctx, req)
+	}, func(resp *googleads.SearchGoogleAdsResponse) int { return len(resp.Results) })
+}
+
+func flushMetrics() {
+	if err := emf.Flush(); err != nil {
+		log.Printf("Failed to flush metrics: %v", err)
+	}
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	opts := []option.ClientOption{
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	}
+	// GOOGLE_ADS_ENDPOINT points the client at a stand-in API such as the
+	// mock server run by cmd/e2e.
+	if endpoint := os.Getenv("GOOGLE_ADS_ENDPOINT"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+
+	srv, err := googleads.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(getEnv(key, ""), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func parseIntEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(getEnv(key, "")); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"pkg/dynamo"
+)
+
+// eraseCarts deletes the user's carts.
+func eraseCarts(ctx context.Context, task Task) (StepResult, error) {
+	carts := tableFromEnv(cartsTableEnv)
+	if carts == nil {
+		return StepResult{Step: ActionEraseCarts}, nil
+	}
+	n, err := deleteUserRecords(ctx, carts, cartsIndex, task.UserID)
+	return StepResult{Step: ActionEraseCarts, Records: map[string]int{"carts": n}}, err
+}
+
+// anonymizeOrders has order-service detach the user's orders from them:
+// user_id becomes a pseudonym unique to this erasure, so the orders still
+// group together for accounting but lead back to no one, and contact
+// details are removed.
+func anonymizeOrders(ctx context.Context, task Task) (StepResult, error) {
+	if orderServiceURL == "" {
+		return StepResult{Step: ActionAnonymizeOrders}, nil
+	}
+	n, err := anonymizeUserOrders(ctx, task.UserID, "erased-"+task.RequestID)
+	if err != nil {
+		return StepResult{}, err
+	}
+	return StepResult{Step: ActionAnonymizeOrders, Records: map[string]int{"orders": n}}, nil
+}
+
+// eraseEvents deletes the user's records in every eventTables store.
+func eraseEvents(ctx context.Context, task Task) (StepResult, error) {
+	result := StepResult{Step: ActionEraseEvents, Records: map[string]int{}}
+	for _, events := range eventTables {
+		table, err := eventTable(events.env, events.name)
+		if err != nil {
+			return StepResult{}, err
+		}
+		n, err := deleteUserRecords(ctx, table, eventsIndex, task.UserID)
+		if err != nil {
+			return StepResult{}, err
+		}
+		result.Records[events.name] = n
+	}
+	return result, nil
+}
+
+// eraseMerges deletes the records linking anonymous visitor IDs to the
+// user.
+func eraseMerges(ctx context.Context, task Task) (StepResult, error) {
+	merges := tableFromEnv(mergesTableEnv)
+	if merges == nil {
+		return StepResult{Step: ActionEraseMerges}, nil
+	}
+	ids, err := mergedAnonymousIDs(ctx, merges, task.UserID)
+	if err != nil {
+		return StepResult{}, err
+	}
+	for _, id := range ids {
+		if err := merges.Delete(ctx, dynamo.StringKey("anonymous_id", id)); err != nil {
+			return StepResult{}, fmt.Errorf("failed to delete merge of %s: %w", id, err)
+		}
+	}
+	return StepResult{Step: ActionEraseMerges, Records: map[string]int{"merges": len(ids)}}, nil
+}
+
+// eraseUser deletes the user record itself. It runs last so a failed
+// erasure leaves the user in place to retry against. The privacy request
+// keeps the user ID as the record that the erasure happened.
+func eraseUser(ctx context.Context, task Task) (StepResult, error) {
+	users := usersTable()
+	if users == nil {
+		return StepResult{}, fmt.Errorf("%s is not set", usersTableEnv)
+	}
+	if err := users.Delete(ctx, dynamo.StringKey("id", task.UserID)); err != nil {
+		return StepResult{}, fmt.Errorf("failed to delete user: %w", err)
+	}
+	return StepResult{Step: ActionEraseUser, Records: map[string]int{"users": 1}}, nil
+}
+
+// deleteUserRecords deletes every item of the user's in table, returning
+// how many there were.
+func deleteUserRecords(ctx context.Context, table *dynamo.Table, index, userID string) (int, error) {
+	ids, err := userRecordIDs(ctx, table, index, userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := table.Delete(ctx, dynamo.StringKey("id", id)); err != nil {
+			return 0, fmt.Errorf("failed to delete %s record %s: %w", table.Name, id, err)
+		}
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"pkg/dynamo"
+)
+
+// exportManifest is manifest.json, the archive's table of contents.
+type exportManifest struct {
+	RequestID   string         `json:"request_id"`
+	UserID      string         `json:"user_id"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Files       map[string]int `json:"files"`
+}
+
+// exportFile is one store's records in the archive.
+type exportFile struct {
+	store   string
+	records []record
+}
+
+// exportUserData gathers the user's records from every store into a zip
+// of one JSON file per store and uploads it to the export bucket, where
+// user-service presigns downloads of it.
+func exportUserData(ctx context.Context, task Task) (StepResult, error) {
+	files, err := collectUserData(ctx, task.UserID)
+	if err != nil {
+		return StepResult{}, err
+	}
+
+	manifest := exportManifest{
+		RequestID:   task.RequestID,
+		UserID:      task.UserID,
+		GeneratedAt: clk.Now().UTC(),
+		Files:       map[string]int{},
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		for _, r := range file.records {
+			for name := range restrictedAttributes {
+				delete(r, name)
+			}
+		}
+		if err := writeJSONFile(archive, file.store+".json", file.records); err != nil {
+			return StepResult{}, err
+		}
+		manifest.Files[file.store+".json"] = len(file.records)
+	}
+	if err := writeJSONFile(archive, "manifest.json", manifest); err != nil {
+		return StepResult{}, err
+	}
+	if err := archive.Close(); err != nil {
+		return StepResult{}, fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	key := fmt.Sprintf("exports/%s/%s.zip", task.UserID, task.RequestID)
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(exportBucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("application/zip"),
+	})
+	if err != nil {
+		return StepResult{}, fmt.Errorf("failed to upload archive: %w", err)
+	}
+
+	result := StepResult{Step: ActionExport, Records: map[string]int{}, ArchiveKey: key}
+	for _, file := range files {
+		result.Records[file.store] = len(file.records)
+	}
+	return result, nil
+}
+
+// collectUserData reads the user's records from each configured store.
+func collectUserData(ctx context.Context, userID string) ([]exportFile, error) {
+	var files []exportFile
+
+	if users := usersTable(); users != nil {
+		user, err := dynamo.Get[record](ctx, users, dynamo.StringKey("id", userID))
+		switch {
+		case err == nil:
+			files = append(files, exportFile{"user", []record{user}})
+		case errors.Is(err, dynamo.ErrNotFound):
+			files = append(files, exportFile{"user", []record{}})
+		default:
+			return nil, fmt.Errorf("failed to read user: %w", err)
+		}
+	}
+
+	if carts := tableFromEnv(cartsTableEnv); carts != nil {
+		records, err := userRecords(ctx, carts, cartsIndex, userID)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, exportFile{"carts", records})
+	}
+
+	if orderServiceURL != "" {
+		records, err := userOrders(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, exportFile{"orders", records})
+	}
+
+	for _, events := range eventTables {
+		table, err := eventTable(events.env, events.name)
+		if err != nil {
+			return nil, err
+		}
+		records, err := userRecords(ctx, table, eventsIndex, userID)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, exportFile{events.name, records})
+	}
+
+	if merges := tableFromEnv(mergesTableEnv); merges != nil {
+		ids, err := mergedAnonymousIDs(ctx, merges, userID)
+		if err != nil {
+			return nil, err
+		}
+		records := make([]record, 0, len(ids))
+		for _, id := range ids {
+			records = append(records, record{"anonymous_id": id})
+		}
+		files = append(files, exportFile{"merged-identities", records})
+	}
+	return files, nil
+}
+
+func writeJSONFile(archive *zip.Writer, name string, v interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/metrics"
+	"pkg/tenant"
+)
+
+// metricNamespace groups the user lifecycle metrics.
+const metricNamespace = "Ecommerce/Users"
+
+// Workflow actions, one per Task state of the privacy state machines.
+const (
+	ActionExport          = "export"
+	ActionEraseCarts      = "erase-carts"
+	ActionAnonymizeOrders = "anonymize-orders"
+	ActionEraseEvents     = "erase-events"
+	ActionEraseMerges     = "erase-merges"
+	ActionEraseUser       = "erase-user"
+	ActionComplete        = "complete"
+	ActionFail            = "fail"
+)
+
+// Privacy request statuses, as user-service reports them.
+const (
+	statusSucceeded = "SUCCEEDED"
+	statusFailed    = "FAILED"
+)
+
+var (
+	requestsTableName = os.Getenv("PRIVACY_REQUESTS_TABLE_NAME")
+	exportBucket      = os.Getenv("PRIVACY_EXPORT_BUCKET")
+	environment       = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+
+	// Clients outlive an invocation so warm starts skip config loading.
+	dynamoClient *dynamodb.Client
+	s3Client     *s3.Client
+)
+
+// Task is the input of every Task state: the execution's request plus the
+// results earlier states stored on it.
+type Task struct {
+	Action    string `json:"action"`
+	RequestID string `json:"request_id"`
+	UserID    string `json:"user_id"`
+	// TenantID is the tenant the user belongs to; empty for the default
+	// tenant.
+	TenantID string `json:"tenant_id,omitempty"`
+
+	// Results of the parallel erasure steps, the erasure of the user
+	// record and the export, whichever the workflow ran.
+	Results []StepResult `json:"results,omitempty"`
+	User    *StepResult  `json:"user,omitempty"`
+	Export  *StepResult  `json:"export,omitempty"`
+
+	// Error is the Catch output of the state that failed.
+	Error *TaskError `json:"error,omitempty"`
+}
+
+// TaskError is how Step Functions reports a failed state.
+type TaskError struct {
+	Error string `json:"Error"`
+	Cause string `json:"Cause"`
+}
+
+// StepResult is what one step did, as records handled per store.
+type StepResult struct {
+	Step       string         `json:"step"`
+	Records    map[string]int `json:"records,omitempty"`
+	ArchiveKey string         `json:"archive_key,omitempty"`
+}
+
+func main() {
+	lambda.Start(HandlePrivacyTask)
+}
+
+// HandlePrivacyTask runs one step of an export or erasure workflow. Every
+// step is safe to retry: exports overwrite the same archive, erasures
+// re-read what is left, and status updates are plain overwrites.
+func HandlePrivacyTask(ctx context.Context, task Task) (StepResult, error) {
+	if task.RequestID == "" || task.UserID == "" {
+		return StepResult{}, fmt.Errorf("task %q has no request or user", task.Action)
+	}
+
+	emf := metrics.NewLogger(metricNamespace, map[string]string{
+		"Function":    "privacy-worker",
+		"Environment": environment,
+	}, clk)
+	defer emf.Flush()
+
+	ctx = tenant.WithID(ctx, task.TenantID)
+	if dynamoClient == nil {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return StepResult{}, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		dynamoClient = dynamodb.NewFromConfig(cfg)
+		s3Client = s3.NewFromConfig(cfg)
+	}
+
+	var result StepResult
+	var err error
+	switch task.Action {
+	case ActionExport:
+		result, err = exportUserData(ctx, task)
+	case ActionEraseCarts:
+		result, err = eraseCarts(ctx, task)
+	case ActionAnonymizeOrders:
+		result, err = anonymizeOrders(ctx, task)
+	case ActionEraseEvents:
+		result, err = eraseEvents(ctx, task)
+	case ActionEraseMerges:
+		result, err = eraseMerges(ctx, task)
+	case ActionEraseUser:
+		result, err = eraseUser(ctx, task)
+	case ActionComplete:
+		err = completeRequest(ctx, task)
+	case ActionFail:
+		err = failRequest(ctx, task)
+	default:
+		return StepResult{}, fmt.Errorf("unknown action %q", task.Action)
+	}
+	if err != nil {
+		return StepResult{}, fmt.Errorf("%s of privacy request %s: %w", task.Action, task.RequestID, err)
+	}
+
+	for store, n := range result.Records {
+		emf.Count("PrivacyRecords", n)
+		log.Printf("Privacy request %s: %s handled %d %s records", task.RequestID, task.Action, n, store)
+	}
+	return result, nil
+}
+
+// completeRequest marks the request succeeded with the records each step
+// handled and, for an export, the archive to download.
+func completeRequest(ctx context.Context, task Task) error {
+	steps := append([]StepResult{}, task.Results...)
+	for _, step := range []*StepResult{task.User, task.Export} {
+		if step != nil {
+			steps = append(steps, *step)
+		}
+	}
+
+	records := map[string]int{}
+	var archiveKey string
+	for _, step := range steps {
+		for store, n := range step.Records {
+			records[store] += n
+		}
+		if step.ArchiveKey != "" {
+			archiveKey = step.ArchiveKey
+		}
+	}
+
+	recordsValue := &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+	for store, n := range records {
+		recordsValue.Value[store] = dynamo.N(fmt.Sprint(n))
+	}
+	values := map[string]types.AttributeValue{
+		":status":  dynamo.S(statusSucceeded),
+		":records": recordsValue,
+		":now":     dynamo.S(clk.Now().UTC().Format(time.RFC3339Nano)),
+	}
+	expression := "SET #status = :status, #records = :records, completed_at = :now"
+	if archiveKey != "" {
+		expression += ", archive_key = :archive"
+		values[":archive"] = dynamo.S(archiveKey)
+	}
+
+	log.Printf("Privacy request %s for user %s succeeded", task.RequestID, task.UserID)
+	return requestsTable().Update(ctx, dynamo.StringKey("id", task.RequestID), dynamo.Update{
+		Expression: expression,
+		Names:      map[string]string{"#status": "status", "#records": "records"},
+		Values:     values,
+	}, nil)
+}
+
+// failRequest marks the request failed with the error that stopped the
+// workflow. The cause can quote internal detail, so only the error name is
+// kept for the caller; the full cause is in the execution history.
+func failRequest(ctx context.Context, task Task) error {
+	reason := "workflow failed"
+	if task.Error != nil && task.Error.Error != "" {
+		reason = task.Error.Error
+		log.Printf("Privacy request %s for user %s failed: %s: %s", task.RequestID, task.UserID, task.Error.Error, task.Error.Cause)
+	}
+
+	return requestsTable().Update(ctx, dynamo.StringKey("id", task.RequestID), dynamo.Update{
+		Expression: "SET #status = :status, #error = :error, completed_at = :now",
+		Names:      map[string]string{"#status": "status", "#error": "error"},
+		Values: map[string]types.AttributeValue{
+			":status": dynamo.S(statusFailed),
+			":error":  dynamo.S(reason),
+			":now":    dynamo.S(clk.Now().UTC().Format(time.RFC3339Nano)),
+		},
+	}, nil)
+}
+
+// Utility functions
+
+func requestsTable() *dynamo.Table {
+	return dynamo.NewTable(dynamoClient, requestsTableName)
+}
+
+// tableFromEnv returns the table named by env, or nil when the store is not
+// deployed in this environment.
+func tableFromEnv(env string, opts ...dynamo.Option) *dynamo.Table {
+	if name := os.Getenv(env); name != "" {
+		return dynamo.NewTable(dynamoClient, name, opts...)
+	}
+	return nil
+}
+
+// usersTable is the users table, scoped to the task's tenant as in
+// user-service.
+func usersTable() *dynamo.Table {
+	return tableFromEnv(usersTableEnv, dynamo.WithTenancy("id"))
+}
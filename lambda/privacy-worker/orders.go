@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"pkg/tenant"
+)
+
+// orderServiceURL is where order-service, which keeps orders in its own
+// database, is reached; see docs/ORDER_SERVICE.md. Orders are skipped when
+// it is unset, like a store whose table is not configured.
+var orderServiceURL = strings.TrimRight(os.Getenv("ORDER_SERVICE_URL"), "/")
+
+var orderClient = &http.Client{Timeout: 10 * time.Second}
+
+// orderHistoryPageSize is the largest page order-service serves.
+const orderHistoryPageSize = 100
+
+// userOrders reads every order of the user's, paging order-service's
+// order history.
+func userOrders(ctx context.Context, userID string) ([]record, error) {
+	query := url.Values{"limit": {fmt.Sprint(orderHistoryPageSize)}}
+	orders := []record{}
+	for {
+		var page struct {
+			Orders     []record `json:"orders"`
+			NextCursor string   `json:"next_cursor"`
+		}
+		path := "/users/" + url.PathEscape(userID) + "/orders?" + query.Encode()
+		if err := callOrderService(ctx, http.MethodGet, path, nil, &page); err != nil {
+			return nil, fmt.Errorf("failed to read orders: %w", err)
+		}
+		orders = append(orders, page.Orders...)
+		if page.NextCursor == "" {
+			return orders, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+// anonymizeUserOrders has order-service detach the user's orders from
+// them under pseudonym, returning how many it changed. Replaying it with
+// the same pseudonym changes nothing.
+func anonymizeUserOrders(ctx context.Context, userID, pseudonym string) (int, error) {
+	var out struct {
+		Anonymized int `json:"anonymized"`
+	}
+	path := "/users/" + url.PathEscape(userID) + "/orders/anonymize"
+	if err := callOrderService(ctx, http.MethodPost, path, map[string]string{"pseudonym": pseudonym}, &out); err != nil {
+		return 0, fmt.Errorf("failed to anonymize orders: %w", err)
+	}
+	return out.Anonymized, nil
+}
+
+// callOrderService sends body, if any, as JSON on behalf of the task's
+// tenant and decodes a 200 response into out.
+func callOrderService(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, orderServiceURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(tenant.Header, tenant.FromContext(ctx))
+
+	resp, err := orderClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("order-service returned %d for %s %s", resp.StatusCode, method, path)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/dynamo"
+)
+
+// The stores holding a user's data, each read through its user_id index.
+// Tables are named by environment variables and skipped when unset, so
+// stores are covered as their owning services come online.
+const (
+	usersTableEnv  = "USERS_TABLE_NAME"
+	cartsTableEnv  = "CARTS_TABLE_NAME"
+	mergesTableEnv = "USER_MERGES_TABLE_NAME"
+
+	// cartsIndex is cart-service's index of carts by owner.
+	cartsIndex = "user_id-last_activity_index"
+	// eventsIndex is the index every per-user event table has.
+	eventsIndex = "user_id-timestamp-index"
+)
+
+// eventTables are the per-user event stores, keyed by id, that an erasure
+// deletes outright. Unlike the stores above they are required; list a
+// store here only once privacy.tf passes its table and grants access to it.
+var eventTables = []struct{ env, name string }{
+	{"AD_CLICKS_TABLE_NAME", "ad-clicks"},
+}
+
+// eventTable returns the table of an eventTables store, failing the step
+// when it is not configured: an export or erasure that skipped the store
+// would look complete without being so.
+func eventTable(env, name string) (*dynamo.Table, error) {
+	table := tableFromEnv(env)
+	if table == nil {
+		return nil, fmt.Errorf("%s is not set: the %s store would be left out", env, name)
+	}
+	return table, nil
+}
+
+// restrictedAttributes never leave the platform, not even in an export:
+// they are credentials, not personal data about the user.
+var restrictedAttributes = map[string]bool{
+	"card_number":    true,
+	"payment_token":  true,
+	"password_hash":  true,
+	"session_secret": true,
+}
+
+// record is an item of any store, decoded generically.
+type record = map[string]interface{}
+
+// userRecords reads every item in table whose index entry belongs to the
+// user.
+func userRecords(ctx context.Context, table *dynamo.Table, index, userID string) ([]record, error) {
+	records, err := dynamo.QueryAll[record](ctx, table, dynamo.Query{
+		Index:        index,
+		KeyCondition: "user_id = :user",
+		Values:       map[string]types.AttributeValue{":user": dynamo.S(userID)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", table.Name, err)
+	}
+	return records, nil
+}
+
+// userRecordIDs reads the ids of the user's items in table. The ids are
+// collected before anything is changed, since changing an item's user_id
+// moves it out of the index being paged.
+func userRecordIDs(ctx context.Context, table *dynamo.Table, index, userID string) ([]string, error) {
+	type ref struct {
+		ID string `dynamodbav:"id"`
+	}
+	refs, err := dynamo.QueryAll[ref](ctx, table, dynamo.Query{
+		Index:        index,
+		KeyCondition: "user_id = :user",
+		Projection:   "id",
+		Values:       map[string]types.AttributeValue{":user": dynamo.S(userID)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", table.Name, err)
+	}
+	ids := make([]string, 0, len(refs))
+	for _, r := range refs {
+		ids = append(ids, r.ID)
+	}
+	return ids, nil
+}
+
+// mergedAnonymousIDs lists the anonymous IDs merged into the user. The
+// merges table is keyed by anonymous ID with no index on the user, so it is
+// scanned; it holds one small item per merge.
+func mergedAnonymousIDs(ctx context.Context, table *dynamo.Table, userID string) ([]string, error) {
+	type merge struct {
+		AnonymousID string `dynamodbav:"anonymous_id"`
+	}
+	var ids []string
+	err := dynamo.ScanEach(ctx, table, dynamo.Scan{
+		Filter:     "user_id = :user",
+		Projection: "anonymous_id",
+		Values:     map[string]types.AttributeValue{":user": dynamo.S(userID)},
+	}, func(page []merge) error {
+		for _, m := range page {
+			ids = append(ids, m.AnonymousID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", table.Name, err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/metrics"
+	"pkg/search"
+)
+
+// metricNamespace groups the product search pipeline metrics.
+const metricNamespace = "Ecommerce/Search"
+
+var (
+	endpoint    = os.Getenv("OPENSEARCH_ENDPOINT")
+	environment = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+
+	// client and indexReady outlive an invocation so warm starts skip
+	// signing setup and the index check.
+	client     *search.Client
+	indexReady bool
+)
+
+func main() {
+	lambda.Start(HandleStream)
+}
+
+// HandleStream mirrors a batch of products table changes into the product
+// index: inserts and updates index the new image, removals delete it.
+// Failed records are reported individually, so Lambda retries from the
+// first failure instead of replaying the whole batch.
+func HandleStream(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	var response events.DynamoDBEventResponse
+
+	emf := metrics.NewLogger(metricNamespace, map[string]string{
+		"Function":    "product-indexer",
+		"Environment": environment,
+	}, clk)
+	defer emf.Flush()
+
+	if client == nil {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return response, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		client = search.New(endpoint, &cfg)
+	}
+	if !indexReady {
+		if err := client.EnsureIndex(ctx, search.ProductIndex, search.ProductMapping); err != nil {
+			return response, err
+		}
+		indexReady = true
+	}
+
+	var actions []search.BulkAction
+	var sequences []string
+	for _, record := range event.Records {
+		action, err := bulkAction(record)
+		if err != nil {
+			// A malformed image will not get better on retry; skip it
+			// rather than block the shard.
+			log.Printf("Skipping record %s: %v", record.EventID, err)
+			emf.Count("ProductsSkipped", 1)
+			continue
+		}
+		actions = append(actions, action)
+		sequences = append(sequences, record.Change.SequenceNumber)
+	}
+	if len(actions) == 0 {
+		return response, nil
+	}
+
+	results, err := client.Bulk(ctx, actions)
+	if err != nil {
+		// Nothing was applied; retry the whole batch.
+		return response, err
+	}
+	if len(results) != len(actions) {
+		return response, fmt.Errorf("bulk response has %d results for %d actions", len(results), len(actions))
+	}
+
+	var indexed, deleted, stale int
+	for i, result := range results {
+		switch {
+		case result.Conflict():
+			stale++
+		case result.OK() && actions[i].Delete:
+			deleted++
+		case result.OK():
+			indexed++
+		default:
+			log.Printf("Failed to index product %s: %d %s", result.ID, result.Status, result.Error)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{
+				ItemIdentifier: sequences[i],
+			})
+		}
+	}
+
+	emf.Count("ProductsIndexed", indexed)
+	emf.Count("ProductsDeleted", deleted)
+	emf.Count("ProductsStale", stale)
+	emf.Count("ProductsFailed", len(response.BatchItemFailures))
+	log.Printf("Indexed %d, deleted %d, skipped %d stale and failed %d products",
+		indexed, deleted, stale, len(response.BatchItemFailures))
+	return response, nil
+}
+
+// bulkAction turns a stream record into an index or delete. Updates are
+// versioned by the product's updated_at and deletes by the time of the
+// removal, so a retried older record cannot overwrite a newer one.
+func bulkAction(record events.DynamoDBEventRecord) (search.BulkAction, error) {
+	if record.EventName == string(events.DynamoDBOperationTypeRemove) {
+		id := record.Change.Keys["id"]
+		if id.DataType() != events.DataTypeString {
+			return search.BulkAction{}, fmt.Errorf("removed item has no id")
+		}
+		return search.BulkAction{
+			Delete:  true,
+			Index:   search.ProductIndex,
+			ID:      id.String(),
+			Version: record.Change.ApproximateCreationDateTime.UnixMilli(),
+		}, nil
+	}
+
+	var doc search.ProductDocument
+	if err := attributevalue.UnmarshalMap(fromStreamImage(record.Change.NewImage), &doc); err != nil {
+		return search.BulkAction{}, fmt.Errorf("failed to unmarshal product: %w", err)
+	}
+	if doc.ID == "" {
+		return search.BulkAction{}, fmt.Errorf("product has no id")
+	}
+	return search.BulkAction{
+		Index:    search.ProductIndex,
+		ID:       doc.ID,
+		Version:  doc.UpdatedAt.UnixMilli(),
+		Document: doc,
+	}, nil
+}
+
+// Utility functions
+
+// fromStreamImage converts a Lambda stream image to SDK attribute values,
+// which attributevalue can unmarshal.
+func fromStreamImage(image map[string]events.DynamoDBAttributeValue) map[string]types.AttributeValue {
+	item := make(map[string]types.AttributeValue, len(image))
+	for name, value := range image {
+		item[name] = fromStreamValue(value)
+	}
+	return item
+}
+
+func fromStreamValue(v events.DynamoDBAttributeValue) types.AttributeValue {
+	switch v.DataType() {
+	case events.DataTypeString:
+		return &types.AttributeValueMemberS{Value: v.String()}
+	case events.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: v.Number()}
+	case events.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: v.Boolean()}
+	case events.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: v.Binary()}
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: v.StringSet()}
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: v.NumberSet()}
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: v.BinarySet()}
+	case events.DataTypeList:
+		list := make([]types.AttributeValue, 0, len(v.List()))
+		for _, elem := range v.List() {
+			list = append(list, fromStreamValue(elem))
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case events.DataTypeMap:
+		return &types.AttributeValueMemberM{Value: fromStreamImage(v.Map())}
+	}
+	return &types.AttributeValueMemberNULL{Value: true}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	qstypes "github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"pkg/clock"
+	"pkg/ids"
+)
+
+// QuickSightManifest is the S3 manifest format QuickSight reads when a
+// dataset is backed by files in S3.
+type QuickSightManifest struct {
+	FileLocations        []ManifestFileLocation `json:"fileLocations"`
+	GlobalUploadSettings ManifestUploadSettings `json:"globalUploadSettings"`
+}
+
+type ManifestFileLocation struct {
+	URIPrefixes []string `json:"URIPrefixes"`
+}
+
+type ManifestUploadSettings struct {
+	Format         string `json:"format"`
+	Delimiter      string `json:"delimiter,omitempty"`
+	ContainsHeader string `json:"containsHeader,omitempty"`
+}
+
+type RefreshResult struct {
+	ReportType  string `json:"report_type"`
+	DataSetID   string `json:"data_set_id"`
+	IngestionID string `json:"ingestion_id,omitempty"`
+	Manifest    string `json:"manifest"`
+	Skipped     bool   `json:"skipped"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+var (
+	awsAccountID   = os.Getenv("QUICKSIGHT_ACCOUNT_ID")
+	dataSetMapping = os.Getenv("QUICKSIGHT_DATASET_IDS")
+	manifestPrefix = getEnv("MANIFEST_PREFIX", "manifests")
+	environment    = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+
+	// ingestionIDs name the ingestions started. Two batches can refresh a
+	// report type within the same second, so the IDs carry randomness as
+	// well as the time.
+	ingestionIDs = ids.FromEnv(clk)
+)
+
+func main() {
+	lambda.Start(HandleExportCreated)
+}
+
+// HandleExportCreated runs for every object the report exporter writes to S3.
+// Exports are laid out as <report_type>/date=YYYY-MM-DD/<file>, so the first
+// path segment identifies which QuickSight dataset needs refreshing.
+func HandleExportCreated(ctx context.Context, event events.S3Event) error {
+	log.Printf("Processing %d export notifications for environment: %s", len(event.Records), environment)
+
+	dataSets, err := parseDataSetMapping(dataSetMapping)
+	if err != nil {
+		return fmt.Errorf("failed to parse dataset mapping: %w", err)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	s3Client := s3.NewFromConfig(cfg)
+	qsClient := quicksight.NewFromConfig(cfg)
+
+	// A single export run usually writes several files for the same report
+	// type; refresh each dataset once per batch of notifications.
+	seen := make(map[string]bool)
+	for _, record := range event.Records {
+		bucket := record.S3.Bucket.Name
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+
+		if strings.HasPrefix(key, manifestPrefix+"/") {
+			continue
+		}
+
+		reportType := reportTypeFromKey(key)
+		if reportType == "" || seen[reportType] {
+			continue
+		}
+		seen[reportType] = true
+
+		dataSetID, ok := dataSets[reportType]
+		if !ok {
+			log.Printf("No QuickSight dataset configured for report type %s, skipping", reportType)
+			continue
+		}
+
+		result, err := refreshDataSet(ctx, s3Client, qsClient, bucket, key, reportType, dataSetID)
+		if err != nil {
+			return fmt.Errorf("failed to refresh dataset for %s: %w", reportType, err)
+		}
+
+		summary, _ := json.Marshal(result)
+		log.Printf("QuickSight refresh result: %s", summary)
+	}
+
+	return nil
+}
+
+func refreshDataSet(ctx context.Context, s3Client *s3.Client, qsClient *quicksight.Client, bucket, key, reportType, dataSetID string) (*RefreshResult, error) {
+	manifestKey, err := writeManifest(ctx, s3Client, bucket, key, reportType)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RefreshResult{
+		ReportType: reportType,
+		DataSetID:  dataSetID,
+		Manifest:   fmt.Sprintf("s3://%s/%s", bucket, manifestKey),
+	}
+
+	// QuickSight rejects a new ingestion while one is in flight; the running
+	// ingestion will already pick up the new files.
+	running, err := hasActiveIngestion(ctx, qsClient, dataSetID)
+	if err != nil {
+		return nil, err
+	}
+	if running {
+		result.Skipped = true
+		result.Reason = "ingestion already in progress"
+		return result, nil
+	}
+
+	ingestionID := reportType + "-" + ingestionIDs.NewID()
+	_, err = qsClient.CreateIngestion(ctx, &quicksight.CreateIngestionInput{
+		AwsAccountId:  aws.String(awsAccountID),
+		DataSetId:     aws.String(dataSetID),
+		IngestionId:   aws.String(ingestionID),
+		IngestionType: qstypes.IngestionTypeFullRefresh,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ingestion: %w", err)
+	}
+
+	result.IngestionID = ingestionID
+	return result, nil
+}
+
+// writeManifest (re)writes the manifest for a report type so it points at
+// every partition under the report prefix. QuickSight resolves URIPrefixes at
+// ingestion time, so new date partitions are picked up without rewriting.
+func writeManifest(ctx context.Context, s3Client *s3.Client, bucket, key, reportType string) (string, error) {
+	manifest := buildManifest(bucket, reportType, path.Ext(key))
+
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	manifestKey := fmt.Sprintf("%s/%s.json", manifestPrefix, reportType)
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(manifestKey),
+		Body:        strings.NewReader(string(body)),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return manifestKey, nil
+}
+
+func buildManifest(bucket, reportType, ext string) QuickSightManifest {
+	settings := ManifestUploadSettings{Format: "CSV", Delimiter: ",", ContainsHeader: "true"}
+	if ext == ".json" || ext == ".ndjson" {
+		settings = ManifestUploadSettings{Format: "JSON"}
+	}
+
+	return QuickSightManifest{
+		FileLocations: []ManifestFileLocation{
+			{URIPrefixes: []string{fmt.Sprintf("s3://%s/%s/", bucket, reportType)}},
+		},
+		GlobalUploadSettings: settings,
+	}
+}
+
+func hasActiveIngestion(ctx context.Context, qsClient *quicksight.Client, dataSetID string) (bool, error) {
+	resp, err := qsClient.ListIngestions(ctx, &quicksight.ListIngestionsInput{
+		AwsAccountId: aws.String(awsAccountID),
+		DataSetId:    aws.String(dataSetID),
+		MaxResults:   aws.Int32(5),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list ingestions: %w", err)
+	}
+
+	for _, ingestion := range resp.Ingestions {
+		switch ingestion.IngestionStatus {
+		case qstypes.IngestionStatusInitialized, qstypes.IngestionStatusQueued, qstypes.IngestionStatusRunning:
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func reportTypeFromKey(key string) string {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[0]
+}
+
+func parseDataSetMapping(raw string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if raw == "" {
+		return mapping, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
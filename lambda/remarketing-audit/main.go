@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/envelope"
+	"pkg/googleads"
+	"pkg/ids"
+	"pkg/notify"
+)
+
+// Alert types raised by the audit.
+const (
+	AlertInvalidProductIDs = "REMARKETING_INVALID_PRODUCT_IDS"
+	AlertMissingProductIDs = "REMARKETING_MISSING_PRODUCT_IDS"
+)
+
+// maxExamples caps the product and order IDs quoted in an alert.
+const maxExamples = 5
+
+var (
+	revenueTable  = os.Getenv("ORDER_REVENUE_TABLE_NAME")
+	productsTable = os.Getenv("PRODUCTS_TABLE_NAME")
+	snsTopicARN   = os.Getenv("SNS_TOPIC_ARN")
+	environment   = os.Getenv("ENVIRONMENT")
+
+	// lookbackDays is how many days of conversions each run audits,
+	// today included.
+	lookbackDays = parseIntEnv("AUDIT_LOOKBACK_DAYS", 1)
+	// maxMissingRate is the share of an account's conversions that may
+	// arrive without product IDs before it is alerted on: orders from
+	// pages without the tag are expected, a broken tag is not.
+	maxMissingRate = parseFloatEnv("MAX_MISSING_PRODUCT_IDS_RATE", 0.2)
+
+	clk = clock.FromEnv()
+)
+
+// conversion is the part of a conversion-uploader order revenue record the
+// audit reads.
+type conversion struct {
+	CustomerID string   `dynamodbav:"customer_id"`
+	OrderID    string   `dynamodbav:"order_id"`
+	ProductIDs []string `dynamodbav:"product_ids"`
+}
+
+// catalogProduct is the part of a product-service product the audit reads.
+type catalogProduct struct {
+	ID string `dynamodbav:"id"`
+}
+
+// accountAudit is what one account's recent conversions carried.
+type accountAudit struct {
+	CustomerID  string
+	Conversions int
+	// Missing counts conversions whose tag carried no product IDs;
+	// Invalid those carrying at least one ID not in the catalogue.
+	Missing       int
+	Invalid       int
+	InvalidIDs    map[string]int
+	InvalidOrders []string
+}
+
+// RemarketingAlert mirrors the campaign alert payload, so audit findings
+// reach the same channels and routes as campaign-monitor's. It concerns
+// the account's tagging rather than one campaign.
+type RemarketingAlert struct {
+	CustomerID   string `json:"customer_id"`
+	CampaignID   string `json:"campaign_id"`
+	CampaignName string `json:"campaign_name"`
+	Status       string `json:"status"`
+	AlertType    string `json:"alert_type"`
+	Message      string `json:"message"`
+}
+
+func main() {
+	lambda.Start(HandleRemarketingAudit)
+}
+
+// HandleRemarketingAudit runs daily: it reads the conversions recorded in
+// the last lookbackDays and checks that the product IDs their purchase
+// page's remarketing tag carried are catalogue product IDs, which are the
+// Merchant Center item IDs dynamic remarketing matches on. Accounts whose
+// tags carry unknown IDs, or too often none, are alerted on.
+func HandleRemarketingAudit(ctx context.Context, event interface{}) error {
+	log.Printf("Starting remarketing tag audit for environment: %s (%d days)", environment, lookbackDays)
+
+	emf := googleads.Metrics("remarketing-audit", environment, clk)
+	defer emf.Flush()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dynamoClient := dynamodb.NewFromConfig(cfg)
+
+	conversions, err := recentConversions(ctx, dynamo.NewTable(dynamoClient, revenueTable))
+	if err != nil {
+		return err
+	}
+	catalog, err := loadCatalog(ctx, dynamo.NewTable(dynamoClient, productsTable), conversions)
+	if err != nil {
+		return err
+	}
+
+	audits := auditConversions(conversions, catalog)
+	var alerts []RemarketingAlert
+	var missing, invalid int
+	for _, audit := range audits {
+		log.Printf("Customer %s: %d conversions, %d without product IDs, %d with unknown product IDs",
+			audit.CustomerID, audit.Conversions, audit.Missing, audit.Invalid)
+		missing += audit.Missing
+		invalid += audit.Invalid
+		alerts = append(alerts, audit.alerts()...)
+	}
+	emf.Count("ConversionsAudited", len(conversions))
+	emf.Count("ConversionsMissingProductIDs", missing)
+	emf.Count("ConversionsInvalidProductIDs", invalid)
+	emf.Count("AlertsGenerated", len(alerts))
+
+	if len(alerts) > 0 {
+		if err := sendAlerts(ctx, sns.NewFromConfig(cfg), alerts); err != nil {
+			return fmt.Errorf("failed to send alerts: %w", err)
+		}
+	}
+
+	log.Printf("Remarketing tag audit completed: %d conversions, %d without product IDs, %d with unknown product IDs, %d alerts",
+		len(conversions), missing, invalid, len(alerts))
+	return nil
+}
+
+// recentConversions reads the conversions of the last lookbackDays. Order
+// keys start with the conversion's UTC date, so the window is a filter on
+// them.
+func recentConversions(ctx context.Context, table *dynamo.Table) ([]conversion, error) {
+	since := clk.Now().UTC().AddDate(0, 0, 1-lookbackDays).Format("2006-01-02")
+	var conversions []conversion
+	err := dynamo.ScanEach(ctx, table, dynamo.Scan{
+		Filter:     "order_key >= :since",
+		Projection: "customer_id, order_id, product_ids",
+		Values:     map[string]types.AttributeValue{":since": dynamo.S(since)},
+	}, func(page []conversion) error {
+		conversions = append(conversions, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan conversions since %s: %w", since, err)
+	}
+	return conversions, nil
+}
+
+// loadCatalog returns which of the well-formed product IDs the
+// conversions carried are in the catalogue.
+func loadCatalog(ctx context.Context, table *dynamo.Table, conversions []conversion) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	var keys []dynamo.Key
+	for _, c := range conversions {
+		for _, id := range c.ProductIDs {
+			if ids.Valid(id) && !seen[id] {
+				seen[id] = true
+				keys = append(keys, dynamo.StringKey("id", id))
+			}
+		}
+	}
+
+	products, err := dynamo.BatchGet[catalogProduct](ctx, table, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %d product IDs: %w", len(keys), err)
+	}
+	catalog := make(map[string]bool, len(products))
+	for _, product := range products {
+		catalog[product.ID] = true
+	}
+	return catalog, nil
+}
+
+// auditConversions groups conversions by account and counts the ones
+// whose product IDs are missing or not in catalog, ordered by customer.
+func auditConversions(conversions []conversion, catalog map[string]bool) []*accountAudit {
+	byCustomer := make(map[string]*accountAudit)
+	for _, c := range conversions {
+		audit := byCustomer[c.CustomerID]
+		if audit == nil {
+			audit = &accountAudit{CustomerID: c.CustomerID, InvalidIDs: make(map[string]int)}
+			byCustomer[c.CustomerID] = audit
+		}
+		audit.Conversions++
+
+		if len(c.ProductIDs) == 0 {
+			audit.Missing++
+			continue
+		}
+		var bad bool
+		for _, id := range c.ProductIDs {
+			if !catalog[id] {
+				audit.InvalidIDs[id]++
+				bad = true
+			}
+		}
+		if bad {
+			audit.Invalid++
+			audit.InvalidOrders = append(audit.InvalidOrders, c.OrderID)
+		}
+	}
+
+	audits := make([]*accountAudit, 0, len(byCustomer))
+	for _, audit := range byCustomer {
+		audits = append(audits, audit)
+	}
+	sort.Slice(audits, func(i, j int) bool { return audits[i].CustomerID < audits[j].CustomerID })
+	return audits
+}
+
+// alerts are the findings worth a person's attention: any unknown product
+// ID, and conversions without IDs beyond maxMissingRate.
+func (a *accountAudit) alerts() []RemarketingAlert {
+	var alerts []RemarketingAlert
+	if a.Invalid > 0 {
+		alerts = append(alerts, a.alert(AlertInvalidProductIDs, fmt.Sprintf(
+			"%d of %d recent conversions carried remarketing product IDs that are not in the catalogue, so dynamic remarketing cannot match them to Merchant Center items. Unknown IDs: %s. Orders: %s.",
+			a.Invalid, a.Conversions, examples(a.invalidIDsByCount()), examples(a.InvalidOrders))))
+	}
+	if rate := float64(a.Missing) / float64(a.Conversions); a.Missing > 0 && rate > maxMissingRate {
+		alerts = append(alerts, a.alert(AlertMissingProductIDs, fmt.Sprintf(
+			"%d of %d recent conversions (%.0f%%) carried no remarketing product IDs; the purchase page tag may be missing or failing.",
+			a.Missing, a.Conversions, rate*100)))
+	}
+	return alerts
+}
+
+func (a *accountAudit) alert(alertType, message string) RemarketingAlert {
+	return RemarketingAlert{
+		CustomerID:   a.CustomerID,
+		CampaignName: "Dynamic remarketing",
+		Status:       "ENABLED",
+		AlertType:    alertType,
+		Message:      message,
+	}
+}
+
+// invalidIDsByCount lists the unknown IDs, most frequent first.
+func (a *accountAudit) invalidIDsByCount() []string {
+	out := make([]string, 0, len(a.InvalidIDs))
+	for id := range a.InvalidIDs {
+		out = append(out, id)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a.InvalidIDs[out[i]] != a.InvalidIDs[out[j]] {
+			return a.InvalidIDs[out[i]] > a.InvalidIDs[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// examples joins the first maxExamples values, noting how many more there
+// are.
+func examples(values []string) string {
+	if len(values) <= maxExamples {
+		return strings.Join(values, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(values[:maxExamples], ", "), len(values)-maxExamples)
+}
+
+// sendAlerts publishes each alert as a campaign alert.
+func sendAlerts(ctx context.Context, svc *sns.Client, alerts []RemarketingAlert) error {
+	codec := envelope.New("remarketing-audit", nil, "", clk)
+	var sent int
+	for _, alert := range alerts {
+		message, err := codec.Seal(ctx, envelope.Meta{
+			Type:          notify.KindCampaignAlert,
+			SchemaVersion: notify.CampaignAlertSchemaVersion,
+			Tenant:        alert.CustomerID,
+		}, alert)
+		if err != nil {
+			return fmt.Errorf("failed to seal alert: %w", err)
+		}
+
+		_, err = svc.Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(snsTopicARN),
+			Message:  aws.String(message),
+			Subject:  aws.String(fmt.Sprintf("Google Ads Alert: %s - %s", alert.AlertType, alert.CampaignName)),
+		})
+		if err != nil {
+			log.Printf("Failed to publish alert: %v", err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("Sent %d of %d remarketing alerts", sent, len(alerts))
+	return nil
+}
+
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func parseIntEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
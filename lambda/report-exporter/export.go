@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Exporter writes one CSV per report, account and day. Each file replaces
+// the previous export of the same partition, so re-running a day after
+// Google Ads restates conversions never duplicates rows.
+type Exporter struct {
+	client *s3.Client
+	bucket string
+}
+
+// Write stores rows, header first, at
+// <report_type>/date=YYYY-MM-DD/<customer_id>.csv.
+func (e *Exporter) Write(ctx context.Context, report reportDefinition, customerID, date string, rows [][]string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(report.header()); err != nil {
+		return fmt.Errorf("failed to encode %s report: %w", report.Name, err)
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to encode %s report: %w", report.Name, err)
+	}
+
+	key := fmt.Sprintf("%s/date=%s/%s.csv", report.Name, date, customerID)
+	_, err := e.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(e.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("text/csv"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	gads "pkg/googleads"
+	_ "pkg/localdev"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+// ReportExportEvent optionally narrows a run. The daily schedule sends an
+// empty event; a backfill passes the reports and an inclusive date range,
+// e.g. {"reports": ["geo"], "start_date": "2024-01-01", "end_date": "2024-03-31"}.
+type ReportExportEvent struct {
+	Reports   []string `json:"reports,omitempty"`
+	StartDate string   `json:"start_date,omitempty"`
+	EndDate   string   `json:"end_date,omitempty"`
+}
+
+// maxBackfillDays bounds a single invocation's date range so a backfill
+// fits in the Lambda timeout; split longer ranges into several events.
+const maxBackfillDays = 92
+
+var (
+	secretName    = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	reportsBucket = os.Getenv("REPORTS_BUCKET")
+	environment   = os.Getenv("ENVIRONMENT")
+
+	// refreshDays is how many days, ending yesterday, the daily run
+	// re-exports: Google Ads keeps restating conversions for a few days.
+	refreshDays = getIntEnv("REFRESH_DAYS", 3)
+
+	clk = clock.FromEnv()
+
+	// emf collects the invocation's metrics for CloudWatch.
+	emf = gads.Metrics("report-exporter", environment, clk)
+
+	// adsCalls makes the Google Ads calls, retrying those that fail with
+	// quota or server errors; see retry.GoogleAdsFromEnv for the overrides.
+	adsCalls = gads.New(emf, nil)
+)
+
+func main() {
+	lambda.Start(HandleReportExport)
+}
+
+// HandleReportExport runs daily: for every active account and report type
+// it exports the last refreshDays days to the reports bucket as
+// date-partitioned CSV, which the Glue tables in the google-ads module
+// expose to Athena and QuickSight.
+func HandleReportExport(ctx context.Context, event ReportExportEvent) error {
+	defer flushMetrics()
+	log.Printf("Starting report export for environment: %s", environment)
+
+	selected := reports
+	if len(event.Reports) > 0 {
+		selected = nil
+		for _, name := range event.Reports {
+			report, ok := reportByName(name)
+			if !ok {
+				return fmt.Errorf("unknown report type %q", name)
+			}
+			selected = append(selected, report)
+		}
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	client, err := createGoogleAdsClient(adsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+
+	accounts, err := loadAccounts(ctx, dynamodb.NewFromConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to load customer accounts: %w", err)
+	}
+
+	exporter := &Exporter{client: s3.NewFromConfig(cfg), bucket: reportsBucket}
+	now := clk.Now()
+
+	var exports, failed int
+	for _, account := range accounts {
+		start, end, err := exportRange(event, now.In(account.location()))
+		if err != nil {
+			return err
+		}
+
+		for _, report := range selected {
+			n, err := exportReport(ctx, client, exporter, report, account.CustomerID, start, end)
+			if err != nil {
+				log.Printf("Failed to export %s report for account %s: %v", report.Name, account.CustomerID, err)
+				emf.Count("ReportsFailed", 1)
+				failed++
+				continue
+			}
+			emf.Count("RowsExported", n)
+			exports++
+		}
+	}
+	if failed > 0 && exports == 0 {
+		return fmt.Errorf("failed to export all %d reports", failed)
+	}
+
+	log.Printf("Report export completed: %d exported, %d failed", exports, failed)
+	return nil
+}
+
+// exportRange is the event's date range, or the refreshDays ending
+// yesterday in the account's time zone.
+func exportRange(event ReportExportEvent, localNow time.Time) (time.Time, time.Time, error) {
+	if event.StartDate == "" && event.EndDate == "" {
+		today := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, time.UTC)
+		end := today.AddDate(0, 0, -1)
+		return end.AddDate(0, 0, -(refreshDays - 1)), end, nil
+	}
+
+	start, err := time.Parse("2006-01-02", event.StartDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_date must be YYYY-MM-DD: %w", err)
+	}
+	end, err := time.Parse("2006-01-02", event.EndDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("end_date must be YYYY-MM-DD: %w", err)
+	}
+	if end.Before(start) || end.Sub(start) >= maxBackfillDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range must be 1 to %d days", maxBackfillDays)
+	}
+	return start, end, nil
+}
+
+// exportReport runs one report over [start, end] for an account and writes
+// one partition per day, empty days included so a rerun clears rows
+// Google Ads no longer reports. It returns the rows written.
+func exportReport(ctx context.Context, client *googleads.Service, exporter *Exporter, report reportDefinition, customerID string, start, end time.Time) (int, error) {
+	query, err := report.query(start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	byDate := make(map[string][][]string)
+	var pageToken string
+	for {
+		resp, err := search(ctx, client, &googleads.SearchGoogleAdsRequest{
+			CustomerId: customerID,
+			Query:      query,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, row := range resp.Results {
+			date := row.Segments.Date
+			byDate[date] = append(byDate[date], append([]string{customerID}, append(report.Row(row), performanceRow(row.Metrics)...)...))
+		}
+
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+
+	written := 0
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		if err := exporter.Write(ctx, report, customerID, date, byDate[date]); err != nil {
+			return written, err
+		}
+		written += len(byDate[date])
+	}
+	return written, nil
+}
+
+// search runs a Google Ads query through adsCalls.
+func search(ctx context.Context, client *googleads.Service, req *googleads.SearchGoogleAdsRequest) (*googleads.SearchGoogleAdsResponse, error) {
+	return gads.Search(ctx, adsCalls, func(ctx context.Context) (*googleads.SearchGoogleAdsResponse, error) {
+		return client.Search(ctx, req)
+	}, func(resp *googleads.SearchGoogleAdsResponse) int { return len(resp.Results) })
+}
+
+func flushMetrics() {
+	if err := emf.Flush(); err != nil {
+		log.Printf("Failed to flush metrics: %v", err)
+	}
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	opts := []option.ClientOption{
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	}
+	if endpoint := os.Getenv("GOOGLE_ADS_ENDPOINT"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+
+	srv, err := googleads.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strconv"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+)
+
+// reportDefinition is one scheduled report: the GAQL resource and fields
+// it selects and how a result row becomes a CSV row. Every report selects
+// segments.date, which becomes the date= partition rather than a column.
+type reportDefinition struct {
+	// Name is the report type, the first path segment of its exports and
+	// the Glue table name.
+	Name     string
+	Resource string
+	Fields   []string
+	Where    func(*gaql.Builder) *gaql.Builder
+	Columns  []string
+	Row      func(*googleads.GoogleAdsRow) []string
+}
+
+// performanceFields and performanceColumns are appended to every report.
+var (
+	performanceFields = []string{
+		"metrics.impressions",
+		"metrics.clicks",
+		"metrics.cost_micros",
+		"metrics.conversions",
+	}
+	performanceColumns = []string{"impressions", "clicks", "cost", "conversions"}
+)
+
+func performanceRow(m *googleads.Metrics) []string {
+	return []string{
+		strconv.FormatInt(m.Impressions, 10),
+		strconv.FormatInt(m.Clicks, 10),
+		strconv.FormatFloat(float64(m.CostMicros)/1000000.0, 'f', 2, 64),
+		strconv.FormatInt(m.Conversions, 10),
+	}
+}
+
+// reports are the exported report types, in export order. Column order
+// must match the Glue tables in modules/google-ads/reports.tf.
+var reports = []reportDefinition{
+	{
+		Name:     "search_terms",
+		Resource: "search_term_view",
+		Fields: []string{
+			"campaign.id",
+			"campaign.name",
+			"ad_group.id",
+			"ad_group.name",
+			"search_term_view.search_term",
+			"search_term_view.status",
+		},
+		Where: func(b *gaql.Builder) *gaql.Builder {
+			return b.Where("metrics.impressions", gaql.GreaterThan, 0)
+		},
+		Columns: []string{"campaign_id", "campaign_name", "ad_group_id", "ad_group_name", "search_term", "status"},
+		Row: func(row *googleads.GoogleAdsRow) []string {
+			return []string{
+				strconv.FormatInt(row.Campaign.Id, 10),
+				row.Campaign.Name,
+				strconv.FormatInt(row.AdGroup.Id, 10),
+				row.AdGroup.Name,
+				row.SearchTermView.SearchTerm,
+				row.SearchTermView.Status.String(),
+			}
+		},
+	},
+	{
+		Name:     "geo",
+		Resource: "geographic_view",
+		Fields: []string{
+			"campaign.id",
+			"campaign.name",
+			"geographic_view.country_criterion_id",
+			"geographic_view.location_type",
+		},
+		Columns: []string{"campaign_id", "campaign_name", "country_criterion_id", "location_type"},
+		Row: func(row *googleads.GoogleAdsRow) []string {
+			return []string{
+				strconv.FormatInt(row.Campaign.Id, 10),
+				row.Campaign.Name,
+				strconv.FormatInt(row.GeographicView.CountryCriterionId, 10),
+				row.GeographicView.LocationType.String(),
+			}
+		},
+	},
+	{
+		Name:     "device",
+		Resource: "campaign",
+		Fields: []string{
+			"campaign.id",
+			"campaign.name",
+			"segments.device",
+		},
+		Where: func(b *gaql.Builder) *gaql.Builder {
+			return b.Where("campaign.status", gaql.NotEquals, "REMOVED")
+		},
+		Columns: []string{"campaign_id", "campaign_name", "device"},
+		Row: func(row *googleads.GoogleAdsRow) []string {
+			return []string{
+				strconv.FormatInt(row.Campaign.Id, 10),
+				row.Campaign.Name,
+				row.Segments.Device.String(),
+			}
+		},
+	},
+	{
+		Name:     "hour_of_day",
+		Resource: "campaign",
+		Fields: []string{
+			"campaign.id",
+			"campaign.name",
+			"segments.hour",
+		},
+		Where: func(b *gaql.Builder) *gaql.Builder {
+			return b.Where("campaign.status", gaql.NotEquals, "REMOVED")
+		},
+		Columns: []string{"campaign_id", "campaign_name", "hour"},
+		Row: func(row *googleads.GoogleAdsRow) []string {
+			return []string{
+				strconv.FormatInt(row.Campaign.Id, 10),
+				row.Campaign.Name,
+				strconv.FormatInt(row.Segments.Hour, 10),
+			}
+		},
+	},
+}
+
+// query builds the report's GAQL for the inclusive date range.
+func (r reportDefinition) query(start, end string) (string, error) {
+	fields := append([]string{"segments.date"}, r.Fields...)
+	fields = append(fields, performanceFields...)
+	b := gaql.Select(fields...).
+		From(r.Resource).
+		Between("segments.date", start, end)
+	if r.Where != nil {
+		b = r.Where(b)
+	}
+	return b.Build()
+}
+
+// header is the CSV header: customer_id, the report's columns and the
+// performance columns.
+func (r reportDefinition) header() []string {
+	header := append([]string{"customer_id"}, r.Columns...)
+	return append(header, performanceColumns...)
+}
+
+func reportByName(name string) (reportDefinition, bool) {
+	for _, r := range reports {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return reportDefinition{}, false
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/clock"
+	"pkg/dynamo"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+// Sync modes.
+const (
+	// modeIncremental adds new seeds and removes lapsed ones, leaving the
+	// rest of the list as it is.
+	modeIncremental = "incremental"
+	// modeReplace clears the list and uploads every seed, correcting any
+	// drift between the list and the recorded members.
+	modeReplace = "replace"
+)
+
+// ExportRequest is the invocation payload. The schedules send the mode;
+// an empty mode takes SYNC_MODE.
+type ExportRequest struct {
+	Mode string `json:"mode"`
+}
+
+var (
+	secretName         = os.Getenv("GOOGLE_ADS_SECRET_ARN")
+	customerID         = os.Getenv("GOOGLE_ADS_CUSTOMER_ID")
+	seedListID         = os.Getenv("SEED_LIST_ID")
+	usersTable         = os.Getenv("USERS_TABLE_NAME")
+	preferencesTable   = os.Getenv("NOTIFICATION_PREFERENCES_TABLE_NAME")
+	membersTable       = os.Getenv("SEED_MEMBERS_TABLE_NAME")
+	defaultMode        = getEnv("SYNC_MODE", modeIncremental)
+	defaultCallingCode = os.Getenv("DEFAULT_CALLING_CODE")
+	environment        = os.Getenv("ENVIRONMENT")
+
+	// seedTiers are the ltv-scorer tiers whose customers seed the list.
+	seedTiers = strings.Split(getEnv("SEED_LTV_TIERS", "high"), ",")
+	// minSeedSize is the fewest seeds worth syncing. Google Ads needs a
+	// list of some size before it builds lookalikes from it, and a seed
+	// far below the usual size more likely means missing scores than
+	// fewer good customers, so the list is left alone.
+	minSeedSize = getIntEnv("MIN_SEED_SIZE", 1000)
+
+	clk = clock.FromEnv()
+)
+
+func main() {
+	lambda.Start(HandleExport)
+}
+
+// HandleExport exports the customers of the seed tiers to the lookalike
+// seed Customer Match list, by hashed email and phone number.
+func HandleExport(ctx context.Context, req ExportRequest) error {
+	mode := req.Mode
+	if mode == "" {
+		mode = defaultMode
+	}
+	if mode != modeIncremental && mode != modeReplace {
+		return fmt.Errorf("unknown sync mode %q", mode)
+	}
+	if seedListID == "" {
+		log.Printf("SEED_LIST_ID is not set; nothing to export")
+		return nil
+	}
+	log.Printf("Starting %s seed export for environment: %s", mode, environment)
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	db := dynamodb.NewFromConfig(cfg)
+	exporter := &Exporter{
+		users:       dynamo.NewTable(db, usersTable),
+		preferences: dynamo.NewTable(db, preferencesTable),
+		members:     dynamo.NewTable(db, membersTable),
+		loadAds:     func() (*googleads.Service, error) { return newAdsClient(ctx, cfg) },
+	}
+
+	seeds, err := exporter.LoadSeeds(ctx)
+	if err != nil {
+		return err
+	}
+	if len(seeds) < minSeedSize {
+		log.Printf("Skipping seed export: %d seeds, fewer than the minimum %d", len(seeds), minSeedSize)
+		return nil
+	}
+
+	result, err := exporter.Sync(ctx, seeds, mode)
+	if err != nil {
+		return err
+	}
+	log.Printf("Seed export completed: %d seeds, %d added, %d removed, job %s",
+		len(seeds), result.Added, result.Removed, result.Job)
+	return nil
+}
+
+func newAdsClient(ctx context.Context, cfg aws.Config) (*googleads.Service, error) {
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google Ads config: %w", err)
+	}
+	return createGoogleAdsClient(adsConfig)
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	srv, err := googleads.NewService(context.Background(),
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"google.golang.org/api/googleads"
+
+	"pkg/customermatch"
+	"pkg/dynamo"
+)
+
+// Member is one customer in the seed list, as uploaded: the hashes are
+// kept so a later removal sends the same identifiers.
+type Member struct {
+	ListID      string    `dynamodbav:"list_id"`
+	UserID      string    `dynamodbav:"user_id"`
+	HashedEmail string    `dynamodbav:"hashed_email,omitempty"`
+	HashedPhone string    `dynamodbav:"hashed_phone,omitempty"`
+	SyncedAt    time.Time `dynamodbav:"synced_at"`
+}
+
+// sameIdentifiers reports whether m and other match on the same hashes.
+func (m Member) sameIdentifiers(other Member) bool {
+	return m.HashedEmail == other.HashedEmail && m.HashedPhone == other.HashedPhone
+}
+
+// seedUser is the part of a user-service record the export needs.
+type seedUser struct {
+	ID               string `dynamodbav:"id"`
+	Email            string `dynamodbav:"email"`
+	MarketingConsent bool   `dynamodbav:"marketing_consent"`
+	// Preferences are the user's consents, set through user-service's
+	// /users/{id}/preferences; nil for users who never set them.
+	Preferences *struct {
+		AdsPersonalization bool `dynamodbav:"ads_personalization"`
+	} `dynamodbav:"preferences"`
+}
+
+// consented reports whether the user agreed to be in ad audiences, as
+// audience-sync decides it.
+func (u seedUser) consented() bool {
+	if u.Preferences != nil {
+		return u.Preferences.AdsPersonalization
+	}
+	return u.MarketingConsent
+}
+
+// channelPreferences is the part of notification-service's preferences
+// holding the user's phone number.
+type channelPreferences struct {
+	UserID      string `dynamodbav:"user_id"`
+	PhoneNumber string `dynamodbav:"phone_number"`
+}
+
+// Exporter builds the seed list and syncs it to Google Ads.
+type Exporter struct {
+	users       *dynamo.Table
+	preferences *dynamo.Table
+	members     *dynamo.Table
+	loadAds     func() (*googleads.Service, error)
+}
+
+// LoadSeeds returns the consenting, live customers of the seed tiers with
+// an email or phone number Customer Match can take, hashed.
+func (e *Exporter) LoadSeeds(ctx context.Context) ([]Member, error) {
+	names := map[string]string{"#ltv": "ltv", "#tier": "tier", "#deleted": "deleted_at"}
+	values := make(map[string]types.AttributeValue, len(seedTiers))
+	var placeholders string
+	for i, tier := range seedTiers {
+		placeholder := ":tier" + strconv.Itoa(i)
+		values[placeholder] = dynamo.S(tier)
+		if i > 0 {
+			placeholders += ", "
+		}
+		placeholders += placeholder
+	}
+
+	var users []seedUser
+	err := dynamo.ScanEach(ctx, e.users, dynamo.Scan{
+		Filter:     "#ltv.#tier IN (" + placeholders + ") AND attribute_not_exists(#deleted)",
+		Projection: "id, email, marketing_consent, preferences",
+		Names:      names,
+		Values:     values,
+	}, func(page []seedUser) error {
+		for _, user := range page {
+			if user.consented() {
+				users = append(users, user)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan users: %w", err)
+	}
+
+	phones, err := e.loadPhones(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	seeds := make([]Member, 0, len(users))
+	for _, user := range users {
+		seed := Member{
+			ListID:      seedListID,
+			UserID:      user.ID,
+			HashedEmail: customermatch.HashEmail(user.Email),
+			HashedPhone: customermatch.HashPhone(phones[user.ID], defaultCallingCode),
+		}
+		if seed.HashedEmail == "" && seed.HashedPhone == "" {
+			continue
+		}
+		seeds = append(seeds, seed)
+	}
+	return seeds, nil
+}
+
+// loadPhones returns the phone numbers users gave notification-service,
+// by user ID.
+func (e *Exporter) loadPhones(ctx context.Context, users []seedUser) (map[string]string, error) {
+	keys := make([]dynamo.Key, len(users))
+	for i, user := range users {
+		keys[i] = dynamo.StringKey("user_id", user.ID)
+	}
+	prefs, err := dynamo.BatchGet[channelPreferences](ctx, e.preferences, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read phone numbers: %w", err)
+	}
+
+	phones := make(map[string]string, len(prefs))
+	for _, p := range prefs {
+		if p.PhoneNumber != "" {
+			phones[p.UserID] = p.PhoneNumber
+		}
+	}
+	return phones, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"google.golang.org/api/googleads"
+
+	"pkg/dynamo"
+)
+
+// maxOperationsPerRequest bounds the operations sent in one
+// AddOfflineUserDataJobOperations call. Google Ads takes up to 100,000
+// identifiers a request; each operation here carries at most two.
+const maxOperationsPerRequest = 10000
+
+// SyncResult summarizes one sync.
+type SyncResult struct {
+	// Job is the offline user data job's resource name, empty when there
+	// was nothing to upload.
+	Job     string
+	Added   int
+	Removed int
+}
+
+// Sync brings the seed list in line with seeds. Incrementally, members
+// no longer in seeds are removed and new seeds added; a member whose email
+// or phone changed is removed by the old hashes and added by the new. In
+// replace mode the list is cleared and every seed added.
+//
+// Changes go to Google Ads as one offline user data job, which it
+// processes over the following hours. Members are recorded once the job is
+// submitted; if recording fails the next incremental sync re-sends the
+// difference, which Customer Match applies idempotently.
+func (e *Exporter) Sync(ctx context.Context, seeds []Member, mode string) (SyncResult, error) {
+	current, err := dynamo.QueryAll[Member](ctx, e.members, dynamo.Query{
+		KeyCondition: "list_id = :list",
+		Values:       map[string]types.AttributeValue{":list": dynamo.S(seedListID)},
+	})
+	if err != nil {
+		return SyncResult{}, fmt.Errorf("failed to load seed members: %w", err)
+	}
+	byUser := make(map[string]Member, len(current))
+	for _, m := range current {
+		byUser[m.UserID] = m
+	}
+
+	var adds, removes, stale []Member
+	seeded := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		seeded[seed.UserID] = true
+		existing, ok := byUser[seed.UserID]
+		switch {
+		case mode == modeReplace || !ok:
+			adds = append(adds, seed)
+		case !existing.sameIdentifiers(seed):
+			removes = append(removes, existing)
+			adds = append(adds, seed)
+		}
+	}
+	for _, m := range current {
+		if !seeded[m.UserID] {
+			stale = append(stale, m)
+		}
+	}
+	if mode == modeIncremental {
+		removes = append(removes, stale...)
+	}
+
+	result := SyncResult{Added: len(adds), Removed: len(removes)}
+	if mode == modeReplace {
+		result.Removed = len(stale)
+	} else if len(adds) == 0 && len(removes) == 0 {
+		return result, nil
+	}
+
+	client, err := e.loadAds()
+	if err != nil {
+		return SyncResult{}, fmt.Errorf("failed to create Google Ads client: %w", err)
+	}
+	result.Job, err = e.upload(ctx, client, mode == modeReplace, removes, adds)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	now := clk.Now()
+	for i := range adds {
+		adds[i].SyncedAt = now
+	}
+	if err := dynamo.BatchPut(ctx, e.members, adds); err != nil {
+		log.Printf("Failed to record seed members: %v", err)
+	}
+	for _, m := range stale {
+		if err := e.members.Delete(ctx, dynamo.CompositeKey("list_id", m.ListID, "user_id", m.UserID)); err != nil {
+			log.Printf("Failed to remove seed member %s: %v", m.UserID, err)
+		}
+	}
+	return result, nil
+}
+
+// upload submits removes, then adds, as one job and starts it. With
+// removeAll the job first empties the list, which Google Ads allows only
+// as a job's first operation.
+func (e *Exporter) upload(ctx context.Context, client *googleads.Service, removeAll bool, removes, adds []Member) (string, error) {
+	job, err := client.CreateOfflineUserDataJob(ctx, &googleads.CreateOfflineUserDataJobRequest{
+		CustomerId: customerID,
+		Job: &googleads.OfflineUserDataJob{
+			Type: "CUSTOMER_MATCH_USER_LIST",
+			CustomerMatchUserListMetadata: &googleads.CustomerMatchUserListMetadata{
+				UserList: "customers/" + customerID + "/userLists/" + seedListID,
+				// Only consenting customers are seeds.
+				Consent: &googleads.Consent{
+					AdUserData:        "GRANTED",
+					AdPersonalization: "GRANTED",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create offline user data job: %w", err)
+	}
+
+	var ops []*googleads.OfflineUserDataJobOperation
+	if removeAll {
+		ops = append(ops, &googleads.OfflineUserDataJobOperation{RemoveAll: true})
+	}
+	for _, m := range removes {
+		ops = append(ops, &googleads.OfflineUserDataJobOperation{Remove: userData(m)})
+	}
+	for _, m := range adds {
+		ops = append(ops, &googleads.OfflineUserDataJobOperation{Create: userData(m)})
+	}
+
+	for start := 0; start < len(ops); start += maxOperationsPerRequest {
+		end := min(start+maxOperationsPerRequest, len(ops))
+		_, err := client.AddOfflineUserDataJobOperations(ctx, &googleads.AddOfflineUserDataJobOperationsRequest{
+			ResourceName: job.ResourceName,
+			Operations:   ops[start:end],
+		})
+		if err != nil {
+			// The job never runs; the next sync starts over.
+			return "", fmt.Errorf("failed to add operations %d-%d to %s: %w", start, end, job.ResourceName, err)
+		}
+	}
+
+	if _, err := client.RunOfflineUserDataJob(ctx, &googleads.RunOfflineUserDataJobRequest{
+		ResourceName: job.ResourceName,
+	}); err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", job.ResourceName, err)
+	}
+	return job.ResourceName, nil
+}
+
+func userData(m Member) *googleads.UserData {
+	var ids []*googleads.UserIdentifier
+	if m.HashedEmail != "" {
+		ids = append(ids, &googleads.UserIdentifier{HashedEmail: m.HashedEmail})
+	}
+	if m.HashedPhone != "" {
+		ids = append(ids, &googleads.UserIdentifier{HashedPhoneNumber: m.HashedPhone})
+	}
+	return &googleads.UserData{UserIdentifiers: ids}
+}
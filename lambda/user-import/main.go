@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/ids"
+	"pkg/metrics"
+	"pkg/tenant"
+	"pkg/validate"
+)
+
+// metricNamespace groups the user lifecycle metrics.
+const metricNamespace = "Ecommerce/Users"
+
+// Import statuses, as user-service records them.
+const (
+	importRunning   = "RUNNING"
+	importSucceeded = "SUCCEEDED"
+	importFailed    = "FAILED"
+)
+
+const (
+	// checkpointRows is how often progress is saved, so a retried or
+	// continued invocation redoes at most this many rows.
+	checkpointRows = 1000
+	// batchRows is how many users are queued per BatchWriteItem call.
+	batchRows = 25
+	// continueBefore is how much of the invocation's time is left when it
+	// hands the rest of the file to a fresh invocation.
+	continueBefore = 2 * time.Minute
+	// maxImportErrors caps the rejected rows kept on the import.
+	maxImportErrors = 100
+	// maxLineBytes bounds one NDJSON line.
+	maxLineBytes = 1 << 20
+)
+
+var (
+	usersTable   = os.Getenv("USERS_TABLE_NAME")
+	importsTable = os.Getenv("USER_IMPORTS_TABLE_NAME")
+	importBucket = os.Getenv("USER_IMPORT_BUCKET")
+	environment  = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+)
+
+// importJob is the event user-service sends, and this function sends
+// itself to continue an import.
+type importJob struct {
+	ImportID string `json:"import_id"`
+	// TenantID is the tenant the users are imported into; events from
+	// before tenancy have none and import into the default tenant.
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// userImport mirrors user-service's UserImport.
+type userImport struct {
+	ID          string        `dynamodbav:"id"`
+	Status      string        `dynamodbav:"status"`
+	S3Key       string        `dynamodbav:"s3_key"`
+	Format      string        `dynamodbav:"format"`
+	Processed   int           `dynamodbav:"processed"`
+	Created     int           `dynamodbav:"created"`
+	Invalid     int           `dynamodbav:"invalid"`
+	Failed      int           `dynamodbav:"failed"`
+	Errors      []importError `dynamodbav:"errors,omitempty"`
+	Error       string        `dynamodbav:"error,omitempty"`
+	CreatedAt   time.Time     `dynamodbav:"created_at"`
+	UpdatedAt   time.Time     `dynamodbav:"updated_at"`
+	CompletedAt *time.Time    `dynamodbav:"completed_at,omitempty"`
+}
+
+type importError struct {
+	Row     int    `dynamodbav:"row"`
+	Field   string `dynamodbav:"field,omitempty"`
+	Message string `dynamodbav:"message"`
+}
+
+// userRecord is one row, checked with user-service's rules for POST /users.
+type userRecord struct {
+	Email            string `json:"email" validate:"required,email,max=254"`
+	FirstName        string `json:"first_name" validate:"required,max=100"`
+	LastName         string `json:"last_name" validate:"required,max=100"`
+	MarketingConsent bool   `json:"marketing_consent"`
+}
+
+// user is the users table item, as user-service writes it.
+type user struct {
+	ID               string    `dynamodbav:"id"`
+	Email            string    `dynamodbav:"email"`
+	FirstName        string    `dynamodbav:"first_name"`
+	LastName         string    `dynamodbav:"last_name"`
+	MarketingConsent bool      `dynamodbav:"marketing_consent"`
+	CreatedAt        time.Time `dynamodbav:"created_at"`
+	UpdatedAt        time.Time `dynamodbav:"updated_at"`
+	Version          int64     `dynamodbav:"version"`
+}
+
+// errInvalidFile marks a file that cannot be imported at all; the import
+// fails rather than being retried.
+var errInvalidFile = errors.New("invalid import file")
+
+func main() {
+	lambda.Start(HandleUserImport)
+}
+
+// importer runs one invocation of an import.
+type importer struct {
+	imports *dynamo.Table
+	users   *dynamo.Table
+	record  userImport
+	emf     *metrics.Logger
+
+	// pending rows not yet written, and the row number of the last row
+	// read.
+	pending    []user
+	pendingRow []int
+	lastRow    int
+	// saved is the processed count last saved.
+	saved int
+}
+
+// HandleUserImport writes the users in an import's S3 object, resuming
+// after the rows an earlier invocation recorded as processed. User IDs
+// are derived from the import and row, so rows redone after a crash or
+// retry overwrite the users they created rather than duplicating them.
+// Unreadable files fail the import; other errors are returned for the
+// asynchronous invocation to retry.
+func HandleUserImport(ctx context.Context, job importJob) error {
+	emf := metrics.NewLogger(metricNamespace, map[string]string{
+		"Function":    "user-import",
+		"Environment": environment,
+	}, clk)
+	defer emf.Flush()
+
+	ctx = tenant.WithID(ctx, job.TenantID)
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dynamoClient := dynamodb.NewFromConfig(cfg)
+	imp := &importer{
+		imports: dynamo.NewTable(dynamoClient, importsTable, dynamo.WithConsistentReads(true)),
+		users:   dynamo.NewTable(dynamoClient, usersTable, dynamo.WithTenancy("id")),
+		emf:     emf,
+	}
+
+	imp.record, err = dynamo.Get[userImport](ctx, imp.imports, dynamo.StringKey("id", job.ImportID))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		log.Printf("User import %s not found, nothing to do", job.ImportID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user import %s: %w", job.ImportID, err)
+	}
+	if imp.record.Status == importSucceeded || imp.record.Status == importFailed {
+		log.Printf("User import %s already %s", job.ImportID, imp.record.Status)
+		return nil
+	}
+	imp.record.Status = importRunning
+	if err := imp.save(ctx); err != nil {
+		return err
+	}
+	log.Printf("Running user import %s of %s from row %d", imp.record.ID, imp.record.S3Key, imp.record.Processed+1)
+
+	s3Client := s3.NewFromConfig(cfg)
+	object, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(importBucket),
+		Key:    aws.String(imp.record.S3Key),
+	})
+	var noSuchKey *s3types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return imp.fail(ctx, "import file no longer exists")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", imp.record.S3Key, err)
+	}
+	defer object.Body.Close()
+
+	deadline, _ := ctx.Deadline()
+	next := csvRows
+	if imp.record.Format == "ndjson" {
+		next = ndjsonRows
+	}
+	done, err := next(object.Body, func(row int, record userRecord, rowErr validate.Errors) (bool, error) {
+		if row <= imp.record.Processed {
+			return true, nil
+		}
+		if err := imp.add(ctx, row, record, rowErr); err != nil {
+			return false, err
+		}
+		if !deadline.IsZero() && time.Until(deadline) < continueBefore {
+			return false, imp.flush(ctx)
+		}
+		return true, nil
+	})
+	if errors.Is(err, errInvalidFile) {
+		return imp.fail(ctx, err.Error())
+	}
+	if err != nil {
+		// Keep what was written so the retry resumes after it.
+		if flushErr := imp.flush(ctx); flushErr == nil {
+			imp.save(ctx)
+		}
+		return err
+	}
+	if err := imp.flush(ctx); err != nil {
+		return err
+	}
+
+	if !done {
+		if err := imp.save(ctx); err != nil {
+			return err
+		}
+		return imp.continueImport(ctx, cfg)
+	}
+
+	now := clk.Now().UTC()
+	imp.record.Status = importSucceeded
+	imp.record.CompletedAt = &now
+	if err := imp.save(ctx); err != nil {
+		return err
+	}
+	log.Printf("User import %s completed: created %d, invalid %d, failed %d of %d rows",
+		imp.record.ID, imp.record.Created, imp.record.Invalid, imp.record.Failed, imp.record.Processed)
+	return nil
+}
+
+// add queues a valid row for writing, or records why it was rejected, and
+// writes the queue once it fills a batch.
+func (imp *importer) add(ctx context.Context, row int, record userRecord, rowErr validate.Errors) error {
+	if rowErr == nil {
+		if err := validate.Struct(record); err != nil {
+			errors.As(err, &rowErr)
+		}
+	}
+	if rowErr != nil {
+		imp.record.Invalid++
+		imp.emf.Count("UserImportRowsInvalid", 1)
+		for _, fe := range rowErr {
+			if len(imp.record.Errors) < maxImportErrors {
+				imp.record.Errors = append(imp.record.Errors, importError{Row: row, Field: fe.Field, Message: fe.Message})
+			}
+		}
+	} else {
+		now := clk.Now().UTC()
+		imp.pending = append(imp.pending, user{
+			ID:               ids.Derived(imp.record.ID, strconv.Itoa(row)),
+			Email:            record.Email,
+			FirstName:        record.FirstName,
+			LastName:         record.LastName,
+			MarketingConsent: record.MarketingConsent,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+			Version:          1,
+		})
+		imp.pendingRow = append(imp.pendingRow, row)
+	}
+	imp.lastRow = row
+
+	if len(imp.pending) >= batchRows || row-imp.record.Processed >= checkpointRows {
+		return imp.flush(ctx)
+	}
+	return nil
+}
+
+// flush writes the queued rows and advances the processed count past
+// them, saving progress every checkpointRows rows. A batch that fails
+// outright is returned for a retry; rows left over from a partial write
+// are counted as failed.
+func (imp *importer) flush(ctx context.Context) error {
+	if len(imp.pending) > 0 {
+		err := dynamo.BatchPut(ctx, imp.users, imp.pending)
+		var batchErr *dynamo.BatchError
+		if err != nil && (!errors.As(err, &batchErr) || len(batchErr.Failed) == len(imp.pending)) {
+			return fmt.Errorf("failed to write users: %w", err)
+		}
+		failed := 0
+		if batchErr != nil {
+			failed = len(batchErr.Failed)
+			for _, i := range batchErr.Failed {
+				if len(imp.record.Errors) < maxImportErrors {
+					imp.record.Errors = append(imp.record.Errors, importError{
+						Row: imp.pendingRow[i], Message: "was not written; import it again",
+					})
+				}
+			}
+			log.Printf("User import %s left %d users unwritten: %v", imp.record.ID, failed, batchErr.Err)
+		}
+		imp.record.Created += len(imp.pending) - failed
+		imp.record.Failed += failed
+		imp.emf.Count("UsersImported", len(imp.pending)-failed)
+		imp.emf.Count("UserImportRowsFailed", failed)
+		imp.pending = imp.pending[:0]
+		imp.pendingRow = imp.pendingRow[:0]
+	}
+
+	if imp.lastRow > imp.record.Processed {
+		imp.record.Processed = imp.lastRow
+	}
+	if imp.record.Processed-imp.saved >= checkpointRows {
+		return imp.save(ctx)
+	}
+	return nil
+}
+
+func (imp *importer) save(ctx context.Context) error {
+	imp.record.UpdatedAt = clk.Now().UTC()
+	if err := imp.imports.Put(ctx, imp.record); err != nil {
+		return fmt.Errorf("failed to save user import %s: %w", imp.record.ID, err)
+	}
+	imp.saved = imp.record.Processed
+	return nil
+}
+
+// fail ends the import with reason. The failure is final, so the
+// invocation succeeds.
+func (imp *importer) fail(ctx context.Context, reason string) error {
+	now := clk.Now().UTC()
+	imp.record.Status = importFailed
+	imp.record.Error = reason
+	imp.record.CompletedAt = &now
+	log.Printf("User import %s failed: %s", imp.record.ID, reason)
+	imp.emf.Count("UserImportsFailed", 1)
+	return imp.save(ctx)
+}
+
+// continueImport hands the rest of the file to a fresh invocation of this
+// function before this one times out.
+func (imp *importer) continueImport(ctx context.Context, cfg aws.Config) error {
+	payload, _ := json.Marshal(importJob{ImportID: imp.record.ID, TenantID: tenant.FromContext(ctx)})
+	_, err := lambdasvc.NewFromConfig(cfg).Invoke(ctx, &lambdasvc.InvokeInput{
+		FunctionName:   aws.String(lambdacontext.FunctionName),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to continue user import %s: %w", imp.record.ID, err)
+	}
+	log.Printf("User import %s continues after row %d", imp.record.ID, imp.record.Processed)
+	return nil
+}
+
+// rowFunc receives each row, numbered from 1 after any header, with the
+// errors that kept it from being parsed. It returns false to stop reading.
+type rowFunc func(row int, record userRecord, rowErr validate.Errors) (bool, error)
+
+// csvRows reads a CSV file whose header names its columns. It reports
+// whether it read the whole file.
+func csvRows(body io.Reader, fn rowFunc) (bool, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: unreadable header: %v", errInvalidFile, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"email", "first_name", "last_name"} {
+		if _, ok := columns[required]; !ok {
+			return false, fmt.Errorf("%w: header has no %s column", errInvalidFile, required)
+		}
+	}
+	field := func(fields []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(fields) {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return true, nil
+		}
+		var record userRecord
+		var rowErr validate.Errors
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			rowErr = validate.Errors{{Rule: "csv", Message: parseErr.Err.Error()}}
+		case err != nil:
+			return false, fmt.Errorf("failed to read row %d: %w", row, err)
+		default:
+			record = userRecord{
+				Email:     field(fields, "email"),
+				FirstName: field(fields, "first_name"),
+				LastName:  field(fields, "last_name"),
+			}
+			switch strings.ToLower(field(fields, "marketing_consent")) {
+			case "true", "1", "yes":
+				record.MarketingConsent = true
+			case "", "false", "0", "no":
+			default:
+				rowErr = validate.Errors{{Field: "marketing_consent", Rule: "bool", Message: "must be true or false"}}
+			}
+		}
+		more, err := fn(row, record, rowErr)
+		if err != nil || !more {
+			return false, err
+		}
+	}
+}
+
+// ndjsonRows reads one JSON user object per line; blank lines are skipped
+// but still numbered. It reports whether it read the whole file.
+func ndjsonRows(body io.Reader, fn rowFunc) (bool, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	row := 0
+	for scanner.Scan() {
+		row++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record userRecord
+		var rowErr validate.Errors
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			rowErr = validate.Errors{{Rule: "json", Message: "must be a user object"}}
+		}
+		more, err := fn(row, record, rowErr)
+		if err != nil || !more {
+			return false, err
+		}
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return false, fmt.Errorf("%w: line %d is longer than %d bytes", errInvalidFile, row+1, maxLineBytes)
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read line %d: %w", row+1, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/metrics"
+)
+
+// metricNamespace groups the user lifecycle metrics.
+const metricNamespace = "Ecommerce/Users"
+
+// ttlAttribute is the epoch-seconds attribute user-service stamps on a
+// soft-deleted user, deleted_at plus the retention period.
+const ttlAttribute = "purge_at"
+
+var (
+	tableName   = os.Getenv("USERS_TABLE_NAME")
+	environment = os.Getenv("ENVIRONMENT")
+
+	clk = clock.FromEnv()
+
+	// ttlReady outlives an invocation so warm starts skip the TTL check.
+	ttlReady bool
+)
+
+// purgeCandidate is the part of a user item the purge needs.
+type purgeCandidate struct {
+	ID      string `dynamodbav:"id"`
+	PurgeAt int64  `dynamodbav:"purge_at"`
+}
+
+func main() {
+	lambda.Start(HandleUserPurge)
+}
+
+// HandleUserPurge runs daily and permanently deletes soft-deleted users
+// whose retention period has passed. DynamoDB's TTL sweep, which this
+// enables on purge_at, removes them too, but only within a couple of days
+// of expiry; the scheduled purge bounds the delay to one day.
+func HandleUserPurge(ctx context.Context, event interface{}) error {
+	log.Printf("Starting user purge for environment: %s", environment)
+
+	emf := metrics.NewLogger(metricNamespace, map[string]string{
+		"Function":    "user-purge",
+		"Environment": environment,
+	}, clk)
+	defer emf.Flush()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	dynamoClient := dynamodb.NewFromConfig(cfg)
+
+	if !ttlReady {
+		if err := ensureTTL(ctx, dynamoClient); err != nil {
+			return err
+		}
+		ttlReady = true
+	}
+
+	users := dynamo.NewTable(dynamoClient, tableName)
+	now := dynamo.N(strconv.FormatInt(clk.Now().Unix(), 10))
+	expired := dynamo.Condition{
+		Expression: "#purge_at <= :now",
+		Names:      map[string]string{"#purge_at": ttlAttribute},
+		Values:     map[string]types.AttributeValue{":now": now},
+	}
+
+	var purged, restored, failed int
+	err = dynamo.ScanEach(ctx, users, dynamo.Scan{
+		Filter:     expired.Expression,
+		Projection: "id, #purge_at",
+		Names:      expired.Names,
+		Values:     expired.Values,
+	}, func(page []purgeCandidate) error {
+		for _, user := range page {
+			// Re-checked on delete: a user restored since the scan has
+			// lost purge_at and is kept.
+			err := users.Delete(ctx, dynamo.StringKey("id", user.ID), expired)
+			switch {
+			case err == nil:
+				purged++
+			case errors.Is(err, dynamo.ErrConditionFailed):
+				restored++
+			default:
+				log.Printf("Failed to purge user %s: %v", user.ID, err)
+				failed++
+			}
+		}
+		return nil
+	})
+
+	emf.Count("UsersPurged", purged)
+	emf.Count("UsersPurgeSkipped", restored)
+	emf.Count("UsersPurgeFailed", failed)
+	if err != nil {
+		return fmt.Errorf("failed to scan for expired users after purging %d: %w", purged, err)
+	}
+	if failed > 0 && purged == 0 {
+		return fmt.Errorf("failed to purge all %d expired users", failed)
+	}
+
+	log.Printf("User purge completed: purged %d, skipped %d restored and failed %d", purged, restored, failed)
+	return nil
+}
+
+// ensureTTL turns on DynamoDB TTL for purge_at. The users table predates
+// this stack and is not managed by it, so the lambda owns the setting.
+func ensureTTL(ctx context.Context, client *dynamodb.Client) error {
+	described, err := client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe TTL of %s: %w", tableName, err)
+	}
+	if ttl := described.TimeToLiveDescription; ttl != nil {
+		switch ttl.TimeToLiveStatus {
+		case types.TimeToLiveStatusEnabled, types.TimeToLiveStatusEnabling:
+			if aws.ToString(ttl.AttributeName) != ttlAttribute {
+				log.Printf("Table %s expires items on %s, not %s; relying on the scheduled purge",
+					tableName, aws.ToString(ttl.AttributeName), ttlAttribute)
+			}
+			return nil
+		case types.TimeToLiveStatusDisabling:
+			// Cannot be changed until disabling finishes; try next run.
+			return nil
+		}
+	}
+
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(ttlAttribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable TTL on %s: %w", tableName, err)
+	}
+	log.Printf("Enabled TTL on %s.%s", tableName, ttlAttribute)
+	return nil
+}
@@ -0,0 +1,134 @@
+# Customer lifetime value scoring. A daily lambda scores every registered
+# customer with completed checkouts on recency, frequency and monetary value,
+# stores the score on the user as ltv and publishes tier changes to the
+# event bus, from which audience-sync maintains the high-LTV Customer Match
+# list. conversion-uploader reads the stored value multiplier when
+# ltv_conversion_values is on.
+
+resource "aws_iam_role" "ltv_scorer" {
+  name = "${var.project_name}-ltv-scorer-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-ltv-scorer-role"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "ltv_scorer" {
+  name = "${var.project_name}-ltv-scorer-policy"
+  role = aws_iam_role.ltv_scorer.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "logs:CreateLogGroup",
+          "logs:CreateLogStream",
+          "logs:PutLogEvents"
+        ]
+        Resource = "arn:aws:logs:*:*:*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:Scan",
+          "dynamodb:UpdateItem"
+        ]
+        Resource = data.aws_dynamodb_table.users.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Query"]
+        Resource = "${aws_dynamodb_table.checkouts.arn}/index/status-saved_at-index"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["events:PutEvents"]
+        Resource = aws_cloudwatch_event_bus.ecommerce.arn
+      }
+    ]
+  })
+}
+
+data "archive_file" "ltv_scorer_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/lambda/ltv-scorer"
+  output_path = "${path.module}/lambda/ltv-scorer.zip"
+}
+
+resource "aws_lambda_function" "ltv_scorer" {
+  filename         = data.archive_file.ltv_scorer_lambda.output_path
+  source_code_hash = data.archive_file.ltv_scorer_lambda.output_base64sha256
+  function_name    = "${var.project_name}-ltv-scorer"
+  role             = aws_iam_role.ltv_scorer.arn
+  handler          = "main"
+  runtime          = "go1.x"
+  timeout          = 900
+  memory_size      = 1024
+
+  environment {
+    variables = {
+      USERS_TABLE_NAME     = data.aws_dynamodb_table.users.name
+      CHECKOUTS_TABLE_NAME = aws_dynamodb_table.checkouts.name
+      EVENT_BUS_NAME       = aws_cloudwatch_event_bus.ecommerce.name
+      FX_RATES             = jsonencode(var.fx_rates)
+      ENVIRONMENT          = var.environment
+    }
+  }
+
+  tags = {
+    Name        = "${var.project_name}-ltv-scorer"
+    Environment = var.environment
+  }
+}
+
+# Daily at 03:30 UTC, after the user purge so purged users are not scored
+resource "aws_cloudwatch_event_rule" "ltv_scorer_schedule" {
+  name                = "${var.project_name}-ltv-scorer-schedule"
+  description         = "Daily customer lifetime value scoring"
+  schedule_expression = "cron(30 3 * * ? *)"
+
+  tags = {
+    Name        = "${var.project_name}-ltv-scorer-schedule"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_target" "ltv_scorer" {
+  rule      = aws_cloudwatch_event_rule.ltv_scorer_schedule.name
+  target_id = "LTVScorerTarget"
+  arn       = aws_lambda_function.ltv_scorer.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_ltv_scorer" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.ltv_scorer.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.ltv_scorer_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "ltv_scorer_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.ltv_scorer.function_name}"
+  retention_in_days = 14
+
+  tags = {
+    Name        = "${var.project_name}-ltv-scorer-logs"
+    Environment = var.environment
+  }
+}
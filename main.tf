@@ -359,11 +359,50 @@ module "google_ads" {
   kms_key_arn        = module.security.kms_key_arn
   sns_topic_arn      = module.monitoring.sns_topic_arn
   dynamodb_table_arn = module.analytics.dynamodb_table_arn
+  event_bus_name     = aws_cloudwatch_event_bus.ecommerce.name
+  users_table_name   = "users"
+
+  # Order attributions, for conversions queued without a click ID
+  attributions_table_name = aws_dynamodb_table.attributions.name
+
+  # Product catalogue, for Shopping and Performance Max item lookups
+  products_table_name = aws_dynamodb_table.products.name
+
+  # Customer Match audiences
+  cart_abandoners_list_id  = var.cart_abandoners_list_id
+  purchasers_list_id       = var.purchasers_list_id
+  registered_users_list_id = var.registered_users_list_id
+  high_ltv_list_id         = var.high_ltv_list_id
+
+  # Lookalike seed list, with phone numbers from notification preferences
+  lookalike_seed_list_id              = var.lookalike_seed_list_id
+  notification_preferences_table_name = aws_dynamodb_table.notification_preferences.name
+
+  # Value-based conversions from ltv-scorer's scores
+  ltv_conversion_values = var.ltv_conversion_values
 
   # Scheduling
   campaign_monitor_schedule = var.campaign_monitor_schedule
   bid_optimizer_schedule    = var.bid_optimizer_schedule
   optimization_interval     = var.optimization_interval
+  bid_experiment_id         = var.bid_experiment_id
+  fx_rates                  = var.fx_rates
+
+  # Cold starts of the queue and event driven functions
+  lambda_warmer_schedule         = var.lambda_warmer_schedule
+  lambda_provisioned_concurrency = var.lambda_provisioned_concurrency
+
+  # Replaces the bid optimizer's built-in performance rules
+  bid_rules = var.bid_rules_file != "" ? file(var.bid_rules_file) : ""
+
+  # PageSpeed Insights, for the landing page checker's mobile audits
+  pagespeed_api_key = var.pagespeed_api_key
+
+  # Microsoft Advertising and Meta accounts run alongside Google Ads
+  ads_platforms_config = var.ads_platforms_config
+
+  # Base of the one-click approve and reject links in bid reports
+  approval_link_base_url = var.domain_name != "" ? "https://${var.domain_name}" : "https://${module.api_gateway.api_domain_name}"
 
   tags = {
     Name = "${var.project_name}-google-ads"
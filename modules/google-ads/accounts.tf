@@ -0,0 +1,167 @@
+# Google Ads accounts onboarded through the ads-api. Only ACTIVE accounts are
+# picked up by the campaign monitor and bid optimizer.
+resource "aws_dynamodb_table" "accounts" {
+  name         = "${var.project_name}-google-ads-accounts-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-accounts"
+    }
+  )
+}
+
+# Per-account thresholds and goals
+resource "aws_dynamodb_table" "account_config" {
+  name         = "${var.project_name}-google-ads-account-config-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-account-config"
+    }
+  )
+}
+
+# Per-campaign performance baselines seeded during onboarding
+resource "aws_dynamodb_table" "baselines" {
+  name         = "${var.project_name}-google-ads-baselines-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+  range_key    = "campaign_id"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "campaign_id"
+    type = "S"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-baselines"
+    }
+  )
+}
+
+# Immutable audit trail of settings changes made through the ads-api
+resource "aws_dynamodb_table" "settings_audit" {
+  name         = "${var.project_name}-google-ads-settings-audit-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "scope"
+  range_key    = "change_id"
+
+  attribute {
+    name = "scope"
+    type = "S"
+  }
+
+  attribute {
+    name = "change_id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-settings-audit"
+    }
+  )
+}
+
+# One record per campaign-monitor and bid-optimizer run with the rule set
+# version and thresholds it applied, served by the ads-api under /runs
+resource "aws_dynamodb_table" "runs" {
+  name         = "${var.project_name}-google-ads-runs-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "function"
+  range_key    = "run_id"
+
+  attribute {
+    name = "function"
+    type = "S"
+  }
+
+  attribute {
+    name = "run_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "invocation_id"
+    type = "S"
+  }
+
+  # Finds the run a retried invocation started, by its Lambda request ID.
+  global_secondary_index {
+    name            = "invocation_id-index"
+    hash_key        = "invocation_id"
+    projection_type = "KEYS_ONLY"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-runs"
+    }
+  )
+}
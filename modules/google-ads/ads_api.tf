@@ -0,0 +1,70 @@
+# The ads-api runs on ECS under the shared task role. It onboards accounts,
+# edits their settings and seasonality events, decides approvals, serves
+# the run and bid audit trails, and writes the daily campaign metrics it
+# fetches to the analytics table.
+resource "aws_iam_role_policy" "ads_api_policy" {
+  name = "${var.project_name}-ads-api-policy"
+  role = "${var.project_name}-ecs-task-role"
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:DeleteItem",
+          "dynamodb:Query",
+          "dynamodb:Scan"
+        ]
+        Resource = [
+          aws_dynamodb_table.accounts.arn,
+          aws_dynamodb_table.account_config.arn,
+          aws_dynamodb_table.baselines.arn,
+          aws_dynamodb_table.approvals.arn,
+          "${aws_dynamodb_table.approvals.arn}/index/*",
+          aws_dynamodb_table.seasonality.arn,
+          "${aws_dynamodb_table.seasonality.arn}/index/*"
+        ]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:Query",
+          "dynamodb:Scan"
+        ]
+        Resource = [
+          aws_dynamodb_table.runs.arn,
+          "${aws_dynamodb_table.runs.arn}/index/*",
+          aws_dynamodb_table.bid_audit.arn,
+          "${aws_dynamodb_table.bid_audit.arn}/index/*"
+        ]
+      },
+      {
+        # Settings changes are only ever appended
+        Effect = "Allow"
+        Action = [
+          "dynamodb:PutItem",
+          "dynamodb:Query"
+        ]
+        Resource = [aws_dynamodb_table.settings_audit.arn]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchWriteItem"]
+        Resource = [var.dynamodb_table_arn]
+      },
+      {
+        Effect = "Allow"
+        Action = ["secretsmanager:GetSecretValue"]
+        Resource = [
+          aws_secretsmanager_secret.google_ads_credentials.arn,
+          aws_secretsmanager_secret.approval_signing_key.arn
+        ]
+      }
+    ]
+  })
+}
@@ -0,0 +1,186 @@
+# Keyword bid changes from the bid optimizer, held for a person to approve
+# when their estimated daily spend impact reaches approval_min_impact and
+# approved on the spot otherwise. The ads-api lists and decides them under
+# /approvals; bid_applier applies the approved ones. status-index lists one
+# status oldest first, approval IDs being time-ordered.
+locals {
+  approval_min_impact   = "25"
+  approval_window_hours = "48"
+}
+
+resource "aws_dynamodb_table" "approvals" {
+  name         = "${var.project_name}-google-ads-approvals-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "approval_id"
+
+  attribute {
+    name = "approval_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "status-index"
+    hash_key        = "status"
+    range_key       = "approval_id"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-approvals"
+    }
+  )
+}
+
+# Key for the one-click approve and reject links in Slack and email
+# reports. Rotating it invalidates the links already sent.
+resource "random_password" "approval_signing_key" {
+  length  = 64
+  special = false
+}
+
+resource "aws_secretsmanager_secret" "approval_signing_key" {
+  name                    = "${var.project_name}/google-ads/approval-signing-key"
+  description             = "Signs one-click bid approval links"
+  recovery_window_in_days = 0
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-approval-signing-key"
+    }
+  )
+}
+
+resource "aws_secretsmanager_secret_version" "approval_signing_key" {
+  secret_id     = aws_secretsmanager_secret.approval_signing_key.id
+  secret_string = random_password.approval_signing_key.result
+}
+
+data "archive_file" "bid_applier_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/bid-applier"
+  output_path = "${path.module}/../../lambda/bid-applier.zip"
+}
+
+resource "aws_lambda_function" "bid_applier" {
+  filename         = data.archive_file.bid_applier_lambda.output_path
+  function_name    = "${var.project_name}-bid-applier"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 300
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN    = aws_secretsmanager_secret.google_ads_credentials.arn
+      ADS_PLATFORMS_SECRET_ARN = aws_secretsmanager_secret.ads_platforms.arn
+      APPROVALS_TABLE_NAME     = aws_dynamodb_table.approvals.name
+      BID_AUDIT_TABLE_NAME     = aws_dynamodb_table.bid_audit.name
+      EVENT_BUS_NAME           = var.event_bus_name
+      BID_APPLY                = "false"
+      ENVIRONMENT              = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-bid-applier"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "approvals_policy" {
+  name = "${var.project_name}-approvals-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:Query"
+        ]
+        Resource = [
+          aws_dynamodb_table.approvals.arn,
+          "${aws_dynamodb_table.approvals.arn}/index/status-index"
+        ]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "secretsmanager:GetSecretValue"
+        ]
+        Resource = aws_secretsmanager_secret.approval_signing_key.arn
+      }
+    ]
+  })
+}
+
+# Every 15 minutes, so approved changes reach Google Ads soon after the
+# decision
+resource "aws_cloudwatch_event_rule" "bid_applier_schedule" {
+  name                = "${var.project_name}-bid-applier-schedule"
+  description         = "Apply approved bid changes and expire undecided ones"
+  schedule_expression = "rate(15 minutes)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-bid-applier-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "bid_applier_target" {
+  rule      = aws_cloudwatch_event_rule.bid_applier_schedule.name
+  target_id = "BidApplierTarget"
+  arn       = aws_lambda_function.bid_applier.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_bid_applier" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.bid_applier.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.bid_applier_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "bid_applier_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.bid_applier.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-bid-applier-logs"
+    }
+  )
+}
@@ -0,0 +1,111 @@
+# Weekly competitor digest from Google Ads auction insights. Each account's
+# week is stored in the reports bucket, where the next run reads it back to
+# find new competitors and significant shifts.
+data "archive_file" "auction_insights_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/auction-insights"
+  output_path = "${path.module}/../../lambda/auction-insights.zip"
+}
+
+resource "aws_lambda_function" "auction_insights" {
+  filename         = data.archive_file.auction_insights_lambda.output_path
+  function_name    = "${var.project_name}-auction-insights"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 300
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN  = aws_secretsmanager_secret.google_ads_credentials.arn
+      ACCOUNTS_TABLE_NAME    = aws_dynamodb_table.accounts.name
+      REPORTS_BUCKET         = replace(var.reports_bucket_arn, "arn:aws:s3:::", "")
+      SNS_TOPIC_ARN          = var.sns_topic_arn
+      COMPETITOR_MIN_OVERLAP = "0.05"
+      COMPETITOR_SHIFT       = "0.10"
+      ENVIRONMENT            = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-auction-insights"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "auction_insights_policy" {
+  name = "${var.project_name}-auction-insights-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:GetObject",
+          "s3:PutObject"
+        ]
+        Resource = "${var.reports_bucket_arn}/auction_insights/*"
+      },
+      {
+        # Without ListBucket a missing previous week reads as access
+        # denied rather than not found.
+        Effect   = "Allow"
+        Action   = ["s3:ListBucket"]
+        Resource = var.reports_bucket_arn
+        Condition = {
+          StringLike = {
+            "s3:prefix" = ["auction_insights/*"]
+          }
+        }
+      }
+    ]
+  })
+}
+
+# Mondays 07:00 UTC, once the previous week is complete
+resource "aws_cloudwatch_event_rule" "auction_insights_schedule" {
+  name                = "${var.project_name}-auction-insights-schedule"
+  description         = "Weekly competitor auction insights digest"
+  schedule_expression = "cron(0 7 ? * MON *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-auction-insights-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "auction_insights_target" {
+  rule      = aws_cloudwatch_event_rule.auction_insights_schedule.name
+  target_id = "AuctionInsightsTarget"
+  arn       = aws_lambda_function.auction_insights.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_auction_insights" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.auction_insights.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.auction_insights_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "auction_insights_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.auction_insights.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-auction-insights-logs"
+    }
+  )
+}
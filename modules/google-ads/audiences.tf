@@ -0,0 +1,207 @@
+# Customer Match audience sync. Cart, order and sign-up events on the
+# platform event bus move users in and out of remarketing lists; membership
+# state is tracked per user and list so removals and expiry can be replayed
+# safely.
+resource "aws_dynamodb_table" "audience_memberships" {
+  name         = "${var.project_name}-google-ads-audience-memberships-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "user_id"
+  range_key    = "list_key"
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "list_key"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  attribute {
+    name = "membership_ends_at"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "status-membership_ends_index"
+    hash_key        = "status"
+    range_key       = "membership_ends_at"
+    projection_type = "ALL"
+  }
+
+  # Removed memberships are purged after the audit retention period
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-audience-memberships"
+    }
+  )
+}
+
+data "archive_file" "audience_sync_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/audience-sync"
+  output_path = "${path.module}/../../lambda/audience-sync.zip"
+}
+
+resource "aws_lambda_function" "audience_sync" {
+  filename         = data.archive_file.audience_sync_lambda.output_path
+  function_name    = "${var.project_name}-audience-sync"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 300
+  publish         = local.provisioned_concurrency
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN    = aws_secretsmanager_secret.google_ads_credentials.arn
+      GOOGLE_ADS_CUSTOMER_ID   = var.google_ads_customer_id
+      CART_ABANDONERS_LIST_ID  = var.cart_abandoners_list_id
+      PURCHASERS_LIST_ID       = var.purchasers_list_id
+      REGISTERED_USERS_LIST_ID = var.registered_users_list_id
+      HIGH_LTV_LIST_ID         = var.high_ltv_list_id
+      USERS_TABLE_NAME         = var.users_table_name
+      MEMBERSHIPS_TABLE_NAME   = aws_dynamodb_table.audience_memberships.name
+      ENVIRONMENT              = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-audience-sync"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+data "aws_dynamodb_table" "users" {
+  name = var.users_table_name
+}
+
+resource "aws_iam_role_policy" "audience_sync_policy" {
+  name = "${var.project_name}-audience-sync-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem"]
+        Resource = [data.aws_dynamodb_table.users.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:Query"
+        ]
+        Resource = [
+          aws_dynamodb_table.audience_memberships.arn,
+          "${aws_dynamodb_table.audience_memberships.arn}/index/*"
+        ]
+      }
+    ]
+  })
+}
+
+resource "aws_cloudwatch_event_rule" "audience_events" {
+  name           = "${var.project_name}-audience-events"
+  description    = "Cart, order, consent and LTV tier events that change audience membership"
+  event_bus_name = var.event_bus_name
+
+  event_pattern = jsonencode({
+    source        = ["ecommerce.cart-service", "ecommerce.order-service", "ecommerce.user-service", "ecommerce.ltv-scorer"]
+    "detail-type" = ["Cart Abandoned", "Order Completed", "User Registered", "User Consent Changed", "Customer LTV Tier Changed"]
+  })
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-audience-events"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "audience_sync_target" {
+  rule           = aws_cloudwatch_event_rule.audience_events.name
+  event_bus_name = var.event_bus_name
+  target_id      = "AudienceSyncTarget"
+  arn            = local.warmed_function_arns["audience_sync"]
+}
+
+resource "aws_lambda_permission" "allow_eventbridge_audience_sync" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.audience_sync.function_name
+  qualifier     = local.warmed_qualifier
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.audience_events.arn
+}
+
+# Daily expiry and consent re-check
+resource "aws_cloudwatch_event_rule" "audience_sync_schedule" {
+  name                = "${var.project_name}-audience-sync-schedule"
+  description         = "Daily audience membership expiry"
+  schedule_expression = "cron(0 3 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-audience-sync-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "audience_sync_schedule_target" {
+  rule      = aws_cloudwatch_event_rule.audience_sync_schedule.name
+  target_id = "AudienceSyncScheduleTarget"
+  arn       = local.warmed_function_arns["audience_sync"]
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_audience_sync" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.audience_sync.function_name
+  qualifier     = local.warmed_qualifier
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.audience_sync_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "audience_sync_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.audience_sync.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-audience-sync-logs"
+    }
+  )
+}
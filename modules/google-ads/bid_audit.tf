@@ -0,0 +1,73 @@
+# Append-only log of the bid changes applied to ad platforms: keyword bids
+# from bid_applier, ad schedules and budget reallocations from the bid
+# optimizer. The ads-api reads it under /audit/bid-changes, and
+# bid_applier's rollback mode reads it to revert bids. The functions may
+# only add and read records, and records never expire, so the log holds up
+# in client reporting and incident review. campaign-index lists one
+# campaign's changes by time.
+resource "aws_dynamodb_table" "bid_audit" {
+  name         = "${var.project_name}-google-ads-bid-audit-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+  range_key    = "change_id"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "change_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "campaign_key"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "campaign-index"
+    hash_key        = "campaign_key"
+    range_key       = "change_id"
+    projection_type = "ALL"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-bid-audit"
+    }
+  )
+}
+
+resource "aws_iam_role_policy" "bid_audit_policy" {
+  name = "${var.project_name}-bid-audit-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:PutItem",
+          "dynamodb:Query",
+          "dynamodb:Scan"
+        ]
+        Resource = [
+          aws_dynamodb_table.bid_audit.arn,
+          "${aws_dynamodb_table.bid_audit.arn}/index/campaign-index"
+        ]
+      }
+    ]
+  })
+}
@@ -0,0 +1,28 @@
+# Spreadsheet exports of bid recommendations. Each bid report's
+# recommendations are written as CSV and XLSX under bid_exports/ in the
+# reports bucket, and the report carries presigned download links so
+# account managers can review them without AWS access.
+locals {
+  bid_export_formats        = "csv,xlsx"
+  bid_export_link_ttl_hours = "72"
+}
+
+resource "aws_iam_role_policy" "bid_exports_policy" {
+  name = "${var.project_name}-bid-exports-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  # GetObject lets the presigned links, signed with this role, download.
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject",
+          "s3:GetObject"
+        ]
+        Resource = "${var.reports_bucket_arn}/bid_exports/*"
+      }
+    ]
+  })
+}
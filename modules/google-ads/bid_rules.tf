@@ -0,0 +1,35 @@
+# Bid rules document. The bid optimizer's performance rules are a
+# declarative document, built into the function; when bid_rules is set it is
+# uploaded here instead, and the dispatcher and worker read it at the start
+# of every invocation. A document that fails validation fails the run.
+locals {
+  bid_rules_key    = "config/bid_rules.yaml"
+  bid_rules_s3_uri = var.bid_rules != "" ? "s3://${replace(var.reports_bucket_arn, "arn:aws:s3:::", "")}/${local.bid_rules_key}" : ""
+}
+
+resource "aws_s3_object" "bid_rules" {
+  count = var.bid_rules != "" ? 1 : 0
+
+  bucket       = replace(var.reports_bucket_arn, "arn:aws:s3:::", "")
+  key          = local.bid_rules_key
+  content      = var.bid_rules
+  content_type = "application/yaml"
+
+  tags = var.tags
+}
+
+resource "aws_iam_role_policy" "bid_rules_policy" {
+  name = "${var.project_name}-bid-rules-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "${var.reports_bucket_arn}/${local.bid_rules_key}"
+      }
+    ]
+  })
+}
@@ -0,0 +1,100 @@
+# Daily ingestion of account budget orders and invoices for the finance
+# dashboards, with alerts on budget orders that are running out.
+data "archive_file" "account_billing_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/account-billing"
+  output_path = "${path.module}/../../lambda/account-billing.zip"
+}
+
+resource "aws_lambda_function" "account_billing" {
+  filename         = data.archive_file.account_billing_lambda.output_path
+  function_name    = "${var.project_name}-account-billing"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 300
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN        = aws_secretsmanager_secret.google_ads_credentials.arn
+      ACCOUNTS_TABLE_NAME          = aws_dynamodb_table.accounts.name
+      REPORTS_BUCKET               = replace(var.reports_bucket_arn, "arn:aws:s3:::", "")
+      SNS_TOPIC_ARN                = var.sns_topic_arn
+      BUDGET_ORDER_ALERT_THRESHOLD = "0.9"
+      BUDGET_ORDER_ALERT_DAYS      = "7"
+      ENVIRONMENT                  = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-account-billing"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "account_billing_policy" {
+  name = "${var.project_name}-account-billing-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject"
+        ]
+        Resource = [
+          "${var.reports_bucket_arn}/account_budgets/*",
+          "${var.reports_bucket_arn}/invoices/*"
+        ]
+      }
+    ]
+  })
+}
+
+# 06:00 UTC, after Google Ads has settled the previous day's serving
+resource "aws_cloudwatch_event_rule" "account_billing_schedule" {
+  name                = "${var.project_name}-account-billing-schedule"
+  description         = "Daily budget order and invoice ingestion"
+  schedule_expression = "cron(0 6 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-account-billing-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "account_billing_target" {
+  rule      = aws_cloudwatch_event_rule.account_billing_schedule.name
+  target_id = "AccountBillingTarget"
+  arn       = aws_lambda_function.account_billing.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_account_billing" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.account_billing.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.account_billing_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "account_billing_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.account_billing.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-account-billing-logs"
+    }
+  )
+}
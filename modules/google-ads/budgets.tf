@@ -0,0 +1,32 @@
+# Daily budget reallocation run of the bid optimizer. Budgets move once a
+# day rather than on every optimization run so each move has a day of
+# spend behind it; per-campaign bounds come from the account config's
+# budget_constraints section, read through organic_overlap_policy's
+# GetItem grant on the shared role.
+resource "aws_cloudwatch_event_rule" "bid_optimizer_budgets_schedule" {
+  name                = "${var.project_name}-bid-optimizer-budgets-schedule"
+  description         = "Daily budget reallocation across campaigns"
+  schedule_expression = "cron(0 6 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-bid-optimizer-budgets-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "bid_optimizer_budgets_target" {
+  rule      = aws_cloudwatch_event_rule.bid_optimizer_budgets_schedule.name
+  target_id = "BidOptimizerBudgetsTarget"
+  arn       = aws_lambda_function.bid_optimizer.arn
+  input     = jsonencode({ mode = "budgets" })
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_bid_optimizer_budgets" {
+  statement_id  = "AllowExecutionFromCloudWatchBudgets"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.bid_optimizer.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.bid_optimizer_budgets_schedule.arn
+}
@@ -0,0 +1,441 @@
+# Offline conversion upload with order-level deduplication. Order events are
+# queued on SQS; every upload is recorded in the uploads table so an order is
+# never sent to Google Ads twice.
+resource "aws_sqs_queue" "conversions_dlq" {
+  name                      = "${var.project_name}-google-ads-conversions-dlq-${var.environment}"
+  message_retention_seconds = 1209600
+  kms_master_key_id         = var.kms_key_arn
+
+  tags = var.tags
+}
+
+resource "aws_sqs_queue" "conversions" {
+  name                       = "${var.project_name}-google-ads-conversions-${var.environment}"
+  visibility_timeout_seconds = 360
+  kms_master_key_id          = var.kms_key_arn
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.conversions_dlq.arn
+    maxReceiveCount     = 5
+  })
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-conversions"
+    }
+  )
+}
+
+# One record per uploaded order ID (authoritative dedup store)
+resource "aws_dynamodb_table" "conversion_uploads" {
+  name         = "${var.project_name}-google-ads-conversion-uploads-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "order_id"
+
+  attribute {
+    name = "order_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-conversion-uploads"
+    }
+  )
+}
+
+# Duplicates detected per day, read by the reconciliation report
+resource "aws_dynamodb_table" "conversion_duplicates" {
+  name         = "${var.project_name}-google-ads-conversion-duplicates-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "date"
+  range_key    = "detected_id"
+
+  attribute {
+    name = "date"
+    type = "S"
+  }
+
+  attribute {
+    name = "detected_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-conversion-duplicates"
+    }
+  )
+}
+
+# Attributed order revenue, joined with Google Ads cost by the bid optimizer
+# to bid on ROAS
+resource "aws_dynamodb_table" "order_revenue" {
+  name         = "${var.project_name}-google-ads-order-revenue-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+  range_key    = "order_key"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "order_key"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-order-revenue"
+    }
+  )
+}
+
+data "archive_file" "conversion_uploader_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/conversion-uploader"
+  output_path = "${path.module}/../../lambda/conversion-uploader.zip"
+}
+
+resource "aws_lambda_function" "conversion_uploader" {
+  filename         = data.archive_file.conversion_uploader_lambda.output_path
+  function_name    = "${var.project_name}-conversion-uploader"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 300
+  publish         = local.provisioned_concurrency
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN    = aws_secretsmanager_secret.google_ads_credentials.arn
+      GOOGLE_ADS_CUSTOMER_ID   = var.google_ads_customer_id
+      CONVERSION_ACTION_ID     = var.conversion_action_id
+      UPLOADS_TABLE_NAME       = aws_dynamodb_table.conversion_uploads.name
+      DUPLICATES_TABLE_NAME    = aws_dynamodb_table.conversion_duplicates.name
+      ORDER_REVENUE_TABLE_NAME = aws_dynamodb_table.order_revenue.name
+      ATTRIBUTIONS_TABLE_NAME  = var.attributions_table_name
+      SNS_TOPIC_ARN            = var.sns_topic_arn
+      MESSAGE_KMS_KEY_ID       = var.kms_key_arn
+      USERS_TABLE_NAME         = var.users_table_name
+      LTV_CONVERSION_VALUES    = tostring(var.ltv_conversion_values)
+      ENVIRONMENT              = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-conversion-uploader"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "conversion_uploader_policy" {
+  name = "${var.project_name}-conversion-uploader-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:GetQueueAttributes"
+        ]
+        Resource = [aws_sqs_queue.conversions.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:DeleteItem",
+          "dynamodb:Query"
+        ]
+        Resource = [
+          aws_dynamodb_table.conversion_uploads.arn,
+          aws_dynamodb_table.conversion_duplicates.arn,
+          aws_dynamodb_table.order_revenue.arn
+        ]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem"]
+        Resource = [data.aws_dynamodb_table.attributions.arn]
+      }
+    ]
+  })
+}
+
+# attribution-service's order attributions, which complete conversions
+# queued without a click ID.
+data "aws_dynamodb_table" "attributions" {
+  name = var.attributions_table_name
+}
+
+resource "aws_lambda_event_source_mapping" "conversion_uploader" {
+  event_source_arn                   = aws_sqs_queue.conversions.arn
+  function_name                      = local.warmed_function_arns["conversion_uploader"]
+  batch_size                         = 100
+  maximum_batching_window_in_seconds = 60
+}
+
+# Daily duplicate reconciliation report
+resource "aws_cloudwatch_event_rule" "conversion_reconciliation_schedule" {
+  name                = "${var.project_name}-conversion-reconciliation-schedule"
+  description         = "Daily conversion dedup reconciliation report"
+  schedule_expression = "cron(0 6 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-conversion-reconciliation-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "conversion_reconciliation_target" {
+  rule      = aws_cloudwatch_event_rule.conversion_reconciliation_schedule.name
+  target_id = "ConversionReconciliationTarget"
+  arn       = local.warmed_function_arns["conversion_uploader"]
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_conversion_reconciliation" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.conversion_uploader.function_name
+  qualifier     = local.warmed_qualifier
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.conversion_reconciliation_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "conversion_uploader_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.conversion_uploader.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-conversion-uploader-logs"
+    }
+  )
+}
+
+# Conversion adjustments for refunded orders. payment-service's refund
+# events are queued for conversion-adjuster, which retracts the conversion
+# of a fully refunded order and restates the value of a partially refunded
+# one, so ROAS counts only the revenue the order kept.
+resource "aws_sqs_queue" "conversion_adjustments_dlq" {
+  name                      = "${var.project_name}-google-ads-conversion-adjustments-dlq-${var.environment}"
+  message_retention_seconds = 1209600
+  sqs_managed_sse_enabled   = true
+
+  tags = var.tags
+}
+
+# Google Ads rejects adjustments for a conversion it is still processing;
+# those are retried each visibility timeout until the dead-letter queue.
+# EventBridge delivers to it, so it is encrypted with the SQS managed key
+# rather than the message key.
+resource "aws_sqs_queue" "conversion_adjustments" {
+  name                       = "${var.project_name}-google-ads-conversion-adjustments-${var.environment}"
+  visibility_timeout_seconds = 3600
+  message_retention_seconds  = 345600
+  sqs_managed_sse_enabled    = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.conversion_adjustments_dlq.arn
+    maxReceiveCount     = 12
+  })
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-conversion-adjustments"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_rule" "payment_refunds" {
+  name           = "${var.project_name}-payment-refunds"
+  description    = "Refunded payments whose conversions are adjusted in Google Ads"
+  event_bus_name = var.event_bus_name
+
+  event_pattern = jsonencode({
+    source        = ["ecommerce.payment-service"]
+    "detail-type" = ["Payment Refunded", "Payment Partially Refunded"]
+  })
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-payment-refunds"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "conversion_adjustments_target" {
+  rule           = aws_cloudwatch_event_rule.payment_refunds.name
+  event_bus_name = var.event_bus_name
+  target_id      = "ConversionAdjustments"
+  arn            = aws_sqs_queue.conversion_adjustments.arn
+}
+
+resource "aws_sqs_queue_policy" "conversion_adjustments" {
+  queue_url = aws_sqs_queue.conversion_adjustments.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = "events.amazonaws.com" }
+        Action    = "sqs:SendMessage"
+        Resource  = aws_sqs_queue.conversion_adjustments.arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = aws_cloudwatch_event_rule.payment_refunds.arn
+          }
+        }
+      }
+    ]
+  })
+}
+
+data "archive_file" "conversion_adjuster_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/conversion-adjuster"
+  output_path = "${path.module}/../../lambda/conversion-adjuster.zip"
+}
+
+resource "aws_lambda_function" "conversion_adjuster" {
+  filename         = data.archive_file.conversion_adjuster_lambda.output_path
+  source_code_hash = data.archive_file.conversion_adjuster_lambda.output_base64sha256
+  function_name    = "${var.project_name}-conversion-adjuster"
+  role             = aws_iam_role.google_ads_lambda_role.arn
+  handler          = "main"
+  runtime          = "go1.x"
+  timeout          = 120
+  publish          = local.provisioned_concurrency
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN    = aws_secretsmanager_secret.google_ads_credentials.arn
+      CONVERSION_ACTION_ID     = var.conversion_action_id
+      UPLOADS_TABLE_NAME       = aws_dynamodb_table.conversion_uploads.name
+      ORDER_REVENUE_TABLE_NAME = aws_dynamodb_table.order_revenue.name
+      ENVIRONMENT              = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-conversion-adjuster"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "conversion_adjuster_policy" {
+  name = "${var.project_name}-conversion-adjuster-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:GetQueueAttributes"
+        ]
+        Resource = [aws_sqs_queue.conversion_adjustments.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:UpdateItem"
+        ]
+        Resource = [
+          aws_dynamodb_table.conversion_uploads.arn,
+          aws_dynamodb_table.order_revenue.arn
+        ]
+      }
+    ]
+  })
+}
+
+resource "aws_lambda_event_source_mapping" "conversion_adjuster" {
+  event_source_arn                   = aws_sqs_queue.conversion_adjustments.arn
+  function_name                      = local.warmed_function_arns["conversion_adjuster"]
+  batch_size                         = 50
+  maximum_batching_window_in_seconds = 60
+  function_response_types            = ["ReportBatchItemFailures"]
+}
+
+resource "aws_cloudwatch_log_group" "conversion_adjuster_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.conversion_adjuster.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-conversion-adjuster-logs"
+    }
+  )
+}
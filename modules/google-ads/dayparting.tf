@@ -0,0 +1,29 @@
+# Latest ad schedule (dayparting) recommendation per campaign from the bid
+# optimizer, with whether it was applied
+resource "aws_dynamodb_table" "ad_schedules" {
+  name         = "${var.project_name}-google-ads-ad-schedules-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+  range_key    = "campaign_id"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "campaign_id"
+    type = "S"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-ad-schedules"
+    }
+  )
+}
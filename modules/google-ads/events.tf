@@ -0,0 +1,21 @@
+# Domain events the Google Ads functions put on the platform bus:
+# campaign-monitor announces each alert ("Campaign Alert Raised") and
+# bid-applier each applied bid ("Bid Applied"). See pkg/events.
+
+data "aws_region" "current" {}
+
+resource "aws_iam_role_policy" "domain_events" {
+  name = "${var.project_name}-google-ads-domain-events"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["events:PutEvents"]
+        Resource = "arn:aws:events:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:event-bus/${var.event_bus_name}"
+      }
+    ]
+  })
+}
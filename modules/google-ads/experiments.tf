@@ -0,0 +1,96 @@
+# Bid strategy experiments. While bid_experiment_id is set, the bid
+# optimizer splits campaigns into treatment and control cohorts, keeps each
+# campaign's cohort here for the life of the experiment, and only applies
+# its changes to treatment. Every Monday it compares the cohorts and writes
+# the report under experiments/ in the reports bucket.
+locals {
+  experiment_treatment_share = "0.5"
+}
+
+resource "aws_dynamodb_table" "experiments" {
+  name         = "${var.project_name}-google-ads-experiments-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "experiment_id"
+  range_key    = "campaign_key"
+
+  attribute {
+    name = "experiment_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "campaign_key"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-experiments"
+    }
+  )
+}
+
+resource "aws_iam_role_policy" "experiments_policy" {
+  name = "${var.project_name}-experiments-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem",
+          "dynamodb:Query"
+        ]
+        Resource = aws_dynamodb_table.experiments.arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject"
+        ]
+        Resource = "${var.reports_bucket_arn}/experiments/*"
+      }
+    ]
+  })
+}
+
+# Mondays 08:00 UTC, comparing the cohorts through Sunday
+resource "aws_cloudwatch_event_rule" "bid_optimizer_experiment_schedule" {
+  name                = "${var.project_name}-bid-optimizer-experiment-schedule"
+  description         = "Weekly bid strategy experiment report"
+  schedule_expression = "cron(0 8 ? * MON *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-bid-optimizer-experiment-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "bid_optimizer_experiment_target" {
+  rule      = aws_cloudwatch_event_rule.bid_optimizer_experiment_schedule.name
+  target_id = "BidOptimizerExperimentTarget"
+  arn       = aws_lambda_function.bid_optimizer.arn
+  input     = jsonencode({ mode = "experiment_report" })
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_bid_optimizer_experiment" {
+  statement_id  = "AllowExecutionFromCloudWatchExperiment"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.bid_optimizer.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.bid_optimizer_experiment_schedule.arn
+}
@@ -0,0 +1,160 @@
+# Per-account fan-out for the bid optimizer. The scheduled bid_optimizer
+# function queues one message per account; bid_optimizer_worker optimizes
+# each account in its own invocation, so a large account cannot run the
+# whole rotation out of time. An account that fails on every receive is
+# moved to the dead-letter queue and recorded as failed on the run.
+locals {
+  bid_optimizer_worker_timeout      = 900
+  bid_optimizer_account_max_receive = 3
+
+  # Shared by the dispatcher and the worker: both compute the run's config
+  # snapshot, so the flags and goals must match.
+  bid_optimizer_environment = {
+    GOOGLE_ADS_SECRET_ARN                = aws_secretsmanager_secret.google_ads_credentials.arn
+    ADS_PLATFORMS_SECRET_ARN             = aws_secretsmanager_secret.ads_platforms.arn
+    SNS_TOPIC_ARN                        = var.sns_topic_arn
+    ENVIRONMENT                          = var.environment
+    RUNS_TABLE_NAME                      = aws_dynamodb_table.runs.name
+    FAILURES_QUEUE_URL                   = aws_sqs_queue.run_failures.url
+    AD_SCHEDULE_TABLE_NAME               = aws_dynamodb_table.ad_schedules.name
+    AD_SCHEDULE_APPLY                    = "false"
+    ORDER_REVENUE_TABLE_NAME             = aws_dynamodb_table.order_revenue.name
+    TARGET_ROAS                          = "4.0"
+    ACCOUNT_CONFIG_TABLE_NAME            = aws_dynamodb_table.account_config.name
+    BUDGET_REALLOCATION_APPLY            = "false"
+    APPROVALS_TABLE_NAME                 = aws_dynamodb_table.approvals.name
+    APPROVAL_MIN_IMPACT                  = local.approval_min_impact
+    APPROVAL_WINDOW_HOURS                = local.approval_window_hours
+    APPROVAL_SIGNING_SECRET_ARN          = aws_secretsmanager_secret.approval_signing_key.arn
+    APPROVAL_LINK_BASE_URL               = var.approval_link_base_url
+    BID_AUDIT_TABLE_NAME                 = aws_dynamodb_table.bid_audit.name
+    EXPERIMENT_ID                        = var.bid_experiment_id
+    EXPERIMENTS_TABLE_NAME               = aws_dynamodb_table.experiments.name
+    EXPERIMENT_TREATMENT_SHARE           = local.experiment_treatment_share
+    EXPERIMENT_REPORTS_BUCKET            = replace(var.reports_bucket_arn, "arn:aws:s3:::", "")
+    BID_EXPORTS_BUCKET                   = replace(var.reports_bucket_arn, "arn:aws:s3:::", "")
+    BID_EXPORT_FORMATS                   = local.bid_export_formats
+    BID_EXPORT_LINK_TTL_HOURS            = local.bid_export_link_ttl_hours
+    FX_RATES                             = jsonencode(var.fx_rates)
+    BID_RULES_S3_URI                     = local.bid_rules_s3_uri
+    BID_GUARDRAIL_MIN_BID                = "0.10"
+    BID_GUARDRAIL_MAX_BID                = "50"
+    BID_GUARDRAIL_MAX_DAILY_CHANGE       = "0.5"
+    BID_GUARDRAIL_MAX_CHANGES_PER_RUN    = "200"
+    BID_GUARDRAIL_MAX_DAILY_SPEND_IMPACT = "500"
+    SEASONALITY_TABLE_NAME               = aws_dynamodb_table.seasonality.name
+    SEASONALITY_LEAD_DAYS                = "7"
+    PRODUCTS_TABLE_NAME                  = var.products_table_name
+    GOOGLE_ADS_RETRY_MAX_ATTEMPTS        = "5"
+    GOOGLE_ADS_MAX_QPS                   = "10"
+    ACCOUNT_CONCURRENCY                  = "4"
+  }
+}
+
+resource "aws_sqs_queue" "bid_optimizer_accounts_dlq" {
+  name                      = "${var.project_name}-google-ads-bid-optimizer-accounts-dlq-${var.environment}"
+  message_retention_seconds = 1209600
+  kms_master_key_id         = var.kms_key_arn
+
+  tags = var.tags
+}
+
+resource "aws_sqs_queue" "bid_optimizer_accounts" {
+  name = "${var.project_name}-google-ads-bid-optimizer-accounts-${var.environment}"
+  # AWS recommends six times the function timeout for SQS event sources.
+  visibility_timeout_seconds = local.bid_optimizer_worker_timeout * 6
+  message_retention_seconds  = 86400
+  kms_master_key_id          = var.kms_key_arn
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.bid_optimizer_accounts_dlq.arn
+    maxReceiveCount     = local.bid_optimizer_account_max_receive
+  })
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-bid-optimizer-accounts"
+    }
+  )
+}
+
+resource "aws_lambda_function" "bid_optimizer_worker" {
+  filename         = data.archive_file.bid_optimizer_lambda.output_path
+  function_name    = "${var.project_name}-bid-optimizer-worker"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = local.bid_optimizer_worker_timeout
+  publish         = local.provisioned_concurrency
+
+  environment {
+    variables = merge(local.bid_optimizer_environment, {
+      ACCOUNT_MAX_RECEIVE_COUNT = tostring(local.bid_optimizer_account_max_receive)
+    })
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-bid-optimizer-worker"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "bid_optimizer_fanout_policy" {
+  name = "${var.project_name}-bid-optimizer-fanout-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:SendMessage",
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:GetQueueAttributes"
+        ]
+        Resource = [aws_sqs_queue.bid_optimizer_accounts.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:UpdateItem"
+        ]
+        Resource = [aws_dynamodb_table.runs.arn]
+      }
+    ]
+  })
+}
+
+# One account per invocation, so each gets the full timeout. Concurrency is
+# capped to stay within the Google Ads API rate limits.
+resource "aws_lambda_event_source_mapping" "bid_optimizer_worker" {
+  event_source_arn        = aws_sqs_queue.bid_optimizer_accounts.arn
+  function_name           = local.warmed_function_arns["bid_optimizer_worker"]
+  batch_size              = 1
+  function_response_types = ["ReportBatchItemFailures"]
+
+  scaling_config {
+    maximum_concurrency = 5
+  }
+}
+
+resource "aws_cloudwatch_log_group" "bid_optimizer_worker_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.bid_optimizer_worker.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-bid-optimizer-worker-logs"
+    }
+  )
+}
@@ -0,0 +1,128 @@
+# Weekly account hygiene audit. Scores are kept per account and week so the
+# weekly digest can show the trend.
+resource "aws_dynamodb_table" "hygiene_scores" {
+  name         = "${var.project_name}-google-ads-hygiene-scores-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+  range_key    = "week_start"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "week_start"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-hygiene-scores"
+    }
+  )
+}
+
+data "archive_file" "account_hygiene_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/account-hygiene"
+  output_path = "${path.module}/../../lambda/account-hygiene.zip"
+}
+
+resource "aws_lambda_function" "account_hygiene" {
+  filename         = data.archive_file.account_hygiene_lambda.output_path
+  function_name    = "${var.project_name}-account-hygiene"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 600
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN = aws_secretsmanager_secret.google_ads_credentials.arn
+      SNS_TOPIC_ARN         = var.sns_topic_arn
+      ENVIRONMENT           = var.environment
+      ACCOUNTS_TABLE_NAME   = aws_dynamodb_table.accounts.name
+      HYGIENE_TABLE_NAME    = aws_dynamodb_table.hygiene_scores.name
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-account-hygiene"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "account_hygiene_policy" {
+  name = "${var.project_name}-account-hygiene-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:Query",
+          "dynamodb:PutItem"
+        ]
+        Resource = [aws_dynamodb_table.hygiene_scores.arn]
+      }
+    ]
+  })
+}
+
+# Mondays 07:00 UTC, ahead of the working week
+resource "aws_cloudwatch_event_rule" "account_hygiene_schedule" {
+  name                = "${var.project_name}-account-hygiene-schedule"
+  description         = "Weekly account hygiene audit and digest"
+  schedule_expression = "cron(0 7 ? * MON *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-account-hygiene-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "account_hygiene_target" {
+  rule      = aws_cloudwatch_event_rule.account_hygiene_schedule.name
+  target_id = "AccountHygieneTarget"
+  arn       = aws_lambda_function.account_hygiene.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_account_hygiene" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.account_hygiene.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.account_hygiene_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "account_hygiene_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.account_hygiene.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-account-hygiene-logs"
+    }
+  )
+}
@@ -0,0 +1,100 @@
+# Weekly keyword suggestions from converting search terms that no keyword
+# targets yet, checked against product-service's catalogue. Set
+# CREATE_PAUSED_KEYWORDS to "true" to also add them as paused keywords in
+# accounts with the optimizer enabled.
+data "archive_file" "keyword_expansion_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/keyword-expansion"
+  output_path = "${path.module}/../../lambda/keyword-expansion.zip"
+}
+
+resource "aws_lambda_function" "keyword_expansion" {
+  filename         = data.archive_file.keyword_expansion_lambda.output_path
+  function_name    = "${var.project_name}-keyword-expansion"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 300
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN       = aws_secretsmanager_secret.google_ads_credentials.arn
+      ACCOUNTS_TABLE_NAME         = aws_dynamodb_table.accounts.name
+      PRODUCTS_TABLE_NAME         = var.products_table_name
+      SNS_TOPIC_ARN               = var.sns_topic_arn
+      MIN_CONVERSIONS             = "2"
+      MAX_TERM_WORDS              = "6"
+      MAX_SUGGESTIONS_PER_ACCOUNT = "50"
+      TARGET_ROAS                 = "4.0"
+      CREATE_PAUSED_KEYWORDS      = "false"
+      ENVIRONMENT                 = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-keyword-expansion"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "keyword_expansion_policy" {
+  name = "${var.project_name}-keyword-expansion-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Scan"]
+        Resource = [data.aws_dynamodb_table.products.arn]
+      }
+    ]
+  })
+}
+
+# Mondays 08:00 UTC
+resource "aws_cloudwatch_event_rule" "keyword_expansion_schedule" {
+  name                = "${var.project_name}-keyword-expansion-schedule"
+  description         = "Weekly keyword suggestions from converting search terms"
+  schedule_expression = "cron(0 8 ? * MON *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-keyword-expansion-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "keyword_expansion_target" {
+  rule      = aws_cloudwatch_event_rule.keyword_expansion_schedule.name
+  target_id = "KeywordExpansionTarget"
+  arn       = aws_lambda_function.keyword_expansion.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_keyword_expansion" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.keyword_expansion.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.keyword_expansion_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "keyword_expansion_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.keyword_expansion.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-keyword-expansion-logs"
+    }
+  )
+}
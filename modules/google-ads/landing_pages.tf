@@ -0,0 +1,87 @@
+# Daily health check of the landing pages active ads and keywords send
+# clicks to. Set PAUSE_BROKEN_ADS to "true" to also pause ads whose page
+# returns 404 or 410 in accounts with the optimizer enabled.
+data "archive_file" "landing_page_checker_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/landing-page-checker"
+  output_path = "${path.module}/../../lambda/landing-page-checker.zip"
+}
+
+resource "aws_lambda_function" "landing_page_checker" {
+  filename         = data.archive_file.landing_page_checker_lambda.output_path
+  function_name    = "${var.project_name}-landing-page-checker"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 900
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN        = aws_secretsmanager_secret.google_ads_credentials.arn
+      ACCOUNTS_TABLE_NAME          = aws_dynamodb_table.accounts.name
+      SNS_TOPIC_ARN                = var.sns_topic_arn
+      CHECK_TIMEOUT_SECONDS        = "10"
+      CHECK_CONCURRENCY            = "8"
+      SLOW_LANDING_PAGE_MS         = "3000"
+      MAX_REDIRECT_HOPS            = "2"
+      LIGHTHOUSE_ENABLED           = var.pagespeed_api_key != "" ? "true" : "false"
+      PAGESPEED_API_KEY            = var.pagespeed_api_key
+      MAX_LIGHTHOUSE_CHECKS        = "25"
+      MIN_MOBILE_PERFORMANCE_SCORE = "0.5"
+      PAUSE_BROKEN_ADS             = "false"
+      MAX_PAUSED_ADS_PER_ACCOUNT   = "50"
+      ENVIRONMENT                  = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-landing-page-checker"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+# Daily 05:00 UTC, ahead of the working day
+resource "aws_cloudwatch_event_rule" "landing_page_checker_schedule" {
+  name                = "${var.project_name}-landing-page-checker-schedule"
+  description         = "Daily health check of ad landing pages"
+  schedule_expression = "cron(0 5 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-landing-page-checker-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "landing_page_checker_target" {
+  rule      = aws_cloudwatch_event_rule.landing_page_checker_schedule.name
+  target_id = "LandingPageCheckerTarget"
+  arn       = aws_lambda_function.landing_page_checker.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_landing_page_checker" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.landing_page_checker.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.landing_page_checker_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "landing_page_checker_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.landing_page_checker.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-landing-page-checker-logs"
+    }
+  )
+}
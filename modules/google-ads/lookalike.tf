@@ -0,0 +1,180 @@
+# Lookalike seed list export. The customers ltv-scorer places in the seed
+# tiers are uploaded to a Customer Match list, hashed by email and phone
+# number, for Google Ads to find similar people. Daily runs add and remove
+# members incrementally; the weekly run replaces the whole list to correct
+# drift. Uploaded members are tracked per list.
+resource "aws_dynamodb_table" "seed_members" {
+  name         = "${var.project_name}-google-ads-seed-members-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "list_id"
+  range_key    = "user_id"
+
+  attribute {
+    name = "list_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-seed-members"
+    }
+  )
+}
+
+data "aws_dynamodb_table" "notification_preferences" {
+  name = var.notification_preferences_table_name
+}
+
+data "archive_file" "seed_export_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/seed-export"
+  output_path = "${path.module}/../../lambda/seed-export.zip"
+}
+
+resource "aws_lambda_function" "seed_export" {
+  filename         = data.archive_file.seed_export_lambda.output_path
+  function_name    = "${var.project_name}-seed-export"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 900
+  memory_size     = 1024
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN               = aws_secretsmanager_secret.google_ads_credentials.arn
+      GOOGLE_ADS_CUSTOMER_ID              = var.google_ads_customer_id
+      SEED_LIST_ID                        = var.lookalike_seed_list_id
+      USERS_TABLE_NAME                    = var.users_table_name
+      NOTIFICATION_PREFERENCES_TABLE_NAME = var.notification_preferences_table_name
+      SEED_MEMBERS_TABLE_NAME             = aws_dynamodb_table.seed_members.name
+      SYNC_MODE                           = "incremental"
+      ENVIRONMENT                         = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-seed-export"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "seed_export_policy" {
+  name = "${var.project_name}-seed-export-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Scan"]
+        Resource = [data.aws_dynamodb_table.users.arn]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchGetItem"]
+        Resource = [data.aws_dynamodb_table.notification_preferences.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:Query",
+          "dynamodb:BatchWriteItem",
+          "dynamodb:DeleteItem"
+        ]
+        Resource = [aws_dynamodb_table.seed_members.arn]
+      }
+    ]
+  })
+}
+
+# Daily at 04:00 UTC, after ltv-scorer's run
+resource "aws_cloudwatch_event_rule" "seed_export_schedule" {
+  name                = "${var.project_name}-seed-export-schedule"
+  description         = "Daily incremental lookalike seed list export"
+  schedule_expression = "cron(0 4 ? * MON-SAT *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-seed-export-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "seed_export_schedule_target" {
+  rule      = aws_cloudwatch_event_rule.seed_export_schedule.name
+  target_id = "SeedExportScheduleTarget"
+  arn       = aws_lambda_function.seed_export.arn
+  input     = jsonencode({ mode = "incremental" })
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_seed_export" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.seed_export.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.seed_export_schedule.arn
+}
+
+# Sundays, in place of the incremental run
+resource "aws_cloudwatch_event_rule" "seed_export_replace_schedule" {
+  name                = "${var.project_name}-seed-export-replace-schedule"
+  description         = "Weekly full replace of the lookalike seed list"
+  schedule_expression = "cron(0 4 ? * SUN *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-seed-export-replace-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "seed_export_replace_target" {
+  rule      = aws_cloudwatch_event_rule.seed_export_replace_schedule.name
+  target_id = "SeedExportReplaceTarget"
+  arn       = aws_lambda_function.seed_export.arn
+  input     = jsonencode({ mode = "replace" })
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_seed_export_replace" {
+  statement_id  = "AllowExecutionFromCloudWatchReplace"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.seed_export.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.seed_export_replace_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "seed_export_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.seed_export.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-seed-export-logs"
+    }
+  )
+}
@@ -8,6 +8,10 @@ terraform {
       source  = "hashicorp/archive"
       version = "~> 2.4"
     }
+    random = {
+      source  = "hashicorp/random"
+      version = "~> 3.5"
+    }
   }
 }
 
@@ -61,13 +65,15 @@ resource "aws_iam_role_policy" "google_ads_lambda_policy" {
         ]
         Resource = [
           aws_secretsmanager_secret.google_ads_credentials.arn,
-          aws_secretsmanager_secret.google_ads_developer_token.arn
+          aws_secretsmanager_secret.google_ads_developer_token.arn,
+          aws_secretsmanager_secret.ads_platforms.arn
         ]
       },
       {
         Effect = "Allow"
         Action = [
-          "kms:Decrypt"
+          "kms:Decrypt",
+          "kms:GenerateDataKey"
         ]
         Resource = [var.kms_key_arn]
       },
@@ -77,6 +83,42 @@ resource "aws_iam_role_policy" "google_ads_lambda_policy" {
           "sns:Publish"
         ]
         Resource = [var.sns_topic_arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:Scan"
+        ]
+        Resource = [aws_dynamodb_table.accounts.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:PutItem"
+        ]
+        Resource = [
+          aws_dynamodb_table.runs.arn,
+          aws_dynamodb_table.ad_schedules.arn
+        ]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:Query"
+        ]
+        Resource = [aws_dynamodb_table.order_revenue.arn]
+      },
+      {
+        # The self_check event mode
+        Effect = "Allow"
+        Action = [
+          "dynamodb:DescribeTable"
+        ]
+        Resource = [
+          aws_dynamodb_table.accounts.arn,
+          aws_dynamodb_table.runs.arn
+        ]
       }
     ]
   })
@@ -106,6 +148,27 @@ resource "aws_secretsmanager_secret_version" "google_ads_credentials" {
   })
 }
 
+# Microsoft Advertising and Meta credentials and accounts. The optimizer,
+# monitor and bid applier run their accounts alongside the Google Ads ones;
+# "{}" leaves them on Google Ads only.
+resource "aws_secretsmanager_secret" "ads_platforms" {
+  name                    = "${var.project_name}/ads-platforms/credentials"
+  description             = "Microsoft Advertising and Meta API credentials and accounts"
+  recovery_window_in_days = 0
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-ads-platforms-credentials"
+    }
+  )
+}
+
+resource "aws_secretsmanager_secret_version" "ads_platforms" {
+  secret_id     = aws_secretsmanager_secret.ads_platforms.id
+  secret_string = var.ads_platforms_config
+}
+
 # Lambda Function for Campaign Performance Monitor
 data "archive_file" "campaign_monitor_lambda" {
   type        = "zip"
@@ -123,9 +186,22 @@ resource "aws_lambda_function" "campaign_monitor" {
 
   environment {
     variables = {
-      GOOGLE_ADS_SECRET_ARN = aws_secretsmanager_secret.google_ads_credentials.arn
-      SNS_TOPIC_ARN         = var.sns_topic_arn
-      ENVIRONMENT           = var.environment
+      GOOGLE_ADS_SECRET_ARN         = aws_secretsmanager_secret.google_ads_credentials.arn
+      ADS_PLATFORMS_SECRET_ARN      = aws_secretsmanager_secret.ads_platforms.arn
+      SNS_TOPIC_ARN                 = var.sns_topic_arn
+      EVENT_BUS_NAME                = var.event_bus_name
+      ENVIRONMENT                   = var.environment
+      ACCOUNTS_TABLE_NAME           = aws_dynamodb_table.accounts.name
+      RUNS_TABLE_NAME               = aws_dynamodb_table.runs.name
+      FAILURES_QUEUE_URL            = aws_sqs_queue.run_failures.url
+      FINDINGS_TABLE_NAME           = aws_dynamodb_table.traffic_findings.name
+      QUALITY_SCORES_TABLE_NAME     = aws_dynamodb_table.quality_scores.name
+      SEASONALITY_TABLE_NAME        = aws_dynamodb_table.seasonality.name
+      REPORTS_BUCKET                = replace(var.reports_bucket_arn, "arn:aws:s3:::", "")
+      FX_RATES                      = jsonencode(var.fx_rates)
+      GOOGLE_ADS_RETRY_MAX_ATTEMPTS = "5"
+      GOOGLE_ADS_MAX_QPS            = "10"
+      ACCOUNT_CONCURRENCY           = "4"
     }
   }
 
@@ -156,13 +232,14 @@ resource "aws_lambda_function" "bid_optimizer" {
   runtime         = "go1.x"
   timeout         = 600
 
+  # The scheduled invocation only queues accounts for bid_optimizer_worker;
+  # see fanout.tf.
   environment {
-    variables = {
-      GOOGLE_ADS_SECRET_ARN = aws_secretsmanager_secret.google_ads_credentials.arn
-      SNS_TOPIC_ARN         = var.sns_topic_arn
-      ENVIRONMENT           = var.environment
+    variables = merge(local.bid_optimizer_environment, {
       OPTIMIZATION_INTERVAL = var.optimization_interval
-    }
+      ACCOUNTS_TABLE_NAME   = aws_dynamodb_table.accounts.name
+      ACCOUNT_QUEUE_URL     = aws_sqs_queue.bid_optimizer_accounts.url
+    })
   }
 
   tags = merge(
@@ -240,6 +317,36 @@ resource "aws_lambda_permission" "allow_cloudwatch_campaign_monitor" {
   source_arn    = aws_cloudwatch_event_rule.campaign_monitor_schedule.arn
 }
 
+# Hourly spend spike check, a few minutes past the hour once the previous
+# hour's spend has mostly been reported
+resource "aws_cloudwatch_event_rule" "campaign_monitor_hourly_schedule" {
+  name                = "${var.project_name}-campaign-monitor-hourly-schedule"
+  description         = "Hourly spend spike check"
+  schedule_expression = "cron(10 * * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-campaign-monitor-hourly-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "campaign_monitor_hourly_target" {
+  rule      = aws_cloudwatch_event_rule.campaign_monitor_hourly_schedule.name
+  target_id = "CampaignMonitorHourlyTarget"
+  arn       = aws_lambda_function.campaign_monitor.arn
+  input     = jsonencode({ mode = "hourly" })
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_campaign_monitor_hourly" {
+  statement_id  = "AllowExecutionFromCloudWatchHourly"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.campaign_monitor.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.campaign_monitor_hourly_schedule.arn
+}
+
 resource "aws_cloudwatch_event_rule" "bid_optimizer_schedule" {
   name                = "${var.project_name}-bid-optimizer-schedule"
   description         = "Schedule for bid optimization"
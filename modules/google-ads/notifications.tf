@@ -0,0 +1,158 @@
+# Lambda Function for Slack/Email Notification Dispatch
+data "archive_file" "notification_dispatcher_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/notification-dispatcher"
+  output_path = "${path.module}/../../lambda/notification-dispatcher.zip"
+}
+
+# Routing document (channels + per-alert-type routes); see pkg/notify.
+resource "aws_ssm_parameter" "notification_routes" {
+  name  = "/${var.project_name}/${var.environment}/google-ads/notification-routes"
+  type  = "SecureString"
+  value = var.notification_routes
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+
+  tags = var.tags
+}
+
+# Non-critical notifications held back by a channel's quiet hours or
+# delivery windows, released by the deferred delivery schedule below.
+resource "aws_dynamodb_table" "deferred_notifications" {
+  name         = "${var.project_name}-google-ads-deferred-notifications-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "channel"
+  range_key    = "deliver_key"
+
+  attribute {
+    name = "channel"
+    type = "S"
+  }
+
+  attribute {
+    name = "deliver_key"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-deferred-notifications"
+    }
+  )
+}
+
+resource "aws_lambda_function" "notification_dispatcher" {
+  filename         = data.archive_file.notification_dispatcher_lambda.output_path
+  function_name    = "${var.project_name}-notification-dispatcher"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 60
+
+  environment {
+    variables = {
+      NOTIFY_ROUTES_PARAMETER           = aws_ssm_parameter.notification_routes.name
+      DEFERRED_NOTIFICATIONS_TABLE_NAME = aws_dynamodb_table.deferred_notifications.name
+      ENVIRONMENT                       = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-notification-dispatcher"
+    }
+  )
+}
+
+resource "aws_iam_role_policy" "notification_dispatcher_policy" {
+  name = "${var.project_name}-notification-dispatcher-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["ssm:GetParameter"]
+        Resource = [aws_ssm_parameter.notification_routes.arn]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["ses:SendEmail"]
+        Resource = "*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:PutItem", "dynamodb:Query", "dynamodb:DeleteItem"]
+        Resource = [aws_dynamodb_table.deferred_notifications.arn]
+      }
+    ]
+  })
+}
+
+resource "aws_sns_topic_subscription" "notification_dispatcher" {
+  topic_arn = var.sns_topic_arn
+  protocol  = "lambda"
+  endpoint  = aws_lambda_function.notification_dispatcher.arn
+}
+
+resource "aws_lambda_permission" "allow_sns_notification_dispatcher" {
+  statement_id  = "AllowExecutionFromSNS"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.notification_dispatcher.function_name
+  principal     = "sns.amazonaws.com"
+  source_arn    = var.sns_topic_arn
+}
+
+# Releases deferred notifications once their channel's quiet hours end
+resource "aws_cloudwatch_event_rule" "deferred_notifications_schedule" {
+  name                = "${var.project_name}-deferred-notifications-schedule"
+  description         = "Deliver deferred Google Ads notifications"
+  schedule_expression = "rate(15 minutes)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-deferred-notifications-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "deferred_notifications_target" {
+  rule      = aws_cloudwatch_event_rule.deferred_notifications_schedule.name
+  target_id = "DeferredNotificationsTarget"
+  arn       = aws_lambda_function.notification_dispatcher.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_notification_dispatcher" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.notification_dispatcher.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.deferred_notifications_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "notification_dispatcher_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.notification_dispatcher.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-notification-dispatcher-logs"
+    }
+  )
+}
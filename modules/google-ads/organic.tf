@@ -0,0 +1,108 @@
+# Weekly comparison of paid search terms with Search Console organic
+# rankings, recommending negatives or lower bids where paid clicks
+# cannibalize organic traffic.
+data "archive_file" "organic_overlap_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/organic-overlap"
+  output_path = "${path.module}/../../lambda/organic-overlap.zip"
+}
+
+resource "aws_lambda_function" "organic_overlap" {
+  filename         = data.archive_file.organic_overlap_lambda.output_path
+  function_name    = "${var.project_name}-organic-overlap"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 300
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN      = aws_secretsmanager_secret.google_ads_credentials.arn
+      ACCOUNTS_TABLE_NAME        = aws_dynamodb_table.accounts.name
+      ACCOUNT_CONFIG_TABLE_NAME  = aws_dynamodb_table.account_config.name
+      REPORTS_BUCKET             = replace(var.reports_bucket_arn, "arn:aws:s3:::", "")
+      SNS_TOPIC_ARN              = var.sns_topic_arn
+      LOOKBACK_DAYS              = "28"
+      ORGANIC_POSITION_THRESHOLD = "3"
+      MIN_PAID_CLICKS            = "10"
+      ENVIRONMENT                = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-organic-overlap"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "organic_overlap_policy" {
+  name = "${var.project_name}-organic-overlap-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem"
+        ]
+        Resource = aws_dynamodb_table.account_config.arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject"
+        ]
+        Resource = "${var.reports_bucket_arn}/organic_overlap/*"
+      }
+    ]
+  })
+}
+
+# Mondays 07:00 UTC; Search Console data lags a few days, see
+# SEARCH_CONSOLE_LAG_DAYS
+resource "aws_cloudwatch_event_rule" "organic_overlap_schedule" {
+  name                = "${var.project_name}-organic-overlap-schedule"
+  description         = "Weekly paid/organic search overlap analysis"
+  schedule_expression = "cron(0 7 ? * MON *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-organic-overlap-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "organic_overlap_target" {
+  rule      = aws_cloudwatch_event_rule.organic_overlap_schedule.name
+  target_id = "OrganicOverlapTarget"
+  arn       = aws_lambda_function.organic_overlap.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_organic_overlap" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.organic_overlap.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.organic_overlap_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "organic_overlap_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.organic_overlap.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-organic-overlap-logs"
+    }
+  )
+}
@@ -53,6 +53,98 @@ output "log_group_names" {
   value = {
     campaign_monitor = aws_cloudwatch_log_group.campaign_monitor_logs.name
     bid_optimizer     = aws_cloudwatch_log_group.bid_optimizer_logs.name
+    bid_optimizer_worker = aws_cloudwatch_log_group.bid_optimizer_worker_logs.name
+    bid_applier       = aws_cloudwatch_log_group.bid_applier_logs.name
     ad_analytics      = aws_cloudwatch_log_group.ad_analytics_logs.name
   }
 }
+
+output "accounts_table_name" {
+  description = "Name of the Google Ads accounts DynamoDB table"
+  value       = aws_dynamodb_table.accounts.name
+}
+
+output "account_config_table_name" {
+  description = "Name of the Google Ads account config DynamoDB table"
+  value       = aws_dynamodb_table.account_config.name
+}
+
+output "baselines_table_name" {
+  description = "Name of the Google Ads campaign baselines DynamoDB table"
+  value       = aws_dynamodb_table.baselines.name
+}
+
+output "conversions_queue_url" {
+  description = "URL of the SQS queue order conversions are published to"
+  value       = aws_sqs_queue.conversions.url
+}
+
+output "conversions_queue_arn" {
+  description = "ARN of the SQS queue order conversions are published to"
+  value       = aws_sqs_queue.conversions.arn
+}
+
+output "bid_optimizer_worker_function_name" {
+  description = "Name of the bid optimizer worker Lambda function"
+  value       = aws_lambda_function.bid_optimizer_worker.function_name
+}
+
+output "bid_optimizer_accounts_dlq_arn" {
+  description = "ARN of the dead-letter queue for accounts the bid optimizer worker could not optimize"
+  value       = aws_sqs_queue.bid_optimizer_accounts_dlq.arn
+}
+
+output "runs_table_name" {
+  description = "Name of the Google Ads run history DynamoDB table"
+  value       = aws_dynamodb_table.runs.name
+}
+
+output "traffic_findings_table_name" {
+  description = "Name of the Google Ads invalid traffic findings DynamoDB table"
+  value       = aws_dynamodb_table.traffic_findings.name
+}
+
+output "quality_scores_table_name" {
+  description = "Name of the Google Ads keyword Quality Score snapshots DynamoDB table"
+  value       = aws_dynamodb_table.quality_scores.name
+}
+
+output "ad_schedules_table_name" {
+  description = "Name of the Google Ads ad schedule recommendations DynamoDB table"
+  value       = aws_dynamodb_table.ad_schedules.name
+}
+
+output "order_revenue_table_name" {
+  description = "Name of the Google Ads attributed order revenue DynamoDB table"
+  value       = aws_dynamodb_table.order_revenue.name
+}
+
+output "approvals_table_name" {
+  description = "Name of the Google Ads bid approvals DynamoDB table"
+  value       = aws_dynamodb_table.approvals.name
+}
+
+output "bid_audit_table_name" {
+  description = "Name of the Google Ads applied bid change audit log DynamoDB table"
+  value       = aws_dynamodb_table.bid_audit.name
+}
+
+output "seasonality_table_name" {
+  description = "Name of the Google Ads seasonality calendar DynamoDB table"
+  value       = aws_dynamodb_table.seasonality.name
+}
+
+output "approval_signing_secret_arn" {
+  description = "ARN of the secret that signs one-click bid approval links"
+  value       = aws_secretsmanager_secret.approval_signing_key.arn
+}
+
+output "experiments_table_name" {
+  description = "Name of the Google Ads experiment cohort assignments DynamoDB table"
+  value       = aws_dynamodb_table.experiments.name
+}
+
+output "run_failures_queue_url" {
+  description = "URL of the queue receiving failed campaign monitor and bid optimizer runs"
+  value       = aws_sqs_queue.run_failures.url
+}
@@ -0,0 +1,99 @@
+# Weekly review of Display and Performance Max placements, adding the ones
+# that spent without converting to each account's shared negative placement
+# list. Accounts protect placements with the placement_exclusions settings
+# section's allowlist.
+data "archive_file" "placement_exclusions_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/placement-exclusions"
+  output_path = "${path.module}/../../lambda/placement-exclusions.zip"
+}
+
+resource "aws_lambda_function" "placement_exclusions" {
+  filename         = data.archive_file.placement_exclusions_lambda.output_path
+  function_name    = "${var.project_name}-placement-exclusions"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 600
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN           = aws_secretsmanager_secret.google_ads_credentials.arn
+      ACCOUNTS_TABLE_NAME             = aws_dynamodb_table.accounts.name
+      ACCOUNT_CONFIG_TABLE_NAME       = aws_dynamodb_table.account_config.name
+      PLACEMENT_EXCLUSION_APPLY       = "true"
+      PLACEMENT_EXCLUSION_MIN_COST    = "20"
+      PLACEMENT_EXCLUSION_MAX_PER_RUN = "100"
+      ENVIRONMENT                     = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-placement-exclusions"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "placement_exclusions_policy" {
+  name = "${var.project_name}-placement-exclusions-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem"
+        ]
+        Resource = aws_dynamodb_table.account_config.arn
+      }
+    ]
+  })
+}
+
+# Tuesdays 07:00 UTC, after a full week of placement data
+resource "aws_cloudwatch_event_rule" "placement_exclusions_schedule" {
+  name                = "${var.project_name}-placement-exclusions-schedule"
+  description         = "Weekly placement exclusion review"
+  schedule_expression = "cron(0 7 ? * TUE *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-placement-exclusions-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "placement_exclusions_target" {
+  rule      = aws_cloudwatch_event_rule.placement_exclusions_schedule.name
+  target_id = "PlacementExclusionsTarget"
+  arn       = aws_lambda_function.placement_exclusions.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_placement_exclusions" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.placement_exclusions.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.placement_exclusions_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "placement_exclusions_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.placement_exclusions.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-placement-exclusions-logs"
+    }
+  )
+}
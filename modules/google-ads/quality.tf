@@ -0,0 +1,96 @@
+# Daily keyword Quality Score snapshots from campaign-monitor's "quality"
+# run, one item per account, day, ad group and keyword. A day's snapshot is
+# compared with the previous one to raise QUALITY_SCORE_DROP and expires
+# after 180 days.
+resource "aws_dynamodb_table" "quality_scores" {
+  name         = "${var.project_name}-google-ads-quality-scores-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+  range_key    = "snapshot_key"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "snapshot_key"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-quality-scores"
+    }
+  )
+}
+
+resource "aws_iam_role_policy" "quality_scores_policy" {
+  name = "${var.project_name}-quality-scores-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:Query",
+          "dynamodb:BatchWriteItem"
+        ]
+        Resource = [aws_dynamodb_table.quality_scores.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject"
+        ]
+        Resource = ["${var.reports_bucket_arn}/quality_scores/*"]
+      }
+    ]
+  })
+}
+
+# Daily 07:00 UTC. Quality Scores are updated once a day at most, so a
+# later run would only see the same ratings.
+resource "aws_cloudwatch_event_rule" "campaign_monitor_quality_schedule" {
+  name                = "${var.project_name}-campaign-monitor-quality-schedule"
+  description         = "Daily keyword Quality Score snapshot"
+  schedule_expression = "cron(0 7 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-campaign-monitor-quality-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "campaign_monitor_quality_target" {
+  rule      = aws_cloudwatch_event_rule.campaign_monitor_quality_schedule.name
+  target_id = "CampaignMonitorQualityTarget"
+  arn       = aws_lambda_function.campaign_monitor.arn
+  input     = jsonencode({ mode = "quality" })
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_campaign_monitor_quality" {
+  statement_id  = "AllowExecutionFromCloudWatchQuality"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.campaign_monitor.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.campaign_monitor_quality_schedule.arn
+}
@@ -0,0 +1,79 @@
+# Lambda Function for QuickSight Dataset Refresh
+data "archive_file" "quicksight_refresh_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/quicksight-refresh"
+  output_path = "${path.module}/../../lambda/quicksight-refresh.zip"
+}
+
+data "aws_caller_identity" "current" {}
+
+resource "aws_lambda_function" "quicksight_refresh" {
+  filename         = data.archive_file.quicksight_refresh_lambda.output_path
+  function_name    = "${var.project_name}-quicksight-refresh"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 60
+
+  environment {
+    variables = {
+      QUICKSIGHT_ACCOUNT_ID  = data.aws_caller_identity.current.account_id
+      QUICKSIGHT_DATASET_IDS = jsonencode(var.quicksight_dataset_ids)
+      MANIFEST_PREFIX        = "manifests"
+      ENVIRONMENT            = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-quicksight-refresh"
+    }
+  )
+}
+
+resource "aws_iam_role_policy" "quicksight_refresh_policy" {
+  name = "${var.project_name}-quicksight-refresh-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "quicksight:CreateIngestion",
+          "quicksight:ListIngestions"
+        ]
+        Resource = "*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject"
+        ]
+        Resource = ["${var.reports_bucket_arn}/manifests/*"]
+      }
+    ]
+  })
+}
+
+resource "aws_lambda_permission" "allow_s3_quicksight_refresh" {
+  statement_id  = "AllowExecutionFromS3"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.quicksight_refresh.function_name
+  principal     = "s3.amazonaws.com"
+  source_arn    = var.reports_bucket_arn
+}
+
+resource "aws_cloudwatch_log_group" "quicksight_refresh_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.quicksight_refresh.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-quicksight-refresh-logs"
+    }
+  )
+}
@@ -0,0 +1,96 @@
+# Daily audit of the product IDs the purchase page's remarketing tag
+# carried on recent conversions, against product-service's catalogue
+# (Merchant Center item IDs are catalogue product IDs). Catalogue lookups
+# use product_catalog_policy.
+data "archive_file" "remarketing_audit_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/remarketing-audit"
+  output_path = "${path.module}/../../lambda/remarketing-audit.zip"
+}
+
+resource "aws_lambda_function" "remarketing_audit" {
+  filename         = data.archive_file.remarketing_audit_lambda.output_path
+  function_name    = "${var.project_name}-remarketing-audit"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 300
+
+  environment {
+    variables = {
+      ORDER_REVENUE_TABLE_NAME     = aws_dynamodb_table.order_revenue.name
+      PRODUCTS_TABLE_NAME          = var.products_table_name
+      SNS_TOPIC_ARN                = var.sns_topic_arn
+      AUDIT_LOOKBACK_DAYS          = "1"
+      MAX_MISSING_PRODUCT_IDS_RATE = "0.2"
+      ENVIRONMENT                  = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-remarketing-audit"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "remarketing_audit_policy" {
+  name = "${var.project_name}-remarketing-audit-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:Scan"]
+        Resource = [aws_dynamodb_table.order_revenue.arn]
+      }
+    ]
+  })
+}
+
+# Daily 04:30 UTC, once the previous day's conversions are in
+resource "aws_cloudwatch_event_rule" "remarketing_audit_schedule" {
+  name                = "${var.project_name}-remarketing-audit-schedule"
+  description         = "Daily audit of remarketing tag product IDs"
+  schedule_expression = "cron(30 4 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-remarketing-audit-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "remarketing_audit_target" {
+  rule      = aws_cloudwatch_event_rule.remarketing_audit_schedule.name
+  target_id = "RemarketingAuditTarget"
+  arn       = aws_lambda_function.remarketing_audit.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_remarketing_audit" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.remarketing_audit.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.remarketing_audit_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "remarketing_audit_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.remarketing_audit.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-remarketing-audit-logs"
+    }
+  )
+}
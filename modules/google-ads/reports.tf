@@ -0,0 +1,182 @@
+# Daily export of search term, geo, device and hour-of-day performance to
+# the reports bucket, catalogued in Glue for Athena and QuickSight.
+data "archive_file" "report_exporter_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/../../lambda/report-exporter"
+  output_path = "${path.module}/../../lambda/report-exporter.zip"
+}
+
+resource "aws_lambda_function" "report_exporter" {
+  filename         = data.archive_file.report_exporter_lambda.output_path
+  function_name    = "${var.project_name}-report-exporter"
+  role            = aws_iam_role.google_ads_lambda_role.arn
+  handler         = "main"
+  runtime         = "go1.x"
+  timeout         = 900
+
+  environment {
+    variables = {
+      GOOGLE_ADS_SECRET_ARN = aws_secretsmanager_secret.google_ads_credentials.arn
+      ACCOUNTS_TABLE_NAME   = aws_dynamodb_table.accounts.name
+      REPORTS_BUCKET        = replace(var.reports_bucket_arn, "arn:aws:s3:::", "")
+      REFRESH_DAYS          = "3"
+      ENVIRONMENT           = var.environment
+    }
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-report-exporter"
+    }
+  )
+
+  depends_on = [
+    aws_iam_role_policy_attachment.google_ads_lambda_policy_attachment
+  ]
+}
+
+resource "aws_iam_role_policy" "report_exporter_policy" {
+  name = "${var.project_name}-report-exporter-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "s3:PutObject"
+        ]
+        Resource = [for report in keys(local.report_tables) : "${var.reports_bucket_arn}/${report}/*"]
+      }
+    ]
+  })
+}
+
+# 05:00 UTC, once yesterday has closed in the accounts' time zones
+resource "aws_cloudwatch_event_rule" "report_exporter_schedule" {
+  name                = "${var.project_name}-report-exporter-schedule"
+  description         = "Daily Google Ads performance report export"
+  schedule_expression = "cron(0 5 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-report-exporter-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "report_exporter_target" {
+  rule      = aws_cloudwatch_event_rule.report_exporter_schedule.name
+  target_id = "ReportExporterTarget"
+  arn       = aws_lambda_function.report_exporter.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_report_exporter" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.report_exporter.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.report_exporter_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "report_exporter_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.report_exporter.function_name}"
+  retention_in_days = var.log_retention_days
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-report-exporter-logs"
+    }
+  )
+}
+
+# Glue catalog for the exports. Partitions are projected from the
+# date=YYYY-MM-DD prefixes, so new days are queryable in Athena without a
+# crawler or MSCK REPAIR.
+locals {
+  report_performance_columns = [
+    ["impressions", "bigint"], ["clicks", "bigint"], ["cost", "double"], ["conversions", "bigint"],
+  ]
+
+  # Column order matches lambda/report-exporter/reports.go.
+  report_tables = {
+    search_terms = [
+      ["customer_id", "string"], ["campaign_id", "string"], ["campaign_name", "string"],
+      ["ad_group_id", "string"], ["ad_group_name", "string"], ["search_term", "string"], ["status", "string"],
+    ]
+    geo = [
+      ["customer_id", "string"], ["campaign_id", "string"], ["campaign_name", "string"],
+      ["country_criterion_id", "string"], ["location_type", "string"],
+    ]
+    device = [
+      ["customer_id", "string"], ["campaign_id", "string"], ["campaign_name", "string"], ["device", "string"],
+    ]
+    hour_of_day = [
+      ["customer_id", "string"], ["campaign_id", "string"], ["campaign_name", "string"], ["hour", "int"],
+    ]
+  }
+}
+
+resource "aws_glue_catalog_database" "google_ads_reports" {
+  name        = replace("${var.project_name}_google_ads_reports_${var.environment}", "-", "_")
+  description = "Google Ads performance exports in the reports bucket"
+}
+
+resource "aws_glue_catalog_table" "google_ads_reports" {
+  for_each = local.report_tables
+
+  name          = each.key
+  database_name = aws_glue_catalog_database.google_ads_reports.name
+  table_type    = "EXTERNAL_TABLE"
+
+  parameters = {
+    "classification"                = "csv"
+    "skip.header.line.count"        = "1"
+    "projection.enabled"            = "true"
+    "projection.date.type"          = "date"
+    "projection.date.format"        = "yyyy-MM-dd"
+    "projection.date.range"         = "2020-01-01,NOW"
+    "projection.date.interval"      = "1"
+    "projection.date.interval.unit" = "DAYS"
+    "storage.location.template"     = "s3://${replace(var.reports_bucket_arn, "arn:aws:s3:::", "")}/${each.key}/date=$${date}/"
+  }
+
+  partition_keys {
+    name = "date"
+    type = "string"
+  }
+
+  storage_descriptor {
+    location      = "s3://${replace(var.reports_bucket_arn, "arn:aws:s3:::", "")}/${each.key}/"
+    input_format  = "org.apache.hadoop.mapred.TextInputFormat"
+    output_format = "org.apache.hadoop.hive.ql.io.HiveIgnoreKeyTextOutputFormat"
+
+    ser_de_info {
+      serialization_library = "org.apache.hadoop.hive.serde2.OpenCSVSerde"
+      parameters = {
+        "separatorChar" = ","
+        "quoteChar"     = "\""
+      }
+    }
+
+    dynamic "columns" {
+      for_each = each.value
+      content {
+        name = columns.value[0]
+        type = columns.value[1]
+      }
+    }
+
+    dynamic "columns" {
+      for_each = local.report_performance_columns
+      content {
+        name = columns.value[0]
+        type = columns.value[1]
+      }
+    }
+  }
+}
@@ -0,0 +1,77 @@
+# Failure handling for the scheduled campaign_monitor and bid_optimizer
+# runs. Each run checkpoints the accounts it has processed on its runs
+# record. Lambda retries a failed scheduled invocation under the same
+# request ID, and the retry resumes the run, skipping processed accounts.
+# Invocations that fail on every attempt, and runs that finish with failed
+# accounts, land on the failures queue; a run is resumed by hand by
+# invoking the function with {"resume_run": "<run or request ID>"}.
+locals {
+  run_max_retry_attempts = 2
+}
+
+resource "aws_sqs_queue" "run_failures" {
+  name                      = "${var.project_name}-google-ads-run-failures-${var.environment}"
+  message_retention_seconds = 1209600
+  kms_master_key_id         = var.kms_key_arn
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-run-failures"
+    }
+  )
+}
+
+resource "aws_lambda_function_event_invoke_config" "campaign_monitor" {
+  function_name          = aws_lambda_function.campaign_monitor.function_name
+  maximum_retry_attempts = local.run_max_retry_attempts
+
+  destination_config {
+    on_failure {
+      destination = aws_sqs_queue.run_failures.arn
+    }
+  }
+}
+
+resource "aws_lambda_function_event_invoke_config" "bid_optimizer" {
+  function_name          = aws_lambda_function.bid_optimizer.function_name
+  maximum_retry_attempts = local.run_max_retry_attempts
+
+  destination_config {
+    on_failure {
+      destination = aws_sqs_queue.run_failures.arn
+    }
+  }
+}
+
+resource "aws_iam_role_policy" "run_failures_policy" {
+  name = "${var.project_name}-run-failures-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  # Reading runs back and checkpointing them in place is what lets a retry
+  # skip the accounts already processed.
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:SendMessage"
+        ]
+        Resource = aws_sqs_queue.run_failures.arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:Query"
+        ]
+        Resource = [
+          aws_dynamodb_table.runs.arn,
+          "${aws_dynamodb_table.runs.arn}/index/*"
+        ]
+      }
+    ]
+  })
+}
@@ -0,0 +1,56 @@
+# Seasonality calendar: planned demand events such as Black Friday, with
+# their dates and the multipliers the automation applies while they run.
+# The ads-api edits it under /seasonality. The bid optimizer reads it to
+# widen guardrails, raise and restore budgets and create Google Ads
+# seasonality adjustments, recording what it did on each event; the
+# campaign monitor reads it to expect the spend surge.
+resource "aws_dynamodb_table" "seasonality" {
+  name         = "${var.project_name}-google-ads-seasonality-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "scope"
+  range_key    = "event_id"
+
+  attribute {
+    name = "scope"
+    type = "S"
+  }
+
+  attribute {
+    name = "event_id"
+    type = "S"
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-seasonality"
+    }
+  )
+}
+
+resource "aws_iam_role_policy" "seasonality_policy" {
+  name = "${var.project_name}-seasonality-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:Query",
+          "dynamodb:UpdateItem"
+        ]
+        Resource = [aws_dynamodb_table.seasonality.arn]
+      }
+    ]
+  })
+}
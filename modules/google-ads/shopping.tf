@@ -0,0 +1,22 @@
+# Shopping and Performance Max analysis. The bid optimizer looks up each
+# advertised item in product-service's catalogue, by the Merchant Center
+# item ID, to flag items that can no longer be bought.
+data "aws_dynamodb_table" "products" {
+  name = var.products_table_name
+}
+
+resource "aws_iam_role_policy" "product_catalog_policy" {
+  name = "${var.project_name}-product-catalog-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchGetItem"]
+        Resource = [data.aws_dynamodb_table.products.arn]
+      }
+    ]
+  })
+}
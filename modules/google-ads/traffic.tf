@@ -0,0 +1,86 @@
+# Invalid traffic findings from campaign-monitor's daily "traffic" run, one
+# item per account, heuristic, campaign and country or placement. An item
+# is rewritten whenever the finding alerts again and expires 90 days later.
+resource "aws_dynamodb_table" "traffic_findings" {
+  name         = "${var.project_name}-google-ads-traffic-findings-${var.environment}"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "customer_id"
+  range_key    = "finding_id"
+
+  attribute {
+    name = "customer_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "finding_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-traffic-findings"
+    }
+  )
+}
+
+resource "aws_iam_role_policy" "traffic_findings_policy" {
+  name = "${var.project_name}-traffic-findings-policy"
+  role = aws_iam_role.google_ads_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:PutItem"
+        ]
+        Resource = [aws_dynamodb_table.traffic_findings.arn]
+      }
+    ]
+  })
+}
+
+# Daily 06:30 UTC, once the previous day's clicks have been reported
+resource "aws_cloudwatch_event_rule" "campaign_monitor_traffic_schedule" {
+  name                = "${var.project_name}-campaign-monitor-traffic-schedule"
+  description         = "Daily invalid traffic check"
+  schedule_expression = "cron(30 6 * * ? *)"
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-campaign-monitor-traffic-schedule"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "campaign_monitor_traffic_target" {
+  rule      = aws_cloudwatch_event_rule.campaign_monitor_traffic_schedule.name
+  target_id = "CampaignMonitorTrafficTarget"
+  arn       = aws_lambda_function.campaign_monitor.arn
+  input     = jsonencode({ mode = "traffic" })
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_campaign_monitor_traffic" {
+  statement_id  = "AllowExecutionFromCloudWatchTraffic"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.campaign_monitor.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.campaign_monitor_traffic_schedule.arn
+}
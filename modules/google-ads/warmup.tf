@@ -0,0 +1,80 @@
+# Cold starts of the queue and event driven functions. Each sets up its AWS
+# config, Google Ads secret and client during init and keeps them across
+# invocations (see pkg/warmup), so only an environment's first invocation
+# pays for them.
+#
+# With lambda_provisioned_concurrency set, that many environments of each
+# are initialized ahead of traffic behind a "live" alias, which their
+# triggers invoke. Otherwise a scheduled {"type":"ping"} keeps one
+# environment of each warm and refreshes its secret between invocations.
+
+locals {
+  provisioned_concurrency = var.lambda_provisioned_concurrency > 0
+  warmer_enabled          = !local.provisioned_concurrency && var.lambda_warmer_schedule != ""
+
+  warmed_functions = {
+    bid_optimizer_worker = aws_lambda_function.bid_optimizer_worker
+    conversion_uploader  = aws_lambda_function.conversion_uploader
+    conversion_adjuster  = aws_lambda_function.conversion_adjuster
+    audience_sync        = aws_lambda_function.audience_sync
+  }
+
+  # What the functions' triggers invoke, and the qualifier their
+  # permissions name.
+  warmed_function_arns = {
+    for key, function in local.warmed_functions :
+    key => local.provisioned_concurrency ? aws_lambda_alias.live[key].arn : function.arn
+  }
+  warmed_qualifier = local.provisioned_concurrency ? "live" : null
+}
+
+resource "aws_lambda_alias" "live" {
+  for_each = local.provisioned_concurrency ? local.warmed_functions : {}
+
+  name             = "live"
+  description      = "Latest version, with provisioned concurrency"
+  function_name    = each.value.function_name
+  function_version = each.value.version
+}
+
+resource "aws_lambda_provisioned_concurrency_config" "live" {
+  for_each = aws_lambda_alias.live
+
+  function_name                     = each.value.function_name
+  qualifier                         = each.value.name
+  provisioned_concurrent_executions = var.lambda_provisioned_concurrency
+}
+
+resource "aws_cloudwatch_event_rule" "lambda_warmer" {
+  count = local.warmer_enabled ? 1 : 0
+
+  name                = "${var.project_name}-google-ads-lambda-warmer"
+  description         = "Pings the queue and event driven Google Ads functions to keep them warm"
+  schedule_expression = var.lambda_warmer_schedule
+
+  tags = merge(
+    var.tags,
+    {
+      Name = "${var.project_name}-google-ads-lambda-warmer"
+    }
+  )
+}
+
+resource "aws_cloudwatch_event_target" "lambda_warmer" {
+  for_each = local.warmer_enabled ? local.warmed_functions : {}
+
+  rule      = aws_cloudwatch_event_rule.lambda_warmer[0].name
+  target_id = "Warm-${replace(each.key, "_", "-")}"
+  arn       = each.value.arn
+  input     = jsonencode({ type = "ping" })
+}
+
+resource "aws_lambda_permission" "allow_lambda_warmer" {
+  for_each = local.warmer_enabled ? local.warmed_functions : {}
+
+  statement_id  = "AllowExecutionFromLambdaWarmer"
+  action        = "lambda:InvokeFunction"
+  function_name = each.value.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.lambda_warmer[0].arn
+}
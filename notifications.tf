@@ -0,0 +1,378 @@
+# Transactional email. Registration, password reset and order events from
+# EventBridge land on the notification events queue, which
+# notification-service turns into SES templated emails, one template per
+# kind and locale. The configuration set publishes delivery, bounce and
+# complaint events through an SNS topic to the feedback queue, from which
+# the service tracks each email and suppresses bad addresses.
+#
+# Users who prefer texts or WhatsApp get those instead, through AWS End
+# User Messaging SMS and Social. Their delivery events go through a second
+# topic to the receipts queue. The WhatsApp Business Account is linked to
+# End User Messaging Social by hand in the console, which points its event
+# destination at the message_receipts topic; its Meta templates are
+# approved there, one per kind named with underscores ("order_shipped").
+locals {
+  notification_kinds = ["welcome", "order-confirmed", "order-shipped", "password-reset"]
+
+  notification_templates = {
+    for pair in setproduct(local.notification_kinds, var.notification_locales) :
+    "${pair[0]}-${pair[1]}" => { kind = pair[0], locale = pair[1] }
+  }
+}
+
+resource "aws_ses_template" "notifications" {
+  for_each = local.notification_templates
+
+  name    = "${var.project_name}-${each.key}"
+  subject = jsondecode(file("${path.module}/templates/email/${each.value.locale}/subjects.json"))[each.value.kind]
+  html    = file("${path.module}/templates/email/${each.value.locale}/${each.value.kind}.html")
+  text    = file("${path.module}/templates/email/${each.value.locale}/${each.value.kind}.txt")
+}
+
+resource "aws_sesv2_configuration_set" "notifications" {
+  configuration_set_name = "${var.project_name}-notifications"
+
+  reputation_options {
+    reputation_metrics_enabled = true
+  }
+
+  tags = {
+    Name        = "${var.project_name}-notifications"
+    Environment = var.environment
+  }
+}
+
+resource "aws_sns_topic" "ses_feedback" {
+  name = "${var.project_name}-ses-feedback"
+
+  tags = {
+    Name        = "${var.project_name}-ses-feedback"
+    Environment = var.environment
+  }
+}
+
+resource "aws_sns_topic_policy" "ses_feedback" {
+  arn = aws_sns_topic.ses_feedback.arn
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = "ses.amazonaws.com" }
+        Action    = "sns:Publish"
+        Resource  = aws_sns_topic.ses_feedback.arn
+      }
+    ]
+  })
+}
+
+resource "aws_sesv2_configuration_set_event_destination" "notifications" {
+  configuration_set_name = aws_sesv2_configuration_set.notifications.configuration_set_name
+  event_destination_name = "feedback"
+
+  event_destination {
+    enabled              = true
+    matching_event_types = ["DELIVERY", "BOUNCE", "COMPLAINT", "REJECT", "RENDERING_FAILURE"]
+
+    sns_destination {
+      topic_arn = aws_sns_topic.ses_feedback.arn
+    }
+  }
+}
+
+resource "aws_sns_topic" "message_receipts" {
+  name = "${var.project_name}-message-receipts"
+
+  tags = {
+    Name        = "${var.project_name}-message-receipts"
+    Environment = var.environment
+  }
+}
+
+resource "aws_sns_topic_policy" "message_receipts" {
+  arn = aws_sns_topic.message_receipts.arn
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = ["sms-voice.amazonaws.com", "social-messaging.amazonaws.com"] }
+        Action    = "sns:Publish"
+        Resource  = aws_sns_topic.message_receipts.arn
+      }
+    ]
+  })
+}
+
+# The AWS provider has no End User Messaging SMS event destinations, so
+# the configuration set goes through Cloud Control.
+resource "aws_cloudcontrolapi_resource" "sms_configuration_set" {
+  type_name = "AWS::SMSVOICE::ConfigurationSet"
+
+  desired_state = jsonencode({
+    ConfigurationSetName = "${var.project_name}-notifications"
+    EventDestinations = [
+      {
+        EventDestinationName = "receipts"
+        Enabled              = true
+        MatchingEventTypes   = ["ALL"]
+        SnsDestination = {
+          TopicArn = aws_sns_topic.message_receipts.arn
+        }
+      }
+    ]
+  })
+
+  depends_on = [aws_sns_topic_policy.message_receipts]
+}
+
+resource "aws_sqs_queue" "notification_dlq" {
+  name                      = "${var.project_name}-notification-dlq"
+  message_retention_seconds = 1209600
+  sqs_managed_sse_enabled   = true
+
+  tags = {
+    Name        = "${var.project_name}-notification-dlq"
+    Environment = var.environment
+  }
+}
+
+# Deferred notifications keep their event here, received again every time
+# it is held back, so it takes more receives to dead-letter one.
+resource "aws_sqs_queue" "notification_events" {
+  name                       = "${var.project_name}-notification-events"
+  visibility_timeout_seconds = 60
+  receive_wait_time_seconds  = 20
+  sqs_managed_sse_enabled    = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.notification_dlq.arn
+    maxReceiveCount     = 10
+  })
+
+  tags = {
+    Name        = "${var.project_name}-notification-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_sqs_queue" "ses_feedback" {
+  name                       = "${var.project_name}-ses-feedback"
+  visibility_timeout_seconds = 60
+  receive_wait_time_seconds  = 20
+  sqs_managed_sse_enabled    = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.notification_dlq.arn
+    maxReceiveCount     = 5
+  })
+
+  tags = {
+    Name        = "${var.project_name}-ses-feedback"
+    Environment = var.environment
+  }
+}
+
+resource "aws_sqs_queue" "message_receipts" {
+  name                       = "${var.project_name}-message-receipts"
+  visibility_timeout_seconds = 60
+  receive_wait_time_seconds  = 20
+  sqs_managed_sse_enabled    = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.notification_dlq.arn
+    maxReceiveCount     = 5
+  })
+
+  tags = {
+    Name        = "${var.project_name}-message-receipts"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "notification_events" {
+  name           = "${var.project_name}-notification-events"
+  description    = "Registration, password reset and order events that send notifications"
+  event_bus_name = aws_cloudwatch_event_bus.ecommerce.name
+
+  event_pattern = jsonencode({
+    source      = ["ecommerce.user-service", "ecommerce.order-service"]
+    detail-type = ["User Registered", "Password Reset Requested", "Order Confirmed", "Order Shipped"]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-notification-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_target" "notification_events" {
+  rule           = aws_cloudwatch_event_rule.notification_events.name
+  event_bus_name = aws_cloudwatch_event_bus.ecommerce.name
+  target_id      = "NotificationEvents"
+  arn            = aws_sqs_queue.notification_events.arn
+}
+
+resource "aws_sqs_queue_policy" "notification_events" {
+  queue_url = aws_sqs_queue.notification_events.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = "events.amazonaws.com" }
+        Action    = "sqs:SendMessage"
+        Resource  = aws_sqs_queue.notification_events.arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = aws_cloudwatch_event_rule.notification_events.arn
+          }
+        }
+      }
+    ]
+  })
+}
+
+# Raw delivery makes the SES event itself the message body.
+resource "aws_sns_topic_subscription" "ses_feedback" {
+  topic_arn            = aws_sns_topic.ses_feedback.arn
+  protocol             = "sqs"
+  endpoint             = aws_sqs_queue.ses_feedback.arn
+  raw_message_delivery = true
+}
+
+resource "aws_sqs_queue_policy" "ses_feedback" {
+  queue_url = aws_sqs_queue.ses_feedback.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = "sns.amazonaws.com" }
+        Action    = "sqs:SendMessage"
+        Resource  = aws_sqs_queue.ses_feedback.arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = aws_sns_topic.ses_feedback.arn
+          }
+        }
+      }
+    ]
+  })
+}
+
+resource "aws_sns_topic_subscription" "message_receipts" {
+  topic_arn            = aws_sns_topic.message_receipts.arn
+  protocol             = "sqs"
+  endpoint             = aws_sqs_queue.message_receipts.arn
+  raw_message_delivery = true
+}
+
+resource "aws_sqs_queue_policy" "message_receipts" {
+  queue_url = aws_sqs_queue.message_receipts.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = "sns.amazonaws.com" }
+        Action    = "sqs:SendMessage"
+        Resource  = aws_sqs_queue.message_receipts.arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = aws_sns_topic.message_receipts.arn
+          }
+        }
+      }
+    ]
+  })
+}
+
+# notification-service sends through the configuration sets, records
+# notifications, suppressions and preferences, reads recipients from the
+# users table and consumes the queues above.
+resource "aws_iam_role_policy" "ecs_task_notifications" {
+  name = "${var.project_name}-ecs-task-notifications-policy"
+  role = "${var.project_name}-ecs-task-role"
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["ses:SendEmail", "ses:SendTemplatedEmail"]
+        Resource = "*"
+        Condition = {
+          StringEquals = {
+            "ses:ConfigurationSetName" = aws_sesv2_configuration_set.notifications.configuration_set_name
+          }
+        }
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["sms-voice:SendTextMessage"]
+        Resource = "*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["social-messaging:SendWhatsAppMessage"]
+        Resource = "*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:DeleteItem",
+          "dynamodb:Query",
+          "dynamodb:Scan"
+        ]
+        Resource = [
+          aws_dynamodb_table.notifications.arn,
+          "${aws_dynamodb_table.notifications.arn}/index/*",
+          aws_dynamodb_table.email_suppressions.arn,
+          aws_dynamodb_table.notification_preferences.arn
+        ]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:GetItem"]
+        Resource = [data.aws_dynamodb_table.users.arn]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:ChangeMessageVisibility"
+        ]
+        Resource = [
+          aws_sqs_queue.notification_events.arn,
+          aws_sqs_queue.ses_feedback.arn,
+          aws_sqs_queue.message_receipts.arn
+        ]
+      }
+    ]
+  })
+}
+
+output "notification_queue_urls" {
+  description = "Queues feeding notification-service"
+  value = {
+    events   = aws_sqs_queue.notification_events.url
+    feedback = aws_sqs_queue.ses_feedback.url
+    receipts = aws_sqs_queue.message_receipts.url
+    dlq      = aws_sqs_queue.notification_dlq.url
+  }
+}
+
+output "message_receipts_topic_arn" {
+  description = "Topic to set as the End User Messaging Social event destination when linking the WhatsApp Business Account"
+  value       = aws_sns_topic.message_receipts.arn
+}
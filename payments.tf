@@ -0,0 +1,34 @@
+# Stripe credentials for payment-service, injected into the task as
+# secrets. Terraform creates the parameters with placeholders; set the real
+# values out of band:
+#   aws ssm put-parameter --overwrite --type SecureString \
+#     --name /ecommerce-platform/stripe/secret-key --value sk_live_...
+resource "aws_ssm_parameter" "stripe_secret_key" {
+  name  = "/${var.project_name}/stripe/secret-key"
+  type  = "SecureString"
+  value = "replace-me"
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+
+  tags = {
+    Name        = "${var.project_name}-stripe-secret-key"
+    Environment = var.environment
+  }
+}
+
+resource "aws_ssm_parameter" "stripe_webhook_secret" {
+  name  = "/${var.project_name}/stripe/webhook-secret"
+  type  = "SecureString"
+  value = "replace-me"
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+
+  tags = {
+    Name        = "${var.project_name}-stripe-webhook-secret"
+    Environment = var.environment
+  }
+}
@@ -0,0 +1,218 @@
+// Package ads puts the ad platforms the optimizer and monitor work with
+// behind one interface, so their rules run the same way on Google Ads,
+// Microsoft Advertising and Meta accounts.
+//
+// Each platform reports performance, takes bid changes and takes offline
+// conversions in its own terms; a Platform translates them to Metrics,
+// BidChange and Conversion, with amounts in the account's currency.
+package ads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pkg/money"
+)
+
+// Platform names. They prefix the account IDs of every platform but
+// Google Ads; see Account.
+const (
+	Google    = "google"
+	Microsoft = "microsoft"
+	Meta      = "meta"
+)
+
+// Title is the platform's name as people know it, for reports.
+func Title(platform string) string {
+	switch platform {
+	case Microsoft:
+		return "Microsoft Advertising"
+	case Meta:
+		return "Meta Ads"
+	default:
+		return "Google Ads"
+	}
+}
+
+// Platform is one ad platform's API.
+type Platform interface {
+	// Name is the platform's name, one of the constants above.
+	Name() string
+
+	// FetchMetrics reports the account's performance over period at the
+	// granularity level names.
+	FetchMetrics(ctx context.Context, accountID string, level Level, period Period) ([]Metrics, error)
+
+	// UpdateBids sets the bids of the account's bid targets. Changes the
+	// platform rejects are returned as failures, indexed as in changes;
+	// an error means none were made.
+	UpdateBids(ctx context.Context, accountID string, changes []BidChange) ([]Failure, error)
+
+	// UploadConversions records offline conversions against the clicks
+	// or people that led to them, with failures reported as UpdateBids
+	// does.
+	UploadConversions(ctx context.Context, accountID string, conversions []Conversion) ([]Failure, error)
+}
+
+// ErrUnsupported is returned by platforms for operations they leave to
+// another part of the system.
+var ErrUnsupported = errors.New("ads: operation not supported by platform")
+
+// Account names an account on a platform. Its string form is the ID
+// prefixed with the platform and a colon, e.g. "microsoft:180012345" or
+// "meta:act_1234567890", except on Google Ads where it is the bare
+// customer ID, as stored before other platforms were added.
+type Account struct {
+	Platform string
+	ID       string
+}
+
+// ParseAccount reads an account's string form. IDs without a known
+// platform prefix are Google Ads customer IDs.
+func ParseAccount(s string) Account {
+	if platform, id, ok := strings.Cut(s, ":"); ok {
+		switch platform {
+		case Microsoft, Meta:
+			return Account{Platform: platform, ID: id}
+		}
+	}
+	return Account{Platform: Google, ID: s}
+}
+
+func (a Account) String() string {
+	if a.Platform == Google || a.Platform == "" {
+		return a.ID
+	}
+	return a.Platform + ":" + a.ID
+}
+
+// Level is the granularity FetchMetrics reports at.
+type Level int
+
+const (
+	// LevelCampaign reports one row per campaign.
+	LevelCampaign Level = iota
+	// LevelBidTarget reports one row per bid target: a keyword on Google
+	// Ads and Microsoft Advertising, an ad set on Meta.
+	LevelBidTarget
+	// LevelCampaignDay reports one row per campaign and day, with Date
+	// set.
+	LevelCampaignDay
+)
+
+// Campaign channel types, as Google Ads names its advertising channels.
+// Other platforms' campaigns are mapped to the nearest one, and Meta's are
+// all ChannelSocial.
+const (
+	ChannelSearch         = "SEARCH"
+	ChannelShopping       = "SHOPPING"
+	ChannelDisplay        = "DISPLAY"
+	ChannelPerformanceMax = "PERFORMANCE_MAX"
+	ChannelSocial         = "SOCIAL"
+)
+
+// Period is a range of whole days, both ends included, in the account's
+// time zone.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// LastDays is the n days before now's, the window Google Ads calls
+// LAST_n_DAYS.
+func LastDays(now time.Time, n int) Period {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return Period{Start: today.AddDate(0, 0, -n), End: today.AddDate(0, 0, -1)}
+}
+
+// Metrics is one campaign's or bid target's performance. Amounts are in
+// the account's currency. On Meta, which bids per ad set, the ad group
+// and keyword fields both hold the ad set.
+type Metrics struct {
+	CampaignID     string
+	CampaignName   string
+	CampaignStatus string
+	AdGroupID      string
+	AdGroupName    string
+	KeywordID      string
+	KeywordText    string
+
+	// ChannelType is the campaign's channel, one of the Channel constants
+	// or another Google Ads channel type. It is set on campaign rows.
+	ChannelType string
+	// Date is the day a LevelCampaignDay row covers, at midnight UTC.
+	Date time.Time
+
+	Impressions     int64
+	Clicks          int64
+	Conversions     float64
+	Cost            money.Money
+	ConversionValue money.Money
+
+	// CurrentBid is the target's manual bid. It is zero for campaigns
+	// and for targets the platform bids on automatically.
+	CurrentBid money.Money
+}
+
+// CTR is clicks per impression.
+func (m Metrics) CTR() float64 {
+	if m.Impressions == 0 {
+		return 0
+	}
+	return float64(m.Clicks) / float64(m.Impressions)
+}
+
+// ConversionRate is conversions per click.
+func (m Metrics) ConversionRate() float64 {
+	if m.Clicks == 0 {
+		return 0
+	}
+	return m.Conversions / float64(m.Clicks)
+}
+
+// AverageCPC is cost per click.
+func (m Metrics) AverageCPC() money.Money {
+	return m.Cost.Div(float64(m.Clicks))
+}
+
+// CostPerConversion is cost per conversion, zero without conversions.
+func (m Metrics) CostPerConversion() money.Money {
+	return m.Cost.Div(m.Conversions)
+}
+
+// BidChange sets one bid target's manual bid.
+type BidChange struct {
+	CampaignID string
+	AdGroupID  string
+	KeywordID  string
+	Bid        money.Money
+}
+
+// Conversion is an order to credit to the ad click that led to it. Email
+// is the customer's address, normalised and hashed with SHA-256 as the
+// platforms match on it. Conversions without anything the platform
+// matches on are returned as failures.
+type Conversion struct {
+	OrderID string
+	// ClickID is the platform's click ID from the landing URL: gclid,
+	// msclkid or fbclid.
+	ClickID string
+	// Name is the conversion goal or event the order counts toward.
+	Name  string
+	Email string
+	Time  time.Time
+	Value money.Money
+}
+
+// Failure is one change or conversion a platform rejected.
+type Failure struct {
+	Index int
+	Err   error
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("item %d: %v", f.Index, f.Err)
+}
@@ -0,0 +1,145 @@
+package ads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"pkg/retry"
+)
+
+// StatusError is an API response other than a success.
+type StatusError struct {
+	Platform string
+	Status   int
+	Body     string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s API returned %d", e.Platform, e.Status)
+	}
+	return fmt.Sprintf("%s API returned %d: %s", e.Platform, e.Status, e.Body)
+}
+
+// Retryable reports whether a failed platform call is worth another
+// attempt: rate limiting, server errors and network failures.
+func Retryable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Status == http.StatusTooManyRequests || status.Status >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// DefaultRetry is the retry policy platforms use unless given another.
+func DefaultRetry() retry.Policy {
+	return retry.Policy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Second,
+		MaxDelay:    15 * time.Second,
+		Jitter:      1,
+		Retryable:   Retryable,
+	}
+}
+
+// client sends a platform's HTTP requests, retrying transient failures.
+type client struct {
+	platform string
+	http     *http.Client
+	retry    retry.Policy
+}
+
+// do sends the request built by build, decoding a successful JSON
+// response into out when it is not nil. build is called for every
+// attempt so the body can be read again.
+func (c *client) do(ctx context.Context, build func(ctx context.Context) (*http.Request, error), out interface{}) error {
+	_, err := retry.Do(ctx, c.retry, func(ctx context.Context) error {
+		req, err := build(ctx)
+		if err != nil {
+			return retry.Permanent(fmt.Errorf("failed to build request: %w", err))
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			// URLs can carry access tokens; keep them out of errors.
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return &StatusError{Platform: c.platform, Status: resp.StatusCode, Body: truncate(string(body), 512)}
+		}
+		if out == nil {
+			return nil
+		}
+		if err := json.Unmarshal(body, out); err != nil {
+			return retry.Permanent(fmt.Errorf("failed to decode response: %w", err))
+		}
+		return nil
+	})
+	return err
+}
+
+// jsonRequest builds requests carrying body as JSON.
+func jsonRequest(method, target string, body interface{}, headers map[string]string) func(ctx context.Context) (*http.Request, error) {
+	return func(ctx context.Context) (*http.Request, error) {
+		var reader io.Reader
+		if body != nil {
+			encoded, err := json.Marshal(body)
+			if err != nil {
+				return nil, err
+			}
+			reader = bytes.NewReader(encoded)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, target, reader)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", "application/json")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		return req, nil
+	}
+}
+
+// formRequest builds POST requests carrying values as a form.
+func formRequest(target string, values url.Values) func(ctx context.Context) (*http.Request, error) {
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewBufferString(values.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,363 @@
+package ads
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/money"
+	"pkg/retry"
+)
+
+const (
+	metaGraphURL = "https://graph.facebook.com/v19.0"
+
+	// metaPurchaseAction is the pixel purchase event as insights report
+	// it.
+	metaPurchaseAction = "offsite_conversion.fb_pixel_purchase"
+	// metaPageSize is the rows asked for per insights or list page.
+	metaPageSize = 500
+	// metaEventsBatchSize is the most events one Conversions API request
+	// takes.
+	metaEventsBatchSize = 1000
+)
+
+// MetaConfig is the Meta part of the platforms secret. GraphURL defaults
+// to the production Graph API.
+type MetaConfig struct {
+	AccessToken  string   `json:"access_token"`
+	AppSecret    string   `json:"app_secret"`
+	AdAccountIDs []string `json:"ad_account_ids"`
+
+	// PixelID is the pixel conversions are sent to through the
+	// Conversions API.
+	PixelID string `json:"pixel_id"`
+	// ConversionAction is the insights action counted as a conversion;
+	// it defaults to the pixel's purchase event.
+	ConversionAction string `json:"conversion_action"`
+
+	GraphURL string `json:"graph_url,omitempty"`
+}
+
+// MetaPlatform is the Meta Marketing API. Meta bids per ad set, so bid
+// targets are ad sets with a bid cap or cost cap; ad sets bid on
+// automatically report no current bid.
+type MetaPlatform struct {
+	cfg    MetaConfig
+	client client
+	proof  string
+}
+
+// NewMeta returns the Meta platform for cfg.
+func NewMeta(cfg MetaConfig, httpClient *http.Client, policy retry.Policy) *MetaPlatform {
+	if cfg.GraphURL == "" {
+		cfg.GraphURL = metaGraphURL
+	}
+	if cfg.ConversionAction == "" {
+		cfg.ConversionAction = metaPurchaseAction
+	}
+	p := &MetaPlatform{
+		cfg:    cfg,
+		client: client{platform: "Meta", http: httpClient, retry: policy},
+	}
+	// appsecret_proof ties calls to the app, for apps that require it.
+	if cfg.AppSecret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.AppSecret))
+		mac.Write([]byte(cfg.AccessToken))
+		p.proof = hex.EncodeToString(mac.Sum(nil))
+	}
+	return p
+}
+
+func (p *MetaPlatform) Name() string { return Meta }
+
+// auth adds the access token, and the proof when there is one.
+func (p *MetaPlatform) auth(values url.Values) url.Values {
+	values.Set("access_token", p.cfg.AccessToken)
+	if p.proof != "" {
+		values.Set("appsecret_proof", p.proof)
+	}
+	return values
+}
+
+// actID is an ad account ID with the act_ prefix the Graph API expects.
+func actID(accountID string) string {
+	if strings.HasPrefix(accountID, "act_") {
+		return accountID
+	}
+	return "act_" + accountID
+}
+
+type metaAction struct {
+	ActionType string `json:"action_type"`
+	Value      string `json:"value"`
+}
+
+type metaInsight struct {
+	CampaignID      string       `json:"campaign_id"`
+	CampaignName    string       `json:"campaign_name"`
+	AdSetID         string       `json:"adset_id"`
+	AdSetName       string       `json:"adset_name"`
+	Impressions     string       `json:"impressions"`
+	Clicks          string       `json:"clicks"`
+	Spend           string       `json:"spend"`
+	Actions         []metaAction `json:"actions"`
+	ActionValues    []metaAction `json:"action_values"`
+	AccountCurrency string       `json:"account_currency"`
+	DateStart       string       `json:"date_start"`
+}
+
+type metaPage[T any] struct {
+	Data   []T `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+// list reads every page of a Graph API edge.
+func list[T any](ctx context.Context, p *MetaPlatform, path string, values url.Values) ([]T, error) {
+	values.Set("limit", strconv.Itoa(metaPageSize))
+	target := p.cfg.GraphURL + "/" + path + "?" + p.auth(values).Encode()
+	var out []T
+	for target != "" {
+		var page metaPage[T]
+		if err := p.client.do(ctx, jsonRequest(http.MethodGet, target, nil, nil), &page); err != nil {
+			return nil, err
+		}
+		out = append(out, page.Data...)
+		target = page.Paging.Next
+	}
+	return out, nil
+}
+
+// FetchMetrics reads campaign or ad set insights over period, daily for
+// LevelCampaignDay. Ad set rows carry the ad set's bid amount, campaign
+// rows the campaign's status.
+func (p *MetaPlatform) FetchMetrics(ctx context.Context, accountID string, level Level, period Period) ([]Metrics, error) {
+	act := actID(accountID)
+	campaigns := level == LevelCampaign || level == LevelCampaignDay
+	insightLevel := "adset"
+	if campaigns {
+		insightLevel = "campaign"
+	}
+	timeRange, err := json.Marshal(map[string]string{
+		"since": period.Start.Format("2006-01-02"),
+		"until": period.End.Format("2006-01-02"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{
+		"level":      {insightLevel},
+		"fields":     {"campaign_id,campaign_name,adset_id,adset_name,impressions,clicks,spend,actions,action_values,account_currency"},
+		"time_range": {string(timeRange)},
+	}
+	if level == LevelCampaignDay {
+		params.Set("time_increment", "1")
+	}
+	insights, err := list[metaInsight](ctx, p, act+"/insights", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read insights: %w", err)
+	}
+
+	var bids, statuses map[string]string
+	if campaigns {
+		statuses, err = p.fieldByID(ctx, act+"/campaigns", "effective_status")
+	} else {
+		bids, err = p.fieldByID(ctx, act+"/adsets", "bid_amount")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Metrics, 0, len(insights))
+	for _, in := range insights {
+		currency := in.AccountCurrency
+		if currency == "" {
+			return nil, fmt.Errorf("insights for campaign %s have no currency", in.CampaignID)
+		}
+		m := Metrics{
+			CampaignID:      in.CampaignID,
+			CampaignName:    in.CampaignName,
+			CampaignStatus:  statuses[in.CampaignID],
+			Impressions:     int64(parseNumber(in.Impressions)),
+			Clicks:          int64(parseNumber(in.Clicks)),
+			Conversions:     actionValue(in.Actions, p.cfg.ConversionAction),
+			Cost:            money.FromUnits(parseNumber(in.Spend), currency),
+			ConversionValue: money.FromUnits(actionValue(in.ActionValues, p.cfg.ConversionAction), currency),
+		}
+		if campaigns {
+			m.ChannelType = ChannelSocial
+		}
+		if level == LevelCampaignDay {
+			if m.Date, err = time.Parse("2006-01-02", in.DateStart); err != nil {
+				return nil, fmt.Errorf("insights for campaign %s have no date: %w", in.CampaignID, err)
+			}
+		}
+		if level == LevelBidTarget {
+			m.AdGroupID, m.AdGroupName = in.AdSetID, in.AdSetName
+			m.KeywordID, m.KeywordText = in.AdSetID, in.AdSetName
+			if bid := parseNumber(bids[in.AdSetID]); bid > 0 {
+				m.CurrentBid = money.FromUnits(bid/metaMinorUnits(currency), currency)
+			}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// fieldByID lists an edge's objects with one field, keyed by ID.
+func (p *MetaPlatform) fieldByID(ctx context.Context, path, field string) (map[string]string, error) {
+	objects, err := list[map[string]interface{}](ctx, p, path, url.Values{"fields": {"id," + field}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", path, err)
+	}
+	out := make(map[string]string, len(objects))
+	for _, object := range objects {
+		id, _ := object["id"].(string)
+		if value, ok := object[field]; ok && id != "" {
+			out[id] = fmt.Sprint(value)
+		}
+	}
+	return out, nil
+}
+
+func actionValue(actions []metaAction, actionType string) float64 {
+	for _, action := range actions {
+		if action.ActionType == actionType {
+			return parseNumber(action.Value)
+		}
+	}
+	return 0
+}
+
+// metaZeroDecimal are the currencies Meta amounts are whole units of;
+// all others are in hundredths.
+var metaZeroDecimal = map[string]bool{
+	"CLP": true, "COP": true, "CRC": true, "HUF": true, "ISK": true, "IDR": true,
+	"JPY": true, "KRW": true, "PYG": true, "TWD": true, "VND": true,
+}
+
+// metaMinorUnits is how many of Meta's bid units make one unit of
+// currency.
+func metaMinorUnits(currency string) float64 {
+	if metaZeroDecimal[currency] {
+		return 1
+	}
+	return 100
+}
+
+// UpdateBids sets ad set bid amounts, one call per ad set. Ad sets bid on
+// automatically reject a bid amount, which comes back as their failure.
+func (p *MetaPlatform) UpdateBids(ctx context.Context, accountID string, changes []BidChange) ([]Failure, error) {
+	var failures []Failure
+	for i, change := range changes {
+		amount := int64(change.Bid.Units()*metaMinorUnits(change.Bid.Currency) + 0.5)
+		values := p.auth(url.Values{"bid_amount": {strconv.FormatInt(amount, 10)}})
+		var resp struct {
+			Success bool `json:"success"`
+		}
+		err := p.client.do(ctx, formRequest(p.cfg.GraphURL+"/"+url.PathEscape(change.KeywordID), values), &resp)
+		if err == nil && !resp.Success {
+			err = errors.New("Meta did not confirm the update")
+		}
+		if err != nil {
+			failures = append(failures, Failure{Index: i, Err: err})
+		}
+	}
+	if len(changes) > 0 && len(failures) == len(changes) {
+		return nil, fmt.Errorf("failed to update ad set bids: %w", failures[0].Err)
+	}
+	return failures, nil
+}
+
+// UploadConversions sends conversions to the pixel through the
+// Conversions API, matched on the fbclid and hashed email. The order ID is
+// the event ID, so Meta deduplicates them against the browser pixel's
+// purchase events.
+func (p *MetaPlatform) UploadConversions(ctx context.Context, accountID string, conversions []Conversion) ([]Failure, error) {
+	if p.cfg.PixelID == "" {
+		return nil, errors.New("no Meta pixel is configured for conversions")
+	}
+	type userData struct {
+		Email []string `json:"em,omitempty"`
+		FBC   string   `json:"fbc,omitempty"`
+	}
+	type event struct {
+		EventName    string                 `json:"event_name"`
+		EventTime    int64                  `json:"event_time"`
+		EventID      string                 `json:"event_id"`
+		ActionSource string                 `json:"action_source"`
+		UserData     userData               `json:"user_data"`
+		CustomData   map[string]interface{} `json:"custom_data"`
+	}
+
+	var failures []Failure
+	var sendable []int
+	for i, c := range conversions {
+		if c.ClickID == "" && c.Email == "" {
+			failures = append(failures, Failure{Index: i, Err: errors.New("no fbclid or email to match on")})
+			continue
+		}
+		sendable = append(sendable, i)
+	}
+
+	var calls, failedCalls int
+	for _, batch := range chunk(sendable, metaEventsBatchSize) {
+		events := make([]event, 0, len(batch))
+		for _, i := range batch {
+			c := conversions[i]
+			name := c.Name
+			if name == "" {
+				name = "Purchase"
+			}
+			e := event{
+				EventName:    name,
+				EventTime:    c.Time.Unix(),
+				EventID:      c.OrderID,
+				ActionSource: "website",
+				CustomData: map[string]interface{}{
+					"currency": c.Value.Currency,
+					"value":    c.Value.Units(),
+					"order_id": c.OrderID,
+				},
+			}
+			if c.Email != "" {
+				e.UserData.Email = []string{c.Email}
+			}
+			if c.ClickID != "" {
+				e.UserData.FBC = fmt.Sprintf("fb.1.%d.%s", c.Time.UnixMilli(), c.ClickID)
+			}
+			events = append(events, e)
+		}
+
+		target := p.cfg.GraphURL + "/" + url.PathEscape(p.cfg.PixelID) + "/events?" + p.auth(url.Values{}).Encode()
+		var resp struct {
+			EventsReceived int `json:"events_received"`
+		}
+		calls++
+		err := p.client.do(ctx, jsonRequest(http.MethodPost, target, map[string]interface{}{"data": events}, nil), &resp)
+		if err == nil && resp.EventsReceived != len(events) {
+			err = fmt.Errorf("Meta received %d of %d events", resp.EventsReceived, len(events))
+		}
+		if err != nil {
+			failedCalls++
+			for _, i := range batch {
+				failures = append(failures, Failure{Index: i, Err: err})
+			}
+		}
+	}
+	if calls > 0 && failedCalls == calls {
+		return nil, fmt.Errorf("failed to send conversions: %w", failures[len(failures)-1].Err)
+	}
+	return failures, nil
+}
@@ -0,0 +1,560 @@
+package ads
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/money"
+	"pkg/retry"
+)
+
+// Microsoft Advertising API v13 endpoints.
+const (
+	microsoftTokenURL     = "https://login.microsoftonline.com/common/oauth2/v2.0/token"
+	microsoftCampaignURL  = "https://campaign.api.bingads.microsoft.com/CampaignManagement/v13"
+	microsoftReportingURL = "https://reporting.api.bingads.microsoft.com/Reporting/v13"
+	microsoftScope        = "https://ads.microsoft.com/msads.manage offline_access"
+
+	// microsoftBatchSize is the most keywords or offline conversions one
+	// Campaign Management call takes.
+	microsoftBatchSize = 1000
+	// microsoftPollInterval is how often a submitted report is checked.
+	microsoftPollInterval = 5 * time.Second
+)
+
+// MicrosoftConfig is the Microsoft Advertising part of the platforms
+// secret. The URLs default to the production API; they are set to point
+// the client at a stand-in.
+type MicrosoftConfig struct {
+	ClientID       string   `json:"client_id"`
+	ClientSecret   string   `json:"client_secret"`
+	RefreshToken   string   `json:"refresh_token"`
+	DeveloperToken string   `json:"developer_token"`
+	CustomerID     string   `json:"customer_id"`
+	AccountIDs     []string `json:"account_ids"`
+
+	// ConversionGoal is the offline conversion goal orders are uploaded
+	// to when a Conversion names none.
+	ConversionGoal string `json:"conversion_goal"`
+
+	TokenURL     string `json:"token_url,omitempty"`
+	CampaignURL  string `json:"campaign_url,omitempty"`
+	ReportingURL string `json:"reporting_url,omitempty"`
+}
+
+// MicrosoftPlatform is the Microsoft Advertising API. Reports come from
+// the Reporting service, bids and offline conversions go to Campaign
+// Management.
+type MicrosoftPlatform struct {
+	cfg    MicrosoftConfig
+	client client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewMicrosoft returns the Microsoft Advertising platform for cfg.
+func NewMicrosoft(cfg MicrosoftConfig, httpClient *http.Client, policy retry.Policy) *MicrosoftPlatform {
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = microsoftTokenURL
+	}
+	if cfg.CampaignURL == "" {
+		cfg.CampaignURL = microsoftCampaignURL
+	}
+	if cfg.ReportingURL == "" {
+		cfg.ReportingURL = microsoftReportingURL
+	}
+	return &MicrosoftPlatform{
+		cfg:    cfg,
+		client: client{platform: "Microsoft Advertising", http: httpClient, retry: policy},
+	}
+}
+
+func (p *MicrosoftPlatform) Name() string { return Microsoft }
+
+// accessToken returns an OAuth access token for the refresh token,
+// renewing it a minute before it expires.
+func (p *MicrosoftPlatform) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Before(p.expires) {
+		return p.token, nil
+	}
+
+	values := url.Values{
+		"client_id":     {p.cfg.ClientID},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {p.cfg.RefreshToken},
+		"scope":         {microsoftScope},
+	}
+	if p.cfg.ClientSecret != "" {
+		values.Set("client_secret", p.cfg.ClientSecret)
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := p.client.do(ctx, formRequest(p.cfg.TokenURL, values), &resp); err != nil {
+		return "", fmt.Errorf("failed to refresh Microsoft Advertising token: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return "", errors.New("Microsoft Advertising token response has no access token")
+	}
+	p.token = resp.AccessToken
+	p.expires = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
+
+// call sends a JSON request to one of the services for accountID.
+func (p *MicrosoftPlatform) call(ctx context.Context, method, target, accountID string, body, out interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	return p.client.do(ctx, jsonRequest(method, target, body, map[string]string{
+		"Authorization":     "Bearer " + token,
+		"DeveloperToken":    p.cfg.DeveloperToken,
+		"CustomerId":        p.cfg.CustomerID,
+		"CustomerAccountId": accountID,
+	}), out)
+}
+
+// Report columns read from the keyword and campaign performance reports.
+var (
+	microsoftKeywordColumns = []string{
+		"CampaignId", "CampaignName", "AdGroupId", "AdGroupName", "KeywordId", "Keyword",
+		"CurrentMaxCpc", "Impressions", "Clicks", "Spend", "Conversions", "Revenue", "CurrencyCode",
+	}
+	microsoftCampaignColumns = []string{
+		"CampaignId", "CampaignName", "CampaignStatus", "CampaignType",
+		"Impressions", "Clicks", "Spend", "Conversions", "Revenue", "CurrencyCode",
+	}
+)
+
+type microsoftDate struct {
+	Day   int `json:"Day"`
+	Month int `json:"Month"`
+	Year  int `json:"Year"`
+}
+
+func toMicrosoftDate(t time.Time) microsoftDate {
+	return microsoftDate{Day: t.Day(), Month: int(t.Month()), Year: t.Year()}
+}
+
+// FetchMetrics runs a keyword or campaign performance report over period,
+// daily for LevelCampaignDay, and reads it once it is ready. Reports are generated asynchronously;
+// ctx bounds how long it waits.
+func (p *MicrosoftPlatform) FetchMetrics(ctx context.Context, accountID string, level Level, period Period) ([]Metrics, error) {
+	account, err := strconv.ParseInt(accountID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Microsoft Advertising account ID %q", accountID)
+	}
+	reportType, columns, aggregation := "KeywordPerformanceReportRequest", microsoftKeywordColumns, "Summary"
+	switch level {
+	case LevelCampaign:
+		reportType, columns = "CampaignPerformanceReportRequest", microsoftCampaignColumns
+	case LevelCampaignDay:
+		reportType, aggregation = "CampaignPerformanceReportRequest", "Daily"
+		columns = append([]string{"TimePeriod"}, microsoftCampaignColumns...)
+	}
+
+	request := map[string]interface{}{
+		"ReportRequest": map[string]interface{}{
+			"Type":                   reportType,
+			"Format":                 "Csv",
+			"FormatVersion":          "2.0",
+			"ExcludeReportHeader":    true,
+			"ExcludeReportFooter":    true,
+			"ExcludeColumnHeaders":   false,
+			"ReturnOnlyCompleteData": false,
+			"Aggregation":            aggregation,
+			"Columns":                columns,
+			"Scope":                  map[string]interface{}{"AccountIds": []int64{account}},
+			"Time": map[string]interface{}{
+				"CustomDateRangeStart": toMicrosoftDate(period.Start),
+				"CustomDateRangeEnd":   toMicrosoftDate(period.End),
+			},
+		},
+	}
+	var submitted struct {
+		ReportRequestID string `json:"ReportRequestId"`
+	}
+	if err := p.call(ctx, http.MethodPost, p.cfg.ReportingURL+"/GenerateReport/Submit", accountID, request, &submitted); err != nil {
+		return nil, fmt.Errorf("failed to submit report: %w", err)
+	}
+
+	downloadURL, err := p.pollReport(ctx, accountID, submitted.ReportRequestID)
+	if err != nil {
+		return nil, err
+	}
+	if downloadURL == "" {
+		// The account had no activity in the period.
+		return nil, nil
+	}
+	rows, err := p.downloadReport(ctx, downloadURL)
+	if err != nil {
+		return nil, err
+	}
+	return microsoftMetrics(rows)
+}
+
+// pollReport waits for a submitted report and returns its download URL,
+// empty when the report has no rows.
+func (p *MicrosoftPlatform) pollReport(ctx context.Context, accountID, requestID string) (string, error) {
+	for {
+		var resp struct {
+			ReportRequestStatus struct {
+				ReportDownloadURL string `json:"ReportDownloadUrl"`
+				Status            string `json:"Status"`
+			} `json:"ReportRequestStatus"`
+		}
+		err := p.call(ctx, http.MethodPost, p.cfg.ReportingURL+"/GenerateReport/Poll", accountID,
+			map[string]string{"ReportRequestId": requestID}, &resp)
+		if err != nil {
+			return "", fmt.Errorf("failed to poll report %s: %w", requestID, err)
+		}
+		switch resp.ReportRequestStatus.Status {
+		case "Success":
+			return resp.ReportRequestStatus.ReportDownloadURL, nil
+		case "Pending":
+		default:
+			return "", fmt.Errorf("report %s ended with status %s", requestID, resp.ReportRequestStatus.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("report %s not ready: %w", requestID, ctx.Err())
+		case <-time.After(microsoftPollInterval):
+		}
+	}
+}
+
+// downloadReport reads the CSV in a report's zip into rows keyed by
+// column.
+func (p *MicrosoftPlatform) downloadReport(ctx context.Context, downloadURL string) ([]map[string]string, error) {
+	var archive []byte
+	_, err := retry.Do(ctx, p.client.retry, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+		if err != nil {
+			return retry.Permanent(err)
+		}
+		resp, err := p.client.http.Do(req)
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return &StatusError{Platform: p.client.platform, Status: resp.StatusCode}
+		}
+		archive, err = io.ReadAll(io.LimitReader(resp.Body, 256<<20))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download report: %w", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report archive: %w", err)
+	}
+	for _, file := range zr.File {
+		if !strings.HasSuffix(strings.ToLower(file.Name), ".csv") {
+			continue
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", file.Name, err)
+		}
+		defer f.Close()
+		return readCSV(f)
+	}
+	return nil, errors.New("report archive has no CSV")
+}
+
+// readCSV reads a CSV with a header row into rows keyed by column.
+func readCSV(r io.Reader) ([]map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.Trim(strings.TrimPrefix(header[i], "\ufeff"), `" `)
+	}
+
+	var rows []map[string]string
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report: %w", err)
+		}
+		row := make(map[string]string, len(header))
+		for i, value := range record {
+			if i < len(header) {
+				row[header[i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func microsoftMetrics(rows []map[string]string) ([]Metrics, error) {
+	out := make([]Metrics, 0, len(rows))
+	for _, row := range rows {
+		currency := row["CurrencyCode"]
+		if currency == "" {
+			return nil, fmt.Errorf("report row for campaign %s has no currency", row["CampaignId"])
+		}
+		m := Metrics{
+			CampaignID:      row["CampaignId"],
+			CampaignName:    row["CampaignName"],
+			CampaignStatus:  strings.ToUpper(row["CampaignStatus"]),
+			AdGroupID:       row["AdGroupId"],
+			AdGroupName:     row["AdGroupName"],
+			KeywordID:       row["KeywordId"],
+			KeywordText:     row["Keyword"],
+			Impressions:     int64(parseNumber(row["Impressions"])),
+			Clicks:          int64(parseNumber(row["Clicks"])),
+			Conversions:     parseNumber(row["Conversions"]),
+			Cost:            money.FromUnits(parseNumber(row["Spend"]), currency),
+			ConversionValue: money.FromUnits(parseNumber(row["Revenue"]), currency),
+			CurrentBid:      money.FromUnits(parseNumber(row["CurrentMaxCpc"]), currency),
+		}
+		if campaignType, ok := row["CampaignType"]; ok {
+			m.ChannelType = microsoftChannel(campaignType)
+		}
+		if period := row["TimePeriod"]; period != "" {
+			date, err := parseMicrosoftDay(period)
+			if err != nil {
+				return nil, err
+			}
+			m.Date = date
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// microsoftChannel maps a report's campaign type to its channel.
+func microsoftChannel(campaignType string) string {
+	switch strings.ToLower(strings.ReplaceAll(campaignType, " ", "")) {
+	case "shopping":
+		return ChannelShopping
+	case "audience":
+		return ChannelDisplay
+	case "performancemax":
+		return ChannelPerformanceMax
+	default:
+		return ChannelSearch
+	}
+}
+
+// parseMicrosoftDay reads a daily report's TimePeriod, which follows the
+// account's locale.
+func parseMicrosoftDay(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "1/2/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unreadable report date %q", s)
+}
+
+// parseNumber reads a report number, which may carry thousands
+// separators; anything unreadable, such as "--", is zero.
+func parseNumber(s string) float64 {
+	s = strings.TrimSuffix(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), "%")
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// microsoftPartialError is one rejected item of a batch call.
+type microsoftPartialError struct {
+	Index     int    `json:"Index"`
+	Code      int    `json:"Code"`
+	ErrorCode string `json:"ErrorCode"`
+	Message   string `json:"Message"`
+}
+
+type microsoftBatchResponse struct {
+	PartialErrors []*microsoftPartialError `json:"PartialErrors"`
+}
+
+// UpdateBids sets keyword bids, one UpdateKeywords call per ad group and
+// batch.
+func (p *MicrosoftPlatform) UpdateBids(ctx context.Context, accountID string, changes []BidChange) ([]Failure, error) {
+	type keyword struct {
+		ID  int64 `json:"Id"`
+		Bid struct {
+			Amount float64 `json:"Amount"`
+		} `json:"Bid"`
+	}
+
+	var failures []Failure
+	byAdGroup := make(map[string][]int)
+	var adGroups []string
+	for i, change := range changes {
+		if _, ok := byAdGroup[change.AdGroupID]; !ok {
+			adGroups = append(adGroups, change.AdGroupID)
+		}
+		byAdGroup[change.AdGroupID] = append(byAdGroup[change.AdGroupID], i)
+	}
+
+	var calls, failedCalls int
+	for _, adGroupID := range adGroups {
+		adGroup, err := strconv.ParseInt(adGroupID, 10, 64)
+		if err != nil {
+			for _, i := range byAdGroup[adGroupID] {
+				failures = append(failures, Failure{Index: i, Err: fmt.Errorf("invalid ad group ID %q", adGroupID)})
+			}
+			continue
+		}
+		for _, batch := range chunk(byAdGroup[adGroupID], microsoftBatchSize) {
+			var sent []int
+			var keywords []keyword
+			for _, i := range batch {
+				id, err := strconv.ParseInt(changes[i].KeywordID, 10, 64)
+				if err != nil {
+					failures = append(failures, Failure{Index: i, Err: fmt.Errorf("invalid keyword ID %q", changes[i].KeywordID)})
+					continue
+				}
+				k := keyword{ID: id}
+				k.Bid.Amount = changes[i].Bid.Units()
+				keywords = append(keywords, k)
+				sent = append(sent, i)
+			}
+			if len(keywords) == 0 {
+				continue
+			}
+
+			var resp microsoftBatchResponse
+			calls++
+			err := p.call(ctx, http.MethodPut, p.cfg.CampaignURL+"/Keywords", accountID, map[string]interface{}{
+				"AdGroupId": adGroup,
+				"Keywords":  keywords,
+			}, &resp)
+			if err != nil {
+				failedCalls++
+				for _, i := range sent {
+					failures = append(failures, Failure{Index: i, Err: err})
+				}
+				continue
+			}
+			failures = append(failures, microsoftFailures(resp.PartialErrors, sent)...)
+		}
+	}
+	if calls > 0 && failedCalls == calls {
+		return nil, fmt.Errorf("failed to update keyword bids: %w", failures[len(failures)-1].Err)
+	}
+	return failures, nil
+}
+
+// UploadConversions applies offline conversions to the Microsoft click
+// IDs they came from.
+func (p *MicrosoftPlatform) UploadConversions(ctx context.Context, accountID string, conversions []Conversion) ([]Failure, error) {
+	type offlineConversion struct {
+		ConversionCurrencyCode string  `json:"ConversionCurrencyCode"`
+		ConversionName         string  `json:"ConversionName"`
+		ConversionTime         string  `json:"ConversionTime"`
+		ConversionValue        float64 `json:"ConversionValue"`
+		MicrosoftClickID       string  `json:"MicrosoftClickId"`
+	}
+
+	var failures []Failure
+	var sendable []int
+	var calls, failedCalls int
+	for i, c := range conversions {
+		if c.ClickID == "" {
+			failures = append(failures, Failure{Index: i, Err: errors.New("no Microsoft click ID")})
+			continue
+		}
+		sendable = append(sendable, i)
+	}
+
+	for _, batch := range chunk(sendable, microsoftBatchSize) {
+		items := make([]offlineConversion, 0, len(batch))
+		for _, i := range batch {
+			c := conversions[i]
+			name := c.Name
+			if name == "" {
+				name = p.cfg.ConversionGoal
+			}
+			items = append(items, offlineConversion{
+				ConversionCurrencyCode: c.Value.Currency,
+				ConversionName:         name,
+				ConversionTime:         c.Time.UTC().Format("2006-01-02T15:04:05Z"),
+				ConversionValue:        c.Value.Units(),
+				MicrosoftClickID:       c.ClickID,
+			})
+		}
+
+		var resp microsoftBatchResponse
+		calls++
+		err := p.call(ctx, http.MethodPost, p.cfg.CampaignURL+"/OfflineConversions/Apply", accountID,
+			map[string]interface{}{"OfflineConversions": items}, &resp)
+		if err != nil {
+			failedCalls++
+			for _, i := range batch {
+				failures = append(failures, Failure{Index: i, Err: err})
+			}
+			continue
+		}
+		failures = append(failures, microsoftFailures(resp.PartialErrors, batch)...)
+	}
+	if calls > 0 && failedCalls == calls {
+		return nil, fmt.Errorf("failed to apply offline conversions: %w", failures[len(failures)-1].Err)
+	}
+	return failures, nil
+}
+
+// microsoftFailures maps a batch's partial errors back to the indexes of
+// the items sent in it.
+func microsoftFailures(partial []*microsoftPartialError, sent []int) []Failure {
+	var failures []Failure
+	for _, e := range partial {
+		if e == nil || e.Index < 0 || e.Index >= len(sent) {
+			continue
+		}
+		failures = append(failures, Failure{Index: sent[e.Index], Err: fmt.Errorf("%s: %s", e.ErrorCode, e.Message)})
+	}
+	return failures
+}
+
+// chunk splits indexes into runs of at most n.
+func chunk(indexes []int, n int) [][]int {
+	var out [][]int
+	for len(indexes) > n {
+		out = append(out, indexes[:n])
+		indexes = indexes[n:]
+	}
+	if len(indexes) > 0 {
+		out = append(out, indexes)
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package ads
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"pkg/retry"
+)
+
+// Config is the platforms secret: the credentials and accounts of every
+// platform besides Google Ads, whose credentials have their own secret.
+// Platforms left out are not used.
+type Config struct {
+	Microsoft *MicrosoftConfig `json:"microsoft,omitempty"`
+	Meta      *MetaConfig      `json:"meta,omitempty"`
+}
+
+// Registry holds the configured platforms and their accounts.
+type Registry struct {
+	platforms map[string]Platform
+	accounts  []Account
+}
+
+// ParseConfig reads the platforms secret.
+func ParseConfig(raw []byte) (Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to decode platforms config: %w", err)
+	}
+	return cfg, nil
+}
+
+// NewRegistry returns the platforms cfg configures, calling their APIs
+// with policy's retries.
+func NewRegistry(cfg Config, policy retry.Policy) *Registry {
+	httpClient := &http.Client{Timeout: 60 * time.Second}
+	r := &Registry{platforms: make(map[string]Platform)}
+	if cfg.Microsoft != nil {
+		r.platforms[Microsoft] = NewMicrosoft(*cfg.Microsoft, httpClient, policy)
+		for _, id := range cfg.Microsoft.AccountIDs {
+			r.accounts = append(r.accounts, Account{Platform: Microsoft, ID: id})
+		}
+	}
+	if cfg.Meta != nil {
+		r.platforms[Meta] = NewMeta(*cfg.Meta, httpClient, policy)
+		for _, id := range cfg.Meta.AdAccountIDs {
+			r.accounts = append(r.accounts, Account{Platform: Meta, ID: actID(id)})
+		}
+	}
+	sort.Slice(r.accounts, func(i, j int) bool { return r.accounts[i].String() < r.accounts[j].String() })
+	return r
+}
+
+// Add registers a platform configured elsewhere, such as the Google Ads
+// adapter each function builds around its own client.
+func (r *Registry) Add(p Platform) {
+	r.platforms[p.Name()] = p
+}
+
+// Platform returns the named platform.
+func (r *Registry) Platform(name string) (Platform, error) {
+	p, ok := r.platforms[name]
+	if !ok {
+		return nil, fmt.Errorf("ad platform %q is not configured", name)
+	}
+	return p, nil
+}
+
+// Accounts are the accounts of the configured platforms, sorted by their
+// string form.
+func (r *Registry) Accounts() []Account {
+	return r.accounts
+}
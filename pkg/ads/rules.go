@@ -0,0 +1,48 @@
+package ads
+
+import "fmt"
+
+// Recommendation types, set by the bidding rules in pkg/bidrules.
+const (
+	IncreaseBid      = "INCREASE_BID"
+	DecreaseBid      = "DECREASE_BID"
+	ModerateIncrease = "MODERATE_INCREASE"
+	NoChange         = "NO_CHANGE"
+)
+
+// AlertRules are the campaign alerting rules shared by every platform.
+// Costs are in Currency, the account's.
+type AlertRules struct {
+	Currency string
+
+	LowCTR                float64
+	LowCTRMinImpressions  int64
+	HighCostNoConversions float64
+	HighCPC               float64
+}
+
+// Campaign alert types raised by Check.
+const (
+	AlertLowPerformance        = "LOW_PERFORMANCE"
+	AlertHighCostNoConversions = "HIGH_COST_NO_CONVERSIONS"
+	AlertHighCPC               = "HIGH_CPC"
+)
+
+// Check returns the type and message of the first alert the campaign's
+// metrics raise, or an empty type when they raise none.
+func (r AlertRules) Check(m Metrics) (string, string) {
+	ctr := m.CTR()
+	cost := m.Cost
+	cpc := m.AverageCPC()
+
+	if m.Impressions > r.LowCTRMinImpressions && ctr < r.LowCTR {
+		return AlertLowPerformance, fmt.Sprintf("Campaign '%s' has low CTR: %.2f%%", m.CampaignName, ctr*100)
+	}
+	if cost.Units() > r.HighCostNoConversions && m.Conversions == 0 {
+		return AlertHighCostNoConversions, fmt.Sprintf("Campaign '%s' has high cost (%s) with no conversions", m.CampaignName, cost)
+	}
+	if cpc.Units() > r.HighCPC {
+		return AlertHighCPC, fmt.Sprintf("Campaign '%s' has high CPC: %s", m.CampaignName, cpc)
+	}
+	return "", ""
+}
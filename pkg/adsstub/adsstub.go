@@ -0,0 +1,213 @@
+// Package adsstub is a stand-in for the Google Ads REST API: search,
+// searchStream and mutate answered from canned fixtures, with the calls
+// recorded. cmd/e2e runs it for its assertions and cmd/googleads-stub for
+// local development (see docs/LOCAL_DEVELOPMENT.md); point a function at
+// it with GOOGLE_ADS_ENDPOINT.
+package adsstub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Fixtures are the canned Google Ads responses. A search gets the results
+// of the first response whose Match strings all occur in its query, and no
+// rows when none match.
+type Fixtures struct {
+	Responses []Response `json:"responses"`
+}
+
+// Response is one canned search result.
+type Response struct {
+	Name    string            `json:"name"`
+	Match   []string          `json:"match"`
+	Results []json.RawMessage `json:"results"`
+}
+
+// SearchCall and MutateCall record the requests the functions made, for
+// assertions.
+type SearchCall struct {
+	CustomerID string
+	Query      string
+	Fixture    string
+}
+
+type MutateCall struct {
+	CustomerID string
+	Resource   string
+	Operations []json.RawMessage
+}
+
+// Server serves the Google Ads REST API's search, searchStream and mutate
+// methods from fixtures.
+type Server struct {
+	// Verbose logs every call, and the queries no fixture matched.
+	Verbose bool
+
+	fixtures Fixtures
+
+	mu       sync.Mutex
+	searches []SearchCall
+	mutates  []MutateCall
+}
+
+// adsPath matches e.g. /v15/customers/1234567890/googleAds:searchStream and
+// /v15/customers/1234567890/campaignCriteria:mutate.
+var adsPath = regexp.MustCompile(`^/v\d+/customers/(\d+)/(\w+):(\w+)$`)
+
+// Load reads the fixtures at path, a JSON Fixtures document.
+func Load(path string) (*Server, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Google Ads fixtures: %w", err)
+	}
+	var fixtures Fixtures
+	if err := json.Unmarshal(raw, &fixtures); err != nil {
+		return nil, fmt.Errorf("failed to parse Google Ads fixtures: %w", err)
+	}
+	return &Server{fixtures: fixtures}, nil
+}
+
+// Start serves the stub on addr, such as "127.0.0.1:0" for any free port;
+// the returned server's URL is the GOOGLE_ADS_ENDPOINT to use.
+func (m *Server) Start(addr string) (*httptest.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the Google Ads stub: %w", err)
+	}
+	srv := httptest.NewUnstartedServer(m)
+	srv.Listener.Close()
+	srv.Listener = listener
+	srv.Start()
+	return srv, nil
+}
+
+func (m *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	match := adsPath.FindStringSubmatch(r.URL.Path)
+	if r.Method != http.MethodPost || match == nil {
+		http.NotFound(w, r)
+		return
+	}
+	customerID, resource, method := match[1], match[2], match[3]
+
+	switch {
+	case resource == "googleAds" && (method == "search" || method == "searchStream"):
+		var req struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fixture := m.match(req.Query)
+		if m.Verbose {
+			if fixture.Name == "" {
+				log.Printf("%s %s: no fixture matches %s", customerID, method, req.Query)
+			} else {
+				log.Printf("%s %s: %s, %d rows", customerID, method, fixture.Name, len(fixture.Results))
+			}
+		}
+		m.mu.Lock()
+		m.searches = append(m.searches, SearchCall{CustomerID: customerID, Query: req.Query, Fixture: fixture.Name})
+		m.mu.Unlock()
+
+		results := fixture.Results
+		if results == nil {
+			results = []json.RawMessage{}
+		}
+		if method == "searchStream" {
+			// The streaming method answers an array of batches; one will do.
+			writeJSON(w, []map[string]interface{}{{"results": results}})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"results": results})
+
+	case method == "mutate":
+		var req struct {
+			Operations []json.RawMessage `json:"operations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if m.Verbose {
+			log.Printf("%s %s:mutate, %d operations", customerID, resource, len(req.Operations))
+		}
+		m.mu.Lock()
+		m.mutates = append(m.mutates, MutateCall{CustomerID: customerID, Resource: resource, Operations: req.Operations})
+		m.mu.Unlock()
+
+		results := make([]map[string]string, len(req.Operations))
+		for i := range results {
+			results[i] = map[string]string{"resourceName": fmt.Sprintf("customers/%s/%s/e2e~%d", customerID, resource, i)}
+		}
+		writeJSON(w, map[string]interface{}{"results": results})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *Server) match(query string) Response {
+	for _, f := range m.fixtures.Responses {
+		matched := true
+		for _, s := range f.Match {
+			if !strings.Contains(query, s) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return f
+		}
+	}
+	return Response{}
+}
+
+// Mutates returns the mutate calls made to resource so far.
+func (m *Server) Mutates(resource string) []MutateCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []MutateCall
+	for _, c := range m.mutates {
+		if c.Resource == resource {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls between steps.
+func (m *Server) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.searches = nil
+	m.mutates = nil
+}
+
+// Unmatched returns the searches no fixture answered, which usually means
+// a query changed and the fixtures need updating.
+func (m *Server) Unmatched() []SearchCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []SearchCall
+	for _, c := range m.searches {
+		if c.Fixture == "" {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
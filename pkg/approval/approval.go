@@ -0,0 +1,249 @@
+// Package approval holds bid changes for a person to approve before they
+// reach Google Ads. bid-optimizer files each keyword bid recommendation as
+// an Item: small changes are approved on the spot, the rest wait as
+// PENDING until someone approves or rejects them through the ads-api, or
+// until their decision window closes. bid-applier applies what was
+// approved.
+//
+//	PENDING ──approve──▶ APPROVED ──apply──▶ APPLIED | APPLY_FAILED
+//	   │
+//	   ├──reject──▶ REJECTED
+//	   └──window closes──▶ EXPIRED
+//
+// Notifications carry one-click approve and reject links signed by a
+// Signer, so a decision can be made from Slack or email without a token.
+package approval
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/money"
+)
+
+// Item statuses.
+const (
+	StatusPending     = "PENDING"
+	StatusApproved    = "APPROVED"
+	StatusRejected    = "REJECTED"
+	StatusExpired     = "EXPIRED"
+	StatusApplied     = "APPLIED"
+	StatusApplyFailed = "APPLY_FAILED"
+)
+
+// KindKeywordBid is a keyword's max CPC bid change.
+const KindKeywordBid = "KEYWORD_BID"
+
+// AutoApprover is the DecidedBy of items approved for being below the
+// impact threshold.
+const AutoApprover = "auto"
+
+// StatusIndex is the table's global secondary index on status, sorted by
+// approval ID and so by creation time.
+const StatusIndex = "status-index"
+
+// retention is how long items are kept after they are created.
+const retention = 90 * 24 * time.Hour
+
+var (
+	// ErrNotPending is returned when deciding an item that has already
+	// been decided or has expired.
+	ErrNotPending = errors.New("approval is no longer pending")
+	// ErrWindowClosed is returned when deciding a pending item after its
+	// DecideBy.
+	ErrWindowClosed = errors.New("approval window has closed")
+)
+
+// Item is one change awaiting, or past, a decision. Bids are in the
+// account currency; Impact is the change's estimated effect on daily
+// spend at the keyword's current click volume.
+type Item struct {
+	ApprovalID string `json:"approval_id" dynamodbav:"approval_id"`
+	Kind       string `json:"kind" dynamodbav:"kind"`
+	Status     string `json:"status" dynamodbav:"status"`
+	CustomerID string `json:"customer_id" dynamodbav:"customer_id"`
+	RunID      string `json:"run_id" dynamodbav:"run_id"`
+	ConfigHash string `json:"config_hash" dynamodbav:"config_hash"`
+
+	CampaignID     string      `json:"campaign_id" dynamodbav:"campaign_id"`
+	CampaignName   string      `json:"campaign_name" dynamodbav:"campaign_name"`
+	AdGroupID      string      `json:"ad_group_id" dynamodbav:"ad_group_id"`
+	KeywordID      string      `json:"keyword_id" dynamodbav:"keyword_id"`
+	KeywordText    string      `json:"keyword_text" dynamodbav:"keyword_text"`
+	CurrentBid     money.Money `json:"current_bid" dynamodbav:"current_bid"`
+	RecommendedBid money.Money `json:"recommended_bid" dynamodbav:"recommended_bid"`
+	Impact         money.Money `json:"impact" dynamodbav:"impact"`
+	Reason         string      `json:"reason" dynamodbav:"reason"`
+
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+	// DecideBy is stored as Unix seconds so conditions can compare it.
+	DecideBy  time.Time  `json:"decide_by" dynamodbav:"decide_by,unixtime"`
+	DecidedBy string     `json:"decided_by,omitempty" dynamodbav:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty" dynamodbav:"decided_at,omitempty"`
+	Note      string     `json:"note,omitempty" dynamodbav:"note,omitempty"`
+	AppliedAt *time.Time `json:"applied_at,omitempty" dynamodbav:"applied_at,omitempty"`
+	Error     string     `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	ExpiresAt int64      `json:"-" dynamodbav:"expires_at"`
+}
+
+// Store keeps items in a DynamoDB table keyed by approval_id, with
+// StatusIndex.
+type Store struct {
+	table *dynamo.Table
+	clock clock.Clock
+}
+
+func NewStore(table *dynamo.Table, clk clock.Clock) *Store {
+	return &Store{table: table, clock: clk}
+}
+
+func key(id string) dynamo.Key {
+	return dynamo.StringKey("approval_id", id)
+}
+
+// Create stores a new item, stamping its creation and retention times.
+func (s *Store) Create(ctx context.Context, item *Item) error {
+	item.CreatedAt = s.clock.Now().UTC()
+	item.ExpiresAt = item.CreatedAt.Add(retention).Unix()
+	return s.table.Put(ctx, item, dynamo.IfNotExists("approval_id"))
+}
+
+// Get returns the item, or dynamo.ErrNotFound.
+func (s *Store) Get(ctx context.Context, id string) (Item, error) {
+	return dynamo.Get[Item](ctx, s.table, key(id))
+}
+
+// List returns a page of items in status, oldest first, resuming after
+// the item with ID cursor when it is set.
+func (s *Store) List(ctx context.Context, status string, limit int32, cursor string) (dynamo.Page[Item], error) {
+	q := dynamo.Query{
+		Index:        StatusIndex,
+		KeyCondition: "#status = :status",
+		Names:        map[string]string{"#status": "status"},
+		Values:       map[string]types.AttributeValue{":status": dynamo.S(status)},
+		Limit:        limit,
+	}
+	if cursor != "" {
+		q.Start = dynamo.Key{"approval_id": dynamo.S(cursor), "status": dynamo.S(status)}
+	}
+	return dynamo.QueryPage[Item](ctx, s.table, q)
+}
+
+// All returns every item in status, oldest first; only customerID's when
+// it is set.
+func (s *Store) All(ctx context.Context, status, customerID string) ([]Item, error) {
+	q := dynamo.Query{
+		Index:        StatusIndex,
+		KeyCondition: "#status = :status",
+		Names:        map[string]string{"#status": "status"},
+		Values:       map[string]types.AttributeValue{":status": dynamo.S(status)},
+	}
+	if customerID != "" {
+		q.Filter = "customer_id = :customer_id"
+		q.Values[":customer_id"] = dynamo.S(customerID)
+	}
+	return dynamo.QueryAll[Item](ctx, s.table, q)
+}
+
+// Decide approves or rejects a pending item for actor. It returns
+// ErrNotPending or ErrWindowClosed when the item can no longer be
+// decided.
+func (s *Store) Decide(ctx context.Context, id string, approve bool, actor, note string) (Item, error) {
+	status := StatusRejected
+	if approve {
+		status = StatusApproved
+	}
+	now := s.clock.Now().UTC()
+	values := map[string]types.AttributeValue{
+		":status":     dynamo.S(status),
+		":pending":    dynamo.S(StatusPending),
+		":actor":      dynamo.S(actor),
+		":decided_at": dynamo.S(now.Format(time.RFC3339Nano)),
+		":now":        dynamo.N(unix(now)),
+	}
+	expression := "SET #status = :status, decided_by = :actor, decided_at = :decided_at"
+	if note != "" {
+		expression += ", note = :note"
+		values[":note"] = dynamo.S(note)
+	}
+
+	var item Item
+	err := s.table.Update(ctx, key(id), dynamo.Update{
+		Expression: expression,
+		Condition:  "#status = :pending AND decide_by > :now",
+		Names:      map[string]string{"#status": "status"},
+		Values:     values,
+	}, &item)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return Item{}, s.whyUndecidable(ctx, id)
+	}
+	if err != nil {
+		return Item{}, err
+	}
+	return item, nil
+}
+
+// whyUndecidable explains a failed decision condition.
+func (s *Store) whyUndecidable(ctx context.Context, id string) error {
+	item, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if item.Status != StatusPending {
+		return ErrNotPending
+	}
+	return ErrWindowClosed
+}
+
+// Expire closes a pending item whose decision window has passed. An item
+// decided in the meantime is left alone.
+func (s *Store) Expire(ctx context.Context, id string) error {
+	err := s.table.Update(ctx, key(id), dynamo.Update{
+		Expression: "SET #status = :expired",
+		Condition:  "#status = :pending AND decide_by <= :now",
+		Names:      map[string]string{"#status": "status"},
+		Values: map[string]types.AttributeValue{
+			":expired": dynamo.S(StatusExpired),
+			":pending": dynamo.S(StatusPending),
+			":now":     dynamo.N(unix(s.clock.Now())),
+		},
+	}, nil)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return nil
+	}
+	return err
+}
+
+// Finish records the outcome of applying an approved item. applyErr nil
+// means it was applied.
+func (s *Store) Finish(ctx context.Context, id string, applyErr error) error {
+	now := s.clock.Now().UTC()
+	u := dynamo.Update{
+		Expression: "SET #status = :status, applied_at = :now",
+		Condition:  "#status = :approved",
+		Names:      map[string]string{"#status": "status"},
+		Values: map[string]types.AttributeValue{
+			":status":   dynamo.S(StatusApplied),
+			":approved": dynamo.S(StatusApproved),
+			":now":      dynamo.S(now.Format(time.RFC3339Nano)),
+		},
+	}
+	if applyErr != nil {
+		u.Expression = "SET #status = :status, #error = :error"
+		u.Names["#error"] = "error"
+		u.Values[":status"] = dynamo.S(StatusApplyFailed)
+		u.Values[":error"] = dynamo.S(applyErr.Error())
+		delete(u.Values, ":now")
+	}
+	return s.table.Update(ctx, key(id), u, nil)
+}
+
+func unix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
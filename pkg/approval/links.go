@@ -0,0 +1,78 @@
+package approval
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Link actions.
+const (
+	ActionApprove = "approve"
+	ActionReject  = "reject"
+)
+
+// LinkPath is the path prefix of one-click links; the ads-api serves
+// LinkPath/{approval id}/{action}.
+const LinkPath = "/approval-links"
+
+var (
+	// ErrBadSignature is returned for a link that was not signed with the
+	// key, or was altered.
+	ErrBadSignature = errors.New("approval link signature is invalid")
+	// ErrLinkExpired is returned for a link past its expiry.
+	ErrLinkExpired = errors.New("approval link has expired")
+)
+
+// Signer makes and checks one-click decision links. The signature covers
+// the approval ID, the action and the expiry, so a link cannot be turned
+// into another decision or extended.
+type Signer struct {
+	key     []byte
+	baseURL string
+}
+
+// NewSigner returns a Signer for links under baseURL, the public API
+// address, e.g. "https://api.example.com".
+func NewSigner(key []byte, baseURL string) *Signer {
+	return &Signer{key: key, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Link returns the URL that takes action on the approval, valid until
+// expires.
+func (s *Signer) Link(id, action string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{
+		"expires":   {exp},
+		"signature": {s.sign(id, action, exp)},
+	}
+	return fmt.Sprintf("%s%s/%s/%s?%s", s.baseURL, LinkPath, url.PathEscape(id), action, query.Encode())
+}
+
+// Verify checks a link's expiry and signature at now.
+func (s *Signer) Verify(id, action, expires, signature string, now time.Time) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	want := s.sign(id, action, expires)
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return ErrBadSignature
+	}
+	if now.Unix() >= exp {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+func (s *Signer) sign(id, action, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(id + "\n" + action + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
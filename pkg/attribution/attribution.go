@@ -0,0 +1,399 @@
+// Package attribution records the Google Ads clicks that bring visitors to
+// the store and credits each order to one of them.
+//
+// attribution-service captures a click when a visitor lands with a gclid,
+// wbraid or gbraid in the URL, storing it with the landing page and UTM
+// parameters under the visitor: the user when signed in, otherwise the
+// storefront's anonymous ID, whose clicks user-service moves to the user
+// when they sign in. When checkout-service creates an order it asks for the
+// order to be resolved: the clicks of its user and visitor within the
+// lookback window before the order are its touchpoints, and the last of
+// them is credited (last-click). The resolved Record is kept per order and
+// is what conversion-uploader uploads and reports-service reports on.
+// attribution-modeler later spreads each attributed order over all its
+// touchpoints under the multi-touch models (see Models), for comparing
+// campaigns' credit beyond the last click.
+//
+// Records carry no user ID, only the order and its touchpoints, so they
+// outlive an erasure of the user like the orders themselves.
+package attribution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/ids"
+	"pkg/tenant"
+	"pkg/tracking"
+)
+
+// ModelLastClick credits the whole order to the last click before it.
+const ModelLastClick = "last_click"
+
+// Record statuses: whether a click within the lookback was found.
+const (
+	StatusAttributed   = "ATTRIBUTED"
+	StatusUnattributed = "UNATTRIBUTED"
+)
+
+// Indexes of the clicks and records tables.
+const (
+	// ClicksIndex is the clicks table's index of each visitor's clicks by
+	// time, the user_id-timestamp-index of every per-user event table.
+	ClicksIndex = "user_id-timestamp-index"
+	// RecordsIndex is the records table's index of records by status and
+	// order time.
+	RecordsIndex = "status-ordered_at-index"
+)
+
+const (
+	// DefaultLookback is Google Ads' default click-through conversion
+	// window.
+	DefaultLookback = 30 * 24 * time.Hour
+	// MaxLookback is the longest window Google Ads accepts conversions
+	// for; clicks are kept that long.
+	MaxLookback = 90 * 24 * time.Hour
+	// maxTouchpoints bounds the touchpoints kept on a record, newest
+	// first, to keep the item well under DynamoDB's size limit.
+	maxTouchpoints = 50
+)
+
+var (
+	// ErrNoClickID is returned for a landing URL without a gclid, wbraid
+	// or gbraid.
+	ErrNoClickID = errors.New("landing URL has no gclid, wbraid or gbraid")
+	// ErrNotFound is returned by Lookup for an order never resolved.
+	ErrNotFound = errors.New("attribution not found")
+)
+
+// ClickIDs are the Google Ads click identifiers of a landing URL. gclid is
+// set on most clicks; iOS app and web clicks subject to App Tracking
+// Transparency carry a gbraid or wbraid instead.
+type ClickIDs struct {
+	Gclid  string `json:"gclid,omitempty" dynamodbav:"gclid,omitempty"`
+	Wbraid string `json:"wbraid,omitempty" dynamodbav:"wbraid,omitempty"`
+	Gbraid string `json:"gbraid,omitempty" dynamodbav:"gbraid,omitempty"`
+}
+
+// Empty reports whether none is set.
+func (c ClickIDs) Empty() bool {
+	return c.Gclid == "" && c.Wbraid == "" && c.Gbraid == ""
+}
+
+// Click is one ad click a visitor landed from, stored in the clicks table
+// keyed by id.
+type Click struct {
+	ID       string `json:"id" dynamodbav:"id"`
+	TenantID string `json:"-" dynamodbav:"tenant_id,omitempty"`
+	// UserID is the user, or the anonymous visitor ID until they sign in.
+	UserID    string `json:"user_id" dynamodbav:"user_id"`
+	SessionID string `json:"session_id,omitempty" dynamodbav:"session_id,omitempty"`
+	ClickIDs
+
+	// The landing context: the page without its query, the UTM source
+	// and medium, and the campaign, ad group and keyword of the canonical
+	// suffix (see tracking.DefaultScheme).
+	LandingPage string `json:"landing_page" dynamodbav:"landing_page"`
+	Referrer    string `json:"referrer,omitempty" dynamodbav:"referrer,omitempty"`
+	Source      string `json:"utm_source,omitempty" dynamodbav:"utm_source,omitempty"`
+	Medium      string `json:"utm_medium,omitempty" dynamodbav:"utm_medium,omitempty"`
+	CampaignID  string `json:"campaign_id,omitempty" dynamodbav:"campaign_id,omitempty"`
+	AdGroupID   string `json:"ad_group_id,omitempty" dynamodbav:"ad_group_id,omitempty"`
+	Keyword     string `json:"keyword,omitempty" dynamodbav:"keyword,omitempty"`
+
+	// Timestamp is when the visitor landed.
+	Timestamp time.Time `json:"clicked_at" dynamodbav:"timestamp"`
+	ExpiresAt int64     `json:"-" dynamodbav:"expires_at"`
+}
+
+// FromLanding reads the click IDs and landing context of a landing URL.
+// It returns ErrNoClickID when the URL carries no click ID.
+func FromLanding(landingURL string) (Click, error) {
+	u, err := url.Parse(landingURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Click{}, fmt.Errorf("landing URL is not a valid http(s) URL")
+	}
+	q := u.Query()
+	c := Click{
+		ClickIDs: ClickIDs{
+			Gclid:  q.Get("gclid"),
+			Wbraid: q.Get("wbraid"),
+			Gbraid: q.Get("gbraid"),
+		},
+		Source:     q.Get("utm_source"),
+		Medium:     q.Get("utm_medium"),
+		CampaignID: q.Get("utm_campaign"),
+		AdGroupID:  q.Get("utm_content"),
+		Keyword:    tracking.NormalizeKeyword(q.Get("utm_term")),
+	}
+	if c.Empty() {
+		return Click{}, ErrNoClickID
+	}
+	u.RawQuery, u.Fragment = "", ""
+	c.LandingPage = u.String()
+	return c, nil
+}
+
+// Touchpoint is a click as kept on a record.
+type Touchpoint struct {
+	ClickID string `json:"click_id" dynamodbav:"click_id"`
+	ClickIDs
+	CampaignID string    `json:"campaign_id,omitempty" dynamodbav:"campaign_id,omitempty"`
+	AdGroupID  string    `json:"ad_group_id,omitempty" dynamodbav:"ad_group_id,omitempty"`
+	Keyword    string    `json:"keyword,omitempty" dynamodbav:"keyword,omitempty"`
+	ClickedAt  time.Time `json:"clicked_at" dynamodbav:"clicked_at"`
+}
+
+// Order is what resolving needs of an order. Guest orders have no user;
+// VisitorID is the storefront's anonymous ID, for clicks not yet moved to
+// the user.
+type Order struct {
+	ID        string
+	UserID    string
+	VisitorID string
+	Value     float64
+	Currency  string
+	OrderedAt time.Time
+}
+
+// Record is an order's attribution, stored in the records table keyed by
+// order_id. An order without a click in its lookback window is recorded
+// UNATTRIBUTED, so a lookup tells it apart from one not resolved yet.
+type Record struct {
+	OrderID  string `json:"order_id" dynamodbav:"order_id"`
+	TenantID string `json:"-" dynamodbav:"tenant_id,omitempty"`
+	Status   string `json:"status" dynamodbav:"status"`
+	Model    string `json:"model" dynamodbav:"model"`
+
+	Value     float64   `json:"value" dynamodbav:"value"`
+	Currency  string    `json:"currency" dynamodbav:"currency"`
+	OrderedAt time.Time `json:"ordered_at" dynamodbav:"ordered_at"`
+
+	// Click is the credited touchpoint, nil when unattributed.
+	Click *Touchpoint `json:"click,omitempty" dynamodbav:"click,omitempty"`
+	// Touchpoints are every click in the window, oldest first, for the
+	// multi-touch models.
+	Touchpoints []Touchpoint `json:"touchpoints" dynamodbav:"touchpoints"`
+
+	LookbackDays int       `json:"lookback_days" dynamodbav:"lookback_days"`
+	ResolvedAt   time.Time `json:"resolved_at" dynamodbav:"resolved_at"`
+}
+
+// Store keeps clicks and records in their DynamoDB tables.
+type Store struct {
+	clicks   *dynamo.Table
+	records  *dynamo.Table
+	clock    clock.Clock
+	lookback time.Duration
+}
+
+// NewStore returns a store resolving orders against the clicks within
+// lookback before them, at most MaxLookback. Either table may be nil for
+// a store that only reads records or only captures clicks.
+func NewStore(clicks, records *dynamo.Table, clk clock.Clock, lookback time.Duration) *Store {
+	if lookback <= 0 {
+		lookback = DefaultLookback
+	}
+	if lookback > MaxLookback {
+		lookback = MaxLookback
+	}
+	return &Store{clicks: clicks, records: records, clock: clk, lookback: lookback}
+}
+
+// Lookback is the window orders are resolved over.
+func (s *Store) Lookback() time.Duration {
+	return s.lookback
+}
+
+// Capture stores c, stamping its time if unset, its tenant and its ID. The
+// ID is derived from the visitor and click IDs, so a landing page
+// reloaded or captured twice stores the click once.
+func (s *Store) Capture(ctx context.Context, c *Click) error {
+	if c.Timestamp.IsZero() {
+		c.Timestamp = s.clock.Now()
+	}
+	c.Timestamp = c.Timestamp.UTC()
+	c.ID = ids.Derived(tenant.FromContext(ctx), c.UserID, c.Gclid, c.Wbraid, c.Gbraid)
+	if t := tenant.FromContext(ctx); t != tenant.Default {
+		c.TenantID = t
+	}
+	c.ExpiresAt = c.Timestamp.Add(MaxLookback).Unix()
+	if err := s.clicks.Put(ctx, c); err != nil {
+		return fmt.Errorf("failed to store click: %w", err)
+	}
+	return nil
+}
+
+// Clicks returns the clicks of visitor in (from, to], oldest first.
+func (s *Store) Clicks(ctx context.Context, visitor string, from, to time.Time) ([]Click, error) {
+	filter, names, tenantID := tenant.Filter(ctx)
+	names["#ts"] = "timestamp"
+	clicks, err := dynamo.QueryAll[Click](ctx, s.clicks, dynamo.Query{
+		Index:        ClicksIndex,
+		KeyCondition: "user_id = :user AND #ts BETWEEN :from AND :to",
+		Filter:       filter,
+		Names:        names,
+		Values: map[string]types.AttributeValue{
+			":user":   dynamo.S(visitor),
+			":from":   dynamo.S(from.UTC().Format(time.RFC3339Nano)),
+			":to":     dynamo.S(to.UTC().Format(time.RFC3339Nano)),
+			":tenant": dynamo.S(tenantID),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query clicks: %w", err)
+	}
+	// BETWEEN is inclusive; a click at the window's start is outside it.
+	kept := clicks[:0]
+	for _, c := range clicks {
+		if c.Timestamp.After(from) {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// Resolve attributes o to the last click of its user or visitor within the
+// lookback before it, and records that. An order already resolved keeps
+// its first record, which is returned with created false.
+func (s *Store) Resolve(ctx context.Context, o Order) (r Record, created bool, err error) {
+	if existing, err := s.Lookup(ctx, o.ID); err == nil {
+		return existing, false, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return Record{}, false, err
+	}
+
+	if o.OrderedAt.IsZero() {
+		o.OrderedAt = s.clock.Now()
+	}
+	o.OrderedAt = o.OrderedAt.UTC()
+
+	seen := make(map[string]bool)
+	var clicks []Click
+	for _, visitor := range []string{o.UserID, o.VisitorID} {
+		if visitor == "" || seen[visitor] {
+			continue
+		}
+		seen[visitor] = true
+		found, err := s.Clicks(ctx, visitor, o.OrderedAt.Add(-s.lookback), o.OrderedAt)
+		if err != nil {
+			return Record{}, false, err
+		}
+		clicks = append(clicks, found...)
+	}
+
+	r = Record{
+		OrderID:      o.ID,
+		Status:       StatusUnattributed,
+		Model:        ModelLastClick,
+		Value:        o.Value,
+		Currency:     o.Currency,
+		OrderedAt:    o.OrderedAt,
+		Touchpoints:  touchpoints(clicks),
+		LookbackDays: int(s.lookback / (24 * time.Hour)),
+		ResolvedAt:   s.clock.Now().UTC(),
+	}
+	if n := len(r.Touchpoints); n > 0 {
+		last := r.Touchpoints[n-1]
+		r.Click = &last
+		r.Status = StatusAttributed
+	}
+	if t := tenant.FromContext(ctx); t != tenant.Default {
+		r.TenantID = t
+	}
+
+	err = s.records.Put(ctx, r, dynamo.IfNotExists("order_id"))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		// Resolved concurrently; the first record stands.
+		existing, err := s.Lookup(ctx, o.ID)
+		return existing, false, err
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to record attribution of order %s: %w", o.ID, err)
+	}
+	return r, true, nil
+}
+
+// Lookup returns the record of an order of ctx's tenant, or ErrNotFound.
+func (s *Store) Lookup(ctx context.Context, orderID string) (Record, error) {
+	r, err := dynamo.Get[Record](ctx, s.records, dynamo.StringKey("order_id", orderID))
+	if errors.Is(err, dynamo.ErrNotFound) || (err == nil && !tenant.Owns(ctx, r.TenantID)) {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to get attribution of order %s: %w", orderID, err)
+	}
+	return r, nil
+}
+
+// Records calls fn with each page of ctx's tenant's records of status for
+// orders placed in [from, to), oldest first.
+func (s *Store) Records(ctx context.Context, status string, from, to time.Time, fn func([]Record) error) error {
+	filter, names, tenantID := tenant.Filter(ctx)
+	names["#status"] = "status"
+	names["#ordered"] = "ordered_at"
+	err := dynamo.QueryEach(ctx, s.records, dynamo.Query{
+		Index:        RecordsIndex,
+		KeyCondition: "#status = :status AND #ordered BETWEEN :from AND :to",
+		Filter:       filter,
+		Names:        names,
+		Values: map[string]types.AttributeValue{
+			":status": dynamo.S(status),
+			":from":   dynamo.S(from.UTC().Format(time.RFC3339Nano)),
+			":to":     dynamo.S(to.Add(-time.Nanosecond).UTC().Format(time.RFC3339Nano)),
+			":tenant": dynamo.S(tenantID),
+		},
+	}, fn)
+	if err != nil {
+		return fmt.Errorf("failed to query attributions: %w", err)
+	}
+	return nil
+}
+
+// AllRecords is Records over every tenant's records, for jobs that run
+// outside any one tenant's requests; each record names its tenant.
+func (s *Store) AllRecords(ctx context.Context, status string, from, to time.Time, fn func([]Record) error) error {
+	err := dynamo.QueryEach(ctx, s.records, dynamo.Query{
+		Index:        RecordsIndex,
+		KeyCondition: "#status = :status AND #ordered BETWEEN :from AND :to",
+		Names:        map[string]string{"#status": "status", "#ordered": "ordered_at"},
+		Values: map[string]types.AttributeValue{
+			":status": dynamo.S(status),
+			":from":   dynamo.S(from.UTC().Format(time.RFC3339Nano)),
+			":to":     dynamo.S(to.Add(-time.Nanosecond).UTC().Format(time.RFC3339Nano)),
+		},
+	}, fn)
+	if err != nil {
+		return fmt.Errorf("failed to query attributions: %w", err)
+	}
+	return nil
+}
+
+// touchpoints returns clicks as touchpoints, oldest first, the newest
+// maxTouchpoints of them.
+func touchpoints(clicks []Click) []Touchpoint {
+	sort.SliceStable(clicks, func(i, j int) bool { return clicks[i].Timestamp.Before(clicks[j].Timestamp) })
+	if len(clicks) > maxTouchpoints {
+		clicks = clicks[len(clicks)-maxTouchpoints:]
+	}
+	out := make([]Touchpoint, 0, len(clicks))
+	for _, c := range clicks {
+		out = append(out, Touchpoint{
+			ClickID:    c.ID,
+			ClickIDs:   c.ClickIDs,
+			CampaignID: c.CampaignID,
+			AdGroupID:  c.AdGroupID,
+			Keyword:    c.Keyword,
+			ClickedAt:  c.Timestamp,
+		})
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package attribution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/dynamo"
+	"pkg/tenant"
+)
+
+// Multi-touch models, which spread an order over every touchpoint of its
+// record rather than crediting the last. attribution-modeler computes
+// them daily, alongside last-click, for comparison.
+const (
+	// ModelLinear credits every touchpoint equally.
+	ModelLinear = "linear"
+	// ModelTimeDecay credits touchpoints closer to the order more, a click
+	// TimeDecayHalfLife earlier getting half the credit of one at the
+	// order.
+	ModelTimeDecay = "time_decay"
+	// ModelPositionBased credits the first and last touchpoints 40% each
+	// and splits the other 20% among those between.
+	ModelPositionBased = "position_based"
+)
+
+// Models are every model, last-click first.
+var Models = []string{ModelLastClick, ModelLinear, ModelTimeDecay, ModelPositionBased}
+
+const (
+	// TimeDecayHalfLife is Google Ads' time decay half-life.
+	TimeDecayHalfLife = 7 * 24 * time.Hour
+	// positionEnds is the share position-based gives the first and the
+	// last touchpoint each.
+	positionEnds = 0.4
+)
+
+// ErrUnknownModel is returned for a model not in Models.
+var ErrUnknownModel = errors.New("unknown attribution model")
+
+// ValidModel reports whether model is one of Models.
+func ValidModel(model string) bool {
+	for _, m := range Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// Weights returns the share of r's order each of its touchpoints gets
+// under model, summing to 1; nil for a record without touchpoints.
+func Weights(model string, r Record) ([]float64, error) {
+	n := len(r.Touchpoints)
+	if !ValidModel(model) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownModel, model)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	weights := make([]float64, n)
+	switch model {
+	case ModelLastClick:
+		weights[n-1] = 1
+	case ModelLinear:
+		for i := range weights {
+			weights[i] = 1 / float64(n)
+		}
+	case ModelTimeDecay:
+		var total float64
+		for i, t := range r.Touchpoints {
+			age := r.OrderedAt.Sub(t.ClickedAt)
+			if age < 0 {
+				age = 0
+			}
+			weights[i] = math.Exp2(-float64(age) / float64(TimeDecayHalfLife))
+			total += weights[i]
+		}
+		for i := range weights {
+			weights[i] /= total
+		}
+	case ModelPositionBased:
+		switch n {
+		case 1:
+			weights[0] = 1
+		case 2:
+			weights[0], weights[1] = 0.5, 0.5
+		default:
+			weights[0], weights[n-1] = positionEnds, positionEnds
+			for i := 1; i < n-1; i++ {
+				weights[i] = (1 - 2*positionEnds) / float64(n-2)
+			}
+		}
+	}
+	return weights, nil
+}
+
+// Credit is the share of an order a model gives one campaign's clicks.
+// Clicks without a campaign in their landing URL are credited to the
+// empty campaign ID.
+type Credit struct {
+	CampaignID string
+	Share      float64
+}
+
+// Credits is r's order split among the campaigns of its touchpoints under
+// model, in the order of each campaign's first touchpoint.
+func Credits(model string, r Record) ([]Credit, error) {
+	weights, err := Weights(model, r)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	var out []Credit
+	for i, t := range r.Touchpoints {
+		if weights[i] == 0 {
+			continue
+		}
+		j, ok := index[t.CampaignID]
+		if !ok {
+			j = len(out)
+			index[t.CampaignID] = j
+			out = append(out, Credit{CampaignID: t.CampaignID})
+		}
+		out[j].Share += weights[i]
+	}
+	return out, nil
+}
+
+// CampaignDay is one day's orders credited to one campaign under one
+// model, in one currency. Conversions are fractional: the shares of the
+// orders credited. CampaignDays are kept in the model results table, a
+// single table scoped per tenant (dynamo.WithTenancy(dynamo.PartitionKey)):
+//
+//	pk = MODEL#<model>   sk = <date>#<campaign id>#<currency>
+//
+// so one Query reads a model's days over a date range.
+type CampaignDay struct {
+	PK string `json:"-" dynamodbav:"pk"`
+	SK string `json:"-" dynamodbav:"sk"`
+
+	Model       string    `json:"model" dynamodbav:"model"`
+	Date        string    `json:"date" dynamodbav:"date"`
+	CampaignID  string    `json:"campaign_id" dynamodbav:"campaign_id"`
+	Currency    string    `json:"currency" dynamodbav:"currency"`
+	Conversions float64   `json:"conversions" dynamodbav:"conversions"`
+	Revenue     float64   `json:"revenue" dynamodbav:"revenue"`
+	ComputedAt  time.Time `json:"computed_at" dynamodbav:"computed_at"`
+}
+
+// Results keeps the models' CampaignDays.
+type Results struct {
+	table *dynamo.Table
+}
+
+// NewResults returns the results kept in table, which must be scoped with
+// dynamo.WithTenancy(dynamo.PartitionKey).
+func NewResults(table *dynamo.Table) *Results {
+	return &Results{table: table}
+}
+
+// Write stores days for ctx's tenant, replacing those with the same model,
+// date, campaign and currency.
+func (s *Results) Write(ctx context.Context, days []CampaignDay) error {
+	for i := range days {
+		d := &days[i]
+		d.PK = dynamo.Compose("MODEL", d.Model)
+		d.SK = dynamo.Compose(d.Date, d.CampaignID, d.Currency)
+	}
+	if err := dynamo.BatchPut(ctx, s.table, days); err != nil {
+		return fmt.Errorf("failed to store attribution model results: %w", err)
+	}
+	return nil
+}
+
+// Days returns ctx's tenant's CampaignDays of model for the dates in
+// [from, to), by date.
+func (s *Results) Days(ctx context.Context, model string, from, to time.Time) ([]CampaignDay, error) {
+	// Sort keys start with the date, so every key of the last day sorts
+	// below the first excluded date alone.
+	days, err := dynamo.QueryAll[CampaignDay](ctx, s.table, dynamo.Query{
+		KeyCondition: "pk = :pk AND sk BETWEEN :from AND :to",
+		Values: map[string]types.AttributeValue{
+			":pk":   dynamo.S(tenant.Key(ctx, dynamo.Compose("MODEL", model))),
+			":from": dynamo.S(from.UTC().Format("2006-01-02")),
+			":to":   dynamo.S(to.UTC().Format("2006-01-02")),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s attribution: %w", model, err)
+	}
+	return days, nil
+}
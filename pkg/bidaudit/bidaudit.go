@@ -0,0 +1,251 @@
+// Package bidaudit keeps an append-only log of the bid changes applied to
+// ad platforms, for client reporting and incident review. bid-applier
+// records each keyword bid it sets and bid-optimizer each ad schedule and
+// budget reallocation it applies; ads-api serves the log at
+// GET /audit/bid-changes.
+//
+// Records are written once, under a condition that no record has the same
+// key, and never updated; the writers' IAM policies allow nothing else.
+package bidaudit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/dynamo"
+)
+
+// Change types, by what the optimization changed.
+const (
+	// TypeKeywordBid is a keyword's max CPC bid.
+	TypeKeywordBid = "KEYWORD_BID"
+	// TypeAdSchedule is a campaign's ad schedule bid adjustments.
+	TypeAdSchedule = "AD_SCHEDULE"
+	// TypeBudget is a campaign's daily budget, moved by a reallocation.
+	TypeBudget = "BUDGET"
+)
+
+// Types lists the change types.
+var Types = []string{TypeKeywordBid, TypeAdSchedule, TypeBudget}
+
+// CampaignIndex is the table's global secondary index on campaign_key,
+// sorted by change_id.
+const CampaignIndex = "campaign-index"
+
+// ErrDuplicate is returned by Append for a record whose key is taken.
+var ErrDuplicate = errors.New("bid change already recorded")
+
+// changeTimeLayout is fixed width, so change IDs sort by time.
+const changeTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// Record is one applied change. OldValue and NewValue hold the changed
+// setting before and after as JSON: a money.Money for bids and budgets, the
+// serving windows for ad schedules.
+type Record struct {
+	CustomerID string `json:"customer_id" dynamodbav:"customer_id"`
+	// ChangeID is the time applied followed by the type and target, so an
+	// account's changes sort by time.
+	ChangeID    string `json:"change_id" dynamodbav:"change_id"`
+	CampaignKey string `json:"-" dynamodbav:"campaign_key"`
+	Type        string `json:"type" dynamodbav:"type"`
+
+	CampaignID   string `json:"campaign_id" dynamodbav:"campaign_id"`
+	CampaignName string `json:"campaign_name,omitempty" dynamodbav:"campaign_name,omitempty"`
+	AdGroupID    string `json:"ad_group_id,omitempty" dynamodbav:"ad_group_id,omitempty"`
+	KeywordID    string `json:"keyword_id,omitempty" dynamodbav:"keyword_id,omitempty"`
+	KeywordText  string `json:"keyword_text,omitempty" dynamodbav:"keyword_text,omitempty"`
+
+	OldValue json.RawMessage `json:"old_value,omitempty" dynamodbav:"old_value,omitempty"`
+	NewValue json.RawMessage `json:"new_value" dynamodbav:"new_value"`
+	Reason   string          `json:"reason,omitempty" dynamodbav:"reason,omitempty"`
+
+	// Source is the function that applied the change, and RunID and
+	// ConfigHash the run that decided it.
+	Source     string `json:"source" dynamodbav:"source"`
+	RunID      string `json:"run_id,omitempty" dynamodbav:"run_id,omitempty"`
+	ConfigHash string `json:"config_hash,omitempty" dynamodbav:"config_hash,omitempty"`
+	// Actor is who made the change: the approver of a bid change, "auto"
+	// for one approved for its small impact, or the applying function for
+	// changes applied without approval.
+	Actor      string    `json:"actor" dynamodbav:"actor"`
+	ApprovalID string    `json:"approval_id,omitempty" dynamodbav:"approval_id,omitempty"`
+	AppliedAt  time.Time `json:"applied_at" dynamodbav:"applied_at"`
+}
+
+// Value encodes a setting for OldValue or NewValue.
+func Value(v interface{}) json.RawMessage {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// Store keeps records in a DynamoDB table keyed by customer_id and
+// change_id, with CampaignIndex.
+type Store struct {
+	table *dynamo.Table
+	clock clock.Clock
+}
+
+func NewStore(table *dynamo.Table, clk clock.Clock) *Store {
+	return &Store{table: table, clock: clk}
+}
+
+// Append records an applied change, stamping its time if unset and its
+// keys. It returns ErrDuplicate if the change was already recorded, as a
+// retried apply may.
+func (s *Store) Append(ctx context.Context, r *Record) error {
+	if r.AppliedAt.IsZero() {
+		r.AppliedAt = s.clock.Now()
+	}
+	r.AppliedAt = r.AppliedAt.UTC()
+	target := r.CampaignID
+	if r.KeywordID != "" {
+		target = r.AdGroupID + "~" + r.KeywordID
+	}
+	r.ChangeID = r.AppliedAt.Format(changeTimeLayout) + "#" + r.Type + "#" + target
+	r.CampaignKey = campaignKey(r.CustomerID, r.CampaignID)
+
+	err := s.table.Put(ctx, r, dynamo.IfNotExists("change_id"))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record bid change: %w", err)
+	}
+	return nil
+}
+
+// Filter selects changes. From and To are days, both included; List
+// needs an account and both days, the rest is optional.
+type Filter struct {
+	CustomerID string
+	CampaignID string
+	Type       string
+	RunID      string
+	From       time.Time
+	To         time.Time
+}
+
+// expression renders f as a key condition, for queries with an account,
+// and a filter on the rest; without an account everything is filtered.
+func (f Filter) expression() (key, filter string, names map[string]string, values map[string]types.AttributeValue) {
+	names = map[string]string{}
+	values = map[string]types.AttributeValue{}
+	var keys, filters []string
+	switch {
+	case f.CustomerID != "" && f.CampaignID != "":
+		keys = append(keys, "campaign_key = :campaign")
+		values[":campaign"] = dynamo.S(campaignKey(f.CustomerID, f.CampaignID))
+	case f.CustomerID != "":
+		keys = append(keys, "customer_id = :customer")
+		values[":customer"] = dynamo.S(f.CustomerID)
+	case f.CampaignID != "":
+		filters = append(filters, "campaign_id = :campaign")
+		values[":campaign"] = dynamo.S(f.CampaignID)
+	}
+	// Change IDs start with the time applied, and those of the day after
+	// To sort after its bare date.
+	var span string
+	switch {
+	case !f.From.IsZero() && !f.To.IsZero():
+		span = "change_id BETWEEN :from AND :to"
+	case !f.From.IsZero():
+		span = "change_id >= :from"
+	case !f.To.IsZero():
+		span = "change_id < :to"
+	}
+	if !f.From.IsZero() {
+		values[":from"] = dynamo.S(f.From.UTC().Format("2006-01-02"))
+	}
+	if !f.To.IsZero() {
+		values[":to"] = dynamo.S(f.To.UTC().AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+	if span != "" && f.CustomerID != "" {
+		keys = append(keys, span)
+	} else if span != "" {
+		filters = append(filters, span)
+	}
+	if f.Type != "" {
+		filters = append(filters, "#type = :type")
+		names["#type"] = "type"
+		values[":type"] = dynamo.S(f.Type)
+	}
+	if f.RunID != "" {
+		filters = append(filters, "run_id = :run")
+		values[":run"] = dynamo.S(f.RunID)
+	}
+	if len(names) == 0 {
+		names = nil
+	}
+	return strings.Join(keys, " AND "), strings.Join(filters, " AND "), names, values
+}
+
+// query is the query for f's account, on CampaignIndex when f names a
+// campaign.
+func (f Filter) query() dynamo.Query {
+	key, filter, names, values := f.expression()
+	q := dynamo.Query{KeyCondition: key, Filter: filter, Names: names, Values: values}
+	if f.CampaignID != "" {
+		q.Index = CampaignIndex
+	}
+	return q
+}
+
+// List returns a page of the changes matching f, newest first, resuming
+// after the change with ID cursor when it is set. Pages may hold fewer
+// than limit changes when Type or RunID filter some out.
+func (s *Store) List(ctx context.Context, f Filter, limit int32, cursor string) (dynamo.Page[Record], error) {
+	q := f.query()
+	q.Limit = limit
+	q.Descending = true
+	if cursor != "" {
+		q.Start = dynamo.Key{"customer_id": dynamo.S(f.CustomerID), "change_id": dynamo.S(cursor)}
+		if f.CampaignID != "" {
+			q.Start["campaign_key"] = dynamo.S(campaignKey(f.CustomerID, f.CampaignID))
+		}
+	}
+	return dynamo.QueryPage[Record](ctx, s.table, q)
+}
+
+// All returns every change matching f, each account's oldest first.
+// Without an account it scans the whole log, which suits occasional work
+// such as rolling a run back but not serving requests.
+func (s *Store) All(ctx context.Context, f Filter) ([]Record, error) {
+	if f.CustomerID != "" {
+		return dynamo.QueryAll[Record](ctx, s.table, f.query())
+	}
+	_, filter, names, values := f.expression()
+	scan := dynamo.Scan{Filter: filter, Names: names}
+	if len(values) > 0 {
+		scan.Values = values
+	}
+	var records []Record
+	err := dynamo.ScanEach(ctx, s.table, scan, func(page []Record) error {
+		records = append(records, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CustomerID != records[j].CustomerID {
+			return records[i].CustomerID < records[j].CustomerID
+		}
+		return records[i].ChangeID < records[j].ChangeID
+	})
+	return records, nil
+}
+
+func campaignKey(customerID, campaignID string) string {
+	return customerID + "#" + campaignID
+}
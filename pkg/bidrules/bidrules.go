@@ -0,0 +1,417 @@
+// Package bidrules evaluates declarative bidding rules: documents, in YAML
+// or JSON, listing conditions over a bid target's metrics and the bid
+// change each calls for. bid-optimizer applies them to every keyword and
+// bid target without order revenue.
+//
+// A document looks like
+//
+//	version: 1
+//	rules:
+//	  - name: strong-performer
+//	    when: ctr > 0.02 and cvr > 0.05 and cpa < 50
+//	    action: {type: INCREASE_BID, multiplier: 1.25, max_bid: 20}
+//	    reason: High CTR ({ctr}) and conversion rate ({cvr})
+//	overrides:
+//	  - campaigns: ["1234567890"]
+//	    rules: [...]
+//
+// Rules are tried in order and the first whose condition holds decides the
+// bid. An override's rules are tried before the document's for its
+// campaigns, which fall back to the document's rules unless the override
+// replaces them. Documents are validated in full when parsed, so a bad
+// rule fails the load rather than the target it would have matched.
+package bidrules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"pkg/ads"
+	"pkg/money"
+)
+
+// Version is the document format Parse reads.
+const Version = 1
+
+// Metrics conditions and reasons can refer to. Money metrics are in the
+// document's currency in conditions and the target's in reasons.
+const (
+	metricImpressions     metric = iota // impressions
+	metricClicks                        // clicks
+	metricConversions                   // conversions
+	metricCost                          // cost, money
+	metricConversionValue               // conversion_value, money
+	metricCTR                           // ctr, clicks per impression
+	metricCVR                           // cvr, conversions per click
+	metricCPA                           // cpa, money, zero without conversions
+	metricCPC                           // cpc, money
+	metricBid                           // bid, the current bid, money
+	metricROAS                          // roas, conversion value per unit of cost
+	metricCount
+)
+
+var metricNames = [metricCount]string{
+	metricImpressions:     "impressions",
+	metricClicks:          "clicks",
+	metricConversions:     "conversions",
+	metricCost:            "cost",
+	metricConversionValue: "conversion_value",
+	metricCTR:             "ctr",
+	metricCVR:             "cvr",
+	metricCPA:             "cpa",
+	metricCPC:             "cpc",
+	metricBid:             "bid",
+	metricROAS:            "roas",
+}
+
+var metricIndex = func() map[string]metric {
+	index := make(map[string]metric, metricCount)
+	for m, name := range metricNames {
+		index[name] = metric(m)
+	}
+	return index
+}()
+
+func (m metric) money() bool {
+	return m == metricCost || m == metricConversionValue || m == metricCPA || m == metricCPC || m == metricBid
+}
+
+// values are a target's metrics, indexed by metric.
+type values [metricCount]float64
+
+// Action types, the recommendation types of the bids they set.
+var actionTypes = map[string]bool{
+	ads.IncreaseBid:      true,
+	ads.ModerateIncrease: true,
+	ads.DecreaseBid:      true,
+	ads.NoChange:         true,
+}
+
+// Document is a rules document as written.
+type Document struct {
+	Version   int        `json:"version"`
+	Rules     []Rule     `json:"rules"`
+	Overrides []Override `json:"overrides,omitempty"`
+}
+
+// Rule sets a bid when its condition holds.
+type Rule struct {
+	// Name identifies the rule in recommendations and logs; it must be
+	// unique across the document, overrides included.
+	Name string `json:"name"`
+	// When is the condition; see the grammar in expr.go.
+	When   string `json:"when"`
+	Action Action `json:"action"`
+	// Reason explains the recommendation. {metric} is replaced by the
+	// target's value: ratios as percentages, money in the target's
+	// currency.
+	Reason string `json:"reason"`
+}
+
+// Action is the bid change a rule calls for: the current bid times
+// Multiplier, moved by no more than MaxChange of the current bid and kept
+// between MinBid and MaxBid. Zero caps are not applied.
+type Action struct {
+	// Type is INCREASE_BID or MODERATE_INCREASE for multipliers above
+	// one, DECREASE_BID for those below and NO_CHANGE to keep the bid.
+	Type       string  `json:"type"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// MaxChange is a fraction of the current bid.
+	MaxChange float64 `json:"max_change,omitempty"`
+	// MinBid and MaxBid are in the document's currency.
+	MinBid float64 `json:"min_bid,omitempty"`
+	MaxBid float64 `json:"max_bid,omitempty"`
+}
+
+// Override applies its rules to some campaigns.
+type Override struct {
+	Campaigns []string `json:"campaigns"`
+	Rules     []Rule   `json:"rules"`
+	// Replace skips the document's rules for the campaigns, so targets no
+	// override rule matches keep their bid.
+	Replace bool `json:"replace,omitempty"`
+}
+
+// Decision is the bid a rule set recommends for a target, in the target's
+// currency, with the recommendation's type and reason. Rule names the rule
+// that decided it, and is empty when none matched.
+type Decision struct {
+	Bid    float64
+	Type   string
+	Reason string
+	Rule   string
+}
+
+type compiled struct {
+	Rule
+	when   expr
+	reason []reasonPart
+}
+
+type reasonPart struct {
+	text   string
+	metric metric
+	isText bool
+}
+
+// Ruleset is a parsed and validated document.
+type Ruleset struct {
+	doc       Document
+	rules     []compiled
+	overrides map[string]*campaignRules
+}
+
+type campaignRules struct {
+	rules   []compiled
+	replace bool
+}
+
+// Parse reads a YAML or JSON document and validates every rule, returning
+// all the problems it finds.
+func Parse(data []byte) (*Ruleset, error) {
+	// YAML is decoded generically and re-encoded as JSON so one set of
+	// field names serves both formats and unknown fields are caught.
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid rules document: %w", err)
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules document: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.DisallowUnknownFields()
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid rules document: %w", err)
+	}
+	return compile(doc)
+}
+
+func compile(doc Document) (*Ruleset, error) {
+	var errs []error
+	if doc.Version != Version {
+		errs = append(errs, fmt.Errorf("version must be %d", Version))
+	}
+	if len(doc.Rules) == 0 {
+		errs = append(errs, errors.New("rules must not be empty"))
+	}
+
+	names := map[string]bool{}
+	compileAll := func(rules []Rule) []compiled {
+		out := make([]compiled, 0, len(rules))
+		for i, rule := range rules {
+			c, err := compileRule(rule)
+			if err == nil && names[rule.Name] {
+				err = errors.New("name is not unique")
+			}
+			names[rule.Name] = true
+			if err != nil {
+				label := rule.Name
+				if label == "" {
+					label = "#" + strconv.Itoa(i+1)
+				}
+				errs = append(errs, fmt.Errorf("rule %s: %w", label, err))
+				continue
+			}
+			out = append(out, c)
+		}
+		return out
+	}
+
+	set := &Ruleset{doc: doc, rules: compileAll(doc.Rules), overrides: map[string]*campaignRules{}}
+	for i, o := range doc.Overrides {
+		if len(o.Campaigns) == 0 {
+			errs = append(errs, fmt.Errorf("override #%d: campaigns must not be empty", i+1))
+		}
+		if len(o.Rules) == 0 && !o.Replace {
+			errs = append(errs, fmt.Errorf("override #%d: rules must not be empty unless it replaces the document's", i+1))
+		}
+		campaign := &campaignRules{rules: compileAll(o.Rules), replace: o.Replace}
+		for _, id := range o.Campaigns {
+			if set.overrides[id] != nil {
+				errs = append(errs, fmt.Errorf("override #%d: campaign %s already has an override", i+1, id))
+				continue
+			}
+			set.overrides[id] = campaign
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid rules document: %w", errors.Join(errs...))
+	}
+	return set, nil
+}
+
+var placeholder = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+func compileRule(rule Rule) (compiled, error) {
+	if rule.Name == "" {
+		return compiled{}, errors.New("name is required")
+	}
+	when, err := parseCondition(rule.When)
+	if err != nil {
+		return compiled{}, fmt.Errorf("when: %w", err)
+	}
+
+	a := &rule.Action
+	if !actionTypes[a.Type] {
+		return compiled{}, fmt.Errorf("action type %q must be one of %s, %s, %s or %s", a.Type, ads.IncreaseBid, ads.ModerateIncrease, ads.DecreaseBid, ads.NoChange)
+	}
+	if a.Type == ads.NoChange && a.Multiplier == 0 {
+		a.Multiplier = 1
+	}
+	switch {
+	case a.Type == ads.NoChange && a.Multiplier != 1:
+		return compiled{}, errors.New("NO_CHANGE takes no multiplier")
+	case a.Type == ads.DecreaseBid && (a.Multiplier <= 0 || a.Multiplier >= 1):
+		return compiled{}, errors.New("DECREASE_BID needs a multiplier between 0 and 1")
+	case (a.Type == ads.IncreaseBid || a.Type == ads.ModerateIncrease) && a.Multiplier <= 1:
+		return compiled{}, fmt.Errorf("%s needs a multiplier above 1", a.Type)
+	case a.MaxChange < 0 || a.MinBid < 0 || a.MaxBid < 0:
+		return compiled{}, errors.New("caps must not be negative")
+	case a.Type == ads.DecreaseBid && a.MaxChange >= 1:
+		return compiled{}, errors.New("max_change must be below 1 for a decrease")
+	case a.MaxBid > 0 && a.MinBid > a.MaxBid:
+		return compiled{}, errors.New("min_bid must not exceed max_bid")
+	}
+
+	if rule.Reason == "" {
+		return compiled{}, errors.New("reason is required")
+	}
+	var parts []reasonPart
+	last := 0
+	for _, loc := range placeholder.FindAllStringSubmatchIndex(rule.Reason, -1) {
+		m, ok := metricIndex[rule.Reason[loc[2]:loc[3]]]
+		if !ok {
+			return compiled{}, fmt.Errorf("reason: unknown metric %q", rule.Reason[loc[2]:loc[3]])
+		}
+		parts = append(parts, reasonPart{text: rule.Reason[last:loc[0]], isText: true}, reasonPart{metric: m})
+		last = loc[1]
+	}
+	parts = append(parts, reasonPart{text: rule.Reason[last:], isText: true})
+
+	return compiled{Rule: rule, when: when, reason: parts}, nil
+}
+
+// JSON encodes the document canonically, for recording the rules a run
+// applied.
+func (s *Ruleset) JSON() string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s.doc)
+	return string(bytes.TrimSpace(buf.Bytes()))
+}
+
+// Rules is the number of rules in the document, overrides included.
+func (s *Ruleset) Rules() int {
+	n := len(s.doc.Rules)
+	for _, o := range s.doc.Overrides {
+		n += len(o.Rules)
+	}
+	return n
+}
+
+// Evaluate decides the bid for a target currently bid at bid, in units of
+// currency, the target's. rate converts the document's currency to it.
+func (s *Ruleset) Evaluate(m ads.Metrics, bid float64, currency string, rate float64) Decision {
+	v := metricValues(m, bid)
+	// Conditions compare money in the document's currency.
+	doc := v
+	for i := range doc {
+		if metric(i).money() && rate > 0 {
+			doc[i] /= rate
+		}
+	}
+
+	override := s.overrides[m.CampaignID]
+	if override != nil {
+		if d, ok := decide(override.rules, doc, v, bid, currency, rate); ok {
+			return d
+		}
+	}
+	if override == nil || !override.replace {
+		if d, ok := decide(s.rules, doc, v, bid, currency, rate); ok {
+			return d
+		}
+	}
+	return Decision{Bid: bid, Type: ads.NoChange, Reason: "Performance metrics are within acceptable ranges"}
+}
+
+func decide(rules []compiled, doc, v values, bid float64, currency string, rate float64) (Decision, bool) {
+	for _, r := range rules {
+		if r.when.eval(doc) == 0 {
+			continue
+		}
+		return Decision{
+			Bid:    r.Action.apply(bid, rate),
+			Type:   r.Action.Type,
+			Reason: r.format(v, currency),
+			Rule:   r.Name,
+		}, true
+	}
+	return Decision{}, false
+}
+
+func (a Action) apply(bid, rate float64) float64 {
+	next := bid * a.Multiplier
+	if a.MaxChange > 0 {
+		next = math.Max(bid*(1-a.MaxChange), math.Min(bid*(1+a.MaxChange), next))
+	}
+	if a.MaxBid > 0 {
+		next = math.Min(next, a.MaxBid*rate)
+	}
+	if a.MinBid > 0 {
+		next = math.Max(next, a.MinBid*rate)
+	}
+	return next
+}
+
+func (r compiled) format(v values, currency string) string {
+	var buf bytes.Buffer
+	for _, p := range r.reason {
+		if p.isText {
+			buf.WriteString(p.text)
+			continue
+		}
+		value := v[p.metric]
+		switch {
+		case p.metric.money():
+			buf.WriteString(money.FromUnits(value, currency).String())
+		case p.metric == metricCTR || p.metric == metricCVR:
+			fmt.Fprintf(&buf, "%.2f%%", value*100)
+		case p.metric == metricImpressions || p.metric == metricClicks:
+			fmt.Fprintf(&buf, "%d", int64(value))
+		case p.metric == metricROAS:
+			fmt.Fprintf(&buf, "%.2f", value)
+		default:
+			buf.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+	return buf.String()
+}
+
+func metricValues(m ads.Metrics, bid float64) values {
+	var v values
+	v[metricImpressions] = float64(m.Impressions)
+	v[metricClicks] = float64(m.Clicks)
+	v[metricConversions] = m.Conversions
+	v[metricCost] = m.Cost.Units()
+	v[metricConversionValue] = m.ConversionValue.Units()
+	v[metricCTR] = m.CTR()
+	v[metricCVR] = m.ConversionRate()
+	v[metricCPA] = m.CostPerConversion().Units()
+	v[metricCPC] = m.AverageCPC().Units()
+	v[metricBid] = bid
+	if v[metricCost] > 0 {
+		v[metricROAS] = v[metricConversionValue] / v[metricCost]
+	}
+	return v
+}
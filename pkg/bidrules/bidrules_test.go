@@ -0,0 +1,161 @@
+package bidrules
+
+import (
+	"strings"
+	"testing"
+
+	"pkg/ads"
+	"pkg/money"
+)
+
+const testDocument = `
+version: 1
+rules:
+  - name: strong
+    when: ctr > 0.02 and cvr > 0.05 and cpa < 50
+    action: {type: INCREASE_BID, multiplier: 1.25, max_bid: 2}
+    reason: High CTR ({ctr}) at {cpa} a conversion
+  - name: weak
+    when: ctr < 0.005 and impressions > 1000
+    action: {type: DECREASE_BID, multiplier: 0.5, max_change: 0.2}
+    reason: Low CTR ({ctr}) over {impressions} impressions
+overrides:
+  - campaigns: ["200"]
+    rules:
+      - name: brand
+        when: clicks > 0
+        action: {type: MODERATE_INCREASE, multiplier: 1.1, min_bid: 1.5}
+        reason: Brand campaign
+  - campaigns: ["300"]
+    replace: true
+`
+
+// metrics are a target's numbers in campaign, cost in units of currency.
+func metrics(campaign string, impressions, clicks int64, conversions, cost float64, currency string) ads.Metrics {
+	return ads.Metrics{
+		CampaignID:  campaign,
+		Impressions: impressions,
+		Clicks:      clicks,
+		Conversions: conversions,
+		Cost:        money.FromUnits(cost, currency),
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	set, err := Parse([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if set.Rules() != 3 {
+		t.Errorf("Rules() = %d, want 3", set.Rules())
+	}
+
+	// 3% CTR, 10% CVR, $10 a conversion.
+	strong := metrics("100", 1000, 30, 3, 30, money.USD)
+	// 0.1% CTR over 5000 impressions.
+	weak := metrics("100", 5000, 5, 0, 10, money.USD)
+
+	tests := []struct {
+		name     string
+		metrics  ads.Metrics
+		bid      float64
+		currency string
+		rate     float64
+		want     Decision
+	}{
+		{
+			name:    "first matching rule decides",
+			metrics: strong, bid: 1, currency: money.USD, rate: 1,
+			want: Decision{Bid: 1.25, Type: ads.IncreaseBid, Rule: "strong", Reason: "High CTR (3.00%) at $10.00 a conversion"},
+		},
+		{
+			name:    "max_bid caps the increase",
+			metrics: strong, bid: 1.8, currency: money.USD, rate: 1,
+			want: Decision{Bid: 2, Type: ads.IncreaseBid, Rule: "strong", Reason: "High CTR (3.00%) at $10.00 a conversion"},
+		},
+		{
+			name:    "max_change limits the decrease",
+			metrics: weak, bid: 1, currency: money.USD, rate: 1,
+			want: Decision{Bid: 0.8, Type: ads.DecreaseBid, Rule: "weak", Reason: "Low CTR (0.10%) over 5000 impressions"},
+		},
+		{
+			name:    "no rule keeps the bid",
+			metrics: metrics("100", 100, 1, 0, 1, money.USD), bid: 1, currency: money.USD, rate: 1,
+			want: Decision{Bid: 1, Type: ads.NoChange, Reason: "Performance metrics are within acceptable ranges"},
+		},
+		{
+			// €40 a conversion is $50 at 0.8 EUR per dollar: not below 50.
+			name:    "conditions compare money in the document's currency",
+			metrics: metrics("100", 1000, 30, 3, 120, "EUR"), bid: 1, currency: "EUR", rate: 0.8,
+			want: Decision{Bid: 1, Type: ads.NoChange, Reason: "Performance metrics are within acceptable ranges"},
+		},
+		{
+			// The $2 cap is €1.60; the reason is in euros.
+			name:    "caps and reasons are in the target's currency",
+			metrics: metrics("100", 1000, 30, 3, 24, "EUR"), bid: 1.5, currency: "EUR", rate: 0.8,
+			want: Decision{Bid: 1.6, Type: ads.IncreaseBid, Rule: "strong", Reason: "High CTR (3.00%) at €8.00 a conversion"},
+		},
+		{
+			name:    "an override's rules come first",
+			metrics: func() ads.Metrics { m := strong; m.CampaignID = "200"; return m }(), bid: 1, currency: money.USD, rate: 1,
+			want: Decision{Bid: 1.5, Type: ads.ModerateIncrease, Rule: "brand", Reason: "Brand campaign"},
+		},
+		{
+			name:    "an override falls back to the document's rules",
+			metrics: func() ads.Metrics { m := weak; m.CampaignID = "200"; m.Clicks = 0; return m }(), bid: 1, currency: money.USD, rate: 1,
+			want: Decision{Bid: 0.8, Type: ads.DecreaseBid, Rule: "weak", Reason: "Low CTR (0.00%) over 5000 impressions"},
+		},
+		{
+			name:    "a replacing override skips the document's rules",
+			metrics: func() ads.Metrics { m := strong; m.CampaignID = "300"; return m }(), bid: 1, currency: money.USD, rate: 1,
+			want: Decision{Bid: 1, Type: ads.NoChange, Reason: "Performance metrics are within acceptable ranges"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := set.Evaluate(tt.metrics, tt.bid, tt.currency, tt.rate)
+			if got.Type != tt.want.Type || got.Rule != tt.want.Rule || got.Reason != tt.want.Reason || !near(got.Bid, tt.want.Bid) {
+				t.Errorf("Evaluate =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d > -1e-9 && d < 1e-9
+}
+
+func TestParseRejects(t *testing.T) {
+	rule := func(s string) string {
+		return "version: 1\nrules:\n  - " + strings.ReplaceAll(s, "\n", "\n    ") + "\n"
+	}
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"another version", "version: 2\nrules: [{name: a, when: ctr > 0, action: {type: NO_CHANGE}, reason: r}]", "version must be 1"},
+		{"no rules", "version: 1\nrules: []", "rules must not be empty"},
+		{"unknown fields", "version: 1\nrule: []", "unknown field"},
+		{"a missing name", rule("when: ctr > 0\naction: {type: NO_CHANGE}\nreason: r"), "rule #1: name is required"},
+		{"a duplicate name", "version: 1\nrules:\n  - {name: a, when: ctr > 0, action: {type: NO_CHANGE}, reason: r}\n  - {name: a, when: ctr > 0, action: {type: NO_CHANGE}, reason: r}", "rule a: name is not unique"},
+		{"a bad condition", rule("name: a\nwhen: ctr >\naction: {type: NO_CHANGE}\nreason: r"), "rule a: when: condition ends unexpectedly"},
+		{"an unknown action", rule("name: a\nwhen: ctr > 0\naction: {type: PAUSE}\nreason: r"), `action type "PAUSE" must be one of`},
+		{"an increase that decreases", rule("name: a\nwhen: ctr > 0\naction: {type: INCREASE_BID, multiplier: 0.9}\nreason: r"), "INCREASE_BID needs a multiplier above 1"},
+		{"a decrease that increases", rule("name: a\nwhen: ctr > 0\naction: {type: DECREASE_BID, multiplier: 1.1}\nreason: r"), "DECREASE_BID needs a multiplier between 0 and 1"},
+		{"NO_CHANGE with a multiplier", rule("name: a\nwhen: ctr > 0\naction: {type: NO_CHANGE, multiplier: 2}\nreason: r"), "NO_CHANGE takes no multiplier"},
+		{"crossed caps", rule("name: a\nwhen: ctr > 0\naction: {type: INCREASE_BID, multiplier: 2, min_bid: 5, max_bid: 1}\nreason: r"), "min_bid must not exceed max_bid"},
+		{"an unknown reason metric", rule("name: a\nwhen: ctr > 0\naction: {type: NO_CHANGE}\nreason: '{roi}'"), `reason: unknown metric "roi"`},
+		{"an override without campaigns", "version: 1\nrules: [{name: a, when: ctr > 0, action: {type: NO_CHANGE}, reason: r}]\noverrides: [{rules: [{name: b, when: ctr > 0, action: {type: NO_CHANGE}, reason: r}]}]", "override #1: campaigns must not be empty"},
+		{"two overrides of a campaign", "version: 1\nrules: [{name: a, when: ctr > 0, action: {type: NO_CHANGE}, reason: r}]\noverrides: [{campaigns: ['1'], replace: true}, {campaigns: ['1'], replace: true}]", "override #2: campaign 1 already has an override"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package bidrules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Conditions are expressions over the metrics, such as
+//
+//	ctr > 0.02 and (cvr > 0.05 or cpa < 50)
+//
+// with numbers, metric names, parentheses, + - * /, the comparisons
+// < <= > >= == != and the operators and, or and not. A condition must be
+// a comparison or a combination of them; arithmetic on comparisons and
+// comparisons of comparisons are rejected when the document is loaded.
+// Division by zero is zero, as the metrics' own ratios are.
+
+// expr is a parsed expression. Comparisons evaluate to 1 or 0.
+type expr interface {
+	eval(v values) float64
+}
+
+type (
+	number float64
+	metric int
+	negate struct{ x expr }
+	not    struct{ x expr }
+	binary struct {
+		op   string
+		x, y expr
+	}
+)
+
+func (n number) eval(values) float64   { return float64(n) }
+func (m metric) eval(v values) float64 { return v[m] }
+func (n negate) eval(v values) float64 { return -n.x.eval(v) }
+
+func (n not) eval(v values) float64 {
+	return truth(n.x.eval(v) == 0)
+}
+
+func (b binary) eval(v values) float64 {
+	switch b.op {
+	case "and":
+		return truth(b.x.eval(v) != 0 && b.y.eval(v) != 0)
+	case "or":
+		return truth(b.x.eval(v) != 0 || b.y.eval(v) != 0)
+	}
+	x, y := b.x.eval(v), b.y.eval(v)
+	switch b.op {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	case "/":
+		if y == 0 {
+			return 0
+		}
+		return x / y
+	case "<":
+		return truth(x < y)
+	case "<=":
+		return truth(x <= y)
+	case ">":
+		return truth(x > y)
+	case ">=":
+		return truth(x >= y)
+	case "==":
+		return truth(x == y)
+	case "!=":
+		return truth(x != y)
+	}
+	panic("bidrules: unknown operator " + b.op)
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// parseCondition parses a condition, which must evaluate to true or false.
+func parseCondition(s string) (expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, boolean, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if !boolean {
+		return nil, fmt.Errorf("condition is a number, not a comparison")
+	}
+	return e, nil
+}
+
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')' || c == '+' || c == '-' || c == '*' || c == '/':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '<' || c == '>' || c == '=' || c == '!':
+			if i+1 < len(s) && s[i+1] == '=' {
+				tokens = append(tokens, s[i:i+2])
+				i += 2
+				continue
+			}
+			if c == '=' || c == '!' {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			tokens = append(tokens, string(c))
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(s[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("condition is empty")
+	}
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over the grammar
+//
+//	or      = and { "or" and }
+//	and     = not { "and" not }
+//	not     = "not" not | compare
+//	compare = sum [ ( "<" | "<=" | ">" | ">=" | "==" | "!=" ) sum ]
+//	sum     = product { ( "+" | "-" ) product }
+//	product = unary { ( "*" | "/" ) unary }
+//	unary   = "-" unary | number | metric | "(" or ")"
+//
+// Each rule returns its expression and whether it is boolean.
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) or() (expr, bool, error) {
+	return p.logical("or", p.and)
+}
+
+func (p *parser) and() (expr, bool, error) {
+	return p.logical("and", p.not)
+}
+
+func (p *parser) logical(op string, operand func() (expr, bool, error)) (expr, bool, error) {
+	x, boolean, err := operand()
+	if err != nil {
+		return nil, false, err
+	}
+	for p.peek() == op {
+		p.next()
+		y, yBoolean, err := operand()
+		if err != nil {
+			return nil, false, err
+		}
+		if !boolean || !yBoolean {
+			return nil, false, fmt.Errorf("%s needs comparisons on both sides", op)
+		}
+		x = binary{op: op, x: x, y: y}
+	}
+	return x, boolean, nil
+}
+
+func (p *parser) not() (expr, bool, error) {
+	if p.peek() != "not" {
+		return p.compare()
+	}
+	p.next()
+	x, boolean, err := p.not()
+	if err != nil {
+		return nil, false, err
+	}
+	if !boolean {
+		return nil, false, fmt.Errorf("not needs a comparison")
+	}
+	return not{x}, true, nil
+}
+
+func (p *parser) compare() (expr, bool, error) {
+	x, boolean, err := p.sum()
+	if err != nil {
+		return nil, false, err
+	}
+	switch op := p.peek(); op {
+	case "<", "<=", ">", ">=", "==", "!=":
+		p.next()
+		y, yBoolean, err := p.sum()
+		if err != nil {
+			return nil, false, err
+		}
+		if boolean || yBoolean {
+			return nil, false, fmt.Errorf("%s compares numbers, not comparisons", op)
+		}
+		return binary{op: op, x: x, y: y}, true, nil
+	}
+	return x, boolean, nil
+}
+
+func (p *parser) sum() (expr, bool, error) {
+	return p.arithmetic([]string{"+", "-"}, p.product)
+}
+
+func (p *parser) product() (expr, bool, error) {
+	return p.arithmetic([]string{"*", "/"}, p.unary)
+}
+
+func (p *parser) arithmetic(ops []string, operand func() (expr, bool, error)) (expr, bool, error) {
+	x, boolean, err := operand()
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		op := p.peek()
+		if op != ops[0] && op != ops[1] {
+			return x, boolean, nil
+		}
+		p.next()
+		y, yBoolean, err := operand()
+		if err != nil {
+			return nil, false, err
+		}
+		if boolean || yBoolean {
+			return nil, false, fmt.Errorf("%s needs numbers on both sides", op)
+		}
+		x = binary{op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) unary() (expr, bool, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, false, fmt.Errorf("condition ends unexpectedly")
+	case t == "-":
+		x, boolean, err := p.unary()
+		if err != nil {
+			return nil, false, err
+		}
+		if boolean {
+			return nil, false, fmt.Errorf("- needs a number")
+		}
+		return negate{x}, false, nil
+	case t == "(":
+		x, boolean, err := p.or()
+		if err != nil {
+			return nil, false, err
+		}
+		if p.next() != ")" {
+			return nil, false, fmt.Errorf("missing )")
+		}
+		return x, boolean, nil
+	case t[0] >= '0' && t[0] <= '9' || t[0] == '.':
+		n, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid number %q", t)
+		}
+		return number(n), false, nil
+	case !unicode.IsLetter(rune(t[0])) && t[0] != '_':
+		return nil, false, fmt.Errorf("unexpected %q", t)
+	}
+	m, ok := metricIndex[t]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown metric %q", t)
+	}
+	return m, false, nil
+}
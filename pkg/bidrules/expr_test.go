@@ -0,0 +1,71 @@
+package bidrules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	var v values
+	v[metricCTR] = 0.03
+	v[metricCVR] = 0.1
+	v[metricCPA] = 40
+	v[metricClicks] = 100
+	v[metricImpressions] = 2000
+
+	tests := []struct {
+		when string
+		want bool
+	}{
+		{"ctr > 0.02 and cvr > 0.05 and cpa < 50", true},
+		{"ctr > 0.05 or cpa <= 40", true},
+		{"not ctr > 0.02", false},
+		{"not (ctr > 0.05 or cpa > 50)", true},
+		// and binds tighter than or.
+		{"ctr > 1 and cvr > 1 or cpa == 40", true},
+		{"ctr > 1 and (cvr > 1 or cpa == 40)", false},
+		// * binds tighter than +, and unary minus applies to a number.
+		{"clicks / impressions * 2 + 1 == 1.1", true},
+		{"-cpa < -39", true},
+		{"cpa != 40", false},
+		// Division by zero is zero.
+		{"cost / conversions == 0", true},
+		{"CTR >= 0.03", true},
+	}
+	for _, tt := range tests {
+		e, err := parseCondition(tt.when)
+		if err != nil {
+			t.Errorf("parseCondition(%q): %v", tt.when, err)
+			continue
+		}
+		if got := e.eval(v) != 0; got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.when, got, tt.want)
+		}
+	}
+}
+
+func TestParseConditionRejects(t *testing.T) {
+	tests := []struct {
+		when string
+		want string
+	}{
+		{"", "condition is empty"},
+		{"ctr", "condition is a number, not a comparison"},
+		{"ctr > 0.02 and cpa", "and needs comparisons on both sides"},
+		{"not ctr", "not needs a comparison"},
+		{"(ctr > 1) > 0", "> compares numbers, not comparisons"},
+		{"(ctr > 1) + 1 > 0", "+ needs numbers on both sides"},
+		{"-(ctr > 1)", "- needs a number"},
+		{"(ctr > 1", "missing )"},
+		{"ctr > 1.2.3", `invalid number "1.2.3"`},
+		{"roi > 1", `unknown metric "roi"`},
+		{"ctr = 1", `unexpected '=' at offset 4`},
+		{"ctr > 1 cpa", `unexpected "cpa"`},
+	}
+	for _, tt := range tests {
+		_, err := parseCondition(tt.when)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseCondition(%q) = %v, want an error containing %q", tt.when, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package bloom is a small, concurrency-safe Bloom filter used as a fast
+// in-memory pre-check in front of authoritative stores.
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Filter answers "definitely not seen" or "possibly seen". It never returns
+// a false negative, so a miss can skip the authoritative lookup entirely.
+type Filter struct {
+	mu    sync.RWMutex
+	bits  []uint64
+	m     uint64
+	k     uint64
+	count uint64
+}
+
+// New sizes a filter for n expected items at false-positive rate p.
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// Add records key.
+func (f *Filter) Add(key string) {
+	h1, h2 := hashes(key)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// MayContain reports whether key may have been added.
+func (f *Filter) MayContain(key string) bool {
+	h1, h2 := hashes(key)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns how many keys have been added.
+func (f *Filter) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return int(f.count)
+}
+
+// hashes derives the two base hashes for Kirsch-Mitzenmacher double hashing.
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+
+	h.Write([]byte{0})
+	h2 := h.Sum64() | 1 // odd, so successive probes cycle through all bits
+	return h1, h2
+}
@@ -0,0 +1,48 @@
+package clock
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ClockRequest is the body accepted by Handler. Now jumps the clock to an
+// absolute time; Advance (a Go duration such as "36h") moves it forward.
+type ClockRequest struct {
+	Now     *time.Time `json:"now,omitempty"`
+	Advance string     `json:"advance,omitempty"`
+}
+
+// Handler exposes a Manual clock over HTTP so end-to-end tests can move time
+// on a running service. GET returns the current time; POST applies a
+// ClockRequest. It must only be mounted in test mode.
+func Handler(m *Manual) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var req ClockRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if req.Now != nil {
+				m.Set(*req.Now)
+			}
+			if req.Advance != "" {
+				d, err := time.ParseDuration(req.Advance)
+				if err != nil {
+					http.Error(w, "Invalid advance duration", http.StatusBadRequest)
+					return
+				}
+				m.Advance(d)
+			}
+		}
+
+		m.mu.Lock()
+		now := m.now
+		m.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]time.Time{"now": now})
+	}
+}
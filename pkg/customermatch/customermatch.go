@@ -0,0 +1,92 @@
+// Package customermatch normalizes and hashes customer contact details as
+// Google Ads Customer Match requires, so every list upload matches on the
+// same hashes.
+//
+// Emails are trimmed and lowercased, with the dots of a Gmail address's
+// local part removed. Phone numbers are put in E.164 form: a plus sign,
+// the country calling code and the national number, digits only. Both are
+// then hashed with SHA-256 and hex encoded.
+package customermatch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// NormalizeEmail returns email in Customer Match form, or false if it is
+// not an address.
+func NormalizeEmail(email string) (string, bool) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" || strings.ContainsAny(email, " \t") || strings.Contains(domain, "@") {
+		return "", false
+	}
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain, true
+}
+
+// NormalizePhone returns phone in E.164 form, or false if it cannot be.
+// Spaces, dashes, dots and brackets are dropped, and an international 00
+// prefix is read as a plus sign. Numbers without either are national and
+// take defaultCallingCode, such as "33", losing their trunk 0; without a
+// default they are rejected.
+func NormalizePhone(phone, defaultCallingCode string) (string, bool) {
+	var digits strings.Builder
+	international := false
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", false
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case international:
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case defaultCallingCode != "":
+		number = strings.TrimLeft(defaultCallingCode, "+") + strings.TrimPrefix(number, "0")
+	default:
+		return "", false
+	}
+	// E.164 allows at most 15 digits; fewer than 8 is no real number.
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", false
+	}
+	return "+" + number, true
+}
+
+// Hash hashes a normalized value.
+func Hash(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashEmail normalizes and hashes email, returning "" if it is not an
+// address.
+func HashEmail(email string) string {
+	normalized, ok := NormalizeEmail(email)
+	if !ok {
+		return ""
+	}
+	return Hash(normalized)
+}
+
+// HashPhone normalizes and hashes phone, returning "" if it cannot be put
+// in E.164 form.
+func HashPhone(phone, defaultCallingCode string) string {
+	normalized, ok := NormalizePhone(phone, defaultCallingCode)
+	if !ok {
+		return ""
+	}
+	return Hash(normalized)
+}
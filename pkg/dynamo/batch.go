@@ -0,0 +1,106 @@
+package dynamo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// batchWriteSize is the most requests one BatchWriteItem call accepts.
+const batchWriteSize = 25
+
+// BatchError reports the items a BatchPut did not write, as indexes into
+// the items passed, with the last error that stopped them.
+type BatchError struct {
+	Failed []int
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d items not written: %v", len(e.Failed), e.Err)
+}
+
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// BatchPut writes items, replacing any with the same keys, 25 to a call.
+// Items DynamoDB leaves unprocessed are retried under the table's retry
+// policy. Batch writes take no conditions, and no two items may share a
+// key. A call that still fails does not stop the rest; the error is then a
+// *BatchError naming every item not written.
+func BatchPut[T any](ctx context.Context, t *Table, items []T) error {
+	var failed []int
+	var lastErr error
+	for start := 0; start < len(items); start += batchWriteSize {
+		end := start + batchWriteSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		// Unprocessed items come back as new maps, matched to their
+		// index by content.
+		indexOf := make(map[string]int, end-start)
+		requests := make([]types.WriteRequest, 0, end-start)
+		for i := start; i < end; i++ {
+			av, err := attributevalue.MarshalMap(items[i])
+			if err != nil {
+				failed = append(failed, i)
+				lastErr = fmt.Errorf("failed to marshal item: %w", err)
+				continue
+			}
+			av = t.scopeItem(ctx, av)
+			indexOf[fingerprint(av)] = i
+			requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: av}})
+		}
+		if len(requests) == 0 {
+			continue
+		}
+
+		err := t.do(ctx, "batch put", func(ctx context.Context) error {
+			result, err := t.db.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{t.Name: requests},
+			})
+			if err != nil {
+				return err
+			}
+			if unprocessed := result.UnprocessedItems[t.Name]; len(unprocessed) > 0 {
+				requests = unprocessed
+				return errUnprocessed
+			}
+			return nil
+		})
+		if err != nil {
+			lastErr = err
+			for _, request := range requests {
+				failed = append(failed, indexOf[fingerprint(request.PutRequest.Item)])
+			}
+			if ctx.Err() != nil {
+				for i := end; i < len(items); i++ {
+					failed = append(failed, i)
+				}
+				break
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Ints(failed)
+		return &BatchError{Failed: failed, Err: lastErr}
+	}
+	return nil
+}
+
+// fingerprint is a canonical form of an item, for recognising it among
+// the unprocessed items DynamoDB returns.
+func fingerprint(item map[string]types.AttributeValue) string {
+	var v map[string]interface{}
+	if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
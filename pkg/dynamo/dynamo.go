@@ -0,0 +1,188 @@
+// Package dynamo is a thin typed layer over a DynamoDB table: reads and
+// writes that marshal with attributevalue, consistent sentinel errors,
+// retries when DynamoDB throttles, and key helpers for single-table
+// designs.
+//
+//	users := dynamo.NewTable(client, "users", dynamo.WithTimeout(5*time.Second))
+//	user, err := dynamo.Get[User](ctx, users, dynamo.StringKey("id", id))
+//	if errors.Is(err, dynamo.ErrNotFound) { ... }
+//	err = users.Put(ctx, user, dynamo.IfNotExists("id"))
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/retry"
+)
+
+// API is the part of *dynamodb.Client a Table uses.
+type API interface {
+	GetItem(ctx context.Context, in *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, in *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, in *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, in *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, in *dynamodb.ScanInput, opts ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	BatchGetItem(ctx context.Context, in *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(ctx context.Context, in *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItems(ctx context.Context, in *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+var (
+	// ErrNotFound is returned by Get for a key with no item.
+	ErrNotFound = errors.New("item not found")
+	// ErrConditionFailed is returned when a write's condition, or any
+	// condition in a transaction, does not hold.
+	ErrConditionFailed = errors.New("condition check failed")
+)
+
+// Table is one DynamoDB table. It is safe for concurrent use.
+type Table struct {
+	// Name is the table name, for callers building their own requests.
+	Name string
+
+	db         API
+	consistent bool
+	timeout    time.Duration
+	retry      retry.Policy
+	// tenantKey is the partition key attribute scoped by WithTenancy.
+	tenantKey string
+}
+
+// Option configures a Table.
+type Option func(*Table)
+
+// WithConsistentReads makes Get, Query, Scan and BatchGet strongly
+// consistent. Queries on a global secondary index stay eventually
+// consistent, the only mode such indexes support.
+func WithConsistentReads(on bool) Option {
+	return func(t *Table) { t.consistent = on }
+}
+
+// WithTimeout bounds each operation, retries included, on top of the
+// caller's context. Zero leaves only the caller's deadline.
+func WithTimeout(d time.Duration) Option {
+	return func(t *Table) { t.timeout = d }
+}
+
+// WithRetry replaces the default Throttling policy.
+func WithRetry(p retry.Policy) Option {
+	return func(t *Table) { t.retry = p }
+}
+
+// NewTable returns the table name reached through db.
+func NewTable(db API, name string, opts ...Option) *Table {
+	t := &Table{Name: name, db: db, retry: Throttling()}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// do runs fn under the table's timeout and retry policy and maps the
+// error it ends with.
+func (t *Table) do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+	_, err := retry.Do(ctx, t.retry, fn)
+	return t.wrap(op, err)
+}
+
+// wrap maps condition failures to ErrConditionFailed and prefixes other
+// errors with the operation and table. Sentinels pass through unchanged.
+func (t *Table) wrap(op string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrConditionFailed):
+		return err
+	case conditionFailed(err):
+		return fmt.Errorf("%s %s: %w", op, t.Name, ErrConditionFailed)
+	}
+	return fmt.Errorf("%s %s: %w", op, t.Name, err)
+}
+
+// Get reads the item at key into a T.
+func Get[T any](ctx context.Context, t *Table, key Key) (T, error) {
+	var out T
+	err := t.do(ctx, "get", func(ctx context.Context) error {
+		result, err := t.db.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(t.Name),
+			Key:            t.scopeKey(ctx, key),
+			ConsistentRead: aws.Bool(t.consistent),
+		})
+		if err != nil {
+			return err
+		}
+		if len(result.Item) == 0 {
+			return retry.Permanent(ErrNotFound)
+		}
+		return retry.Permanent(attributevalue.UnmarshalMap(t.unscopeItem(ctx, result.Item), &out))
+	})
+	return out, err
+}
+
+// Put writes item, replacing any item with the same key, if every
+// condition holds.
+func (t *Table) Put(ctx context.Context, item interface{}, conditions ...Condition) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("put %s: failed to marshal item: %w", t.Name, err)
+	}
+	input := &dynamodb.PutItemInput{TableName: aws.String(t.Name), Item: t.scopeItem(ctx, av)}
+	input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = all(conditions).render()
+
+	return t.do(ctx, "put", func(ctx context.Context) error {
+		_, err := t.db.PutItem(ctx, input)
+		return err
+	})
+}
+
+// Update applies u to the item at key. With out non-nil the item as
+// updated is decoded into it.
+func (t *Table) Update(ctx context.Context, key Key, u Update, out interface{}) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(t.Name),
+		Key:                       t.scopeKey(ctx, key),
+		UpdateExpression:          aws.String(u.Expression),
+		ExpressionAttributeNames:  u.Names,
+		ExpressionAttributeValues: u.Values,
+	}
+	if u.Condition != "" {
+		input.ConditionExpression = aws.String(u.Condition)
+	}
+	if out != nil {
+		input.ReturnValues = types.ReturnValueAllNew
+	}
+
+	return t.do(ctx, "update", func(ctx context.Context) error {
+		result, err := t.db.UpdateItem(ctx, input)
+		if err != nil || out == nil {
+			return err
+		}
+		return retry.Permanent(attributevalue.UnmarshalMap(t.unscopeItem(ctx, result.Attributes), out))
+	})
+}
+
+// Delete removes the item at key if every condition holds. Deleting a
+// missing item without conditions succeeds.
+func (t *Table) Delete(ctx context.Context, key Key, conditions ...Condition) error {
+	input := &dynamodb.DeleteItemInput{TableName: aws.String(t.Name), Key: t.scopeKey(ctx, key)}
+	input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = all(conditions).render()
+
+	return t.do(ctx, "delete", func(ctx context.Context) error {
+		_, err := t.db.DeleteItem(ctx, input)
+		return err
+	})
+}
@@ -0,0 +1,79 @@
+package dynamo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+
+	"pkg/retry"
+)
+
+// errUnprocessed asks for another BatchGetItem or BatchWriteItem attempt
+// with the keys or items DynamoDB left unprocessed.
+var errUnprocessed = errors.New("keys left unprocessed")
+
+// throttlingCodes are the DynamoDB error codes a later attempt can succeed
+// past.
+var throttlingCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+	"LimitExceededException":                 true,
+	"InternalServerError":                    true,
+	"TransactionInProgressException":         true,
+}
+
+// Throttling is the default retry policy: up to five attempts over about
+// three seconds when DynamoDB throttles or a transaction conflicts. It
+// runs on top of the SDK's own retries, which give up quickly on a hot
+// partition.
+func Throttling() retry.Policy {
+	return retry.Policy{
+		MaxAttempts: 5,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Jitter:      1,
+		Retryable:   Retryable,
+	}
+}
+
+// Retryable reports whether err is DynamoDB throttling, a transaction
+// conflict or keys left unprocessed.
+func Retryable(err error) bool {
+	if errors.Is(err, errUnprocessed) {
+		return true
+	}
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for _, reason := range canceled.CancellationReasons {
+			switch code := aws.ToString(reason.Code); code {
+			case "TransactionConflict", "ThrottlingError", "ProvisionedThroughputExceeded":
+				return true
+			}
+		}
+		return false
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && throttlingCodes[apiErr.ErrorCode()]
+}
+
+// conditionFailed reports whether err is a failed condition on a single
+// write or within a cancelled transaction.
+func conditionFailed(err error) bool {
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return true
+	}
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for _, reason := range canceled.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+	return false
+}
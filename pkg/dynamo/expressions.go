@@ -0,0 +1,102 @@
+package dynamo
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Condition is a condition expression with its placeholders. Conditions
+// passed together must not reuse a placeholder for different values.
+type Condition struct {
+	Expression string
+	Names      map[string]string
+	Values     map[string]types.AttributeValue
+}
+
+// IfNotExists holds when the item has no attr, which for a key attribute
+// means there is no item: create, never overwrite.
+func IfNotExists(attr string) Condition {
+	return Condition{
+		Expression: "attribute_not_exists(#" + attr + ")",
+		Names:      map[string]string{"#" + attr: attr},
+	}
+}
+
+// IfExists holds when the item has attr, which for a key attribute means
+// the item exists: update, never create.
+func IfExists(attr string) Condition {
+	return Condition{
+		Expression: "attribute_exists(#" + attr + ")",
+		Names:      map[string]string{"#" + attr: attr},
+	}
+}
+
+// IfEquals holds when attr is value, as for an optimistic version check.
+func IfEquals(attr string, value types.AttributeValue) Condition {
+	return Condition{
+		Expression: "#" + attr + " = :" + attr,
+		Names:      map[string]string{"#" + attr: attr},
+		Values:     map[string]types.AttributeValue{":" + attr: value},
+	}
+}
+
+// IfVersion holds when the numeric attr is version, the optimistic check
+// for items versioned on write. Items written before they carried attr
+// count as version 0.
+func IfVersion(attr string, version int64) Condition {
+	if version == 0 {
+		return IfNotExists(attr)
+	}
+	return IfEquals(attr, N(strconv.FormatInt(version, 10)))
+}
+
+// Update is an update expression, an optional condition and the
+// placeholders both use.
+type Update struct {
+	Expression string
+	Condition  string
+	Names      map[string]string
+	Values     map[string]types.AttributeValue
+}
+
+type all []Condition
+
+// render ANDs the conditions into request fields, all nil when there are
+// none.
+func (cs all) render() (*string, map[string]string, map[string]types.AttributeValue) {
+	if len(cs) == 0 {
+		return nil, nil, nil
+	}
+	var parts []string
+	var names map[string]string
+	var values map[string]types.AttributeValue
+	for _, c := range cs {
+		parts = append(parts, "("+c.Expression+")")
+		for k, v := range c.Names {
+			if names == nil {
+				names = make(map[string]string)
+			}
+			names[k] = v
+		}
+		for k, v := range c.Values {
+			if values == nil {
+				values = make(map[string]types.AttributeValue)
+			}
+			values[k] = v
+		}
+	}
+	return aws.String(strings.Join(parts, " AND ")), names, values
+}
+
+// S is a string attribute value.
+func S(value string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: value}
+}
+
+// N is a number attribute value from its decimal string.
+func N(value string) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: value}
+}
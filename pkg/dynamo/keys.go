@@ -0,0 +1,58 @@
+package dynamo
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Key is an item's primary key.
+type Key map[string]types.AttributeValue
+
+// StringKey is a partition key alone.
+func StringKey(name, value string) Key {
+	return Key{name: S(value)}
+}
+
+// CompositeKey is a partition and sort key.
+func CompositeKey(partitionName, partition, sortName, sort string) Key {
+	return Key{partitionName: S(partition), sortName: S(sort)}
+}
+
+// Single-table designs keep several entity types in one table under
+// generic key attributes, with each key naming its entity:
+//
+//	pk = USER#<user id>     sk = PROFILE
+//	pk = USER#<user id>     sk = ORDER#<order id>
+//
+// so one Query on pk returns a user with everything beneath it, and
+// begins_with(sk, "ORDER#") narrows it to one kind.
+const (
+	PartitionKey = "pk"
+	SortKey      = "sk"
+	// Separator joins the parts of a composed key.
+	Separator = "#"
+)
+
+// ItemKey is the single-table key of an item.
+func ItemKey(pk, sk string) Key {
+	return CompositeKey(PartitionKey, pk, SortKey, sk)
+}
+
+// Compose joins an entity name and its identifiers into a key value:
+// Compose("ORDER", "2024-05-01", id) is "ORDER#2024-05-01#<id>".
+func Compose(entity string, ids ...string) string {
+	return strings.Join(append([]string{entity}, ids...), Separator)
+}
+
+// Prefix is the begins_with operand matching every key of entity.
+func Prefix(entity string) string {
+	return entity + Separator
+}
+
+// Split is the inverse of Compose, returning the entity and identifiers.
+// Identifiers must not contain Separator for the split to be exact.
+func Split(value string) (entity string, ids []string) {
+	parts := strings.Split(value, Separator)
+	return parts[0], parts[1:]
+}
@@ -0,0 +1,214 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/retry"
+)
+
+// Query selects items by partition key, on the table or one of its
+// indexes.
+type Query struct {
+	// Index is the secondary index to query; empty for the table.
+	Index string
+	// KeyCondition is the key condition expression, e.g.
+	// "pk = :pk AND begins_with(sk, :prefix)".
+	KeyCondition string
+	// Filter drops items after they are read; they still count against
+	// Limit and capacity.
+	Filter     string
+	Projection string
+	Names      map[string]string
+	Values     map[string]types.AttributeValue
+	// Limit is the number of items read per page; zero lets DynamoDB
+	// fill 1 MB.
+	Limit int32
+	// Descending returns items in reverse sort key order.
+	Descending bool
+	// Start resumes after a previous page's Next.
+	Start Key
+}
+
+// Scan reads every item of the table or an index.
+type Scan struct {
+	Index      string
+	Filter     string
+	Projection string
+	Names      map[string]string
+	Values     map[string]types.AttributeValue
+	Limit      int32
+	Start      Key
+}
+
+// Page is one page of results. Next is nil on the last page.
+type Page[T any] struct {
+	Items []T
+	Next  Key
+}
+
+// QueryPage reads one page of q.
+func QueryPage[T any](ctx context.Context, t *Table, q Query) (Page[T], error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(t.Name),
+		KeyConditionExpression: aws.String(q.KeyCondition),
+		ScanIndexForward:       aws.Bool(!q.Descending),
+		ExclusiveStartKey:      q.Start,
+	}
+	if q.Index != "" {
+		input.IndexName = aws.String(q.Index)
+	} else {
+		input.ConsistentRead = aws.Bool(t.consistent)
+	}
+	input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = t.scopeFilter(ctx, q.Filter, q.Names, q.Values)
+	if q.Projection != "" {
+		input.ProjectionExpression = aws.String(q.Projection)
+	}
+	if q.Limit > 0 {
+		input.Limit = aws.Int32(q.Limit)
+	}
+
+	var page Page[T]
+	err := t.do(ctx, "query", func(ctx context.Context) error {
+		result, err := t.db.Query(ctx, input)
+		if err != nil {
+			return err
+		}
+		page.Next = result.LastEvaluatedKey
+		return retry.Permanent(decodePage(t.unscopeItems(ctx, result.Items), &page))
+	})
+	return page, err
+}
+
+// QueryEach reads every page of q, handing each to fn; an error from fn
+// stops the query and is returned as is.
+func QueryEach[T any](ctx context.Context, t *Table, q Query, fn func([]T) error) error {
+	for {
+		page, err := QueryPage[T](ctx, t, q)
+		if err != nil {
+			return err
+		}
+		if err := fn(page.Items); err != nil {
+			return err
+		}
+		if len(page.Next) == 0 {
+			return nil
+		}
+		q.Start = page.Next
+	}
+}
+
+// QueryAll reads every item q selects.
+func QueryAll[T any](ctx context.Context, t *Table, q Query) ([]T, error) {
+	items := []T{}
+	err := QueryEach(ctx, t, q, func(page []T) error {
+		items = append(items, page...)
+		return nil
+	})
+	return items, err
+}
+
+// ScanPage reads one page of s.
+func ScanPage[T any](ctx context.Context, t *Table, s Scan) (Page[T], error) {
+	input := &dynamodb.ScanInput{
+		TableName:         aws.String(t.Name),
+		ExclusiveStartKey: s.Start,
+	}
+	if s.Index != "" {
+		input.IndexName = aws.String(s.Index)
+	} else {
+		input.ConsistentRead = aws.Bool(t.consistent)
+	}
+	input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = t.scopeFilter(ctx, s.Filter, s.Names, s.Values)
+	if s.Projection != "" {
+		input.ProjectionExpression = aws.String(s.Projection)
+	}
+	if s.Limit > 0 {
+		input.Limit = aws.Int32(s.Limit)
+	}
+
+	var page Page[T]
+	err := t.do(ctx, "scan", func(ctx context.Context) error {
+		result, err := t.db.Scan(ctx, input)
+		if err != nil {
+			return err
+		}
+		page.Next = result.LastEvaluatedKey
+		return retry.Permanent(decodePage(t.unscopeItems(ctx, result.Items), &page))
+	})
+	return page, err
+}
+
+// ScanEach reads every page of s, handing each to fn.
+func ScanEach[T any](ctx context.Context, t *Table, s Scan, fn func([]T) error) error {
+	for {
+		page, err := ScanPage[T](ctx, t, s)
+		if err != nil {
+			return err
+		}
+		if err := fn(page.Items); err != nil {
+			return err
+		}
+		if len(page.Next) == 0 {
+			return nil
+		}
+		s.Start = page.Next
+	}
+}
+
+func decodePage[T any](items []map[string]types.AttributeValue, page *Page[T]) error {
+	page.Items = make([]T, 0, len(items))
+	if err := attributevalue.UnmarshalListOfMaps(items, &page.Items); err != nil {
+		return fmt.Errorf("failed to unmarshal items: %w", err)
+	}
+	return nil
+}
+
+// batchGetSize is the most keys one BatchGetItem call accepts.
+const batchGetSize = 100
+
+// BatchGet reads the items at keys, in no particular order; keys with no
+// item are left out. Keys are sent 100 to a call, and keys DynamoDB leaves
+// unprocessed are retried under the table's retry policy.
+func BatchGet[T any](ctx context.Context, t *Table, keys []Key) ([]T, error) {
+	items := []T{}
+	for start := 0; start < len(keys); start += batchGetSize {
+		end := start + batchGetSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunk := make([]map[string]types.AttributeValue, 0, end-start)
+		for _, key := range keys[start:end] {
+			chunk = append(chunk, t.scopeKey(ctx, key))
+		}
+		request := map[string]types.KeysAndAttributes{
+			t.Name: {Keys: chunk, ConsistentRead: aws.Bool(t.consistent)},
+		}
+
+		err := t.do(ctx, "batch get", func(ctx context.Context) error {
+			result, err := t.db.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return err
+			}
+			var page []T
+			if err := attributevalue.UnmarshalListOfMaps(t.unscopeItems(ctx, result.Responses[t.Name]), &page); err != nil {
+				return retry.Permanent(fmt.Errorf("failed to unmarshal items: %w", err))
+			}
+			items = append(items, page...)
+			if len(result.UnprocessedKeys) > 0 {
+				request = result.UnprocessedKeys
+				return errUnprocessed
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
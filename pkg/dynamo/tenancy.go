@@ -0,0 +1,131 @@
+package dynamo
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/tenant"
+)
+
+// WithTenancy scopes the table to the tenant of each operation's context
+// (see pkg/tenant). Keys and written items have their partition key,
+// named partition, prefixed with the tenant, written items get the
+// tenant_id attribute, items read back have the prefix removed, and Query
+// and Scan keep only the tenant's items. Callers use IDs as the tenant
+// knows them, except in a Query's key condition on the table's own
+// partition key, whose value must be the stored form, tenant.Key. The
+// expression names #tenant and :tenant are reserved.
+//
+// Update does not set tenant_id, so it should only change items that
+// exist.
+func WithTenancy(partition string) Option {
+	return func(t *Table) { t.tenantKey = partition }
+}
+
+// scopeKey is key as stored for ctx's tenant. key is left unchanged.
+func (t *Table) scopeKey(ctx context.Context, key Key) Key {
+	if t.tenantKey == "" {
+		return key
+	}
+	scoped := make(Key, len(key))
+	for name, value := range key {
+		scoped[name] = t.scopeValue(ctx, name, value)
+	}
+	return scoped
+}
+
+// scopeItem is item as stored for ctx's tenant. item is left unchanged.
+func (t *Table) scopeItem(ctx context.Context, item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	if t.tenantKey == "" {
+		return item
+	}
+	scoped := make(map[string]types.AttributeValue, len(item)+1)
+	for name, value := range item {
+		scoped[name] = t.scopeValue(ctx, name, value)
+	}
+	scoped[tenant.Attr] = S(tenant.FromContext(ctx))
+	return scoped
+}
+
+func (t *Table) scopeValue(ctx context.Context, name string, value types.AttributeValue) types.AttributeValue {
+	if s, ok := value.(*types.AttributeValueMemberS); ok && name == t.tenantKey {
+		return S(tenant.Key(ctx, s.Value))
+	}
+	return value
+}
+
+// unscopeItem strips the tenant from item's partition key, in place.
+func (t *Table) unscopeItem(ctx context.Context, item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	if t.tenantKey == "" {
+		return item
+	}
+	if s, ok := item[t.tenantKey].(*types.AttributeValueMemberS); ok {
+		item[t.tenantKey] = S(tenant.TrimKey(ctx, s.Value))
+	}
+	return item
+}
+
+func (t *Table) unscopeItems(ctx context.Context, items []map[string]types.AttributeValue) []map[string]types.AttributeValue {
+	for _, item := range items {
+		t.unscopeItem(ctx, item)
+	}
+	return items
+}
+
+// scopeFilter ANDs the tenant's filter onto a Query or Scan filter,
+// returning the request fields. names and values are left unchanged.
+func (t *Table) scopeFilter(ctx context.Context, filter string, names map[string]string, values map[string]types.AttributeValue) (*string, map[string]string, map[string]types.AttributeValue) {
+	if t.tenantKey == "" {
+		if filter == "" {
+			return nil, names, values
+		}
+		return aws.String(filter), names, values
+	}
+
+	expr, tenantNames, value := tenant.Filter(ctx)
+	if filter != "" {
+		expr = "(" + filter + ") AND " + expr
+	}
+	scopedNames := make(map[string]string, len(names)+len(tenantNames))
+	for k, v := range names {
+		scopedNames[k] = v
+	}
+	for k, v := range tenantNames {
+		scopedNames[k] = v
+	}
+	scopedValues := make(map[string]types.AttributeValue, len(values)+1)
+	for k, v := range values {
+		scopedValues[k] = v
+	}
+	scopedValues[":tenant"] = S(value)
+	return aws.String(expr), scopedNames, scopedValues
+}
+
+// scopeTx scopes a transaction write to ctx's tenant when the table that
+// built it is tenant scoped.
+func (t *Table) scopeTx(ctx context.Context, item types.TransactWriteItem) types.TransactWriteItem {
+	if t == nil || t.tenantKey == "" {
+		return item
+	}
+	switch {
+	case item.Put != nil:
+		put := *item.Put
+		put.Item = t.scopeItem(ctx, put.Item)
+		item.Put = &put
+	case item.Update != nil:
+		update := *item.Update
+		update.Key = t.scopeKey(ctx, update.Key)
+		item.Update = &update
+	case item.Delete != nil:
+		del := *item.Delete
+		del.Key = t.scopeKey(ctx, del.Key)
+		item.Delete = &del
+	case item.ConditionCheck != nil:
+		check := *item.ConditionCheck
+		check.Key = t.scopeKey(ctx, check.Key)
+		item.ConditionCheck = &check
+	}
+	return item
+}
@@ -0,0 +1,79 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TxItem is one write of a transaction, built by a table's PutTx,
+// UpdateTx, DeleteTx or CheckTx.
+type TxItem struct {
+	item  types.TransactWriteItem
+	table *Table
+	err   error
+}
+
+// PutTx writes item as part of a transaction.
+func (t *Table) PutTx(item interface{}, conditions ...Condition) TxItem {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return TxItem{err: fmt.Errorf("put %s: failed to marshal item: %w", t.Name, err)}
+	}
+	put := &types.Put{TableName: aws.String(t.Name), Item: av}
+	put.ConditionExpression, put.ExpressionAttributeNames, put.ExpressionAttributeValues = all(conditions).render()
+	return TxItem{item: types.TransactWriteItem{Put: put}, table: t}
+}
+
+// UpdateTx applies u to the item at key as part of a transaction.
+func (t *Table) UpdateTx(key Key, u Update) TxItem {
+	update := &types.Update{
+		TableName:                 aws.String(t.Name),
+		Key:                       key,
+		UpdateExpression:          aws.String(u.Expression),
+		ExpressionAttributeNames:  u.Names,
+		ExpressionAttributeValues: u.Values,
+	}
+	if u.Condition != "" {
+		update.ConditionExpression = aws.String(u.Condition)
+	}
+	return TxItem{item: types.TransactWriteItem{Update: update}, table: t}
+}
+
+// DeleteTx removes the item at key as part of a transaction.
+func (t *Table) DeleteTx(key Key, conditions ...Condition) TxItem {
+	del := &types.Delete{TableName: aws.String(t.Name), Key: key}
+	del.ConditionExpression, del.ExpressionAttributeNames, del.ExpressionAttributeValues = all(conditions).render()
+	return TxItem{item: types.TransactWriteItem{Delete: del}, table: t}
+}
+
+// CheckTx makes a transaction depend on cond holding for the item at key
+// without writing it.
+func (t *Table) CheckTx(key Key, cond Condition) TxItem {
+	check := &types.ConditionCheck{TableName: aws.String(t.Name), Key: key}
+	check.ConditionExpression, check.ExpressionAttributeNames, check.ExpressionAttributeValues = all{cond}.render()
+	return TxItem{item: types.TransactWriteItem{ConditionCheck: check}, table: t}
+}
+
+// TransactWrite applies items atomically; they may span tables. A failed
+// condition anywhere cancels the transaction with ErrConditionFailed.
+// Conflicts with concurrent transactions and throttling are retried under
+// t's policy.
+func (t *Table) TransactWrite(ctx context.Context, items ...TxItem) error {
+	input := &dynamodb.TransactWriteItemsInput{}
+	for _, item := range items {
+		if item.err != nil {
+			return item.err
+		}
+		input.TransactItems = append(input.TransactItems, item.table.scopeTx(ctx, item.item))
+	}
+
+	return t.do(ctx, "transact write", func(ctx context.Context) error {
+		_, err := t.db.TransactWriteItems(ctx, input)
+		return err
+	})
+}
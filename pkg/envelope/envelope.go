@@ -0,0 +1,296 @@
+// Package envelope is the wire format for messages published to SNS and
+// SQS. Every message carries its type and schema version, the producer,
+// the tenant it concerns and a checksum of the body, so consumers can route
+// and reject messages without guessing from payload fields. Bodies with
+// personal data are encrypted with a KMS data key (AES-256-GCM) bound to the
+// envelope metadata, so subscribers without key access see only metadata.
+//
+// Producers:
+//
+//	codec := envelope.New("campaign-monitor", nil, "", clk)
+//	raw, err := codec.Seal(ctx, envelope.Meta{Type: "campaign_alert", SchemaVersion: 1}, alert)
+//
+// Consumers:
+//
+//	env, err := codec.Open(ctx, raw)
+//	if err := env.Expect("campaign_alert", 1); err != nil { ... }
+//	err = env.Decode(&alert)
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	"pkg/clock"
+	"pkg/ids"
+)
+
+// Version is the envelope format version written by this package.
+const Version = 1
+
+// Algorithm is the body cipher for encrypted envelopes.
+const Algorithm = "AES-256-GCM"
+
+var (
+	// ErrNotEnvelope is returned by Open for messages published before
+	// producers adopted envelopes; consumers may fall back to the raw body.
+	ErrNotEnvelope = errors.New("envelope: message is not an envelope")
+	// ErrChecksum means the body does not match the envelope checksum.
+	ErrChecksum = errors.New("envelope: checksum mismatch")
+	// ErrNoKey means an encrypted body was received by a codec without KMS.
+	ErrNoKey = errors.New("envelope: encrypted body but no KMS client")
+	// ErrKeyUnavailable wraps KMS failures. Unlike the errors above it says
+	// nothing about the message, so consumers should retry rather than
+	// discard it.
+	ErrKeyUnavailable = errors.New("envelope: KMS unavailable")
+)
+
+// Meta is what the producer states about a message.
+type Meta struct {
+	// Type names the message contract, e.g. "campaign_alert".
+	Type string
+	// SchemaVersion is the contract version; bump it on breaking changes.
+	SchemaVersion int
+	// Tenant is the account the message concerns, empty for
+	// platform-wide messages.
+	Tenant string
+	// Sensitive bodies carry personal data and are encrypted.
+	Sensitive bool
+}
+
+// Envelope is a message on the wire. After Open, Body holds the plaintext
+// body whether or not it was encrypted.
+type Envelope struct {
+	EnvelopeVersion int             `json:"envelope_version"`
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	SchemaVersion   int             `json:"schema_version"`
+	Producer        string          `json:"producer"`
+	Tenant          string          `json:"tenant,omitempty"`
+	PublishedAt     time.Time       `json:"published_at"`
+	Checksum        string          `json:"checksum"`
+	Encryption      *Encryption     `json:"encryption,omitempty"`
+	Body            json.RawMessage `json:"body,omitempty"`
+	Ciphertext      string          `json:"ciphertext,omitempty"`
+}
+
+// Encryption describes an encrypted body. The data key is encrypted under
+// KeyID with the envelope's type and producer as KMS encryption context.
+type Encryption struct {
+	Algorithm    string `json:"alg"`
+	KeyID        string `json:"key_id"`
+	EncryptedKey string `json:"encrypted_key"`
+	Nonce        string `json:"nonce"`
+}
+
+// Codec seals and opens envelopes for one producer. KMS and KeyID are only
+// needed to seal sensitive messages or open encrypted ones.
+type Codec struct {
+	Producer string
+	KMS      *kms.Client
+	KeyID    string
+	Clock    clock.Clock
+	IDs      ids.Generator
+}
+
+// New returns a Codec for producer. client may be nil when the producer
+// neither publishes nor consumes encrypted messages.
+func New(producer string, client *kms.Client, keyID string, clk clock.Clock) *Codec {
+	return &Codec{Producer: producer, KMS: client, KeyID: keyID, Clock: clk, IDs: ids.FromEnv(clk)}
+}
+
+// Seal marshals body into an envelope and returns the wire form, ready to
+// be used as an SNS or SQS message body.
+func (c *Codec) Seal(ctx context.Context, meta Meta, body interface{}) (string, error) {
+	plaintext, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("envelope: failed to marshal body: %w", err)
+	}
+
+	env := Envelope{
+		EnvelopeVersion: Version,
+		ID:              c.IDs.NewID(),
+		Type:            meta.Type,
+		SchemaVersion:   meta.SchemaVersion,
+		Producer:        c.Producer,
+		Tenant:          meta.Tenant,
+		PublishedAt:     c.Clock.Now().UTC(),
+		Checksum:        checksum(plaintext),
+	}
+
+	if meta.Sensitive {
+		if err := c.encrypt(ctx, &env, plaintext); err != nil {
+			return "", err
+		}
+	} else {
+		env.Body = plaintext
+	}
+
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return "", fmt.Errorf("envelope: failed to marshal envelope: %w", err)
+	}
+	return string(raw), nil
+}
+
+// Open parses and verifies an envelope, decrypting the body if needed.
+// Messages that are not envelopes return ErrNotEnvelope.
+func (c *Codec) Open(ctx context.Context, raw string) (Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal([]byte(raw), &env); err != nil || env.EnvelopeVersion == 0 {
+		return Envelope{}, ErrNotEnvelope
+	}
+	if env.EnvelopeVersion > Version {
+		return Envelope{}, fmt.Errorf("envelope: unsupported envelope version %d", env.EnvelopeVersion)
+	}
+
+	if env.Encryption != nil {
+		plaintext, err := c.decrypt(ctx, env)
+		if err != nil {
+			return Envelope{}, err
+		}
+		env.Body = plaintext
+		env.Ciphertext = ""
+	}
+
+	if checksum(env.Body) != env.Checksum {
+		return Envelope{}, ErrChecksum
+	}
+	return env, nil
+}
+
+// Expect checks the envelope is of msgType with a schema version the
+// consumer understands.
+func (e Envelope) Expect(msgType string, maxSchemaVersion int) error {
+	if e.Type != msgType {
+		return fmt.Errorf("envelope: expected %s message, got %s", msgType, e.Type)
+	}
+	if e.SchemaVersion < 1 || e.SchemaVersion > maxSchemaVersion {
+		return fmt.Errorf("envelope: %s schema version %d not supported (max %d)", msgType, e.SchemaVersion, maxSchemaVersion)
+	}
+	return nil
+}
+
+// Decode unmarshals the body into v.
+func (e Envelope) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Body, v); err != nil {
+		return fmt.Errorf("envelope: failed to decode %s body: %w", e.Type, err)
+	}
+	return nil
+}
+
+func (c *Codec) encrypt(ctx context.Context, env *Envelope, plaintext []byte) error {
+	if c.KMS == nil || c.KeyID == "" {
+		return fmt.Errorf("envelope: %s is sensitive but no KMS key is configured", env.Type)
+	}
+
+	key, err := c.KMS.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(c.KeyID),
+		KeySpec:           kmstypes.DataKeySpecAes256,
+		EncryptionContext: encryptionContext(*env),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: failed to generate data key: %v", ErrKeyUnavailable, err)
+	}
+
+	gcm, err := newGCM(key.Plaintext)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("envelope: failed to read nonce: %w", err)
+	}
+
+	env.Encryption = &Encryption{
+		Algorithm:    Algorithm,
+		KeyID:        aws.ToString(key.KeyId),
+		EncryptedKey: base64.StdEncoding.EncodeToString(key.CiphertextBlob),
+		Nonce:        base64.StdEncoding.EncodeToString(nonce),
+	}
+	env.Ciphertext = base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, additionalData(*env)))
+	return nil
+}
+
+func (c *Codec) decrypt(ctx context.Context, env Envelope) ([]byte, error) {
+	if env.Encryption.Algorithm != Algorithm {
+		return nil, fmt.Errorf("envelope: unsupported algorithm %q", env.Encryption.Algorithm)
+	}
+	if c.KMS == nil {
+		return nil, ErrNoKey
+	}
+
+	encryptedKey, err := base64.StdEncoding.DecodeString(env.Encryption.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: malformed encrypted key: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(env.Encryption.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: malformed nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: malformed ciphertext: %w", err)
+	}
+
+	key, err := c.KMS.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    encryptedKey,
+		KeyId:             aws.String(env.Encryption.KeyID),
+		EncryptionContext: encryptionContext(env),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt data key: %v", ErrKeyUnavailable, err)
+	}
+
+	gcm, err := newGCM(key.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("envelope: nonce must be %d bytes", gcm.NonceSize())
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData(env))
+	if err != nil {
+		return nil, fmt.Errorf("envelope: failed to decrypt body: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: invalid data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptionContext ties the data key to the message type and producer;
+// KMS key policies can grant consumers decryption per type.
+func encryptionContext(env Envelope) map[string]string {
+	return map[string]string{"type": env.Type, "producer": env.Producer}
+}
+
+// additionalData binds the ciphertext to the envelope metadata so a body
+// cannot be replayed under another ID, type, tenant or schema version.
+func additionalData(env Envelope) []byte {
+	return []byte(env.ID + "|" + env.Type + "|" + strconv.Itoa(env.SchemaVersion) + "|" + env.Producer + "|" + env.Tenant)
+}
+
+func checksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+// Package etag implements entity tags for versioned items. An item's tag
+// is its version number, quoted: reads send it as ETag and honour
+// If-None-Match, and writes require it in If-Match so that concurrent
+// writers get 412 Precondition Failed instead of overwriting each other.
+//
+//	pre, ok := etag.RequireIfMatch(w, r)
+//	if !ok {
+//		return
+//	}
+//	if !pre.Matches(item.Version) {
+//		etag.WriteFailed(w, r, item.Version)
+//		return
+//	}
+package etag
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pkg/problem"
+)
+
+// Format is the entity tag of version.
+func Format(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Set sends version as the response's ETag.
+func Set(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", Format(version))
+}
+
+// Precondition is a parsed If-Match header: any current version, or one.
+type Precondition struct {
+	Any     bool
+	Version int64
+}
+
+// Matches reports whether an item at version satisfies the precondition.
+func (p Precondition) Matches(version int64) bool {
+	return p.Any || p.Version == version
+}
+
+// RequireIfMatch parses If-Match. A missing header is answered with 428
+// and a malformed one with 400, and ok is then false. Weak tags are
+// rejected: If-Match compares strongly.
+func RequireIfMatch(w http.ResponseWriter, r *http.Request) (pre Precondition, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		problem.Write(w, r, problem.New(http.StatusPreconditionRequired,
+			"If-Match with the ETag last read is required"))
+		return Precondition{}, false
+	}
+	if header == "*" {
+		return Precondition{Any: true}, true
+	}
+	version, err := parse(header)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return Precondition{}, false
+	}
+	return Precondition{Version: version}, true
+}
+
+// NotModified reports whether If-None-Match names version, in which case
+// the caller answers 304 instead of the item. Weak tags match too.
+func NotModified(r *http.Request, version int64) bool {
+	header := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if v, err := parse(tag); err == nil && v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteNotModified answers a conditional GET whose tag still matches.
+func WriteNotModified(w http.ResponseWriter, version int64) {
+	Set(w, version)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// WriteFailed answers a write whose If-Match is stale with 412 and the
+// current ETag, for the caller to reload and retry.
+func WriteFailed(w http.ResponseWriter, r *http.Request, current int64) {
+	Set(w, current)
+	problem.Write(w, r, problem.New(http.StatusPreconditionFailed,
+		"The resource has changed since it was read; reload it and retry"))
+}
+
+func parse(tag string) (int64, error) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, fmt.Errorf("If-Match must be a quoted ETag such as %s", Format(1))
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("If-Match %s is not an ETag this service issued", tag)
+	}
+	return version, nil
+}
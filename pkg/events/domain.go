@@ -0,0 +1,145 @@
+package events
+
+import (
+	"time"
+
+	"pkg/money"
+)
+
+// EventBridge sources of the publishers.
+const (
+	SourceUserService     = "ecommerce.user-service"
+	SourceOrderService    = "ecommerce.order-service"
+	SourceCartService     = "ecommerce.cart-service"
+	SourceBidApplier      = "ecommerce.bid-applier"
+	SourceCampaignMonitor = "ecommerce.campaign-monitor"
+)
+
+// Detail types of the events. Rules match on these, so renaming one is a
+// breaking change for every rule and consumer.
+const (
+	DetailTypeUserRegistered      = "User Registered"
+	DetailTypeOrderCompleted      = "Order Completed"
+	DetailTypeCartAbandoned       = "Cart Abandoned"
+	DetailTypeBidApplied          = "Bid Applied"
+	DetailTypeCampaignAlertRaised = "Campaign Alert Raised"
+)
+
+var (
+	userRegistered = register(Type{
+		DetailType:  DetailTypeUserRegistered,
+		Source:      SourceUserService,
+		Version:     1,
+		Description: "A user signed up. Consumers look the user up for anything else, so no contact details travel on the bus.",
+	}, UserRegistered{})
+
+	orderCompleted = register(Type{
+		DetailType:  DetailTypeOrderCompleted,
+		Source:      SourceOrderService,
+		Version:     1,
+		Description: "An order was paid and completed.",
+	}, OrderCompleted{})
+
+	cartAbandoned = register(Type{
+		DetailType:  DetailTypeCartAbandoned,
+		Source:      SourceCartService,
+		Version:     1,
+		Description: "A cart with items sat idle past the abandonment window.",
+	}, CartAbandoned{})
+
+	bidApplied = register(Type{
+		DetailType:  DetailTypeBidApplied,
+		Source:      SourceBidApplier,
+		Version:     1,
+		Description: "An approved keyword bid change was set on its ad platform.",
+	}, BidApplied{})
+
+	campaignAlertRaised = register(Type{
+		DetailType:  DetailTypeCampaignAlertRaised,
+		Source:      SourceCampaignMonitor,
+		Version:     1,
+		Description: "The campaign monitor raised an alert about a campaign or account.",
+	}, CampaignAlertRaised{})
+)
+
+// UserRegistered is published by user-service when a user signs up.
+type UserRegistered struct {
+	UserID           string    `json:"user_id" validate:"required"`
+	MarketingConsent bool      `json:"marketing_consent"`
+	RegisteredAt     time.Time `json:"registered_at" validate:"required"`
+}
+
+func (UserRegistered) EventType() Type { return userRegistered }
+
+// OrderCompleted is published by order-service when an order completes.
+// Guest orders have no user.
+type OrderCompleted struct {
+	OrderID string      `json:"order_id" validate:"required"`
+	UserID  string      `json:"user_id,omitempty"`
+	Items   []OrderItem `json:"items,omitempty"`
+}
+
+func (OrderCompleted) EventType() Type { return orderCompleted }
+
+// OrderItem is one line of a completed order.
+type OrderItem struct {
+	ProductID string `json:"product_id" validate:"required"`
+	Quantity  int    `json:"quantity" validate:"min=1"`
+}
+
+// CartAbandoned is published by cart-service for each cart it marks
+// abandoned. Anonymous carts carry the visitor's ID as the user.
+type CartAbandoned struct {
+	CartID         string     `json:"cart_id" validate:"required"`
+	UserID         string     `json:"user_id,omitempty"`
+	Currency       string     `json:"currency" validate:"required,currency"`
+	Subtotal       float64    `json:"subtotal" validate:"min=0"`
+	ItemCount      int        `json:"item_count" validate:"required,min=1"`
+	Items          []CartItem `json:"items" validate:"required"`
+	LastActivityAt time.Time  `json:"last_activity_at" validate:"required"`
+	AbandonedAt    time.Time  `json:"abandoned_at" validate:"required"`
+}
+
+func (CartAbandoned) EventType() Type { return cartAbandoned }
+
+// CartItem is one line of an abandoned cart.
+type CartItem struct {
+	SKU       string  `json:"sku" validate:"required"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity" validate:"required,min=1"`
+	UnitPrice float64 `json:"unit_price" validate:"min=0"`
+}
+
+// BidApplied is published by bid-applier for each keyword bid it sets.
+type BidApplied struct {
+	CustomerID   string      `json:"customer_id" validate:"required"`
+	CampaignID   string      `json:"campaign_id" validate:"required"`
+	CampaignName string      `json:"campaign_name,omitempty"`
+	AdGroupID    string      `json:"ad_group_id" validate:"required"`
+	KeywordID    string      `json:"keyword_id" validate:"required"`
+	KeywordText  string      `json:"keyword_text,omitempty"`
+	OldBid       money.Money `json:"old_bid"`
+	NewBid       money.Money `json:"new_bid" validate:"required"`
+	ApprovalID   string      `json:"approval_id" validate:"required"`
+	RunID        string      `json:"run_id,omitempty"`
+	Actor        string      `json:"actor,omitempty"`
+	AppliedAt    time.Time   `json:"applied_at" validate:"required"`
+}
+
+func (BidApplied) EventType() Type { return bidApplied }
+
+// CampaignAlertRaised is published by campaign-monitor for each alert,
+// including those sent as part of a group, which carry the group's cause.
+// The full alert goes to the alerts topic; this is its summary.
+type CampaignAlertRaised struct {
+	CustomerID   string    `json:"customer_id" validate:"required"`
+	CampaignID   string    `json:"campaign_id,omitempty"`
+	CampaignName string    `json:"campaign_name,omitempty"`
+	AlertType    string    `json:"alert_type" validate:"required"`
+	Message      string    `json:"message"`
+	Cause        string    `json:"cause,omitempty"`
+	RunID        string    `json:"run_id,omitempty"`
+	RaisedAt     time.Time `json:"raised_at" validate:"required"`
+}
+
+func (CampaignAlertRaised) EventType() Type { return campaignAlertRaised }
@@ -0,0 +1,198 @@
+// Package events defines the domain events on the platform EventBridge
+// bus: one versioned struct per detail type, the metadata every detail
+// carries, and the helpers publishers and consumers marshal and check them
+// with. The JSON schemas registered in the EventBridge schema registry are
+// generated from the same structs (see schemas/), so the registry, the
+// publishers and the consumers cannot drift apart.
+//
+// Publishers:
+//
+//	enc := events.NewEncoder(clk)
+//	entry, err := enc.Marshal(ctx, events.UserRegistered{UserID: id, RegisteredAt: now})
+//	// PutEvents with entry.Source, entry.DetailType, entry.Detail and entry.Time
+//
+// Consumers:
+//
+//	var order events.OrderCompleted
+//	meta, err := events.Unmarshal(bus.Detail, &order)
+//
+// The metadata travels in the detail under "metadata", next to the event's
+// own fields, so consumers that predate it are unaffected. Details without
+// it, from publishers that predate it, decode as version 1.
+//
+//go:generate go run ./schemagen schemas
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"pkg/clock"
+	"pkg/ids"
+	"pkg/validate"
+)
+
+var (
+	// ErrMalformed means the detail is not a JSON object of the event.
+	ErrMalformed = errors.New("events: malformed detail")
+	// ErrInvalid means the event fails its schema: a required field is
+	// missing or a value is out of range.
+	ErrInvalid = errors.New("events: invalid event")
+	// ErrVersion means the detail is of a schema version newer than the
+	// consumer understands.
+	ErrVersion = errors.New("events: unsupported schema version")
+)
+
+// metadataField is the detail field holding the Metadata.
+const metadataField = "metadata"
+
+// Metadata is what the publisher states about an event.
+type Metadata struct {
+	// ID is the publisher's ID of the event, for logs and traces to
+	// refer to it by.
+	ID string `json:"id" validate:"required"`
+	// Source is the EventBridge source of the publisher.
+	Source string `json:"source" validate:"required"`
+	// Version is the event's schema version.
+	Version int `json:"version" validate:"required,min=1"`
+	// Trace is the X-Ray trace header of the request or invocation that
+	// published the event, empty when there was none.
+	Trace string `json:"trace,omitempty"`
+}
+
+// Type describes one detail type.
+type Type struct {
+	DetailType string
+	Source     string
+	// Version is the schema version publishers write and the newest
+	// consumers understand. Bump it on breaking changes.
+	Version int
+	// Description is registered with the schema.
+	Description string
+
+	event reflect.Type
+}
+
+// Event is a domain event struct.
+type Event interface {
+	EventType() Type
+}
+
+// registered is every event type, in the order schemas are listed.
+var registered []Type
+
+func register(t Type, e Event) Type {
+	t.event = reflect.TypeOf(e)
+	registered = append(registered, t)
+	return t
+}
+
+// Types returns every event type.
+func Types() []Type {
+	return append([]Type(nil), registered...)
+}
+
+// Lookup returns the event type with the detail type.
+func Lookup(detailType string) (Type, bool) {
+	for _, t := range registered {
+		if t.DetailType == detailType {
+			return t, true
+		}
+	}
+	return Type{}, false
+}
+
+// Entry is a marshalled event, ready to become a PutEvents entry.
+type Entry struct {
+	ID         string
+	Source     string
+	DetailType string
+	Detail     string
+	Time       time.Time
+}
+
+// Encoder stamps and marshals events for a publisher.
+type Encoder struct {
+	Clock clock.Clock
+	IDs   ids.Generator
+}
+
+// NewEncoder returns an Encoder stamping events with IDs and times from
+// clk.
+func NewEncoder(clk clock.Clock) *Encoder {
+	return &Encoder{Clock: clk, IDs: ids.FromEnv(clk)}
+}
+
+// Marshal validates e and returns it as an entry, with its metadata and
+// the trace of ctx.
+func (enc *Encoder) Marshal(ctx context.Context, e Event) (Entry, error) {
+	t := e.EventType()
+	if err := validate.Struct(e); err != nil {
+		return Entry{}, fmt.Errorf("%w: %s: %v", ErrInvalid, t.DetailType, err)
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, fmt.Errorf("events: failed to marshal %s: %w", t.DetailType, err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return Entry{}, fmt.Errorf("events: %s is not a JSON object: %w", t.DetailType, err)
+	}
+
+	meta := Metadata{ID: enc.IDs.NewID(), Source: t.Source, Version: t.Version, Trace: Trace(ctx)}
+	fields[metadataField], _ = json.Marshal(meta)
+	detail, err := json.Marshal(fields)
+	if err != nil {
+		return Entry{}, fmt.Errorf("events: failed to marshal %s: %w", t.DetailType, err)
+	}
+	return Entry{
+		ID:         meta.ID,
+		Source:     t.Source,
+		DetailType: t.DetailType,
+		Detail:     string(detail),
+		Time:       enc.Clock.Now().UTC(),
+	}, nil
+}
+
+// Unmarshal decodes detail into e, which must be a pointer to an event
+// struct, and checks it against the event's schema. Every error wraps
+// ErrMalformed, ErrInvalid or ErrVersion: none is worth retrying.
+func Unmarshal(detail []byte, e Event) (Metadata, error) {
+	t := e.EventType()
+	var probe struct {
+		Metadata *Metadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(detail, &probe); err != nil {
+		return Metadata{}, fmt.Errorf("%w: %s: %v", ErrMalformed, t.DetailType, err)
+	}
+	meta := Metadata{Source: t.Source, Version: 1}
+	if probe.Metadata != nil {
+		meta = *probe.Metadata
+	}
+	if meta.Version < 1 || meta.Version > t.Version {
+		return meta, fmt.Errorf("%w: %s version %d (max %d)", ErrVersion, t.DetailType, meta.Version, t.Version)
+	}
+
+	if err := json.Unmarshal(detail, e); err != nil {
+		return meta, fmt.Errorf("%w: %s: %v", ErrMalformed, t.DetailType, err)
+	}
+	if err := validate.Struct(e); err != nil {
+		return meta, fmt.Errorf("%w: %s: %v", ErrInvalid, t.DetailType, err)
+	}
+	return meta, nil
+}
+
+// Check decodes and checks a detail of any registered type, for consumers
+// that pass details on without reading them. Unregistered detail types
+// pass.
+func Check(detailType string, detail []byte) (Metadata, error) {
+	t, ok := Lookup(detailType)
+	if !ok {
+		return Metadata{}, nil
+	}
+	return Unmarshal(detail, reflect.New(t.event).Interface().(Event))
+}
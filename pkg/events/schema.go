@@ -0,0 +1,129 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaDraft is the JSON Schema dialect of Schema, as the registry names
+// it.
+const SchemaDraft = "JSONSchemaDraft4"
+
+// SchemaName is the registry name of the type's schema, e.g.
+// "ecommerce.user-service@UserRegistered".
+func (t Type) SchemaName() string {
+	return t.Source + "@" + strings.ReplaceAll(t.DetailType, " ", "")
+}
+
+// Schema returns the JSON schema of EventBridge events of the type: the
+// source and detail type, and the detail from the event struct's json and
+// validate tags.
+func (t Type) Schema() ([]byte, error) {
+	detail := schemaOf(t.event)
+	detail["properties"].(map[string]interface{})[metadataField] = schemaOf(reflect.TypeOf(Metadata{}))
+
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-04/schema#",
+		"title":       strings.ReplaceAll(t.DetailType, " ", ""),
+		"description": t.Description,
+		"type":        "object",
+		"required":    []string{"source", "detail-type", "detail"},
+		"properties": map[string]interface{}{
+			"source":      map[string]interface{}{"type": "string", "enum": []string{t.Source}},
+			"detail-type": map[string]interface{}{"type": "string", "enum": []string{t.DetailType}},
+			"detail":      detail,
+		},
+		"x-schema-version": strconv.Itoa(t.Version),
+	}, "", "  ")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf returns the schema of values of typ.
+func schemaOf(typ reflect.Type) map[string]interface{} {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch {
+	case typ == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case typ.Kind() == reflect.Struct:
+		return structSchema(typ)
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(typ.Elem())}
+	case typ.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(typ.Elem())}
+	case typ.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case typ.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema describes a struct's exported fields by their json names;
+// validate's required, min and oneof rules become the schema's.
+func structSchema(typ reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaOf(field.Type)
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			rule, param, _ := strings.Cut(rule, "=")
+			switch rule {
+			case "required":
+				// validate's required also rejects empty values.
+				required = append(required, name)
+				switch schema["type"] {
+				case "string":
+					if schema["format"] == nil {
+						schema["minLength"] = 1
+					}
+				case "array":
+					schema["minItems"] = 1
+				}
+			case "min":
+				n, err := strconv.ParseFloat(param, 64)
+				if err != nil {
+					continue
+				}
+				switch schema["type"] {
+				case "string":
+					schema["minLength"] = n
+				case "array":
+					schema["minItems"] = n
+				case "integer", "number":
+					schema["minimum"] = n
+				}
+			case "oneof":
+				schema["enum"] = strings.Fields(param)
+			}
+		}
+		properties[name] = schema
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,36 @@
+// Command schemagen writes the JSON schema of every event type to a
+// directory, one <detail-type>.json each, for Terraform to register:
+//
+//	go generate ./events
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pkg/events"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatalf("Usage: schemagen <directory>")
+	}
+	dir := os.Args[1]
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatalf("Failed to create %s: %v", dir, err)
+	}
+	for _, t := range events.Types() {
+		schema, err := t.Schema()
+		if err != nil {
+			log.Fatalf("Failed to build the %s schema: %v", t.DetailType, err)
+		}
+		name := strings.ToLower(strings.ReplaceAll(t.DetailType, " ", "-")) + ".json"
+		if err := os.WriteFile(filepath.Join(dir, name), append(schema, '\n'), 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", name, err)
+		}
+		fmt.Println(name)
+	}
+}
@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"net/http"
+	"os"
+)
+
+// TraceHeader is the request header carrying the X-Ray trace; the load
+// balancer adds it to every request.
+const TraceHeader = "X-Amzn-Trace-Id"
+
+type traceKey struct{}
+
+// WithTrace returns ctx carrying trace, which events published with it
+// record. Consumers pass on the trace of the event they handle.
+func WithTrace(ctx context.Context, trace string) context.Context {
+	if trace == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// Trace returns the trace of ctx or, in Lambda, of the invocation.
+func Trace(ctx context.Context) string {
+	if trace, ok := ctx.Value(traceKey{}).(string); ok {
+		return trace
+	}
+	return os.Getenv("_X_AMZN_TRACE_ID")
+}
+
+// Middleware puts each request's trace header in its context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if trace := r.Header.Get(TraceHeader); trace != "" {
+			r = r.WithContext(WithTrace(r.Context(), trace))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
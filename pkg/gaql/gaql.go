@@ -0,0 +1,279 @@
+// Package gaql builds Google Ads Query Language statements and validates
+// field names against the schema generated from GoogleAdsFieldService.
+//
+//	query, err := gaql.Select("campaign.id", "campaign.name", "metrics.clicks").
+//		From("campaign").
+//		Where("campaign.status", gaql.NotEquals, "REMOVED").
+//		During(gaql.Last7Days).
+//		Build()
+package gaql
+
+//go:generate go run ./internal/schemagen -in fields.json -out schema_gen.go
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Category is the GoogleAdsFieldCategory of a field.
+type Category int
+
+const (
+	CategoryResource Category = iota
+	CategoryAttribute
+	CategoryMetric
+	CategorySegment
+)
+
+// Field describes one GAQL field from the generated schema.
+type Field struct {
+	Name       string
+	Category   Category
+	DataType   string
+	Selectable bool
+	Filterable bool
+	Sortable   bool
+}
+
+// Operators supported in WHERE conditions.
+const (
+	Equals         = "="
+	NotEquals      = "!="
+	GreaterThan    = ">"
+	GreaterOrEqual = ">="
+	LessThan       = "<"
+	LessOrEqual    = "<="
+	In             = "IN"
+	NotIn          = "NOT IN"
+	Like           = "LIKE"
+	IsNull         = "IS NULL"
+	IsNotNull      = "IS NOT NULL"
+)
+
+// DateRange is a predefined GAQL date range for DURING.
+type DateRange string
+
+const (
+	Today            DateRange = "TODAY"
+	Yesterday        DateRange = "YESTERDAY"
+	Last7Days        DateRange = "LAST_7_DAYS"
+	Last14Days       DateRange = "LAST_14_DAYS"
+	Last30Days       DateRange = "LAST_30_DAYS"
+	ThisMonth        DateRange = "THIS_MONTH"
+	LastMonth        DateRange = "LAST_MONTH"
+	ThisWeekMonToday DateRange = "THIS_WEEK_MON_TODAY"
+	LastWeekMonSun   DateRange = "LAST_WEEK_MON_SUN"
+)
+
+var validOperators = map[string]bool{
+	Equals: true, NotEquals: true, GreaterThan: true, GreaterOrEqual: true,
+	LessThan: true, LessOrEqual: true, In: true, NotIn: true, Like: true,
+	IsNull: true, IsNotNull: true,
+}
+
+// Lookup returns the schema entry for a field name.
+func Lookup(name string) (Field, bool) {
+	f, ok := schema[name]
+	return f, ok
+}
+
+// Builder accumulates a query. Validation errors are collected and reported
+// together by Build so call sites stay fluent.
+type Builder struct {
+	fields     []string
+	resource   string
+	conditions []string
+	orderings  []string
+	limit      int
+	errs       []error
+}
+
+// Select starts a query with the given fields.
+func Select(fields ...string) *Builder {
+	b := &Builder{}
+	if len(fields) == 0 {
+		b.errs = append(b.errs, errors.New("at least one field must be selected"))
+	}
+	for _, name := range fields {
+		f, ok := schema[name]
+		switch {
+		case !ok:
+			b.errs = append(b.errs, fmt.Errorf("unknown field %q", name))
+		case !f.Selectable:
+			b.errs = append(b.errs, fmt.Errorf("field %q is not selectable", name))
+		}
+	}
+	b.fields = fields
+	return b
+}
+
+// From sets the resource being queried.
+func (b *Builder) From(resource string) *Builder {
+	if f, ok := schema[resource]; !ok || f.Category != CategoryResource {
+		b.errs = append(b.errs, fmt.Errorf("unknown resource %q", resource))
+	}
+	b.resource = resource
+	return b
+}
+
+// Where adds a condition ANDed with the others. Strings are quoted, slices
+// become IN lists; IS NULL / IS NOT NULL take no value.
+func (b *Builder) Where(field, operator string, value interface{}) *Builder {
+	if !b.checkFilterable(field) {
+		return b
+	}
+	if !validOperators[operator] {
+		b.errs = append(b.errs, fmt.Errorf("unsupported operator %q", operator))
+		return b
+	}
+
+	if operator == IsNull || operator == IsNotNull {
+		b.conditions = append(b.conditions, fmt.Sprintf("%s %s", field, operator))
+		return b
+	}
+
+	literal, err := formatValue(value)
+	if err != nil {
+		b.errs = append(b.errs, fmt.Errorf("field %q: %w", field, err))
+		return b
+	}
+	b.conditions = append(b.conditions, fmt.Sprintf("%s %s %s", field, operator, literal))
+	return b
+}
+
+// Between adds a BETWEEN condition, typically on segments.date.
+func (b *Builder) Between(field string, from, to interface{}) *Builder {
+	if !b.checkFilterable(field) {
+		return b
+	}
+	lo, err := formatValue(from)
+	if err != nil {
+		b.errs = append(b.errs, fmt.Errorf("field %q: %w", field, err))
+		return b
+	}
+	hi, err := formatValue(to)
+	if err != nil {
+		b.errs = append(b.errs, fmt.Errorf("field %q: %w", field, err))
+		return b
+	}
+	b.conditions = append(b.conditions, fmt.Sprintf("%s BETWEEN %s AND %s", field, lo, hi))
+	return b
+}
+
+// During restricts segments.date to a predefined range.
+func (b *Builder) During(dateRange DateRange) *Builder {
+	b.conditions = append(b.conditions, fmt.Sprintf("segments.date DURING %s", dateRange))
+	return b
+}
+
+// OrderBy adds an ORDER BY clause.
+func (b *Builder) OrderBy(field string, descending bool) *Builder {
+	f, ok := schema[field]
+	if !ok || !f.Sortable {
+		b.errs = append(b.errs, fmt.Errorf("field %q is not sortable", field))
+		return b
+	}
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	b.orderings = append(b.orderings, field+" "+direction)
+	return b
+}
+
+// Limit caps the number of rows returned.
+func (b *Builder) Limit(n int) *Builder {
+	if n <= 0 {
+		b.errs = append(b.errs, fmt.Errorf("limit must be positive, got %d", n))
+	}
+	b.limit = n
+	return b
+}
+
+// Build renders the query or returns every validation error found.
+func (b *Builder) Build() (string, error) {
+	errs := b.errs
+	if b.resource == "" {
+		errs = append(errs, errors.New("FROM resource is required"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return "", fmt.Errorf("invalid GAQL query: %w", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	sb.WriteString(strings.Join(b.fields, ", "))
+	sb.WriteString(" FROM ")
+	sb.WriteString(b.resource)
+	if len(b.conditions) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(b.conditions, " AND "))
+	}
+	if len(b.orderings) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(b.orderings, ", "))
+	}
+	if b.limit > 0 {
+		sb.WriteString(" LIMIT ")
+		sb.WriteString(strconv.Itoa(b.limit))
+	}
+	return sb.String(), nil
+}
+
+// MustBuild is Build for queries fixed at compile time; it panics on an
+// invalid query so mistakes surface at init rather than at request time.
+func (b *Builder) MustBuild() string {
+	query, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return query
+}
+
+func (b *Builder) checkFilterable(field string) bool {
+	f, ok := schema[field]
+	switch {
+	case !ok:
+		b.errs = append(b.errs, fmt.Errorf("unknown field %q", field))
+		return false
+	case !f.Filterable:
+		b.errs = append(b.errs, fmt.Errorf("field %q is not filterable", field))
+		return false
+	}
+	return true
+}
+
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return quote(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = quote(s)
+		}
+		return "(" + strings.Join(quoted, ", ") + ")", nil
+	case []int64:
+		parts := make([]string, len(v))
+		for i, n := range v {
+			parts[i] = strconv.FormatInt(n, 10)
+		}
+		return "(" + strings.Join(parts, ", ") + ")", nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
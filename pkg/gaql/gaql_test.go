@@ -0,0 +1,105 @@
+package gaql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Builder
+		want  string
+		// errs are the validation errors Build reports, in order.
+		errs []string
+	}{
+		{
+			name:  "renders every clause in order",
+			query: Select("campaign.id", "campaign.name", "metrics.clicks").From("campaign").Where("campaign.status", NotEquals, "REMOVED").During(Last7Days).OrderBy("metrics.clicks", true).Limit(10),
+			want:  "SELECT campaign.id, campaign.name, metrics.clicks FROM campaign WHERE campaign.status != 'REMOVED' AND segments.date DURING LAST_7_DAYS ORDER BY metrics.clicks DESC LIMIT 10",
+		},
+		{
+			name:  "formats each value type",
+			query: Select("campaign.id").From("campaign").Where("campaign.id", Equals, int64(42)).Where("metrics.clicks", GreaterThan, 5).Where("metrics.cost_micros", LessThan, 1.5).Where("campaign.name", Like, "%sale%"),
+			want:  "SELECT campaign.id FROM campaign WHERE campaign.id = 42 AND metrics.clicks > 5 AND metrics.cost_micros < 1.5 AND campaign.name LIKE '%sale%'",
+		},
+		{
+			name:  "turns slices into IN lists",
+			query: Select("campaign.id").From("campaign").Where("campaign.status", In, []string{"ENABLED", "PAUSED"}).Where("campaign.id", NotIn, []int64{1, 2}),
+			want:  "SELECT campaign.id FROM campaign WHERE campaign.status IN ('ENABLED', 'PAUSED') AND campaign.id NOT IN (1, 2)",
+		},
+		{
+			name:  "escapes quotes and backslashes in strings",
+			query: Select("campaign.id").From("campaign").Where("campaign.name", Equals, `Bob's \ sale`),
+			want:  `SELECT campaign.id FROM campaign WHERE campaign.name = 'Bob\'s \\ sale'`,
+		},
+		{
+			name:  "takes no value for null checks",
+			query: Select("campaign.id").From("campaign").Where("campaign.name", IsNotNull, nil),
+			want:  "SELECT campaign.id FROM campaign WHERE campaign.name IS NOT NULL",
+		},
+		{
+			name:  "renders BETWEEN",
+			query: Select("segments.date", "metrics.clicks").From("campaign").Between("segments.date", "2026-03-01", "2026-03-07").OrderBy("segments.date", false),
+			want:  "SELECT segments.date, metrics.clicks FROM campaign WHERE segments.date BETWEEN '2026-03-01' AND '2026-03-07' ORDER BY segments.date ASC",
+		},
+		{
+			name:  "rejects unknown and unselectable fields",
+			query: Select("campaign.nope", "campaign").From("campaign"),
+			errs:  []string{`unknown field "campaign.nope"`, `field "campaign" is not selectable`},
+		},
+		{
+			name:  "rejects an empty select and a missing resource",
+			query: Select(),
+			errs:  []string{"at least one field must be selected", "FROM resource is required"},
+		},
+		{
+			name:  "rejects a field as the resource",
+			query: Select("campaign.id").From("campaign.id"),
+			errs:  []string{`unknown resource "campaign.id"`},
+		},
+		{
+			name:  "rejects bad conditions",
+			query: Select("campaign.id").From("campaign").Where("campaign", Equals, "x").Where("campaign.id", "<>", 1).Where("campaign.id", Equals, struct{}{}),
+			errs:  []string{`field "campaign" is not filterable`, `unsupported operator "<>"`, `field "campaign.id": unsupported value type struct {}`},
+		},
+		{
+			name:  "rejects unsortable orderings and a non-positive limit",
+			query: Select("campaign.id").From("campaign").OrderBy("campaign", false).Limit(0),
+			errs:  []string{`field "campaign" is not sortable`, "limit must be positive, got 0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.Build()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("Build: %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("Build =\n%s\nwant\n%s", got, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Build = %q, want errors %q", got, tt.errs)
+			}
+			msg := err.Error()
+			if !strings.HasPrefix(msg, "invalid GAQL query: ") {
+				t.Errorf("error %q does not say the query is invalid", msg)
+			}
+			if got := strings.Split(strings.TrimPrefix(msg, "invalid GAQL query: "), "\n"); strings.Join(got, "|") != strings.Join(tt.errs, "|") {
+				t.Errorf("errors = %q, want %q", got, tt.errs)
+			}
+		})
+	}
+}
+
+func TestMustBuildPanicsOnInvalidQuery(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustBuild of an invalid query did not panic")
+		}
+	}()
+	Select("campaign.id").MustBuild()
+}
@@ -0,0 +1,85 @@
+// Command schemagen generates the GAQL field schema used by the builder from
+// a JSON export of GoogleAdsFieldService, e.g. the result of
+//
+//	SELECT name, category, data_type, selectable, filterable, sortable
+//	FROM google_ads_field
+//
+// trimmed to the resources this project queries.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+)
+
+type fieldSpec struct {
+	Category   string `json:"category"`
+	DataType   string `json:"data_type"`
+	Selectable bool   `json:"selectable"`
+	Filterable bool   `json:"filterable"`
+	Sortable   bool   `json:"sortable"`
+}
+
+func main() {
+	in := flag.String("in", "fields.json", "GoogleAdsFieldService export")
+	out := flag.String("out", "schema_gen.go", "generated Go file")
+	flag.Parse()
+
+	raw, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *in, err)
+	}
+
+	var doc struct {
+		Fields map[string]fieldSpec `json:"fields"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		log.Fatalf("Failed to parse %s: %v", *in, err)
+	}
+
+	names := make([]string, 0, len(doc.Fields))
+	for name := range doc.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by schemagen from %s; DO NOT EDIT.\n\n", *in)
+	fmt.Fprintf(&buf, "package gaql\n\n")
+	fmt.Fprintf(&buf, "var schema = map[string]Field{\n")
+	for _, name := range names {
+		f := doc.Fields[name]
+		fmt.Fprintf(&buf, "\t%q: {Name: %q, Category: Category%s, DataType: %q, Selectable: %t, Filterable: %t, Sortable: %t},\n",
+			name, name, categoryIdent(f.Category), f.DataType, f.Selectable, f.Filterable, f.Sortable)
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("Failed to format generated source: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+}
+
+func categoryIdent(category string) string {
+	switch category {
+	case "RESOURCE":
+		return "Resource"
+	case "ATTRIBUTE":
+		return "Attribute"
+	case "METRIC":
+		return "Metric"
+	case "SEGMENT":
+		return "Segment"
+	}
+	log.Fatalf("Unknown field category %q", category)
+	return ""
+}
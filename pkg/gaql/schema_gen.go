@@ -0,0 +1,201 @@
+// Code generated by schemagen from fields.json; DO NOT EDIT.
+
+package gaql
+
+var schema = map[string]Field{
+	"account_budget": {Name: "account_budget", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"account_budget.adjusted_spending_limit_micros":                     {Name: "account_budget.adjusted_spending_limit_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.adjusted_spending_limit_type":                       {Name: "account_budget.adjusted_spending_limit_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.amount_served_micros":                               {Name: "account_budget.amount_served_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.approved_end_date_time":                             {Name: "account_budget.approved_end_date_time", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.approved_end_time_type":                             {Name: "account_budget.approved_end_time_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.approved_spending_limit_micros":                     {Name: "account_budget.approved_spending_limit_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.approved_spending_limit_type":                       {Name: "account_budget.approved_spending_limit_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.approved_start_date_time":                           {Name: "account_budget.approved_start_date_time", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.billing_setup":                                      {Name: "account_budget.billing_setup", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.id":                                                 {Name: "account_budget.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.name":                                               {Name: "account_budget.name", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.purchase_order_number":                              {Name: "account_budget.purchase_order_number", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget.status":                                             {Name: "account_budget.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"account_budget_proposal":                                           {Name: "account_budget_proposal", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"ad_group":                                                          {Name: "ad_group", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"ad_group.cpc_bid_micros":                                           {Name: "ad_group.cpc_bid_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group.id":                                                       {Name: "ad_group.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group.name":                                                     {Name: "ad_group.name", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group.status":                                                   {Name: "ad_group.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group.type":                                                     {Name: "ad_group.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad":                                                       {Name: "ad_group_ad", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"ad_group_ad.ad.final_urls":                                         {Name: "ad_group_ad.ad.final_urls", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: false},
+	"ad_group_ad.ad.id":                                                 {Name: "ad_group_ad.ad.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad.ad.responsive_search_ad.descriptions":                  {Name: "ad_group_ad.ad.responsive_search_ad.descriptions", Category: CategoryAttribute, DataType: "MESSAGE", Selectable: true, Filterable: false, Sortable: false},
+	"ad_group_ad.ad.responsive_search_ad.headlines":                     {Name: "ad_group_ad.ad.responsive_search_ad.headlines", Category: CategoryAttribute, DataType: "MESSAGE", Selectable: true, Filterable: false, Sortable: false},
+	"ad_group_ad.ad.type":                                               {Name: "ad_group_ad.ad.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad.ad_strength":                                           {Name: "ad_group_ad.ad_strength", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad.policy_summary.approval_status":                        {Name: "ad_group_ad.policy_summary.approval_status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad.policy_summary.policy_topic_entries":                   {Name: "ad_group_ad.policy_summary.policy_topic_entries", Category: CategoryAttribute, DataType: "MESSAGE", Selectable: true, Filterable: false, Sortable: false},
+	"ad_group_ad.policy_summary.review_status":                          {Name: "ad_group_ad.policy_summary.review_status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad.status":                                                {Name: "ad_group_ad.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad_asset_view":                                            {Name: "ad_group_ad_asset_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"ad_group_ad_asset_view.enabled":                                    {Name: "ad_group_ad_asset_view.enabled", Category: CategoryAttribute, DataType: "BOOLEAN", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad_asset_view.field_type":                                 {Name: "ad_group_ad_asset_view.field_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad_asset_view.policy_summary.approval_status":             {Name: "ad_group_ad_asset_view.policy_summary.approval_status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_ad_asset_view.policy_summary.policy_topic_entries":        {Name: "ad_group_ad_asset_view.policy_summary.policy_topic_entries", Category: CategoryAttribute, DataType: "MESSAGE", Selectable: true, Filterable: false, Sortable: false},
+	"ad_group_criterion":                                                {Name: "ad_group_criterion", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"ad_group_criterion.approval_status":                                {Name: "ad_group_criterion.approval_status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.cpc_bid_micros":                                 {Name: "ad_group_criterion.cpc_bid_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.criterion_id":                                   {Name: "ad_group_criterion.criterion_id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.disapproval_reasons":                            {Name: "ad_group_criterion.disapproval_reasons", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: false, Sortable: false},
+	"ad_group_criterion.effective_cpc_bid_micros":                       {Name: "ad_group_criterion.effective_cpc_bid_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.final_urls":                                     {Name: "ad_group_criterion.final_urls", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.keyword.match_type":                             {Name: "ad_group_criterion.keyword.match_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.keyword.text":                                   {Name: "ad_group_criterion.keyword.text", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.listing_group.case_value.product_item_id.value": {Name: "ad_group_criterion.listing_group.case_value.product_item_id.value", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.listing_group.type":                             {Name: "ad_group_criterion.listing_group.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.negative":                                       {Name: "ad_group_criterion.negative", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.quality_info.creative_quality_score":            {Name: "ad_group_criterion.quality_info.creative_quality_score", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.quality_info.post_click_quality_score":          {Name: "ad_group_criterion.quality_info.post_click_quality_score", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.quality_info.quality_score":                     {Name: "ad_group_criterion.quality_info.quality_score", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.quality_info.search_predicted_ctr":              {Name: "ad_group_criterion.quality_info.search_predicted_ctr", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.status":                                         {Name: "ad_group_criterion.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion.type":                                           {Name: "ad_group_criterion.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion_simulation":                                     {Name: "ad_group_criterion_simulation", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"ad_group_criterion_simulation.ad_group_id":                         {Name: "ad_group_criterion_simulation.ad_group_id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion_simulation.cpc_bid_point_list.points":           {Name: "ad_group_criterion_simulation.cpc_bid_point_list.points", Category: CategoryAttribute, DataType: "MESSAGE", Selectable: true, Filterable: false, Sortable: false},
+	"ad_group_criterion_simulation.criterion_id":                        {Name: "ad_group_criterion_simulation.criterion_id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion_simulation.end_date":                            {Name: "ad_group_criterion_simulation.end_date", Category: CategoryAttribute, DataType: "DATE", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion_simulation.modification_method":                 {Name: "ad_group_criterion_simulation.modification_method", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion_simulation.start_date":                          {Name: "ad_group_criterion_simulation.start_date", Category: CategoryAttribute, DataType: "DATE", Selectable: true, Filterable: true, Sortable: true},
+	"ad_group_criterion_simulation.type":                                {Name: "ad_group_criterion_simulation.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"ad_schedule_view":                                                  {Name: "ad_schedule_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"asset":                                                             {Name: "asset", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"asset.id":                                                          {Name: "asset.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"asset.text_asset.text":                                             {Name: "asset.text_asset.text", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"asset_group":                                                       {Name: "asset_group", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"asset_group.id":                                                    {Name: "asset_group.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"asset_group.name":                                                  {Name: "asset_group.name", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"asset_group.status":                                                {Name: "asset_group.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"asset_group_listing_group_filter":                                  {Name: "asset_group_listing_group_filter", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"asset_group_listing_group_filter.case_value.product_item_id.value": {Name: "asset_group_listing_group_filter.case_value.product_item_id.value", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"asset_group_listing_group_filter.id":                               {Name: "asset_group_listing_group_filter.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"asset_group_listing_group_filter.type":                             {Name: "asset_group_listing_group_filter.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"asset_group_product_group_view":                                    {Name: "asset_group_product_group_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"auction_insight":                                                   {Name: "auction_insight", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"bidding_seasonality_adjustment":                                    {Name: "bidding_seasonality_adjustment", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"campaign":                                                          {Name: "campaign", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"campaign.advertising_channel_type":                                 {Name: "campaign.advertising_channel_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.bidding_strategy_type":                                    {Name: "campaign.bidding_strategy_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.campaign_budget":                                          {Name: "campaign.campaign_budget", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.end_date":                                                 {Name: "campaign.end_date", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.final_url_suffix":                                         {Name: "campaign.final_url_suffix", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.id":                                                       {Name: "campaign.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.name":                                                     {Name: "campaign.name", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.start_date":                                               {Name: "campaign.start_date", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.status":                                                   {Name: "campaign.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.target_cpa.target_cpa_micros":                             {Name: "campaign.target_cpa.target_cpa_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.target_roas.target_roas":                                  {Name: "campaign.target_roas.target_roas", Category: CategoryAttribute, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"campaign.tracking_url_template":                                    {Name: "campaign.tracking_url_template", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_asset":                                                    {Name: "campaign_asset", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"campaign_asset.field_type":                                         {Name: "campaign_asset.field_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_asset.status":                                             {Name: "campaign_asset.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_budget":                                                   {Name: "campaign_budget", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"campaign_budget.amount_micros":                                     {Name: "campaign_budget.amount_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_budget.explicitly_shared":                                 {Name: "campaign_budget.explicitly_shared", Category: CategoryAttribute, DataType: "BOOLEAN", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_budget.id":                                                {Name: "campaign_budget.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_budget.name":                                              {Name: "campaign_budget.name", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_budget.period":                                            {Name: "campaign_budget.period", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_budget.resource_name":                                     {Name: "campaign_budget.resource_name", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_budget.status":                                            {Name: "campaign_budget.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_budget.total_amount_micros":                               {Name: "campaign_budget.total_amount_micros", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_criterion":                                                {Name: "campaign_criterion", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"campaign_criterion.ad_schedule.day_of_week":                        {Name: "campaign_criterion.ad_schedule.day_of_week", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_criterion.ad_schedule.end_hour":                           {Name: "campaign_criterion.ad_schedule.end_hour", Category: CategoryAttribute, DataType: "INT32", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_criterion.ad_schedule.start_hour":                         {Name: "campaign_criterion.ad_schedule.start_hour", Category: CategoryAttribute, DataType: "INT32", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_criterion.bid_modifier":                                   {Name: "campaign_criterion.bid_modifier", Category: CategoryAttribute, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_criterion.criterion_id":                                   {Name: "campaign_criterion.criterion_id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_criterion.resource_name":                                  {Name: "campaign_criterion.resource_name", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_criterion.status":                                         {Name: "campaign_criterion.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_criterion.type":                                           {Name: "campaign_criterion.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_shared_set":                                               {Name: "campaign_shared_set", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"campaign_shared_set.campaign":                                      {Name: "campaign_shared_set.campaign", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_shared_set.resource_name":                                 {Name: "campaign_shared_set.resource_name", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_shared_set.shared_set":                                    {Name: "campaign_shared_set.shared_set", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_shared_set.status":                                        {Name: "campaign_shared_set.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_simulation":                                               {Name: "campaign_simulation", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"campaign_simulation.campaign_id":                                   {Name: "campaign_simulation.campaign_id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_simulation.end_date":                                      {Name: "campaign_simulation.end_date", Category: CategoryAttribute, DataType: "DATE", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_simulation.modification_method":                           {Name: "campaign_simulation.modification_method", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_simulation.start_date":                                    {Name: "campaign_simulation.start_date", Category: CategoryAttribute, DataType: "DATE", Selectable: true, Filterable: true, Sortable: true},
+	"campaign_simulation.target_cpa_point_list.points":                  {Name: "campaign_simulation.target_cpa_point_list.points", Category: CategoryAttribute, DataType: "MESSAGE", Selectable: true, Filterable: false, Sortable: false},
+	"campaign_simulation.target_roas_point_list.points":                 {Name: "campaign_simulation.target_roas_point_list.points", Category: CategoryAttribute, DataType: "MESSAGE", Selectable: true, Filterable: false, Sortable: false},
+	"campaign_simulation.type":                                          {Name: "campaign_simulation.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"click_view":                                                        {Name: "click_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"conversion_action":                                                 {Name: "conversion_action", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"customer":                                                          {Name: "customer", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"customer.currency_code":                                            {Name: "customer.currency_code", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"customer.descriptive_name":                                         {Name: "customer.descriptive_name", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"customer.final_url_suffix":                                         {Name: "customer.final_url_suffix", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"customer.id":                                                       {Name: "customer.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"customer.time_zone":                                                {Name: "customer.time_zone", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"customer.tracking_url_template":                                    {Name: "customer.tracking_url_template", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"customer_negative_criterion":                                       {Name: "customer_negative_criterion", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"geographic_view":                                                   {Name: "geographic_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"geographic_view.country_criterion_id":                              {Name: "geographic_view.country_criterion_id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"geographic_view.location_type":                                     {Name: "geographic_view.location_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"group_placement_view":                                              {Name: "group_placement_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"group_placement_view.display_name":                                 {Name: "group_placement_view.display_name", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"group_placement_view.placement":                                    {Name: "group_placement_view.placement", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"group_placement_view.placement_type":                               {Name: "group_placement_view.placement_type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"group_placement_view.target_url":                                   {Name: "group_placement_view.target_url", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"invoice":                                                           {Name: "invoice", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"keyword_view":                                                      {Name: "keyword_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"landing_page_view":                                                 {Name: "landing_page_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"metrics.all_conversions":                                           {Name: "metrics.all_conversions", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.auction_insight_search_absolute_top_impression_percentage": {Name: "metrics.auction_insight_search_absolute_top_impression_percentage", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.auction_insight_search_impression_share":                   {Name: "metrics.auction_insight_search_impression_share", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.auction_insight_search_outranking_share":                   {Name: "metrics.auction_insight_search_outranking_share", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.auction_insight_search_overlap_rate":                       {Name: "metrics.auction_insight_search_overlap_rate", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.auction_insight_search_position_above_rate":                {Name: "metrics.auction_insight_search_position_above_rate", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.auction_insight_search_top_impression_percentage":          {Name: "metrics.auction_insight_search_top_impression_percentage", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.average_cpc":                                               {Name: "metrics.average_cpc", Category: CategoryMetric, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.clicks":                                                    {Name: "metrics.clicks", Category: CategoryMetric, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.conversion_rate":                                           {Name: "metrics.conversion_rate", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.conversions":                                               {Name: "metrics.conversions", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.conversions_value":                                         {Name: "metrics.conversions_value", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.cost_micros":                                               {Name: "metrics.cost_micros", Category: CategoryMetric, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.cost_per_conversion":                                       {Name: "metrics.cost_per_conversion", Category: CategoryMetric, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.ctr":                                                       {Name: "metrics.ctr", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.impressions":                                               {Name: "metrics.impressions", Category: CategoryMetric, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.invalid_click_rate":                                        {Name: "metrics.invalid_click_rate", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.invalid_clicks":                                            {Name: "metrics.invalid_clicks", Category: CategoryMetric, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.search_budget_lost_impression_share":                       {Name: "metrics.search_budget_lost_impression_share", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.search_impression_share":                                   {Name: "metrics.search_impression_share", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"metrics.search_rank_lost_impression_share":                         {Name: "metrics.search_rank_lost_impression_share", Category: CategoryMetric, DataType: "DOUBLE", Selectable: true, Filterable: true, Sortable: true},
+	"product_group_view":                                                {Name: "product_group_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"search_term_view":                                                  {Name: "search_term_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"search_term_view.search_term":                                      {Name: "search_term_view.search_term", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"search_term_view.status":                                           {Name: "search_term_view.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"segments.auction_insight_domain":                                   {Name: "segments.auction_insight_domain", Category: CategorySegment, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"segments.date":                                                     {Name: "segments.date", Category: CategorySegment, DataType: "DATE", Selectable: true, Filterable: true, Sortable: true},
+	"segments.day_of_week":                                              {Name: "segments.day_of_week", Category: CategorySegment, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"segments.device":                                                   {Name: "segments.device", Category: CategorySegment, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"segments.hour":                                                     {Name: "segments.hour", Category: CategorySegment, DataType: "INT32", Selectable: true, Filterable: true, Sortable: true},
+	"segments.month":                                                    {Name: "segments.month", Category: CategorySegment, DataType: "DATE", Selectable: true, Filterable: true, Sortable: true},
+	"segments.product_item_id":                                          {Name: "segments.product_item_id", Category: CategorySegment, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"segments.product_title":                                            {Name: "segments.product_title", Category: CategorySegment, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"segments.week":                                                     {Name: "segments.week", Category: CategorySegment, DataType: "DATE", Selectable: true, Filterable: true, Sortable: true},
+	"shared_criterion":                                                  {Name: "shared_criterion", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"shared_criterion.mobile_application.app_id":                        {Name: "shared_criterion.mobile_application.app_id", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"shared_criterion.placement.url":                                    {Name: "shared_criterion.placement.url", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"shared_criterion.resource_name":                                    {Name: "shared_criterion.resource_name", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"shared_criterion.shared_set":                                       {Name: "shared_criterion.shared_set", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"shared_criterion.type":                                             {Name: "shared_criterion.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"shared_set":                                                        {Name: "shared_set", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"shared_set.id":                                                     {Name: "shared_set.id", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"shared_set.member_count":                                           {Name: "shared_set.member_count", Category: CategoryAttribute, DataType: "INT64", Selectable: true, Filterable: true, Sortable: true},
+	"shared_set.name":                                                   {Name: "shared_set.name", Category: CategoryAttribute, DataType: "STRING", Selectable: true, Filterable: true, Sortable: true},
+	"shared_set.resource_name":                                          {Name: "shared_set.resource_name", Category: CategoryAttribute, DataType: "RESOURCE_NAME", Selectable: true, Filterable: true, Sortable: true},
+	"shared_set.status":                                                 {Name: "shared_set.status", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"shared_set.type":                                                   {Name: "shared_set.type", Category: CategoryAttribute, DataType: "ENUM", Selectable: true, Filterable: true, Sortable: true},
+	"shopping_performance_view":                                         {Name: "shopping_performance_view", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+	"user_list":                                                         {Name: "user_list", Category: CategoryResource, DataType: "RESOURCE_NAME", Selectable: false, Filterable: false, Sortable: false},
+}
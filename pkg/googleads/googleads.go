@@ -0,0 +1,151 @@
+// Package googleads makes the Google Ads API calls of every function the
+// same way: paced by the function's shared throttle, retried on transient
+// errors and timed and counted in its metrics. It is handed the calls
+// rather than the client, so pkg does not depend on the API library.
+package googleads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"pkg/clock"
+	"pkg/metrics"
+	"pkg/retry"
+)
+
+// Metrics returns the logger collecting a Google Ads function's metrics
+// for CloudWatch, dimensioned by function and environment.
+func Metrics(function, environment string, clk clock.Clock) *metrics.Logger {
+	return metrics.NewLogger(metrics.GoogleAdsNamespace, map[string]string{
+		"Function":    function,
+		"Environment": environment,
+	}, clk)
+}
+
+// Throttle paces calls and holds them off after a rate limit error, as
+// *pool.Throttle does.
+type Throttle interface {
+	Wait(ctx context.Context) error
+	Backoff()
+}
+
+// Calls makes a function's Google Ads calls. Its workers share one, as
+// the API's limits are per developer token.
+type Calls struct {
+	// Retry is the policy searches are retried with.
+	Retry retry.Policy
+	// Throttle paces every call; nil leaves them unpaced.
+	Throttle Throttle
+
+	emf *metrics.Logger
+}
+
+// New returns Calls recording to emf, retrying searches per
+// retry.GoogleAdsFromEnv and logging each retry, and paced by throttle.
+func New(emf *metrics.Logger, throttle Throttle) *Calls {
+	p := retry.GoogleAdsFromEnv()
+	p.OnRetry = func(attempt int, err error, delay time.Duration) {
+		log.Printf("Google Ads call failed (attempt %d/%d), retrying in %s: %v", attempt, p.MaxAttempts, delay, err)
+	}
+	return &Calls{Retry: p, Throttle: throttle, emf: emf}
+}
+
+// Call makes one call at the throttle's pace. A rate limit error holds
+// every worker off for the cooldown, not just this one. Calls are not
+// retried here: a mutate that failed may still have been applied.
+func (c *Calls) Call(ctx context.Context, call func(ctx context.Context) error) error {
+	if c.Throttle == nil {
+		return call(ctx)
+	}
+	if err := c.Throttle.Wait(ctx); err != nil {
+		return err
+	}
+	err := call(ctx)
+	if retry.GoogleAdsRateLimited(err) {
+		c.emf.Count("GoogleAdsRateLimited", 1)
+		c.Throttle.Backoff()
+	}
+	return err
+}
+
+// Search runs a search, retrying transient failures, and records its
+// latency, retries and the rows of the response, which rows counts.
+func Search[Resp any](ctx context.Context, c *Calls, search func(ctx context.Context) (Resp, error), rows func(Resp) int) (Resp, error) {
+	defer c.emf.Time("GoogleAdsSearchLatency")()
+	var resp Resp
+	attempts, err := retry.Do(ctx, c.Retry, func(ctx context.Context) error {
+		return c.Call(ctx, func(ctx context.Context) error {
+			var err error
+			resp, err = search(ctx)
+			return err
+		})
+	})
+	c.emf.Count("GoogleAdsRetries", attempts-1)
+	if err != nil {
+		c.emf.Count("GoogleAdsSearchErrors", 1)
+		var zero Resp
+		return zero, gaveUp(attempts, err)
+	}
+	c.emf.Count("RowsProcessed", rows(resp))
+	return resp, nil
+}
+
+// Stream yields a streamed search's batches of rows, then io.EOF.
+type Stream[Resp any] interface {
+	Recv() (Resp, error)
+}
+
+// SearchStream runs a search that can return too many rows to hold at
+// once, such as an account's keywords, over the streaming endpoint: each
+// row of the batches, which rows picks out, is handed to fn as its batch
+// arrives and dropped after. Failing to open the stream is retried like
+// Search, but once rows have reached fn a retry would hand them over
+// twice, so a later error, or one from fn, ends it.
+func SearchStream[Resp, Row any](ctx context.Context, c *Calls, open func(ctx context.Context) (Stream[Resp], error), rows func(Resp) []Row, fn func(Row) error) error {
+	defer c.emf.Time("GoogleAdsSearchLatency")()
+	var seen int
+	attempts, err := retry.Do(ctx, c.Retry, func(ctx context.Context) error {
+		return c.Call(ctx, func(ctx context.Context) error {
+			stream, err := open(ctx)
+			if err != nil {
+				return err
+			}
+			for {
+				resp, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					if seen > 0 {
+						return retry.Permanent(fmt.Errorf("stream broke after %d rows: %w", seen, err))
+					}
+					return err
+				}
+				for _, row := range rows(resp) {
+					seen++
+					if err := fn(row); err != nil {
+						return retry.Permanent(err)
+					}
+				}
+			}
+		})
+	})
+	c.emf.Count("GoogleAdsRetries", attempts-1)
+	c.emf.Count("RowsProcessed", seen)
+	if err != nil {
+		c.emf.Count("GoogleAdsSearchErrors", 1)
+		return gaveUp(attempts, err)
+	}
+	return nil
+}
+
+func gaveUp(attempts int, err error) error {
+	if attempts > 1 {
+		return fmt.Errorf("gave up after %d attempts: %w", attempts, err)
+	}
+	return err
+}
@@ -0,0 +1,275 @@
+package googleads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/clock"
+	"pkg/pool"
+)
+
+var start = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+var (
+	errQuota    = errors.New("googleapi: Error 429: RESOURCE_EXHAUSTED")
+	errInternal = errors.New("googleapi: Error 500: INTERNAL")
+	errQuery    = errors.New("googleapi: Error 400: INVALID_ARGUMENT")
+)
+
+// newCalls returns Calls that retry up to three times without waiting,
+// paced on a manual clock with a 10s cooldown, and the buffer their
+// metrics are flushed to.
+func newCalls(t *testing.T) (*Calls, *clock.Manual, *bytes.Buffer) {
+	t.Helper()
+	clk := clock.NewManual(start, 0)
+	emf := Metrics("test", "test", clk)
+	var out bytes.Buffer
+	emf.Out = &out
+	c := New(emf, pool.NewThrottle(0, 10*time.Second, clk))
+	c.Retry.MaxAttempts = 3
+	c.Retry.Sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return c, clk, &out
+}
+
+// counts flushes c's metrics and returns the counters.
+func counts(t *testing.T, c *Calls, out *bytes.Buffer) map[string]float64 {
+	t.Helper()
+	if err := c.emf.Flush(); err != nil {
+		t.Fatalf("flush metrics: %v", err)
+	}
+	line := map[string]interface{}{}
+	if out.Len() > 0 {
+		if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+			t.Fatalf("decode metrics: %v", err)
+		}
+	}
+	got := map[string]float64{}
+	for _, name := range []string{"GoogleAdsRetries", "GoogleAdsSearchErrors", "GoogleAdsRateLimited", "RowsProcessed"} {
+		if v, ok := line[name].(float64); ok {
+			got[name] = v
+		}
+	}
+	return got
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name string
+		// errs are the errors of the attempts before the one that
+		// answers; an attempt past them succeeds.
+		errs     []error
+		wantErr  string
+		attempts int
+		cooldown time.Duration
+		want     map[string]float64
+	}{
+		{
+			name:     "answers the first time",
+			attempts: 1,
+			want:     map[string]float64{"GoogleAdsRetries": 0, "RowsProcessed": 2},
+		},
+		{
+			name:     "retries a server error",
+			errs:     []error{errInternal},
+			attempts: 2,
+			want:     map[string]float64{"GoogleAdsRetries": 1, "RowsProcessed": 2},
+		},
+		{
+			name:     "holds off every call after a rate limit",
+			errs:     []error{errQuota},
+			attempts: 2,
+			cooldown: 10 * time.Second,
+			want:     map[string]float64{"GoogleAdsRetries": 1, "GoogleAdsRateLimited": 1, "RowsProcessed": 2},
+		},
+		{
+			name:     "does not retry a bad query",
+			errs:     []error{errQuery},
+			wantErr:  errQuery.Error(),
+			attempts: 1,
+			want:     map[string]float64{"GoogleAdsRetries": 0, "GoogleAdsSearchErrors": 1},
+		},
+		{
+			name:     "gives up when the attempts run out",
+			errs:     []error{errInternal, errInternal, errInternal},
+			wantErr:  "gave up after 3 attempts: " + errInternal.Error(),
+			attempts: 3,
+			want:     map[string]float64{"GoogleAdsRetries": 2, "GoogleAdsSearchErrors": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, clk, out := newCalls(t)
+
+			var attempts int
+			resp, err := Search(context.Background(), c, func(ctx context.Context) ([]string, error) {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return nil, tt.errs[attempts-1]
+				}
+				return []string{"row-1", "row-2"}, nil
+			}, func(rows []string) int { return len(rows) })
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Search error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil || len(resp) != 2 {
+				t.Errorf("Search = %v, %v, want two rows", resp, err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("made %d attempts, want %d", attempts, tt.attempts)
+			}
+			if got := clk.Now().Sub(start); got != tt.cooldown {
+				t.Errorf("calls held off for %s, want %s", got, tt.cooldown)
+			}
+			got := counts(t, c, out)
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s = %v, want %v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+// batches is a Stream of string batches; fail, if set, is returned in
+// place of the batch at failAt.
+type batches struct {
+	batches [][]string
+	fail    error
+	failAt  int
+	next    int
+}
+
+func (b *batches) Recv() ([]string, error) {
+	if b.fail != nil && b.next == b.failAt {
+		b.fail, b.next = nil, b.next+1
+		return nil, errInternal
+	}
+	if b.next >= len(b.batches) {
+		return nil, io.EOF
+	}
+	b.next++
+	return b.batches[b.next-1], nil
+}
+
+func TestSearchStream(t *testing.T) {
+	tests := []struct {
+		name string
+		// openErrs fail the first opens; later opens stream batches,
+		// failing once at failAt if fail.
+		openErrs []error
+		fail     bool
+		failAt   int
+		// stopAt makes fn fail on that row.
+		stopAt   string
+		wantErr  string
+		wantRows []string
+		opens    int
+	}{
+		{
+			name:     "hands over every row",
+			wantRows: []string{"a", "b", "c"},
+			opens:    1,
+		},
+		{
+			name:     "retries a stream that fails to open",
+			openErrs: []error{errInternal},
+			wantRows: []string{"a", "b", "c"},
+			opens:    2,
+		},
+		{
+			name:     "retries a stream that breaks before any row",
+			fail:     true,
+			failAt:   0,
+			wantRows: []string{"a", "b", "c"},
+			opens:    2,
+		},
+		{
+			name:     "ends a stream that breaks after rows",
+			fail:     true,
+			failAt:   1,
+			wantErr:  "stream broke after 2 rows: " + errInternal.Error(),
+			wantRows: []string{"a", "b"},
+			opens:    1,
+		},
+		{
+			name:     "ends on an error from fn",
+			stopAt:   "b",
+			wantErr:  "stop",
+			wantRows: []string{"a", "b"},
+			opens:    1,
+		},
+		{
+			name:     "does not retry a bad query",
+			openErrs: []error{errQuery},
+			wantErr:  errQuery.Error(),
+			opens:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _ := newCalls(t)
+
+			var opens int
+			var got []string
+			err := SearchStream(context.Background(), c, func(ctx context.Context) (Stream[[]string], error) {
+				opens++
+				if opens <= len(tt.openErrs) {
+					return nil, tt.openErrs[opens-1]
+				}
+				s := &batches{batches: [][]string{{"a", "b"}, {"c"}}}
+				if tt.fail {
+					s.fail, s.failAt = errInternal, tt.failAt
+					tt.fail = false
+				}
+				return s, nil
+			}, func(batch []string) []string { return batch }, func(row string) error {
+				got = append(got, row)
+				if row == tt.stopAt {
+					return errors.New("stop")
+				}
+				return nil
+			})
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("SearchStream error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("SearchStream: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantRows, ",") {
+				t.Errorf("rows = %v, want %v", got, tt.wantRows)
+			}
+			if opens != tt.opens {
+				t.Errorf("opened %d streams, want %d", opens, tt.opens)
+			}
+		})
+	}
+}
+
+func TestCallDoesNotRetry(t *testing.T) {
+	c, clk, _ := newCalls(t)
+
+	var calls int
+	err := c.Call(context.Background(), func(ctx context.Context) error {
+		calls++
+		return errQuota
+	})
+	if !errors.Is(err, errQuota) || calls != 1 {
+		t.Errorf("Call = %v after %d calls, want the rate limit error after 1", err, calls)
+	}
+	if err := c.Call(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got := clk.Now().Sub(start); got != 10*time.Second {
+		t.Errorf("next call held off for %s, want the 10s cooldown", got)
+	}
+}
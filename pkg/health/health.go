@@ -0,0 +1,184 @@
+// Package health checks that a service's dependencies answer, for
+// readiness probes and the functions' self-check runs. /health only says
+// the process is up; a Checker calls each dependency, a DynamoDB
+// DescribeTable or a Secrets Manager DescribeSecret, and reports its
+// status and latency.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+)
+
+// Report statuses: ready when every check passed, degraded when only
+// non-critical ones failed, not ready when a critical one did.
+const (
+	StatusReady    = "ready"
+	StatusDegraded = "degraded"
+	StatusNotReady = "not_ready"
+)
+
+// Check statuses.
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// DefaultTimeout bounds each check.
+const DefaultTimeout = 2 * time.Second
+
+// Check is one dependency. Critical ones are those the service cannot do
+// its work without.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is how one check went.
+type Result struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the outcome of running every check.
+type Report struct {
+	Status    string            `json:"status"`
+	Service   string            `json:"service"`
+	Timestamp time.Time         `json:"timestamp"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every critical check passed.
+func (r Report) Ready() bool {
+	return r.Status != StatusNotReady
+}
+
+// Err names the failed critical checks, or is nil when the report is
+// ready.
+func (r Report) Err() error {
+	if r.Ready() {
+		return nil
+	}
+	var failed []string
+	for name, result := range r.Checks {
+		if result.Critical && result.Status == StatusFailed {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, result.Error))
+		}
+	}
+	sort.Strings(failed)
+	return errors.New("dependencies failed: " + strings.Join(failed, "; "))
+}
+
+// Checker runs a service's checks. It is safe for concurrent use.
+type Checker struct {
+	service string
+	clk     clock.Clock
+	timeout time.Duration
+	checks  []Check
+}
+
+// NewChecker returns a Checker for service running checks, each bounded
+// by DefaultTimeout.
+func NewChecker(service string, clk clock.Clock, checks ...Check) *Checker {
+	return &Checker{service: service, clk: clk, timeout: DefaultTimeout, checks: checks}
+}
+
+// Run runs every check at once and reports on them.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{
+		Status:    StatusReady,
+		Service:   c.service,
+		Timestamp: c.clk.Now(),
+		Checks:    make(map[string]Result, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			start := time.Now()
+			err := check.Run(ctx)
+			result := Result{Status: StatusOK, Critical: check.Critical, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = StatusFailed
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			switch {
+			case err == nil:
+			case check.Critical:
+				report.Status = StatusNotReady
+			case report.Status == StatusReady:
+				report.Status = StatusDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+// Handler answers readiness probes with the report: 200 unless a
+// critical check failed, then 503.
+func (c *Checker) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// TableAPI is the part of *dynamodb.Client Table uses.
+type TableAPI interface {
+	DescribeTable(ctx context.Context, in *dynamodb.DescribeTableInput, opts ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+}
+
+// Table checks that DynamoDB describes the table and that it is active;
+// a table being updated still serves reads and writes. The check is named
+// dynamodb:<table>.
+func Table(db TableAPI, table string, critical bool) Check {
+	return Check{
+		Name:     "dynamodb:" + table,
+		Critical: critical,
+		Run: func(ctx context.Context) error {
+			out, err := db.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+			if err != nil {
+				return err
+			}
+			switch status := out.Table.TableStatus; status {
+			case types.TableStatusActive, types.TableStatusUpdating:
+				return nil
+			default:
+				return fmt.Errorf("table is %s", status)
+			}
+		},
+	}
+}
@@ -0,0 +1,327 @@
+// Package idempotency implements the Idempotency-Key header for POST
+// endpoints. The first request with a key runs normally and its response is
+// stored in DynamoDB; retries with the same key and payload get the stored
+// response replayed, and retries with a different payload are rejected.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/problem"
+)
+
+// Header is the request header carrying the client-chosen key.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses served from the store.
+const ReplayedHeader = "Idempotent-Replayed"
+
+const (
+	statusInProgress = "IN_PROGRESS"
+	statusCompleted  = "COMPLETED"
+
+	maxKeyLength = 255
+	// lockTimeout bounds how long an in-progress record blocks retries if
+	// the instance handling it dies before completing.
+	lockTimeout = 30 * time.Second
+)
+
+// replayedHeaders are the response headers worth storing.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// record is the DynamoDB item for one key.
+type record struct {
+	Key             string            `dynamodbav:"idempotency_key"`
+	Fingerprint     string            `dynamodbav:"fingerprint"`
+	Status          string            `dynamodbav:"status"`
+	ResponseStatus  int               `dynamodbav:"response_status,omitempty"`
+	ResponseHeaders map[string]string `dynamodbav:"response_headers,omitempty"`
+	ResponseBody    []byte            `dynamodbav:"response_body,omitempty"`
+	LockedUntil     int64             `dynamodbav:"locked_until"`
+	ExpiresAt       int64             `dynamodbav:"expires_at"`
+}
+
+// DB is the part of *dynamodb.Client a Store uses.
+type DB interface {
+	GetItem(ctx context.Context, in *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, in *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, in *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// Store persists keys and responses in a DynamoDB table with hash key
+// "idempotency_key" and TTL on "expires_at".
+type Store struct {
+	DB    DB
+	Table string
+	TTL   time.Duration
+	Clock clock.Clock
+}
+
+// NewStore returns a Store keeping responses for 24 hours.
+func NewStore(db DB, table string, clk clock.Clock) *Store {
+	return &Store{DB: db, Table: table, TTL: 24 * time.Hour, Clock: clk}
+}
+
+// Middleware applies idempotency to POST requests that carry the header.
+// Requests without it are passed through unchanged.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("%s must be at most %d characters", Header, maxKeyLength)))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Write(w, r, problem.Malformed("Failed to read request body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped to the caller and the endpoint, so the same key
+		// sent by two callers, or to two different resources, cannot
+		// collide and replay one caller's response to another.
+		scopedKey := callerOf(r) + " " + r.Method + " " + r.URL.Path + " " + key
+		fingerprint := fingerprintOf(r, body)
+
+		acquired, existing, err := s.acquire(r.Context(), scopedKey, fingerprint)
+		if err != nil {
+			log.Printf("Failed to acquire idempotency key: %v", err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+			return
+		}
+
+		if !acquired {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				problem.Write(w, r, problem.New(http.StatusUnprocessableEntity,
+					fmt.Sprintf("%s was already used with a different request payload", Header)))
+			case existing.Status == statusInProgress:
+				w.Header().Set("Retry-After", "1")
+				problem.Write(w, r, problem.New(http.StatusConflict,
+					"A request with this Idempotency-Key is still being processed"))
+			default:
+				replay(w, existing)
+			}
+			return
+		}
+
+		rec := &recorder{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= 500 {
+			// Server errors are not final: release the key so the client's
+			// retry runs the request again.
+			s.release(r.Context(), scopedKey)
+		} else if err := s.complete(r.Context(), scopedKey, rec); err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+		}
+		rec.flushTo(w)
+	})
+}
+
+// acquire claims key for this request. If the key is already held it
+// returns the existing record instead.
+func (s *Store) acquire(ctx context.Context, key, fingerprint string) (bool, *record, error) {
+	now := s.Clock.Now()
+	item, err := attributevalue.MarshalMap(record{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      statusInProgress,
+		LockedUntil: now.Add(lockTimeout).Unix(),
+		ExpiresAt:   now.Add(s.TTL).Unix(),
+	})
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	nowValue := &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)}
+	_, err = s.DB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item:      item,
+		// Expired records may linger until DynamoDB's TTL sweep, and
+		// abandoned in-progress records are taken over once their lock
+		// lapses.
+		ConditionExpression: aws.String("attribute_not_exists(idempotency_key) OR expires_at < :now OR (#status = :in_progress AND locked_until < :now)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":         nowValue,
+			":in_progress": &types.AttributeValueMemberS{Value: statusInProgress},
+		},
+	})
+
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		existing, err := s.get(ctx, key)
+		if err != nil {
+			return false, nil, err
+		}
+		return false, existing, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to put idempotency record: %w", err)
+	}
+	return true, nil, nil
+}
+
+func (s *Store) get(ctx context.Context, key string) (*record, error) {
+	result, err := s.DB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.Table),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency record: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return nil, fmt.Errorf("idempotency record %q disappeared", key)
+	}
+
+	var rec record
+	if err := attributevalue.UnmarshalMap(result.Item, &rec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+	}
+	return &rec, nil
+}
+
+func (s *Store) complete(ctx context.Context, key string, rec *recorder) error {
+	headers := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if value := rec.header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	headerValue, err := attributevalue.Marshal(headers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response headers: %w", err)
+	}
+
+	body := rec.body.Bytes()
+	update := "SET #status = :completed, response_status = :status, response_headers = :headers"
+	values := map[string]types.AttributeValue{
+		":completed": &types.AttributeValueMemberS{Value: statusCompleted},
+		":status":    &types.AttributeValueMemberN{Value: strconv.Itoa(rec.status)},
+		":headers":   headerValue,
+	}
+	// DynamoDB rejects empty binary attributes.
+	if len(body) > 0 {
+		update += ", response_body = :body"
+		values[":body"] = &types.AttributeValueMemberB{Value: body}
+	}
+
+	_, err = s.DB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.Table),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+		UpdateExpression: aws.String(update),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update idempotency record: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) release(ctx context.Context, key string) {
+	_, err := s.DB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.Table),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to release idempotency key: %v", err)
+	}
+}
+
+func replay(w http.ResponseWriter, rec *record) {
+	for name, value := range rec.ResponseHeaders {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.ResponseStatus)
+	w.Write(rec.ResponseBody)
+}
+
+// callerOf names the authenticated caller the API gateway identified: the
+// user (X-User-Id) or API client (X-Client-Id), or anonymous for public
+// endpoints.
+func callerOf(r *http.Request) string {
+	if id := r.Header.Get("X-User-Id"); id != "" {
+		return "user:" + id
+	}
+	if id := r.Header.Get("X-Client-Id"); id != "" {
+		return "client:" + id
+	}
+	return "anonymous"
+}
+
+// fingerprintOf hashes what makes two requests "the same": the caller, the
+// endpoint and the exact body.
+func fingerprintOf(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(callerOf(r) + " " + r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder buffers the handler's response so it can be stored before it is
+// sent.
+type recorder struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) flushTo(w http.ResponseWriter) {
+	for name, values := range rec.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
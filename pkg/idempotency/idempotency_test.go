@@ -0,0 +1,269 @@
+package idempotency
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+)
+
+// fakeDB is an in-memory idempotency table. Puts evaluate the claim
+// condition acquire writes: the key is free, expired, or held in progress
+// past its lock. Updates apply plain "SET a = :v, ..." expressions.
+type fakeDB struct {
+	mu    sync.Mutex
+	items map[string]map[string]types.AttributeValue
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{items: map[string]map[string]types.AttributeValue{}}
+}
+
+func keyOf(key map[string]types.AttributeValue) string {
+	return key["idempotency_key"].(*types.AttributeValueMemberS).Value
+}
+
+func number(item map[string]types.AttributeValue, name string) int64 {
+	v, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(v.Value, 10, 64)
+	return n
+}
+
+func (db *fakeDB) GetItem(ctx context.Context, in *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: db.items[keyOf(in.Key)]}, nil
+}
+
+func (db *fakeDB) PutItem(ctx context.Context, in *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	key := keyOf(in.Item)
+	if existing, ok := db.items[key]; ok && in.ConditionExpression != nil {
+		now := number(in.ExpressionAttributeValues, ":now")
+		status := existing["status"].(*types.AttributeValueMemberS).Value
+		expired := number(existing, "expires_at") < now
+		abandoned := status == statusInProgress && number(existing, "locked_until") < now
+		if !expired && !abandoned {
+			return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+		}
+	}
+	db.items[key] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (db *fakeDB) UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	item, ok := db.items[keyOf(in.Key)]
+	if !ok {
+		item = map[string]types.AttributeValue{"idempotency_key": in.Key["idempotency_key"]}
+		db.items[keyOf(in.Key)] = item
+	}
+	for _, clause := range strings.Split(strings.TrimPrefix(*in.UpdateExpression, "SET "), ", ") {
+		name, value, _ := strings.Cut(clause, " = ")
+		if real, ok := in.ExpressionAttributeNames[name]; ok {
+			name = real
+		}
+		item[name] = in.ExpressionAttributeValues[value]
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (db *fakeDB) DeleteItem(ctx context.Context, in *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.items, keyOf(in.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// seed stores rec as if an earlier request had written it.
+func (db *fakeDB) seed(t *testing.T, rec record) {
+	t.Helper()
+	item, err := attributevalue.MarshalMap(rec)
+	if err != nil {
+		t.Fatalf("marshal record: %v", err)
+	}
+	db.items[rec.Key] = item
+}
+
+var start = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// request is one POST /orders as a caller sends it.
+type request struct {
+	caller string
+	key    string
+	body   string
+}
+
+func (req request) send(t *testing.T, h http.Handler) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(req.body))
+	if req.key != "" {
+		r.Header.Set(Header, req.key)
+	}
+	if req.caller != "" {
+		r.Header.Set("X-User-Id", req.caller)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	first := request{caller: "user-1", key: "key-1", body: `{"sku":"A"}`}
+
+	tests := []struct {
+		name string
+		// seed is a record already in the table, with its times relative
+		// to the clock's start.
+		seed func() record
+		// status the handler answers with.
+		status int
+		// requests are sent in order at the start time, after advance.
+		requests []request
+		advance  time.Duration
+		// want are the statuses of the responses, and calls how many of
+		// the requests reached the handler.
+		want     []int
+		calls    int
+		replayed bool
+	}{
+		{
+			name:     "replays the stored response",
+			requests: []request{first, first},
+			want:     []int{http.StatusCreated, http.StatusCreated},
+			calls:    1,
+			replayed: true,
+		},
+		{
+			name:     "rejects a reused key with another payload",
+			requests: []request{first, {caller: "user-1", key: "key-1", body: `{"sku":"B"}`}},
+			want:     []int{http.StatusCreated, http.StatusUnprocessableEntity},
+			calls:    1,
+		},
+		{
+			name:     "scopes keys to the caller",
+			requests: []request{first, {caller: "user-2", key: "key-1", body: `{"sku":"A"}`}},
+			want:     []int{http.StatusCreated, http.StatusCreated},
+			calls:    2,
+		},
+		{
+			name:     "passes requests without a key through",
+			requests: []request{{caller: "user-1", body: `{}`}, {caller: "user-1", body: `{}`}},
+			want:     []int{http.StatusCreated, http.StatusCreated},
+			calls:    2,
+		},
+		{
+			name:     "rejects an oversized key",
+			requests: []request{{caller: "user-1", key: strings.Repeat("k", maxKeyLength+1), body: `{}`}},
+			want:     []int{http.StatusBadRequest},
+		},
+		{
+			name:     "releases the key after a server error",
+			status:   http.StatusServiceUnavailable,
+			requests: []request{first, first},
+			want:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			calls:    2,
+		},
+		{
+			name: "answers 409 while the first request is in progress",
+			seed: func() record {
+				return record{Status: statusInProgress, LockedUntil: start.Add(lockTimeout).Unix(), ExpiresAt: start.Add(time.Hour).Unix()}
+			},
+			requests: []request{first},
+			want:     []int{http.StatusConflict},
+		},
+		{
+			name: "takes over a lock its holder abandoned",
+			seed: func() record {
+				return record{Status: statusInProgress, LockedUntil: start.Add(lockTimeout).Unix(), ExpiresAt: start.Add(time.Hour).Unix()}
+			},
+			advance:  lockTimeout + time.Second,
+			requests: []request{first},
+			want:     []int{http.StatusCreated},
+			calls:    1,
+		},
+		{
+			name: "runs again once the stored response expires",
+			seed: func() record {
+				return record{Status: statusCompleted, ResponseStatus: http.StatusCreated, ExpiresAt: start.Add(time.Hour).Unix()}
+			},
+			advance:  time.Hour + time.Second,
+			requests: []request{first},
+			want:     []int{http.StatusCreated},
+			calls:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB()
+			clk := clock.NewManual(start, 0)
+			store := NewStore(db, "idempotency-keys", clk)
+
+			status := tt.status
+			if status == 0 {
+				status = http.StatusCreated
+			}
+			var calls int
+			h := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Location", "/orders/"+strconv.Itoa(calls))
+				w.WriteHeader(status)
+				w.Write(body)
+			}))
+
+			if tt.seed != nil {
+				rec := tt.seed()
+				r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(first.body))
+				r.Header.Set("X-User-Id", first.caller)
+				rec.Key = callerOf(r) + " POST /orders " + first.key
+				rec.Fingerprint = fingerprintOf(r, []byte(first.body))
+				db.seed(t, rec)
+			}
+			clk.Advance(tt.advance)
+
+			var last *httptest.ResponseRecorder
+			for i, req := range tt.requests {
+				last = req.send(t, h)
+				if last.Code != tt.want[i] {
+					t.Errorf("request %d: status = %d, want %d: %s", i+1, last.Code, tt.want[i], last.Body)
+				}
+			}
+			if calls != tt.calls {
+				t.Errorf("handler ran %d times, want %d", calls, tt.calls)
+			}
+			if got := last.Header().Get(ReplayedHeader) == "true"; got != tt.replayed {
+				t.Errorf("replayed = %v, want %v", got, tt.replayed)
+			}
+			if tt.replayed {
+				if got := last.Header().Get("Location"); got != "/orders/1" {
+					t.Errorf("replayed Location = %q, want the first response's", got)
+				}
+				if got := last.Body.String(); got != first.body {
+					t.Errorf("replayed body = %q, want %q", got, first.body)
+				}
+			}
+			if last.Code == http.StatusConflict && last.Header().Get("Retry-After") == "" {
+				t.Error("409 without Retry-After")
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package ids
+
+import (
+	"net/http"
+
+	"pkg/problem"
+)
+
+// PathVars extracts route variables from a request, e.g. mux.Vars.
+type PathVars func(*http.Request) map[string]string
+
+// ValidatePathParams rejects requests whose named path parameters are not
+// valid IDs with 400 before they reach a handler or the database. Legacy
+// numeric IDs are accepted so records created before UUIDs stay reachable.
+// Routes without the parameters pass through unchanged, so it can be
+// installed router-wide.
+func ValidatePathParams(vars PathVars, params ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			values := vars(r)
+			for _, param := range params {
+				value, ok := values[param]
+				if ok && !Valid(value) {
+					problem.Write(w, r, problem.New(http.StatusBadRequest, "Invalid "+param+": must be a UUID"))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
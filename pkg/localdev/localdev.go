@@ -0,0 +1,48 @@
+// Package localdev points a service or function at the local stack when
+// LOCAL_DEV=true: AWS calls go to LocalStack, DynamoDB to DynamoDB Local,
+// and Google Ads calls to the stub server, with dummy credentials. See
+// docs/LOCAL_DEVELOPMENT.md and docker-compose.yml.
+//
+// Import it for its side effect, before anything loads the AWS config:
+//
+//	import _ "pkg/localdev"
+//
+// It only fills in variables that are unset, so each endpoint can still be
+// overridden, e.g. AWS_ENDPOINT_URL_DYNAMODB to use LocalStack's DynamoDB
+// instead. Without LOCAL_DEV it does nothing.
+package localdev
+
+import (
+	"log"
+	"os"
+)
+
+// Defaults for a stack run on the host; docker-compose sets the service
+// names instead.
+var defaults = []struct{ key, value string }{
+	{"AWS_ENDPOINT_URL", "http://localhost:4566"},
+	{"AWS_ENDPOINT_URL_DYNAMODB", "http://localhost:8000"},
+	{"AWS_REGION", "us-east-1"},
+	{"AWS_ACCESS_KEY_ID", "test"},
+	{"AWS_SECRET_ACCESS_KEY", "test"},
+	{"GOOGLE_ADS_ENDPOINT", "http://localhost:8089"},
+	{"ENVIRONMENT", "local"},
+}
+
+func init() {
+	if !Enabled() {
+		return
+	}
+	for _, d := range defaults {
+		if os.Getenv(d.key) == "" {
+			os.Setenv(d.key, d.value)
+		}
+	}
+	log.Printf("Local development mode: AWS at %s, DynamoDB at %s, Google Ads at %s",
+		os.Getenv("AWS_ENDPOINT_URL"), os.Getenv("AWS_ENDPOINT_URL_DYNAMODB"), os.Getenv("GOOGLE_ADS_ENDPOINT"))
+}
+
+// Enabled reports whether LOCAL_DEV=true.
+func Enabled() bool {
+	return os.Getenv("LOCAL_DEV") == "true"
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"pkg/clock"
+)
+
+// Unit is a CloudWatch metric unit.
+type Unit string
+
+const (
+	Count        Unit = "Count"
+	Milliseconds Unit = "Milliseconds"
+	Seconds      Unit = "Seconds"
+	None         Unit = "None"
+)
+
+// GoogleAdsNamespace is the CloudWatch namespace of the Google Ads Lambdas'
+// metrics.
+const GoogleAdsNamespace = "Ecommerce/GoogleAds"
+
+// maxValuesPerMetric is CloudWatch's limit on values for one metric in a
+// single embedded metric format line.
+const maxValuesPerMetric = 100
+
+// Logger collects metrics for one Lambda invocation and writes them as
+// CloudWatch embedded metric format lines on Flush. CloudWatch Logs
+// extracts the metrics from the function's log group without a
+// PutMetricData call.
+type Logger struct {
+	Namespace  string
+	Dimensions map[string]string
+	Clock      clock.Clock
+	// Out receives the lines; defaults to stdout, which Lambda ships to
+	// CloudWatch Logs.
+	Out io.Writer
+
+	mu      sync.Mutex
+	order   []string
+	metrics map[string]*emfMetric
+}
+
+type emfMetric struct {
+	unit   Unit
+	values []float64
+}
+
+// NewLogger returns a Logger for namespace writing to stdout. Every metric
+// is emitted with dimensions.
+func NewLogger(namespace string, dimensions map[string]string, clk clock.Clock) *Logger {
+	return &Logger{Namespace: namespace, Dimensions: dimensions, Clock: clk, Out: os.Stdout}
+}
+
+// Count adds n to a counter, emitted as a single summed value.
+func (l *Logger) Count(name string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m := l.metric(name, Count)
+	if len(m.values) == 0 {
+		m.values = append(m.values, 0)
+	}
+	m.values[0] += float64(n)
+}
+
+// Put records one value; repeated values of a metric are emitted together
+// so CloudWatch keeps their distribution.
+func (l *Logger) Put(name string, value float64, unit Unit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m := l.metric(name, unit)
+	m.values = append(m.values, value)
+}
+
+// Duration records d in milliseconds.
+func (l *Logger) Duration(name string, d time.Duration) {
+	l.Put(name, float64(d)/float64(time.Millisecond), Milliseconds)
+}
+
+// Time starts a timer and returns the function that records it, for
+// `defer logger.Time("SearchLatency")()`.
+func (l *Logger) Time(name string) func() {
+	start := l.Clock.Now()
+	return func() {
+		l.Duration(name, l.Clock.Now().Sub(start))
+	}
+}
+
+// metric returns the named metric; callers hold the lock.
+func (l *Logger) metric(name string, unit Unit) *emfMetric {
+	if l.metrics == nil {
+		l.metrics = make(map[string]*emfMetric)
+	}
+	m, ok := l.metrics[name]
+	if !ok {
+		m = &emfMetric{unit: unit}
+		l.metrics[name] = m
+		l.order = append(l.order, name)
+	}
+	return m
+}
+
+// Flush writes the collected metrics and resets the logger. Metrics with
+// more values than one line may carry are split across lines.
+func (l *Logger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.order) == 0 || l.Out == nil {
+		return nil
+	}
+
+	dimensions := make([]string, 0, len(l.Dimensions))
+	for name := range l.Dimensions {
+		dimensions = append(dimensions, name)
+	}
+	sort.Strings(dimensions)
+
+	for offset := 0; ; offset += maxValuesPerMetric {
+		line := map[string]interface{}{}
+		var definitions []map[string]string
+		for _, name := range l.order {
+			m := l.metrics[name]
+			if offset >= len(m.values) {
+				continue
+			}
+			values := m.values[offset:min(offset+maxValuesPerMetric, len(m.values))]
+			if len(values) == 1 {
+				line[name] = values[0]
+			} else {
+				line[name] = values
+			}
+			definitions = append(definitions, map[string]string{"Name": name, "Unit": string(m.unit)})
+		}
+		if len(definitions) == 0 {
+			break
+		}
+
+		for name, value := range l.Dimensions {
+			line[name] = value
+		}
+		line["_aws"] = map[string]interface{}{
+			"Timestamp": l.Clock.Now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  l.Namespace,
+				"Dimensions": [][]string{dimensions},
+				"Metrics":    definitions,
+			}},
+		}
+
+		encoded, err := json.Marshal(line)
+		if err != nil {
+			return fmt.Errorf("failed to encode metrics: %w", err)
+		}
+		if _, err := fmt.Fprintln(l.Out, string(encoded)); err != nil {
+			return fmt.Errorf("failed to write metrics: %w", err)
+		}
+	}
+
+	l.order = nil
+	l.metrics = nil
+	return nil
+}
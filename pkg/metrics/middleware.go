@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"pkg/clock"
+)
+
+// RouteFunc names the route a request matched, e.g. its mux path
+// template. Raw paths would give every ID its own series.
+type RouteFunc func(*http.Request) string
+
+// HTTP records request counts by status and request latency for one
+// service. The error rate is the share of requests with a 5xx status.
+type HTTP struct {
+	service  string
+	route    RouteFunc
+	clock    clock.Clock
+	requests *CounterVec
+	duration *HistogramVec
+}
+
+// NewHTTP registers the HTTP request metrics for service in r.
+func NewHTTP(r *Registry, service string, route RouteFunc, clk clock.Clock) *HTTP {
+	return &HTTP{
+		service: service,
+		route:   route,
+		clock:   clk,
+		requests: r.Counter("http_requests_total", "HTTP requests handled, by route and status.",
+			"service", "method", "route", "status"),
+		duration: r.Histogram("http_request_duration_seconds", "HTTP request latency in seconds, by route.",
+			nil, "service", "method", "route"),
+	}
+}
+
+// Middleware measures every request it wraps. Install it inside the
+// recovery middleware: a request whose handler panics is counted as a
+// 500 before the panic reaches the recoverer.
+func (h *HTTP) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := h.clock.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		completed := false
+		defer func() {
+			status := sw.status
+			if !completed {
+				status = http.StatusInternalServerError
+			} else if status == 0 {
+				status = http.StatusOK
+			}
+			route := h.route(r)
+			h.requests.Add(1, h.service, r.Method, route, strconv.Itoa(status))
+			h.duration.Observe(h.clock.Now().Sub(start).Seconds(), h.service, r.Method, route)
+		}()
+		next.ServeHTTP(sw, r)
+		completed = true
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush and Unwrap keep streaming handlers and http.ResponseController
+// working through the wrapper.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
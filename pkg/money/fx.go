@@ -0,0 +1,83 @@
+package money
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNoRate is returned when a Provider has no rate between two currencies.
+var ErrNoRate = errors.New("money: no exchange rate")
+
+// Provider quotes exchange rates. Rate returns how many units of to one
+// unit of from buys. Implementations may call out to a rates service; the
+// callers here convert a handful of thresholds per account, so they do not
+// need to cache.
+type Provider interface {
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
+
+// Static quotes fixed rates, given as units of each currency per US
+// dollar. The dollar itself is always 1.
+type Static map[string]float64
+
+func (s Static) Rate(_ context.Context, from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	f, err := s.perUSD(from)
+	if err != nil {
+		return 0, err
+	}
+	t, err := s.perUSD(to)
+	if err != nil {
+		return 0, err
+	}
+	return t / f, nil
+}
+
+func (s Static) perUSD(currency string) (float64, error) {
+	if currency == USD {
+		return 1, nil
+	}
+	if rate, ok := s[currency]; ok && rate > 0 {
+		return rate, nil
+	}
+	return 0, fmt.Errorf("%w for %s", ErrNoRate, currency)
+}
+
+// StaticFromEnv reads FX_RATES, a JSON object of units per US dollar such
+// as {"EUR": 0.92, "GBP": 0.79}. Unset, only dollar amounts convert.
+func StaticFromEnv() (Static, error) {
+	raw := os.Getenv("FX_RATES")
+	if raw == "" {
+		return Static{}, nil
+	}
+	var rates map[string]float64
+	if err := json.Unmarshal([]byte(raw), &rates); err != nil {
+		return nil, fmt.Errorf("FX_RATES must be a JSON object of rates per USD: %w", err)
+	}
+	s := make(Static, len(rates))
+	for currency, rate := range rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("FX_RATES: rate for %s must be positive", currency)
+		}
+		s[strings.ToUpper(currency)] = rate
+	}
+	return s, nil
+}
+
+// Convert returns m in currency to.
+func Convert(ctx context.Context, p Provider, m Money, to string) (Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	rate, err := p.Rate(ctx, m.Currency, to)
+	if err != nil {
+		return Money{}, err
+	}
+	return FromUnits(m.Units()*rate, to), nil
+}
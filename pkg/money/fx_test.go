@@ -0,0 +1,63 @@
+package money
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	rates := Static{"EUR": 0.8, "GBP": 0.5}
+	tests := []struct {
+		name    string
+		money   Money
+		to      string
+		want    Money
+		wantErr error
+	}{
+		{"into dollars", FromUnits(8, "EUR"), USD, FromUnits(10, USD), nil},
+		{"out of dollars", FromUnits(10, USD), "GBP", FromUnits(5, "GBP"), nil},
+		{"across the dollar", FromUnits(8, "EUR"), "GBP", FromUnits(5, "GBP"), nil},
+		{"to its own currency", FromUnits(3, "CHF"), "CHF", FromUnits(3, "CHF"), nil},
+		{"without a rate", FromUnits(3, "CHF"), USD, Money{}, ErrNoRate},
+	}
+	for _, tt := range tests {
+		got, err := Convert(context.Background(), rates, tt.money, tt.to)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStaticFromEnv(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    Static
+		wantErr bool
+	}{
+		{"", Static{}, false},
+		{`{"eur": 0.92, "GBP": 0.79}`, Static{"EUR": 0.92, "GBP": 0.79}, false},
+		{`{"EUR": 0}`, nil, true},
+		{`[0.92]`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("FX_RATES", tt.env)
+		got, err := StaticFromEnv()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FX_RATES=%s: err = %v, want error %v", tt.env, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("FX_RATES=%s: rates = %v, want %v", tt.env, got, tt.want)
+			continue
+		}
+		for currency, rate := range tt.want {
+			if got[currency] != rate {
+				t.Errorf("FX_RATES=%s: rates = %v, want %v", tt.env, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package money represents amounts the way Google Ads reports them, in
+// micros of a currency, so amounts from accounts in different currencies
+// are never mixed up unnoticed, and converts them between currencies with
+// a pluggable rate Provider.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// USD is the currency the optimizer and monitor rules are written in.
+const USD = "USD"
+
+const microsPerUnit = 1000000
+
+// ErrMixedCurrencies is returned when adding amounts in different
+// currencies.
+var ErrMixedCurrencies = errors.New("money: mixed currencies")
+
+// Money is an amount in millionths of a currency's unit, the currency an
+// ISO 4217 code. The zero value is an amount of nothing in no currency.
+type Money struct {
+	AmountMicros int64  `json:"amount_micros" dynamodbav:"amount_micros"`
+	Currency     string `json:"currency" dynamodbav:"currency"`
+}
+
+// FromMicros returns micros of currency, as in Google Ads *_micros fields.
+func FromMicros(micros int64, currency string) Money {
+	return Money{AmountMicros: micros, Currency: currency}
+}
+
+// FromUnits returns amount whole units of currency, rounded to the micro.
+func FromUnits(amount float64, currency string) Money {
+	return Money{AmountMicros: int64(math.Round(amount * microsPerUnit)), Currency: currency}
+}
+
+// Units returns the amount in whole units of its currency.
+func (m Money) Units() float64 {
+	return float64(m.AmountMicros) / microsPerUnit
+}
+
+// Mul scales the amount by f, keeping the currency.
+func (m Money) Mul(f float64) Money {
+	return FromUnits(m.Units()*f, m.Currency)
+}
+
+// Div returns the amount per n, e.g. cost per conversion. It is zero when
+// n is.
+func (m Money) Div(n float64) Money {
+	if n == 0 {
+		return Money{Currency: m.Currency}
+	}
+	return m.Mul(1 / n)
+}
+
+// Add returns m plus o. Amounts in different currencies cannot be added
+// without a rate; Add returns m and ErrMixedCurrencies rather than mix
+// them.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency == "" {
+		m.Currency = o.Currency
+	}
+	if o.AmountMicros != 0 && o.Currency != m.Currency {
+		return m, fmt.Errorf("%w: adding %s to %s", ErrMixedCurrencies, o.Currency, m.Currency)
+	}
+	m.AmountMicros += o.AmountMicros
+	return m, nil
+}
+
+// symbols are the currencies written with a prefix symbol; the rest are
+// written with their code after the amount.
+var symbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"INR": "₹",
+	"AUD": "A$",
+	"CAD": "C$",
+}
+
+// String renders the amount to two decimals in its currency, e.g. "€12.50"
+// or "12.50 CHF". Amounts of unknown currency have no symbol.
+func (m Money) String() string {
+	if symbol, ok := symbols[m.Currency]; ok {
+		if m.AmountMicros < 0 {
+			return fmt.Sprintf("-%s%.2f", symbol, -m.Units())
+		}
+		return fmt.Sprintf("%s%.2f", symbol, m.Units())
+	}
+	if m.Currency == "" {
+		return fmt.Sprintf("%.2f", m.Units())
+	}
+	return fmt.Sprintf("%.2f %s", m.Units(), m.Currency)
+}
+
+// UnmarshalJSON reads {"amount_micros": ..., "currency": ...}, and also a
+// plain number of units, as payloads carried amounts before they had a
+// currency. Those come back with no currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var units float64
+	if err := json.Unmarshal(data, &units); err == nil {
+		*m = FromUnits(units, "")
+		return nil
+	}
+	type plain Money
+	return json.Unmarshal(data, (*plain)(m))
+}
@@ -0,0 +1,85 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{FromUnits(12.5, "EUR"), "€12.50"},
+		{FromUnits(-3.456, USD), "-$3.46"},
+		{FromMicros(1234500000, "CHF"), "1234.50 CHF"},
+		{FromUnits(7, ""), "7.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		{"units round to the micro", FromUnits(0.1234567, USD), FromMicros(123457, USD)},
+		{"Mul keeps the currency", FromUnits(10, "GBP").Mul(1.5), FromUnits(15, "GBP")},
+		{"Div splits the amount", FromUnits(90, USD).Div(4), FromUnits(22.5, USD)},
+		{"Div by zero is zero", FromUnits(90, USD).Div(0), FromMicros(0, USD)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{"sums one currency", FromUnits(1.25, "EUR"), FromUnits(2, "EUR"), FromUnits(3.25, "EUR"), nil},
+		{"takes the currency of a sum begun from zero", Money{}, FromUnits(2, "EUR"), FromUnits(2, "EUR"), nil},
+		{"ignores nothing in another currency", FromUnits(2, "EUR"), Money{}, FromUnits(2, "EUR"), nil},
+		{"refuses to mix currencies", FromUnits(1, USD), FromUnits(1, "EUR"), FromUnits(1, USD), ErrMixedCurrencies},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		want Money
+	}{
+		{`{"amount_micros": 2500000, "currency": "EUR"}`, FromUnits(2.5, "EUR")},
+		{`2.5`, FromUnits(2.5, "")},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.data), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.data, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package notify
+
+import "time"
+
+// KindBudgetOrderAlert is an account budget order (the spending limit
+// agreed with Google for invoiced accounts) running low or ending.
+const KindBudgetOrderAlert = "budget_order_alert"
+
+// BudgetOrderAlert mirrors the payload published by account-billing.
+// Amounts are in the account currency.
+type BudgetOrderAlert struct {
+	CustomerID          string     `json:"customer_id"`
+	AccountName         string     `json:"account_name,omitempty"`
+	BudgetID            string     `json:"budget_id"`
+	BudgetName          string     `json:"budget_name"`
+	PurchaseOrderNumber string     `json:"purchase_order_number,omitempty"`
+	AlertType           string     `json:"alert_type"`
+	Message             string     `json:"message"`
+	Currency            string     `json:"currency"`
+	SpendingLimit       float64    `json:"spending_limit"`
+	AmountServed        float64    `json:"amount_served"`
+	Remaining           float64    `json:"remaining"`
+	PercentConsumed     float64    `json:"percent_consumed"`
+	EndDate             *time.Time `json:"end_date,omitempty"`
+	ProjectedExhaustion *time.Time `json:"projected_exhaustion,omitempty"`
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/ids"
+)
+
+// deferredRetention is how long an undelivered deferred message is kept
+// before DynamoDB expires it.
+const deferredRetention = 14 * 24 * time.Hour
+
+// Deferrer holds a message for one channel until deliverAt.
+type Deferrer interface {
+	Defer(ctx context.Context, channel string, msg Message, deliverAt time.Time) error
+}
+
+// Deferred is a message waiting for its channel's schedule to allow it.
+type Deferred struct {
+	Channel    string
+	DeliverKey string
+	DeliverAt  time.Time
+	Message    Message
+}
+
+// DeferredStore keeps deferred messages in a DynamoDB table keyed by
+// channel (hash) and deliver_key (range): the delivery time in RFC 3339
+// followed by a unique suffix, so a channel's due messages are one Query.
+type DeferredStore struct {
+	client *dynamodb.Client
+	table  string
+	ids    ids.Generator
+}
+
+func NewDeferredStore(client *dynamodb.Client, table string, gen ids.Generator) *DeferredStore {
+	return &DeferredStore{client: client, table: table, ids: gen}
+}
+
+func (s *DeferredStore) Defer(ctx context.Context, channel string, msg Message, deliverAt time.Time) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deferred message: %w", err)
+	}
+
+	deliverAt = deliverAt.UTC()
+	key := deliverAt.Format(time.RFC3339) + "#" + s.ids.NewID()
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"channel":     &types.AttributeValueMemberS{Value: channel},
+			"deliver_key": &types.AttributeValueMemberS{Value: key},
+			"message":     &types.AttributeValueMemberS{Value: string(body)},
+			"expires_at":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", deliverAt.Add(deferredRetention).Unix())},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save deferred message: %w", err)
+	}
+	return nil
+}
+
+// Due returns the channel's messages whose delivery time has passed,
+// oldest first.
+func (s *DeferredStore) Due(ctx context.Context, channel string, now time.Time) ([]Deferred, error) {
+	// "~" sorts after "#", so every key at or before now matches.
+	upper := now.UTC().Format(time.RFC3339) + "~"
+
+	var due []Deferred
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.table),
+		KeyConditionExpression: aws.String("channel = :channel AND deliver_key <= :upper"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":channel": &types.AttributeValueMemberS{Value: channel},
+			":upper":   &types.AttributeValueMemberS{Value: upper},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query deferred messages: %w", err)
+		}
+		for _, item := range page.Items {
+			key, _ := item["deliver_key"].(*types.AttributeValueMemberS)
+			body, _ := item["message"].(*types.AttributeValueMemberS)
+			if key == nil || body == nil {
+				continue
+			}
+			d := Deferred{Channel: channel, DeliverKey: key.Value}
+			if err := json.Unmarshal([]byte(body.Value), &d.Message); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal deferred message %s: %w", key.Value, err)
+			}
+			at, _, _ := strings.Cut(key.Value, "#")
+			d.DeliverAt, _ = time.Parse(time.RFC3339, at)
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+// Remove deletes a delivered message.
+func (s *DeferredStore) Remove(ctx context.Context, d Deferred) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]types.AttributeValue{
+			"channel":     &types.AttributeValueMemberS{Value: d.Channel},
+			"deliver_key": &types.AttributeValueMemberS{Value: d.DeliverKey},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove deferred message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// KindWeeklyDigest is the weekly per-account summary.
+const KindWeeklyDigest = "weekly_digest"
+
+// WeeklyDigest is published once a week. Sections are optional so producers
+// can contribute independently.
+type WeeklyDigest struct {
+	Kind        string           `json:"kind"`
+	WeekStart   string           `json:"week_start"`
+	Environment string           `json:"environment"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Hygiene     []AccountHygiene `json:"hygiene,omitempty"`
+
+	// Competitors is contributed by auction-insights.
+	Competitors []AccountCompetitors `json:"competitors,omitempty"`
+}
+
+// AccountHygiene is one account's structural health for the week. Trend
+// holds prior weekly scores, oldest first.
+type AccountHygiene struct {
+	CustomerID    string         `json:"customer_id"`
+	AccountName   string         `json:"account_name,omitempty"`
+	Score         float64        `json:"score"`
+	PreviousScore *float64       `json:"previous_score,omitempty"`
+	Trend         []float64      `json:"trend,omitempty"`
+	Checks        []HygieneCheck `json:"checks"`
+}
+
+// HygieneCheck is the result of one structural audit.
+type HygieneCheck struct {
+	Name     string   `json:"name"`
+	Issues   int      `json:"issues"`
+	Penalty  float64  `json:"penalty"`
+	Examples []string `json:"examples,omitempty"`
+}
+
+// Delta is the week-over-week score change, or 0 without history.
+func (a AccountHygiene) Delta() float64 {
+	if a.PreviousScore == nil {
+		return 0
+	}
+	return a.Score - *a.PreviousScore
+}
+
+// Sparkline renders Trend plus the current score as block characters.
+func (a AccountHygiene) Sparkline() string {
+	const bars = "▁▂▃▄▅▆▇█"
+	runes := []rune(bars)
+	scores := append(append([]float64{}, a.Trend...), a.Score)
+
+	out := make([]rune, len(scores))
+	for i, s := range scores {
+		idx := int(s / 100 * float64(len(runes)-1))
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(runes) {
+			idx = len(runes) - 1
+		}
+		out[i] = runes[idx]
+	}
+	return string(out)
+}
+
+// Kinds of competitor change.
+const (
+	CompetitorNew   = "NEW"
+	CompetitorGone  = "GONE"
+	CompetitorShift = "SHIFT"
+)
+
+// AccountCompetitors is how the competition in one account's search
+// auctions changed between the last two full weeks.
+type AccountCompetitors struct {
+	CustomerID  string             `json:"customer_id"`
+	AccountName string             `json:"account_name,omitempty"`
+	WindowStart string             `json:"window_start"`
+	WindowEnd   string             `json:"window_end"`
+	Competitors int                `json:"competitors"`
+	Changes     []CompetitorChange `json:"changes,omitempty"`
+
+	// ReportURI is where the week's full auction insights are stored.
+	ReportURI string `json:"report_uri,omitempty"`
+}
+
+// CompetitorChange is one domain that entered or left the account's
+// auctions, or whose overlap or position above rate moved. The previous
+// rates are unset for new competitors; a gone competitor's current rates
+// are zero.
+type CompetitorChange struct {
+	Domain                    string   `json:"domain"`
+	Change                    string   `json:"change"`
+	ImpressionShare           float64  `json:"impression_share"`
+	OverlapRate               float64  `json:"overlap_rate"`
+	PreviousOverlapRate       *float64 `json:"previous_overlap_rate,omitempty"`
+	PositionAboveRate         float64  `json:"position_above_rate"`
+	PreviousPositionAboveRate *float64 `json:"previous_position_above_rate,omitempty"`
+}
+
+// String renders the change as "example.com: overlap 18% (+9 pts),
+// above you 40% (−2 pts)".
+func (c CompetitorChange) String() string {
+	switch c.Change {
+	case CompetitorNew:
+		return fmt.Sprintf("%s: new, overlap %.0f%%, above you %.0f%%", c.Domain, c.OverlapRate*100, c.PositionAboveRate*100)
+	case CompetitorGone:
+		if c.PreviousOverlapRate != nil {
+			return fmt.Sprintf("%s: gone, overlap was %.0f%%", c.Domain, *c.PreviousOverlapRate*100)
+		}
+		return c.Domain + ": gone"
+	}
+	s := fmt.Sprintf("%s: overlap %.0f%%", c.Domain, c.OverlapRate*100)
+	if c.PreviousOverlapRate != nil {
+		s += fmt.Sprintf(" (%+.0f pts)", (c.OverlapRate-*c.PreviousOverlapRate)*100)
+	}
+	s += fmt.Sprintf(", above you %.0f%%", c.PositionAboveRate*100)
+	if c.PreviousPositionAboveRate != nil {
+		s += fmt.Sprintf(" (%+.0f pts)", (c.PositionAboveRate-*c.PreviousPositionAboveRate)*100)
+	}
+	return s
+}
@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+
+	"pkg/money"
+)
+
+var emailTemplate = template.Must(template.New("email").Funcs(template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) },
+	"money":   func(m money.Money) string { return m.String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #202124;">
+  <h2>{{.Title}}</h2>
+  {{if .Alert}}
+  <p>{{.Alert.Message}}</p>
+  <table cellpadding="6" style="border-collapse: collapse;">
+    <tr><td><b>Campaign</b></td><td>{{.Alert.CampaignName}} ({{.Alert.CampaignID}})</td></tr>
+    <tr><td><b>Customer</b></td><td>{{.Alert.CustomerID}}</td></tr>
+    <tr><td><b>Impressions</b></td><td>{{.Alert.Impressions}}</td></tr>
+    <tr><td><b>Clicks</b></td><td>{{.Alert.Clicks}}</td></tr>
+    <tr><td><b>Cost</b></td><td>{{money .Alert.Cost}}</td></tr>
+    <tr><td><b>Conversions</b></td><td>{{.Alert.Conversions}}</td></tr>
+    <tr><td><b>CTR</b></td><td>{{percent .Alert.CTR}}</td></tr>
+    <tr><td><b>CPC</b></td><td>{{money .Alert.CPC}}</td></tr>
+    {{if .Alert.AdID}}<tr><td><b>Ad</b></td><td>{{.Alert.AdID}} in {{.Alert.AdGroupName}} ({{.Alert.AdGroupID}})</td></tr>{{end}}
+    {{if .Alert.AdStrength}}<tr><td><b>Ad strength</b></td><td>{{.Alert.AdStrength}}</td></tr>{{end}}
+    {{if .Alert.KeywordID}}<tr><td><b>Keyword</b></td><td>{{.Alert.KeywordText}} ({{.Alert.MatchType}}) in {{.Alert.AdGroupName}} ({{.Alert.AdGroupID}})</td></tr>{{end}}
+    {{if .Alert.AssetText}}<tr><td><b>{{.Alert.AssetFieldType}}</b></td><td>{{.Alert.AssetText}}</td></tr>{{end}}
+    {{if .Alert.SearchImpressionShare}}<tr><td><b>Impression share</b></td><td>{{percent .Alert.SearchImpressionShare}} won, {{percent .Alert.BudgetLostImpressionShare}} lost to budget, {{percent .Alert.RankLostImpressionShare}} lost to rank</td></tr>{{end}}
+    {{if .Alert.RecommendedBudget}}<tr><td><b>Suggested budget</b></td><td>{{money .Alert.RecommendedBudget}} (+{{money .Alert.BudgetIncrease}})</td></tr>{{end}}
+    {{if .Alert.LandingPageURL}}<tr><td><b>Landing page</b></td><td>{{.Alert.LandingPageURL}}</td></tr>
+    <tr><td><b>Status</b></td><td>{{if .Alert.CheckError}}{{.Alert.CheckError}}{{else}}HTTP {{.Alert.HTTPStatus}} in {{.Alert.ResponseTimeMs}}ms{{end}}</td></tr>
+    <tr><td><b>Used by</b></td><td>{{.Alert.AffectedAds}} ads, {{.Alert.AffectedKeywords}} keywords{{if .Alert.PausedAds}} ({{.Alert.PausedAds}} ads paused){{end}}</td></tr>{{end}}
+    {{range .Alert.RedirectChain}}<tr><td><b>Redirects to</b></td><td>{{.}}</td></tr>{{end}}
+    {{range .Alert.MobileIssues}}<tr><td><b>Mobile issue</b></td><td>{{.}}</td></tr>{{end}}
+    {{range .Alert.PolicyTopics}}<tr><td><b>Policy topic</b></td><td>{{.Topic}}{{if .Type}} ({{.Type}}){{end}}</td></tr>{{end}}
+  </table>
+  {{end}}
+  {{if .BudgetOrder}}
+  <p>{{.BudgetOrder.Message}}</p>
+  <table cellpadding="6" style="border-collapse: collapse;">
+    <tr><td><b>Budget order</b></td><td>{{.BudgetOrder.BudgetName}} ({{.BudgetOrder.BudgetID}})</td></tr>
+    <tr><td><b>Customer</b></td><td>{{.BudgetOrder.CustomerID}}</td></tr>
+    {{if .BudgetOrder.PurchaseOrderNumber}}<tr><td><b>PO number</b></td><td>{{.BudgetOrder.PurchaseOrderNumber}}</td></tr>{{end}}
+    <tr><td><b>Spending limit</b></td><td>{{printf "%.2f" .BudgetOrder.SpendingLimit}} {{.BudgetOrder.Currency}}</td></tr>
+    <tr><td><b>Served</b></td><td>{{printf "%.2f" .BudgetOrder.AmountServed}} {{.BudgetOrder.Currency}}</td></tr>
+    <tr><td><b>Remaining</b></td><td>{{printf "%.2f" .BudgetOrder.Remaining}} {{.BudgetOrder.Currency}}</td></tr>
+    {{if .BudgetOrder.EndDate}}<tr><td><b>Ends</b></td><td>{{.BudgetOrder.EndDate.Format "2006-01-02"}}</td></tr>{{end}}
+  </table>
+  {{end}}
+  {{if .Group}}
+  <p>{{.Group.Message}}</p>
+  <p>Customer {{.Group.CustomerID}} · {{len .Group.Alerts}} related alerts</p>
+  <table cellpadding="6" border="1" style="border-collapse: collapse;">
+    <tr><th>Alert</th><th>Campaign</th><th>Cost</th><th>Conversions</th><th>Details</th></tr>
+    {{range .Group.Alerts}}
+    <tr><td>{{.AlertType}}</td><td>{{.CampaignName}} ({{.CampaignID}})</td><td>{{money .Cost}}</td><td>{{.Conversions}}</td><td>{{.Message}}</td></tr>
+    {{end}}
+  </table>
+  {{end}}
+  {{if .Recommendations}}
+  <table cellpadding="6" border="1" style="border-collapse: collapse;">
+    <tr><th>Campaign</th><th>Keyword</th><th>Type</th><th>Current</th><th>Recommended</th><th>Reason</th><th>Approval</th></tr>
+    {{range .Recommendations}}
+    <tr><td>{{.CampaignName}}</td><td>{{.KeywordText}}</td><td>{{.OptimizationType}}</td><td>{{money .CurrentBid}}</td><td>{{money .RecommendedBid}}</td><td>{{.Reason}}</td><td>{{if .ApproveURL}}<a href="{{.ApproveURL}}">Approve</a> · <a href="{{.RejectURL}}">Reject</a>{{else}}{{.ApprovalStatus}}{{end}}</td></tr>
+    {{end}}
+  </table>
+  {{if .Exports}}<p>Download as {{range $i, $e := .Exports}}{{if $i}} · {{end}}<a href="{{$e.DownloadURL}}">{{$e.Format}}</a>{{end}} (links expire {{(index .Exports 0).ExpiresAt.UTC.Format "2006-01-02 15:04 MST"}})</p>{{end}}
+  {{end}}
+  {{if .Digest}}
+  {{range .Digest.Hygiene}}
+  <h3>{{.AccountName}} ({{.CustomerID}})</h3>
+  <p>Hygiene score <b>{{printf "%.0f" .Score}}</b>/100 {{.Sparkline}}{{if .PreviousScore}} ({{printf "%+.0f" .Delta}} vs last week){{end}}</p>
+  <table cellpadding="6" border="1" style="border-collapse: collapse;">
+    <tr><th>Check</th><th>Issues</th><th>Penalty</th><th>Examples</th></tr>
+    {{range .Checks}}
+    <tr><td>{{.Name}}</td><td>{{.Issues}}</td><td>{{printf "%.0f" .Penalty}}</td><td>{{range $i, $e := .Examples}}{{if $i}}, {{end}}{{$e}}{{end}}</td></tr>
+    {{end}}
+  </table>
+  {{end}}
+  {{range .Digest.Competitors}}
+  <h3>{{.AccountName}} ({{.CustomerID}})</h3>
+  <p>Auction insights {{.WindowStart}} to {{.WindowEnd}}: {{.Competitors}} competitors{{if not .Changes}}, no significant changes{{end}}</p>
+  {{if .Changes}}<ul>{{range .Changes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+  {{if .ReportURI}}<p>Full report: {{.ReportURI}}</p>{{end}}
+  {{end}}
+  {{end}}
+  {{if .Experiment}}
+  <table cellpadding="6" border="1" style="border-collapse: collapse;">
+    <tr><th>Cohort</th><th>Campaigns</th><th>Clicks</th><th>Conversions</th><th>Conversion rate</th><th>Cost</th><th>CPA</th></tr>
+    {{with .Experiment.Treatment}}<tr><td>Treatment</td><td>{{.Campaigns}}</td><td>{{.Clicks}}</td><td>{{printf "%.1f" .Conversions}}</td><td>{{percent .ConversionRate}}</td><td>{{money .Cost}}</td><td>{{money .CPA}}</td></tr>{{end}}
+    {{with .Experiment.Control}}<tr><td>Control</td><td>{{.Campaigns}}</td><td>{{.Clicks}}</td><td>{{printf "%.1f" .Conversions}}</td><td>{{percent .ConversionRate}}</td><td>{{money .Cost}}</td><td>{{money .CPA}}</td></tr>{{end}}
+  </table>
+  {{if .Experiment.ConversionRateLift}}<p><b>Conversion rate lift:</b> {{.Experiment.ConversionRateLift}}</p>{{end}}
+  {{if .Experiment.CPADelta}}<p><b>CPA change:</b> {{.Experiment.CPADelta}}</p>{{end}}
+  {{if .Experiment.ReportURI}}<p>Full report: {{.Experiment.ReportURI}}</p>{{end}}
+  {{end}}
+  <p style="color: #5f6368; font-size: 12px;">Environment: {{.Environment}} · {{.Timestamp.Format "2006-01-02 15:04 MST"}}</p>
+</body>
+</html>`))
+
+type emailView struct {
+	Message
+	Title string
+}
+
+// RenderEmailHTML renders a message as an HTML email body.
+func RenderEmailHTML(msg Message) (string, error) {
+	var buf bytes.Buffer
+	if err := emailTemplate.Execute(&buf, emailView{Message: msg, Title: msg.Title()}); err != nil {
+		return "", fmt.Errorf("failed to render email: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// EmailChannel sends HTML emails through SES.
+type EmailChannel struct {
+	ChannelName string
+	From        string
+	To          []string
+	Client      *sesv2.Client
+}
+
+func NewEmailChannel(name string, client *sesv2.Client, from string, to []string) *EmailChannel {
+	return &EmailChannel{ChannelName: name, From: from, To: to, Client: client}
+}
+
+func (c *EmailChannel) Name() string { return c.ChannelName }
+
+func (c *EmailChannel) Send(ctx context.Context, msg Message) error {
+	body, err := RenderEmailHTML(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(c.From),
+		Destination:      &types.Destination{ToAddresses: c.To},
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{Data: aws.String(msg.Title())},
+				Body: &types.Body{
+					Html: &types.Content{Data: aws.String(body)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
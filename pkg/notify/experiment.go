@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"pkg/money"
+)
+
+// KindExperimentReport is the weekly comparison of an optimizer
+// experiment's treatment and control cohorts.
+const KindExperimentReport = "experiment_report"
+
+// ExperimentReportSchemaVersion is the highest experiment report schema
+// the formatters understand. Version 2 carries costs as money.Money.
+const ExperimentReportSchemaVersion = 2
+
+// ExperimentReport mirrors the payload published by bid-optimizer. It
+// covers the experiment from its first assignment to WindowEnd.
+type ExperimentReport struct {
+	ExperimentID string        `json:"experiment_id"`
+	Environment  string        `json:"environment"`
+	GeneratedAt  time.Time     `json:"generated_at"`
+	WindowStart  string        `json:"window_start"`
+	WindowEnd    string        `json:"window_end"`
+	Control      CohortMetrics `json:"control"`
+	Treatment    CohortMetrics `json:"treatment"`
+
+	// ConversionRateLift is the treatment's conversion rate relative to
+	// control's, minus one; CPADelta the same for cost per conversion.
+	ConversionRateLift *Estimate `json:"conversion_rate_lift,omitempty"`
+	CPADelta           *Estimate `json:"cpa_delta,omitempty"`
+
+	// ReportURI is where the full report, with per-campaign rows, is
+	// stored.
+	ReportURI string `json:"report_uri,omitempty"`
+}
+
+// CohortMetrics totals one cohort's campaigns over the window. Costs of
+// accounts in other currencies are converted to a common one.
+type CohortMetrics struct {
+	Campaigns      int         `json:"campaigns"`
+	Clicks         int64       `json:"clicks"`
+	Conversions    float64     `json:"conversions"`
+	Cost           money.Money `json:"cost"`
+	ConversionRate float64     `json:"conversion_rate"`
+	CPA            money.Money `json:"cpa"`
+}
+
+// Estimate is a relative difference with its 95% confidence interval.
+// Significant is set when the interval excludes zero.
+type Estimate struct {
+	Value       float64 `json:"value"`
+	Lower       float64 `json:"lower"`
+	Upper       float64 `json:"upper"`
+	Significant bool    `json:"significant"`
+}
+
+// String renders the estimate as "+4.2% (95% CI −1.0% to +9.4%)", marked
+// when significant.
+func (e Estimate) String() string {
+	s := fmt.Sprintf("%+.1f%% (95%% CI %+.1f%% to %+.1f%%)", e.Value*100, e.Lower*100, e.Upper*100)
+	if e.Significant {
+		s += ", significant"
+	}
+	return s
+}
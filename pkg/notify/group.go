@@ -0,0 +1,29 @@
+package notify
+
+// KindAlertGroup is several campaign alerts from one campaign-monitor run
+// that share a likely root cause, sent as one notification.
+const KindAlertGroup = "alert_group"
+
+// maxGroupAlerts bounds how many member alerts a grouped notification
+// lists; the rest are summarised by count.
+const maxGroupAlerts = 10
+
+// AlertGroup mirrors the grouped alert published by campaign-monitor.
+// CampaignID and CampaignName are set when the group concerns a single
+// campaign.
+type AlertGroup struct {
+	CustomerID   string          `json:"customer_id"`
+	Cause        string          `json:"cause"`
+	Message      string          `json:"message"`
+	CampaignID   string          `json:"campaign_id,omitempty"`
+	CampaignName string          `json:"campaign_name,omitempty"`
+	Alerts       []CampaignAlert `json:"alerts"`
+}
+
+// Listed returns the member alerts to show and how many were left out.
+func (g AlertGroup) Listed() ([]CampaignAlert, int) {
+	if len(g.Alerts) <= maxGroupAlerts {
+		return g.Alerts, 0
+	}
+	return g.Alerts[:maxGroupAlerts], len(g.Alerts) - maxGroupAlerts
+}
@@ -0,0 +1,182 @@
+// Package notify formats Google Ads alerts and bid recommendations for
+// human-facing channels (Slack, email) and routes them per alert type.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pkg/money"
+)
+
+// Message kinds understood by the formatters. They double as the envelope
+// message types producers publish under.
+const (
+	KindCampaignAlert = "campaign_alert"
+	KindBidReport     = "bid_report"
+)
+
+// Highest envelope schema versions the formatters understand, per kind.
+// Version 2 of campaign alerts, bid reports and alert groups carries
+// amounts as money.Money; version 1 amounts still decode, with no
+// currency.
+const (
+	CampaignAlertSchemaVersion = 2
+	BidReportSchemaVersion     = 2
+	WeeklyDigestSchemaVersion  = 1
+	BudgetOrderSchemaVersion   = 1
+	AlertGroupSchemaVersion    = 2
+)
+
+// CampaignAlert mirrors the JSON payload published by campaign-monitor.
+type CampaignAlert struct {
+	CustomerID     string      `json:"customer_id"`
+	CampaignID     string      `json:"campaign_id"`
+	CampaignName   string      `json:"campaign_name"`
+	Status         string      `json:"status"`
+	Impressions    int64       `json:"impressions"`
+	Clicks         int64       `json:"clicks"`
+	Cost           money.Money `json:"cost"`
+	Conversions    int64       `json:"conversions"`
+	CTR            float64     `json:"ctr"`
+	CPC            money.Money `json:"cpc"`
+	ConversionRate float64     `json:"conversion_rate"`
+	AlertType      string      `json:"alert_type"`
+	Message        string      `json:"message"`
+
+	BudgetPeriod        string       `json:"budget_period,omitempty"`
+	BudgetAmount        *money.Money `json:"budget_amount,omitempty"`
+	PercentConsumed     float64      `json:"percent_consumed,omitempty"`
+	ProjectedExhaustion *time.Time   `json:"projected_exhaustion,omitempty"`
+
+	AdGroupID      string        `json:"ad_group_id,omitempty"`
+	AdGroupName    string        `json:"ad_group_name,omitempty"`
+	AdID           string        `json:"ad_id,omitempty"`
+	AdStrength     string        `json:"ad_strength,omitempty"`
+	Headlines      int           `json:"headlines,omitempty"`
+	Descriptions   int           `json:"descriptions,omitempty"`
+	AssetID        string        `json:"asset_id,omitempty"`
+	AssetFieldType string        `json:"asset_field_type,omitempty"`
+	AssetText      string        `json:"asset_text,omitempty"`
+	KeywordID      string        `json:"keyword_id,omitempty"`
+	KeywordText    string        `json:"keyword_text,omitempty"`
+	MatchType      string        `json:"match_type,omitempty"`
+	PolicyTopics   []PolicyTopic `json:"policy_topics,omitempty"`
+
+	SearchImpressionShare     float64      `json:"search_impression_share,omitempty"`
+	BudgetLostImpressionShare float64      `json:"budget_lost_impression_share,omitempty"`
+	RankLostImpressionShare   float64      `json:"rank_lost_impression_share,omitempty"`
+	RecommendedBudget         *money.Money `json:"recommended_budget,omitempty"`
+	BudgetIncrease            *money.Money `json:"budget_increase,omitempty"`
+
+	LandingPageURL         string   `json:"landing_page_url,omitempty"`
+	HTTPStatus             int      `json:"http_status,omitempty"`
+	RedirectChain          []string `json:"redirect_chain,omitempty"`
+	ResponseTimeMs         int64    `json:"response_time_ms,omitempty"`
+	CheckError             string   `json:"check_error,omitempty"`
+	MobilePerformanceScore float64  `json:"mobile_performance_score,omitempty"`
+	MobileIssues           []string `json:"mobile_issues,omitempty"`
+	AffectedAds            int      `json:"affected_ads,omitempty"`
+	AffectedKeywords       int      `json:"affected_keywords,omitempty"`
+	PausedAds              int      `json:"paused_ads,omitempty"`
+}
+
+// PolicyTopic is one policy finding behind a disapproval.
+type PolicyTopic struct {
+	Topic string `json:"topic"`
+	Type  string `json:"type,omitempty"`
+}
+
+// BidRecommendation mirrors BidOptimizationResult published by bid-optimizer.
+type BidRecommendation struct {
+	CustomerID       string       `json:"customer_id"`
+	CampaignID       string       `json:"campaign_id"`
+	CampaignName     string       `json:"campaign_name"`
+	AdGroupID        string       `json:"ad_group_id"`
+	AdGroupName      string       `json:"ad_group_name"`
+	KeywordID        string       `json:"keyword_id"`
+	KeywordText      string       `json:"keyword_text"`
+	CurrentBid       money.Money  `json:"current_bid"`
+	RecommendedBid   money.Money  `json:"recommended_bid"`
+	OptimizationType string       `json:"optimization_type"`
+	Reason           string       `json:"reason"`
+	ExpectedImpact   string       `json:"expected_impact"`
+	Revenue          *money.Money `json:"revenue,omitempty"`
+	Orders           int          `json:"orders,omitempty"`
+	ROAS             float64      `json:"roas,omitempty"`
+	ApprovalStatus   string       `json:"approval_status,omitempty"`
+	ApproveURL       string       `json:"approve_url,omitempty"`
+	RejectURL        string       `json:"reject_url,omitempty"`
+}
+
+// BidExport is a spreadsheet of a bid report's recommendations.
+// DownloadURL is presigned and stops working at ExpiresAt.
+type BidExport struct {
+	Format      string    `json:"format"`
+	URI         string    `json:"uri"`
+	DownloadURL string    `json:"download_url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Rows        int       `json:"rows"`
+}
+
+// Message is a channel-agnostic notification. Exactly one of Alert,
+// Recommendations, Digest, BudgetOrder, Group or Experiment is populated
+// depending on Kind. Exports accompany Recommendations.
+type Message struct {
+	Kind            string
+	Environment     string
+	Timestamp       time.Time
+	Alert           *CampaignAlert
+	Recommendations []BidRecommendation
+	Exports         []BidExport
+	Digest          *WeeklyDigest
+	BudgetOrder     *BudgetOrderAlert
+	Group           *AlertGroup
+	Experiment      *ExperimentReport
+}
+
+// RouteKey is the key used to look up channels for the message: the alert
+// type for campaign and budget order alerts, the inferred cause for alert
+// groups, and the kind for everything else.
+func (m Message) RouteKey() string {
+	if m.Kind == KindCampaignAlert && m.Alert != nil {
+		return m.Alert.AlertType
+	}
+	if m.Kind == KindBudgetOrderAlert && m.BudgetOrder != nil {
+		return m.BudgetOrder.AlertType
+	}
+	if m.Kind == KindAlertGroup && m.Group != nil {
+		return m.Group.Cause
+	}
+	return m.Kind
+}
+
+// Title is a one-line summary shared by all channels.
+func (m Message) Title() string {
+	switch m.Kind {
+	case KindCampaignAlert:
+		return fmt.Sprintf("Google Ads Alert: %s - %s", m.Alert.AlertType, m.Alert.CampaignName)
+	case KindBidReport:
+		return fmt.Sprintf("Google Ads Bid Optimization Report - %d Recommendations", len(m.Recommendations))
+	case KindWeeklyDigest:
+		return fmt.Sprintf("Google Ads Weekly Digest - Week of %s", m.Digest.WeekStart)
+	case KindBudgetOrderAlert:
+		return fmt.Sprintf("Google Ads Budget Order: %s - %s", m.BudgetOrder.AlertType, m.BudgetOrder.BudgetName)
+	case KindAlertGroup:
+		if m.Group.CampaignName != "" {
+			return fmt.Sprintf("Google Ads Alert: %s - %s", m.Group.Cause, m.Group.CampaignName)
+		}
+		return fmt.Sprintf("Google Ads Alert: %s - %d alerts", m.Group.Cause, len(m.Group.Alerts))
+	case KindExperimentReport:
+		return fmt.Sprintf("Google Ads Experiment Report: %s - %s to %s", m.Experiment.ExperimentID, m.Experiment.WindowStart, m.Experiment.WindowEnd)
+	default:
+		return "Google Ads Notification"
+	}
+}
+
+// Channel delivers a formatted message to one destination.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
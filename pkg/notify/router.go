@@ -0,0 +1,235 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"pkg/clock"
+)
+
+// DefaultRoute is used for alert types without an explicit route.
+const DefaultRoute = "default"
+
+// RoutingConfig is the JSON document stored in SSM. Channels are declared
+// once by name and referenced from routes, e.g.
+//
+//	{
+//	  "channels": {
+//	    "slack-ads": {"type": "slack", "webhook_url": "https://hooks.slack.com/..."},
+//	    "marketing": {"type": "email", "from": "ads@example.com", "to": ["team@example.com"]}
+//	  },
+//	  "routes": {"HIGH_COST_NO_CONVERSIONS": ["slack-ads", "marketing"], "default": ["marketing"]}
+//	}
+//
+// A channel may carry a schedule (see Schedule) holding back non-critical
+// messages outside its recipients' hours. Critical lists the route keys
+// that bypass schedules; DefaultCritical applies when it is omitted.
+type RoutingConfig struct {
+	Channels map[string]ChannelConfig `json:"channels"`
+	Routes   map[string][]string      `json:"routes"`
+	Critical []string                 `json:"critical,omitempty"`
+}
+
+type ChannelConfig struct {
+	Type       string    `json:"type"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	From       string    `json:"from,omitempty"`
+	To         []string  `json:"to,omitempty"`
+	Schedule   *Schedule `json:"schedule,omitempty"`
+}
+
+// Validate checks that every route references a declared channel.
+func (c RoutingConfig) Validate() error {
+	for name, ch := range c.Channels {
+		switch ch.Type {
+		case "slack":
+			if ch.WebhookURL == "" {
+				return fmt.Errorf("channel %s: webhook_url is required", name)
+			}
+		case "email":
+			if ch.From == "" || len(ch.To) == 0 {
+				return fmt.Errorf("channel %s: from and to are required", name)
+			}
+		default:
+			return fmt.Errorf("channel %s: unknown type %q", name, ch.Type)
+		}
+		if ch.Schedule != nil {
+			if err := ch.Schedule.Validate(); err != nil {
+				return fmt.Errorf("channel %s: schedule: %w", name, err)
+			}
+		}
+	}
+	for key, names := range c.Routes {
+		for _, name := range names {
+			if _, ok := c.Channels[name]; !ok {
+				return fmt.Errorf("route %s references unknown channel %s", key, name)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadRoutingConfig reads and validates the routing document from an SSM
+// parameter. The parameter is expected to be a SecureString since it holds
+// webhook URLs.
+func LoadRoutingConfig(ctx context.Context, client *ssm.Client, parameterName string) (RoutingConfig, error) {
+	resp, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(parameterName),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return RoutingConfig{}, fmt.Errorf("failed to get routing parameter: %w", err)
+	}
+
+	var cfg RoutingConfig
+	if err := json.Unmarshal([]byte(aws.ToString(resp.Parameter.Value)), &cfg); err != nil {
+		return RoutingConfig{}, fmt.Errorf("failed to unmarshal routing config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return RoutingConfig{}, fmt.Errorf("invalid routing config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Dispatcher sends messages to the channels routed for their alert type.
+type Dispatcher struct {
+	channels  map[string]Channel
+	routes    map[string][]string
+	schedules map[string]Schedule
+	critical  map[string]bool
+
+	deferrer Deferrer
+	clock    clock.Clock
+}
+
+// NewDispatcher builds channels from the routing config.
+func NewDispatcher(cfg RoutingConfig, sesClient *sesv2.Client) *Dispatcher {
+	channels := make(map[string]Channel, len(cfg.Channels))
+	schedules := make(map[string]Schedule)
+	for name, ch := range cfg.Channels {
+		switch ch.Type {
+		case "slack":
+			channels[name] = NewSlackChannel(name, ch.WebhookURL)
+		case "email":
+			channels[name] = NewEmailChannel(name, sesClient, ch.From, ch.To)
+		}
+		if ch.Schedule != nil {
+			schedules[name] = *ch.Schedule
+		}
+	}
+
+	critical := make(map[string]bool)
+	keys := cfg.Critical
+	if keys == nil {
+		keys = DefaultCritical
+	}
+	for _, key := range keys {
+		critical[key] = true
+	}
+
+	return &Dispatcher{channels: channels, routes: cfg.Routes, schedules: schedules, critical: critical, clock: clock.Real{}}
+}
+
+// WithDeferral enables channel schedules: non-critical messages outside a
+// channel's hours are handed to deferrer instead of sent. Without it
+// schedules are ignored and everything is delivered immediately.
+func (d *Dispatcher) WithDeferral(deferrer Deferrer, clk clock.Clock) *Dispatcher {
+	d.deferrer = deferrer
+	d.clock = clk
+	return d
+}
+
+// Severity is SeverityCritical for the configured critical route keys.
+func (d *Dispatcher) Severity(msg Message) string {
+	if d.critical[msg.RouteKey()] {
+		return SeverityCritical
+	}
+	return SeverityNormal
+}
+
+// ChannelsFor returns the channels a message should be delivered to.
+func (d *Dispatcher) ChannelsFor(msg Message) []Channel {
+	names, ok := d.routes[msg.RouteKey()]
+	if !ok {
+		names = d.routes[DefaultRoute]
+	}
+
+	var channels []Channel
+	for _, name := range names {
+		if ch, ok := d.channels[name]; ok {
+			channels = append(channels, ch)
+		}
+	}
+	return channels
+}
+
+// Dispatch delivers the message to every routed channel. A failing channel
+// does not prevent delivery to the others; all failures are returned joined.
+func (d *Dispatcher) Dispatch(ctx context.Context, msg Message) error {
+	channels := d.ChannelsFor(msg)
+	if len(channels) == 0 {
+		log.Printf("No notification channels routed for %s", msg.RouteKey())
+		return nil
+	}
+
+	critical := d.Severity(msg) == SeverityCritical
+	var errs []error
+	for _, ch := range channels {
+		if schedule, ok := d.schedules[ch.Name()]; ok && !critical && d.deferrer != nil {
+			if deliverAt, later := schedule.NextDelivery(d.clock.Now()); later {
+				if err := d.deferrer.Defer(ctx, ch.Name(), msg, deliverAt); err != nil {
+					errs = append(errs, fmt.Errorf("channel %s: %w", ch.Name(), err))
+					continue
+				}
+				log.Printf("Deferred %s notification to %s until %s", msg.RouteKey(), ch.Name(), deliverAt.Format(time.RFC3339))
+				continue
+			}
+		}
+
+		if err := ch.Send(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", ch.Name(), err))
+			continue
+		}
+		log.Printf("Delivered %s notification to %s", msg.RouteKey(), ch.Name())
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeliverDue sends every deferred message whose time has come, removing
+// each once its channel accepts it. Messages for channels removed from
+// the routing config are left to expire.
+func (d *Dispatcher) DeliverDue(ctx context.Context, store *DeferredStore) (int, error) {
+	now := d.clock.Now()
+	delivered := 0
+	var errs []error
+	for name, ch := range d.channels {
+		due, err := store.Due(ctx, name, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", name, err))
+			continue
+		}
+		for _, deferred := range due {
+			if err := ch.Send(ctx, deferred.Message); err != nil {
+				errs = append(errs, fmt.Errorf("channel %s: %w", name, err))
+				continue
+			}
+			if err := store.Remove(ctx, deferred); err != nil {
+				errs = append(errs, fmt.Errorf("channel %s: %w", name, err))
+				continue
+			}
+			delivered++
+			log.Printf("Delivered deferred %s notification to %s", deferred.Message.RouteKey(), name)
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
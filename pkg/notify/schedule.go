@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	// Lambda's runtime has no zoneinfo; embed it so schedules resolve.
+	_ "time/tzdata"
+)
+
+// Severities. Critical messages ignore quiet hours and delivery windows.
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityNormal   = "NORMAL"
+)
+
+// DefaultCritical are the route keys treated as critical when the routing
+// config does not list its own: money is being lost right now.
+var DefaultCritical = []string{
+	"BROKEN_LANDING_PAGE",
+	"BUDGET_EXHAUSTED",
+	"BUDGET_ORDER_EXHAUSTED",
+	"HIGH_COST_NO_CONVERSIONS",
+	"SPEND_SPIKE",
+	"TRACKING_OUTAGE",
+}
+
+// Schedule restricts when a channel receives non-critical messages, in
+// the recipient's time zone, e.g.
+//
+//	{
+//	  "timezone": "Europe/Berlin",
+//	  "quiet_hours": [{"start": "20:00", "end": "08:00"}],
+//	  "delivery_windows": [{"days": ["MON", "TUE", "WED", "THU", "FRI"], "start": "09:00", "end": "17:00"}]
+//	}
+//
+// A message arriving during quiet hours, or outside every delivery window
+// when any are set, is deferred to the next time both allow.
+type Schedule struct {
+	Timezone        string   `json:"timezone"`
+	QuietHours      []Window `json:"quiet_hours,omitempty"`
+	DeliveryWindows []Window `json:"delivery_windows,omitempty"`
+}
+
+// Window is a daily span of local time. End before Start spans midnight;
+// Days, if set, are the days the window starts on.
+type Window struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"SUN": time.Sunday, "MON": time.Monday, "TUE": time.Tuesday, "WED": time.Wednesday,
+	"THU": time.Thursday, "FRI": time.Friday, "SAT": time.Saturday,
+}
+
+// Validate checks the time zone, clock times and day names.
+func (s Schedule) Validate() error {
+	if _, err := time.LoadLocation(s.Timezone); err != nil || s.Timezone == "" {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	for _, w := range append(append([]Window{}, s.QuietHours...), s.DeliveryWindows...) {
+		start, err := clockMinutes(w.Start)
+		if err != nil {
+			return err
+		}
+		end, err := clockMinutes(w.End)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return fmt.Errorf("window %s-%s is empty", w.Start, w.End)
+		}
+		for _, day := range w.Days {
+			if _, ok := weekdays[strings.ToUpper(day)]; !ok {
+				return fmt.Errorf("unknown day %q", day)
+			}
+		}
+	}
+	return nil
+}
+
+// NextDelivery returns when a non-critical message arriving at now may be
+// delivered, and whether that is later than now.
+func (s Schedule) NextDelivery(now time.Time) (time.Time, bool) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return now, false
+	}
+	local := now.In(loc)
+	if s.allows(local) {
+		return now, false
+	}
+
+	// Delivery can only open up where a quiet period ends or a delivery
+	// window starts; try those over the next week in order.
+	var candidates []time.Time
+	for d := -1; d <= 7; d++ {
+		day := local.AddDate(0, 0, d)
+		for _, w := range s.QuietHours {
+			candidates = append(candidates, at(day, w.End, loc))
+		}
+		for _, w := range s.DeliveryWindows {
+			candidates = append(candidates, at(day, w.Start, loc))
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	for _, c := range candidates {
+		if c.After(local) && s.allows(c) {
+			return c.In(now.Location()), true
+		}
+	}
+
+	// A schedule that never allows delivery is a misconfiguration; don't
+	// hold messages forever.
+	return now, false
+}
+
+func (s Schedule) allows(t time.Time) bool {
+	for _, w := range s.QuietHours {
+		if w.contains(t) {
+			return false
+		}
+	}
+	if len(s.DeliveryWindows) == 0 {
+		return true
+	}
+	for _, w := range s.DeliveryWindows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether local time t falls in the window. For a window
+// spanning midnight the part after midnight belongs to the previous day.
+func (w Window) contains(t time.Time) bool {
+	start, err := clockMinutes(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := clockMinutes(w.End)
+	if err != nil {
+		return false
+	}
+	minutes := t.Hour()*60 + t.Minute()
+
+	if start < end {
+		return minutes >= start && minutes < end && w.onDay(t.Weekday())
+	}
+	if minutes >= start {
+		return w.onDay(t.Weekday())
+	}
+	if minutes < end {
+		return w.onDay((t.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+func (w Window) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, name := range w.Days {
+		if weekdays[strings.ToUpper(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// at returns the given HH:MM on day's date in loc.
+func at(day time.Time, hhmm string, loc *time.Location) time.Time {
+	minutes, _ := clockMinutes(hhmm)
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, loc)
+}
+
+func clockMinutes(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, fmt.Errorf("time %q must be HH:MM", hhmm)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,301 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxSlackRecommendations keeps bid reports under Slack's 50-block limit.
+const maxSlackRecommendations = 20
+
+// maxDigestCompetitorChanges keeps an account's competitor changes within
+// Slack's 3000 character section text.
+const maxDigestCompetitorChanges = 10
+
+// SlackBlock is a Block Kit layout block. Only the fields used by the
+// formatter are modelled.
+type SlackBlock struct {
+	Type   string      `json:"type"`
+	Text   *SlackText  `json:"text,omitempty"`
+	Fields []SlackText `json:"fields,omitempty"`
+	Elems  []SlackText `json:"elements,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type SlackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// SlackChannel posts Block Kit messages to an incoming webhook.
+type SlackChannel struct {
+	ChannelName string
+	WebhookURL  string
+	HTTPClient  *http.Client
+}
+
+func NewSlackChannel(name, webhookURL string) *SlackChannel {
+	return &SlackChannel{
+		ChannelName: name,
+		WebhookURL:  webhookURL,
+		HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *SlackChannel) Name() string { return c.ChannelName }
+
+func (c *SlackChannel) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(BuildSlackPayload(msg))
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to slack: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack webhook returned %d: %s", resp.StatusCode, detail)
+	}
+
+	return nil
+}
+
+// BuildSlackPayload renders a message as Block Kit blocks.
+func BuildSlackPayload(msg Message) SlackPayload {
+	payload := SlackPayload{
+		Text: msg.Title(),
+		Blocks: []SlackBlock{
+			{Type: "header", Text: &SlackText{Type: "plain_text", Text: msg.Title()}},
+		},
+	}
+
+	switch msg.Kind {
+	case KindCampaignAlert:
+		alert := msg.Alert
+		payload.Blocks = append(payload.Blocks,
+			SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: alert.Message}},
+			SlackBlock{Type: "section", Fields: []SlackText{
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Campaign*\n%s (%s)", alert.CampaignName, alert.CampaignID)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Customer*\n%s", alert.CustomerID)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Cost*\n%s", alert.Cost)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Conversions*\n%d", alert.Conversions)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*CTR*\n%.2f%%", alert.CTR*100)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*CPC*\n%s", alert.CPC)},
+			}},
+		)
+		if alert.AdGroupID != "" {
+			fields := []SlackText{
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Ad group*\n%s (%s)", alert.AdGroupName, alert.AdGroupID)},
+			}
+			if alert.AdID != "" {
+				fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Ad*\n%s", alert.AdID)})
+			}
+			if alert.KeywordID != "" {
+				fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Keyword*\n%s (%s)", alert.KeywordText, alert.MatchType)})
+			}
+			if alert.AdStrength != "" {
+				fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Ad strength*\n%s", alert.AdStrength)})
+			}
+			if alert.AssetText != "" {
+				fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", alert.AssetFieldType, alert.AssetText)})
+			}
+			payload.Blocks = append(payload.Blocks, SlackBlock{Type: "section", Fields: fields})
+		}
+		if alert.SearchImpressionShare > 0 {
+			fields := []SlackText{
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Impression share*\n%.0f%%", alert.SearchImpressionShare*100)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Lost to budget*\n%.0f%%", alert.BudgetLostImpressionShare*100)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Lost to rank*\n%.0f%%", alert.RankLostImpressionShare*100)},
+			}
+			if alert.RecommendedBudget != nil && alert.BudgetIncrease != nil {
+				fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Suggested budget*\n%s (+%s)", *alert.RecommendedBudget, *alert.BudgetIncrease)})
+			}
+			payload.Blocks = append(payload.Blocks, SlackBlock{Type: "section", Fields: fields})
+		}
+		if alert.LandingPageURL != "" {
+			status := alert.CheckError
+			if status == "" {
+				status = fmt.Sprintf("HTTP %d in %dms", alert.HTTPStatus, alert.ResponseTimeMs)
+			}
+			fields := []SlackText{
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Landing page*\n%s", alert.LandingPageURL)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Status*\n%s", status)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Used by*\n%d ads, %d keywords", alert.AffectedAds, alert.AffectedKeywords)},
+			}
+			if len(alert.RedirectChain) > 0 {
+				fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Redirects*\n%s", strings.Join(alert.RedirectChain, " → "))})
+			}
+			if alert.MobilePerformanceScore > 0 {
+				fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Mobile performance*\n%.0f", alert.MobilePerformanceScore*100)})
+			}
+			if alert.PausedAds > 0 {
+				fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Ads paused*\n%d", alert.PausedAds)})
+			}
+			payload.Blocks = append(payload.Blocks, SlackBlock{Type: "section", Fields: fields})
+		}
+		if len(alert.PolicyTopics) > 0 {
+			var topics []string
+			for _, t := range alert.PolicyTopics {
+				line := fmt.Sprintf("• `%s`", t.Topic)
+				if t.Type != "" {
+					line += fmt.Sprintf(" (%s)", t.Type)
+				}
+				topics = append(topics, line)
+			}
+			payload.Blocks = append(payload.Blocks, SlackBlock{
+				Type: "section",
+				Text: &SlackText{Type: "mrkdwn", Text: "*Policy topics*\n" + strings.Join(topics, "\n")},
+			})
+		}
+	case KindBidReport:
+		for i, rec := range msg.Recommendations {
+			if i == maxSlackRecommendations {
+				payload.Blocks = append(payload.Blocks, SlackBlock{
+					Type:  "context",
+					Elems: []SlackText{{Type: "mrkdwn", Text: fmt.Sprintf("…and %d more recommendations", len(msg.Recommendations)-i)}},
+				})
+				break
+			}
+			text := fmt.Sprintf("*%s* `%s` — %s\n%s → %s · %s",
+				rec.OptimizationType, rec.KeywordText, rec.CampaignName, rec.CurrentBid, rec.RecommendedBid, rec.Reason)
+			if rec.ApproveURL != "" {
+				text += fmt.Sprintf("\n<%s|Approve> · <%s|Reject>", rec.ApproveURL, rec.RejectURL)
+			} else if rec.ApprovalStatus != "" {
+				text += "\n_" + strings.ToLower(rec.ApprovalStatus) + "_"
+			}
+			payload.Blocks = append(payload.Blocks, SlackBlock{
+				Type: "section",
+				Text: &SlackText{Type: "mrkdwn", Text: text},
+			})
+		}
+		if len(msg.Exports) > 0 {
+			var links []string
+			for _, export := range msg.Exports {
+				links = append(links, fmt.Sprintf("<%s|%s>", export.DownloadURL, strings.ToUpper(export.Format)))
+			}
+			payload.Blocks = append(payload.Blocks, SlackBlock{
+				Type:  "context",
+				Elems: []SlackText{{Type: "mrkdwn", Text: fmt.Sprintf("Download all %d recommendations: %s (links expire %s)", msg.Exports[0].Rows, strings.Join(links, " · "), msg.Exports[0].ExpiresAt.UTC().Format("2006-01-02 15:04 MST"))}},
+			})
+		}
+	case KindBudgetOrderAlert:
+		order := msg.BudgetOrder
+		fields := []SlackText{
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Budget order*\n%s (%s)", order.BudgetName, order.BudgetID)},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Customer*\n%s", order.CustomerID)},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Served*\n%.2f of %.2f %s", order.AmountServed, order.SpendingLimit, order.Currency)},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Remaining*\n%.2f %s (%.0f%% used)", order.Remaining, order.Currency, order.PercentConsumed)},
+		}
+		if order.PurchaseOrderNumber != "" {
+			fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*PO number*\n%s", order.PurchaseOrderNumber)})
+		}
+		if order.EndDate != nil {
+			fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Ends*\n%s", order.EndDate.Format("2006-01-02"))})
+		}
+		payload.Blocks = append(payload.Blocks,
+			SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: order.Message}},
+			SlackBlock{Type: "section", Fields: fields},
+		)
+	case KindAlertGroup:
+		group := msg.Group
+		payload.Blocks = append(payload.Blocks,
+			SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: group.Message}},
+			SlackBlock{Type: "context", Elems: []SlackText{{Type: "mrkdwn", Text: fmt.Sprintf("Customer %s · %d related alerts", group.CustomerID, len(group.Alerts))}}},
+		)
+		listed, more := group.Listed()
+		for _, alert := range listed {
+			payload.Blocks = append(payload.Blocks, SlackBlock{
+				Type: "section",
+				Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s* %s (%s)\n%s", alert.AlertType, alert.CampaignName, alert.CampaignID, alert.Message)},
+			})
+		}
+		if more > 0 {
+			payload.Blocks = append(payload.Blocks, SlackBlock{
+				Type:  "context",
+				Elems: []SlackText{{Type: "mrkdwn", Text: fmt.Sprintf("…and %d more alerts", more)}},
+			})
+		}
+	case KindWeeklyDigest:
+		for _, account := range msg.Digest.Hygiene {
+			text := fmt.Sprintf("*%s* (%s)\nHygiene score *%.0f*/100 %s", account.AccountName, account.CustomerID, account.Score, account.Sparkline())
+			if account.PreviousScore != nil {
+				text += fmt.Sprintf(" (%+.0f vs last week)", account.Delta())
+			}
+			var fields []SlackText
+			for _, check := range account.Checks {
+				if check.Issues > 0 {
+					fields = append(fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%d issues (−%.0f)", check.Name, check.Issues, check.Penalty)})
+				}
+			}
+			block := SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: text}}
+			if len(fields) > 0 {
+				// Slack allows at most 10 fields per section.
+				if len(fields) > 10 {
+					fields = fields[:10]
+				}
+				block.Fields = fields
+			}
+			payload.Blocks = append(payload.Blocks, block)
+		}
+		for _, account := range msg.Digest.Competitors {
+			text := fmt.Sprintf("*%s* (%s)\nAuction insights %s to %s: %d competitors", account.AccountName, account.CustomerID, account.WindowStart, account.WindowEnd, account.Competitors)
+			if len(account.Changes) == 0 {
+				text += ", no significant changes"
+			}
+			for i, change := range account.Changes {
+				if i == maxDigestCompetitorChanges {
+					text += fmt.Sprintf("\n…and %d more changes", len(account.Changes)-i)
+					break
+				}
+				text += "\n• " + change.String()
+			}
+			payload.Blocks = append(payload.Blocks, SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: text}})
+		}
+	case KindExperimentReport:
+		report := msg.Experiment
+		fields := []SlackText{
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Treatment*\n%d campaigns · %.0f conv · CPA %s", report.Treatment.Campaigns, report.Treatment.Conversions, report.Treatment.CPA)},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Control*\n%d campaigns · %.0f conv · CPA %s", report.Control.Campaigns, report.Control.Conversions, report.Control.CPA)},
+		}
+		if report.ConversionRateLift != nil {
+			fields = append(fields, SlackText{Type: "mrkdwn", Text: "*Conversion rate lift*\n" + report.ConversionRateLift.String()})
+		}
+		if report.CPADelta != nil {
+			fields = append(fields, SlackText{Type: "mrkdwn", Text: "*CPA change*\n" + report.CPADelta.String()})
+		}
+		payload.Blocks = append(payload.Blocks, SlackBlock{Type: "section", Fields: fields})
+		if report.ReportURI != "" {
+			payload.Blocks = append(payload.Blocks, SlackBlock{
+				Type:  "context",
+				Elems: []SlackText{{Type: "mrkdwn", Text: "Full report: " + report.ReportURI}},
+			})
+		}
+	}
+
+	payload.Blocks = append(payload.Blocks, SlackBlock{
+		Type:  "context",
+		Elems: []SlackText{{Type: "mrkdwn", Text: fmt.Sprintf("Environment: %s · %s", msg.Environment, msg.Timestamp.Format(time.RFC3339))}},
+	})
+
+	return payload
+}
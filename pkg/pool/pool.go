@@ -0,0 +1,49 @@
+// Package pool runs independent pieces of work over a bounded number of
+// goroutines, and paces the calls they make to a rate-limited API so the
+// extra concurrency does not turn into quota errors.
+package pool
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Each calls fn for every item, with at most limit calls running at once;
+// a limit below 1 runs them one at a time. The first error cancels the
+// context of the calls still running, stops new ones from starting and is
+// returned once all have finished. Callers that must process every item
+// whatever happens to the others handle the item's error inside fn.
+func Each[T any](ctx context.Context, limit int, items []T, fn func(ctx context.Context, item T) error) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(limit, 1))
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		item := item
+		g.Go(func() error {
+			return fn(ctx, item)
+		})
+	}
+	return g.Wait()
+}
+
+// Run calls each fn with at most limit running at once, with the same
+// cancellation as Each.
+func Run(ctx context.Context, limit int, fns ...func(ctx context.Context) error) error {
+	return Each(ctx, limit, fns, func(ctx context.Context, fn func(context.Context) error) error {
+		return fn(ctx)
+	})
+}
+
+// LimitFromEnv reads a concurrency limit from the environment variable
+// key, falling back to def when it is unset or not a positive integer.
+func LimitFromEnv(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
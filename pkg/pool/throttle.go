@@ -0,0 +1,100 @@
+package pool
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"pkg/clock"
+)
+
+// Throttle paces the calls of every goroutine sharing it to at most a set
+// rate, and stops them all for a cooldown once one is told the API is
+// pushing back, rather than letting each retry into the same limit. Slots
+// are kept on its clock; a Manual clock is moved on to the caller's slot
+// rather than slept on, so test runs are paced without waiting. A nil
+// Throttle does not pace.
+type Throttle struct {
+	interval time.Duration
+	cooldown time.Duration
+	clk      clock.Clock
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewThrottle returns a Throttle allowing perSecond calls a second; zero
+// or less leaves calls unpaced, but still observes cooldowns.
+func NewThrottle(perSecond float64, cooldown time.Duration, clk clock.Clock) *Throttle {
+	t := &Throttle{cooldown: cooldown, clk: clk}
+	if perSecond > 0 {
+		t.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return t
+}
+
+// GoogleAdsThrottleFromEnv paces Google Ads calls to GOOGLE_ADS_MAX_QPS
+// requests a second (default 10) and pauses them for
+// GOOGLE_ADS_RATE_LIMIT_COOLDOWN (a Go duration, default 10s) after a
+// rate limit error. The API's limits are per developer token, so every
+// worker of a function shares one Throttle.
+func GoogleAdsThrottleFromEnv(clk clock.Clock) *Throttle {
+	qps := 10.0
+	if f, err := strconv.ParseFloat(os.Getenv("GOOGLE_ADS_MAX_QPS"), 64); err == nil && f >= 0 {
+		qps = f
+	}
+	cooldown := 10 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("GOOGLE_ADS_RATE_LIMIT_COOLDOWN")); err == nil && d >= 0 {
+		cooldown = d
+	}
+	return NewThrottle(qps, cooldown, clk)
+}
+
+// Wait blocks until the caller may make its call, or ctx is done. Each
+// caller reserves the next free slot, so waiting callers go in turn.
+func (t *Throttle) Wait(ctx context.Context) error {
+	if t == nil {
+		return ctx.Err()
+	}
+	t.mu.Lock()
+	now := t.clk.Now()
+	slot := t.next
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next = slot.Add(t.interval)
+	if manual, ok := t.clk.(*clock.Manual); ok {
+		manual.Advance(slot.Sub(now))
+		t.mu.Unlock()
+		return ctx.Err()
+	}
+	t.mu.Unlock()
+
+	d := slot.Sub(t.clk.Now())
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Backoff holds off every call that has not reserved a slot yet for the
+// cooldown; calls already waiting keep their slots.
+func (t *Throttle) Backoff() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if resume := t.clk.Now().Add(t.cooldown); resume.After(t.next) {
+		t.next = resume
+	}
+}
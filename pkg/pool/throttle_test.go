@@ -0,0 +1,131 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pkg/clock"
+)
+
+var start = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// step is one thing done to a throttle: a call waiting its turn, a rate
+// limit error, or time passing.
+type step struct {
+	wait    bool
+	backoff bool
+	advance time.Duration
+}
+
+var (
+	wait    = step{wait: true}
+	backoff = step{backoff: true}
+)
+
+func after(d time.Duration) step { return step{advance: d} }
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		name      string
+		perSecond float64
+		cooldown  time.Duration
+		steps     []step
+		// want is when, after the start, each waiting call was let through.
+		want []time.Duration
+	}{
+		{
+			name:      "spaces calls by the interval",
+			perSecond: 10,
+			steps:     []step{wait, wait, wait},
+			want:      []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name:      "does not bank unused slots",
+			perSecond: 10,
+			steps:     []step{wait, after(time.Second), wait, wait},
+			want:      []time.Duration{0, time.Second, 1100 * time.Millisecond},
+		},
+		{
+			name:  "leaves calls unpaced without a rate",
+			steps: []step{wait, wait, wait},
+			want:  []time.Duration{0, 0, 0},
+		},
+		{
+			name:      "holds calls off for the cooldown",
+			perSecond: 10,
+			cooldown:  10 * time.Second,
+			steps:     []step{wait, backoff, wait, wait},
+			want:      []time.Duration{0, 10 * time.Second, 10100 * time.Millisecond},
+		},
+		{
+			name:     "cools down even when unpaced",
+			cooldown: 10 * time.Second,
+			steps:    []step{backoff, wait, wait},
+			want:     []time.Duration{10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:      "extends the cooldown on another rate limit",
+			perSecond: 10,
+			cooldown:  10 * time.Second,
+			steps:     []step{backoff, after(4 * time.Second), backoff, wait},
+			want:      []time.Duration{14 * time.Second},
+		},
+		{
+			name:      "keeps slots reserved past the cooldown",
+			perSecond: 1,
+			cooldown:  time.Second,
+			steps:     []step{wait, wait, wait, wait, after(-3 * time.Second), backoff, wait},
+			want:      []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewManual(start, 0)
+			throttle := NewThrottle(tt.perSecond, tt.cooldown, clk)
+
+			var got []time.Duration
+			for _, s := range tt.steps {
+				switch {
+				case s.wait:
+					if err := throttle.Wait(context.Background()); err != nil {
+						t.Fatalf("Wait: %v", err)
+					}
+					got = append(got, clk.Now().Sub(start))
+				case s.backoff:
+					throttle.Backoff()
+				default:
+					clk.Advance(s.advance)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("let calls through at %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("let calls through at %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestThrottleWaitStopsWithContext(t *testing.T) {
+	throttle := NewThrottle(0, time.Hour, clock.Real{})
+	throttle.Backoff()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := throttle.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestNilThrottleDoesNotPace(t *testing.T) {
+	var throttle *Throttle
+	throttle.Backoff()
+	if err := throttle.Wait(context.Background()); err != nil {
+		t.Errorf("Wait = %v, want nil", err)
+	}
+}
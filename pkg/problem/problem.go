@@ -0,0 +1,89 @@
+// Package problem writes RFC 7807 application/problem+json error bodies.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pkg/validate"
+)
+
+// ContentType is the media type for problem details.
+const ContentType = "application/problem+json"
+
+// Problem types used across services. Generic HTTP errors use about:blank,
+// whose title is the status text.
+const (
+	TypeBlank      = "about:blank"
+	TypeValidation = "/problems/validation-error"
+	TypeMalformed  = "/problems/malformed-request"
+)
+
+// Problem is an RFC 7807 problem details object. Errors is the extension
+// member carrying field-level validation failures.
+type Problem struct {
+	Type     string                `json:"type"`
+	Title    string                `json:"title"`
+	Status   int                   `json:"status"`
+	Detail   string                `json:"detail,omitempty"`
+	Instance string                `json:"instance,omitempty"`
+	Errors   []validate.FieldError `json:"errors,omitempty"`
+}
+
+// Error lets helpers return a Problem as an error for the handler to write.
+func (p Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// New returns an about:blank problem for status.
+func New(status int, detail string) Problem {
+	return Problem{
+		Type:   TypeBlank,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Malformed is returned when the body cannot be decoded at all.
+func Malformed(detail string) Problem {
+	return Problem{
+		Type:   TypeMalformed,
+		Title:  "Malformed request body",
+		Status: http.StatusBadRequest,
+		Detail: detail,
+	}
+}
+
+// Validation converts a validate.Struct error into a 422 problem. Other
+// errors are reported as the problem detail.
+func Validation(err error) Problem {
+	p := Problem{
+		Type:   TypeValidation,
+		Title:  "Request validation failed",
+		Status: http.StatusUnprocessableEntity,
+	}
+	var fieldErrs validate.Errors
+	if errors.As(err, &fieldErrs) {
+		p.Detail = "One or more fields are invalid."
+		p.Errors = fieldErrs
+	} else {
+		p.Detail = err.Error()
+	}
+	return p
+}
+
+// Write sends p, filling Instance from the request path when unset.
+func Write(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
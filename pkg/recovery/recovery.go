@@ -0,0 +1,182 @@
+// Package recovery keeps a panic in one request or background job from
+// taking the whole service down. Recovered panics are logged with their
+// stack and request context under a reference ID that is also returned to
+// the client, and counted as a CloudWatch metric.
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"pkg/clock"
+	"pkg/ids"
+	"pkg/problem"
+)
+
+// Namespace and name of the crash metric, one series per service.
+const (
+	MetricNamespace = "Ecommerce/Services"
+	MetricName      = "Panics"
+)
+
+// ReferenceHeader carries the reference ID on 500 responses.
+const ReferenceHeader = "X-Error-Reference"
+
+// contextHeaders are request headers worth logging with a panic. Bodies
+// and credentials are never logged.
+var contextHeaders = []string{"X-Request-Id", "X-Amzn-Trace-Id", "Idempotency-Key", "User-Agent"}
+
+// Recoverer recovers panics for one service.
+type Recoverer struct {
+	Service string
+	Clock   clock.Clock
+	IDs     ids.Generator
+	// Metrics receives one CloudWatch embedded metric format line per
+	// panic; CloudWatch Logs turns these into the Panics metric without
+	// an API call. Defaults to stdout, which ECS and Lambda ship to logs.
+	Metrics io.Writer
+
+	panics atomic.Int64
+}
+
+// New returns a Recoverer for service writing metrics to stdout.
+func New(service string, clk clock.Clock, idGen ids.Generator) *Recoverer {
+	return &Recoverer{Service: service, Clock: clk, IDs: idGen, Metrics: os.Stdout}
+}
+
+// Panics returns how many panics have been recovered since start.
+func (rc *Recoverer) Panics() int64 {
+	return rc.panics.Load()
+}
+
+// Middleware turns a handler panic into a 500 problem carrying the
+// reference ID. If the handler had already started its response, the
+// status cannot change; the panic is still logged and counted. It should
+// be the outermost middleware so panics in other middleware are caught.
+func (rc *Recoverer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// ErrAbortHandler is net/http's deliberate way to drop a
+			// connection, not a crash.
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			ref := rc.report(v, fmt.Sprintf("%s %s", r.Method, r.URL.Path), requestContext(r))
+			if tw.wroteHeader {
+				return
+			}
+			w.Header().Set(ReferenceHeader, ref)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError,
+				"An unexpected error occurred. Quote reference "+ref+" when reporting it."))
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+// Go runs fn in a goroutine, recovering and reporting a panic instead of
+// crashing the process. A long-running loop that should survive a panic
+// must recover per iteration with Do.
+func (rc *Recoverer) Go(name string, fn func()) {
+	go rc.Do(name, fn)
+}
+
+// Do runs fn, recovering and reporting a panic. It reports whether fn
+// returned normally.
+func (rc *Recoverer) Do(name string, fn func()) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			rc.report(v, name, "")
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
+
+// report logs the panic and emits the metric, returning the reference ID.
+func (rc *Recoverer) report(v interface{}, where, details string) string {
+	rc.panics.Add(1)
+	ref := rc.IDs.NewID()
+	log.Printf("PANIC ref=%s service=%s in %s: %v%s\n%s", ref, rc.Service, where, v, details, debug.Stack())
+
+	line, err := json.Marshal(map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": rc.Clock.Now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  MetricNamespace,
+				"Dimensions": [][]string{{"Service"}},
+				"Metrics":    []map[string]string{{"Name": MetricName, "Unit": "Count"}},
+			}},
+		},
+		"Service":   rc.Service,
+		MetricName:  1,
+		"Reference": ref,
+		"Where":     where,
+	})
+	if err == nil && rc.Metrics != nil {
+		fmt.Fprintln(rc.Metrics, string(line))
+	}
+	return ref
+}
+
+func requestContext(r *http.Request) string {
+	details := " remote=" + r.RemoteAddr
+	// Query values can carry personal data; their names are enough to
+	// reproduce most crashes.
+	if query := r.URL.Query(); len(query) > 0 {
+		names := make([]string, 0, len(query))
+		for name := range query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		details += " query=" + strings.Join(names, ",")
+	}
+	for _, name := range contextHeaders {
+		if value := r.Header.Get(name); value != "" {
+			details += " " + name + "=" + value
+		}
+	}
+	return details
+}
+
+// trackingWriter records whether the response has started. Flush and
+// Unwrap keep streaming handlers and http.ResponseController working.
+type trackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *trackingWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *trackingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *trackingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+func (w *trackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,119 @@
+// Package retry runs calls that fail transiently again with capped
+// exponential backoff and jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Policy configures Do. The zero value makes a single attempt.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// BaseDelay is the wait before the second attempt; each later wait
+	// doubles, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter is the fraction of each wait, between 0 and 1, that is
+	// randomised so callers that failed together do not retry together.
+	// 1 is "full jitter": a wait anywhere between 0 and the backoff.
+	Jitter float64
+	// Retryable reports whether an error is worth another attempt. Nil
+	// retries every error.
+	Retryable func(error) bool
+	// OnRetry is called before each wait with the attempt that failed,
+	// its error and the wait, for logging and metrics.
+	OnRetry func(attempt int, err error, delay time.Duration)
+	// Sleep waits for d or until ctx is done; defaults to a timer. Tests
+	// replace it to run without waiting.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Permanent wraps an error so Do returns it without retrying, whatever
+// Retryable says.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Do calls fn until it succeeds, returns a non-retryable error, the
+// attempts run out or ctx is done, and returns the number of attempts
+// made with the last error. Cancellation of ctx is never retried.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) (int, error) {
+	sleep := p.Sleep
+	if sleep == nil {
+		sleep = wait
+	}
+
+	attempt := 0
+	for {
+		attempt++
+		err := fn(ctx)
+		if err == nil {
+			return attempt, nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return attempt, permanent.err
+		}
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return attempt, err
+		}
+		if attempt >= p.MaxAttempts || (p.Retryable != nil && !p.Retryable(err)) {
+			return attempt, err
+		}
+
+		delay := p.Backoff(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+		if serr := sleep(ctx, delay); serr != nil {
+			return attempt, err
+		}
+	}
+}
+
+// Backoff returns the wait after the given failed attempt, counted from 1.
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	jitter := p.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 {
+		delay -= time.Duration(jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
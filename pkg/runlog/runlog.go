@@ -0,0 +1,466 @@
+// Package runlog records each scheduled Google Ads run together with a
+// snapshot of the exact configuration it applied, so a past alert or bid
+// recommendation can be traced to the rule set and thresholds behind it
+// and reproduced. Runs also checkpoint the accounts they have processed,
+// so a retried or resumed run skips them.
+package runlog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/ids"
+)
+
+// Run statuses. A run stays RUNNING if the function timed out before
+// finishing.
+const (
+	StatusRunning   = "RUNNING"
+	StatusSucceeded = "SUCCEEDED"
+	StatusPartial   = "PARTIAL"
+	StatusFailed    = "FAILED"
+)
+
+// retention is how long run records are kept for audit.
+const retention = 400 * 24 * time.Hour
+
+// InvocationIndex is the runs table index on invocation_id.
+const InvocationIndex = "invocation_id-index"
+
+// ErrNotFound is returned by Lookup when no run matches.
+var ErrNotFound = errors.New("run not found")
+
+// Snapshot is the configuration a run applied. RuleSetVersion names the
+// decision logic; it is bumped whenever the rules change, since the same
+// thresholds mean something different under different rules.
+type Snapshot struct {
+	RuleSetVersion string             `json:"rule_set_version" dynamodbav:"rule_set_version"`
+	Thresholds     map[string]float64 `json:"thresholds" dynamodbav:"thresholds"`
+	Goals          map[string]float64 `json:"goals,omitempty" dynamodbav:"goals,omitempty"`
+	FeatureFlags   map[string]bool    `json:"feature_flags,omitempty" dynamodbav:"feature_flags,omitempty"`
+	// RuleDocuments are declarative rules the run loaded, by name, each
+	// encoded canonically so a changed document changes the hash.
+	RuleDocuments map[string]string `json:"rule_documents,omitempty" dynamodbav:"rule_documents,omitempty"`
+}
+
+// Hash identifies the snapshot's content: two runs with the same hash
+// applied identical configuration. encoding/json sorts map keys, so the
+// encoding is canonical.
+func (s Snapshot) Hash() string {
+	encoded, _ := json.Marshal(s)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Run is one invocation of a scheduled function. Run IDs are time-ordered,
+// so a function's runs sort newest first by querying in reverse.
+type Run struct {
+	Function       string     `json:"function" dynamodbav:"function"`
+	RunID          string     `json:"run_id" dynamodbav:"run_id"`
+	Environment    string     `json:"environment" dynamodbav:"environment"`
+	Status         string     `json:"status" dynamodbav:"status"`
+	Error          string     `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	StartedAt      time.Time  `json:"started_at" dynamodbav:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty" dynamodbav:"finished_at,omitempty"`
+	Accounts       int        `json:"accounts" dynamodbav:"accounts"`
+	AccountsDone   int        `json:"accounts_done,omitempty" dynamodbav:"accounts_done,omitempty"`
+	AccountsFailed int        `json:"accounts_failed" dynamodbav:"accounts_failed"`
+	Results        int        `json:"results" dynamodbav:"results"`
+	Config         Snapshot   `json:"config" dynamodbav:"config"`
+	ConfigHash     string     `json:"config_hash" dynamodbav:"config_hash"`
+	ExpiresAt      int64      `json:"-" dynamodbav:"expires_at"`
+
+	// Mode is the event mode the run was started with, so a resumed run
+	// does the same work.
+	Mode string `json:"mode,omitempty" dynamodbav:"mode,omitempty"`
+	// InvocationID is the Lambda request ID of the invocation that started
+	// the run. Lambda keeps it when it retries an asynchronous invocation,
+	// which is how a retry finds the run to resume.
+	InvocationID string `json:"invocation_id,omitempty" dynamodbav:"invocation_id,omitempty"`
+	// Attempts counts the invocations that worked on the run.
+	Attempts int `json:"attempts,omitempty" dynamodbav:"attempts,omitempty"`
+	// CustomerIDs is the run's account rotation. Processed holds the
+	// accounts finished so far and Failed those whose last attempt failed;
+	// the rest are pending.
+	CustomerIDs []string `json:"customer_ids,omitempty" dynamodbav:"customer_ids,stringset,omitempty"`
+	Processed   []string `json:"processed,omitempty" dynamodbav:"processed,stringset,omitempty"`
+	Failed      []string `json:"failed,omitempty" dynamodbav:"failed,stringset,omitempty"`
+}
+
+// Done reports whether the account was processed by this run.
+func (r *Run) Done(customerID string) bool {
+	for _, id := range r.Processed {
+		if id == customerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending returns the rotation's accounts not processed yet, failed ones
+// included, in customer ID order.
+func (r *Run) Pending() []string {
+	var pending []string
+	for _, id := range r.CustomerIDs {
+		if !r.Done(id) {
+			pending = append(pending, id)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// Envelope type and schema version of Failure messages.
+const (
+	FailureMessageType   = "run_failure"
+	FailureSchemaVersion = 1
+)
+
+// Failure reports a run that finished without processing every account,
+// for the failures queue. Resume is the event that continues the run with
+// the accounts that are still pending.
+type Failure struct {
+	Function     string            `json:"function"`
+	RunID        string            `json:"run_id"`
+	InvocationID string            `json:"invocation_id,omitempty"`
+	Mode         string            `json:"mode,omitempty"`
+	Status       string            `json:"status"`
+	Error        string            `json:"error,omitempty"`
+	Attempts     int               `json:"attempts"`
+	Processed    []string          `json:"processed"`
+	Failed       []string          `json:"failed"`
+	Pending      []string          `json:"pending"`
+	Resume       map[string]string `json:"resume"`
+}
+
+// NewFailure describes the run's progress as a Failure.
+func NewFailure(run *Run) Failure {
+	processed := append([]string{}, run.Processed...)
+	failed := append([]string{}, run.Failed...)
+	sort.Strings(processed)
+	sort.Strings(failed)
+	pending := run.Pending()
+	if pending == nil {
+		pending = []string{}
+	}
+	return Failure{
+		Function:     run.Function,
+		RunID:        run.RunID,
+		InvocationID: run.InvocationID,
+		Mode:         run.Mode,
+		Status:       run.Status,
+		Error:        run.Error,
+		Attempts:     run.Attempts,
+		Processed:    processed,
+		Failed:       failed,
+		Pending:      pending,
+		Resume:       map[string]string{"resume_run": run.RunID},
+	}
+}
+
+// Recorder writes runs to a DynamoDB table with hash key function and
+// range key run_id.
+type Recorder struct {
+	client *dynamodb.Client
+	table  string
+	clock  clock.Clock
+	ids    ids.Generator
+}
+
+func NewRecorder(client *dynamodb.Client, table string, clk clock.Clock, gen ids.Generator) *Recorder {
+	return &Recorder{client: client, table: table, clock: clk, ids: gen}
+}
+
+// Start records a RUNNING run with its configuration snapshot, the mode
+// it runs in and the Lambda request ID of its invocation, if any.
+func (r *Recorder) Start(ctx context.Context, function, environment string, config Snapshot, mode, invocationID string) (*Run, error) {
+	now := r.clock.Now()
+	run := &Run{
+		Function:     function,
+		RunID:        r.ids.NewID(),
+		Environment:  environment,
+		Status:       StatusRunning,
+		StartedAt:    now,
+		Config:       config,
+		ConfigHash:   config.Hash(),
+		ExpiresAt:    now.Add(retention).Unix(),
+		Mode:         mode,
+		InvocationID: invocationID,
+		Attempts:     1,
+	}
+	if err := r.put(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Lookup returns the function's run with the given run ID or, failing
+// that, the one started by the invocation with that Lambda request ID, as
+// found in failure records. It returns ErrNotFound when neither exists.
+func (r *Recorder) Lookup(ctx context.Context, function, id string) (*Run, error) {
+	run, err := r.get(ctx, function, id)
+	if !errors.Is(err, ErrNotFound) {
+		return run, err
+	}
+
+	out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.table),
+		IndexName:              aws.String(InvocationIndex),
+		KeyConditionExpression: aws.String("invocation_id = :invocation_id"),
+		FilterExpression:       aws.String("#function = :function"),
+		ExpressionAttributeNames: map[string]string{
+			"#function": "function",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":invocation_id": &types.AttributeValueMemberS{Value: id},
+			":function":      &types.AttributeValueMemberS{Value: function},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs by invocation: %w", err)
+	}
+	if len(out.Items) == 0 {
+		return nil, ErrNotFound
+	}
+	var key struct {
+		RunID string `dynamodbav:"run_id"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Items[0], &key); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run key: %w", err)
+	}
+	return r.get(ctx, function, key.RunID)
+}
+
+// Resume records another attempt at a run. Failed accounts are cleared,
+// since the attempt retries them along with the pending ones; processed
+// accounts count as done.
+func (r *Recorder) Resume(ctx context.Context, run *Run) error {
+	run.Status = StatusRunning
+	run.Error = ""
+	run.FinishedAt = nil
+	run.Attempts++
+	run.Failed = nil
+	run.AccountsFailed = 0
+	run.AccountsDone = len(run.Processed)
+	return r.put(ctx, run)
+}
+
+// Plan records the accounts the run is to process, so what is still
+// pending is known if it stops partway.
+func (r *Recorder) Plan(ctx context.Context, run *Run, customerIDs []string) error {
+	run.CustomerIDs = customerIDs
+	run.Accounts = len(customerIDs)
+	return r.put(ctx, run)
+}
+
+// Checkpoint records that an account of a run in progress was processed,
+// or failed when accountErr is set, so a later attempt skips or retries
+// it. The sets are updated in place rather than rewritten, so workers of
+// the same run do not lose each other's accounts.
+func (r *Recorder) Checkpoint(ctx context.Context, run *Run, customerID string, accountErr error) error {
+	update := "ADD #processed :id DELETE #failed :id"
+	if accountErr != nil {
+		update = "ADD #failed :id"
+	}
+	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(r.table),
+		Key:                      runKey(run.Function, run.RunID),
+		UpdateExpression:         aws.String(update),
+		ConditionExpression:      aws.String("attribute_exists(run_id)"),
+		ExpressionAttributeNames: setNames(accountErr),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberSS{Value: []string{customerID}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint account %s of run %s: %w", customerID, run.RunID, err)
+	}
+
+	if accountErr != nil {
+		run.Failed = appendUnique(run.Failed, customerID)
+		return nil
+	}
+	run.Processed = appendUnique(run.Processed, customerID)
+	for i, id := range run.Failed {
+		if id == customerID {
+			run.Failed = append(run.Failed[:i], run.Failed[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Finish records the run's outcome. runErr is the error the function is
+// about to return; failed accounts without one make the run PARTIAL.
+func (r *Recorder) Finish(ctx context.Context, run *Run, runErr error) error {
+	now := r.clock.Now()
+	run.FinishedAt = &now
+	switch {
+	case runErr != nil:
+		run.Status = StatusFailed
+		run.Error = runErr.Error()
+	case run.AccountsFailed > 0:
+		run.Status = StatusPartial
+	default:
+		run.Status = StatusSucceeded
+	}
+	return r.put(ctx, run)
+}
+
+// Dispatch records that the run's Accounts have been handed to workers,
+// which report back through FinishAccount; the run stays RUNNING until
+// the last of them does. A run without accounts is finished at once.
+func (r *Recorder) Dispatch(ctx context.Context, run *Run) error {
+	if run.Accounts == 0 {
+		return r.Finish(ctx, run, nil)
+	}
+	return r.put(ctx, run)
+}
+
+// FinishAccount records one dispatched account's outcome, and the run's
+// once every account has reported; the finished run is returned to the
+// caller that recorded its last account, and nil to the others. The
+// account is added to the run's processed or failed set, as Checkpoint
+// does. Counters are added in place rather than rewritten, so workers
+// finishing at the same time do not lose each other's counts.
+func (r *Recorder) FinishAccount(ctx context.Context, function, runID, customerID string, results int, accountErr error) (*Run, error) {
+	failed := 0
+	update := "ADD accounts_done :one, accounts_failed :failed, results :results, #processed :id DELETE #failed :id"
+	if accountErr != nil {
+		failed = 1
+		update = "ADD accounts_done :one, accounts_failed :failed, results :results, #failed :id"
+	}
+	key := runKey(function, runID)
+	out, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(r.table),
+		Key:                      key,
+		UpdateExpression:         aws.String(update),
+		ConditionExpression:      aws.String("attribute_exists(run_id)"),
+		ExpressionAttributeNames: setNames(accountErr),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":     &types.AttributeValueMemberN{Value: "1"},
+			":failed":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", failed)},
+			":results": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", results)},
+			":id":      &types.AttributeValueMemberSS{Value: []string{customerID}},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record account for run %s: %w", runID, err)
+	}
+
+	var run Run
+	if err := attributevalue.UnmarshalMap(out.Attributes, &run); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+	if run.Status != StatusRunning || run.AccountsDone < run.Accounts {
+		return nil, nil
+	}
+
+	status := StatusSucceeded
+	if run.AccountsFailed > 0 {
+		status = StatusPartial
+	}
+	now := r.clock.Now()
+	finishedAt, err := attributevalue.Marshal(now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal finish time: %w", err)
+	}
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(r.table),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET #status = :status, finished_at = :finished_at"),
+		ConditionExpression: aws.String("#status = :running"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status":      &types.AttributeValueMemberS{Value: status},
+			":running":     &types.AttributeValueMemberS{Value: StatusRunning},
+			":finished_at": finishedAt,
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		// A redelivered account finished the run first.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish run %s: %w", runID, err)
+	}
+	run.Status = status
+	run.FinishedAt = &now
+	return &run, nil
+}
+
+// get returns one run by key, or ErrNotFound.
+func (r *Recorder) get(ctx context.Context, function, runID string) (*Run, error) {
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            runKey(function, runID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run %s: %w", runID, err)
+	}
+	if out.Item == nil {
+		return nil, ErrNotFound
+	}
+	var run Run
+	if err := attributevalue.UnmarshalMap(out.Item, &run); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+	return &run, nil
+}
+
+func runKey(function, runID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"function": &types.AttributeValueMemberS{Value: function},
+		"run_id":   &types.AttributeValueMemberS{Value: runID},
+	}
+}
+
+// setNames are the attribute names of the account sets an update with or
+// without accountErr touches.
+func setNames(accountErr error) map[string]string {
+	if accountErr != nil {
+		return map[string]string{"#failed": "failed"}
+	}
+	return map[string]string{"#processed": "processed", "#failed": "failed"}
+}
+
+func appendUnique(ids []string, id string) []string {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+func (r *Recorder) put(ctx context.Context, run *Run) error {
+	item, err := attributevalue.MarshalMap(run)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.table),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save run: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package search
+
+import "time"
+
+// ProductIndex is the index product-indexer writes and product-service
+// searches.
+const ProductIndex = "products"
+
+// ProductDocument is a product as indexed. Its dynamodbav tags match the
+// products table, so stream images decode straight into it.
+type ProductDocument struct {
+	ID          string    `json:"id" dynamodbav:"id"`
+	SKU         string    `json:"sku" dynamodbav:"sku"`
+	Name        string    `json:"name" dynamodbav:"name"`
+	Description string    `json:"description,omitempty" dynamodbav:"description"`
+	Category    string    `json:"category" dynamodbav:"category"`
+	Brand       string    `json:"brand,omitempty" dynamodbav:"brand"`
+	Tags        []string  `json:"tags,omitempty" dynamodbav:"tags"`
+	Price       float64   `json:"price" dynamodbav:"price"`
+	Currency    string    `json:"currency" dynamodbav:"currency"`
+	ImageURL    string    `json:"image_url,omitempty" dynamodbav:"image_url"`
+	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// ProductMapping creates ProductIndex. Names and descriptions are analysed
+// for English full-text search; name also keeps a keyword for sorting.
+// Category, brand and tags are keywords for exact filters and facets.
+var ProductMapping = []byte(`{
+  "settings": {
+    "number_of_shards": 1,
+    "number_of_replicas": 1
+  },
+  "mappings": {
+    "dynamic": "strict",
+    "properties": {
+      "id":          {"type": "keyword"},
+      "sku":         {"type": "keyword"},
+      "name":        {"type": "text", "analyzer": "english", "fields": {"raw": {"type": "keyword", "ignore_above": 256}}},
+      "description": {"type": "text", "analyzer": "english"},
+      "category":    {"type": "keyword"},
+      "brand":       {"type": "keyword"},
+      "tags":        {"type": "keyword"},
+      "price":       {"type": "scaled_float", "scaling_factor": 100},
+      "currency":    {"type": "keyword"},
+      "image_url":   {"type": "keyword", "index": false},
+      "created_at":  {"type": "date"},
+      "updated_at":  {"type": "date"}
+    }
+  }
+}`)
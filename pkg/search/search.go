@@ -0,0 +1,222 @@
+// Package search is a minimal Amazon OpenSearch Service client: signed JSON
+// requests, index creation and the bulk API. Requests are signed with
+// SigV4 for the "es" service unless the client has no credentials, as
+// with a local OpenSearch container.
+package search
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// signingName is the SigV4 service name of OpenSearch Service domains.
+const signingName = "es"
+
+// Error is a non-2xx response from OpenSearch.
+type Error struct {
+	Status int
+	Body   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("opensearch returned %d: %s", e.Status, e.Body)
+}
+
+// IsStatus reports whether err is an OpenSearch response with status.
+func IsStatus(err error, status int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Status == status
+}
+
+// Client sends requests to one OpenSearch domain.
+type Client struct {
+	endpoint    string
+	region      string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	http        *http.Client
+}
+
+// New returns a client for the domain at endpoint, signing with cfg's
+// credentials and region. A nil cfg gives an unsigned client.
+func New(endpoint string, cfg *aws.Config) *Client {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	c := &Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+	if cfg != nil {
+		c.region = cfg.Region
+		c.credentials = cfg.Credentials
+		c.signer = v4.NewSigner()
+	}
+	return c
+}
+
+// Do sends body to path and decodes a JSON response into out, which may
+// be nil. Responses other than 2xx are returned as *Error.
+func (c *Client) Do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	return c.do(ctx, method, path, "application/json", body, out)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if c.signer != nil {
+		creds, err := c.credentials.Retrieve(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve credentials: %w", err)
+		}
+		hash := sha256.Sum256(body)
+		if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), signingName, c.region, time.Now()); err != nil {
+			return fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call opensearch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return &Error{Status: resp.StatusCode, Body: strings.TrimSpace(string(b))}
+	}
+	if out == nil || method == http.MethodHead {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode opensearch response: %w", err)
+	}
+	return nil
+}
+
+// EnsureIndex creates index with mapping unless it already exists.
+// Mapping changes to an existing index are not applied; they need a new
+// index and a reindex.
+func (c *Client) EnsureIndex(ctx context.Context, index string, mapping []byte) error {
+	err := c.Do(ctx, http.MethodHead, "/"+index, nil, nil)
+	if err == nil {
+		return nil
+	}
+	if !IsStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("failed to check index %s: %w", index, err)
+	}
+
+	err = c.Do(ctx, http.MethodPut, "/"+index, mapping, nil)
+	// Another writer may have created it since the check.
+	if err != nil && !(IsStatus(err, http.StatusBadRequest) && strings.Contains(err.Error(), "resource_already_exists_exception")) {
+		return fmt.Errorf("failed to create index %s: %w", index, err)
+	}
+	return nil
+}
+
+// BulkAction is one index or delete in a bulk request. A non-zero Version
+// is applied as an external version, so an action older than what the
+// index holds is rejected with a 409 instead of overwriting newer data.
+type BulkAction struct {
+	Delete   bool
+	Index    string
+	ID       string
+	Version  int64
+	Document interface{}
+}
+
+// BulkResult is the outcome of one BulkAction, in request order.
+type BulkResult struct {
+	ID     string
+	Status int
+	Error  string
+}
+
+// Conflict reports whether the action lost to a newer version, which for
+// externally versioned writes means there is nothing left to do.
+func (r BulkResult) Conflict() bool {
+	return r.Status == http.StatusConflict
+}
+
+// OK reports whether the action succeeded. Deleting a missing document
+// counts as success.
+func (r BulkResult) OK() bool {
+	return r.Status < 300 || r.Status == http.StatusNotFound
+}
+
+type bulkMeta struct {
+	Index       string `json:"_index"`
+	ID          string `json:"_id"`
+	Version     int64  `json:"version,omitempty"`
+	VersionType string `json:"version_type,omitempty"`
+}
+
+// Bulk applies actions in one _bulk request. An error means the request
+// as a whole failed; per-action failures are in the results.
+func (c *Client) Bulk(ctx context.Context, actions []BulkAction) ([]BulkResult, error) {
+	if len(actions) == 0 {
+		return nil, nil
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, a := range actions {
+		meta := bulkMeta{Index: a.Index, ID: a.ID}
+		if a.Version > 0 {
+			meta.Version = a.Version
+			meta.VersionType = "external_gte"
+		}
+		op := "index"
+		if a.Delete {
+			op = "delete"
+		}
+		if err := enc.Encode(map[string]bulkMeta{op: meta}); err != nil {
+			return nil, fmt.Errorf("failed to encode bulk action: %w", err)
+		}
+		if !a.Delete {
+			if err := enc.Encode(a.Document); err != nil {
+				return nil, fmt.Errorf("failed to encode document %s: %w", a.ID, err)
+			}
+		}
+	}
+
+	var resp struct {
+		Items []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("failed to send bulk request: %w", err)
+	}
+
+	results := make([]BulkResult, len(resp.Items))
+	for i, item := range resp.Items {
+		for _, r := range item {
+			results[i] = BulkResult{ID: r.ID, Status: r.Status}
+			if len(r.Error) > 0 {
+				results[i].Error = string(r.Error)
+			}
+		}
+	}
+	return results, nil
+}
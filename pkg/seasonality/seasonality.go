@@ -0,0 +1,319 @@
+// Package seasonality is the calendar of planned demand events: Black
+// Friday, holidays, sales. Each Event spans whole days and says how far
+// above normal bids, spend and conversion rates are expected to go, so the
+// automation treats the surge as planned rather than as an anomaly.
+//
+// bid-optimizer widens an account's bid guardrails during its events,
+// raises campaign budgets for them and restores the budgets afterwards,
+// leaves event days out of the history budget reallocation learns from,
+// and creates a Google Ads seasonality adjustment ahead of each event with
+// a conversion rate modifier so Smart Bidding expects the change.
+// campaign-monitor raises its spend spike threshold while an event runs.
+// ads-api edits the calendar under /seasonality.
+package seasonality
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/dynamo"
+)
+
+// GlobalScope holds events that apply to every account.
+const GlobalScope = "global"
+
+// DateLayout is the format of event dates.
+const DateLayout = "2006-01-02"
+
+// Bounds on an event's multipliers. Google Ads accepts conversion rate
+// modifiers from 0.1 to 10 on adjustments of at most MaxAdjustmentDays.
+const (
+	MaxBidMultiplier          = 3.0
+	MaxBudgetMultiplier       = 5.0
+	MinConversionRateModifier = 0.1
+	MaxConversionRateModifier = 10.0
+	MaxAdjustmentDays         = 14
+	// MaxEventDays bounds events without a conversion rate modifier.
+	MaxEventDays = 62
+)
+
+// ErrNotFound is returned for an event that does not exist.
+var ErrNotFound = errors.New("seasonality event not found")
+
+// Event is one planned demand event, from StartDate through EndDate
+// inclusive, as days in UTC. A multiplier of 1, or zero, leaves its
+// setting as it is.
+type Event struct {
+	// Scope is the account the event applies to, or GlobalScope.
+	Scope   string `json:"scope" dynamodbav:"scope"`
+	EventID string `json:"event_id" dynamodbav:"event_id"`
+	Name    string `json:"name" dynamodbav:"name"`
+
+	StartDate string `json:"start_date" dynamodbav:"start_date"`
+	EndDate   string `json:"end_date" dynamodbav:"end_date"`
+
+	// BidMultiplier raises the max bid guardrail during the event.
+	BidMultiplier float64 `json:"bid_multiplier,omitempty" dynamodbav:"bid_multiplier,omitempty"`
+	// BudgetMultiplier is the expected lift in spend: campaign budgets and
+	// the bid guardrails' spend impact cap are raised by it, and spend
+	// spikes are measured against it.
+	BudgetMultiplier float64 `json:"budget_multiplier,omitempty" dynamodbav:"budget_multiplier,omitempty"`
+	// ConversionRateModifier is the expected change in conversion rate,
+	// sent to Google Ads as a seasonality adjustment; zero creates none.
+	ConversionRateModifier float64 `json:"conversion_rate_modifier,omitempty" dynamodbav:"conversion_rate_modifier,omitempty"`
+	// CampaignIDs narrows an account's event to some of its campaigns;
+	// global events cover every campaign.
+	CampaignIDs []string `json:"campaign_ids,omitempty" dynamodbav:"campaign_ids,omitempty"`
+
+	// Accounts records what the optimizer has done for the event in each
+	// account, keyed by customer ID.
+	Accounts map[string]AccountState `json:"accounts" dynamodbav:"accounts"`
+
+	CreatedBy string    `json:"created_by" dynamodbav:"created_by"`
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+// AccountState is what the optimizer has done for an event in one
+// account.
+type AccountState struct {
+	// Adjustment is the resource name of the Google Ads seasonality
+	// adjustment created for the event.
+	Adjustment string `json:"adjustment,omitempty" dynamodbav:"adjustment,omitempty"`
+	// Budgets holds the daily budget, in micros, of each campaign whose
+	// budget was raised for the event, as it was before the raise.
+	Budgets map[string]int64 `json:"budgets,omitempty" dynamodbav:"budgets,omitempty"`
+	// Restored is set once the raised budgets are back.
+	Restored bool `json:"restored,omitempty" dynamodbav:"restored,omitempty"`
+}
+
+// Start is the first day of the event.
+func (e Event) Start() time.Time {
+	t, _ := time.Parse(DateLayout, e.StartDate)
+	return t
+}
+
+// End is the last day of the event.
+func (e Event) End() time.Time {
+	t, _ := time.Parse(DateLayout, e.EndDate)
+	return t
+}
+
+// Days is the event's length in days.
+func (e Event) Days() int {
+	return int(e.End().Sub(e.Start()).Hours()/24) + 1
+}
+
+// On reports whether day falls within the event.
+func (e Event) On(day time.Time) bool {
+	d := day.UTC().Format(DateLayout)
+	return e.StartDate <= d && d <= e.EndDate
+}
+
+// Covers reports whether the event applies to the campaign.
+func (e Event) Covers(campaignID string) bool {
+	if len(e.CampaignIDs) == 0 {
+		return true
+	}
+	for _, id := range e.CampaignIDs {
+		if id == campaignID {
+			return true
+		}
+	}
+	return false
+}
+
+// Multiplier returns m, or 1 when it is unset.
+func Multiplier(m float64) float64 {
+	if m <= 0 {
+		return 1
+	}
+	return m
+}
+
+// Validate checks the event's dates and multipliers.
+func (e Event) Validate() error {
+	var errs []error
+	if strings.TrimSpace(e.Name) == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	start, startErr := time.Parse(DateLayout, e.StartDate)
+	if startErr != nil {
+		errs = append(errs, errors.New("start_date must be a date in YYYY-MM-DD format"))
+	}
+	end, endErr := time.Parse(DateLayout, e.EndDate)
+	if endErr != nil {
+		errs = append(errs, errors.New("end_date must be a date in YYYY-MM-DD format"))
+	}
+	if startErr == nil && endErr == nil {
+		days := int(end.Sub(start).Hours()/24) + 1
+		switch {
+		case end.Before(start):
+			errs = append(errs, errors.New("end_date must not be before start_date"))
+		case e.ConversionRateModifier != 0 && days > MaxAdjustmentDays:
+			errs = append(errs, fmt.Errorf("an event with a conversion_rate_modifier must not exceed %d days", MaxAdjustmentDays))
+		case days > MaxEventDays:
+			errs = append(errs, fmt.Errorf("an event must not exceed %d days", MaxEventDays))
+		}
+	}
+	if e.BidMultiplier != 0 && (e.BidMultiplier < 1 || e.BidMultiplier > MaxBidMultiplier) {
+		errs = append(errs, fmt.Errorf("bid_multiplier must be between 1 and %g", MaxBidMultiplier))
+	}
+	if e.BudgetMultiplier != 0 && (e.BudgetMultiplier < 1 || e.BudgetMultiplier > MaxBudgetMultiplier) {
+		errs = append(errs, fmt.Errorf("budget_multiplier must be between 1 and %g", MaxBudgetMultiplier))
+	}
+	if e.ConversionRateModifier != 0 && (e.ConversionRateModifier < MinConversionRateModifier || e.ConversionRateModifier > MaxConversionRateModifier) {
+		errs = append(errs, fmt.Errorf("conversion_rate_modifier must be between %g and %g", MinConversionRateModifier, MaxConversionRateModifier))
+	}
+	if e.Scope == GlobalScope && len(e.CampaignIDs) > 0 {
+		errs = append(errs, errors.New("campaign_ids are only allowed on an account's events"))
+	}
+	for _, id := range e.CampaignIDs {
+		if id == "" || strings.Trim(id, "0123456789") != "" {
+			errs = append(errs, fmt.Errorf("campaign_ids: %q is not a campaign ID", id))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Store keeps events in a DynamoDB table keyed by scope and event_id.
+type Store struct {
+	table *dynamo.Table
+	clock clock.Clock
+}
+
+func NewStore(table *dynamo.Table, clk clock.Clock) *Store {
+	return &Store{table: table, clock: clk}
+}
+
+func key(scope, id string) dynamo.Key {
+	return dynamo.CompositeKey("scope", scope, "event_id", id)
+}
+
+// Create stores a new event, stamping its creation time.
+func (s *Store) Create(ctx context.Context, e *Event) error {
+	e.CreatedAt = s.clock.Now().UTC()
+	if e.Accounts == nil {
+		// SetAccount writes into the map, which must exist.
+		e.Accounts = map[string]AccountState{}
+	}
+	return s.table.Put(ctx, e, dynamo.IfNotExists("event_id"))
+}
+
+// Get returns the event, or ErrNotFound.
+func (s *Store) Get(ctx context.Context, scope, id string) (Event, error) {
+	e, err := dynamo.Get[Event](ctx, s.table, key(scope, id))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return Event{}, ErrNotFound
+	}
+	return e, err
+}
+
+// Delete removes the event.
+func (s *Store) Delete(ctx context.Context, scope, id string) error {
+	return s.table.Delete(ctx, key(scope, id))
+}
+
+// List returns the scope's events, earliest first.
+func (s *Store) List(ctx context.Context, scope string) ([]Event, error) {
+	events, err := dynamo.QueryAll[Event](ctx, s.table, dynamo.Query{
+		KeyCondition: "#scope = :scope",
+		Names:        map[string]string{"#scope": "scope"},
+		Values:       map[string]types.AttributeValue{":scope": dynamo.S(scope)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+// ForAccount returns the account's events and the global ones, earliest
+// first.
+func (s *Store) ForAccount(ctx context.Context, customerID string) ([]Event, error) {
+	own, err := s.List(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	global, err := s.List(ctx, GlobalScope)
+	if err != nil {
+		return nil, err
+	}
+	events := append(own, global...)
+	sortEvents(events)
+	return events, nil
+}
+
+// SetAccount records what was done for the event in one account. It
+// returns ErrNotFound if the event was deleted meanwhile.
+func (s *Store) SetAccount(ctx context.Context, scope, id, customerID string, state AccountState) error {
+	value, err := attributevalue.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal account state: %w", err)
+	}
+	err = s.table.Update(ctx, key(scope, id), dynamo.Update{
+		Expression: "SET accounts.#customer = :state",
+		Condition:  "attribute_exists(event_id)",
+		Names:      map[string]string{"#customer": customerID},
+		Values:     map[string]types.AttributeValue{":state": value},
+	}, nil)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].StartDate != events[j].StartDate {
+			return events[i].StartDate < events[j].StartDate
+		}
+		return events[i].EventID < events[j].EventID
+	})
+}
+
+// Active returns the events running on day.
+func Active(events []Event, day time.Time) []Event {
+	var active []Event
+	for _, e := range events {
+		if e.On(day) {
+			active = append(active, e)
+		}
+	}
+	return active
+}
+
+// Multipliers are the largest multipliers of the events covering one
+// campaign, or of all of an account's events when the campaign is empty.
+type Multipliers struct {
+	Bid    float64
+	Budget float64
+	// Events names the events behind them.
+	Events []string
+}
+
+// Combine returns the multipliers of the events covering campaignID; an
+// empty campaignID takes every event.
+func Combine(events []Event, campaignID string) Multipliers {
+	m := Multipliers{Bid: 1, Budget: 1}
+	for _, e := range events {
+		if campaignID != "" && !e.Covers(campaignID) {
+			continue
+		}
+		if b := Multiplier(e.BidMultiplier); b > m.Bid {
+			m.Bid = b
+		}
+		if b := Multiplier(e.BudgetMultiplier); b > m.Budget {
+			m.Budget = b
+		}
+		m.Events = append(m.Events, e.Name)
+	}
+	return m
+}
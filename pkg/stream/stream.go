@@ -0,0 +1,159 @@
+// Package stream writes large result sets to HTTP clients row by row as
+// NDJSON or CSV, flushing as it goes so handlers never hold a full export in
+// memory.
+package stream
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Format is an output encoding.
+type Format string
+
+const (
+	NDJSON Format = "ndjson"
+	CSV    Format = "csv"
+)
+
+// ContentType returns the Content-Type header value for the format.
+func (f Format) ContentType() string {
+	if f == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// FormatFromRequest picks the format from the "format" query parameter or,
+// failing that, the Accept header. NDJSON is the default.
+func FormatFromRequest(r *http.Request) (Format, error) {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "":
+	case string(NDJSON):
+		return NDJSON, nil
+	case string(CSV):
+		return CSV, nil
+	default:
+		return "", fmt.Errorf("unsupported format %q", r.URL.Query().Get("format"))
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		return CSV, nil
+	}
+	return NDJSON, nil
+}
+
+// Record is implemented by rows that can be exported as CSV. CSVHeader must
+// return the same columns for every row of a stream.
+type Record interface {
+	CSVHeader() []string
+	CSVRow() []string
+}
+
+// DefaultFlushEvery is how many rows are buffered between flushes.
+const DefaultFlushEvery = 100
+
+// Writer encodes rows onto a chunked HTTP response.
+type Writer struct {
+	w          http.ResponseWriter
+	flusher    http.Flusher
+	format     Format
+	json       *json.Encoder
+	csv        *csv.Writer
+	FlushEvery int
+
+	rows          int
+	headerWritten bool
+}
+
+// NewWriter sets the response headers and status for a streamed body. The
+// status cannot change after this call, so validate inputs first.
+func NewWriter(w http.ResponseWriter, format Format, filename string) *Writer {
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+string(format)))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	sw := &Writer{w: w, format: format, FlushEvery: DefaultFlushEvery}
+	sw.flusher, _ = w.(http.Flusher)
+	if format == CSV {
+		sw.csv = csv.NewWriter(w)
+	} else {
+		sw.json = json.NewEncoder(w)
+	}
+	return sw
+}
+
+// Write encodes one row. CSV streams require rows implementing Record.
+func (sw *Writer) Write(row interface{}) error {
+	if sw.format == CSV {
+		record, ok := row.(Record)
+		if !ok {
+			return fmt.Errorf("row type %T cannot be written as CSV", row)
+		}
+		if !sw.headerWritten {
+			if err := sw.csv.Write(record.CSVHeader()); err != nil {
+				return fmt.Errorf("failed to write CSV header: %w", err)
+			}
+			sw.headerWritten = true
+		}
+		if err := sw.csv.Write(record.CSVRow()); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	} else if err := sw.json.Encode(row); err != nil {
+		return fmt.Errorf("failed to write NDJSON row: %w", err)
+	}
+
+	sw.rows++
+	if sw.FlushEvery > 0 && sw.rows%sw.FlushEvery == 0 {
+		sw.Flush()
+	}
+	return nil
+}
+
+// Rows returns the number of rows written so far.
+func (sw *Writer) Rows() int {
+	return sw.rows
+}
+
+// Flush pushes buffered rows to the client.
+func (sw *Writer) Flush() {
+	if sw.csv != nil {
+		sw.csv.Flush()
+	}
+	if sw.flusher != nil {
+		sw.flusher.Flush()
+	}
+}
+
+// ExtendDeadline pushes the connection's write deadline d into the future.
+// Servers set WriteTimeout for ordinary requests; long exports call this per
+// page so they are not cut off while still making progress.
+func (sw *Writer) ExtendDeadline(d time.Duration) {
+	http.NewResponseController(sw.w).SetWriteDeadline(time.Now().Add(d))
+}
+
+// Abort terminates a stream that failed part way. The status code has
+// already been sent, so NDJSON streams get a trailing {"error": ...} line
+// that clients must check for; CSV streams are simply cut short.
+func (sw *Writer) Abort(err error) {
+	if sw.json != nil {
+		sw.json.Encode(map[string]string{"error": err.Error()})
+	}
+	sw.Flush()
+}
+
+// Close flushes any remaining rows.
+func (sw *Writer) Close() error {
+	sw.Flush()
+	if sw.csv != nil {
+		return sw.csv.Error()
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package tenant carries the storefront brand, or tenant, a request acts
+// for, so one deployment can serve several brands with their data kept
+// apart.
+//
+// The API gateway sets the X-Tenant-Id header from the caller's token, and
+// services read it into the request context with Middleware. Stored items
+// carry their tenant in the tenant_id attribute, and tables keyed by an ID
+// prefix it with the tenant ("acme#<id>") so tenants can reuse IDs without
+// colliding. The default tenant, which owns everything written before
+// tenancy, keeps unprefixed keys, so existing data needs no migration.
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"pkg/problem"
+)
+
+const (
+	// Header carries the tenant between the gateway and the services.
+	Header = "X-Tenant-Id"
+	// Attr is the attribute holding an item's tenant.
+	Attr = "tenant_id"
+	// Default is the tenant of requests that name none.
+	Default = "default"
+	// Separator ends the tenant prefix of a key.
+	Separator = "#"
+)
+
+var pattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Valid reports whether id can name a tenant: lowercase letters, digits
+// and hyphens, at most 63 characters, so it is safe in keys and headers.
+func Valid(id string) bool {
+	return pattern.MatchString(id)
+}
+
+type contextKey struct{}
+
+// WithID returns ctx acting for tenant id.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ctx acts for, Default when it names none.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
+
+// Middleware puts the X-Tenant-Id header's tenant in the request context,
+// answering 400 if it is not a valid tenant ID. Requests without the
+// header act for the default tenant.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !Valid(id) {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "Invalid "+Header+": must be lowercase letters, digits and hyphens"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+	})
+}
+
+// Key is the stored form of key for ctx's tenant: key itself for the
+// default tenant, otherwise prefixed with the tenant.
+func Key(ctx context.Context, key string) string {
+	id := FromContext(ctx)
+	if id == Default {
+		return key
+	}
+	return id + Separator + key
+}
+
+// TrimKey is the inverse of Key, returning key as the tenant knows it.
+func TrimKey(ctx context.Context, key string) string {
+	id := FromContext(ctx)
+	if id == Default {
+		return key
+	}
+	return strings.TrimPrefix(key, id+Separator)
+}
+
+// Owns reports whether an item stored with the tenant attribute itemTenant
+// belongs to ctx's tenant. Items without the attribute predate tenancy and
+// belong to the default tenant.
+func Owns(ctx context.Context, itemTenant string) bool {
+	if itemTenant == "" {
+		itemTenant = Default
+	}
+	return itemTenant == FromContext(ctx)
+}
+
+// Filter is a DynamoDB filter expression keeping the items of ctx's
+// tenant, with its names and values. For the default tenant it also keeps
+// items without the attribute.
+func Filter(ctx context.Context) (expr string, names map[string]string, value string) {
+	names = map[string]string{"#tenant": Attr}
+	if FromContext(ctx) == Default {
+		return "(attribute_not_exists(#tenant) OR #tenant = :tenant)", names, Default
+	}
+	return "#tenant = :tenant", names, FromContext(ctx)
+}
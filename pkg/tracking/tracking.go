@@ -0,0 +1,223 @@
+// Package tracking validates Google Ads tracking templates, final URL
+// suffixes and landing page URL parameters against the canonical UTM scheme
+// that downstream attribution joins on.
+//
+// The scheme is written as a final URL suffix, for example
+//
+//	utm_source=google&utm_medium=cpc&utm_campaign={campaignid}
+//
+// and every campaign's effective suffix must carry exactly those values.
+package tracking
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultScheme is the canonical suffix used when none is configured.
+// utm_campaign and utm_content carry IDs rather than names so joins survive
+// renames.
+const DefaultScheme = "utm_source=google&utm_medium=cpc&utm_campaign={campaignid}&utm_content={adgroupid}&utm_term={keyword}"
+
+// Issue is a single problem found in a campaign's tracking setup.
+type Issue struct {
+	Param   string
+	Message string
+}
+
+func (i Issue) String() string {
+	return i.Message
+}
+
+// Scheme is the set of required URL parameters and their expected values.
+type Scheme struct {
+	params map[string]string
+}
+
+// ParseScheme parses a canonical suffix. Values may be literals or
+// ValueTrack parameters.
+func ParseScheme(suffix string) (*Scheme, error) {
+	values, err := url.ParseQuery(strings.TrimLeft(suffix, "?&"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tracking scheme: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("tracking scheme has no parameters")
+	}
+
+	params := make(map[string]string, len(values))
+	for name, v := range values {
+		if len(v) != 1 {
+			return nil, fmt.Errorf("tracking scheme sets %s %d times", name, len(v))
+		}
+		params[name] = v[0]
+	}
+	return &Scheme{params: params}, nil
+}
+
+// MustParseScheme is like ParseScheme but panics on error.
+func MustParseScheme(suffix string) *Scheme {
+	s, err := ParseScheme(suffix)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Params returns the scheme's parameter names in sorted order.
+func (s *Scheme) Params() []string {
+	names := make([]string, 0, len(s.params))
+	for name := range s.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckTemplate reports problems with a tracking template that would break
+// or drop the landing page URL.
+func CheckTemplate(template string) []Issue {
+	if template == "" {
+		return nil
+	}
+
+	var issues []Issue
+	if !strings.Contains(template, "{lpurl}") && !strings.Contains(template, "{unescapedlpurl}") && !strings.Contains(template, "{escapedlpurl}") {
+		issues = append(issues, Issue{Message: "tracking template does not include {lpurl}"})
+	}
+	if strings.Count(template, "{") != strings.Count(template, "}") {
+		return append(issues, Issue{Message: "tracking template has unbalanced braces"})
+	}
+	for _, name := range unknownValueTrack(template) {
+		issues = append(issues, Issue{Message: fmt.Sprintf("tracking template uses unknown parameter {%s}", name)})
+	}
+	if !strings.HasPrefix(template, "{lpurl}") && !strings.HasPrefix(template, "{unescapedlpurl}") && !strings.HasPrefix(template, "{escapedlpurl}") {
+		u, err := url.Parse(valueTrackPattern.ReplaceAllString(template, "x"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			issues = append(issues, Issue{Message: "tracking template is not a valid http(s) URL"})
+		}
+	}
+	return issues
+}
+
+// CheckSuffix reports where a final URL suffix deviates from the scheme:
+// malformed syntax, missing or duplicated parameters, wrong values and
+// parameters whose name differs from the scheme only by case.
+func (s *Scheme) CheckSuffix(suffix string) []Issue {
+	if suffix == "" {
+		return []Issue{{Message: "no final URL suffix; canonical UTM parameters are missing"}}
+	}
+	if strings.HasPrefix(suffix, "?") || strings.HasPrefix(suffix, "&") {
+		return []Issue{{Message: "final URL suffix must not start with ? or &"}}
+	}
+	if strings.Count(suffix, "{") != strings.Count(suffix, "}") {
+		return []Issue{{Message: "final URL suffix has unbalanced braces"}}
+	}
+
+	values, err := url.ParseQuery(suffix)
+	if err != nil {
+		return []Issue{{Message: fmt.Sprintf("final URL suffix is not a valid query string: %v", err)}}
+	}
+
+	var issues []Issue
+	for _, name := range unknownValueTrack(suffix) {
+		issues = append(issues, Issue{Message: fmt.Sprintf("final URL suffix uses unknown parameter {%s}", name)})
+	}
+	for _, name := range s.Params() {
+		want := s.params[name]
+		got, ok := values[name]
+		switch {
+		case !ok:
+			if other := caseVariant(values, name); other != "" {
+				issues = append(issues, Issue{Param: name, Message: fmt.Sprintf("%s is set as %s; parameter names are case-sensitive", name, other)})
+			} else {
+				issues = append(issues, Issue{Param: name, Message: fmt.Sprintf("%s is missing", name)})
+			}
+		case len(got) > 1:
+			issues = append(issues, Issue{Param: name, Message: fmt.Sprintf("%s is set %d times", name, len(got))})
+		case got[0] != want:
+			issues = append(issues, Issue{Param: name, Message: fmt.Sprintf("%s is %q, expected %q", name, got[0], want)})
+		}
+	}
+	return issues
+}
+
+// CheckFinalURL reports scheme parameters hardcoded in a landing page URL.
+// The suffix is appended after them, so the page receives both values and
+// analytics tools keep whichever comes first.
+func (s *Scheme) CheckFinalURL(finalURL string) []Issue {
+	u, err := url.Parse(finalURL)
+	if err != nil {
+		return []Issue{{Message: fmt.Sprintf("final URL %s is not a valid URL", finalURL)}}
+	}
+
+	query := u.Query()
+	var issues []Issue
+	for _, name := range s.Params() {
+		if _, ok := query[name]; ok {
+			issues = append(issues, Issue{Param: name, Message: fmt.Sprintf("final URL %s hardcodes %s", finalURL, name)})
+		}
+	}
+	return issues
+}
+
+// EffectiveSuffix returns the suffix Google Ads applies to a campaign: its
+// own if set, otherwise the account's.
+func EffectiveSuffix(campaign, account string) string {
+	if campaign != "" {
+		return campaign
+	}
+	return account
+}
+
+// NormalizeKeyword returns the form of a keyword that revenue attribution
+// joins on. utm_term carries {keyword} as entered, so the same keyword may
+// arrive with broad match modifiers, match type punctuation or different
+// case.
+func NormalizeKeyword(keyword string) string {
+	keyword = strings.ToLower(keyword)
+	keyword = strings.NewReplacer("+", "", `"`, "", "[", "", "]", "").Replace(keyword)
+	return strings.Join(strings.Fields(keyword), " ")
+}
+
+var valueTrackPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// valueTrack lists the ValueTrack parameters we use. Custom parameters
+// ({_name}) are always allowed.
+var valueTrack = map[string]bool{
+	"lpurl": true, "unescapedlpurl": true, "escapedlpurl": true, "escapedlpurl+2": true,
+	"campaignid": true, "adgroupid": true, "creative": true, "keyword": true,
+	"matchtype": true, "network": true, "device": true, "devicemodel": true,
+	"gclid": true, "targetid": true, "placement": true, "adposition": true,
+	"feeditemid": true, "extensionid": true, "loc_physical_ms": true,
+	"loc_interest_ms": true, "ifmobile": true, "ifnotmobile": true,
+	"ifsearch": true, "ifcontent": true, "target": true, "random": true,
+}
+
+func unknownValueTrack(s string) []string {
+	var unknown []string
+	for _, m := range valueTrackPattern.FindAllStringSubmatch(s, -1) {
+		name := strings.ToLower(m[1])
+		// Conditional parameters look like {ifmobile:value}.
+		if i := strings.Index(name, ":"); i >= 0 {
+			name = name[:i]
+		}
+		if strings.HasPrefix(name, "_") || valueTrack[name] {
+			continue
+		}
+		unknown = append(unknown, m[1])
+	}
+	return unknown
+}
+
+func caseVariant(values url.Values, name string) string {
+	for other := range values {
+		if strings.EqualFold(other, name) {
+			return other
+		}
+	}
+	return ""
+}
@@ -0,0 +1,273 @@
+// Package validate checks request structs against `validate` struct tags.
+//
+//	type CreateUserRequest struct {
+//		Email string `json:"email" validate:"required,email,max=254"`
+//	}
+//
+// Rules are comma separated; parameters follow "=". Nil pointers and zero
+// values are skipped unless the field is "required"; a non-nil pointer is
+// always checked, so PATCH-style requests can use pointer fields. Nested
+// structs and slices of structs are validated recursively and reported with
+// JSON paths ("items[2].sku").
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FieldError describes one failed rule.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors is every FieldError found in one struct.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Func reports whether value satisfies a rule with the given parameter.
+type Func func(value reflect.Value, param string) bool
+
+type rule struct {
+	check   Func
+	message func(param string) string
+}
+
+var (
+	mu    sync.RWMutex
+	rules = map[string]rule{}
+)
+
+// Register adds a custom rule usable in struct tags. message builds the
+// error text from the rule parameter.
+func Register(name string, check Func, message func(param string) string) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules[name] = rule{check: check, message: message}
+}
+
+// Struct validates v, which must be a struct or pointer to struct. It
+// returns nil or an Errors value.
+func Struct(v interface{}) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return Errors{{Field: "", Rule: "required", Message: "request body is required"}}
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: expected struct, got %s", value.Kind())
+	}
+
+	var errs Errors
+	validateStruct(value, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(value reflect.Value, prefix string, errs *Errors) {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		fv := value.Field(i)
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			if !validateField(fv, path, tag, errs) {
+				continue
+			}
+		}
+		descend(fv, path, errs)
+	}
+}
+
+// validateField applies the tag's rules and reports whether the value is
+// present, i.e. whether nested validation should continue.
+func validateField(fv reflect.Value, path, tag string, errs *Errors) bool {
+	explicit := false
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			if hasRule(tag, "required") {
+				*errs = append(*errs, FieldError{Field: path, Rule: "required", Message: "is required"})
+			}
+			return false
+		}
+		fv = fv.Elem()
+		explicit = true
+	}
+
+	// A non-nil pointer means the client sent the field, so even a zero
+	// value is checked against the rules.
+	if !explicit && fv.IsZero() {
+		if hasRule(tag, "required") {
+			*errs = append(*errs, FieldError{Field: path, Rule: "required", Message: "is required"})
+		}
+		return false
+	}
+
+	for _, part := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "required" || name == "" {
+			continue
+		}
+
+		mu.RLock()
+		r, ok := rules[name]
+		mu.RUnlock()
+		if !ok {
+			panic(fmt.Sprintf("validate: unknown rule %q on %s", name, path))
+		}
+		if !r.check(fv, param) {
+			*errs = append(*errs, FieldError{Field: path, Rule: name, Message: r.message(param)})
+		}
+	}
+	return true
+}
+
+func descend(fv reflect.Value, path string, errs *Errors) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		if fv.Type().PkgPath() == "time" {
+			return
+		}
+		validateStruct(fv, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			descend(fv.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func hasRule(tag, name string) bool {
+	for _, part := range strings.Split(tag, ",") {
+		if strings.TrimSpace(part) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// Built-in rules
+
+var (
+	emailPattern = regexp.MustCompile(`^[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}$`)
+	skuPattern   = regexp.MustCompile(`^[A-Z0-9][A-Z0-9\-]{2,31}$`)
+	uuidPattern  = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// IsEmail and IsUUID apply the email and uuid rules outside struct tags,
+// such as to OpenAPI string formats.
+func IsEmail(s string) bool { return emailPattern.MatchString(s) }
+
+func IsUUID(s string) bool { return uuidPattern.MatchString(s) }
+
+// currencies is the set of ISO 4217 codes the storefront and Google Ads
+// accounts are allowed to transact in.
+var currencies = map[string]bool{
+	"USD": true, "EUR": true, "GBP": true, "CAD": true, "AUD": true,
+	"NZD": true, "CHF": true, "JPY": true, "SEK": true, "NOK": true,
+	"DKK": true, "PLN": true, "CZK": true, "MXN": true, "BRL": true,
+	"INR": true, "SGD": true, "HKD": true, "ZAR": true, "AED": true,
+	"TND": true, "MAD": true,
+}
+
+func init() {
+	Register("email", matches(emailPattern), constant("must be a valid email address"))
+	Register("sku", matches(skuPattern), constant("must be 3-32 uppercase letters, digits or dashes"))
+	Register("uuid", matches(uuidPattern), constant("must be a UUID"))
+	Register("currency", func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && currencies[v.String()]
+	}, constant("must be a supported ISO 4217 currency code"))
+
+	Register("min", func(v reflect.Value, param string) bool {
+		n, ok := measure(v)
+		limit, err := strconv.ParseFloat(param, 64)
+		return ok && err == nil && n >= limit
+	}, func(param string) string { return "must be at least " + param })
+
+	Register("max", func(v reflect.Value, param string) bool {
+		n, ok := measure(v)
+		limit, err := strconv.ParseFloat(param, 64)
+		return ok && err == nil && n <= limit
+	}, func(param string) string { return "must be at most " + param })
+
+	Register("oneof", func(v reflect.Value, param string) bool {
+		s := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return true
+			}
+		}
+		return false
+	}, func(param string) string { return "must be one of: " + strings.Join(strings.Fields(param), ", ") })
+}
+
+// measure returns the length of strings and collections, or the numeric
+// value of numbers.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func matches(pattern *regexp.Regexp) Func {
+	return func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && pattern.MatchString(v.String())
+	}
+}
+
+func constant(message string) func(string) string {
+	return func(string) string { return message }
+}
@@ -0,0 +1,212 @@
+// Package warmup keeps a Lambda function's expensive setup — the AWS
+// config, secrets, API clients — across invocations instead of redoing it
+// on each one, and cuts the cold start the first invocation pays.
+//
+// A function declares its setup as Values, primes them from init() so the
+// work happens during the Lambda init phase (ahead of time under
+// provisioned concurrency), and wraps its handler with Handler or
+// ErrorHandler. The first invocation logs how long the cold start took. A
+// {"type":"ping"} event from the scheduled warmer is answered without
+// reaching the handler; it refreshes stale Values so real invocations
+// don't pay for it.
+package warmup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PingType is the type of the scheduled warmer's events.
+const PingType = "ping"
+
+// primeTimeout bounds the setup done during init; Lambda allows the whole
+// init phase 10 seconds.
+const primeTimeout = 8 * time.Second
+
+var (
+	// started is when the execution environment began initializing, as
+	// near as a package variable gets.
+	started = time.Now()
+
+	mu      sync.Mutex
+	values  []Setup
+	timings []string
+	primed  time.Time
+	invoked bool
+)
+
+// RefreshFromEnv is how long a secret, and the clients built from it, are
+// kept before being loaded again, so a rotated secret is picked up:
+// SECRET_REFRESH_INTERVAL, a Go duration, default an hour.
+func RefreshFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SECRET_REFRESH_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return time.Hour
+}
+
+// Setup is any Value, whatever it holds.
+type Setup interface {
+	name() string
+	refresh(ctx context.Context) error
+}
+
+// Value is a piece of setup done once per execution environment. It is
+// loaded on first use, or by Prime, and loaded again once it is older than
+// its refresh interval; a failed refresh keeps serving the previous value.
+type Value[T any] struct {
+	label   string
+	every   time.Duration
+	load    func(context.Context) (T, error)
+	mu      sync.Mutex
+	value   T
+	loaded  time.Time
+	present bool
+}
+
+// New declares a Value loaded by load. An every of zero never refreshes
+// it. Values answer the warmer's pings, so declare them as package
+// variables, not per invocation.
+func New[T any](name string, every time.Duration, load func(context.Context) (T, error)) *Value[T] {
+	v := &Value[T]{label: name, every: every, load: load}
+	mu.Lock()
+	values = append(values, v)
+	mu.Unlock()
+	return v
+}
+
+// Get returns the value, loading it if it is missing or due a refresh.
+func (v *Value[T]) Get(ctx context.Context) (T, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.present && (v.every <= 0 || time.Since(v.loaded) < v.every) {
+		return v.value, nil
+	}
+	value, err := v.load(ctx)
+	if err != nil {
+		if v.present {
+			log.Printf("Failed to refresh %s, keeping the one loaded %s ago: %v", v.label, time.Since(v.loaded).Round(time.Second), err)
+			return v.value, nil
+		}
+		var zero T
+		return zero, err
+	}
+	v.value, v.loaded, v.present = value, time.Now(), true
+	return value, nil
+}
+
+func (v *Value[T]) name() string { return v.label }
+
+func (v *Value[T]) refresh(ctx context.Context) error {
+	_, err := v.Get(ctx)
+	return err
+}
+
+// Prime loads the Values in order and records how long each took for the
+// cold start log. Call it from init(). A Value that fails to load is
+// logged and left for its first Get to try again, so a slow or failing
+// dependency doesn't fail the init phase.
+func Prime(vs ...Setup) {
+	ctx, cancel := context.WithTimeout(context.Background(), primeTimeout)
+	defer cancel()
+	for _, r := range vs {
+		start := time.Now()
+		err := r.refresh(ctx)
+		took := time.Since(start).Round(time.Millisecond)
+		mu.Lock()
+		if err != nil {
+			log.Printf("Failed to set up %s during init, retrying on first use: %v", r.name(), err)
+			timings = append(timings, fmt.Sprintf("%s=failed after %s", r.name(), took))
+		} else {
+			timings = append(timings, fmt.Sprintf("%s=%s", r.name(), took))
+		}
+		mu.Unlock()
+	}
+	mu.Lock()
+	primed = time.Now()
+	mu.Unlock()
+}
+
+// Handler wraps a handler taking an event of type E, answering pings and
+// decoding every other event into E.
+func Handler[E, R any](h func(context.Context, E) (R, error)) func(context.Context, json.RawMessage) (R, error) {
+	return func(ctx context.Context, raw json.RawMessage) (R, error) {
+		if ping(ctx, raw) {
+			var zero R
+			return zero, nil
+		}
+		var event E
+		if err := json.Unmarshal(raw, &event); err != nil {
+			var zero R
+			return zero, fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		return h(ctx, event)
+	}
+}
+
+// ErrorHandler is Handler for handlers that return only an error.
+func ErrorHandler[E any](h func(context.Context, E) error) func(context.Context, json.RawMessage) error {
+	wrapped := Handler(func(ctx context.Context, event E) (struct{}, error) {
+		return struct{}{}, h(ctx, event)
+	})
+	return func(ctx context.Context, raw json.RawMessage) error {
+		_, err := wrapped(ctx, raw)
+		return err
+	}
+}
+
+// ping logs the cold start on an environment's first invocation and
+// reports whether the event is a warmer ping, refreshing the Values if it
+// is.
+func ping(ctx context.Context, raw json.RawMessage) bool {
+	var probe struct {
+		Type string `json:"type"`
+	}
+	isPing := json.Unmarshal(raw, &probe) == nil && probe.Type == PingType
+	logColdStart(isPing)
+	if !isPing {
+		return false
+	}
+
+	mu.Lock()
+	vs := append([]Setup(nil), values...)
+	mu.Unlock()
+	for _, v := range vs {
+		if err := v.refresh(ctx); err != nil {
+			log.Printf("Warmer ping failed to set up %s: %v", v.name(), err)
+		}
+	}
+	return true
+}
+
+// logColdStart logs, once, how long the environment took to initialize
+// and how long it then waited for its first invocation: under provisioned
+// concurrency the wait is the point, on demand it should be near zero.
+func logColdStart(isPing bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	if invoked {
+		return
+	}
+	invoked = true
+	initType := os.Getenv("AWS_LAMBDA_INITIALIZATION_TYPE")
+	if initType == "" {
+		initType = "on-demand"
+	}
+	end := primed
+	if end.IsZero() {
+		end = started
+	}
+	first := "invocation"
+	if isPing {
+		first = "ping"
+	}
+	log.Printf("Cold start (%s): init took %s [%s], first %s %s later",
+		initType, end.Sub(started).Round(time.Millisecond), strings.Join(timings, " "), first, time.Since(end).Round(time.Millisecond))
+}
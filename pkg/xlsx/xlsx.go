@@ -0,0 +1,269 @@
+// Package xlsx writes simple Office Open XML spreadsheets: one or more
+// sheets of text and number cells under a bold, frozen header row. It
+// covers what report exports need without a third-party dependency.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the MIME type of the written workbooks.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// maxSheetName is the longest sheet name Excel accepts.
+const maxSheetName = 31
+
+// Cell is one spreadsheet cell. Build cells with Text and Number so IDs
+// stay text and amounts stay numeric.
+type Cell struct {
+	text    string
+	number  float64
+	numeric bool
+}
+
+// Text returns a text cell.
+func Text(s string) Cell {
+	return Cell{text: s}
+}
+
+// Number returns a numeric cell.
+func Number(f float64) Cell {
+	return Cell{number: f, numeric: true}
+}
+
+// Int returns a numeric cell holding n.
+func Int(n int64) Cell {
+	return Cell{number: float64(n), numeric: true}
+}
+
+// String returns the cell as text, for writing the same rows as CSV.
+func (c Cell) String() string {
+	if !c.numeric {
+		return c.text
+	}
+	if math.IsNaN(c.number) || math.IsInf(c.number, 0) {
+		return ""
+	}
+	return strconv.FormatFloat(c.number, 'f', -1, 64)
+}
+
+// Sheet is one worksheet. Rows shorter than Header leave the remaining
+// cells empty.
+type Sheet struct {
+	Name   string
+	Header []string
+	Rows   [][]Cell
+}
+
+// Write encodes the sheets as a workbook onto w.
+func Write(w io.Writer, sheets ...Sheet) error {
+	if len(sheets) == 0 {
+		return fmt.Errorf("xlsx: a workbook needs at least one sheet")
+	}
+	names := make(map[string]bool, len(sheets))
+	for _, s := range sheets {
+		if s.Name == "" || len(s.Name) > maxSheetName || strings.ContainsAny(s.Name, `[]:*?/\`) {
+			return fmt.Errorf("xlsx: invalid sheet name %q", s.Name)
+		}
+		if names[strings.ToLower(s.Name)] {
+			return fmt.Errorf("xlsx: duplicate sheet name %q", s.Name)
+		}
+		names[strings.ToLower(s.Name)] = true
+	}
+
+	z := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes(len(sheets))},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", workbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", workbookRels(len(sheets))},
+		{"xl/styles.xml", styles},
+	}
+	for _, f := range files {
+		if err := writeFile(z, f.name, f.content); err != nil {
+			return err
+		}
+	}
+	for i, s := range sheets {
+		fw, err := z.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return fmt.Errorf("xlsx: %w", err)
+		}
+		if err := writeSheet(fw, s); err != nil {
+			return fmt.Errorf("xlsx: failed to write sheet %q: %w", s.Name, err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	return nil
+}
+
+func writeFile(z *zip.Writer, name, content string) error {
+	fw, err := z.Create(name)
+	if err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	if _, err := io.WriteString(fw, content); err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	return nil
+}
+
+// writeSheet streams the worksheet XML. Text is written as inline strings,
+// so the workbook needs no shared string table.
+func writeSheet(w io.Writer, s Sheet) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(s.Header) > 0 {
+		b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	b.WriteString(`<sheetData>`)
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+
+	row := 1
+	if len(s.Header) > 0 {
+		header := make([]Cell, len(s.Header))
+		for i, h := range s.Header {
+			header[i] = Text(h)
+		}
+		if err := writeRow(w, row, header, headerStyle); err != nil {
+			return err
+		}
+		row++
+	}
+	for _, cells := range s.Rows {
+		if err := writeRow(w, row, cells, 0); err != nil {
+			return err
+		}
+		row++
+	}
+
+	end := `</sheetData>`
+	if len(s.Header) > 0 && row > 1 {
+		end += fmt.Sprintf(`<autoFilter ref="A1:%s%d"/>`, column(len(s.Header)-1), row-1)
+	}
+	end += `</worksheet>`
+	_, err := io.WriteString(w, end)
+	return err
+}
+
+// headerStyle is the bold cell format in styles.
+const headerStyle = 1
+
+func writeRow(w io.Writer, row int, cells []Cell, style int) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, row)
+	for i, c := range cells {
+		ref := column(i) + strconv.Itoa(row)
+		s := ""
+		if style != 0 {
+			s = fmt.Sprintf(` s="%d"`, style)
+		}
+		if c.numeric {
+			if v := c.String(); v != "" {
+				fmt.Fprintf(&b, `<c r="%s"%s><v>%s</v></c>`, ref, s, v)
+			}
+			continue
+		}
+		if c.text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">`, ref, s)
+		if err := xml.EscapeText(&b, []byte(sanitize(c.text))); err != nil {
+			return err
+		}
+		b.WriteString(`</t></is></c>`)
+	}
+	b.WriteString(`</row>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// sanitize drops the control characters XML 1.0 cannot carry.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// column returns the letters of the zero-based column index: A, B, ... Z,
+// AA, AB, ...
+func column(i int) string {
+	var name []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = append([]byte{byte('A' + (i-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+func contentTypes(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+func workbook(sheets []Sheet) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, s := range sheets {
+		b.WriteString(`<sheet name="`)
+		xml.EscapeText(&b, []byte(s.Name))
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+// workbookRels links the sheets as rId1..rIdN and the styles after them.
+func workbookRels(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// styles defines the default cell format and, as format 1, bold text for
+// the header row.
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
@@ -0,0 +1,392 @@
+# GDPR data subject requests. user-service records each export or erasure
+# and starts its state machine; every step runs in the privacy-worker
+# lambda against the user, cart, order and event tables. Exports land in a
+# private bucket that user-service presigns downloads from and that expires
+# them after a week.
+
+resource "aws_s3_bucket" "privacy_exports" {
+  bucket = "${var.project_name}-privacy-exports-${random_string.suffix.result}"
+
+  tags = {
+    Name        = "${var.project_name}-privacy-exports"
+    Environment = var.environment
+  }
+}
+
+resource "aws_s3_bucket_public_access_block" "privacy_exports" {
+  bucket = aws_s3_bucket.privacy_exports.id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "privacy_exports" {
+  bucket = aws_s3_bucket.privacy_exports.id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "privacy_exports" {
+  bucket = aws_s3_bucket.privacy_exports.id
+
+  rule {
+    id     = "expire-exports"
+    status = "Enabled"
+
+    filter {
+      prefix = "exports/"
+    }
+
+    expiration {
+      days = 7
+    }
+  }
+}
+
+resource "aws_iam_role" "privacy_worker" {
+  name = "${var.project_name}-privacy-worker-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-privacy-worker-role"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "privacy_worker" {
+  name = "${var.project_name}-privacy-worker-policy"
+  role = aws_iam_role.privacy_worker.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "logs:CreateLogGroup",
+          "logs:CreateLogStream",
+          "logs:PutLogEvents"
+        ]
+        Resource = "arn:aws:logs:*:*:*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:Query",
+          "dynamodb:Scan",
+          "dynamodb:UpdateItem",
+          "dynamodb:DeleteItem"
+        ]
+        Resource = [
+          data.aws_dynamodb_table.users.arn,
+          aws_dynamodb_table.carts.arn,
+          "${aws_dynamodb_table.carts.arn}/index/*",
+          aws_dynamodb_table.user_merges.arn,
+          aws_dynamodb_table.ad_clicks.arn,
+          "${aws_dynamodb_table.ad_clicks.arn}/index/*",
+          aws_dynamodb_table.privacy_requests.arn
+        ]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:PutObject"]
+        Resource = "${aws_s3_bucket.privacy_exports.arn}/exports/*"
+      }
+    ]
+  })
+}
+
+data "archive_file" "privacy_worker_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/lambda/privacy-worker"
+  output_path = "${path.module}/lambda/privacy-worker.zip"
+}
+
+# The worker fails an export or erasure step when an event table it lists
+# is not set here; add a store to its eventTables together with the table
+# below and in the policy above.
+resource "aws_lambda_function" "privacy_worker" {
+  filename         = data.archive_file.privacy_worker_lambda.output_path
+  source_code_hash = data.archive_file.privacy_worker_lambda.output_base64sha256
+  function_name    = "${var.project_name}-privacy-worker"
+  role             = aws_iam_role.privacy_worker.arn
+  handler          = "main"
+  runtime          = "go1.x"
+  timeout          = 300
+  memory_size      = 512
+
+  environment {
+    variables = {
+      PRIVACY_REQUESTS_TABLE_NAME = aws_dynamodb_table.privacy_requests.name
+      PRIVACY_EXPORT_BUCKET       = aws_s3_bucket.privacy_exports.id
+      USERS_TABLE_NAME            = data.aws_dynamodb_table.users.name
+      CARTS_TABLE_NAME            = aws_dynamodb_table.carts.name
+      USER_MERGES_TABLE_NAME      = aws_dynamodb_table.user_merges.name
+      AD_CLICKS_TABLE_NAME        = aws_dynamodb_table.ad_clicks.name
+      ORDER_SERVICE_URL           = var.order_service_url
+      ENVIRONMENT                 = var.environment
+    }
+  }
+
+  tags = {
+    Name        = "${var.project_name}-privacy-worker"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_log_group" "privacy_worker_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.privacy_worker.function_name}"
+  retention_in_days = 14
+
+  tags = {
+    Name        = "${var.project_name}-privacy-worker-logs"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role" "privacy_workflows" {
+  name = "${var.project_name}-privacy-workflows-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "states.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-privacy-workflows-role"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "privacy_workflows" {
+  name = "${var.project_name}-privacy-workflows-policy"
+  role = aws_iam_role.privacy_workflows.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = aws_lambda_function.privacy_worker.arn
+      }
+    ]
+  })
+}
+
+locals {
+  # Every state runs a privacy-worker action on the execution's request;
+  # failed steps are retried, then the request is marked failed.
+  privacy_retry = [
+    {
+      ErrorEquals     = ["States.TaskFailed", "Lambda.ServiceException", "Lambda.TooManyRequestsException"]
+      IntervalSeconds = 5
+      MaxAttempts     = 3
+      BackoffRate     = 2
+    }
+  ]
+
+  privacy_catch = [
+    {
+      ErrorEquals = ["States.ALL"]
+      ResultPath  = "$.error"
+      Next        = "MarkFailed"
+    }
+  ]
+
+  privacy_request = {
+    "request_id.$" = "$.request_id"
+    "user_id.$"    = "$.user_id"
+    "tenant_id.$"  = "$.tenant_id"
+  }
+
+  privacy_fail_states = {
+    MarkFailed = {
+      Type       = "Task"
+      Resource   = aws_lambda_function.privacy_worker.arn
+      Parameters = merge(local.privacy_request, { action = "fail", "error.$" = "$.error" })
+      Retry      = local.privacy_retry
+      Next       = "Failed"
+    }
+    Failed = {
+      Type  = "Fail"
+      Error = "PrivacyRequestFailed"
+    }
+  }
+
+  privacy_erasure_steps = {
+    EraseCarts      = "erase-carts"
+    AnonymizeOrders = "anonymize-orders"
+    EraseEvents     = "erase-events"
+    EraseMerges     = "erase-merges"
+  }
+}
+
+resource "aws_sfn_state_machine" "privacy_export" {
+  name     = "${var.project_name}-privacy-export"
+  role_arn = aws_iam_role.privacy_workflows.arn
+
+  definition = jsonencode({
+    Comment = "Export a user's data to a downloadable archive"
+    StartAt = "Export"
+    States = merge(local.privacy_fail_states, {
+      Export = {
+        Type       = "Task"
+        Resource   = aws_lambda_function.privacy_worker.arn
+        Parameters = merge(local.privacy_request, { action = "export" })
+        ResultPath = "$.export"
+        Retry      = local.privacy_retry
+        Catch      = local.privacy_catch
+        Next       = "MarkSucceeded"
+      }
+      MarkSucceeded = {
+        Type       = "Task"
+        Resource   = aws_lambda_function.privacy_worker.arn
+        Parameters = merge(local.privacy_request, { action = "complete", "export.$" = "$.export" })
+        Retry      = local.privacy_retry
+        Catch      = local.privacy_catch
+        End        = true
+      }
+    })
+  })
+
+  tags = {
+    Name        = "${var.project_name}-privacy-export"
+    Environment = var.environment
+  }
+}
+
+# Carts, orders, events and merges are erased in parallel; the user record
+# goes last so a failed erasure can be retried against it.
+resource "aws_sfn_state_machine" "privacy_erasure" {
+  name     = "${var.project_name}-privacy-erasure"
+  role_arn = aws_iam_role.privacy_workflows.arn
+
+  definition = jsonencode({
+    Comment = "Erase a user's data, anonymizing orders kept for accounting"
+    StartAt = "EraseRecords"
+    States = merge(local.privacy_fail_states, {
+      EraseRecords = {
+        Type = "Parallel"
+        Branches = [
+          for state, action in local.privacy_erasure_steps : {
+            StartAt = state
+            States = {
+              (state) = {
+                Type       = "Task"
+                Resource   = aws_lambda_function.privacy_worker.arn
+                Parameters = merge(local.privacy_request, { action = action })
+                Retry      = local.privacy_retry
+                End        = true
+              }
+            }
+          }
+        ]
+        ResultPath = "$.results"
+        Catch      = local.privacy_catch
+        Next       = "EraseUser"
+      }
+      EraseUser = {
+        Type       = "Task"
+        Resource   = aws_lambda_function.privacy_worker.arn
+        Parameters = merge(local.privacy_request, { action = "erase-user" })
+        ResultPath = "$.user"
+        Retry      = local.privacy_retry
+        Catch      = local.privacy_catch
+        Next       = "MarkSucceeded"
+      }
+      MarkSucceeded = {
+        Type       = "Task"
+        Resource   = aws_lambda_function.privacy_worker.arn
+        Parameters = merge(local.privacy_request, { action = "complete", "results.$" = "$.results", "user.$" = "$.user" })
+        Retry      = local.privacy_retry
+        Catch      = local.privacy_catch
+        End        = true
+      }
+    })
+  })
+
+  tags = {
+    Name        = "${var.project_name}-privacy-erasure"
+    Environment = var.environment
+  }
+}
+
+# user-service starts the workflows, polls their requests and presigns
+# export downloads.
+resource "aws_iam_role_policy" "ecs_task_privacy" {
+  name = "${var.project_name}-ecs-task-privacy-policy"
+  role = "${var.project_name}-ecs-task-role"
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = ["states:StartExecution"]
+        Resource = [
+          aws_sfn_state_machine.privacy_export.arn,
+          aws_sfn_state_machine.privacy_erasure.arn
+        ]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:Query"
+        ]
+        Resource = [
+          aws_dynamodb_table.privacy_requests.arn,
+          "${aws_dynamodb_table.privacy_requests.arn}/index/*"
+        ]
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "${aws_s3_bucket.privacy_exports.arn}/exports/*"
+      }
+    ]
+  })
+}
+
+output "privacy_export_bucket" {
+  description = "Bucket holding GDPR export archives"
+  value       = aws_s3_bucket.privacy_exports.id
+}
+
+output "privacy_state_machine_arns" {
+  description = "State machines running GDPR export and erasure requests"
+  value = {
+    export  = aws_sfn_state_machine.privacy_export.arn
+    erasure = aws_sfn_state_machine.privacy_erasure.arn
+  }
+}
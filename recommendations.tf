@@ -0,0 +1,74 @@
+# Order events for recommendation-service. EventBridge delivers "Order
+# Completed" events to a queue the service long-polls; events that keep
+# failing move to the dead-letter queue after five attempts.
+resource "aws_sqs_queue" "recommendation_order_events_dlq" {
+  name                      = "${var.project_name}-recommendation-order-events-dlq"
+  message_retention_seconds = 1209600
+  sqs_managed_sse_enabled   = true
+
+  tags = {
+    Name        = "${var.project_name}-recommendation-order-events-dlq"
+    Environment = var.environment
+  }
+}
+
+resource "aws_sqs_queue" "recommendation_order_events" {
+  name                       = "${var.project_name}-recommendation-order-events"
+  visibility_timeout_seconds = 60
+  receive_wait_time_seconds  = 20
+  sqs_managed_sse_enabled    = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.recommendation_order_events_dlq.arn
+    maxReceiveCount     = 5
+  })
+
+  tags = {
+    Name        = "${var.project_name}-recommendation-order-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "recommendation_order_events" {
+  name           = "${var.project_name}-recommendation-order-events"
+  description    = "Completed orders that update co-purchase counts"
+  event_bus_name = aws_cloudwatch_event_bus.ecommerce.name
+
+  event_pattern = jsonencode({
+    source        = ["ecommerce.order-service"]
+    "detail-type" = ["Order Completed"]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-recommendation-order-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_target" "recommendation_order_events" {
+  rule           = aws_cloudwatch_event_rule.recommendation_order_events.name
+  event_bus_name = aws_cloudwatch_event_bus.ecommerce.name
+  target_id      = "RecommendationOrderEvents"
+  arn            = aws_sqs_queue.recommendation_order_events.arn
+}
+
+resource "aws_sqs_queue_policy" "recommendation_order_events" {
+  queue_url = aws_sqs_queue.recommendation_order_events.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = "events.amazonaws.com" }
+        Action    = "sqs:SendMessage"
+        Resource  = aws_sqs_queue.recommendation_order_events.arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = aws_cloudwatch_event_rule.recommendation_order_events.arn
+          }
+        }
+      }
+    ]
+  })
+}
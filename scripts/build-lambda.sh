@@ -42,7 +42,7 @@ build_lambda() {
     
     # Build for Linux
     echo "Building binary..."
-    GOOS=linux GOARCH=amd64 CGO_ENABLED=0 go build -ldflags="-w -s" -o main main.go
+    GOOS=linux GOARCH=amd64 CGO_ENABLED=0 go build -ldflags="-w -s" -o main .
     
     # Check if build was successful
     if [ ! -f "main" ]; then
@@ -63,7 +63,7 @@ build_lambda() {
 }
 
 # Build all Lambda functions
-functions=("campaign-monitor" "bid-optimizer" "ad-analytics")
+functions=("campaign-monitor" "bid-optimizer" "ad-analytics" "quicksight-refresh" "notification-dispatcher" "conversion-uploader" "account-hygiene" "audience-sync" "account-billing" "organic-overlap" "report-exporter" "product-indexer" "user-purge" "privacy-worker" "user-import" "placement-exclusions" "bid-applier" "auction-insights" "keyword-expansion" "landing-page-checker" "remarketing-audit" "ga4-forwarder" "conversion-adjuster")
 
 for function in "${functions[@]}"; do
     build_lambda "$function"
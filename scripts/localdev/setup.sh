@@ -0,0 +1,143 @@
+#!/bin/sh
+
+# Creates what the services read in local development (see
+# docs/LOCAL_DEVELOPMENT.md): their DynamoDB tables in DynamoDB Local, under
+# the default names the services fall back to, plus the Google Ads
+# credentials secret in LocalStack and the fixture account the Google Ads
+# stub answers for. Safe to run again; existing resources are kept.
+#
+# docker compose runs it once the stack is up; against a stack on the host:
+#   DYNAMODB_ENDPOINT=http://localhost:8000 LOCALSTACK_ENDPOINT=http://localhost:4566 scripts/localdev/setup.sh
+set -e
+
+DYNAMODB_ENDPOINT="${DYNAMODB_ENDPOINT:-http://dynamodb-local:8000}"
+LOCALSTACK_ENDPOINT="${LOCALSTACK_ENDPOINT:-http://localstack:4566}"
+export AWS_REGION="${AWS_REGION:-us-east-1}"
+export AWS_ACCESS_KEY_ID="${AWS_ACCESS_KEY_ID:-test}"
+export AWS_SECRET_ACCESS_KEY="${AWS_SECRET_ACCESS_KEY:-test}"
+export AWS_PAGER=""
+
+ddb() {
+    aws --endpoint-url "$DYNAMODB_ENDPOINT" dynamodb "$@"
+}
+
+# attr NAME[:TYPE] prints an attribute definition; TYPE defaults to S.
+attr() {
+    name="${1%%:*}"
+    type=S
+    case "$1" in *:*) type="${1#*:}" ;; esac
+    printf 'AttributeName=%s,AttributeType=%s' "$name" "$type"
+}
+
+# keys HASH [RANGE] prints a key schema.
+keys() {
+    printf 'AttributeName=%s,KeyType=HASH' "${1%%:*}"
+    if [ -n "$2" ]; then
+        printf ' AttributeName=%s,KeyType=RANGE' "${2%%:*}"
+    fi
+}
+
+# table NAME HASH [RANGE] [INDEX INDEX_HASH [INDEX_RANGE]] creates a table,
+# with at most one global secondary index, unless it exists.
+table() {
+    name="$1" hash="$2" range="$3" index="$4" index_hash="$5" index_range="$6"
+    if ddb describe-table --table-name "$name" >/dev/null 2>&1; then
+        echo "Table $name exists"
+        return
+    fi
+
+    attrs="$(attr "$hash")"
+    [ -n "$range" ] && attrs="$attrs $(attr "$range")"
+    if [ -n "$index" ]; then
+        for a in "$index_hash" "$index_range"; do
+            [ -z "$a" ] && continue
+            case " $attrs " in *"AttributeName=${a%%:*},"*) continue ;; esac
+            attrs="$attrs $(attr "$a")"
+        done
+        # shellcheck disable=SC2046
+        ddb create-table --table-name "$name" --billing-mode PAY_PER_REQUEST \
+            --attribute-definitions $attrs \
+            --key-schema $(keys "$hash" "$range") \
+            --global-secondary-indexes "IndexName=$index,KeySchema=[{$(keys "$index_hash" "$index_range" | sed 's/ /},{/')}],Projection={ProjectionType=ALL}" \
+            >/dev/null
+    else
+        # shellcheck disable=SC2046
+        ddb create-table --table-name "$name" --billing-mode PAY_PER_REQUEST \
+            --attribute-definitions $attrs \
+            --key-schema $(keys "$hash" "$range") \
+            >/dev/null
+    fi
+    echo "Created table $name"
+}
+
+# DynamoDB Local takes a moment to accept connections.
+tries=0
+until ddb list-tables >/dev/null 2>&1; do
+    tries=$((tries + 1))
+    if [ "$tries" -ge 30 ]; then
+        echo "DynamoDB Local at $DYNAMODB_ENDPOINT is not answering" >&2
+        exit 1
+    fi
+    sleep 1
+done
+
+echo "Creating tables in $DYNAMODB_ENDPOINT"
+
+# Google Ads
+table google-ads-accounts customer_id
+table google-ads-account-config customer_id
+table google-ads-baselines customer_id campaign_id
+table google-ads-settings-audit scope change_id
+table google-ads-runs function run_id invocation_id-index invocation_id
+table google-ads-approvals approval_id "" status-index status approval_id
+table google-ads-bid-audit customer_id change_id campaign-index campaign_key change_id
+table google-ads-seasonality scope event_id
+table analytics id timestamp
+
+# Storefront
+table users id
+table user-merges anonymous_id
+table user-consent-log user_id id
+table products id
+table product-prices pk sk due-index due due_at:N
+table carts id "" status-last_activity_index status last_activity_at:N
+table checkouts id "" status-saved_at-index status saved_at:N
+table ad-clicks id "" user_id-timestamp-index user_id timestamp
+table attributions order_id "" status-ordered_at-index status ordered_at
+table attribution-models pk sk
+table coupons pk sk
+table inventory sku
+table inventory-reservations id "" order_id-index order_id
+table stock-movements sku id
+table payments id "" order_id-index order_id
+table stripe-webhook-events id
+table co-purchases product_id related_id
+table user-purchases user_id product_id
+table recommendation-orders order_id
+table notifications id
+table notification-preferences user_id
+table email-suppressions email
+table webhooks id
+table webhook-deliveries webhook_id id
+
+# The account cmd/e2e/fixtures/googleads.json answers for.
+ddb put-item --table-name google-ads-accounts --item '{
+  "customer_id": {"S": "1234567890"},
+  "descriptive_name": {"S": "Local Outdoor Store"},
+  "currency_code": {"S": "USD"},
+  "time_zone": {"S": "UTC"},
+  "status": {"S": "ACTIVE"},
+  "monitor_enabled": {"BOOL": true},
+  "optimizer_enabled": {"BOOL": true}
+}'
+echo "Seeded Google Ads account 1234567890"
+
+if aws --endpoint-url "$LOCALSTACK_ENDPOINT" secretsmanager describe-secret --secret-id local/google-ads/credentials >/dev/null 2>&1; then
+    echo "Secret local/google-ads/credentials exists"
+else
+    aws --endpoint-url "$LOCALSTACK_ENDPOINT" secretsmanager create-secret \
+        --name local/google-ads/credentials \
+        --secret-string '{"client_id":"local","client_secret":"local","refresh_token":"local","developer_token":"local"}' \
+        >/dev/null
+    echo "Created secret local/google-ads/credentials"
+fi
@@ -0,0 +1,174 @@
+# Product search: product-indexer consumes the products table stream and
+# keeps the OpenSearch product index in sync; product-service queries it
+# for GET /products/search.
+data "aws_caller_identity" "current" {}
+
+resource "aws_opensearch_domain" "products" {
+  domain_name    = "${var.project_name}-products"
+  engine_version = "OpenSearch_2.11"
+
+  cluster_config {
+    instance_type          = "t3.small.search"
+    instance_count         = 2
+    zone_awareness_enabled = true
+  }
+
+  ebs_options {
+    ebs_enabled = true
+    volume_size = 10
+    volume_type = "gp3"
+  }
+
+  encrypt_at_rest {
+    enabled = true
+  }
+
+  node_to_node_encryption {
+    enabled = true
+  }
+
+  domain_endpoint_options {
+    enforce_https       = true
+    tls_security_policy = "Policy-Min-TLS-1-2-2019-07"
+  }
+
+  # Only the indexer and the ECS tasks may call the domain, with SigV4
+  access_policies = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Principal = {
+          AWS = [
+            aws_iam_role.product_indexer.arn,
+            "arn:aws:iam::${data.aws_caller_identity.current.account_id}:role/${var.project_name}-ecs-task-role"
+          ]
+        }
+        Action   = ["es:ESHttpGet", "es:ESHttpHead", "es:ESHttpPost", "es:ESHttpPut"]
+        Resource = "arn:aws:es:${var.aws_region}:${data.aws_caller_identity.current.account_id}:domain/${var.project_name}-products/*"
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-products"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role" "product_indexer" {
+  name = "${var.project_name}-product-indexer-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-product-indexer-role"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "product_indexer" {
+  name = "${var.project_name}-product-indexer-policy"
+  role = aws_iam_role.product_indexer.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "logs:CreateLogGroup",
+          "logs:CreateLogStream",
+          "logs:PutLogEvents"
+        ]
+        Resource = "arn:aws:logs:*:*:*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:DescribeStream",
+          "dynamodb:GetRecords",
+          "dynamodb:GetShardIterator",
+          "dynamodb:ListStreams"
+        ]
+        Resource = aws_dynamodb_table.products.stream_arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "es:ESHttpHead",
+          "es:ESHttpPost",
+          "es:ESHttpPut"
+        ]
+        Resource = "${aws_opensearch_domain.products.arn}/*"
+      }
+    ]
+  })
+}
+
+data "archive_file" "product_indexer_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/lambda/product-indexer"
+  output_path = "${path.module}/lambda/product-indexer.zip"
+}
+
+resource "aws_lambda_function" "product_indexer" {
+  filename         = data.archive_file.product_indexer_lambda.output_path
+  source_code_hash = data.archive_file.product_indexer_lambda.output_base64sha256
+  function_name    = "${var.project_name}-product-indexer"
+  role             = aws_iam_role.product_indexer.arn
+  handler          = "main"
+  runtime          = "go1.x"
+  timeout          = 60
+
+  environment {
+    variables = {
+      OPENSEARCH_ENDPOINT = aws_opensearch_domain.products.endpoint
+      ENVIRONMENT         = var.environment
+    }
+  }
+
+  tags = {
+    Name        = "${var.project_name}-product-indexer"
+    Environment = var.environment
+  }
+}
+
+# Failed records are reported individually; a batch that keeps failing is
+# split in half until the bad record is isolated.
+resource "aws_lambda_event_source_mapping" "product_indexer" {
+  event_source_arn                   = aws_dynamodb_table.products.stream_arn
+  function_name                      = aws_lambda_function.product_indexer.arn
+  starting_position                  = "TRIM_HORIZON"
+  batch_size                         = 100
+  maximum_batching_window_in_seconds = 1
+  maximum_retry_attempts             = 10
+  bisect_batch_on_function_error     = true
+  function_response_types            = ["ReportBatchItemFailures"]
+}
+
+resource "aws_cloudwatch_log_group" "product_indexer_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.product_indexer.function_name}"
+  retention_in_days = 14
+
+  tags = {
+    Name        = "${var.project_name}-product-indexer-logs"
+    Environment = var.environment
+  }
+}
+
+output "product_search_endpoint" {
+  description = "Endpoint of the OpenSearch domain holding the product index"
+  value       = aws_opensearch_domain.products.endpoint
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/notify"
+	"pkg/problem"
+	"pkg/tenant"
+	"pkg/validate"
+)
+
+// Onboarding statuses, in the order an account moves through them.
+const (
+	AccountStatusPending     = "PENDING"
+	AccountStatusValidating  = "VALIDATING"
+	AccountStatusBackfilling = "BACKFILLING"
+	AccountStatusSeeding     = "SEEDING"
+	AccountStatusActive      = "ACTIVE"
+	AccountStatusFailed      = "FAILED"
+)
+
+const backfillDays = 90
+
+var customerIDPattern = regexp.MustCompile(`^\d{10}$`)
+
+var customerInfoQuery = gaql.Select(
+	"customer.id",
+	"customer.descriptive_name",
+	"customer.currency_code",
+	"customer.time_zone",
+).From("customer").
+	Limit(1).
+	MustBuild()
+
+// Account is a Google Ads account onboarded by a tenant (storefront
+// brand), which alone sees and manages it. Accounts from before tenancy
+// have no TenantID and belong to the default tenant.
+type Account struct {
+	CustomerID       string    `json:"customer_id" dynamodbav:"customer_id"`
+	TenantID         string    `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+	DescriptiveName  string    `json:"descriptive_name" dynamodbav:"descriptive_name"`
+	CurrencyCode     string    `json:"currency_code" dynamodbav:"currency_code"`
+	TimeZone         string    `json:"time_zone" dynamodbav:"time_zone"`
+	Status           string    `json:"status" dynamodbav:"status"`
+	Error            string    `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	MonitorEnabled   bool      `json:"monitor_enabled" dynamodbav:"monitor_enabled"`
+	OptimizerEnabled bool      `json:"optimizer_enabled" dynamodbav:"optimizer_enabled"`
+	BackfilledDays   int       `json:"backfilled_days" dynamodbav:"backfilled_days"`
+	CreatedAt        time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// AccountConfig holds the per-account settings the monitor and optimizer
+// apply. Defaults mirror the values previously hard-coded in the lambdas.
+// Version is bumped on every settings change for optimistic locking.
+type AccountConfig struct {
+	CustomerID          string                      `json:"customer_id" dynamodbav:"customer_id"`
+	Version             int64                       `json:"version" dynamodbav:"version"`
+	Thresholds          AlertThresholds             `json:"thresholds" dynamodbav:"thresholds"`
+	Goals               AccountGoals                `json:"goals" dynamodbav:"goals"`
+	Rules               []OptimizationRule          `json:"rules,omitempty" dynamodbav:"rules,omitempty"`
+	Schedules           map[string]string           `json:"schedules,omitempty" dynamodbav:"schedules,omitempty"`
+	NotificationRouting *notify.RoutingConfig       `json:"notification_routing,omitempty" dynamodbav:"notification_routing,omitempty"`
+	FeatureFlags        map[string]bool             `json:"feature_flags,omitempty" dynamodbav:"feature_flags,omitempty"`
+	OrganicSearch       *OrganicSearch              `json:"organic_search,omitempty" dynamodbav:"organic_search,omitempty"`
+	PlacementExclusions *PlacementExclusions        `json:"placement_exclusions,omitempty" dynamodbav:"placement_exclusions,omitempty"`
+	BudgetConstraints   map[string]BudgetConstraint `json:"budget_constraints,omitempty" dynamodbav:"budget_constraints,omitempty"`
+	BidGuardrails       *BidGuardrails              `json:"bid_guardrails,omitempty" dynamodbav:"bid_guardrails,omitempty"`
+	UpdatedBy           string                      `json:"updated_by,omitempty" dynamodbav:"updated_by,omitempty"`
+	UpdatedAt           time.Time                   `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+type AlertThresholds struct {
+	LowCTR                float64 `json:"low_ctr" dynamodbav:"low_ctr"`
+	LowCTRMinImpressions  int64   `json:"low_ctr_min_impressions" dynamodbav:"low_ctr_min_impressions"`
+	HighCostNoConversions float64 `json:"high_cost_no_conversions" dynamodbav:"high_cost_no_conversions"`
+	HighCPC               float64 `json:"high_cpc" dynamodbav:"high_cpc"`
+}
+
+type AccountGoals struct {
+	TargetCPA           float64 `json:"target_cpa" dynamodbav:"target_cpa"`
+	MaxCPA              float64 `json:"max_cpa" dynamodbav:"max_cpa"`
+	MinBidChangePercent float64 `json:"min_bid_change_percent" dynamodbav:"min_bid_change_percent"`
+}
+
+// CampaignBaseline is the 90-day average performance of a campaign, used by
+// the monitor to judge whether today's numbers are out of the ordinary.
+type CampaignBaseline struct {
+	CustomerID        string    `json:"customer_id" dynamodbav:"customer_id"`
+	CampaignID        string    `json:"campaign_id" dynamodbav:"campaign_id"`
+	CampaignName      string    `json:"campaign_name" dynamodbav:"campaign_name"`
+	Days              int       `json:"days" dynamodbav:"days"`
+	AvgDailyCost      float64   `json:"avg_daily_cost" dynamodbav:"avg_daily_cost"`
+	AvgDailyClicks    float64   `json:"avg_daily_clicks" dynamodbav:"avg_daily_clicks"`
+	AvgCTR            float64   `json:"avg_ctr" dynamodbav:"avg_ctr"`
+	AvgCPC            float64   `json:"avg_cpc" dynamodbav:"avg_cpc"`
+	AvgConversionRate float64   `json:"avg_conversion_rate" dynamodbav:"avg_conversion_rate"`
+	ComputedAt        time.Time `json:"computed_at" dynamodbav:"computed_at"`
+}
+
+// DailyCampaignMetrics rows are written to the shared analytics table.
+type DailyCampaignMetrics struct {
+	ID           string `dynamodbav:"id"`
+	Timestamp    string `dynamodbav:"timestamp"`
+	MetricType   string `dynamodbav:"metric_type"`
+	Service      string `dynamodbav:"service"`
+	CustomerID   string `dynamodbav:"customer_id"`
+	CampaignID   string `dynamodbav:"campaign_id"`
+	CampaignName string `dynamodbav:"campaign_name"`
+	Impressions  int64  `dynamodbav:"impressions"`
+	Clicks       int64  `dynamodbav:"clicks"`
+	CostMicros   int64  `dynamodbav:"cost_micros"`
+	Conversions  int64  `dynamodbav:"conversions"`
+}
+
+type OnboardAccountRequest struct {
+	CustomerID string `json:"customer_id" validate:"required,customer_id"`
+}
+
+func init() {
+	validate.Register("customer_id", func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && customerIDPattern.MatchString(v.String())
+	}, func(string) string { return "must be a 10-digit Google Ads customer ID" })
+}
+
+var errAccountNotFound = errors.New("account not found")
+
+func defaultAccountConfig(customerID string) AccountConfig {
+	return AccountConfig{
+		CustomerID: customerID,
+		Version:    1,
+		Thresholds: AlertThresholds{
+			LowCTR:                0.005,
+			LowCTRMinImpressions:  1000,
+			HighCostNoConversions: 100.0,
+			HighCPC:               5.0,
+		},
+		Goals: AccountGoals{
+			TargetCPA:           50.0,
+			MaxCPA:              100.0,
+			MinBidChangePercent: 0.2,
+		},
+		UpdatedBy: "onboarding",
+		UpdatedAt: clk.Now(),
+	}
+}
+
+func onboardAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var req OnboardAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+
+	req.CustomerID = normalizeCustomerID(req.CustomerID)
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+	customerID := req.CustomerID
+
+	existing, err := loadAccount(r.Context(), customerID)
+	if err != nil && !errors.Is(err, errAccountNotFound) {
+		log.Printf("Failed to get account: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	if err == nil && !tenant.Owns(r.Context(), existing.TenantID) {
+		problem.Write(w, r, problem.New(http.StatusConflict, "Account is onboarded by another tenant"))
+		return
+	}
+	if err == nil && existing.Status != AccountStatusFailed {
+		problem.Write(w, r, problem.New(http.StatusConflict, "Account is already onboarded or onboarding"))
+		return
+	}
+
+	now := clk.Now()
+	account := Account{
+		CustomerID: customerID,
+		TenantID:   tenant.FromContext(r.Context()),
+		Status:     AccountStatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := saveAccount(r.Context(), account); err != nil {
+		log.Printf("Failed to save account: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	// The backfill can take minutes for large accounts, so the workflow runs
+	// detached from the request and progress is polled via GET.
+	recoverer.Go("onboarding "+account.CustomerID, func() {
+		runOnboarding(context.Background(), account)
+	})
+
+	writeJSON(w, http.StatusAccepted, account)
+}
+
+func getAccountHandler(w http.ResponseWriter, r *http.Request) {
+	customerID := normalizeCustomerID(mux.Vars(r)["customerId"])
+
+	account, err := getAccount(r.Context(), customerID)
+	if err != nil {
+		if errors.Is(err, errAccountNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "Account not found"))
+			return
+		}
+		log.Printf("Failed to get account: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account)
+}
+
+func listAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	accounts, err := listAccounts(r.Context())
+	if err != nil {
+		log.Printf("Failed to list accounts: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"accounts": accounts})
+}
+
+// runOnboarding drives an account through validation, backfill, baseline
+// seeding and default config creation. Each step persists the account status
+// so a failure is visible on GET /accounts/{customerId} and can be retried by
+// re-posting the customer ID.
+func runOnboarding(ctx context.Context, account Account) {
+	steps := []struct {
+		status string
+		run    func(context.Context, *Account) error
+	}{
+		{AccountStatusValidating, validateAccountAccess},
+		{AccountStatusBackfilling, backfillAndSeedBaselines},
+		{AccountStatusSeeding, createDefaultConfig},
+	}
+
+	for _, step := range steps {
+		if err := setAccountStatus(ctx, &account, step.status, ""); err != nil {
+			log.Printf("Failed to update onboarding status for %s: %v", account.CustomerID, err)
+			return
+		}
+
+		if err := step.run(ctx, &account); err != nil {
+			log.Printf("Onboarding step %s failed for %s: %v", step.status, account.CustomerID, err)
+			if err := setAccountStatus(ctx, &account, AccountStatusFailed, err.Error()); err != nil {
+				log.Printf("Failed to record onboarding failure for %s: %v", account.CustomerID, err)
+			}
+			return
+		}
+	}
+
+	// Activating the account puts it into the monitor and optimizer rotation.
+	account.MonitorEnabled = true
+	account.OptimizerEnabled = true
+	if err := setAccountStatus(ctx, &account, AccountStatusActive, ""); err != nil {
+		log.Printf("Failed to activate account %s: %v", account.CustomerID, err)
+		return
+	}
+
+	log.Printf("Account %s onboarded successfully", account.CustomerID)
+}
+
+func validateAccountAccess(ctx context.Context, account *Account) error {
+	resp, err := adsClient.Search(ctx, &googleads.SearchGoogleAdsRequest{
+		CustomerId: account.CustomerID,
+		Query:      customerInfoQuery,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to access customer: %w", err)
+	}
+	if len(resp.Results) == 0 || resp.Results[0].Customer == nil {
+		return fmt.Errorf("customer %s returned no data", account.CustomerID)
+	}
+
+	customer := resp.Results[0].Customer
+	account.DescriptiveName = customer.DescriptiveName
+	account.CurrencyCode = customer.CurrencyCode
+	account.TimeZone = customer.TimeZone
+	return nil
+}
+
+func backfillAndSeedBaselines(ctx context.Context, account *Account) error {
+	end := clk.Now().AddDate(0, 0, -1)
+	start := end.AddDate(0, 0, -(backfillDays - 1))
+
+	query, err := gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"segments.date",
+		"metrics.impressions",
+		"metrics.clicks",
+		"metrics.cost_micros",
+		"metrics.conversions",
+	).From("campaign").
+		Where("campaign.status", gaql.NotEquals, "REMOVED").
+		Between("segments.date", start.Format("2006-01-02"), end.Format("2006-01-02")).
+		Build()
+	if err != nil {
+		return err
+	}
+
+	resp, err := adsClient.Search(ctx, &googleads.SearchGoogleAdsRequest{
+		CustomerId: account.CustomerID,
+		Query:      query,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query campaign history: %w", err)
+	}
+
+	var rows []DailyCampaignMetrics
+	for _, row := range resp.Results {
+		rows = append(rows, DailyCampaignMetrics{
+			ID:           fmt.Sprintf("%s#%d", account.CustomerID, row.Campaign.Id),
+			Timestamp:    row.Segments.Date,
+			MetricType:   "campaign_daily",
+			Service:      "google-ads",
+			CustomerID:   account.CustomerID,
+			CampaignID:   fmt.Sprintf("%d", row.Campaign.Id),
+			CampaignName: row.Campaign.Name,
+			Impressions:  row.Metrics.Impressions,
+			Clicks:       row.Metrics.Clicks,
+			CostMicros:   row.Metrics.CostMicros,
+			Conversions:  row.Metrics.Conversions,
+		})
+	}
+
+	if err := writeDailyMetrics(ctx, rows); err != nil {
+		return err
+	}
+
+	for _, baseline := range computeBaselines(account.CustomerID, rows) {
+		item, err := attributevalue.MarshalMap(baseline)
+		if err != nil {
+			return fmt.Errorf("failed to marshal baseline: %w", err)
+		}
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(baselinesTable),
+			Item:      item,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save baseline: %w", err)
+		}
+	}
+
+	account.BackfilledDays = backfillDays
+	return nil
+}
+
+func computeBaselines(customerID string, rows []DailyCampaignMetrics) []CampaignBaseline {
+	type totals struct {
+		name                                   string
+		days                                   int
+		impressions, clicks, costMicros, convs int64
+	}
+
+	byCampaign := make(map[string]*totals)
+	for _, row := range rows {
+		t, ok := byCampaign[row.CampaignID]
+		if !ok {
+			t = &totals{name: row.CampaignName}
+			byCampaign[row.CampaignID] = t
+		}
+		t.days++
+		t.impressions += row.Impressions
+		t.clicks += row.Clicks
+		t.costMicros += row.CostMicros
+		t.convs += row.Conversions
+	}
+
+	var baselines []CampaignBaseline
+	for campaignID, t := range byCampaign {
+		cost := float64(t.costMicros) / 1000000.0
+		baseline := CampaignBaseline{
+			CustomerID:     customerID,
+			CampaignID:     campaignID,
+			CampaignName:   t.name,
+			Days:           t.days,
+			AvgDailyCost:   cost / float64(t.days),
+			AvgDailyClicks: float64(t.clicks) / float64(t.days),
+			ComputedAt:     clk.Now(),
+		}
+		if t.impressions > 0 {
+			baseline.AvgCTR = float64(t.clicks) / float64(t.impressions)
+		}
+		if t.clicks > 0 {
+			baseline.AvgCPC = cost / float64(t.clicks)
+			baseline.AvgConversionRate = float64(t.convs) / float64(t.clicks)
+		}
+		baselines = append(baselines, baseline)
+	}
+
+	return baselines
+}
+
+func createDefaultConfig(ctx context.Context, account *Account) error {
+	item, err := attributevalue.MarshalMap(defaultAccountConfig(account.CustomerID))
+	if err != nil {
+		return fmt.Errorf("failed to marshal account config: %w", err)
+	}
+
+	// Never clobber a config someone already tuned, e.g. when re-onboarding
+	// an account after a failed attempt.
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(accountConfigTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(customer_id)"),
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return fmt.Errorf("failed to save account config: %w", err)
+	}
+
+	return nil
+}
+
+// DynamoDB operations
+func writeDailyMetrics(ctx context.Context, rows []DailyCampaignMetrics) error {
+	const batchSize = 25
+
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var requests []types.WriteRequest
+		for _, row := range rows[start:end] {
+			item, err := attributevalue.MarshalMap(row)
+			if err != nil {
+				return fmt.Errorf("failed to marshal daily metrics: %w", err)
+			}
+			requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+		}
+
+		pending := map[string][]types.WriteRequest{analyticsTable: requests}
+		for attempt := 0; len(pending) > 0 && attempt < 5; attempt++ {
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt*100) * time.Millisecond)
+			}
+			resp, err := dynamoClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return fmt.Errorf("failed to write daily metrics: %w", err)
+			}
+			pending = resp.UnprocessedItems
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("failed to write daily metrics: unprocessed items remain after retries")
+		}
+	}
+
+	return nil
+}
+
+func saveAccount(ctx context.Context, account Account) error {
+	item, err := attributevalue.MarshalMap(account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal account: %w", err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(accountsTable),
+		Item:      item,
+	})
+
+	return err
+}
+
+func setAccountStatus(ctx context.Context, account *Account, status, errMessage string) error {
+	account.Status = status
+	account.Error = errMessage
+	account.UpdatedAt = clk.Now()
+	return saveAccount(ctx, *account)
+}
+
+// getAccount returns the account if it belongs to ctx's tenant, and
+// errAccountNotFound otherwise.
+func getAccount(ctx context.Context, customerID string) (Account, error) {
+	account, err := loadAccount(ctx, customerID)
+	if err != nil {
+		return Account{}, err
+	}
+	if !tenant.Owns(ctx, account.TenantID) {
+		return Account{}, errAccountNotFound
+	}
+	return account, nil
+}
+
+// loadAccount returns the account whichever tenant it belongs to.
+func loadAccount(ctx context.Context, customerID string) (Account, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(accountsTable),
+		ConsistentRead: aws.Bool(consistentReads),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberS{Value: customerID},
+		},
+	})
+	if err != nil {
+		return Account{}, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return Account{}, errAccountNotFound
+	}
+
+	var account Account
+	if err := attributevalue.UnmarshalMap(result.Item, &account); err != nil {
+		return Account{}, fmt.Errorf("failed to unmarshal account: %w", err)
+	}
+
+	return account, nil
+}
+
+// listAccounts returns the accounts of ctx's tenant.
+func listAccounts(ctx context.Context) ([]Account, error) {
+	filter, names, value := tenant.Filter(ctx)
+	result, err := dynamoClient.Scan(ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String(accountsTable),
+		ConsistentRead:            aws.Bool(consistentReads),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: map[string]types.AttributeValue{":tenant": &types.AttributeValueMemberS{Value: value}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan accounts: %w", err)
+	}
+
+	var accounts []Account
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// requireAccountTenant answers 404 for a request naming, as its
+// customerId or settings scope, an account of another tenant, so every
+// per-account route is scoped without each handler checking. Settings of
+// customer IDs never onboarded predate tenancy and stay with the default
+// tenant, as do changes to the global settings every account inherits.
+func requireAccountTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		customerID, ok := vars["customerId"]
+		if !ok {
+			customerID = vars["scope"]
+		}
+		customerID = normalizeCustomerID(customerID)
+		defaultTenant := tenant.FromContext(r.Context()) == tenant.Default
+
+		if customerID == GlobalScope && r.Method != http.MethodGet && !defaultTenant {
+			problem.Write(w, r, problem.New(http.StatusForbidden, "Only the default tenant can change global settings"))
+			return
+		}
+		if !customerIDPattern.MatchString(customerID) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		account, err := loadAccount(r.Context(), customerID)
+		switch {
+		case errors.Is(err, errAccountNotFound) && defaultTenant:
+		case errors.Is(err, errAccountNotFound):
+			problem.Write(w, r, problem.New(http.StatusNotFound, "Account not found"))
+			return
+		case err != nil:
+			log.Printf("Failed to get account: %v", err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+			return
+		case !tenant.Owns(r.Context(), account.TenantID):
+			problem.Write(w, r, problem.New(http.StatusNotFound, "Account not found"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func normalizeCustomerID(customerID string) string {
+	return strings.ReplaceAll(strings.TrimSpace(customerID), "-", "")
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/gorilla/mux"
+
+	"pkg/approval"
+	"pkg/dynamo"
+	"pkg/problem"
+)
+
+// approvalsScope is the token scope that allows deciding bid changes.
+const approvalsScope = "approvals"
+
+// linkActor is the decider recorded for decisions made through a signed
+// link, which carries no identity of its own.
+const linkActor = "link"
+
+const (
+	defaultApprovalsLimit = 50
+	maxApprovalsLimit     = 200
+)
+
+var (
+	approvals *approval.Store
+	// linkSigner verifies one-click links; nil when no signing key is
+	// configured, in which case links are refused.
+	linkSigner *approval.Signer
+)
+
+var approvalStatuses = map[string]bool{
+	approval.StatusPending:     true,
+	approval.StatusApproved:    true,
+	approval.StatusRejected:    true,
+	approval.StatusExpired:     true,
+	approval.StatusApplied:     true,
+	approval.StatusApplyFailed: true,
+}
+
+// loadLinkSigner reads the key one-click links are signed with.
+func loadLinkSigner(ctx context.Context, cfg aws.Config, secretARN string) (*approval.Signer, error) {
+	result, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretARN),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+	// Links are only verified here, so the base URL is not needed.
+	return approval.NewSigner([]byte(aws.ToString(result.SecretString)), ""), nil
+}
+
+// approver returns the user deciding, answering 401 or 403 when the caller
+// may not decide bid changes.
+func approver(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := r.Header.Get("X-User-Id")
+	if user == "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "Bid changes are decided by signed-in users"))
+		return "", false
+	}
+	for _, scope := range strings.Fields(r.Header.Get("X-Auth-Scope")) {
+		if scope == approvalsScope {
+			if email := r.Header.Get("X-User-Email"); email != "" {
+				return email, true
+			}
+			return user, true
+		}
+	}
+	problem.Write(w, r, problem.New(http.StatusForbidden, "The "+approvalsScope+" scope is required to decide bid changes"))
+	return "", false
+}
+
+// listApprovalsHandler returns a page of bid changes in one status,
+// PENDING by default, oldest first. Pass the response's next_cursor as
+// cursor for the following page.
+func listApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := approver(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	status := strings.ToUpper(query.Get("status"))
+	if status == "" {
+		status = approval.StatusPending
+	}
+	if !approvalStatuses[status] {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("Unknown status %q", status)))
+		return
+	}
+	limit := defaultApprovalsLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxApprovalsLimit {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxApprovalsLimit)))
+			return
+		}
+		limit = n
+	}
+
+	page, err := approvals.List(r.Context(), status, int32(limit), query.Get("cursor"))
+	if err != nil {
+		log.Printf("Failed to list approvals: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	response := map[string]interface{}{"approvals": page.Items}
+	if page.Next != nil && len(page.Items) > 0 {
+		response["next_cursor"] = page.Items[len(page.Items)-1].ApprovalID
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func getApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := approver(w, r); !ok {
+		return
+	}
+	item, err := approvals.Get(r.Context(), mux.Vars(r)["approvalId"])
+	if err != nil {
+		writeApprovalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// decideApprovalHandler approves or rejects a pending change, with an
+// optional {"note": "..."} body.
+func decideApprovalHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := approver(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Note string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+			return
+		}
+
+		item, err := approvals.Decide(r.Context(), mux.Vars(r)["approvalId"], approve, actor, req.Note)
+		if err != nil {
+			writeApprovalError(w, r, err)
+			return
+		}
+		log.Printf("Approval %s %s by %s", item.ApprovalID, item.Status, actor)
+		writeJSON(w, http.StatusOK, item)
+	}
+}
+
+// approvalLinkPage confirms a one-click decision. The link itself only
+// shows this page: chat apps fetch links to preview them, which must not
+// decide anything.
+var approvalLinkPage = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Verb}} bid change</title></head>
+<body>
+<p>{{.Verb}} changing the bid of <strong>{{.Item.KeywordText}}</strong> in {{.Item.CampaignName}}
+from {{.Item.CurrentBid}} to {{.Item.RecommendedBid}}?</p>
+<p>{{.Item.Reason}}</p>
+<form method="post"><button type="submit">{{.Verb}}</button></form>
+</body></html>
+`))
+
+// approvalLinkHandler serves the one-click links in Slack and email
+// reports: GET shows the change with a button, which POSTs back to the
+// same link to decide it. The signature stands in for the token, so the
+// gateway routes these without one.
+func approvalLinkHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, action := vars["approvalId"], vars["action"]
+	if action != approval.ActionApprove && action != approval.ActionReject {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Unknown action"))
+		return
+	}
+	if linkSigner == nil {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Approval links are not enabled"))
+		return
+	}
+
+	query := r.URL.Query()
+	err := linkSigner.Verify(id, action, query.Get("expires"), query.Get("signature"), clk.Now())
+	if errors.Is(err, approval.ErrLinkExpired) {
+		problem.Write(w, r, problem.New(http.StatusGone, "This link has expired"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusForbidden, "This link is not valid"))
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		item, err := approvals.Get(r.Context(), id)
+		if err != nil {
+			writeApprovalError(w, r, err)
+			return
+		}
+		verb := "Approve"
+		if action == approval.ActionReject {
+			verb = "Reject"
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := approvalLinkPage.Execute(w, map[string]interface{}{"Verb": verb, "Item": item}); err != nil {
+			log.Printf("Failed to render approval link page: %v", err)
+		}
+		return
+	}
+
+	item, err := approvals.Decide(r.Context(), id, action == approval.ActionApprove, linkActor, "")
+	if err != nil {
+		writeApprovalError(w, r, err)
+		return
+	}
+	log.Printf("Approval %s %s by signed link", item.ApprovalID, item.Status)
+	writeJSON(w, http.StatusOK, item)
+}
+
+func writeApprovalError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, dynamo.ErrNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Approval not found"))
+	case errors.Is(err, approval.ErrNotPending):
+		problem.Write(w, r, problem.New(http.StatusConflict, "This change has already been decided"))
+	case errors.Is(err, approval.ErrWindowClosed):
+		problem.Write(w, r, problem.New(http.StatusGone, "The decision window for this change has closed"))
+	default:
+		log.Printf("Failed to handle approval: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/bidaudit"
+	"pkg/problem"
+	"pkg/tenant"
+)
+
+// auditScope is the token scope that allows reading the bid audit log.
+const auditScope = "audit"
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 500
+	// defaultAuditDays is the range read when from is not given, ending
+	// today.
+	defaultAuditDays = 30
+	maxAuditDays     = 366
+)
+
+var bidAudit *bidaudit.Store
+
+var auditTypes = map[string]bool{
+	bidaudit.TypeKeywordBid: true,
+	bidaudit.TypeAdSchedule: true,
+	bidaudit.TypeBudget:     true,
+}
+
+// auditReader answers 401 or 403 unless the caller is a user or API client
+// with the audit scope.
+func auditReader(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-User-Id") == "" && r.Header.Get("X-Client-Id") == "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "The bid audit log is available to authenticated users and API clients"))
+		return false
+	}
+	for _, scope := range strings.Fields(r.Header.Get("X-Auth-Scope")) {
+		if scope == auditScope {
+			return true
+		}
+	}
+	problem.Write(w, r, problem.New(http.StatusForbidden, "The "+auditScope+" scope is required to read the bid audit log"))
+	return false
+}
+
+// listBidChangesHandler returns a page of an account's applied bid
+// changes, newest first: ?customer= is required; campaign, type and from
+// and to (YYYY-MM-DD, inclusive; the last defaultAuditDays by default)
+// narrow it. Pass the response's next_cursor as cursor for the following
+// page.
+func listBidChangesHandler(w http.ResponseWriter, r *http.Request) {
+	if !auditReader(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := bidaudit.Filter{
+		CustomerID: normalizeCustomerID(query.Get("customer")),
+		CampaignID: query.Get("campaign"),
+		Type:       strings.ToUpper(query.Get("type")),
+	}
+	if filter.CustomerID == "" {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "customer is required"))
+		return
+	}
+	if filter.Type != "" && !auditTypes[filter.Type] {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("type must be one of %s", strings.Join(bidaudit.Types, ", "))))
+		return
+	}
+	var err error
+	filter.From, filter.To, err = parseAuditRange(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+	limit := defaultAuditLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit)))
+			return
+		}
+		limit = n
+	}
+
+	// The account comes from the query rather than the path, so
+	// requireAccountTenant does not cover it.
+	account, err := loadAccount(r.Context(), filter.CustomerID)
+	defaultTenant := tenant.FromContext(r.Context()) == tenant.Default
+	switch {
+	case errors.Is(err, errAccountNotFound) && defaultTenant:
+	case errors.Is(err, errAccountNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Account not found"))
+		return
+	case err != nil:
+		log.Printf("Failed to get account: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	case !tenant.Owns(r.Context(), account.TenantID):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Account not found"))
+		return
+	}
+
+	page, err := bidAudit.List(r.Context(), filter, int32(limit), query.Get("cursor"))
+	if err != nil {
+		log.Printf("Failed to list bid changes: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	response := map[string]interface{}{
+		"changes": page.Items,
+		"from":    filter.From.Format("2006-01-02"),
+		"to":      filter.To.Format("2006-01-02"),
+	}
+	if page.Next != nil && len(page.Items) > 0 {
+		response["next_cursor"] = page.Items[len(page.Items)-1].ChangeID
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// parseAuditRange reads from and to (YYYY-MM-DD, inclusive). to defaults
+// to today, as changes are logged as they are applied, and from to
+// defaultAuditDays before it.
+func parseAuditRange(r *http.Request) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	now := clk.Now().UTC()
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if value := q.Get("to"); value != "" {
+		if to, err = time.Parse("2006-01-02", value); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+		}
+	}
+	from = to.AddDate(0, 0, -(defaultAuditDays - 1))
+	if value := q.Get("from"); value != "" {
+		if from, err = time.Parse("2006-01-02", value); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+		}
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxAuditDays {
+		return time.Time{}, time.Time{}, fmt.Errorf("range must not exceed %d days", maxAuditDays)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"pkg/health"
+)
+
+// newReadiness returns the checks behind /health/ready. The accounts,
+// config and runs tables and the Google Ads credentials are critical:
+// without them no request can be served.
+func newReadiness(cfg aws.Config) *health.Checker {
+	secrets := secretsmanager.NewFromConfig(cfg)
+	checks := []health.Check{
+		health.Table(dynamoClient, accountsTable, true),
+		health.Table(dynamoClient, accountConfigTable, true),
+		health.Table(dynamoClient, runsTable, true),
+		health.Table(dynamoClient, baselinesTable, false),
+		health.Table(dynamoClient, settingsAuditTable, false),
+		health.Table(dynamoClient, analyticsTable, false),
+		secretCheck(secrets, "google-ads-credentials", os.Getenv("GOOGLE_ADS_SECRET_ARN"), true),
+	}
+	if secretARN := os.Getenv("APPROVAL_SIGNING_SECRET_ARN"); secretARN != "" {
+		checks = append(checks, secretCheck(secrets, "approval-signing-key", secretARN, false))
+	}
+	return health.NewChecker("ads-api", clk, checks...)
+}
+
+// secretCheck checks that the task role can still describe the secret.
+// Describing it proves access without pulling its value on every probe.
+func secretCheck(svc *secretsmanager.Client, name, secretID string, critical bool) health.Check {
+	return health.Check{
+		Name:     "secretsmanager:" + name,
+		Critical: critical,
+		Run: func(ctx context.Context) error {
+			_, err := svc.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretID)})
+			return err
+		},
+	}
+}
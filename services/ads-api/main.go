@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/gorilla/mux"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/approval"
+	"pkg/bidaudit"
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/recovery"
+	"pkg/seasonality"
+	"pkg/tenant"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient       *dynamodb.Client
+	adsClient          *googleads.Service
+	accountsTable      string
+	accountConfigTable string
+	baselinesTable     string
+	settingsAuditTable string
+	analyticsTable     string
+	runsTable          string
+	serverPort         string
+	version            = "1.0.0"
+
+	// clk is the time source for timestamps and baseline windows;
+	// deterministic when TEST_MODE=true.
+	clk clock.Clock = clock.Real{}
+	// consistentReads makes reads strongly consistent so tests can read
+	// their own writes.
+	consistentReads bool
+
+	// recoverer reports panics in handlers and onboarding workflows.
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	accountsTable = getEnv("ACCOUNTS_TABLE_NAME", "google-ads-accounts")
+	accountConfigTable = getEnv("ACCOUNT_CONFIG_TABLE_NAME", "google-ads-account-config")
+	baselinesTable = getEnv("BASELINES_TABLE_NAME", "google-ads-baselines")
+	settingsAuditTable = getEnv("SETTINGS_AUDIT_TABLE_NAME", "google-ads-settings-audit")
+	analyticsTable = getEnv("ANALYTICS_TABLE_NAME", "analytics")
+	runsTable = getEnv("RUNS_TABLE_NAME", "google-ads-runs")
+	serverPort = getEnv("PORT", "3000")
+
+	clk = clock.FromEnv()
+	consistentReads = clock.TestMode()
+	recoverer = recovery.New("ads-api", clk, ids.FromEnv(clk))
+
+	approvals = approval.NewStore(dynamo.NewTable(dynamoClient, getEnv("APPROVALS_TABLE_NAME", "google-ads-approvals"),
+		dynamo.WithConsistentReads(consistentReads)), clk)
+	bidAudit = bidaudit.NewStore(dynamo.NewTable(dynamoClient, getEnv("BID_AUDIT_TABLE_NAME", "google-ads-bid-audit"),
+		dynamo.WithConsistentReads(consistentReads)), clk)
+	seasons = seasonality.NewStore(dynamo.NewTable(dynamoClient, getEnv("SEASONALITY_TABLE_NAME", "google-ads-seasonality"),
+		dynamo.WithConsistentReads(consistentReads)), clk)
+	eventIDs = ids.FromEnv(clk)
+	if secretARN := os.Getenv("APPROVAL_SIGNING_SECRET_ARN"); secretARN != "" {
+		linkSigner, err = loadLinkSigner(ctx, cfg, secretARN)
+		if err != nil {
+			log.Fatalf("Failed to load approval signing key: %v", err)
+		}
+	}
+
+	// Initialize Google Ads client
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg, os.Getenv("GOOGLE_ADS_SECRET_ARN"))
+	if err != nil {
+		log.Fatalf("Failed to load Google Ads config: %v", err)
+	}
+
+	adsClient, err = createGoogleAdsClient(ctx, adsConfig)
+	if err != nil {
+		log.Fatalf("Failed to create Google Ads client: %v", err)
+	}
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware)
+	router.Use(tenant.Middleware, requireAccountTenant)
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", newReadiness(cfg).Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock, consistent reads")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+	}
+
+	// Account onboarding endpoints
+	router.HandleFunc("/accounts", onboardAccountHandler).Methods("POST")
+	router.HandleFunc("/accounts", listAccountsHandler).Methods("GET")
+	router.HandleFunc("/accounts/{customerId}", getAccountHandler).Methods("GET")
+
+	// Streaming reports (NDJSON by default, CSV with ?format=csv)
+	router.HandleFunc("/accounts/{customerId}/reports/keywords", keywordReportHandler).Methods("GET")
+
+	// Historical trends, rolled up to DAILY/WEEKLY/MONTHLY with gaps filled
+	router.HandleFunc("/accounts/{customerId}/campaigns/{campaignId}/trends", campaignTrendHandler).Methods("GET")
+	router.HandleFunc("/accounts/{customerId}/ad-groups/{adGroupId}/keywords/{keywordId}/trends", keywordTrendHandler).Methods("GET")
+
+	// Budget what-if simulator
+	router.HandleFunc("/accounts/{customerId}/campaigns/{campaignId}/what-if", whatIfHandler).Methods("POST")
+
+	// Run history with the configuration each run applied
+	router.HandleFunc("/runs/{function}", listRunsHandler).Methods("GET")
+	router.HandleFunc("/runs/{function}/{runId}", getRunHandler).Methods("GET")
+
+	// Bid changes awaiting a decision; see pkg/approval
+	router.HandleFunc("/approvals", listApprovalsHandler).Methods("GET")
+	router.HandleFunc("/approvals/{approvalId}", getApprovalHandler).Methods("GET")
+	router.HandleFunc("/approvals/{approvalId}/approve", decideApprovalHandler(true)).Methods("POST")
+	router.HandleFunc("/approvals/{approvalId}/reject", decideApprovalHandler(false)).Methods("POST")
+	router.HandleFunc("/approval-links/{approvalId}/{action}", approvalLinkHandler).Methods("GET", "POST")
+
+	// Applied bid changes; see pkg/bidaudit
+	router.HandleFunc("/audit/bid-changes", listBidChangesHandler).Methods("GET")
+
+	// Settings endpoints (scope is "global" or a customer ID)
+	router.HandleFunc("/settings/{scope}", getSettingsHandler).Methods("GET")
+	router.HandleFunc("/settings/{scope}/history", getSettingsHistoryHandler).Methods("GET")
+	router.HandleFunc("/settings/{scope}/{section}", getSettingsSectionHandler).Methods("GET")
+	router.HandleFunc("/settings/{scope}/{section}", updateSettingsSectionHandler).Methods("PUT")
+
+	// Seasonality calendar (scope is "global" or a customer ID); see
+	// pkg/seasonality
+	router.HandleFunc("/seasonality/{scope}/events", listSeasonalityEventsHandler).Methods("GET")
+	router.HandleFunc("/seasonality/{scope}/events", createSeasonalityEventHandler).Methods("POST")
+	router.HandleFunc("/seasonality/{scope}/events/{eventId}", getSeasonalityEventHandler).Methods("GET")
+	router.HandleFunc("/seasonality/{scope}/events/{eventId}", deleteSeasonalityEventHandler).Methods("DELETE")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 30 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Ads API starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "ads-api",
+		Version:   version,
+	})
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config, secretARN string) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretARN),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+func createGoogleAdsClient(ctx context.Context, adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	opts := []option.ClientOption{
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	}
+	// GOOGLE_ADS_ENDPOINT points the client at a stand-in API such as the
+	// stub server of local development.
+	if endpoint := os.Getenv("GOOGLE_ADS_ENDPOINT"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+
+	srv, err := googleads.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
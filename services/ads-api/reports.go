@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/problem"
+	"pkg/stream"
+)
+
+// reportPageSize is the Search page size used for streamed reports.
+const reportPageSize = 1000
+
+// KeywordReportRow is one keyword's performance over the requested range.
+type KeywordReportRow struct {
+	CustomerID     string  `json:"customer_id"`
+	CampaignID     string  `json:"campaign_id"`
+	CampaignName   string  `json:"campaign_name"`
+	AdGroupID      string  `json:"ad_group_id"`
+	AdGroupName    string  `json:"ad_group_name"`
+	KeywordID      string  `json:"keyword_id"`
+	KeywordText    string  `json:"keyword_text"`
+	MatchType      string  `json:"match_type"`
+	Impressions    int64   `json:"impressions"`
+	Clicks         int64   `json:"clicks"`
+	Cost           float64 `json:"cost"`
+	Conversions    int64   `json:"conversions"`
+	CTR            float64 `json:"ctr"`
+	CPC            float64 `json:"cpc"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+func (k KeywordReportRow) CSVHeader() []string {
+	return []string{
+		"customer_id", "campaign_id", "campaign_name", "ad_group_id", "ad_group_name",
+		"keyword_id", "keyword_text", "match_type", "impressions", "clicks", "cost",
+		"conversions", "ctr", "cpc", "conversion_rate",
+	}
+}
+
+func (k KeywordReportRow) CSVRow() []string {
+	return []string{
+		k.CustomerID, k.CampaignID, k.CampaignName, k.AdGroupID, k.AdGroupName,
+		k.KeywordID, k.KeywordText, k.MatchType,
+		strconv.FormatInt(k.Impressions, 10),
+		strconv.FormatInt(k.Clicks, 10),
+		strconv.FormatFloat(k.Cost, 'f', 2, 64),
+		strconv.FormatInt(k.Conversions, 10),
+		strconv.FormatFloat(k.CTR, 'f', 4, 64),
+		strconv.FormatFloat(k.CPC, 'f', 2, 64),
+		strconv.FormatFloat(k.ConversionRate, 'f', 4, 64),
+	}
+}
+
+var reportDateRanges = map[string]gaql.DateRange{
+	"LAST_7_DAYS":  gaql.Last7Days,
+	"LAST_14_DAYS": gaql.Last14Days,
+	"LAST_30_DAYS": gaql.Last30Days,
+	"THIS_MONTH":   gaql.ThisMonth,
+	"LAST_MONTH":   gaql.LastMonth,
+}
+
+// keywordReportHandler streams keyword performance for an account as NDJSON
+// or CSV, writing each Search page as it arrives.
+func keywordReportHandler(w http.ResponseWriter, r *http.Request) {
+	customerID := normalizeCustomerID(mux.Vars(r)["customerId"])
+	if !customerIDPattern.MatchString(customerID) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "customer_id must be a 10-digit Google Ads customer ID"))
+		return
+	}
+
+	format, err := stream.FormatFromRequest(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	during := gaql.Last30Days
+	if value := r.URL.Query().Get("during"); value != "" {
+		var ok bool
+		if during, ok = reportDateRanges[value]; !ok {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("unsupported date range %q", value)))
+			return
+		}
+	}
+
+	query, err := gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"ad_group.id",
+		"ad_group.name",
+		"ad_group_criterion.criterion_id",
+		"ad_group_criterion.keyword.text",
+		"ad_group_criterion.keyword.match_type",
+		"metrics.impressions",
+		"metrics.clicks",
+		"metrics.cost_micros",
+		"metrics.conversions",
+		"metrics.ctr",
+		"metrics.average_cpc",
+		"metrics.conversion_rate",
+	).From("keyword_view").
+		Where("ad_group_criterion.status", gaql.NotEquals, "REMOVED").
+		During(during).
+		Build()
+	if err != nil {
+		log.Printf("Failed to build keyword report query: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	sw := stream.NewWriter(w, format, "keywords-"+customerID)
+	err = searchPages(r.Context(), customerID, query, func(rows []*googleads.GoogleAdsRow) error {
+		sw.ExtendDeadline(30 * time.Second)
+		for _, row := range rows {
+			if err := sw.Write(keywordReportRow(customerID, row)); err != nil {
+				return err
+			}
+		}
+		sw.Flush()
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to stream keyword report for %s after %d rows: %v", customerID, sw.Rows(), err)
+		sw.Abort(fmt.Errorf("report failed"))
+		return
+	}
+
+	if err := sw.Close(); err != nil {
+		log.Printf("Failed to finish keyword report for %s: %v", customerID, err)
+	}
+}
+
+func keywordReportRow(customerID string, row *googleads.GoogleAdsRow) KeywordReportRow {
+	return KeywordReportRow{
+		CustomerID:     customerID,
+		CampaignID:     fmt.Sprintf("%d", row.Campaign.Id),
+		CampaignName:   row.Campaign.Name,
+		AdGroupID:      fmt.Sprintf("%d", row.AdGroup.Id),
+		AdGroupName:    row.AdGroup.Name,
+		KeywordID:      fmt.Sprintf("%d", row.AdGroupCriterion.CriterionId),
+		KeywordText:    row.AdGroupCriterion.Keyword.Text,
+		MatchType:      row.AdGroupCriterion.Keyword.MatchType.String(),
+		Impressions:    row.Metrics.Impressions,
+		Clicks:         row.Metrics.Clicks,
+		Cost:           float64(row.Metrics.CostMicros) / 1000000.0,
+		Conversions:    row.Metrics.Conversions,
+		CTR:            row.Metrics.Ctr,
+		CPC:            float64(row.Metrics.AverageCpc) / 1000000.0,
+		ConversionRate: row.Metrics.ConversionRate,
+	}
+}
+
+// searchPages runs a Search query page by page, handing each page to fn so
+// callers never hold the whole result set.
+func searchPages(ctx context.Context, customerID, query string, fn func([]*googleads.GoogleAdsRow) error) error {
+	pageToken := ""
+	for {
+		resp, err := adsClient.Search(ctx, &googleads.SearchGoogleAdsRequest{
+			CustomerId: customerID,
+			Query:      query,
+			PageToken:  pageToken,
+			PageSize:   reportPageSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to search: %w", err)
+		}
+		if err := fn(resp.Results); err != nil {
+			return err
+		}
+		if resp.NextPageToken == "" {
+			return nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/problem"
+	"pkg/runlog"
+)
+
+// Scheduled functions that record their runs.
+var runFunctions = map[string]bool{
+	"campaign-monitor": true,
+	"bid-optimizer":    true,
+}
+
+const (
+	defaultRunsLimit = 20
+	maxRunsLimit     = 100
+)
+
+var errRunNotFound = errors.New("run not found")
+
+// listRunsHandler returns a function's most recent runs, newest first,
+// each with the configuration snapshot it applied.
+func listRunsHandler(w http.ResponseWriter, r *http.Request) {
+	function := mux.Vars(r)["function"]
+	if !runFunctions[function] {
+		problem.Write(w, r, problem.New(http.StatusNotFound, fmt.Sprintf("Unknown function %q", function)))
+		return
+	}
+
+	limit := defaultRunsLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxRunsLimit {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxRunsLimit)))
+			return
+		}
+		limit = n
+	}
+
+	runs, err := listRuns(r.Context(), function, limit)
+	if err != nil {
+		log.Printf("Failed to list runs: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"runs": runs})
+}
+
+// getRunHandler returns one run, so a past alert or recommendation can be
+// traced through its run_id to the exact configuration behind it.
+func getRunHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !runFunctions[vars["function"]] {
+		problem.Write(w, r, problem.New(http.StatusNotFound, fmt.Sprintf("Unknown function %q", vars["function"])))
+		return
+	}
+
+	run, err := getRun(r.Context(), vars["function"], vars["runId"])
+	if errors.Is(err, errRunNotFound) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Run not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get run: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, run)
+}
+
+func listRuns(ctx context.Context, function string, limit int) ([]runlog.Run, error) {
+	result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(runsTable),
+		ConsistentRead:         aws.Bool(consistentReads),
+		KeyConditionExpression: aws.String("#function = :function"),
+		ExpressionAttributeNames: map[string]string{
+			"#function": "function",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":function": &types.AttributeValueMemberS{Value: function},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs: %w", err)
+	}
+
+	runs := []runlog.Run{}
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &runs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+func getRun(ctx context.Context, function, runID string) (*runlog.Run, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(runsTable),
+		ConsistentRead: aws.Bool(consistentReads),
+		Key: map[string]types.AttributeValue{
+			"function": &types.AttributeValueMemberS{Value: function},
+			"run_id":   &types.AttributeValueMemberS{Value: runID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run: %w", err)
+	}
+	if result.Item == nil {
+		return nil, errRunNotFound
+	}
+
+	var run runlog.Run
+	if err := attributevalue.UnmarshalMap(result.Item, &run); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+
+	return &run, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/api/googleads"
+
+	"pkg/ids"
+	"pkg/problem"
+	"pkg/seasonality"
+)
+
+var (
+	seasons  *seasonality.Store
+	eventIDs ids.Generator
+)
+
+// SeasonalityEventRequest is the body of POST /seasonality/{scope}/events.
+// Dates are YYYY-MM-DD, both included; see seasonality.Event for the
+// multipliers.
+type SeasonalityEventRequest struct {
+	Name                   string   `json:"name"`
+	StartDate              string   `json:"start_date"`
+	EndDate                string   `json:"end_date"`
+	BidMultiplier          float64  `json:"bid_multiplier,omitempty"`
+	BudgetMultiplier       float64  `json:"budget_multiplier,omitempty"`
+	ConversionRateModifier float64  `json:"conversion_rate_modifier,omitempty"`
+	CampaignIDs            []string `json:"campaign_ids,omitempty"`
+}
+
+func listSeasonalityEventsHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := settingsScope(w, r)
+	if !ok {
+		return
+	}
+	events, err := seasons.List(r.Context(), scope)
+	if err != nil {
+		log.Printf("Failed to list seasonality events: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	if events == nil {
+		events = []seasonality.Event{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"events": events})
+}
+
+// createSeasonalityEventHandler adds an event to the scope's calendar.
+// Events are not edited: delete one and create it again to change it.
+func createSeasonalityEventHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := settingsScope(w, r)
+	if !ok {
+		return
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	var req SeasonalityEventRequest
+	if err := dec.Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object with the event's name, dates and multipliers"))
+		return
+	}
+
+	actor := r.Header.Get("X-User-Email")
+	if actor == "" {
+		actor = "unknown"
+	}
+	event := seasonality.Event{
+		Scope:                  scope,
+		EventID:                eventIDs.NewID(),
+		Name:                   strings.TrimSpace(req.Name),
+		StartDate:              req.StartDate,
+		EndDate:                req.EndDate,
+		BidMultiplier:          req.BidMultiplier,
+		BudgetMultiplier:       req.BudgetMultiplier,
+		ConversionRateModifier: req.ConversionRateModifier,
+		CampaignIDs:            req.CampaignIDs,
+		CreatedBy:              actor,
+	}
+	if err := event.Validate(); err != nil {
+		problem.Write(w, r, problem.Validation(fmt.Errorf("invalid seasonality event: %w", err)))
+		return
+	}
+	if event.EndDate < clk.Now().UTC().Format(seasonality.DateLayout) {
+		problem.Write(w, r, problem.Validation(errors.New("invalid seasonality event: end_date is in the past")))
+		return
+	}
+
+	if err := seasons.Create(r.Context(), &event); err != nil {
+		log.Printf("Failed to create seasonality event: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusCreated, event)
+}
+
+func getSeasonalityEventHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := settingsScope(w, r)
+	if !ok {
+		return
+	}
+	event, err := seasons.Get(r.Context(), scope, mux.Vars(r)["eventId"])
+	if err != nil {
+		writeSeasonalityError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, event)
+}
+
+// deleteSeasonalityEventHandler removes an event and the Google Ads
+// seasonality adjustments created for it. An event whose raised budgets
+// have not been restored yet answers 409: without it the bid optimizer
+// would no longer know what to restore them to.
+func deleteSeasonalityEventHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := settingsScope(w, r)
+	if !ok {
+		return
+	}
+	event, err := seasons.Get(r.Context(), scope, mux.Vars(r)["eventId"])
+	if err != nil {
+		writeSeasonalityError(w, r, err)
+		return
+	}
+	for customerID, state := range event.Accounts {
+		if len(state.Budgets) > 0 && !state.Restored {
+			problem.Write(w, r, problem.New(http.StatusConflict, fmt.Sprintf("Budgets raised for this event in account %s have not been restored yet; delete it after it ends", customerID)))
+			return
+		}
+	}
+
+	for customerID, state := range event.Accounts {
+		if state.Adjustment == "" {
+			continue
+		}
+		_, err := adsClient.MutateBiddingSeasonalityAdjustments(r.Context(), &googleads.MutateBiddingSeasonalityAdjustmentsRequest{
+			CustomerId: customerID,
+			Operations: []*googleads.BiddingSeasonalityAdjustmentOperation{{Remove: state.Adjustment}},
+		})
+		if err != nil {
+			log.Printf("Failed to remove seasonality adjustment %s: %v", state.Adjustment, err)
+			problem.Write(w, r, problem.New(http.StatusBadGateway, "Failed to remove the event's Google Ads seasonality adjustment; try again"))
+			return
+		}
+		// Recorded so a retried delete doesn't remove it twice.
+		state.Adjustment = ""
+		if err := seasons.SetAccount(r.Context(), scope, event.EventID, customerID, state); err != nil {
+			log.Printf("Failed to record removed seasonality adjustment: %v", err)
+		}
+	}
+
+	if err := seasons.Delete(r.Context(), scope, event.EventID); err != nil {
+		log.Printf("Failed to delete seasonality event: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeSeasonalityError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, seasonality.ErrNotFound) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Seasonality event not found"))
+		return
+	}
+	log.Printf("Seasonality operation failed: %v", err)
+	problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/notify"
+	"pkg/problem"
+)
+
+// GlobalScope holds settings that apply to every account unless an account
+// overrides them.
+const GlobalScope = "global"
+
+// Settings sections editable through the API. Each maps to an attribute of
+// the AccountConfig item.
+const (
+	SectionThresholds          = "thresholds"
+	SectionGoals               = "goals"
+	SectionRules               = "rules"
+	SectionSchedules           = "schedules"
+	SectionNotificationRouting = "notification_routing"
+	SectionFeatureFlags        = "feature_flags"
+	SectionOrganicSearch       = "organic_search"
+	SectionPlacementExclusions = "placement_exclusions"
+	SectionBudgetConstraints   = "budget_constraints"
+	SectionBidGuardrails       = "bid_guardrails"
+)
+
+// maxBrandTerms bounds the brand terms matched against every search term.
+const maxBrandTerms = 50
+
+// maxAllowedPlacements bounds a placement allowlist.
+const maxAllowedPlacements = 1000
+
+var (
+	errSettingsNotFound    = errors.New("settings not found")
+	errVersionConflict     = errors.New("settings were modified by someone else")
+	scheduleExpression     = regexp.MustCompile(`^(rate\(\d+ (minute|minutes|hour|hours|day|days)\)|cron\(.+\))$`)
+	validRuleMetrics       = map[string]bool{"ctr": true, "cpc": true, "cost": true, "conversions": true, "conversion_rate": true, "cost_per_conversion": true, "impressions": true}
+	validRuleOperators     = map[string]bool{">": true, ">=": true, "<": true, "<=": true, "==": true}
+	validRuleActions       = map[string]bool{"INCREASE_BID": true, "DECREASE_BID": true, "MODERATE_INCREASE": true, "PAUSE": true, "ALERT": true}
+	settingsSectionDecoder = map[string]func(json.RawMessage) (interface{}, error){
+		SectionThresholds:          decodeThresholds,
+		SectionGoals:               decodeGoals,
+		SectionRules:               decodeRules,
+		SectionSchedules:           decodeSchedules,
+		SectionNotificationRouting: decodeNotificationRouting,
+		SectionFeatureFlags:        decodeFeatureFlags,
+		SectionOrganicSearch:       decodeOrganicSearch,
+		SectionPlacementExclusions: decodePlacementExclusions,
+		SectionBudgetConstraints:   decodeBudgetConstraints,
+		SectionBidGuardrails:       decodeBidGuardrails,
+	}
+)
+
+// OptimizationRule is a single declarative rule: when Metric Operator Value
+// holds, apply Action by AdjustmentPercent.
+type OptimizationRule struct {
+	Name              string  `json:"name" dynamodbav:"name"`
+	Metric            string  `json:"metric" dynamodbav:"metric"`
+	Operator          string  `json:"operator" dynamodbav:"operator"`
+	Value             float64 `json:"value" dynamodbav:"value"`
+	Action            string  `json:"action" dynamodbav:"action"`
+	AdjustmentPercent float64 `json:"adjustment_percent" dynamodbav:"adjustment_percent"`
+	Enabled           bool    `json:"enabled" dynamodbav:"enabled"`
+}
+
+// OrganicSearch links an account to its Search Console property so paid
+// search terms can be compared with organic rankings. SiteURL is the
+// property as Search Console names it: "sc-domain:example.com" or a URL
+// prefix such as "https://www.example.com/". Queries containing a brand
+// term are treated as navigational.
+type OrganicSearch struct {
+	SiteURL    string   `json:"site_url" dynamodbav:"site_url"`
+	BrandTerms []string `json:"brand_terms,omitempty" dynamodbav:"brand_terms,omitempty"`
+}
+
+// PlacementExclusions tunes the placement-exclusions lambda. MinCost
+// overrides the spend a non-converting placement needs before it is
+// excluded. Allowlist names placements never to exclude, as Google Ads
+// reports them: a domain such as "example.com", a YouTube channel or
+// video ID, or a mobile app ID. The global allowlist applies to every
+// account on top of the account's own.
+type PlacementExclusions struct {
+	MinCost   float64  `json:"min_cost,omitempty" dynamodbav:"min_cost,omitempty"`
+	Allowlist []string `json:"allowlist,omitempty" dynamodbav:"allowlist,omitempty"`
+}
+
+// BudgetConstraint bounds the daily budget the bid optimizer's budget
+// reallocation may give one campaign, in the account currency. Zero leaves
+// a bound unset; a locked campaign's budget is never moved.
+type BudgetConstraint struct {
+	MinDailyBudget float64 `json:"min_daily_budget,omitempty" dynamodbav:"min_daily_budget,omitempty"`
+	MaxDailyBudget float64 `json:"max_daily_budget,omitempty" dynamodbav:"max_daily_budget,omitempty"`
+	Locked         bool    `json:"locked,omitempty" dynamodbav:"locked,omitempty"`
+}
+
+// BidGuardrails bound the keyword bid changes the bid optimizer recommends
+// for an account, overriding its defaults. Bids and spend are in the account
+// currency and MaxDailyChange is a fraction of the bid at the start of the
+// day; zero keeps a default.
+type BidGuardrails struct {
+	MinBid              float64 `json:"min_bid,omitempty" dynamodbav:"min_bid,omitempty"`
+	MaxBid              float64 `json:"max_bid,omitempty" dynamodbav:"max_bid,omitempty"`
+	MaxDailyChange      float64 `json:"max_daily_change,omitempty" dynamodbav:"max_daily_change,omitempty"`
+	MaxChangesPerRun    int     `json:"max_changes_per_run,omitempty" dynamodbav:"max_changes_per_run,omitempty"`
+	MaxDailySpendImpact float64 `json:"max_daily_spend_impact,omitempty" dynamodbav:"max_daily_spend_impact,omitempty"`
+}
+
+// SettingsChange is an immutable audit record of a settings update.
+type SettingsChange struct {
+	Scope     string          `json:"scope" dynamodbav:"scope"`
+	ChangeID  string          `json:"change_id" dynamodbav:"change_id"`
+	Section   string          `json:"section" dynamodbav:"section"`
+	Version   int64           `json:"version" dynamodbav:"version"`
+	OldValue  json.RawMessage `json:"old_value,omitempty" dynamodbav:"old_value,omitempty"`
+	NewValue  json.RawMessage `json:"new_value" dynamodbav:"new_value"`
+	ChangedBy string          `json:"changed_by" dynamodbav:"changed_by"`
+	ChangedAt time.Time       `json:"changed_at" dynamodbav:"changed_at"`
+}
+
+type SettingsSectionResponse struct {
+	Scope   string      `json:"scope"`
+	Section string      `json:"section"`
+	Version int64       `json:"version"`
+	Value   interface{} `json:"value"`
+}
+
+func getSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := settingsScope(w, r)
+	if !ok {
+		return
+	}
+
+	settings, err := getAccountConfig(r.Context(), scope)
+	if err != nil {
+		writeSettingsError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", strconv.FormatInt(settings.Version, 10))
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func getSettingsSectionHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := settingsScope(w, r)
+	if !ok {
+		return
+	}
+	section := mux.Vars(r)["section"]
+	if _, ok := settingsSectionDecoder[section]; !ok {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Unknown settings section"))
+		return
+	}
+
+	settings, err := getAccountConfig(r.Context(), scope)
+	if err != nil {
+		writeSettingsError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", strconv.FormatInt(settings.Version, 10))
+	writeJSON(w, http.StatusOK, SettingsSectionResponse{
+		Scope:   scope,
+		Section: section,
+		Version: settings.Version,
+		Value:   settings.section(section),
+	})
+}
+
+// updateSettingsSectionHandler replaces one section. Callers must send the
+// version they last read in If-Match; a stale version yields 412 so two
+// marketers editing the same threshold can't silently overwrite each other.
+func updateSettingsSectionHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := settingsScope(w, r)
+	if !ok {
+		return
+	}
+	section := mux.Vars(r)["section"]
+	decode, ok := settingsSectionDecoder[section]
+	if !ok {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Unknown settings section"))
+		return
+	}
+
+	ifMatch := strings.Trim(r.Header.Get("If-Match"), `"`)
+	if ifMatch == "" {
+		problem.Write(w, r, problem.New(http.StatusPreconditionRequired, "If-Match header with the current settings version is required"))
+		return
+	}
+	expectedVersion, err := strconv.ParseInt(ifMatch, 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "If-Match must be a settings version number"))
+		return
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be valid JSON"))
+		return
+	}
+	value, err := decode(raw)
+	if err != nil {
+		problem.Write(w, r, problem.Validation(fmt.Errorf("invalid %s: %w", section, err)))
+		return
+	}
+
+	actor := r.Header.Get("X-User-Email")
+	if actor == "" {
+		actor = "unknown"
+	}
+
+	settings, err := updateSettingsSection(r.Context(), scope, section, value, expectedVersion, actor)
+	if err != nil {
+		writeSettingsError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", strconv.FormatInt(settings.Version, 10))
+	writeJSON(w, http.StatusOK, SettingsSectionResponse{
+		Scope:   scope,
+		Section: section,
+		Version: settings.Version,
+		Value:   settings.section(section),
+	})
+}
+
+func getSettingsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := settingsScope(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := listSettingsChanges(r.Context(), scope)
+	if err != nil {
+		log.Printf("Failed to list settings changes: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"changes": changes})
+}
+
+func settingsScope(w http.ResponseWriter, r *http.Request) (string, bool) {
+	scope := normalizeCustomerID(mux.Vars(r)["scope"])
+	if scope != GlobalScope && !customerIDPattern.MatchString(scope) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "Scope must be 'global' or a 10-digit customer ID"))
+		return "", false
+	}
+	return scope, true
+}
+
+func writeSettingsError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errSettingsNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Settings not found"))
+	case errors.Is(err, errVersionConflict):
+		problem.Write(w, r, problem.New(http.StatusPreconditionFailed, "Settings version mismatch; reload and retry"))
+	default:
+		log.Printf("Settings operation failed: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+	}
+}
+
+func (c AccountConfig) section(name string) interface{} {
+	switch name {
+	case SectionThresholds:
+		return c.Thresholds
+	case SectionGoals:
+		return c.Goals
+	case SectionRules:
+		return c.Rules
+	case SectionSchedules:
+		return c.Schedules
+	case SectionNotificationRouting:
+		return c.NotificationRouting
+	case SectionFeatureFlags:
+		return c.FeatureFlags
+	case SectionOrganicSearch:
+		return c.OrganicSearch
+	case SectionPlacementExclusions:
+		return c.PlacementExclusions
+	case SectionBudgetConstraints:
+		return c.BudgetConstraints
+	case SectionBidGuardrails:
+		return c.BidGuardrails
+	}
+	return nil
+}
+
+// Section validation
+func decodeThresholds(raw json.RawMessage) (interface{}, error) {
+	var t AlertThresholds
+	if err := strictUnmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	if t.LowCTR < 0 || t.LowCTR > 1 {
+		return nil, fmt.Errorf("low_ctr must be a fraction between 0 and 1")
+	}
+	if t.LowCTRMinImpressions < 0 || t.HighCostNoConversions < 0 || t.HighCPC < 0 {
+		return nil, fmt.Errorf("thresholds must not be negative")
+	}
+	return t, nil
+}
+
+func decodeGoals(raw json.RawMessage) (interface{}, error) {
+	var g AccountGoals
+	if err := strictUnmarshal(raw, &g); err != nil {
+		return nil, err
+	}
+	if g.TargetCPA < 0 || g.MaxCPA < 0 {
+		return nil, fmt.Errorf("CPA goals must not be negative")
+	}
+	if g.MaxCPA > 0 && g.TargetCPA > g.MaxCPA {
+		return nil, fmt.Errorf("target_cpa must not exceed max_cpa")
+	}
+	if g.MinBidChangePercent < 0 || g.MinBidChangePercent > 1 {
+		return nil, fmt.Errorf("min_bid_change_percent must be a fraction between 0 and 1")
+	}
+	return g, nil
+}
+
+func decodeRules(raw json.RawMessage) (interface{}, error) {
+	var rules []OptimizationRule
+	if err := strictUnmarshal(raw, &rules); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i, rule := range rules {
+		switch {
+		case rule.Name == "":
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		case names[rule.Name]:
+			return nil, fmt.Errorf("rule %d: duplicate name %q", i, rule.Name)
+		case !validRuleMetrics[rule.Metric]:
+			return nil, fmt.Errorf("rule %s: unknown metric %q", rule.Name, rule.Metric)
+		case !validRuleOperators[rule.Operator]:
+			return nil, fmt.Errorf("rule %s: unknown operator %q", rule.Name, rule.Operator)
+		case !validRuleActions[rule.Action]:
+			return nil, fmt.Errorf("rule %s: unknown action %q", rule.Name, rule.Action)
+		case rule.AdjustmentPercent < 0 || rule.AdjustmentPercent > 1:
+			return nil, fmt.Errorf("rule %s: adjustment_percent must be between 0 and 1", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return rules, nil
+}
+
+func decodeSchedules(raw json.RawMessage) (interface{}, error) {
+	var schedules map[string]string
+	if err := strictUnmarshal(raw, &schedules); err != nil {
+		return nil, err
+	}
+	for job, expr := range schedules {
+		if !scheduleExpression.MatchString(expr) {
+			return nil, fmt.Errorf("schedule for %s must be a rate() or cron() expression", job)
+		}
+	}
+	return schedules, nil
+}
+
+func decodeNotificationRouting(raw json.RawMessage) (interface{}, error) {
+	var routing notify.RoutingConfig
+	if err := strictUnmarshal(raw, &routing); err != nil {
+		return nil, err
+	}
+	if err := routing.Validate(); err != nil {
+		return nil, err
+	}
+	return &routing, nil
+}
+
+func decodeFeatureFlags(raw json.RawMessage) (interface{}, error) {
+	var flags map[string]bool
+	if err := strictUnmarshal(raw, &flags); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+func decodeOrganicSearch(raw json.RawMessage) (interface{}, error) {
+	var organic OrganicSearch
+	if err := strictUnmarshal(raw, &organic); err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(organic.SiteURL, "sc-domain:") && len(organic.SiteURL) > len("sc-domain:"):
+	case strings.HasPrefix(organic.SiteURL, "https://") || strings.HasPrefix(organic.SiteURL, "http://"):
+		if !strings.HasSuffix(organic.SiteURL, "/") {
+			return nil, fmt.Errorf("site_url must end with / for a URL-prefix property")
+		}
+	default:
+		return nil, fmt.Errorf("site_url must be sc-domain:<domain> or a URL-prefix property")
+	}
+	if len(organic.BrandTerms) > maxBrandTerms {
+		return nil, fmt.Errorf("at most %d brand_terms are allowed", maxBrandTerms)
+	}
+	for i, term := range organic.BrandTerms {
+		organic.BrandTerms[i] = strings.ToLower(strings.TrimSpace(term))
+		if organic.BrandTerms[i] == "" {
+			return nil, fmt.Errorf("brand_terms must not be empty")
+		}
+	}
+	return &organic, nil
+}
+
+func decodePlacementExclusions(raw json.RawMessage) (interface{}, error) {
+	var exclusions PlacementExclusions
+	if err := strictUnmarshal(raw, &exclusions); err != nil {
+		return nil, err
+	}
+	if exclusions.MinCost < 0 {
+		return nil, fmt.Errorf("min_cost must not be negative")
+	}
+	if len(exclusions.Allowlist) > maxAllowedPlacements {
+		return nil, fmt.Errorf("at most %d allowlisted placements are allowed", maxAllowedPlacements)
+	}
+	for i, placement := range exclusions.Allowlist {
+		exclusions.Allowlist[i] = strings.ToLower(strings.TrimSpace(placement))
+		if exclusions.Allowlist[i] == "" {
+			return nil, fmt.Errorf("allowlist must not contain empty placements")
+		}
+	}
+	return &exclusions, nil
+}
+
+// decodeBudgetConstraints reads constraints keyed by campaign ID.
+func decodeBudgetConstraints(raw json.RawMessage) (interface{}, error) {
+	var constraints map[string]BudgetConstraint
+	if err := strictUnmarshal(raw, &constraints); err != nil {
+		return nil, err
+	}
+	for campaignID, c := range constraints {
+		if _, err := strconv.ParseInt(campaignID, 10, 64); err != nil {
+			return nil, fmt.Errorf("%q is not a campaign ID", campaignID)
+		}
+		if c.MinDailyBudget < 0 || c.MaxDailyBudget < 0 {
+			return nil, fmt.Errorf("campaign %s: daily budgets must not be negative", campaignID)
+		}
+		if c.MaxDailyBudget > 0 && c.MinDailyBudget > c.MaxDailyBudget {
+			return nil, fmt.Errorf("campaign %s: min_daily_budget must not exceed max_daily_budget", campaignID)
+		}
+	}
+	return constraints, nil
+}
+
+func decodeBidGuardrails(raw json.RawMessage) (interface{}, error) {
+	var g BidGuardrails
+	if err := strictUnmarshal(raw, &g); err != nil {
+		return nil, err
+	}
+	switch {
+	case g.MinBid < 0 || g.MaxBid < 0 || g.MaxChangesPerRun < 0 || g.MaxDailySpendImpact < 0:
+		return nil, fmt.Errorf("guardrails must not be negative")
+	case g.MaxBid > 0 && g.MinBid > g.MaxBid:
+		return nil, fmt.Errorf("min_bid must not exceed max_bid")
+	case g.MaxDailyChange < 0 || g.MaxDailyChange > 1:
+		return nil, fmt.Errorf("max_daily_change must be a fraction between 0 and 1")
+	}
+	return &g, nil
+}
+
+func strictUnmarshal(raw json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// DynamoDB operations
+func getAccountConfig(ctx context.Context, scope string) (AccountConfig, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(accountConfigTable),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberS{Value: scope},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return AccountConfig{}, fmt.Errorf("failed to get settings: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		if scope == GlobalScope {
+			// The global scope exists implicitly; the first write creates it.
+			return AccountConfig{CustomerID: GlobalScope}, nil
+		}
+		return AccountConfig{}, errSettingsNotFound
+	}
+
+	var settings AccountConfig
+	if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+		return AccountConfig{}, fmt.Errorf("failed to unmarshal settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+func updateSettingsSection(ctx context.Context, scope, section string, value interface{}, expectedVersion int64, actor string) (AccountConfig, error) {
+	current, err := getAccountConfig(ctx, scope)
+	if err != nil {
+		return AccountConfig{}, err
+	}
+	if current.Version != expectedVersion {
+		return AccountConfig{}, errVersionConflict
+	}
+
+	av, err := attributevalue.Marshal(value)
+	if err != nil {
+		return AccountConfig{}, fmt.Errorf("failed to marshal %s: %w", section, err)
+	}
+
+	now := clk.Now()
+	condition := "#version = :expected"
+	if expectedVersion == 0 {
+		condition = "attribute_not_exists(#version) OR #version = :expected"
+	}
+
+	result, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(accountConfigTable),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberS{Value: scope},
+		},
+		UpdateExpression:    aws.String("SET #section = :value, #version = :next, updated_at = :now, updated_by = :actor"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#section": section,
+			"#version": "version",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":value":    av,
+			":expected": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion, 10)},
+			":next":     &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion+1, 10)},
+			":now":      &types.AttributeValueMemberS{Value: now.Format(time.RFC3339Nano)},
+			":actor":    &types.AttributeValueMemberS{Value: actor},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return AccountConfig{}, errVersionConflict
+		}
+		return AccountConfig{}, fmt.Errorf("failed to update settings: %w", err)
+	}
+
+	var updated AccountConfig
+	if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+		return AccountConfig{}, fmt.Errorf("failed to unmarshal settings: %w", err)
+	}
+
+	oldValue, _ := json.Marshal(current.section(section))
+	newValue, _ := json.Marshal(updated.section(section))
+	change := SettingsChange{
+		Scope:     scope,
+		ChangeID:  fmt.Sprintf("%s#%010d", now.UTC().Format(time.RFC3339), updated.Version),
+		Section:   section,
+		Version:   updated.Version,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		ChangedBy: actor,
+		ChangedAt: now,
+	}
+	if err := saveSettingsChange(ctx, change); err != nil {
+		// The update already happened; losing the audit record is logged
+		// loudly rather than reported to the caller as a failed update.
+		log.Printf("Failed to record settings change for %s/%s v%d: %v", scope, section, updated.Version, err)
+	}
+
+	return updated, nil
+}
+
+func saveSettingsChange(ctx context.Context, change SettingsChange) error {
+	item, err := attributevalue.MarshalMap(change)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings change: %w", err)
+	}
+
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(settingsAuditTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(change_id)"),
+	})
+
+	return err
+}
+
+func listSettingsChanges(ctx context.Context, scope string) ([]SettingsChange, error) {
+	result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(settingsAuditTable),
+		ConsistentRead:         aws.Bool(consistentReads),
+		KeyConditionExpression: aws.String("#scope = :scope"),
+		ExpressionAttributeNames: map[string]string{
+			"#scope": "scope",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":scope": &types.AttributeValueMemberS{Value: scope},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(100),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settings changes: %w", err)
+	}
+
+	var changes []SettingsChange
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &changes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal settings changes: %w", err)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// marginalEfficiency discounts clicks bought with extra budget: the
+// impressions a campaign currently loses to budget are, on average, in less
+// valuable auctions than the ones it already wins.
+const marginalEfficiency = 0.85
+
+// simulationWindows are the lookback windows accepted by the simulator and
+// their length in days.
+var simulationWindows = map[string]struct {
+	during gaql.DateRange
+	days   int
+}{
+	"LAST_7_DAYS":  {gaql.Last7Days, 7},
+	"LAST_14_DAYS": {gaql.Last14Days, 14},
+	"LAST_30_DAYS": {gaql.Last30Days, 30},
+}
+
+// WhatIfRequest describes a hypothetical budget for one campaign. Exactly
+// one of DailyBudget or BudgetChangePercent must be set.
+type WhatIfRequest struct {
+	DailyBudget         *float64 `json:"daily_budget,omitempty" validate:"min=0.01"`
+	BudgetChangePercent *float64 `json:"budget_change_percent,omitempty" validate:"min=-100,max=1000"`
+	Lookback            string   `json:"lookback,omitempty" validate:"oneof=LAST_7_DAYS LAST_14_DAYS LAST_30_DAYS"`
+}
+
+// Scenario is a campaign's average daily performance at a given budget.
+type Scenario struct {
+	DailyBudget     float64 `json:"daily_budget"`
+	Impressions     float64 `json:"impressions"`
+	Clicks          float64 `json:"clicks"`
+	Cost            float64 `json:"cost"`
+	Conversions     float64 `json:"conversions"`
+	CPA             float64 `json:"cpa"`
+	ImpressionShare float64 `json:"impression_share"`
+}
+
+// ScenarioComparison is the simulator's response: the campaign's current
+// daily averages, the estimate at the proposed budget and the difference.
+type ScenarioComparison struct {
+	CustomerID                string   `json:"customer_id"`
+	CampaignID                string   `json:"campaign_id"`
+	CampaignName              string   `json:"campaign_name"`
+	Lookback                  string   `json:"lookback"`
+	BudgetLostImpressionShare float64  `json:"budget_lost_impression_share"`
+	RankLostImpressionShare   float64  `json:"rank_lost_impression_share"`
+	HistoricalConversionRate  float64  `json:"historical_conversion_rate"`
+	Baseline                  Scenario `json:"baseline"`
+	Proposed                  Scenario `json:"proposed"`
+	Delta                     Scenario `json:"delta"`
+	Assumptions               []string `json:"assumptions"`
+}
+
+// whatIfHandler estimates how a campaign would perform at a different daily
+// budget, using the impression share it currently loses to budget as the
+// ceiling for growth and its historical CTR and conversion rate.
+func whatIfHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	customerID := normalizeCustomerID(vars["customerId"])
+	if !customerIDPattern.MatchString(customerID) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "customer_id must be a 10-digit Google Ads customer ID"))
+		return
+	}
+	campaignID, err := strconv.ParseInt(vars["campaignId"], 10, 64)
+	if err != nil || campaignID <= 0 {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "campaign_id must be a numeric Google Ads campaign ID"))
+		return
+	}
+
+	var req WhatIfRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+	if (req.DailyBudget == nil) == (req.BudgetChangePercent == nil) {
+		problem.Write(w, r, problem.Validation(validate.Errors{{
+			Field:   "daily_budget",
+			Rule:    "required_without",
+			Message: "exactly one of daily_budget or budget_change_percent is required",
+		}}))
+		return
+	}
+	if req.Lookback == "" {
+		req.Lookback = "LAST_30_DAYS"
+	}
+	window := simulationWindows[req.Lookback]
+
+	query, err := gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"campaign_budget.amount_micros",
+		"metrics.impressions",
+		"metrics.clicks",
+		"metrics.cost_micros",
+		"metrics.conversions",
+		"metrics.search_impression_share",
+		"metrics.search_budget_lost_impression_share",
+		"metrics.search_rank_lost_impression_share",
+	).From("campaign").
+		Where("campaign.id", gaql.Equals, campaignID).
+		During(window.during).
+		Build()
+	if err != nil {
+		log.Printf("Failed to build what-if query: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	resp, err := adsClient.Search(r.Context(), &googleads.SearchGoogleAdsRequest{
+		CustomerId: customerID,
+		Query:      query,
+	})
+	if err != nil {
+		log.Printf("Failed to query campaign %d for %s: %v", campaignID, customerID, err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, "Failed to query Google Ads"))
+		return
+	}
+	if len(resp.Results) == 0 {
+		problem.Write(w, r, problem.New(http.StatusNotFound, fmt.Sprintf("campaign %d not found", campaignID)))
+		return
+	}
+
+	row := resp.Results[0]
+	currentBudget := float64(row.CampaignBudget.AmountMicros) / 1000000.0
+	var proposedBudget float64
+	if req.DailyBudget != nil {
+		proposedBudget = *req.DailyBudget
+	} else {
+		proposedBudget = currentBudget * (1 + *req.BudgetChangePercent/100)
+	}
+
+	comparison := simulateBudget(row, window.days, currentBudget, proposedBudget)
+	comparison.CustomerID = customerID
+	comparison.Lookback = req.Lookback
+	writeJSON(w, http.StatusOK, comparison)
+}
+
+// simulateBudget models a campaign's daily performance at proposedBudget.
+//
+// Spend is assumed to scale with budget at the current cost per impression.
+// Growth is capped by the impression share currently lost to budget: share
+// lost to rank cannot be bought with budget alone. Extra clicks are
+// discounted by marginalEfficiency; cuts scale linearly. Conversions follow
+// the historical conversion rate.
+func simulateBudget(row *googleads.GoogleAdsRow, days int, currentBudget, proposedBudget float64) ScenarioComparison {
+	m := row.Metrics
+	perDay := float64(days)
+
+	baseline := Scenario{
+		DailyBudget:     currentBudget,
+		Impressions:     float64(m.Impressions) / perDay,
+		Clicks:          float64(m.Clicks) / perDay,
+		Cost:            float64(m.CostMicros) / 1000000.0 / perDay,
+		Conversions:     float64(m.Conversions) / perDay,
+		ImpressionShare: m.SearchImpressionShare,
+	}
+	baseline.CPA = costPerAcquisition(baseline.Cost, baseline.Conversions)
+
+	var ctr, cvr float64
+	if m.Impressions > 0 {
+		ctr = float64(m.Clicks) / float64(m.Impressions)
+	}
+	if m.Clicks > 0 {
+		cvr = float64(m.Conversions) / float64(m.Clicks)
+	}
+
+	factor := 1.0
+	if currentBudget > 0 {
+		factor = proposedBudget / currentBudget
+	}
+
+	proposed := Scenario{DailyBudget: proposedBudget}
+	if factor >= 1 {
+		// The most the campaign could show is what it wins today plus what
+		// it loses to budget.
+		maxFactor := 1.0
+		if m.SearchImpressionShare > 0 {
+			maxFactor = (m.SearchImpressionShare + m.SearchBudgetLostImpressionShare) / m.SearchImpressionShare
+		}
+		effective := math.Min(factor, maxFactor)
+
+		extraImpressions := baseline.Impressions * (effective - 1)
+		proposed.Impressions = baseline.Impressions + extraImpressions
+		proposed.Clicks = baseline.Clicks + extraImpressions*ctr*marginalEfficiency
+		proposed.Cost = baseline.Cost * effective
+		proposed.ImpressionShare = m.SearchImpressionShare * effective
+	} else {
+		proposed.Impressions = baseline.Impressions * factor
+		proposed.Clicks = baseline.Clicks * factor
+		proposed.Cost = baseline.Cost * factor
+		proposed.ImpressionShare = m.SearchImpressionShare * factor
+	}
+	proposed.Conversions = proposed.Clicks * cvr
+	proposed.CPA = costPerAcquisition(proposed.Cost, proposed.Conversions)
+
+	assumptions := []string{
+		fmt.Sprintf("Daily averages over the last %d days", days),
+		fmt.Sprintf("Incremental clicks discounted to %.0f%% of historical CTR", marginalEfficiency*100),
+		fmt.Sprintf("Conversions at historical conversion rate of %.2f%%", cvr*100),
+	}
+	if factor > 1 && m.SearchBudgetLostImpressionShare == 0 {
+		assumptions = append(assumptions, "Campaign is not limited by budget; extra budget is not expected to be spent")
+	} else if proposed.Cost < baseline.Cost*factor {
+		assumptions = append(assumptions, "Growth capped at the impression share currently lost to budget")
+	}
+	if m.SearchRankLostImpressionShare > m.SearchBudgetLostImpressionShare {
+		assumptions = append(assumptions, "More impression share is lost to rank than budget; bids or quality may matter more than budget")
+	}
+
+	return ScenarioComparison{
+		CampaignID:                fmt.Sprintf("%d", row.Campaign.Id),
+		CampaignName:              row.Campaign.Name,
+		BudgetLostImpressionShare: m.SearchBudgetLostImpressionShare,
+		RankLostImpressionShare:   m.SearchRankLostImpressionShare,
+		HistoricalConversionRate:  cvr,
+		Baseline:                  baseline,
+		Proposed:                  proposed,
+		Delta: Scenario{
+			DailyBudget:     proposed.DailyBudget - baseline.DailyBudget,
+			Impressions:     proposed.Impressions - baseline.Impressions,
+			Clicks:          proposed.Clicks - baseline.Clicks,
+			Cost:            proposed.Cost - baseline.Cost,
+			Conversions:     proposed.Conversions - baseline.Conversions,
+			CPA:             proposed.CPA - baseline.CPA,
+			ImpressionShare: proposed.ImpressionShare - baseline.ImpressionShare,
+		},
+		Assumptions: assumptions,
+	}
+}
+
+func costPerAcquisition(cost, conversions float64) float64 {
+	if conversions == 0 {
+		return 0
+	}
+	return cost / conversions
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/problem"
+)
+
+// Trend granularities. Weeks start on Monday, as segments.week does.
+const (
+	GranularityDaily   = "DAILY"
+	GranularityWeekly  = "WEEKLY"
+	GranularityMonthly = "MONTHLY"
+)
+
+const (
+	// maxTrendDays bounds the requested range; Google Ads keeps roughly
+	// three years of performance data.
+	maxTrendDays = 3 * 366
+	// defaultTrendDays is the range when from is omitted.
+	defaultTrendDays = 90
+	// maxTrendPoints caps the series returned for the chosen granularity
+	// so a two-year daily request doesn't ship 730 points to a chart that
+	// can't draw them.
+	maxTrendPoints = 400
+)
+
+// trendSegments is the segment each granularity groups by. Google Ads
+// rolls the rows up server side, so a two-year monthly series is 24 rows
+// per entity rather than 730.
+var trendSegments = map[string]string{
+	GranularityDaily:   "segments.date",
+	GranularityWeekly:  "segments.week",
+	GranularityMonthly: "segments.month",
+}
+
+// TrendPoint is one bucket of a series. Start and End are clamped to the
+// requested range, so the first and last buckets may be Partial. Ratios
+// are nil when their denominator is zero rather than a misleading 0.
+type TrendPoint struct {
+	Start          string   `json:"start"`
+	End            string   `json:"end"`
+	Partial        bool     `json:"partial,omitempty"`
+	Filled         bool     `json:"filled,omitempty"`
+	Impressions    int64    `json:"impressions"`
+	Clicks         int64    `json:"clicks"`
+	Cost           float64  `json:"cost"`
+	Conversions    int64    `json:"conversions"`
+	CTR            *float64 `json:"ctr"`
+	CPC            *float64 `json:"cpc"`
+	ConversionRate *float64 `json:"conversion_rate"`
+	CPA            *float64 `json:"cpa"`
+}
+
+// TrendResponse is a gap-filled time series for one campaign or keyword.
+type TrendResponse struct {
+	CustomerID  string       `json:"customer_id"`
+	Level       string       `json:"level"`
+	CampaignID  string       `json:"campaign_id,omitempty"`
+	AdGroupID   string       `json:"ad_group_id,omitempty"`
+	KeywordID   string       `json:"keyword_id,omitempty"`
+	Name        string       `json:"name,omitempty"`
+	Granularity string       `json:"granularity"`
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Points      []TrendPoint `json:"points"`
+}
+
+// trendRange is a parsed trend request.
+type trendRange struct {
+	from, to    time.Time
+	granularity string
+}
+
+// campaignTrendHandler returns a campaign's performance series.
+func campaignTrendHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	customerID := normalizeCustomerID(vars["customerId"])
+	if !customerIDPattern.MatchString(customerID) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "customer_id must be a 10-digit Google Ads customer ID"))
+		return
+	}
+	campaignID, err := strconv.ParseInt(vars["campaignId"], 10, 64)
+	if err != nil || campaignID <= 0 {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "campaign_id must be a numeric Google Ads campaign ID"))
+		return
+	}
+	tr, err := parseTrendRange(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	query, err := trendQuery(tr, "campaign.name").
+		From("campaign").
+		Where("campaign.id", gaql.Equals, campaignID).
+		Build()
+	if err != nil {
+		log.Printf("Failed to build campaign trend query: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	resp := TrendResponse{
+		CustomerID: customerID,
+		Level:      "CAMPAIGN",
+		CampaignID: strconv.FormatInt(campaignID, 10),
+	}
+	writeTrend(w, r, customerID, query, tr, &resp, func(row *googleads.GoogleAdsRow) string {
+		return row.Campaign.Name
+	})
+}
+
+// keywordTrendHandler returns a keyword's performance series. Criterion
+// IDs are only unique within an ad group, so the ad group is part of the
+// path.
+func keywordTrendHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	customerID := normalizeCustomerID(vars["customerId"])
+	if !customerIDPattern.MatchString(customerID) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "customer_id must be a 10-digit Google Ads customer ID"))
+		return
+	}
+	adGroupID, err := strconv.ParseInt(vars["adGroupId"], 10, 64)
+	if err != nil || adGroupID <= 0 {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "ad_group_id must be a numeric Google Ads ad group ID"))
+		return
+	}
+	keywordID, err := strconv.ParseInt(vars["keywordId"], 10, 64)
+	if err != nil || keywordID <= 0 {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "keyword_id must be a numeric Google Ads criterion ID"))
+		return
+	}
+	tr, err := parseTrendRange(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	query, err := trendQuery(tr, "campaign.id", "ad_group_criterion.keyword.text").
+		From("keyword_view").
+		Where("ad_group.id", gaql.Equals, adGroupID).
+		Where("ad_group_criterion.criterion_id", gaql.Equals, keywordID).
+		Build()
+	if err != nil {
+		log.Printf("Failed to build keyword trend query: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	resp := TrendResponse{
+		CustomerID: customerID,
+		Level:      "KEYWORD",
+		AdGroupID:  strconv.FormatInt(adGroupID, 10),
+		KeywordID:  strconv.FormatInt(keywordID, 10),
+	}
+	writeTrend(w, r, customerID, query, tr, &resp, func(row *googleads.GoogleAdsRow) string {
+		resp.CampaignID = strconv.FormatInt(row.Campaign.Id, 10)
+		return row.AdGroupCriterion.Keyword.Text
+	})
+}
+
+// trendQuery selects the bucket segment and the summable metrics over the
+// range; ratios are derived from the sums so they stay correct after
+// rollup.
+func trendQuery(tr trendRange, fields ...string) *gaql.Builder {
+	fields = append(fields,
+		trendSegments[tr.granularity],
+		"metrics.impressions",
+		"metrics.clicks",
+		"metrics.cost_micros",
+		"metrics.conversions",
+	)
+	return gaql.Select(fields...).
+		Between("segments.date", tr.from.Format("2006-01-02"), tr.to.Format("2006-01-02"))
+}
+
+// writeTrend runs the query, sums rows into buckets, fills the buckets
+// with no rows and writes the response. name reads the entity's name from
+// a row.
+func writeTrend(w http.ResponseWriter, r *http.Request, customerID, query string, tr trendRange, resp *TrendResponse, name func(*googleads.GoogleAdsRow) string) {
+	buckets := make(map[string]*TrendPoint)
+	err := searchPages(r.Context(), customerID, query, func(rows []*googleads.GoogleAdsRow) error {
+		for _, row := range rows {
+			start, err := time.Parse("2006-01-02", trendBucketKey(tr.granularity, row.Segments))
+			if err != nil {
+				return fmt.Errorf("unexpected bucket in trend row: %w", err)
+			}
+			key := start.Format("2006-01-02")
+			point, ok := buckets[key]
+			if !ok {
+				point = &TrendPoint{}
+				buckets[key] = point
+			}
+			point.Impressions += row.Metrics.Impressions
+			point.Clicks += row.Metrics.Clicks
+			point.Cost += float64(row.Metrics.CostMicros) / 1000000.0
+			point.Conversions += row.Metrics.Conversions
+			if resp.Name == "" {
+				resp.Name = name(row)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to query %s trend for %s: %v", strings.ToLower(resp.Level), customerID, err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, "Failed to query Google Ads"))
+		return
+	}
+
+	resp.Granularity = tr.granularity
+	resp.From = tr.from.Format("2006-01-02")
+	resp.To = tr.to.Format("2006-01-02")
+	resp.Points = fillTrend(tr, buckets)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// fillTrend walks every bucket in the range in order, using the summed
+// point where there was data and a zero point marked Filled where there
+// wasn't: no row from Google Ads means nothing served that day.
+func fillTrend(tr trendRange, buckets map[string]*TrendPoint) []TrendPoint {
+	points := []TrendPoint{}
+	for start := bucketStart(tr.granularity, tr.from); !start.After(tr.to); start = nextBucket(tr.granularity, start) {
+		end := nextBucket(tr.granularity, start).AddDate(0, 0, -1)
+
+		point := TrendPoint{Filled: true}
+		if summed, ok := buckets[start.Format("2006-01-02")]; ok {
+			point = *summed
+		}
+
+		clampedStart, clampedEnd := start, end
+		if clampedStart.Before(tr.from) {
+			clampedStart = tr.from
+		}
+		if clampedEnd.After(tr.to) {
+			clampedEnd = tr.to
+		}
+		point.Start = clampedStart.Format("2006-01-02")
+		point.End = clampedEnd.Format("2006-01-02")
+		point.Partial = !clampedStart.Equal(start) || !clampedEnd.Equal(end)
+
+		point.CTR = ratio(float64(point.Clicks), float64(point.Impressions))
+		point.CPC = ratio(point.Cost, float64(point.Clicks))
+		point.ConversionRate = ratio(float64(point.Conversions), float64(point.Clicks))
+		point.CPA = ratio(point.Cost, float64(point.Conversions))
+		points = append(points, point)
+	}
+	return points
+}
+
+// parseTrendRange reads from, to (YYYY-MM-DD, inclusive) and granularity.
+// to defaults to yesterday, the last complete day, and from to
+// defaultTrendDays before it. Without a granularity the finest one that
+// fits in maxTrendPoints is chosen.
+func parseTrendRange(r *http.Request) (trendRange, error) {
+	q := r.URL.Query()
+	now := clk.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	tr := trendRange{to: today.AddDate(0, 0, -1)}
+	if value := q.Get("to"); value != "" {
+		to, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return trendRange{}, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+		}
+		tr.to = to
+	}
+	tr.from = tr.to.AddDate(0, 0, -(defaultTrendDays - 1))
+	if value := q.Get("from"); value != "" {
+		from, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return trendRange{}, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+		}
+		tr.from = from
+	}
+
+	if tr.from.After(tr.to) {
+		return trendRange{}, fmt.Errorf("from must not be after to")
+	}
+	if tr.to.After(today) {
+		return trendRange{}, fmt.Errorf("to must not be in the future")
+	}
+	days := int(tr.to.Sub(tr.from).Hours()/24) + 1
+	if days > maxTrendDays {
+		return trendRange{}, fmt.Errorf("range must not exceed %d days", maxTrendDays)
+	}
+
+	tr.granularity = strings.ToUpper(q.Get("granularity"))
+	switch tr.granularity {
+	case "":
+		switch {
+		case days <= maxTrendPoints:
+			tr.granularity = GranularityDaily
+		case days/7 <= maxTrendPoints:
+			tr.granularity = GranularityWeekly
+		default:
+			tr.granularity = GranularityMonthly
+		}
+	case GranularityDaily:
+		if days > maxTrendPoints {
+			return trendRange{}, fmt.Errorf("range of %d days is too long for DAILY granularity; use WEEKLY or MONTHLY", days)
+		}
+	case GranularityWeekly, GranularityMonthly:
+	default:
+		return trendRange{}, fmt.Errorf("granularity must be one of DAILY, WEEKLY, MONTHLY")
+	}
+
+	return tr, nil
+}
+
+// trendBucketKey returns the date a row's bucket starts on.
+func trendBucketKey(granularity string, segments *googleads.Segments) string {
+	switch granularity {
+	case GranularityWeekly:
+		return segments.Week
+	case GranularityMonthly:
+		return segments.Month
+	default:
+		return segments.Date
+	}
+}
+
+// bucketStart returns the first day of the bucket containing day.
+func bucketStart(granularity string, day time.Time) time.Time {
+	switch granularity {
+	case GranularityWeekly:
+		offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+		return day.AddDate(0, 0, -offset)
+	case GranularityMonthly:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextBucket returns the first day of the bucket after the one starting on
+// start.
+func nextBucket(granularity string, start time.Time) time.Time {
+	switch granularity {
+	case GranularityWeekly:
+		return start.AddDate(0, 0, 7)
+	case GranularityMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func ratio(numerator, denominator float64) *float64 {
+	if denominator == 0 {
+		return nil
+	}
+	value := numerator / denominator
+	return &value
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"pkg/problem"
+	"pkg/tenant"
+)
+
+// jwtLeeway absorbs clock skew between the gateway and the token issuer.
+const jwtLeeway = 30 * time.Second
+
+// Claims are the registered JWT claims the gateway checks, plus the client,
+// scope and tenant claims it forwards. Audience may be a string or a list.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	ClientID  string   `json:"client_id"`
+	// AuthorizedParty names the client in tokens without client_id.
+	AuthorizedParty string `json:"azp"`
+	Scope           string `json:"scope"`
+	// Tenant is the storefront brand the token was issued for, read from
+	// the claim JWT_TENANT_CLAIM names; empty for the default tenant.
+	Tenant string `json:"-"`
+}
+
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("aud must be a string or list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// client names who the token was issued to, for rate limiting and logs.
+func (c *Claims) client() string {
+	if c.ClientID != "" {
+		return c.ClientID
+	}
+	if c.AuthorizedParty != "" {
+		return c.AuthorizedParty
+	}
+	return c.Subject
+}
+
+// hasScope reports whether scope is among the token's space-separated
+// scopes.
+func (c *Claims) hasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier validates bearer tokens signed with HS256, RS256 or both.
+// Tokens signed with any other algorithm, including "none", are rejected.
+type Verifier struct {
+	hmacSecret  []byte
+	publicKey   *rsa.PublicKey
+	issuer      string
+	audience    string
+	tenantClaim string
+}
+
+// newVerifierFromEnv reads JWT_HMAC_SECRET and JWT_PUBLIC_KEY (an RSA
+// public key in PEM), the optional JWT_ISSUER and JWT_AUDIENCE, and
+// JWT_TENANT_CLAIM, the claim naming the tenant (default
+// custom:tenant_id, the user pool attribute). At least one key is
+// required: the gateway does not run open.
+func newVerifierFromEnv() (*Verifier, error) {
+	v := &Verifier{
+		hmacSecret:  []byte(os.Getenv("JWT_HMAC_SECRET")),
+		issuer:      os.Getenv("JWT_ISSUER"),
+		audience:    os.Getenv("JWT_AUDIENCE"),
+		tenantClaim: getEnv("JWT_TENANT_CLAIM", "custom:tenant_id"),
+	}
+	if keyPEM := os.Getenv("JWT_PUBLIC_KEY"); keyPEM != "" {
+		key, err := parseRSAPublicKey(keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		v.publicKey = key
+	}
+	if len(v.hmacSecret) == 0 && v.publicKey == nil {
+		return nil, errors.New("JWT_HMAC_SECRET or JWT_PUBLIC_KEY must be set")
+	}
+	return v, nil
+}
+
+func parseRSAPublicKey(keyPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("JWT_PUBLIC_KEY is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT_PUBLIC_KEY: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("JWT_PUBLIC_KEY is not an RSA key")
+	}
+	return key, nil
+}
+
+// Middleware requires a valid bearer token on every call to route that is
+// not public, and replaces the identity headers with the token's. Public
+// calls that carry a token are still checked, so a bad token is never
+// silently ignored.
+//
+// The tenant comes from the token. Calls without one, such as signup and
+// login, may name it in X-Tenant-Id, as a brand's storefront does; a call
+// naming a tenant other than its token's is refused with 403.
+func (v *Verifier) Middleware(route Route, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(headerUserID)
+		r.Header.Del(headerClientID)
+		r.Header.Del(headerScope)
+
+		requested := r.Header.Get(tenant.Header)
+		if requested != "" && !tenant.Valid(requested) {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "Invalid "+tenant.Header+": must be lowercase letters, digits and hyphens"))
+			return
+		}
+
+		token, hasToken := bearerToken(r)
+		if !hasToken {
+			if route.isPublic(r) {
+				infoFrom(r).client = "ip:" + clientIP(r)
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			problem.Write(w, r, problem.New(http.StatusUnauthorized, "A bearer token is required"))
+			return
+		}
+
+		claims, err := v.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			problem.Write(w, r, problem.New(http.StatusUnauthorized, err.Error()))
+			return
+		}
+
+		tokenTenant := claims.Tenant
+		if tokenTenant == "" {
+			tokenTenant = tenant.Default
+		}
+		if requested != "" && requested != tokenTenant {
+			problem.Write(w, r, problem.New(http.StatusForbidden, "Token was not issued for tenant "+requested))
+			return
+		}
+
+		if scope := route.requiredScope(r); scope != "" && !claims.hasScope(scope) {
+			problem.Write(w, r, problem.New(http.StatusForbidden, "The "+scope+" scope is required"))
+			return
+		}
+
+		r.Header.Set(tenant.Header, tokenTenant)
+		r.Header.Set(headerUserID, claims.Subject)
+		r.Header.Set(headerClientID, claims.client())
+		if claims.Scope != "" {
+			r.Header.Set(headerScope, claims.Scope)
+		}
+		infoFrom(r).client = claims.client()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// Verify checks token's signature and its time, issuer and audience
+// claims. Errors are safe to return to the client.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Token is malformed")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("Token header is malformed")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("Token signature is malformed")
+	}
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("Token claims are malformed")
+	}
+	if err := v.checkClaims(&claims); err != nil {
+		return nil, err
+	}
+	if err := v.readTenant(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// readTenant sets c.Tenant from the tenant claim of the claims segment,
+// which must be a valid tenant ID when present.
+func (v *Verifier) readTenant(segment string, c *Claims) error {
+	if v.tenantClaim == "" {
+		return nil
+	}
+	var all map[string]interface{}
+	if err := decodeSegment(segment, &all); err != nil {
+		return errors.New("Token claims are malformed")
+	}
+	value, ok := all[v.tenantClaim]
+	if !ok {
+		return nil
+	}
+	id, ok := value.(string)
+	if !ok || !tenant.Valid(id) {
+		return errors.New("Token tenant is invalid")
+	}
+	c.Tenant = id
+	return nil
+}
+
+func (v *Verifier) verifySignature(alg, signed string, signature []byte) error {
+	switch alg {
+	case "HS256":
+		if len(v.hmacSecret) == 0 {
+			break
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("Token signature is invalid")
+		}
+		return nil
+	case "RS256":
+		if v.publicKey == nil {
+			break
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(v.publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("Token signature is invalid")
+		}
+		return nil
+	}
+	return fmt.Errorf("Token algorithm %q is not accepted", alg)
+}
+
+func (v *Verifier) checkClaims(c *Claims) error {
+	now := clk.Now()
+	if c.ExpiresAt == nil {
+		return errors.New("Token has no expiry")
+	}
+	if now.After(unixTime(*c.ExpiresAt).Add(jwtLeeway)) {
+		return errors.New("Token has expired")
+	}
+	if c.NotBefore != nil && now.Add(jwtLeeway).Before(unixTime(*c.NotBefore)) {
+		return errors.New("Token is not valid yet")
+	}
+	if c.Subject == "" {
+		return errors.New("Token has no subject")
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return errors.New("Token issuer is not accepted")
+	}
+	if v.audience != "" && !c.Audience.contains(v.audience) {
+		return errors.New("Token audience is not accepted")
+	}
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
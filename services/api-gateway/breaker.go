@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Breaker stops sending requests to a backend after threshold consecutive
+// failures. Once cooldown has passed a single trial request goes through:
+// success closes the breaker, failure opens it for another cooldown.
+type Breaker struct {
+	backend   string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// newBreakerFromEnv reads BREAKER_FAILURE_THRESHOLD and
+// BREAKER_COOLDOWN_SECONDS, shared by every backend.
+func newBreakerFromEnv(backend string) *Breaker {
+	return &Breaker{
+		backend:   backend,
+		threshold: getEnvInt("BREAKER_FAILURE_THRESHOLD", 5),
+		cooldown:  time.Duration(getEnvInt("BREAKER_COOLDOWN_SECONDS", 30)) * time.Second,
+	}
+}
+
+// allow reports whether a request may go to the backend, and if not how
+// long until the next trial. Every allowed request must end in record or
+// release.
+func (b *Breaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		elapsed := clk.Now().Sub(b.openedAt)
+		if elapsed < b.cooldown {
+			return false, b.cooldown - elapsed
+		}
+		b.setState(breakerHalfOpen)
+		b.trial = true
+		return true, 0
+	case breakerHalfOpen:
+		if b.trial {
+			return false, time.Second
+		}
+		b.trial = true
+		return true, 0
+	}
+	return true, 0
+}
+
+// record reports the outcome of an allowed request.
+func (b *Breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+		b.failures = 0
+		b.trial = false
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.openedAt = clk.Now()
+		b.setState(breakerOpen)
+	}
+	b.trial = false
+}
+
+// release ends an allowed request that says nothing about the backend,
+// such as one the client abandoned.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *Breaker) setState(state breakerState) {
+	log.Printf("Circuit breaker for %s: %s -> %s after %d consecutive failures", b.backend, b.state, state, b.failures)
+	b.state = state
+}
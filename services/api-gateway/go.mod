@@ -0,0 +1,10 @@
+module api-gateway
+
+go 1.21
+
+require (
+	github.com/gorilla/mux v1.8.0
+	pkg v0.0.0
+)
+
+replace pkg => ../../pkg
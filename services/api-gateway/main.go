@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/ids"
+	"pkg/metrics"
+	"pkg/recovery"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	serverPort string
+	version    = "1.0.0"
+
+	// backendTimeout bounds how long a backend may take to start its
+	// response, inside the server's write timeout.
+	backendTimeout time.Duration
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+)
+
+func main() {
+	serverPort = getEnv("PORT", "8080")
+	backendTimeout = time.Duration(getEnvInt("BACKEND_TIMEOUT_SECONDS", 10)) * time.Second
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+
+	verifier, err := newVerifierFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure JWT validation: %v", err)
+	}
+	limiter, err := newRateLimiterFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure rate limits: %v", err)
+	}
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recovery.New("api-gateway", clk, idGen).Middleware)
+
+	// Request count, error rate and latency per route, scraped from
+	// /metrics
+	registry := metrics.NewRegistry()
+	router.Use(metrics.NewHTTP(registry, "api-gateway", routeTemplate, clk).Middleware)
+	router.Use(logRequests)
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.Handle("/metrics", registry.Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+	}
+
+	// Backend routes
+	for _, route := range routes {
+		target := os.Getenv(route.URLEnv)
+		if target == "" {
+			log.Printf("%s is not set, not routing %s", route.URLEnv, route.Prefix)
+			continue
+		}
+		proxy, err := newBackendProxy(route, target)
+		if err != nil {
+			log.Fatalf("Failed to configure %s: %v", route.Backend, err)
+		}
+
+		handler := verifier.Middleware(route, limiter.Middleware(proxy))
+		router.Path(route.Prefix).Handler(handler)
+		router.PathPrefix(route.Prefix + "/").Handler(handler)
+		log.Printf("Routing %s to %s at %s", route.Prefix, route.Backend, target)
+	}
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("API gateway starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "api-gateway",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
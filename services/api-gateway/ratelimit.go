@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/problem"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled are
+// dropped, so the limiter's memory follows the number of active clients.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimit is a token bucket's refill rate and size.
+type rateLimit struct {
+	rps   float64
+	burst float64
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter gives every client its own token bucket. Clients are named
+// by their token's client, or by IP for anonymous calls.
+type RateLimiter struct {
+	defaults  rateLimit
+	overrides map[string]rateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// newRateLimiterFromEnv reads the default RATE_LIMIT_RPS and
+// RATE_LIMIT_BURST, and per-client overrides from RATE_LIMITS as
+// "client=rps:burst,client=rps:burst".
+func newRateLimiterFromEnv() (*RateLimiter, error) {
+	rps := float64(getEnvInt("RATE_LIMIT_RPS", 20))
+	l := &RateLimiter{
+		defaults:  rateLimit{rps: rps, burst: float64(getEnvInt("RATE_LIMIT_BURST", int(rps)*2))},
+		overrides: make(map[string]rateLimit),
+		buckets:   make(map[string]*bucket),
+	}
+
+	if spec := os.Getenv("RATE_LIMITS"); spec != "" {
+		for _, entry := range strings.Split(spec, ",") {
+			client, limit, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid RATE_LIMITS entry %q", entry)
+			}
+			rpsValue, burstValue, _ := strings.Cut(limit, ":")
+			rps, err := strconv.ParseFloat(rpsValue, 64)
+			if err != nil || rps <= 0 {
+				return nil, fmt.Errorf("invalid rate in RATE_LIMITS entry %q", entry)
+			}
+			burst := rps * 2
+			if burstValue != "" {
+				if burst, err = strconv.ParseFloat(burstValue, 64); err != nil || burst < 1 {
+					return nil, fmt.Errorf("invalid burst in RATE_LIMITS entry %q", entry)
+				}
+			}
+			l.overrides[client] = rateLimit{rps: rps, burst: burst}
+		}
+	}
+	return l, nil
+}
+
+func (l *RateLimiter) limitFor(client string) rateLimit {
+	if limit, ok := l.overrides[client]; ok {
+		return limit
+	}
+	return l.defaults
+}
+
+// take spends one of client's tokens. When none is left it returns how
+// long until one is.
+func (l *RateLimiter) take(client string) (bool, time.Duration) {
+	now := clk.Now()
+	limit := l.limitFor(client)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: limit.burst, updated: now}
+		l.buckets[client] = b
+	}
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(limit.burst, b.tokens+elapsed*limit.rps)
+		b.updated = now
+	}
+
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / limit.rps
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that would be full by now; a new bucket starts full,
+// so forgetting them changes nothing.
+func (l *RateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		limit := l.limitFor(client)
+		if b.tokens+now.Sub(b.updated).Seconds()*limit.rps >= limit.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// Middleware rejects a client's requests with 429 once its bucket is
+// empty. It runs after authentication, which names the client.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := infoFrom(r).client
+		limit := l.limitFor(client)
+		w.Header().Set("X-RateLimit-Limit", strconv.FormatFloat(limit.rps, 'f', -1, 64))
+
+		if ok, retryAfter := l.take(client); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+			problem.Write(w, r, problem.New(http.StatusTooManyRequests, "Rate limit exceeded"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds for Retry-After.
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"pkg/clock"
+	"pkg/problem"
+)
+
+// Route sends every request under Prefix to one backend service, whose
+// base URL is read from URLEnv. Backends serve the same paths the gateway
+// exposes, so paths are forwarded unchanged.
+type Route struct {
+	Prefix  string
+	Backend string
+	URLEnv  string
+	// Public lists the methods that may be called without a token.
+	Public []string
+	// PublicTree makes the Public methods public on every path under
+	// Prefix rather than only on the collection.
+	PublicTree bool
+	// Scoped maps paths under Prefix to the scope a token must carry to
+	// call them. The backend checks the scope too.
+	Scoped map[string]string
+}
+
+var routes = []Route{
+	// Sign-up is the one anonymous user call; exporting every user is for
+	// admins.
+	{Prefix: "/users", Backend: "user-service", URLEnv: "USER_SERVICE_URL", Public: []string{"POST"},
+		Scoped: map[string]string{"/users/export": "admin"}},
+	// Cognito sign-up, login and refresh are how callers get a token.
+	{Prefix: "/auth", Backend: "user-service", URLEnv: "USER_SERVICE_URL", Public: []string{"POST"}, PublicTree: true},
+	// The catalogue can be browsed anonymously.
+	{Prefix: "/products", Backend: "product-service", URLEnv: "PRODUCT_SERVICE_URL", Public: []string{"GET", "HEAD"}},
+	{Prefix: "/orders", Backend: "order-service", URLEnv: "ORDER_SERVICE_URL"},
+	{Prefix: "/carts", Backend: "cart-service", URLEnv: "CART_SERVICE_URL"},
+	// Checkout turns the caller's cart into a paid order.
+	{Prefix: "/checkout", Backend: "checkout-service", URLEnv: "CHECKOUT_SERVICE_URL"},
+	// Coupons are managed by callers with the coupons scope.
+	{Prefix: "/coupons", Backend: "checkout-service", URLEnv: "CHECKOUT_SERVICE_URL"},
+	// The storefront records the ad click a visitor landed from before
+	// they have signed in.
+	{Prefix: "/clicks", Backend: "attribution-service", URLEnv: "ATTRIBUTION_SERVICE_URL", Public: []string{"POST"}},
+	{Prefix: "/graphql", Backend: "graphql-service", URLEnv: "GRAPHQL_SERVICE_URL"},
+	// Webhooks are managed by API clients with the webhooks scope.
+	{Prefix: "/webhooks", Backend: "webhook-service", URLEnv: "WEBHOOK_SERVICE_URL"},
+	// Bid changes are decided by users with the approvals scope, or
+	// through the signed one-click links in reports, which carry no token.
+	{Prefix: "/approvals", Backend: "ads-api", URLEnv: "ADS_API_URL"},
+	{Prefix: "/approval-links", Backend: "ads-api", URLEnv: "ADS_API_URL", Public: []string{"GET", "POST"}, PublicTree: true},
+	// The log of applied bid changes is read by users and API clients with
+	// the audit scope.
+	{Prefix: "/audit", Backend: "ads-api", URLEnv: "ADS_API_URL"},
+	// Ad performance reports are pulled by users and API clients with the
+	// reports scope.
+	{Prefix: "/reports", Backend: "reports-service", URLEnv: "REPORTS_SERVICE_URL"},
+	// Sent notifications and the suppression list are managed by callers
+	// with the notifications scope.
+	{Prefix: "/notifications", Backend: "notification-service", URLEnv: "NOTIFICATION_SERVICE_URL"},
+	{Prefix: "/suppressions", Backend: "notification-service", URLEnv: "NOTIFICATION_SERVICE_URL"},
+	// Users set their own notification channels and schedule.
+	{Prefix: "/notification-preferences", Backend: "notification-service", URLEnv: "NOTIFICATION_SERVICE_URL"},
+}
+
+// isPublic reports whether r may reach the route without a token. Unless
+// the route is a PublicTree, only the collection itself is public for POST,
+// so sign-up does not open up the user sub-resources.
+func (route Route) isPublic(r *http.Request) bool {
+	for _, method := range route.Public {
+		if r.Method != method {
+			continue
+		}
+		if method == "POST" && !route.PublicTree {
+			return r.URL.Path == route.Prefix
+		}
+		return true
+	}
+	return false
+}
+
+// requiredScope returns the scope a token must carry for r, or "" if any
+// valid token will do.
+func (route Route) requiredScope(r *http.Request) string {
+	return route.Scoped[strings.TrimRight(r.URL.Path, "/")]
+}
+
+// Headers the gateway sets from the verified token. Incoming values are
+// dropped so clients cannot impersonate each other to the backends.
+const (
+	headerUserID   = "X-User-Id"
+	headerClientID = "X-Client-Id"
+	headerScope    = "X-Auth-Scope"
+)
+
+// newBackendProxy forwards requests to target through route's circuit
+// breaker.
+func newBackendProxy(route Route, target string) (http.Handler, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s %q", route.URLEnv, target)
+	}
+
+	breaker := newBreakerFromEnv(route.Backend)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.Transport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: backendTimeout}).DialContext,
+		MaxIdleConnsPerHost:   32,
+		ResponseHeaderTimeout: backendTimeout,
+	}
+
+	// Backend 5xx responses trip the breaker like transport errors do;
+	// 4xx are the client's fault.
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		breaker.record(resp.StatusCode < 500)
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if r.Context().Err() != nil {
+			// The client went away; say nothing about the backend.
+			breaker.release()
+			return
+		}
+		breaker.record(false)
+		log.Printf("Failed to proxy %s %s to %s: %v", r.Method, r.URL.Path, route.Backend, err)
+
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) || isTimeout(err) {
+			status = http.StatusGatewayTimeout
+		}
+		problem.Write(w, r, problem.New(status, route.Backend+" is unavailable"))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retryAfter := breaker.allow(); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+			problem.Write(w, r, problem.New(http.StatusServiceUnavailable,
+				route.Backend+" is failing; requests are paused while it recovers"))
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}), nil
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// requestInfo carries what inner handlers learn about a request back out
+// to the request log.
+type requestInfo struct {
+	client string
+}
+
+type requestInfoKey struct{}
+
+func infoFrom(r *http.Request) *requestInfo {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info
+	}
+	return &requestInfo{}
+}
+
+// logRequests assigns each request an X-Request-Id, passed to the backend
+// and returned to the client, and logs one line per request once the
+// response is written.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := clk.Now()
+		requestID := r.Header.Get("X-Request-Id")
+		if requestID == "" {
+			requestID = idGen.NewID()
+			r.Header.Set("X-Request-Id", requestID)
+		}
+		w.Header().Set("X-Request-Id", requestID)
+
+		info := &requestInfo{}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+		lw := &loggingWriter{ResponseWriter: w}
+		defer func() {
+			status := lw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			client := info.client
+			if client == "" {
+				client = "-"
+			}
+			log.Printf("%s %s %d %dB %s client=%s request_id=%s",
+				r.Method, r.URL.Path, status, lw.bytes, clock.Since(clk, start), client, requestID)
+		}()
+		next.ServeHTTP(lw, r)
+	})
+}
+
+// loggingWriter records the status and size of a response. Flush and
+// Unwrap keep streamed backend responses streaming.
+type loggingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *loggingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *loggingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *loggingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *loggingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// clientIP is the caller's address. The load balancer appends it to
+// X-Forwarded-For; earlier entries come from the client and can be forged.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		return strings.TrimSpace(hops[len(hops)-1])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"pkg/attribution"
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// ResolveRequest asks for an order to be attributed. checkout-service
+// sends it once the order exists, with the checkout's user and the
+// storefront's anonymous visitor ID; OrderedAt defaults to now.
+type ResolveRequest struct {
+	OrderID   string     `json:"order_id" validate:"required,max=64"`
+	UserID    string     `json:"user_id,omitempty" validate:"max=128"`
+	VisitorID string     `json:"visitor_id,omitempty" validate:"max=128"`
+	Value     float64    `json:"value" validate:"min=0"`
+	Currency  string     `json:"currency" validate:"required,currency"`
+	OrderedAt *time.Time `json:"ordered_at,omitempty"`
+}
+
+// resolveHandler attributes an order to its last click within the
+// lookback, answering 201 with the new record or 200 with the one the
+// order already has.
+func resolveHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	order := attribution.Order{
+		ID:        req.OrderID,
+		UserID:    req.UserID,
+		VisitorID: req.VisitorID,
+		Value:     req.Value,
+		Currency:  req.Currency,
+	}
+	if req.OrderedAt != nil {
+		order.OrderedAt = *req.OrderedAt
+	}
+
+	record, created, err := store.Resolve(r.Context(), order)
+	if err != nil {
+		log.Printf("Failed to resolve attribution of order %s: %v", req.OrderID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	if !created {
+		writeJSON(w, http.StatusOK, record)
+		return
+	}
+	log.Printf("Order %s resolved %s with %d touchpoints", record.OrderID, record.Status, len(record.Touchpoints))
+	writeJSON(w, http.StatusCreated, record)
+}
+
+// getAttributionHandler returns an order's attribution.
+func getAttributionHandler(w http.ResponseWriter, r *http.Request) {
+	record, err := store.Lookup(r.Context(), mux.Vars(r)["orderId"])
+	if errors.Is(err, attribution.ErrNotFound) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Attribution not found"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up attribution: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"pkg/attribution"
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// clockSkew is how far ahead of the server a browser's click time may be.
+const clockSkew = 5 * time.Minute
+
+// ClickRequest is a visitor landing on the store. The storefront sends it
+// when the landing URL carries a gclid, wbraid or gbraid; signed-in
+// visitors are identified by their token, the others by VisitorID, the
+// storefront's anonymous ID.
+type ClickRequest struct {
+	LandingURL string     `json:"landing_url" validate:"required,max=2048"`
+	VisitorID  string     `json:"visitor_id,omitempty" validate:"max=128"`
+	SessionID  string     `json:"session_id,omitempty" validate:"max=128"`
+	Referrer   string     `json:"referrer,omitempty" validate:"max=2048"`
+	ClickedAt  *time.Time `json:"clicked_at,omitempty"`
+}
+
+// captureClickHandler stores the click of a landing URL, answering 201
+// with it. Capturing the same click again stores it once.
+func captureClickHandler(w http.ResponseWriter, r *http.Request) {
+	var req ClickRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	click, err := attribution.FromLanding(req.LandingURL)
+	if errors.Is(err, attribution.ErrNoClickID) {
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "landing_url has no gclid, wbraid or gbraid"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "landing_url must be an http(s) URL"))
+		return
+	}
+
+	click.UserID = r.Header.Get("X-User-Id")
+	if click.UserID == "" {
+		click.UserID = req.VisitorID
+	}
+	if click.UserID == "" {
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "visitor_id is required for visitors who are not signed in"))
+		return
+	}
+	click.SessionID = req.SessionID
+	click.Referrer = req.Referrer
+
+	now := clk.Now()
+	if req.ClickedAt != nil {
+		if req.ClickedAt.After(now.Add(clockSkew)) || req.ClickedAt.Before(now.Add(-attribution.MaxLookback)) {
+			problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "clicked_at must be within the last 90 days"))
+			return
+		}
+		click.Timestamp = *req.ClickedAt
+	}
+
+	if err := store.Capture(r.Context(), &click); err != nil {
+		log.Printf("Failed to capture click: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusCreated, click)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/mux"
+
+	"pkg/attribution"
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/health"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/recovery"
+	"pkg/tenant"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient *dynamodb.Client
+	serverPort   string
+	version      = "1.0.0"
+
+	// store holds the clicks and the orders' attributions.
+	store *attribution.Store
+
+	clk clock.Clock = clock.Real{}
+
+	// recoverer reports panics in handlers.
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	serverPort = getEnv("PORT", "3012")
+
+	clk = clock.FromEnv()
+	recoverer = recovery.New("attribution-service", clk, ids.FromEnv(clk))
+
+	clicks := dynamo.NewTable(dynamoClient, getEnv("AD_CLICKS_TABLE_NAME", "ad-clicks"), dynamo.WithTimeout(5*time.Second))
+	records := dynamo.NewTable(dynamoClient, getEnv("ATTRIBUTIONS_TABLE_NAME", "attributions"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second))
+	lookback := time.Duration(getEnvInt("ATTRIBUTION_LOOKBACK_DAYS", 30)) * 24 * time.Hour
+	store = attribution.NewStore(clicks, records, clk, lookback)
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware, tenant.Middleware)
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("attribution-service", clk,
+		health.Table(dynamoClient, clicks.Name, true),
+		health.Table(dynamoClient, records.Name, true),
+	).Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+	}
+
+	// Click capture, called by the storefront when a visitor lands
+	router.HandleFunc("/clicks", captureClickHandler).Methods("POST")
+
+	// Order attribution, resolved by checkout-service as it creates the
+	// order and looked up by order
+	router.HandleFunc("/attributions", resolveHandler).Methods("POST")
+	router.HandleFunc("/attributions/{orderId}", getAttributionHandler).Methods("GET")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Attribution service starting on port %s (lookback %s)", serverPort, store.Lookback())
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "attribution-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
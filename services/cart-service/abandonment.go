@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"pkg/events"
+	"pkg/problem"
+)
+
+// abandonmentIndex is the GSI on (status, last_activity_at) used to find
+// idle carts without scanning the table.
+const abandonmentIndex = "status-last_activity_index"
+
+// runAbandonmentSweeper periodically marks idle carts abandoned. Every task
+// runs it; the conditional update in markAbandoned ensures each cart is
+// emitted once. A panicking sweep is recovered so the next tick still runs.
+func runAbandonmentSweeper(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			recoverer.Do("abandonment sweep", func() {
+				if n, err := sweepAbandonedCarts(ctx); err != nil {
+					log.Printf("Failed to sweep abandoned carts: %v", err)
+				} else if n > 0 {
+					log.Printf("Marked %d carts abandoned", n)
+				}
+			})
+		}
+	}
+}
+
+// sweepHandler runs one sweep on demand; registered only in test mode.
+func sweepHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := sweepAbandonedCarts(r.Context())
+	if err != nil {
+		log.Printf("Failed to sweep abandoned carts: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"abandoned": n})
+}
+
+// sweepAbandonedCarts finds active, non-empty carts idle for longer than
+// idleWindow, marks them abandoned and publishes an event for each.
+func sweepAbandonedCarts(ctx context.Context) (int, error) {
+	now := clk.Now()
+	cutoff := now.Add(-idleWindow).Unix()
+
+	var abandoned int
+	var lastKey map[string]types.AttributeValue
+	for {
+		result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(tableName),
+			IndexName:              aws.String(abandonmentIndex),
+			KeyConditionExpression: aws.String("#status = :active AND last_activity_at < :cutoff"),
+			FilterExpression:       aws.String("size(#items) > :zero"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "status",
+				"#items":  "items",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":active": &types.AttributeValueMemberS{Value: CartStatusActive},
+				":cutoff": &types.AttributeValueMemberN{Value: strconv.FormatInt(cutoff, 10)},
+				":zero":   &types.AttributeValueMemberN{Value: "0"},
+			},
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return abandoned, fmt.Errorf("failed to query idle carts: %w", err)
+		}
+
+		var carts []Cart
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &carts); err != nil {
+			return abandoned, fmt.Errorf("failed to unmarshal carts: %w", err)
+		}
+
+		for _, cart := range carts {
+			ok, err := abandonCart(ctx, cart, now)
+			if err != nil {
+				log.Printf("Failed to abandon cart %s: %v", cart.ID, err)
+				continue
+			}
+			if ok {
+				abandoned++
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return abandoned, nil
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+}
+
+// abandonCart marks the cart abandoned and publishes the event. It returns
+// false if the cart changed since it was read (activity or another task got
+// there first). If publishing fails the cart is reverted to active so the
+// next sweep retries it.
+func abandonCart(ctx context.Context, cart Cart, now time.Time) (bool, error) {
+	if err := markAbandoned(ctx, cart, now); err != nil {
+		var conflict *types.ConditionalCheckFailedException
+		if errors.As(err, &conflict) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := publishAbandoned(ctx, cart, now); err != nil {
+		if revertErr := revertAbandoned(ctx, cart); revertErr != nil {
+			log.Printf("Failed to revert cart %s after publish error: %v", cart.ID, revertErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// markAbandoned flips the status only if the cart is unchanged since it was
+// read, so a cart edited mid-sweep is left active.
+func markAbandoned(ctx context.Context, cart Cart, now time.Time) error {
+	abandonedAt, err := attributevalue.Marshal(now)
+	if err != nil {
+		return fmt.Errorf("failed to marshal abandoned_at: %w", err)
+	}
+
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: cart.ID},
+		},
+		UpdateExpression:    aws.String("SET #status = :abandoned, abandoned_at = :abandoned_at"),
+		ConditionExpression: aws.String("#status = :active AND version = :version"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":abandoned":    &types.AttributeValueMemberS{Value: CartStatusAbandoned},
+			":abandoned_at": abandonedAt,
+			":active":       &types.AttributeValueMemberS{Value: CartStatusActive},
+			":version":      &types.AttributeValueMemberN{Value: strconv.FormatInt(cart.Version, 10)},
+		},
+	})
+	return err
+}
+
+func revertAbandoned(ctx context.Context, cart Cart) error {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: cart.ID},
+		},
+		UpdateExpression:    aws.String("SET #status = :active REMOVE abandoned_at"),
+		ConditionExpression: aws.String("#status = :abandoned AND version = :version"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":abandoned": &types.AttributeValueMemberS{Value: CartStatusAbandoned},
+			":active":    &types.AttributeValueMemberS{Value: CartStatusActive},
+			":version":   &types.AttributeValueMemberN{Value: strconv.FormatInt(cart.Version, 10)},
+		},
+	})
+	return err
+}
+
+func publishAbandoned(ctx context.Context, cart Cart, now time.Time) error {
+	var itemCount int
+	for _, item := range cart.Items {
+		itemCount += item.Quantity
+	}
+
+	items := make([]events.CartItem, len(cart.Items))
+	for i, item := range cart.Items {
+		items[i] = events.CartItem{SKU: item.SKU, Name: item.Name, Quantity: item.Quantity, UnitPrice: item.UnitPrice}
+	}
+	entry, err := eventEncoder.Marshal(ctx, events.CartAbandoned{
+		CartID:         cart.ID,
+		UserID:         cart.UserID,
+		Currency:       cart.Currency,
+		Subtotal:       cart.Subtotal,
+		ItemCount:      itemCount,
+		Items:          items,
+		LastActivityAt: time.Unix(cart.LastActivityAt, 0).UTC(),
+		AbandonedAt:    now,
+	})
+	if err != nil {
+		return err
+	}
+
+	result, err := eventBridgeClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{
+			{
+				EventBusName: aws.String(eventBusName),
+				Source:       aws.String(entry.Source),
+				DetailType:   aws.String(entry.DetailType),
+				Detail:       aws.String(entry.Detail),
+				Time:         aws.Time(now),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put event: %w", err)
+	}
+	if result.FailedEntryCount > 0 {
+		return fmt.Errorf("event rejected: %s", aws.ToString(result.Entries[0].ErrorMessage))
+	}
+	return nil
+}
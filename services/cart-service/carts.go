@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// Cart statuses. An abandoned cart becomes active again on any change. A
+// merged cart was folded into another when its anonymous owner logged in,
+// and is read-only.
+const (
+	CartStatusActive    = "ACTIVE"
+	CartStatusAbandoned = "ABANDONED"
+	CartStatusMerged    = "MERGED"
+)
+
+// maxItems bounds a cart so the DynamoDB item stays well under 400 KB.
+const maxItems = 100
+
+type Cart struct {
+	ID          string     `json:"id" dynamodbav:"id"`
+	UserID      string     `json:"user_id,omitempty" dynamodbav:"user_id,omitempty"`
+	Currency    string     `json:"currency" dynamodbav:"currency"`
+	Items       []CartItem `json:"items" dynamodbav:"items"`
+	Subtotal    float64    `json:"subtotal" dynamodbav:"subtotal"`
+	Status      string     `json:"status" dynamodbav:"status"`
+	Version     int64      `json:"version" dynamodbav:"version"`
+	CreatedAt   time.Time  `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" dynamodbav:"updated_at"`
+	AbandonedAt *time.Time `json:"abandoned_at,omitempty" dynamodbav:"abandoned_at,omitempty"`
+	MergedInto  string     `json:"merged_into,omitempty" dynamodbav:"merged_into,omitempty"`
+
+	// LastActivityAt (epoch seconds) is the sort key of the abandonment
+	// index; ExpiresAt is the DynamoDB TTL attribute.
+	LastActivityAt int64 `json:"-" dynamodbav:"last_activity_at"`
+	ExpiresAt      int64 `json:"-" dynamodbav:"expires_at"`
+}
+
+// CartItem is a line of a cart. UnitPrice is product-service's price of
+// the product when the line was last added to.
+type CartItem struct {
+	ProductID string  `json:"product_id,omitempty" dynamodbav:"product_id,omitempty"`
+	SKU       string  `json:"sku" dynamodbav:"sku"`
+	Name      string  `json:"name" dynamodbav:"name"`
+	Quantity  int     `json:"quantity" dynamodbav:"quantity"`
+	UnitPrice float64 `json:"unit_price" dynamodbav:"unit_price"`
+}
+
+// AddItemRequest adds a product to a cart. Its SKU and price are read
+// from product-service; Name is only a display label.
+type AddItemRequest struct {
+	ProductID string `json:"product_id" validate:"required,max=64"`
+	Name      string `json:"name" validate:"max=200"`
+	Quantity  int    `json:"quantity" validate:"required,min=1,max=99"`
+}
+
+type CreateCartRequest struct {
+	UserID   string `json:"user_id,omitempty" validate:"uuid"`
+	Currency string `json:"currency" validate:"required,currency"`
+}
+
+type UpdateItemRequest struct {
+	Quantity int `json:"quantity" validate:"min=0,max=99"`
+}
+
+// skuParam validates the {sku} path parameter with the same rule as bodies.
+type skuParam struct {
+	SKU string `json:"sku" validate:"sku"`
+}
+
+var (
+	errCartNotFound = errors.New("cart not found")
+	errCartConflict = errors.New("cart was modified concurrently")
+)
+
+func createCartHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	now := clk.Now()
+	cart := Cart{
+		ID:        idGen.NewID(),
+		UserID:    req.UserID,
+		Currency:  req.Currency,
+		Items:     []CartItem{},
+		Status:    CartStatusActive,
+		CreatedAt: now,
+	}
+	touch(&cart, now)
+
+	if err := saveCart(r.Context(), cart, 0); err != nil {
+		log.Printf("Failed to save cart: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	w.Header().Set("Location", "/carts/"+cart.ID)
+	writeJSON(w, http.StatusCreated, cart)
+}
+
+func getCartHandler(w http.ResponseWriter, r *http.Request) {
+	cart, err := getCartByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cart)
+}
+
+func deleteCartHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := dynamoClient.DeleteItem(r.Context(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: mux.Vars(r)["id"]},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to delete cart: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addItemHandler adds a product at its current price, or increases its
+// quantity and reprices it if the SKU is already in the cart.
+func addItemHandler(w http.ResponseWriter, r *http.Request) {
+	var req AddItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	price, err := currentPrice(r, req.ProductID)
+	switch {
+	case errors.Is(err, errProductNotFound):
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "Product not found"))
+		return
+	case err != nil:
+		log.Printf("Failed to price product %s: %v", req.ProductID, err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, "Product price is unavailable"))
+		return
+	}
+	item := CartItem{
+		ProductID: price.ProductID,
+		SKU:       price.SKU,
+		Name:      req.Name,
+		Quantity:  req.Quantity,
+		UnitPrice: price.Price,
+	}
+
+	cart, err := modifyCart(r.Context(), mux.Vars(r)["id"], func(cart *Cart) error {
+		if cart.Currency != price.Currency {
+			return problem.New(http.StatusConflict, fmt.Sprintf("product is priced in %s, the cart in %s", price.Currency, cart.Currency))
+		}
+		for i := range cart.Items {
+			if cart.Items[i].SKU == item.SKU {
+				cart.Items[i].Quantity += item.Quantity
+				cart.Items[i].ProductID = item.ProductID
+				cart.Items[i].UnitPrice = item.UnitPrice
+				if item.Name != "" {
+					cart.Items[i].Name = item.Name
+				}
+				return nil
+			}
+		}
+		if len(cart.Items) >= maxItems {
+			return problem.New(http.StatusConflict, fmt.Sprintf("a cart holds at most %d items", maxItems))
+		}
+		cart.Items = append(cart.Items, item)
+		return nil
+	})
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cart)
+}
+
+// updateItemHandler sets an item's quantity; zero removes it.
+func updateItemHandler(w http.ResponseWriter, r *http.Request) {
+	sku, ok := skuFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	cart, err := modifyCart(r.Context(), mux.Vars(r)["id"], func(cart *Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].SKU == sku {
+				if req.Quantity == 0 {
+					cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+				} else {
+					cart.Items[i].Quantity = req.Quantity
+				}
+				return nil
+			}
+		}
+		return problem.New(http.StatusNotFound, fmt.Sprintf("item %s is not in the cart", sku))
+	})
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cart)
+}
+
+func removeItemHandler(w http.ResponseWriter, r *http.Request) {
+	sku, ok := skuFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	cart, err := modifyCart(r.Context(), mux.Vars(r)["id"], func(cart *Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].SKU == sku {
+				cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+				return nil
+			}
+		}
+		return problem.New(http.StatusNotFound, fmt.Sprintf("item %s is not in the cart", sku))
+	})
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cart)
+}
+
+// modifyCart applies fn to the stored cart and saves it, guarded by the
+// cart's version so concurrent edits from two tabs cannot lose an item.
+// Any change counts as activity: it pushes out the idle window and TTL and
+// reactivates an abandoned cart.
+func modifyCart(ctx context.Context, cartID string, fn func(*Cart) error) (Cart, error) {
+	cart, err := getCartByID(ctx, cartID)
+	if err != nil {
+		return Cart{}, err
+	}
+	if cart.Status == CartStatusMerged {
+		return Cart{}, problem.New(http.StatusConflict, "cart was merged into cart "+cart.MergedInto)
+	}
+
+	if err := fn(&cart); err != nil {
+		return Cart{}, err
+	}
+
+	if cart.Status == CartStatusAbandoned {
+		log.Printf("Cart %s recovered after abandonment", cart.ID)
+	}
+	cart.Status = CartStatusActive
+	cart.AbandonedAt = nil
+	touch(&cart, clk.Now())
+
+	expected := cart.Version
+	if err := saveCart(ctx, cart, expected); err != nil {
+		return Cart{}, err
+	}
+	cart.Version = expected + 1
+	return cart, nil
+}
+
+// touch records activity on the cart at now.
+func touch(cart *Cart, now time.Time) {
+	var subtotal float64
+	for _, item := range cart.Items {
+		subtotal += float64(item.Quantity) * item.UnitPrice
+	}
+	cart.Subtotal = math.Round(subtotal*100) / 100
+	cart.UpdatedAt = now
+	cart.LastActivityAt = now.Unix()
+	cart.ExpiresAt = now.Add(cartTTL).Unix()
+}
+
+func skuFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	sku := mux.Vars(r)["sku"]
+	if err := validate.Struct(skuParam{SKU: sku}); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "sku must be 3-32 uppercase letters, digits or dashes"))
+		return "", false
+	}
+	return sku, true
+}
+
+func writeCartError(w http.ResponseWriter, r *http.Request, err error) {
+	var p problem.Problem
+	switch {
+	case errors.As(err, &p):
+		problem.Write(w, r, p)
+	case errors.Is(err, errCartNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Cart not found"))
+	case errors.Is(err, errCartConflict):
+		problem.Write(w, r, problem.New(http.StatusConflict, "Cart was modified concurrently; retry the request"))
+	default:
+		log.Printf("Cart operation failed: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+	}
+}
+
+// DynamoDB operations
+
+// saveCart writes the cart if the stored version still equals expected
+// (0 for a new cart) and bumps the version.
+func saveCart(ctx context.Context, cart Cart, expected int64) error {
+	cart.Version = expected + 1
+	item, err := attributevalue.MarshalMap(cart)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cart: %w", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	}
+	if expected == 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(id)")
+	} else {
+		input.ConditionExpression = aws.String("version = :expected")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":expected": &types.AttributeValueMemberN{Value: strconv.FormatInt(expected, 10)},
+		}
+	}
+
+	_, err = dynamoClient.PutItem(ctx, input)
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		return errCartConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save cart: %w", err)
+	}
+	return nil
+}
+
+func getCartByID(ctx context.Context, cartID string) (Cart, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: cartID},
+		},
+	})
+	if err != nil {
+		return Cart{}, fmt.Errorf("failed to get cart: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return Cart{}, errCartNotFound
+	}
+
+	var cart Cart
+	if err := attributevalue.UnmarshalMap(result.Item, &cart); err != nil {
+		return Cart{}, fmt.Errorf("failed to unmarshal cart: %w", err)
+	}
+
+	// TTL deletion can lag expiry by up to two days.
+	if cart.ExpiresAt > 0 && cart.ExpiresAt < clk.Now().Unix() {
+		return Cart{}, errCartNotFound
+	}
+	return cart, nil
+}
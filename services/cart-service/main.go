@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/events"
+	"pkg/health"
+	"pkg/idempotency"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/recovery"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient      *dynamodb.Client
+	eventBridgeClient *eventbridge.Client
+	tableName         string
+	eventBusName      string
+	eventEncoder      *events.Encoder
+	serverPort        string
+	version           = "1.0.0"
+
+	// idleWindow is how long a cart with items may go untouched before it
+	// is considered abandoned; cartTTL is when DynamoDB deletes it.
+	idleWindow    time.Duration
+	cartTTL       time.Duration
+	sweepInterval time.Duration
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+
+	// recoverer reports panics in handlers and the sweeper.
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	eventBridgeClient = eventbridge.NewFromConfig(cfg)
+	tableName = getEnv("CARTS_TABLE_NAME", "carts")
+	eventBusName = getEnv("EVENT_BUS_NAME", "default")
+	serverPort = getEnv("PORT", "3003")
+	productServiceURL = strings.TrimRight(os.Getenv("PRODUCT_SERVICE_URL"), "/")
+
+	idleWindow = time.Duration(getEnvInt("CART_IDLE_MINUTES", 60)) * time.Minute
+	cartTTL = time.Duration(getEnvInt("CART_TTL_DAYS", 30)) * 24 * time.Hour
+	sweepInterval = time.Duration(getEnvInt("CART_SWEEP_INTERVAL_SECONDS", 60)) * time.Second
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+	eventEncoder = &events.Encoder{Clock: clk, IDs: idGen}
+	recoverer = recovery.New("cart-service", clk, idGen)
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id"))
+
+	// Idempotency-Key support for POST retries
+	if table := os.Getenv("IDEMPOTENCY_TABLE_NAME"); table != "" {
+		router.Use(idempotency.NewStore(dynamoClient, table, clk).Middleware)
+	}
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("cart-service", clk,
+		health.Table(dynamoClient, tableName, true),
+	).Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs, manual abandonment sweeps")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+		router.HandleFunc("/__test/abandonment-sweep", sweepHandler).Methods("POST")
+	} else {
+		go runAbandonmentSweeper(context.Background())
+	}
+
+	// Cart endpoints
+	router.HandleFunc("/carts", createCartHandler).Methods("POST")
+	router.HandleFunc("/carts/merge", mergeCartsHandler).Methods("POST")
+	router.HandleFunc("/carts/{id}", getCartHandler).Methods("GET")
+	router.HandleFunc("/carts/{id}", deleteCartHandler).Methods("DELETE")
+	router.HandleFunc("/carts/{id}/items", addItemHandler).Methods("POST")
+	router.HandleFunc("/carts/{id}/items/{sku}", updateItemHandler).Methods("PUT")
+	router.HandleFunc("/carts/{id}/items/{sku}", removeItemHandler).Methods("DELETE")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Cart service starting on port %s (idle window %s)", serverPort, idleWindow)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "cart-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
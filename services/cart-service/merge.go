@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// ownerIndex is the GSI on (user_id, last_activity_at) listing a user's
+// carts by activity.
+const ownerIndex = "user_id-last_activity_index"
+
+// MergeCartsRequest hands an anonymous visitor's carts to the user they
+// logged in or registered as. user-service sends it as part of merging
+// the visitor into the user.
+type MergeCartsRequest struct {
+	AnonymousID string `json:"anonymous_id" validate:"required,uuid"`
+	UserID      string `json:"user_id" validate:"required,uuid"`
+}
+
+// MergeCartsResult is what a merge did to the anonymous carts.
+type MergeCartsResult struct {
+	// CartID is the user's open cart after the merge, if any.
+	CartID string `json:"cart_id,omitempty"`
+	// CartsMerged were folded into CartID; CartsReassigned could not be
+	// combined and now belong to the user as they are.
+	CartsMerged     int `json:"carts_merged"`
+	CartsReassigned int `json:"carts_reassigned"`
+}
+
+func mergeCartsHandler(w http.ResponseWriter, r *http.Request) {
+	var req MergeCartsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+	if req.AnonymousID == req.UserID {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "anonymous_id must differ from user_id"))
+		return
+	}
+
+	result, err := mergeCarts(r.Context(), req.AnonymousID, req.UserID)
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+	if result.CartsMerged+result.CartsReassigned > 0 {
+		log.Printf("Merged carts of %s into user %s: %d merged, %d reassigned",
+			req.AnonymousID, req.UserID, result.CartsMerged, result.CartsReassigned)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// mergeCarts applies the cart conflict rules:
+//
+//   - the user's most recently active open cart is the target; if the user
+//     has none, the first open anonymous cart is handed over and becomes it
+//   - each other open anonymous cart is folded into the target and marked
+//     MERGED; a SKU in both carts keeps the larger quantity (the shopper
+//     re-adding the same item on a second device should not double it) and
+//     the price and name from the more recently updated cart
+//   - carts in another currency, or that would exceed the item limit, are
+//     not combined but reassigned to the user as they are
+//   - closed anonymous carts are reassigned for history
+//
+// The target is written before the source is marked merged; taking the
+// larger quantity makes replaying a half-finished fold harmless, and every
+// write is guarded by the cart's version.
+func mergeCarts(ctx context.Context, anonymousID, userID string) (MergeCartsResult, error) {
+	var result MergeCartsResult
+	anonCarts, err := cartsOwnedBy(ctx, anonymousID)
+	if err != nil || len(anonCarts) == 0 {
+		return result, err
+	}
+	userCarts, err := cartsOwnedBy(ctx, userID)
+	if err != nil {
+		return result, err
+	}
+
+	var target *Cart
+	for i := range userCarts {
+		if isOpen(userCarts[i]) {
+			target = &userCarts[i]
+			break
+		}
+	}
+
+	for i := range anonCarts {
+		cart := anonCarts[i]
+		if !isOpen(cart) {
+			if err := reassignCart(ctx, &cart, userID); err != nil {
+				return result, err
+			}
+			result.CartsReassigned++
+			continue
+		}
+		if target == nil {
+			if err := reassignCart(ctx, &cart, userID); err != nil {
+				return result, err
+			}
+			target = &cart
+			result.CartsReassigned++
+			continue
+		}
+
+		items, ok := combineItems(*target, cart)
+		if !ok {
+			if err := reassignCart(ctx, &cart, userID); err != nil {
+				return result, err
+			}
+			result.CartsReassigned++
+			continue
+		}
+		if err := replaceItems(ctx, target, items); err != nil {
+			return result, err
+		}
+		if err := markMerged(ctx, &cart, target.ID, userID); err != nil {
+			return result, err
+		}
+		result.CartsMerged++
+	}
+
+	if target != nil {
+		result.CartID = target.ID
+	}
+	return result, nil
+}
+
+func isOpen(cart Cart) bool {
+	return cart.Status == CartStatusActive || cart.Status == CartStatusAbandoned
+}
+
+// combineItems returns target's items with source's folded in, or false
+// if the carts cannot be combined.
+func combineItems(target, source Cart) ([]CartItem, bool) {
+	if target.Currency != source.Currency {
+		return nil, false
+	}
+	sourceNewer := source.UpdatedAt.After(target.UpdatedAt)
+
+	items := append([]CartItem(nil), target.Items...)
+	index := make(map[string]int, len(items))
+	for i, item := range items {
+		index[item.SKU] = i
+	}
+	for _, item := range source.Items {
+		i, ok := index[item.SKU]
+		if !ok {
+			index[item.SKU] = len(items)
+			items = append(items, item)
+			continue
+		}
+		quantity := items[i].Quantity
+		if item.Quantity > quantity {
+			quantity = item.Quantity
+		}
+		if sourceNewer {
+			items[i] = item
+		}
+		items[i].Quantity = quantity
+	}
+	if len(items) > maxItems {
+		return nil, false
+	}
+	return items, true
+}
+
+// reassignCart hands the cart to the user as it is.
+func reassignCart(ctx context.Context, cart *Cart, userID string) error {
+	cart.UserID = userID
+	cart.UpdatedAt = clk.Now()
+	return saveMergedCart(ctx, cart)
+}
+
+// replaceItems sets the target's items. The merge counts as cart
+// activity, so an abandoned target becomes active again.
+func replaceItems(ctx context.Context, cart *Cart, items []CartItem) error {
+	cart.Items = items
+	cart.Status = CartStatusActive
+	cart.AbandonedAt = nil
+	touch(cart, clk.Now())
+	return saveMergedCart(ctx, cart)
+}
+
+// markMerged closes a cart folded into targetID; it stays readable, and
+// owned by the user, for history.
+func markMerged(ctx context.Context, cart *Cart, targetID, userID string) error {
+	cart.UserID = userID
+	cart.Status = CartStatusMerged
+	cart.MergedInto = targetID
+	cart.UpdatedAt = clk.Now()
+	return saveMergedCart(ctx, cart)
+}
+
+// saveMergedCart saves a cart changed by a merge against the version it
+// was read at, keeping cart current for the next write.
+func saveMergedCart(ctx context.Context, cart *Cart) error {
+	expected := cart.Version
+	if err := saveCart(ctx, *cart, expected); err != nil {
+		return err
+	}
+	cart.Version = expected + 1
+	return nil
+}
+
+// cartsOwnedBy lists the carts of ownerID, most recently active first.
+func cartsOwnedBy(ctx context.Context, ownerID string) ([]Cart, error) {
+	var carts []Cart
+	var lastKey map[string]types.AttributeValue
+	for {
+		result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(tableName),
+			IndexName:              aws.String(ownerIndex),
+			KeyConditionExpression: aws.String("user_id = :owner"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":owner": &types.AttributeValueMemberS{Value: ownerID},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			ExclusiveStartKey: lastKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query carts: %w", err)
+		}
+		var page []Cart
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal carts: %w", err)
+		}
+		carts = append(carts, page...)
+
+		lastKey = result.LastEvaluatedKey
+		if len(lastKey) == 0 {
+			return carts, nil
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ProductPrice is product-service's effective price of a product: its
+// promotional price while a promotion runs, otherwise its regular price.
+type ProductPrice struct {
+	ProductID string  `json:"product_id"`
+	SKU       string  `json:"sku"`
+	Price     float64 `json:"price"`
+	Currency  string  `json:"currency"`
+}
+
+var (
+	// productServiceURL is where item prices are read from when an item
+	// is added; a price sent by the client is never used.
+	productServiceURL string
+	productClient     = &http.Client{Timeout: 5 * time.Second}
+
+	errProductNotFound = errors.New("product not found")
+)
+
+// currentPrice asks product-service what productID sells for now, as the
+// caller, so product-service applies its own tenant and access rules.
+func currentPrice(r *http.Request, productID string) (ProductPrice, error) {
+	var price ProductPrice
+	if productServiceURL == "" {
+		return price, errors.New("PRODUCT_SERVICE_URL is not configured")
+	}
+	target := productServiceURL + "/products/" + url.PathEscape(productID) + "/price"
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		return price, fmt.Errorf("failed to build price request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for _, header := range []string{"X-Request-Id", "X-User-Id", "X-Tenant-Id"} {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	resp, err := productClient.Do(req)
+	if err != nil {
+		return price, fmt.Errorf("failed to get %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusBadRequest:
+		return price, errProductNotFound
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return price, fmt.Errorf("%s returned %d", target, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&price); err != nil {
+		return price, fmt.Errorf("failed to decode %s: %w", target, err)
+	}
+	return price, nil
+}
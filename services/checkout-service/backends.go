@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"pkg/problem"
+)
+
+// Calls to cart-, inventory-, payment-, order-, product- and
+// attribution-service. Every call of a checkout carries its correlation ID
+// and the user and tenant it is for, read from the checkout rather than
+// the request so the recovery sweep makes the same calls. Calls that change something also carry an
+// Idempotency-Key derived from the checkout and step, so a retried step
+// replays the first response instead of acting twice.
+
+// backend is a JSON HTTP service the checkout calls.
+type backend struct {
+	name    string
+	baseURL string
+	client  *http.Client
+}
+
+func newBackend(name, baseURL string, timeout time.Duration) *backend {
+	return &backend{
+		name:    name,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// backendError is a response of 300 or more. Problem is the body when the
+// backend answered with problem details.
+type backendError struct {
+	Backend string
+	Status  int
+	Problem problem.Problem
+}
+
+func (e *backendError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Backend, e.Status, e.Problem.Error())
+}
+
+// rejected reports whether err is the backend refusing the request itself;
+// asking again would not help. Throttling, server errors and transport
+// failures are not rejections.
+func rejected(err error) bool {
+	var failure *backendError
+	return errors.As(err, &failure) && failure.Status >= 400 && failure.Status < 500 &&
+		failure.Status != http.StatusTooManyRequests && failure.Status != http.StatusRequestTimeout
+}
+
+// hasStatus reports whether err is a backend response with status.
+func hasStatus(err error, status int) bool {
+	var failure *backendError
+	return errors.As(err, &failure) && failure.Status == status
+}
+
+// call sends body, if any, as JSON to path for checkout c and decodes the
+// response into out, if given. An empty idempotencyKey sends none.
+func (b *backend) call(ctx context.Context, c *Checkout, method, path, idempotencyKey string, body, out interface{}) error {
+	if b.baseURL == "" {
+		return fmt.Errorf("%s is not configured", b.name)
+	}
+
+	var payload io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s request: %w", b.name, err)
+		}
+		payload = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, payload)
+	if err != nil {
+		return fmt.Errorf("failed to build %s request: %w", b.name, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Correlation-Id", c.ID)
+	if c.UserID != "" {
+		req.Header.Set("X-User-Id", c.UserID)
+	}
+	if c.TenantID != "" {
+		req.Header.Set("X-Tenant-Id", c.TenantID)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", b.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		failure := &backendError{Backend: b.name, Status: resp.StatusCode}
+		if json.Unmarshal(raw, &failure.Problem) != nil || failure.Problem.Status == 0 {
+			failure.Problem = problem.New(resp.StatusCode, strings.TrimSpace(string(raw)))
+		}
+		return failure
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", b.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,974 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/ids"
+	"pkg/problem"
+	"pkg/tenant"
+	"pkg/validate"
+)
+
+// A checkout turns a cart into an order as a saga: stock is reserved, the
+// coupon, if any, redeemed, the payment captured, then the order created.
+// Creating the order is the pivot. A step failing before it undoes the
+// steps already done, in reverse (the payment refunded, the coupon
+// released, the stock released); once the order exists the checkout only
+// goes forward, committing the reservation and clearing the cart.
+//
+// Each checkout is saved after every step, so one cut short by a crash is
+// finished by the recovery sweep: undone if it had not reached the pivot,
+// otherwise taken forward. The checkout ID is the saga's correlation ID,
+// sent on every call it makes and used as the order ID.
+
+// Checkout statuses. A checkout failing before the pivot is COMPENSATING
+// until every step is undone, then FAILED; one that could not be undone
+// after maxCompensationAttempts is COMPENSATION_FAILED and needs a person.
+const (
+	CheckoutPending            = "PENDING"
+	CheckoutCompleted          = "COMPLETED"
+	CheckoutCompensating       = "COMPENSATING"
+	CheckoutFailed             = "FAILED"
+	CheckoutCompensationFailed = "COMPENSATION_FAILED"
+)
+
+// Saga steps, forward then compensating.
+const (
+	StepReserveStock   = "reserve-stock"
+	StepRedeemCoupon   = "redeem-coupon"
+	StepCapturePayment = "capture-payment"
+	StepCreateOrder    = "create-order"
+	StepCommitStock    = "commit-stock"
+	StepClearCart      = "clear-cart"
+	StepAttributeOrder = "attribute-order"
+	StepReleaseStock   = "release-stock"
+	StepReleaseCoupon  = "release-coupon"
+	StepRefundPayment  = "refund-payment"
+)
+
+// Step outcomes recorded in a checkout's history.
+const (
+	OutcomeStarted = "STARTED"
+	OutcomeDone    = "DONE"
+	OutcomeFailed  = "FAILED"
+)
+
+// Statuses written by cart-, inventory- and payment-service.
+const (
+	cartStatusActive     = "ACTIVE"
+	paymentSucceeded     = "SUCCEEDED"
+	paymentProcessing    = "PROCESSING"
+	reservationCommitted = "COMMITTED"
+)
+
+// maxCompensationAttempts bounds how often the sweep retries undoing a
+// checkout.
+const maxCompensationAttempts = 10
+
+// zeroDecimalCurrencies have no minor unit: amounts are sent to
+// payment-service in whole units.
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true,
+	"KRW": true, "MGA": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+	"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+type Checkout struct {
+	ID            string         `json:"id" dynamodbav:"id"`
+	CartID        string         `json:"cart_id" dynamodbav:"cart_id"`
+	UserID        string         `json:"user_id,omitempty" dynamodbav:"user_id,omitempty"`
+	TenantID      string         `json:"-" dynamodbav:"tenant_id,omitempty"`
+	Items         []CheckoutItem `json:"items" dynamodbav:"items"`
+	Currency      string         `json:"currency" dynamodbav:"currency"`
+	Subtotal      float64        `json:"subtotal" dynamodbav:"subtotal"`
+	CouponCode    string         `json:"coupon_code,omitempty" dynamodbav:"coupon_code,omitempty"`
+	Discount      float64        `json:"discount" dynamodbav:"discount"`
+	Total         float64        `json:"total" dynamodbav:"total"`
+	Status        string         `json:"status" dynamodbav:"status"`
+	Step          string         `json:"step,omitempty" dynamodbav:"step,omitempty"`
+	ReservationID string         `json:"reservation_id,omitempty" dynamodbav:"reservation_id,omitempty"`
+	PaymentID     string         `json:"payment_id,omitempty" dynamodbav:"payment_id,omitempty"`
+	OrderID       string         `json:"order_id,omitempty" dynamodbav:"order_id,omitempty"`
+	FailedStep    string         `json:"failed_step,omitempty" dynamodbav:"failed_step,omitempty"`
+	FailureReason string         `json:"failure_reason,omitempty" dynamodbav:"failure_reason,omitempty"`
+	History       []StepRecord   `json:"history" dynamodbav:"history"`
+	Version       int64          `json:"-" dynamodbav:"version"`
+	CreatedAt     time.Time      `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" dynamodbav:"updated_at"`
+
+	// The payment method and receipt address are only sent on to
+	// payment-service.
+	PaymentMethod string `json:"-" dynamodbav:"payment_method"`
+	ReceiptEmail  string `json:"-" dynamodbav:"receipt_email,omitempty"`
+	// The storefront's Google Analytics client and session, which
+	// ga4-forwarder stitches the order's purchase and refund events to.
+	GAClientID  string `json:"-" dynamodbav:"ga_client_id,omitempty"`
+	GASessionID string `json:"-" dynamodbav:"ga_session_id,omitempty"`
+	// VisitorID is the storefront's anonymous visitor ID, whose ad clicks
+	// the order is attributed to along with the user's.
+	VisitorID string `json:"-" dynamodbav:"visitor_id,omitempty"`
+	// Attempts counts recovery sweeps that tried to undo the checkout.
+	Attempts int `json:"-" dynamodbav:"attempts"`
+	// SavedAt (epoch seconds) is the sort key of the recovery index.
+	SavedAt int64 `json:"-" dynamodbav:"saved_at"`
+}
+
+// CheckoutItem is a cart line as it was when the checkout started.
+// ProductID is empty for lines added to the cart before carts kept it.
+type CheckoutItem struct {
+	ProductID string  `json:"product_id,omitempty" dynamodbav:"product_id,omitempty"`
+	SKU       string  `json:"sku" dynamodbav:"sku"`
+	Name      string  `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	Quantity  int     `json:"quantity" dynamodbav:"quantity"`
+	UnitPrice float64 `json:"unit_price" dynamodbav:"unit_price"`
+}
+
+// StepRecord is one step starting, succeeding or failing.
+type StepRecord struct {
+	Step    string    `json:"step" dynamodbav:"step"`
+	Outcome string    `json:"outcome" dynamodbav:"outcome"`
+	Detail  string    `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
+	At      time.Time `json:"at" dynamodbav:"at"`
+}
+
+// CheckoutRequest checks out a cart, paying with a Stripe PaymentMethod
+// the storefront collected, less the discount of CouponCode if given.
+type CheckoutRequest struct {
+	CartID        string `json:"cart_id" validate:"required,max=64"`
+	PaymentMethod string `json:"payment_method" validate:"required,max=255"`
+	ReceiptEmail  string `json:"receipt_email,omitempty" validate:"email,max=254"`
+	CouponCode    string `json:"coupon_code,omitempty" validate:"coupon_code"`
+	// GAClientID and GASessionID are read from the storefront's gtag:
+	// its client_id and session_id.
+	GAClientID  string `json:"ga_client_id,omitempty" validate:"max=64"`
+	GASessionID string `json:"ga_session_id,omitempty" validate:"max=32"`
+	// VisitorID is the anonymous visitor ID the storefront captured ad
+	// clicks under.
+	VisitorID string `json:"visitor_id,omitempty" validate:"max=128"`
+}
+
+// The parts of other services' resources the checkout reads.
+type cart struct {
+	ID       string         `json:"id"`
+	UserID   string         `json:"user_id"`
+	Currency string         `json:"currency"`
+	Items    []CheckoutItem `json:"items"`
+	Status   string         `json:"status"`
+}
+
+type reservation struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type payment struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type order struct {
+	ID string `json:"id"`
+}
+
+var (
+	errCheckoutNotFound = errors.New("checkout not found")
+	// errCheckoutTaken is another worker saving the checkout first; it
+	// carries the saga on.
+	errCheckoutTaken = errors.New("checkout was taken over concurrently")
+)
+
+// checkoutHandler runs a checkout to the end and answers with its outcome:
+// 201 once the order exists, the failing service's problem (409 for stock
+// that ran out, 402 for a declined payment) once the steps before it are
+// undone, or 202 while the outcome of creating the order is unknown. The
+// X-Correlation-Id header, when it holds an ID, names the checkout; sending
+// the same one again answers with the first checkout instead of starting
+// another.
+func checkoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	id := r.Header.Get("X-Correlation-Id")
+	if !ids.Valid(id) {
+		id = idGen.NewID()
+	}
+	w.Header().Set("X-Correlation-Id", id)
+
+	if existing, err := getCheckout(r.Context(), id); err == nil {
+		if existing.CartID != req.CartID || !tenant.Owns(r.Context(), existing.TenantID) {
+			problem.Write(w, r, problem.New(http.StatusConflict, "X-Correlation-Id names another checkout"))
+			return
+		}
+		writeOutcome(w, r, existing, existing.failure())
+		return
+	} else if !errors.Is(err, errCheckoutNotFound) {
+		writeCheckoutError(w, r, err)
+		return
+	}
+
+	c := &Checkout{
+		ID:            id,
+		CartID:        req.CartID,
+		UserID:        r.Header.Get("X-User-Id"),
+		Status:        CheckoutPending,
+		PaymentMethod: req.PaymentMethod,
+		ReceiptEmail:  req.ReceiptEmail,
+		CouponCode:    strings.ToUpper(req.CouponCode),
+		GAClientID:    req.GAClientID,
+		GASessionID:   req.GASessionID,
+		VisitorID:     req.VisitorID,
+		History:       []StepRecord{},
+	}
+	if t := tenant.FromContext(r.Context()); t != tenant.Default {
+		c.TenantID = t
+	}
+
+	// The saga outlives a caller that hangs up: steps left half done
+	// would otherwise wait for the recovery sweep.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), sagaTimeout)
+	defer cancel()
+
+	var current cart
+	if err := carts.call(ctx, c, http.MethodGet, "/carts/"+c.CartID, "", nil, &current); err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+	switch {
+	case current.UserID != "" && current.UserID != c.UserID:
+		problem.Write(w, r, problem.New(http.StatusForbidden, "Cart belongs to another user"))
+		return
+	case current.Status != cartStatusActive:
+		problem.Write(w, r, problem.New(http.StatusConflict, fmt.Sprintf("Cart is %s", current.Status)))
+		return
+	case len(current.Items) == 0:
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "Cart is empty"))
+		return
+	case len(current.Items) > 49:
+		// Reservations are limited to 49 lines.
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "Cart has more than 49 items"))
+		return
+	}
+	c.Items = current.Items
+	c.Currency = current.Currency
+	if err := checkPrices(ctx, c); err != nil {
+		writePriceError(w, r, err)
+		return
+	}
+	c.Subtotal = cartTotal(current.Items)
+	c.Total = c.Subtotal
+
+	// A coupon that cannot be used fails the checkout before any stock
+	// is held; whether it applies to the items is for the redemption.
+	if c.CouponCode != "" {
+		coupon, err := getCoupon(r.Context(), c.CouponCode)
+		if err == nil {
+			err = coupon.usable(clk.Now().UTC(), c.UserID)
+		}
+		if err != nil {
+			writeCouponError(w, r, err)
+			return
+		}
+	}
+
+	if err := createCheckout(ctx, c); err != nil {
+		if errors.Is(err, dynamo.ErrConditionFailed) {
+			problem.Write(w, r, problem.New(http.StatusConflict, "Checkout "+c.ID+" is already in progress"))
+			return
+		}
+		writeCheckoutError(w, r, err)
+		return
+	}
+
+	err := run(ctx, c)
+	if errors.Is(err, errCheckoutTaken) {
+		latest, getErr := getCheckout(ctx, c.ID)
+		if getErr != nil {
+			writeCheckoutError(w, r, getErr)
+			return
+		}
+		c, err = &latest, latest.failure()
+	}
+	writeOutcome(w, r, *c, err)
+}
+
+func getCheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := getCheckout(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeCheckoutError(w, r, err)
+		return
+	}
+	if !tenant.Owns(r.Context(), c.TenantID) || (c.UserID != "" && c.UserID != r.Header.Get("X-User-Id")) {
+		writeCheckoutError(w, r, errCheckoutNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// run takes c forward from where it stopped. When a step before the pivot
+// fails, the steps before it are undone and the step's error returned. A
+// failed pivot whose outcome is unknown leaves c pending for the sweep to
+// try again.
+func run(ctx context.Context, c *Checkout) error {
+	type step struct {
+		name string
+		do   func(context.Context, *Checkout) error
+	}
+	steps := []step{{StepReserveStock, reserveStock}}
+	if c.CouponCode != "" {
+		steps = append(steps, step{StepRedeemCoupon, redeemCoupon})
+	}
+	steps = append(steps, step{StepCapturePayment, capturePayment}, step{StepCreateOrder, createOrder})
+
+	for _, step := range steps {
+		if c.done(step.name) {
+			continue
+		}
+		c.record(step.name, OutcomeStarted, "")
+		if err := saveCheckout(ctx, c); err != nil {
+			return err
+		}
+
+		err := step.do(ctx, c)
+		if err == nil {
+			c.record(step.name, OutcomeDone, "")
+			if err := saveCheckout(ctx, c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Printf("Checkout %s failed at %s: %v", c.ID, step.name, err)
+		c.record(step.name, OutcomeFailed, err.Error())
+		if step.name == StepCreateOrder && !rejected(err) {
+			// The order may exist; only trying again with the same key
+			// tells.
+			if saveErr := saveCheckout(ctx, c); saveErr != nil {
+				return saveErr
+			}
+			return err
+		}
+		c.Status = CheckoutCompensating
+		c.FailedStep = step.name
+		c.FailureReason = failureReason(err)
+		if saveErr := saveCheckout(ctx, c); saveErr != nil {
+			return saveErr
+		}
+		if compErr := compensate(ctx, c); compErr != nil {
+			log.Printf("Checkout %s is not fully undone, leaving it to the recovery sweep: %v", c.ID, compErr)
+		}
+		return err
+	}
+	return finish(ctx, c)
+}
+
+// finish completes a checkout whose order exists. Committing the stock,
+// clearing the cart and attributing the order are best effort: the order
+// stands either way.
+func finish(ctx context.Context, c *Checkout) error {
+	for _, step := range []struct {
+		name string
+		do   func(context.Context, *Checkout) error
+	}{
+		{StepCommitStock, commitStock},
+		{StepClearCart, clearCart},
+		{StepAttributeOrder, attributeOrder},
+	} {
+		if err := step.do(ctx, c); err != nil {
+			log.Printf("Checkout %s could not %s: %v", c.ID, step.name, err)
+			c.record(step.name, OutcomeFailed, err.Error())
+			continue
+		}
+		c.record(step.name, OutcomeDone, "")
+	}
+	c.Status = CheckoutCompleted
+	c.Step = ""
+	if err := saveCheckout(ctx, c); err != nil {
+		return err
+	}
+	log.Printf("Checkout %s completed: order %s, %.2f %s", c.ID, c.OrderID, c.Total, c.Currency)
+	return nil
+}
+
+// compensate undoes the steps of c that were started, newest first, and
+// marks it FAILED once all are undone. A step started without its result
+// recorded is never sent again: what it may have created is looked up by
+// the checkout ID and undone if it exists.
+func compensate(ctx context.Context, c *Checkout) error {
+	if c.started(StepCapturePayment) && !c.done(StepRefundPayment) {
+		if err := refundPayment(ctx, c); err != nil {
+			c.record(StepRefundPayment, OutcomeFailed, err.Error())
+			if saveErr := saveCheckout(ctx, c); saveErr != nil {
+				return saveErr
+			}
+			return err
+		}
+		c.record(StepRefundPayment, OutcomeDone, "")
+	}
+	if c.started(StepRedeemCoupon) && !c.done(StepReleaseCoupon) {
+		if err := releaseCoupon(ctx, c); err != nil {
+			c.record(StepReleaseCoupon, OutcomeFailed, err.Error())
+			if saveErr := saveCheckout(ctx, c); saveErr != nil {
+				return saveErr
+			}
+			return err
+		}
+		c.record(StepReleaseCoupon, OutcomeDone, "")
+	}
+	if c.started(StepReserveStock) && !c.done(StepReleaseStock) {
+		if err := releaseStock(ctx, c); err != nil {
+			c.record(StepReleaseStock, OutcomeFailed, err.Error())
+			if saveErr := saveCheckout(ctx, c); saveErr != nil {
+				return saveErr
+			}
+			return err
+		}
+		c.record(StepReleaseStock, OutcomeDone, "")
+	}
+	c.Status = CheckoutFailed
+	c.Step = ""
+	if err := saveCheckout(ctx, c); err != nil {
+		return err
+	}
+	log.Printf("Checkout %s failed at %s and was undone", c.ID, c.FailedStep)
+	return nil
+}
+
+// Forward steps
+
+func reserveStock(ctx context.Context, c *Checkout) error {
+	type line struct {
+		SKU      string `json:"sku"`
+		Quantity int    `json:"quantity"`
+	}
+	body := struct {
+		OrderID string `json:"order_id"`
+		Items   []line `json:"items"`
+	}{OrderID: c.ID}
+	for _, item := range c.Items {
+		body.Items = append(body.Items, line{SKU: item.SKU, Quantity: item.Quantity})
+	}
+
+	var held reservation
+	if err := inventory.call(ctx, c, http.MethodPost, "/reservations", stepKey(c, StepReserveStock), body, &held); err != nil {
+		return err
+	}
+	c.ReservationID = held.ID
+	return nil
+}
+
+// redeemCoupon redeems the checkout's coupon for the order and takes the
+// discount off the total. A coupon limited to categories needs the lines'
+// categories, which cart lines lack, so they are looked up by SKU in
+// product-service.
+func redeemCoupon(ctx context.Context, c *Checkout) error {
+	ctx = tenant.WithID(ctx, c.TenantID)
+	coupon, err := getCoupon(ctx, c.CouponCode)
+	if err != nil {
+		return couponRefusal(err)
+	}
+
+	lines := make([]CouponLine, len(c.Items))
+	for i, item := range c.Items {
+		lines[i] = CouponLine{SKU: item.SKU, Quantity: item.Quantity, UnitPrice: item.UnitPrice}
+	}
+	if len(coupon.Categories) > 0 {
+		if err := categorize(ctx, c, lines); err != nil {
+			return err
+		}
+	}
+
+	redemption, _, err := redeem(ctx, c.CouponCode, RedeemRequest{
+		OrderID:  c.ID,
+		UserID:   c.UserID,
+		Currency: c.Currency,
+		Items:    lines,
+	})
+	if err != nil {
+		return couponRefusal(err)
+	}
+	c.Discount = redemption.Discount
+	c.Total = math.Round((c.Subtotal-c.Discount)*100) / 100
+	return nil
+}
+
+// categorize fills in the category of each line from product search.
+func categorize(ctx context.Context, c *Checkout, lines []CouponLine) error {
+	query := url.Values{"page_size": {"100"}}
+	for _, line := range lines {
+		query.Add("sku", line.SKU)
+	}
+	var found struct {
+		Products []struct {
+			SKU      string `json:"sku"`
+			Category string `json:"category"`
+		} `json:"products"`
+	}
+	if err := products.call(ctx, c, http.MethodGet, "/products/search?"+query.Encode(), "", nil, &found); err != nil {
+		return err
+	}
+	categories := make(map[string]string, len(found.Products))
+	for _, product := range found.Products {
+		categories[product.SKU] = product.Category
+	}
+	for i := range lines {
+		lines[i].Category = categories[lines[i].SKU]
+	}
+	return nil
+}
+
+// checkPrices compares each line's price with what product-service sells
+// the product for now. The cart keeps the price a line was added at, so a
+// line repriced since, or no longer sold, is refused with 409 for the
+// shopper to review the cart. Lines without a product ID are resolved by
+// SKU through product search.
+func checkPrices(ctx context.Context, c *Checkout) error {
+	query := url.Values{"page_size": {"100"}}
+	for _, item := range c.Items {
+		if item.ProductID == "" {
+			query.Add("sku", item.SKU)
+		}
+	}
+	if len(query["sku"]) > 0 {
+		var found struct {
+			Products []struct {
+				ID  string `json:"id"`
+				SKU string `json:"sku"`
+			} `json:"products"`
+		}
+		if err := products.call(ctx, c, http.MethodGet, "/products/search?"+query.Encode(), "", nil, &found); err != nil {
+			return err
+		}
+		productIDs := make(map[string]string, len(found.Products))
+		for _, product := range found.Products {
+			productIDs[product.SKU] = product.ID
+		}
+		for i := range c.Items {
+			if c.Items[i].ProductID == "" {
+				c.Items[i].ProductID = productIDs[c.Items[i].SKU]
+			}
+		}
+	}
+
+	for _, item := range c.Items {
+		if item.ProductID == "" {
+			return problem.New(http.StatusConflict, fmt.Sprintf("%s is no longer sold", item.SKU))
+		}
+		var price struct {
+			Price    float64 `json:"price"`
+			Currency string  `json:"currency"`
+		}
+		err := products.call(ctx, c, http.MethodGet, "/products/"+url.PathEscape(item.ProductID)+"/price", "", nil, &price)
+		if hasStatus(err, http.StatusNotFound) {
+			return problem.New(http.StatusConflict, fmt.Sprintf("%s is no longer sold", item.SKU))
+		}
+		if err != nil {
+			return err
+		}
+		if price.Currency != c.Currency || minorUnits(price.Price, c.Currency) != minorUnits(item.UnitPrice, c.Currency) {
+			return problem.New(http.StatusConflict, fmt.Sprintf("The price of %s changed from %.2f %s to %.2f %s",
+				item.SKU, item.UnitPrice, c.Currency, price.Price, price.Currency))
+		}
+	}
+	return nil
+}
+
+// capturePayment charges the total. A payment left anything but succeeded
+// or processing fails the step; it is recorded so compensation cancels it.
+// An order the coupon paid for in full is not charged.
+func capturePayment(ctx context.Context, c *Checkout) error {
+	if minorUnits(c.Total, c.Currency) == 0 {
+		return nil
+	}
+	charged, err := paymentFor(ctx, c)
+	if err != nil {
+		return err
+	}
+	c.PaymentID = charged.ID
+	if charged.Status != paymentSucceeded && charged.Status != paymentProcessing {
+		return fmt.Errorf("payment %s is %s", charged.ID, charged.Status)
+	}
+	return nil
+}
+
+func paymentFor(ctx context.Context, c *Checkout) (payment, error) {
+	body := struct {
+		OrderID       string `json:"order_id"`
+		Amount        int64  `json:"amount"`
+		Currency      string `json:"currency"`
+		ReceiptEmail  string `json:"receipt_email,omitempty"`
+		PaymentMethod string `json:"payment_method"`
+	}{
+		OrderID:       c.ID,
+		Amount:        minorUnits(c.Total, c.Currency),
+		Currency:      c.Currency,
+		ReceiptEmail:  c.ReceiptEmail,
+		PaymentMethod: c.PaymentMethod,
+	}
+	var charged payment
+	err := payments.call(ctx, c, http.MethodPost, "/payments", stepKey(c, StepCapturePayment), body, &charged)
+	return charged, err
+}
+
+// createOrder is the pivot. order-service creates the order under the
+// checkout ID, paid and with its stock held.
+func createOrder(ctx context.Context, c *Checkout) error {
+	body := struct {
+		ID            string         `json:"id"`
+		UserID        string         `json:"user_id,omitempty"`
+		CartID        string         `json:"cart_id"`
+		Items         []CheckoutItem `json:"items"`
+		Currency      string         `json:"currency"`
+		Subtotal      float64        `json:"subtotal"`
+		CouponCode    string         `json:"coupon_code,omitempty"`
+		Discount      float64        `json:"discount"`
+		Total         float64        `json:"total"`
+		ReservationID string         `json:"reservation_id"`
+		PaymentID     string         `json:"payment_id,omitempty"`
+	}{
+		ID:            c.ID,
+		UserID:        c.UserID,
+		CartID:        c.CartID,
+		Items:         c.Items,
+		Currency:      c.Currency,
+		Subtotal:      c.Subtotal,
+		CouponCode:    c.CouponCode,
+		Discount:      c.Discount,
+		Total:         c.Total,
+		ReservationID: c.ReservationID,
+		PaymentID:     c.PaymentID,
+	}
+	var created order
+	err := orders.call(ctx, c, http.MethodPost, "/orders", stepKey(c, StepCreateOrder), body, &created)
+	if hasStatus(err, http.StatusConflict) {
+		// Created by an earlier attempt whose answer was lost.
+		created.ID, err = c.ID, nil
+	}
+	if err != nil {
+		return err
+	}
+	c.OrderID = created.ID
+	if c.OrderID == "" {
+		c.OrderID = c.ID
+	}
+	return nil
+}
+
+func commitStock(ctx context.Context, c *Checkout) error {
+	err := inventory.call(ctx, c, http.MethodPost, "/reservations/"+c.ReservationID+"/commit", stepKey(c, StepCommitStock), nil, nil)
+	if hasStatus(err, http.StatusConflict) {
+		var held reservation
+		if getErr := inventory.call(ctx, c, http.MethodGet, "/reservations/"+c.ReservationID, "", nil, &held); getErr == nil && held.Status == reservationCommitted {
+			return nil
+		}
+	}
+	return err
+}
+
+func clearCart(ctx context.Context, c *Checkout) error {
+	err := carts.call(ctx, c, http.MethodDelete, "/carts/"+c.CartID, "", nil, nil)
+	if hasStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// attributeOrder has attribution-service credit the order to the last ad
+// click of its user or visitor. Resolving an order again answers with its
+// first attribution. Skipped when ATTRIBUTION_SERVICE_URL is unset.
+func attributeOrder(ctx context.Context, c *Checkout) error {
+	if attributions.baseURL == "" {
+		return nil
+	}
+	body := struct {
+		OrderID   string    `json:"order_id"`
+		UserID    string    `json:"user_id,omitempty"`
+		VisitorID string    `json:"visitor_id,omitempty"`
+		Value     float64   `json:"value"`
+		Currency  string    `json:"currency"`
+		OrderedAt time.Time `json:"ordered_at"`
+	}{
+		OrderID:   c.OrderID,
+		UserID:    c.UserID,
+		VisitorID: c.VisitorID,
+		Value:     c.Total,
+		Currency:  c.Currency,
+		OrderedAt: c.orderedAt(),
+	}
+	return attributions.call(ctx, c, http.MethodPost, "/attributions", "", body, nil)
+}
+
+// Compensating steps
+
+// refundPayment refunds or cancels the payment. A charge whose response
+// was lost is found by the checkout ID, the order ID payment-service keeps;
+// the step's key lets it create one payment at most. When there is none,
+// nothing was charged and nothing needs undoing.
+func refundPayment(ctx context.Context, c *Checkout) error {
+	if c.PaymentID == "" {
+		if minorUnits(c.Total, c.Currency) == 0 {
+			return nil
+		}
+		var found struct {
+			Payments []payment `json:"payments"`
+		}
+		if err := payments.call(ctx, c, http.MethodGet, "/payments?order_id="+url.QueryEscape(c.ID), "", nil, &found); err != nil {
+			return err
+		}
+		if len(found.Payments) == 0 {
+			return nil
+		}
+		c.PaymentID = found.Payments[0].ID
+	}
+	body := map[string]string{"reason": "checkout " + c.ID + " failed at " + c.FailedStep}
+	return payments.call(ctx, c, http.MethodPost, "/payments/"+c.PaymentID+"/refund", stepKey(c, StepRefundPayment), body, nil)
+}
+
+// releaseCoupon gives back the use the checkout's redemption took.
+// Releasing a redemption never made succeeds.
+func releaseCoupon(ctx context.Context, c *Checkout) error {
+	return release(tenant.WithID(ctx, c.TenantID), c.CouponCode, c.ID)
+}
+
+// releaseStock releases the reservation. A reservation whose response was
+// lost is found by the checkout ID, its order ID; when there is none, no
+// stock is held. Releasing is idempotent in inventory-service.
+func releaseStock(ctx context.Context, c *Checkout) error {
+	if c.ReservationID == "" {
+		var found struct {
+			Reservations []reservation `json:"reservations"`
+		}
+		if err := inventory.call(ctx, c, http.MethodGet, "/reservations?order_id="+url.QueryEscape(c.ID), "", nil, &found); err != nil {
+			return err
+		}
+		if len(found.Reservations) == 0 {
+			return nil
+		}
+		c.ReservationID = found.Reservations[0].ID
+	}
+	body := map[string]string{"reason": "checkout " + c.ID + " failed at " + c.FailedStep}
+	return inventory.call(ctx, c, http.MethodPost, "/reservations/"+c.ReservationID+"/release", stepKey(c, StepReleaseStock), body, nil)
+}
+
+// Saga state
+
+// record appends a step outcome to the history; a started step becomes
+// the current one.
+func (c *Checkout) record(step, outcome, detail string) {
+	if outcome == OutcomeStarted {
+		c.Step = step
+	}
+	c.History = append(c.History, StepRecord{Step: step, Outcome: outcome, Detail: detail, At: clk.Now().UTC()})
+}
+
+// orderedAt is when the order was created, the time its create-order
+// step was recorded done.
+func (c *Checkout) orderedAt() time.Time {
+	for _, r := range c.History {
+		if r.Step == StepCreateOrder && r.Outcome == OutcomeDone {
+			return r.At
+		}
+	}
+	return clk.Now().UTC()
+}
+
+func (c *Checkout) done(step string) bool {
+	return c.reached(step, OutcomeDone)
+}
+
+func (c *Checkout) started(step string) bool {
+	return c.reached(step, OutcomeStarted)
+}
+
+func (c *Checkout) reached(step, outcome string) bool {
+	for _, r := range c.History {
+		if r.Step == step && r.Outcome == outcome {
+			return true
+		}
+	}
+	return false
+}
+
+// failure is the error a finished checkout failed with, as a problem, for
+// answering a checkout sent again; nil for one that did not fail.
+func (c Checkout) failure() error {
+	if c.Status == CheckoutCompleted || c.FailedStep == "" {
+		return nil
+	}
+	status := http.StatusUnprocessableEntity
+	switch c.FailedStep {
+	case StepReserveStock:
+		status = http.StatusConflict
+	case StepCapturePayment:
+		status = http.StatusPaymentRequired
+	}
+	return &backendError{Backend: c.FailedStep, Status: status, Problem: problem.New(status, c.FailureReason)}
+}
+
+// stepKey is the Idempotency-Key of a checkout step.
+func stepKey(c *Checkout, step string) string {
+	return c.ID + "-" + step
+}
+
+// couponRefusal is a coupon that cannot be redeemed as a rejection, so
+// the checkout is undone and answered like a backend refusing it.
+func couponRefusal(err error) error {
+	status := couponStatus(err)
+	if status == 0 {
+		return err
+	}
+	return &backendError{Backend: "coupons", Status: status, Problem: problem.New(status, capitalize(err.Error()))}
+}
+
+func failureReason(err error) string {
+	var failure *backendError
+	if errors.As(err, &failure) {
+		return failure.Problem.Error()
+	}
+	return err.Error()
+}
+
+// cartTotal sums the lines, rounded to the cent as cart-service does.
+func cartTotal(items []CheckoutItem) float64 {
+	var total float64
+	for _, item := range items {
+		total += float64(item.Quantity) * item.UnitPrice
+	}
+	return math.Round(total*100) / 100
+}
+
+// minorUnits is amount in the currency's smallest unit, as payment-service
+// takes it.
+func minorUnits(amount float64, currency string) int64 {
+	if zeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return int64(math.Round(amount))
+	}
+	return int64(math.Round(amount * 100))
+}
+
+// Responses
+
+// writeOutcome answers with c, or with the problem err describes.
+func writeOutcome(w http.ResponseWriter, r *http.Request, c Checkout, err error) {
+	w.Header().Set("Location", "/checkout/"+c.ID)
+	if err == nil {
+		status := http.StatusCreated
+		if c.Status != CheckoutCompleted {
+			status = http.StatusAccepted
+		}
+		writeJSON(w, status, c)
+		return
+	}
+
+	var failure *backendError
+	switch {
+	case c.Status == CheckoutPending:
+		// The order may or may not exist yet; the sweep settles it.
+		writeJSON(w, http.StatusAccepted, c)
+	case errors.As(err, &failure) && rejected(err):
+		status := failure.Status
+		if status != http.StatusConflict && status != http.StatusPaymentRequired {
+			status = http.StatusUnprocessableEntity
+		}
+		p := problem.New(status, fmt.Sprintf("Checkout failed at %s: %s", c.FailedStep, failure.Problem.Error()))
+		p.Errors = failure.Problem.Errors
+		p.Instance = "/checkout/" + c.ID
+		problem.Write(w, r, p)
+	default:
+		p := problem.New(http.StatusBadGateway, fmt.Sprintf("Checkout failed at %s: a service it needs is unavailable", c.FailedStep))
+		p.Instance = "/checkout/" + c.ID
+		problem.Write(w, r, p)
+	}
+}
+
+func writeCartError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case hasStatus(err, http.StatusNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Cart not found"))
+	case rejected(err):
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, failureReason(err)))
+	default:
+		log.Printf("Failed to read cart: %v", err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, "cart-service is unavailable"))
+	}
+}
+
+func writePriceError(w http.ResponseWriter, r *http.Request, err error) {
+	var p problem.Problem
+	if errors.As(err, &p) {
+		problem.Write(w, r, p)
+		return
+	}
+	log.Printf("Failed to check prices: %v", err)
+	problem.Write(w, r, problem.New(http.StatusBadGateway, "product-service is unavailable"))
+}
+
+func writeCheckoutError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errCheckoutNotFound) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Checkout not found"))
+		return
+	}
+	log.Printf("Checkout error: %v", err)
+	problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+}
+
+// DynamoDB operations
+
+func checkoutKey(id string) dynamo.Key {
+	return dynamo.StringKey("id", id)
+}
+
+func getCheckout(ctx context.Context, id string) (Checkout, error) {
+	c, err := dynamo.Get[Checkout](ctx, checkouts, checkoutKey(id))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return Checkout{}, errCheckoutNotFound
+	}
+	if err != nil {
+		return Checkout{}, fmt.Errorf("failed to get checkout %s: %w", id, err)
+	}
+	return c, nil
+}
+
+// createCheckout saves a new checkout, failing with
+// dynamo.ErrConditionFailed if its ID is taken.
+func createCheckout(ctx context.Context, c *Checkout) error {
+	now := clk.Now().UTC()
+	c.CreatedAt, c.UpdatedAt, c.SavedAt = now, now, now.Unix()
+	c.Version = 1
+	return checkouts.Put(ctx, c, dynamo.IfNotExists("id"))
+}
+
+// saveCheckout writes c if no one else has since it was read, so the
+// handler and the sweep never both carry a checkout on; errCheckoutTaken
+// otherwise.
+func saveCheckout(ctx context.Context, c *Checkout) error {
+	now := clk.Now().UTC()
+	c.UpdatedAt, c.SavedAt = now, now.Unix()
+	c.Version++
+	err := checkouts.Put(ctx, c, dynamo.IfVersion("version", c.Version-1))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return errCheckoutTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save checkout %s: %w", c.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cartRead are the calls reading the fake cart and checking its prices.
+func cartRead() []string {
+	return []string{"GET /carts/cart-1", "GET /products/prod-1/price", "GET /products/prod-2/price"}
+}
+
+func TestCheckoutSaga(t *testing.T) {
+	reserve, pay, order := "POST /reservations", "POST /payments", "POST /orders"
+	clear := "DELETE /carts/cart-1"
+	commit, release, refund := "POST /reservations/res-1/commit", "POST /reservations/res-1/release", "POST /payments/pay-1/refund"
+
+	tests := []struct {
+		name string
+		fail map[string]int
+		// coupon checks out with SAVE10, taking 10% off.
+		coupon bool
+		// want is the response status, the checkout's status after it and
+		// the backend calls made, in order, once the cart and its prices
+		// are read.
+		want       int
+		wantStatus string
+		wantCalls  []string
+		wantSteps  []string
+		// redemptions is SAVE10's count after the checkout.
+		redemptions int
+	}{
+		{
+			name:       "completes and clears the cart",
+			want:       http.StatusCreated,
+			wantStatus: CheckoutCompleted,
+			wantCalls:  []string{reserve, pay, order, commit, clear},
+		},
+		{
+			name:       "fails on stock that ran out",
+			fail:       map[string]int{reserve: http.StatusConflict},
+			want:       http.StatusConflict,
+			wantStatus: CheckoutFailed,
+			// Releasing looks the reservation up by order and finds
+			// none: nothing was held.
+			wantCalls: []string{reserve, "GET /reservations"},
+		},
+		{
+			name:       "releases the stock of a declined payment",
+			fail:       map[string]int{pay: http.StatusPaymentRequired},
+			want:       http.StatusPaymentRequired,
+			wantStatus: CheckoutFailed,
+			wantCalls:  []string{reserve, pay, "GET /payments", release},
+			wantSteps:  []string{StepReleaseStock},
+		},
+		{
+			name:       "refunds and releases when the order is refused",
+			fail:       map[string]int{order: http.StatusUnprocessableEntity},
+			want:       http.StatusUnprocessableEntity,
+			wantStatus: CheckoutFailed,
+			wantCalls:  []string{reserve, pay, order, refund, release},
+			wantSteps:  []string{StepRefundPayment, StepReleaseStock},
+		},
+		{
+			name:       "leaves an order of unknown outcome pending",
+			fail:       map[string]int{order: http.StatusInternalServerError},
+			want:       http.StatusAccepted,
+			wantStatus: CheckoutPending,
+			wantCalls:  []string{reserve, pay, order},
+		},
+		{
+			name:        "takes a coupon's discount off the payment",
+			coupon:      true,
+			want:        http.StatusCreated,
+			wantStatus:  CheckoutCompleted,
+			wantCalls:   []string{reserve, pay, order, commit, clear},
+			redemptions: 1,
+		},
+		{
+			name:       "gives the coupon back when the payment is declined",
+			coupon:     true,
+			fail:       map[string]int{pay: http.StatusPaymentRequired},
+			want:       http.StatusPaymentRequired,
+			wantStatus: CheckoutFailed,
+			wantCalls:  []string{reserve, pay, "GET /payments", release},
+			wantSteps:  []string{StepReleaseCoupon, StepReleaseStock},
+		},
+		{
+			name:       "completes though the cart cannot be cleared",
+			fail:       map[string]int{clear: http.StatusServiceUnavailable},
+			want:       http.StatusCreated,
+			wantStatus: CheckoutCompleted,
+			wantCalls:  []string{reserve, pay, order, commit, clear},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTables(t)
+			backends := useBackends(t, tt.fail)
+			body := `{"cart_id": "cart-1", "payment_method": "pm_card_visa"}`
+			total := 30.0
+			if tt.coupon {
+				seedCoupon(t, Coupon{Code: "SAVE10"})
+				body = `{"cart_id": "cart-1", "payment_method": "pm_card_visa", "coupon_code": "save10"}`
+				total = 27
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/checkout", strings.NewReader(body))
+			r.Header.Set("X-User-Id", "user-1")
+			w := httptest.NewRecorder()
+			checkoutHandler(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			wantCalls := append(cartRead(), tt.wantCalls...)
+			if !reflect.DeepEqual(backends.calls, wantCalls) {
+				t.Errorf("calls = %q, want %q", backends.calls, wantCalls)
+			}
+
+			id := w.Header().Get("X-Correlation-Id")
+			c, err := getCheckout(context.Background(), id)
+			if err != nil {
+				t.Fatalf("get checkout %s: %v", id, err)
+			}
+			if c.Status != tt.wantStatus {
+				t.Errorf("checkout status = %s, want %s", c.Status, tt.wantStatus)
+			}
+			for _, step := range tt.wantSteps {
+				if !c.done(step) {
+					t.Errorf("compensating step %s not recorded done in %+v", step, c.History)
+				}
+			}
+			if c.Total != total {
+				t.Errorf("total = %v, want %v", c.Total, total)
+			}
+			if tt.coupon {
+				coupon, err := getCoupon(context.Background(), "SAVE10")
+				if err != nil {
+					t.Fatalf("get coupon: %v", err)
+				}
+				if coupon.Redemptions != tt.redemptions {
+					t.Errorf("coupon redemptions = %d, want %d", coupon.Redemptions, tt.redemptions)
+				}
+			}
+		})
+	}
+}
+
+// A checkout sent again with its correlation ID answers with the first
+// outcome and makes no further calls.
+func TestCheckoutReplaysOutcome(t *testing.T) {
+	useTables(t)
+	backends := useBackends(t, map[string]int{"POST /payments": http.StatusPaymentRequired})
+
+	send := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/checkout",
+			strings.NewReader(`{"cart_id": "cart-1", "payment_method": "pm_card_visa"}`))
+		r.Header.Set("X-User-Id", "user-1")
+		r.Header.Set("X-Correlation-Id", id)
+		w := httptest.NewRecorder()
+		checkoutHandler(w, r)
+		return w
+	}
+
+	first := send("")
+	id := first.Header().Get("X-Correlation-Id")
+	calls := len(backends.calls)
+	second := send(id)
+
+	if first.Code != http.StatusPaymentRequired || second.Code != first.Code {
+		t.Errorf("statuses = %d, %d, want 402 twice", first.Code, second.Code)
+	}
+	if len(backends.calls) != calls {
+		t.Errorf("replay made calls %q", backends.calls[calls:])
+	}
+	var p struct {
+		Instance string `json:"instance"`
+	}
+	json.NewDecoder(second.Body).Decode(&p)
+	if p.Instance != "/checkout/"+id {
+		t.Errorf("replayed instance = %q, want /checkout/%s", p.Instance, id)
+	}
+}
+
+func TestCheckoutRefusesRepricedCart(t *testing.T) {
+	tests := []struct {
+		name string
+		// price is what product-service sells prod-1 for, 0 for not at all.
+		price float64
+	}{
+		{"refuses a line whose price changed", 13},
+		{"refuses a line no longer sold", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTables(t)
+			backends := useBackends(t, nil)
+			backends.prices["prod-1"] = tt.price
+			if tt.price == 0 {
+				delete(backends.prices, "prod-1")
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/checkout",
+				strings.NewReader(`{"cart_id": "cart-1", "payment_method": "pm_card_visa"}`))
+			r.Header.Set("X-User-Id", "user-1")
+			w := httptest.NewRecorder()
+			checkoutHandler(w, r)
+
+			if w.Code != http.StatusConflict {
+				t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+			}
+			if want := cartRead()[:2]; !reflect.DeepEqual(backends.calls, want) {
+				t.Errorf("calls = %q, want only %q", backends.calls, want)
+			}
+			if _, err := getCheckout(context.Background(), w.Header().Get("X-Correlation-Id")); !errors.Is(err, errCheckoutNotFound) {
+				t.Errorf("checkout saved for a refused cart: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/problem"
+	"pkg/tenant"
+	"pkg/validate"
+)
+
+// Coupons take a percentage or a fixed amount off an order, optionally
+// only off the lines of some SKUs or categories, until they expire or
+// have been redeemed as often as allowed, overall and per user.
+//
+// A redemption is one transaction: the coupon's counter goes up only while
+// it is below the limit, the user's counter likewise, and the redemption
+// is recorded under the order, so two orders racing for the last use
+// cannot both have it and redeeming for the same order twice is a replay.
+// Releasing a redemption, when the order's checkout is undone, gives the
+// uses back.
+//
+// The coupons table is single-table and scoped to the tenant:
+//
+//	pk = COUPON#<code>   sk = COUPON
+//	pk = COUPON#<code>   sk = REDEMPTION#<order id>
+//	pk = COUPON#<code>   sk = USER#<user id>
+
+const couponsScope = "coupons"
+
+// Discount types.
+const (
+	DiscountPercentage = "PERCENTAGE"
+	DiscountFixed      = "FIXED"
+)
+
+// Sort keys of the coupons table.
+const (
+	couponEntity     = "COUPON"
+	redemptionEntity = "REDEMPTION"
+	userEntity       = "USER"
+)
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9-]{2,31}$`)
+
+func init() {
+	validate.Register("coupon_code", func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && couponCodePattern.MatchString(strings.ToUpper(v.String()))
+	}, func(string) string { return "must be 3-32 letters, digits or dashes" })
+}
+
+type Coupon struct {
+	PK          string     `json:"-" dynamodbav:"pk"`
+	SK          string     `json:"-" dynamodbav:"sk"`
+	Code        string     `json:"code" dynamodbav:"code"`
+	Description string     `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Type        string     `json:"type" dynamodbav:"type"`
+	Value       float64    `json:"value" dynamodbav:"value"`
+	Currency    string     `json:"currency,omitempty" dynamodbav:"currency,omitempty"`
+	SKUs        []string   `json:"skus,omitempty" dynamodbav:"skus,omitempty"`
+	Categories  []string   `json:"categories,omitempty" dynamodbav:"categories,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" dynamodbav:"expires_at,omitempty"`
+	// MaxRedemptions and MaxPerUser of 0 are unlimited.
+	MaxRedemptions int       `json:"max_redemptions,omitempty" dynamodbav:"max_redemptions"`
+	MaxPerUser     int       `json:"max_per_user,omitempty" dynamodbav:"max_per_user"`
+	Redemptions    int       `json:"redemptions" dynamodbav:"redemptions"`
+	Active         bool      `json:"active" dynamodbav:"active"`
+	CreatedAt      time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" dynamodbav:"updated_at"`
+
+	// ExpiresEpoch (epoch seconds) is ExpiresAt as the redemption
+	// condition compares it.
+	ExpiresEpoch int64 `json:"-" dynamodbav:"expires_epoch,omitempty"`
+}
+
+// CreateCouponRequest creates a coupon. Value is a percentage for
+// PERCENTAGE coupons and an amount in Currency for FIXED ones.
+type CreateCouponRequest struct {
+	Code           string     `json:"code" validate:"required,coupon_code"`
+	Description    string     `json:"description" validate:"max=500"`
+	Type           string     `json:"type" validate:"required,oneof=PERCENTAGE FIXED"`
+	Value          float64    `json:"value" validate:"required,min=0.01,max=1000000"`
+	Currency       string     `json:"currency" validate:"currency"`
+	SKUs           []string   `json:"skus" validate:"max=100"`
+	Categories     []string   `json:"categories" validate:"max=50"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	MaxRedemptions int        `json:"max_redemptions" validate:"min=0,max=10000000"`
+	MaxPerUser     int        `json:"max_per_user" validate:"min=0,max=1000"`
+}
+
+// Redemption is a coupon used on an order.
+type Redemption struct {
+	PK         string    `json:"-" dynamodbav:"pk"`
+	SK         string    `json:"-" dynamodbav:"sk"`
+	Code       string    `json:"code" dynamodbav:"code"`
+	OrderID    string    `json:"order_id" dynamodbav:"order_id"`
+	UserID     string    `json:"user_id,omitempty" dynamodbav:"user_id,omitempty"`
+	Discount   float64   `json:"discount" dynamodbav:"discount"`
+	Currency   string    `json:"currency" dynamodbav:"currency"`
+	RedeemedAt time.Time `json:"redeemed_at" dynamodbav:"redeemed_at"`
+
+	// PerUser records that the user's counter was taken, to give back.
+	PerUser bool `json:"-" dynamodbav:"per_user,omitempty"`
+}
+
+// RedeemRequest redeems a coupon for an order of Items. Category is only
+// needed on the lines of a coupon restricted to categories.
+type RedeemRequest struct {
+	OrderID  string       `json:"order_id" validate:"required,max=64"`
+	UserID   string       `json:"user_id" validate:"max=128"`
+	Currency string       `json:"currency" validate:"required,currency"`
+	Items    []CouponLine `json:"items" validate:"required,max=100"`
+}
+
+type CouponLine struct {
+	SKU       string  `json:"sku" validate:"required,max=64"`
+	Category  string  `json:"category" validate:"max=100"`
+	Quantity  int     `json:"quantity" validate:"required,min=1"`
+	UnitPrice float64 `json:"unit_price" validate:"min=0"`
+}
+
+// Reasons a coupon cannot be redeemed.
+var (
+	errCouponNotFound      = errors.New("coupon not found")
+	errCouponInactive      = errors.New("coupon is no longer active")
+	errCouponExpired       = errors.New("coupon has expired")
+	errCouponExhausted     = errors.New("coupon has been fully redeemed")
+	errCouponUserLimit     = errors.New("coupon has been used as often as allowed by this user")
+	errCouponNeedsUser     = errors.New("coupon can only be used by a signed-in user")
+	errCouponNotApplicable = errors.New("coupon does not apply to any item in the order")
+)
+
+func createCouponHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r) {
+		return
+	}
+	var req CreateCouponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	err := validate.Struct(req)
+	var fieldErrs validate.Errors
+	errors.As(err, &fieldErrs)
+	switch {
+	case req.Type == DiscountPercentage && req.Value > 100:
+		fieldErrs = append(fieldErrs, validate.FieldError{Field: "value", Rule: "max", Message: "must be at most 100 for a percentage"})
+	case req.Type == DiscountFixed && req.Currency == "":
+		fieldErrs = append(fieldErrs, validate.FieldError{Field: "currency", Rule: "required", Message: "is required for a fixed discount"})
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(clk.Now()) {
+		fieldErrs = append(fieldErrs, validate.FieldError{Field: "expires_at", Rule: "future", Message: "must be in the future"})
+	}
+	if len(fieldErrs) > 0 {
+		problem.Write(w, r, problem.Validation(fieldErrs))
+		return
+	}
+
+	now := clk.Now().UTC()
+	code := strings.ToUpper(req.Code)
+	coupon := Coupon{
+		PK:             couponPartition(code),
+		SK:             couponEntity,
+		Code:           code,
+		Description:    req.Description,
+		Type:           req.Type,
+		Value:          req.Value,
+		Currency:       req.Currency,
+		SKUs:           req.SKUs,
+		Categories:     req.Categories,
+		MaxRedemptions: req.MaxRedemptions,
+		MaxPerUser:     req.MaxPerUser,
+		Active:         true,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if req.ExpiresAt != nil {
+		expires := req.ExpiresAt.UTC()
+		coupon.ExpiresAt, coupon.ExpiresEpoch = &expires, expires.Unix()
+	}
+
+	if err := coupons.Put(r.Context(), coupon, dynamo.IfNotExists(dynamo.PartitionKey)); err != nil {
+		if errors.Is(err, dynamo.ErrConditionFailed) {
+			problem.Write(w, r, problem.New(http.StatusConflict, "Coupon "+code+" already exists"))
+			return
+		}
+		writeCouponError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/coupons/"+code)
+	writeJSON(w, http.StatusCreated, coupon)
+}
+
+func getCouponHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r) {
+		return
+	}
+	coupon, err := getCoupon(r.Context(), mux.Vars(r)["code"])
+	if err != nil {
+		writeCouponError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, coupon)
+}
+
+// deactivateCouponHandler stops a coupon being redeemed. Its redemptions
+// stand.
+func deactivateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r) {
+		return
+	}
+	code := strings.ToUpper(mux.Vars(r)["code"])
+	if !validCode(code) {
+		writeCouponError(w, r, errCouponNotFound)
+		return
+	}
+	err := coupons.Update(r.Context(), couponKey(code), dynamo.Update{
+		Expression: "SET active = :false, updated_at = :now",
+		Condition:  "attribute_exists(pk)",
+		Values: map[string]types.AttributeValue{
+			":false": &types.AttributeValueMemberBOOL{Value: false},
+			":now":   dynamo.S(clk.Now().UTC().Format(time.RFC3339Nano)),
+		},
+	}, nil)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		err = errCouponNotFound
+	}
+	if err != nil {
+		writeCouponError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// redeemCouponHandler redeems a coupon for an order placed outside the
+// checkout. Redeeming again for the same order answers 200 with the first
+// redemption.
+func redeemCouponHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r) {
+		return
+	}
+	var req RedeemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	redemption, replayed, err := redeem(r.Context(), mux.Vars(r)["code"], req)
+	if err != nil {
+		writeCouponError(w, r, err)
+		return
+	}
+	status := http.StatusCreated
+	if replayed {
+		status = http.StatusOK
+	}
+	w.Header().Set("Location", "/coupons/"+redemption.Code+"/redemptions/"+redemption.OrderID)
+	writeJSON(w, status, redemption)
+}
+
+// releaseRedemptionHandler gives back the uses an order's redemption took.
+// Releasing one that does not exist succeeds.
+func releaseRedemptionHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	if err := release(r.Context(), vars["code"], vars["orderId"]); err != nil {
+		writeCouponError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// redeem applies coupon code to req's items and records the redemption,
+// reporting whether it had already been made for the order.
+func redeem(ctx context.Context, code string, req RedeemRequest) (Redemption, bool, error) {
+	code = strings.ToUpper(code)
+	if !validCode(code) {
+		return Redemption{}, false, errCouponNotFound
+	}
+	if existing, err := getRedemption(ctx, code, req.OrderID); err == nil {
+		return existing, true, nil
+	} else if !errors.Is(err, dynamo.ErrNotFound) {
+		return Redemption{}, false, err
+	}
+
+	coupon, err := getCoupon(ctx, code)
+	if err != nil {
+		return Redemption{}, false, err
+	}
+	now := clk.Now().UTC()
+	if err := coupon.usable(now, req.UserID); err != nil {
+		return Redemption{}, false, err
+	}
+	discount, err := coupon.discount(req.Items, req.Currency)
+	if err != nil {
+		return Redemption{}, false, err
+	}
+
+	redemption := Redemption{
+		PK:         couponPartition(code),
+		SK:         dynamo.Compose(redemptionEntity, req.OrderID),
+		Code:       code,
+		OrderID:    req.OrderID,
+		UserID:     req.UserID,
+		Discount:   discount,
+		Currency:   req.Currency,
+		RedeemedAt: now,
+		PerUser:    coupon.MaxPerUser > 0,
+	}
+
+	writes := []dynamo.TxItem{
+		coupons.PutTx(redemption, dynamo.IfNotExists(dynamo.PartitionKey)),
+		coupons.UpdateTx(couponKey(code), dynamo.Update{
+			Expression: "SET redemptions = redemptions + :one, updated_at = :now",
+			Condition: "active = :true" +
+				" AND (attribute_not_exists(expires_epoch) OR expires_epoch > :epoch)" +
+				" AND (max_redemptions = :zero OR redemptions < max_redemptions)",
+			Values: map[string]types.AttributeValue{
+				":one":   dynamo.N("1"),
+				":zero":  dynamo.N("0"),
+				":true":  &types.AttributeValueMemberBOOL{Value: true},
+				":epoch": dynamo.N(strconv.FormatInt(now.Unix(), 10)),
+				":now":   dynamo.S(now.Format(time.RFC3339Nano)),
+			},
+		}),
+	}
+	if redemption.PerUser {
+		writes = append(writes, coupons.UpdateTx(userCounterKey(code, req.UserID), dynamo.Update{
+			Expression: "SET redemptions = if_not_exists(redemptions, :zero) + :one, #tenant_id = :tenant_id",
+			Condition:  "attribute_not_exists(redemptions) OR redemptions < :limit",
+			Names:      map[string]string{"#tenant_id": "tenant_id"},
+			Values: map[string]types.AttributeValue{
+				":one":       dynamo.N("1"),
+				":zero":      dynamo.N("0"),
+				":limit":     dynamo.N(strconv.Itoa(coupon.MaxPerUser)),
+				":tenant_id": dynamo.S(tenant.FromContext(ctx)),
+			},
+		}))
+	}
+
+	err = coupons.TransactWrite(ctx, writes...)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return redemptionRefused(ctx, code, req)
+	}
+	if err != nil {
+		return Redemption{}, false, fmt.Errorf("failed to redeem coupon %s: %w", code, err)
+	}
+	log.Printf("Coupon %s redeemed for order %s: %.2f %s off", code, req.OrderID, discount, req.Currency)
+	return redemption, false, nil
+}
+
+// redemptionRefused finds out which condition of a redemption failed: a
+// concurrent redemption for the same order, which is replayed, or the
+// coupon or the user running out of uses.
+func redemptionRefused(ctx context.Context, code string, req RedeemRequest) (Redemption, bool, error) {
+	if existing, err := getRedemption(ctx, code, req.OrderID); err == nil {
+		return existing, true, nil
+	}
+	coupon, err := getCoupon(ctx, code)
+	if err != nil {
+		return Redemption{}, false, err
+	}
+	if err := coupon.usable(clk.Now().UTC(), req.UserID); err != nil {
+		return Redemption{}, false, err
+	}
+	if coupon.MaxPerUser > 0 {
+		return Redemption{}, false, errCouponUserLimit
+	}
+	return Redemption{}, false, fmt.Errorf("redemption of coupon %s for order %s conflicted with another", code, req.OrderID)
+}
+
+// release deletes an order's redemption and gives its uses back.
+func release(ctx context.Context, code, orderID string) error {
+	code = strings.ToUpper(code)
+	if !validCode(code) {
+		return nil
+	}
+	redemption, err := getRedemption(ctx, code, orderID)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	decrement := dynamo.Update{
+		Expression: "SET redemptions = redemptions - :one",
+		Condition:  "redemptions > :zero",
+		Values:     map[string]types.AttributeValue{":one": dynamo.N("1"), ":zero": dynamo.N("0")},
+	}
+	writes := []dynamo.TxItem{
+		coupons.DeleteTx(redemptionKey(code, orderID), dynamo.IfExists(dynamo.PartitionKey)),
+		coupons.UpdateTx(couponKey(code), decrement),
+	}
+	if redemption.PerUser {
+		writes = append(writes, coupons.UpdateTx(userCounterKey(code, redemption.UserID), decrement))
+	}
+
+	err = coupons.TransactWrite(ctx, writes...)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		// Released concurrently.
+		if _, getErr := getRedemption(ctx, code, orderID); errors.Is(getErr, dynamo.ErrNotFound) {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release coupon %s for order %s: %w", code, orderID, err)
+	}
+	log.Printf("Coupon %s released for order %s", code, orderID)
+	return nil
+}
+
+// usable checks everything about the coupon except what the order is for.
+func (cp Coupon) usable(now time.Time, userID string) error {
+	switch {
+	case !cp.Active:
+		return errCouponInactive
+	case cp.ExpiresAt != nil && !now.Before(*cp.ExpiresAt):
+		return errCouponExpired
+	case cp.MaxRedemptions > 0 && cp.Redemptions >= cp.MaxRedemptions:
+		return errCouponExhausted
+	case cp.MaxPerUser > 0 && userID == "":
+		return errCouponNeedsUser
+	}
+	return nil
+}
+
+// discount is what the coupon takes off the lines it applies to, rounded
+// to the cent and never more than they cost.
+func (cp Coupon) discount(items []CouponLine, currency string) (float64, error) {
+	if cp.Type == DiscountFixed && !strings.EqualFold(cp.Currency, currency) {
+		return 0, fmt.Errorf("%w: it is for orders in %s", errCouponNotApplicable, cp.Currency)
+	}
+	var eligible float64
+	for _, item := range items {
+		if cp.appliesTo(item) {
+			eligible += float64(item.Quantity) * item.UnitPrice
+		}
+	}
+	eligible = math.Round(eligible*100) / 100
+	if eligible <= 0 {
+		return 0, errCouponNotApplicable
+	}
+
+	amount := cp.Value
+	if cp.Type == DiscountPercentage {
+		amount = eligible * cp.Value / 100
+	}
+	return math.Round(math.Min(amount, eligible)*100) / 100, nil
+}
+
+// appliesTo reports whether the coupon covers a line: any line when it
+// names no SKUs or categories, otherwise a line matching either.
+func (cp Coupon) appliesTo(item CouponLine) bool {
+	if len(cp.SKUs) == 0 && len(cp.Categories) == 0 {
+		return true
+	}
+	for _, sku := range cp.SKUs {
+		if item.SKU == sku {
+			return true
+		}
+	}
+	for _, category := range cp.Categories {
+		if item.Category != "" && strings.EqualFold(item.Category, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireScope answers 401 or 403 unless the caller's token has the
+// coupons scope.
+func requireScope(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-User-Id") == "" && r.Header.Get("X-Client-Id") == "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "Coupons are managed by authenticated callers"))
+		return false
+	}
+	for _, scope := range strings.Fields(r.Header.Get("X-Auth-Scope")) {
+		if scope == couponsScope {
+			return true
+		}
+	}
+	problem.Write(w, r, problem.New(http.StatusForbidden, "The "+couponsScope+" scope is required to manage coupons"))
+	return false
+}
+
+// couponStatus is the HTTP status of a refused redemption: 404 for an
+// unknown coupon, 409 for one out of uses, 422 otherwise; 0 for an error
+// that is not a refusal.
+func couponStatus(err error) int {
+	switch {
+	case errors.Is(err, errCouponNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errCouponExhausted), errors.Is(err, errCouponUserLimit):
+		return http.StatusConflict
+	case errors.Is(err, errCouponInactive), errors.Is(err, errCouponExpired),
+		errors.Is(err, errCouponNeedsUser), errors.Is(err, errCouponNotApplicable):
+		return http.StatusUnprocessableEntity
+	}
+	return 0
+}
+
+func writeCouponError(w http.ResponseWriter, r *http.Request, err error) {
+	if status := couponStatus(err); status != 0 {
+		problem.Write(w, r, problem.New(status, capitalize(err.Error())))
+		return
+	}
+	log.Printf("Coupon error: %v", err)
+	problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// DynamoDB operations
+
+// validCode reports whether code, as given in a path, can name a coupon.
+func validCode(code string) bool {
+	return couponCodePattern.MatchString(code)
+}
+
+func couponPartition(code string) string {
+	return dynamo.Compose(couponEntity, code)
+}
+
+func couponKey(code string) dynamo.Key {
+	return dynamo.ItemKey(couponPartition(code), couponEntity)
+}
+
+func redemptionKey(code, orderID string) dynamo.Key {
+	return dynamo.ItemKey(couponPartition(code), dynamo.Compose(redemptionEntity, orderID))
+}
+
+func userCounterKey(code, userID string) dynamo.Key {
+	return dynamo.ItemKey(couponPartition(code), dynamo.Compose(userEntity, userID))
+}
+
+func getCoupon(ctx context.Context, code string) (Coupon, error) {
+	code = strings.ToUpper(code)
+	if !validCode(code) {
+		return Coupon{}, errCouponNotFound
+	}
+	coupon, err := dynamo.Get[Coupon](ctx, coupons, couponKey(code))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return Coupon{}, errCouponNotFound
+	}
+	if err != nil {
+		return Coupon{}, fmt.Errorf("failed to get coupon %s: %w", code, err)
+	}
+	return coupon, nil
+}
+
+// getRedemption returns dynamo.ErrNotFound when the order has not
+// redeemed the coupon.
+func getRedemption(ctx context.Context, code, orderID string) (Redemption, error) {
+	redemption, err := dynamo.Get[Redemption](ctx, coupons, redemptionKey(code, orderID))
+	if err != nil && !errors.Is(err, dynamo.ErrNotFound) {
+		return Redemption{}, fmt.Errorf("failed to get redemption of %s for order %s: %w", code, orderID, err)
+	}
+	return redemption, err
+}
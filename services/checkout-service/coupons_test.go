@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pkg/dynamo"
+)
+
+// seedCoupon stores cp as an active coupon taking 10% off.
+func seedCoupon(t *testing.T, cp Coupon) {
+	t.Helper()
+	cp.PK, cp.SK, cp.Active = couponPartition(cp.Code), couponEntity, true
+	if cp.Type == "" {
+		cp.Type, cp.Value = DiscountPercentage, 10
+	}
+	if cp.ExpiresAt != nil {
+		cp.ExpiresEpoch = cp.ExpiresAt.Unix()
+	}
+	if err := coupons.Put(context.Background(), cp, dynamo.IfNotExists(dynamo.PartitionKey)); err != nil {
+		t.Fatalf("seed coupon %s: %v", cp.Code, err)
+	}
+}
+
+func TestRedeemAndRelease(t *testing.T) {
+	// step redeems the coupon for order, or releases order's redemption.
+	type step struct {
+		release  bool
+		order    string
+		user     string
+		want     error
+		replayed bool
+	}
+	expired := start.Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		coupon Coupon
+		steps  []step
+		// redemptions is the coupon's count after the steps.
+		redemptions int
+	}{
+		{
+			name:        "counts a redemption",
+			coupon:      Coupon{Code: "SAVE10"},
+			steps:       []step{{order: "order-1", user: "user-1"}},
+			redemptions: 1,
+		},
+		{
+			name:   "replays a redemption for the same order",
+			coupon: Coupon{Code: "SAVE10", MaxRedemptions: 1},
+			steps: []step{
+				{order: "order-1", user: "user-1"},
+				{order: "order-1", user: "user-1", replayed: true},
+			},
+			redemptions: 1,
+		},
+		{
+			name:   "refuses a coupon used up",
+			coupon: Coupon{Code: "SAVE10", MaxRedemptions: 1},
+			steps: []step{
+				{order: "order-1", user: "user-1"},
+				{order: "order-2", user: "user-2", want: errCouponExhausted},
+			},
+			redemptions: 1,
+		},
+		{
+			name:   "limits the uses of each user",
+			coupon: Coupon{Code: "SAVE10", MaxPerUser: 1},
+			steps: []step{
+				{order: "order-1", user: "user-1"},
+				{order: "order-2", user: "user-1", want: errCouponUserLimit},
+				{order: "order-3", user: "user-2"},
+			},
+			redemptions: 2,
+		},
+		{
+			name:   "gives the coupon's and the user's use back on release",
+			coupon: Coupon{Code: "SAVE10", MaxRedemptions: 1, MaxPerUser: 1},
+			steps: []step{
+				{order: "order-1", user: "user-1"},
+				{release: true, order: "order-1"},
+				{order: "order-2", user: "user-1"},
+			},
+			redemptions: 1,
+		},
+		{
+			name:   "releases a redemption once",
+			coupon: Coupon{Code: "SAVE10"},
+			steps: []step{
+				{order: "order-1", user: "user-1"},
+				{release: true, order: "order-1"},
+				{release: true, order: "order-1"},
+				{release: true, order: "order-2"},
+			},
+			redemptions: 0,
+		},
+		{
+			name:   "refuses an expired coupon",
+			coupon: Coupon{Code: "SAVE10", ExpiresAt: &expired},
+			steps:  []step{{order: "order-1", user: "user-1", want: errCouponExpired}},
+		},
+		{
+			name:   "needs a user for a coupon limited per user",
+			coupon: Coupon{Code: "SAVE10", MaxPerUser: 1},
+			steps:  []step{{order: "order-1", want: errCouponNeedsUser}},
+		},
+		{
+			name:   "refuses a coupon for other SKUs",
+			coupon: Coupon{Code: "SAVE10", SKUs: []string{"SKU-9"}},
+			steps:  []step{{order: "order-1", user: "user-1", want: errCouponNotApplicable}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTables(t)
+			seedCoupon(t, tt.coupon)
+			ctx := context.Background()
+
+			for i, s := range tt.steps {
+				if s.release {
+					if err := release(ctx, tt.coupon.Code, s.order); err != nil {
+						t.Fatalf("step %d: release %s: %v", i+1, s.order, err)
+					}
+					continue
+				}
+				redemption, replayed, err := redeem(ctx, tt.coupon.Code, RedeemRequest{
+					OrderID:  s.order,
+					UserID:   s.user,
+					Currency: "EUR",
+					Items: []CouponLine{
+						{SKU: "SKU-1", Quantity: 2, UnitPrice: 12.5},
+						{SKU: "SKU-2", Quantity: 1, UnitPrice: 5},
+					},
+				})
+				if !errors.Is(err, s.want) {
+					t.Fatalf("step %d: redeem for %s = %v, want %v", i+1, s.order, err, s.want)
+				}
+				if err == nil && redemption.Discount != 3 {
+					t.Errorf("step %d: discount = %v, want 3", i+1, redemption.Discount)
+				}
+				if replayed != s.replayed {
+					t.Errorf("step %d: replayed = %v, want %v", i+1, replayed, s.replayed)
+				}
+			}
+
+			coupon, err := getCoupon(ctx, tt.coupon.Code)
+			if err != nil {
+				t.Fatalf("get coupon: %v", err)
+			}
+			if coupon.Redemptions != tt.redemptions {
+				t.Errorf("redemptions = %d, want %d", coupon.Redemptions, tt.redemptions)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/health"
+	"pkg/idempotency"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/recovery"
+	"pkg/tenant"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient *dynamodb.Client
+	checkouts    *dynamo.Table
+	coupons      *dynamo.Table
+	serverPort   string
+	version      = "1.0.0"
+
+	// The services each checkout calls.
+	carts        *backend
+	inventory    *backend
+	payments     *backend
+	orders       *backend
+	products     *backend
+	attributions *backend
+
+	// sagaTimeout bounds one checkout request's run through the saga;
+	// stuckAfter is how long a checkout may go unsaved before the
+	// recovery sweep takes it over.
+	sagaTimeout   time.Duration
+	stuckAfter    time.Duration
+	sweepInterval time.Duration
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+
+	// recoverer reports panics in handlers and the sweeper.
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	serverPort = getEnv("PORT", "3011")
+
+	backendTimeout := time.Duration(getEnvInt("BACKEND_TIMEOUT_SECONDS", 5)) * time.Second
+	carts = newBackend("cart-service", os.Getenv("CART_SERVICE_URL"), backendTimeout)
+	inventory = newBackend("inventory-service", os.Getenv("INVENTORY_SERVICE_URL"), backendTimeout)
+	payments = newBackend("payment-service", os.Getenv("PAYMENT_SERVICE_URL"), backendTimeout)
+	orders = newBackend("order-service", os.Getenv("ORDER_SERVICE_URL"), backendTimeout)
+	products = newBackend("product-service", os.Getenv("PRODUCT_SERVICE_URL"), backendTimeout)
+	attributions = newBackend("attribution-service", os.Getenv("ATTRIBUTION_SERVICE_URL"), backendTimeout)
+
+	sagaTimeout = time.Duration(getEnvInt("CHECKOUT_TIMEOUT_SECONDS", 45)) * time.Second
+	stuckAfter = time.Duration(getEnvInt("CHECKOUT_STUCK_MINUTES", 5)) * time.Minute
+	sweepInterval = time.Duration(getEnvInt("CHECKOUT_SWEEP_INTERVAL_SECONDS", 60)) * time.Second
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+	recoverer = recovery.New("checkout-service", clk, idGen)
+
+	checkouts = dynamo.NewTable(dynamoClient, getEnv("CHECKOUTS_TABLE_NAME", "checkouts"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second))
+	coupons = dynamo.NewTable(dynamoClient, getEnv("COUPONS_TABLE_NAME", "coupons"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second), dynamo.WithTenancy(dynamo.PartitionKey))
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware, tenant.Middleware)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id", "orderId"))
+
+	// Idempotency-Key support for POST retries
+	if table := os.Getenv("IDEMPOTENCY_TABLE_NAME"); table != "" {
+		router.Use(idempotency.NewStore(dynamoClient, table, clk).Middleware)
+	}
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("checkout-service", clk,
+		health.Table(dynamoClient, checkouts.Name, true),
+		health.Table(dynamoClient, coupons.Name, false),
+	).Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs, manual recovery sweeps")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+		router.HandleFunc("/__test/recovery-sweep", sweepHandler).Methods("POST")
+	} else {
+		go runRecoverySweeper(context.Background())
+	}
+
+	// Checkout endpoints
+	router.HandleFunc("/checkout", checkoutHandler).Methods("POST")
+	router.HandleFunc("/checkout/{id}", getCheckoutHandler).Methods("GET")
+
+	// Coupon endpoints
+	router.HandleFunc("/coupons", createCouponHandler).Methods("POST")
+	router.HandleFunc("/coupons/{code}", getCouponHandler).Methods("GET")
+	router.HandleFunc("/coupons/{code}", deactivateCouponHandler).Methods("DELETE")
+	router.HandleFunc("/coupons/{code}/redemptions", redeemCouponHandler).Methods("POST")
+	router.HandleFunc("/coupons/{code}/redemptions/{orderId}", releaseRedemptionHandler).Methods("DELETE")
+
+	// Start server; a checkout makes several backend calls in turn
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: sagaTimeout + 15*time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Checkout service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "checkout-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
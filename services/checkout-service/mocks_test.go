@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/ids"
+	"pkg/problem"
+)
+
+var start = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// fakeDB is an in-memory table keyed on keys. Writes evaluate their
+// condition expressions against the stored item. A method the test did
+// not expect panics on the nil API.
+type fakeDB struct {
+	dynamo.API
+
+	mu    sync.Mutex
+	keys  []string
+	items map[string]map[string]types.AttributeValue
+}
+
+func newFakeDB(keys ...string) *fakeDB {
+	return &fakeDB{keys: keys, items: map[string]map[string]types.AttributeValue{}}
+}
+
+// useTables gives the service fresh in-memory checkouts and coupons
+// tables, a manual clock and sequential IDs for the rest of the test.
+func useTables(t *testing.T) {
+	t.Helper()
+	savedCheckouts, savedCoupons, savedClk, savedIDs := checkouts, coupons, clk, idGen
+	checkouts = dynamo.NewTable(newFakeDB("id"), "checkouts")
+	coupons = dynamo.NewTable(newFakeDB(dynamo.PartitionKey, dynamo.SortKey), "coupons", dynamo.WithTenancy(dynamo.PartitionKey))
+	clk = clock.NewManual(start, time.Millisecond)
+	idGen = &ids.Sequential{}
+	t.Cleanup(func() { checkouts, coupons, clk, idGen = savedCheckouts, savedCoupons, savedClk, savedIDs })
+}
+
+func (db *fakeDB) keyOf(item map[string]types.AttributeValue) string {
+	var parts []string
+	for _, name := range db.keys {
+		parts = append(parts, item[name].(*types.AttributeValueMemberS).Value)
+	}
+	return strings.Join(parts, "|")
+}
+
+func (db *fakeDB) GetItem(ctx context.Context, in *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: db.items[db.keyOf(in.Key)]}, nil
+}
+
+func (db *fakeDB) PutItem(ctx context.Context, in *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	key := db.keyOf(in.Item)
+	if !holds(in.ConditionExpression, db.items[key], in.ExpressionAttributeNames, in.ExpressionAttributeValues) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	db.items[key] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (db *fakeDB) DeleteItem(ctx context.Context, in *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	key := db.keyOf(in.Key)
+	if !holds(in.ConditionExpression, db.items[key], in.ExpressionAttributeNames, in.ExpressionAttributeValues) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	delete(db.items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (db *fakeDB) UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	item, ok := db.updated(in.Key, *in.UpdateExpression, in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if !ok {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	db.items[db.keyOf(in.Key)] = item
+	return &dynamodb.UpdateItemOutput{Attributes: item}, nil
+}
+
+// TransactWriteItems checks every condition before writing anything, and
+// cancels the transaction naming the items whose condition failed.
+func (db *fakeDB) TransactWriteItems(ctx context.Context, in *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	writes := map[string]map[string]types.AttributeValue{}
+	reasons := make([]types.CancellationReason, len(in.TransactItems))
+	canceled := false
+	for i, tx := range in.TransactItems {
+		var ok bool
+		switch {
+		case tx.Put != nil:
+			key := db.keyOf(tx.Put.Item)
+			ok = holds(tx.Put.ConditionExpression, db.items[key], tx.Put.ExpressionAttributeNames, tx.Put.ExpressionAttributeValues)
+			writes[key] = tx.Put.Item
+		case tx.Update != nil:
+			var item map[string]types.AttributeValue
+			item, ok = db.updated(tx.Update.Key, *tx.Update.UpdateExpression, tx.Update.ConditionExpression, tx.Update.ExpressionAttributeNames, tx.Update.ExpressionAttributeValues)
+			writes[db.keyOf(tx.Update.Key)] = item
+		case tx.Delete != nil:
+			key := db.keyOf(tx.Delete.Key)
+			ok = holds(tx.Delete.ConditionExpression, db.items[key], tx.Delete.ExpressionAttributeNames, tx.Delete.ExpressionAttributeValues)
+			writes[key] = nil
+		case tx.ConditionCheck != nil:
+			check := tx.ConditionCheck
+			ok = holds(check.ConditionExpression, db.items[db.keyOf(check.Key)], check.ExpressionAttributeNames, check.ExpressionAttributeValues)
+		}
+		code := "None"
+		if !ok {
+			code, canceled = "ConditionalCheckFailed", true
+		}
+		reasons[i].Code = &code
+	}
+	if canceled {
+		return nil, &types.TransactionCanceledException{CancellationReasons: reasons}
+	}
+	for key, item := range writes {
+		if item == nil {
+			delete(db.items, key)
+		} else {
+			db.items[key] = item
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// updated is the item at key as update, a "SET a = ..., b = ..."
+// expression, leaves it, or false if cond does not hold.
+func (db *fakeDB) updated(key map[string]types.AttributeValue, update string, cond *string, names map[string]string, values map[string]types.AttributeValue) (map[string]types.AttributeValue, bool) {
+	old := db.items[db.keyOf(key)]
+	if !holds(cond, old, names, values) {
+		return nil, false
+	}
+	item := map[string]types.AttributeValue{}
+	for name, v := range old {
+		item[name] = v
+	}
+	for name, v := range key {
+		item[name] = v
+	}
+	e := &expression{tokens: tokenPattern.FindAllString(update, -1), item: old, names: names, values: values}
+	e.next()
+	for {
+		name := e.name(e.next())
+		e.next()
+		item[name] = e.operand()
+		if e.peek() != "," {
+			return item, true
+		}
+		e.next()
+	}
+}
+
+// expression evaluates the condition expressions the service writes
+// with: AND, OR, NOT and parentheses over attribute_exists,
+// attribute_not_exists and comparisons of attributes and values. Its
+// operands serve the right-hand sides of update expressions too.
+type expression struct {
+	tokens []string
+	item   map[string]types.AttributeValue
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+var tokenPattern = regexp.MustCompile(`[#:]?[A-Za-z_][A-Za-z0-9_.]*|<=|>=|<>|[=<>(),+-]`)
+
+// holds reports whether cond, if any, holds for item, nil for none.
+func holds(cond *string, item map[string]types.AttributeValue, names map[string]string, values map[string]types.AttributeValue) bool {
+	if cond == nil {
+		return true
+	}
+	e := &expression{tokens: tokenPattern.FindAllString(*cond, -1), item: item, names: names, values: values}
+	return e.or()
+}
+
+func (e *expression) peek() string {
+	if len(e.tokens) == 0 {
+		return ""
+	}
+	return e.tokens[0]
+}
+
+func (e *expression) next() string {
+	token := e.peek()
+	e.tokens = e.tokens[1:]
+	return token
+}
+
+func (e *expression) or() bool {
+	v := e.and()
+	for e.peek() == "OR" {
+		e.next()
+		v = e.and() || v
+	}
+	return v
+}
+
+func (e *expression) and() bool {
+	v := e.not()
+	for e.peek() == "AND" {
+		e.next()
+		v = e.not() && v
+	}
+	return v
+}
+
+func (e *expression) not() bool {
+	switch e.peek() {
+	case "NOT":
+		e.next()
+		return !e.not()
+	case "(":
+		e.next()
+		v := e.or()
+		e.next()
+		return v
+	case "attribute_exists", "attribute_not_exists":
+		fn := e.next()
+		e.next()
+		_, exists := e.item[e.name(e.next())]
+		e.next()
+		return exists == (fn == "attribute_exists")
+	}
+	left := e.operand()
+	op := e.next()
+	return compare(left, op, e.operand())
+}
+
+// name resolves a #placeholder to the attribute it stands for.
+func (e *expression) name(token string) string {
+	if real, ok := e.names[token]; ok {
+		return real
+	}
+	return token
+}
+
+// operand is a value, an attribute or if_not_exists, plus or minus
+// another operand.
+func (e *expression) operand() types.AttributeValue {
+	var v types.AttributeValue
+	switch token := e.next(); {
+	case token == "if_not_exists":
+		e.next()
+		v = e.operand()
+		e.next()
+		fallback := e.operand()
+		e.next()
+		if v == nil {
+			v = fallback
+		}
+	case strings.HasPrefix(token, ":"):
+		v = e.values[token]
+	default:
+		v = e.item[e.name(token)]
+	}
+	if op := e.peek(); op == "+" || op == "-" {
+		e.next()
+		a, b := numberOf(v), numberOf(e.operand())
+		if op == "-" {
+			b = -b
+		}
+		v = dynamo.N(strconv.FormatFloat(a+b, 'f', -1, 64))
+	}
+	return v
+}
+
+func numberOf(v types.AttributeValue) float64 {
+	n, ok := v.(*types.AttributeValueMemberN)
+	if !ok {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(n.Value, 64)
+	return f
+}
+
+// compare is false when either side is missing, as in DynamoDB.
+func compare(left types.AttributeValue, op string, right types.AttributeValue) bool {
+	var cmp int
+	switch l := left.(type) {
+	case *types.AttributeValueMemberN:
+		if _, ok := right.(*types.AttributeValueMemberN); !ok {
+			return false
+		}
+		switch a, b := numberOf(left), numberOf(right); {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	case *types.AttributeValueMemberS:
+		r, ok := right.(*types.AttributeValueMemberS)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(l.Value, r.Value)
+	case *types.AttributeValueMemberBOOL:
+		r, ok := right.(*types.AttributeValueMemberBOOL)
+		if !ok || (op != "=" && op != "<>") {
+			return false
+		}
+		if l.Value != r.Value {
+			cmp = 1
+		}
+	default:
+		return false
+	}
+	switch op {
+	case "=":
+		return cmp == 0
+	case "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// fakeBackends stands in for cart-, inventory-, payment-, order- and
+// product-service, all at one URL. It records every call as "METHOD path"
+// and answers a call listed in fail with that status.
+type fakeBackends struct {
+	mu    sync.Mutex
+	calls []string
+	fail  map[string]int
+	cart  cart
+	// prices are product-service's prices by product ID.
+	prices map[string]float64
+	// held and paid record that res-1 and pay-1 were created, for
+	// listing them by order.
+	held, paid bool
+}
+
+// useBackends points every backend at a fakeBackends for the rest of the
+// test, but for attribution-service, which is left unset. The cart it
+// serves is cart-1, with two lines, owned by user-1.
+func useBackends(t *testing.T, fail map[string]int) *fakeBackends {
+	t.Helper()
+	b := &fakeBackends{
+		fail: fail,
+		cart: cart{
+			ID:       "cart-1",
+			UserID:   "user-1",
+			Currency: "EUR",
+			Status:   cartStatusActive,
+			Items: []CheckoutItem{
+				{SKU: "SKU-1", ProductID: "prod-1", Quantity: 2, UnitPrice: 12.5},
+				{SKU: "SKU-2", ProductID: "prod-2", Quantity: 1, UnitPrice: 5},
+			},
+		},
+		prices: map[string]float64{"prod-1": 12.5, "prod-2": 5},
+	}
+	srv := httptest.NewServer(b)
+	t.Cleanup(srv.Close)
+
+	saved := []*backend{carts, inventory, payments, orders, products}
+	carts = newBackend("cart-service", srv.URL, time.Second)
+	inventory = newBackend("inventory-service", srv.URL, time.Second)
+	payments = newBackend("payment-service", srv.URL, time.Second)
+	orders = newBackend("order-service", srv.URL, time.Second)
+	products = newBackend("product-service", srv.URL, time.Second)
+	savedAttributions := attributions
+	attributions = newBackend("attribution-service", "", time.Second)
+	savedTimeout := sagaTimeout
+	sagaTimeout = 10 * time.Second
+	t.Cleanup(func() {
+		carts, inventory, payments, orders, products = saved[0], saved[1], saved[2], saved[3], saved[4]
+		attributions, sagaTimeout = savedAttributions, savedTimeout
+	})
+	return b
+}
+
+func (b *fakeBackends) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := r.Method + " " + r.URL.Path
+	b.mu.Lock()
+	b.calls = append(b.calls, call)
+	b.mu.Unlock()
+
+	if status, ok := b.fail[call]; ok {
+		problem.Write(w, r, problem.New(status, call+" failed"))
+		return
+	}
+	if id, ok := strings.CutPrefix(r.URL.Path, "/products/"); ok && r.Method == http.MethodGet {
+		price, ok := b.prices[strings.TrimSuffix(id, "/price")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"price": price, "currency": b.cart.Currency})
+		return
+	}
+	switch call {
+	case "GET /carts/" + b.cart.ID:
+		writeJSON(w, http.StatusOK, b.cart)
+	case "DELETE /carts/" + b.cart.ID:
+		w.WriteHeader(http.StatusNoContent)
+	case "POST /reservations":
+		b.held = true
+		writeJSON(w, http.StatusCreated, reservation{ID: "res-1", Status: "HELD"})
+	case "GET /reservations":
+		found := []reservation{}
+		if b.held {
+			found = append(found, reservation{ID: "res-1", Status: "HELD"})
+		}
+		writeJSON(w, http.StatusOK, map[string][]reservation{"reservations": found})
+	case "POST /payments":
+		b.paid = true
+		writeJSON(w, http.StatusCreated, payment{ID: "pay-1", Status: paymentSucceeded})
+	case "GET /payments":
+		found := []payment{}
+		if b.paid {
+			found = append(found, payment{ID: "pay-1", Status: paymentSucceeded})
+		}
+		writeJSON(w, http.StatusOK, map[string][]payment{"payments": found})
+	case "POST /orders":
+		var body order
+		json.NewDecoder(r.Body).Decode(&body)
+		writeJSON(w, http.StatusCreated, body)
+	case "POST /reservations/res-1/commit", "POST /reservations/res-1/release", "POST /payments/pay-1/refund":
+		writeJSON(w, http.StatusOK, map[string]string{})
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/dynamo"
+	"pkg/problem"
+)
+
+// recoveryIndex is the GSI on (status, saved_at) used to find checkouts
+// no one has carried on for a while.
+const recoveryIndex = "status-saved_at-index"
+
+// runRecoverySweeper periodically finishes checkouts left pending or
+// half undone, by a crash or by a backend that was down. Every task runs
+// it; saveCheckout's version check lets one worker at a time carry a
+// checkout on.
+func runRecoverySweeper(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			recoverer.Do("checkout recovery sweep", func() {
+				if n, err := sweepCheckouts(ctx); err != nil {
+					log.Printf("Failed to sweep checkouts: %v", err)
+				} else if n > 0 {
+					log.Printf("Recovered %d checkouts", n)
+				}
+			})
+		}
+	}
+}
+
+// sweepHandler runs one sweep on demand; registered only in test mode.
+func sweepHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := sweepCheckouts(r.Context())
+	if err != nil {
+		log.Printf("Failed to sweep checkouts: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"recovered": n})
+}
+
+// sweepCheckouts carries on every pending or compensating checkout last
+// saved more than stuckAfter ago, and returns how many it settled.
+func sweepCheckouts(ctx context.Context) (int, error) {
+	cutoff := clk.Now().Add(-stuckAfter).Unix()
+
+	var settled int
+	for _, status := range []string{CheckoutPending, CheckoutCompensating} {
+		err := dynamo.QueryEach(ctx, checkouts, dynamo.Query{
+			Index:        recoveryIndex,
+			KeyCondition: "#status = :status AND saved_at < :cutoff",
+			Names:        map[string]string{"#status": "status"},
+			Values: map[string]types.AttributeValue{
+				":status": dynamo.S(status),
+				":cutoff": dynamo.N(strconv.FormatInt(cutoff, 10)),
+			},
+		}, func(page []Checkout) error {
+			for i := range page {
+				ok, err := recoverCheckout(ctx, &page[i])
+				if err != nil {
+					log.Printf("Failed to recover checkout %s: %v", page[i].ID, err)
+				}
+				if ok {
+					settled++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return settled, fmt.Errorf("failed to query %s checkouts: %w", status, err)
+		}
+	}
+	return settled, nil
+}
+
+// recoverCheckout settles one stuck checkout, reporting whether it did. A
+// pending checkout that had started creating the order is taken forward,
+// since the order may exist; one that had not is undone. A compensating
+// checkout is undone again, up to maxCompensationAttempts times.
+func recoverCheckout(ctx context.Context, c *Checkout) (bool, error) {
+	switch {
+	case c.Status == CheckoutPending && c.started(StepCreateOrder):
+		err := run(ctx, c)
+		return c.Status == CheckoutCompleted || c.Status == CheckoutFailed, err
+	case c.Status == CheckoutPending:
+		c.Status = CheckoutCompensating
+		c.FailedStep = c.Step
+		c.FailureReason = "checkout was interrupted"
+	}
+
+	c.Attempts++
+	if c.Attempts > maxCompensationAttempts {
+		c.Status = CheckoutCompensationFailed
+		log.Printf("Checkout %s could not be undone after %d attempts and needs attention", c.ID, maxCompensationAttempts)
+		return true, saveCheckout(ctx, c)
+	}
+	if err := saveCheckout(ctx, c); err != nil {
+		return false, err
+	}
+	if err := compensate(ctx, c); err != nil {
+		if errors.Is(err, errCheckoutTaken) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"graphql-service/graph/model"
+)
+
+// adTrend is the part of an ads-api campaign trend the summary needs.
+type adTrend struct {
+	Name   string `json:"name"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Points []struct {
+		Impressions int64   `json:"impressions"`
+		Clicks      int64   `json:"clicks"`
+		Cost        float64 `json:"cost"`
+		Conversions int64   `json:"conversions"`
+	} `json:"points"`
+}
+
+// campaignPerformance totals a campaign's monthly trend from ads-api, which
+// defaults and validates the range. Monthly buckets keep the response to a
+// handful of points however long the range is.
+func campaignPerformance(ctx context.Context, ads *Backend, customerID, campaignID string, from, to *string) (*model.AdPerformanceSummary, error) {
+	query := url.Values{"granularity": {"MONTHLY"}}
+	if from != nil {
+		query.Set("from", *from)
+	}
+	if to != nil {
+		query.Set("to", *to)
+	}
+
+	var trend adTrend
+	path := "/accounts/" + url.PathEscape(customerID) + "/campaigns/" + url.PathEscape(campaignID) + "/trends"
+	err := ads.getJSON(ctx, path, query, &trend)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &model.AdPerformanceSummary{
+		CustomerID: customerID,
+		CampaignID: campaignID,
+		From:       trend.From,
+		To:         trend.To,
+	}
+	if trend.Name != "" {
+		summary.Name = &trend.Name
+	}
+	for _, p := range trend.Points {
+		summary.Impressions += p.Impressions
+		summary.Clicks += p.Clicks
+		summary.Cost += p.Cost
+		summary.Conversions += p.Conversions
+	}
+	summary.Ctr = ratio(float64(summary.Clicks), float64(summary.Impressions))
+	summary.Cpc = ratio(summary.Cost, float64(summary.Clicks))
+	summary.Cpa = ratio(summary.Cost, float64(summary.Conversions))
+	return summary, nil
+}
+
+// ratio is nil when the denominator is zero, as in ads-api trends.
+func ratio(numerator, denominator float64) *float64 {
+	if denominator == 0 {
+		return nil
+	}
+	v := numerator / denominator
+	return &v
+}
+
+// compact drops the nils a loader returns for unknown keys.
+func compact[T any](values []*T) []*T {
+	out := make([]*T, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vikstrous/dataloadgen"
+
+	"graphql-service/graph/model"
+)
+
+const (
+	// loaderWait is how long a loader collects keys before fetching them.
+	// Resolvers for one list run concurrently, so a few milliseconds
+	// gathers a whole page.
+	loaderWait = 2 * time.Millisecond
+	// loaderBatchCapacity matches the largest batch the backends accept.
+	loaderBatchCapacity = 100
+)
+
+// Loaders batch and cache one request's reads. They are created per
+// request: a cache shared between callers would leak data across users.
+type Loaders struct {
+	UserByID       *dataloadgen.Loader[string, *model.User]
+	ProductByID    *dataloadgen.Loader[string, *model.Product]
+	OrdersByUserID *dataloadgen.Loader[string, []*model.Order]
+}
+
+type loadersKey struct{}
+
+func newLoaders(backends *Backends) *Loaders {
+	options := []dataloadgen.Option{
+		dataloadgen.WithWait(loaderWait),
+		dataloadgen.WithBatchCapacity(loaderBatchCapacity),
+	}
+	return &Loaders{
+		UserByID:       dataloadgen.NewLoader(batchUsers(backends.Users), options...),
+		ProductByID:    dataloadgen.NewLoader(batchProducts(backends.Products), options...),
+		OrdersByUserID: dataloadgen.NewLoader(batchOrdersByUser(backends.Orders), options...),
+	}
+}
+
+// Middleware gives every request its own loaders and the headers to
+// forward to the backends.
+func Middleware(backends *Backends) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), loadersKey{}, newLoaders(backends))
+			ctx = WithForwardedHeaders(ctx, r)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func loadersFrom(ctx context.Context) *Loaders {
+	return ctx.Value(loadersKey{}).(*Loaders)
+}
+
+// batchUsers reads users with one GET /users?ids= call. Unknown IDs
+// resolve to nil.
+func batchUsers(backend *Backend) func(context.Context, []string) ([]*model.User, []error) {
+	return func(ctx context.Context, ids []string) ([]*model.User, []error) {
+		var resp struct {
+			Users []*model.User `json:"users"`
+		}
+		query := url.Values{"ids": {strings.Join(ids, ",")}}
+		if err := backend.getJSON(ctx, "/users", query, &resp); err != nil {
+			return nil, []error{err}
+		}
+
+		byID := make(map[string]*model.User, len(resp.Users))
+		for _, u := range resp.Users {
+			byID[u.ID] = u
+		}
+		users := make([]*model.User, len(ids))
+		for i, id := range ids {
+			users[i] = byID[id]
+		}
+		return users, nil
+	}
+}
+
+// batchProducts reads products with one GET /products?ids= call.
+func batchProducts(backend *Backend) func(context.Context, []string) ([]*model.Product, []error) {
+	return func(ctx context.Context, ids []string) ([]*model.Product, []error) {
+		var resp struct {
+			Products []*model.Product `json:"products"`
+		}
+		query := url.Values{"ids": {strings.Join(ids, ",")}}
+		if err := backend.getJSON(ctx, "/products", query, &resp); err != nil {
+			return nil, []error{err}
+		}
+
+		byID := make(map[string]*model.Product, len(resp.Products))
+		for _, p := range resp.Products {
+			byID[p.ID] = p
+		}
+		products := make([]*model.Product, len(ids))
+		for i, id := range ids {
+			products[i] = byID[id]
+		}
+		return products, nil
+	}
+}
+
+// batchOrdersByUser reads the orders of several users with one
+// GET /orders?user_ids= call.
+func batchOrdersByUser(backend *Backend) func(context.Context, []string) ([][]*model.Order, []error) {
+	return func(ctx context.Context, userIDs []string) ([][]*model.Order, []error) {
+		var resp struct {
+			Orders []*model.Order `json:"orders"`
+		}
+		query := url.Values{"user_ids": {strings.Join(userIDs, ",")}}
+		if err := backend.getJSON(ctx, "/orders", query, &resp); err != nil {
+			return nil, []error{err}
+		}
+
+		byUser := make(map[string][]*model.Order, len(userIDs))
+		for _, o := range resp.Orders {
+			byUser[o.UserID] = append(byUser[o.UserID], o)
+		}
+		orders := make([][]*model.Order, len(userIDs))
+		for i, id := range userIDs {
+			orders[i] = byUser[id]
+			if orders[i] == nil {
+				orders[i] = []*model.Order{}
+			}
+		}
+		return orders, nil
+	}
+}
@@ -0,0 +1,68 @@
+// Package model holds the graph's types. They are bound to the schema by
+// name and carry the JSON tags of the backend responses they decode.
+package model
+
+import "time"
+
+// User is served by user-service.
+type User struct {
+	ID               string    `json:"id"`
+	Email            string    `json:"email"`
+	FirstName        string    `json:"first_name"`
+	LastName         string    `json:"last_name"`
+	MarketingConsent bool      `json:"marketing_consent"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Product is served by product-service.
+type Product struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Category    *string `json:"category"`
+	Price       float64 `json:"price"`
+	Currency    string  `json:"currency"`
+}
+
+// Order is served by order-service.
+type Order struct {
+	ID        string       `json:"id"`
+	UserID    string       `json:"user_id"`
+	Status    string       `json:"status"`
+	Total     float64      `json:"total"`
+	Currency  string       `json:"currency"`
+	Items     []*OrderItem `json:"items"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// OrderItem is a line of an Order.
+type OrderItem struct {
+	ProductID string  `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+}
+
+// AdAccount is a Google Ads account onboarded in ads-api.
+type AdAccount struct {
+	CustomerID      string `json:"customer_id"`
+	DescriptiveName string `json:"descriptive_name"`
+	CurrencyCode    string `json:"currency_code"`
+	Status          string `json:"status"`
+}
+
+// AdPerformanceSummary totals a campaign's ads-api trend over a range.
+type AdPerformanceSummary struct {
+	CustomerID  string   `json:"customer_id"`
+	CampaignID  string   `json:"campaign_id"`
+	Name        *string  `json:"name"`
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Impressions int64    `json:"impressions"`
+	Clicks      int64    `json:"clicks"`
+	Cost        float64  `json:"cost"`
+	Conversions int64    `json:"conversions"`
+	Ctr         *float64 `json:"ctr"`
+	Cpc         *float64 `json:"cpc"`
+	Cpa         *float64 `json:"cpa"`
+}
@@ -0,0 +1,10 @@
+package graph
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+// Resolver is the root resolver. Field resolvers read through the
+// request's loaders where a list could otherwise fan out into one backend
+// call per row.
+type Resolver struct {
+	Backends *Backends
+}
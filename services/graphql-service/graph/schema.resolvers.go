@@ -0,0 +1,118 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.45
+
+import (
+	"context"
+	"errors"
+	"graphql-service/graph/model"
+	"net/url"
+)
+
+// CampaignPerformance is the resolver for the campaignPerformance field.
+func (r *adAccountResolver) CampaignPerformance(ctx context.Context, obj *model.AdAccount, campaignID string, from *string, to *string) (*model.AdPerformanceSummary, error) {
+	return campaignPerformance(ctx, r.Backends.Ads, obj.CustomerID, campaignID, from, to)
+}
+
+// User is the resolver for the user field.
+func (r *orderResolver) User(ctx context.Context, obj *model.Order) (*model.User, error) {
+	return loadersFrom(ctx).UserByID.Load(ctx, obj.UserID)
+}
+
+// Product is the resolver for the product field.
+func (r *orderItemResolver) Product(ctx context.Context, obj *model.OrderItem) (*model.Product, error) {
+	return loadersFrom(ctx).ProductByID.Load(ctx, obj.ProductID)
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
+	return loadersFrom(ctx).UserByID.Load(ctx, id)
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, ids []string) ([]*model.User, error) {
+	users, err := loadersFrom(ctx).UserByID.LoadAll(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return compact(users), nil
+}
+
+// Product is the resolver for the product field.
+func (r *queryResolver) Product(ctx context.Context, id string) (*model.Product, error) {
+	return loadersFrom(ctx).ProductByID.Load(ctx, id)
+}
+
+// Products is the resolver for the products field.
+func (r *queryResolver) Products(ctx context.Context, ids []string) ([]*model.Product, error) {
+	products, err := loadersFrom(ctx).ProductByID.LoadAll(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return compact(products), nil
+}
+
+// Order is the resolver for the order field.
+func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, error) {
+	var order model.Order
+	err := r.Backends.Orders.getJSON(ctx, "/orders/"+url.PathEscape(id), nil, &order)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// AdAccounts is the resolver for the adAccounts field.
+func (r *queryResolver) AdAccounts(ctx context.Context) ([]*model.AdAccount, error) {
+	var resp struct {
+		Accounts []*model.AdAccount `json:"accounts"`
+	}
+	if err := r.Backends.Ads.getJSON(ctx, "/accounts", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Accounts, nil
+}
+
+// AdAccount is the resolver for the adAccount field.
+func (r *queryResolver) AdAccount(ctx context.Context, customerID string) (*model.AdAccount, error) {
+	var account model.AdAccount
+	err := r.Backends.Ads.getJSON(ctx, "/accounts/"+url.PathEscape(customerID), nil, &account)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Orders is the resolver for the orders field.
+func (r *userResolver) Orders(ctx context.Context, obj *model.User) ([]*model.Order, error) {
+	return loadersFrom(ctx).OrdersByUserID.Load(ctx, obj.ID)
+}
+
+// AdAccount returns AdAccountResolver implementation.
+func (r *Resolver) AdAccount() AdAccountResolver { return &adAccountResolver{r} }
+
+// Order returns OrderResolver implementation.
+func (r *Resolver) Order() OrderResolver { return &orderResolver{r} }
+
+// OrderItem returns OrderItemResolver implementation.
+func (r *Resolver) OrderItem() OrderItemResolver { return &orderItemResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type adAccountResolver struct{ *Resolver }
+type orderResolver struct{ *Resolver }
+type orderItemResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
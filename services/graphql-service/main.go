@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/gorilla/mux"
+
+	"graphql-service/graph"
+	"pkg/clock"
+	"pkg/ids"
+	"pkg/metrics"
+	"pkg/recovery"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	serverPort string
+	version    = "1.0.0"
+
+	// complexityLimit rejects queries that would fan out into too many
+	// backend reads, such as every order of every user of a large list.
+	complexityLimit int
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+)
+
+func main() {
+	serverPort = getEnv("PORT", "3006")
+	complexityLimit = getEnvInt("GRAPHQL_COMPLEXITY_LIMIT", 500)
+	backendTimeout := time.Duration(getEnvInt("BACKEND_TIMEOUT_SECONDS", 5)) * time.Second
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+
+	backends := &graph.Backends{
+		Users:    graph.NewBackend("user-service", os.Getenv("USER_SERVICE_URL"), backendTimeout),
+		Products: graph.NewBackend("product-service", os.Getenv("PRODUCT_SERVICE_URL"), backendTimeout),
+		Orders:   graph.NewBackend("order-service", os.Getenv("ORDER_SERVICE_URL"), backendTimeout),
+		Ads:      graph.NewBackend("ads-api", os.Getenv("ADS_API_URL"), backendTimeout),
+	}
+
+	server := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{
+		Resolvers: &graph.Resolver{Backends: backends},
+	}))
+	server.Use(extension.FixedComplexityLimit(complexityLimit))
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recovery.New("graphql-service", clk, idGen).Middleware)
+
+	// Request count, error rate and latency per route, scraped from
+	// /metrics
+	registry := metrics.NewRegistry()
+	router.Use(metrics.NewHTTP(registry, "graphql-service", routeTemplate, clk).Middleware)
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.Handle("/metrics", registry.Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+	}
+
+	// GraphQL endpoint, with the playground for local exploration
+	router.Handle("/graphql", graph.Middleware(backends)(server)).Methods("GET", "POST")
+	if os.Getenv("GRAPHQL_PLAYGROUND") == "true" {
+		router.Handle("/playground", playground.Handler("E-commerce graph", "/graphql")).Methods("GET")
+	}
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("GraphQL service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "graphql-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
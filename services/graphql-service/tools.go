@@ -0,0 +1,8 @@
+//go:build tools
+
+// This file pins the gqlgen version used by go generate.
+package main
+
+import (
+	_ "github.com/99designs/gqlgen"
+)
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/health"
+	"pkg/idempotency"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/recovery"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient      *dynamodb.Client
+	stockTable        string
+	reservationsTable string
+	movementsTable    string
+	serverPort        string
+	version           = "1.0.0"
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	stockTable = getEnv("INVENTORY_TABLE_NAME", "inventory")
+	reservationsTable = getEnv("RESERVATIONS_TABLE_NAME", "inventory-reservations")
+	movementsTable = getEnv("STOCK_MOVEMENTS_TABLE_NAME", "stock-movements")
+	serverPort = getEnv("PORT", "3004")
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recovery.New("inventory-service", clk, idGen).Middleware)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id"))
+
+	// Idempotency-Key support for POST retries
+	if table := os.Getenv("IDEMPOTENCY_TABLE_NAME"); table != "" {
+		router.Use(idempotency.NewStore(dynamoClient, table, clk).Middleware)
+	}
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("inventory-service", clk,
+		health.Table(dynamoClient, stockTable, true),
+		health.Table(dynamoClient, reservationsTable, true),
+		health.Table(dynamoClient, movementsTable, false),
+	).Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+	}
+
+	// Stock endpoints
+	router.HandleFunc("/inventory/{sku}", getStockHandler).Methods("GET")
+	router.HandleFunc("/inventory/{sku}/adjustments", adjustStockHandler).Methods("POST")
+	router.HandleFunc("/inventory/{sku}/movements", listMovementsHandler).Methods("GET")
+
+	// Reservation endpoints
+	router.HandleFunc("/reservations", reserveHandler).Methods("POST")
+	router.HandleFunc("/reservations", listReservationsHandler).Methods("GET")
+	router.HandleFunc("/reservations/{id}", getReservationHandler).Methods("GET")
+	router.HandleFunc("/reservations/{id}/release", releaseHandler).Methods("POST")
+	router.HandleFunc("/reservations/{id}/commit", commitHandler).Methods("POST")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Inventory service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "inventory-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// Reservation statuses. A held reservation is either released (checkout
+// abandoned or order cancelled) or committed (order shipped or paid),
+// never both.
+const (
+	ReservationHeld      = "HELD"
+	ReservationReleased  = "RELEASED"
+	ReservationCommitted = "COMMITTED"
+)
+
+type Reservation struct {
+	ID          string            `json:"id" dynamodbav:"id"`
+	OrderID     string            `json:"order_id" dynamodbav:"order_id"`
+	Items       []ReservationLine `json:"items" dynamodbav:"items"`
+	Status      string            `json:"status" dynamodbav:"status"`
+	Reason      string            `json:"reason,omitempty" dynamodbav:"reason,omitempty"`
+	CreatedAt   time.Time         `json:"created_at" dynamodbav:"created_at"`
+	ReleasedAt  *time.Time        `json:"released_at,omitempty" dynamodbav:"released_at,omitempty"`
+	CommittedAt *time.Time        `json:"committed_at,omitempty" dynamodbav:"committed_at,omitempty"`
+}
+
+type ReservationLine struct {
+	SKU      string `json:"sku" dynamodbav:"sku" validate:"required,sku"`
+	Quantity int    `json:"quantity" dynamodbav:"quantity" validate:"required,min=1,max=999"`
+}
+
+// ReserveRequest is limited to 49 lines so a reservation fits in one
+// DynamoDB transaction (100 items): a stock update and a movement per line,
+// plus the reservation itself.
+type ReserveRequest struct {
+	OrderID string            `json:"order_id" validate:"required,max=64"`
+	Items   []ReservationLine `json:"items" validate:"required,min=1,max=49"`
+}
+
+type ReleaseRequest struct {
+	Reason string `json:"reason,omitempty" validate:"max=200"`
+}
+
+// reserveHandler holds stock for every line of an order, or none of it:
+// one transaction decrements available stock per SKU on the condition
+// that enough is available, so concurrent checkouts cannot oversell.
+func reserveHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReserveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	now := clk.Now()
+	reservation := Reservation{
+		ID:        idGen.NewID(),
+		OrderID:   req.OrderID,
+		Items:     consolidateLines(req.Items),
+		Status:    ReservationHeld,
+		CreatedAt: now,
+	}
+
+	// Stock updates come first so cancellation reasons index lines.
+	var items []types.TransactWriteItem
+	for _, line := range reservation.Items {
+		items = append(items, types.TransactWriteItem{Update: &types.Update{
+			TableName:           aws.String(stockTable),
+			Key:                 stockKey(line.SKU),
+			UpdateExpression:    aws.String("SET available = available - :quantity, reserved = reserved + :quantity, updated_at = :now"),
+			ConditionExpression: aws.String("available >= :quantity"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":quantity": number(line.Quantity),
+				":now":      timestamp(now),
+			},
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		}})
+	}
+	for _, line := range reservation.Items {
+		movement, err := movementPut(Movement{
+			SKU:            line.SKU,
+			Type:           MovementReserve,
+			Quantity:       line.Quantity,
+			ReservedChange: line.Quantity,
+			ReservationID:  reservation.ID,
+			OrderID:        reservation.OrderID,
+			CreatedAt:      now,
+		})
+		if err != nil {
+			writeInventoryError(w, r, err)
+			return
+		}
+		items = append(items, movement)
+	}
+	record, err := attributevalue.MarshalMap(reservation)
+	if err != nil {
+		writeInventoryError(w, r, fmt.Errorf("failed to marshal reservation: %w", err))
+		return
+	}
+	items = append(items, types.TransactWriteItem{Put: &types.Put{
+		TableName:           aws.String(reservationsTable),
+		Item:                record,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	}})
+
+	_, err = dynamoClient.TransactWriteItems(r.Context(), &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		var short []validate.FieldError
+		for i, line := range reservation.Items {
+			if conditionFailed(canceled, i) {
+				short = append(short, validate.FieldError{
+					Field:   line.SKU,
+					Rule:    "stock",
+					Message: fmt.Sprintf("requested %d, %d available", line.Quantity, availableIn(canceled.CancellationReasons[i].Item)),
+				})
+			}
+		}
+		if len(short) > 0 {
+			log.Printf("Reservation for order %s rejected: insufficient stock for %d SKUs", req.OrderID, len(short))
+			problem.Write(w, r, insufficientStock(short))
+			return
+		}
+	}
+	if err != nil {
+		writeInventoryError(w, r, fmt.Errorf("failed to reserve stock: %w", err))
+		return
+	}
+
+	w.Header().Set("Location", "/reservations/"+reservation.ID)
+	writeJSON(w, http.StatusCreated, reservation)
+}
+
+func getReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, err := getReservation(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeInventoryError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reservation)
+}
+
+// listReservationsHandler lists the reservations of ?order_id=, oldest
+// first, so a caller that lost a reserve response can find what it holds.
+func listReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	orderID := r.URL.Query().Get("order_id")
+	if orderID == "" || len(orderID) > 64 {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "order_id is required"))
+		return
+	}
+	reservations, err := reservationsForOrder(r.Context(), orderID)
+	if err != nil {
+		writeInventoryError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]Reservation{"reservations": reservations})
+}
+
+// releaseHandler returns a held reservation's stock to available.
+// Releasing twice is harmless; releasing committed stock is a conflict.
+func releaseHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReleaseRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+			return
+		}
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	reservation, err := settleReservation(r.Context(), mux.Vars(r)["id"], ReservationReleased, req.Reason)
+	if err != nil {
+		writeInventoryError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reservation)
+}
+
+// commitHandler turns a held reservation into a stock deduction: reserved
+// and on-hand both drop, available is unchanged.
+func commitHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, err := settleReservation(r.Context(), mux.Vars(r)["id"], ReservationCommitted, "")
+	if err != nil {
+		writeInventoryError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reservation)
+}
+
+// settleReservation moves a held reservation to status (released or
+// committed) and applies the matching stock changes in one transaction
+// conditioned on the reservation still being held. A reservation already
+// in the target status is returned unchanged so retries succeed.
+func settleReservation(ctx context.Context, id, status, reason string) (Reservation, error) {
+	reservation, err := getReservation(ctx, id)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if reservation.Status == status {
+		return reservation, nil
+	}
+	if reservation.Status != ReservationHeld {
+		return Reservation{}, problem.New(http.StatusConflict, fmt.Sprintf("reservation is already %s", reservation.Status))
+	}
+
+	now := clk.Now()
+	movementType := MovementRelease
+	stockUpdate := "SET reserved = reserved - :quantity, available = available + :quantity, updated_at = :now"
+	statusUpdate := "SET #status = :status, released_at = :now"
+	onHandSign := 0
+	if status == ReservationCommitted {
+		movementType = MovementCommit
+		stockUpdate = "SET reserved = reserved - :quantity, on_hand = on_hand - :quantity, updated_at = :now"
+		statusUpdate = "SET #status = :status, committed_at = :now"
+		onHandSign = -1
+	}
+	values := map[string]types.AttributeValue{
+		":status": &types.AttributeValueMemberS{Value: status},
+		":held":   &types.AttributeValueMemberS{Value: ReservationHeld},
+		":now":    timestamp(now),
+	}
+	if reason != "" {
+		statusUpdate += ", reason = :reason"
+		values[":reason"] = &types.AttributeValueMemberS{Value: reason}
+	}
+
+	items := []types.TransactWriteItem{{Update: &types.Update{
+		TableName: aws.String(reservationsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:          aws.String(statusUpdate),
+		ConditionExpression:       aws.String("#status = :held"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	}}}
+	for _, line := range reservation.Items {
+		items = append(items, types.TransactWriteItem{Update: &types.Update{
+			TableName:           aws.String(stockTable),
+			Key:                 stockKey(line.SKU),
+			UpdateExpression:    aws.String(stockUpdate),
+			ConditionExpression: aws.String("reserved >= :quantity"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":quantity": number(line.Quantity),
+				":now":      timestamp(now),
+			},
+		}})
+		movement, err := movementPut(Movement{
+			SKU:            line.SKU,
+			Type:           movementType,
+			Quantity:       line.Quantity,
+			OnHandChange:   onHandSign * line.Quantity,
+			ReservedChange: -line.Quantity,
+			ReservationID:  reservation.ID,
+			OrderID:        reservation.OrderID,
+			Reason:         reason,
+			CreatedAt:      now,
+		})
+		if err != nil {
+			return Reservation{}, err
+		}
+		items = append(items, movement)
+	}
+
+	_, err = dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) && conditionFailed(canceled, 0) {
+		// Settled concurrently; report what won.
+		current, err := getReservation(ctx, id)
+		if err != nil {
+			return Reservation{}, err
+		}
+		if current.Status == status {
+			return current, nil
+		}
+		return Reservation{}, problem.New(http.StatusConflict, fmt.Sprintf("reservation is already %s", current.Status))
+	}
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to settle reservation: %w", err)
+	}
+
+	reservation.Status = status
+	reservation.Reason = reason
+	if status == ReservationCommitted {
+		reservation.CommittedAt = &now
+	} else {
+		reservation.ReleasedAt = &now
+	}
+	return reservation, nil
+}
+
+// consolidateLines merges repeated SKUs: a transaction may touch each
+// stock item only once.
+func consolidateLines(lines []ReservationLine) []ReservationLine {
+	var out []ReservationLine
+	index := make(map[string]int, len(lines))
+	for _, line := range lines {
+		if i, ok := index[line.SKU]; ok {
+			out[i].Quantity += line.Quantity
+			continue
+		}
+		index[line.SKU] = len(out)
+		out = append(out, line)
+	}
+	return out
+}
+
+func getReservation(ctx context.Context, id string) (Reservation, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(reservationsTable),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to get reservation: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return Reservation{}, errReservationNotFound
+	}
+
+	var reservation Reservation
+	if err := attributevalue.UnmarshalMap(result.Item, &reservation); err != nil {
+		return Reservation{}, fmt.Errorf("failed to unmarshal reservation: %w", err)
+	}
+	return reservation, nil
+}
+
+// reservationsForOrder reads an order's reservations through the order
+// index. The index is only eventually consistent, so each reservation is
+// read again from the table.
+func reservationsForOrder(ctx context.Context, orderID string) ([]Reservation, error) {
+	result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(reservationsTable),
+		IndexName:              aws.String("order_id-index"),
+		KeyConditionExpression: aws.String("order_id = :order"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":order": &types.AttributeValueMemberS{Value: orderID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reservations by order: %w", err)
+	}
+
+	reservations := make([]Reservation, 0, len(result.Items))
+	for _, item := range result.Items {
+		var key struct {
+			ID string `dynamodbav:"id"`
+		}
+		if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal reservation key: %w", err)
+		}
+		reservation, err := getReservation(ctx, key.ID)
+		if errors.Is(err, errReservationNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+	sort.Slice(reservations, func(i, j int) bool { return reservations[i].CreatedAt.Before(reservations[j].CreatedAt) })
+	return reservations, nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// Stock movement types. Every change to a stock level is written in the
+// same transaction as one of these, so the movements for a SKU replay
+// exactly to its current level.
+const (
+	MovementReserve = "RESERVE"
+	MovementRelease = "RELEASE"
+	MovementCommit  = "COMMIT"
+	MovementAdjust  = "ADJUST"
+)
+
+const (
+	defaultMovementsLimit = 50
+	maxMovementsLimit     = 200
+)
+
+// typeInsufficientStock is the problem type for reservations and
+// adjustments that would take available stock below zero.
+const typeInsufficientStock = "/problems/insufficient-stock"
+
+// StockLevel is a SKU's stock. Available is kept as its own attribute
+// (always OnHand - Reserved) because condition expressions cannot do
+// arithmetic, and "available >= :quantity" is what prevents overselling.
+type StockLevel struct {
+	SKU       string    `json:"sku" dynamodbav:"sku"`
+	OnHand    int       `json:"on_hand" dynamodbav:"on_hand"`
+	Reserved  int       `json:"reserved" dynamodbav:"reserved"`
+	Available int       `json:"available" dynamodbav:"available"`
+	UpdatedAt time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// Movement is one entry in a SKU's audit trail. IDs are time-ordered, so
+// the trail sorts chronologically by its range key.
+type Movement struct {
+	SKU            string    `json:"sku" dynamodbav:"sku"`
+	ID             string    `json:"id" dynamodbav:"id"`
+	Type           string    `json:"type" dynamodbav:"type"`
+	Quantity       int       `json:"quantity" dynamodbav:"quantity"`
+	OnHandChange   int       `json:"on_hand_change" dynamodbav:"on_hand_change"`
+	ReservedChange int       `json:"reserved_change" dynamodbav:"reserved_change"`
+	ReservationID  string    `json:"reservation_id,omitempty" dynamodbav:"reservation_id,omitempty"`
+	OrderID        string    `json:"order_id,omitempty" dynamodbav:"order_id,omitempty"`
+	Reason         string    `json:"reason,omitempty" dynamodbav:"reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+// AdjustStockRequest changes on-hand stock: positive for receipts and
+// returns to stock, negative for shrinkage and write-offs.
+type AdjustStockRequest struct {
+	Quantity int    `json:"quantity" validate:"required,min=-100000,max=100000"`
+	Reason   string `json:"reason" validate:"required,max=200"`
+}
+
+// skuParam validates the {sku} path parameter with the same rule as bodies.
+type skuParam struct {
+	SKU string `json:"sku" validate:"sku"`
+}
+
+var (
+	errStockNotFound       = errors.New("stock level not found")
+	errReservationNotFound = errors.New("reservation not found")
+)
+
+func getStockHandler(w http.ResponseWriter, r *http.Request) {
+	sku, ok := skuFromPath(w, r)
+	if !ok {
+		return
+	}
+	stock, err := getStock(r.Context(), sku)
+	if err != nil {
+		writeInventoryError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stock)
+}
+
+// adjustStockHandler applies a manual adjustment. Stock that is reserved
+// cannot be adjusted away: a negative adjustment is limited to what is
+// available.
+func adjustStockHandler(w http.ResponseWriter, r *http.Request) {
+	sku, ok := skuFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdjustStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	now := clk.Now()
+	update := &types.Update{
+		TableName: aws.String(stockTable),
+		Key:       stockKey(sku),
+		UpdateExpression: aws.String("SET on_hand = if_not_exists(on_hand, :zero) + :delta, " +
+			"available = if_not_exists(available, :zero) + :delta, " +
+			"reserved = if_not_exists(reserved, :zero), updated_at = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":delta": number(req.Quantity),
+			":zero":  number(0),
+			":now":   timestamp(now),
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	if req.Quantity < 0 {
+		update.ConditionExpression = aws.String("available >= :needed")
+		update.ExpressionAttributeValues[":needed"] = number(-req.Quantity)
+	}
+
+	movement, err := movementPut(Movement{
+		SKU:          sku,
+		Type:         MovementAdjust,
+		Quantity:     req.Quantity,
+		OnHandChange: req.Quantity,
+		Reason:       req.Reason,
+		CreatedAt:    now,
+	})
+	if err != nil {
+		writeInventoryError(w, r, err)
+		return
+	}
+
+	_, err = dynamoClient.TransactWriteItems(r.Context(), &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{{Update: update}, movement},
+	})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) && conditionFailed(canceled, 0) {
+		available := availableIn(canceled.CancellationReasons[0].Item)
+		problem.Write(w, r, insufficientStock([]validate.FieldError{{
+			Field:   "quantity",
+			Rule:    "stock",
+			Message: fmt.Sprintf("only %d available to remove", available),
+		}}))
+		return
+	}
+	if err != nil {
+		writeInventoryError(w, r, fmt.Errorf("failed to adjust stock: %w", err))
+		return
+	}
+
+	stock, err := getStock(r.Context(), sku)
+	if err != nil {
+		writeInventoryError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stock)
+}
+
+// listMovementsHandler returns a SKU's audit trail, newest first.
+func listMovementsHandler(w http.ResponseWriter, r *http.Request) {
+	sku, ok := skuFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultMovementsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxMovementsLimit {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxMovementsLimit)))
+			return
+		}
+		limit = n
+	}
+
+	result, err := dynamoClient.Query(r.Context(), &dynamodb.QueryInput{
+		TableName:              aws.String(movementsTable),
+		KeyConditionExpression: aws.String("sku = :sku"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sku": &types.AttributeValueMemberS{Value: sku},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		writeInventoryError(w, r, fmt.Errorf("failed to query movements: %w", err))
+		return
+	}
+
+	movements := []Movement{}
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &movements); err != nil {
+		writeInventoryError(w, r, fmt.Errorf("failed to unmarshal movements: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sku": sku, "movements": movements})
+}
+
+func skuFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	sku := mux.Vars(r)["sku"]
+	if err := validate.Struct(skuParam{SKU: sku}); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "sku must be 3-32 uppercase letters, digits or dashes"))
+		return "", false
+	}
+	return sku, true
+}
+
+func insufficientStock(errs []validate.FieldError) problem.Problem {
+	return problem.Problem{
+		Type:   typeInsufficientStock,
+		Title:  "Insufficient stock",
+		Status: http.StatusConflict,
+		Detail: "Not enough stock is available for the request",
+		Errors: errs,
+	}
+}
+
+func writeInventoryError(w http.ResponseWriter, r *http.Request, err error) {
+	var p problem.Problem
+	switch {
+	case errors.As(err, &p):
+		problem.Write(w, r, p)
+	case errors.Is(err, errStockNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "SKU has no stock record"))
+	case errors.Is(err, errReservationNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Reservation not found"))
+	default:
+		log.Printf("Inventory operation failed: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+	}
+}
+
+// DynamoDB operations
+
+func getStock(ctx context.Context, sku string) (StockLevel, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(stockTable),
+		ConsistentRead: aws.Bool(true),
+		Key:            stockKey(sku),
+	})
+	if err != nil {
+		return StockLevel{}, fmt.Errorf("failed to get stock: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return StockLevel{}, errStockNotFound
+	}
+
+	var stock StockLevel
+	if err := attributevalue.UnmarshalMap(result.Item, &stock); err != nil {
+		return StockLevel{}, fmt.Errorf("failed to unmarshal stock: %w", err)
+	}
+	return stock, nil
+}
+
+// movementPut returns the transaction item recording m under a new ID.
+func movementPut(m Movement) (types.TransactWriteItem, error) {
+	m.ID = idGen.NewID()
+	item, err := attributevalue.MarshalMap(m)
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("failed to marshal movement: %w", err)
+	}
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName: aws.String(movementsTable),
+			Item:      item,
+		},
+	}, nil
+}
+
+// conditionFailed reports whether the i-th item of a canceled transaction
+// failed its condition.
+func conditionFailed(canceled *types.TransactionCanceledException, i int) bool {
+	return i < len(canceled.CancellationReasons) &&
+		aws.ToString(canceled.CancellationReasons[i].Code) == "ConditionalCheckFailed"
+}
+
+// availableIn reads the available attribute from a cancellation's old
+// item; a SKU with no stock record has none.
+func availableIn(item map[string]types.AttributeValue) int {
+	var stock StockLevel
+	if err := attributevalue.UnmarshalMap(item, &stock); err != nil {
+		return 0
+	}
+	return stock.Available
+}
+
+func stockKey(sku string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"sku": &types.AttributeValueMemberS{Value: sku},
+	}
+}
+
+func number(n int) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.Itoa(n)}
+}
+
+func timestamp(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: t.UTC().Format(time.RFC3339Nano)}
+}
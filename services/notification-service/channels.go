@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	schedules "pkg/notify"
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// Channels. A notification goes out on one channel: email, SMS or
+// WhatsApp. Users choose, per kind or for every kind, the channels they
+// want in order of preference, and each notification takes the first of
+// them it can use: email needs an address that is not suppressed, SMS and
+// WhatsApp a phone number. Users who never chose get email.
+//
+// Users may also give a schedule (pkg/notify's: quiet hours and delivery
+// windows in their timezone). SMS and WhatsApp messages it does not allow
+// are deferred until it does; emails, and password resets the user just
+// asked for, are not.
+
+// Notification channels.
+const (
+	ChannelEmail    = "email"
+	ChannelSMS      = "sms"
+	ChannelWhatsApp = "whatsapp"
+)
+
+var channels = map[string]bool{ChannelEmail: true, ChannelSMS: true, ChannelWhatsApp: true}
+
+// kinds are the notification kinds preferences may name.
+var kinds = map[string]bool{KindWelcome: true, KindOrderConfirmed: true, KindOrderShipped: true, KindPasswordReset: true}
+
+// phonePattern matches E.164 numbers, as SMS and WhatsApp take them.
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// ChannelPreferences are how a user wants to be notified.
+type ChannelPreferences struct {
+	UserID      string              `json:"user_id" dynamodbav:"user_id"`
+	PhoneNumber string              `json:"phone_number,omitempty" dynamodbav:"phone_number,omitempty"`
+	Channels    []string            `json:"channels" dynamodbav:"channels"`
+	Kinds       map[string][]string `json:"kinds,omitempty" dynamodbav:"kinds,omitempty"`
+	Schedule    *schedules.Schedule `json:"schedule,omitempty" dynamodbav:"schedule,omitempty"`
+	UpdatedAt   time.Time           `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+type PutChannelPreferencesRequest struct {
+	PhoneNumber string              `json:"phone_number"`
+	Channels    []string            `json:"channels" validate:"required,min=1,max=3"`
+	Kinds       map[string][]string `json:"kinds"`
+	Schedule    *schedules.Schedule `json:"schedule"`
+}
+
+// defaultPreferences are those of users who never chose.
+func defaultPreferences(userID string) ChannelPreferences {
+	return ChannelPreferences{UserID: userID, Channels: []string{ChannelEmail}}
+}
+
+// channelsFor lists the channels to try for kind, in order.
+func (p ChannelPreferences) channelsFor(kind string) []string {
+	if list, ok := p.Kinds[kind]; ok && len(list) > 0 {
+		return list
+	}
+	if len(p.Channels) > 0 {
+		return p.Channels
+	}
+	return []string{ChannelEmail}
+}
+
+// sendAfter returns when a message to the user arriving at now may be
+// sent, and whether that is later than now.
+func (p ChannelPreferences) sendAfter(now time.Time) (time.Time, bool) {
+	if p.Schedule == nil {
+		return now, false
+	}
+	return p.Schedule.NextDelivery(now)
+}
+
+// deferrable reports whether a notification of kind on channel waits for
+// the user's schedule.
+func deferrable(kind, channel string) bool {
+	return channel != ChannelEmail && kind != KindPasswordReset
+}
+
+// resolveChannel picks the channel for a notification of kind to user:
+// the first of their preferred channels that can reach them. suppressed
+// reports whether email was passed over because the address is
+// suppressed; with no channel left the notification is not sent.
+func resolveChannel(ctx context.Context, kind string, prefs ChannelPreferences, user recipient) (channel string, suppressed bool, err error) {
+	for _, channel := range prefs.channelsFor(kind) {
+		switch channel {
+		case ChannelEmail:
+			if user.Email == "" {
+				continue
+			}
+			blocked, err := isSuppressed(ctx, normalizeEmail(user.Email))
+			if err != nil {
+				return "", false, err
+			}
+			if blocked {
+				suppressed = true
+				continue
+			}
+			return channel, suppressed, nil
+		case ChannelSMS, ChannelWhatsApp:
+			if prefs.PhoneNumber != "" {
+				return channel, suppressed, nil
+			}
+		}
+	}
+	return "", suppressed, nil
+}
+
+func loadPreferences(ctx context.Context, userID string) (ChannelPreferences, error) {
+	prefs, err := dynamo.Get[ChannelPreferences](ctx, channelPreferences, preferencesKey(userID))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return defaultPreferences(userID), nil
+	}
+	if err != nil {
+		return ChannelPreferences{}, fmt.Errorf("failed to get channel preferences of user %s: %w", userID, err)
+	}
+	return prefs, nil
+}
+
+// Handlers
+
+func getPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := preferencesUser(w, r)
+	if !ok {
+		return
+	}
+	prefs, err := loadPreferences(r.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to get channel preferences: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// putPreferencesHandler replaces the user's channel preferences.
+func putPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := preferencesUser(w, r)
+	if !ok {
+		return
+	}
+	var req PutChannelPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+	if errs := validatePreferences(req); len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+
+	prefs := ChannelPreferences{
+		UserID:      userID,
+		PhoneNumber: req.PhoneNumber,
+		Channels:    req.Channels,
+		Kinds:       req.Kinds,
+		Schedule:    req.Schedule,
+		UpdatedAt:   clk.Now().UTC(),
+	}
+	if err := channelPreferences.Put(r.Context(), prefs); err != nil {
+		log.Printf("Failed to save channel preferences of user %s: %v", userID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// validatePreferences checks what validate.Struct cannot, one error per
+// problem.
+func validatePreferences(req PutChannelPreferencesRequest) validate.Errors {
+	var errs validate.Errors
+	needsPhone := false
+	checkChannels := func(field string, list []string) {
+		seen := map[string]bool{}
+		for i, channel := range list {
+			if !channels[channel] || seen[channel] {
+				errs = append(errs, validate.FieldError{
+					Field:   fmt.Sprintf("%s[%d]", field, i),
+					Rule:    "channel",
+					Message: "must be one of email, sms, whatsapp, each listed once",
+				})
+			}
+			seen[channel] = true
+			needsPhone = needsPhone || channel == ChannelSMS || channel == ChannelWhatsApp
+		}
+	}
+	checkChannels("channels", req.Channels)
+	for kind, list := range req.Kinds {
+		if !kinds[kind] {
+			errs = append(errs, validate.FieldError{Field: "kinds." + kind, Rule: "kind", Message: "is not a notification kind"})
+			continue
+		}
+		checkChannels("kinds."+kind, list)
+	}
+
+	if req.PhoneNumber != "" && !phonePattern.MatchString(req.PhoneNumber) {
+		errs = append(errs, validate.FieldError{Field: "phone_number", Rule: "e164", Message: "must be an E.164 number such as +33612345678"})
+	} else if req.PhoneNumber == "" && needsPhone {
+		errs = append(errs, validate.FieldError{Field: "phone_number", Rule: "required", Message: "is required for sms and whatsapp"})
+	}
+	if req.Schedule != nil {
+		if err := req.Schedule.Validate(); err != nil {
+			errs = append(errs, validate.FieldError{Field: "schedule", Rule: "schedule", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// preferencesUser returns the user in the path, answering 401 or 403
+// unless the caller is that user or has the notifications scope.
+func preferencesUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := mux.Vars(r)["id"]
+	if caller := r.Header.Get("X-User-Id"); caller != "" && caller == userID {
+		return userID, true
+	}
+	if !requireScope(w, r) {
+		return "", false
+	}
+	return userID, true
+}
+
+// DynamoDB operations
+
+func preferencesKey(userID string) dynamo.Key {
+	return dynamo.StringKey("user_id", userID)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"pkg/events"
+	"pkg/problem"
+	"pkg/tenant"
+)
+
+// Event intake. One queue receives the EventBridge events that warrant a
+// notification; each becomes at most one, whose ID is derived from the
+// event's so a redelivered event is recognised and not sent twice. The
+// event of a deferred notification stays on the queue, invisible until the
+// notification may be sent.
+
+// Notification kinds, one template per kind, channel and locale.
+const (
+	KindWelcome        = "welcome"
+	KindOrderConfirmed = "order-confirmed"
+	KindOrderShipped   = "order-shipped"
+	KindPasswordReset  = "password-reset"
+)
+
+const (
+	// receiveBackoff is the pause after a failed receive.
+	receiveBackoff = 5 * time.Second
+	// maxVisibilityDelay stays under SQS's 12-hour visibility limit; an
+	// event deferred for longer is deferred again when it reappears.
+	maxVisibilityDelay = 11 * time.Hour
+)
+
+// eventKinds maps the source and detail type of each event that sends a
+// notification to its kind. Templates read the detail: order
+// events carry order_id (and total, currency, carrier or tracking_url
+// where they apply) and Password Reset Requested carries reset_url and
+// expires_at.
+var eventKinds = map[string]map[string]string{
+	"ecommerce.user-service": {
+		"User Registered":          KindWelcome,
+		"Password Reset Requested": KindPasswordReset,
+	},
+	"ecommerce.order-service": {
+		"Order Confirmed": KindOrderConfirmed,
+		"Order Shipped":   KindOrderShipped,
+	},
+}
+
+// busEvent is an EventBridge event as delivered to the queue.
+type busEvent struct {
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Time       time.Time       `json:"time"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// eventRecipient is the part of every detail naming who is notified. The
+// tenant defaults to the default tenant and the locale to defaultLocale;
+// the rest of the detail is passed to the template as it is.
+type eventRecipient struct {
+	UserID   string `json:"user_id"`
+	TenantID string `json:"tenant_id"`
+	Locale   string `json:"locale"`
+}
+
+// runEventConsumer long-polls the events queue until ctx is done. Messages
+// are deleted once handled and hidden until their time when deferred;
+// failures are left for the queue to redeliver and, after repeated
+// failures, move to its dead-letter queue.
+func runEventConsumer(ctx context.Context) {
+	log.Printf("Consuming notification events from %s", eventsQueueURL)
+	for ctx.Err() == nil {
+		recoverer.Do("notification event poll", func() {
+			if err := pollEvents(ctx); err != nil {
+				log.Printf("Failed to receive notification events: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(receiveBackoff):
+				}
+			}
+		})
+	}
+}
+
+func pollEvents(ctx context.Context) error {
+	result, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(eventsQueueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range result.Messages {
+		deferFor, err := handleEventMessage(ctx, aws.ToString(message.Body))
+		if err != nil {
+			log.Printf("Failed to notify for event %s, leaving it for redelivery: %v", aws.ToString(message.MessageId), err)
+			continue
+		}
+		if deferFor > 0 {
+			if deferFor > maxVisibilityDelay {
+				deferFor = maxVisibilityDelay
+			}
+			_, err := sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(eventsQueueURL),
+				ReceiptHandle:     message.ReceiptHandle,
+				VisibilityTimeout: int32((deferFor + time.Second - 1) / time.Second),
+			})
+			if err != nil {
+				log.Printf("Failed to hold back event %s: %v", aws.ToString(message.MessageId), err)
+			}
+			continue
+		}
+		_, err = sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(eventsQueueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+		if err != nil {
+			log.Printf("Failed to delete event %s: %v", aws.ToString(message.MessageId), err)
+		}
+	}
+	return nil
+}
+
+// handleEventMessage sends the notification one queued event calls for,
+// returning how long to hold the event back if it is deferred. Only errors
+// worth retrying are returned; malformed events and events that send
+// nothing are logged and dropped.
+func handleEventMessage(ctx context.Context, body string) (time.Duration, error) {
+	var event busEvent
+	if err := json.Unmarshal([]byte(body), &event); err != nil || event.ID == "" {
+		log.Printf("Dropping message that is not an EventBridge event")
+		return 0, nil
+	}
+	kind, ok := eventKinds[event.Source][event.DetailType]
+	if !ok {
+		log.Printf("Ignoring event %s: %q from %q sends no notification", event.ID, event.DetailType, event.Source)
+		return 0, nil
+	}
+
+	if _, err := events.Check(event.DetailType, event.Detail); err != nil {
+		log.Printf("Dropping event %s: %v", event.ID, err)
+		return 0, nil
+	}
+
+	var recipient eventRecipient
+	if err := json.Unmarshal(event.Detail, &recipient); err != nil || recipient.UserID == "" {
+		log.Printf("Dropping %s event %s without a user", event.DetailType, event.ID)
+		return 0, nil
+	}
+	if recipient.TenantID != "" {
+		if !tenant.Valid(recipient.TenantID) {
+			log.Printf("Dropping %s event %s with invalid tenant %q", event.DetailType, event.ID, recipient.TenantID)
+			return 0, nil
+		}
+		ctx = tenant.WithID(ctx, recipient.TenantID)
+	}
+
+	return notify(ctx, notifyRequest{
+		EventID: event.ID,
+		Kind:    kind,
+		UserID:  recipient.UserID,
+		Locale:  recipient.Locale,
+		Detail:  event.Detail,
+	})
+}
+
+// testEventHandler handles a posted EventBridge event; registered only in
+// test mode, where there is no queue. A deferred notification answers 202
+// with when to post the event again.
+func testEventHandler(w http.ResponseWriter, r *http.Request) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be an EventBridge event"))
+		return
+	}
+	deferFor, err := handleEventMessage(r.Context(), string(raw))
+	if err != nil {
+		log.Printf("Failed to handle test event: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	if deferFor > 0 {
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"retry_at": clk.Now().Add(deferFor).UTC()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
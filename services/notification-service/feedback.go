@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"pkg/problem"
+)
+
+// SES feedback. The configuration set publishes delivery, bounce,
+// complaint, reject and rendering failure events to an SNS topic feeding
+// the feedback queue. Each moves the notification named by its
+// notification_id tag along; a permanent bounce or a complaint also puts
+// the recipient on the suppression list, so they are not emailed again.
+
+// sesEvent is the part of an SES event publishing record this service
+// reads.
+type sesEvent struct {
+	EventType string `json:"eventType"`
+	Mail      struct {
+		MessageID string              `json:"messageId"`
+		Tags      map[string][]string `json:"tags"`
+	} `json:"mail"`
+	Bounce *struct {
+		BounceType        string `json:"bounceType"`
+		BounceSubType     string `json:"bounceSubType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint *struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+	Reject *struct {
+		Reason string `json:"reason"`
+	} `json:"reject"`
+	Failure *struct {
+		ErrorMessage string `json:"errorMessage"`
+	} `json:"failure"`
+}
+
+// runFeedbackConsumer long-polls the feedback queue until ctx is done, in
+// the same way as runEventConsumer.
+func runFeedbackConsumer(ctx context.Context) {
+	log.Printf("Consuming SES feedback from %s", feedbackQueueURL)
+	for ctx.Err() == nil {
+		recoverer.Do("SES feedback poll", func() {
+			if err := pollFeedback(ctx); err != nil {
+				log.Printf("Failed to receive SES feedback: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(receiveBackoff):
+				}
+			}
+		})
+	}
+}
+
+func pollFeedback(ctx context.Context) error {
+	result, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(feedbackQueueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range result.Messages {
+		if err := handleFeedback(ctx, aws.ToString(message.Body)); err != nil {
+			log.Printf("Failed to apply SES feedback %s, leaving it for redelivery: %v", aws.ToString(message.MessageId), err)
+			continue
+		}
+		_, err := sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(feedbackQueueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+		if err != nil {
+			log.Printf("Failed to delete SES feedback %s: %v", aws.ToString(message.MessageId), err)
+		}
+	}
+	return nil
+}
+
+// handleFeedback applies one SES event. Only errors worth retrying are
+// returned; events this service has no use for are dropped.
+func handleFeedback(ctx context.Context, body string) error {
+	var event sesEvent
+	if err := json.Unmarshal([]byte(body), &event); err != nil || event.EventType == "" {
+		log.Printf("Dropping message that is not an SES event")
+		return nil
+	}
+	var id string
+	if tag := event.Mail.Tags["notification_id"]; len(tag) > 0 {
+		id = tag[0]
+	}
+	if id == "" {
+		// Sent by something else using the configuration set.
+		return nil
+	}
+	messageID := event.Mail.MessageID
+
+	switch event.EventType {
+	case "Delivery":
+		return markNotification(ctx, id, StatusDelivered, messageID, "", StatusPending, StatusSent)
+
+	case "Bounce":
+		if event.Bounce == nil {
+			return nil
+		}
+		detail := event.Bounce.BounceType + "/" + event.Bounce.BounceSubType
+		for _, r := range event.Bounce.BouncedRecipients {
+			if r.DiagnosticCode != "" {
+				detail += ": " + r.DiagnosticCode
+				break
+			}
+		}
+		// Transient bounces (a full mailbox, say) do not suppress.
+		if event.Bounce.BounceType == "Permanent" {
+			for _, r := range event.Bounce.BouncedRecipients {
+				if err := suppress(ctx, r.EmailAddress, ReasonBounce, id, detail); err != nil {
+					return err
+				}
+			}
+		}
+		return markNotification(ctx, id, StatusBounced, messageID, detail)
+
+	case "Complaint":
+		if event.Complaint == nil {
+			return nil
+		}
+		for _, r := range event.Complaint.ComplainedRecipients {
+			if err := suppress(ctx, r.EmailAddress, ReasonComplaint, id, event.Complaint.ComplaintFeedbackType); err != nil {
+				return err
+			}
+		}
+		return markNotification(ctx, id, StatusComplained, messageID, event.Complaint.ComplaintFeedbackType)
+
+	case "Reject":
+		var reason string
+		if event.Reject != nil {
+			reason = event.Reject.Reason
+		}
+		return markNotification(ctx, id, StatusRejected, messageID, reason)
+
+	case "Rendering Failure":
+		var reason string
+		if event.Failure != nil {
+			reason = event.Failure.ErrorMessage
+		}
+		return markNotification(ctx, id, StatusFailed, messageID, reason)
+	}
+	return nil
+}
+
+// testFeedbackHandler applies a posted SES event; registered only in test
+// mode, where there is no queue.
+func testFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be an SES event"))
+		return
+	}
+	if err := handleFeedback(r.Context(), string(raw)); err != nil {
+		log.Printf("Failed to apply test feedback: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/pinpointsmsvoicev2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/health"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/metrics"
+	"pkg/recovery"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient     *dynamodb.Client
+	sqsClient        *sqs.Client
+	mailer           emailSender
+	texter           smsSender
+	whatsApp         whatsAppSender
+	notifications    *dynamo.Table
+	suppressions     *dynamo.Table
+	users            *dynamo.Table
+	eventsQueueURL   string
+	feedbackQueueURL string
+	receiptsQueueURL string
+	serverPort       string
+	version          = "1.0.0"
+
+	// channelPreferences holds each user's channels and schedule.
+	channelPreferences *dynamo.Table
+	// allNotifications is the notifications table across tenants, for
+	// finding notifications by message ID from receipts, which carry no
+	// tenant.
+	allNotifications *dynamo.Table
+
+	// fromAddress is the verified SES identity emails are sent from.
+	fromAddress string
+	// configurationSet routes send, delivery, bounce and complaint events
+	// to the feedback queue.
+	configurationSet string
+	// templatePrefix names the SES templates: <prefix>-<kind>-<locale>.
+	templatePrefix string
+	// locales are the locales templates exist for; defaultLocale is used
+	// for any other.
+	locales       map[string]bool
+	defaultLocale string
+
+	// smsOriginationIdentity is the phone number, sender ID or pool texts
+	// are sent from; smsConfigurationSet routes their delivery receipts
+	// to the receipts queue.
+	smsOriginationIdentity string
+	smsConfigurationSet    string
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	sqsClient = sqs.NewFromConfig(cfg)
+	mailer = sesv2.NewFromConfig(cfg)
+	texter = pinpointsmsvoicev2.NewFromConfig(cfg)
+	whatsApp = newSocialMessagingClient(cfg, os.Getenv("WHATSAPP_PHONE_NUMBER_ID"))
+	eventsQueueURL = os.Getenv("NOTIFICATION_EVENTS_QUEUE_URL")
+	feedbackQueueURL = os.Getenv("SES_FEEDBACK_QUEUE_URL")
+	receiptsQueueURL = os.Getenv("MESSAGE_RECEIPTS_QUEUE_URL")
+	serverPort = getEnv("PORT", "3010")
+	fromAddress = os.Getenv("SES_FROM_ADDRESS")
+	configurationSet = os.Getenv("SES_CONFIGURATION_SET")
+	templatePrefix = getEnv("SES_TEMPLATE_PREFIX", "ecommerce-platform")
+	defaultLocale = getEnv("DEFAULT_LOCALE", "en")
+	locales = parseLocales(getEnv("NOTIFICATION_LOCALES", defaultLocale), defaultLocale)
+	smsOriginationIdentity = os.Getenv("SMS_ORIGINATION_IDENTITY")
+	smsConfigurationSet = os.Getenv("SMS_CONFIGURATION_SET")
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+	recoverer = recovery.New("notification-service", clk, idGen)
+
+	notifications = dynamo.NewTable(dynamoClient, getEnv("NOTIFICATIONS_TABLE_NAME", "notifications"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second), dynamo.WithTenancy("user_id"))
+	suppressions = dynamo.NewTable(dynamoClient, getEnv("EMAIL_SUPPRESSIONS_TABLE_NAME", "email-suppressions"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second))
+	users = dynamo.NewTable(dynamoClient, getEnv("USERS_TABLE_NAME", "users"),
+		dynamo.WithTimeout(5*time.Second), dynamo.WithTenancy("id"))
+	channelPreferences = dynamo.NewTable(dynamoClient, getEnv("NOTIFICATION_PREFERENCES_TABLE_NAME", "notification-preferences"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second), dynamo.WithTenancy("user_id"))
+	allNotifications = dynamo.NewTable(dynamoClient, getEnv("NOTIFICATIONS_TABLE_NAME", "notifications"),
+		dynamo.WithTimeout(5*time.Second))
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware)
+
+	// Request count, error rate and latency per route, scraped from
+	// /metrics
+	registry := metrics.NewRegistry()
+	router.Use(metrics.NewHTTP(registry, "notification-service", routeTemplate, clk).Middleware)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id"))
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("notification-service", clk,
+		health.Table(dynamoClient, notifications.Name, true),
+		health.Table(dynamoClient, suppressions.Name, true),
+		health.Table(dynamoClient, users.Name, false),
+		health.Table(dynamoClient, channelPreferences.Name, false),
+	).Handler()).Methods("GET")
+	router.Handle("/metrics", registry.Handler()).Methods("GET")
+
+	// Test hooks; events, SES feedback and delivery receipts are posted
+	// directly instead of polled, and messages are recorded as sent
+	// without leaving the service
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs, events via /__test/events, nothing sent")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+		router.HandleFunc("/__test/events", testEventHandler).Methods("POST")
+		router.HandleFunc("/__test/feedback", testFeedbackHandler).Methods("POST")
+		router.HandleFunc("/__test/receipts", testReceiptHandler).Methods("POST")
+		mailer = &testMailer{}
+		texter = &testTexter{}
+		whatsApp = &testWhatsApp{}
+	} else {
+		if fromAddress == "" {
+			log.Printf("SES_FROM_ADDRESS not set, every email will fail to send")
+		}
+		if eventsQueueURL != "" {
+			go runEventConsumer(context.Background())
+		} else {
+			log.Printf("NOTIFICATION_EVENTS_QUEUE_URL not set, no notifications will be sent")
+		}
+		if feedbackQueueURL != "" {
+			go runFeedbackConsumer(context.Background())
+		} else {
+			log.Printf("SES_FEEDBACK_QUEUE_URL not set, bounces and complaints will not be tracked")
+		}
+		if receiptsQueueURL != "" {
+			go runReceiptsConsumer(context.Background())
+		} else {
+			log.Printf("MESSAGE_RECEIPTS_QUEUE_URL not set, SMS and WhatsApp deliveries will not be tracked")
+		}
+	}
+
+	// Sent notifications and their status
+	router.HandleFunc("/notifications", listNotificationsHandler).Methods("GET")
+	router.HandleFunc("/notifications/{id}", getNotificationHandler).Methods("GET")
+
+	// Each user's channels and schedule
+	router.HandleFunc("/notification-preferences/{id}", getPreferencesHandler).Methods("GET")
+	router.HandleFunc("/notification-preferences/{id}", putPreferencesHandler).Methods("PUT")
+
+	// Suppression list
+	router.HandleFunc("/suppressions", listSuppressionsHandler).Methods("GET")
+	router.HandleFunc("/suppressions/{email}", getSuppressionHandler).Methods("GET")
+	router.HandleFunc("/suppressions/{email}", putSuppressionHandler).Methods("PUT")
+	router.HandleFunc("/suppressions/{email}", deleteSuppressionHandler).Methods("DELETE")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Notification service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "notification-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// parseLocales reads a comma-separated locale list such as "en,fr,de",
+// which always includes the default.
+func parseLocales(value, defaultLocale string) map[string]bool {
+	set := map[string]bool{defaultLocale: true}
+	for _, locale := range strings.Split(value, ",") {
+		if locale = normalizeLocale(locale); locale != "" {
+			set[locale] = true
+		}
+	}
+	return set
+}
+
+// routeTemplate labels metrics with the matched route rather than the raw
+// path, which would give every notification its own series.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/ids"
+	"pkg/problem"
+	"pkg/tenant"
+)
+
+// Notifications. Every email, text or WhatsApp message sent is recorded
+// before it goes out, then follows the delivery feedback of its channel:
+// sent, delivered, bounced or failed. Each event's message goes out on the
+// channel the user prefers for its kind (see channels.go), rendered from
+// the templates of its kind and locale with the event detail and the
+// recipient's name. A recipient whose address is on the suppression list
+// is not emailed; if no other channel reaches them, the notification is
+// recorded as suppressed. Texts and WhatsApp messages the user's schedule
+// does not allow yet are recorded as deferred, and their event is held
+// back on the queue until it does.
+//
+// Sending is at least once: if the service stops between a channel
+// accepting a message and the notification being marked sent, the
+// redelivered event sends it again.
+
+// Notification statuses.
+const (
+	StatusPending    = "PENDING"
+	StatusDeferred   = "DEFERRED"
+	StatusSent       = "SENT"
+	StatusDelivered  = "DELIVERED"
+	StatusRead       = "READ"
+	StatusBounced    = "BOUNCED"
+	StatusComplained = "COMPLAINED"
+	StatusRejected   = "REJECTED"
+	StatusSuppressed = "SUPPRESSED"
+	StatusFailed     = "FAILED"
+)
+
+const (
+	// notificationRetention is how long notifications are kept; the table
+	// expires older ones through its TTL.
+	notificationRetention = 180 * 24 * time.Hour
+	// notificationsScope is the token scope that allows reading
+	// notifications and managing the suppression list.
+	notificationsScope = "notifications"
+
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+// Notification is one message, sent or withheld.
+type Notification struct {
+	ID          string         `json:"id" dynamodbav:"id"`
+	EventID     string         `json:"event_id" dynamodbav:"event_id"`
+	Kind        string         `json:"kind" dynamodbav:"kind"`
+	UserID      string         `json:"user_id" dynamodbav:"user_id"`
+	TenantID    string         `json:"-" dynamodbav:"tenant_id,omitempty"`
+	Channel     string         `json:"channel" dynamodbav:"channel"`
+	Email       string         `json:"email,omitempty" dynamodbav:"email,omitempty"`
+	PhoneNumber string         `json:"phone_number,omitempty" dynamodbav:"phone_number,omitempty"`
+	Locale      string         `json:"locale" dynamodbav:"locale"`
+	Template    string         `json:"template" dynamodbav:"template"`
+	Status      string         `json:"status" dynamodbav:"status"`
+	MessageID   string         `json:"message_id,omitempty" dynamodbav:"message_id,omitempty"`
+	SendAfter   *time.Time     `json:"send_after,omitempty" dynamodbav:"send_after,omitempty"`
+	Error       string         `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	History     []StatusChange `json:"history" dynamodbav:"history"`
+	CreatedAt   time.Time      `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at" dynamodbav:"updated_at"`
+	ExpiresAt   int64          `json:"-" dynamodbav:"expires_at"`
+}
+
+// StatusChange is one step of a notification's history.
+type StatusChange struct {
+	Status string    `json:"status" dynamodbav:"status"`
+	At     time.Time `json:"at" dynamodbav:"at"`
+	Detail string    `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
+}
+
+// notifyRequest is a notification an event calls for.
+type notifyRequest struct {
+	EventID string
+	Kind    string
+	UserID  string
+	Locale  string
+	Detail  json.RawMessage
+}
+
+// recipient is the part of a user a notification needs.
+type recipient struct {
+	Email     string `dynamodbav:"email"`
+	FirstName string `dynamodbav:"first_name"`
+	LastName  string `dynamodbav:"last_name"`
+	Deleted   bool   `dynamodbav:"deleted"`
+}
+
+// emailSender sends email; the SES client, or testMailer in test mode.
+type emailSender interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+// notify sends the notification req calls for, unless its event was
+// handled already, and returns how long to hold the event back when the
+// notification is deferred. Users who no longer exist are not notified.
+func notify(ctx context.Context, req notifyRequest) (time.Duration, error) {
+	id := ids.Derived("notification", req.EventID)
+	existing, err := dynamo.Get[Notification](ctx, notifications, notificationKey(id))
+	switch {
+	case err == nil && existing.Status != StatusPending && existing.Status != StatusDeferred:
+		log.Printf("Event %s already notified as %s", req.EventID, id)
+		return 0, nil
+	case err != nil && !errors.Is(err, dynamo.ErrNotFound):
+		return 0, fmt.Errorf("failed to get notification %s: %w", id, err)
+	}
+
+	user, err := dynamo.Get[recipient](ctx, users, dynamo.StringKey("id", req.UserID))
+	if errors.Is(err, dynamo.ErrNotFound) || (err == nil && user.Deleted) {
+		log.Printf("Dropping %s notification for event %s: user %s does not exist", req.Kind, req.EventID, req.UserID)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user %s: %w", req.UserID, err)
+	}
+	prefs, err := loadPreferences(ctx, req.UserID)
+	if err != nil {
+		return 0, err
+	}
+	now := clk.Now().UTC()
+
+	// A pending or deferred notification is one whose send may not have
+	// happened; it is kept, channel and history included, and sent again.
+	n := existing
+	if n.ID == "" {
+		channel, suppressed, err := resolveChannel(ctx, req.Kind, prefs, user)
+		if err != nil {
+			return 0, err
+		}
+		if channel == "" && !suppressed {
+			log.Printf("Dropping %s notification for event %s: no channel reaches user %s", req.Kind, req.EventID, req.UserID)
+			return 0, nil
+		}
+		if channel == "" {
+			n = newNotification(ctx, id, req, ChannelEmail, user, prefs, now)
+			n.Status = StatusSuppressed
+			n.History = []StatusChange{{Status: StatusSuppressed, At: now}}
+			if err := notifications.Put(ctx, n, dynamo.IfNotExists("id")); err != nil && !errors.Is(err, dynamo.ErrConditionFailed) {
+				return 0, fmt.Errorf("failed to record notification %s: %w", id, err)
+			}
+			log.Printf("Not sending %s email %s: recipient is suppressed", n.Kind, id)
+			return 0, nil
+		}
+		n = newNotification(ctx, id, req, channel, user, prefs, now)
+		if err := notifications.Put(ctx, n, dynamo.IfNotExists("id")); err != nil {
+			if errors.Is(err, dynamo.ErrConditionFailed) {
+				log.Printf("Event %s is being notified concurrently", req.EventID)
+				return 0, nil
+			}
+			return 0, fmt.Errorf("failed to record notification %s: %w", id, err)
+		}
+	} else if n.Channel == ChannelEmail {
+		suppressed, err := isSuppressed(ctx, n.Email)
+		if err != nil {
+			return 0, err
+		}
+		if suppressed {
+			log.Printf("Not sending %s email %s: recipient is suppressed", n.Kind, id)
+			return 0, markNotification(ctx, id, StatusSuppressed, "", "")
+		}
+	}
+
+	if deferrable(n.Kind, n.Channel) {
+		if until, later := prefs.sendAfter(now); later {
+			if err := deferNotification(ctx, n.ID, until); err != nil {
+				return 0, err
+			}
+			log.Printf("Deferred %s %s %s until %s", n.Kind, n.Channel, n.ID, until.Format(time.RFC3339))
+			return until.Sub(now), nil
+		}
+	}
+
+	data, err := templateData(req.Detail, user)
+	if err != nil {
+		return 0, markNotification(ctx, n.ID, StatusFailed, "", err.Error())
+	}
+	messageID, err := send(ctx, n, data)
+	if err != nil {
+		if permanentSendError(err) {
+			log.Printf("Refused %s %s %s: %v", n.Kind, n.Channel, n.ID, err)
+			return 0, markNotification(ctx, n.ID, StatusFailed, "", err.Error())
+		}
+		return 0, fmt.Errorf("failed to send %s %s %s: %w", n.Kind, n.Channel, n.ID, err)
+	}
+	log.Printf("Sent %s %s %s for event %s", n.Kind, n.Channel, n.ID, req.EventID)
+	return 0, markNotification(ctx, n.ID, StatusSent, messageID, "", StatusPending, StatusDeferred)
+}
+
+// newNotification is the pending notification of req on channel.
+func newNotification(ctx context.Context, id string, req notifyRequest, channel string, user recipient, prefs ChannelPreferences, now time.Time) Notification {
+	locale := pickLocale(req.Locale)
+	n := Notification{
+		ID:        id,
+		EventID:   req.EventID,
+		Kind:      req.Kind,
+		UserID:    req.UserID,
+		TenantID:  tenant.FromContext(ctx),
+		Channel:   channel,
+		Locale:    locale,
+		Status:    StatusPending,
+		History:   []StatusChange{{Status: StatusPending, At: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(notificationRetention).Unix(),
+	}
+	switch channel {
+	case ChannelEmail:
+		n.Email = normalizeEmail(user.Email)
+		n.Template = templateName(req.Kind, locale)
+	case ChannelSMS:
+		n.PhoneNumber = prefs.PhoneNumber
+		n.Template = smsTemplateName(req.Kind, locale)
+	case ChannelWhatsApp:
+		n.PhoneNumber = prefs.PhoneNumber
+		n.Template = whatsAppTemplateName(req.Kind)
+	}
+	return n
+}
+
+// send sends n on its channel and returns the channel's message ID.
+func send(ctx context.Context, n Notification, data string) (string, error) {
+	switch n.Channel {
+	case ChannelSMS:
+		return sendSMS(ctx, n, data)
+	case ChannelWhatsApp:
+		return sendWhatsApp(ctx, n, data)
+	}
+	return sendEmail(ctx, n, data)
+}
+
+// sendEmail sends n with its template and returns the SES message ID.
+func sendEmail(ctx context.Context, n Notification, data string) (string, error) {
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(fromAddress),
+		Destination:      &sestypes.Destination{ToAddresses: []string{n.Email}},
+		Content: &sestypes.EmailContent{
+			Template: &sestypes.Template{
+				TemplateName: aws.String(n.Template),
+				TemplateData: aws.String(data),
+			},
+		},
+		// The tags come back on every feedback event.
+		EmailTags: []sestypes.MessageTag{
+			{Name: aws.String("notification_id"), Value: aws.String(n.ID)},
+			{Name: aws.String("kind"), Value: aws.String(n.Kind)},
+		},
+	}
+	if configurationSet != "" {
+		input.ConfigurationSetName = aws.String(configurationSet)
+	}
+
+	result, err := mailer.SendEmail(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(result.MessageId), nil
+}
+
+// permanentSendError reports whether the channel refused the message
+// itself, so sending it again would fail the same way; a template missing
+// for the kind and locale is one.
+func permanentSendError(err error) bool {
+	if errors.Is(err, errNoTemplate) || permanentSMSError(err) || permanentWhatsAppError(err) {
+		return true
+	}
+	var (
+		badRequest *sestypes.BadRequestException
+		rejected   *sestypes.MessageRejected
+		notFound   *sestypes.NotFoundException
+		unverified *sestypes.MailFromDomainNotVerifiedException
+	)
+	return errors.As(err, &badRequest) || errors.As(err, &rejected) ||
+		errors.As(err, &notFound) || errors.As(err, &unverified)
+}
+
+// markNotification moves a notification to status, adding it to the
+// history. messageID, when set, records the channel's message ID; detail says
+// why, for failures and bounces. Given from, only a notification in one of
+// those statuses moves; any other is left as it is, so late feedback does
+// not undo a bounce.
+func markNotification(ctx context.Context, id, status, messageID, detail string, from ...string) error {
+	now := clk.Now().UTC()
+	change, err := marshalHistory(StatusChange{Status: status, At: now, Detail: detail})
+	if err != nil {
+		return err
+	}
+	expr := "SET #status = :status, updated_at = :now, history = list_append(if_not_exists(history, :empty), :change)"
+	names := map[string]string{"#status": "status"}
+	values := map[string]types.AttributeValue{
+		":status": dynamo.S(status),
+		":now":    dynamo.S(now.Format(time.RFC3339Nano)),
+		":change": change,
+		":empty":  &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+	}
+	if messageID != "" {
+		expr += ", message_id = :message"
+		values[":message"] = dynamo.S(messageID)
+	}
+	if detail != "" && status == StatusFailed {
+		expr += ", #error = :error"
+		names["#error"] = "error"
+		values[":error"] = dynamo.S(detail)
+	}
+
+	condition := "attribute_exists(id)"
+	if len(from) > 0 {
+		var allowed []string
+		for i, s := range from {
+			name := ":from" + strconv.Itoa(i)
+			values[name] = dynamo.S(s)
+			allowed = append(allowed, name)
+		}
+		condition += " AND #status IN (" + strings.Join(allowed, ", ") + ")"
+	}
+
+	err = notifications.Update(ctx, notificationKey(id), dynamo.Update{
+		Expression: expr,
+		Condition:  condition,
+		Names:      names,
+		Values:     values,
+	}, nil)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		// Expired, or no longer in a from status.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark notification %s %s: %w", id, status, err)
+	}
+	return nil
+}
+
+// deferNotification records that a pending or deferred notification
+// waits until the given time.
+func deferNotification(ctx context.Context, id string, until time.Time) error {
+	now := clk.Now().UTC()
+	until = until.UTC()
+	change, err := marshalHistory(StatusChange{Status: StatusDeferred, At: now, Detail: "until " + until.Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+	err = notifications.Update(ctx, notificationKey(id), dynamo.Update{
+		Expression: "SET #status = :status, send_after = :until, updated_at = :now, history = list_append(if_not_exists(history, :empty), :change)",
+		Condition:  "attribute_exists(id) AND #status IN (:pending, :deferred)",
+		Names:      map[string]string{"#status": "status"},
+		Values: map[string]types.AttributeValue{
+			":status":   dynamo.S(StatusDeferred),
+			":until":    dynamo.S(until.Format(time.RFC3339Nano)),
+			":now":      dynamo.S(now.Format(time.RFC3339Nano)),
+			":change":   change,
+			":empty":    &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":pending":  dynamo.S(StatusPending),
+			":deferred": dynamo.S(StatusDeferred),
+		},
+	}, nil)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to defer notification %s: %w", id, err)
+	}
+	return nil
+}
+
+// templateData is the event detail with the recipient's name added,
+// unless the detail has its own.
+func templateData(detail json.RawMessage, user recipient) (string, error) {
+	data := map[string]interface{}{}
+	if len(detail) > 0 {
+		if err := json.Unmarshal(detail, &data); err != nil {
+			return "", fmt.Errorf("event detail is not a JSON object: %w", err)
+		}
+	}
+	for key, value := range map[string]string{"first_name": user.FirstName, "last_name": user.LastName} {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal template data: %w", err)
+	}
+	return string(b), nil
+}
+
+// templateName is the SES template of kind in locale.
+func templateName(kind, locale string) string {
+	return templatePrefix + "-" + kind + "-" + locale
+}
+
+// pickLocale chooses the template locale for a requested one: the locale
+// itself ("fr-ca"), else its language ("fr"), else the default.
+func pickLocale(requested string) string {
+	locale := normalizeLocale(requested)
+	if locales[locale] {
+		return locale
+	}
+	if language, _, ok := strings.Cut(locale, "-"); ok && locales[language] {
+		return language
+	}
+	return defaultLocale
+}
+
+// normalizeLocale lowercases a locale and uses hyphens, as in template
+// names: "fr_CA" is "fr-ca".
+func normalizeLocale(locale string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(locale)), "_", "-")
+}
+
+// testMailer accepts every email without sending it; used in test mode.
+type testMailer struct{}
+
+func (*testMailer) SendEmail(_ context.Context, input *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	log.Printf("TEST_MODE: not sending %s to %v", aws.ToString(input.Content.Template.TemplateName), input.Destination.ToAddresses)
+	return &sesv2.SendEmailOutput{MessageId: aws.String("test-" + idGen.NewID())}, nil
+}
+
+// Handlers
+
+// listNotificationsHandler pages through one user's notifications, newest
+// first: ?user_id= (required), ?limit= (default 25) and ?cursor= from the
+// previous page.
+func listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r) {
+		return
+	}
+	query := r.URL.Query()
+
+	userID := query.Get("user_id")
+	if !ids.Valid(userID) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "user_id is required and must be a user ID"))
+		return
+	}
+	limit := defaultPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize)))
+			return
+		}
+		limit = n
+	}
+
+	q := dynamo.Query{
+		Index:        "user_id-index",
+		KeyCondition: "user_id = :user",
+		Values:       map[string]types.AttributeValue{":user": dynamo.S(tenant.Key(r.Context(), userID))},
+		Limit:        int32(limit),
+		Descending:   true,
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		// The cursor is the last notification listed; the index needs its
+		// creation time to carry on from it.
+		last, err := ownedNotification(r.Context(), cursor)
+		if err != nil || last.UserID != userID {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "cursor is invalid"))
+			return
+		}
+		q.Start = dynamo.Key{
+			"id":         dynamo.S(last.ID),
+			"user_id":    dynamo.S(tenant.Key(r.Context(), userID)),
+			"created_at": dynamo.S(last.CreatedAt.Format(time.RFC3339Nano)),
+		}
+	}
+
+	page, err := dynamo.QueryPage[Notification](r.Context(), notifications, q)
+	if err != nil {
+		log.Printf("Failed to list notifications of user %s: %v", userID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	list := page.Items
+	if list == nil {
+		list = []Notification{}
+	}
+	response := map[string]interface{}{"notifications": list}
+	if len(page.Next) > 0 && len(list) > 0 {
+		response["next_cursor"] = list[len(list)-1].ID
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func getNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r) {
+		return
+	}
+	n, err := ownedNotification(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "Notification not found"))
+			return
+		}
+		log.Printf("Failed to get notification: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+// ownedNotification gets a notification of the request's tenant; another
+// tenant's is not found.
+func ownedNotification(ctx context.Context, id string) (Notification, error) {
+	n, err := dynamo.Get[Notification](ctx, notifications, notificationKey(id))
+	if err == nil && !tenant.Owns(ctx, n.TenantID) {
+		err = dynamo.ErrNotFound
+	}
+	return n, err
+}
+
+// requireScope answers 401 or 403 unless the caller's token has the
+// notifications scope.
+func requireScope(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-User-Id") == "" && r.Header.Get("X-Client-Id") == "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "Notifications are managed by authenticated callers"))
+		return false
+	}
+	for _, scope := range strings.Fields(r.Header.Get("X-Auth-Scope")) {
+		if scope == notificationsScope {
+			return true
+		}
+	}
+	problem.Write(w, r, problem.New(http.StatusForbidden, "The "+notificationsScope+" scope is required to manage notifications"))
+	return false
+}
+
+// DynamoDB operations
+
+func notificationKey(id string) dynamo.Key {
+	return dynamo.StringKey("id", id)
+}
+
+func marshalHistory(change StatusChange) (types.AttributeValue, error) {
+	av, err := attributevalue.Marshal([]StatusChange{change})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal status change: %w", err)
+	}
+	return av, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"pkg/dynamo"
+	"pkg/problem"
+)
+
+// Delivery receipts for texts and WhatsApp messages. The SMS configuration
+// set and End User Messaging Social both publish to an SNS topic feeding
+// the receipts queue. SMS events name their notification in the message
+// context; WhatsApp status updates carry only the message ID, which the
+// notifications table indexes.
+
+// smsEvent is the part of an End User Messaging SMS event this service
+// reads.
+type smsEvent struct {
+	EventType                string            `json:"eventType"`
+	MessageID                string            `json:"messageId"`
+	MessageStatusDescription string            `json:"messageStatusDescription"`
+	Context                  map[string]string `json:"context"`
+}
+
+// whatsAppEvent is an End User Messaging Social event: the WhatsApp
+// webhook entry, as a JSON string.
+type whatsAppEvent struct {
+	WebhookEntry string `json:"whatsAppWebhookEntry"`
+}
+
+// whatsAppEntry is the part of a WhatsApp webhook entry this service
+// reads: the status updates of sent messages.
+type whatsAppEntry struct {
+	Changes []struct {
+		Value struct {
+			Statuses []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+				Errors []struct {
+					Code  int    `json:"code"`
+					Title string `json:"title"`
+				} `json:"errors"`
+			} `json:"statuses"`
+		} `json:"value"`
+	} `json:"changes"`
+}
+
+// runReceiptsConsumer long-polls the receipts queue until ctx is done, in
+// the same way as runEventConsumer.
+func runReceiptsConsumer(ctx context.Context) {
+	log.Printf("Consuming delivery receipts from %s", receiptsQueueURL)
+	for ctx.Err() == nil {
+		recoverer.Do("delivery receipt poll", func() {
+			if err := pollReceipts(ctx); err != nil {
+				log.Printf("Failed to receive delivery receipts: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(receiveBackoff):
+				}
+			}
+		})
+	}
+}
+
+func pollReceipts(ctx context.Context) error {
+	result, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(receiptsQueueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range result.Messages {
+		if err := handleReceipt(ctx, aws.ToString(message.Body)); err != nil {
+			log.Printf("Failed to apply delivery receipt %s, leaving it for redelivery: %v", aws.ToString(message.MessageId), err)
+			continue
+		}
+		_, err := sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(receiptsQueueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+		if err != nil {
+			log.Printf("Failed to delete delivery receipt %s: %v", aws.ToString(message.MessageId), err)
+		}
+	}
+	return nil
+}
+
+// handleReceipt applies one SMS or WhatsApp event. Only errors worth
+// retrying are returned; events this service has no use for are dropped.
+func handleReceipt(ctx context.Context, body string) error {
+	var probe struct {
+		smsEvent
+		whatsAppEvent
+	}
+	if err := json.Unmarshal([]byte(body), &probe); err != nil {
+		log.Printf("Dropping message that is not a delivery receipt")
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(probe.EventType, "TEXT_"):
+		return applySMSReceipt(ctx, probe.smsEvent)
+	case probe.WebhookEntry != "":
+		return applyWhatsAppReceipt(ctx, probe.WebhookEntry)
+	}
+	log.Printf("Dropping message that is not a delivery receipt")
+	return nil
+}
+
+// applySMSReceipt moves the notification along. Events on the way
+// (queued, handed to the carrier) change nothing; any final event other
+// than delivery is a failure.
+func applySMSReceipt(ctx context.Context, event smsEvent) error {
+	id := event.Context["notification_id"]
+	if id == "" {
+		// Sent by something else using the configuration set.
+		return nil
+	}
+	switch event.EventType {
+	case "TEXT_QUEUED", "TEXT_PENDING", "TEXT_SUCCESSFUL":
+		return nil
+	case "TEXT_DELIVERED":
+		return markNotification(ctx, id, StatusDelivered, event.MessageID, "", StatusPending, StatusSent)
+	}
+	detail := event.EventType
+	if event.MessageStatusDescription != "" {
+		detail += ": " + event.MessageStatusDescription
+	}
+	return markNotification(ctx, id, StatusFailed, event.MessageID, detail, StatusPending, StatusSent)
+}
+
+// applyWhatsAppReceipt applies every status update in a webhook entry.
+// WhatsApp reports messages read as well as delivered.
+func applyWhatsAppReceipt(ctx context.Context, raw string) error {
+	var entry whatsAppEntry
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		log.Printf("Dropping WhatsApp event with an unreadable webhook entry")
+		return nil
+	}
+	for _, change := range entry.Changes {
+		for _, status := range change.Value.Statuses {
+			id, err := notificationByMessageID(ctx, status.ID)
+			if errors.Is(err, dynamo.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			switch status.Status {
+			case "delivered":
+				err = markNotification(ctx, id, StatusDelivered, "", "", StatusPending, StatusSent)
+			case "read":
+				err = markNotification(ctx, id, StatusRead, "", "", StatusPending, StatusSent, StatusDelivered)
+			case "failed":
+				detail := "failed"
+				if len(status.Errors) > 0 {
+					detail = fmt.Sprintf("%d: %s", status.Errors[0].Code, status.Errors[0].Title)
+				}
+				err = markNotification(ctx, id, StatusFailed, "", detail, StatusPending, StatusSent)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// notificationByMessageID finds the notification sent as messageID, of
+// whichever tenant: receipts carry none.
+func notificationByMessageID(ctx context.Context, messageID string) (string, error) {
+	if messageID == "" {
+		return "", dynamo.ErrNotFound
+	}
+	page, err := dynamo.QueryPage[Notification](ctx, allNotifications, dynamo.Query{
+		Index:        "message_id-index",
+		KeyCondition: "message_id = :message",
+		Values:       map[string]types.AttributeValue{":message": dynamo.S(messageID)},
+		Limit:        1,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find notification of message %s: %w", messageID, err)
+	}
+	if len(page.Items) == 0 {
+		return "", dynamo.ErrNotFound
+	}
+	return page.Items[0].ID, nil
+}
+
+// testReceiptHandler applies a posted SMS or WhatsApp event; registered
+// only in test mode, where there is no queue.
+func testReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be an SMS or WhatsApp event"))
+		return
+	}
+	if err := handleReceipt(r.Context(), string(raw)); err != nil {
+		log.Printf("Failed to apply test receipt: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
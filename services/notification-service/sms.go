@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pinpointsmsvoicev2"
+	smstypes "github.com/aws/aws-sdk-go-v2/service/pinpointsmsvoicev2/types"
+)
+
+// SMS. Texts go through AWS End User Messaging SMS (the Pinpoint SMS and
+// voice v2 API) as transactional messages. Their bodies are Go templates
+// kept with the service, templates/sms/<locale>/<kind>.txt, given the same
+// data as the email templates. The configuration set publishes delivery
+// receipts to the receipts queue; the notification ID travels in the
+// message context.
+
+//go:embed templates/sms
+var smsTemplates embed.FS
+
+// errNoTemplate is a kind with no template in the chosen locale; sending
+// again would not help.
+var errNoTemplate = errors.New("no template for kind and locale")
+
+// smsSender sends texts; the End User Messaging SMS client, or testTexter
+// in test mode.
+type smsSender interface {
+	SendTextMessage(ctx context.Context, params *pinpointsmsvoicev2.SendTextMessageInput, optFns ...func(*pinpointsmsvoicev2.Options)) (*pinpointsmsvoicev2.SendTextMessageOutput, error)
+}
+
+// sendSMS texts n and returns the message ID.
+func sendSMS(ctx context.Context, n Notification, data string) (string, error) {
+	body, err := renderSMS(n.Template, data)
+	if err != nil {
+		return "", err
+	}
+	input := &pinpointsmsvoicev2.SendTextMessageInput{
+		DestinationPhoneNumber: aws.String(n.PhoneNumber),
+		MessageBody:            aws.String(body),
+		MessageType:            smstypes.MessageTypeTransactional,
+		// The context comes back on every delivery receipt.
+		Context: map[string]string{"notification_id": n.ID, "kind": n.Kind},
+	}
+	if smsOriginationIdentity != "" {
+		input.OriginationIdentity = aws.String(smsOriginationIdentity)
+	}
+	if smsConfigurationSet != "" {
+		input.ConfigurationSetName = aws.String(smsConfigurationSet)
+	}
+
+	result, err := texter.SendTextMessage(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(result.MessageId), nil
+}
+
+// smsTemplateName is the embedded template of kind in locale.
+func smsTemplateName(kind, locale string) string {
+	return "templates/sms/" + locale + "/" + kind + ".txt"
+}
+
+// renderSMS executes the named template with the JSON template data.
+// Missing fields render empty rather than failing the text.
+func renderSMS(name, data string) (string, error) {
+	source, err := smsTemplates.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, errNoTemplate)
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(string(source))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, errNoTemplate)
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return "", fmt.Errorf("failed to read template data: %w", err)
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, values); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return string(bytes.TrimSpace(body.Bytes())), nil
+}
+
+// permanentSMSError reports whether End User Messaging refused the text
+// itself: an invalid number or message, or a missing origination identity
+// or configuration set.
+func permanentSMSError(err error) bool {
+	var (
+		invalid  *smstypes.ValidationException
+		notFound *smstypes.ResourceNotFoundException
+		denied   *smstypes.AccessDeniedException
+	)
+	return errors.As(err, &invalid) || errors.As(err, &notFound) || errors.As(err, &denied)
+}
+
+// testTexter accepts every text without sending it; used in test mode.
+type testTexter struct{}
+
+func (*testTexter) SendTextMessage(_ context.Context, input *pinpointsmsvoicev2.SendTextMessageInput, _ ...func(*pinpointsmsvoicev2.Options)) (*pinpointsmsvoicev2.SendTextMessageOutput, error) {
+	log.Printf("TEST_MODE: not texting %s: %q", input.Context["notification_id"], aws.ToString(input.MessageBody))
+	return &pinpointsmsvoicev2.SendTextMessageOutput{MessageId: aws.String("test-" + idGen.NewID())}, nil
+}
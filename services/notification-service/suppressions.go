@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// The suppression list holds the addresses that are never emailed: those
+// that bounced permanently or complained, added from SES feedback, and
+// those added by hand. It is kept per address rather than per tenant,
+// since a bad address hurts the sending reputation of every tenant alike.
+// Removing an address lets it be emailed again.
+
+// Suppression reasons.
+const (
+	ReasonBounce    = "BOUNCE"
+	ReasonComplaint = "COMPLAINT"
+	ReasonManual    = "MANUAL"
+)
+
+// Suppression is one address that is not emailed.
+type Suppression struct {
+	Email          string    `json:"email" dynamodbav:"email"`
+	Reason         string    `json:"reason" dynamodbav:"reason"`
+	Detail         string    `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
+	NotificationID string    `json:"notification_id,omitempty" dynamodbav:"notification_id,omitempty"`
+	CreatedBy      string    `json:"created_by,omitempty" dynamodbav:"created_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at" dynamodbav:"created_at"`
+}
+
+type PutSuppressionRequest struct {
+	Detail string `json:"detail" validate:"max=500"`
+}
+
+// suppress adds email to the suppression list for reason. An address
+// already on it keeps its first reason.
+func suppress(ctx context.Context, email, reason, notificationID, detail string) error {
+	email = normalizeEmail(email)
+	if email == "" {
+		return nil
+	}
+	err := suppressions.Put(ctx, Suppression{
+		Email:          email,
+		Reason:         reason,
+		Detail:         detail,
+		NotificationID: notificationID,
+		CreatedAt:      clk.Now().UTC(),
+	}, dynamo.IfNotExists("email"))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to suppress %s: %w", email, err)
+	}
+	log.Printf("Suppressed an address after notification %s: %s", notificationID, reason)
+	return nil
+}
+
+func isSuppressed(ctx context.Context, email string) (bool, error) {
+	_, err := dynamo.Get[Suppression](ctx, suppressions, suppressionKey(email))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check the suppression list: %w", err)
+	}
+	return true, nil
+}
+
+// listSuppressionsHandler pages through the list: ?limit= (default 25)
+// and ?cursor= from the previous page. Pages are in no particular order.
+func listSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r) {
+		return
+	}
+	query := r.URL.Query()
+
+	limit := defaultPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize)))
+			return
+		}
+		limit = n
+	}
+	s := dynamo.Scan{Limit: int32(limit)}
+	if cursor := query.Get("cursor"); cursor != "" {
+		s.Start = suppressionKey(cursor)
+	}
+
+	page, err := dynamo.ScanPage[Suppression](r.Context(), suppressions, s)
+	if err != nil {
+		log.Printf("Failed to list suppressions: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	list := page.Items
+	if list == nil {
+		list = []Suppression{}
+	}
+	response := map[string]interface{}{"suppressions": list}
+	if len(page.Next) > 0 && len(list) > 0 {
+		response["next_cursor"] = list[len(list)-1].Email
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func getSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	email, ok := pathEmail(w, r)
+	if !ok {
+		return
+	}
+	suppression, err := dynamo.Get[Suppression](r.Context(), suppressions, suppressionKey(email))
+	if err != nil {
+		writeSuppressionError(w, r, "get", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, suppression)
+}
+
+// putSuppressionHandler adds the address by hand, answering 201, or 200
+// with the existing entry if it is already suppressed.
+func putSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	email, ok := pathEmail(w, r)
+	if !ok {
+		return
+	}
+	var req PutSuppressionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+			return
+		}
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	suppression := Suppression{
+		Email:     email,
+		Reason:    ReasonManual,
+		Detail:    req.Detail,
+		CreatedBy: caller(r),
+		CreatedAt: clk.Now().UTC(),
+	}
+	err := suppressions.Put(r.Context(), suppression, dynamo.IfNotExists("email"))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		existing, err := dynamo.Get[Suppression](r.Context(), suppressions, suppressionKey(email))
+		if err != nil {
+			writeSuppressionError(w, r, "get", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, existing)
+		return
+	}
+	if err != nil {
+		writeSuppressionError(w, r, "add", err)
+		return
+	}
+	log.Printf("%s suppressed an address by hand", suppression.CreatedBy)
+	writeJSON(w, http.StatusCreated, suppression)
+}
+
+func deleteSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	email, ok := pathEmail(w, r)
+	if !ok {
+		return
+	}
+	err := suppressions.Delete(r.Context(), suppressionKey(email), dynamo.IfExists("email"))
+	if err != nil {
+		writeSuppressionError(w, r, "remove", err)
+		return
+	}
+	log.Printf("%s removed an address from the suppression list", caller(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathEmail checks the caller's scope and returns the address in the
+// path, normalized, answering 400 if it is not one.
+func pathEmail(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !requireScope(w, r) {
+		return "", false
+	}
+	email := normalizeEmail(mux.Vars(r)["email"])
+	if !validate.IsEmail(email) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "Path must name a valid email address"))
+		return "", false
+	}
+	return email, true
+}
+
+func writeSuppressionError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	if errors.Is(err, dynamo.ErrNotFound) || errors.Is(err, dynamo.ErrConditionFailed) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Address is not suppressed"))
+		return
+	}
+	log.Printf("Failed to %s suppression: %v", op, err)
+	problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+}
+
+// caller names the user or API client the gateway authenticated.
+func caller(r *http.Request) string {
+	if user := r.Header.Get("X-User-Id"); user != "" {
+		return "user:" + user
+	}
+	return "client:" + r.Header.Get("X-Client-Id")
+}
+
+// normalizeEmail is the form addresses are stored and compared in.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// DynamoDB operations
+
+func suppressionKey(email string) dynamo.Key {
+	return dynamo.StringKey("email", normalizeEmail(email))
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// WhatsApp. Messages go through AWS End User Messaging Social, which
+// relays them to the WhatsApp Business Account linked to it. Outside a
+// conversation the user started, WhatsApp only delivers templates
+// approved by Meta, so each kind is sent as the template of the same name
+// with underscores ("order_shipped"), in the notification's language,
+// with the body parameters whatsAppParameters lists. Status updates come
+// back through the receipts queue, matched by message ID.
+//
+// The Go SDK has no End User Messaging Social client here, so
+// SendWhatsAppMessage is called directly, signed with SigV4.
+
+// metaAPIVersion is the WhatsApp Cloud API version messages are written
+// for.
+const metaAPIVersion = "v20.0"
+
+// whatsAppParameters are the template body parameters of each kind, in
+// order, read from the template data.
+var whatsAppParameters = map[string][]string{
+	KindWelcome:        {"first_name"},
+	KindOrderConfirmed: {"first_name", "order_id", "total", "currency"},
+	KindOrderShipped:   {"first_name", "order_id", "carrier", "tracking_url"},
+	KindPasswordReset:  {"first_name", "reset_url"},
+}
+
+// whatsAppSender sends WhatsApp messages, given as Cloud API message
+// objects, and returns the message ID; the End User Messaging Social
+// client, or testWhatsApp in test mode.
+type whatsAppSender interface {
+	SendWhatsAppMessage(ctx context.Context, message []byte) (string, error)
+}
+
+// whatsAppError is a message End User Messaging Social refused.
+type whatsAppError struct {
+	Status  int
+	Message string
+}
+
+func (e *whatsAppError) Error() string {
+	return fmt.Sprintf("social-messaging answered %d: %s", e.Status, e.Message)
+}
+
+// sendWhatsApp sends n as its template and returns the message ID.
+func sendWhatsApp(ctx context.Context, n Notification, data string) (string, error) {
+	message, err := whatsAppMessage(n, data)
+	if err != nil {
+		return "", err
+	}
+	return whatsApp.SendWhatsAppMessage(ctx, message)
+}
+
+// whatsAppMessage builds the Cloud API template message for n.
+func whatsAppMessage(n Notification, data string) ([]byte, error) {
+	names, ok := whatsAppParameters[n.Kind]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", n.Kind, errNoTemplate)
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return nil, fmt.Errorf("failed to read template data: %w", err)
+	}
+	parameters := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		var text string
+		if value, ok := values[name]; ok && value != nil {
+			text = fmt.Sprint(value)
+		}
+		parameters = append(parameters, map[string]string{"type": "text", "text": text})
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"to":                n.PhoneNumber,
+		"type":              "template",
+		"template": map[string]interface{}{
+			"name":     n.Template,
+			"language": map[string]string{"code": whatsAppLanguage(n.Locale)},
+			"components": []map[string]interface{}{
+				{"type": "body", "parameters": parameters},
+			},
+		},
+	})
+}
+
+// whatsAppTemplateName is the Meta template of kind.
+func whatsAppTemplateName(kind string) string {
+	return strings.ReplaceAll(kind, "-", "_")
+}
+
+// whatsAppLanguage is locale as Meta names template languages: "fr-ca"
+// is "fr_CA".
+func whatsAppLanguage(locale string) string {
+	language, region, ok := strings.Cut(locale, "-")
+	if !ok {
+		return language
+	}
+	return language + "_" + strings.ToUpper(region)
+}
+
+// permanentWhatsAppError reports whether the message itself was refused;
+// throttling and server errors are worth retrying.
+func permanentWhatsAppError(err error) bool {
+	var refused *whatsAppError
+	return errors.As(err, &refused) && refused.Status >= 400 && refused.Status < 500 &&
+		refused.Status != http.StatusTooManyRequests
+}
+
+// socialMessagingClient calls End User Messaging Social's
+// SendWhatsAppMessage from the linked phone number.
+type socialMessagingClient struct {
+	httpClient    *http.Client
+	credentials   aws.CredentialsProvider
+	signer        *v4.Signer
+	region        string
+	phoneNumberID string
+}
+
+func newSocialMessagingClient(cfg aws.Config, phoneNumberID string) *socialMessagingClient {
+	return &socialMessagingClient{
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		credentials:   cfg.Credentials,
+		signer:        v4.NewSigner(),
+		region:        cfg.Region,
+		phoneNumberID: phoneNumberID,
+	}
+}
+
+func (c *socialMessagingClient) SendWhatsAppMessage(ctx context.Context, message []byte) (string, error) {
+	if c.phoneNumberID == "" {
+		return "", &whatsAppError{Status: http.StatusBadRequest, Message: "WHATSAPP_PHONE_NUMBER_ID is not set"}
+	}
+	// The message blob is base64 in JSON, which encoding/json does for
+	// []byte.
+	body, err := json.Marshal(map[string]interface{}{
+		"originationPhoneNumberId": c.phoneNumberID,
+		"message":                  message,
+		"metaApiVersion":           metaAPIVersion,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal WhatsApp message: %w", err)
+	}
+
+	endpoint := "https://social-messaging." + c.region + ".amazonaws.com/v1/whatsapp/send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	credentials, err := c.credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(hash[:]), "social-messaging", c.region, clk.Now()); err != nil {
+		return "", fmt.Errorf("failed to sign WhatsApp request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	payload, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(payload, &failure)
+		if failure.Message == "" {
+			failure.Message = resp.Status
+		}
+		return "", &whatsAppError{Status: resp.StatusCode, Message: failure.Message}
+	}
+
+	var result struct {
+		MessageID string `json:"messageId"`
+	}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return "", fmt.Errorf("failed to read WhatsApp response: %w", err)
+	}
+	return result.MessageID, nil
+}
+
+// testWhatsApp accepts every message without sending it; used in test
+// mode.
+type testWhatsApp struct{}
+
+func (*testWhatsApp) SendWhatsAppMessage(_ context.Context, message []byte) (string, error) {
+	log.Printf("TEST_MODE: not sending WhatsApp message %s", message)
+	return "test-" + idGen.NewID(), nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/health"
+	"pkg/idempotency"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/recovery"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient      *dynamodb.Client
+	eventBridgeClient *eventbridge.Client
+	stripe            *stripeClient
+	paymentsTable     string
+	webhookEvents     string
+	eventBusName      string
+	serverPort        string
+	version           = "1.0.0"
+
+	// webhookSecret signs Stripe webhook deliveries; webhookTolerance is
+	// how old a signed delivery may be before it is treated as a replay.
+	webhookSecret    string
+	webhookTolerance time.Duration
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	eventBridgeClient = eventbridge.NewFromConfig(cfg)
+	paymentsTable = getEnv("PAYMENTS_TABLE_NAME", "payments")
+	webhookEvents = getEnv("WEBHOOK_EVENTS_TABLE_NAME", "stripe-webhook-events")
+	eventBusName = getEnv("EVENT_BUS_NAME", "default")
+	serverPort = getEnv("PORT", "3005")
+
+	stripe = newStripeClient(os.Getenv("STRIPE_SECRET_KEY"), getEnv("STRIPE_API_URL", defaultStripeAPIURL))
+	webhookSecret = os.Getenv("STRIPE_WEBHOOK_SECRET")
+	webhookTolerance = time.Duration(getEnvInt("STRIPE_WEBHOOK_TOLERANCE_SECONDS", 300)) * time.Second
+	if webhookSecret == "" {
+		log.Printf("STRIPE_WEBHOOK_SECRET is not set; all webhook deliveries will be rejected")
+	}
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recovery.New("payment-service", clk, idGen).Middleware)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id"))
+
+	// Idempotency-Key support for POST retries
+	if table := os.Getenv("IDEMPOTENCY_TABLE_NAME"); table != "" {
+		router.Use(idempotency.NewStore(dynamoClient, table, clk).Middleware)
+	}
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("payment-service", clk,
+		health.Table(dynamoClient, paymentsTable, true),
+		health.Table(dynamoClient, webhookEvents, true),
+	).Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+	}
+
+	// Payment endpoints
+	router.HandleFunc("/payments", createPaymentHandler).Methods("POST")
+	router.HandleFunc("/payments", listPaymentsHandler).Methods("GET")
+	router.HandleFunc("/payments/{id}", getPaymentHandler).Methods("GET")
+	router.HandleFunc("/payments/{id}/refund", refundPaymentHandler).Methods("POST")
+
+	// Stripe webhooks
+	router.HandleFunc("/webhooks/stripe", stripeWebhookHandler).Methods("POST")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Payment service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "payment-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
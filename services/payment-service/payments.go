@@ -0,0 +1,629 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/gorilla/mux"
+
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// Payment statuses. Stripe's requires_* intent states are all PENDING.
+const (
+	PaymentPending    = "PENDING"
+	PaymentProcessing = "PROCESSING"
+	PaymentSucceeded  = "SUCCEEDED"
+	PaymentFailed     = "FAILED"
+	PaymentCanceled   = "CANCELED"
+	PaymentRefunded   = "REFUNDED"
+)
+
+// paymentTransitions lists the statuses each status may be entered from.
+// Stripe does not guarantee delivery order, so a late payment_failed for
+// an intent that has since succeeded must not move it back. A failed
+// payment can still succeed: the customer may retry with another card.
+var paymentTransitions = map[string][]string{
+	PaymentProcessing: {PaymentPending, PaymentFailed},
+	PaymentSucceeded:  {PaymentPending, PaymentProcessing, PaymentFailed},
+	PaymentFailed:     {PaymentPending, PaymentProcessing},
+	PaymentCanceled:   {PaymentPending, PaymentProcessing, PaymentFailed},
+	PaymentRefunded:   {PaymentSucceeded},
+}
+
+// Order statuses announced for each payment status. order-service applies
+// them when it receives the matching event.
+var orderStatusFor = map[string]string{
+	PaymentProcessing: "PAYMENT_PROCESSING",
+	PaymentSucceeded:  "PAID",
+	PaymentFailed:     "PAYMENT_FAILED",
+	PaymentCanceled:   "CANCELLED",
+	PaymentRefunded:   "REFUNDED",
+}
+
+// A partial refund leaves the payment SUCCEEDED; it is announced with its
+// own detail type and order status.
+const (
+	detailTypePartiallyRefunded  = "Payment Partially Refunded"
+	orderStatusPartiallyRefunded = "PARTIALLY_REFUNDED"
+)
+
+const eventSource = "ecommerce.payment-service"
+
+// EventBridge detail types, one per payment status change.
+var detailTypeFor = map[string]string{
+	PaymentProcessing: "Payment Processing",
+	PaymentSucceeded:  "Payment Succeeded",
+	PaymentFailed:     "Payment Failed",
+	PaymentCanceled:   "Payment Canceled",
+	PaymentRefunded:   "Payment Refunded",
+}
+
+// Payment is one attempt to pay for an order. Amount is in the currency's
+// smallest unit, as Stripe expects; AmountRefunded is how much of it has
+// been refunded so far, as Stripe last reported it.
+type Payment struct {
+	ID                    string    `json:"id" dynamodbav:"id"`
+	OrderID               string    `json:"order_id" dynamodbav:"order_id"`
+	Amount                int64     `json:"amount" dynamodbav:"amount"`
+	AmountRefunded        int64     `json:"amount_refunded" dynamodbav:"amount_refunded"`
+	Currency              string    `json:"currency" dynamodbav:"currency"`
+	Status                string    `json:"status" dynamodbav:"status"`
+	StripePaymentIntentID string    `json:"stripe_payment_intent_id,omitempty" dynamodbav:"stripe_payment_intent_id,omitempty"`
+	FailureCode           string    `json:"failure_code,omitempty" dynamodbav:"failure_code,omitempty"`
+	FailureMessage        string    `json:"failure_message,omitempty" dynamodbav:"failure_message,omitempty"`
+	LastEventID           string    `json:"last_event_id,omitempty" dynamodbav:"last_event_id,omitempty"`
+	CreatedAt             time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// CreatePaymentRequest starts a payment for an order. With a payment
+// method (a Stripe PaymentMethod ID the storefront collected), the payment
+// is charged at once instead of confirmed later with Stripe.js.
+type CreatePaymentRequest struct {
+	OrderID       string `json:"order_id" validate:"required,max=64"`
+	Amount        int64  `json:"amount" validate:"required,min=1,max=99999999"`
+	Currency      string `json:"currency" validate:"required,currency"`
+	ReceiptEmail  string `json:"receipt_email,omitempty" validate:"email,max=254"`
+	PaymentMethod string `json:"payment_method,omitempty" validate:"max=255"`
+}
+
+// RefundPaymentRequest refunds Amount, in the currency's smallest unit,
+// or all that is left of the payment when Amount is zero.
+type RefundPaymentRequest struct {
+	Amount int64  `json:"amount,omitempty" validate:"max=99999999"`
+	Reason string `json:"reason,omitempty" validate:"max=200"`
+}
+
+// CreatePaymentResponse carries the client secret the storefront needs to
+// confirm the intent with Stripe.js. The secret is not stored.
+type CreatePaymentResponse struct {
+	Payment
+	ClientSecret string `json:"client_secret"`
+}
+
+// PaymentEvent is the detail of the payment events on the platform bus.
+type PaymentEvent struct {
+	PaymentID      string    `json:"payment_id"`
+	OrderID        string    `json:"order_id"`
+	Status         string    `json:"status"`
+	OrderStatus    string    `json:"order_status"`
+	Amount         int64     `json:"amount"`
+	AmountRefunded int64     `json:"amount_refunded,omitempty"`
+	Currency       string    `json:"currency"`
+	FailureCode    string    `json:"failure_code,omitempty"`
+	FailureMessage string    `json:"failure_message,omitempty"`
+	StripeEventID  string    `json:"stripe_event_id"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+var errPaymentNotFound = errors.New("payment not found")
+
+// createPaymentHandler records the payment before creating its intent, so
+// every webhook for an intent created here finds its payment. A payment
+// charged at once answers with its outcome; a declined one is kept as
+// failed and answers 402.
+func createPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreatePaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	now := clk.Now()
+	payment := Payment{
+		ID:        idGen.NewID(),
+		OrderID:   req.OrderID,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Status:    PaymentPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	record, err := attributevalue.MarshalMap(payment)
+	if err != nil {
+		writePaymentError(w, r, fmt.Errorf("failed to marshal payment: %w", err))
+		return
+	}
+	_, err = dynamoClient.PutItem(r.Context(), &dynamodb.PutItemInput{
+		TableName:           aws.String(paymentsTable),
+		Item:                record,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		writePaymentError(w, r, fmt.Errorf("failed to put payment: %w", err))
+		return
+	}
+
+	intent, err := stripe.createPaymentIntent(r.Context(), req.Amount, req.Currency, map[string]string{
+		"payment_id": payment.ID,
+		"order_id":   payment.OrderID,
+	}, req.ReceiptEmail, req.PaymentMethod, "payment-"+payment.ID)
+	var declined *stripeError
+	if errors.As(err, &declined) && declined.Status == http.StatusPaymentRequired && declined.PaymentIntent != nil {
+		payment.StripePaymentIntentID = declined.PaymentIntent.ID
+		payment.Status = PaymentFailed
+		payment.FailureCode = declined.Code
+		payment.FailureMessage = declined.Message
+		recordIntent(r.Context(), payment)
+		problem.Write(w, r, problem.New(http.StatusPaymentRequired, "Payment was declined: "+declined.Message))
+		return
+	}
+	if err != nil {
+		deletePayment(r.Context(), payment.ID)
+		var stripeErr *stripeError
+		if errors.As(err, &stripeErr) && stripeErr.Status < http.StatusInternalServerError {
+			problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "Payment provider rejected the payment: "+stripeErr.Message))
+			return
+		}
+		log.Printf("Failed to create payment intent for order %s: %v", payment.OrderID, err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, "Payment provider is unavailable"))
+		return
+	}
+
+	payment.StripePaymentIntentID = intent.ID
+	payment.Status = intentPaymentStatus(intent.Status)
+	recordIntent(r.Context(), payment)
+
+	w.Header().Set("Location", "/payments/"+payment.ID)
+	writeJSON(w, http.StatusCreated, CreatePaymentResponse{Payment: payment, ClientSecret: intent.ClientSecret})
+}
+
+func getPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	payment, err := getPayment(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, payment)
+}
+
+// listPaymentsHandler lists the payments of ?order_id=, oldest first, so
+// a caller that lost a create response can find what it created.
+func listPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	orderID := r.URL.Query().Get("order_id")
+	if orderID == "" || len(orderID) > 64 {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "order_id is required"))
+		return
+	}
+	payments, err := paymentsForOrder(r.Context(), orderID)
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]Payment{"payments": payments})
+}
+
+// refundPaymentHandler gives a payment's money back: a succeeded payment
+// is refunded in full, or by the amount asked for, and one that has not
+// succeeded is cancelled so it never does. Stripe's webhooks then record
+// the refund, moving the payment to REFUNDED once nothing is left, or
+// move it to CANCELED; until they do the payment answers 202 as it is.
+// Refunding a refunded or cancelled payment changes nothing.
+func refundPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefundPaymentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+			return
+		}
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	payment, err := getPayment(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+	switch {
+	case payment.Status == PaymentRefunded || payment.Status == PaymentCanceled:
+		writeJSON(w, http.StatusOK, payment)
+		return
+	case payment.StripePaymentIntentID == "":
+		problem.Write(w, r, problem.New(http.StatusConflict, "Payment has no payment intent yet"))
+		return
+	case req.Amount > 0 && payment.Status != PaymentSucceeded:
+		problem.Write(w, r, problem.New(http.StatusConflict, "Only a succeeded payment can be partially refunded"))
+		return
+	case req.Amount > payment.Amount-payment.AmountRefunded:
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity,
+			fmt.Sprintf("Amount exceeds the %d left to refund", payment.Amount-payment.AmountRefunded)))
+		return
+	}
+
+	if payment.Status == PaymentSucceeded {
+		metadata := map[string]string{"payment_id": payment.ID, "order_id": payment.OrderID}
+		if req.Reason != "" {
+			metadata["reason"] = req.Reason
+		}
+		// The key names the refund by what was refunded before it, so a
+		// retried request is the same refund and a later one a new one.
+		key := fmt.Sprintf("refund-%s-%d-%d", payment.ID, payment.AmountRefunded, req.Amount)
+		_, err = stripe.refundPaymentIntent(r.Context(), payment.StripePaymentIntentID, req.Amount, metadata, key)
+	} else {
+		_, err = stripe.cancelPaymentIntent(r.Context(), payment.StripePaymentIntentID, "cancel-"+payment.ID)
+	}
+	var stripeErr *stripeError
+	if errors.As(err, &stripeErr) && stripeErr.Status < http.StatusInternalServerError {
+		// Usually the intent moved on since the payment was last updated;
+		// its webhook is on the way and a retry will pick the right call.
+		problem.Write(w, r, problem.New(http.StatusConflict, "Payment cannot be refunded now: "+stripeErr.Message))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to refund payment %s: %v", payment.ID, err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, "Payment provider is unavailable"))
+		return
+	}
+
+	log.Printf("Refund of payment %s for order %s requested (%s)", payment.ID, payment.OrderID, payment.Status)
+	writeJSON(w, http.StatusAccepted, payment)
+}
+
+func writePaymentError(w http.ResponseWriter, r *http.Request, err error) {
+	var p problem.Problem
+	switch {
+	case errors.As(err, &p):
+		problem.Write(w, r, p)
+	case errors.Is(err, errPaymentNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Payment not found"))
+	default:
+		log.Printf("Payment operation failed: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+	}
+}
+
+// transitionPayment moves a payment to status if its current status allows
+// it, and reports whether the order should hear about it. A payment
+// already in status also reports true: the previous delivery may have
+// updated the payment but failed to publish, so consumers must treat
+// repeated events for the same payment and status as one.
+func transitionPayment(ctx context.Context, id, status string, event StripeEvent, failureCode, failureMessage string) (Payment, bool, error) {
+	from := paymentTransitions[status]
+	values := map[string]types.AttributeValue{
+		":status": &types.AttributeValueMemberS{Value: status},
+		":event":  &types.AttributeValueMemberS{Value: event.ID},
+		":now":    timestamp(clk.Now()),
+	}
+	placeholders := make([]string, len(from))
+	for i, s := range from {
+		placeholders[i] = fmt.Sprintf(":from%d", i)
+		values[placeholders[i]] = &types.AttributeValueMemberS{Value: s}
+	}
+
+	update := "SET #status = :status, last_event_id = :event, updated_at = :now"
+	if failureCode != "" || failureMessage != "" {
+		update += ", failure_code = :code, failure_message = :message"
+		values[":code"] = &types.AttributeValueMemberS{Value: failureCode}
+		values[":message"] = &types.AttributeValueMemberS{Value: failureMessage}
+	}
+
+	result, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(paymentsTable),
+		Key:                       paymentKey(id),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("attribute_exists(id) AND #status IN (" + strings.Join(placeholders, ", ") + ")"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		current, err := getPayment(ctx, id)
+		if err != nil {
+			return Payment{}, false, err
+		}
+		if current.Status != status {
+			log.Printf("Ignoring %s for payment %s: cannot move from %s to %s", event.Type, id, current.Status, status)
+		}
+		return current, current.Status == status, nil
+	}
+	if err != nil {
+		return Payment{}, false, fmt.Errorf("failed to update payment: %w", err)
+	}
+
+	var payment Payment
+	if err := attributevalue.UnmarshalMap(result.Attributes, &payment); err != nil {
+		return Payment{}, false, fmt.Errorf("failed to unmarshal payment: %w", err)
+	}
+	return payment, true, nil
+}
+
+// recordRefund records that amountRefunded of a succeeded payment has been
+// refunded, and reports whether the order should hear about it. Stripe
+// reports the running total, so a late delivery of an earlier refund
+// leaves a larger total alone; one already recorded also reports true, as
+// in transitionPayment.
+func recordRefund(ctx context.Context, id string, amountRefunded int64, event StripeEvent) (Payment, bool, error) {
+	result, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(paymentsTable),
+		Key:              paymentKey(id),
+		UpdateExpression: aws.String("SET amount_refunded = :refunded, last_event_id = :event, updated_at = :now"),
+		ConditionExpression: aws.String("attribute_exists(id) AND #status = :succeeded AND " +
+			"(attribute_not_exists(amount_refunded) OR amount_refunded < :refunded)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":refunded":  &types.AttributeValueMemberN{Value: strconv.FormatInt(amountRefunded, 10)},
+			":succeeded": &types.AttributeValueMemberS{Value: PaymentSucceeded},
+			":event":     &types.AttributeValueMemberS{Value: event.ID},
+			":now":       timestamp(clk.Now()),
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		current, err := getPayment(ctx, id)
+		if err != nil {
+			return Payment{}, false, err
+		}
+		if current.AmountRefunded != amountRefunded {
+			log.Printf("Ignoring %s for payment %s: %s with %d refunded", event.Type, id, current.Status, current.AmountRefunded)
+		}
+		return current, current.AmountRefunded == amountRefunded, nil
+	}
+	if err != nil {
+		return Payment{}, false, fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	var payment Payment
+	if err := attributevalue.UnmarshalMap(result.Attributes, &payment); err != nil {
+		return Payment{}, false, fmt.Errorf("failed to unmarshal payment: %w", err)
+	}
+	return payment, true, nil
+}
+
+// publishPaymentEvent announces a payment status change, and the order
+// status it implies, on the platform bus.
+func publishPaymentEvent(ctx context.Context, payment Payment, event StripeEvent) error {
+	return putPaymentEvent(ctx, detailTypeFor[payment.Status], orderStatusFor[payment.Status], payment, event)
+}
+
+// publishPartialRefund announces a refund that left some of the payment.
+func publishPartialRefund(ctx context.Context, payment Payment, event StripeEvent) error {
+	return putPaymentEvent(ctx, detailTypePartiallyRefunded, orderStatusPartiallyRefunded, payment, event)
+}
+
+func putPaymentEvent(ctx context.Context, detailType, orderStatus string, payment Payment, event StripeEvent) error {
+	occurredAt := time.Unix(event.Created, 0).UTC()
+	detail, err := json.Marshal(PaymentEvent{
+		PaymentID:      payment.ID,
+		OrderID:        payment.OrderID,
+		Status:         payment.Status,
+		OrderStatus:    orderStatus,
+		Amount:         payment.Amount,
+		AmountRefunded: payment.AmountRefunded,
+		Currency:       payment.Currency,
+		FailureCode:    payment.FailureCode,
+		FailureMessage: payment.FailureMessage,
+		StripeEventID:  event.ID,
+		OccurredAt:     occurredAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	result, err := eventBridgeClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{
+			{
+				EventBusName: aws.String(eventBusName),
+				Source:       aws.String(eventSource),
+				DetailType:   aws.String(detailType),
+				Detail:       aws.String(string(detail)),
+				Time:         aws.Time(occurredAt),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put event: %w", err)
+	}
+	if result.FailedEntryCount > 0 {
+		return fmt.Errorf("event rejected: %s", aws.ToString(result.Entries[0].ErrorMessage))
+	}
+	return nil
+}
+
+// DynamoDB operations
+
+func getPayment(ctx context.Context, id string) (Payment, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(paymentsTable),
+		ConsistentRead: aws.Bool(true),
+		Key:            paymentKey(id),
+	})
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return Payment{}, errPaymentNotFound
+	}
+
+	var payment Payment
+	if err := attributevalue.UnmarshalMap(result.Item, &payment); err != nil {
+		return Payment{}, fmt.Errorf("failed to unmarshal payment: %w", err)
+	}
+	return payment, nil
+}
+
+// paymentIDForIntent finds the payment for an intent through the intent
+// index, for Stripe objects that do not carry our metadata.
+func paymentIDForIntent(ctx context.Context, intentID string) (string, error) {
+	result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(paymentsTable),
+		IndexName:              aws.String("stripe_payment_intent_id-index"),
+		KeyConditionExpression: aws.String("stripe_payment_intent_id = :intent"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":intent": &types.AttributeValueMemberS{Value: intentID},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to query payments by intent: %w", err)
+	}
+	if len(result.Items) == 0 {
+		return "", errPaymentNotFound
+	}
+
+	var payment Payment
+	if err := attributevalue.UnmarshalMap(result.Items[0], &payment); err != nil {
+		return "", fmt.Errorf("failed to unmarshal payment: %w", err)
+	}
+	return payment.ID, nil
+}
+
+// paymentsForOrder reads an order's payments through the order index. The
+// index is only eventually consistent, so each payment is read again from
+// the table.
+func paymentsForOrder(ctx context.Context, orderID string) ([]Payment, error) {
+	result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(paymentsTable),
+		IndexName:              aws.String("order_id-index"),
+		KeyConditionExpression: aws.String("order_id = :order"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":order": &types.AttributeValueMemberS{Value: orderID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payments by order: %w", err)
+	}
+
+	payments := make([]Payment, 0, len(result.Items))
+	for _, item := range result.Items {
+		var key struct {
+			ID string `dynamodbav:"id"`
+		}
+		if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal payment key: %w", err)
+		}
+		payment, err := getPayment(ctx, key.ID)
+		if errors.Is(err, errPaymentNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].CreatedAt.Before(payments[j].CreatedAt) })
+	return payments, nil
+}
+
+// recordIntent saves the intent of a new payment and the status its
+// creation left it in. A webhook may have moved the payment on already;
+// the status is then left as the webhook set it.
+func recordIntent(ctx context.Context, payment Payment) {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(paymentsTable),
+		Key:              paymentKey(payment.ID),
+		UpdateExpression: aws.String("SET stripe_payment_intent_id = :intent"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":intent": &types.AttributeValueMemberS{Value: payment.StripePaymentIntentID},
+		},
+	})
+	if err != nil {
+		// Webhooks still find the payment through the intent metadata.
+		log.Printf("Failed to record intent %s on payment %s: %v", payment.StripePaymentIntentID, payment.ID, err)
+	}
+	if payment.Status == PaymentPending {
+		return
+	}
+
+	update := "SET #status = :status, updated_at = :now"
+	values := map[string]types.AttributeValue{
+		":status":  &types.AttributeValueMemberS{Value: payment.Status},
+		":pending": &types.AttributeValueMemberS{Value: PaymentPending},
+		":now":     timestamp(clk.Now()),
+	}
+	if payment.FailureCode != "" || payment.FailureMessage != "" {
+		update += ", failure_code = :code, failure_message = :message"
+		values[":code"] = &types.AttributeValueMemberS{Value: payment.FailureCode}
+		values[":message"] = &types.AttributeValueMemberS{Value: payment.FailureMessage}
+	}
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(paymentsTable),
+		Key:                       paymentKey(payment.ID),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("#status = :pending"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionErr) {
+		log.Printf("Failed to record status %s of payment %s: %v", payment.Status, payment.ID, err)
+	}
+}
+
+// intentPaymentStatus is the payment status of a just-created intent.
+func intentPaymentStatus(intentStatus string) string {
+	switch intentStatus {
+	case "succeeded":
+		return PaymentSucceeded
+	case "processing":
+		return PaymentProcessing
+	case "canceled":
+		return PaymentCanceled
+	}
+	return PaymentPending
+}
+
+// deletePayment removes a payment whose intent could not be created.
+func deletePayment(ctx context.Context, id string) {
+	_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(paymentsTable),
+		Key:       paymentKey(id),
+	})
+	if err != nil {
+		log.Printf("Failed to delete payment %s: %v", id, err)
+	}
+}
+
+func paymentKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: id},
+	}
+}
+
+func timestamp(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: t.UTC().Format(time.RFC3339Nano)}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStripeAPIURL = "https://api.stripe.com"
+
+	// stripeAPIVersion pins request and webhook payload shapes; the
+	// webhook endpoint in the Stripe dashboard must use the same version.
+	stripeAPIVersion = "2023-10-16"
+)
+
+// Webhook signature errors. All of them mean the delivery is rejected.
+var (
+	errMissingSignature = errors.New("missing Stripe-Signature header")
+	errInvalidSignature = errors.New("no matching webhook signature")
+	errSignatureExpired = errors.New("webhook timestamp outside tolerance")
+)
+
+// stripeClient is the small part of the Stripe API the service uses.
+type stripeClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+func newStripeClient(apiKey, baseURL string) *stripeClient {
+	return &stripeClient{
+		apiKey:     apiKey,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// PaymentIntent is the subset of a Stripe PaymentIntent the service reads,
+// from API responses and webhook payloads alike.
+type PaymentIntent struct {
+	ID               string            `json:"id"`
+	Status           string            `json:"status"`
+	Amount           int64             `json:"amount"`
+	Currency         string            `json:"currency"`
+	ClientSecret     string            `json:"client_secret"`
+	Metadata         map[string]string `json:"metadata"`
+	LastPaymentError *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+// Charge is the subset of a Stripe Charge read from refund webhooks.
+type Charge struct {
+	ID             string `json:"id"`
+	PaymentIntent  string `json:"payment_intent"`
+	Amount         int64  `json:"amount"`
+	AmountRefunded int64  `json:"amount_refunded"`
+	Refunded       bool   `json:"refunded"`
+}
+
+// StripeEvent is a webhook delivery. Data.Object is decoded according to
+// Type.
+type StripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// Refund is the subset of a Stripe Refund the service reads.
+type Refund struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// stripeError is an error response from the Stripe API. Declines of an
+// intent confirmed on creation carry the intent.
+type stripeError struct {
+	Status        int
+	Type          string         `json:"type"`
+	Code          string         `json:"code"`
+	Message       string         `json:"message"`
+	PaymentIntent *PaymentIntent `json:"payment_intent"`
+}
+
+func (e *stripeError) Error() string {
+	return fmt.Sprintf("stripe: %d %s: %s", e.Status, e.Type, e.Message)
+}
+
+// createPaymentIntent creates an intent for amount in the currency's
+// smallest unit. idempotencyKey makes retries of the same call return the
+// same intent instead of charging twice. Given a payment method, the
+// intent is confirmed and charged at once; one that would need the
+// customer to authenticate is declined rather than left waiting.
+func (c *stripeClient) createPaymentIntent(ctx context.Context, amount int64, currency string, metadata map[string]string, receiptEmail, paymentMethod, idempotencyKey string) (PaymentIntent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(amount, 10))
+	form.Set("currency", strings.ToLower(currency))
+	form.Set("automatic_payment_methods[enabled]", "true")
+	if paymentMethod != "" {
+		form.Set("payment_method", paymentMethod)
+		form.Set("confirm", "true")
+		form.Set("error_on_requires_action", "true")
+		form.Set("automatic_payment_methods[allow_redirects]", "never")
+	}
+	for key, value := range metadata {
+		form.Set("metadata["+key+"]", value)
+	}
+	if receiptEmail != "" {
+		form.Set("receipt_email", receiptEmail)
+	}
+
+	var intent PaymentIntent
+	if err := c.post(ctx, "/v1/payment_intents", form, idempotencyKey, &intent); err != nil {
+		return PaymentIntent{}, err
+	}
+	return intent, nil
+}
+
+// refundPaymentIntent refunds amount of a succeeded intent, or all that is
+// left of it when amount is zero.
+func (c *stripeClient) refundPaymentIntent(ctx context.Context, intentID string, amount int64, metadata map[string]string, idempotencyKey string) (Refund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", intentID)
+	if amount > 0 {
+		form.Set("amount", strconv.FormatInt(amount, 10))
+	}
+	for key, value := range metadata {
+		form.Set("metadata["+key+"]", value)
+	}
+
+	var refund Refund
+	if err := c.post(ctx, "/v1/refunds", form, idempotencyKey, &refund); err != nil {
+		return Refund{}, err
+	}
+	return refund, nil
+}
+
+// cancelPaymentIntent cancels an intent that has not succeeded, so it
+// never can.
+func (c *stripeClient) cancelPaymentIntent(ctx context.Context, intentID, idempotencyKey string) (PaymentIntent, error) {
+	var intent PaymentIntent
+	if err := c.post(ctx, "/v1/payment_intents/"+url.PathEscape(intentID)+"/cancel", url.Values{}, idempotencyKey, &intent); err != nil {
+		return PaymentIntent{}, err
+	}
+	return intent, nil
+}
+
+func (c *stripeClient) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	if c.apiKey == "" {
+		return errors.New("stripe: STRIPE_SECRET_KEY is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build Stripe request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Stripe-Version", stripeAPIVersion)
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Stripe: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var body struct {
+			Error stripeError `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return &stripeError{Status: resp.StatusCode, Type: "api_error", Message: http.StatusText(resp.StatusCode)}
+		}
+		body.Error.Status = resp.StatusCode
+		return &body.Error
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Stripe response: %w", err)
+	}
+	return nil
+}
+
+// verifySignature checks a Stripe-Signature header ("t=...,v1=...") against
+// the raw payload: v1 is the hex HMAC-SHA256 of "t.payload" under the
+// endpoint secret. Secrets being rolled produce several v1 entries; any
+// match is accepted. Old timestamps are rejected so a captured delivery
+// cannot be replayed later.
+func verifySignature(payload []byte, header, secret string, tolerance time.Duration, now time.Time) error {
+	if header == "" || secret == "" {
+		return errMissingSignature
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errMissingSignature
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errMissingSignature
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > tolerance || age < -tolerance {
+		return errSignatureExpired
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return errInvalidSignature
+}
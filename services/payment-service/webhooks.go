@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/problem"
+)
+
+const (
+	// maxWebhookBytes bounds the payload read before verification.
+	maxWebhookBytes = 256 << 10
+
+	// Processed event IDs are kept longer than Stripe's three days of
+	// retries; a claim older than webhookClaimTimeout is assumed to
+	// belong to a crashed task and may be taken over.
+	webhookEventRetention = 30 * 24 * time.Hour
+	webhookClaimTimeout   = 2 * time.Minute
+)
+
+// Webhook event processing states.
+const (
+	webhookProcessing = "PROCESSING"
+	webhookProcessed  = "PROCESSED"
+)
+
+// paymentIntentStatuses maps the intent events the service handles to the
+// payment status they imply.
+var paymentIntentStatuses = map[string]string{
+	"payment_intent.processing":     PaymentProcessing,
+	"payment_intent.succeeded":      PaymentSucceeded,
+	"payment_intent.payment_failed": PaymentFailed,
+	"payment_intent.canceled":       PaymentCanceled,
+}
+
+var errWebhookInProgress = errors.New("webhook event is being processed")
+
+// stripeWebhookHandler verifies and applies a Stripe webhook delivery.
+// Stripe delivers at least once and retries anything but a 2xx, so each
+// event ID is claimed before processing: duplicates of a processed event
+// are acknowledged without effect, and a failed attempt releases its claim
+// so the retry runs again.
+func stripeWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes+1))
+	if err != nil {
+		problem.Write(w, r, problem.Malformed("Failed to read request body"))
+		return
+	}
+	if len(payload) > maxWebhookBytes {
+		problem.Write(w, r, problem.New(http.StatusRequestEntityTooLarge, "Webhook payload is too large"))
+		return
+	}
+
+	if err := verifySignature(payload, r.Header.Get("Stripe-Signature"), webhookSecret, webhookTolerance, clk.Now()); err != nil {
+		log.Printf("Rejected Stripe webhook: %v", err)
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "Invalid webhook signature"))
+		return
+	}
+
+	var event StripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.ID == "" {
+		problem.Write(w, r, problem.Malformed("Webhook payload must be a Stripe event"))
+		return
+	}
+
+	if _, ok := paymentIntentStatuses[event.Type]; !ok && event.Type != "charge.refunded" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"received": true, "ignored": true})
+		return
+	}
+
+	claimed, err := claimWebhookEvent(r.Context(), event)
+	if errors.Is(err, errWebhookInProgress) {
+		problem.Write(w, r, problem.New(http.StatusConflict, "Event is already being processed"))
+		return
+	}
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+	if !claimed {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"received": true, "duplicate": true})
+		return
+	}
+
+	if err := applyWebhookEvent(r.Context(), event); err != nil {
+		releaseWebhookEvent(r.Context(), event.ID)
+		writePaymentError(w, r, fmt.Errorf("failed to apply %s %s: %w", event.Type, event.ID, err))
+		return
+	}
+	completeWebhookEvent(r.Context(), event.ID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"received": true})
+}
+
+// applyWebhookEvent maps an event to a payment transition and publishes
+// the resulting order status.
+func applyWebhookEvent(ctx context.Context, event StripeEvent) error {
+	var paymentID, status, failureCode, failureMessage string
+
+	if intentStatus, ok := paymentIntentStatuses[event.Type]; ok {
+		var intent PaymentIntent
+		if err := json.Unmarshal(event.Data.Object, &intent); err != nil {
+			return fmt.Errorf("failed to unmarshal payment intent: %w", err)
+		}
+		paymentID = intent.Metadata["payment_id"]
+		if paymentID == "" {
+			log.Printf("Ignoring %s for intent %s: not created by payment-service", event.Type, intent.ID)
+			return nil
+		}
+		status = intentStatus
+		if status == PaymentFailed && intent.LastPaymentError != nil {
+			failureCode = intent.LastPaymentError.Code
+			failureMessage = intent.LastPaymentError.Message
+		}
+	} else {
+		var charge Charge
+		if err := json.Unmarshal(event.Data.Object, &charge); err != nil {
+			return fmt.Errorf("failed to unmarshal charge: %w", err)
+		}
+		id, err := paymentIDForIntent(ctx, charge.PaymentIntent)
+		if errors.Is(err, errPaymentNotFound) {
+			log.Printf("Ignoring refund of charge %s: no payment for intent %s", charge.ID, charge.PaymentIntent)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		payment, notify, err := recordRefund(ctx, id, charge.AmountRefunded, event)
+		if err != nil {
+			return err
+		}
+		// A partial refund leaves the payment, and the order, paid; a full
+		// one goes on to refund it.
+		if !charge.Refunded {
+			if !notify {
+				return nil
+			}
+			if err := publishPartialRefund(ctx, payment, event); err != nil {
+				return err
+			}
+			log.Printf("Payment %s for order %s has %d of %d refunded (%s)", payment.ID, payment.OrderID, payment.AmountRefunded, payment.Amount, event.ID)
+			return nil
+		}
+		paymentID, status = id, PaymentRefunded
+	}
+
+	payment, notify, err := transitionPayment(ctx, paymentID, status, event, failureCode, failureMessage)
+	if err != nil {
+		return err
+	}
+	if !notify {
+		return nil
+	}
+	if err := publishPaymentEvent(ctx, payment, event); err != nil {
+		return err
+	}
+
+	log.Printf("Payment %s for order %s is %s (%s)", payment.ID, payment.OrderID, payment.Status, event.ID)
+	return nil
+}
+
+// claimWebhookEvent records that event is being processed. It returns
+// false for an event that was already processed and errWebhookInProgress
+// while another delivery of it is still running.
+func claimWebhookEvent(ctx context.Context, event StripeEvent) (bool, error) {
+	now := clk.Now()
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(webhookEvents),
+		Item: map[string]types.AttributeValue{
+			"id":          &types.AttributeValueMemberS{Value: event.ID},
+			"type":        &types.AttributeValueMemberS{Value: event.Type},
+			"status":      &types.AttributeValueMemberS{Value: webhookProcessing},
+			"claimed_at":  &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			"received_at": timestamp(now),
+			"expires_at":  &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(webhookEventRetention).Unix(), 10)},
+		},
+		ConditionExpression:      aws.String("attribute_not_exists(id) OR (#status = :processing AND claimed_at < :stale)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":processing": &types.AttributeValueMemberS{Value: webhookProcessing},
+			":stale":      &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(-webhookClaimTimeout).Unix(), 10)},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		if status, ok := conditionErr.Item["status"].(*types.AttributeValueMemberS); ok && status.Value == webhookProcessed {
+			return false, nil
+		}
+		return false, errWebhookInProgress
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook event: %w", err)
+	}
+	return true, nil
+}
+
+func completeWebhookEvent(ctx context.Context, id string) {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(webhookEvents),
+		Key:                      map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+		UpdateExpression:         aws.String("SET #status = :processed, processed_at = :now"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":processed": &types.AttributeValueMemberS{Value: webhookProcessed},
+			":now":       timestamp(clk.Now()),
+		},
+	})
+	if err != nil {
+		// The claim goes stale and a redelivery reprocesses the event,
+		// which the payment transition rules make harmless.
+		log.Printf("Failed to mark webhook event %s processed: %v", id, err)
+	}
+}
+
+func releaseWebhookEvent(ctx context.Context, id string) {
+	_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(webhookEvents),
+		Key:       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+	})
+	if err != nil {
+		log.Printf("Failed to release webhook event %s: %v", id, err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/health"
+	"pkg/idempotency"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/metrics"
+	"pkg/recovery"
+	"pkg/search"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient      *dynamodb.Client
+	eventBridgeClient *eventbridge.Client
+	tableName         string
+	eventBusName      string
+	serverPort        string
+	version           = "1.0.0"
+
+	// prices holds each product's price history and promotions.
+	prices *dynamo.Table
+	// promotionSweepInterval is how often promotions are started and
+	// ended, so how late either may be.
+	promotionSweepInterval time.Duration
+
+	// cartServiceURL and checkoutServiceURL are read for the remarketing
+	// parameters of cart and purchase pages.
+	cartServiceURL     string
+	checkoutServiceURL string
+
+	// searchClient queries the index product-indexer keeps in sync with
+	// the table; nil when OPENSEARCH_ENDPOINT is unset.
+	searchClient *search.Client
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+
+	// recoverer reports panics in handlers and the promotion sweeper.
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	eventBridgeClient = eventbridge.NewFromConfig(cfg)
+	tableName = getEnv("PRODUCTS_TABLE_NAME", "products")
+	eventBusName = getEnv("EVENT_BUS_NAME", "default")
+	serverPort = getEnv("PORT", "3001")
+	cartServiceURL = strings.TrimRight(os.Getenv("CART_SERVICE_URL"), "/")
+	checkoutServiceURL = strings.TrimRight(os.Getenv("CHECKOUT_SERVICE_URL"), "/")
+	promotionSweepInterval = time.Duration(getEnvInt("PROMOTION_SWEEP_INTERVAL_SECONDS", 60)) * time.Second
+	prices = dynamo.NewTable(dynamoClient, getEnv("PRICES_TABLE_NAME", "product-prices"),
+		dynamo.WithTimeout(5*time.Second))
+
+	if endpoint := os.Getenv("OPENSEARCH_ENDPOINT"); endpoint != "" {
+		searchClient = search.New(endpoint, &cfg)
+	} else {
+		log.Printf("OPENSEARCH_ENDPOINT not set, product search disabled")
+	}
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+	recoverer = recovery.New("product-service", clk, idGen)
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware)
+
+	// Request count, error rate and latency per route, scraped from
+	// /metrics
+	registry := metrics.NewRegistry()
+	router.Use(metrics.NewHTTP(registry, "product-service", routeTemplate, clk).Middleware)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id", "promotionId"))
+
+	// Idempotency-Key support for POST retries
+	if table := os.Getenv("IDEMPOTENCY_TABLE_NAME"); table != "" {
+		router.Use(idempotency.NewStore(dynamoClient, table, clk).Middleware)
+	}
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("product-service", clk,
+		health.Table(dynamoClient, tableName, true),
+		health.Table(dynamoClient, prices.Name, true),
+	).Handler()).Methods("GET")
+	router.Handle("/metrics", registry.Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs, manual promotion sweeps")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+		router.HandleFunc("/__test/promotion-sweep", promotionSweepHandler).Methods("POST")
+	} else {
+		go runPromotionSweeper(context.Background())
+	}
+
+	// Product endpoints; /products/search and /products/remarketing
+	// before /products/{id} so they are not taken for an ID
+	router.HandleFunc("/products", createProductHandler).Methods("POST")
+	router.HandleFunc("/products", listProductsHandler).Methods("GET")
+	router.HandleFunc("/products/search", searchProductsHandler).Methods("GET")
+	router.HandleFunc("/products/remarketing", remarketingHandler).Methods("GET")
+	router.HandleFunc("/products/{id}", getProductHandler).Methods("GET")
+	router.HandleFunc("/products/{id}", updateProductHandler).Methods("PUT")
+	router.HandleFunc("/products/{id}", deleteProductHandler).Methods("DELETE")
+
+	// Prices: the effective price at a time, regular price history and
+	// promotions
+	router.HandleFunc("/products/{id}/price", getPriceHandler).Methods("GET")
+	router.HandleFunc("/products/{id}/price-history", priceHistoryHandler).Methods("GET")
+	router.HandleFunc("/products/{id}/promotions", listPromotionsHandler).Methods("GET")
+	router.HandleFunc("/products/{id}/promotions", createPromotionHandler).Methods("POST")
+	router.HandleFunc("/products/{id}/promotions/{promotionId}", cancelPromotionHandler).Methods("DELETE")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Product service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "product-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// routeTemplate labels metrics with the matched route rather than the raw
+// path, which would give every product ID its own series.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// Prices. A product's price field is its regular price; every change to
+// it is kept in the prices table, so what a product cost at any moment
+// can be answered after the fact. Promotions lower the price for a time
+// box without touching the regular price. The effective price at a time
+// is the lowest of the regular price then and the promotions running
+// then; order-service prices order lines with it.
+//
+// Each change of the effective price, whether an edit or a promotion
+// starting or ending, is announced as a Product Price Changed event for
+// the Merchant Center feed. Promotions start and end on their own, found
+// by the promotion sweep through the sparse due index.
+//
+// The prices table is single-table, keyed by product:
+//
+//	pk = PRODUCT#<id>   sk = PRICE#<changed at>#<change id>
+//	pk = PRODUCT#<id>   sk = PROMO#<promotion id>
+
+const (
+	eventSource            = "ecommerce.product-service"
+	detailTypePriceChanged = "Product Price Changed"
+)
+
+// Promotion states. A promotion cancelled before it starts is deleted; one
+// cancelled while running ends at once, so past prices stay answerable.
+const (
+	PromotionScheduled = "SCHEDULED"
+	PromotionActive    = "ACTIVE"
+	PromotionEnded     = "ENDED"
+)
+
+// Reasons the effective price changed.
+const (
+	ReasonCreated          = "created"
+	ReasonUpdated          = "updated"
+	ReasonPromotionStarted = "promotion-started"
+	ReasonPromotionEnded   = "promotion-ended"
+)
+
+// dueIndex holds promotions waiting to start or end, keyed on the constant
+// due marker and the time they are due.
+const (
+	dueIndex  = "due-index"
+	dueMarker = "DUE"
+)
+
+// stampLayout formats times in sort keys: fixed width, so keys sort in
+// time order.
+const stampLayout = "2006-01-02T15:04:05.000000000Z"
+
+const maxHistoryLimit = 200
+
+// PriceChange is one regular price a product had from ChangedAt.
+type PriceChange struct {
+	PK        string    `json:"-" dynamodbav:"pk"`
+	SK        string    `json:"-" dynamodbav:"sk"`
+	ID        string    `json:"id" dynamodbav:"id"`
+	ProductID string    `json:"product_id" dynamodbav:"product_id"`
+	Price     float64   `json:"price" dynamodbav:"price"`
+	Currency  string    `json:"currency" dynamodbav:"currency"`
+	Reason    string    `json:"reason" dynamodbav:"reason"`
+	ChangedAt time.Time `json:"changed_at" dynamodbav:"changed_at"`
+}
+
+// Promotion is a price a product sells at from StartsAt until EndsAt, in
+// the product's currency.
+type Promotion struct {
+	PK        string    `json:"-" dynamodbav:"pk"`
+	SK        string    `json:"-" dynamodbav:"sk"`
+	ID        string    `json:"id" dynamodbav:"id"`
+	ProductID string    `json:"product_id" dynamodbav:"product_id"`
+	Name      string    `json:"name" dynamodbav:"name"`
+	Price     float64   `json:"price" dynamodbav:"price"`
+	StartsAt  time.Time `json:"starts_at" dynamodbav:"starts_at"`
+	EndsAt    time.Time `json:"ends_at" dynamodbav:"ends_at"`
+	State     string    `json:"state" dynamodbav:"state"`
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+
+	// Due and DueAt (epoch seconds) put a promotion in the due index
+	// until it has ended.
+	Due   string `json:"-" dynamodbav:"due,omitempty"`
+	DueAt int64  `json:"-" dynamodbav:"due_at,omitempty"`
+}
+
+type CreatePromotionRequest struct {
+	Name     string    `json:"name" validate:"required,max=200"`
+	Price    float64   `json:"price" validate:"required,min=0.01,max=1000000"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at" validate:"required"`
+}
+
+// EffectivePrice is what a product sold for at a time.
+type EffectivePrice struct {
+	ProductID     string    `json:"product_id"`
+	SKU           string    `json:"sku"`
+	Price         float64   `json:"price"`
+	RegularPrice  float64   `json:"regular_price"`
+	Currency      string    `json:"currency"`
+	PromotionID   string    `json:"promotion_id,omitempty"`
+	PromotionName string    `json:"promotion_name,omitempty"`
+	At            time.Time `json:"at"`
+}
+
+// PriceChangedEvent is the EventBridge detail of a change to a product's
+// effective price.
+type PriceChangedEvent struct {
+	ProductID    string    `json:"product_id"`
+	SKU          string    `json:"sku"`
+	Price        float64   `json:"price"`
+	RegularPrice float64   `json:"regular_price"`
+	Currency     string    `json:"currency"`
+	PromotionID  string    `json:"promotion_id,omitempty"`
+	Reason       string    `json:"reason"`
+	ChangedAt    time.Time `json:"changed_at"`
+}
+
+var errNoPriceAt = errors.New("product had no price at that time")
+
+// Handlers
+
+// getPriceHandler answers GET /products/{id}/price?at=<RFC 3339 time>
+// with the effective price then; now without at.
+func getPriceHandler(w http.ResponseWriter, r *http.Request) {
+	at := clk.Now().UTC()
+	if value := r.URL.Query().Get("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "at must be an RFC 3339 time"))
+			return
+		}
+		at = parsed.UTC()
+	}
+
+	product, err := getProduct(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+	price, err := effectivePrice(r.Context(), product, at)
+	if errors.Is(err, errNoPriceAt) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Product did not exist at "+at.Format(time.RFC3339)))
+		return
+	}
+	if err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, price)
+}
+
+// priceHistoryHandler lists a product's regular prices, newest first.
+func priceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["id"]
+	limit := defaultListLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit)))
+			return
+		}
+		limit = n
+	}
+	q := dynamo.Query{
+		KeyCondition: "pk = :pk AND begins_with(sk, :prefix)",
+		Values: map[string]types.AttributeValue{
+			":pk":     dynamo.S(productPartition(productID)),
+			":prefix": dynamo.S(dynamo.Prefix("PRICE")),
+		},
+		Limit:      int32(limit),
+		Descending: true,
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		q.Start = dynamo.ItemKey(productPartition(productID), cursor)
+	}
+
+	page, err := dynamo.QueryPage[PriceChange](r.Context(), prices, q)
+	if err != nil {
+		writeProductError(w, r, fmt.Errorf("failed to query price history: %w", err))
+		return
+	}
+	response := map[string]interface{}{"prices": page.Items}
+	if sk, ok := page.Next[dynamo.SortKey].(*types.AttributeValueMemberS); ok {
+		response["next_cursor"] = sk.Value
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func listPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	promotions, err := productPromotions(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"promotions": promotions})
+}
+
+// createPromotionHandler schedules a promotion, starting it at once when
+// it starts now or has no start.
+func createPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreatePromotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	now := clk.Now().UTC()
+	if req.StartsAt.IsZero() || req.StartsAt.Before(now) {
+		req.StartsAt = now
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		problem.Write(w, r, problem.Validation(validate.Errors{{Field: "ends_at", Rule: "after", Message: "must be after starts_at and in the future"}}))
+		return
+	}
+
+	product, err := getProduct(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+
+	id := idGen.NewID()
+	promotion := Promotion{
+		PK:        productPartition(product.ID),
+		SK:        dynamo.Compose("PROMO", id),
+		ID:        id,
+		ProductID: product.ID,
+		Name:      req.Name,
+		Price:     req.Price,
+		StartsAt:  req.StartsAt.UTC(),
+		EndsAt:    req.EndsAt.UTC(),
+		State:     PromotionScheduled,
+		CreatedAt: now,
+		Due:       dueMarker,
+		DueAt:     req.StartsAt.Unix(),
+	}
+	started := !promotion.StartsAt.After(now)
+	if started {
+		promotion.State = PromotionActive
+		promotion.DueAt = promotion.EndsAt.Unix()
+	}
+	if err := prices.Put(r.Context(), promotion, dynamo.IfNotExists(dynamo.SortKey)); err != nil {
+		writeProductError(w, r, fmt.Errorf("failed to save promotion: %w", err))
+		return
+	}
+	if started {
+		announcePriceChange(r.Context(), product, promotion.StartsAt, ReasonPromotionStarted)
+	}
+
+	w.Header().Set("Location", "/products/"+product.ID+"/promotions/"+promotion.ID)
+	writeJSON(w, http.StatusCreated, promotion)
+}
+
+// cancelPromotionHandler deletes a promotion that has not started and ends
+// a running one now, including one past its start the sweep has not yet
+// seen. Ended promotions are history and cannot be cancelled.
+func cancelPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	product, err := getProduct(r.Context(), vars["id"])
+	if err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+	key := promotionKey(product.ID, vars["promotionId"])
+	promotion, err := dynamo.Get[Promotion](r.Context(), prices, key)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Promotion not found"))
+		return
+	}
+	if err != nil {
+		writeProductError(w, r, fmt.Errorf("failed to get promotion: %w", err))
+		return
+	}
+
+	now := clk.Now().UTC()
+	switch {
+	case promotion.State == PromotionEnded:
+		problem.Write(w, r, problem.New(http.StatusConflict, "Promotion has already ended"))
+		return
+	case promotion.State == PromotionScheduled && now.Before(promotion.StartsAt):
+		err = prices.Delete(r.Context(), key, dynamo.IfEquals("state", dynamo.S(PromotionScheduled)))
+		if errors.Is(err, dynamo.ErrConditionFailed) {
+			problem.Write(w, r, problem.New(http.StatusConflict, "Promotion started meanwhile; cancel it again to end it"))
+			return
+		}
+		if err != nil {
+			writeProductError(w, r, fmt.Errorf("failed to delete promotion: %w", err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := endPromotion(r.Context(), promotion, now); err != nil {
+		if errors.Is(err, dynamo.ErrConditionFailed) {
+			problem.Write(w, r, problem.New(http.StatusConflict, "Promotion has already ended"))
+			return
+		}
+		writeProductError(w, r, err)
+		return
+	}
+	announcePriceChange(r.Context(), product, now, ReasonPromotionEnded)
+	promotion.State, promotion.EndsAt = PromotionEnded, now
+	writeJSON(w, http.StatusOK, promotion)
+}
+
+// Promotion sweep
+
+// runPromotionSweeper starts and ends promotions as they fall due. Every
+// task runs it; the conditional state changes let one of them announce
+// each.
+func runPromotionSweeper(ctx context.Context) {
+	ticker := time.NewTicker(promotionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			recoverer.Do("promotion sweep", func() {
+				if n, err := sweepPromotions(ctx); err != nil {
+					log.Printf("Failed to sweep promotions: %v", err)
+				} else if n > 0 {
+					log.Printf("Started or ended %d promotions", n)
+				}
+			})
+		}
+	}
+}
+
+// promotionSweepHandler runs one sweep on demand; registered only in test
+// mode.
+func promotionSweepHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := sweepPromotions(r.Context())
+	if err != nil {
+		log.Printf("Failed to sweep promotions: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"changed": n})
+}
+
+// sweepPromotions moves every due promotion on a state and announces the
+// price change, returning how many it moved.
+func sweepPromotions(ctx context.Context) (int, error) {
+	now := clk.Now().UTC()
+	var changed int
+	err := dynamo.QueryEach(ctx, prices, dynamo.Query{
+		Index:        dueIndex,
+		KeyCondition: "due = :due AND due_at <= :now",
+		Values: map[string]types.AttributeValue{
+			":due": dynamo.S(dueMarker),
+			":now": dynamo.N(strconv.FormatInt(now.Unix(), 10)),
+		},
+	}, func(page []Promotion) error {
+		for _, promotion := range page {
+			ok, err := advancePromotion(ctx, promotion, now)
+			if err != nil {
+				log.Printf("Failed to advance promotion %s: %v", promotion.ID, err)
+				continue
+			}
+			if ok {
+				changed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return changed, fmt.Errorf("failed to query due promotions: %w", err)
+	}
+	return changed, nil
+}
+
+// advancePromotion starts a scheduled promotion or ends a running one. It
+// returns false if another task got there first.
+func advancePromotion(ctx context.Context, promotion Promotion, now time.Time) (bool, error) {
+	product, err := getProduct(ctx, promotion.ProductID)
+	if errors.Is(err, errProductNotFound) {
+		// Deleted products have no price to announce; retire the
+		// promotion quietly.
+		err := endPromotion(ctx, promotion, promotion.EndsAt)
+		return false, ignoreConditionFailed(err)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case promotion.State == PromotionScheduled && now.Before(promotion.EndsAt):
+		err = prices.Update(ctx, promotionKey(promotion.ProductID, promotion.ID), dynamo.Update{
+			Expression: "SET #state = :active, due_at = :ends",
+			Condition:  "#state = :scheduled",
+			Names:      map[string]string{"#state": "state"},
+			Values: map[string]types.AttributeValue{
+				":active":    dynamo.S(PromotionActive),
+				":scheduled": dynamo.S(PromotionScheduled),
+				":ends":      dynamo.N(strconv.FormatInt(promotion.EndsAt.Unix(), 10)),
+			},
+		}, nil)
+		if errors.Is(err, dynamo.ErrConditionFailed) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to start promotion: %w", err)
+		}
+		announcePriceChange(ctx, product, promotion.StartsAt, ReasonPromotionStarted)
+		return true, nil
+	default:
+		// Running past its end, or scheduled and already over by the
+		// time the sweep saw it.
+		err = endPromotion(ctx, promotion, promotion.EndsAt)
+		if errors.Is(err, dynamo.ErrConditionFailed) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		announcePriceChange(ctx, product, promotion.EndsAt, ReasonPromotionEnded)
+		return true, nil
+	}
+}
+
+// endPromotion marks a promotion ended at endsAt and takes it out of the
+// due index. It fails with dynamo.ErrConditionFailed if it had ended.
+func endPromotion(ctx context.Context, promotion Promotion, endsAt time.Time) error {
+	endsAtValue, err := attributevalue.Marshal(endsAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to marshal ends_at: %w", err)
+	}
+	err = prices.Update(ctx, promotionKey(promotion.ProductID, promotion.ID), dynamo.Update{
+		Expression: "SET #state = :ended, ends_at = :ends_at REMOVE due, due_at",
+		Condition:  "#state <> :ended",
+		Names:      map[string]string{"#state": "state"},
+		Values: map[string]types.AttributeValue{
+			":ended":   dynamo.S(PromotionEnded),
+			":ends_at": endsAtValue,
+		},
+	}, nil)
+	if err != nil && !errors.Is(err, dynamo.ErrConditionFailed) {
+		return fmt.Errorf("failed to end promotion: %w", err)
+	}
+	return err
+}
+
+// Effective prices
+
+// effectivePrice is the lowest of product's regular price at and the
+// promotions running at that time. Products priced before history was kept
+// have no change on record; their current price counts as their price
+// since creation.
+func effectivePrice(ctx context.Context, product Product, at time.Time) (EffectivePrice, error) {
+	price := EffectivePrice{
+		ProductID: product.ID,
+		SKU:       product.SKU,
+		Currency:  product.Currency,
+		At:        at,
+	}
+
+	page, err := dynamo.QueryPage[PriceChange](ctx, prices, dynamo.Query{
+		KeyCondition: "pk = :pk AND sk BETWEEN :first AND :last",
+		Values: map[string]types.AttributeValue{
+			":pk":    dynamo.S(productPartition(product.ID)),
+			":first": dynamo.S(dynamo.Prefix("PRICE")),
+			":last":  dynamo.S(dynamo.Compose("PRICE", at.UTC().Format(stampLayout), "~")),
+		},
+		Limit:      1,
+		Descending: true,
+	})
+	if err != nil {
+		return EffectivePrice{}, fmt.Errorf("failed to query price history: %w", err)
+	}
+	switch {
+	case len(page.Items) > 0:
+		price.RegularPrice = page.Items[0].Price
+		price.Currency = page.Items[0].Currency
+	case at.Before(product.CreatedAt):
+		return EffectivePrice{}, errNoPriceAt
+	default:
+		price.RegularPrice = product.Price
+	}
+	price.Price = price.RegularPrice
+
+	promotions, err := productPromotions(ctx, product.ID)
+	if err != nil {
+		return EffectivePrice{}, err
+	}
+	for _, promotion := range promotions {
+		if at.Before(promotion.StartsAt) || !at.Before(promotion.EndsAt) || promotion.Price >= price.Price {
+			continue
+		}
+		price.Price = promotion.Price
+		price.PromotionID = promotion.ID
+		price.PromotionName = promotion.Name
+	}
+	return price, nil
+}
+
+// priceChange is the history record of product's regular price from
+// product.UpdatedAt, or nil if prior had the same price.
+func priceChange(product Product, prior *Product) *PriceChange {
+	reason := ReasonCreated
+	if prior != nil {
+		if prior.Price == product.Price && prior.Currency == product.Currency {
+			return nil
+		}
+		reason = ReasonUpdated
+	}
+	id := idGen.NewID()
+	changedAt := product.UpdatedAt.UTC()
+	return &PriceChange{
+		PK:        productPartition(product.ID),
+		SK:        dynamo.Compose("PRICE", changedAt.Format(stampLayout), id),
+		ID:        id,
+		ProductID: product.ID,
+		Price:     product.Price,
+		Currency:  product.Currency,
+		Reason:    reason,
+		ChangedAt: changedAt,
+	}
+}
+
+// announcePriceChange publishes product's effective price at changedAt.
+// The change itself is saved by then, so a failure is logged rather than
+// failing it.
+func announcePriceChange(ctx context.Context, product Product, changedAt time.Time, reason string) {
+	price, err := effectivePrice(ctx, product, changedAt)
+	if err != nil {
+		log.Printf("Failed to price product %s for its price change event: %v", product.ID, err)
+		return
+	}
+	detail, err := json.Marshal(PriceChangedEvent{
+		ProductID:    product.ID,
+		SKU:          product.SKU,
+		Price:        price.Price,
+		RegularPrice: price.RegularPrice,
+		Currency:     price.Currency,
+		PromotionID:  price.PromotionID,
+		Reason:       reason,
+		ChangedAt:    changedAt,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal price change event: %v", err)
+		return
+	}
+
+	result, err := eventBridgeClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{
+			{
+				EventBusName: aws.String(eventBusName),
+				Source:       aws.String(eventSource),
+				DetailType:   aws.String(detailTypePriceChanged),
+				Detail:       aws.String(string(detail)),
+				Time:         aws.Time(changedAt),
+			},
+		},
+	})
+	if err == nil && result.FailedEntryCount > 0 {
+		err = errors.New(aws.ToString(result.Entries[0].ErrorMessage))
+	}
+	if err != nil {
+		log.Printf("Failed to publish price change of product %s: %v", product.ID, err)
+	}
+}
+
+// DynamoDB operations
+
+func productPartition(productID string) string {
+	return dynamo.Compose("PRODUCT", productID)
+}
+
+func promotionKey(productID, promotionID string) dynamo.Key {
+	return dynamo.ItemKey(productPartition(productID), dynamo.Compose("PROMO", promotionID))
+}
+
+func productPromotions(ctx context.Context, productID string) ([]Promotion, error) {
+	promotions, err := dynamo.QueryAll[Promotion](ctx, prices, dynamo.Query{
+		KeyCondition: "pk = :pk AND begins_with(sk, :prefix)",
+		Values: map[string]types.AttributeValue{
+			":pk":     dynamo.S(productPartition(productID)),
+			":prefix": dynamo.S(dynamo.Prefix("PROMO")),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query promotions: %w", err)
+	}
+	return promotions, nil
+}
+
+func ignoreConditionFailed(err error) error {
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/ids"
+	"pkg/problem"
+	"pkg/search"
+	"pkg/validate"
+)
+
+// Product is the catalogue record. It is the indexed document itself, so
+// the table, the stream and the search index cannot drift apart.
+type Product = search.ProductDocument
+
+// ProductRequest creates or replaces a product.
+type ProductRequest struct {
+	SKU         string   `json:"sku" validate:"required,sku"`
+	Name        string   `json:"name" validate:"required,max=200"`
+	Description string   `json:"description" validate:"max=5000"`
+	Category    string   `json:"category" validate:"required,max=100"`
+	Brand       string   `json:"brand" validate:"max=100"`
+	Tags        []string `json:"tags" validate:"max=20"`
+	Price       float64  `json:"price" validate:"required,min=0.01,max=1000000"`
+	Currency    string   `json:"currency" validate:"required,currency"`
+	ImageURL    string   `json:"image_url" validate:"max=2048"`
+}
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+	// maxBatchProducts caps GET /products?ids=, one BatchGetItem call.
+	maxBatchProducts = 100
+	// batchGetAttempts bounds the retries of keys DynamoDB leaves
+	// unprocessed under throttling.
+	batchGetAttempts = 3
+)
+
+var errProductNotFound = errors.New("product not found")
+
+func createProductHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeProductRequest(w, r)
+	if !ok {
+		return
+	}
+
+	now := clk.Now()
+	product := req.product(idGen.NewID())
+	product.CreatedAt = now
+	product.UpdatedAt = now
+
+	if err := putProduct(r.Context(), product, "attribute_not_exists(id)", priceChange(product, nil)); err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+	announcePriceChange(r.Context(), product, product.UpdatedAt, ReasonCreated)
+	writeJSON(w, http.StatusCreated, product)
+}
+
+func getProductHandler(w http.ResponseWriter, r *http.Request) {
+	product, err := getProduct(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+// updateProductHandler replaces a product, keeping its creation time. A
+// new price is kept in the price history.
+func updateProductHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeProductRequest(w, r)
+	if !ok {
+		return
+	}
+
+	existing, err := getProduct(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+
+	product := req.product(existing.ID)
+	product.CreatedAt = existing.CreatedAt
+	product.UpdatedAt = clk.Now()
+
+	change := priceChange(product, &existing)
+	if err := putProduct(r.Context(), product, "attribute_exists(id)", change); err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+	if change != nil {
+		announcePriceChange(r.Context(), product, product.UpdatedAt, ReasonUpdated)
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+func deleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := dynamoClient.DeleteItem(r.Context(), &dynamodb.DeleteItemInput{
+		TableName:           aws.String(tableName),
+		Key:                 productKey(mux.Vars(r)["id"]),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+	})
+	var condition *types.ConditionalCheckFailedException
+	if errors.As(err, &condition) {
+		writeProductError(w, r, errProductNotFound)
+		return
+	}
+	if err != nil {
+		writeProductError(w, r, fmt.Errorf("failed to delete product: %w", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listProductsHandler pages through the catalogue in key order, or with
+// ids= returns just those products for batching callers such as the
+// GraphQL service. Browsing by text, category or price is /products/search.
+func listProductsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if idList := query.Get("ids"); idList != "" {
+		batchGetProductsHandler(w, r, idList)
+		return
+	}
+
+	limit := defaultListLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxListLimit {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxListLimit)))
+			return
+		}
+		limit = n
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+		Limit:     aws.Int32(int32(limit)),
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		input.ExclusiveStartKey = productKey(cursor)
+	}
+
+	result, err := dynamoClient.Scan(r.Context(), input)
+	if err != nil {
+		writeProductError(w, r, fmt.Errorf("failed to scan products: %w", err))
+		return
+	}
+
+	products := []Product{}
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &products); err != nil {
+		writeProductError(w, r, fmt.Errorf("failed to unmarshal products: %w", err))
+		return
+	}
+	response := map[string]interface{}{"products": products}
+	if id, ok := result.LastEvaluatedKey["id"].(*types.AttributeValueMemberS); ok {
+		response["next_cursor"] = id.Value
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// batchGetProductsHandler answers GET /products?ids=a,b,c with the
+// products that exist, in no particular order.
+func batchGetProductsHandler(w http.ResponseWriter, r *http.Request, idList string) {
+	var productIDs []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(idList, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if !ids.Valid(id) {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("ids contains an invalid product ID %q", id)))
+			return
+		}
+		seen[id] = true
+		productIDs = append(productIDs, id)
+	}
+	if len(productIDs) > maxBatchProducts {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("ids may list at most %d products", maxBatchProducts)))
+		return
+	}
+
+	products, err := batchGetProducts(r.Context(), productIDs)
+	if err != nil {
+		writeProductError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"products": products})
+}
+
+func decodeProductRequest(w http.ResponseWriter, r *http.Request) (ProductRequest, bool) {
+	var req ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return req, false
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return req, false
+	}
+	return req, true
+}
+
+func (req ProductRequest) product(id string) Product {
+	return Product{
+		ID:          id,
+		SKU:         req.SKU,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Category:    req.Category,
+		Brand:       req.Brand,
+		Tags:        req.Tags,
+		Price:       req.Price,
+		Currency:    req.Currency,
+		ImageURL:    req.ImageURL,
+	}
+}
+
+func writeProductError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errProductNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Product not found"))
+	default:
+		log.Printf("Product operation failed: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+	}
+}
+
+// DynamoDB operations
+
+func getProduct(ctx context.Context, id string) (Product, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       productKey(id),
+	})
+	if err != nil {
+		return Product{}, fmt.Errorf("failed to get product: %w", err)
+	}
+	if len(result.Item) == 0 {
+		return Product{}, errProductNotFound
+	}
+
+	var product Product
+	if err := attributevalue.UnmarshalMap(result.Item, &product); err != nil {
+		return Product{}, fmt.Errorf("failed to unmarshal product: %w", err)
+	}
+	return product, nil
+}
+
+// putProduct writes product under condition, mapping a failed condition
+// to errProductNotFound for updates. A price change is recorded in the
+// same transaction.
+func putProduct(ctx context.Context, product Product, condition string, change *PriceChange) error {
+	item, err := attributevalue.MarshalMap(product)
+	if err != nil {
+		return fmt.Errorf("failed to marshal product: %w", err)
+	}
+
+	if change == nil {
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(tableName),
+			Item:                item,
+			ConditionExpression: aws.String(condition),
+		})
+	} else {
+		var record map[string]types.AttributeValue
+		record, err = attributevalue.MarshalMap(change)
+		if err != nil {
+			return fmt.Errorf("failed to marshal price change: %w", err)
+		}
+		_, err = dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{Put: &types.Put{TableName: aws.String(tableName), Item: item, ConditionExpression: aws.String(condition)}},
+				{Put: &types.Put{TableName: aws.String(prices.Name), Item: record}},
+			},
+		})
+	}
+	var failed *types.ConditionalCheckFailedException
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &failed) || (errors.As(err, &canceled) && len(canceled.CancellationReasons) > 0 &&
+		aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed") {
+		if condition == "attribute_exists(id)" {
+			return errProductNotFound
+		}
+		return fmt.Errorf("product %s already exists", product.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put product: %w", err)
+	}
+	return nil
+}
+
+// batchGetProducts reads up to maxBatchProducts products in one
+// BatchGetItem call, retrying any keys DynamoDB did not process.
+func batchGetProducts(ctx context.Context, productIDs []string) ([]Product, error) {
+	products := []Product{}
+	if len(productIDs) == 0 {
+		return products, nil
+	}
+
+	keys := make([]map[string]types.AttributeValue, 0, len(productIDs))
+	for _, id := range productIDs {
+		keys = append(keys, productKey(id))
+	}
+	request := map[string]types.KeysAndAttributes{
+		tableName: {Keys: keys},
+	}
+
+	for attempt := 0; len(request) > 0; attempt++ {
+		if attempt == batchGetAttempts {
+			return nil, fmt.Errorf("failed to get products: keys still unprocessed after %d attempts", batchGetAttempts)
+		}
+		result, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+		if err != nil {
+			return nil, fmt.Errorf("failed to batch get products: %w", err)
+		}
+		var page []Product
+		if err := attributevalue.UnmarshalListOfMaps(result.Responses[tableName], &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal products: %w", err)
+		}
+		products = append(products, page...)
+		request = result.UnprocessedKeys
+	}
+	return products, nil
+}
+
+func productKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: id},
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pkg/ids"
+	"pkg/problem"
+	"pkg/search"
+)
+
+// Dynamic remarketing. The storefront's tagging layer asks for the
+// parameters of the page being shown and passes them to the Google Ads tag
+// unchanged, so the product IDs remarketing lists and dynamic ads are
+// built from are always catalogue IDs, which are the Merchant Center item
+// IDs. Products the page names that are not in the catalogue are left out
+// rather than sent on.
+//
+// Cart pages read the cart from cart-service and purchase pages the
+// checkout from checkout-service; their lines carry SKUs, which the
+// product index resolves to IDs.
+
+// Remarketing page types, as Google Ads defines ecomm_pagetype for retail.
+const (
+	PageHome          = "home"
+	PageSearchResults = "searchresults"
+	PageCategory      = "category"
+	PageProduct       = "product"
+	PageCart          = "cart"
+	PagePurchase      = "purchase"
+	PageOther         = "other"
+)
+
+// RemarketingParams is the payload of a page's remarketing tag.
+// TotalValue is set on product, cart and purchase pages; Currency goes
+// with it.
+type RemarketingParams struct {
+	PageType   string   `json:"ecomm_pagetype"`
+	ProductIDs []string `json:"ecomm_prodid"`
+	TotalValue *float64 `json:"ecomm_totalvalue,omitempty"`
+	Currency   string   `json:"currency,omitempty"`
+}
+
+// orderLines is the part of a cart or checkout the parameters are built
+// from.
+type orderLines struct {
+	Status   string  `json:"status"`
+	Currency string  `json:"currency"`
+	Total    float64 `json:"total"`
+	Items    []struct {
+		SKU       string  `json:"sku"`
+		Quantity  int     `json:"quantity"`
+		UnitPrice float64 `json:"unit_price"`
+	} `json:"items"`
+}
+
+var (
+	// backendClient calls cart- and checkout-service.
+	backendClient = &http.Client{Timeout: 5 * time.Second}
+
+	errLinesNotFound      = errors.New("cart or checkout not found")
+	errCheckoutIncomplete = errors.New("checkout has not completed")
+	errSearchDisabled     = errors.New("product search is not configured")
+)
+
+// remarketingHandler answers GET /products/remarketing with the
+// remarketing parameters of a storefront page.
+//
+//	pagetype     home, searchresults, category, product, cart, purchase or other
+//	id           the product shown on a product page, or the products
+//	             listed on a search results or category page, comma
+//	             separated or repeated
+//	cart_id      the cart shown on a cart page
+//	checkout_id  the completed checkout a purchase page confirms
+func remarketingHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params := RemarketingParams{PageType: q.Get("pagetype"), ProductIDs: []string{}}
+	productIDs := listParam(q["id"])
+
+	var err error
+	switch params.PageType {
+	case PageHome, PageOther:
+	case PageSearchResults, PageCategory:
+		err = params.listing(r.Context(), productIDs)
+	case PageProduct:
+		if len(productIDs) != 1 {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "A product page needs exactly one id"))
+			return
+		}
+		err = params.product(r.Context(), productIDs[0])
+	case PageCart:
+		err = params.lines(r, cartServiceURL, "/carts/", "cart_id")
+	case PagePurchase:
+		err = params.lines(r, checkoutServiceURL, "/checkout/", "checkout_id")
+	default:
+		problem.Write(w, r, problem.New(http.StatusBadRequest,
+			"pagetype must be one of home, searchresults, category, product, cart, purchase or other"))
+		return
+	}
+
+	var bad *badRemarketingRequest
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, params)
+	case errors.As(err, &bad):
+		problem.Write(w, r, problem.New(http.StatusBadRequest, bad.message))
+	case errors.Is(err, errProductNotFound), errors.Is(err, errLinesNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, capitalize(err.Error())))
+	case errors.Is(err, errCheckoutIncomplete):
+		problem.Write(w, r, problem.New(http.StatusConflict, capitalize(err.Error())))
+	case errors.Is(err, errSearchDisabled):
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Product search is not configured"))
+	default:
+		log.Printf("Failed to build remarketing parameters for %s page: %v", params.PageType, err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, "Remarketing parameters are unavailable"))
+	}
+}
+
+// badRemarketingRequest is a page description that cannot be answered.
+type badRemarketingRequest struct{ message string }
+
+func (e *badRemarketingRequest) Error() string { return e.message }
+
+// checkoutCompleted is checkout-service's status of a paid order.
+const checkoutCompleted = "COMPLETED"
+
+// listing keeps the listed products that are in the catalogue, in order.
+func (p *RemarketingParams) listing(ctx context.Context, productIDs []string) error {
+	if len(productIDs) > maxBatchProducts {
+		return &badRemarketingRequest{fmt.Sprintf("id may list at most %d products", maxBatchProducts)}
+	}
+	var valid []string
+	for _, id := range productIDs {
+		if ids.Valid(id) {
+			valid = append(valid, id)
+		}
+	}
+	valid = dedupe(valid)
+	products, err := batchGetProducts(ctx, valid)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool, len(products))
+	for _, product := range products {
+		found[product.ID] = true
+	}
+	for _, id := range valid {
+		if found[id] {
+			p.ProductIDs = append(p.ProductIDs, id)
+		}
+	}
+	return nil
+}
+
+// product sets a product page's ID and its effective price now.
+func (p *RemarketingParams) product(ctx context.Context, productID string) error {
+	if !ids.Valid(productID) {
+		return errProductNotFound
+	}
+	product, err := getProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	price, err := effectivePrice(ctx, product, clk.Now())
+	if err != nil {
+		return err
+	}
+	p.ProductIDs = []string{product.ID}
+	p.TotalValue, p.Currency = &price.Price, price.Currency
+	return nil
+}
+
+// lines sets the products and total of the cart or checkout named by the
+// query parameter param, read from the service at baseURL under path.
+func (p *RemarketingParams) lines(r *http.Request, baseURL, path, param string) error {
+	id := r.URL.Query().Get(param)
+	if !ids.Valid(id) {
+		return &badRemarketingRequest{"A " + p.PageType + " page needs a valid " + param}
+	}
+	if baseURL == "" {
+		return fmt.Errorf("no service is configured for %s pages", p.PageType)
+	}
+	if searchClient == nil {
+		return errSearchDisabled
+	}
+
+	var order orderLines
+	if err := getLines(r, baseURL+path+url.PathEscape(id), &order); err != nil {
+		return err
+	}
+	if p.PageType == PagePurchase && order.Status != checkoutCompleted {
+		return errCheckoutIncomplete
+	}
+	skus := make([]string, 0, len(order.Items))
+	total := 0.0
+	for _, item := range order.Items {
+		skus = append(skus, item.SKU)
+		total += float64(item.Quantity) * item.UnitPrice
+	}
+	productIDs, err := productIDsBySKU(r.Context(), dedupe(skus))
+	if err != nil {
+		return err
+	}
+	for _, sku := range dedupe(skus) {
+		if productID, ok := productIDs[sku]; ok {
+			p.ProductIDs = append(p.ProductIDs, productID)
+		} else {
+			log.Printf("SKU %s of %s %s is not in the catalogue; left out of remarketing", sku, param, id)
+		}
+	}
+
+	// A checkout's total is what was paid, after any discount.
+	if order.Total > 0 {
+		total = order.Total
+	}
+	total = math.Round(total*100) / 100
+	p.TotalValue, p.Currency = &total, order.Currency
+	return nil
+}
+
+// getLines reads a cart or checkout as the caller, so the owning service
+// applies its own access rules.
+func getLines(r *http.Request, target string, out *orderLines) error {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for _, header := range []string{"X-Request-Id", "X-User-Id", "X-Tenant-Id"} {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	resp, err := backendClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusForbidden:
+		return errLinesNotFound
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("%s returned %d", target, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", target, err)
+	}
+	return nil
+}
+
+// productIDsBySKU resolves SKUs to product IDs through the product index.
+func productIDsBySKU(ctx context.Context, skus []string) (map[string]string, error) {
+	found := make(map[string]string, len(skus))
+	if len(skus) == 0 {
+		return found, nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"size":    len(skus),
+		"_source": []string{"id", "sku"},
+		"query":   map[string]interface{}{"bool": map[string]interface{}{"filter": termsFilter("sku", skus)}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SKU query: %w", err)
+	}
+
+	var result searchResult
+	if err := searchClient.Do(ctx, http.MethodPost, "/"+search.ProductIndex+"/_search", body, &result); err != nil {
+		return nil, fmt.Errorf("failed to look up SKUs: %w", err)
+	}
+	for _, hit := range result.Hits.Hits {
+		found[hit.Source.SKU] = hit.Source.ID
+	}
+	return found, nil
+}
+
+// dedupe is values without repeats, in first-seen order.
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pkg/problem"
+	"pkg/search"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	// maxResultWindow is OpenSearch's default index.max_result_window;
+	// deeper pages must narrow the query instead.
+	maxResultWindow = 10000
+	// facetSize is how many category and brand values are counted.
+	facetSize = 20
+)
+
+// searchSorts are the accepted sort= values. relevance is the default
+// with a query and newest without one.
+var searchSorts = map[string][]interface{}{
+	"relevance":  {"_score", map[string]string{"updated_at": "desc"}},
+	"newest":     {map[string]string{"created_at": "desc"}},
+	"price_asc":  {map[string]string{"price": "asc"}},
+	"price_desc": {map[string]string{"price": "desc"}},
+	"name":       {map[string]string{"name.raw": "asc"}},
+}
+
+// priceRanges are the buckets of the price facet.
+var priceRanges = []map[string]interface{}{
+	{"key": "under-25", "to": 25},
+	{"key": "25-50", "from": 25, "to": 50},
+	{"key": "50-100", "from": 50, "to": 100},
+	{"key": "100-250", "from": 100, "to": 250},
+	{"key": "250-plus", "from": 250},
+}
+
+// SearchResponse is a page of matching products with facet counts.
+type SearchResponse struct {
+	Total    int                      `json:"total"`
+	Page     int                      `json:"page"`
+	PageSize int                      `json:"page_size"`
+	Products []Product                `json:"products"`
+	Facets   map[string][]FacetBucket `json:"facets"`
+}
+
+// FacetBucket is one value of a facet and how many products have it. From
+// and To bound price buckets.
+type FacetBucket struct {
+	Value string   `json:"value"`
+	Count int      `json:"count"`
+	From  *float64 `json:"from,omitempty"`
+	To    *float64 `json:"to,omitempty"`
+}
+
+// searchRequest is a parsed GET /products/search.
+type searchRequest struct {
+	text       string
+	categories []string
+	brands     []string
+	tags       []string
+	skus       []string
+	minPrice   *float64
+	maxPrice   *float64
+	sort       string
+	page       int
+	pageSize   int
+}
+
+// searchProductsHandler runs full-text search over the product index.
+//
+//	q          text matched against name, brand, category and description
+//	category   exact categories, comma separated or repeated
+//	brand      exact brands, comma separated or repeated
+//	tag        products must carry every tag given
+//	sku        exact SKUs, comma separated or repeated
+//	min_price  lowest price, inclusive
+//	max_price  highest price, inclusive
+//	sort       relevance, newest, price_asc, price_desc or name
+//	page       1-based page number
+//	page_size  1-100, default 20
+//
+// Each facet is counted with every filter except its own, so selecting a
+// category still shows how many products the other categories have.
+func searchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	if searchClient == nil {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Product search is not configured"))
+		return
+	}
+
+	req, err := parseSearchRequest(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	body, err := json.Marshal(req.query())
+	if err != nil {
+		log.Printf("Failed to encode search query: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	var result searchResult
+	err = searchClient.Do(r.Context(), http.MethodPost, "/"+search.ProductIndex+"/_search", body, &result)
+	if err != nil {
+		log.Printf("Failed to search products: %v", err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, "Product search is unavailable"))
+		return
+	}
+
+	response := SearchResponse{
+		Total:    result.Hits.Total.Value,
+		Page:     req.page,
+		PageSize: req.pageSize,
+		Products: make([]Product, 0, len(result.Hits.Hits)),
+		Facets: map[string][]FacetBucket{
+			"category": result.Aggregations.Category.Values.buckets(),
+			"brand":    result.Aggregations.Brand.Values.buckets(),
+			"price":    result.Aggregations.Price.Values.buckets(),
+		},
+	}
+	for _, hit := range result.Hits.Hits {
+		response.Products = append(response.Products, hit.Source)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func parseSearchRequest(r *http.Request) (searchRequest, error) {
+	q := r.URL.Query()
+	req := searchRequest{
+		text:       strings.TrimSpace(q.Get("q")),
+		categories: listParam(q["category"]),
+		brands:     listParam(q["brand"]),
+		tags:       listParam(q["tag"]),
+		skus:       listParam(q["sku"]),
+		sort:       q.Get("sort"),
+		page:       1,
+		pageSize:   defaultPageSize,
+	}
+	if len(req.text) > 200 {
+		return req, fmt.Errorf("q must be at most 200 characters")
+	}
+
+	for name, target := range map[string]**float64{"min_price": &req.minPrice, "max_price": &req.maxPrice} {
+		if value := q.Get(name); value != "" {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil || price < 0 {
+				return req, fmt.Errorf("%s must be a non-negative number", name)
+			}
+			*target = &price
+		}
+	}
+	if req.minPrice != nil && req.maxPrice != nil && *req.minPrice > *req.maxPrice {
+		return req, fmt.Errorf("min_price must not exceed max_price")
+	}
+
+	if req.sort == "" {
+		req.sort = "newest"
+		if req.text != "" {
+			req.sort = "relevance"
+		}
+	}
+	if _, ok := searchSorts[req.sort]; !ok {
+		return req, fmt.Errorf("sort must be one of relevance, newest, price_asc, price_desc or name")
+	}
+
+	if value := q.Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return req, fmt.Errorf("page must be a positive integer")
+		}
+		req.page = n
+	}
+	if value := q.Get("page_size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			return req, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+		}
+		req.pageSize = n
+	}
+	if req.page*req.pageSize > maxResultWindow {
+		return req, fmt.Errorf("results beyond the first %d cannot be paged to; narrow the search", maxResultWindow)
+	}
+	return req, nil
+}
+
+// query builds the OpenSearch request. Text, price, tag and SKU filters
+// restrict everything; category and brand go in post_filter so the facets
+// can leave out their own selection.
+func (req searchRequest) query() map[string]interface{} {
+	var must interface{} = map[string]interface{}{"match_all": map[string]interface{}{}}
+	if req.text != "" {
+		must = map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":     req.text,
+				"fields":    []string{"name^3", "brand^2", "category^2", "description"},
+				"fuzziness": "AUTO",
+				"operator":  "and",
+			},
+		}
+	}
+
+	var filters []interface{}
+	if req.minPrice != nil || req.maxPrice != nil {
+		priceRange := map[string]interface{}{}
+		if req.minPrice != nil {
+			priceRange["gte"] = *req.minPrice
+		}
+		if req.maxPrice != nil {
+			priceRange["lte"] = *req.maxPrice
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"price": priceRange}})
+	}
+	for _, tag := range req.tags {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"tags": tag}})
+	}
+	if skuFilter := termsFilter("sku", req.skus); skuFilter != nil {
+		filters = append(filters, skuFilter)
+	}
+
+	categoryFilter := termsFilter("category", req.categories)
+	brandFilter := termsFilter("brand", req.brands)
+
+	return map[string]interface{}{
+		"from":             (req.page - 1) * req.pageSize,
+		"size":             req.pageSize,
+		"track_total_hits": true,
+		"sort":             searchSorts[req.sort],
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"must": must, "filter": nonNil(filters)},
+		},
+		"post_filter": boolFilter(categoryFilter, brandFilter),
+		"aggs": map[string]interface{}{
+			"category": facet(boolFilter(brandFilter), map[string]interface{}{
+				"terms": map[string]interface{}{"field": "category", "size": facetSize},
+			}),
+			"brand": facet(boolFilter(categoryFilter), map[string]interface{}{
+				"terms": map[string]interface{}{"field": "brand", "size": facetSize},
+			}),
+			"price": facet(boolFilter(categoryFilter, brandFilter), map[string]interface{}{
+				"range": map[string]interface{}{"field": "price", "ranges": priceRanges},
+			}),
+		},
+	}
+}
+
+// searchResult is the part of an OpenSearch search response we read.
+type searchResult struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source Product `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations struct {
+		Category facetResult `json:"category"`
+		Brand    facetResult `json:"brand"`
+		Price    facetResult `json:"price"`
+	} `json:"aggregations"`
+}
+
+type facetResult struct {
+	Values aggregationBuckets `json:"values"`
+}
+
+type aggregationBuckets struct {
+	Buckets []struct {
+		Key      interface{} `json:"key"`
+		DocCount int         `json:"doc_count"`
+		From     *float64    `json:"from"`
+		To       *float64    `json:"to"`
+	} `json:"buckets"`
+}
+
+func (a aggregationBuckets) buckets() []FacetBucket {
+	buckets := make([]FacetBucket, 0, len(a.Buckets))
+	for _, b := range a.Buckets {
+		buckets = append(buckets, FacetBucket{
+			Value: fmt.Sprint(b.Key),
+			Count: b.DocCount,
+			From:  b.From,
+			To:    b.To,
+		})
+	}
+	return buckets
+}
+
+// facet wraps an aggregation in the filter that leaves out the facet's
+// own selection.
+func facet(filter map[string]interface{}, agg map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"filter": filter,
+		"aggs":   map[string]interface{}{"values": agg},
+	}
+}
+
+func termsFilter(field string, values []string) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"terms": map[string]interface{}{field: values}}
+}
+
+// boolFilter ANDs the non-nil filters; with none it matches everything.
+func boolFilter(filters ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": nonNil(filters)}}
+}
+
+func nonNil(filters []interface{}) []interface{} {
+	out := []interface{}{}
+	for _, f := range filters {
+		if f != nil {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// listParam accepts both repeated and comma separated values.
+func listParam(values []string) []string {
+	var out []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
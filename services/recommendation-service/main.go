@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/health"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/metrics"
+	"pkg/recovery"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient         *dynamodb.Client
+	sqsClient            *sqs.Client
+	coPurchasesTable     string
+	userPurchasesTable   string
+	processedOrdersTable string
+	orderEventsQueueURL  string
+	serverPort           string
+	version              = "1.0.0"
+
+	// minCoPurchases is how many orders must contain a pair before it is
+	// recommended; single co-purchases are mostly noise.
+	minCoPurchases int
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	sqsClient = sqs.NewFromConfig(cfg)
+	coPurchasesTable = getEnv("CO_PURCHASES_TABLE_NAME", "co-purchases")
+	userPurchasesTable = getEnv("USER_PURCHASES_TABLE_NAME", "user-purchases")
+	processedOrdersTable = getEnv("PROCESSED_ORDERS_TABLE_NAME", "recommendation-orders")
+	orderEventsQueueURL = os.Getenv("ORDER_EVENTS_QUEUE_URL")
+	serverPort = getEnv("PORT", "3007")
+	minCoPurchases = getEnvInt("MIN_CO_PURCHASES", 2)
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+	recoverer = recovery.New("recommendation-service", clk, idGen)
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware)
+
+	// Request count, error rate and latency per route, scraped from
+	// /metrics
+	registry := metrics.NewRegistry()
+	router.Use(metrics.NewHTTP(registry, "recommendation-service", routeTemplate, clk).Middleware)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id", "productId"))
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("recommendation-service", clk,
+		health.Table(dynamoClient, coPurchasesTable, true),
+		health.Table(dynamoClient, userPurchasesTable, true),
+		health.Table(dynamoClient, processedOrdersTable, false),
+	).Handler()).Methods("GET")
+	router.Handle("/metrics", registry.Handler()).Methods("GET")
+
+	// Test hooks; order events are posted directly instead of polled
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs, order events via /__test/order-events")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+		router.HandleFunc("/__test/order-events", orderEventHandler).Methods("POST")
+	} else if orderEventsQueueURL != "" {
+		go runOrderEventConsumer(context.Background())
+	} else {
+		log.Printf("ORDER_EVENTS_QUEUE_URL not set, co-purchase counts will not be updated")
+	}
+
+	// Recommendation endpoints
+	router.HandleFunc("/recommendations/{productId}", productRecommendationsHandler).Methods("GET")
+	router.HandleFunc("/users/{id}/recommendations", userRecommendationsHandler).Methods("GET")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Recommendation service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "recommendation-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// routeTemplate labels metrics with the matched route rather than the raw
+// path, which would give every product and user its own series.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
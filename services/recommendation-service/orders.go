@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"pkg/events"
+	"pkg/ids"
+	"pkg/problem"
+)
+
+const (
+	// maxOrderProducts bounds the pair updates of one order, which grow
+	// with the square of its distinct products.
+	maxOrderProducts = 20
+	// pairWriters is how many pair updates run concurrently.
+	pairWriters = 8
+	// processedOrderTTL keeps dedupe records well beyond the queue's
+	// retention, after which a redelivery is impossible.
+	processedOrderTTL = 30 * 24 * time.Hour
+	// receiveBackoff is the pause after a failed receive.
+	receiveBackoff = 5 * time.Second
+)
+
+// OrderEvent is an EventBridge event as delivered to the queue.
+type OrderEvent struct {
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// runOrderEventConsumer long-polls the order events queue until ctx is
+// done. Messages are deleted once applied; failures are left for the queue
+// to redeliver and, after repeated failures, move to its dead-letter queue.
+func runOrderEventConsumer(ctx context.Context) {
+	log.Printf("Consuming order events from %s", orderEventsQueueURL)
+	for ctx.Err() == nil {
+		recoverer.Do("order event poll", func() {
+			if err := pollOrderEvents(ctx); err != nil {
+				log.Printf("Failed to receive order events: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(receiveBackoff):
+				}
+			}
+		})
+	}
+}
+
+func pollOrderEvents(ctx context.Context) error {
+	result, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(orderEventsQueueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range result.Messages {
+		if err := handleOrderMessage(ctx, aws.ToString(message.Body)); err != nil {
+			log.Printf("Failed to apply order event %s, leaving it for redelivery: %v", aws.ToString(message.MessageId), err)
+			continue
+		}
+		_, err := sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(orderEventsQueueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+		if err != nil {
+			// Redelivery is harmless: the order is already marked processed.
+			log.Printf("Failed to delete order event %s: %v", aws.ToString(message.MessageId), err)
+		}
+	}
+	return nil
+}
+
+// handleOrderMessage applies one queued event. Only errors worth retrying
+// are returned; malformed or irrelevant events are logged and dropped.
+func handleOrderMessage(ctx context.Context, body string) error {
+	var event OrderEvent
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		log.Printf("Dropping malformed order event: %v", err)
+		return nil
+	}
+	// The queue's EventBridge rule delivers only completed orders, but
+	// other detail types are tolerated and dropped.
+	if event.DetailType != events.DetailTypeOrderCompleted {
+		log.Printf("Ignoring event %s with detail type %q", event.ID, event.DetailType)
+		return nil
+	}
+
+	var order events.OrderCompleted
+	if _, err := events.Unmarshal(event.Detail, &order); err != nil {
+		log.Printf("Dropping order event %s: %v", event.ID, err)
+		return nil
+	}
+	return recordOrder(ctx, order)
+}
+
+// orderEventHandler applies a posted EventBridge event; registered only in
+// test mode, where there is no queue.
+func orderEventHandler(w http.ResponseWriter, r *http.Request) {
+	var event OrderEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be an EventBridge event"))
+		return
+	}
+	body, _ := json.Marshal(event)
+	if err := handleOrderMessage(r.Context(), string(body)); err != nil {
+		log.Printf("Failed to apply order event %s: %v", event.ID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordOrder adds one to the co-purchase count of every pair of products
+// in order, in both directions, and of each product with itself, which
+// counts the orders containing it. The buyer's purchases are recorded for
+// user recommendations.
+//
+// The order is claimed first so a redelivered event is not counted twice.
+// If an update then fails the claim is released for the retry; updates
+// that already succeeded are counted again, an overcount of one order that
+// the scores tolerate.
+func recordOrder(ctx context.Context, order events.OrderCompleted) error {
+	products := orderProducts(order)
+	if len(products) == 0 {
+		return nil
+	}
+
+	claimed, err := claimOrder(ctx, order.OrderID)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Printf("Order %s already recorded", order.OrderID)
+		return nil
+	}
+
+	if err := applyOrder(ctx, order, products); err != nil {
+		releaseOrder(ctx, order.OrderID)
+		return err
+	}
+	log.Printf("Recorded order %s with %d products", order.OrderID, len(products))
+	return nil
+}
+
+// orderProducts returns the order's distinct product IDs in order of
+// appearance, at most maxOrderProducts of them.
+func orderProducts(order events.OrderCompleted) []string {
+	var products []string
+	seen := make(map[string]bool)
+	for _, item := range order.Items {
+		if !ids.Valid(item.ProductID) || seen[item.ProductID] {
+			continue
+		}
+		seen[item.ProductID] = true
+		products = append(products, item.ProductID)
+		if len(products) == maxOrderProducts {
+			break
+		}
+	}
+	return products
+}
+
+func applyOrder(ctx context.Context, order events.OrderCompleted, products []string) error {
+	now := clk.Now().UTC().Format(time.RFC3339)
+
+	type pair struct{ product, related string }
+	pairs := make(chan pair)
+	errs := make(chan error, pairWriters)
+	var wg sync.WaitGroup
+	for i := 0; i < pairWriters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range pairs {
+				if err := incrementCoPurchase(ctx, p.product, p.related, now); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+send:
+	for _, product := range products {
+		for _, related := range products {
+			select {
+			case pairs <- pair{product, related}:
+			case err = <-errs:
+				break send
+			}
+		}
+	}
+	close(pairs)
+	wg.Wait()
+	close(errs)
+	if err == nil {
+		err = <-errs
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update co-purchases of order %s: %w", order.OrderID, err)
+	}
+
+	if order.UserID == "" {
+		return nil
+	}
+	for _, product := range products {
+		if err := recordPurchase(ctx, order.UserID, product, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DynamoDB operations
+
+func claimOrder(ctx context.Context, orderID string) (bool, error) {
+	now := clk.Now()
+	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(processedOrdersTable),
+		Item: map[string]types.AttributeValue{
+			"order_id":     &types.AttributeValueMemberS{Value: orderID},
+			"processed_at": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			"expires_at":   &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(processedOrderTTL).Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(order_id)"),
+	})
+	var condition *types.ConditionalCheckFailedException
+	if errors.As(err, &condition) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim order %s: %w", orderID, err)
+	}
+	return true, nil
+}
+
+func releaseOrder(ctx context.Context, orderID string) {
+	_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(processedOrdersTable),
+		Key: map[string]types.AttributeValue{
+			"order_id": &types.AttributeValueMemberS{Value: orderID},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to release order %s; its redelivery will be skipped: %v", orderID, err)
+	}
+}
+
+func incrementCoPurchase(ctx context.Context, product, related, now string) error {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(coPurchasesTable),
+		Key: map[string]types.AttributeValue{
+			"product_id": &types.AttributeValueMemberS{Value: product},
+			"related_id": &types.AttributeValueMemberS{Value: related},
+		},
+		UpdateExpression: aws.String("ADD co_purchases :one SET updated_at = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+			":now": &types.AttributeValueMemberS{Value: now},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to increment %s/%s: %w", product, related, err)
+	}
+	return nil
+}
+
+func recordPurchase(ctx context.Context, userID, productID, now string) error {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(userPurchasesTable),
+		Key: map[string]types.AttributeValue{
+			"user_id":    &types.AttributeValueMemberS{Value: userID},
+			"product_id": &types.AttributeValueMemberS{Value: productID},
+		},
+		UpdateExpression: aws.String("ADD purchases :one SET last_purchased_at = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+			":now": &types.AttributeValueMemberS{Value: now},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record purchase of %s by %s: %w", productID, userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/problem"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 50
+	// maxCandidateRows bounds how much of a popular product's co-purchase
+	// partition is read per request.
+	maxCandidateRows = 1000
+	// maxCandidates is how many of the most co-purchased products are
+	// scored; the rest are too rare to rank.
+	maxCandidates = 100
+	// seedPurchases is how many of a user's most recent purchases seed
+	// their recommendations.
+	seedPurchases = 10
+	// maxReasons caps the purchases listed as the reason for a user
+	// recommendation.
+	maxReasons = 3
+	// batchGetSize is DynamoDB's BatchGetItem key limit.
+	batchGetSize = 100
+)
+
+// Recommendation is a product bought together with the requested one.
+// Score is the cosine similarity of the two products' buyers: co-purchases
+// divided by the geometric mean of each product's order count, so a
+// bestseller bought alongside everything does not outrank a true
+// complement.
+type Recommendation struct {
+	ProductID   string  `json:"product_id"`
+	Score       float64 `json:"score"`
+	CoPurchases int     `json:"co_purchases"`
+}
+
+// UserRecommendation is a product scored against a user's recent
+// purchases. Score sums its similarity to each of them; Because lists the
+// purchases contributing most.
+type UserRecommendation struct {
+	ProductID string   `json:"product_id"`
+	Score     float64  `json:"score"`
+	Because   []string `json:"because"`
+}
+
+// CoPurchase is one cell of the co-purchase matrix; the diagonal
+// (RelatedID == ProductID) counts the orders containing the product.
+type CoPurchase struct {
+	ProductID   string `dynamodbav:"product_id"`
+	RelatedID   string `dynamodbav:"related_id"`
+	CoPurchases int    `dynamodbav:"co_purchases"`
+	UpdatedAt   string `dynamodbav:"updated_at"`
+}
+
+// Purchase is a product a user has bought.
+type Purchase struct {
+	UserID          string `dynamodbav:"user_id"`
+	ProductID       string `dynamodbav:"product_id"`
+	Purchases       int    `dynamodbav:"purchases"`
+	LastPurchasedAt string `dynamodbav:"last_purchased_at"`
+}
+
+// productRecommendationsHandler returns the products most often bought
+// with productId, best first. A product with no qualifying co-purchases
+// gets an empty list rather than a 404.
+func productRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+	productID := mux.Vars(r)["productId"]
+
+	recommendations, err := relatedProducts(r.Context(), productID)
+	if err != nil {
+		log.Printf("Failed to recommend for product %s: %v", productID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"product_id":      productID,
+		"recommendations": recommendations,
+	})
+}
+
+// userRecommendationsHandler combines the recommendations of the user's
+// most recent purchases, leaving out anything they have already bought.
+func userRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+	userID := mux.Vars(r)["id"]
+
+	recommendations, err := recommendForUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to recommend for user %s: %v", userID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":         userID,
+		"recommendations": recommendations,
+	})
+}
+
+func parseLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLimit, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxLimit {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxLimit)))
+		return 0, false
+	}
+	return n, true
+}
+
+// relatedProducts scores every product co-purchased with productID at
+// least minCoPurchases times, best first.
+func relatedProducts(ctx context.Context, productID string) ([]Recommendation, error) {
+	cells, err := coPurchasesOf(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := 0
+	var candidates []CoPurchase
+	for _, cell := range cells {
+		switch {
+		case cell.RelatedID == productID:
+			orders = cell.CoPurchases
+		case cell.CoPurchases >= minCoPurchases:
+			candidates = append(candidates, cell)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CoPurchases > candidates[j].CoPurchases
+	})
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+	if len(candidates) == 0 {
+		return []Recommendation{}, nil
+	}
+
+	candidateIDs := make([]string, len(candidates))
+	for i, c := range candidates {
+		candidateIDs[i] = c.RelatedID
+	}
+	orderCounts, err := orderCountsOf(ctx, candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]Recommendation, 0, len(candidates))
+	for _, c := range candidates {
+		recommendations = append(recommendations, Recommendation{
+			ProductID:   c.RelatedID,
+			Score:       cosine(c.CoPurchases, orders, orderCounts[c.RelatedID]),
+			CoPurchases: c.CoPurchases,
+		})
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		a, b := recommendations[i], recommendations[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.CoPurchases != b.CoPurchases {
+			return a.CoPurchases > b.CoPurchases
+		}
+		return a.ProductID < b.ProductID
+	})
+	return recommendations, nil
+}
+
+func recommendForUser(ctx context.Context, userID string) ([]UserRecommendation, error) {
+	purchases, err := purchasesOf(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	bought := make(map[string]bool, len(purchases))
+	for _, p := range purchases {
+		bought[p.ProductID] = true
+	}
+	// RFC 3339 UTC timestamps sort chronologically as strings.
+	sort.Slice(purchases, func(i, j int) bool {
+		return purchases[i].LastPurchasedAt > purchases[j].LastPurchasedAt
+	})
+	if len(purchases) > seedPurchases {
+		purchases = purchases[:seedPurchases]
+	}
+
+	type contribution struct {
+		seed  string
+		score float64
+	}
+	scores := make(map[string]float64)
+	reasons := make(map[string][]contribution)
+	for _, seed := range purchases {
+		related, err := relatedProducts(ctx, seed.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range related {
+			if bought[rec.ProductID] {
+				continue
+			}
+			scores[rec.ProductID] += rec.Score
+			reasons[rec.ProductID] = append(reasons[rec.ProductID], contribution{seed.ProductID, rec.Score})
+		}
+	}
+
+	recommendations := make([]UserRecommendation, 0, len(scores))
+	for productID, score := range scores {
+		contributions := reasons[productID]
+		sort.SliceStable(contributions, func(i, j int) bool {
+			return contributions[i].score > contributions[j].score
+		})
+		because := make([]string, 0, maxReasons)
+		for _, c := range contributions {
+			if len(because) == maxReasons {
+				break
+			}
+			because = append(because, c.seed)
+		}
+		recommendations = append(recommendations, UserRecommendation{
+			ProductID: productID,
+			Score:     round(score),
+			Because:   because,
+		})
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		a, b := recommendations[i], recommendations[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.ProductID < b.ProductID
+	})
+	return recommendations, nil
+}
+
+// cosine is co-purchases over the geometric mean of the two order counts.
+// A missing count (the diagonal lags or was never written) falls back to
+// the co-purchases themselves, the smallest the count can be.
+func cosine(coPurchases, ordersA, ordersB int) float64 {
+	if ordersA < coPurchases {
+		ordersA = coPurchases
+	}
+	if ordersB < coPurchases {
+		ordersB = coPurchases
+	}
+	return round(float64(coPurchases) / math.Sqrt(float64(ordersA)*float64(ordersB)))
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// DynamoDB operations
+
+// coPurchasesOf reads productID's row of the co-purchase matrix, up to
+// maxCandidateRows cells.
+func coPurchasesOf(ctx context.Context, productID string) ([]CoPurchase, error) {
+	var cells []CoPurchase
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(coPurchasesTable),
+		KeyConditionExpression: aws.String("product_id = :product_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":product_id": &types.AttributeValueMemberS{Value: productID},
+		},
+	}
+	for len(cells) < maxCandidateRows {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query co-purchases of %s: %w", productID, err)
+		}
+		var page []CoPurchase
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal co-purchases: %w", err)
+		}
+		cells = append(cells, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	return cells, nil
+}
+
+// orderCountsOf reads the diagonal cell, the order count, of each product.
+func orderCountsOf(ctx context.Context, productIDs []string) (map[string]int, error) {
+	counts := make(map[string]int, len(productIDs))
+	for start := 0; start < len(productIDs); start += batchGetSize {
+		end := start + batchGetSize
+		if end > len(productIDs) {
+			end = len(productIDs)
+		}
+
+		keys := make([]map[string]types.AttributeValue, 0, end-start)
+		for _, id := range productIDs[start:end] {
+			keys = append(keys, map[string]types.AttributeValue{
+				"product_id": &types.AttributeValueMemberS{Value: id},
+				"related_id": &types.AttributeValueMemberS{Value: id},
+			})
+		}
+		request := map[string]types.KeysAndAttributes{
+			coPurchasesTable: {Keys: keys, ProjectionExpression: aws.String("product_id, co_purchases")},
+		}
+
+		// Unprocessed keys are retried a few times; counts still missing
+		// afterwards fall back in cosine rather than fail the request.
+		for attempt := 0; attempt < 3 && len(request) > 0; attempt++ {
+			result, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get order counts: %w", err)
+			}
+			var cells []CoPurchase
+			if err := attributevalue.UnmarshalListOfMaps(result.Responses[coPurchasesTable], &cells); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal order counts: %w", err)
+			}
+			for _, cell := range cells {
+				counts[cell.ProductID] = cell.CoPurchases
+			}
+			request = result.UnprocessedKeys
+		}
+	}
+	return counts, nil
+}
+
+// purchasesOf reads everything userID has bought.
+func purchasesOf(ctx context.Context, userID string) ([]Purchase, error) {
+	var purchases []Purchase
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(userPurchasesTable),
+		KeyConditionExpression: aws.String("user_id = :user_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	}
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query purchases of %s: %w", userID, err)
+		}
+		var page []Purchase
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal purchases: %w", err)
+		}
+		purchases = append(purchases, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return purchases, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
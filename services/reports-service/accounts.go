@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/tenant"
+)
+
+const accountStatusActive = "ACTIVE"
+
+var customerIDPattern = regexp.MustCompile(`^\d{10}$`)
+
+var errAccountNotFound = errors.New("account not found")
+
+// reportAccount is the part of an ads-api account a report needs.
+type reportAccount struct {
+	CustomerID      string `dynamodbav:"customer_id"`
+	TenantID        string `dynamodbav:"tenant_id"`
+	DescriptiveName string `dynamodbav:"descriptive_name"`
+	CurrencyCode    string `dynamodbav:"currency_code"`
+	Status          string `dynamodbav:"status"`
+}
+
+// getAccount returns an onboarded account, or errAccountNotFound unless it
+// is ACTIVE and belongs to ctx's tenant: accounts still onboarding or that
+// failed are not reported on.
+func getAccount(ctx context.Context, customerID string) (reportAccount, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(accountsTable),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberS{Value: customerID},
+		},
+	})
+	if err != nil {
+		return reportAccount{}, fmt.Errorf("failed to get account: %w", err)
+	}
+	if result.Item == nil {
+		return reportAccount{}, errAccountNotFound
+	}
+
+	var account reportAccount
+	if err := attributevalue.UnmarshalMap(result.Item, &account); err != nil {
+		return reportAccount{}, fmt.Errorf("failed to unmarshal account: %w", err)
+	}
+	if account.Status != accountStatusActive || !tenant.Owns(ctx, account.TenantID) {
+		return reportAccount{}, errAccountNotFound
+	}
+	return account, nil
+}
+
+// listActiveAccounts returns every ACTIVE account of ctx's tenant, by
+// customer ID.
+func listActiveAccounts(ctx context.Context) ([]reportAccount, error) {
+	tenantFilter, names, tenantID := tenant.Filter(ctx)
+	names["#status"] = "status"
+	paginator := dynamodb.NewScanPaginator(dynamoClient, &dynamodb.ScanInput{
+		TableName:                aws.String(accountsTable),
+		FilterExpression:         aws.String("#status = :active AND " + tenantFilter),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active": &types.AttributeValueMemberS{Value: accountStatusActive},
+			":tenant": &types.AttributeValueMemberS{Value: tenantID},
+		},
+	})
+
+	var accounts []reportAccount
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan accounts: %w", err)
+		}
+
+		var batch []reportAccount
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal accounts: %w", err)
+		}
+		accounts = append(accounts, batch...)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].CustomerID < accounts[j].CustomerID })
+	return accounts, nil
+}
+
+func normalizeCustomerID(customerID string) string {
+	return strings.ReplaceAll(strings.TrimSpace(customerID), "-", "")
+}
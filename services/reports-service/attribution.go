@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+
+	"pkg/attribution"
+)
+
+// attributions reads attribution-service's order attributions, for the
+// store revenue each campaign's clicks brought in; nil unless
+// ATTRIBUTIONS_TABLE_NAME is set.
+var attributions *attribution.Store
+
+// attributedDay is one day's orders credited to one campaign's clicks, in
+// one currency.
+type attributedDay struct {
+	Date       string
+	CampaignID string
+	Currency   string
+	Orders     int64
+	Revenue    float64
+}
+
+// queryAttributedDays totals the tenant's attributed orders placed in the
+// range per day, campaign and currency.
+func queryAttributedDays(ctx context.Context, rr reportRange) ([]attributedDay, error) {
+	type dayKey struct{ date, campaign, currency string }
+	days := make(map[dayKey]*attributedDay)
+	var order []dayKey
+	err := attributions.Records(ctx, attribution.StatusAttributed, rr.from, rr.to.AddDate(0, 0, 1), func(records []attribution.Record) error {
+		for _, r := range records {
+			if r.Click == nil {
+				continue
+			}
+			key := dayKey{date: r.OrderedAt.UTC().Format("2006-01-02"), campaign: r.Click.CampaignID, currency: r.Currency}
+			day, ok := days[key]
+			if !ok {
+				day = &attributedDay{Date: key.date, CampaignID: key.campaign, Currency: key.currency}
+				days[key] = day
+				order = append(order, key)
+			}
+			day.Orders++
+			day.Revenue += r.Value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]attributedDay, 0, len(order))
+	for _, key := range order {
+		out = append(out, *days[key])
+	}
+	return out, nil
+}
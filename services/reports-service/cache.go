@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// settleDays is how long Google Ads keeps revising a day's conversions.
+// Ranges ending before then no longer change and are cached longer.
+const settleDays = 3
+
+// reportCache holds each account's report rows per date range so
+// dashboards polling the same range don't run the query every time.
+// Concurrent requests for a report not cached yet share one query.
+type reportCache[T any] struct {
+	ttl        time.Duration
+	settledTTL time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[reportKey]*cacheEntry[T]
+}
+
+// reportKey names a cached report. customerID is the account, or the
+// tenant for reports over its orders.
+type reportKey struct {
+	customerID string
+	from, to   string
+}
+
+type cacheEntry[T any] struct {
+	ready     chan struct{}
+	rows      []T
+	err       error
+	fetchedAt time.Time
+	expires   time.Time
+}
+
+func newReportCache[T any](ttl, settledTTL time.Duration, maxEntries int) *reportCache[T] {
+	return &reportCache[T]{
+		ttl:        ttl,
+		settledTTL: settledTTL,
+		maxEntries: maxEntries,
+		entries:    make(map[reportKey]*cacheEntry[T]),
+	}
+}
+
+// get returns the cached report for key, running fetch when there is none
+// or it expired. hit reports whether the rows came from the cache. Failed
+// fetches are not cached.
+func (c *reportCache[T]) get(ctx context.Context, key reportKey, settled bool, fetch func(context.Context) ([]T, error)) (rows []T, fetchedAt time.Time, hit bool, err error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && !c.expired(entry) {
+		c.mu.Unlock()
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			return nil, time.Time{}, false, ctx.Err()
+		}
+		if entry.err != nil {
+			return nil, time.Time{}, false, entry.err
+		}
+		return entry.rows, entry.fetchedAt, true, nil
+	}
+	entry = &cacheEntry[T]{ready: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	rows, err = fetch(ctx)
+
+	c.mu.Lock()
+	now := clk.Now()
+	if err != nil {
+		entry.err = err
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+	} else {
+		entry.rows = rows
+		entry.fetchedAt = now
+		ttl := c.ttl
+		if settled {
+			ttl = c.settledTTL
+		}
+		entry.expires = now.Add(ttl)
+		c.evict()
+	}
+	close(entry.ready)
+	c.mu.Unlock()
+
+	return rows, now, false, err
+}
+
+// expired reports whether a fetched entry is past its expiry; entries
+// still being fetched never are.
+func (c *reportCache[T]) expired(entry *cacheEntry[T]) bool {
+	select {
+	case <-entry.ready:
+		return !clk.Now().Before(entry.expires)
+	default:
+		return false
+	}
+}
+
+// evict drops expired entries and then, while the cache is over
+// maxEntries, the oldest ones. The caller holds mu.
+func (c *reportCache[T]) evict() {
+	for key, entry := range c.entries {
+		if c.expired(entry) {
+			delete(c.entries, key)
+		}
+	}
+	for len(c.entries) > c.maxEntries {
+		var oldestKey reportKey
+		var oldest *cacheEntry[T]
+		for key, entry := range c.entries {
+			if c.expired(entry) || entry.expires.IsZero() {
+				continue
+			}
+			if oldest == nil || entry.fetchedAt.Before(oldest.fetchedAt) {
+				oldestKey, oldest = key, entry
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(c.entries, oldestKey)
+	}
+}
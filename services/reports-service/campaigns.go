@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/gaql"
+	"pkg/problem"
+	"pkg/stream"
+)
+
+// reportsScope is the token scope required to pull reports.
+const reportsScope = "reports"
+
+const (
+	// maxReportDays bounds the requested range; Google Ads keeps roughly
+	// three years of performance data.
+	maxReportDays = 3 * 366
+	// defaultReportDays is the range when from is omitted.
+	defaultReportDays = 30
+	// reportPageSize is the Search page size.
+	reportPageSize = 1000
+)
+
+// CampaignReportRow is one campaign's performance over the requested
+// range. Amounts are in the account's currency.
+type CampaignReportRow struct {
+	CustomerID       string  `json:"customer_id"`
+	CustomerName     string  `json:"customer_name"`
+	CurrencyCode     string  `json:"currency_code"`
+	CampaignID       string  `json:"campaign_id"`
+	CampaignName     string  `json:"campaign_name"`
+	CampaignStatus   string  `json:"campaign_status"`
+	ChannelType      string  `json:"channel_type"`
+	Impressions      int64   `json:"impressions"`
+	Clicks           int64   `json:"clicks"`
+	Cost             float64 `json:"cost"`
+	Conversions      int64   `json:"conversions"`
+	ConversionsValue float64 `json:"conversions_value"`
+	CTR              float64 `json:"ctr"`
+	CPC              float64 `json:"cpc"`
+	ConversionRate   float64 `json:"conversion_rate"`
+	ROAS             float64 `json:"roas"`
+}
+
+func (c CampaignReportRow) CSVHeader() []string {
+	return []string{
+		"customer_id", "customer_name", "currency_code", "campaign_id", "campaign_name",
+		"campaign_status", "channel_type", "impressions", "clicks", "cost",
+		"conversions", "conversions_value", "ctr", "cpc", "conversion_rate", "roas",
+	}
+}
+
+func (c CampaignReportRow) CSVRow() []string {
+	return []string{
+		c.CustomerID, c.CustomerName, c.CurrencyCode, c.CampaignID, c.CampaignName,
+		c.CampaignStatus, c.ChannelType,
+		strconv.FormatInt(c.Impressions, 10),
+		strconv.FormatInt(c.Clicks, 10),
+		strconv.FormatFloat(c.Cost, 'f', 2, 64),
+		strconv.FormatInt(c.Conversions, 10),
+		strconv.FormatFloat(c.ConversionsValue, 'f', 2, 64),
+		strconv.FormatFloat(c.CTR, 'f', 4, 64),
+		strconv.FormatFloat(c.CPC, 'f', 2, 64),
+		strconv.FormatFloat(c.ConversionRate, 'f', 4, 64),
+		strconv.FormatFloat(c.ROAS, 'f', 2, 64),
+	}
+}
+
+// CampaignReport is the JSON response. GeneratedAt is when the oldest of
+// the accounts' cached reports was queried.
+type CampaignReport struct {
+	From        string              `json:"from"`
+	To          string              `json:"to"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Rows        []CampaignReportRow `json:"rows"`
+}
+
+// reportRange is a parsed report request.
+type reportRange struct {
+	from, to time.Time
+}
+
+// campaignReportHandler returns campaign performance between from and to
+// for one account, or every active account when customer is omitted, as
+// JSON or, with ?format=csv or Accept: text/csv, as CSV.
+func campaignReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	format := strings.ToLower(q.Get("format"))
+	switch format {
+	case "":
+		format = "json"
+		if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			format = "csv"
+		}
+	case "json", "csv":
+	default:
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("Unsupported format %q; use json or csv", q.Get("format"))))
+		return
+	}
+
+	rr, err := parseReportRange(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	var accounts []reportAccount
+	if value := q.Get("customer"); value != "" {
+		customerID := normalizeCustomerID(value)
+		if !customerIDPattern.MatchString(customerID) {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "customer must be a 10-digit Google Ads customer ID"))
+			return
+		}
+		account, err := getAccount(r.Context(), customerID)
+		if errors.Is(err, errAccountNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, fmt.Sprintf("No active account %s", customerID)))
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get account %s: %v", customerID, err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+			return
+		}
+		accounts = []reportAccount{account}
+	} else {
+		accounts, err = listActiveAccounts(r.Context())
+		if err != nil {
+			log.Printf("Failed to list accounts: %v", err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+			return
+		}
+	}
+
+	report := CampaignReport{
+		From: rr.from.Format("2006-01-02"),
+		To:   rr.to.Format("2006-01-02"),
+		Rows: []CampaignReportRow{},
+	}
+	allHits := true
+	for _, account := range accounts {
+		key := reportKey{customerID: account.CustomerID, from: report.From, to: report.To}
+		rows, fetchedAt, hit, err := reports.get(r.Context(), key, rr.settled(), func(ctx context.Context) ([]CampaignReportRow, error) {
+			return queryCampaignReport(ctx, account, rr)
+		})
+		if err != nil {
+			log.Printf("Failed to run campaign report for %s: %v", account.CustomerID, err)
+			problem.Write(w, r, problem.New(http.StatusBadGateway, fmt.Sprintf("Google Ads query failed for account %s", account.CustomerID)))
+			return
+		}
+		if report.GeneratedAt.IsZero() || fetchedAt.Before(report.GeneratedAt) {
+			report.GeneratedAt = fetchedAt
+		}
+		allHits = allHits && hit
+		report.Rows = append(report.Rows, rows...)
+	}
+	if report.GeneratedAt.IsZero() {
+		report.GeneratedAt = clk.Now()
+	}
+
+	if allHits && len(accounts) > 0 {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("Last-Modified", report.GeneratedAt.UTC().Format(http.TimeFormat))
+
+	if format == "json" {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	sw := stream.NewWriter(w, stream.CSV, fmt.Sprintf("campaigns-%s-%s", report.From, report.To))
+	for _, row := range report.Rows {
+		if err := sw.Write(row); err != nil {
+			log.Printf("Failed to write campaign report: %v", err)
+			sw.Abort(fmt.Errorf("report failed"))
+			return
+		}
+	}
+	if err := sw.Close(); err != nil {
+		log.Printf("Failed to finish campaign report: %v", err)
+	}
+}
+
+// authorized answers 401 or 403 unless the caller is a user or API client
+// with the reports scope.
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-User-Id") == "" && r.Header.Get("X-Client-Id") == "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "Reports are available to authenticated users and API clients"))
+		return false
+	}
+	for _, scope := range strings.Fields(r.Header.Get("X-Auth-Scope")) {
+		if scope == reportsScope {
+			return true
+		}
+	}
+	problem.Write(w, r, problem.New(http.StatusForbidden, "The "+reportsScope+" scope is required to pull reports"))
+	return false
+}
+
+// parseReportRange reads from and to (YYYY-MM-DD, inclusive). to defaults
+// to yesterday, the last complete day, and from to defaultReportDays
+// before it.
+func parseReportRange(r *http.Request) (reportRange, error) {
+	q := r.URL.Query()
+	today := today()
+
+	rr := reportRange{to: today.AddDate(0, 0, -1)}
+	if value := q.Get("to"); value != "" {
+		to, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return reportRange{}, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+		}
+		rr.to = to
+	}
+	rr.from = rr.to.AddDate(0, 0, -(defaultReportDays - 1))
+	if value := q.Get("from"); value != "" {
+		from, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return reportRange{}, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+		}
+		rr.from = from
+	}
+
+	if rr.from.After(rr.to) {
+		return reportRange{}, fmt.Errorf("from must not be after to")
+	}
+	if rr.to.After(today) {
+		return reportRange{}, fmt.Errorf("to must not be in the future")
+	}
+	if days := int(rr.to.Sub(rr.from).Hours()/24) + 1; days > maxReportDays {
+		return reportRange{}, fmt.Errorf("range must not exceed %d days", maxReportDays)
+	}
+	return rr, nil
+}
+
+// settled reports whether the range ends before the days whose
+// conversions are still being revised.
+func (rr reportRange) settled() bool {
+	return rr.to.Before(today().AddDate(0, 0, -settleDays))
+}
+
+func today() time.Time {
+	now := clk.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// queryCampaignReport runs the campaign report for one account. Campaigns
+// that did not serve in the range return no row.
+func queryCampaignReport(ctx context.Context, account reportAccount, rr reportRange) ([]CampaignReportRow, error) {
+	query, err := gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"campaign.status",
+		"campaign.advertising_channel_type",
+		"metrics.impressions",
+		"metrics.clicks",
+		"metrics.cost_micros",
+		"metrics.conversions",
+		"metrics.conversions_value",
+		"metrics.ctr",
+		"metrics.average_cpc",
+		"metrics.conversion_rate",
+	).From("campaign").
+		Between("segments.date", rr.from.Format("2006-01-02"), rr.to.Format("2006-01-02")).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build campaign report query: %w", err)
+	}
+
+	var rows []CampaignReportRow
+	pageToken := ""
+	for {
+		resp, err := adsClient.Search(ctx, &googleads.SearchGoogleAdsRequest{
+			CustomerId: account.CustomerID,
+			Query:      query,
+			PageToken:  pageToken,
+			PageSize:   reportPageSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search: %w", err)
+		}
+		for _, row := range resp.Results {
+			rows = append(rows, campaignReportRow(account, row))
+		}
+		if resp.NextPageToken == "" {
+			return rows, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+func campaignReportRow(account reportAccount, row *googleads.GoogleAdsRow) CampaignReportRow {
+	report := CampaignReportRow{
+		CustomerID:       account.CustomerID,
+		CustomerName:     account.DescriptiveName,
+		CurrencyCode:     account.CurrencyCode,
+		CampaignID:       fmt.Sprintf("%d", row.Campaign.Id),
+		CampaignName:     row.Campaign.Name,
+		CampaignStatus:   row.Campaign.Status.String(),
+		ChannelType:      row.Campaign.AdvertisingChannelType.String(),
+		Impressions:      row.Metrics.Impressions,
+		Clicks:           row.Metrics.Clicks,
+		Cost:             float64(row.Metrics.CostMicros) / 1000000.0,
+		Conversions:      row.Metrics.Conversions,
+		ConversionsValue: row.Metrics.ConversionsValue,
+		CTR:              row.Metrics.Ctr,
+		CPC:              float64(row.Metrics.AverageCpc) / 1000000.0,
+		ConversionRate:   row.Metrics.ConversionRate,
+	}
+	if report.Cost > 0 {
+		report.ROAS = report.ConversionsValue / report.Cost
+	}
+	return report
+}
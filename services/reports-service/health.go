@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"pkg/health"
+)
+
+// newReadiness returns the checks behind /health/ready. Campaign reports
+// need the accounts table and the Google Ads credentials; the checkouts,
+// attributions and attribution models tables only feed the order reports.
+func newReadiness(cfg aws.Config, checkoutsTable string, attributionTables ...string) *health.Checker {
+	secrets := secretsmanager.NewFromConfig(cfg)
+	checks := []health.Check{
+		health.Table(dynamoClient, accountsTable, true),
+		health.Table(dynamoClient, checkoutsTable, false),
+		secretCheck(secrets, "google-ads-credentials", os.Getenv("GOOGLE_ADS_SECRET_ARN"), true),
+	}
+	for _, table := range attributionTables {
+		if table != "" {
+			checks = append(checks, health.Table(dynamoClient, table, false))
+		}
+	}
+	if secretARN := os.Getenv("ADS_PLATFORMS_SECRET_ARN"); secretARN != "" {
+		checks = append(checks, secretCheck(secrets, "ads-platforms-credentials", secretARN, false))
+	}
+	return health.NewChecker("reports-service", clk, checks...)
+}
+
+// secretCheck checks that the task role can still describe the secret.
+// Describing it proves access without pulling its value on every probe.
+func secretCheck(svc *secretsmanager.Client, name, secretID string, critical bool) health.Check {
+	return health.Check{
+		Name:     "secretsmanager:" + name,
+		Critical: critical,
+		Run: func(ctx context.Context) error {
+			_, err := svc.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretID)})
+			return err
+		},
+	}
+}
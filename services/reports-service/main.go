@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/gorilla/mux"
+	"google.golang.org/api/googleads"
+	"google.golang.org/api/option"
+
+	"pkg/ads"
+	"pkg/attribution"
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/money"
+	"pkg/recovery"
+	"pkg/tenant"
+)
+
+type GoogleAdsConfig struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	DeveloperToken string `json:"developer_token"`
+}
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient  *dynamodb.Client
+	adsClient     *googleads.Service
+	accountsTable string
+	serverPort    string
+	version       = "1.0.0"
+
+	// reports caches each account's campaign report per date range.
+	reports *reportCache[CampaignReportRow]
+
+	// spendReports caches each account's daily campaign spend, on any
+	// platform, orderReports each tenant's daily orders,
+	// attributedReports each tenant's daily attributed orders and
+	// modelReports each tenant's daily credit under every attribution
+	// model, per date range.
+	spendReports      *reportCache[spendRow]
+	orderReports      *reportCache[orderDay]
+	attributedReports *reportCache[attributedDay]
+	modelReports      *reportCache[attribution.CampaignDay]
+
+	// checkouts is checkout-service's table, read for completed orders.
+	checkouts *dynamo.Table
+
+	// platforms are the ad platforms besides Google Ads, with the
+	// accounts to report on; empty unless ADS_PLATFORMS_SECRET_ARN is
+	// set.
+	platforms *ads.Registry
+
+	// fx converts account and order currencies to the spend report's.
+	fx money.Static
+
+	// clk is the time source for date ranges and cache expiry;
+	// deterministic when TEST_MODE=true.
+	clk clock.Clock = clock.Real{}
+
+	// recoverer reports panics in handlers.
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	accountsTable = getEnv("ACCOUNTS_TABLE_NAME", "google-ads-accounts")
+	serverPort = getEnv("PORT", "3009")
+
+	clk = clock.FromEnv()
+	recoverer = recovery.New("reports-service", clk, ids.FromEnv(clk))
+	cacheTTL := getDurationEnv("REPORT_CACHE_TTL", 15*time.Minute)
+	settledTTL := getDurationEnv("REPORT_CACHE_SETTLED_TTL", 24*time.Hour)
+	maxEntries := getIntEnv("REPORT_CACHE_MAX_ENTRIES", 1000)
+	reports = newReportCache[CampaignReportRow](cacheTTL, settledTTL, maxEntries)
+	spendReports = newReportCache[spendRow](cacheTTL, settledTTL, maxEntries)
+	orderReports = newReportCache[orderDay](cacheTTL, settledTTL, maxEntries)
+	attributedReports = newReportCache[attributedDay](cacheTTL, settledTTL, maxEntries)
+	modelReports = newReportCache[attribution.CampaignDay](cacheTTL, settledTTL, maxEntries)
+
+	checkoutsTable := getEnv("CHECKOUTS_TABLE_NAME", "checkouts")
+	checkouts = dynamo.NewTable(dynamoClient, checkoutsTable, dynamo.WithTimeout(10*time.Second))
+	attributionsTable := os.Getenv("ATTRIBUTIONS_TABLE_NAME")
+	if attributionsTable != "" {
+		attributions = attribution.NewStore(nil, dynamo.NewTable(dynamoClient, attributionsTable, dynamo.WithTimeout(10*time.Second)), clk, 0)
+	}
+	modelsTable := os.Getenv("ATTRIBUTION_MODELS_TABLE_NAME")
+	if modelsTable != "" {
+		attributionModels = attribution.NewResults(dynamo.NewTable(dynamoClient, modelsTable,
+			dynamo.WithTimeout(10*time.Second), dynamo.WithTenancy(dynamo.PartitionKey)))
+	}
+
+	fx, err = money.StaticFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load exchange rates: %v", err)
+	}
+
+	platforms, err = loadPlatforms(ctx, cfg, os.Getenv("ADS_PLATFORMS_SECRET_ARN"))
+	if err != nil {
+		log.Fatalf("Failed to load ad platforms: %v", err)
+	}
+
+	// Initialize Google Ads client
+	adsConfig, err := loadGoogleAdsConfig(ctx, cfg, os.Getenv("GOOGLE_ADS_SECRET_ARN"))
+	if err != nil {
+		log.Fatalf("Failed to load Google Ads config: %v", err)
+	}
+
+	adsClient, err = createGoogleAdsClient(ctx, adsConfig)
+	if err != nil {
+		log.Fatalf("Failed to create Google Ads client: %v", err)
+	}
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware, tenant.Middleware)
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", newReadiness(cfg, checkoutsTable, attributionsTable, modelsTable).Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+	}
+
+	// Campaign performance over a date range (JSON by default, CSV with
+	// ?format=csv)
+	router.HandleFunc("/reports/campaigns", campaignReportHandler).Methods("GET")
+
+	// Spend, conversions and revenue across ad platforms and store
+	// orders, by day, campaign or channel
+	router.HandleFunc("/reports/spend", spendReportHandler).Methods("GET")
+
+	// Campaign revenue under last-click and the multi-touch attribution
+	// models, side by side
+	if attributionModels != nil {
+		router.HandleFunc("/reports/attribution", modelComparisonHandler).Methods("GET")
+	}
+
+	// Start server. Reports over every account can take a while to run
+	// on a cold cache.
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 60 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Reports service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "reports-service",
+		Version:   version,
+	})
+}
+
+func loadGoogleAdsConfig(ctx context.Context, cfg aws.Config, secretARN string) (*GoogleAdsConfig, error) {
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretARN),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+	}
+
+	var adsConfig GoogleAdsConfig
+	if err := json.Unmarshal([]byte(*result.SecretString), &adsConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return &adsConfig, nil
+}
+
+// loadPlatforms reads the platforms secret, configuring none when
+// secretARN is empty.
+func loadPlatforms(ctx context.Context, cfg aws.Config, secretARN string) (*ads.Registry, error) {
+	var platformsConfig ads.Config
+	if secretARN != "" {
+		result, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(secretARN),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve secret: %w", err)
+		}
+		if platformsConfig, err = ads.ParseConfig([]byte(aws.ToString(result.SecretString))); err != nil {
+			return nil, err
+		}
+	}
+	return ads.NewRegistry(platformsConfig, ads.DefaultRetry()), nil
+}
+
+func createGoogleAdsClient(ctx context.Context, adsConfig *GoogleAdsConfig) (*googleads.Service, error) {
+	opts := []option.ClientOption{
+		option.WithCredentialsFile(adsConfig),
+		option.WithScopes(googleads.GoogleAdsScope),
+	}
+	// GOOGLE_ADS_ENDPOINT points the client at a stand-in API such as the
+	// mock server run by cmd/e2e.
+	if endpoint := os.Getenv("GOOGLE_ADS_ENDPOINT"); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+
+	srv, err := googleads.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Ads service: %w", err)
+	}
+
+	return srv, nil
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return defaultValue
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/ads"
+	"pkg/attribution"
+	"pkg/money"
+	"pkg/pool"
+	"pkg/problem"
+	"pkg/tenant"
+)
+
+// attributionModels reads attribution-modeler's per-model credit; nil
+// unless ATTRIBUTION_MODELS_TABLE_NAME is set, and the model comparison
+// report is then not served.
+var attributionModels *attribution.Results
+
+// ModelMetrics are the orders a model credits a campaign with. Conversions
+// are fractional under the multi-touch models. ROAS is revenue per unit of
+// the campaign's spend, and RevenueVsLastClick the revenue the model moves
+// to the campaign (or away from it, when negative) compared to last-click.
+type ModelMetrics struct {
+	Conversions        float64 `json:"conversions"`
+	Revenue            float64 `json:"revenue"`
+	ROAS               float64 `json:"roas"`
+	RevenueVsLastClick float64 `json:"revenue_vs_last_click"`
+}
+
+// ModelComparisonRow is one Google Ads campaign's spend and its credit
+// under every model. Clicks whose landing URL named no campaign are
+// reported under an empty campaign ID.
+type ModelComparisonRow struct {
+	AccountID    string                   `json:"account_id,omitempty"`
+	CampaignID   string                   `json:"campaign_id"`
+	CampaignName string                   `json:"campaign_name,omitempty"`
+	Spend        float64                  `json:"spend"`
+	Models       map[string]*ModelMetrics `json:"models"`
+}
+
+// ModelComparisonReport is the JSON response. GeneratedAt is when the
+// oldest of the cached reports it was built from was queried.
+type ModelComparisonReport struct {
+	From        string               `json:"from"`
+	To          string               `json:"to"`
+	Currency    string               `json:"currency"`
+	Models      []string             `json:"models"`
+	GeneratedAt time.Time            `json:"generated_at"`
+	Rows        []ModelComparisonRow `json:"rows"`
+	Totals      ModelComparisonRow   `json:"totals"`
+}
+
+// modelComparisonHandler compares the store revenue each Google Ads
+// campaign is credited with between from and to under last-click and the
+// multi-touch models, with the campaign's spend, in ?currency= (USD by
+// default).
+func modelComparisonHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	currency := strings.ToUpper(r.URL.Query().Get("currency"))
+	if currency == "" {
+		currency = money.USD
+	}
+	if _, err := fx.Rate(ctx, money.USD, currency); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("No exchange rate for %s", currency)))
+		return
+	}
+
+	rr, err := parseReportRange(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	report := ModelComparisonReport{
+		From:     rr.from.Format("2006-01-02"),
+		To:       rr.to.Format("2006-01-02"),
+		Currency: currency,
+		Models:   attribution.Models,
+		Rows:     []ModelComparisonRow{},
+	}
+	allHits := true
+	seen := func(fetchedAt time.Time, hit bool) {
+		if report.GeneratedAt.IsZero() || fetchedAt.Before(report.GeneratedAt) {
+			report.GeneratedAt = fetchedAt
+		}
+		allHits = allHits && hit
+	}
+
+	rows, failed, err := googleSpendRows(ctx, rr, seen)
+	if err != nil {
+		log.Printf("Failed to run spend report: %v", err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, fmt.Sprintf("Google Ads query failed for account %s", failed)))
+		return
+	}
+
+	key := reportKey{customerID: tenant.FromContext(ctx), from: report.From, to: report.To}
+	days, fetchedAt, hit, err := modelReports.get(ctx, key, rr.settled(), func(ctx context.Context) ([]attribution.CampaignDay, error) {
+		var out []attribution.CampaignDay
+		for _, model := range attribution.Models {
+			days, err := attributionModels.Days(ctx, model, rr.from, rr.to.AddDate(0, 0, 1))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, days...)
+		}
+		return out, nil
+	})
+	if err != nil {
+		log.Printf("Failed to read attribution models: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	seen(fetchedAt, hit)
+
+	if err := report.aggregate(ctx, rows, days); err != nil {
+		log.Printf("Failed to convert model comparison to %s: %v", currency, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	if report.GeneratedAt.IsZero() {
+		report.GeneratedAt = clk.Now()
+	}
+
+	if allHits {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("Last-Modified", report.GeneratedAt.UTC().Format(http.TimeFormat))
+	writeJSON(w, http.StatusOK, report)
+}
+
+// googleSpendRows returns the daily campaign spend of the tenant's active
+// Google Ads accounts, through the spend report's cache, calling seen with
+// each account's fetch time. On failure it also returns the account that
+// failed.
+func googleSpendRows(ctx context.Context, rr reportRange, seen func(time.Time, bool)) ([]spendRow, string, error) {
+	accounts, err := listActiveAccounts(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list accounts: %w", err)
+	}
+
+	from, to := rr.from.Format("2006-01-02"), rr.to.Format("2006-01-02")
+	var (
+		mu     sync.Mutex
+		rows   []spendRow
+		failed string
+	)
+	err = pool.Each(ctx, spendAccountConcurrency, accounts, func(ctx context.Context, account reportAccount) error {
+		key := reportKey{customerID: ads.ParseAccount(account.CustomerID).String(), from: from, to: to}
+		accountRows, fetchedAt, hit, err := spendReports.get(ctx, key, rr.settled(), func(ctx context.Context) ([]spendRow, error) {
+			return queryGoogleSpend(ctx, account, rr)
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed = account.CustomerID
+			return fmt.Errorf("account %s: %w", failed, err)
+		}
+		seen(fetchedAt, hit)
+		rows = append(rows, accountRows...)
+		return nil
+	})
+	if err != nil {
+		return nil, failed, err
+	}
+	return rows, "", nil
+}
+
+// aggregate fills the report's campaign rows and totals from the accounts'
+// spend and the models' campaign days, converted to the report's currency.
+func (report *ModelComparisonReport) aggregate(ctx context.Context, rows []spendRow, days []attribution.CampaignDay) error {
+	rates := make(map[string]float64)
+	convert := func(amount float64, currency string) (float64, error) {
+		rate, ok := rates[currency]
+		if !ok {
+			var err error
+			if rate, err = fx.Rate(ctx, currency, report.Currency); err != nil {
+				return 0, fmt.Errorf("no exchange rate from %s to %s", currency, report.Currency)
+			}
+			rates[currency] = rate
+		}
+		return amount * rate, nil
+	}
+
+	newRow := func(init ModelComparisonRow) *ModelComparisonRow {
+		init.Models = make(map[string]*ModelMetrics, len(report.Models))
+		for _, model := range report.Models {
+			init.Models[model] = &ModelMetrics{}
+		}
+		return &init
+	}
+	// Google Ads campaign IDs are unique across accounts, so the models'
+	// days, which know only the campaign, find its row by ID.
+	campaigns := make(map[string]*ModelComparisonRow)
+	var order []string
+	campaign := func(id string, init ModelComparisonRow) *ModelComparisonRow {
+		row, ok := campaigns[id]
+		if !ok {
+			init.CampaignID = id
+			row = newRow(init)
+			campaigns[id] = row
+			order = append(order, id)
+		}
+		return row
+	}
+	totals := newRow(ModelComparisonRow{})
+
+	for _, r := range rows {
+		cost, err := convert(r.Cost, r.Currency)
+		if err != nil {
+			return err
+		}
+		row := campaign(r.CampaignID, ModelComparisonRow{AccountID: r.AccountID, CampaignName: r.CampaignName})
+		row.Spend += cost
+		totals.Spend += cost
+	}
+
+	for _, d := range days {
+		revenue, err := convert(d.Revenue, d.Currency)
+		if err != nil {
+			return err
+		}
+		for _, row := range []*ModelComparisonRow{campaign(d.CampaignID, ModelComparisonRow{}), totals} {
+			m, ok := row.Models[d.Model]
+			if !ok {
+				// A model no longer offered.
+				continue
+			}
+			m.Conversions += d.Conversions
+			m.Revenue += revenue
+		}
+	}
+
+	for _, id := range order {
+		campaigns[id].derive()
+		report.Rows = append(report.Rows, *campaigns[id])
+	}
+	totals.derive()
+	report.Totals = *totals
+
+	sort.SliceStable(report.Rows, func(i, j int) bool { return report.Rows[i].Spend > report.Rows[j].Spend })
+	return nil
+}
+
+// derive computes each model's ratios from the row's sums.
+func (row *ModelComparisonRow) derive() {
+	var lastClick float64
+	if m, ok := row.Models[attribution.ModelLastClick]; ok {
+		lastClick = m.Revenue
+	}
+	for _, m := range row.Models {
+		if row.Spend > 0 {
+			m.ROAS = m.Revenue / row.Spend
+		}
+		m.RevenueVsLastClick = m.Revenue - lastClick
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"pkg/dynamo"
+	"pkg/tenant"
+)
+
+const (
+	// checkoutCompleted is checkout-service's status of a paid order.
+	checkoutCompleted = "COMPLETED"
+	// completedIndex is checkout-service's (status, saved_at) index. A
+	// checkout is last saved when it completes, so a completed one's
+	// saved_at is when its order was placed.
+	completedIndex = "status-saved_at-index"
+)
+
+// newCustomerLookbackDays is how far before a report's range a customer's
+// earlier orders make them a returning customer.
+var newCustomerLookbackDays = getIntEnv("NEW_CUSTOMER_LOOKBACK_DAYS", 365)
+
+// orderDay is one day's completed orders in one currency.
+type orderDay struct {
+	Date         string
+	Currency     string
+	Orders       int64
+	NewCustomers int64
+	Revenue      float64
+}
+
+// completedOrder is the part of a completed checkout the spend report
+// reads.
+type completedOrder struct {
+	UserID   string  `dynamodbav:"user_id"`
+	Currency string  `dynamodbav:"currency"`
+	Total    float64 `dynamodbav:"total"`
+	SavedAt  int64   `dynamodbav:"saved_at"`
+}
+
+// queryOrderDays totals the completed orders of ctx's tenant per day and
+// currency. A customer is new on the day of their first order in the
+// range unless they ordered in the newCustomerLookbackDays before it;
+// guest orders each count as a new customer.
+func queryOrderDays(ctx context.Context, rr reportRange) ([]orderDay, error) {
+	returning := make(map[string]bool)
+	lookback := rr.from.AddDate(0, 0, -newCustomerLookbackDays)
+	err := queryCompletedOrders(ctx, lookback, rr.from, func(o completedOrder) {
+		if o.UserID != "" {
+			returning[o.UserID] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type dayKey struct{ date, currency string }
+	days := make(map[dayKey]*orderDay)
+	var order []dayKey
+	err = queryCompletedOrders(ctx, rr.from, rr.to.AddDate(0, 0, 1), func(o completedOrder) {
+		key := dayKey{date: time.Unix(o.SavedAt, 0).UTC().Format("2006-01-02"), currency: o.Currency}
+		day, ok := days[key]
+		if !ok {
+			day = &orderDay{Date: key.date, Currency: key.currency}
+			days[key] = day
+			order = append(order, key)
+		}
+		day.Orders++
+		day.Revenue += o.Total
+		// Orders come oldest first, so a customer's first order in the
+		// range is the one seen first.
+		if o.UserID == "" || !returning[o.UserID] {
+			day.NewCustomers++
+		}
+		if o.UserID != "" {
+			returning[o.UserID] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]orderDay, 0, len(order))
+	for _, key := range order {
+		out = append(out, *days[key])
+	}
+	return out, nil
+}
+
+// queryCompletedOrders calls fn with each of the tenant's orders completed
+// in [from, to), oldest first.
+func queryCompletedOrders(ctx context.Context, from, to time.Time, fn func(completedOrder)) error {
+	tenantFilter, names, tenantID := tenant.Filter(ctx)
+	names["#status"] = "status"
+	names["#user"] = "user_id"
+	names["#currency"] = "currency"
+	names["#total"] = "total"
+	names["#saved"] = "saved_at"
+
+	err := dynamo.QueryEach(ctx, checkouts, dynamo.Query{
+		Index:        completedIndex,
+		KeyCondition: "#status = :status AND #saved BETWEEN :from AND :to",
+		Filter:       tenantFilter,
+		Projection:   "#user, #currency, #total, #saved",
+		Names:        names,
+		Values: map[string]types.AttributeValue{
+			":status": dynamo.S(checkoutCompleted),
+			":from":   dynamo.N(strconv.FormatInt(from.Unix(), 10)),
+			":to":     dynamo.N(strconv.FormatInt(to.Unix()-1, 10)),
+			":tenant": dynamo.S(tenantID),
+		},
+	}, func(page []completedOrder) error {
+		for _, o := range page {
+			fn(o)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query completed orders: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleads"
+
+	"pkg/ads"
+	"pkg/gaql"
+	"pkg/money"
+	"pkg/pool"
+	"pkg/problem"
+	"pkg/tenant"
+)
+
+// Spend report groupings.
+const (
+	groupByDay      = "day"
+	groupByCampaign = "campaign"
+	groupByChannel  = "channel"
+)
+
+// spendAccountConcurrency is how many accounts' spend is queried at once.
+// Microsoft Advertising reports are generated asynchronously, so one slow
+// account should not hold up the rest.
+const spendAccountConcurrency = 4
+
+// spendRow is one campaign's performance on one day, as cached per
+// account. Amounts are in Currency, the account's.
+type spendRow struct {
+	Platform         string
+	AccountID        string
+	CampaignID       string
+	CampaignName     string
+	ChannelType      string
+	Date             string
+	Impressions      int64
+	Clicks           int64
+	Conversions      float64
+	Cost             float64
+	ConversionsValue float64
+	Currency         string
+}
+
+// SpendReportRow is one day, campaign or channel of the spend report,
+// with the fields of the other groupings left out. Conversions and
+// their value are as the platforms report them; amounts are in the
+// report's currency.
+type SpendReportRow struct {
+	Date             string             `json:"date,omitempty"`
+	Platform         string             `json:"platform,omitempty"`
+	AccountID        string             `json:"account_id,omitempty"`
+	CampaignID       string             `json:"campaign_id,omitempty"`
+	CampaignName     string             `json:"campaign_name,omitempty"`
+	Channel          string             `json:"channel,omitempty"`
+	Impressions      int64              `json:"impressions"`
+	Clicks           int64              `json:"clicks"`
+	Spend            float64            `json:"spend"`
+	Conversions      float64            `json:"conversions"`
+	ConversionsValue float64            `json:"conversions_value"`
+	CPA              float64            `json:"cpa"`
+	ROAS             float64            `json:"roas"`
+	Store            *StoreMetrics      `json:"store,omitempty"`
+	Attributed       *AttributedMetrics `json:"attributed,omitempty"`
+}
+
+// StoreMetrics are the store's own completed orders, whatever brought
+// them in, set on day rows and the totals. BlendedCAC is spend per new
+// customer and BlendedROAS revenue per unit of spend.
+type StoreMetrics struct {
+	Orders       int64   `json:"orders"`
+	NewCustomers int64   `json:"new_customers"`
+	Revenue      float64 `json:"revenue"`
+	BlendedCAC   float64 `json:"blended_cac"`
+	BlendedROAS  float64 `json:"blended_roas"`
+}
+
+// AttributedMetrics are the store's orders credited to Google Ads clicks
+// by its own last-click attribution, set on the totals and on the day and
+// campaign rows with any when attribution is configured. Unlike the
+// platforms' conversions each order counts once. ROAS is revenue per unit
+// of the row's spend.
+type AttributedMetrics struct {
+	Orders  int64   `json:"orders"`
+	Revenue float64 `json:"revenue"`
+	ROAS    float64 `json:"roas"`
+}
+
+// SpendReport is the JSON response. GeneratedAt is when the oldest of the
+// cached account and order reports it was built from was queried.
+type SpendReport struct {
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	GroupBy     string           `json:"group_by"`
+	Currency    string           `json:"currency"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Rows        []SpendReportRow `json:"rows"`
+	Totals      SpendReportRow   `json:"totals"`
+}
+
+// spendAccount is one ad account the spend report covers. Google Ads
+// accounts come from the accounts table, the others from the platforms
+// secret.
+type spendAccount struct {
+	account ads.Account
+	google  reportAccount
+}
+
+// spendReportHandler returns spend, conversions and revenue between from
+// and to across every active Google Ads account and, for the default
+// tenant, the other platforms' accounts, alongside the store's completed
+// orders. Rows are grouped by day, campaign or channel (?group_by=) and
+// amounts converted to ?currency= (USD by default) at the FX_RATES rates.
+func spendReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	q := r.URL.Query()
+	groupBy := strings.ToLower(q.Get("group_by"))
+	switch groupBy {
+	case "":
+		groupBy = groupByDay
+	case groupByDay, groupByCampaign, groupByChannel:
+	default:
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("Unsupported group_by %q; use day, campaign or channel", q.Get("group_by"))))
+		return
+	}
+	currency := strings.ToUpper(q.Get("currency"))
+	if currency == "" {
+		currency = money.USD
+	}
+	if _, err := fx.Rate(ctx, money.USD, currency); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("No exchange rate for %s", currency)))
+		return
+	}
+
+	rr, err := parseReportRange(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	googleAccounts, err := listActiveAccounts(ctx)
+	if err != nil {
+		log.Printf("Failed to list accounts: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	var accounts []spendAccount
+	for _, account := range googleAccounts {
+		accounts = append(accounts, spendAccount{account: ads.ParseAccount(account.CustomerID), google: account})
+	}
+	// The other platforms' accounts are configured for the deployment,
+	// not onboarded per tenant.
+	if tenant.FromContext(ctx) == tenant.Default {
+		for _, account := range platforms.Accounts() {
+			accounts = append(accounts, spendAccount{account: account})
+		}
+	}
+
+	report := SpendReport{
+		From:     rr.from.Format("2006-01-02"),
+		To:       rr.to.Format("2006-01-02"),
+		GroupBy:  groupBy,
+		Currency: currency,
+		Rows:     []SpendReportRow{},
+	}
+	var (
+		mu      sync.Mutex
+		rows    []spendRow
+		allHits = true
+	)
+	seen := func(fetchedAt time.Time, hit bool) {
+		if report.GeneratedAt.IsZero() || fetchedAt.Before(report.GeneratedAt) {
+			report.GeneratedAt = fetchedAt
+		}
+		allHits = allHits && hit
+	}
+
+	var failed string
+	err = pool.Each(ctx, spendAccountConcurrency, accounts, func(ctx context.Context, a spendAccount) error {
+		key := reportKey{customerID: a.account.String(), from: report.From, to: report.To}
+		accountRows, fetchedAt, hit, err := spendReports.get(ctx, key, rr.settled(), func(ctx context.Context) ([]spendRow, error) {
+			if a.account.Platform == ads.Google {
+				return queryGoogleSpend(ctx, a.google, rr)
+			}
+			return queryPlatformSpend(ctx, a.account, rr)
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed = a.account.String()
+			return fmt.Errorf("account %s: %w", failed, err)
+		}
+		seen(fetchedAt, hit)
+		rows = append(rows, accountRows...)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to run spend report: %v", err)
+		problem.Write(w, r, problem.New(http.StatusBadGateway, fmt.Sprintf("Ad platform query failed for account %s", failed)))
+		return
+	}
+
+	orderKey := reportKey{customerID: tenant.FromContext(ctx), from: report.From, to: report.To}
+	days, fetchedAt, hit, err := orderReports.get(ctx, orderKey, rr.settled(), func(ctx context.Context) ([]orderDay, error) {
+		return queryOrderDays(ctx, rr)
+	})
+	if err != nil {
+		log.Printf("Failed to total orders: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	seen(fetchedAt, hit)
+
+	var attributed []attributedDay
+	if attributions != nil {
+		attributed, fetchedAt, hit, err = attributedReports.get(ctx, orderKey, rr.settled(), func(ctx context.Context) ([]attributedDay, error) {
+			return queryAttributedDays(ctx, rr)
+		})
+		if err != nil {
+			log.Printf("Failed to total attributed orders: %v", err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+			return
+		}
+		seen(fetchedAt, hit)
+	}
+
+	if err := report.aggregate(ctx, rows, days, attributed); err != nil {
+		log.Printf("Failed to convert spend report to %s: %v", currency, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if allHits {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("Last-Modified", report.GeneratedAt.UTC().Format(http.TimeFormat))
+	writeJSON(w, http.StatusOK, report)
+}
+
+// aggregate fills the report's rows and totals from the accounts' rows,
+// the order days and the attributed order days, converted to the report's
+// currency.
+func (report *SpendReport) aggregate(ctx context.Context, rows []spendRow, days []orderDay, attributed []attributedDay) error {
+	rates := make(map[string]float64)
+	convert := func(amount float64, currency string) (float64, error) {
+		rate, ok := rates[currency]
+		if !ok {
+			var err error
+			if rate, err = fx.Rate(ctx, currency, report.Currency); err != nil {
+				return 0, fmt.Errorf("no exchange rate from %s to %s", currency, report.Currency)
+			}
+			rates[currency] = rate
+		}
+		return amount * rate, nil
+	}
+
+	groups := make(map[string]*SpendReportRow)
+	var keys []string
+	group := func(key string, init SpendReportRow) *SpendReportRow {
+		row, ok := groups[key]
+		if !ok {
+			row = &init
+			groups[key] = row
+			keys = append(keys, key)
+		}
+		return row
+	}
+	if report.GroupBy == groupByDay {
+		from, _ := time.Parse("2006-01-02", report.From)
+		to, _ := time.Parse("2006-01-02", report.To)
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			date := day.Format("2006-01-02")
+			group(date, SpendReportRow{Date: date, Store: &StoreMetrics{}})
+		}
+	}
+
+	report.Totals = SpendReportRow{Store: &StoreMetrics{}}
+	if attributions != nil {
+		report.Totals.Attributed = &AttributedMetrics{}
+	}
+	// Google Ads campaign IDs are unique across accounts, so attributed
+	// orders, which know only the campaign, find its row by ID.
+	campaignRows := make(map[string]string)
+	for _, r := range rows {
+		cost, err := convert(r.Cost, r.Currency)
+		if err != nil {
+			return err
+		}
+		value, err := convert(r.ConversionsValue, r.Currency)
+		if err != nil {
+			return err
+		}
+
+		var row *SpendReportRow
+		switch report.GroupBy {
+		case groupByDay:
+			row = group(r.Date, SpendReportRow{Date: r.Date, Store: &StoreMetrics{}})
+		case groupByCampaign:
+			if r.Platform == ads.Google {
+				campaignRows[r.CampaignID] = r.AccountID + "/" + r.CampaignID
+			}
+			row = group(r.AccountID+"/"+r.CampaignID, SpendReportRow{
+				Platform:     r.Platform,
+				AccountID:    r.AccountID,
+				CampaignID:   r.CampaignID,
+				CampaignName: r.CampaignName,
+				Channel:      r.ChannelType,
+			})
+		case groupByChannel:
+			row = group(r.Platform+"/"+r.ChannelType, SpendReportRow{Platform: r.Platform, Channel: r.ChannelType})
+		}
+		for _, sum := range []*SpendReportRow{row, &report.Totals} {
+			sum.Impressions += r.Impressions
+			sum.Clicks += r.Clicks
+			sum.Spend += cost
+			sum.Conversions += r.Conversions
+			sum.ConversionsValue += value
+		}
+	}
+
+	for _, d := range days {
+		revenue, err := convert(d.Revenue, d.Currency)
+		if err != nil {
+			return err
+		}
+		stores := []*StoreMetrics{report.Totals.Store}
+		if report.GroupBy == groupByDay {
+			stores = append(stores, group(d.Date, SpendReportRow{Date: d.Date, Store: &StoreMetrics{}}).Store)
+		}
+		for _, store := range stores {
+			store.Orders += d.Orders
+			store.NewCustomers += d.NewCustomers
+			store.Revenue += revenue
+		}
+	}
+
+	for _, a := range attributed {
+		revenue, err := convert(a.Revenue, a.Currency)
+		if err != nil {
+			return err
+		}
+		sums := []*SpendReportRow{&report.Totals}
+		switch report.GroupBy {
+		case groupByDay:
+			sums = append(sums, group(a.Date, SpendReportRow{Date: a.Date, Store: &StoreMetrics{}}))
+		case groupByCampaign:
+			key, ok := campaignRows[a.CampaignID]
+			if !ok {
+				// Clicked before the range, or a campaign the accounts
+				// table no longer lists.
+				key = ads.Google + "/" + a.CampaignID
+			}
+			sums = append(sums, group(key, SpendReportRow{Platform: ads.Google, CampaignID: a.CampaignID}))
+		}
+		for _, sum := range sums {
+			if sum.Attributed == nil {
+				sum.Attributed = &AttributedMetrics{}
+			}
+			sum.Attributed.Orders += a.Orders
+			sum.Attributed.Revenue += revenue
+		}
+	}
+
+	for _, key := range keys {
+		groups[key].derive()
+		report.Rows = append(report.Rows, *groups[key])
+	}
+	report.Totals.derive()
+
+	if report.GroupBy == groupByDay {
+		sort.SliceStable(report.Rows, func(i, j int) bool { return report.Rows[i].Date < report.Rows[j].Date })
+	} else {
+		sort.SliceStable(report.Rows, func(i, j int) bool { return report.Rows[i].Spend > report.Rows[j].Spend })
+	}
+	return nil
+}
+
+// derive computes the row's ratios from its sums.
+func (row *SpendReportRow) derive() {
+	if row.Conversions > 0 {
+		row.CPA = row.Spend / row.Conversions
+	}
+	if row.Spend > 0 {
+		row.ROAS = row.ConversionsValue / row.Spend
+	}
+	if row.Attributed != nil && row.Spend > 0 {
+		row.Attributed.ROAS = row.Attributed.Revenue / row.Spend
+	}
+	if row.Store == nil {
+		return
+	}
+	if row.Store.NewCustomers > 0 {
+		row.Store.BlendedCAC = row.Spend / float64(row.Store.NewCustomers)
+	}
+	if row.Spend > 0 {
+		row.Store.BlendedROAS = row.Store.Revenue / row.Spend
+	}
+}
+
+// queryGoogleSpend reads a Google Ads account's campaign performance per
+// day.
+func queryGoogleSpend(ctx context.Context, account reportAccount, rr reportRange) ([]spendRow, error) {
+	query, err := gaql.Select(
+		"campaign.id",
+		"campaign.name",
+		"campaign.advertising_channel_type",
+		"segments.date",
+		"metrics.impressions",
+		"metrics.clicks",
+		"metrics.cost_micros",
+		"metrics.conversions",
+		"metrics.conversions_value",
+	).From("campaign").
+		Between("segments.date", rr.from.Format("2006-01-02"), rr.to.Format("2006-01-02")).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build spend query: %w", err)
+	}
+
+	var rows []spendRow
+	pageToken := ""
+	for {
+		resp, err := adsClient.Search(ctx, &googleads.SearchGoogleAdsRequest{
+			CustomerId: account.CustomerID,
+			Query:      query,
+			PageToken:  pageToken,
+			PageSize:   reportPageSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search: %w", err)
+		}
+		for _, row := range resp.Results {
+			rows = append(rows, spendRow{
+				Platform:         ads.Google,
+				AccountID:        account.CustomerID,
+				CampaignID:       fmt.Sprintf("%d", row.Campaign.Id),
+				CampaignName:     row.Campaign.Name,
+				ChannelType:      row.Campaign.AdvertisingChannelType.String(),
+				Date:             row.Segments.Date,
+				Impressions:      row.Metrics.Impressions,
+				Clicks:           row.Metrics.Clicks,
+				Conversions:      float64(row.Metrics.Conversions),
+				Cost:             float64(row.Metrics.CostMicros) / 1000000.0,
+				ConversionsValue: row.Metrics.ConversionsValue,
+				Currency:         account.CurrencyCode,
+			})
+		}
+		if resp.NextPageToken == "" {
+			return rows, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// queryPlatformSpend reads another platform's account's campaign
+// performance per day.
+func queryPlatformSpend(ctx context.Context, account ads.Account, rr reportRange) ([]spendRow, error) {
+	platform, err := platforms.Platform(account.Platform)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := platform.FetchMetrics(ctx, account.ID, ads.LevelCampaignDay, ads.Period{Start: rr.from, End: rr.to})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]spendRow, 0, len(metrics))
+	for _, m := range metrics {
+		rows = append(rows, spendRow{
+			Platform:         account.Platform,
+			AccountID:        account.String(),
+			CampaignID:       m.CampaignID,
+			CampaignName:     m.CampaignName,
+			ChannelType:      m.ChannelType,
+			Date:             m.Date.Format("2006-01-02"),
+			Impressions:      m.Impressions,
+			Clicks:           m.Clicks,
+			Conversions:      m.Conversions,
+			Cost:             m.Cost.Units(),
+			ConversionsValue: m.ConversionValue.Units(),
+			Currency:         m.Cost.Currency,
+		})
+	}
+	return rows, nil
+}
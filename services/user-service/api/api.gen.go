@@ -0,0 +1,1692 @@
+// Package api provides primitives to interact with the openapi HTTP API.
+//
+// Code generated by github.com/deepmap/oapi-codegen/v2 version v2.1.0 DO NOT EDIT.
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/oapi-codegen/runtime"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
+// Defines values for BatchCreateRequestFormat.
+const (
+	BatchCreateRequestFormatCsv    BatchCreateRequestFormat = "csv"
+	BatchCreateRequestFormatNdjson BatchCreateRequestFormat = "ndjson"
+)
+
+// Defines values for BatchCreateResultStatus.
+const (
+	Created BatchCreateResultStatus = "created"
+	Failed  BatchCreateResultStatus = "failed"
+	Invalid BatchCreateResultStatus = "invalid"
+)
+
+// Defines values for ConsentRecordChannel.
+const (
+	AdsPersonalization ConsentRecordChannel = "ads_personalization"
+	Email              ConsentRecordChannel = "email"
+	Sms                ConsentRecordChannel = "sms"
+)
+
+// Defines values for MergeRequestTrigger.
+const (
+	MergeRequestTriggerLogin        MergeRequestTrigger = "login"
+	MergeRequestTriggerRegistration MergeRequestTrigger = "registration"
+)
+
+// Defines values for MergeResultStatus.
+const (
+	COMPLETED  MergeResultStatus = "COMPLETED"
+	INPROGRESS MergeResultStatus = "IN_PROGRESS"
+)
+
+// Defines values for MergeResultTrigger.
+const (
+	MergeResultTriggerLogin        MergeResultTrigger = "login"
+	MergeResultTriggerRegistration MergeResultTrigger = "registration"
+)
+
+// Defines values for PrivacyRequestKind.
+const (
+	Erasure PrivacyRequestKind = "erasure"
+	Export  PrivacyRequestKind = "export"
+)
+
+// Defines values for PrivacyRequestStatus.
+const (
+	PrivacyRequestStatusFAILED    PrivacyRequestStatus = "FAILED"
+	PrivacyRequestStatusRUNNING   PrivacyRequestStatus = "RUNNING"
+	PrivacyRequestStatusSUCCEEDED PrivacyRequestStatus = "SUCCEEDED"
+)
+
+// Defines values for TimelineResponsePurpose.
+const (
+	TimelineResponsePurposeAnalytics TimelineResponsePurpose = "analytics"
+	TimelineResponsePurposeSupport   TimelineResponsePurpose = "support"
+)
+
+// Defines values for UserImportFormat.
+const (
+	UserImportFormatCsv    UserImportFormat = "csv"
+	UserImportFormatNdjson UserImportFormat = "ndjson"
+)
+
+// Defines values for UserImportStatus.
+const (
+	UserImportStatusFAILED    UserImportStatus = "FAILED"
+	UserImportStatusPENDING   UserImportStatus = "PENDING"
+	UserImportStatusRUNNING   UserImportStatus = "RUNNING"
+	UserImportStatusSUCCEEDED UserImportStatus = "SUCCEEDED"
+)
+
+// Defines values for ExportUsersParamsFormat.
+const (
+	Csv    ExportUsersParamsFormat = "csv"
+	Ndjson ExportUsersParamsFormat = "ndjson"
+)
+
+// Defines values for GetUserTimelineParamsPurpose.
+const (
+	GetUserTimelineParamsPurposeAnalytics GetUserTimelineParamsPurpose = "analytics"
+	GetUserTimelineParamsPurposeSupport   GetUserTimelineParamsPurpose = "support"
+)
+
+// BatchCreateRequest Give either users or s3_key.
+type BatchCreateRequest struct {
+	// Format Taken from the key's extension (.csv, .ndjson or .jsonl) when left out.
+	Format BatchCreateRequestFormat `json:"format,omitempty"`
+
+	// S3Key A CSV or NDJSON object in the import bucket.
+	S3Key string `json:"s3_key,omitempty"`
+
+	// Users Up to 1000 records shaped like CreateUserRequest. Records are
+	// checked one by one, so an invalid record fails alone.
+	Users []json.RawMessage `json:"users,omitempty"`
+}
+
+// BatchCreateRequestFormat Taken from the key's extension (.csv, .ndjson or .jsonl) when left out.
+type BatchCreateRequestFormat string
+
+// BatchCreateResponse defines model for BatchCreateResponse.
+type BatchCreateResponse struct {
+	Created int                 `json:"created"`
+	Failed  int                 `json:"failed"`
+	Invalid int                 `json:"invalid"`
+	Results []BatchCreateResult `json:"results"`
+}
+
+// BatchCreateResult defines model for BatchCreateResult.
+type BatchCreateResult struct {
+	Errors *[]FieldError `json:"errors,omitempty"`
+	Id     *string       `json:"id,omitempty"`
+	Index  int           `json:"index"`
+
+	// Status Failed records were valid but not written; retrying them alone is safe.
+	Status BatchCreateResultStatus `json:"status"`
+}
+
+// BatchCreateResultStatus Failed records were valid but not written; retrying them alone is safe.
+type BatchCreateResultStatus string
+
+// ConsentHistory defines model for ConsentHistory.
+type ConsentHistory struct {
+	NextCursor *string         `json:"next_cursor,omitempty"`
+	Records    []ConsentRecord `json:"records"`
+}
+
+// ConsentRecord One consent granted or withdrawn. Records are never changed or deleted.
+type ConsentRecord struct {
+	// Actor The user or API client that made the change.
+	Actor      *string              `json:"actor,omitempty"`
+	Channel    ConsentRecordChannel `json:"channel"`
+	Granted    bool                 `json:"granted"`
+	Id         string               `json:"id"`
+	RecordedAt time.Time            `json:"recorded_at"`
+
+	// Source What made the change; "preferences" for PUT /users/{id}/preferences.
+	Source string `json:"source"`
+}
+
+// ConsentRecordChannel defines model for ConsentRecord.Channel.
+type ConsentRecordChannel string
+
+// CreateUserRequest defines model for CreateUserRequest.
+type CreateUserRequest struct {
+	Email            openapi_types.Email `json:"email"`
+	FirstName        string              `json:"first_name"`
+	LastName         string              `json:"last_name"`
+	MarketingConsent bool                `json:"marketing_consent,omitempty"`
+}
+
+// FieldError defines model for FieldError.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Rule    string `json:"rule"`
+}
+
+// ImportError defines model for ImportError.
+type ImportError struct {
+	Field   *string `json:"field,omitempty"`
+	Message string  `json:"message"`
+	Row     int     `json:"row"`
+}
+
+// JSONPatch defines model for JSONPatch.
+type JSONPatch = []JSONPatchOperation
+
+// JSONPatchOperation defines model for JSONPatchOperation.
+type JSONPatchOperation struct {
+	// Op add, replace or test.
+	Op string `json:"op"`
+
+	// Path A top-level user field, such as /first_name.
+	Path string `json:"path"`
+
+	// Value Required by every supported op.
+	Value *interface{} `json:"value,omitempty"`
+}
+
+// LoginRequest defines model for LoginRequest.
+type LoginRequest struct {
+	Email    openapi_types.Email `json:"email"`
+	Password string              `json:"password"`
+}
+
+// MergeRequest defines model for MergeRequest.
+type MergeRequest struct {
+	AnonymousID string              `json:"anonymous_id"`
+	Trigger     MergeRequestTrigger `json:"trigger"`
+}
+
+// MergeRequestTrigger defines model for MergeRequest.Trigger.
+type MergeRequestTrigger string
+
+// MergeResult defines model for MergeResult.
+type MergeResult struct {
+	AnonymousId string `json:"anonymous_id"`
+
+	// CartId The user's open cart after the merge, if any.
+	CartId          *string    `json:"cart_id,omitempty"`
+	CartsMerged     int        `json:"carts_merged"`
+	CartsReassigned int        `json:"carts_reassigned"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+
+	// Records Events and attribution records moved, per store.
+	Records   map[string]int     `json:"records"`
+	StartedAt time.Time          `json:"started_at"`
+	Status    MergeResultStatus  `json:"status"`
+	Trigger   MergeResultTrigger `json:"trigger"`
+	UserId    string             `json:"user_id"`
+}
+
+// MergeResultStatus defines model for MergeResult.Status.
+type MergeResultStatus string
+
+// MergeResultTrigger defines model for MergeResult.Trigger.
+type MergeResultTrigger string
+
+// Message defines model for Message.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Preferences defines model for Preferences.
+type Preferences struct {
+	// AdsPersonalization Use in ad audiences, such as Google Ads Customer Match.
+	AdsPersonalization bool `json:"ads_personalization"`
+
+	// Email Marketing email.
+	Email bool `json:"email"`
+
+	// Sms Marketing text messages.
+	SMS bool `json:"sms"`
+
+	// UpdatedAt When the preferences were last set; absent if never.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// PrivacyRequest defines model for PrivacyRequest.
+type PrivacyRequest struct {
+	CompletedAt       *time.Time           `json:"completed_at,omitempty"`
+	CreatedAt         time.Time            `json:"created_at"`
+	DownloadExpiresAt *time.Time           `json:"download_expires_at,omitempty"`
+	DownloadUrl       *string              `json:"download_url,omitempty"`
+	Error             *string              `json:"error,omitempty"`
+	Id                string               `json:"id"`
+	Kind              PrivacyRequestKind   `json:"kind"`
+	Records           *map[string]int      `json:"records,omitempty"`
+	Status            PrivacyRequestStatus `json:"status"`
+	UserId            string               `json:"user_id"`
+}
+
+// PrivacyRequestKind defines model for PrivacyRequest.Kind.
+type PrivacyRequestKind string
+
+// PrivacyRequestStatus defines model for PrivacyRequest.Status.
+type PrivacyRequestStatus string
+
+// Problem defines model for Problem.
+type Problem struct {
+	Detail   *string       `json:"detail,omitempty"`
+	Errors   *[]FieldError `json:"errors,omitempty"`
+	Instance *string       `json:"instance,omitempty"`
+	Status   int           `json:"status"`
+	Title    string        `json:"title"`
+	Type     string        `json:"type"`
+}
+
+// RefreshRequest defines model for RefreshRequest.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// SignupRequest defines model for SignupRequest.
+type SignupRequest struct {
+	Email            openapi_types.Email `json:"email"`
+	FirstName        string              `json:"first_name"`
+	LastName         string              `json:"last_name"`
+	MarketingConsent bool                `json:"marketing_consent,omitempty"`
+	Password         string              `json:"password"`
+}
+
+// TimelineEvent defines model for TimelineEvent.
+type TimelineEvent struct {
+	Attributes *map[string]string `json:"attributes,omitempty"`
+	Id         string             `json:"id"`
+	Source     string             `json:"source"`
+	Summary    string             `json:"summary"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Type       string             `json:"type"`
+}
+
+// TimelineResponse defines model for TimelineResponse.
+type TimelineResponse struct {
+	Events     []TimelineEvent         `json:"events"`
+	NextCursor *string                 `json:"next_cursor,omitempty"`
+	Purpose    TimelineResponsePurpose `json:"purpose"`
+
+	// Unavailable Sources that failed; the page is still returned.
+	Unavailable *[]string `json:"unavailable,omitempty"`
+	UserId      string    `json:"user_id"`
+}
+
+// TimelineResponsePurpose defines model for TimelineResponse.Purpose.
+type TimelineResponsePurpose string
+
+// TokenResponse A refresh returns no new refresh token; the one presented stays valid.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int32  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+}
+
+// UpdateUserRequest Fields left out are unchanged.
+type UpdateUserRequest struct {
+	FirstName        *string `json:"first_name,omitempty"`
+	LastName         *string `json:"last_name,omitempty"`
+	MarketingConsent *bool   `json:"marketing_consent,omitempty"`
+}
+
+// User defines model for User.
+type User struct {
+	CreatedAt        time.Time           `json:"created_at"`
+	Deleted          *bool               `json:"deleted,omitempty"`
+	DeletedAt        *time.Time          `json:"deleted_at,omitempty"`
+	Email            openapi_types.Email `json:"email"`
+	FirstName        string              `json:"first_name"`
+	Id               string              `json:"id"`
+	LastName         string              `json:"last_name"`
+	MarketingConsent bool                `json:"marketing_consent"`
+
+	// TenantId The storefront brand the user belongs to.
+	TenantID  string    `json:"tenant_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Version Counts writes to the user; the ETag.
+	Version int64 `json:"version"`
+}
+
+// UserImport defines model for UserImport.
+type UserImport struct {
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Created     int        `json:"created"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Error       *string    `json:"error,omitempty"`
+
+	// Errors The first hundred rejected rows.
+	Errors    *[]ImportError   `json:"errors,omitempty"`
+	Failed    int              `json:"failed"`
+	Format    UserImportFormat `json:"format"`
+	Id        string           `json:"id"`
+	Invalid   int              `json:"invalid"`
+	Processed int              `json:"processed"`
+	S3Key     string           `json:"s3_key"`
+	Status    UserImportStatus `json:"status"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// UserImportFormat defines model for UserImport.Format.
+type UserImportFormat string
+
+// UserImportStatus defines model for UserImport.Status.
+type UserImportStatus string
+
+// UserList defines model for UserList.
+type UserList struct {
+	Users []User `json:"users"`
+}
+
+// UserMergePatch The fields to set, as in UpdateUserRequest. Read-only fields and
+// nulls are refused with a field error each.
+type UserMergePatch = map[string]interface{}
+
+// CacheBypass defines model for CacheBypass.
+type CacheBypass = string
+
+// IdempotencyKey defines model for IdempotencyKey.
+type IdempotencyKey = string
+
+// IfMatch defines model for IfMatch.
+type IfMatch = string
+
+// UserID defines model for UserID.
+type UserID = string
+
+// PrivacyRequestStarted defines model for PrivacyRequestStarted.
+type PrivacyRequestStarted = PrivacyRequest
+
+// Tokens A refresh returns no new refresh token; the one presented stays valid.
+type Tokens = TokenResponse
+
+// VersionedPreferences defines model for VersionedPreferences.
+type VersionedPreferences = Preferences
+
+// VersionedUser defines model for VersionedUser.
+type VersionedUser = User
+
+// ListUsersParams defines parameters for ListUsers.
+type ListUsersParams struct {
+	// Ids Comma-separated user IDs, at most 100. Unknown and deleted users are left out.
+	Ids *string `form:"ids,omitempty" json:"ids,omitempty"`
+
+	// XCacheBypass Any value but "false" or "0" reads from DynamoDB, skipping the cache.
+	XCacheBypass *CacheBypass `json:"X-Cache-Bypass,omitempty"`
+}
+
+// CreateUserParams defines parameters for CreateUser.
+type CreateUserParams struct {
+	// IdempotencyKey Replays the stored response to a retried request with the same key.
+	IdempotencyKey *IdempotencyKey `json:"Idempotency-Key,omitempty"`
+}
+
+// BatchCreateUsersParams defines parameters for BatchCreateUsers.
+type BatchCreateUsersParams struct {
+	// IdempotencyKey Replays the stored response to a retried request with the same key.
+	IdempotencyKey *IdempotencyKey `json:"Idempotency-Key,omitempty"`
+}
+
+// ExportUsersParams defines parameters for ExportUsers.
+type ExportUsersParams struct {
+	// Format Defaults to ndjson, or csv when Accept asks for text/csv.
+	Format *ExportUsersParamsFormat `form:"format,omitempty" json:"format,omitempty"`
+}
+
+// ExportUsersParamsFormat defines parameters for ExportUsers.
+type ExportUsersParamsFormat string
+
+// DeleteUserParams defines parameters for DeleteUser.
+type DeleteUserParams struct {
+	// IfMatch The ETag last read, or "*". Required; its absence is answered with 428.
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// GetUserParams defines parameters for GetUser.
+type GetUserParams struct {
+	IfNoneMatch *string `json:"If-None-Match,omitempty"`
+
+	// XCacheBypass Any value but "false" or "0" reads from DynamoDB, skipping the cache.
+	XCacheBypass *CacheBypass `json:"X-Cache-Bypass,omitempty"`
+}
+
+// PatchUserParams defines parameters for PatchUser.
+type PatchUserParams struct {
+	// IfMatch The ETag last read, or "*". Required; its absence is answered with 428.
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// UpdateUserParams defines parameters for UpdateUser.
+type UpdateUserParams struct {
+	// IfMatch The ETag last read, or "*". Required; its absence is answered with 428.
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// UpdateUserPreferencesParams defines parameters for UpdateUserPreferences.
+type UpdateUserPreferencesParams struct {
+	// IfMatch The ETag last read, or "*". Required; its absence is answered with 428.
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// GetUserConsentHistoryParams defines parameters for GetUserConsentHistory.
+type GetUserConsentHistoryParams struct {
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Cursor next_cursor from the previous page.
+	Cursor *string `form:"cursor,omitempty" json:"cursor,omitempty"`
+}
+
+// GetUserTimelineParams defines parameters for GetUserTimeline.
+type GetUserTimelineParams struct {
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Cursor next_cursor from the previous page.
+	Cursor *string `form:"cursor,omitempty" json:"cursor,omitempty"`
+
+	// Purpose Support sees masked contact details; analytics sees no personal data and a pseudonymous user ID.
+	Purpose *GetUserTimelineParamsPurpose `form:"purpose,omitempty" json:"purpose,omitempty"`
+}
+
+// GetUserTimelineParamsPurpose defines parameters for GetUserTimeline.
+type GetUserTimelineParamsPurpose string
+
+// LoginJSONRequestBody defines body for Login for application/json ContentType.
+type LoginJSONRequestBody = LoginRequest
+
+// RefreshTokensJSONRequestBody defines body for RefreshTokens for application/json ContentType.
+type RefreshTokensJSONRequestBody = RefreshRequest
+
+// SignupJSONRequestBody defines body for Signup for application/json ContentType.
+type SignupJSONRequestBody = SignupRequest
+
+// CreateUserJSONRequestBody defines body for CreateUser for application/json ContentType.
+type CreateUserJSONRequestBody = CreateUserRequest
+
+// BatchCreateUsersJSONRequestBody defines body for BatchCreateUsers for application/json ContentType.
+type BatchCreateUsersJSONRequestBody = BatchCreateRequest
+
+// PatchUserJSONRequestBody defines body for PatchUser for application/json ContentType.
+type PatchUserJSONRequestBody = UserMergePatch
+
+// PatchUserApplicationJSONPatchPlusJSONRequestBody defines body for PatchUser for application/json-patch+json ContentType.
+type PatchUserApplicationJSONPatchPlusJSONRequestBody = JSONPatch
+
+// PatchUserApplicationMergePatchPlusJSONRequestBody defines body for PatchUser for application/merge-patch+json ContentType.
+type PatchUserApplicationMergePatchPlusJSONRequestBody = UserMergePatch
+
+// UpdateUserJSONRequestBody defines body for UpdateUser for application/json ContentType.
+type UpdateUserJSONRequestBody = UpdateUserRequest
+
+// MergeUserJSONRequestBody defines body for MergeUser for application/json ContentType.
+type MergeUserJSONRequestBody = MergeRequest
+
+// UpdateUserPreferencesJSONRequestBody defines body for UpdateUserPreferences for application/json ContentType.
+type UpdateUserPreferencesJSONRequestBody = Preferences
+
+// ServerInterface represents all server handlers.
+type ServerInterface interface {
+	// Exchange an email and password for tokens
+	// (POST /auth/login)
+	Login(w http.ResponseWriter, r *http.Request)
+	// Exchange a refresh token for new access and ID tokens
+	// (POST /auth/refresh)
+	RefreshTokens(w http.ResponseWriter, r *http.Request)
+	// Create a Cognito login and its user
+	// (POST /auth/signup)
+	Signup(w http.ResponseWriter, r *http.Request)
+	// List live users, or the given ones
+	// (GET /users)
+	ListUsers(w http.ResponseWriter, r *http.Request, params ListUsersParams)
+	// Create a user
+	// (POST /users)
+	CreateUser(w http.ResponseWriter, r *http.Request, params CreateUserParams)
+	// Create up to 1000 users, or import them from S3
+	// (POST /users/batch)
+	BatchCreateUsers(w http.ResponseWriter, r *http.Request, params BatchCreateUsersParams)
+	// Stream every live user
+	// (GET /users/export)
+	ExportUsers(w http.ResponseWriter, r *http.Request, params ExportUsersParams)
+	// Report an import's progress
+	// (GET /users/imports/{importId})
+	GetUserImport(w http.ResponseWriter, r *http.Request, importId string)
+	// Soft-delete a user
+	// (DELETE /users/{id})
+	DeleteUser(w http.ResponseWriter, r *http.Request, id UserID, params DeleteUserParams)
+	// Get a live user
+	// (GET /users/{id})
+	GetUser(w http.ResponseWriter, r *http.Request, id UserID, params GetUserParams)
+	// Patch a user in a single conditional update
+	// (PATCH /users/{id})
+	PatchUser(w http.ResponseWriter, r *http.Request, id UserID, params PatchUserParams)
+	// Update a user's fields
+	// (PUT /users/{id})
+	UpdateUser(w http.ResponseWriter, r *http.Request, id UserID, params UpdateUserParams)
+	// Start a GDPR erasure of the user's data
+	// (POST /users/{id}/erase)
+	EraseUserData(w http.ResponseWriter, r *http.Request, id UserID)
+	// Start a GDPR export of the user's data
+	// (POST /users/{id}/export)
+	ExportUserData(w http.ResponseWriter, r *http.Request, id UserID)
+	// Move an anonymous visitor's carts and events to the user
+	// (POST /users/{id}/merge)
+	MergeUser(w http.ResponseWriter, r *http.Request, id UserID)
+	// Get the user's consent to email, SMS and ads personalization
+	// (GET /users/{id}/preferences)
+	GetUserPreferences(w http.ResponseWriter, r *http.Request, id UserID)
+	// Grant or withdraw consents
+	// (PUT /users/{id}/preferences)
+	UpdateUserPreferences(w http.ResponseWriter, r *http.Request, id UserID, params UpdateUserPreferencesParams)
+	// Page through every consent change, newest first
+	// (GET /users/{id}/preferences/history)
+	GetUserConsentHistory(w http.ResponseWriter, r *http.Request, id UserID, params GetUserConsentHistoryParams)
+	// Report a privacy request's progress
+	// (GET /users/{id}/privacy-requests/{requestId})
+	GetPrivacyRequest(w http.ResponseWriter, r *http.Request, id UserID, requestId string)
+	// Undo a soft delete
+	// (POST /users/{id}/restore)
+	RestoreUser(w http.ResponseWriter, r *http.Request, id UserID)
+	// Page through the user's journey across services, newest first
+	// (GET /users/{id}/timeline)
+	GetUserTimeline(w http.ResponseWriter, r *http.Request, id UserID, params GetUserTimelineParams)
+}
+
+// ServerInterfaceWrapper converts contexts to parameters.
+type ServerInterfaceWrapper struct {
+	Handler            ServerInterface
+	HandlerMiddlewares []MiddlewareFunc
+	ErrorHandlerFunc   func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type MiddlewareFunc func(http.Handler) http.Handler
+
+// Login operation middleware
+func (siw *ServerInterfaceWrapper) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.Login(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RefreshTokens operation middleware
+func (siw *ServerInterfaceWrapper) RefreshTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.RefreshTokens(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Signup operation middleware
+func (siw *ServerInterfaceWrapper) Signup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.Signup(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ListUsers operation middleware
+func (siw *ServerInterfaceWrapper) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ListUsersParams
+
+	// ------------- Optional query parameter "ids" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "ids", r.URL.Query(), &params.Ids)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "ids", Err: err})
+		return
+	}
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "X-Cache-Bypass" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Cache-Bypass")]; found {
+		var XCacheBypass CacheBypass
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Cache-Bypass", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Cache-Bypass", valueList[0], &XCacheBypass, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Cache-Bypass", Err: err})
+			return
+		}
+
+		params.XCacheBypass = &XCacheBypass
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ListUsers(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// CreateUser operation middleware
+func (siw *ServerInterfaceWrapper) CreateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params CreateUserParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "Idempotency-Key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Idempotency-Key")]; found {
+		var IdempotencyKey IdempotencyKey
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "Idempotency-Key", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "Idempotency-Key", valueList[0], &IdempotencyKey, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "Idempotency-Key", Err: err})
+			return
+		}
+
+		params.IdempotencyKey = &IdempotencyKey
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.CreateUser(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// BatchCreateUsers operation middleware
+func (siw *ServerInterfaceWrapper) BatchCreateUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params BatchCreateUsersParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "Idempotency-Key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Idempotency-Key")]; found {
+		var IdempotencyKey IdempotencyKey
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "Idempotency-Key", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "Idempotency-Key", valueList[0], &IdempotencyKey, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "Idempotency-Key", Err: err})
+			return
+		}
+
+		params.IdempotencyKey = &IdempotencyKey
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.BatchCreateUsers(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ExportUsers operation middleware
+func (siw *ServerInterfaceWrapper) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ExportUsersParams
+
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "format", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ExportUsers(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetUserImport operation middleware
+func (siw *ServerInterfaceWrapper) GetUserImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "importId" -------------
+	var importId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "importId", mux.Vars(r)["importId"], &importId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "importId", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetUserImport(w, r, importId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// DeleteUser operation middleware
+func (siw *ServerInterfaceWrapper) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params DeleteUserParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "If-Match", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "If-Match", valueList[0], &IfMatch, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "If-Match", Err: err})
+			return
+		}
+
+		params.IfMatch = &IfMatch
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteUser(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetUser operation middleware
+func (siw *ServerInterfaceWrapper) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetUserParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "If-None-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-None-Match")]; found {
+		var IfNoneMatch string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "If-None-Match", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "If-None-Match", valueList[0], &IfNoneMatch, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "If-None-Match", Err: err})
+			return
+		}
+
+		params.IfNoneMatch = &IfNoneMatch
+
+	}
+
+	// ------------- Optional header parameter "X-Cache-Bypass" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("X-Cache-Bypass")]; found {
+		var XCacheBypass CacheBypass
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "X-Cache-Bypass", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "X-Cache-Bypass", valueList[0], &XCacheBypass, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "X-Cache-Bypass", Err: err})
+			return
+		}
+
+		params.XCacheBypass = &XCacheBypass
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetUser(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// PatchUser operation middleware
+func (siw *ServerInterfaceWrapper) PatchUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PatchUserParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "If-Match", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "If-Match", valueList[0], &IfMatch, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "If-Match", Err: err})
+			return
+		}
+
+		params.IfMatch = &IfMatch
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PatchUser(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// UpdateUser operation middleware
+func (siw *ServerInterfaceWrapper) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params UpdateUserParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "If-Match", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "If-Match", valueList[0], &IfMatch, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "If-Match", Err: err})
+			return
+		}
+
+		params.IfMatch = &IfMatch
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.UpdateUser(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// EraseUserData operation middleware
+func (siw *ServerInterfaceWrapper) EraseUserData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.EraseUserData(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ExportUserData operation middleware
+func (siw *ServerInterfaceWrapper) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ExportUserData(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// MergeUser operation middleware
+func (siw *ServerInterfaceWrapper) MergeUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.MergeUser(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetUserPreferences operation middleware
+func (siw *ServerInterfaceWrapper) GetUserPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetUserPreferences(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// UpdateUserPreferences operation middleware
+func (siw *ServerInterfaceWrapper) UpdateUserPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params UpdateUserPreferencesParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "If-Match", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "If-Match", valueList[0], &IfMatch, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "If-Match", Err: err})
+			return
+		}
+
+		params.IfMatch = &IfMatch
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.UpdateUserPreferences(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetUserConsentHistory operation middleware
+func (siw *ServerInterfaceWrapper) GetUserConsentHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetUserConsentHistoryParams
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", r.URL.Query(), &params.Cursor)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "cursor", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetUserConsentHistory(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetPrivacyRequest operation middleware
+func (siw *ServerInterfaceWrapper) GetPrivacyRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "requestId" -------------
+	var requestId string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "requestId", mux.Vars(r)["requestId"], &requestId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "requestId", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetPrivacyRequest(w, r, id, requestId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RestoreUser operation middleware
+func (siw *ServerInterfaceWrapper) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.RestoreUser(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetUserTimeline operation middleware
+func (siw *ServerInterfaceWrapper) GetUserTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id UserID
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", mux.Vars(r)["id"], &id, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetUserTimelineParams
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", r.URL.Query(), &params.Cursor)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "cursor", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "purpose" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "purpose", r.URL.Query(), &params.Purpose)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "purpose", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetUserTimeline(w, r, id, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+type UnescapedCookieParamError struct {
+	ParamName string
+	Err       error
+}
+
+func (e *UnescapedCookieParamError) Error() string {
+	return fmt.Sprintf("error unescaping cookie parameter '%s'", e.ParamName)
+}
+
+func (e *UnescapedCookieParamError) Unwrap() error {
+	return e.Err
+}
+
+type UnmarshalingParamError struct {
+	ParamName string
+	Err       error
+}
+
+func (e *UnmarshalingParamError) Error() string {
+	return fmt.Sprintf("Error unmarshaling parameter %s as JSON: %s", e.ParamName, e.Err.Error())
+}
+
+func (e *UnmarshalingParamError) Unwrap() error {
+	return e.Err
+}
+
+type RequiredParamError struct {
+	ParamName string
+}
+
+func (e *RequiredParamError) Error() string {
+	return fmt.Sprintf("Query argument %s is required, but not found", e.ParamName)
+}
+
+type RequiredHeaderError struct {
+	ParamName string
+	Err       error
+}
+
+func (e *RequiredHeaderError) Error() string {
+	return fmt.Sprintf("Header parameter %s is required, but not found", e.ParamName)
+}
+
+func (e *RequiredHeaderError) Unwrap() error {
+	return e.Err
+}
+
+type InvalidParamFormatError struct {
+	ParamName string
+	Err       error
+}
+
+func (e *InvalidParamFormatError) Error() string {
+	return fmt.Sprintf("Invalid format for parameter %s: %s", e.ParamName, e.Err.Error())
+}
+
+func (e *InvalidParamFormatError) Unwrap() error {
+	return e.Err
+}
+
+type TooManyValuesForParamError struct {
+	ParamName string
+	Count     int
+}
+
+func (e *TooManyValuesForParamError) Error() string {
+	return fmt.Sprintf("Expected one value for %s, got %d", e.ParamName, e.Count)
+}
+
+// Handler creates http.Handler with routing matching OpenAPI spec.
+func Handler(si ServerInterface) http.Handler {
+	return HandlerWithOptions(si, GorillaServerOptions{})
+}
+
+type GorillaServerOptions struct {
+	BaseURL          string
+	BaseRouter       *mux.Router
+	Middlewares      []MiddlewareFunc
+	ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// HandlerFromMux creates http.Handler with routing matching OpenAPI spec based on the provided mux.
+func HandlerFromMux(si ServerInterface, r *mux.Router) http.Handler {
+	return HandlerWithOptions(si, GorillaServerOptions{
+		BaseRouter: r,
+	})
+}
+
+func HandlerFromMuxWithBaseURL(si ServerInterface, r *mux.Router, baseURL string) http.Handler {
+	return HandlerWithOptions(si, GorillaServerOptions{
+		BaseURL:    baseURL,
+		BaseRouter: r,
+	})
+}
+
+// HandlerWithOptions creates http.Handler with additional options
+func HandlerWithOptions(si ServerInterface, options GorillaServerOptions) http.Handler {
+	r := options.BaseRouter
+
+	if r == nil {
+		r = mux.NewRouter()
+	}
+	if options.ErrorHandlerFunc == nil {
+		options.ErrorHandlerFunc = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+	wrapper := ServerInterfaceWrapper{
+		Handler:            si,
+		HandlerMiddlewares: options.Middlewares,
+		ErrorHandlerFunc:   options.ErrorHandlerFunc,
+	}
+
+	r.HandleFunc(options.BaseURL+"/auth/login", wrapper.Login).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/auth/refresh", wrapper.RefreshTokens).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/auth/signup", wrapper.Signup).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/users", wrapper.ListUsers).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/users", wrapper.CreateUser).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/users/batch", wrapper.BatchCreateUsers).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/users/export", wrapper.ExportUsers).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/users/imports/{importId}", wrapper.GetUserImport).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}", wrapper.DeleteUser).Methods("DELETE")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}", wrapper.GetUser).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}", wrapper.PatchUser).Methods("PATCH")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}", wrapper.UpdateUser).Methods("PUT")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/erase", wrapper.EraseUserData).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/export", wrapper.ExportUserData).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/merge", wrapper.MergeUser).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/preferences", wrapper.GetUserPreferences).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/preferences", wrapper.UpdateUserPreferences).Methods("PUT")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/preferences/history", wrapper.GetUserConsentHistory).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/privacy-requests/{requestId}", wrapper.GetPrivacyRequest).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/restore", wrapper.RestoreUser).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/users/{id}/timeline", wrapper.GetUserTimeline).Methods("GET")
+
+	return r
+}
+
+// Base64 encoded, gzipped, json marshaled Swagger object
+var swaggerSpec = []string{
+
+	"H4sIAAAAAAAC/+w8/XPbuHL/CobtzN21lKzYuXt3zk+J7eTcJo7Hdl5f55TxwORKwpkEeAAoWc3of+8s",
+	"AH6D+oqcl+n0pzgiuFjsLvZ7+SWIRJoJDlyr4PRLMAMagzR/XtzRKf4bg4okyzQTPDgN7mZAcgXyB0Xm",
+	"IBUTPCRUEUqUloJPCb41DMJARTNIKb6vlxkEp4HSkvFpsFqFwT8GZzSaQRf475d3IflweXtLhCRv/vv6",
+	"9e1tSBYz4ETPgET4EmGKAKcPCcTNbYDnaXD6B8IIwgCBBGFgYQSfww4WqzDIqKQpaHdcg9KbZUaV6iL2",
+	"mi/JnCY5kIdck3EwoYmCcYBojoPROCASaKzIRIqUnC85TcX5m5CoR5ZljE8r7BFlhgAtnYMw4DRFvBxJ",
+	"Bg6B9fS7jCHNhAYeLf8Tll1sbyBL6FKZbZUWEmIiQWWCKyBaEEokaMnMr3/loDRZMD2zq2kK5BGWvXjW",
+	"th7g3hsQnXygOpr5pQglhSRUaUO80NLy38bBkNzAXzmTEL8iTCtCHxTwyDCecrUAPI5B+OXxr/14TgZ2",
+	"6/UIflIgL8/xmYGSUT2rYLA4CAPpcAlOtcxhHbRVGBRUNhJ0JfRbkfMY/44E18C1eQ2e9FGWUNzwy3pw",
+	"TZpdCaLyaIasFLmMYBiswuBasjmNljeWkbeaSg3tHWmWJSyiCOboTyVa+/6rhElwGvzLUaUIjuxTddSE",
+	"7kMKGemkyHAQhUhwIGJSkyfGY6I0SxIic84Zn4YkE0kCMaHaLHsvLHpkyubAkak1PVQ83EAuQwzxkEC6",
+	"5viZXfHvu5LBwvWc/+btGfnbr6O/EQeZxKApS5Rhzp14BK4Oxg0D7saJmA+ZMzHlTAuizb4Ghb9bHQ3x",
+	"tYQJSLxI6oDiUcHskQ1nKiJEmWvVYm1hYnybuGVHZs1qVT8L3tqDHcIAW4M9WreFZFp3BHMX7FeF5jBv",
+	"vkHVdCaBaijuVkdFvmNzIMD0DKTBQ+H1Uif3TjtnUmQgNbPsnAiZUg+QO/oI3JolvGePsPxBEXjSwJGS",
+	"5MdhpOYhGfIYaYYbDPGP5CdrdBOYaCJyjfsV5jVS8yAM7AtduxoGT4OpGOCPA7R+A2EwockgE4xrkFaN",
+	"IjXMSTyWlpzd/h0xuTr/j9uPV0Q8/AmRJsy6ACzNhNTkIY8ewaCV0qf3wKd6Fpy+GB2/3B8fQ+IuOp8y",
+	"tJgvRqMRkRAJGSuiZjSDmCTsEYjlIYqQ4yMaL7uMShjzaAbRI8RGJT4s8Z+QKEEoJ4zPacJiB5VMUGkQ",
+	"mggOwzEPwoBpSA0+5QGC0wCJPryhiw+gFJ0CXnD3hEpJl1sft3rPkhcBNWTS6ZjTLy05i8zzuKaAEewU",
+	"b1AY4Bn6nrnj+h9KUHli/c/y2OuubBPVPNEdQqxWdcv9R4l3hUiJbrX9541Uwa06NAEphdwe+bcMkvgC",
+	"3+liHQYNEhXGDbGO4clPPKWpzj2S+9Ycr5Ra9JuIFTl0YbnQhVZ7ZdzBpfNTUyuE6G0pOoHG1e8nosfB",
+	"bjLAHqDE1kfqM2sjfmdKC7ns0pnDk76PcqmE9NLInXRrRrj97H3dKEEF9DWYO0gdTnzkUBhAMpWUa1QI",
+	"0viwsaQL3tAZhMMcJIlmlE/tuhgS0DbaaRKERlrI7nal4RKSvL6+JFHCcGc9o5qkNAYbjRj4w6A8TUVH",
+	"fMQhqcdUkFKWIPdSFYQBjdV9BlKhYmH/Y32zzx5A7qw1Zj0IkQDlawTdkhnie6rrdi2IqYaBZin4MLb+",
+	"cJcS/+U58isyDrLKbxkHZCIkuf50R46MCTj6wuLVUW2Fh0Zt2caLUFCtOnaJV/NUXgFqmxGPljEsqJOk",
+	"YErNBB7//NJDngmTSt/boOZL02KOwiBlvPy/5+WE7v9uSuUjaMan9078PaKwg8mq07w4fO1sdVx9RK4p",
+	"3g51J/jMK5CpM7W+ZzJPwB9X1lG1sN3qCqAPxUvj3hwWR7Hw2Y22dhOLDaihM3ZdBPNb6dfyjY8ZSKsl",
+	"PAbPs6pzcpF17zaN45BITHREYAJPdL58ysHE9B43U4tskMAcEqssDXVDG2FTRY4qwfJCNckgX+bF0hSd",
+	"PdTjS6LyDHmKqjwbdugussBh6KP5ezFl/Dk0QkaVWjhbVb5d/tgC8MuGe95zM0twvpN9ADmF3pNRLvgy",
+	"Fbm6Z00U89zoWq+P75I2r4t3L8/ruqVxfC3ZdAqybuESJLXR1FOmtOwzaq2zNhCt4K45sd+FbB+4a5Op",
+	"1O5Zb4wtMuAEFxI60WBTMSnuGhI2IZQv/daeSq3uzboe79yukECVYlPeu0qkmfFTdrLcNZ+NxjGzmv+6",
+	"QZvuVk0KXMyBa0Uox2ySluwhxwel35uKOcQhyUDaVOgw8DBH2bzZTqhXfnchQ5dX99c3H9/dXJjU89nH",
+	"D9fvL+4uzr2+0f4iaENVv6CsF8/ivWr38hQtOfAwveJVg1x+US/NUVPM++1UC/F1hqiVyPKLjcnPd/xl",
+	"j9/aDfgVYLKBxoTmMTPbVFbhnRDTBMjrWJGzXGmRgiQmzVyTqpqPW2ro5hYfCreImAX+d1Wq1r2JWWTi",
+	"yKQ8EJpK8fbDrRGcLKaObx5f2VVZaq6vDRpNil6BfmUz8Rq1iQlScFvvXZFA4488WRY58+0MxjbBRV0M",
+	"GqnpbqZiL33kQtyd3onFgieCxvfwlDEJar+Xc5l4NT8UzmDnSY+pwGx7I3Z7Qv8jQEhU5RK8KmUvPexT",
+	"oy2VePPp6ury6l0QBrefzs4uLs4v0Cq/fX35vkcvbq3bWhrNnLquzipG+qWnrBQ0xcam7/s5cbA8D1ea",
+	"8sjvs1d09BCd6cT/lv1hE93M0wLM2nzMDUwkqFnvDZP2+b2pNuAPu3iJzZd929+yKc+z/4+HezPWX+HE",
+	"/7qzE79TpH3HUkgYB+Oaebxd56bBNvqmLd+1bXoUYJUN6j7K05TKpfcZamilaZptr7y3u3FVyFLLCFW7",
+	"VVitI2V/Sh7mRe/GVmqpyRuPZtqUZs1ymQkFdS3vYtwgDCinyVKzSPmVO6dzyhJs3ug6ILeGNMrmKW1a",
+	"+ZV1SOjUpqNtBRl0LrlNh5YH7pOV8lBbm5XKohTnDAsKe9nTKMl6sgxOzzm0FeGCcFiUPxv196qsmmcS",
+	"FJj8sNLYwGGy7L7EbwRKVYq3c/zCE2G8IcyM65PjSpDr5Zm4D1rTkbw8Nye2LkNL/e9beTMA7re7S42T",
+	"19BuHLkB0se1T1ncTbe2qidovVVZATWZ+Zy7rLyn/vo9mxRvua+ooXvre7u5sLY+4U/zu4c7Aew37RtM",
+	"+bYucoPg+5E0DDRwyvuTMibZMJGCa/IgMTmhi7LMAySCTxXRYrgxVmrevjuz5eX5DperGfJtR3/X19c9",
+	"15nIubbdEID4l2eyGqxo/avrm19eevSNz0BuSOj72NLw8htHrc7wuUf0bab9wGFjT2ZsjzvVH/VVUUhX",
+	"5gztyCznsW35wwPjH2KhGuZynX9QL0F4DOm6Gn/VhLJds8i6cveaboFMCjQCfVhUjSVbpOyuL67ObXy6",
+	"e6S6883yiX0ZsDq0SyrWzxmu71/ouwV9sv+e+QKqsgFmKzGxXVMbauYWZB8aJiN+3d8fOrEmWAuiQJsm",
+	"Y8ZJx3Rj8ZzGA8GTZfEG5fGY8zxJbEFdwiRXRc8otYuIuUYEaDSz7TYtDFdGCCfCmx+UKiSYFR3kGe5F",
+	"TOI2JA958ugalAwOJLMpqqI/Ug3HfMzN+wavedHOduq6h62PaFSpe9bprA7t4a4/3YXk+vXd2e9mo/ML",
+	"TDSTNDeJOh4TpskDjR6RYEUjrO2qBaXJg4gZOCpVLdAGpaJdiU4p40oTPWOKxCLKU0A7BhMhgVAyozxO",
+	"QBKZc/VqzK1KMgB62yHx6BemIOaoQWiklam943mtMSU/tq3mT3iEfwys4RtcxuGYL2Ysss3KU6phQZco",
+	"HqrqcYtokph6iPOtC+ob/qMrx/SY00iXe8cwoXmiHQ5DYjkkJkSY3jv7sz0eF/hazmMnNDYXY2SC3IKc",
+	"MxPblfYzeDEcDUco7yIDTjMWnAYnw9HwxBX9zC07ormeHRkZwv9mwl5OUZRDL+Pg1FYCXTcyKP1GxMuD",
+	"NUA2qoyr5h12XkSjr/l4NOoDWa47cq2vqzB4OXqxeXnZYYvrT3Zbf/zbDuvrSYDg4sk69IRym4q319bl",
+	"PKyA2HOEgaZTZSKQHIu1CMcyzoVB/axzabS7AtBzsLCVqvtnM7GHyM2o15AXY2Eb0xnSX55vJrgyecF+",
+	"etu84TMRupmU3IrOL75JpzISEs3t0HLrtx2v0PFO638enewrDbbTiVBS9KobxWeYz7QyR/DzvnRPpuDT",
+	"j0xpo7eD5ljPH90QJk3pQAEuQt8YwZLLcxUSqkkqlMZe3yH5xB+5WFi8XAjrmrDRDNT7olFrB3/lIJf1",
+	"wZENEzx+2lWIH9WHkVaf/Xf3YDKFxFvXAd/u2q+Nb61rfS+WGcgvR6N9RQbRIwmbO2TKMRMzK0IEh7q2",
+	"cC7nKuzRDlWnXVdSNvCkNXVl2XJ4FdPtBfwu1cxXzHHspm786qOlKAq2l5ri6KEILAo5aJW7MRhw8oRR",
+	"QNGHz1zS1SgHvP2uSZoIbhRUoRT0DMbcjqPhO8ejkYsvOCqGSKRgWk4s1CEx29kQL7TZXjfWoMbchgwQ",
+	"FzMO6LlPJXqZxU6kvtFxNa1n37S+aFPMa23rPWrx+xB2zyDM9s7L4THoH61C4S8YKyaut89xF03i8ej4",
+	"oBfQ5ad6MLGMf6YpupcvTp7Re/Bd57wasqlUvD2jHUkwwd3tSefCh4Fd1bz6ruOh8hW8PZp2PJbGKeNE",
+	"RSKDYecWXRhAW/kV5zaINOkKm+8yh4jU3I5SvY4iyDSh6tEFvTgFGql5nwtRZoG6A84WfBCa7JqnRXE3",
+	"d+Fp4ODtah/CoDjDjnOsOA5h3C5UkFiKHD5/mNiQulstgabuDpeOxVpr4sTs6Iv94zJe9bqi70DXLnBH",
+	"bHxzxg7mTtPGz+0UbqOAHONebmZEOQvd5MQNmDtOuQP4g8LE0VSCqvt0vjuOUxr2aiegYc0QTEQ5eQAi",
+	"wQ3C51yzxFx9CUgp1JcZSCZik84q3PomT8/NLvt5jW4E/lkZVs4DrhljXVBVjRLtzje0C8c72oVf976h",
+	"YqIHFtl+Xy9ce/96bp7nOwFXgsM2Hwv4voK2dbze2zsP94rtTqwk9chd2bnhvJQitW3DN5uhrljw1Srl",
+	"HWhC12r1XW+w+0YEcjTrqVbQR5NQt+nvk19/IWZ02RQ4iKlwkB9pooRJdWUmslBj3ub/T+gwOCC//DY6",
+	"tkCubfL+o61vFLXRcMzL2qiJEjrV0ULxGZSxlaaCRsaBBqXHwZiXV0eRB7BRC5W6+HqDrSXZ8X3bpOWL",
+	"NQzMA+jGw0cXrSoTCkob2MDQZ8fvQVSzUG2Qpn9+L5gdXA+Twm1+M2Evtb9rMnFXM/Hi52dNVn6FGbK3",
+	"hTo9xrEUxzgOAJT3gSbukvj1TO6xT1UF8/u7L52+qO9IDHf2Pr6ZmFiyOTn5Qbky9Np4wgwZg6SuoXNv",
+	"e+TNcV4gXFx1TjUNOuzaii6+rwrtw7afvyZMM7Ns5N359Q1xwwulZbKUju0BCzq7gruH0mVG4NCkLjME",
+	"/5dobQ61J6mNBXwGShvb6LTmc+i+xkTqN85B1mdDe9x6N8hZtqcRLhboL9qejO295kYG5bdvlef7IOam",
+	"yF4OJJI5U0wL82koWvTL2D7rel/hZh2aNacBvQk/29CxmAn3bQ0FujHlNqNzcNmgwnmGv3KaOEyYHPOO",
+	"e+1zhF3kWR9Q/CpbWQd0gKhIdz7HhQc0fQ8huf1wa3iAfUjt8bvDhlC5h0MXDeKbCQDbNKAwfCy+nlEU",
+	"SJqHGPOZ/WJM8dh8c870qA49YdFEJIlY2OSvOfuYFywl5VcJmaptZL7YpGcOJnnI06z+eMxdROsTicqj",
+	"akrF9+X3db7jdkiP7+uk+Lt2/N5JynX9Uz6FTKqdFNfRrPrk0bqUVusDSf4EV6uOkLCUNcsIrt0tOP15",
+	"ZGbEWJqn1ayB+5+vZ7t9aWuDQlX3XSZhzlDBZ3QKfcUN+1IDq60+8fAtc+AtYvfUMfCU6CgV2sXN0Tp7",
+	"PNrRHu+v368RDz2TIp/OWqbMKtIQS/egtM0hHVKld+TaOIaDou3y6Iv7a0PNpDXP/Yyc3emjpq8w6M+j",
+	"CAANkPOMIyqlaaElxfg21rEeD1YOaXcO+8silQu+L+9Cbzmq5Ndu9aiWHLiCyzNEAjcWchkLfO8psWau",
+	"gMcCRUpMtKvGbDYV2o1sbrIPxWjnYS3D8T/ZMnjqMK3BUTt9ShSAIilV2MCOigJ7vF37+StSDqbaZVyU",
+	"Xq6JbK3vSzIFeVyEKK41sA/Vaj7UQ8HaSOxuQ7LPatM6w8QbrJoNyJ7PmPVlXWu2rObv/ylyyWFJaCSF",
+	"Qj6afnv1jJZtVQL7UnDddKSuwvL/dpPaD0WxuvZToahXn1f/OwBvhBSrb18AAA==",
+}
+
+// GetSwagger returns the content of the embedded swagger specification file
+// or error if failed to decode
+func decodeSpec() ([]byte, error) {
+	zipped, err := base64.StdEncoding.DecodeString(strings.Join(swaggerSpec, ""))
+	if err != nil {
+		return nil, fmt.Errorf("error base64 decoding spec: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(zipped))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing spec: %w", err)
+	}
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(zr)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing spec: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+var rawSpec = decodeSpecCached()
+
+// a naive cached of a decoded swagger spec
+func decodeSpecCached() func() ([]byte, error) {
+	data, err := decodeSpec()
+	return func() ([]byte, error) {
+		return data, err
+	}
+}
+
+// Constructs a synthetic filesystem for resolving external references when loading openapi specifications.
+func PathToRawSpec(pathToFile string) map[string]func() ([]byte, error) {
+	res := make(map[string]func() ([]byte, error))
+	if len(pathToFile) > 0 {
+		res[pathToFile] = rawSpec
+	}
+
+	return res
+}
+
+// GetSwagger returns the Swagger specification corresponding to the generated code
+// in this file. The external references of Swagger specification are resolved.
+// The logic of resolving external references is tightly connected to "import-mapping" feature.
+// Externally referenced files must be embedded in the corresponding golang packages.
+// Urls can be supported but this task was out of the scope.
+func GetSwagger() (swagger *openapi3.T, err error) {
+	resolvePath := PathToRawSpec("")
+
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+	loader.ReadFromURIFunc = func(loader *openapi3.Loader, url *url.URL) ([]byte, error) {
+		pathToFile := url.String()
+		pathToFile = path.Clean(pathToFile)
+		getSpec, ok := resolvePath[pathToFile]
+		if !ok {
+			err1 := fmt.Errorf("path not found: %s", pathToFile)
+			return nil, err1
+		}
+		return getSpec()
+	}
+	var specData []byte
+	specData, err = rawSpec()
+	if err != nil {
+		return
+	}
+	swagger, err = loader.LoadFromData(specData)
+	if err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,8 @@
+// Package api is generated from openapi.yaml, the user service's contract:
+// request and response types, a gorilla/mux router that binds parameters
+// and calls a ServerInterface, and the spec itself for validation and for
+// serving at /openapi.json. Edit openapi.yaml and run go generate; do not
+// edit api.gen.go.
+package api
+
+//go:generate go run github.com/deepmap/oapi-codegen/v2/cmd/oapi-codegen@v2.1.0 -config oapi-codegen.yaml openapi.yaml
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	cognitotypes "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+
+	"pkg/dynamo"
+	"pkg/events"
+	"pkg/problem"
+	"pkg/tenant"
+	"pkg/validate"
+
+	"user-service/api"
+)
+
+// Sign-up and login through Cognito. The user pool owns credentials and
+// issues tokens; the users table stays the profile of record. Sign-up
+// creates both, linking them through the Cognito sub on the user and a
+// custom:user_id attribute on the Cognito user, which puts the user ID in
+// every token.
+
+// userIDAttribute is the user pool's custom attribute holding the user ID.
+const userIDAttribute = "custom:user_id"
+
+// tenantAttribute is the user pool's custom attribute holding the tenant
+// the user signed up to, which the gateway reads from their tokens. Email
+// is the pool's username, so one email signs up to one tenant.
+const tenantAttribute = "custom:tenant_id"
+
+var (
+	cognitoClient *cognitoidentityprovider.Client
+	userPoolID    string
+	appClientID   string
+)
+
+// initAuth enables the /auth endpoints when a user pool and app client are
+// configured; otherwise they answer 503.
+func initAuth(cfg aws.Config) {
+	userPoolID = os.Getenv("COGNITO_USER_POOL_ID")
+	appClientID = os.Getenv("COGNITO_CLIENT_ID")
+	if userPoolID == "" || appClientID == "" {
+		log.Printf("COGNITO_USER_POOL_ID or COGNITO_CLIENT_ID not set, sign-up and login disabled")
+		return
+	}
+	cognitoClient = cognitoidentityprovider.NewFromConfig(cfg)
+}
+
+// signupHandler creates the Cognito user with a permanent password, then
+// the user record. If the record cannot be saved the Cognito user is
+// deleted again, so a retry can start over.
+func signupHandler(w http.ResponseWriter, r *http.Request) {
+	if cognitoClient == nil {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Sign-up is not configured"))
+		return
+	}
+	var req api.SignupRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	now := clk.Now()
+	user := User{
+		ID:               generateUUID(),
+		Email:            string(req.Email),
+		FirstName:        req.FirstName,
+		LastName:         req.LastName,
+		MarketingConsent: req.MarketingConsent,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Version:          1,
+	}
+
+	sub, err := createCognitoUser(r.Context(), user, req.Password)
+	if err != nil {
+		if writeCognitoError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to create Cognito user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	user.CognitoSub = sub
+
+	if err := users.Put(r.Context(), user, dynamo.IfNotExists("id")); err != nil {
+		deleteCognitoUser(context.WithoutCancel(r.Context()), user.Email)
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to save signed-up user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	invalidateUsers(r.Context(), user.ID)
+
+	// The account exists either way; a lost event only delays the
+	// audience sync until the user's next cart or order event.
+	err = publishDomainEvent(r.Context(), events.UserRegistered{
+		UserID:           user.ID,
+		MarketingConsent: user.MarketingConsent,
+		RegisteredAt:     now,
+	})
+	if err != nil {
+		log.Printf("Failed to publish registration of user %s: %v", user.ID, err)
+	}
+
+	log.Printf("User %s signed up", user.ID)
+	writeJSON(w, http.StatusCreated, user)
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if cognitoClient == nil {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Login is not configured"))
+		return
+	}
+	var req api.LoginRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	initiateAuth(w, r, cognitotypes.AuthFlowTypeUserPasswordAuth, map[string]string{
+		"USERNAME": string(req.Email),
+		"PASSWORD": req.Password,
+	})
+}
+
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
+	if cognitoClient == nil {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Login is not configured"))
+		return
+	}
+	var req api.RefreshRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	initiateAuth(w, r, cognitotypes.AuthFlowTypeRefreshTokenAuth, map[string]string{
+		"REFRESH_TOKEN": req.RefreshToken,
+	})
+}
+
+// initiateAuth runs one Cognito auth flow and answers with its tokens.
+// Challenges such as a forced password change are not supported through
+// this API and are refused.
+func initiateAuth(w http.ResponseWriter, r *http.Request, flow cognitotypes.AuthFlowType, params map[string]string) {
+	result, err := cognitoClient.InitiateAuth(r.Context(), &cognitoidentityprovider.InitiateAuthInput{
+		AuthFlow:       flow,
+		ClientId:       aws.String(appClientID),
+		AuthParameters: params,
+	})
+	if err != nil {
+		if writeCognitoError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to authenticate: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	if result.AuthenticationResult == nil {
+		problem.Write(w, r, problem.New(http.StatusForbidden, "Account requires "+string(result.ChallengeName)+" before logging in"))
+		return
+	}
+
+	tokens := result.AuthenticationResult
+	writeJSON(w, http.StatusOK, api.TokenResponse{
+		AccessToken:  aws.ToString(tokens.AccessToken),
+		IDToken:      aws.ToString(tokens.IdToken),
+		RefreshToken: aws.ToString(tokens.RefreshToken),
+		ExpiresIn:    tokens.ExpiresIn,
+		TokenType:    aws.ToString(tokens.TokenType),
+	})
+}
+
+// Cognito operations
+
+// createCognitoUser creates a confirmed user with a permanent password and
+// returns its sub. Cognito's welcome message is suppressed; the user just
+// chose the password.
+func createCognitoUser(ctx context.Context, user User, password string) (string, error) {
+	created, err := cognitoClient.AdminCreateUser(ctx, &cognitoidentityprovider.AdminCreateUserInput{
+		UserPoolId:    aws.String(userPoolID),
+		Username:      aws.String(user.Email),
+		MessageAction: cognitotypes.MessageActionTypeSuppress,
+		UserAttributes: []cognitotypes.AttributeType{
+			{Name: aws.String("email"), Value: aws.String(user.Email)},
+			{Name: aws.String("given_name"), Value: aws.String(user.FirstName)},
+			{Name: aws.String("family_name"), Value: aws.String(user.LastName)},
+			{Name: aws.String(userIDAttribute), Value: aws.String(user.ID)},
+			{Name: aws.String(tenantAttribute), Value: aws.String(tenant.FromContext(ctx))},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = cognitoClient.AdminSetUserPassword(ctx, &cognitoidentityprovider.AdminSetUserPasswordInput{
+		UserPoolId: aws.String(userPoolID),
+		Username:   aws.String(user.Email),
+		Password:   aws.String(password),
+		Permanent:  true,
+	})
+	if err != nil {
+		deleteCognitoUser(context.WithoutCancel(ctx), user.Email)
+		return "", err
+	}
+
+	for _, attr := range created.User.Attributes {
+		if aws.ToString(attr.Name) == "sub" {
+			return aws.ToString(attr.Value), nil
+		}
+	}
+	return "", errors.New("created Cognito user has no sub")
+}
+
+func deleteCognitoUser(ctx context.Context, username string) {
+	_, err := cognitoClient.AdminDeleteUser(ctx, &cognitoidentityprovider.AdminDeleteUserInput{
+		UserPoolId: aws.String(userPoolID),
+		Username:   aws.String(username),
+	})
+	if err != nil {
+		log.Printf("Failed to roll back Cognito user %s: %v", username, err)
+	}
+}
+
+// writeCognitoError answers the Cognito errors that are the caller's
+// doing. Unknown users and wrong passwords get the same answer so login
+// cannot be used to discover accounts. It reports false for other errors.
+func writeCognitoError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var (
+		exists     *cognitotypes.UsernameExistsException
+		badPolicy  *cognitotypes.InvalidPasswordException
+		notAuth    *cognitotypes.NotAuthorizedException
+		noUser     *cognitotypes.UserNotFoundException
+		unverified *cognitotypes.UserNotConfirmedException
+		throttled  *cognitotypes.TooManyRequestsException
+	)
+	switch {
+	case errors.As(err, &exists):
+		problem.Write(w, r, problem.New(http.StatusConflict, "An account with this email already exists"))
+	case errors.As(err, &badPolicy):
+		problem.Write(w, r, problem.Validation(validate.Errors{{
+			Field: "password", Rule: "policy", Message: aws.ToString(badPolicy.Message),
+		}}))
+	case errors.As(err, &notAuth), errors.As(err, &noUser):
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "Incorrect email, password or refresh token"))
+	case errors.As(err, &unverified):
+		problem.Write(w, r, problem.New(http.StatusForbidden, "Account is not confirmed"))
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", "1")
+		problem.Write(w, r, problem.New(http.StatusTooManyRequests, "Too many attempts, try again shortly"))
+	default:
+		return writeContextError(w, r, err)
+	}
+	return true
+}
+
+// adminScope lets a caller act on every user, such as support staff and
+// back-office API clients.
+const adminScope = "admin"
+
+// requireScope answers 401 or 403 unless the caller's token has scope.
+func requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if r.Header.Get("X-User-Id") == "" && r.Header.Get("X-Client-Id") == "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "An authenticated caller is required"))
+		return false
+	}
+	if hasScope(r, scope) {
+		return true
+	}
+	problem.Write(w, r, problem.New(http.StatusForbidden, "The "+scope+" scope is required"))
+	return false
+}
+
+// requireSelfOrAdmin answers 404 unless the caller is userID or has the
+// admin scope. Other callers are told the user does not exist, so they
+// cannot learn which user IDs do.
+func requireSelfOrAdmin(w http.ResponseWriter, r *http.Request, userID string) bool {
+	if (userID != "" && r.Header.Get("X-User-Id") == userID) || hasScope(r, adminScope) {
+		return true
+	}
+	problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+	return false
+}
+
+// hasScope reports whether the caller's token, as the gateway forwards
+// it, has scope.
+func hasScope(r *http.Request, scope string) bool {
+	for _, s := range strings.Fields(r.Header.Get("X-Auth-Scope")) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
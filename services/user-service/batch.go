@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"pkg/dynamo"
+	"pkg/ids"
+	"pkg/problem"
+	"pkg/validate"
+
+	"user-service/api"
+)
+
+// maxBatchUsers caps GET /users?ids=. Callers such as the GraphQL
+// service's loaders batch at most this many keys.
+const maxBatchUsers = 100
+
+// maxBatchCreateUsers caps POST /users/batch; larger imports go through S3.
+const maxBatchCreateUsers = 1000
+
+// maxBatchCreateBody bounds the POST /users/batch body, comfortably above
+// maxBatchCreateUsers records.
+const maxBatchCreateBody = 4 << 20
+
+// Outcomes of one record of a batch create.
+const (
+	BatchCreated = "created"
+	BatchInvalid = "invalid"
+	// BatchFailed records were valid but not written; retrying them alone
+	// is safe.
+	BatchFailed = "failed"
+)
+
+// BatchCreateResult is the outcome of the record at Index.
+type BatchCreateResult struct {
+	Index  int             `json:"index"`
+	Status string          `json:"status"`
+	ID     string          `json:"id,omitempty"`
+	Errors validate.Errors `json:"errors,omitempty"`
+}
+
+type BatchCreateResponse struct {
+	Created int                 `json:"created"`
+	Invalid int                 `json:"invalid"`
+	Failed  int                 `json:"failed"`
+	Results []BatchCreateResult `json:"results"`
+}
+
+// batchGetUsersHandler answers GET /users?ids=a,b,c with the live users
+// among them, in no particular order. Unknown and deleted IDs are left out
+// rather than failing the batch.
+func batchGetUsersHandler(w http.ResponseWriter, r *http.Request, idList string) {
+	var userIDs []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(idList, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if !ids.Valid(id) {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("ids contains an invalid user ID %q", id)))
+			return
+		}
+		seen[id] = true
+		userIDs = append(userIDs, id)
+	}
+	if len(userIDs) > maxBatchUsers {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("ids may list at most %d users", maxBatchUsers)))
+		return
+	}
+
+	users, err := batchGetUsers(r.Context(), userIDs)
+	if err != nil {
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to batch get users: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+}
+
+// batchGetUsers reads up to maxBatchUsers users in one BatchGetItem call,
+// leaving out soft-deleted ones.
+func batchGetUsers(ctx context.Context, userIDs []string) ([]User, error) {
+	found, err := users.BatchGet(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	live := found[:0]
+	for _, user := range found {
+		if !user.Deleted {
+			live = append(live, user)
+		}
+	}
+	return live, nil
+}
+
+// batchCreateUsersHandler creates up to maxBatchCreateUsers users from
+// POST /users/batch and answers 200 with an outcome per record, whatever
+// they are. Invalid records are skipped and valid ones written with
+// BatchWriteItem. Imported users are not announced as registrations. With
+// s3_key instead of users, the import runs in the background; see
+// startUserImport.
+func batchCreateUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var req api.BatchCreateRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	switch {
+	case req.S3Key != "" && len(req.Users) > 0:
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "Give either users or s3_key, not both"))
+		return
+	case req.S3Key != "":
+		startUserImport(w, r, req)
+		return
+	case len(req.Users) == 0:
+		problem.Write(w, r, problem.Validation(validate.Errors{{Field: "users", Rule: "required", Message: "is required"}}))
+		return
+	case len(req.Users) > maxBatchCreateUsers:
+		problem.Write(w, r, problem.New(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("users may list at most %d records; import larger sets from S3", maxBatchCreateUsers)))
+		return
+	}
+
+	now := clk.Now()
+	response := BatchCreateResponse{Results: make([]BatchCreateResult, len(req.Users))}
+	var valid []User
+	var validIndex []int
+	for i, raw := range req.Users {
+		result := BatchCreateResult{Index: i, Status: BatchInvalid}
+		// Each record is checked against the spec here rather than with
+		// the body, so that it fails alone.
+		var value interface{}
+		var record api.CreateUserRequest
+		json.Unmarshal(raw, &value)
+		if errs := checkSchema("CreateUserRequest", value); len(errs) > 0 {
+			result.Errors = errs
+		} else if err := json.Unmarshal(raw, &record); err != nil {
+			result.Errors = validate.Errors{{Field: fmt.Sprintf("users[%d]", i), Rule: "json", Message: "must be a user object"}}
+		} else {
+			user := User{
+				ID:               generateUUID(),
+				Email:            string(record.Email),
+				FirstName:        record.FirstName,
+				LastName:         record.LastName,
+				MarketingConsent: record.MarketingConsent,
+				CreatedAt:        now,
+				UpdatedAt:        now,
+				Version:          1,
+			}
+			valid = append(valid, user)
+			validIndex = append(validIndex, i)
+			result = BatchCreateResult{Index: i, Status: BatchCreated, ID: user.ID}
+		}
+		response.Results[i] = result
+	}
+
+	// Even a failed batch may have written some users, so the cached
+	// list goes either way.
+	err := users.BatchPut(r.Context(), valid)
+	if len(valid) > 0 {
+		invalidateUsers(r.Context())
+	}
+	if err != nil {
+		var batchErr *dynamo.BatchError
+		if !errors.As(err, &batchErr) {
+			log.Printf("Failed to batch create users: %v", err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+			return
+		}
+		log.Printf("Batch create left %d of %d users unwritten: %v", len(batchErr.Failed), len(valid), batchErr.Err)
+		for _, i := range batchErr.Failed {
+			result := &response.Results[validIndex[i]]
+			result.Status = BatchFailed
+			result.ID = ""
+		}
+	}
+
+	for _, result := range response.Results {
+		switch result.Status {
+		case BatchCreated:
+			response.Created++
+		case BatchInvalid:
+			response.Invalid++
+		case BatchFailed:
+			response.Failed++
+		}
+	}
+	log.Printf("Batch created %d users (%d invalid, %d failed)", response.Created, response.Invalid, response.Failed)
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"pkg/metrics"
+	"pkg/tenant"
+)
+
+// Read-through cache for GET /users/{id} and GET /users, in Redis
+// (ElastiCache), so hot lookups from checkout don't each cost a DynamoDB
+// read. Every write to a user in this service drops the user and the list
+// from the cache; writes made elsewhere (the user-import and privacy
+// erasure lambdas) show up once the short TTLs run out. Without REDIS_ADDR
+// nothing is cached.
+//
+// Keys carry the tenant, like the users table's.
+
+// cacheBypassHeader makes a read skip the cache, for debugging; the answer
+// comes from DynamoDB and is not cached.
+const cacheBypassHeader = "X-Cache-Bypass"
+
+const (
+	userCachePrefix = "user-service:user:"
+	userListKey     = "user-service:users"
+)
+
+var (
+	cache *redis.Client
+
+	// userCacheTTL bounds how stale a cached user can be after a write
+	// from outside the service, and userListCacheTTL the user list.
+	userCacheTTL     = 30 * time.Second
+	userListCacheTTL = 10 * time.Second
+
+	cacheRequests *metrics.CounterVec
+)
+
+// initCache connects to Redis at REDIS_ADDR (host:port), with TLS unless
+// REDIS_TLS is "false" and REDIS_AUTH_TOKEN when set. Calls time out after
+// REDIS_TIMEOUT (default 100ms): a slow cache falls back to DynamoDB
+// rather than slowing the request.
+func initCache(registry *metrics.Registry) {
+	cacheRequests = registry.Counter("user_cache_requests_total",
+		"User cache lookups by key kind and result (hit, miss, bypass, error).", "kind", "result")
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		log.Printf("REDIS_ADDR not set, user caching disabled")
+		return
+	}
+	userCacheTTL = durationEnv("USER_CACHE_TTL", userCacheTTL)
+	userListCacheTTL = durationEnv("USER_LIST_CACHE_TTL", userListCacheTTL)
+	timeout := durationEnv("REDIS_TIMEOUT", 100*time.Millisecond)
+
+	opts := &redis.Options{
+		Addr:         addr,
+		Password:     os.Getenv("REDIS_AUTH_TOKEN"),
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		MaxRetries:   -1,
+	}
+	if os.Getenv("REDIS_TLS") != "false" {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	cache = redis.NewClient(opts)
+}
+
+// cachedUser returns the live user, from the cache when it holds it.
+// Cached users are stored as their JSON response, so fields the API never
+// returns are not set.
+func cachedUser(w http.ResponseWriter, r *http.Request, userID string) (User, error) {
+	return readThrough(w, r, "user", userCacheKey(r.Context(), userID), userCacheTTL, func(ctx context.Context) (User, error) {
+		return getUserByID(ctx, userID)
+	})
+}
+
+// cachedUserList returns every live user, from the cache when it holds
+// the list.
+func cachedUserList(w http.ResponseWriter, r *http.Request) ([]User, error) {
+	return readThrough(w, r, "list", userListCacheKey(r.Context()), userListCacheTTL, listAllUsers)
+}
+
+// readThrough returns the value cached under key, or loads it and caches
+// it for ttl, reporting which in X-Cache. Cache errors are logged and fall
+// back to load; load's errors, such as not found, are returned and not
+// cached.
+func readThrough[T any](w http.ResponseWriter, r *http.Request, kind, key string, ttl time.Duration, load func(context.Context) (T, error)) (T, error) {
+	ctx := r.Context()
+	bypass := bypassCache(r)
+	if cache != nil && !bypass {
+		data, err := cache.Get(ctx, key).Bytes()
+		switch {
+		case err == nil:
+			var v T
+			if err := json.Unmarshal(data, &v); err == nil {
+				cacheRequests.Add(1, kind, "hit")
+				w.Header().Set("X-Cache", "HIT")
+				return v, nil
+			}
+			log.Printf("Ignoring unreadable cache entry %s", key)
+		case errors.Is(err, redis.Nil):
+		default:
+			cacheRequests.Add(1, kind, "error")
+			log.Printf("Failed to read %s from cache: %v", key, err)
+		}
+	}
+
+	v, err := load(ctx)
+	if err != nil || cache == nil {
+		return v, err
+	}
+	if bypass {
+		cacheRequests.Add(1, kind, "bypass")
+		w.Header().Set("X-Cache", "BYPASS")
+		return v, nil
+	}
+	cacheRequests.Add(1, kind, "miss")
+	w.Header().Set("X-Cache", "MISS")
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode %s for the cache: %v", key, err)
+		return v, nil
+	}
+	if err := cache.Set(ctx, key, data, ttl).Err(); err != nil {
+		log.Printf("Failed to cache %s: %v", key, err)
+	}
+	return v, nil
+}
+
+// invalidateUsers drops the users and the user list from the cache after
+// a write. It runs even if the request was cancelled, since the write
+// went through. A failure leaves entries to expire with their TTL.
+func invalidateUsers(ctx context.Context, userIDs ...string) {
+	if cache == nil {
+		return
+	}
+	keys := []string{userListCacheKey(ctx)}
+	for _, id := range userIDs {
+		keys = append(keys, userCacheKey(ctx, id))
+	}
+	if err := cache.Del(context.WithoutCancel(ctx), keys...).Err(); err != nil {
+		log.Printf("Failed to invalidate cached users %s: %v", strings.Join(userIDs, ", "), err)
+	}
+}
+
+func userCacheKey(ctx context.Context, userID string) string {
+	return userCachePrefix + tenant.Key(ctx, userID)
+}
+
+func userListCacheKey(ctx context.Context) string {
+	return tenant.Key(ctx, userListKey)
+}
+
+func bypassCache(r *http.Request) bool {
+	value := strings.ToLower(r.Header.Get(cacheBypassHeader))
+	return value != "" && value != "false" && value != "0"
+}
+
+func durationEnv(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/etag"
+	"pkg/problem"
+)
+
+// Users are soft-deleted: DELETE /users/{id} marks the item deleted and
+// stamps purge_at, the table's TTL attribute, deletedRetention ahead. Until
+// then POST /users/{id}/restore brings the user back unchanged; afterwards
+// the user-purge lambda, and DynamoDB's own TTL sweep, remove the item.
+
+// restoreUserHandler undoes a soft delete. Restoring a live user is a
+// conflict; a user already purged is not found.
+func restoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	user, err := restoreUser(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		if errors.Is(err, errUserNotDeleted) {
+			problem.Write(w, r, problem.New(http.StatusConflict, "User is not deleted"))
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to restore user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	etag.Set(w, user.Version)
+	writeJSON(w, http.StatusOK, user)
+}
+
+var errUserNotDeleted = errors.New("user is not deleted")
+
+// bumpVersion is the update clause counting a write to a user, whose
+// Version is its ETag.
+const bumpVersion = "#version = if_not_exists(#version, :zero) + :one"
+
+// deleteUserByID soft-deletes a live user at the version pre allows,
+// reporting ErrNotFound when there is none and *staleVersionError when it
+// has been written since.
+func deleteUserByID(ctx context.Context, userID string, pre etag.Precondition) error {
+	now := clk.Now().UTC()
+	condition := "attribute_exists(id) AND attribute_not_exists(deleted)"
+	values := map[string]types.AttributeValue{
+		":deleted": &types.AttributeValueMemberBOOL{Value: true},
+		":now":     dynamo.S(now.Format(time.RFC3339Nano)),
+		":purge":   dynamo.N(strconv.FormatInt(now.Add(deletedRetention).Unix(), 10)),
+		":zero":    dynamo.N("0"),
+		":one":     dynamo.N("1"),
+	}
+	if !pre.Any {
+		version := dynamo.IfVersion("version", pre.Version)
+		condition += " AND " + version.Expression
+		for k, v := range version.Values {
+			values[k] = v
+		}
+	}
+	err := users.Update(ctx, userID, dynamo.Update{
+		Expression: "SET deleted = :deleted, deleted_at = :now, purge_at = :purge, updated_at = :now, " + bumpVersion,
+		Condition:  condition,
+		Names:      map[string]string{"#version": "version"},
+		Values:     values,
+	}, nil)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return versionConflict(ctx, userID)
+	}
+	if err == nil {
+		invalidateUsers(ctx, userID)
+	}
+	return err
+}
+
+// restoreUser clears a soft delete and returns the restored user.
+func restoreUser(ctx context.Context, userID string) (User, error) {
+	var user User
+	err := users.Update(ctx, userID, dynamo.Update{
+		Expression: "REMOVE deleted, deleted_at, purge_at SET updated_at = :now, " + bumpVersion,
+		Condition:  "attribute_exists(deleted)",
+		Names:      map[string]string{"#version": "version"},
+		Values: map[string]types.AttributeValue{
+			":now":  dynamo.S(clk.Now().UTC().Format(time.RFC3339Nano)),
+			":zero": dynamo.N("0"),
+			":one":  dynamo.N("1"),
+		},
+	}, &user)
+	if err == nil {
+		invalidateUsers(ctx, userID)
+	}
+	if !errors.Is(err, dynamo.ErrConditionFailed) {
+		return user, err
+	}
+
+	// The condition fails both for a live user and for no user at all.
+	if _, err := getUserByID(ctx, userID); err != nil {
+		return User{}, err
+	}
+	return User{}, fmt.Errorf("user %s: %w", userID, errUserNotDeleted)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pkg/problem"
+	"pkg/stream"
+)
+
+// exportPageSize bounds how many users are held in memory at once.
+const exportPageSize = 500
+
+func (u User) CSVHeader() []string {
+	return []string{"id", "email", "first_name", "last_name", "marketing_consent", "created_at", "updated_at"}
+}
+
+func (u User) CSVRow() []string {
+	return []string{
+		u.ID,
+		u.Email,
+		u.FirstName,
+		u.LastName,
+		strconv.FormatBool(u.MarketingConsent),
+		u.CreatedAt.Format(time.RFC3339),
+		u.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// exportUsersHandler streams every user as NDJSON (default) or CSV
+// (?format=csv or Accept: text/csv), one DynamoDB page at a time. Only
+// admins may export.
+func exportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, adminScope) {
+		return
+	}
+	format, err := stream.FormatFromRequest(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	sw := stream.NewWriter(w, format, "users")
+	err = scanUsers(r.Context(), func(users []User) error {
+		sw.ExtendDeadline(30 * time.Second)
+		for _, user := range users {
+			if err := sw.Write(user); err != nil {
+				return err
+			}
+		}
+		sw.Flush()
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to export users after %d rows: %v", sw.Rows(), err)
+		sw.Abort(fmt.Errorf("export failed"))
+		return
+	}
+
+	if err := sw.Close(); err != nil {
+		log.Printf("Failed to finish user export: %v", err)
+	}
+}
+
+// scanUsers pages through the live users in the table, handing each page to fn.
+func scanUsers(ctx context.Context, fn func([]User) error) error {
+	return users.ScanLive(ctx, exportPageSize, fn)
+}
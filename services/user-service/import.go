@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/problem"
+	"pkg/tenant"
+	"pkg/validate"
+
+	"user-service/api"
+)
+
+// Background user imports. POST /users/batch with an s3_key records an
+// import of a CSV or NDJSON object in the import bucket and hands it to
+// the user-import lambda, which writes the users in batches and records
+// its progress on the import; callers poll GET /users/imports/{importId}.
+
+// Import statuses. An import that ran to the end succeeds even if some
+// rows were invalid; it fails only when the file cannot be read.
+const (
+	ImportPending   = "PENDING"
+	ImportRunning   = "RUNNING"
+	ImportSucceeded = "SUCCEEDED"
+	ImportFailed    = "FAILED"
+)
+
+// Import file formats. CSV files need a header row naming the columns:
+// email, first_name, last_name and optionally marketing_consent. NDJSON
+// files hold one user object per line, shaped like a POST /users body.
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// UserImport is one background import and its progress.
+type UserImport struct {
+	ID          string        `json:"id" dynamodbav:"id"`
+	Status      string        `json:"status" dynamodbav:"status"`
+	S3Key       string        `json:"s3_key" dynamodbav:"s3_key"`
+	Format      string        `json:"format" dynamodbav:"format"`
+	Processed   int           `json:"processed" dynamodbav:"processed"`
+	Created     int           `json:"created" dynamodbav:"created"`
+	Invalid     int           `json:"invalid" dynamodbav:"invalid"`
+	Failed      int           `json:"failed" dynamodbav:"failed"`
+	Errors      []ImportError `json:"errors,omitempty" dynamodbav:"errors,omitempty"`
+	Error       string        `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	CreatedAt   time.Time     `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" dynamodbav:"updated_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
+}
+
+// ImportError is a rejected row; the lambda keeps the first hundred.
+type ImportError struct {
+	Row     int    `json:"row" dynamodbav:"row"`
+	Field   string `json:"field,omitempty" dynamodbav:"field,omitempty"`
+	Message string `json:"message" dynamodbav:"message"`
+}
+
+// userImportJob is the user-import lambda's event.
+type userImportJob struct {
+	ImportID string `json:"import_id"`
+	TenantID string `json:"tenant_id"`
+}
+
+var (
+	userImports        *dynamo.Table
+	importS3Client     *s3.Client
+	lambdaClient       *lambda.Client
+	importBucket       string
+	importFunctionName string
+)
+
+// initImports enables imports from S3 when their table, bucket and lambda
+// are configured; otherwise POST /users/batch with an s3_key answers 503.
+func initImports(cfg aws.Config) {
+	table := os.Getenv("USER_IMPORTS_TABLE_NAME")
+	importBucket = os.Getenv("USER_IMPORT_BUCKET")
+	importFunctionName = os.Getenv("USER_IMPORT_FUNCTION_NAME")
+	if table == "" || importBucket == "" || importFunctionName == "" {
+		log.Printf("User imports not configured, imports from S3 disabled")
+		return
+	}
+
+	userImports = dynamo.NewTable(dynamoClient, table,
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(dynamoTimeout))
+	importS3Client = s3.NewFromConfig(cfg)
+	lambdaClient = lambda.NewFromConfig(cfg)
+}
+
+// startUserImport answers 202 with the import and its polling URL once the
+// object is known to exist and the lambda has accepted the job.
+func startUserImport(w http.ResponseWriter, r *http.Request, req api.BatchCreateRequest) {
+	if userImports == nil {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Imports from S3 are not configured"))
+		return
+	}
+
+	format, errs := importFormat(req.S3Key, string(req.Format))
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+
+	_, err := importS3Client.HeadObject(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(importBucket),
+		Key:    aws.String(req.S3Key),
+	})
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		problem.Write(w, r, problem.Validation(validate.Errors{{
+			Field: "s3_key", Rule: "exists", Message: "is not an object in the import bucket",
+		}}))
+		return
+	}
+	if err != nil {
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to look up import object %s: %v", req.S3Key, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	now := clk.Now().UTC()
+	userImport := UserImport{
+		ID:        generateUUID(),
+		Status:    ImportPending,
+		S3Key:     req.S3Key,
+		Format:    format,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := userImports.Put(r.Context(), userImport, dynamo.IfNotExists("id")); err != nil {
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to save user import: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	payload, _ := json.Marshal(userImportJob{ImportID: userImport.ID, TenantID: tenant.FromContext(r.Context())})
+	_, err = lambdaClient.Invoke(r.Context(), &lambda.InvokeInput{
+		FunctionName:   aws.String(importFunctionName),
+		InvocationType: lambdatypes.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		failUserImport(context.WithoutCancel(r.Context()), userImport.ID, "import did not start")
+		log.Printf("Failed to start user import %s: %v", userImport.ID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	log.Printf("Started user import %s of %s", userImport.ID, req.S3Key)
+	w.Header().Set("Location", "/users/imports/"+userImport.ID)
+	writeJSON(w, http.StatusAccepted, userImport)
+}
+
+// getUserImportHandler reports an import's progress.
+func getUserImportHandler(w http.ResponseWriter, r *http.Request) {
+	if userImports == nil {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Imports from S3 are not configured"))
+		return
+	}
+	userImport, err := dynamo.Get[UserImport](r.Context(), userImports, dynamo.StringKey("id", mux.Vars(r)["importId"]))
+	if err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "Import not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get user import: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, userImport)
+}
+
+// importFormat checks the key and returns the file format, given or taken
+// from the key's extension.
+func importFormat(key, format string) (string, validate.Errors) {
+	var errs validate.Errors
+	if len(key) > 1024 || strings.HasPrefix(key, "/") || strings.Contains(key, "..") {
+		errs = append(errs, validate.FieldError{Field: "s3_key", Rule: "key", Message: "must be a relative object key"})
+	}
+	if format == "" {
+		switch strings.ToLower(path.Ext(key)) {
+		case ".csv":
+			format = ImportCSV
+		case ".ndjson", ".jsonl":
+			format = ImportNDJSON
+		}
+	}
+	if format != ImportCSV && format != ImportNDJSON {
+		errs = append(errs, validate.FieldError{
+			Field: "format", Rule: "oneof",
+			Message: "must be csv or ndjson, or given by a .csv, .ndjson or .jsonl key",
+		})
+	}
+	return format, errs
+}
+
+// failUserImport marks an import whose lambda never started, so it does
+// not stay pending forever.
+func failUserImport(ctx context.Context, importID, reason string) {
+	now := clk.Now().UTC().Format(time.RFC3339Nano)
+	err := userImports.Update(ctx, dynamo.StringKey("id", importID), dynamo.Update{
+		Expression: "SET #status = :failed, #error = :error, completed_at = :now, updated_at = :now",
+		Names:      map[string]string{"#status": "status", "#error": "error"},
+		Values: map[string]types.AttributeValue{
+			":failed": dynamo.S(ImportFailed),
+			":error":  dynamo.S(reason),
+			":now":    dynamo.S(now),
+		},
+	}, nil)
+	if err != nil {
+		log.Printf("Failed to mark user import %s failed: %v", importID, err)
+	}
+}
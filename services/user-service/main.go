@@ -3,37 +3,64 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/etag"
+	"pkg/events"
+	"pkg/health"
+	"pkg/idempotency"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/metrics"
+	"pkg/problem"
+	"pkg/recovery"
+	"pkg/tenant"
+
+	"user-service/api"
 )
 
 type User struct {
-	ID        string    `json:"id" dynamodbav:"id"`
-	Email     string    `json:"email" dynamodbav:"email"`
-	FirstName string    `json:"first_name" dynamodbav:"first_name"`
-	LastName  string    `json:"last_name" dynamodbav:"last_name"`
-	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" dynamodbav:"updated_at"`
-}
-
-type CreateUserRequest struct {
-	Email     string `json:"email"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-}
-
-type UpdateUserRequest struct {
-	FirstName *string `json:"first_name,omitempty"`
-	LastName  *string `json:"last_name,omitempty"`
+	ID               string    `json:"id" dynamodbav:"id"`
+	TenantID         string    `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+	Email            string    `json:"email" dynamodbav:"email"`
+	FirstName        string    `json:"first_name" dynamodbav:"first_name"`
+	LastName         string    `json:"last_name" dynamodbav:"last_name"`
+	MarketingConsent bool      `json:"marketing_consent" dynamodbav:"marketing_consent"`
+	CreatedAt        time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" dynamodbav:"updated_at"`
+
+	// Version counts writes to the user and is its ETag; PUT and DELETE
+	// must send it in If-Match. Users written before versioning are at 0.
+	Version int64 `json:"version" dynamodbav:"version"`
+
+	// CognitoSub links a user who signed up through /auth/signup to their
+	// Cognito identity.
+	CognitoSub string `json:"-" dynamodbav:"cognito_sub,omitempty"`
+
+	// Preferences are the user's consents, served on their own at
+	// /users/{id}/preferences; nil until first set.
+	Preferences *Preferences `json:"-" dynamodbav:"preferences,omitempty"`
+
+	// Soft deletion: a deleted user is hidden from every read until it is
+	// restored or, once PurgeAt (epoch seconds, the table's TTL attribute)
+	// passes, removed for good.
+	Deleted   bool       `json:"deleted,omitempty" dynamodbav:"deleted,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" dynamodbav:"deleted_at,omitempty"`
+	PurgeAt   int64      `json:"-" dynamodbav:"purge_at,omitempty"`
 }
 
 type HealthResponse struct {
@@ -44,10 +71,31 @@ type HealthResponse struct {
 }
 
 var (
-	dynamoClient *dynamodb.Client
-	tableName    string
-	serverPort   string
-	version      = "1.0.0"
+	dynamoClient      *dynamodb.Client
+	eventBridgeClient *eventbridge.Client
+	users             UserRepository
+	merges            *dynamo.Table
+	tableName         string
+	mergesTable       string
+	eventBusName      string
+	eventEncoder      *events.Encoder
+	serverPort        string
+	version           = "1.0.0"
+
+	// dynamoTimeout bounds each DynamoDB call on top of the request
+	// context, so a slow table fails the request before the server's
+	// write timeout does.
+	dynamoTimeout = 5 * time.Second
+
+	// deletedRetention is how long a soft-deleted user can be restored
+	// before user-purge removes it.
+	deletedRetention = 30 * 24 * time.Hour
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+	// consistentReads makes reads strongly consistent so tests can read
+	// their own writes.
+	consistentReads bool
 )
 
 func main() {
@@ -59,21 +107,71 @@ func main() {
 
 	// Initialize DynamoDB client
 	dynamoClient = dynamodb.NewFromConfig(cfg)
+	eventBridgeClient = eventbridge.NewFromConfig(cfg)
 	tableName = getEnv("DYNAMODB_TABLE_NAME", "users")
+	mergesTable = getEnv("USER_MERGES_TABLE_NAME", "user-merges")
+	eventBusName = os.Getenv("EVENT_BUS_NAME")
 	serverPort = getEnv("PORT", "3000")
+	cartServiceURL = strings.TrimRight(os.Getenv("CART_SERVICE_URL"), "/")
+	if value := os.Getenv("DYNAMODB_TIMEOUT"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			dynamoTimeout = d
+		}
+	}
+	if value := os.Getenv("DELETED_USER_RETENTION_DAYS"); value != "" {
+		if days, err := strconv.Atoi(value); err == nil && days > 0 {
+			deletedRetention = time.Duration(days) * 24 * time.Hour
+		}
+	}
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+	eventEncoder = &events.Encoder{Clock: clk, IDs: idGen}
+	consistentReads = clock.TestMode()
+	// Users are kept per tenant: a storefront brand sees only its own.
+	users = newTableUsers(dynamo.NewTable(dynamoClient, tableName,
+		dynamo.WithConsistentReads(consistentReads), dynamo.WithTimeout(dynamoTimeout),
+		dynamo.WithTenancy("id")))
+	merges = dynamo.NewTable(dynamoClient, mergesTable, dynamo.WithConsistentReads(true))
+	initTimelineSources()
+	initPrivacy(cfg)
+	initPreferences()
+	initAuth(cfg)
+	initImports(cfg)
 
 	// Create router
 	router := mux.NewRouter()
+	router.Use(recovery.New("user-service", clk, idGen).Middleware)
+
+	// Request count, error rate and latency per route, scraped from
+	// /metrics
+	registry := metrics.NewRegistry()
+	router.Use(metrics.NewHTTP(registry, "user-service", routeTemplate, clk).Middleware)
+	initCache(registry)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id", "requestId", "importId"))
+	router.Use(tenant.Middleware, events.Middleware)
+
+	// Idempotency-Key support for POST retries
+	if table := os.Getenv("IDEMPOTENCY_TABLE_NAME"); table != "" {
+		router.Use(idempotency.NewStore(dynamoClient, table, clk).Middleware)
+	}
 
 	// Health check endpoint
 	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("user-service", clk,
+		health.Table(dynamoClient, tableName, true),
+		health.Table(dynamoClient, mergesTable, false),
+	).Handler()).Methods("GET")
+	router.Handle("/metrics", registry.Handler()).Methods("GET")
+
+	// Test hooks
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs, consistent reads")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+	}
 
-	// User endpoints
-	router.HandleFunc("/users", createUserHandler).Methods("POST")
-	router.HandleFunc("/users/{id}", getUserHandler).Methods("GET")
-	router.HandleFunc("/users/{id}", updateUserHandler).Methods("PUT")
-	router.HandleFunc("/users/{id}", deleteUserHandler).Methods("DELETE")
-	router.HandleFunc("/users", listUsersHandler).Methods("GET")
+	// Auth and user endpoints, routed and validated from api/openapi.yaml
+	registerAPI(router)
 
 	// Start server
 	srv := &http.Server{
@@ -90,7 +188,7 @@ func main() {
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Status:    "healthy",
-		Timestamp: time.Now(),
+		Timestamp: clk.Now(),
 		Service:   "user-service",
 		Version:   version,
 	}
@@ -101,35 +199,35 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func createUserHandler(w http.ResponseWriter, r *http.Request) {
-	var req CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Validate input
-	if req.Email == "" || req.FirstName == "" || req.LastName == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	var req api.CreateUserRequest
+	if !decodeBody(w, r, &req) {
 		return
 	}
 
 	// Create user
+	now := clk.Now()
 	user := User{
-		ID:        generateUUID(),
-		Email:     req.Email,
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:               generateUUID(),
+		Email:            string(req.Email),
+		FirstName:        req.FirstName,
+		LastName:         req.LastName,
+		MarketingConsent: req.MarketingConsent,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Version:          1,
 	}
 
 	// Save to DynamoDB
-	if err := saveUser(user); err != nil {
+	if err := saveUser(r.Context(), user, 0); err != nil {
+		if writeContextError(w, r, err) {
+			return
+		}
 		log.Printf("Failed to save user: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
 		return
 	}
 
+	etag.Set(w, user.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
@@ -139,41 +237,62 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["id"]
 
-	user, err := getUserByID(userID)
+	user, err := cachedUser(w, r, userID)
 	if err != nil {
-		if err.Error() == "user not found" {
-			http.Error(w, "User not found", http.StatusNotFound)
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
 			return
 		}
 		log.Printf("Failed to get user: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
 		return
 	}
 
+	if etag.NotModified(r, user.Version) {
+		etag.WriteNotModified(w, user.Version)
+		return
+	}
+	etag.Set(w, user.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(user)
 }
 
+// updateUserHandler applies a partial update to the version of the user
+// named in If-Match; a stale version is answered with 412.
 func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["id"]
 
-	var req UpdateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	pre, ok := etag.RequireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req api.UpdateUserRequest
+	if !decodeBody(w, r, &req) {
 		return
 	}
 
 	// Get existing user
-	user, err := getUserByID(userID)
+	user, err := getUserByID(r.Context(), userID)
 	if err != nil {
-		if err.Error() == "user not found" {
-			http.Error(w, "User not found", http.StatusNotFound)
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
 			return
 		}
 		log.Printf("Failed to get user: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	if !pre.Matches(user.Version) {
+		etag.WriteFailed(w, r, user.Version)
 		return
 	}
 
@@ -184,27 +303,63 @@ func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	if req.LastName != nil {
 		user.LastName = *req.LastName
 	}
-	user.UpdatedAt = time.Now()
+	if req.MarketingConsent != nil {
+		user.MarketingConsent = *req.MarketingConsent
+	}
+	user.UpdatedAt = clk.Now()
+	user.Version++
 
-	// Save updated user
-	if err := saveUser(user); err != nil {
+	// Save updated user, unless another write got there first
+	if err := saveUser(r.Context(), user, user.Version-1); err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		var stale *staleVersionError
+		if errors.As(err, &stale) {
+			etag.WriteFailed(w, r, stale.current)
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
 		log.Printf("Failed to update user: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
 		return
 	}
 
+	etag.Set(w, user.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(user)
 }
 
+// deleteUserHandler soft-deletes the version of the user named in
+// If-Match; a stale version is answered with 412.
 func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["id"]
 
-	if err := deleteUserByID(userID); err != nil {
+	pre, ok := etag.RequireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := deleteUserByID(r.Context(), userID, pre); err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		var stale *staleVersionError
+		if errors.As(err, &stale) {
+			etag.WriteFailed(w, r, stale.current)
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
 		log.Printf("Failed to delete user: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
 		return
 	}
 
@@ -214,10 +369,13 @@ func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func listUsersHandler(w http.ResponseWriter, r *http.Request) {
-	users, err := listAllUsers()
+	users, err := cachedUserList(w, r)
 	if err != nil {
+		if writeContextError(w, r, err) {
+			return
+		}
 		log.Printf("Failed to list users: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
 		return
 	}
 
@@ -227,82 +385,99 @@ func listUsersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // DynamoDB operations
-func saveUser(user User) error {
-	item, err := attributevalue.MarshalMap(user)
-	if err != nil {
-		return fmt.Errorf("failed to marshal user: %w", err)
-	}
 
-	_, err = dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(tableName),
-		Item:      item,
-	})
-
-	return err
+// staleVersionError reports a write whose expected version is no longer
+// the user's.
+type staleVersionError struct {
+	userID  string
+	current int64
 }
 
-func getUserByID(userID string) (User, error) {
-	result, err := dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String(tableName),
-		Key: map[string]dynamodb.AttributeValue{
-			"id": &dynamodb.AttributeMemberS{Value: userID},
-		},
-	})
+func (e *staleVersionError) Error() string {
+	return fmt.Sprintf("user %s is at version %d", e.userID, e.current)
+}
 
-	if err != nil {
-		return User{}, fmt.Errorf("failed to get user: %w", err)
+// saveUser writes user if it is still at version expected, 0 for a new
+// user. A user soft-deleted in the meantime is reported as ErrNotFound
+// rather than brought back, and one written since as *staleVersionError.
+func saveUser(ctx context.Context, user User, expected int64) error {
+	err := users.Put(ctx, user, dynamo.IfNotExists("deleted"), dynamo.IfVersion("version", expected))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return versionConflict(ctx, user.ID)
 	}
-
-	if len(result.Item) == 0 {
-		return User{}, fmt.Errorf("user not found")
+	if err == nil {
+		invalidateUsers(ctx, user.ID)
 	}
+	return err
+}
 
-	var user User
-	err = attributevalue.UnmarshalMap(result.Item, &user)
+// versionConflict explains a failed versioned write to userID: the user
+// is gone, or at another version.
+func versionConflict(ctx context.Context, userID string) error {
+	current, err := getUserByID(ctx, userID)
 	if err != nil {
-		return User{}, fmt.Errorf("failed to unmarshal user: %w", err)
+		return err
 	}
+	return &staleVersionError{userID: userID, current: current.Version}
+}
 
-	return user, nil
+// getUserByID reads a live user; soft-deleted users are not found.
+func getUserByID(ctx context.Context, userID string) (User, error) {
+	user, err := users.Get(ctx, userID)
+	if err == nil && user.Deleted {
+		return User{}, fmt.Errorf("user %s is deleted: %w", userID, dynamo.ErrNotFound)
+	}
+	return user, err
 }
 
-func deleteUserByID(userID string) error {
-	_, err := dynamoClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
-		TableName: aws.String(tableName),
-		Key: map[string]dynamodb.AttributeValue{
-			"id": &dynamodb.AttributeMemberS{Value: userID},
-		},
+func listAllUsers(ctx context.Context) ([]User, error) {
+	all := []User{}
+	err := users.ScanLive(ctx, 0, func(page []User) error {
+		all = append(all, page...)
+		return nil
 	})
-
-	return err
+	return all, err
 }
 
-func listAllUsers() ([]User, error) {
-	result, err := dynamoClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(tableName),
-	})
+// Utility functions
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to scan users: %w", err)
+// writeContextError answers a request whose DynamoDB call was cut short by
+// its context: 408 when the client went away, 503 when the call ran out of
+// time. It reports false for any other error.
+func writeContextError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled):
+		log.Printf("Request %s %s cancelled by client: %v", r.Method, r.URL.Path, err)
+		problem.Write(w, r, problem.New(http.StatusRequestTimeout, "Request was cancelled"))
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Printf("Request %s %s timed out: %v", r.Method, r.URL.Path, err)
+		w.Header().Set("Retry-After", "1")
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "User store did not respond in time"))
+	default:
+		return false
 	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
 
-	var users []User
-	for _, item := range result.Items {
-		var user User
-		err := attributevalue.UnmarshalMap(item, &user)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+// routeTemplate labels metrics with the matched route rather than the raw
+// path, which would give every user ID its own series.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
 		}
-		users = append(users, user)
 	}
-
-	return users, nil
+	return "unmatched"
 }
 
-// Utility functions
 func generateUUID() string {
-	// Simple UUID generation - in production, use a proper UUID library
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	return idGen.NewID()
 }
 
 func getEnv(key, defaultValue string) string {
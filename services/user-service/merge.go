@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/events"
+	"pkg/problem"
+	"pkg/tenant"
+
+	"user-service/api"
+)
+
+// Anonymous visitors get a client-generated UUID that stands in for the
+// user ID on carts, sessions and ad clicks until they log in or register.
+// Merging moves everything recorded under that ID to the identified user.
+
+// EventBridge source and detail types of user-service events.
+const (
+	eventSource              = events.SourceUserService
+	detailTypeUserMerged     = "User Merged"
+	detailTypeConsentChanged = "User Consent Changed"
+)
+
+// Merge record statuses. A merge that failed part way stays in progress
+// and is resumed by retrying the request; every step only touches records
+// still owned by the anonymous ID, so replays are safe.
+const (
+	MergeStatusInProgress = "IN_PROGRESS"
+	MergeStatusCompleted  = "COMPLETED"
+)
+
+// MergeResult is both the response and the stored merge record, keyed by
+// anonymous ID so an anonymous identity is merged at most once.
+type MergeResult struct {
+	AnonymousID string `json:"anonymous_id" dynamodbav:"anonymous_id"`
+	UserID      string `json:"user_id" dynamodbav:"user_id"`
+	Trigger     string `json:"trigger" dynamodbav:"trigger"`
+	Status      string `json:"status" dynamodbav:"status"`
+	// CartID is the user's open cart after the merge, if any.
+	CartID string `json:"cart_id,omitempty" dynamodbav:"cart_id,omitempty"`
+	// CartsMerged were folded into CartID; CartsReassigned could not be
+	// combined and now belong to the user as they are.
+	CartsMerged     int `json:"carts_merged" dynamodbav:"carts_merged"`
+	CartsReassigned int `json:"carts_reassigned" dynamodbav:"carts_reassigned"`
+	// Records counts events and attribution records moved, per store.
+	Records     map[string]int `json:"records" dynamodbav:"records"`
+	StartedAt   time.Time      `json:"started_at" dynamodbav:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
+}
+
+var (
+	// cartServiceURL is where a merge hands the anonymous carts to the
+	// user; carts are left alone when it is unset.
+	cartServiceURL string
+	cartClient     = &http.Client{Timeout: 10 * time.Second}
+)
+
+// cartMergeResult is cart-service's answer to POST /carts/merge.
+type cartMergeResult struct {
+	CartID          string `json:"cart_id"`
+	CartsMerged     int    `json:"carts_merged"`
+	CartsReassigned int    `json:"carts_reassigned"`
+}
+
+var (
+	errMergeConflict = errors.New("anonymous ID already merged into another user")
+	errCartConflict  = errors.New("cart was modified concurrently")
+)
+
+// mergeUserHandler consolidates an anonymous visitor's records into the
+// user after login or registration and emits a "User Merged" event.
+func mergeUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	var req api.MergeRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.AnonymousID == userID {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "anonymous_id must differ from the user ID"))
+		return
+	}
+
+	if _, err := getUserByID(r.Context(), userID); err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	// Folding one account into another is a support operation, not a login
+	// side effect.
+	if _, err := getUserByID(r.Context(), req.AnonymousID); err == nil {
+		problem.Write(w, r, problem.New(http.StatusConflict, "anonymous_id belongs to a registered user"))
+		return
+	} else if !errors.Is(err, dynamo.ErrNotFound) {
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	result, err := mergeAnonymous(r.Context(), req, userID)
+	switch {
+	case errors.Is(err, errMergeConflict):
+		problem.Write(w, r, problem.New(http.StatusConflict, "anonymous_id was already merged into another user"))
+	case errors.Is(err, errCartConflict):
+		problem.Write(w, r, problem.New(http.StatusConflict, "A cart was modified during the merge; retry the request"))
+	case err != nil:
+		log.Printf("Failed to merge %s into user %s: %v", req.AnonymousID, userID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// mergeAnonymous runs or resumes the merge of req.AnonymousID into userID.
+// A completed merge is returned as stored.
+func mergeAnonymous(ctx context.Context, req api.MergeRequest, userID string) (MergeResult, error) {
+	record, err := claimMerge(ctx, req, userID)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	if record.Status == MergeStatusCompleted {
+		return record, nil
+	}
+
+	if record.Records == nil {
+		record.Records = map[string]int{}
+	}
+	for _, t := range userEventTables {
+		table := os.Getenv(t.env)
+		if table == "" {
+			continue
+		}
+		n, err := reassignUserEvents(ctx, dynamo.NewTable(dynamoClient, table), req.AnonymousID, userID)
+		if err != nil {
+			return MergeResult{}, err
+		}
+		record.Records[t.name] += n
+	}
+
+	if err := mergeCarts(ctx, req.AnonymousID, userID, &record); err != nil {
+		return MergeResult{}, err
+	}
+
+	now := clk.Now()
+	record.Status = MergeStatusCompleted
+	record.CompletedAt = &now
+	if err := publishMerged(ctx, record); err != nil {
+		return MergeResult{}, err
+	}
+	if err := saveMerge(ctx, record); err != nil {
+		return MergeResult{}, err
+	}
+
+	log.Printf("Merged anonymous %s into user %s: %d carts merged, %d reassigned, records %v",
+		record.AnonymousID, userID, record.CartsMerged, record.CartsReassigned, record.Records)
+	return record, nil
+}
+
+// claimMerge records that the anonymous ID is being merged into userID. If
+// a record already exists it is returned when it names the same user, so a
+// retry resumes or replays the merge; a different user is a conflict.
+func claimMerge(ctx context.Context, req api.MergeRequest, userID string) (MergeResult, error) {
+	record := MergeResult{
+		AnonymousID: req.AnonymousID,
+		UserID:      userID,
+		Trigger:     string(req.Trigger),
+		Status:      MergeStatusInProgress,
+		Records:     map[string]int{},
+		StartedAt:   clk.Now(),
+	}
+	err := merges.Put(ctx, record, dynamo.IfNotExists("anonymous_id"))
+	if err == nil {
+		return record, nil
+	}
+	if !errors.Is(err, dynamo.ErrConditionFailed) {
+		return MergeResult{}, fmt.Errorf("failed to claim merge: %w", err)
+	}
+
+	existing, err := dynamo.Get[MergeResult](ctx, merges, dynamo.StringKey("anonymous_id", req.AnonymousID))
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("failed to get merge record: %w", err)
+	}
+	if existing.UserID != userID {
+		return MergeResult{}, errMergeConflict
+	}
+	return existing, nil
+}
+
+func saveMerge(ctx context.Context, record MergeResult) error {
+	if err := merges.Put(ctx, record); err != nil {
+		return fmt.Errorf("failed to save merge record: %w", err)
+	}
+	return nil
+}
+
+// reassignUserEvents moves every record in table from the anonymous ID to
+// the user, tagging it merged_from. Attribution records (ad clicks) are
+// kept whole rather than deduplicated against the user's own, so
+// attribution models see the full path to conversion.
+func reassignUserEvents(ctx context.Context, table *dynamo.Table, anonymousID, userID string) (int, error) {
+	type eventRef struct {
+		ID string `dynamodbav:"id"`
+	}
+
+	var moved int
+	err := dynamo.QueryEach(ctx, table, dynamo.Query{
+		Index:        "user_id-timestamp-index",
+		KeyCondition: "user_id = :anon",
+		Projection:   "id",
+		Values:       map[string]types.AttributeValue{":anon": dynamo.S(anonymousID)},
+	}, func(records []eventRef) error {
+		for _, record := range records {
+			err := table.Update(ctx, dynamo.StringKey("id", record.ID), dynamo.Update{
+				Expression: "SET user_id = :user, merged_from = :anon",
+				Condition:  "user_id = :anon",
+				Values: map[string]types.AttributeValue{
+					":user": dynamo.S(userID),
+					":anon": dynamo.S(anonymousID),
+				},
+			}, nil)
+			// The index lags the table; a record already moved is skipped.
+			if errors.Is(err, dynamo.ErrConditionFailed) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to reassign %s record: %w", table.Name, err)
+			}
+			moved++
+		}
+		return nil
+	})
+	return moved, err
+}
+
+// mergeCarts has cart-service, which owns the carts, fold the anonymous
+// carts into the user's open cart or hand them over. It is safe to replay,
+// so a resumed merge simply asks again.
+func mergeCarts(ctx context.Context, anonymousID, userID string, record *MergeResult) error {
+	if cartServiceURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(map[string]string{"anonymous_id": anonymousID, "user_id": userID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cart merge: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cartServiceURL+"/carts/merge", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build cart merge request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(tenant.Header, tenant.FromContext(ctx))
+
+	resp, err := cartClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to merge carts: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		return errCartConflict
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("cart-service returned %d for the cart merge", resp.StatusCode)
+	}
+
+	var result cartMergeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode cart merge: %w", err)
+	}
+	// A replay finds the carts already moved and reports none, so counts
+	// from an earlier attempt are kept.
+	record.CartsMerged += result.CartsMerged
+	record.CartsReassigned += result.CartsReassigned
+	if result.CartID != "" {
+		record.CartID = result.CartID
+	}
+	return nil
+}
+
+func publishMerged(ctx context.Context, record MergeResult) error {
+	return publishEvent(ctx, detailTypeUserMerged, record, record.CompletedAt)
+}
+
+// publishEvent puts one user-service event on the platform bus; without a
+// bus configured it does nothing.
+func publishEvent(ctx context.Context, detailType string, v interface{}, at *time.Time) error {
+	if eventBusName == "" {
+		return nil
+	}
+	detail, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return putEvent(ctx, detailType, string(detail), at)
+}
+
+// publishDomainEvent puts one of the events defined in pkg/events on the
+// platform bus, validated and with its metadata; without a bus configured
+// it does nothing.
+func publishDomainEvent(ctx context.Context, e events.Event) error {
+	if eventBusName == "" {
+		return nil
+	}
+	entry, err := eventEncoder.Marshal(ctx, e)
+	if err != nil {
+		return err
+	}
+	return putEvent(ctx, entry.DetailType, entry.Detail, &entry.Time)
+}
+
+func putEvent(ctx context.Context, detailType, detail string, at *time.Time) error {
+	result, err := eventBridgeClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{
+			{
+				EventBusName: aws.String(eventBusName),
+				Source:       aws.String(eventSource),
+				DetailType:   aws.String(detailType),
+				Detail:       aws.String(detail),
+				Time:         at,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put event: %w", err)
+	}
+	if result.FailedEntryCount > 0 {
+		return fmt.Errorf("event rejected: %s", aws.ToString(result.Entries[0].ErrorMessage))
+	}
+	return nil
+}
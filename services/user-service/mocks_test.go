@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"pkg/dynamo"
+)
+
+// mockUsers is a UserRepository answering with the functions a test sets.
+// A method the test did not expect fails it.
+type mockUsers struct {
+	t *testing.T
+
+	GetFunc        func(ctx context.Context, userID string) (User, error)
+	BatchGetFunc   func(ctx context.Context, userIDs []string) ([]User, error)
+	ScanLiveFunc   func(ctx context.Context, limit int32, fn func([]User) error) error
+	PutFunc        func(ctx context.Context, user User, conditions ...dynamo.Condition) error
+	BatchPutFunc   func(ctx context.Context, users []User) error
+	UpdateFunc     func(ctx context.Context, userID string, u dynamo.Update, out *User) error
+	UpdateWithFunc func(ctx context.Context, userID string, u dynamo.Update, items ...dynamo.TxItem) error
+}
+
+// useUsers makes m the users repository for the rest of the test.
+func useUsers(t *testing.T, m *mockUsers) *mockUsers {
+	t.Helper()
+	m.t = t
+	saved := users
+	users = m
+	t.Cleanup(func() { users = saved })
+	return m
+}
+
+func (m *mockUsers) unexpected(method string) {
+	m.t.Helper()
+	m.t.Fatalf("unexpected call to UserRepository.%s", method)
+}
+
+func (m *mockUsers) Get(ctx context.Context, userID string) (User, error) {
+	if m.GetFunc == nil {
+		m.unexpected("Get")
+	}
+	return m.GetFunc(ctx, userID)
+}
+
+func (m *mockUsers) BatchGet(ctx context.Context, userIDs []string) ([]User, error) {
+	if m.BatchGetFunc == nil {
+		m.unexpected("BatchGet")
+	}
+	return m.BatchGetFunc(ctx, userIDs)
+}
+
+func (m *mockUsers) ScanLive(ctx context.Context, limit int32, fn func([]User) error) error {
+	if m.ScanLiveFunc == nil {
+		m.unexpected("ScanLive")
+	}
+	return m.ScanLiveFunc(ctx, limit, fn)
+}
+
+func (m *mockUsers) Put(ctx context.Context, user User, conditions ...dynamo.Condition) error {
+	if m.PutFunc == nil {
+		m.unexpected("Put")
+	}
+	return m.PutFunc(ctx, user, conditions...)
+}
+
+func (m *mockUsers) BatchPut(ctx context.Context, users []User) error {
+	if m.BatchPutFunc == nil {
+		m.unexpected("BatchPut")
+	}
+	return m.BatchPutFunc(ctx, users)
+}
+
+func (m *mockUsers) Update(ctx context.Context, userID string, u dynamo.Update, out *User) error {
+	if m.UpdateFunc == nil {
+		m.unexpected("Update")
+	}
+	return m.UpdateFunc(ctx, userID, u, out)
+}
+
+func (m *mockUsers) UpdateWith(ctx context.Context, userID string, u dynamo.Update, items ...dynamo.TxItem) error {
+	if m.UpdateWithFunc == nil {
+		m.unexpected("UpdateWith")
+	}
+	return m.UpdateWithFunc(ctx, userID, u, items...)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gorilla/mux"
+
+	"pkg/problem"
+	"pkg/validate"
+
+	"user-service/api"
+)
+
+// The API is defined in api/openapi.yaml, from which oapi-codegen
+// generates the api package: request and response types, the routes and
+// their parameter binding, and the spec itself. Every request is checked
+// against its operation in the spec before the handler runs, so handlers
+// decode bodies into the generated types without validating them again.
+// The spec is served at /openapi.json.
+
+// maxRequestBody bounds every request body, which is read whole to be
+// validated; POST /users/batch takes the largest.
+const maxRequestBody = maxBatchCreateBody
+
+var (
+	apiSpec     *openapi3.T
+	apiSpecJSON []byte
+)
+
+func init() {
+	// The spec's formats follow the rules pkg/validate applies elsewhere.
+	openapi3.DefineStringFormatCallback("email", formatRule(validate.IsEmail, "must be a valid email address"))
+	openapi3.DefineStringFormatCallback("uuid", formatRule(validate.IsUUID, "must be a UUID"))
+	openapi3filter.RegisterBodyDecoder(mergePatchType, openapi3filter.RegisteredBodyDecoder("application/json"))
+}
+
+// registerAPI loads the spec and routes its operations, validated, to the
+// handlers.
+func registerAPI(router *mux.Router) {
+	spec, err := api.GetSwagger()
+	if err != nil {
+		log.Fatalf("Failed to load OpenAPI spec: %v", err)
+	}
+	if err := spec.Validate(context.Background()); err != nil {
+		log.Fatalf("Invalid OpenAPI spec: %v", err)
+	}
+	if apiSpecJSON, err = json.Marshal(spec); err != nil {
+		log.Fatalf("Failed to encode OpenAPI spec: %v", err)
+	}
+	apiSpec = spec
+
+	router.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
+	api.HandlerWithOptions(apiServer{}, api.GorillaServerOptions{
+		BaseRouter:  router,
+		Middlewares: []api.MiddlewareFunc{validateRequest},
+		ErrorHandlerFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+		},
+	})
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(apiSpecJSON)
+}
+
+// validateRequest checks a request's parameters, Content-Type and body
+// against its operation. Every field at fault is listed: parameters are
+// answered with 400 and bodies with 422, as the handlers did. A body
+// without a Content-Type is taken to be JSON.
+func validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, err := specRoute(r)
+		if err != nil {
+			log.Printf("No OpenAPI operation for %s %s: %v", r.Method, r.URL.Path, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if body := route.Operation.RequestBody; body != nil && r.ContentLength != 0 {
+			if r.Header.Get("Content-Type") == "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			if body.Value.Content.Get(r.Header.Get("Content-Type")) == nil {
+				types := strings.Join(sortedFields(body.Value.Content), ", ")
+				if r.Method == http.MethodPatch {
+					w.Header().Set("Accept-Patch", types)
+				}
+				problem.Write(w, r, problem.New(http.StatusUnsupportedMediaType, "Content-Type must be one of "+types))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		}
+
+		err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: mux.Vars(r),
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		})
+		if err != nil {
+			problem.Write(w, r, requestProblem(err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// specRoute finds the request's operation from the route mux matched.
+func specRoute(r *http.Request) (*routers.Route, error) {
+	template, err := mux.CurrentRoute(r).GetPathTemplate()
+	if err != nil {
+		return nil, err
+	}
+	item := apiSpec.Paths.Value(template)
+	if item == nil || item.GetOperation(r.Method) == nil {
+		return nil, routers.ErrPathNotFound
+	}
+	return &routers.Route{
+		Spec:      apiSpec,
+		Path:      template,
+		PathItem:  item,
+		Method:    r.Method,
+		Operation: item.GetOperation(r.Method),
+	}, nil
+}
+
+// requestProblem turns a failed validation into the problem to answer.
+func requestProblem(err error) problem.Problem {
+	var params, fields validate.Errors
+	for _, err := range flatten(err) {
+		var (
+			reqErr   *openapi3filter.RequestError
+			tooLarge *http.MaxBytesError
+			parseErr *openapi3filter.ParseError
+		)
+		switch {
+		case !errors.As(err, &reqErr):
+			return problem.New(http.StatusBadRequest, err.Error())
+		case errors.As(reqErr.Err, &tooLarge):
+			return problem.New(http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Request body must be at most %d bytes", tooLarge.Limit))
+		case reqErr.Parameter != nil:
+			params = append(params, schemaErrors(reqErr.Parameter.Name, reqErr.Err)...)
+		case errors.As(reqErr.Err, &parseErr):
+			return problem.Malformed("Request body must be valid JSON")
+		default:
+			fields = append(fields, schemaErrors("", reqErr.Err)...)
+		}
+	}
+	if len(params) > 0 {
+		p := problem.Validation(params)
+		p.Status = http.StatusBadRequest
+		return p
+	}
+	return problem.Validation(fields)
+}
+
+// checkSchema validates value, decoded from JSON, against one of the
+// spec's schemas, for parts of a request that are checked on their own.
+func checkSchema(name string, value interface{}) validate.Errors {
+	err := apiSpec.Components.Schemas[name].Value.VisitJSON(value, openapi3.VisitAsRequest(), openapi3.MultiErrors())
+	if err != nil {
+		return schemaErrors("", err)
+	}
+	return nil
+}
+
+// schemaErrors lists the fields err finds at fault under prefix, by JSON
+// path ("users[2].email"), with the broken schema keyword as the rule.
+func schemaErrors(prefix string, err error) validate.Errors {
+	var errs validate.Errors
+	for _, err := range flatten(err) {
+		var schemaErr *openapi3.SchemaError
+		switch {
+		case errors.As(err, &schemaErr):
+			errs = append(errs, validate.FieldError{
+				Field:   fieldPath(prefix, schemaErr.JSONPointer()),
+				Rule:    schemaErr.SchemaField,
+				Message: schemaErr.Reason,
+			})
+		case errors.Is(err, openapi3filter.ErrInvalidRequired):
+			errs = append(errs, validate.FieldError{Field: prefix, Rule: "required", Message: "is required"})
+		default:
+			errs = append(errs, validate.FieldError{Field: prefix, Rule: "invalid", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// flatten lists the errors in err, which may nest MultiErrors.
+func flatten(err error) []error {
+	multi, ok := err.(openapi3.MultiError)
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, err := range multi {
+		errs = append(errs, flatten(err)...)
+	}
+	return errs
+}
+
+func fieldPath(prefix string, pointer []string) string {
+	path := prefix
+	for _, part := range pointer {
+		switch _, err := strconv.Atoi(part); {
+		case err == nil:
+			path += "[" + part + "]"
+		case path == "":
+			path = part
+		default:
+			path += "." + part
+		}
+	}
+	return path
+}
+
+func formatRule(valid func(string) bool, message string) openapi3.FormatCallback {
+	return func(value string) error {
+		if !valid(value) {
+			return errors.New(message)
+		}
+		return nil
+	}
+}
+
+// decodeBody decodes a validated request body into its generated type,
+// answering 400 and reporting false if that fails.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return false
+	}
+	return true
+}
+
+// apiServer implements the generated api.ServerInterface with the
+// handlers. Path parameters are also left in mux.Vars, where the handlers
+// read them.
+type apiServer struct{}
+
+func (apiServer) Signup(w http.ResponseWriter, r *http.Request) { signupHandler(w, r) }
+
+func (apiServer) Login(w http.ResponseWriter, r *http.Request) { loginHandler(w, r) }
+
+func (apiServer) RefreshTokens(w http.ResponseWriter, r *http.Request) { refreshHandler(w, r) }
+
+func (apiServer) ListUsers(w http.ResponseWriter, r *http.Request, params api.ListUsersParams) {
+	if params.Ids != nil && *params.Ids != "" {
+		batchGetUsersHandler(w, r, *params.Ids)
+		return
+	}
+	listUsersHandler(w, r)
+}
+
+func (apiServer) CreateUser(w http.ResponseWriter, r *http.Request, _ api.CreateUserParams) {
+	createUserHandler(w, r)
+}
+
+func (apiServer) BatchCreateUsers(w http.ResponseWriter, r *http.Request, _ api.BatchCreateUsersParams) {
+	batchCreateUsersHandler(w, r)
+}
+
+func (apiServer) ExportUsers(w http.ResponseWriter, r *http.Request, _ api.ExportUsersParams) {
+	exportUsersHandler(w, r)
+}
+
+func (apiServer) GetUserImport(w http.ResponseWriter, r *http.Request, _ string) {
+	getUserImportHandler(w, r)
+}
+
+func (apiServer) GetUser(w http.ResponseWriter, r *http.Request, _ api.UserID, _ api.GetUserParams) {
+	getUserHandler(w, r)
+}
+
+func (apiServer) UpdateUser(w http.ResponseWriter, r *http.Request, _ api.UserID, _ api.UpdateUserParams) {
+	updateUserHandler(w, r)
+}
+
+func (apiServer) PatchUser(w http.ResponseWriter, r *http.Request, _ api.UserID, _ api.PatchUserParams) {
+	patchUserHandler(w, r)
+}
+
+func (apiServer) DeleteUser(w http.ResponseWriter, r *http.Request, _ api.UserID, _ api.DeleteUserParams) {
+	deleteUserHandler(w, r)
+}
+
+func (apiServer) RestoreUser(w http.ResponseWriter, r *http.Request, _ api.UserID) {
+	restoreUserHandler(w, r)
+}
+
+func (apiServer) GetUserTimeline(w http.ResponseWriter, r *http.Request, _ api.UserID, params api.GetUserTimelineParams) {
+	timelineHandler(w, r, params)
+}
+
+func (apiServer) GetUserPreferences(w http.ResponseWriter, r *http.Request, _ api.UserID) {
+	getPreferencesHandler(w, r)
+}
+
+func (apiServer) UpdateUserPreferences(w http.ResponseWriter, r *http.Request, _ api.UserID, _ api.UpdateUserPreferencesParams) {
+	updatePreferencesHandler(w, r)
+}
+
+func (apiServer) GetUserConsentHistory(w http.ResponseWriter, r *http.Request, _ api.UserID, params api.GetUserConsentHistoryParams) {
+	consentHistoryHandler(w, r, params)
+}
+
+func (apiServer) MergeUser(w http.ResponseWriter, r *http.Request, _ api.UserID) {
+	mergeUserHandler(w, r)
+}
+
+func (apiServer) ExportUserData(w http.ResponseWriter, r *http.Request, _ api.UserID) {
+	exportUserDataHandler(w, r)
+}
+
+func (apiServer) EraseUserData(w http.ResponseWriter, r *http.Request, _ api.UserID) {
+	eraseUserDataHandler(w, r)
+}
+
+func (apiServer) GetPrivacyRequest(w http.ResponseWriter, r *http.Request, _ api.UserID, _ string) {
+	getPrivacyRequestHandler(w, r)
+}
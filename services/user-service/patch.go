@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/etag"
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// PATCH /users/{id} takes an RFC 7386 JSON Merge Patch or an RFC 6902 JSON
+// Patch and applies it as a single UpdateItem, without reading the user
+// first. Like PUT it needs If-Match; JSON Patch "test" operations become
+// part of the update's condition.
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// patchableFields are the user fields a patch may change, by JSON name,
+// with the value each takes. The rest are read-only.
+var patchableFields = map[string]func() interface{}{
+	"first_name":        func() interface{} { return new(string) },
+	"last_name":         func() interface{} { return new(string) },
+	"marketing_consent": func() interface{} { return new(bool) },
+}
+
+// userPatch is a patch reduced to the fields it sets and the values it
+// tests, both keyed by field.
+type userPatch struct {
+	set   map[string]interface{}
+	tests map[string]interface{}
+}
+
+// jsonPatchOp is one RFC 6902 operation.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+var errPatchTestFailed = errors.New("patch test failed")
+
+func patchUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var parse func(json.RawMessage) (userPatch, validate.Errors)
+	switch mediaType {
+	case mergePatchType, "application/json":
+		parse = parseMergePatch
+	case jsonPatchType:
+		parse = parseJSONPatch
+	default:
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		problem.Write(w, r, problem.New(http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Content-Type must be %s or %s", mergePatchType, jsonPatchType)))
+		return
+	}
+
+	pre, ok := etag.RequireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be valid JSON"))
+		return
+	}
+	patch, errs := parse(raw)
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+
+	user, err := applyUserPatch(r.Context(), userID, pre, patch)
+	if err != nil {
+		var stale *staleVersionError
+		switch {
+		case errors.Is(err, dynamo.ErrNotFound):
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+		case errors.As(err, &stale):
+			etag.WriteFailed(w, r, stale.current)
+		case errors.Is(err, errPatchTestFailed):
+			problem.Write(w, r, problem.New(http.StatusConflict, "A test operation did not match the user"))
+		case writeContextError(w, r, err):
+		default:
+			log.Printf("Failed to patch user: %v", err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		}
+		return
+	}
+
+	etag.Set(w, user.Version)
+	writeJSON(w, http.StatusOK, user)
+}
+
+// applyUserPatch writes patch to the user at the version pre allows and
+// returns the user as updated. A patch that changes nothing writes
+// nothing.
+func applyUserPatch(ctx context.Context, userID string, pre etag.Precondition, patch userPatch) (User, error) {
+	if len(patch.set) == 0 && len(patch.tests) == 0 {
+		user, err := getUserByID(ctx, userID)
+		if err == nil && !pre.Matches(user.Version) {
+			err = &staleVersionError{userID: userID, current: user.Version}
+		}
+		return user, err
+	}
+
+	names := map[string]string{"#version": "version"}
+	values := map[string]types.AttributeValue{
+		":now":  dynamo.S(clk.Now().UTC().Format(time.RFC3339Nano)),
+		":zero": dynamo.N("0"),
+		":one":  dynamo.N("1"),
+	}
+	clauses := []string{"updated_at = :now", bumpVersion}
+	conditions := []string{"attribute_exists(id)", "attribute_not_exists(deleted)"}
+	if !pre.Any {
+		version := dynamo.IfVersion("version", pre.Version)
+		conditions = append(conditions, version.Expression)
+		for k, v := range version.Values {
+			values[k] = v
+		}
+	}
+	for _, field := range sortedFields(patch.set) {
+		names["#"+field] = field
+		values[":set_"+field] = attributeValue(patch.set[field])
+		clauses = append(clauses, fmt.Sprintf("#%s = :set_%s", field, field))
+	}
+	for _, field := range sortedFields(patch.tests) {
+		names["#"+field] = field
+		values[":test_"+field] = attributeValue(patch.tests[field])
+		conditions = append(conditions, fmt.Sprintf("#%s = :test_%s", field, field))
+	}
+
+	var user User
+	err := users.Update(ctx, userID, dynamo.Update{
+		Expression: "SET " + strings.Join(clauses, ", "),
+		Condition:  strings.Join(conditions, " AND "),
+		Names:      names,
+		Values:     values,
+	}, &user)
+	if err == nil {
+		invalidateUsers(ctx, userID)
+	}
+	if !errors.Is(err, dynamo.ErrConditionFailed) {
+		return user, err
+	}
+
+	// Which condition failed: the user is gone, at another version, or
+	// fails a test.
+	err = versionConflict(ctx, userID)
+	var stale *staleVersionError
+	if errors.As(err, &stale) && (pre.Any || stale.current == pre.Version) && len(patch.tests) > 0 {
+		return User{}, fmt.Errorf("user %s: %w", userID, errPatchTestFailed)
+	}
+	return User{}, err
+}
+
+// parseMergePatch reads an RFC 7386 merge patch. Every user field is
+// required, so null, which would remove one, is rejected.
+func parseMergePatch(raw json.RawMessage) (userPatch, validate.Errors) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+		return userPatch{}, validate.Errors{{Field: "", Rule: "object", Message: "merge patch must be a JSON object"}}
+	}
+
+	patch := userPatch{set: make(map[string]interface{})}
+	var errs validate.Errors
+	for _, field := range sortedFields(members) {
+		value, fe := patchValue(field, members[field])
+		if fe != nil {
+			errs = append(errs, *fe)
+			continue
+		}
+		patch.set[field] = value
+	}
+	if len(errs) > 0 {
+		return userPatch{}, errs
+	}
+	return patch, validatePatch(patch.set)
+}
+
+// parseJSONPatch reads an RFC 6902 patch of add, replace and test
+// operations on top-level fields. Operations apply in order, so a later
+// one on the same field wins, but every test checks the user as stored
+// before the patch. Remove, move and copy would leave a required field
+// unset and are rejected.
+func parseJSONPatch(raw json.RawMessage) (userPatch, validate.Errors) {
+	var ops []jsonPatchOp
+	if err := json.Unmarshal(raw, &ops); err != nil {
+		return userPatch{}, validate.Errors{{Field: "", Rule: "array", Message: "JSON Patch must be an array of operations"}}
+	}
+
+	patch := userPatch{set: make(map[string]interface{}), tests: make(map[string]interface{})}
+	var errs validate.Errors
+	for i, op := range ops {
+		at := fmt.Sprintf("[%d]", i)
+		field := strings.TrimPrefix(op.Path, "/")
+		if !strings.HasPrefix(op.Path, "/") || strings.ContainsAny(field, "/~") {
+			errs = append(errs, validate.FieldError{Field: at + ".path", Rule: "path", Message: "must name a top-level user field"})
+			continue
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+		case "remove", "move", "copy":
+			errs = append(errs, validate.FieldError{Field: at + ".op", Rule: "oneof",
+				Message: op.Op + " is not supported; user fields are required"})
+			continue
+		default:
+			errs = append(errs, validate.FieldError{Field: at + ".op", Rule: "oneof", Message: "must be add, replace or test"})
+			continue
+		}
+		if op.Value == nil {
+			errs = append(errs, validate.FieldError{Field: at + ".value", Rule: "required", Message: "is required"})
+			continue
+		}
+		value, fe := patchValue(field, op.Value)
+		if fe != nil {
+			fe.Field = at + ".value"
+			errs = append(errs, *fe)
+			continue
+		}
+		if op.Op == "test" {
+			patch.tests[field] = value
+		} else {
+			patch.set[field] = value
+		}
+	}
+	if len(errs) > 0 {
+		return userPatch{}, errs
+	}
+	return patch, validatePatch(patch.set)
+}
+
+// patchValue decodes the new value of a patchable field.
+func patchValue(field string, raw json.RawMessage) (interface{}, *validate.FieldError) {
+	newValue, ok := patchableFields[field]
+	if !ok {
+		return nil, &validate.FieldError{Field: field, Rule: "readonly", Message: "cannot be patched"}
+	}
+	if string(raw) == "null" {
+		return nil, &validate.FieldError{Field: field, Rule: "required", Message: "cannot be removed"}
+	}
+	value := newValue()
+	if err := json.Unmarshal(raw, value); err != nil {
+		return nil, &validate.FieldError{Field: field, Rule: "type", Message: "has the wrong type"}
+	}
+	return value, nil
+}
+
+// validatePatch applies PUT's schema to the values a patch sets.
+func validatePatch(set map[string]interface{}) validate.Errors {
+	values := make(map[string]interface{}, len(set))
+	for field, value := range set {
+		switch v := value.(type) {
+		case *string:
+			values[field] = *v
+		case *bool:
+			values[field] = *v
+		}
+	}
+	return checkSchema("UpdateUserRequest", values)
+}
+
+func attributeValue(value interface{}) types.AttributeValue {
+	switch v := value.(type) {
+	case *string:
+		return dynamo.S(*v)
+	case *bool:
+		return &types.AttributeValueMemberBOOL{Value: *v}
+	}
+	panic(fmt.Sprintf("unexpected patch value %T", value))
+}
+
+func sortedFields[V any](m map[string]V) []string {
+	fields := make([]string, 0, len(m))
+	for field := range m {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
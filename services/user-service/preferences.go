@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/etag"
+	"pkg/problem"
+	"pkg/tenant"
+
+	"user-service/api"
+)
+
+// Consent preferences. A user consents separately to marketing email, SMS
+// and ads personalization (their hashed email in Google Ads Customer Match
+// audiences, which the audience-sync lambda uploads). The preferences live
+// on the user record, so readers such as audience-sync get them with the
+// user, and each change is published as a User Consent Changed event. Every
+// change is also recorded in the consent log as proof of
+// consent: one record per channel granted or withdrawn, written in the
+// same transaction, never updated or deleted. The ECS task role is denied
+// both in Terraform.
+//
+// Users who never set preferences predate them; every consent is then
+// their marketing_consent, which afterwards follows the email consent.
+
+// Consent channels, as recorded in the consent log.
+const (
+	ChannelEmail              = "email"
+	ChannelSMS                = "sms"
+	ChannelAdsPersonalization = "ads_personalization"
+)
+
+var consentChannels = []string{ChannelEmail, ChannelSMS, ChannelAdsPersonalization}
+
+// consentSourcePreferences marks consent changed through
+// PUT /users/{id}/preferences.
+const consentSourcePreferences = "preferences"
+
+const defaultConsentHistoryLimit = 50
+
+var consentLog *dynamo.Table
+
+// Preferences are a user's consents. UpdatedAt is nil until they are first
+// set.
+type Preferences struct {
+	Email              bool       `json:"email" dynamodbav:"email"`
+	SMS                bool       `json:"sms" dynamodbav:"sms"`
+	AdsPersonalization bool       `json:"ads_personalization" dynamodbav:"ads_personalization"`
+	UpdatedAt          *time.Time `json:"updated_at,omitempty" dynamodbav:"updated_at,omitempty"`
+}
+
+func (p Preferences) granted(channel string) bool {
+	switch channel {
+	case ChannelEmail:
+		return p.Email
+	case ChannelSMS:
+		return p.SMS
+	case ChannelAdsPersonalization:
+		return p.AdsPersonalization
+	}
+	return false
+}
+
+// ConsentRecord is one consent granted or withdrawn. IDs are UUIDv7, so
+// the log sorts by time within a user.
+type ConsentRecord struct {
+	UserID     string    `json:"-" dynamodbav:"user_id"`
+	ID         string    `json:"id" dynamodbav:"id"`
+	Channel    string    `json:"channel" dynamodbav:"channel"`
+	Granted    bool      `json:"granted" dynamodbav:"granted"`
+	Source     string    `json:"source" dynamodbav:"source"`
+	Actor      string    `json:"actor,omitempty" dynamodbav:"actor,omitempty"`
+	RecordedAt time.Time `json:"recorded_at" dynamodbav:"recorded_at"`
+}
+
+// ConsentChanged is the event published when a user's consents change,
+// so audience-sync can drop a user who withdrew at once.
+type ConsentChanged struct {
+	UserID             string    `json:"user_id"`
+	Email              bool      `json:"email"`
+	SMS                bool      `json:"sms"`
+	AdsPersonalization bool      `json:"ads_personalization"`
+	ChangedAt          time.Time `json:"changed_at"`
+}
+
+// ConsentHistory is one page of a user's consent log, newest first.
+type ConsentHistory struct {
+	Records    []ConsentRecord `json:"records"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// initPreferences opens the consent log, USER_CONSENT_LOG_TABLE_NAME,
+// keyed by user_id and id and scoped by tenant like the users table.
+func initPreferences() {
+	consentLog = dynamo.NewTable(dynamoClient, getEnv("USER_CONSENT_LOG_TABLE_NAME", "user-consent-log"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(dynamoTimeout),
+		dynamo.WithTenancy("user_id"))
+}
+
+// preferences returns the user's consents, derived from marketing_consent
+// when they were never set.
+func (u User) preferences() Preferences {
+	if u.Preferences != nil {
+		return *u.Preferences
+	}
+	return Preferences{
+		Email:              u.MarketingConsent,
+		SMS:                u.MarketingConsent,
+		AdsPersonalization: u.MarketingConsent,
+	}
+}
+
+func getPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	user, err := getUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	etag.Set(w, user.Version)
+	writeJSON(w, http.StatusOK, user.preferences())
+}
+
+// updatePreferencesHandler sets every consent of the version of the user
+// named in If-Match; a stale version is answered with 412.
+func updatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	pre, ok := etag.RequireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req api.Preferences
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	prefs := Preferences{Email: req.Email, SMS: req.SMS, AdsPersonalization: req.AdsPersonalization}
+
+	user, err := setPreferences(r.Context(), userID, pre, prefs, consentActor(r))
+	if err != nil {
+		var stale *staleVersionError
+		switch {
+		case errors.Is(err, dynamo.ErrNotFound):
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+		case errors.As(err, &stale):
+			etag.WriteFailed(w, r, stale.current)
+		case writeContextError(w, r, err):
+		default:
+			log.Printf("Failed to update preferences of user %s: %v", userID, err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		}
+		return
+	}
+
+	etag.Set(w, user.Version)
+	writeJSON(w, http.StatusOK, user.preferences())
+}
+
+// setPreferences writes prefs to the user at the version pre allows, with
+// a consent record for every channel that changes, and returns the user as
+// updated. Preferences set for the first time record every channel.
+// Preferences that change nothing write nothing.
+func setPreferences(ctx context.Context, userID string, pre etag.Precondition, prefs Preferences, actor string) (User, error) {
+	user, err := getUserByID(ctx, userID)
+	if err != nil {
+		return User{}, err
+	}
+	if !pre.Matches(user.Version) {
+		return User{}, &staleVersionError{userID: userID, current: user.Version}
+	}
+
+	now := clk.Now().UTC()
+	current := user.preferences()
+	var records []dynamo.TxItem
+	for _, channel := range consentChannels {
+		if user.Preferences != nil && current.granted(channel) == prefs.granted(channel) {
+			continue
+		}
+		records = append(records, consentLog.PutTx(ConsentRecord{
+			UserID:     userID,
+			ID:         generateUUID(),
+			Channel:    channel,
+			Granted:    prefs.granted(channel),
+			Source:     consentSourcePreferences,
+			Actor:      actor,
+			RecordedAt: now,
+		}, dynamo.IfNotExists("id")))
+	}
+	if len(records) == 0 {
+		return user, nil
+	}
+
+	prefs.UpdatedAt = &now
+	av, err := attributevalue.Marshal(prefs)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to marshal preferences: %w", err)
+	}
+	version := dynamo.IfVersion("version", user.Version)
+	values := map[string]types.AttributeValue{
+		":prefs": av,
+		":email": &types.AttributeValueMemberBOOL{Value: prefs.Email},
+		":now":   dynamo.S(now.Format(time.RFC3339Nano)),
+		":zero":  dynamo.N("0"),
+		":one":   dynamo.N("1"),
+	}
+	for k, v := range version.Values {
+		values[k] = v
+	}
+	update := dynamo.Update{
+		Expression: "SET preferences = :prefs, marketing_consent = :email, updated_at = :now, " + bumpVersion,
+		Condition:  "attribute_exists(id) AND attribute_not_exists(deleted) AND " + version.Expression,
+		Names:      map[string]string{"#version": "version"},
+		Values:     values,
+	}
+
+	err = users.UpdateWith(ctx, userID, update, records...)
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		return User{}, versionConflict(ctx, userID)
+	}
+	if err != nil {
+		return User{}, err
+	}
+	invalidateUsers(ctx, userID)
+
+	// The consent log is the record; a lost event only delays removal
+	// from audiences until the next daily audience-sync run.
+	err = publishEvent(ctx, detailTypeConsentChanged, ConsentChanged{
+		UserID:             userID,
+		Email:              prefs.Email,
+		SMS:                prefs.SMS,
+		AdsPersonalization: prefs.AdsPersonalization,
+		ChangedAt:          now,
+	}, &now)
+	if err != nil {
+		log.Printf("Failed to publish consent change of user %s: %v", userID, err)
+	}
+
+	user.Preferences = &prefs
+	user.MarketingConsent = prefs.Email
+	user.UpdatedAt = now
+	user.Version++
+	return user, nil
+}
+
+// consentHistoryHandler pages through a live user's consent log, newest
+// first: ?limit= (default 50) and ?cursor= from the previous page.
+func consentHistoryHandler(w http.ResponseWriter, r *http.Request, params api.GetUserConsentHistoryParams) {
+	userID := mux.Vars(r)["id"]
+
+	if _, err := getUserByID(r.Context(), userID); err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	limit := defaultConsentHistoryLimit
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	q := dynamo.Query{
+		KeyCondition: "user_id = :user",
+		Values:       map[string]types.AttributeValue{":user": dynamo.S(tenant.Key(r.Context(), userID))},
+		Descending:   true,
+		Limit:        int32(limit),
+	}
+	if params.Cursor != nil && *params.Cursor != "" {
+		q.KeyCondition += " AND id < :cursor"
+		q.Values[":cursor"] = dynamo.S(*params.Cursor)
+	}
+
+	page, err := dynamo.QueryPage[ConsentRecord](r.Context(), consentLog, q)
+	if err != nil {
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to read consent history of user %s: %v", userID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	history := ConsentHistory{Records: page.Items}
+	if len(page.Next) > 0 && len(page.Items) > 0 {
+		history.NextCursor = page.Items[len(page.Items)-1].ID
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// consentActor names who changed consent: the user or API client the
+// gateway authenticated, or nobody for an unauthenticated call.
+func consentActor(r *http.Request) string {
+	if user := r.Header.Get("X-User-Id"); user != "" {
+		return "user:" + user
+	}
+	if client := r.Header.Get("X-Client-Id"); client != "" {
+		return "client:" + client
+	}
+	return ""
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/problem"
+	"pkg/tenant"
+)
+
+// Data subject requests. POST /users/{id}/export and POST /users/{id}/erase
+// record a privacy request and start its Step Functions workflow, which the
+// privacy-worker lambda carries out across the user, order, cart and event
+// tables; callers poll GET /users/{id}/privacy-requests/{requestId} until
+// it finishes. A finished export answers with a short-lived download link
+// to the archive in S3.
+
+// Privacy request kinds.
+const (
+	PrivacyExport  = "export"
+	PrivacyErasure = "erasure"
+)
+
+// Privacy request statuses; the workflow moves a request from running to
+// succeeded or failed.
+const (
+	PrivacyRunning   = "RUNNING"
+	PrivacySucceeded = "SUCCEEDED"
+	PrivacyFailed    = "FAILED"
+)
+
+// downloadURLTTL bounds how long an export link works; each poll of a
+// finished export issues a fresh one.
+const downloadURLTTL = 15 * time.Minute
+
+// PrivacyRequest is one export or erasure of a user's data.
+type PrivacyRequest struct {
+	ID           string         `json:"id" dynamodbav:"id"`
+	UserID       string         `json:"user_id" dynamodbav:"user_id"`
+	Kind         string         `json:"kind" dynamodbav:"kind"`
+	Status       string         `json:"status" dynamodbav:"status"`
+	ExecutionARN string         `json:"-" dynamodbav:"execution_arn,omitempty"`
+	ArchiveKey   string         `json:"-" dynamodbav:"archive_key,omitempty"`
+	Records      map[string]int `json:"records,omitempty" dynamodbav:"records,omitempty"`
+	Error        string         `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	CreatedAt    time.Time      `json:"created_at" dynamodbav:"created_at"`
+	CompletedAt  *time.Time     `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
+
+	DownloadURL       string     `json:"download_url,omitempty" dynamodbav:"-"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty" dynamodbav:"-"`
+}
+
+// privacyWorkflowInput is what each workflow execution starts with.
+type privacyWorkflowInput struct {
+	RequestID string `json:"request_id"`
+	UserID    string `json:"user_id"`
+	TenantID  string `json:"tenant_id"`
+	Kind      string `json:"kind"`
+}
+
+var (
+	privacyRequests *dynamo.Table
+	sfnClient       *sfn.Client
+	presignClient   *s3.PresignClient
+	exportBucket    string
+
+	// privacyWorkflows maps each kind to its state machine ARN.
+	privacyWorkflows = map[string]string{}
+)
+
+// initPrivacy enables privacy requests when their table and workflows are
+// configured; otherwise the endpoints answer 503.
+func initPrivacy(cfg aws.Config) {
+	table := os.Getenv("PRIVACY_REQUESTS_TABLE_NAME")
+	exportARN := os.Getenv("PRIVACY_EXPORT_STATE_MACHINE_ARN")
+	erasureARN := os.Getenv("PRIVACY_ERASURE_STATE_MACHINE_ARN")
+	exportBucket = os.Getenv("PRIVACY_EXPORT_BUCKET")
+	if table == "" || exportARN == "" || erasureARN == "" || exportBucket == "" {
+		log.Printf("Privacy request workflows not configured, export and erasure disabled")
+		return
+	}
+
+	privacyRequests = dynamo.NewTable(dynamoClient, table,
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(dynamoTimeout))
+	sfnClient = sfn.NewFromConfig(cfg)
+	presignClient = s3.NewPresignClient(s3.NewFromConfig(cfg))
+	privacyWorkflows[PrivacyExport] = exportARN
+	privacyWorkflows[PrivacyErasure] = erasureARN
+}
+
+func exportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	startPrivacyRequest(w, r, PrivacyExport)
+}
+
+func eraseUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	startPrivacyRequest(w, r, PrivacyErasure)
+}
+
+// startPrivacyRequest answers 202 with the request and its polling URL. A
+// request of the same kind still running for the user is returned instead
+// of starting another.
+func startPrivacyRequest(w http.ResponseWriter, r *http.Request, kind string) {
+	userID := mux.Vars(r)["id"]
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+	if privacyRequests == nil {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Privacy requests are not configured"))
+		return
+	}
+
+	// Soft-deleted users keep their rights over the data until it is
+	// purged, so the raw item is checked rather than getUserByID.
+	if _, err := users.Get(r.Context(), userID); err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	request, err := runningPrivacyRequest(r.Context(), userID, kind)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		request, err = startPrivacyWorkflow(r.Context(), userID, kind)
+	}
+	if err != nil {
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to start %s of user %s: %v", kind, userID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/users/%s/privacy-requests/%s", userID, request.ID))
+	writeJSON(w, http.StatusAccepted, request)
+}
+
+// getPrivacyRequestHandler reports a request's progress; a succeeded
+// export carries a download link.
+func getPrivacyRequestHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !requireSelfOrAdmin(w, r, vars["id"]) {
+		return
+	}
+	if privacyRequests == nil {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "Privacy requests are not configured"))
+		return
+	}
+
+	request, err := dynamo.Get[PrivacyRequest](r.Context(), privacyRequests, dynamo.StringKey("id", vars["requestId"]))
+	if err == nil && request.UserID != vars["id"] {
+		err = dynamo.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "Privacy request not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get privacy request: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	if request.Kind == PrivacyExport && request.Status == PrivacySucceeded && request.ArchiveKey != "" {
+		if err := presignDownload(r.Context(), &request); err != nil {
+			log.Printf("Failed to presign export %s: %v", request.ID, err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, request)
+}
+
+// runningPrivacyRequest finds the user's newest request of kind if it has
+// not finished, reporting ErrNotFound otherwise.
+func runningPrivacyRequest(ctx context.Context, userID, kind string) (PrivacyRequest, error) {
+	page, err := dynamo.QueryPage[PrivacyRequest](ctx, privacyRequests, dynamo.Query{
+		Index:        "user_id-created_at-index",
+		KeyCondition: "user_id = :user",
+		Filter:       "#kind = :kind",
+		Names:        map[string]string{"#kind": "kind"},
+		Values: map[string]types.AttributeValue{
+			":user": dynamo.S(userID),
+			":kind": dynamo.S(kind),
+		},
+		Descending: true,
+	})
+	if err != nil {
+		return PrivacyRequest{}, fmt.Errorf("failed to query privacy requests: %w", err)
+	}
+	if len(page.Items) == 0 || page.Items[0].Status != PrivacyRunning {
+		return PrivacyRequest{}, dynamo.ErrNotFound
+	}
+	return page.Items[0], nil
+}
+
+// startPrivacyWorkflow records a running request and starts its workflow,
+// named after the request so a retried start cannot run it twice.
+func startPrivacyWorkflow(ctx context.Context, userID, kind string) (PrivacyRequest, error) {
+	request := PrivacyRequest{
+		ID:        generateUUID(),
+		UserID:    userID,
+		Kind:      kind,
+		Status:    PrivacyRunning,
+		CreatedAt: clk.Now().UTC(),
+	}
+	if err := privacyRequests.Put(ctx, request, dynamo.IfNotExists("id")); err != nil {
+		return PrivacyRequest{}, fmt.Errorf("failed to save privacy request: %w", err)
+	}
+
+	input, _ := json.Marshal(privacyWorkflowInput{
+		RequestID: request.ID, UserID: userID, TenantID: tenant.FromContext(ctx), Kind: kind,
+	})
+	execution, err := sfnClient.StartExecution(ctx, &sfn.StartExecutionInput{
+		StateMachineArn: aws.String(privacyWorkflows[kind]),
+		Name:            aws.String(request.ID),
+		Input:           aws.String(string(input)),
+	})
+	if err != nil {
+		failPrivacyRequest(ctx, request, err)
+		return PrivacyRequest{}, fmt.Errorf("failed to start %s workflow: %w", kind, err)
+	}
+
+	request.ExecutionARN = aws.ToString(execution.ExecutionArn)
+	err = privacyRequests.Update(ctx, dynamo.StringKey("id", request.ID), dynamo.Update{
+		Expression: "SET execution_arn = :arn",
+		Values:     map[string]types.AttributeValue{":arn": dynamo.S(request.ExecutionARN)},
+	}, nil)
+	if err != nil {
+		// The workflow runs regardless; only the reference is missing.
+		log.Printf("Failed to record execution of privacy request %s: %v", request.ID, err)
+	}
+	log.Printf("Started %s of user %s as privacy request %s", kind, userID, request.ID)
+	return request, nil
+}
+
+// failPrivacyRequest marks a request whose workflow never started, so a
+// retry starts a new one rather than finding it running.
+func failPrivacyRequest(ctx context.Context, request PrivacyRequest, cause error) {
+	err := privacyRequests.Update(ctx, dynamo.StringKey("id", request.ID), dynamo.Update{
+		Expression: "SET #status = :failed, #error = :error, completed_at = :now",
+		Names:      map[string]string{"#status": "status", "#error": "error"},
+		Values: map[string]types.AttributeValue{
+			":failed": dynamo.S(PrivacyFailed),
+			":error":  dynamo.S("workflow did not start"),
+			":now":    dynamo.S(clk.Now().UTC().Format(time.RFC3339Nano)),
+		},
+	}, nil)
+	if err != nil {
+		log.Printf("Failed to mark privacy request %s failed after %v: %v", request.ID, cause, err)
+	}
+}
+
+func presignDownload(ctx context.Context, request *PrivacyRequest) error {
+	presigned, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(exportBucket),
+		Key:                        aws.String(request.ArchiveKey),
+		ResponseContentDisposition: aws.String(fmt.Sprintf(`attachment; filename="user-%s-export.zip"`, request.UserID)),
+	}, s3.WithPresignExpires(downloadURLTTL))
+	if err != nil {
+		return err
+	}
+	expires := clk.Now().UTC().Add(downloadURLTTL)
+	request.DownloadURL = presigned.URL
+	request.DownloadExpiresAt = &expires
+	return nil
+}
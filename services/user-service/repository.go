@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+
+	"pkg/dynamo"
+)
+
+// UserRepository is where users are kept. The handlers reach the users
+// table only through it, so they run the same against DynamoDB or an
+// in-memory stand-in.
+type UserRepository interface {
+	// Get returns the user, soft-deleted or not, or dynamo.ErrNotFound.
+	Get(ctx context.Context, userID string) (User, error)
+	// BatchGet returns those of the users that exist, in no particular
+	// order.
+	BatchGet(ctx context.Context, userIDs []string) ([]User, error)
+	// ScanLive hands the users that are not soft-deleted to fn, up to
+	// limit at a time; zero leaves the page size to the store.
+	ScanLive(ctx context.Context, limit int32, fn func([]User) error) error
+	// Put writes user if every condition holds, failing with
+	// dynamo.ErrConditionFailed otherwise.
+	Put(ctx context.Context, user User, conditions ...dynamo.Condition) error
+	// BatchPut writes users unconditionally; users it could not write are
+	// reported in a *dynamo.BatchError.
+	BatchPut(ctx context.Context, users []User) error
+	// Update applies u to the user. With out non-nil the user as updated
+	// is decoded into it.
+	Update(ctx context.Context, userID string, u dynamo.Update, out *User) error
+	// UpdateWith applies u to the user in one transaction with items, the
+	// writes to other tables that must happen with it.
+	UpdateWith(ctx context.Context, userID string, u dynamo.Update, items ...dynamo.TxItem) error
+}
+
+// tableUsers is the UserRepository over the users table.
+type tableUsers struct {
+	table *dynamo.Table
+}
+
+// newTableUsers returns the UserRepository over table, keyed by id.
+func newTableUsers(table *dynamo.Table) *tableUsers {
+	return &tableUsers{table: table}
+}
+
+func (u *tableUsers) Get(ctx context.Context, userID string) (User, error) {
+	return dynamo.Get[User](ctx, u.table, userKey(userID))
+}
+
+func (u *tableUsers) BatchGet(ctx context.Context, userIDs []string) ([]User, error) {
+	keys := make([]dynamo.Key, 0, len(userIDs))
+	for _, id := range userIDs {
+		keys = append(keys, userKey(id))
+	}
+	return dynamo.BatchGet[User](ctx, u.table, keys)
+}
+
+func (u *tableUsers) ScanLive(ctx context.Context, limit int32, fn func([]User) error) error {
+	return dynamo.ScanEach(ctx, u.table, dynamo.Scan{Filter: "attribute_not_exists(deleted)", Limit: limit}, fn)
+}
+
+func (u *tableUsers) Put(ctx context.Context, user User, conditions ...dynamo.Condition) error {
+	return u.table.Put(ctx, user, conditions...)
+}
+
+func (u *tableUsers) BatchPut(ctx context.Context, users []User) error {
+	return dynamo.BatchPut(ctx, u.table, users)
+}
+
+func (u *tableUsers) Update(ctx context.Context, userID string, update dynamo.Update, out *User) error {
+	// A nil *User must reach the table as a nil interface, or it would
+	// ask for the updated item and fail to decode it.
+	if out == nil {
+		return u.table.Update(ctx, userKey(userID), update, nil)
+	}
+	return u.table.Update(ctx, userKey(userID), update, out)
+}
+
+func (u *tableUsers) UpdateWith(ctx context.Context, userID string, update dynamo.Update, items ...dynamo.TxItem) error {
+	tx := u.table.UpdateTx(userKey(userID), update)
+	return u.table.TransactWrite(ctx, append([]dynamo.TxItem{tx}, items...)...)
+}
+
+func userKey(userID string) dynamo.Key {
+	return dynamo.StringKey("id", userID)
+}
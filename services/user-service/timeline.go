@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/problem"
+
+	"user-service/api"
+)
+
+// defaultTimelineLimit is the page size when ?limit= is left out; the
+// spec caps it at 200.
+const defaultTimelineLimit = 50
+
+// Timeline purposes. Support sees masked contact details; analytics sees
+// no personal data and a pseudonymous user ID.
+const (
+	PurposeSupport   = "support"
+	PurposeAnalytics = "analytics"
+)
+
+// TimelineEvent is one entry in a user's journey.
+type TimelineEvent struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Source     string            `json:"source"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Summary    string            `json:"summary"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// TimelineResponse is one page of a user's timeline, newest first.
+type TimelineResponse struct {
+	UserID     string          `json:"user_id"`
+	Purpose    string          `json:"purpose"`
+	Events     []TimelineEvent `json:"events"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	// Unavailable lists sources that failed; the page is still returned so
+	// one broken store does not hide the rest of the journey.
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+// timelineSource supplies a user's events from one store. Events must be
+// returned newest first, strictly before the cursor, at most limit of them.
+type timelineSource interface {
+	Name() string
+	Events(ctx context.Context, userID string, before timelineCursor, limit int) ([]TimelineEvent, error)
+}
+
+// piiAttributes are masked for support and dropped for analytics.
+var piiAttributes = map[string]func(string) string{
+	"email":            maskEmail,
+	"phone":            maskTail,
+	"ip_address":       maskIP,
+	"shipping_address": func(string) string { return "[redacted]" },
+}
+
+// restrictedAttributes never leave the service.
+var restrictedAttributes = map[string]bool{
+	"card_number":    true,
+	"payment_token":  true,
+	"password_hash":  true,
+	"session_secret": true,
+}
+
+var timelineSources []timelineSource
+
+// userEventTables are the per-user event stores other services own: tables
+// keyed by id with a user_id-timestamp-index GSI. Each is required, so a
+// timeline never silently leaves one out; list a store here only once
+// Terraform creates its table and gives user-service access to it.
+var userEventTables = []struct{ env, name, eventType string }{
+	{"AD_CLICKS_TABLE_NAME", "ad-clicks", "ad_click"},
+}
+
+// initTimelineSources registers a source for every store configured in the
+// environment: cart-service's table, order-service's order history plus
+// the userEventTables, which must all be configured.
+func initTimelineSources() {
+	if table := os.Getenv("CARTS_TABLE_NAME"); table != "" {
+		timelineSources = append(timelineSources, cartSource{table: dynamo.NewTable(dynamoClient, table)})
+	}
+	if baseURL := strings.TrimRight(os.Getenv("ORDER_SERVICE_URL"), "/"); baseURL != "" {
+		timelineSources = append(timelineSources, orderSource{baseURL: baseURL, client: &http.Client{Timeout: 5 * time.Second}})
+	}
+
+	for _, g := range userEventTables {
+		table := os.Getenv(g.env)
+		if table == "" {
+			log.Fatalf("%s is not set: timelines would leave out the %s store", g.env, g.name)
+		}
+		timelineSources = append(timelineSources, userEventSource{name: g.name, table: dynamo.NewTable(dynamoClient, table), eventType: g.eventType})
+	}
+}
+
+// timelineHandler returns a page of the user's journey across all
+// configured stores: ?limit=, ?cursor= from the previous page and
+// ?purpose=support|analytics, already checked against the spec.
+func timelineHandler(w http.ResponseWriter, r *http.Request, params api.GetUserTimelineParams) {
+	userID := mux.Vars(r)["id"]
+	if !requireSelfOrAdmin(w, r, userID) {
+		return
+	}
+
+	purpose := PurposeSupport
+	if params.Purpose != nil {
+		purpose = string(*params.Purpose)
+	}
+	limit := defaultTimelineLimit
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	cursor := timelineCursor{Time: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if params.Cursor != nil && *params.Cursor != "" {
+		var err error
+		if cursor, err = decodeCursor(*params.Cursor); err != nil {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "cursor is invalid"))
+			return
+		}
+	}
+
+	if _, err := getUserByID(r.Context(), userID); err != nil {
+		if errors.Is(err, dynamo.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "User not found"))
+			return
+		}
+		if writeContextError(w, r, err) {
+			return
+		}
+		log.Printf("Failed to get user: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	resp := TimelineResponse{UserID: userID, Purpose: purpose, Events: []TimelineEvent{}}
+
+	// Each source returns up to limit events before the cursor, so the
+	// newest limit of their union is exactly the next page.
+	var events []TimelineEvent
+	for _, source := range timelineSources {
+		found, err := source.Events(r.Context(), userID, cursor, limit)
+		if err != nil {
+			log.Printf("Timeline source %s failed for user %s: %v", source.Name(), userID, err)
+			resp.Unavailable = append(resp.Unavailable, source.Name())
+			continue
+		}
+		events = append(events, found...)
+	}
+	sort.Slice(events, func(i, j int) bool { return cursorOf(events[j]).before(cursorOf(events[i])) })
+
+	if len(events) > limit {
+		events = events[:limit]
+		resp.NextCursor = encodeCursor(cursorOf(events[limit-1]))
+	}
+	for _, event := range events {
+		resp.Events = append(resp.Events, applyPrivacy(event, purpose))
+	}
+	if purpose == PurposeAnalytics {
+		resp.UserID = pseudonymize(userID)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// applyPrivacy strips what the purpose may not see.
+func applyPrivacy(event TimelineEvent, purpose string) TimelineEvent {
+	attrs := make(map[string]string, len(event.Attributes))
+	for name, value := range event.Attributes {
+		if restrictedAttributes[name] {
+			continue
+		}
+		if mask, ok := piiAttributes[name]; ok {
+			if purpose == PurposeAnalytics {
+				continue
+			}
+			value = mask(value)
+		}
+		attrs[name] = value
+	}
+	event.Attributes = attrs
+	return event
+}
+
+// pseudonymize maps a user ID to a stable token that cannot be reversed
+// without the salt, so analytics can join timelines without identities.
+func pseudonymize(userID string) string {
+	sum := sha256.Sum256([]byte(os.Getenv("TIMELINE_PSEUDONYM_SALT") + userID))
+	return "anon-" + hex.EncodeToString(sum[:8])
+}
+
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return "[redacted]"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+func maskTail(v string) string {
+	if len(v) <= 4 {
+		return "****"
+	}
+	return strings.Repeat("*", len(v)-4) + v[len(v)-4:]
+}
+
+func maskIP(ip string) string {
+	if i := strings.LastIndex(ip, "."); i > 0 {
+		return ip[:i] + ".0"
+	}
+	return "[redacted]"
+}
+
+// timelineCursor orders events by time, then ID, so pages never split or
+// repeat events sharing a timestamp.
+type timelineCursor struct {
+	Time time.Time
+	ID   string
+}
+
+func cursorOf(e TimelineEvent) timelineCursor {
+	return timelineCursor{Time: e.Timestamp, ID: e.ID}
+}
+
+// before reports whether c sorts strictly before (is older than) other.
+func (c timelineCursor) before(other timelineCursor) bool {
+	if !c.Time.Equal(other.Time) {
+		return c.Time.Before(other.Time)
+	}
+	return c.ID < other.ID
+}
+
+func encodeCursor(c timelineCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Time.UTC().Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+func decodeCursor(s string) (timelineCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return timelineCursor{}, err
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return timelineCursor{}, fmt.Errorf("missing separator")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return timelineCursor{}, err
+	}
+	return timelineCursor{Time: t, ID: id}, nil
+}
+
+// keepBefore filters events to those strictly before the cursor, newest
+// first, at most limit.
+func keepBefore(events []TimelineEvent, cursor timelineCursor, limit int) []TimelineEvent {
+	kept := events[:0]
+	for _, e := range events {
+		if cursorOf(e).before(cursor) {
+			kept = append(kept, e)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return cursorOf(kept[j]).before(cursorOf(kept[i])) })
+	if len(kept) > limit {
+		kept = kept[:limit]
+	}
+	return kept
+}
+
+// cartSource turns a user's carts into created, abandoned and last-updated
+// events. Users have few carts, so all are read and filtered in memory.
+type cartSource struct {
+	table *dynamo.Table
+}
+
+// timelineCart is the subset of cart-service's cart item the timeline uses.
+type timelineCart struct {
+	ID          string     `dynamodbav:"id"`
+	Status      string     `dynamodbav:"status"`
+	Subtotal    float64    `dynamodbav:"subtotal"`
+	Currency    string     `dynamodbav:"currency"`
+	Items       []struct{} `dynamodbav:"items"`
+	CreatedAt   time.Time  `dynamodbav:"created_at"`
+	UpdatedAt   time.Time  `dynamodbav:"updated_at"`
+	AbandonedAt *time.Time `dynamodbav:"abandoned_at"`
+}
+
+func (s cartSource) Name() string { return "carts" }
+
+func (s cartSource) Events(ctx context.Context, userID string, before timelineCursor, limit int) ([]TimelineEvent, error) {
+	carts, err := dynamo.QueryAll[timelineCart](ctx, s.table, dynamo.Query{
+		Index:        "user_id-last_activity_index",
+		KeyCondition: "user_id = :user",
+		Values:       map[string]types.AttributeValue{":user": dynamo.S(userID)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query carts: %w", err)
+	}
+
+	var events []TimelineEvent
+	for _, cart := range carts {
+		attrs := map[string]string{
+			"cart_id":  cart.ID,
+			"status":   cart.Status,
+			"subtotal": strconv.FormatFloat(cart.Subtotal, 'f', 2, 64),
+			"currency": cart.Currency,
+			"items":    strconv.Itoa(len(cart.Items)),
+		}
+		events = append(events, TimelineEvent{
+			ID: cart.ID + ":created", Type: "cart_created", Source: s.Name(),
+			Timestamp: cart.CreatedAt, Summary: "Cart created", Attributes: attrs,
+		})
+		if cart.UpdatedAt.After(cart.CreatedAt) {
+			events = append(events, TimelineEvent{
+				ID: cart.ID + ":updated", Type: "cart_updated", Source: s.Name(),
+				Timestamp: cart.UpdatedAt, Summary: fmt.Sprintf("Cart updated (%d items, %.2f %s)", len(cart.Items), cart.Subtotal, cart.Currency),
+				Attributes: attrs,
+			})
+		}
+		if cart.AbandonedAt != nil {
+			events = append(events, TimelineEvent{
+				ID: cart.ID + ":abandoned", Type: "cart_abandoned", Source: s.Name(),
+				Timestamp: *cart.AbandonedAt, Summary: "Cart abandoned", Attributes: attrs,
+			})
+		}
+	}
+	return keepBefore(events, before, limit), nil
+}
+
+// orderSource reads the user's orders from order-service, which keeps them
+// in its own database, through GET /users/{id}/orders; see
+// docs/ORDER_SERVICE.md.
+type orderSource struct {
+	baseURL string
+	client  *http.Client
+}
+
+// timelineOrder is the subset of order-service's order the timeline uses.
+type timelineOrder struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"`
+	Total     float64    `json:"total"`
+	Currency  string     `json:"currency"`
+	Items     []struct{} `json:"items"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// orderHistoryPageSize is the largest page order-service serves.
+const orderHistoryPageSize = 100
+
+func (s orderSource) Name() string { return "orders" }
+
+func (s orderSource) Events(ctx context.Context, userID string, before timelineCursor, limit int) ([]TimelineEvent, error) {
+	// to is exclusive, so it is set just past the cursor: orders sharing
+	// its timestamp are fetched and keepBefore sorts them out by ID. Pages
+	// are read until there is one more order than needed, as that many
+	// may share the timestamp.
+	query := url.Values{
+		"to":    {before.Time.Add(time.Nanosecond).UTC().Format(time.RFC3339Nano)},
+		"limit": {strconv.Itoa(min(limit+1, orderHistoryPageSize))},
+	}
+	var events []TimelineEvent
+	for len(events) <= limit {
+		var page struct {
+			Orders     []timelineOrder `json:"orders"`
+			NextCursor string          `json:"next_cursor"`
+		}
+		if err := s.get(ctx, "/users/"+url.PathEscape(userID)+"/orders?"+query.Encode(), &page); err != nil {
+			return nil, err
+		}
+		for _, order := range page.Orders {
+			events = append(events, TimelineEvent{
+				ID: order.ID, Type: "order", Source: s.Name(), Timestamp: order.CreatedAt,
+				Summary: fmt.Sprintf("Order %s (%d items, %.2f %s)", strings.ToLower(order.Status), len(order.Items), order.Total, order.Currency),
+				Attributes: map[string]string{
+					"order_id": order.ID,
+					"status":   order.Status,
+					"total":    strconv.FormatFloat(order.Total, 'f', 2, 64),
+					"currency": order.Currency,
+					"items":    strconv.Itoa(len(order.Items)),
+				},
+			})
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	return keepBefore(events, before, limit), nil
+}
+
+func (s orderSource) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build order history request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get order history: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("order-service returned %d for the order history", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode order history: %w", err)
+	}
+	return nil
+}
+
+// userEventSource reads a table of per-user events with string attributes
+// id, user_id, timestamp (RFC 3339) and optionally summary; every other
+// string attribute becomes an event attribute.
+type userEventSource struct {
+	name      string
+	table     *dynamo.Table
+	eventType string
+}
+
+func (s userEventSource) Name() string { return s.name }
+
+func (s userEventSource) Events(ctx context.Context, userID string, before timelineCursor, limit int) ([]TimelineEvent, error) {
+	// Over-fetch by one so events sharing the cursor's timestamp do not
+	// starve the page.
+	page, err := dynamo.QueryPage[map[string]interface{}](ctx, s.table, dynamo.Query{
+		Index:        "user_id-timestamp-index",
+		KeyCondition: "user_id = :user AND #ts <= :before",
+		Names:        map[string]string{"#ts": "timestamp"},
+		Values: map[string]types.AttributeValue{
+			":user":   dynamo.S(userID),
+			":before": dynamo.S(before.Time.UTC().Format(time.RFC3339Nano)),
+		},
+		Descending: true,
+		Limit:      int32(limit + 1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", s.table.Name, err)
+	}
+
+	var events []TimelineEvent
+	for _, record := range page.Items {
+		event := TimelineEvent{Type: s.eventType, Source: s.name, Summary: s.eventType, Attributes: map[string]string{}}
+		for name, value := range record {
+			str, ok := value.(string)
+			if !ok {
+				continue
+			}
+			switch name {
+			case "id":
+				event.ID = str
+			case "timestamp":
+				event.Timestamp, _ = time.Parse(time.RFC3339Nano, str)
+			case "summary":
+				event.Summary = str
+			case "user_id":
+			default:
+				event.Attributes[name] = str
+			}
+		}
+		events = append(events, event)
+	}
+	return keepBefore(events, before, limit), nil
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/ids"
+	"pkg/problem"
+	"pkg/retry"
+)
+
+// Deliveries. Each event sent to a webhook is a delivery, recorded before
+// it is queued so the delivery log shows it even if sending never starts.
+// Workers POST the payload, signed with the webhook's secret:
+//
+//	X-Webhook-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+//
+// Receivers recompute the HMAC over the timestamp and raw body and should
+// reject timestamps more than a few minutes old, which stops replays.
+//
+// A 2xx answer completes the delivery. Anything else is retried with
+// exponential backoff by hiding the queue message until the next attempt
+// is due; after maxAttempts the delivery fails and its job moves to the
+// dead-letter queue, from where it can be inspected or redriven.
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "PENDING"
+	DeliveryRetrying  = "RETRYING"
+	DeliverySucceeded = "SUCCEEDED"
+	DeliveryFailed    = "FAILED"
+)
+
+const (
+	// deliveryTimeout bounds one POST to a receiver, connection included.
+	deliveryTimeout = 10 * time.Second
+	// deliveryRetention is how long the delivery log is kept; the table
+	// expires older deliveries through its TTL.
+	deliveryRetention = 30 * 24 * time.Hour
+	// maxLoggedAttempts bounds the attempt log of one delivery; the count
+	// keeps growing across redeliveries but only the latest are kept.
+	maxLoggedAttempts = 20
+	// maxResponseExcerpt is how much of a receiver's answer is logged.
+	maxResponseExcerpt = 512
+	// maxVisibilityDelay stays under SQS's 12-hour visibility limit.
+	maxVisibilityDelay = 11 * time.Hour
+
+	defaultDeliveryPageSize = 25
+	maxDeliveryPageSize     = 100
+)
+
+// retryBackoff spaces retries 30s, 1m, 2m, ... up to 4 hours apart, with
+// jitter so a receiver coming back is not hit by every retry at once.
+var retryBackoff = retry.Policy{
+	BaseDelay: 30 * time.Second,
+	MaxDelay:  4 * time.Hour,
+	Jitter:    0.2,
+}
+
+// Delivery is one event sent, or being sent, to one webhook.
+type Delivery struct {
+	WebhookID     string     `json:"webhook_id" dynamodbav:"webhook_id"`
+	ID            string     `json:"id" dynamodbav:"id"`
+	EventID       string     `json:"event_id" dynamodbav:"event_id"`
+	EventType     string     `json:"event_type" dynamodbav:"event_type"`
+	Status        string     `json:"status" dynamodbav:"status"`
+	Attempts      int        `json:"attempts" dynamodbav:"attempts"`
+	AttemptLog    []Attempt  `json:"attempt_log,omitempty" dynamodbav:"attempt_log,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty" dynamodbav:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at" dynamodbav:"created_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
+	// RedeliveryOf is the delivery this one repeats.
+	RedeliveryOf string `json:"redelivery_of,omitempty" dynamodbav:"redelivery_of,omitempty"`
+
+	// Payload is the exact body sent, so every attempt signs the same
+	// bytes. The single-delivery view returns it as JSON.
+	Payload   string          `json:"-" dynamodbav:"payload"`
+	Body      json.RawMessage `json:"payload,omitempty" dynamodbav:"-"`
+	ExpiresAt int64           `json:"-" dynamodbav:"expires_at"`
+}
+
+// Attempt is one POST of a delivery and how the receiver answered.
+type Attempt struct {
+	At         time.Time `json:"at" dynamodbav:"at"`
+	StatusCode int       `json:"status_code,omitempty" dynamodbav:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	Response   string    `json:"response,omitempty" dynamodbav:"response,omitempty"`
+	DurationMS int64     `json:"duration_ms" dynamodbav:"duration_ms"`
+}
+
+func (a Attempt) succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// deliveryJob is the deliveries queue message; the delivery itself is
+// read from the table on every attempt.
+type deliveryJob struct {
+	WebhookID  string `json:"webhook_id"`
+	DeliveryID string `json:"delivery_id"`
+}
+
+// errPrivateTarget refuses connections to addresses inside the network.
+var errPrivateTarget = errors.New("endpoint resolves to a private address")
+
+// receiverClient posts deliveries. It dials only public addresses, checked
+// after resolution so DNS cannot point a registered name inward, ignores
+// proxy settings that would bypass that check, and does not follow
+// redirects, which count as failures.
+var receiverClient = &http.Client{
+	Timeout: deliveryTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				if allowPrivateTargets {
+					return nil
+				}
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return errPrivateTarget
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: deliveryTimeout,
+		MaxIdleConnsPerHost:   4,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// cgnat is the carrier-grade NAT range, private in practice though not
+// by net.IP.IsPrivate.
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || cgnat.Contains(ip))
+}
+
+// runDeliveryWorker long-polls the deliveries queue until ctx is done.
+// Several run at once, each sending its deliveries one after another.
+func runDeliveryWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		recoverer.Do("webhook delivery poll", func() {
+			if err := pollDeliveries(ctx); err != nil {
+				log.Printf("Failed to receive webhook deliveries: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(receiveBackoff):
+				}
+			}
+		})
+	}
+}
+
+func pollDeliveries(ctx context.Context) error {
+	result, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(deliveriesQueueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range result.Messages {
+		var job deliveryJob
+		if err := json.Unmarshal([]byte(aws.ToString(message.Body)), &job); err != nil || job.DeliveryID == "" {
+			log.Printf("Dropping malformed delivery job %s", aws.ToString(message.MessageId))
+			deleteDeliveryMessage(ctx, message.ReceiptHandle)
+			continue
+		}
+
+		retryIn, err := attemptDelivery(ctx, job)
+		switch {
+		case err != nil:
+			// The queue redelivers it once the visibility timeout passes.
+			log.Printf("Failed to process delivery %s: %v", job.DeliveryID, err)
+		case retryIn > 0:
+			if retryIn > maxVisibilityDelay {
+				retryIn = maxVisibilityDelay
+			}
+			_, err := sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(deliveriesQueueURL),
+				ReceiptHandle:     message.ReceiptHandle,
+				VisibilityTimeout: int32(retryIn / time.Second),
+			})
+			if err != nil {
+				log.Printf("Failed to delay retry of delivery %s: %v", job.DeliveryID, err)
+			}
+		default:
+			deleteDeliveryMessage(ctx, message.ReceiptHandle)
+		}
+	}
+	return nil
+}
+
+func deleteDeliveryMessage(ctx context.Context, receiptHandle *string) {
+	_, err := sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(deliveriesQueueURL),
+		ReceiptHandle: receiptHandle,
+	})
+	if err != nil {
+		log.Printf("Failed to delete delivery job: %v", err)
+	}
+}
+
+// queueDelivery hands a recorded delivery to the workers. Without a
+// deliveries queue, as in test mode, it is attempted once inline and
+// retries wait for /__test/deliveries/retry.
+func queueDelivery(ctx context.Context, delivery Delivery) error {
+	job := deliveryJob{WebhookID: delivery.WebhookID, DeliveryID: delivery.ID}
+	if deliveriesQueueURL == "" {
+		_, err := attemptDelivery(ctx, job)
+		return err
+	}
+
+	body, _ := json.Marshal(job)
+	_, err := sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(deliveriesQueueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue delivery %s: %w", delivery.ID, err)
+	}
+	return nil
+}
+
+// attemptDelivery makes the next attempt of a delivery and records it.
+// It returns how long to wait before the following attempt, or zero once
+// the delivery is finished. Errors mean the attempt could not be recorded
+// and the job should be tried again as is.
+func attemptDelivery(ctx context.Context, job deliveryJob) (time.Duration, error) {
+	delivery, err := dynamo.Get[Delivery](ctx, deliveries, deliveryKey(job.WebhookID, job.DeliveryID))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if delivery.Status == DeliverySucceeded || delivery.Status == DeliveryFailed {
+		return 0, nil
+	}
+	if next := delivery.NextAttemptAt; next != nil && next.After(clk.Now()) {
+		// Received early, e.g. after the delay could not be set.
+		return next.Sub(clk.Now()), nil
+	}
+
+	webhook, err := dynamo.Get[Webhook](ctx, webhooks, webhookKey(job.WebhookID))
+	switch {
+	case errors.Is(err, dynamo.ErrNotFound):
+		return 0, abandonDelivery(ctx, delivery, "webhook was deleted")
+	case err != nil:
+		return 0, err
+	case !webhook.Active:
+		return 0, abandonDelivery(ctx, delivery, "webhook is disabled")
+	}
+
+	attempt := send(ctx, webhook, delivery)
+	previous := delivery.Attempts
+	delivery.Attempts++
+	delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	if len(delivery.AttemptLog) > maxLoggedAttempts {
+		delivery.AttemptLog = delivery.AttemptLog[len(delivery.AttemptLog)-maxLoggedAttempts:]
+	}
+	delivery.NextAttemptAt = nil
+
+	var retryIn time.Duration
+	switch {
+	case attempt.succeeded():
+		delivery.Status = DeliverySucceeded
+		delivery.CompletedAt = &attempt.At
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.CompletedAt = &attempt.At
+	default:
+		retryIn = retryBackoff.Backoff(delivery.Attempts)
+		next := attempt.At.Add(retryIn)
+		delivery.Status = DeliveryRetrying
+		delivery.NextAttemptAt = &next
+	}
+
+	// Two workers can hold the same job if a send outlives the message's
+	// visibility; the attempt count makes only the first record stick.
+	err = deliveries.Put(ctx, delivery, dynamo.IfEquals("attempts", dynamo.N(strconv.Itoa(previous))))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		log.Printf("Delivery %s was attempted concurrently; dropping this attempt's record", delivery.ID)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to record attempt of delivery %s: %w", delivery.ID, err)
+	}
+
+	switch delivery.Status {
+	case DeliverySucceeded:
+		log.Printf("Delivered %s to webhook %s on attempt %d", delivery.ID, webhook.ID, delivery.Attempts)
+	case DeliveryFailed:
+		log.Printf("Delivery %s to webhook %s failed after %d attempts", delivery.ID, webhook.ID, delivery.Attempts)
+		deadLetter(ctx, job)
+	default:
+		log.Printf("Delivery %s to webhook %s failed (%s), retrying in %s",
+			delivery.ID, webhook.ID, attempt.outcome(), retryIn.Round(time.Second))
+	}
+	return retryIn, nil
+}
+
+// send POSTs the delivery's payload once.
+func send(ctx context.Context, webhook Webhook, delivery Delivery) Attempt {
+	start := clk.Now()
+	attempt := Attempt{At: start.UTC()}
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ecommerce-webhooks/"+version)
+	req.Header.Set("X-Webhook-Id", webhook.ID)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "t="+timestamp+",v1="+sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := receiverClient.Do(req)
+	attempt.DurationMS = clock.Since(clk, start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseExcerpt))
+	attempt.Response = string(excerpt)
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return attempt
+}
+
+func (a Attempt) outcome() string {
+	if a.Error != "" {
+		return a.Error
+	}
+	return "HTTP " + strconv.Itoa(a.StatusCode)
+}
+
+// sign is the hex HMAC-SHA256 of "<timestamp>.<body>" under secret.
+func sign(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// abandonDelivery fails a delivery whose webhook can no longer receive it,
+// without an attempt.
+func abandonDelivery(ctx context.Context, delivery Delivery, reason string) error {
+	now := clk.Now().UTC()
+	delivery.Status = DeliveryFailed
+	delivery.CompletedAt = &now
+	delivery.NextAttemptAt = nil
+	delivery.AttemptLog = append(delivery.AttemptLog, Attempt{At: now, Error: reason})
+	err := deliveries.Put(ctx, delivery, dynamo.IfEquals("attempts", dynamo.N(strconv.Itoa(delivery.Attempts))))
+	if err != nil && !errors.Is(err, dynamo.ErrConditionFailed) {
+		return fmt.Errorf("failed to abandon delivery %s: %w", delivery.ID, err)
+	}
+	log.Printf("Abandoned delivery %s: %s", delivery.ID, reason)
+	return nil
+}
+
+// deadLetter moves the job of a failed delivery to the dead-letter queue.
+// The delivery is already marked failed, so losing the message only loses
+// the alarm on the queue's depth.
+func deadLetter(ctx context.Context, job deliveryJob) {
+	if deadLetterQueueURL == "" {
+		return
+	}
+	body, _ := json.Marshal(job)
+	_, err := sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(deadLetterQueueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	if err != nil {
+		log.Printf("Failed to dead-letter delivery %s: %v", job.DeliveryID, err)
+	}
+}
+
+// Delivery log endpoints
+
+// listDeliveriesHandler pages through a webhook's deliveries, newest
+// first, optionally only those with ?status=.
+func listDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	limit := defaultDeliveryPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDeliveryPageSize {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxDeliveryPageSize)))
+			return
+		}
+		limit = n
+	}
+
+	q := dynamo.Query{
+		KeyCondition: "webhook_id = :webhook",
+		Values:       map[string]types.AttributeValue{":webhook": dynamo.S(webhook.ID)},
+		Projection:   "webhook_id, id, event_id, event_type, #status, attempts, next_attempt_at, created_at, completed_at, redelivery_of",
+		Names:        map[string]string{"#status": "status"},
+		Limit:        int32(limit),
+		Descending:   true,
+	}
+	if status := query.Get("status"); status != "" {
+		switch status {
+		case DeliveryPending, DeliveryRetrying, DeliverySucceeded, DeliveryFailed:
+		default:
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "status must be one of PENDING, RETRYING, SUCCEEDED, FAILED"))
+			return
+		}
+		q.Filter = "#status = :status"
+		q.Values[":status"] = dynamo.S(status)
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		if !ids.Valid(cursor) {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, "cursor is invalid"))
+			return
+		}
+		q.Start = deliveryKey(webhook.ID, cursor)
+	}
+
+	page, err := dynamo.QueryPage[Delivery](r.Context(), deliveries, q)
+	if err != nil {
+		log.Printf("Failed to list deliveries of webhook %s: %v", webhook.ID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	list := page.Items
+	if list == nil {
+		list = []Delivery{}
+	}
+	response := map[string]interface{}{"deliveries": list}
+	if id, ok := page.Next["id"].(*types.AttributeValueMemberS); ok {
+		response["next_cursor"] = id.Value
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getDeliveryHandler returns one delivery with its payload and attempts.
+func getDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := ownedDelivery(w, r)
+	if !ok {
+		return
+	}
+	delivery.Body = json.RawMessage(delivery.Payload)
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// redeliverHandler sends a delivery's event again as a new delivery, so
+// the original keeps its history. The payload is resent as recorded.
+func redeliverHandler(w http.ResponseWriter, r *http.Request) {
+	original, ok := ownedDelivery(w, r)
+	if !ok {
+		return
+	}
+	webhook, err := dynamo.Get[Webhook](r.Context(), webhooks, webhookKey(original.WebhookID))
+	if err != nil {
+		writeWebhookError(w, r, "get", err)
+		return
+	}
+	if !webhook.Active {
+		problem.Write(w, r, problem.New(http.StatusConflict, "Webhook is disabled; enable it before redelivering"))
+		return
+	}
+
+	event := Event{ID: original.EventID, Type: original.EventType}
+	delivery, err := createDelivery(r.Context(), webhook, event, original.Payload, original.ID)
+	if err == nil {
+		err = queueDelivery(r.Context(), delivery)
+	}
+	if err != nil {
+		log.Printf("Failed to redeliver %s: %v", original.ID, err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	log.Printf("Redelivering %s to webhook %s as %s", original.ID, webhook.ID, delivery.ID)
+	w.Header().Set("Location", fmt.Sprintf("/webhooks/%s/deliveries/%s", webhook.ID, delivery.ID))
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+// ownedDelivery loads the delivery in the path, answering 404 when it or
+// its webhook does not belong to the caller.
+func ownedDelivery(w http.ResponseWriter, r *http.Request) (Delivery, bool) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return Delivery{}, false
+	}
+	delivery, err := dynamo.Get[Delivery](r.Context(), deliveries, deliveryKey(webhook.ID, mux.Vars(r)["deliveryId"]))
+	if errors.Is(err, dynamo.ErrNotFound) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Delivery not found"))
+		return Delivery{}, false
+	}
+	if err != nil {
+		log.Printf("Failed to get delivery: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return Delivery{}, false
+	}
+	return delivery, true
+}
+
+// testRetryHandler makes the next attempt of every retrying delivery that
+// is due by the test clock; registered only in test mode, where there is
+// no queue to redeliver them.
+func testRetryHandler(w http.ResponseWriter, r *http.Request) {
+	now := clk.Now()
+	var due []Delivery
+	err := dynamo.ScanEach(r.Context(), deliveries, dynamo.Scan{
+		Filter: "#status = :retrying",
+		Names:  map[string]string{"#status": "status"},
+		Values: map[string]types.AttributeValue{":retrying": dynamo.S(DeliveryRetrying)},
+	}, func(page []Delivery) error {
+		for _, delivery := range page {
+			if delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now) {
+				due = append(due, delivery)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to find due deliveries: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	for _, delivery := range due {
+		if _, err := attemptDelivery(r.Context(), deliveryJob{WebhookID: delivery.WebhookID, DeliveryID: delivery.ID}); err != nil {
+			log.Printf("Failed to retry delivery %s: %v", delivery.ID, err)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"attempted": len(due)})
+}
+
+// DynamoDB operations
+
+func deliveryKey(webhookID, deliveryID string) dynamo.Key {
+	return dynamo.CompositeKey("webhook_id", webhookID, "id", deliveryID)
+}
+
+// createDelivery records a pending delivery of event to webhook, as a
+// repeat of delivery redeliveryOf if that is set. Its ID is time-ordered,
+// which is what lists deliveries newest first.
+func createDelivery(ctx context.Context, webhook Webhook, event Event, payload, redeliveryOf string) (Delivery, error) {
+	now := clk.Now().UTC()
+	delivery := Delivery{
+		WebhookID:    webhook.ID,
+		ID:           idGen.NewID(),
+		EventID:      event.ID,
+		EventType:    event.Type,
+		Status:       DeliveryPending,
+		CreatedAt:    now,
+		RedeliveryOf: redeliveryOf,
+		Payload:      payload,
+		ExpiresAt:    now.Add(deliveryRetention).Unix(),
+	}
+	if err := deliveries.Put(ctx, delivery, dynamo.IfNotExists("id")); err != nil {
+		return Delivery{}, fmt.Errorf("failed to record delivery of %s to webhook %s: %w", event.ID, webhook.ID, err)
+	}
+	return delivery, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"pkg/dynamo"
+	"pkg/envelope"
+	"pkg/events"
+	"pkg/notify"
+	"pkg/problem"
+)
+
+// Event intake. One queue receives order and user events from EventBridge
+// and campaign alerts from the alerts SNS topic; each event is turned into
+// a delivery for every active webhook subscribed to its type.
+//
+// Delivery is at least once: if fan-out fails part way the event is
+// received again and some webhooks get it twice. Payloads carry the
+// event's own ID so receivers can drop repeats.
+
+const (
+	// subscriptionsTTL is how long the active webhooks are cached between
+	// reloads; a new or changed webhook takes effect within it.
+	subscriptionsTTL = 30 * time.Second
+	// receiveBackoff is the pause after a failed receive.
+	receiveBackoff = 5 * time.Second
+)
+
+// busEvent is an EventBridge event as delivered to the queue.
+type busEvent struct {
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Time       time.Time       `json:"time"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// Event is what webhooks receive: the event type in dotted form, the ID
+// and time of the source event and its payload unchanged.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// eventSources are the EventBridge sources whose events can be subscribed
+// to, with the entity their event types are named after.
+var eventSources = map[string]string{
+	"ecommerce.order-service": "order",
+	"ecommerce.user-service":  "user",
+}
+
+// alertTypes names the campaign alert envelopes that can be subscribed to.
+var alertTypes = map[string]string{
+	notify.KindCampaignAlert: "campaign.alert",
+	notify.KindAlertGroup:    "campaign.alert_group",
+}
+
+// alertCodec opens campaign alert envelopes. Alerts are not encrypted, so
+// it needs no KMS client.
+var alertCodec *envelope.Codec
+
+// runEventConsumer long-polls the events queue until ctx is done. Messages
+// are deleted once fanned out; failures are left for the queue to
+// redeliver.
+func runEventConsumer(ctx context.Context) {
+	log.Printf("Consuming webhook events from %s", eventsQueueURL)
+	for ctx.Err() == nil {
+		recoverer.Do("webhook event poll", func() {
+			if err := pollEvents(ctx); err != nil {
+				log.Printf("Failed to receive webhook events: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(receiveBackoff):
+				}
+			}
+		})
+	}
+}
+
+func pollEvents(ctx context.Context) error {
+	result, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(eventsQueueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range result.Messages {
+		if err := handleEventMessage(ctx, aws.ToString(message.Body)); err != nil {
+			log.Printf("Failed to fan out event %s, leaving it for redelivery: %v", aws.ToString(message.MessageId), err)
+			continue
+		}
+		_, err := sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(eventsQueueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		})
+		if err != nil {
+			log.Printf("Failed to delete event %s: %v", aws.ToString(message.MessageId), err)
+		}
+	}
+	return nil
+}
+
+// handleEventMessage fans out one queued message. Only errors worth
+// retrying are returned; malformed or unsubscribable messages are logged
+// and dropped.
+func handleEventMessage(ctx context.Context, body string) error {
+	event, err := parseEvent(ctx, body)
+	if err != nil {
+		if errors.Is(err, envelope.ErrKeyUnavailable) {
+			return err
+		}
+		log.Printf("Dropping event: %v", err)
+		return nil
+	}
+	if event.Type == "" {
+		return nil
+	}
+	return fanOut(ctx, event)
+}
+
+// parseEvent reads an EventBridge event or a campaign alert envelope. A
+// message of a kind webhooks cannot subscribe to yields an Event with no
+// type.
+func parseEvent(ctx context.Context, body string) (Event, error) {
+	env, err := alertCodec.Open(ctx, body)
+	if err == nil {
+		eventType, ok := alertTypes[env.Type]
+		if !ok {
+			return Event{}, nil
+		}
+		return Event{ID: env.ID, Type: eventType, CreatedAt: env.PublishedAt, Data: env.Body}, nil
+	}
+	if !errors.Is(err, envelope.ErrNotEnvelope) {
+		return Event{}, err
+	}
+
+	var bus busEvent
+	if err := json.Unmarshal([]byte(body), &bus); err != nil || bus.ID == "" {
+		return Event{}, errors.New("message is neither an envelope nor an EventBridge event")
+	}
+	entity, ok := eventSources[bus.Source]
+	if !ok || bus.DetailType == "" {
+		log.Printf("Ignoring event %s from %q", bus.ID, bus.Source)
+		return Event{}, nil
+	}
+	// Subscribers get the detail as it is, so one that fails its schema is
+	// not passed on.
+	if _, err := events.Check(bus.DetailType, bus.Detail); err != nil {
+		return Event{}, fmt.Errorf("event %s: %w", bus.ID, err)
+	}
+	return Event{ID: bus.ID, Type: eventTypeOf(entity, bus.DetailType), CreatedAt: bus.Time, Data: bus.Detail}, nil
+}
+
+// eventTypeOf names a detail type for webhooks: "Order Completed" from
+// order-service is "order.completed" and "User Registered" from
+// user-service is "user.registered". A detail type not starting with the
+// entity keeps all of its words.
+func eventTypeOf(entity, detailType string) string {
+	words := strings.Fields(strings.ToLower(detailType))
+	if len(words) > 1 && words[0] == entity {
+		words = words[1:]
+	}
+	return entity + "." + strings.Join(words, "_")
+}
+
+// fanOut records a delivery of event for every subscribed webhook and
+// hands each to the workers.
+func fanOut(ctx context.Context, event Event) error {
+	subscribed, err := subscriptions.matching(ctx, event.Type)
+	if err != nil {
+		return err
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %s: %w", event.ID, err)
+	}
+	for _, webhook := range subscribed {
+		delivery, err := createDelivery(ctx, webhook, event, string(payload), "")
+		if err != nil {
+			return err
+		}
+		if err := queueDelivery(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	log.Printf("Event %s (%s) queued for %d webhooks", event.ID, event.Type, len(subscribed))
+	return nil
+}
+
+// subscriptionCache holds the active webhooks, reloaded when stale. Every
+// event would otherwise scan the webhooks table.
+type subscriptionCache struct {
+	mu       sync.Mutex
+	active   []Webhook
+	loadedAt time.Time
+}
+
+var subscriptions = &subscriptionCache{}
+
+func (c *subscriptionCache) matching(ctx context.Context, eventType string) ([]Webhook, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := clk.Now()
+	if c.loadedAt.IsZero() || now.Sub(c.loadedAt) >= subscriptionsTTL {
+		active, err := activeWebhooks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.active, c.loadedAt = active, now
+	}
+
+	var matched []Webhook
+	for _, webhook := range c.active {
+		if webhook.subscribes(eventType) {
+			matched = append(matched, webhook)
+		}
+	}
+	return matched, nil
+}
+
+// invalidate makes the next event reload the webhooks; used in test mode,
+// where webhooks must take effect at once.
+func (c *subscriptionCache) invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+}
+
+func activeWebhooks(ctx context.Context) ([]Webhook, error) {
+	var active []Webhook
+	err := dynamo.ScanEach(ctx, webhooks, dynamo.Scan{
+		Filter: "#active = :true",
+		Names:  map[string]string{"#active": "active"},
+		Values: map[string]types.AttributeValue{":true": &types.AttributeValueMemberBOOL{Value: true}},
+	}, func(page []Webhook) error {
+		active = append(active, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load active webhooks: %w", err)
+	}
+	return active, nil
+}
+
+// testEventHandler fans out a posted EventBridge event or envelope;
+// registered only in test mode, where there is no queue. Deliveries are
+// attempted before it answers.
+func testEventHandler(w http.ResponseWriter, r *http.Request) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be an EventBridge event or an envelope"))
+		return
+	}
+	subscriptions.invalidate()
+	if err := handleEventMessage(r.Context(), string(raw)); err != nil {
+		log.Printf("Failed to fan out test event: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gorilla/mux"
+
+	"pkg/clock"
+	"pkg/dynamo"
+	"pkg/envelope"
+	"pkg/health"
+	"pkg/idempotency"
+	"pkg/ids"
+	_ "pkg/localdev"
+	"pkg/metrics"
+	"pkg/recovery"
+)
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	Version   string    `json:"version"`
+}
+
+var (
+	dynamoClient       *dynamodb.Client
+	sqsClient          *sqs.Client
+	webhooks           *dynamo.Table
+	deliveries         *dynamo.Table
+	eventsQueueURL     string
+	deliveriesQueueURL string
+	deadLetterQueueURL string
+	serverPort         string
+	version            = "1.0.0"
+
+	// maxAttempts is how many times a delivery is tried before it is
+	// marked failed and dead-lettered.
+	maxAttempts int
+	// deliveryWorkers is how many deliveries are sent concurrently.
+	deliveryWorkers int
+	// allowPrivateTargets lets endpoints resolve to loopback and private
+	// addresses, for receivers running next to the service in tests.
+	allowPrivateTargets bool
+
+	clk   clock.Clock   = clock.Real{}
+	idGen ids.Generator = ids.UUIDv7{Clock: clock.Real{}}
+
+	recoverer *recovery.Recoverer
+)
+
+func main() {
+	// Initialize AWS configuration
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load AWS configuration: %v", err)
+	}
+
+	dynamoClient = dynamodb.NewFromConfig(cfg)
+	sqsClient = sqs.NewFromConfig(cfg)
+	eventsQueueURL = os.Getenv("WEBHOOK_EVENTS_QUEUE_URL")
+	deliveriesQueueURL = os.Getenv("WEBHOOK_DELIVERIES_QUEUE_URL")
+	deadLetterQueueURL = os.Getenv("WEBHOOK_DLQ_URL")
+	serverPort = getEnv("PORT", "3008")
+	maxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+	deliveryWorkers = getEnvInt("WEBHOOK_DELIVERY_WORKERS", 4)
+
+	clk = clock.FromEnv()
+	idGen = ids.FromEnv(clk)
+	recoverer = recovery.New("webhook-service", clk, idGen)
+	alertCodec = envelope.New("webhook-service", nil, "", clk)
+	allowPrivateTargets = clock.TestMode() || os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS") == "true"
+
+	webhooks = dynamo.NewTable(dynamoClient, getEnv("WEBHOOKS_TABLE_NAME", "webhooks"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second))
+	deliveries = dynamo.NewTable(dynamoClient, getEnv("WEBHOOK_DELIVERIES_TABLE_NAME", "webhook-deliveries"),
+		dynamo.WithConsistentReads(true), dynamo.WithTimeout(5*time.Second))
+
+	// Create router
+	router := mux.NewRouter()
+	router.Use(recoverer.Middleware)
+
+	// Request count, error rate and latency per route, scraped from
+	// /metrics
+	registry := metrics.NewRegistry()
+	router.Use(metrics.NewHTTP(registry, "webhook-service", routeTemplate, clk).Middleware)
+	router.Use(ids.ValidatePathParams(mux.Vars, "id", "deliveryId"))
+
+	// Idempotency-Key support for POST retries
+	if table := os.Getenv("IDEMPOTENCY_TABLE_NAME"); table != "" {
+		router.Use(idempotency.NewStore(dynamoClient, table, clk).Middleware)
+	}
+
+	// Health check endpoint
+	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
+	router.HandleFunc("/health/ready", health.NewChecker("webhook-service", clk,
+		health.Table(dynamoClient, webhooks.Name, true),
+		health.Table(dynamoClient, deliveries.Name, true),
+	).Handler()).Methods("GET")
+	router.Handle("/metrics", registry.Handler()).Methods("GET")
+
+	// Test hooks; events are posted directly instead of polled, and
+	// deliveries are attempted inline with retries run on demand
+	if manual, ok := clk.(*clock.Manual); ok {
+		log.Printf("TEST_MODE enabled: deterministic clock and IDs, events via /__test/events")
+		router.HandleFunc("/__test/clock", clock.Handler(manual)).Methods("GET", "POST")
+		router.HandleFunc("/__test/events", testEventHandler).Methods("POST")
+		router.HandleFunc("/__test/deliveries/retry", testRetryHandler).Methods("POST")
+		deliveriesQueueURL = ""
+	} else {
+		if eventsQueueURL != "" {
+			go runEventConsumer(context.Background())
+		} else {
+			log.Printf("WEBHOOK_EVENTS_QUEUE_URL not set, no events will be delivered")
+		}
+		if deliveriesQueueURL != "" {
+			for i := 0; i < deliveryWorkers; i++ {
+				go runDeliveryWorker(context.Background())
+			}
+		} else {
+			log.Printf("WEBHOOK_DELIVERIES_QUEUE_URL not set, deliveries are attempted once without retries")
+		}
+	}
+
+	// Webhook endpoints
+	router.HandleFunc("/webhooks", createWebhookHandler).Methods("POST")
+	router.HandleFunc("/webhooks", listWebhooksHandler).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", getWebhookHandler).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", updateWebhookHandler).Methods("PUT")
+	router.HandleFunc("/webhooks/{id}", deleteWebhookHandler).Methods("DELETE")
+	router.HandleFunc("/webhooks/{id}/rotate-secret", rotateSecretHandler).Methods("POST")
+
+	// Delivery log
+	router.HandleFunc("/webhooks/{id}/deliveries", listDeliveriesHandler).Methods("GET")
+	router.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}", getDeliveryHandler).Methods("GET")
+	router.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}/redeliver", redeliverHandler).Methods("POST")
+
+	// Start server
+	srv := &http.Server{
+		Handler:      router,
+		Addr:         ":" + serverPort,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	log.Printf("Webhook service starting on port %s", serverPort)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:    "healthy",
+		Timestamp: clk.Now(),
+		Service:   "webhook-service",
+		Version:   version,
+	})
+}
+
+// Utility functions
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// routeTemplate labels metrics with the matched route rather than the raw
+// path, which would give every webhook its own series.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+
+	"pkg/dynamo"
+	"pkg/problem"
+	"pkg/validate"
+)
+
+// Webhooks are registered by API clients, which receive the events they
+// subscribe to as signed POSTs to their endpoint. A webhook belongs to the
+// client that registered it (the gateway's X-Client-Id) and is invisible
+// to every other client. Registering one needs the webhooks scope, since
+// order and user events are not scoped to the caller.
+
+// webhooksScope is the token scope that allows managing webhooks.
+const webhooksScope = "webhooks"
+
+// maxWebhooksPerClient bounds the endpoints one client can register.
+const maxWebhooksPerClient = 25
+
+// Webhook is one registered endpoint. The secret signs every delivery;
+// it is only ever returned by create and rotate-secret.
+type Webhook struct {
+	ID          string    `json:"id" dynamodbav:"id"`
+	OwnerID     string    `json:"-" dynamodbav:"owner_id"`
+	URL         string    `json:"url" dynamodbav:"url"`
+	EventTypes  []string  `json:"event_types" dynamodbav:"event_types"`
+	Description string    `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Active      bool      `json:"active" dynamodbav:"active"`
+	Secret      string    `json:"-" dynamodbav:"secret"`
+	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// WebhookWithSecret is the answer to create and rotate-secret, the only
+// times the secret leaves the service.
+type WebhookWithSecret struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" validate:"required,max=2048"`
+	EventTypes  []string `json:"event_types" validate:"required,min=1,max=50"`
+	Description string   `json:"description" validate:"max=500"`
+}
+
+type UpdateWebhookRequest struct {
+	URL         *string  `json:"url,omitempty" validate:"max=2048"`
+	EventTypes  []string `json:"event_types,omitempty" validate:"max=50"`
+	Description *string  `json:"description,omitempty" validate:"max=500"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+// eventTypePattern matches a subscription: an event type such as
+// "order.completed", every event of an entity ("order.*"), or "*".
+var eventTypePattern = regexp.MustCompile(`^(\*|(order|user|campaign)\.(\*|[a-z][a-z_]*))$`)
+
+// errWebhookLimit is returned when a client already has
+// maxWebhooksPerClient webhooks.
+var errWebhookLimit = errors.New("webhook limit reached")
+
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := callerOwner(w, r)
+	if !ok {
+		return
+	}
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+	if errs := validateSubscription(req.URL, req.EventTypes); len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		log.Printf("Failed to generate webhook secret: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	now := clk.Now().UTC()
+	webhook := Webhook{
+		ID:          idGen.NewID(),
+		OwnerID:     owner,
+		URL:         req.URL,
+		EventTypes:  normalizeEventTypes(req.EventTypes),
+		Description: req.Description,
+		Active:      true,
+		Secret:      secret,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := saveNewWebhook(r.Context(), webhook); err != nil {
+		if errors.Is(err, errWebhookLimit) {
+			problem.Write(w, r, problem.New(http.StatusConflict,
+				fmt.Sprintf("A client can register at most %d webhooks", maxWebhooksPerClient)))
+			return
+		}
+		log.Printf("Failed to create webhook: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+
+	log.Printf("Client %s registered webhook %s for %v", owner, webhook.ID, webhook.EventTypes)
+	w.Header().Set("Location", "/webhooks/"+webhook.ID)
+	writeJSON(w, http.StatusCreated, WebhookWithSecret{Webhook: webhook, Secret: secret})
+}
+
+func listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := callerOwner(w, r)
+	if !ok {
+		return
+	}
+	list, err := ownedWebhooks(r.Context(), owner)
+	if err != nil {
+		log.Printf("Failed to list webhooks: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": list})
+}
+
+func getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// updateWebhookHandler changes the fields present in the body. Turning a
+// webhook back on does not replay the events it missed.
+func updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	var req UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.Malformed("Request body must be a JSON object"))
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Write(w, r, problem.Validation(err))
+		return
+	}
+
+	if req.URL != nil {
+		webhook.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		webhook.EventTypes = req.EventTypes
+	}
+	if req.Description != nil {
+		webhook.Description = *req.Description
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	if errs := validateSubscription(webhook.URL, webhook.EventTypes); len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+	webhook.EventTypes = normalizeEventTypes(webhook.EventTypes)
+	previous := webhook.UpdatedAt
+	webhook.UpdatedAt = clk.Now().UTC()
+
+	// The whole item is written back, so a concurrent change, a secret
+	// rotation in particular, must not be overwritten.
+	err := webhooks.Put(r.Context(), webhook,
+		dynamo.IfEquals("updated_at", dynamo.S(previous.Format(time.RFC3339Nano))))
+	if errors.Is(err, dynamo.ErrConditionFailed) {
+		problem.Write(w, r, problem.New(http.StatusConflict, "Webhook was changed concurrently; fetch it and try again"))
+		return
+	}
+	if err != nil {
+		writeWebhookError(w, r, "update", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// deleteWebhookHandler removes the webhook; its delivery log expires on
+// its own and pending retries find the webhook gone and give up.
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := webhooks.Delete(r.Context(), webhookKey(webhook.ID)); err != nil {
+		writeWebhookError(w, r, "delete", err)
+		return
+	}
+	log.Printf("Client %s deleted webhook %s", webhook.OwnerID, webhook.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rotateSecretHandler replaces the signing secret at once; deliveries
+// already in flight are signed with the new one when they are retried.
+func rotateSecretHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	secret, err := newSecret()
+	if err != nil {
+		log.Printf("Failed to generate webhook secret: %v", err)
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+		return
+	}
+	webhook.Secret = secret
+	webhook.UpdatedAt = clk.Now().UTC()
+
+	err = webhooks.Update(r.Context(), webhookKey(webhook.ID), dynamo.Update{
+		Expression: "SET #secret = :secret, updated_at = :now",
+		Condition:  "attribute_exists(id)",
+		Names:      map[string]string{"#secret": "secret"},
+		Values: map[string]types.AttributeValue{
+			":secret": dynamo.S(secret),
+			":now":    dynamo.S(webhook.UpdatedAt.Format(time.RFC3339Nano)),
+		},
+	}, nil)
+	if err != nil {
+		writeWebhookError(w, r, "rotate the secret of", err)
+		return
+	}
+	log.Printf("Rotated secret of webhook %s", webhook.ID)
+	writeJSON(w, http.StatusOK, WebhookWithSecret{Webhook: webhook, Secret: secret})
+}
+
+// callerOwner returns the client calling, answering 401 or 403 when the
+// request does not come from a client allowed to manage webhooks.
+func callerOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	owner := r.Header.Get("X-Client-Id")
+	if owner == "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "Webhooks are managed by authenticated API clients"))
+		return "", false
+	}
+	for _, scope := range strings.Fields(r.Header.Get("X-Auth-Scope")) {
+		if scope == webhooksScope {
+			return owner, true
+		}
+	}
+	problem.Write(w, r, problem.New(http.StatusForbidden, "The "+webhooksScope+" scope is required to manage webhooks"))
+	return "", false
+}
+
+// ownedWebhook loads the webhook in the path, answering 404 when it is
+// missing or belongs to another client.
+func ownedWebhook(w http.ResponseWriter, r *http.Request) (Webhook, bool) {
+	owner, ok := callerOwner(w, r)
+	if !ok {
+		return Webhook{}, false
+	}
+	webhook, err := dynamo.Get[Webhook](r.Context(), webhooks, webhookKey(mux.Vars(r)["id"]))
+	if err == nil && webhook.OwnerID != owner {
+		err = dynamo.ErrNotFound
+	}
+	if err != nil {
+		writeWebhookError(w, r, "get", err)
+		return Webhook{}, false
+	}
+	return webhook, true
+}
+
+func writeWebhookError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	if errors.Is(err, dynamo.ErrNotFound) || errors.Is(err, dynamo.ErrConditionFailed) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "Webhook not found"))
+		return
+	}
+	log.Printf("Failed to %s webhook: %v", op, err)
+	problem.Write(w, r, problem.New(http.StatusInternalServerError, "Internal server error"))
+}
+
+// validateSubscription checks the endpoint and event types, returning
+// one error per problem.
+func validateSubscription(endpoint string, eventTypes []string) validate.Errors {
+	var errs validate.Errors
+	if err := checkEndpoint(endpoint); err != nil {
+		errs = append(errs, validate.FieldError{Field: "url", Rule: "endpoint", Message: err.Error()})
+	}
+	if len(eventTypes) == 0 {
+		errs = append(errs, validate.FieldError{Field: "event_types", Rule: "required", Message: "at least one event type is required"})
+	}
+	for i, eventType := range eventTypes {
+		if !eventTypePattern.MatchString(eventType) {
+			errs = append(errs, validate.FieldError{
+				Field:   fmt.Sprintf("event_types[%d]", i),
+				Rule:    "event_type",
+				Message: fmt.Sprintf("%q is not an order, user or campaign event type", eventType),
+			})
+		}
+	}
+	return errs
+}
+
+// checkEndpoint accepts absolute https URLs whose host is not a loopback
+// or private address. The address a name resolves to is checked again on
+// every delivery, so a name pointed inward later is refused then.
+func checkEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return errors.New("must be an absolute URL")
+	}
+	if u.Scheme != "https" && !(allowPrivateTargets && u.Scheme == "http") {
+		return errors.New("must use https")
+	}
+	if u.User != nil {
+		return errors.New("must not contain credentials")
+	}
+	if allowPrivateTargets {
+		return nil
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return errors.New("must not point at a private address")
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return errors.New("must not point at a private address")
+	}
+	return nil
+}
+
+// normalizeEventTypes drops duplicates, keeping the first occurrence.
+func normalizeEventTypes(eventTypes []string) []string {
+	seen := make(map[string]bool, len(eventTypes))
+	out := make([]string, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		if !seen[eventType] {
+			seen[eventType] = true
+			out = append(out, eventType)
+		}
+	}
+	return out
+}
+
+// subscribes reports whether the webhook wants events of eventType.
+func (wh Webhook) subscribes(eventType string) bool {
+	entity, _, _ := strings.Cut(eventType, ".")
+	for _, subscribed := range wh.EventTypes {
+		if subscribed == "*" || subscribed == eventType || subscribed == entity+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+// newSecret returns 32 random bytes, prefixed so leaked secrets are easy
+// to recognise in logs and scanners.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DynamoDB operations
+
+func webhookKey(id string) dynamo.Key {
+	return dynamo.StringKey("id", id)
+}
+
+// saveNewWebhook stores webhook unless its owner is at the limit. The
+// count is read first, so concurrent registrations can overshoot by a few;
+// the limit only guards against runaway clients.
+func saveNewWebhook(ctx context.Context, webhook Webhook) error {
+	existing, err := ownedWebhooks(ctx, webhook.OwnerID)
+	if err != nil {
+		return err
+	}
+	if len(existing) >= maxWebhooksPerClient {
+		return errWebhookLimit
+	}
+	return webhooks.Put(ctx, webhook, dynamo.IfNotExists("id"))
+}
+
+func ownedWebhooks(ctx context.Context, owner string) ([]Webhook, error) {
+	list, err := dynamo.QueryAll[Webhook](ctx, webhooks, dynamo.Query{
+		Index:        "owner_id-index",
+		KeyCondition: "owner_id = :owner",
+		Values:       map[string]types.AttributeValue{":owner": dynamo.S(owner)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks of %s: %w", owner, err)
+	}
+	if list == nil {
+		list = []Webhook{}
+	}
+	return list, nil
+}
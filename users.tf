@@ -0,0 +1,323 @@
+# Purge of soft-deleted users. user-service marks a deleted user and stamps
+# purge_at, deleted_at plus the retention period; this daily lambda deletes
+# users past it and enables DynamoDB TTL on purge_at as a backstop. The
+# users table itself is not managed by this stack.
+
+data "aws_dynamodb_table" "users" {
+  name = "users"
+}
+
+resource "aws_iam_role" "user_purge" {
+  name = "${var.project_name}-user-purge-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-user-purge-role"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "user_purge" {
+  name = "${var.project_name}-user-purge-policy"
+  role = aws_iam_role.user_purge.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "logs:CreateLogGroup",
+          "logs:CreateLogStream",
+          "logs:PutLogEvents"
+        ]
+        Resource = "arn:aws:logs:*:*:*"
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:Scan",
+          "dynamodb:DeleteItem",
+          "dynamodb:DescribeTimeToLive",
+          "dynamodb:UpdateTimeToLive"
+        ]
+        Resource = data.aws_dynamodb_table.users.arn
+      }
+    ]
+  })
+}
+
+data "archive_file" "user_purge_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/lambda/user-purge"
+  output_path = "${path.module}/lambda/user-purge.zip"
+}
+
+resource "aws_lambda_function" "user_purge" {
+  filename         = data.archive_file.user_purge_lambda.output_path
+  source_code_hash = data.archive_file.user_purge_lambda.output_base64sha256
+  function_name    = "${var.project_name}-user-purge"
+  role             = aws_iam_role.user_purge.arn
+  handler          = "main"
+  runtime          = "go1.x"
+  timeout          = 900
+
+  environment {
+    variables = {
+      USERS_TABLE_NAME = data.aws_dynamodb_table.users.name
+      ENVIRONMENT      = var.environment
+    }
+  }
+
+  tags = {
+    Name        = "${var.project_name}-user-purge"
+    Environment = var.environment
+  }
+}
+
+# Daily at 03:00 UTC, off peak for the users table
+resource "aws_cloudwatch_event_rule" "user_purge_schedule" {
+  name                = "${var.project_name}-user-purge-schedule"
+  description         = "Daily purge of soft-deleted users past retention"
+  schedule_expression = "cron(0 3 * * ? *)"
+
+  tags = {
+    Name        = "${var.project_name}-user-purge-schedule"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_target" "user_purge" {
+  rule      = aws_cloudwatch_event_rule.user_purge_schedule.name
+  target_id = "UserPurgeTarget"
+  arn       = aws_lambda_function.user_purge.arn
+}
+
+resource "aws_lambda_permission" "allow_cloudwatch_user_purge" {
+  statement_id  = "AllowExecutionFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.user_purge.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.user_purge_schedule.arn
+}
+
+resource "aws_cloudwatch_log_group" "user_purge_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.user_purge.function_name}"
+  retention_in_days = 14
+
+  tags = {
+    Name        = "${var.project_name}-user-purge-logs"
+    Environment = var.environment
+  }
+}
+
+# Bulk user imports. POST /users/batch writes up to a thousand users
+# inline; larger sets are uploaded as CSV or NDJSON to the imports bucket
+# and written by the user-import lambda, which records its progress on the
+# import and re-invokes itself to continue files it cannot finish in one
+# run. Uploaded files expire after a week.
+
+resource "aws_s3_bucket" "user_imports" {
+  bucket = "${var.project_name}-user-imports-${random_string.suffix.result}"
+
+  tags = {
+    Name        = "${var.project_name}-user-imports"
+    Environment = var.environment
+  }
+}
+
+resource "aws_s3_bucket_public_access_block" "user_imports" {
+  bucket = aws_s3_bucket.user_imports.id
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "user_imports" {
+  bucket = aws_s3_bucket.user_imports.id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "AES256"
+    }
+  }
+}
+
+resource "aws_s3_bucket_lifecycle_configuration" "user_imports" {
+  bucket = aws_s3_bucket.user_imports.id
+
+  rule {
+    id     = "expire-imports"
+    status = "Enabled"
+
+    filter {}
+
+    expiration {
+      days = 7
+    }
+  }
+}
+
+resource "aws_iam_role" "user_import" {
+  name = "${var.project_name}-user-import-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Action = "sts:AssumeRole"
+        Effect = "Allow"
+        Principal = {
+          Service = "lambda.amazonaws.com"
+        }
+      }
+    ]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-user-import-role"
+    Environment = var.environment
+  }
+}
+
+resource "aws_iam_role_policy" "user_import" {
+  name = "${var.project_name}-user-import-policy"
+  role = aws_iam_role.user_import.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "logs:CreateLogGroup",
+          "logs:CreateLogStream",
+          "logs:PutLogEvents"
+        ]
+        Resource = "arn:aws:logs:*:*:*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchWriteItem"]
+        Resource = data.aws_dynamodb_table.users.arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem"
+        ]
+        Resource = aws_dynamodb_table.user_imports.arn
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "${aws_s3_bucket.user_imports.arn}/*"
+      },
+      {
+        # Continues long imports in a fresh invocation
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = "arn:aws:lambda:*:*:function:${var.project_name}-user-import"
+      }
+    ]
+  })
+}
+
+data "archive_file" "user_import_lambda" {
+  type        = "zip"
+  source_dir  = "${path.module}/lambda/user-import"
+  output_path = "${path.module}/lambda/user-import.zip"
+}
+
+resource "aws_lambda_function" "user_import" {
+  filename         = data.archive_file.user_import_lambda.output_path
+  source_code_hash = data.archive_file.user_import_lambda.output_base64sha256
+  function_name    = "${var.project_name}-user-import"
+  role             = aws_iam_role.user_import.arn
+  handler          = "main"
+  runtime          = "go1.x"
+  timeout          = 900
+  memory_size      = 512
+
+  environment {
+    variables = {
+      USERS_TABLE_NAME        = data.aws_dynamodb_table.users.name
+      USER_IMPORTS_TABLE_NAME = aws_dynamodb_table.user_imports.name
+      USER_IMPORT_BUCKET      = aws_s3_bucket.user_imports.id
+      ENVIRONMENT             = var.environment
+    }
+  }
+
+  tags = {
+    Name        = "${var.project_name}-user-import"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_log_group" "user_import_logs" {
+  name              = "/aws/lambda/${aws_lambda_function.user_import.function_name}"
+  retention_in_days = 14
+
+  tags = {
+    Name        = "${var.project_name}-user-import-logs"
+    Environment = var.environment
+  }
+}
+
+# user-service writes inline batches, records imports and starts the
+# lambda once it has checked the uploaded file exists.
+resource "aws_iam_role_policy" "ecs_task_user_imports" {
+  name = "${var.project_name}-ecs-task-user-imports-policy"
+  role = "${var.project_name}-ecs-task-role"
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect   = "Allow"
+        Action   = ["dynamodb:BatchWriteItem"]
+        Resource = data.aws_dynamodb_table.users.arn
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem"
+        ]
+        Resource = aws_dynamodb_table.user_imports.arn
+      },
+      {
+        # HeadObject is authorised by s3:GetObject
+        Effect   = "Allow"
+        Action   = ["s3:GetObject"]
+        Resource = "${aws_s3_bucket.user_imports.arn}/*"
+      },
+      {
+        Effect   = "Allow"
+        Action   = ["lambda:InvokeFunction"]
+        Resource = aws_lambda_function.user_import.arn
+      }
+    ]
+  })
+}
+
+output "user_import_bucket" {
+  description = "Bucket to upload bulk user import files to"
+  value       = aws_s3_bucket.user_imports.id
+}
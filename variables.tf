@@ -182,8 +182,38 @@ variable "services" {
       environment_variables = {
         NODE_ENV = "production"
         PORT = "3000"
+        IDEMPOTENCY_TABLE_NAME = "ecommerce-platform-idempotency-keys"
+        CARTS_TABLE_NAME = "ecommerce-platform-carts"
+        CART_SERVICE_URL = "http://cart-service:3003"
+        ORDER_SERVICE_URL = "http://order-service:3002"
+        USER_MERGES_TABLE_NAME = "ecommerce-platform-user-merges"
+        AD_CLICKS_TABLE_NAME = "ecommerce-platform-ad-clicks"
+        USER_CONSENT_LOG_TABLE_NAME = "ecommerce-platform-user-consent-log"
+        EVENT_BUS_NAME = "ecommerce-platform-events"
+        DELETED_USER_RETENTION_DAYS = "30"
+        PRIVACY_REQUESTS_TABLE_NAME = "ecommerce-platform-privacy-requests"
+        PRIVACY_EXPORT_STATE_MACHINE_ARN = "arn:aws:states:us-east-1:ACCOUNT_ID:stateMachine:ecommerce-platform-privacy-export"
+        PRIVACY_ERASURE_STATE_MACHINE_ARN = "arn:aws:states:us-east-1:ACCOUNT_ID:stateMachine:ecommerce-platform-privacy-erasure"
+        # The bucket name carries a generated suffix; set it from the
+        # privacy_export_bucket output after the first apply
+        PRIVACY_EXPORT_BUCKET = "ecommerce-platform-privacy-exports"
+        # Generated IDs; set from the cognito_user_pool_id and
+        # cognito_client_id outputs after the first apply
+        COGNITO_USER_POOL_ID = "us-east-1_POOLID"
+        COGNITO_CLIENT_ID = "CLIENT_ID"
+        USER_IMPORTS_TABLE_NAME = "ecommerce-platform-user-imports"
+        USER_IMPORT_FUNCTION_NAME = "ecommerce-platform-user-import"
+        # Set from the user_import_bucket output after the first apply
+        USER_IMPORT_BUCKET = "ecommerce-platform-user-imports"
+        # Set to the Redis primary endpoint after the first apply; user
+        # reads are not cached while it is empty
+        REDIS_ADDR = ""
+        USER_CACHE_TTL = "30s"
+        USER_LIST_CACHE_TTL = "10s"
+      }
+      secrets = {
+        REDIS_AUTH_TOKEN = "/ecommerce-platform/redis/auth-token"
       }
-      secrets = {}
     },
     {
       name           = "product-service"
@@ -196,8 +226,16 @@ variable "services" {
       max_capacity   = 5
       health_check_path = "/health"
       environment_variables = {
-        NODE_ENV = "production"
         PORT = "3001"
+        PRODUCTS_TABLE_NAME = "ecommerce-platform-products"
+        PRICES_TABLE_NAME = "ecommerce-platform-product-prices"
+        EVENT_BUS_NAME = "ecommerce-platform-events"
+        IDEMPOTENCY_TABLE_NAME = "ecommerce-platform-idempotency-keys"
+        CART_SERVICE_URL = "http://cart-service:3003"
+        CHECKOUT_SERVICE_URL = "http://checkout-service:3011"
+        # The domain endpoint carries a generated suffix; set it from the
+        # product_search_endpoint output after the first apply
+        OPENSEARCH_ENDPOINT = "https://search-ecommerce-platform-products.us-east-1.es.amazonaws.com"
       }
       secrets = {}
     },
@@ -216,6 +254,292 @@ variable "services" {
         PORT = "3002"
       }
       secrets = {}
+    },
+    {
+      name           = "cart-service"
+      image          = "nginx:latest"
+      port           = 3003
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3003"
+        CARTS_TABLE_NAME = "ecommerce-platform-carts"
+        EVENT_BUS_NAME = "ecommerce-platform-events"
+        CART_IDLE_MINUTES = "60"
+        CART_TTL_DAYS = "30"
+        IDEMPOTENCY_TABLE_NAME = "ecommerce-platform-idempotency-keys"
+        PRODUCT_SERVICE_URL = "http://product-service:3001"
+      }
+      secrets = {}
+    },
+    {
+      name           = "inventory-service"
+      image          = "nginx:latest"
+      port           = 3004
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3004"
+        INVENTORY_TABLE_NAME = "ecommerce-platform-inventory"
+        RESERVATIONS_TABLE_NAME = "ecommerce-platform-inventory-reservations"
+        STOCK_MOVEMENTS_TABLE_NAME = "ecommerce-platform-stock-movements"
+        IDEMPOTENCY_TABLE_NAME = "ecommerce-platform-idempotency-keys"
+      }
+      secrets = {}
+    },
+    {
+      name           = "payment-service"
+      image          = "nginx:latest"
+      port           = 3005
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3005"
+        PAYMENTS_TABLE_NAME = "ecommerce-platform-payments"
+        WEBHOOK_EVENTS_TABLE_NAME = "ecommerce-platform-stripe-webhook-events"
+        EVENT_BUS_NAME = "ecommerce-platform-events"
+        IDEMPOTENCY_TABLE_NAME = "ecommerce-platform-idempotency-keys"
+      }
+      secrets = {
+        STRIPE_SECRET_KEY = "/ecommerce-platform/stripe/secret-key"
+        STRIPE_WEBHOOK_SECRET = "/ecommerce-platform/stripe/webhook-secret"
+      }
+    },
+    {
+      name           = "api-gateway"
+      image          = "nginx:latest"
+      port           = 8080
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 2
+      max_capacity   = 10
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "8080"
+        USER_SERVICE_URL = "http://user-service:3000"
+        PRODUCT_SERVICE_URL = "http://product-service:3001"
+        ORDER_SERVICE_URL = "http://order-service:3002"
+        CART_SERVICE_URL = "http://cart-service:3003"
+        GRAPHQL_SERVICE_URL = "http://graphql-service:3006"
+        WEBHOOK_SERVICE_URL = "http://webhook-service:3008"
+        ADS_API_URL = "http://ads-api:3000"
+        REPORTS_SERVICE_URL = "http://reports-service:3009"
+        NOTIFICATION_SERVICE_URL = "http://notification-service:3010"
+        CHECKOUT_SERVICE_URL = "http://checkout-service:3011"
+        ATTRIBUTION_SERVICE_URL = "http://attribution-service:3012"
+        JWT_ISSUER = "https://auth.ecommerce-platform.com"
+        JWT_AUDIENCE = "ecommerce-api"
+        JWT_TENANT_CLAIM = "custom:tenant_id"
+        RATE_LIMIT_RPS = "20"
+        RATE_LIMIT_BURST = "40"
+      }
+      secrets = {
+        JWT_HMAC_SECRET = "/ecommerce-platform/api-gateway/jwt-secret"
+      }
+    },
+    {
+      name           = "graphql-service"
+      image          = "nginx:latest"
+      port           = 3006
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3006"
+        USER_SERVICE_URL = "http://user-service:3000"
+        PRODUCT_SERVICE_URL = "http://product-service:3001"
+        ORDER_SERVICE_URL = "http://order-service:3002"
+        ADS_API_URL = "http://ads-api:3000"
+      }
+      secrets = {}
+    },
+    {
+      name           = "recommendation-service"
+      image          = "nginx:latest"
+      port           = 3007
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3007"
+        CO_PURCHASES_TABLE_NAME = "ecommerce-platform-co-purchases"
+        USER_PURCHASES_TABLE_NAME = "ecommerce-platform-user-purchases"
+        PROCESSED_ORDERS_TABLE_NAME = "ecommerce-platform-recommendation-orders"
+        ORDER_EVENTS_QUEUE_URL = "https://sqs.us-east-1.amazonaws.com/ACCOUNT_ID/ecommerce-platform-recommendation-order-events"
+        MIN_CO_PURCHASES = "2"
+      }
+      secrets = {}
+    },
+    {
+      name           = "webhook-service"
+      image          = "nginx:latest"
+      port           = 3008
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3008"
+        WEBHOOKS_TABLE_NAME = "ecommerce-platform-webhooks"
+        WEBHOOK_DELIVERIES_TABLE_NAME = "ecommerce-platform-webhook-deliveries"
+        # Queue URLs from the webhook_queue_urls output
+        WEBHOOK_EVENTS_QUEUE_URL = "https://sqs.us-east-1.amazonaws.com/ACCOUNT_ID/ecommerce-platform-webhook-events"
+        WEBHOOK_DELIVERIES_QUEUE_URL = "https://sqs.us-east-1.amazonaws.com/ACCOUNT_ID/ecommerce-platform-webhook-deliveries"
+        WEBHOOK_DLQ_URL = "https://sqs.us-east-1.amazonaws.com/ACCOUNT_ID/ecommerce-platform-webhook-dlq"
+        WEBHOOK_MAX_ATTEMPTS = "8"
+        WEBHOOK_DELIVERY_WORKERS = "4"
+      }
+      secrets = {}
+    },
+    {
+      name           = "reports-service"
+      image          = "nginx:latest"
+      port           = 3009
+      cpu            = 256
+      memory         = 512
+      desired_count  = 1
+      min_capacity   = 1
+      max_capacity   = 3
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3009"
+        ACCOUNTS_TABLE_NAME = "ecommerce-platform-google-ads-accounts-dev"
+        GOOGLE_ADS_SECRET_ARN = "arn:aws:secretsmanager:us-east-1:ACCOUNT_ID:secret:ecommerce-platform/google-ads/credentials"
+        REPORT_CACHE_TTL = "15m"
+        REPORT_CACHE_SETTLED_TTL = "24h"
+        REPORT_CACHE_MAX_ENTRIES = "1000"
+        CHECKOUTS_TABLE_NAME = "ecommerce-platform-checkouts"
+        ADS_PLATFORMS_SECRET_ARN = "arn:aws:secretsmanager:us-east-1:ACCOUNT_ID:secret:ecommerce-platform/ads-platforms/credentials"
+        FX_RATES = "{}"
+        NEW_CUSTOMER_LOOKBACK_DAYS = "365"
+        ATTRIBUTIONS_TABLE_NAME = "ecommerce-platform-attributions"
+        ATTRIBUTION_MODELS_TABLE_NAME = "ecommerce-platform-attribution-models"
+      }
+      secrets = {}
+    },
+    {
+      name           = "ads-api"
+      image          = "nginx:latest"
+      port           = 3000
+      cpu            = 256
+      memory         = 512
+      desired_count  = 1
+      min_capacity   = 1
+      max_capacity   = 3
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3000"
+        ACCOUNTS_TABLE_NAME = "ecommerce-platform-google-ads-accounts-dev"
+        ACCOUNT_CONFIG_TABLE_NAME = "ecommerce-platform-google-ads-account-config-dev"
+        BASELINES_TABLE_NAME = "ecommerce-platform-google-ads-baselines-dev"
+        SETTINGS_AUDIT_TABLE_NAME = "ecommerce-platform-google-ads-settings-audit-dev"
+        RUNS_TABLE_NAME = "ecommerce-platform-google-ads-runs-dev"
+        APPROVALS_TABLE_NAME = "ecommerce-platform-google-ads-approvals-dev"
+        BID_AUDIT_TABLE_NAME = "ecommerce-platform-google-ads-bid-audit-dev"
+        SEASONALITY_TABLE_NAME = "ecommerce-platform-google-ads-seasonality-dev"
+        ANALYTICS_TABLE_NAME = "ecommerce-platform-analytics-dev"
+        GOOGLE_ADS_SECRET_ARN = "arn:aws:secretsmanager:us-east-1:ACCOUNT_ID:secret:ecommerce-platform/google-ads/credentials"
+        APPROVAL_SIGNING_SECRET_ARN = "arn:aws:secretsmanager:us-east-1:ACCOUNT_ID:secret:ecommerce-platform/google-ads/approval-signing-key"
+      }
+      secrets = {}
+    },
+    {
+      name           = "notification-service"
+      image          = "nginx:latest"
+      port           = 3010
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3010"
+        NOTIFICATIONS_TABLE_NAME = "ecommerce-platform-notifications"
+        EMAIL_SUPPRESSIONS_TABLE_NAME = "ecommerce-platform-email-suppressions"
+        NOTIFICATION_PREFERENCES_TABLE_NAME = "ecommerce-platform-notification-preferences"
+        USERS_TABLE_NAME = "users"
+        # Queue URLs from the notification_queue_urls output
+        NOTIFICATION_EVENTS_QUEUE_URL = "https://sqs.us-east-1.amazonaws.com/ACCOUNT_ID/ecommerce-platform-notification-events"
+        SES_FEEDBACK_QUEUE_URL = "https://sqs.us-east-1.amazonaws.com/ACCOUNT_ID/ecommerce-platform-ses-feedback"
+        MESSAGE_RECEIPTS_QUEUE_URL = "https://sqs.us-east-1.amazonaws.com/ACCOUNT_ID/ecommerce-platform-message-receipts"
+        SES_FROM_ADDRESS = "no-reply@ecommerce-platform.com"
+        SES_CONFIGURATION_SET = "ecommerce-platform-notifications"
+        SES_TEMPLATE_PREFIX = "ecommerce-platform"
+        NOTIFICATION_LOCALES = "en,fr"
+        DEFAULT_LOCALE = "en"
+        SMS_CONFIGURATION_SET = "ecommerce-platform-notifications"
+        # The End User Messaging SMS number or pool texts are sent from, and
+        # the phone number ID of the WhatsApp Business Account linked to End
+        # User Messaging Social in the console
+        SMS_ORIGINATION_IDENTITY = ""
+        WHATSAPP_PHONE_NUMBER_ID = ""
+      }
+      secrets = {}
+    },
+    {
+      name           = "checkout-service"
+      image          = "nginx:latest"
+      port           = 3011
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3011"
+        CHECKOUTS_TABLE_NAME = "ecommerce-platform-checkouts"
+        COUPONS_TABLE_NAME = "ecommerce-platform-coupons"
+        IDEMPOTENCY_TABLE_NAME = "ecommerce-platform-idempotency-keys"
+        CART_SERVICE_URL = "http://cart-service:3003"
+        INVENTORY_SERVICE_URL = "http://inventory-service:3004"
+        PAYMENT_SERVICE_URL = "http://payment-service:3005"
+        ORDER_SERVICE_URL = "http://order-service:3002"
+        PRODUCT_SERVICE_URL = "http://product-service:3001"
+        ATTRIBUTION_SERVICE_URL = "http://attribution-service:3012"
+        CHECKOUT_STUCK_MINUTES = "5"
+      }
+      secrets = {}
+    },
+    {
+      name           = "attribution-service"
+      image          = "nginx:latest"
+      port           = 3012
+      cpu            = 256
+      memory         = 512
+      desired_count  = 2
+      min_capacity   = 1
+      max_capacity   = 5
+      health_check_path = "/health"
+      environment_variables = {
+        PORT = "3012"
+        AD_CLICKS_TABLE_NAME = "ecommerce-platform-ad-clicks"
+        ATTRIBUTIONS_TABLE_NAME = "ecommerce-platform-attributions"
+        ATTRIBUTION_LOOKBACK_DAYS = "30"
+      }
+      secrets = {}
     }
   ]
 }
@@ -537,6 +861,50 @@ variable "optimization_interval" {
   default     = "60"
 }
 
+variable "bid_experiment_id" {
+  description = "Name of the running bid strategy experiment; empty applies the optimizer to every campaign"
+  type        = string
+  default     = ""
+}
+
+variable "fx_rates" {
+  description = "Units of each non-USD account currency per US dollar, e.g. { EUR = 0.92 }; alert and bid thresholds are written in dollars"
+  type        = map(number)
+  default     = {}
+}
+
+variable "bid_rules_file" {
+  description = "Path to a YAML or JSON bid rules document replacing the bid optimizer's built-in performance rules; empty keeps them"
+  type        = string
+  default     = ""
+}
+
+variable "lambda_warmer_schedule" {
+  description = "Schedule of the ping that keeps the queue and event driven Google Ads functions warm; empty disables it"
+  type        = string
+  default     = "rate(5 minutes)"
+}
+
+variable "lambda_provisioned_concurrency" {
+  description = "Provisioned concurrency of each queue and event driven Google Ads function; 0 leaves them on demand, kept warm by lambda_warmer_schedule"
+  type        = number
+  default     = 0
+}
+
+variable "pagespeed_api_key" {
+  description = "PageSpeed Insights API key for the landing page checker's Lighthouse mobile audits; empty skips them"
+  type        = string
+  default     = ""
+  sensitive   = true
+}
+
+variable "ads_platforms_config" {
+  description = "JSON with the \"microsoft\" and \"meta\" credentials and account IDs the bid optimizer, campaign monitor and bid applier also run; see docs/GOOGLE_ADS_INTEGRATION.md"
+  type        = string
+  default     = "{}"
+  sensitive   = true
+}
+
 # Deep Seek API Configuration
 variable "deepseek_api_key" {
   description = "Deep Seek API key for AI services"
@@ -549,3 +917,74 @@ variable "deepseek_api_url" {
   type        = string
   default     = "https://api.deepseek.com/v1"
 }
+
+variable "cart_abandoners_list_id" {
+  description = "Google Ads Customer Match user list ID for cart abandoners"
+  type        = string
+  default     = ""
+}
+
+variable "purchasers_list_id" {
+  description = "Google Ads Customer Match user list ID for purchasers"
+  type        = string
+  default     = ""
+}
+
+variable "registered_users_list_id" {
+  description = "Google Ads Customer Match user list ID for registered users"
+  type        = string
+  default     = ""
+}
+
+variable "high_ltv_list_id" {
+  description = "Google Ads Customer Match user list ID for the high lifetime value tier"
+  type        = string
+  default     = ""
+}
+
+variable "lookalike_seed_list_id" {
+  description = "Google Ads Customer Match user list ID the high-LTV lookalike seed is exported to; empty disables the export"
+  type        = string
+  default     = ""
+}
+
+variable "ltv_conversion_values" {
+  description = "Scale uploaded conversion values by each customer's LTV value multiplier"
+  type        = bool
+  default     = false
+}
+
+# Transactional email (notification-service)
+variable "notification_locales" {
+  description = "Locales SES email templates are created for; keep NOTIFICATION_LOCALES of notification-service in step"
+  type        = list(string)
+  default     = ["en", "fr"]
+}
+
+
+# GA4 Measurement Protocol (ga4-forwarder)
+variable "ga4_measurement_id" {
+  description = "GA4 web stream measurement ID (G-XXXXXXX) purchases and refunds are sent to"
+  type        = string
+  default     = ""
+}
+
+variable "ga4_api_secret" {
+  description = "Measurement Protocol API secret of the GA4 web stream"
+  type        = string
+  default     = ""
+  sensitive   = true
+}
+
+variable "ga4_debug_validation" {
+  description = "Send events to the Measurement Protocol validation endpoint instead of recording them"
+  type        = bool
+  default     = false
+}
+
+# Privacy requests (privacy-worker)
+variable "order_service_url" {
+  description = "Base URL the privacy-worker reaches order-service at to export and anonymize orders; empty leaves orders out of privacy requests"
+  type        = string
+  default     = ""
+}
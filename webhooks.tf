@@ -0,0 +1,170 @@
+# Outbound webhooks. Order and user events from EventBridge and campaign
+# alerts from the alerts topic land on one events queue, which
+# webhook-service fans out into a delivery job per subscribed webhook.
+# Failed deliveries are retried by delaying their job on the deliveries
+# queue; jobs that exhaust their attempts are moved to the dead-letter
+# queue by the service, and ones that keep crashing it by the redrive
+# policy.
+resource "aws_sqs_queue" "webhook_dlq" {
+  name                      = "${var.project_name}-webhook-dlq"
+  message_retention_seconds = 1209600
+  sqs_managed_sse_enabled   = true
+
+  tags = {
+    Name        = "${var.project_name}-webhook-dlq"
+    Environment = var.environment
+  }
+}
+
+resource "aws_sqs_queue" "webhook_events" {
+  name                       = "${var.project_name}-webhook-events"
+  visibility_timeout_seconds = 60
+  receive_wait_time_seconds  = 20
+  sqs_managed_sse_enabled    = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.webhook_dlq.arn
+    maxReceiveCount     = 5
+  })
+
+  tags = {
+    Name        = "${var.project_name}-webhook-events"
+    Environment = var.environment
+  }
+}
+
+# Workers take up to ten jobs per receive and send them in turn, each
+# bounded by a 10 second timeout. Every retry is a receive, so the
+# redrive count sits well above WEBHOOK_MAX_ATTEMPTS.
+resource "aws_sqs_queue" "webhook_deliveries" {
+  name                       = "${var.project_name}-webhook-deliveries"
+  visibility_timeout_seconds = 180
+  receive_wait_time_seconds  = 20
+  message_retention_seconds  = 345600
+  sqs_managed_sse_enabled    = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.webhook_dlq.arn
+    maxReceiveCount     = 20
+  })
+
+  tags = {
+    Name        = "${var.project_name}-webhook-deliveries"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "webhook_events" {
+  name           = "${var.project_name}-webhook-events"
+  description    = "Order and user events delivered to webhooks"
+  event_bus_name = aws_cloudwatch_event_bus.ecommerce.name
+
+  event_pattern = jsonencode({
+    source = ["ecommerce.order-service", "ecommerce.user-service"]
+  })
+
+  tags = {
+    Name        = "${var.project_name}-webhook-events"
+    Environment = var.environment
+  }
+}
+
+resource "aws_cloudwatch_event_target" "webhook_events" {
+  rule           = aws_cloudwatch_event_rule.webhook_events.name
+  event_bus_name = aws_cloudwatch_event_bus.ecommerce.name
+  target_id      = "WebhookEvents"
+  arn            = aws_sqs_queue.webhook_events.arn
+}
+
+# Raw delivery keeps the alert envelope as the message body, the same
+# shape the service reads from EventBridge events.
+resource "aws_sns_topic_subscription" "webhook_alerts" {
+  topic_arn            = module.monitoring.sns_topic_arn
+  protocol             = "sqs"
+  endpoint             = aws_sqs_queue.webhook_events.arn
+  raw_message_delivery = true
+}
+
+resource "aws_sqs_queue_policy" "webhook_events" {
+  queue_url = aws_sqs_queue.webhook_events.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { Service = "events.amazonaws.com" }
+        Action    = "sqs:SendMessage"
+        Resource  = aws_sqs_queue.webhook_events.arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = aws_cloudwatch_event_rule.webhook_events.arn
+          }
+        }
+      },
+      {
+        Effect    = "Allow"
+        Principal = { Service = "sns.amazonaws.com" }
+        Action    = "sqs:SendMessage"
+        Resource  = aws_sqs_queue.webhook_events.arn
+        Condition = {
+          ArnEquals = {
+            "aws:SourceArn" = module.monitoring.sns_topic_arn
+          }
+        }
+      }
+    ]
+  })
+}
+
+# webhook-service manages webhooks and their delivery log, and consumes
+# and produces the queues above.
+resource "aws_iam_role_policy" "ecs_task_webhooks" {
+  name = "${var.project_name}-ecs-task-webhooks-policy"
+  role = "${var.project_name}-ecs-task-role"
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Action = [
+          "dynamodb:GetItem",
+          "dynamodb:PutItem",
+          "dynamodb:UpdateItem",
+          "dynamodb:DeleteItem",
+          "dynamodb:Query",
+          "dynamodb:Scan"
+        ]
+        Resource = [
+          aws_dynamodb_table.webhooks.arn,
+          "${aws_dynamodb_table.webhooks.arn}/index/*",
+          aws_dynamodb_table.webhook_deliveries.arn
+        ]
+      },
+      {
+        Effect = "Allow"
+        Action = [
+          "sqs:ReceiveMessage",
+          "sqs:DeleteMessage",
+          "sqs:ChangeMessageVisibility",
+          "sqs:SendMessage"
+        ]
+        Resource = [
+          aws_sqs_queue.webhook_events.arn,
+          aws_sqs_queue.webhook_deliveries.arn,
+          aws_sqs_queue.webhook_dlq.arn
+        ]
+      }
+    ]
+  })
+}
+
+output "webhook_queue_urls" {
+  description = "Queues feeding webhook-service"
+  value = {
+    events     = aws_sqs_queue.webhook_events.url
+    deliveries = aws_sqs_queue.webhook_deliveries.url
+    dlq        = aws_sqs_queue.webhook_dlq.url
+  }
+}